@@ -140,6 +140,12 @@ type Environment struct {
 	// GomoteTransferBucket is the bucket used by the gomote GRPC service
 	// to transfer files between gomote clients and the gomote instances.
 	GomoteTransferBucket string
+
+	// GomoteAttachmentBucket is the bucket the gomote GRPC service
+	// uploads files shared from gomote instances to, for linking to
+	// from issues. It must be publicly readable, and have a lifecycle
+	// rule that deletes objects after 30 days.
+	GomoteAttachmentBucket string
 }
 
 // ComputePrefix returns the URI prefix for Compute Engine resources in a project.
@@ -291,7 +297,8 @@ var Production = &Environment{
 		"coordinator-internal-iap": "7963570695201399464",
 		"relui-internal":           "155577380958854618",
 	},
-	GomoteTransferBucket: "gomote-transfer",
+	GomoteTransferBucket:   "gomote-transfer",
+	GomoteAttachmentBucket: "gomote-attachments",
 }
 
 var LUCIProduction = &Environment{
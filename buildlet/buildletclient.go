@@ -17,9 +17,12 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
+
+	"golang.org/x/build/internal/envutil"
 )
 
 var _ Client = (*client)(nil)
@@ -62,23 +65,24 @@ var ErrClosed = errors.New("buildlet: Client closed")
 
 // Close destroys and closes down the buildlet, destroying all state
 // immediately.
+//
+// Closing the client cancels any of its RPCs that are in flight.
 func (c *client) Close() error {
-	// TODO(bradfitz): have a Client-wide Done channel we set on
-	// all outbound HTTP Requests and close it in the once here?
-	// Then if something was in-flight and somebody else Closes,
-	// the local http.Transport notices, rather than noticing via
-	// the remote machine dying or timing out.
 	c.closeOnce.Do(func() {
 		// Send a best-effort notification to the server to destroy itself.
 		// Don't want too long (since it's likely in a broken state anyway).
 		// Ignore the return value, since we're about to forcefully destroy
-		// it anyway.
-		req, err := http.NewRequest("POST", c.URL()+"/halt", nil)
-		if err != nil {
-			// ignore.
-		} else {
-			_, err = c.doHeaderTimeout(req, 2*time.Second)
+		// it anyway. Use send rather than do: the client may already be
+		// marked broken, and the remote should be told to halt regardless.
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		req, err := http.NewRequestWithContext(ctx, "POST", c.URL()+"/halt", nil)
+		if err == nil {
+			var res *http.Response
+			if res, err = c.send(req); err == nil {
+				res.Body.Close()
+			}
 		}
+		cancel()
 		if err == nil {
 			err = ErrClosed
 		}
@@ -127,6 +131,51 @@ func (c *client) SetHTTPClient(httpClient *http.Client) {
 	c.httpClient = httpClient
 }
 
+// Timeouts are the default timeouts of a Client's RPCs.
+type Timeouts struct {
+	// Headers is how long Exec, Status and WorkDir wait for response
+	// headers before giving up. A buildlet that doesn't send Exec
+	// headers in time is marked broken. Zero means 20 seconds.
+	Headers time.Duration
+
+	// RPC limits the duration of RPCs other than Exec whose context
+	// has no deadline. Zero means no limit.
+	RPC time.Duration
+
+	// Exec limits the duration of Exec calls whose context has no
+	// deadline. Zero means no limit.
+	Exec time.Duration
+}
+
+// defaultHeaderTimeout is the default value of Timeouts.Headers.
+//
+// The first thing the buildlet's exec handler does is flush the headers, so
+// 20 seconds should be plenty of time, regardless of where on the planet
+// (Atlanta, Paris, Sydney, etc.) the reverse buildlet is.
+const defaultHeaderTimeout = 20 * time.Second
+
+// SetTimeouts sets the default timeouts of the client's RPCs.
+// It should only be called before the Client is used.
+func (c *client) SetTimeouts(t Timeouts) {
+	c.timeouts = t
+}
+
+func (c *client) headerTimeout() time.Duration {
+	if c.timeouts.Headers > 0 {
+		return c.timeouts.Headers
+	}
+	return defaultHeaderTimeout
+}
+
+// rpcContext returns the context for an RPC: ctx, with a timeout of d
+// if d is positive and ctx has no deadline of its own.
+func rpcContext(ctx context.Context, d time.Duration) (context.Context, context.CancelFunc) {
+	if _, ok := ctx.Deadline(); ok || d <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, d)
+}
+
 // SetDialer sets the function that creates a new connection to the buildlet.
 // By default, net.Dialer.DialContext is used. SetDialer has effect only when
 // TLS isn't used.
@@ -166,7 +215,8 @@ type client struct {
 
 	closeFuncs []func() // optional extra code to run on close
 
-	ctx              context.Context
+	timeouts         Timeouts
+	ctx              context.Context // canceled when the client is marked broken
 	ctxCancel        context.CancelFunc
 	heartbeatFailure func() // optional
 	desc             string
@@ -249,7 +299,31 @@ func (c *client) authUsername() string {
 	return "gomote"
 }
 
+// do sends req. The request is canceled if the client is marked
+// broken or closed before the response body is read to EOF or closed.
 func (c *client) do(req *http.Request) (*http.Response, error) {
+	ctx, cancel := context.WithCancel(req.Context())
+	go func() {
+		select {
+		case <-c.ctx.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	res, err := c.send(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		if c.ctx.Err() != nil && req.Context().Err() == nil {
+			return nil, fmt.Errorf("buildlet: client marked broken: %w", err)
+		}
+		return nil, err
+	}
+	res.Body = onEOFReadCloser{res.Body, cancel}
+	return res, nil
+}
+
+// send sends req as is, without tying it to the client's lifetime.
+func (c *client) send(req *http.Request) (*http.Response, error) {
 	c.initHeartbeatOnce.Do(c.initHeartbeats)
 	if c.password != "" {
 		req.SetBasicAuth(c.authUsername(), c.password)
@@ -265,16 +339,21 @@ func (c *client) do(req *http.Request) (*http.Response, error) {
 // and the target type must be a VM type running on GCE. This was primarily
 // created for RDP to Windows machines, but it might get reused for other
 // purposes in the future.
-func (c *client) ProxyTCP(port int) (io.ReadWriteCloser, error) {
+//
+// ctx bounds establishing the connection; the returned connection
+// stays open until it is closed.
+func (c *client) ProxyTCP(ctx context.Context, port int) (io.ReadWriteCloser, error) {
 	if c.RemoteName() == "" {
 		return nil, errors.New("ProxyTCP currently only supports gomote-created buildlets")
 	}
-	req, err := http.NewRequest("POST", c.URL()+"/tcpproxy", nil)
+	req, err := http.NewRequestWithContext(ctx, "POST", c.URL()+"/tcpproxy", nil)
 	if err != nil {
 		return nil, err
 	}
 	req.Header.Add("X-Target-Port", fmt.Sprint(port))
-	res, err := c.do(req)
+	// The response body is the proxied connection, so use send:
+	// wrapping it as do does would hide its io.Writer.
+	res, err := c.send(req)
 	if err != nil {
 		return nil, err
 	}
@@ -390,19 +469,43 @@ func (c *client) doHeaderTimeout(req *http.Request, max time.Duration) (res *htt
 }
 
 // doOK sends the request and expects a 200 OK response.
+// The client's RPC timeout applies.
 func (c *client) doOK(req *http.Request) error {
-	res, err := c.do(req)
+	ctx, cancel := rpcContext(req.Context(), c.timeouts.RPC)
+	defer cancel()
+	res, err := c.do(req.WithContext(ctx))
 	if err != nil {
 		return err
 	}
 	defer res.Body.Close()
 	if res.StatusCode != http.StatusOK {
 		slurp, _ := ioutil.ReadAll(io.LimitReader(res.Body, 4<<10))
-		return fmt.Errorf("%v; body: %s", res.Status, slurp)
+		return statusError(res, slurp)
 	}
 	return nil
 }
 
+// ErrDiskFull is returned by the methods of a Client that write to
+// the buildlet's work directory when its host's disk is full.
+var ErrDiskFull = errors.New("buildlet: host disk is full")
+
+// ErrWorkDirQuotaExceeded is returned by the methods of a Client that
+// write to the buildlet's work directory when the write would take it
+// over the quota set by SetWorkDirQuota.
+var ErrWorkDirQuotaExceeded = errors.New("buildlet: work directory quota exceeded")
+
+// statusError returns the error for the non-OK response res with
+// body slurp.
+func statusError(res *http.Response, slurp []byte) error {
+	switch res.StatusCode {
+	case http.StatusInsufficientStorage:
+		return fmt.Errorf("%w; body: %s", ErrDiskFull, slurp)
+	case http.StatusRequestEntityTooLarge:
+		return fmt.Errorf("%w; body: %s", ErrWorkDirQuotaExceeded, slurp)
+	}
+	return fmt.Errorf("%v; body: %s", res.Status, slurp)
+}
+
 // PutTar writes files to the remote buildlet, rooted at the relative
 // directory dir.
 // If dir is empty, they're placed at the root of the buildlet's work directory.
@@ -450,20 +553,24 @@ func (c *client) Put(ctx context.Context, r io.Reader, path string, mode os.File
 // GetTar returns a .tar.gz stream of the given directory, relative to the buildlet's work dir.
 // The provided dir may be empty to get everything.
 func (c *client) GetTar(ctx context.Context, dir string) (io.ReadCloser, error) {
-	req, err := http.NewRequest("GET", c.URL()+"/tgz?dir="+url.QueryEscape(dir), nil)
+	ctx, cancel := rpcContext(ctx, c.timeouts.RPC)
+	req, err := http.NewRequestWithContext(ctx, "GET", c.URL()+"/tgz?dir="+url.QueryEscape(dir), nil)
 	if err != nil {
+		cancel()
 		return nil, err
 	}
-	res, err := c.do(req.WithContext(ctx))
+	res, err := c.do(req)
 	if err != nil {
+		cancel()
 		return nil, err
 	}
 	if res.StatusCode != http.StatusOK {
 		slurp, _ := ioutil.ReadAll(io.LimitReader(res.Body, 4<<10))
 		res.Body.Close()
+		cancel()
 		return nil, fmt.Errorf("%v; body: %s", res.Status, slurp)
 	}
-	return res.Body, nil
+	return onEOFReadCloser{res.Body, cancel}, nil
 }
 
 // ExecOpts are options for a remote command invocation.
@@ -501,6 +608,12 @@ type ExecOpts struct {
 	// environment variable.
 	Path []string
 
+	// EnvProfile, if non-nil, is the environment profile the
+	// buildlet applies to the environment the command inherits
+	// from it. ExtraEnv and Path are applied after it. Buildlets
+	// older than version 34 ignore it.
+	EnvProfile *envutil.Profile
+
 	// SystemLevel controls whether the command is expected to be found outside of
 	// the buildlet's environment.
 	SystemLevel bool
@@ -509,10 +622,44 @@ type ExecOpts struct {
 	// info to the output before the command begins executing.
 	Debug bool
 
+	// Timeout, if positive, is how long the buildlet lets the command
+	// run before killing it and its descendants. Unlike when the
+	// context's deadline is exceeded, the command is then reported to
+	// have failed remotely, and the buildlet isn't marked broken.
+	// Buildlets since version 35 first write the state of the
+	// system to Output, and send SIGQUIT to the command so that Go
+	// programs dump their goroutines.
+	Timeout time.Duration
+
 	// OnStartExec is an optional hook that runs after the 200 OK
 	// response from the buildlet, but before the output begins
 	// writing to Output.
 	OnStartExec func()
+
+	// OnUsage is an optional hook that runs after the command
+	// finishes, successfully or not, with the resources it used.
+	// It isn't run if the buildlet didn't report them.
+	OnUsage func(ExecUsage)
+}
+
+// ExecUsage is the resource usage of a command run by Client.Exec,
+// including that of the descendants it waited for.
+type ExecUsage struct {
+	CPUTime time.Duration // user and system CPU time
+	MaxRSS  int64         // peak resident set size in bytes, or 0 if unknown
+
+	// ReadBytes and WriteBytes are the bytes read from and written to
+	// storage, not counting those served by or left in the page cache.
+	// They're 0 if unknown, as they are on buildlets other than Linux
+	// ones.
+	ReadBytes, WriteBytes int64
+
+	// NetRecvBytes and NetSentBytes are the bytes received and sent
+	// on the buildlet machine's network interfaces while the command
+	// ran. They include the traffic of anything else running on the
+	// machine, such as the command's output streamed back to the
+	// client. They're 0 if unknown.
+	NetRecvBytes, NetSentBytes int64
 }
 
 // ErrTimeout is a sentinel error that represents that waiting
@@ -553,17 +700,25 @@ func (c *client) Exec(ctx context.Context, cmd string, opts ExecOpts) (remoteErr
 		"path":   path,
 		"debug":  {fmt.Sprint(opts.Debug)},
 	}
-	req, err := http.NewRequest("POST", c.URL()+"/exec", strings.NewReader(form.Encode()))
+	if opts.Timeout > 0 {
+		form.Set("timeout", opts.Timeout.String())
+	}
+	if opts.EnvProfile != nil {
+		b, err := json.Marshal(opts.EnvProfile)
+		if err != nil {
+			return nil, fmt.Errorf("encoding environment profile: %v", err)
+		}
+		form.Set("envProfile", string(b))
+	}
+	ctx, cancel := rpcContext(ctx, c.timeouts.Exec)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "POST", c.URL()+"/exec", strings.NewReader(form.Encode()))
 	if err != nil {
 		return nil, err
 	}
-	req = req.WithContext(ctx)
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 
-	// The first thing the buildlet's exec handler does is flush the headers, so
-	// 20 seconds should be plenty of time, regardless of where on the planet
-	// (Atlanta, Paris, Sydney, etc.) the reverse buildlet is:
-	res, err := c.doHeaderTimeout(req, 20*time.Second)
+	res, err := c.doHeaderTimeout(req, c.headerTimeout())
 	if err == errHeaderTimeout {
 		// If we don't see headers after all that time,
 		// consider the buildlet to be unhealthy.
@@ -604,6 +759,11 @@ func (c *client) Exec(ctx context.Context, cmd string, opts ExecOpts) (remoteErr
 			resc <- errs{execErr: errors.New("missing Process-State trailer from HTTP response; buildlet built with old (<= 1.4) Go?")}
 			return
 		}
+		if opts.OnUsage != nil {
+			if u, ok := parseExecUsage(res.Trailer); ok {
+				opts.OnUsage(u)
+			}
+		}
 		if state != "ok" {
 			resc <- errs{remoteErr: errors.New(state)}
 		} else {
@@ -631,6 +791,23 @@ func (c *client) Exec(ctx context.Context, cmd string, opts ExecOpts) (remoteErr
 	}
 }
 
+// parseExecUsage parses the resource usage trailers of an /exec
+// response, which buildlets older than version 31 don't send. Those
+// older than version 32 don't send the I/O ones.
+func parseExecUsage(trailer http.Header) (u ExecUsage, ok bool) {
+	cpu, err := strconv.ParseFloat(trailer.Get("Process-CPU-Seconds"), 64)
+	if err != nil {
+		return ExecUsage{}, false
+	}
+	u.CPUTime = time.Duration(cpu * float64(time.Second))
+	u.MaxRSS, _ = strconv.ParseInt(trailer.Get("Process-Max-RSS"), 10, 64)
+	u.ReadBytes, _ = strconv.ParseInt(trailer.Get("Process-Read-Bytes"), 10, 64)
+	u.WriteBytes, _ = strconv.ParseInt(trailer.Get("Process-Write-Bytes"), 10, 64)
+	u.NetRecvBytes, _ = strconv.ParseInt(trailer.Get("Process-Net-Recv-Bytes"), 10, 64)
+	u.NetSentBytes, _ = strconv.ParseInt(trailer.Get("Process-Net-Sent-Bytes"), 10, 64)
+	return u, true
+}
+
 // RemoveAll deletes the provided paths, relative to the work directory.
 func (c *client) RemoveAll(ctx context.Context, paths ...string) error {
 	if len(paths) == 0 {
@@ -645,6 +822,52 @@ func (c *client) RemoveAll(ctx context.Context, paths ...string) error {
 	return c.doOK(req.WithContext(ctx))
 }
 
+// SetWorkDirQuota limits the total size of the files in the buildlet's
+// work directory to n bytes, or removes the limit if n is 0. Writes
+// by Put, PutTar, and PutTarFromURL that would go over the quota fail
+// with ErrWorkDirQuotaExceeded. It requires buildlet version 28 or newer.
+func (c *client) SetWorkDirQuota(ctx context.Context, n int64) error {
+	form := url.Values{"bytes": {strconv.FormatInt(n, 10)}}
+	req, err := http.NewRequest("POST", c.URL()+"/quota", strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return c.doOK(req.WithContext(ctx))
+}
+
+// CleanResult is the outcome of cleaning a buildlet's work directory.
+type CleanResult struct {
+	BytesReclaimed int64 // total size of the files removed
+}
+
+// CleanWorkDir returns the buildlet's work directory to the state it
+// was in when the buildlet started, and verifies that nothing was
+// left behind. Unlike RemoveAll of ".", it fails if the buildlet
+// couldn't remove everything. It requires buildlet version 28 or newer.
+func (c *client) CleanWorkDir(ctx context.Context) (CleanResult, error) {
+	ctx, cancel := rpcContext(ctx, c.timeouts.RPC)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "POST", c.URL()+"/clean", nil)
+	if err != nil {
+		return CleanResult{}, err
+	}
+	res, err := c.do(req)
+	if err != nil {
+		return CleanResult{}, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		slurp, _ := ioutil.ReadAll(io.LimitReader(res.Body, 4<<10))
+		return CleanResult{}, statusError(res, slurp)
+	}
+	var cr CleanResult
+	if err := json.NewDecoder(res.Body).Decode(&cr); err != nil {
+		return CleanResult{}, err
+	}
+	return cr, nil
+}
+
 // Status provides status information about the buildlet.
 //
 // A coordinator can use the provided information to decide what, if anything,
@@ -661,12 +884,13 @@ func (c *client) Status(ctx context.Context) (Status, error) {
 	default:
 		// Continue below.
 	}
-	req, err := http.NewRequest("GET", c.URL()+"/status", nil)
+	ctx, cancel := rpcContext(ctx, c.timeouts.RPC)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", c.URL()+"/status", nil)
 	if err != nil {
 		return Status{}, err
 	}
-	req = req.WithContext(ctx)
-	resp, err := c.doHeaderTimeout(req, 20*time.Second) // plenty of time
+	resp, err := c.doHeaderTimeout(req, c.headerTimeout())
 	if err != nil {
 		return Status{}, err
 	}
@@ -687,12 +911,13 @@ func (c *client) Status(ctx context.Context) (Status, error) {
 
 // WorkDir returns the absolute path to the buildlet work directory.
 func (c *client) WorkDir(ctx context.Context) (string, error) {
-	req, err := http.NewRequest("GET", c.URL()+"/workdir", nil)
+	ctx, cancel := rpcContext(ctx, c.timeouts.RPC)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", c.URL()+"/workdir", nil)
 	if err != nil {
 		return "", err
 	}
-	req = req.WithContext(ctx)
-	resp, err := c.doHeaderTimeout(req, 20*time.Second) // plenty of time
+	resp, err := c.doHeaderTimeout(req, c.headerTimeout())
 	if err != nil {
 		return "", err
 	}
@@ -782,11 +1007,13 @@ func (c *client) ListDir(ctx context.Context, dir string, opts ListDirOpts, fn f
 		"skip":      opts.Skip,
 		"digest":    {fmt.Sprint(opts.Digest)},
 	}
-	req, err := http.NewRequest("GET", c.URL()+"/ls?"+param.Encode(), nil)
+	ctx, cancel := rpcContext(ctx, c.timeouts.RPC)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", c.URL()+"/ls?"+param.Encode(), nil)
 	if err != nil {
 		return err
 	}
-	resp, err := c.do(req.WithContext(ctx))
+	resp, err := c.do(req)
 	if err != nil {
 		return err
 	}
@@ -803,6 +1030,73 @@ func (c *client) ListDir(ctx context.Context, dir string, opts ListDirOpts, fn f
 	return sc.Err()
 }
 
+// TailOpts are options for Client.Tail.
+type TailOpts struct {
+	// Offset is the offset in the file to start following it at.
+	// If negative, it counts back from the end of the file.
+	Offset int64
+}
+
+// A TailEvent is a change in a file followed by Client.Tail.
+type TailEvent struct {
+	// Rotated reports that the file was replaced or truncated.
+	// The events that follow are of the new contents, from their
+	// start.
+	Rotated bool `json:",omitempty"`
+
+	// Data is content appended to the file.
+	Data []byte `json:",omitempty"`
+
+	// Offset is the offset of Data in the file.
+	Offset int64 `json:",omitempty"`
+}
+
+// Tail follows the file at path, relative to the work directory, as
+// it's appended to, like tail -f. The fn callback is run for each
+// change; if it returns an error, Tail stops and returns it.
+// Otherwise, Tail runs until ctx is done. It requires buildlet version
+// 33 or newer.
+//
+// The file is followed by name, so Tail continues with the new file
+// if it's rotated.
+func (c *client) Tail(ctx context.Context, path string, opts TailOpts, fn func(TailEvent) error) error {
+	param := url.Values{
+		"path":   {path},
+		"offset": {fmt.Sprint(opts.Offset)},
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", c.URL()+"/tail?"+param.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	res, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		slurp, _ := ioutil.ReadAll(io.LimitReader(res.Body, 4<<10))
+		return statusError(res, slurp)
+	}
+	dec := json.NewDecoder(res.Body)
+	for {
+		var ev TailEvent
+		if err := dec.Decode(&ev); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return fmt.Errorf("following %s: %w", path, err)
+		}
+		if err := fn(ev); err != nil {
+			return err
+		}
+	}
+}
+
 func (c *client) getDialer() func(context.Context) (net.Conn, error) {
 	if !c.tls.IsZero() {
 		return func(_ context.Context) (net.Conn, error) {
@@ -823,8 +1117,11 @@ func (c *client) dialWithNetDial(ctx context.Context) (net.Conn, error) {
 // ConnectSSH opens an SSH connection to the buildlet for the given username.
 // The authorizedPubKey must be a line from an ~/.ssh/authorized_keys file
 // and correspond to the private key to be used to communicate over the net.Conn.
-func (c *client) ConnectSSH(user, authorizedPubKey string) (net.Conn, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+//
+// ctx bounds establishing the connection. If it has no deadline, a
+// default of 15 seconds applies.
+func (c *client) ConnectSSH(ctx context.Context, user, authorizedPubKey string) (net.Conn, error) {
+	ctx, cancel := rpcContext(ctx, 15*time.Second)
 	defer cancel()
 	conn, err := c.getDialer()(ctx)
 	if err != nil {
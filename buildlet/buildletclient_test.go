@@ -9,12 +9,14 @@ import (
 	"crypto/tls"
 	"encoding/json"
 	"errors"
+	"io"
 	"net"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestConnectSSHTLS(t *testing.T) {
@@ -87,7 +89,7 @@ func TestConnectSSHTLS(t *testing.T) {
 				authUser: tc.authUser,
 				dialer:   tc.dialer,
 			}
-			gotConn, gotErr := c.ConnectSSH(tc.user, tc.key)
+			gotConn, gotErr := c.ConnectSSH(context.Background(), tc.user, tc.key)
 			if gotErr != nil {
 				t.Fatalf("Client.ConnectSSH(%s, %s) = %v, %v; want no error", tc.user, tc.key, gotConn, gotErr)
 			}
@@ -158,7 +160,7 @@ func TestConnectSSHNonTLS(t *testing.T) {
 				authUser: tc.authUser,
 				dialer:   tc.dialer,
 			}
-			gotConn, gotErr := c.ConnectSSH(tc.user, tc.key)
+			gotConn, gotErr := c.ConnectSSH(context.Background(), tc.user, tc.key)
 			if (gotErr != nil) != tc.wantErr {
 				t.Fatalf("Client.ConnectSSH(%q, %q) = %v, %v; want net.Conn, error=%t", tc.user, tc.key, gotConn, gotErr, tc.wantErr)
 			}
@@ -211,6 +213,79 @@ func TestExecTimeoutError(t *testing.T) {
 	}
 }
 
+func TestExecUsage(t *testing.T) {
+	for _, tc := range []struct {
+		desc    string
+		trailer map[string]string
+		want    *ExecUsage
+	}{
+		{
+			desc:    "cpu-and-rss",
+			trailer: map[string]string{"Process-CPU-Seconds": "1.500", "Process-Max-RSS": "4096"},
+			want:    &ExecUsage{CPUTime: 1500 * time.Millisecond, MaxRSS: 4096},
+		},
+		{
+			desc: "io",
+			trailer: map[string]string{
+				"Process-CPU-Seconds":    "2",
+				"Process-Max-RSS":        "4096",
+				"Process-Read-Bytes":     "1024",
+				"Process-Write-Bytes":    "2048",
+				"Process-Net-Recv-Bytes": "300",
+				"Process-Net-Sent-Bytes": "400",
+			},
+			want: &ExecUsage{CPUTime: 2 * time.Second, MaxRSS: 4096, ReadBytes: 1024, WriteBytes: 2048, NetRecvBytes: 300, NetSentBytes: 400},
+		},
+		{
+			desc:    "cpu-only",
+			trailer: map[string]string{"Process-CPU-Seconds": "0.250"},
+			want:    &ExecUsage{CPUTime: 250 * time.Millisecond},
+		},
+		{
+			desc: "old-buildlet",
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			mux := http.NewServeMux()
+			mux.HandleFunc("/status", func(w http.ResponseWriter, req *http.Request) {
+				json.NewEncoder(w).Encode(Status{})
+			})
+			mux.HandleFunc("/exec", func(w http.ResponseWriter, req *http.Request) {
+				w.Header().Set("Trailer", "Process-State, Process-CPU-Seconds, Process-Max-RSS, Process-Read-Bytes, Process-Write-Bytes, Process-Net-Recv-Bytes, Process-Net-Sent-Bytes")
+				w.Write([]byte("ok\n"))
+				w.Header().Set("Process-State", "exit status 1")
+				for k, v := range tc.trailer {
+					w.Header().Set(k, v)
+				}
+			})
+			ts := httptest.NewServer(mux)
+			defer ts.Close()
+			u, err := url.Parse(ts.URL)
+			if err != nil {
+				t.Fatalf("unable to parse http server url %s", err)
+			}
+			cl := NewClient(u.Host, NoKeyPair)
+			defer cl.Close()
+
+			var got *ExecUsage
+			remoteErr, execErr := cl.Exec(context.Background(), "./bin/test", ExecOpts{
+				OnUsage: func(u ExecUsage) { got = &u },
+			})
+			if execErr != nil || remoteErr == nil {
+				t.Fatalf("cl.Exec = %v, %v; want remote error", remoteErr, execErr)
+			}
+			switch {
+			case tc.want == nil && got != nil:
+				t.Errorf("OnUsage called with %+v; want no call", *got)
+			case tc.want != nil && got == nil:
+				t.Errorf("OnUsage not called; want %+v", *tc.want)
+			case tc.want != nil && *got != *tc.want:
+				t.Errorf("OnUsage called with %+v; want %+v", *got, *tc.want)
+			}
+		})
+	}
+}
+
 type deadlineOnDemandContext struct {
 	context.Context
 	done chan struct{}
@@ -225,3 +300,93 @@ func (c deadlineOnDemandContext) Err() error {
 		return context.DeadlineExceeded
 	}
 }
+
+// Test that the client's default RPC timeout applies to calls whose
+// context has no deadline.
+func TestTimeoutsRPC(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/workdir", func(w http.ResponseWriter, req *http.Request) {
+		w.(http.Flusher).Flush()
+		<-req.Context().Done() // Simulate a hung buildlet.
+	})
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("unable to parse http server url %s", err)
+	}
+	cl := NewClient(u.Host, NoKeyPair)
+	cl.SetTimeouts(Timeouts{RPC: 50 * time.Millisecond})
+	defer cl.Close()
+
+	if _, err := cl.WorkDir(context.Background()); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("cl.WorkDir error = %v; want %v", err, context.DeadlineExceeded)
+	}
+}
+
+// Test that marking a client broken cancels its RPCs in flight.
+func TestMarkBrokenCancelsRPCs(t *testing.T) {
+	started := make(chan bool)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ls", func(w http.ResponseWriter, req *http.Request) {
+		w.(http.Flusher).Flush()
+		started <- true
+		<-req.Context().Done() // Simulate a hung buildlet.
+	})
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("unable to parse http server url %s", err)
+	}
+	cl := NewClient(u.Host, NoKeyPair)
+	defer cl.Close()
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- cl.ListDir(context.Background(), ".", ListDirOpts{}, func(DirEntry) {})
+	}()
+	<-started
+	cl.MarkBroken()
+	select {
+	case err := <-errc:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("cl.ListDir error = %v; want %v", err, context.Canceled)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("cl.ListDir didn't return after cl.MarkBroken")
+	}
+}
+
+// Test that writes failing for lack of space return the matching errors.
+func TestStorageErrors(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/write", func(w http.ResponseWriter, req *http.Request) {
+		http.Error(w, "host disk is full: no space left on device", http.StatusInsufficientStorage)
+	})
+	mux.HandleFunc("/writetgz", func(w http.ResponseWriter, req *http.Request) {
+		http.Error(w, "work directory quota exceeded", http.StatusRequestEntityTooLarge)
+	})
+	mux.HandleFunc("/clean", func(w http.ResponseWriter, req *http.Request) {
+		io.WriteString(w, `{"BytesReclaimed":1234}`)
+	})
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("unable to parse http server url %s", err)
+	}
+	cl := NewClient(u.Host, NoKeyPair)
+	defer cl.Close()
+	ctx := context.Background()
+
+	if err := cl.Put(ctx, strings.NewReader("x"), "x", 0644); !errors.Is(err, ErrDiskFull) {
+		t.Errorf("cl.Put error = %v; want %v", err, ErrDiskFull)
+	}
+	if err := cl.PutTar(ctx, strings.NewReader("x"), ""); !errors.Is(err, ErrWorkDirQuotaExceeded) {
+		t.Errorf("cl.PutTar error = %v; want %v", err, ErrWorkDirQuotaExceeded)
+	}
+	if res, err := cl.CleanWorkDir(ctx); err != nil || res.BytesReclaimed != 1234 {
+		t.Errorf("cl.CleanWorkDir = %+v, %v; want 1234 bytes reclaimed", res, err)
+	}
+}
@@ -5,6 +5,9 @@
 package buildlet
 
 import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
 	"context"
 	"errors"
 	"fmt"
@@ -24,9 +27,10 @@ type RemoteClient interface {
 	Put(ctx context.Context, r io.Reader, path string, mode os.FileMode) error
 	PutTar(ctx context.Context, r io.Reader, dir string) error
 	PutTarFromURL(ctx context.Context, tarURL, dir string) error
-	ProxyTCP(port int) (io.ReadWriteCloser, error)
+	ProxyTCP(ctx context.Context, port int) (io.ReadWriteCloser, error)
 	RemoteName() string
 	RemoveAll(ctx context.Context, paths ...string) error
+	Tail(ctx context.Context, path string, opts TailOpts, fn func(TailEvent) error) error
 	WorkDir(ctx context.Context) (string, error)
 }
 
@@ -37,7 +41,8 @@ type RemoteClient interface {
 // coordinator should use RemoteClient.
 type Client interface {
 	RemoteClient
-	ConnectSSH(user, authorizedPubKey string) (net.Conn, error)
+	CleanWorkDir(ctx context.Context) (CleanResult, error)
+	ConnectSSH(ctx context.Context, user, authorizedPubKey string) (net.Conn, error)
 	IPPort() string
 	InstanceName() string
 	IsBroken() bool
@@ -50,6 +55,8 @@ type Client interface {
 	SetInstanceName(v string)
 	SetName(name string)
 	SetOnHeartbeatFailure(fn func())
+	SetTimeouts(t Timeouts)
+	SetWorkDirQuota(ctx context.Context, n int64) error
 	Status(ctx context.Context) (Status, error)
 	String() string
 	URL() string
@@ -75,7 +82,7 @@ func (fc *FakeClient) Close() error {
 }
 
 // ConnectSSH connects to a fake SSH server.
-func (fc *FakeClient) ConnectSSH(user, authorizedPubKey string) (net.Conn, error) {
+func (fc *FakeClient) ConnectSSH(ctx context.Context, user, authorizedPubKey string) (net.Conn, error) {
 	return nil, errUnimplemented
 }
 
@@ -99,10 +106,29 @@ func (fc *FakeClient) Exec(ctx context.Context, cmd string, opts ExecOpts) (remo
 // InstanceName gives the fake instance name.
 func (fc *FakeClient) InstanceName() string { return fc.instanceName }
 
-// GetTar gives a vake tar zipped directory.
+// FakeTarContents is the contents of the file in the tar zipped
+// directory a FakeClient gives.
+const FakeTarContents = "the gopher goes to the sea and fights the kraken"
+
+// GetTar gives a fake tar zipped directory. It contains a single
+// unnamed regular file, as a buildlet gives when dir is a file.
 func (fc *FakeClient) GetTar(ctx context.Context, dir string) (io.ReadCloser, error) {
-	r := strings.NewReader("the gopher goes to the sea and fights the kraken")
-	return io.NopCloser(r), nil
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(zw)
+	if err := tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(FakeTarContents))}); err != nil {
+		return nil, err
+	}
+	if _, err := io.WriteString(tw, FakeTarContents); err != nil {
+		return nil, err
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return io.NopCloser(&buf), nil
 }
 
 // IPPort provides a fake ip and port pair.
@@ -135,7 +161,9 @@ func (fc *FakeClient) Name() string { return fc.name }
 func (fc *FakeClient) ProxyRoundTripper() http.RoundTripper { return nil }
 
 // ProxyTCP provides a fake proxy.
-func (fc *FakeClient) ProxyTCP(port int) (io.ReadWriteCloser, error) { return nil, errUnimplemented }
+func (fc *FakeClient) ProxyTCP(ctx context.Context, port int) (io.ReadWriteCloser, error) {
+	return nil, errUnimplemented
+}
 
 // Put places a file on a fake buildlet.
 func (fc *FakeClient) Put(ctx context.Context, r io.Reader, path string, mode os.FileMode) error {
@@ -182,9 +210,34 @@ func (fc *FakeClient) SetName(name string) {
 // SetOnHeartbeatFailure sets a function to be called when heartbeats against this fake buildlet fail.
 func (fc *FakeClient) SetOnHeartbeatFailure(fn func()) {}
 
+// SetTimeouts sets the default timeouts of the fake client's RPCs.
+func (fc *FakeClient) SetTimeouts(t Timeouts) {}
+
 // Status provides a status on the fake client.
 func (fc *FakeClient) Status(ctx context.Context) (Status, error) { return Status{}, errUnimplemented }
 
+// Tail follows a fake file, whose contents are FakeTarContents and
+// which is never appended to, until ctx is done.
+func (fc *FakeClient) Tail(ctx context.Context, path string, opts TailOpts, fn func(TailEvent) error) error {
+	if path == "" || fn == nil {
+		return errors.New("invalid arguments")
+	}
+	offset := opts.Offset
+	if offset < 0 {
+		offset += int64(len(FakeTarContents))
+	}
+	if offset < 0 {
+		offset = 0
+	} else if offset > int64(len(FakeTarContents)) {
+		offset = int64(len(FakeTarContents))
+	}
+	if err := fn(TailEvent{Data: []byte(FakeTarContents[offset:]), Offset: offset}); err != nil {
+		return err
+	}
+	<-ctx.Done()
+	return ctx.Err()
+}
+
 // String provides a fake string representation of the client.
 func (fc *FakeClient) String() string { return "" }
 
@@ -201,3 +254,13 @@ func (fc *FakeClient) RemoveAll(ctx context.Context, paths ...string) error {
 	// TODO(go.dev/issue/48742) add a file system implementation which would enable proper testing.
 	return nil
 }
+
+// CleanWorkDir cleans the work directory of a fake buildlet.
+func (fc *FakeClient) CleanWorkDir(ctx context.Context) (CleanResult, error) {
+	return CleanResult{}, nil
+}
+
+// SetWorkDirQuota sets the work directory quota of a fake buildlet.
+func (fc *FakeClient) SetWorkDirQuota(ctx context.Context, n int64) error {
+	return nil
+}
@@ -218,7 +218,7 @@ func (b *grpcBuildlet) upload(ctx context.Context, r io.Reader) (string, error)
 	return resp.Url + resp.ObjectName, nil
 }
 
-func (b *grpcBuildlet) ProxyTCP(port int) (io.ReadWriteCloser, error) {
+func (b *grpcBuildlet) ProxyTCP(ctx context.Context, port int) (io.ReadWriteCloser, error) {
 	return nil, fmt.Errorf("TCP proxying unimplemented in grpc")
 }
 
@@ -234,6 +234,33 @@ func (b *grpcBuildlet) RemoveAll(ctx context.Context, paths ...string) error {
 	return err
 }
 
+func (b *grpcBuildlet) Tail(ctx context.Context, path string, opts TailOpts, fn func(TailEvent) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stream, err := b.client.TailFile(ctx, &protos.TailFileRequest{
+		GomoteId: b.id,
+		Path:     path,
+		Offset:   opts.Offset,
+	})
+	if err != nil {
+		return err
+	}
+	for {
+		update, err := stream.Recv()
+		switch {
+		case ctx.Err() != nil:
+			return ctx.Err()
+		case err == io.EOF:
+			return io.ErrUnexpectedEOF
+		case err != nil:
+			return err
+		}
+		if err := fn(TailEvent{Rotated: update.GetRotated(), Data: update.GetData(), Offset: update.GetOffset()}); err != nil {
+			return err
+		}
+	}
+}
+
 func (b *grpcBuildlet) WorkDir(ctx context.Context) (string, error) {
 	return b.workDir, nil
 }
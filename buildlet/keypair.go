@@ -27,9 +27,14 @@ import (
 type KeyPair struct {
 	CertPEM string
 	KeyPEM  string
+
+	// Verify, if non-nil, additionally verifies the certificates
+	// presented by the builder, leaf first, such as against the
+	// certificate authority that issued CertPEM and its revocations.
+	Verify func(chain []*x509.Certificate) error
 }
 
-func (kp KeyPair) IsZero() bool { return kp == KeyPair{} }
+func (kp KeyPair) IsZero() bool { return kp.CertPEM == "" && kp.KeyPEM == "" }
 
 // Password returns the SHA1 of the KeyPEM. This is used as the HTTP
 // Basic Auth password.
@@ -74,6 +79,12 @@ func (kp KeyPair) tlsDialer() func(network, addr string) (net.Conn, error) {
 		if peerPubRSA.N.Cmp(wantPubKey.N) != 0 {
 			return nil, fmt.Errorf("unexpected TLS certificate")
 		}
+		if kp.Verify != nil {
+			if err := kp.Verify(certs); err != nil {
+				tlsConn.Close()
+				return nil, fmt.Errorf("invalid TLS certificate: %v", err)
+			}
+		}
 		return tlsConn, nil
 	}
 }
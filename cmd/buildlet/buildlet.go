@@ -38,6 +38,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"cloud.google.com/go/compute/metadata"
@@ -59,6 +60,10 @@ var (
 	coordinator  = flag.String("coordinator", "localhost:8119", "address of coordinator, in production use farmer.golang.org. Only used in reverse mode.")
 	hostname     = flag.String("hostname", "", "hostname to advertise to coordinator for reverse mode; default is actual hostname")
 	healthAddr   = flag.String("health-addr", "0.0.0.0:8080", "For reverse buildlets, address to listen for /healthz requests separately from the reverse dialer to the coordinator.")
+
+	selfTest       = flag.Bool("self-test", true, "For reverse buildlets, check the bootstrap toolchain, work directory, network and clock at startup, and report the results to the coordinator, which won't schedule work on the buildlet while any check fails. Failed checks are retried periodically.")
+	wireGuardIface = flag.String("wireguard-iface", "", "For reverse buildlets, if non-empty, the name of a WireGuard interface to create and join the coordinator's WireGuard mesh with, instead of reverse dialing the coordinator. Requires Linux and the wg and ip tools.")
+	logFile        = flag.String("log-file", "", "If non-empty, a file to write logs to instead of the default output. It's rotated as it grows, keeping a few old files. Set by \"buildlet install\".")
 )
 
 // Bump this whenever something notable happens, or when another
@@ -84,7 +89,15 @@ var (
 //	25: use removeAllIncludingReadonly for all work area cleanup
 //	26: clean up path validation and normalization
 //	27: export GOPLSCACHE=$workdir/goplscache
-const buildletVersion = 27
+//	28: work directory quotas (/quota) and verified cleaning (/clean)
+//	29: startup self-test, reported on registration
+//	30: install/uninstall as a Windows service or launchd daemon, -log-file
+//	31: Process-CPU-Seconds and Process-Max-RSS trailers from /exec
+//	32: Process-{Read,Write}-Bytes and Process-Net-{Recv,Sent}-Bytes trailers from /exec
+//	33: /tail to follow a file as it's appended to
+//	34: envProfile parameter to /exec
+//	35: capture the state of the system and SIGQUIT commands that time out
+const buildletVersion = 35
 
 func defaultListenAddr() string {
 	if runtime.GOOS == "darwin" {
@@ -126,6 +139,12 @@ const (
 )
 
 func main() {
+	if len(os.Args) > 1 && (os.Args[1] == "install" || os.Args[1] == "uninstall") {
+		if err := serviceCommand(os.Args[1], os.Args[2:]); err != nil {
+			log.Fatalf("buildlet %s: %v", os.Args[1], err)
+		}
+		return
+	}
 	builderEnv := os.Getenv("GO_BUILDER_ENV")
 	onGCE := metadata.OnGCE()
 	switch runtime.GOOS {
@@ -147,6 +166,12 @@ func main() {
 
 	log.Printf("buildlet starting.")
 	flag.Parse()
+	if *logFile != "" {
+		if err := setLogFile(*logFile); err != nil {
+			log.Fatalf("setting log file: %v", err)
+		}
+		log.Printf("buildlet starting.")
+	}
 
 	if builderEnv == "android-amd64-emu" {
 		startAndroidEmulator()
@@ -239,8 +264,11 @@ func main() {
 	http.Handle("/tgz", requireAuth(handleGetTGZ))
 	http.Handle("/removeall", requireAuth(handleRemoveAll))
 	http.Handle("/workdir", requireAuth(handleWorkDir))
+	http.Handle("/quota", requireAuth(handleQuota))
+	http.Handle("/clean", requireAuth(handleClean))
 	http.Handle("/status", requireAuth(handleStatus))
 	http.Handle("/ls", requireAuth(handleLs))
+	http.Handle("/tail", requireAuth(handleTail))
 	http.Handle("/connect-ssh", requireAuth(handleConnectSSH))
 	http.HandleFunc("/healthz", handleHealthz)
 
@@ -252,20 +280,50 @@ func main() {
 				log.Printf("Error in serveReverseHealth: %v", err)
 			}
 		}()
-		ln, err := dialCoordinator()
-		if err != nil {
-			log.Fatalf("Error dialing coordinator: %v", err)
+		if *selfTest {
+			r := runStartupSelfTest()
+			setSelfTest(r)
+			logSelfTest(r)
 		}
-		srv := &http.Server{}
-		err = srv.Serve(ln)
-		log.Printf("http.Serve on reverse connection complete: %v", err)
-		log.Printf("buildlet reverse mode exiting.")
-		if *haltEntireOS {
-			// The coordinator disconnects before doHalt has time to
-			// execute. handleHalt has a 1s delay.
-			time.Sleep(5 * time.Second)
+		for {
+			var ln net.Listener
+			var err error
+			if *wireGuardIface != "" {
+				ln, err = joinWireGuardMesh()
+			} else {
+				ln, err = dialCoordinator()
+			}
+			if err != nil {
+				log.Fatalf("Error dialing coordinator: %v", err)
+			}
+			// The coordinator only reads the self-test report on
+			// registration, so once a failed self-test passes,
+			// drop the connection and register again.
+			done, passed := make(chan struct{}), make(chan struct{})
+			if selfTestFailed() {
+				go recheckSelfTest(done, func() {
+					close(passed)
+					ln.Close()
+				})
+			}
+			srv := &http.Server{}
+			err = srv.Serve(ln)
+			close(done)
+			select {
+			case <-passed:
+				log.Printf("Self-test passed; registering with coordinator again.")
+				continue
+			default:
+			}
+			log.Printf("http.Serve on reverse connection complete: %v", err)
+			log.Printf("buildlet reverse mode exiting.")
+			if *haltEntireOS {
+				// The coordinator disconnects before doHalt has time to
+				// execute. handleHalt has a 1s delay.
+				time.Sleep(5 * time.Second)
+			}
+			os.Exit(0)
 		}
-		os.Exit(0)
 	}
 }
 
@@ -620,6 +678,13 @@ func handleWriteTGZ(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	budget, err := newWorkDirBudget()
+	if err != nil {
+		err = storageError(err)
+		http.Error(w, err.Error(), httpStatus(err))
+		return
+	}
+
 	var tgz io.Reader
 	var urlStr string
 	switch r.Method {
@@ -654,8 +719,9 @@ func handleWriteTGZ(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err := untar(tgz, baseDir)
+	err = untar(tgz, baseDir, budget)
 	if err != nil {
+		err = storageError(err)
 		http.Error(w, err.Error(), httpStatus(err))
 		return
 	}
@@ -685,21 +751,32 @@ func handleWrite(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	budget, err := newWorkDirBudget()
+	if err != nil {
+		err = storageError(err)
+		http.Error(w, err.Error(), httpStatus(err))
+		return
+	}
+
 	// Make the parent directory, along with any necessary parents, if needed.
 	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		err = storageError(err)
+		http.Error(w, err.Error(), httpStatus(err))
 		return
 	}
 
-	if err := writeFile(r.Body, path, mode); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if err := writeFile(r.Body, path, mode, budget); err != nil {
+		err = storageError(err)
+		http.Error(w, err.Error(), httpStatus(err))
 		return
 	}
 
 	io.WriteString(w, "OK")
 }
 
-func writeFile(r io.Reader, path string, mode os.FileMode) error {
+// writeFile writes the contents of r to the file at path, within
+// budget.
+func writeFile(r io.Reader, path string, mode os.FileMode, budget *workDirBudget) error {
 	if runtime.GOOS == "darwin" && mode&0111 != 0 {
 		// The darwin kernel caches binary signatures and SIGKILLs
 		// binaries with mismatched signatures. Overwriting a binary
@@ -715,7 +792,7 @@ func writeFile(r io.Reader, path string, mode os.FileMode) error {
 	if err != nil {
 		return err
 	}
-	if _, err := io.Copy(f, r); err != nil {
+	if _, err := io.Copy(budget.writer(f), r); err != nil {
 		f.Close()
 		return err
 	}
@@ -729,8 +806,9 @@ func writeFile(r io.Reader, path string, mode os.FileMode) error {
 	return f.Close()
 }
 
-// untar reads the gzip-compressed tar file from r and writes it into dir.
-func untar(r io.Reader, dir string) (err error) {
+// untar reads the gzip-compressed tar file from r and writes it into dir,
+// within budget.
+func untar(r io.Reader, dir string, budget *workDirBudget) (err error) {
 	t0 := time.Now()
 	nFiles := 0
 	madeDir := map[string]bool{}
@@ -796,12 +874,12 @@ func untar(r io.Reader, dir string) (err error) {
 			if err != nil {
 				return err
 			}
-			n, err := io.Copy(wf, tr)
+			n, err := io.Copy(budget.writer(wf), tr)
 			if closeErr := wf.Close(); closeErr != nil && err == nil {
 				err = closeErr
 			}
 			if err != nil {
-				return fmt.Errorf("error writing to %s: %v", abs, err)
+				return fmt.Errorf("error writing to %s: %w", abs, err)
 			}
 			if n != f.Size {
 				return fmt.Errorf("only wrote %d bytes to %s; expected %d", n, abs, f.Size)
@@ -847,11 +925,31 @@ func untar(r io.Reader, dir string) (err error) {
 // on success, or os.ProcessState.String() on failure.
 const hdrProcessState = "Process-State"
 
+// Process-CPU-Seconds and Process-Max-RSS are HTTP Trailers set in the
+// /exec handler to the user and system CPU time, in seconds, and the
+// peak resident set size, in bytes, of the command and the descendants
+// it waited for. The latter is only set where it's known.
+const (
+	hdrProcessCPUSeconds = "Process-CPU-Seconds"
+	hdrProcessMaxRSS     = "Process-Max-RSS"
+)
+
+// Process-Read-Bytes and Process-Write-Bytes are HTTP Trailers set in
+// the /exec handler to the bytes that the command and the descendants
+// it waited for read from and wrote to storage, and
+// Process-Net-Recv-Bytes and Process-Net-Sent-Bytes to the bytes
+// received and sent on the machine's network interfaces while it ran.
+// They're only set where they're known.
+const (
+	hdrProcessReadBytes    = "Process-Read-Bytes"
+	hdrProcessWriteBytes   = "Process-Write-Bytes"
+	hdrProcessNetRecvBytes = "Process-Net-Recv-Bytes"
+	hdrProcessNetSentBytes = "Process-Net-Sent-Bytes"
+)
+
 func handleExec(w http.ResponseWriter, r *http.Request) {
 	cn := w.(http.CloseNotifier)
 	clientGone := cn.CloseNotify()
-	handlerDone := make(chan bool)
-	defer close(handlerDone)
 
 	if r.Method != "POST" {
 		http.Error(w, "requires POST method", http.StatusBadRequest)
@@ -880,11 +978,23 @@ func handleExec(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	w.Header().Set("Trailer", hdrProcessState) // declare it so we can set it
+	// Declare the trailers so we can set them.
+	w.Header()["Trailer"] = []string{hdrProcessState, hdrProcessCPUSeconds, hdrProcessMaxRSS,
+		hdrProcessReadBytes, hdrProcessWriteBytes, hdrProcessNetRecvBytes, hdrProcessNetSentBytes}
 
 	sysMode := r.FormValue("mode") == "sys"
 	debug, _ := strconv.ParseBool(r.FormValue("debug"))
 
+	var timeout time.Duration
+	if v := r.FormValue("timeout"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			http.Error(w, fmt.Sprintf("invalid 'timeout' parameter %q", v), http.StatusBadRequest)
+			return
+		}
+		timeout = d
+	}
+
 	absCmd, err := absExecCmd(r.FormValue("cmd"), sysMode) // required
 	if err != nil {
 		http.Error(w, "invalid 'cmd' parameter: "+err.Error(), httpStatus(err))
@@ -897,6 +1007,28 @@ func handleExec(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	var prof *envutil.Profile
+	var profTmpDir string // TMPDIR for prof, if any
+	if v := r.FormValue("envProfile"); v != "" {
+		prof = new(envutil.Profile)
+		if err := json.Unmarshal([]byte(v), prof); err != nil {
+			http.Error(w, "invalid 'envProfile' parameter: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if prof.TmpDir != "" {
+			dir, err := nativeRelPath(prof.TmpDir)
+			if err != nil {
+				http.Error(w, "invalid 'envProfile' parameter: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			profTmpDir = filepath.Join(*workDir, dir)
+			if err := os.MkdirAll(profTmpDir, 0755); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+	}
+
 	if f, ok := w.(http.Flusher); ok {
 		f.Flush()
 	}
@@ -911,10 +1043,14 @@ func handleExec(w http.ResponseWriter, r *http.Request) {
 		disableOutboundNetwork()
 	}
 
-	env := append(baseEnv(goarch), postEnv...)
+	env, violations := baseEnv(goarch, prof)
+	env = append(env, postEnv...)
 	if v := processTmpDirEnv; v != "" {
 		env = append(env, "TMPDIR="+v)
 	}
+	if profTmpDir != "" {
+		env = append(env, "TMPDIR="+profTmpDir)
+	}
 	if v := processGoCacheEnv; v != "" {
 		env = append(env, "GOCACHE="+v)
 	}
@@ -937,42 +1073,99 @@ func handleExec(w http.ResponseWriter, r *http.Request) {
 	cmd.Args = append(cmd.Args, r.PostForm["cmdArg"]...)
 	cmd.Env = env
 	envutil.SetDir(cmd, absDir)
-	cmdOutput := flushWriter{w}
+	cmdOutput := &lockedWriter{w: flushWriter{w}}
 	cmd.Stdout = cmdOutput
 	cmd.Stderr = cmdOutput
 
 	log.Printf("[%p] Running %s with args %q and env %q in dir %s",
 		cmd, cmd.Path, cmd.Args, cmd.Env, cmd.Dir)
+	if len(violations) > 0 {
+		action := "inherited"
+		if prof.Strict {
+			action = "removed"
+		}
+		log.Printf("[%p] Environment profile %q: %s variables it doesn't allow: %s",
+			cmd, prof.Name, action, strings.Join(violations, ", "))
+		fmt.Fprintf(cmdOutput, ":: Environment profile %q: %s variables it doesn't allow: %s\n\n",
+			prof.Name, action, strings.Join(violations, ", "))
+	}
 
 	if debug {
 		fmt.Fprintf(cmdOutput, ":: Running %s with args %q and env %q in dir %s\n\n",
 			cmd.Path, cmd.Args, cmd.Env, cmd.Dir)
 	}
 
+	setProcessGroup(cmd)
+	recv0, sent0, netOK := netBytes()
 	t0 := time.Now()
 	err = cmd.Start()
+	var timedOut atomic.Bool
 	if err == nil {
+		group := newProcessGroup(cmd.Process)
+		exited := make(chan struct{})
+		watcherDone := make(chan struct{})
 		go func() {
+			defer close(watcherDone)
+			var timeoutc <-chan time.Time
+			if timeout > 0 {
+				t := time.NewTimer(timeout)
+				defer t.Stop()
+				timeoutc = t.C
+			}
 			select {
 			case <-clientGone:
-				err := killProcessTree(cmd.Process)
-				if err != nil {
-					log.Printf("Kill failed: %v", err)
+			case <-timeoutc:
+				timedOut.Store(true)
+				captureTimeoutState(cmdOutput, group, timeout, exited)
+				select {
+				case <-exited:
+					return
+				default:
 				}
-			case <-handlerDone:
+			case <-exited:
 				return
 			}
+			if err := group.kill(); err != nil {
+				log.Printf("Kill failed: %v", err)
+			}
 		}()
 		err = cmd.Wait()
+		close(exited)
+		// Wait for any output about a timeout.
+		<-watcherDone
+		// Don't let descendants that outlived the command wedge later builds.
+		if err := group.cleanup(); err != nil {
+			log.Printf("[%p] Cleaning up process group failed: %v", cmd, err)
+		}
 	}
 	state := "ok"
+	if ps := cmd.ProcessState; ps != nil {
+		cpu := ps.UserTime() + ps.SystemTime()
+		w.Header().Set(hdrProcessCPUSeconds, strconv.FormatFloat(cpu.Seconds(), 'f', 3, 64))
+		if rss := maxRSS(ps); rss > 0 {
+			w.Header().Set(hdrProcessMaxRSS, strconv.FormatInt(rss, 10))
+		}
+		if read, written, ok := ioBytes(ps); ok {
+			w.Header().Set(hdrProcessReadBytes, strconv.FormatInt(read, 10))
+			w.Header().Set(hdrProcessWriteBytes, strconv.FormatInt(written, 10))
+		}
+		// Counters that went down were reset, as when an
+		// interface went away.
+		if recv, sent, ok := netBytes(); ok && netOK && recv >= recv0 && sent >= sent0 {
+			w.Header().Set(hdrProcessNetRecvBytes, strconv.FormatInt(recv-recv0, 10))
+			w.Header().Set(hdrProcessNetSentBytes, strconv.FormatInt(sent-sent0, 10))
+		}
+	}
 	if err != nil {
 		if ps := cmd.ProcessState; ps != nil {
-			state = ps.String()
+			state = exitState(ps)
 		} else {
 			state = err.Error()
 		}
 	}
+	if timedOut.Load() {
+		state = fmt.Sprintf("timeout after %v: %s", timeout, state)
+	}
 	w.Header().Set(hdrProcessState, state)
 	log.Printf("[%p] Run = %s, after %v", cmd, state, time.Since(t0))
 }
@@ -1102,13 +1295,25 @@ var (
 	defaultBootstrapOnce sync.Once
 )
 
-func baseEnv(goarch string) []string {
-	var env []string
+// baseEnv returns the environment commands inherit from the buildlet,
+// with prof, if non-nil, applied to it, and the variables prof
+// doesn't allow.
+func baseEnv(goarch string, prof *envutil.Profile) (env, violations []string) {
 	if runtime.GOOS == "windows" {
 		env = windowsBaseEnv(goarch)
 	} else {
 		env = os.Environ()
 	}
+	if prof != nil {
+		var pathKV string
+		if prof.Path != nil {
+			pathKV, _ = pathEnv(runtime.GOOS, env, prof.Path, *workDir)
+		}
+		env, violations = prof.Apply(runtime.GOOS, env)
+		if pathKV != "" {
+			env = append(env, pathKV)
+		}
+	}
 
 	defaultBootstrapOnce.Do(func() {
 		defaultBootstrap = filepath.Join(*workDir, "go1.4")
@@ -1123,7 +1328,7 @@ func baseEnv(goarch string) []string {
 	})
 	env = append(env, "GOROOT_BOOTSTRAP="+defaultBootstrap)
 
-	return env
+	return env, violations
 }
 
 func windowsBaseEnv(goarch string) (e []string) {
@@ -1736,12 +1941,6 @@ func (pw *gcePlan9LogWriter) Write(p []byte) (n int, err error) {
 	return pw.w.Write(pw.buf[:n+1])
 }
 
-var killProcessTree = killProcessTreeUnix
-
-func killProcessTreeUnix(p *os.Process) error {
-	return p.Kill()
-}
-
 func vmwareGetInfo(key string) string {
 	cmd := exec.Command("/Library/Application Support/VMware Tools/vmware-tools-daemon",
 		"--cmd",
@@ -0,0 +1,75 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+func init() {
+	setProcessGroup = setProcessGroupPlan9
+	processGroupID = processGroupIDPlan9
+	killProcessGroup = killProcessGroupPlan9
+	exitState = exitStatePlan9
+}
+
+// setProcessGroupPlan9 starts cmd in a new note group, which its
+// descendants inherit unless they ask for one of their own.
+func setProcessGroupPlan9(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Rfork: syscall.RFNOTEG}
+}
+
+func processGroupIDPlan9(p *os.Process) int {
+	id, err := readNoteID(p.Pid)
+	if err != nil {
+		return 0
+	}
+	return id
+}
+
+func readNoteID(pid int) (int, error) {
+	b, err := os.ReadFile(fmt.Sprintf("/proc/%d/noteid", pid))
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(string(b)))
+}
+
+// killProcessGroupPlan9 kills every process in note group id.
+// Unlike writing to /proc/<pid>/notepg, it works after the process
+// that started the group has exited.
+func killProcessGroupPlan9(id int) error {
+	ents, err := os.ReadDir("/proc")
+	if err != nil {
+		return err
+	}
+	for _, e := range ents {
+		pid, err := strconv.Atoi(e.Name())
+		if err != nil || pid == os.Getpid() {
+			continue
+		}
+		if nid, err := readNoteID(pid); err != nil || nid != id {
+			continue
+		}
+		// The process may have exited since we looked, so ignore errors.
+		if f, err := os.OpenFile(fmt.Sprintf("/proc/%d/ctl", pid), os.O_WRONLY, 0); err == nil {
+			f.Write([]byte("kill"))
+			f.Close()
+		}
+	}
+	return nil
+}
+
+func exitStatePlan9(ps *os.ProcessState) string {
+	if w, ok := ps.Sys().(*syscall.Waitmsg); ok {
+		return plan9ExitStatus(w.Msg)
+	}
+	return ps.String()
+}
@@ -0,0 +1,81 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file is also built on illumos.
+
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"syscall"
+)
+
+func init() {
+	setProcessGroup = setProcessGroupSolaris
+	processGroupID = processGroupIDSolaris
+	killProcessGroup = killProcessGroupSolaris
+	killProcessTree = killProcessTreeSolaris
+	snapshotProcesses = snapshotSolarisProcesses
+}
+
+func setProcessGroupSolaris(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// processGroupIDSolaris returns the pid of p, which setProcessGroup
+// made the leader of its process group.
+func processGroupIDSolaris(p *os.Process) int {
+	return p.Pid
+}
+
+func killProcessGroupSolaris(pgid int) error {
+	err := syscall.Kill(-pgid, syscall.SIGKILL)
+	if errors.Is(err, syscall.ESRCH) {
+		// The group is gone.
+		return nil
+	}
+	return err
+}
+
+// killProcessTreeSolaris kills p and its descendants, including any
+// that left its process group by starting their own.
+func killProcessTreeSolaris(p *os.Process) error {
+	ps, err := snapshotSolarisProcesses()
+	if err != nil {
+		return err
+	}
+	for _, pid := range ps.findDescendants(p.Pid) {
+		syscall.Kill(pid, syscall.SIGKILL)
+	}
+	return p.Kill()
+}
+
+// snapshotSolarisProcesses reads the system process tree from /proc.
+func snapshotSolarisProcesses() (psTree, error) {
+	psinfos, err := filepath.Glob("/proc/*/psinfo")
+	if err != nil {
+		return nil, err
+	}
+	ps := make(psTree)
+	for _, file := range psinfos {
+		if _, err := strconv.Atoi(filepath.Base(filepath.Dir(file))); err != nil {
+			continue
+		}
+		b, err := os.ReadFile(file)
+		if err != nil {
+			// The process exited since we listed /proc.
+			continue
+		}
+		pid, ppid, err := parsePsinfo(b)
+		if err != nil {
+			continue
+		}
+		ps[pid] = ppid
+	}
+	return ps, nil
+}
@@ -5,9 +5,20 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
+	"path/filepath"
 	"runtime"
+	"strings"
 	"testing"
+	"time"
+
+	"golang.org/x/build/buildlet"
+	"golang.org/x/build/internal/envutil"
 )
 
 func TestPathEnv(t *testing.T) {
@@ -110,3 +121,104 @@ func TestPathListSeparator(t *testing.T) {
 		t.Errorf("pathListSeparator(%q) = %q; want %q", runtime.GOOS, sep, want)
 	}
 }
+
+func TestExecEnvProfile(t *testing.T) {
+	if runtime.GOOS == "windows" || runtime.GOOS == "plan9" {
+		t.Skipf("no /usr/bin/env on %s", runtime.GOOS)
+	}
+	dir := setTestWorkDir(t)
+	t.Setenv("BUILDLET_TEST_ALLOWED", "1")
+	t.Setenv("BUILDLET_TEST_SECRET", "1")
+	t.Setenv("PATH", "/usr/bin:/bin")
+	ts := httptest.NewServer(http.HandlerFunc(handleExec))
+	defer ts.Close()
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bc := buildlet.NewClient(u.Host, buildlet.NoKeyPair)
+	defer bc.Close()
+
+	for _, strict := range []bool{false, true} {
+		var out bytes.Buffer
+		remoteErr, err := bc.Exec(context.Background(), "/usr/bin/env", buildlet.ExecOpts{
+			Output:      &out,
+			SystemLevel: true,
+			ExtraEnv:    []string{"BUILDLET_TEST_EXTRA=1"},
+			EnvProfile: &envutil.Profile{
+				Name:   "test",
+				Allow:  []string{"BUILDLET_TEST_ALLOWED"},
+				Path:   []string{"$WORKDIR/bin", "$PATH"},
+				TmpDir: "profile/tmp",
+				Strict: strict,
+			},
+		})
+		if remoteErr != nil || err != nil {
+			t.Fatalf("Exec(strict=%v) = %v, %v", strict, remoteErr, err)
+		}
+		got := out.String()
+		for _, want := range []string{
+			"BUILDLET_TEST_ALLOWED=1\n",
+			"BUILDLET_TEST_EXTRA=1\n",
+			"PATH=" + filepath.Join(dir, "bin") + ":/usr/bin:/bin\n",
+			"TMPDIR=" + filepath.Join(dir, "profile", "tmp") + "\n",
+			"GOROOT_BOOTSTRAP=",
+			"variables it doesn't allow: ",
+		} {
+			if !strings.Contains(got, want) {
+				t.Errorf("Exec(strict=%v) output lacks %q:\n%s", strict, want, got)
+			}
+		}
+		if has := strings.Contains(got, "BUILDLET_TEST_SECRET=1\n"); has == strict {
+			t.Errorf("Exec(strict=%v) output has BUILDLET_TEST_SECRET: %v; want %v:\n%s", strict, has, !strict, got)
+		}
+	}
+}
+
+func TestExecTimeoutState(t *testing.T) {
+	if runtime.GOOS == "windows" || runtime.GOOS == "plan9" {
+		t.Skipf("no SIGQUIT on %s", runtime.GOOS)
+	}
+	defer func(cmds [][]string, grace time.Duration) {
+		timeoutStateCommands, timeoutQuitGrace = cmds, grace
+	}(timeoutStateCommands, timeoutQuitGrace)
+	timeoutStateCommands = [][]string{{"echo", "system state"}, {"false"}}
+	timeoutQuitGrace = time.Minute
+	setTestWorkDir(t)
+	ts := httptest.NewServer(http.HandlerFunc(handleExec))
+	defer ts.Close()
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bc := buildlet.NewClient(u.Host, buildlet.NoKeyPair)
+	defer bc.Close()
+
+	// The command dumps its state and exits on SIGQUIT, as Go
+	// programs do.
+	var out bytes.Buffer
+	remoteErr, err := bc.Exec(context.Background(), "/bin/sh", buildlet.ExecOpts{
+		Output:      &out,
+		SystemLevel: true,
+		Args:        []string{"-c", `trap 'echo dumping goroutines; exit 2' QUIT; while :; do sleep 0.1; done`},
+		Timeout:     time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if remoteErr == nil || !strings.Contains(remoteErr.Error(), "timeout after 1s: exit status 2") {
+		t.Errorf("Exec = %v; want timeout after 1s with exit status 2", remoteErr)
+	}
+	got := out.String()
+	for _, want := range []string{
+		":: Timed out after 1s.",
+		":: echo system state\nsystem state\n",
+		":: false failed: exit status 1",
+		":: Sending SIGQUIT",
+		"dumping goroutines\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Exec output lacks %q:\n%s", want, got)
+		}
+	}
+}
@@ -5,6 +5,7 @@
 package main
 
 import (
+	"errors"
 	"log"
 	"os"
 	"syscall"
@@ -16,6 +17,15 @@ import (
 func init() {
 	killProcessTree = killProcessTreeWindows
 	configureSerialLogOutput = configureSerialLogOutputWindows
+	isDiskFull = isDiskFullWindows
+}
+
+func isDiskFullWindows(err error) bool {
+	const (
+		ERROR_HANDLE_DISK_FULL syscall.Errno = 39
+		ERROR_DISK_FULL        syscall.Errno = 112
+	)
+	return errors.Is(err, ERROR_DISK_FULL) || errors.Is(err, ERROR_HANDLE_DISK_FULL)
 }
 
 func configureSerialLogOutputWindows() {
@@ -32,22 +42,6 @@ func configureSerialLogOutputWindows() {
 	log.SetOutput(s)
 }
 
-// the system process tree
-type psTree map[int]int // pid -> parent pid
-
-// findDescendants searches process tree t for pid process children.
-// It returns children pids.
-func (t psTree) findDescendants(pid int) []int {
-	var children []int
-	for child, parent := range t {
-		if parent == pid {
-			children = append(children, child)
-			children = append(children, t.findDescendants(child)...)
-		}
-	}
-	return children
-}
-
 func snapshotSysProcesses() (psTree, error) {
 	ss, err := syscall.CreateToolhelp32Snapshot(syscall.TH32CS_SNAPPROCESS, 0)
 	if err != nil {
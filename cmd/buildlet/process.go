@@ -0,0 +1,210 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// Management of the processes started by the /exec handler.
+//
+// Commands often start processes of their own, and any left running
+// after the command exits or is killed can wedge later builds. The
+// hooks below are replaced on systems that can do better than the
+// defaults, which only deal with the command's own process.
+var (
+	// setProcessGroup configures cmd, before it's started, to run in
+	// a new process group or the OS's equivalent.
+	setProcessGroup = func(cmd *exec.Cmd) {}
+
+	// processGroupID returns the ID of the group that setProcessGroup
+	// put the started process p in, or 0 if there is none.
+	processGroupID = func(p *os.Process) int { return 0 }
+
+	// killProcessGroup, if non-nil, kills the processes still running
+	// in group id.
+	killProcessGroup func(id int) error
+
+	// killProcessTree kills p and its descendants.
+	killProcessTree = func(p *os.Process) error { return p.Kill() }
+
+	// quitProcessTree, if non-nil, sends SIGQUIT to p and its
+	// descendants, as typing ^\ in a terminal does, so that Go
+	// programs dump their goroutines and exit. The go command
+	// ignores the signal, and relays the dumps of the tests it runs.
+	quitProcessTree func(p *os.Process) error
+
+	// snapshotProcesses, if non-nil, returns the system process
+	// tree.
+	snapshotProcesses func() (psTree, error)
+
+	// exitState describes how a command exited, for the Process-State
+	// trailer.
+	exitState = (*os.ProcessState).String
+
+	// maxRSS returns the peak resident set size, in bytes, of the
+	// exited command ps and the descendants it waited for, or 0 if
+	// it's unknown.
+	maxRSS = func(ps *os.ProcessState) int64 { return 0 }
+
+	// ioBytes returns the bytes that the exited command ps and the
+	// descendants it waited for read from and wrote to storage, not
+	// counting those served by or left in the page cache, and
+	// whether they're known.
+	ioBytes = func(ps *os.ProcessState) (read, written int64, ok bool) { return 0, 0, false }
+
+	// netBytes returns the bytes received and sent so far on the
+	// machine's network interfaces, other than loopback ones, and
+	// whether they're known. There's no per-process accounting of
+	// network use, so commands are metered by the difference.
+	netBytes = func() (recv, sent int64, ok bool) { return 0, 0, false }
+)
+
+// A processGroup is the process of a command run by /exec and its
+// descendants.
+type processGroup struct {
+	p  *os.Process
+	id int // see processGroupID
+}
+
+// newProcessGroup returns the processGroup of the started process p.
+func newProcessGroup(p *os.Process) *processGroup {
+	return &processGroup{p: p, id: processGroupID(p)}
+}
+
+// kill kills the command and all its descendants.
+func (g *processGroup) kill() error {
+	err := killProcessTree(g.p)
+	if err2 := g.cleanup(); err == nil {
+		err = err2
+	}
+	return err
+}
+
+// cleanup kills the descendants of the command that are still running
+// in its group, including any that outlived it.
+func (g *processGroup) cleanup() error {
+	if g.id == 0 || killProcessGroup == nil {
+		return nil
+	}
+	return killProcessGroup(g.id)
+}
+
+// the system process tree
+type psTree map[int]int // pid -> parent pid
+
+// findDescendants searches process tree t for pid process children.
+// It returns children pids.
+func (t psTree) findDescendants(pid int) []int {
+	var children []int
+	for child, parent := range t {
+		if parent == pid {
+			children = append(children, child)
+			children = append(children, t.findDescendants(child)...)
+		}
+	}
+	return children
+}
+
+// parsePs parses the output of "ps -A -o pid= -o ppid=" into a
+// process tree.
+func parsePs(out []byte) (psTree, error) {
+	ps := make(psTree)
+	for i, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		f := strings.Fields(line)
+		if len(f) != 2 {
+			return nil, fmt.Errorf("line %d: %d fields; want 2", i+1, len(f))
+		}
+		pid, err1 := strconv.Atoi(f[0])
+		ppid, err2 := strconv.Atoi(f[1])
+		if err1 != nil || err2 != nil {
+			return nil, fmt.Errorf("line %d: invalid pids %q", i+1, line)
+		}
+		ps[pid] = ppid
+	}
+	return ps, nil
+}
+
+// parsePsinfo returns the process ID and parent process ID from the
+// contents of a Solaris /proc/<pid>/psinfo file, which begins:
+//
+//	int   pr_flag;
+//	int   pr_nlwp;
+//	pid_t pr_pid;
+//	pid_t pr_ppid;
+//
+// The buildlet only runs on little-endian Solaris systems.
+func parsePsinfo(b []byte) (pid, ppid int, err error) {
+	if len(b) < 16 {
+		return 0, 0, errors.New("short psinfo")
+	}
+	pid = int(int32(binary.LittleEndian.Uint32(b[8:])))
+	ppid = int(int32(binary.LittleEndian.Uint32(b[12:])))
+	return pid, ppid, nil
+}
+
+// plan9ExitStatus maps the exit message of a Plan 9 process, which
+// is prefixed with its name and pid, like "go 1234: fail", to the
+// form that os.ProcessState.String uses on Unix systems, so that the
+// Process-State trailer reads the same on all buildlets.
+func plan9ExitStatus(msg string) string {
+	if name, rest, ok := strings.Cut(msg, " "); ok && name != "" {
+		if pid, rest, ok := strings.Cut(rest, ": "); ok {
+			if _, err := strconv.Atoi(pid); err == nil {
+				msg = rest
+			}
+		}
+	}
+	switch {
+	case msg == "":
+		return "exit status 0"
+	case msg == "kill" || msg == "sys: kill" || strings.HasSuffix(msg, "killed"):
+		return "signal: killed"
+	case strings.HasPrefix(msg, "interrupt"):
+		return "signal: interrupt"
+	}
+	return "exit status 1: " + msg
+}
+
+// parseNetDev parses r, in the format of Linux's /proc/net/dev, and
+// returns the bytes received and sent on all but the loopback
+// interfaces.
+func parseNetDev(r io.Reader) (recv, sent int64, err error) {
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		if n <= 2 {
+			continue // column headers
+		}
+		name, stats, ok := strings.Cut(s.Text(), ":")
+		if !ok {
+			return 0, 0, fmt.Errorf("line %d: no interface name", n)
+		}
+		if strings.TrimSpace(name) == "lo" {
+			continue
+		}
+		// The received counters come first, then the sent ones,
+		// each starting with bytes.
+		f := strings.Fields(stats)
+		if len(f) < 16 {
+			return 0, 0, fmt.Errorf("line %d: %d fields; want 16", n, len(f))
+		}
+		r, err1 := strconv.ParseInt(f[0], 10, 64)
+		t, err2 := strconv.ParseInt(f[8], 10, 64)
+		if err1 != nil || err2 != nil {
+			return 0, 0, fmt.Errorf("line %d: invalid byte counts", n)
+		}
+		recv += r
+		sent += t
+	}
+	return recv, sent, s.Err()
+}
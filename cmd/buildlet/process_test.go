@@ -0,0 +1,140 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/binary"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestFindDescendants(t *testing.T) {
+	ps := psTree{
+		1:  0,
+		10: 1,
+		11: 10,
+		12: 10,
+		13: 12,
+		20: 1, // sibling of 10
+		21: 20,
+	}
+	got := ps.findDescendants(10)
+	sort.Ints(got)
+	if diff := cmp.Diff([]int{11, 12, 13}, got); diff != "" {
+		t.Errorf("findDescendants(10) mismatch (-want +got):\n%s", diff)
+	}
+	if got := ps.findDescendants(13); len(got) != 0 {
+		t.Errorf("findDescendants(13) = %v, want none", got)
+	}
+}
+
+func TestParsePsinfo(t *testing.T) {
+	b := make([]byte, 416) // sizeof(psinfo_t) on amd64
+	binary.LittleEndian.PutUint32(b[0:], 0x2000)
+	binary.LittleEndian.PutUint32(b[4:], 3)
+	binary.LittleEndian.PutUint32(b[8:], 1234)
+	binary.LittleEndian.PutUint32(b[12:], 1)
+	binary.LittleEndian.PutUint32(b[16:], 1234)
+	pid, ppid, err := parsePsinfo(b)
+	if err != nil || pid != 1234 || ppid != 1 {
+		t.Errorf("parsePsinfo = %v, %v, %v, want 1234, 1, nil", pid, ppid, err)
+	}
+	if _, _, err := parsePsinfo(b[:12]); err == nil {
+		t.Errorf("parsePsinfo(short) succeeded, want error")
+	}
+}
+
+func TestPlan9ExitStatus(t *testing.T) {
+	for _, tc := range []struct {
+		msg, want string
+	}{
+		{"", "exit status 0"},
+		{"go 1234: exit status 2", "exit status 1: exit status 2"},
+		{"rc 56: rc: fail", "exit status 1: rc: fail"},
+		{"8.out 78: sys: kill", "signal: killed"},
+		{"test.exe 90: killed", "signal: killed"},
+		{"rc 12: interrupt", "signal: interrupt"},
+		{"no pid here", "exit status 1: no pid here"},
+	} {
+		if got := plan9ExitStatus(tc.msg); got != tc.want {
+			t.Errorf("plan9ExitStatus(%q) = %q, want %q", tc.msg, got, tc.want)
+		}
+	}
+}
+
+func TestProcessGroup(t *testing.T) {
+	defer func(id func(*os.Process) int, killGroup func(int) error, killTree func(*os.Process) error) {
+		processGroupID, killProcessGroup, killProcessTree = id, killGroup, killTree
+	}(processGroupID, killProcessGroup, killProcessTree)
+
+	var killed []string
+	processGroupID = func(p *os.Process) int { return p.Pid + 1 }
+	killProcessGroup = func(id int) error {
+		if id != 43 {
+			t.Errorf("killProcessGroup(%d), want 43", id)
+		}
+		killed = append(killed, "group")
+		return nil
+	}
+	killProcessTree = func(p *os.Process) error {
+		killed = append(killed, "tree")
+		return nil
+	}
+
+	g := newProcessGroup(&os.Process{Pid: 42})
+	if err := g.kill(); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.cleanup(); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"tree", "group", "group"}, killed); diff != "" {
+		t.Errorf("kills mismatch (-want +got):\n%s", diff)
+	}
+
+	// Without a group, cleanup has nothing to do.
+	killed = nil
+	processGroupID = func(*os.Process) int { return 0 }
+	if err := newProcessGroup(&os.Process{Pid: 42}).cleanup(); err != nil || killed != nil {
+		t.Errorf("cleanup without a group = %v and killed %v, want nil and nothing", err, killed)
+	}
+}
+
+func TestParseNetDev(t *testing.T) {
+	const netDev = `Inter-|   Receive                                                |  Transmit
+ face |bytes    packets errs drop fifo frame compressed multicast|bytes    packets errs drop fifo colls carrier compressed
+    lo: 9000000   12000    0    0    0     0          0         0  9000000   12000    0    0    0     0       0          0
+  ens4: 1500000    3000    0    0    0     0          0         0   250000    2000    0    0    0     0       0          0
+    wg0:    1000      10    0    0    0     0          0         0     2000      20    0    0    0     0       0          0
+`
+	recv, sent, err := parseNetDev(strings.NewReader(netDev))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recv != 1501000 || sent != 252000 {
+		t.Errorf("parseNetDev = %d, %d; want 1501000, 252000", recv, sent)
+	}
+
+	if _, _, err := parseNetDev(strings.NewReader("header\nheader\n  eth0: 1 2 3\n")); err == nil {
+		t.Errorf("parseNetDev of a truncated line succeeded; want error")
+	}
+}
+
+func TestParsePs(t *testing.T) {
+	got, err := parsePs([]byte("    1     0\n  100     1\n  101   100\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(psTree{1: 0, 100: 1, 101: 100}, got); diff != "" {
+		t.Errorf("parsePs mismatch (-want +got):\n%s", diff)
+	}
+	if _, err := parsePs([]byte("1 0\nPID PPID\n")); err == nil {
+		t.Errorf("parsePs of a header succeeded; want error")
+	}
+}
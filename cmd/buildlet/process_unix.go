@@ -0,0 +1,83 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build unix
+// +build unix
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"runtime"
+	"syscall"
+)
+
+func init() {
+	maxRSS = maxRSSUnix
+	quitProcessTree = quitProcessTreeUnix
+	if snapshotProcesses == nil {
+		// Not already set by buildlet_solaris.go, whose init
+		// function runs first.
+		snapshotProcesses = snapshotPsProcesses
+	}
+	if runtime.GOOS == "linux" {
+		// Elsewhere, the block counts of rusage are numbers of
+		// operations rather than of 512-byte blocks.
+		ioBytes = ioBytesLinux
+		netBytes = netBytesLinux
+	}
+}
+
+func maxRSSUnix(ps *os.ProcessState) int64 {
+	ru, ok := ps.SysUsage().(*syscall.Rusage)
+	if !ok {
+		return 0
+	}
+	if runtime.GOOS == "darwin" || runtime.GOOS == "ios" {
+		return int64(ru.Maxrss) // already in bytes
+	}
+	return int64(ru.Maxrss) << 10 // in KiB
+}
+
+func ioBytesLinux(ps *os.ProcessState) (read, written int64, ok bool) {
+	ru, ok := ps.SysUsage().(*syscall.Rusage)
+	if !ok {
+		return 0, 0, false
+	}
+	return int64(ru.Inblock) * 512, int64(ru.Oublock) * 512, true
+}
+
+func netBytesLinux() (recv, sent int64, ok bool) {
+	f, err := os.Open("/proc/net/dev")
+	if err != nil {
+		return 0, 0, false
+	}
+	defer f.Close()
+	recv, sent, err = parseNetDev(f)
+	return recv, sent, err == nil
+}
+
+// quitProcessTreeUnix sends SIGQUIT to p and its descendants, deepest
+// first.
+func quitProcessTreeUnix(p *os.Process) error {
+	ps, err := snapshotProcesses()
+	if err != nil {
+		return err
+	}
+	pids := ps.findDescendants(p.Pid)
+	for i := len(pids) - 1; i >= 0; i-- {
+		syscall.Kill(pids[i], syscall.SIGQUIT)
+	}
+	return p.Signal(syscall.SIGQUIT)
+}
+
+// snapshotPsProcesses reads the system process tree from ps.
+func snapshotPsProcesses() (psTree, error) {
+	out, err := exec.Command("ps", "-A", "-o", "pid=", "-o", "ppid=").Output()
+	if err != nil {
+		return nil, err
+	}
+	return parsePs(out)
+}
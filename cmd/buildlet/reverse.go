@@ -53,12 +53,9 @@ func isDevReverseMode() bool {
 	return !strings.HasPrefix(*coordinator, "farmer.golang.org")
 }
 
-// dialCoordinator dials the coordinator to establish a revdial connection
-// where the returned net.Listener can be used to accept connections from the
-// coordinator.
-func dialCoordinator() (net.Listener, error) {
-	devMode := isDevReverseMode()
-
+// setReverseHostname sets *hostname to the name this buildlet
+// advertises to the coordinator, if it wasn't set by a flag.
+func setReverseHostname() {
 	if *hostname == "" {
 		*hostname = os.Getenv("HOSTNAME")
 		if *hostname == "" {
@@ -68,6 +65,15 @@ func dialCoordinator() (net.Listener, error) {
 			*hostname = "buildlet"
 		}
 	}
+}
+
+// dialCoordinator dials the coordinator to establish a revdial connection
+// where the returned net.Listener can be used to accept connections from the
+// coordinator.
+func dialCoordinator() (net.Listener, error) {
+	devMode := isDevReverseMode()
+
+	setReverseHostname()
 
 	key, err := keyForMode(*reverseType)
 	if err != nil {
@@ -125,6 +131,7 @@ func dialCoordinator() (net.Listener, error) {
 		req.Header.Set("X-Go-Builder-Hostname", *hostname)
 		req.Header.Set("X-Go-Builder-Version", strconv.Itoa(buildletVersion))
 		req.Header.Set("X-Revdial-Version", "2")
+		setSelfTestHeader(req)
 		if err := req.Write(bufw); err != nil {
 			return nil, fmt.Errorf("coordinator /reverse request failed: %v", err)
 		}
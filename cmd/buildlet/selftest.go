@@ -0,0 +1,255 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/build/types"
+)
+
+var (
+	selfTestMu sync.Mutex
+	// selfTestReport is the result of the latest self-test, sent to
+	// the coordinator on registration. It's nil if -self-test is
+	// false. It's guarded by selfTestMu.
+	selfTestReport *types.BuildletSelfTest
+)
+
+const (
+	// selfTestTries is how many times the startup self-test runs
+	// before the buildlet registers with its failures, so that a
+	// transient failure at boot, such as the network not being up
+	// yet, doesn't keep it from getting work.
+	selfTestTries = 3
+	// selfTestDiskBytes is how much the disk check writes.
+	selfTestDiskBytes = 16 << 20
+	// minDiskMBps is the slowest work directory throughput that
+	// passes the disk check. It only catches badly broken disks;
+	// some builders legitimately run on SD cards.
+	minDiskMBps = 1
+)
+
+var (
+	// selfTestRetryDelay is how long to wait between the startup
+	// self-test's tries.
+	selfTestRetryDelay = 20 * time.Second
+	// selfTestRecheckInterval is how often a buildlet whose
+	// self-test failed runs it again.
+	selfTestRecheckInterval = 10 * time.Minute
+)
+
+// minSaneTime is a time before which the local clock is certainly
+// wrong, such as after losing its RTC battery.
+var minSaneTime = time.Date(2023, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// runSelfTest checks that this machine is in a state to run builds:
+// that the bootstrap toolchain works, the work directory has a sane
+// write speed, the coordinator is reachable, and the clock is plausible.
+func runSelfTest() *types.BuildletSelfTest {
+	r := &types.BuildletSelfTest{
+		GOOS:   runtime.GOOS,
+		GOARCH: runtime.GOARCH,
+		NumCPU: runtime.NumCPU(),
+		CC:     findCC(),
+	}
+	fail := func(format string, args ...interface{}) {
+		r.Failures = append(r.Failures, fmt.Sprintf(format, args...))
+	}
+
+	if goroot := os.Getenv("GOROOT_BOOTSTRAP"); goroot != "" {
+		v, err := bootstrapVersion(goroot)
+		if err != nil {
+			fail("bootstrap toolchain: %v", err)
+		}
+		r.GoBootstrap = v
+	}
+
+	mbps, err := diskMBps(*workDir)
+	if err != nil {
+		fail("disk: %v", err)
+	} else if mbps < minDiskMBps {
+		fail("disk: work directory writes at %.2f MB/s, want at least %d MB/s", mbps, minDiskMBps)
+	}
+	r.DiskMBps = mbps
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	t0 := time.Now()
+	if c, err := dialCoordinatorTCP(ctx, selfTestCoordinatorAddr()); err != nil {
+		fail("network: dialing coordinator: %v", err)
+	} else {
+		r.CoordinatorRTT = time.Since(t0)
+		c.Close()
+	}
+
+	if now := time.Now(); now.Before(minSaneTime) {
+		fail("clock: local time is %v", now.UTC().Format(time.RFC3339))
+	}
+	return r
+}
+
+// runStartupSelfTest runs the self-test up to selfTestTries times,
+// until it passes, and returns the last report.
+func runStartupSelfTest() *types.BuildletSelfTest {
+	for try := 1; ; try++ {
+		r := runSelfTest()
+		if len(r.Failures) == 0 || try == selfTestTries {
+			return r
+		}
+		log.Printf("Self-test failed on attempt %d, will try again in %v: %s", try, selfTestRetryDelay, strings.Join(r.Failures, "; "))
+		time.Sleep(selfTestRetryDelay)
+	}
+}
+
+// setSelfTest sets the report sent to the coordinator on registration.
+func setSelfTest(r *types.BuildletSelfTest) {
+	selfTestMu.Lock()
+	defer selfTestMu.Unlock()
+	selfTestReport = r
+}
+
+// selfTestFailed reports whether the latest self-test failed.
+func selfTestFailed() bool {
+	selfTestMu.Lock()
+	defer selfTestMu.Unlock()
+	return selfTestReport != nil && len(selfTestReport.Failures) > 0
+}
+
+// recheckSelfTest runs the self-test every selfTestRecheckInterval
+// until it passes or done is closed. Once it passes, it records the
+// new report and calls passed, which makes the buildlet register
+// with the coordinator again so that it's given work.
+func recheckSelfTest(done <-chan struct{}, passed func()) {
+	t := time.NewTicker(selfTestRecheckInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-t.C:
+		}
+		r := runSelfTest()
+		logSelfTest(r)
+		if len(r.Failures) == 0 {
+			setSelfTest(r)
+			passed()
+			return
+		}
+	}
+}
+
+// findCC returns the path of the C compiler, or the empty string if
+// there is none. Not all builders need one, so its absence isn't a
+// failure.
+func findCC() string {
+	names := []string{"cc", "gcc", "clang"}
+	if cc := strings.Fields(os.Getenv("CC")); len(cc) > 0 {
+		names = cc[:1]
+	}
+	for _, name := range names {
+		if p, err := exec.LookPath(name); err == nil {
+			return p
+		}
+	}
+	return ""
+}
+
+// bootstrapVersion returns the "go version" output of the toolchain
+// in goroot.
+func bootstrapVersion(goroot string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	goBin := filepath.Join(goroot, "bin", "go")
+	if runtime.GOOS == "windows" {
+		goBin += ".exe"
+	}
+	cmd := exec.CommandContext(ctx, goBin, "version")
+	cmd.Env = append(os.Environ(), "GOROOT="+goroot)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("%s version: %v: %s", goBin, err, bytes.TrimSpace(out))
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// diskMBps measures how fast a file can be written and synced in dir.
+func diskMBps(dir string) (float64, error) {
+	f, err := os.CreateTemp(dir, ".selftest-")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	buf := make([]byte, 1<<20)
+	for i := range buf {
+		buf[i] = byte(i)
+	}
+	t0 := time.Now()
+	for n := 0; n < selfTestDiskBytes; n += len(buf) {
+		if _, err := f.Write(buf); err != nil {
+			return 0, err
+		}
+	}
+	if err := f.Sync(); err != nil {
+		return 0, err
+	}
+	d := time.Since(t0)
+	if d <= 0 {
+		d = time.Nanosecond
+	}
+	return float64(selfTestDiskBytes) / 1e6 / d.Seconds(), nil
+}
+
+// selfTestCoordinatorAddr returns the host:port of *coordinator,
+// defaulting to the HTTPS port.
+func selfTestCoordinatorAddr() string {
+	if _, _, err := net.SplitHostPort(*coordinator); err == nil {
+		return *coordinator
+	}
+	return net.JoinHostPort(*coordinator, "443")
+}
+
+// logSelfTest logs a summary of r.
+func logSelfTest(r *types.BuildletSelfTest) {
+	log.Printf("Self-test: %s/%s, %d CPUs, C compiler %q, bootstrap %q, disk %.1f MB/s, coordinator dialed in %v",
+		r.GOOS, r.GOARCH, r.NumCPU, r.CC, r.GoBootstrap, r.DiskMBps, r.CoordinatorRTT.Round(time.Millisecond))
+	for _, f := range r.Failures {
+		log.Printf("Self-test FAILED: %s", f)
+	}
+	if len(r.Failures) > 0 {
+		log.Printf("The coordinator won't schedule work on this buildlet until the self-test passes; it runs again every %v.", selfTestRecheckInterval)
+	}
+}
+
+// setSelfTestHeader adds the self-test report, if any, to a
+// registration request.
+func setSelfTestHeader(req *http.Request) {
+	selfTestMu.Lock()
+	defer selfTestMu.Unlock()
+	if selfTestReport == nil {
+		return
+	}
+	r := *selfTestReport
+	r.Time = time.Now()
+	j, err := json.Marshal(&r)
+	if err != nil {
+		log.Fatalf("encoding self-test report: %v", err)
+	}
+	req.Header.Set(types.BuildletSelfTestHeader, string(j))
+}
@@ -0,0 +1,86 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunSelfTest(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	oldWorkDir, oldCoordinator := *workDir, *coordinator
+	defer func() { *workDir, *coordinator = oldWorkDir, oldCoordinator }()
+	*workDir = t.TempDir()
+	*coordinator = ln.Addr().String()
+	t.Setenv("GOROOT_BOOTSTRAP", "")
+
+	r := runSelfTest()
+	if len(r.Failures) != 0 {
+		t.Errorf("runSelfTest failures = %q; want none", r.Failures)
+	}
+	if r.DiskMBps <= 0 || r.CoordinatorRTT <= 0 {
+		t.Errorf("runSelfTest = %+v; want positive disk throughput and coordinator RTT", r)
+	}
+
+	// An unusable bootstrap toolchain and an unreachable
+	// coordinator both fail.
+	t.Setenv("GOROOT_BOOTSTRAP", t.TempDir())
+	ln.Close()
+	r = runSelfTest()
+	if len(r.Failures) != 2 ||
+		!strings.HasPrefix(r.Failures[0], "bootstrap toolchain: ") ||
+		!strings.HasPrefix(r.Failures[1], "network: ") {
+		t.Errorf("runSelfTest failures = %q; want bootstrap toolchain and network failures", r.Failures)
+	}
+}
+
+func TestRecheckSelfTest(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	oldWorkDir, oldCoordinator, oldInterval := *workDir, *coordinator, selfTestRecheckInterval
+	defer func() {
+		*workDir, *coordinator, selfTestRecheckInterval = oldWorkDir, oldCoordinator, oldInterval
+		setSelfTest(nil)
+	}()
+	// The disk check fails until the work directory exists.
+	*workDir = filepath.Join(t.TempDir(), "work")
+	*coordinator = ln.Addr().String()
+	selfTestRecheckInterval = 10 * time.Millisecond
+	t.Setenv("GOROOT_BOOTSTRAP", "")
+
+	setSelfTest(runSelfTest())
+	if !selfTestFailed() {
+		t.Fatal("selfTestFailed = false before the work directory exists; want true")
+	}
+	done, passed := make(chan struct{}), make(chan struct{})
+	defer close(done)
+	go recheckSelfTest(done, func() { close(passed) })
+	time.Sleep(50 * time.Millisecond)
+	if err := os.Mkdir(*workDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-passed:
+	case <-time.After(10 * time.Second):
+		t.Fatal("recheckSelfTest didn't report that the self-test passed")
+	}
+	if selfTestFailed() {
+		t.Error("selfTestFailed = true after the self-test passed; want false")
+	}
+}
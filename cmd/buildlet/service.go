@@ -0,0 +1,299 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+)
+
+// Functionality set non-nil by platforms on which the buildlet can run
+// as a system service:
+var (
+	// installService registers the buildlet as a service that starts
+	// at boot and restarts if it exits, and starts it.
+	installService func(*serviceConfig) error
+	// uninstallService stops and removes the named service.
+	uninstallService func(name string) error
+)
+
+// A serviceConfig describes the service that runs the buildlet. The
+// service runs stage0, which downloads the latest buildlet each time
+// it starts, so that the buildlet stays up to date.
+type serviceConfig struct {
+	Name string // service name on Windows, launchd label on macOS
+	Exe  string // path to the stage0 binary
+	Args []string
+	Env  map[string]string
+	// BuildletDir is where stage0 downloads the buildlet to.
+	BuildletDir string
+	// LogDir holds the buildlet's rotated logs, and on macOS the
+	// output of launchd.
+	LogDir string
+	// User is the user to run the buildlet as, on macOS. If empty,
+	// it runs as root.
+	User string
+}
+
+// defaultServiceName is the default name of the buildlet's service.
+func defaultServiceName() string {
+	if runtime.GOOS == "darwin" {
+		return "org.golang.buildlet"
+	}
+	return "buildlet"
+}
+
+// serviceCommand implements the "install" and "uninstall" subcommands,
+// which register the buildlet as a Windows service or launchd daemon
+// in place of hand-maintained start-up scripts:
+//
+//	buildlet install [-name name] [-log-dir dir] [-env KEY=VALUE]... [-- buildlet flags]
+//	buildlet uninstall [-name name]
+//
+// The service runs stage0, which downloads and runs the latest
+// buildlet. It starts at boot, restarts stage0 when the buildlet
+// exits, and runs the buildlet with the given flags plus -log-file, so
+// that its logs are rotated.
+func serviceCommand(cmd string, args []string) error {
+	if installService == nil {
+		return fmt.Errorf("running the buildlet as a service isn't supported on %s", runtime.GOOS)
+	}
+	fs := flag.NewFlagSet(cmd, flag.ExitOnError)
+	name := fs.String("name", defaultServiceName(), "service name on Windows, or launchd label on macOS")
+	if cmd == "uninstall" {
+		fs.Parse(args)
+		return uninstallService(*name)
+	}
+	c := &serviceConfig{Env: map[string]string{}}
+	stage0 := fs.String("stage0", "", "path to the stage0 binary to run as the service; if empty, stage0 next to this buildlet binary")
+	fs.StringVar(&c.BuildletDir, "buildlet-dir", defaultServiceBuildletDir(), "directory for stage0 to download the buildlet to")
+	fs.StringVar(&c.LogDir, "log-dir", defaultServiceLogDir(), "directory for the buildlet's logs")
+	fs.StringVar(&c.User, "user", "", "on macOS, the user to run the buildlet as; root if empty")
+	fs.Func("env", "environment variable for the buildlet, as KEY=VALUE; may be repeated", func(kv string) error {
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok || k == "" {
+			return fmt.Errorf("want KEY=VALUE, got %q", kv)
+		}
+		c.Env[k] = v
+		return nil
+	})
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: buildlet install [flags] [-- buildlet flags]\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	c.Name = *name
+	if *stage0 == "" {
+		exe, err := os.Executable()
+		if err != nil {
+			return err
+		}
+		*stage0 = filepath.Join(filepath.Dir(exe), "stage0")
+		if runtime.GOOS == "windows" {
+			*stage0 += ".exe"
+		}
+	}
+	var err error
+	if c.Exe, err = filepath.Abs(*stage0); err != nil {
+		return err
+	}
+	if _, err := os.Stat(c.Exe); err != nil {
+		return fmt.Errorf("stage0 binary: %v", err)
+	}
+	if c.BuildletDir, err = filepath.Abs(c.BuildletDir); err != nil {
+		return err
+	}
+	for _, dir := range []string{c.LogDir, c.BuildletDir} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+	c.Args = serviceArgs(c.BuildletDir, fs.Args(), filepath.Join(c.LogDir, "buildlet.log"))
+	return installService(c)
+}
+
+// serviceArgs returns the arguments to stage0 that make it download
+// the buildlet to dir and run it with buildletArgs, logging to logFile.
+func serviceArgs(dir string, buildletArgs []string, logFile string) []string {
+	args := []string{"-buildlet-dir=" + dir, "--"}
+	args = append(args, buildletArgs...)
+	return append(args, "-log-file="+logFile)
+}
+
+func defaultServiceBuildletDir() string {
+	switch runtime.GOOS {
+	case "windows":
+		return `C:\buildlet`
+	case "darwin":
+		return "/usr/local/buildlet"
+	}
+	return filepath.Join(os.TempDir(), "buildlet")
+}
+
+func defaultServiceLogDir() string {
+	switch runtime.GOOS {
+	case "windows":
+		return `C:\buildlet-logs`
+	case "darwin":
+		return "/Library/Logs/buildlet"
+	}
+	return filepath.Join(os.TempDir(), "buildlet-logs")
+}
+
+// sortedEnv returns env as a sorted list of KEY=VALUE strings.
+func sortedEnv(env map[string]string) []string {
+	var kvs []string
+	for k, v := range env {
+		kvs = append(kvs, k+"="+v)
+	}
+	sort.Strings(kvs)
+	return kvs
+}
+
+var launchdPlistTmpl = template.Must(template.New("plist").Funcs(template.FuncMap{
+	"xml": func(s string) (string, error) {
+		var b strings.Builder
+		err := xml.EscapeText(&b, []byte(s))
+		return b.String(), err
+	},
+}).Parse(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>Label</key>
+	<string>{{xml .Name}}</string>
+	<key>ProgramArguments</key>
+	<array>
+		<string>{{xml .Exe}}</string>
+{{- range .Args}}
+		<string>{{xml .}}</string>
+{{- end}}
+	</array>
+{{- if .Env}}
+	<key>EnvironmentVariables</key>
+	<dict>
+{{- range $k, $v := .Env}}
+		<key>{{xml $k}}</key>
+		<string>{{xml $v}}</string>
+{{- end}}
+	</dict>
+{{- end}}
+{{- if .User}}
+	<key>UserName</key>
+	<string>{{xml .User}}</string>
+{{- end}}
+	<key>RunAtLoad</key>
+	<true/>
+	<key>KeepAlive</key>
+	<true/>
+	<key>ThrottleInterval</key>
+	<integer>10</integer>
+	<key>StandardOutPath</key>
+	<string>{{xml .LogDir}}/launchd.log</string>
+	<key>StandardErrorPath</key>
+	<string>{{xml .LogDir}}/launchd.log</string>
+</dict>
+</plist>
+`))
+
+// launchdPlist returns the launchd property list of the daemon that
+// runs stage0 as described by c.
+func launchdPlist(c *serviceConfig) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := launchdPlistTmpl.Execute(&buf, c); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Log rotation parameters for -log-file.
+const (
+	logFileMaxSize = 10 << 20
+	logFileKeep    = 5
+)
+
+// setLogFile sends the log output to the file at path, rotating it as
+// it grows.
+func setLogFile(path string) error {
+	w, err := newRotatingFile(path, logFileMaxSize, logFileKeep)
+	if err != nil {
+		return err
+	}
+	log.SetOutput(w)
+	return nil
+}
+
+// A rotatingFile is a file that's renamed to name.1, name.1 to name.2,
+// and so on, dropping the oldest of keep files, once writes to it
+// exceed maxSize bytes.
+type rotatingFile struct {
+	name    string
+	maxSize int64
+	keep    int
+
+	mu   sync.Mutex
+	f    *os.File
+	size int64
+}
+
+func newRotatingFile(name string, maxSize int64, keep int) (*rotatingFile, error) {
+	r := &rotatingFile{name: name, maxSize: maxSize, keep: keep}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *rotatingFile) open() error {
+	f, err := os.OpenFile(r.name, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	r.f, r.size = f, fi.Size()
+	return nil
+}
+
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.size > 0 && r.size+int64(len(p)) > r.maxSize {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := r.f.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+// rotate rotates the files and reopens name. If that fails, the next
+// write tries again.
+func (r *rotatingFile) rotate() error {
+	r.f.Close()
+	for i := r.keep - 1; i > 0; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", r.name, i), fmt.Sprintf("%s.%d", r.name, i+1))
+	}
+	if r.keep > 0 {
+		os.Rename(r.name, r.name+".1")
+	} else {
+		os.Remove(r.name)
+	}
+	return r.open()
+}
@@ -0,0 +1,70 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+func init() {
+	installService = installLaunchDaemon
+	uninstallService = uninstallLaunchDaemon
+}
+
+// launchDaemonPath returns the path of the property list of the launchd
+// daemon with the given label.
+func launchDaemonPath(label string) string {
+	return filepath.Join("/Library/LaunchDaemons", label+".plist")
+}
+
+// installLaunchDaemon installs and starts a launchd daemon that runs
+// stage0 as described by c, replacing any with the same label.
+func installLaunchDaemon(c *serviceConfig) error {
+	plist, err := launchdPlist(c)
+	if err != nil {
+		return err
+	}
+	if c.User != "" {
+		// stage0 downloads the buildlet, and the buildlet writes
+		// its logs, as the user.
+		for _, dir := range []string{c.BuildletDir, c.LogDir} {
+			if out, err := exec.Command("chown", c.User, dir).CombinedOutput(); err != nil {
+				return fmt.Errorf("chown %s: %v\n%s", dir, err, out)
+			}
+		}
+	}
+	// Ignore errors: the daemon may not exist yet.
+	exec.Command("launchctl", "bootout", "system/"+c.Name).Run()
+	path := launchDaemonPath(c.Name)
+	if err := os.WriteFile(path, plist, 0644); err != nil {
+		return err
+	}
+	if out, err := exec.Command("launchctl", "bootstrap", "system", path).CombinedOutput(); err != nil {
+		return fmt.Errorf("launchctl bootstrap: %v\n%s", err, out)
+	}
+	log.Printf("installed and started launchd daemon %s (%s); logs are in %s", c.Name, path, c.LogDir)
+	return nil
+}
+
+// uninstallLaunchDaemon stops and removes the launchd daemon with the
+// given label.
+func uninstallLaunchDaemon(label string) error {
+	path := launchDaemonPath(label)
+	if _, err := os.Stat(path); err != nil {
+		return err
+	}
+	if out, err := exec.Command("launchctl", "bootout", "system/"+label).CombinedOutput(); err != nil {
+		log.Printf("launchctl bootout: %v\n%s", err, out)
+	}
+	if err := os.Remove(path); err != nil {
+		return err
+	}
+	log.Printf("uninstalled launchd daemon %s", label)
+	return nil
+}
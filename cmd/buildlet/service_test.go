@@ -0,0 +1,92 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLaunchdPlist(t *testing.T) {
+	plist, err := launchdPlist(&serviceConfig{
+		Name:   "org.golang.buildlet",
+		Exe:    "/usr/local/bin/stage0",
+		Args:   serviceArgs("/usr/local/buildlet", []string{"-reverse-type=host-darwin-amd64-13"}, "/Library/Logs/buildlet/buildlet.log"),
+		Env:    map[string]string{"GO_BUILDER_ENV": "macos", "PATH": "/usr/bin:/bin"},
+		LogDir: "/Library/Logs/buildlet",
+		User:   "gopher & co",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The property list must be well-formed, with special characters
+	// escaped.
+	d := xml.NewDecoder(strings.NewReader(string(plist)))
+	for {
+		if _, err := d.Token(); err != nil {
+			if err.Error() != "EOF" {
+				t.Fatalf("launchdPlist() isn't valid XML: %v\n%s", err, plist)
+			}
+			break
+		}
+	}
+	for _, want := range []string{
+		"<string>org.golang.buildlet</string>",
+		"<string>/usr/local/bin/stage0</string>",
+		"<string>-buildlet-dir=/usr/local/buildlet</string>",
+		"<string>-reverse-type=host-darwin-amd64-13</string>",
+		"<key>GO_BUILDER_ENV</key>\n\t\t<string>macos</string>",
+		"<string>gopher &amp; co</string>",
+		"<key>KeepAlive</key>\n\t<true/>",
+	} {
+		if !strings.Contains(string(plist), want) {
+			t.Errorf("launchdPlist() doesn't contain %q:\n%s", want, plist)
+		}
+	}
+}
+
+func TestServiceArgs(t *testing.T) {
+	// stage0 must pass everything after its own flags, including
+	// -log-file, to the buildlet.
+	got := serviceArgs("/usr/local/buildlet", []string{"-reverse-type=host-darwin-amd64-13", "-halt=false"}, "/Library/Logs/buildlet/buildlet.log")
+	want := []string{"-buildlet-dir=/usr/local/buildlet", "--", "-reverse-type=host-darwin-amd64-13", "-halt=false", "-log-file=/Library/Logs/buildlet/buildlet.log"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("serviceArgs() = %q; want %q", got, want)
+	}
+}
+
+func TestRotatingFile(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "buildlet.log")
+	r, err := newRotatingFile(name, 10, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"aaaa\n", "bbbb\n", "cccc\n", "dddd\n", "eeee\n", "ffff\n", "gggg\n"} {
+		if _, err := r.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r.f.Close()
+	for file, want := range map[string]string{
+		name:        "gggg\n",
+		name + ".1": "eeee\nffff\n",
+		name + ".2": "cccc\ndddd\n",
+	} {
+		got, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != want {
+			t.Errorf("%s = %q; want %q", filepath.Base(file), got, want)
+		}
+	}
+	if _, err := os.Stat(name + ".3"); err == nil {
+		t.Errorf("%s.3 exists; want only 2 old files kept", filepath.Base(name))
+	}
+}
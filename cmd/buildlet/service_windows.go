@@ -0,0 +1,100 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"golang.org/x/sys/windows/registry"
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+func init() {
+	installService = installWindowsService
+	uninstallService = uninstallWindowsService
+}
+
+// installWindowsService installs and starts a Windows service that
+// runs stage0 as described by c, replacing any with the same
+// name.
+func installWindowsService(c *serviceConfig) error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return err
+	}
+	defer m.Disconnect()
+	if s, err := m.OpenService(c.Name); err == nil {
+		s.Close()
+		if err := uninstallWindowsService(c.Name); err != nil {
+			return fmt.Errorf("removing existing service: %v", err)
+		}
+	}
+	s, err := m.CreateService(c.Name, c.Exe, mgr.Config{
+		StartType:   mgr.StartAutomatic,
+		DisplayName: "Go buildlet",
+		Description: "Runs builds and tests for the Go build infrastructure.",
+	}, c.Args...)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	// Restart stage0, and so update the buildlet, whenever the
+	// buildlet exits, as it does after each build in reverse mode.
+	restart := mgr.RecoveryAction{Type: mgr.ServiceRestart, Delay: 10 * time.Second}
+	if err := s.SetRecoveryActions([]mgr.RecoveryAction{restart, restart, restart}, uint32((24 * time.Hour).Seconds())); err != nil {
+		return fmt.Errorf("setting recovery actions: %v", err)
+	}
+	if err := s.SetRecoveryActionsOnNonCrashFailures(true); err != nil {
+		return fmt.Errorf("setting recovery actions: %v", err)
+	}
+	if len(c.Env) != 0 {
+		k, err := registry.OpenKey(registry.LOCAL_MACHINE, `SYSTEM\CurrentControlSet\Services\`+c.Name, registry.SET_VALUE)
+		if err != nil {
+			return err
+		}
+		defer k.Close()
+		if err := k.SetStringsValue("Environment", sortedEnv(c.Env)); err != nil {
+			return fmt.Errorf("setting environment: %v", err)
+		}
+	}
+	if err := s.Start(); err != nil {
+		return err
+	}
+	log.Printf("installed and started service %s; logs are in %s", c.Name, c.LogDir)
+	return nil
+}
+
+// uninstallWindowsService stops and removes the named Windows service.
+func uninstallWindowsService(name string) error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return err
+	}
+	defer m.Disconnect()
+	s, err := m.OpenService(name)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	if st, err := s.Query(); err == nil && st.State != svc.Stopped {
+		if _, err := s.Control(svc.Stop); err != nil {
+			log.Printf("stopping service %s: %v", name, err)
+		}
+		for i := 0; i < 30 && st.State != svc.Stopped; i++ {
+			time.Sleep(time.Second)
+			if st, err = s.Query(); err != nil {
+				break
+			}
+		}
+	}
+	if err := s.Delete(); err != nil {
+		return err
+	}
+	log.Printf("uninstalled service %s", name)
+	return nil
+}
@@ -7,7 +7,7 @@
 // it. If not on GCE, such as when in a Linux Docker container being
 // developed and tested locally, the stage0 instead looks for the
 // META_BUILDLET_BINARY_URL environment to have a URL to the buildlet
-// binary.
+// binary. Arguments after stage0's flags are passed to the buildlet.
 //
 // The stage0 binary is typically baked into the VM or container
 // images or manually copied to dedicated once and is typically never
@@ -26,6 +26,7 @@ import (
 	"os/exec"
 	"path/filepath"
 	"runtime"
+	"sync"
 	"time"
 
 	"cloud.google.com/go/compute/metadata"
@@ -48,6 +49,14 @@ var (
 	untarDestDir = flag.String("untar-dest-dir", "", "destination directory to untar --untar-file to")
 )
 
+var buildletDir = flag.String("buildlet-dir", "", "directory to download the buildlet to; the current directory if empty. Set by \"buildlet install\".")
+
+// runAsService is set non-nil on platforms where stage0 can run as a
+// system service, as registered by "buildlet install". If stage0 was
+// started by the service manager, it tells the manager that it's
+// running, and when the manager stops it, calls stop and exits.
+var runAsService func(stop func())
+
 // configureSerialLogOutput and closeSerialLogOutput are set non-nil
 // on some platforms to configure log output to go to the serial
 // console and to close the serial port, respectively.
@@ -64,6 +73,9 @@ func main() {
 	}
 	log.SetPrefix("stage0: ")
 	flag.Parse()
+	if runAsService != nil {
+		runAsService(stopBuildlet)
+	}
 
 	onGCE := metadata.OnGCE()
 	if *untarFile != "" {
@@ -102,6 +114,9 @@ func main() {
 	// Note: we name it ".exe" for Windows, but the name also
 	// works fine on Linux, etc.
 	target := filepath.FromSlash("./buildlet.exe")
+	if *buildletDir != "" {
+		target = filepath.Join(*buildletDir, "buildlet.exe")
+	}
 	if err := download(target, buildletURL()); err != nil {
 		sleepFatalf("Downloading %s: %v", buildletURL(), err)
 	}
@@ -195,7 +210,14 @@ func main() {
 	if closeSerialLogOutput != nil {
 		closeSerialLogOutput()
 	}
-	err := cmd.Run()
+	cmd.Args = append(cmd.Args, flag.Args()...)
+	err := cmd.Start()
+	if err == nil {
+		buildlet.Lock()
+		buildlet.process = cmd.Process
+		buildlet.Unlock()
+		err = cmd.Wait()
+	}
 	if err != nil {
 		if configureSerialLogOutput != nil {
 			configureSerialLogOutput()
@@ -204,6 +226,21 @@ func main() {
 	}
 }
 
+// buildlet is the running buildlet process, if any.
+var buildlet struct {
+	sync.Mutex
+	process *os.Process
+}
+
+// stopBuildlet kills the running buildlet, if any.
+func stopBuildlet() {
+	buildlet.Lock()
+	defer buildlet.Unlock()
+	if buildlet.process != nil {
+		buildlet.process.Kill()
+	}
+}
+
 // reverseHostTypeArgs returns the default arguments for the buildlet
 // for the provided host type. (one of the keys of the
 // x/build/dashboard.Hosts map)
@@ -10,11 +10,13 @@ import (
 	"os"
 
 	"github.com/tarm/serial"
+	"golang.org/x/sys/windows/svc"
 )
 
 func init() {
 	configureSerialLogOutput = configureSerialLogOutputWindows
 	closeSerialLogOutput = closeSerialLogOutputWindows
+	runAsService = runWindowsService
 }
 
 var com1 *serial.Port
@@ -41,3 +43,35 @@ func closeSerialLogOutputWindows() {
 		log.SetOutput(os.Stderr)
 	}
 }
+
+// runWindowsService, if stage0 is running as a Windows service, reports
+// to the service manager that it's running, and when the manager stops
+// it, calls stop and exits.
+func runWindowsService(stop func()) {
+	if ok, err := svc.IsWindowsService(); err != nil || !ok {
+		return
+	}
+	go func() {
+		if err := svc.Run("", serviceHandler{}); err != nil {
+			log.Printf("svc.Run: %v", err)
+		}
+		stop()
+		os.Exit(0)
+	}()
+}
+
+type serviceHandler struct{}
+
+func (serviceHandler) Execute(args []string, r <-chan svc.ChangeRequest, s chan<- svc.Status) (bool, uint32) {
+	s <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+	for req := range r {
+		switch req.Cmd {
+		case svc.Interrogate:
+			s <- req.CurrentStatus
+		case svc.Stop, svc.Shutdown:
+			s <- svc.Status{State: svc.StopPending}
+			return false, 0
+		}
+	}
+	return false, 0
+}
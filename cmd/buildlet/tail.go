@@ -0,0 +1,172 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"golang.org/x/build/buildlet"
+)
+
+// tailPollInterval is how often handleTail checks a file that it has
+// read to the end for new contents.
+var tailPollInterval = 250 * time.Millisecond
+
+// tailChunkSize is the maximum size of the data of a TailEvent.
+const tailChunkSize = 32 << 10
+
+// handleTail streams the contents of a file in the work directory as
+// they're appended to it, like tail -f, until the client goes away.
+// The response is a stream of JSON-encoded buildlet.TailEvents.
+//
+// The file is followed by name: if it's replaced, say by log
+// rotation, or truncated, handleTail sends an event with Rotated set
+// and continues from the start of the new contents.
+func handleTail(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "requires GET method", http.StatusBadRequest)
+		return
+	}
+	rel, err := nativeRelPath(r.FormValue("path"))
+	if err != nil {
+		http.Error(w, "invalid 'path' parameter: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	var offset int64
+	if v := r.FormValue("offset"); v != "" {
+		offset, err = strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			http.Error(w, "invalid 'offset' parameter: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	t, err := newTailer(filepath.Join(*workDir, filepath.FromSlash(rel)), offset)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer t.close()
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+	enc := json.NewEncoder(flushWriter{w})
+	buf := make([]byte, tailChunkSize)
+	for {
+		ev, err := t.poll(buf)
+		if err != nil {
+			log.Printf("tail of %s: %v", rel, err)
+			// Break the chunked response to signal the failure.
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			conn.Close()
+			return
+		}
+		if ev.Rotated || len(ev.Data) > 0 {
+			if err := enc.Encode(ev); err != nil {
+				return
+			}
+			continue
+		}
+		select {
+		case <-r.Context().Done():
+			return
+		case <-time.After(tailPollInterval):
+		}
+	}
+}
+
+// A tailer follows a file by name as it's appended to.
+type tailer struct {
+	path   string
+	f      *os.File
+	fi     os.FileInfo // of f
+	offset int64       // in f of the next byte to read
+}
+
+// newTailer returns a tailer for path that starts reading at offset.
+// A negative offset counts back from the end of the file.
+func newTailer(path string, offset int64) (*tailer, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if !fi.Mode().IsRegular() {
+		f.Close()
+		return nil, errors.New(path + " is not a regular file")
+	}
+	if offset < 0 {
+		offset += fi.Size()
+		if offset < 0 {
+			offset = 0
+		}
+	}
+	return &tailer{path: path, f: f, fi: fi, offset: offset}, nil
+}
+
+func (t *tailer) close() { t.f.Close() }
+
+// poll returns the next event of the file, reading its data into buf.
+// If the file was read to the end and hasn't been replaced or
+// truncated since, the event is empty.
+func (t *tailer) poll(buf []byte) (buildlet.TailEvent, error) {
+	n, err := t.f.ReadAt(buf, t.offset)
+	if n > 0 {
+		ev := buildlet.TailEvent{Offset: t.offset, Data: buf[:n]}
+		t.offset += int64(n)
+		return ev, nil
+	}
+	if err != nil && err != io.EOF {
+		return buildlet.TailEvent{}, err
+	}
+
+	// Everything is read, so it's safe to move to a new file.
+	fi, err := os.Stat(t.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		// Renamed away, and its replacement isn't there yet.
+		return buildlet.TailEvent{}, nil
+	} else if err != nil {
+		return buildlet.TailEvent{}, err
+	}
+	if !os.SameFile(fi, t.fi) {
+		f, err := os.Open(t.path)
+		if errors.Is(err, fs.ErrNotExist) {
+			return buildlet.TailEvent{}, nil
+		} else if err != nil {
+			return buildlet.TailEvent{}, err
+		}
+		if fi, err = f.Stat(); err != nil {
+			f.Close()
+			return buildlet.TailEvent{}, err
+		}
+		t.f.Close()
+		t.f, t.fi, t.offset = f, fi, 0
+		return buildlet.TailEvent{Rotated: true}, nil
+	}
+	if fi.Size() < t.offset {
+		t.offset = 0
+		return buildlet.TailEvent{Rotated: true}, nil
+	}
+	return buildlet.TailEvent{}, nil
+}
@@ -0,0 +1,171 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"golang.org/x/build/buildlet"
+)
+
+func TestTailer(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("open files can't be renamed on Windows")
+	}
+	path := filepath.Join(t.TempDir(), "test.log")
+	write := func(flag int, s string) {
+		t.Helper()
+		f, err := os.OpenFile(path, flag|os.O_WRONLY|os.O_CREATE, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.WriteString(s); err != nil {
+			t.Fatal(err)
+		}
+		if err := f.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(os.O_TRUNC, "one\n")
+	tr, err := newTailer(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tr.close()
+	buf := make([]byte, 64)
+	poll := func(want buildlet.TailEvent) {
+		t.Helper()
+		ev, err := tr.poll(buf)
+		if err != nil {
+			t.Fatalf("poll: %v", err)
+		}
+		if ev.Rotated != want.Rotated || string(ev.Data) != string(want.Data) || ev.Offset != want.Offset {
+			t.Fatalf("poll = {Rotated: %v, Data: %q, Offset: %d}; want {Rotated: %v, Data: %q, Offset: %d}",
+				ev.Rotated, ev.Data, ev.Offset, want.Rotated, want.Data, want.Offset)
+		}
+	}
+
+	poll(buildlet.TailEvent{Data: []byte("one\n")})
+	poll(buildlet.TailEvent{})
+	write(os.O_APPEND, "two\n")
+	poll(buildlet.TailEvent{Data: []byte("two\n"), Offset: 4})
+
+	// Rotation: what's left in the old file comes before the new one.
+	write(os.O_APPEND, "last\n")
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	poll(buildlet.TailEvent{Data: []byte("last\n"), Offset: 8})
+	poll(buildlet.TailEvent{}) // no new file yet
+	write(os.O_TRUNC, "three\n")
+	poll(buildlet.TailEvent{Rotated: true})
+	poll(buildlet.TailEvent{Data: []byte("three\n")})
+
+	// Truncation.
+	write(os.O_TRUNC, "4\n")
+	poll(buildlet.TailEvent{Rotated: true})
+	poll(buildlet.TailEvent{Data: []byte("4\n")})
+}
+
+func TestNewTailerOffset(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.log")
+	if err := os.WriteFile(path, []byte("0123456789"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		offset, want int64
+	}{
+		{0, 0},
+		{3, 3},
+		{-4, 6},
+		{-20, 0},
+	} {
+		tr, err := newTailer(path, tt.offset)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tr.close()
+		if tr.offset != tt.want {
+			t.Errorf("newTailer(%d) starts at %d; want %d", tt.offset, tr.offset, tt.want)
+		}
+	}
+	if _, err := newTailer(filepath.Dir(path), 0); err == nil {
+		t.Errorf("newTailer of a directory succeeded; want error")
+	}
+}
+
+func TestHandleTail(t *testing.T) {
+	dir := setTestWorkDir(t)
+	oldInterval := tailPollInterval
+	tailPollInterval = time.Millisecond
+	t.Cleanup(func() { tailPollInterval = oldInterval })
+	if w := putFile("test.log", "hello\n"); w.Code != http.StatusOK {
+		t.Fatalf("write: %v %s", w.Code, w.Body)
+	}
+	ts := httptest.NewServer(http.HandlerFunc(handleTail))
+	defer ts.Close()
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bc := buildlet.NewClient(u.Host, buildlet.NoKeyPair)
+	defer bc.Close()
+
+	if err := bc.Tail(context.Background(), "missing.log", buildlet.TailOpts{}, func(buildlet.TailEvent) error {
+		return nil
+	}); err == nil {
+		t.Errorf("Tail of a missing file succeeded; want error")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := make(chan buildlet.TailEvent)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- bc.Tail(ctx, "test.log", buildlet.TailOpts{Offset: -3}, func(ev buildlet.TailEvent) error {
+			events <- ev
+			return nil
+		})
+	}()
+	next := func() buildlet.TailEvent {
+		t.Helper()
+		select {
+		case ev := <-events:
+			return ev
+		case err := <-errc:
+			t.Fatalf("Tail returned early: %v", err)
+		case <-time.After(10 * time.Second):
+			t.Fatal("timed out waiting for a tail event")
+		}
+		panic("unreachable")
+	}
+	if ev := next(); string(ev.Data) != "lo\n" || ev.Offset != 3 {
+		t.Errorf("first event = %q at %d; want %q at 3", ev.Data, ev.Offset, "lo\n")
+	}
+	f, err := os.OpenFile(filepath.Join(dir, "test.log"), os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteString("world\n"); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	if ev := next(); string(ev.Data) != "world\n" || ev.Offset != 6 {
+		t.Errorf("second event = %q at %d; want %q at 6", ev.Data, ev.Offset, "world\n")
+	}
+	cancel()
+	if err := <-errc; !errors.Is(err, context.Canceled) {
+		t.Errorf("Tail error = %v; want %v", err, context.Canceled)
+	}
+}
@@ -9,6 +9,7 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"flag"
 	"fmt"
 	"io"
@@ -50,7 +51,7 @@ func main() {
 	pubKey, privPath := genKey()
 
 	log.Printf("hitting buildlet's /connect-ssh ...")
-	buildletConn, err := bc.ConnectSSH(*user, pubKey)
+	buildletConn, err := bc.ConnectSSH(context.Background(), *user, pubKey)
 	if err != nil {
 		var out []byte
 		if *container != "" {
@@ -0,0 +1,108 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// When a command run by /exec times out, the buildlet captures the
+// state of the system and asks the command to dump its own before it
+// kills it, and writes them to the command's output, so that timeouts
+// come with the evidence needed to debug them.
+
+var (
+	// timeoutStateCommands are the commands whose output describes
+	// the state of the system.
+	timeoutStateCommands = stateCommands(runtime.GOOS)
+
+	// timeoutStateCommandTimeout is how long each of
+	// timeoutStateCommands may run.
+	timeoutStateCommandTimeout = 10 * time.Second
+
+	// timeoutQuitGrace is how long a command that timed out has to
+	// dump its state and exit after it's sent SIGQUIT, before it's
+	// killed.
+	timeoutQuitGrace = 10 * time.Second
+)
+
+// stateCommands returns the commands whose output describes the
+// processes, network connections and memory of a goos system.
+func stateCommands(goos string) [][]string {
+	switch goos {
+	case "windows":
+		return [][]string{{"tasklist", "/v"}, {"netstat", "-ano"}}
+	case "plan9":
+		return [][]string{{"ps", "-a"}, {"netstat", "-n"}, {"cat", "/dev/swap"}}
+	}
+	ps := []string{"ps", "-A", "-o", "pid,ppid,stat,etime,time,rss,args"}
+	if goos == "solaris" || goos == "illumos" {
+		ps = []string{"ps", "-A", "-o", "pid,ppid,s,etime,time,rss,args"}
+	}
+	cmds := [][]string{{"uptime"}, ps, {"netstat", "-an"}}
+	switch goos {
+	case "linux", "android":
+		cmds = append(cmds, []string{"cat", "/proc/meminfo"})
+	case "darwin", "ios":
+		cmds = append(cmds, []string{"vm_stat"})
+	default:
+		cmds = append(cmds, []string{"vmstat"})
+	}
+	return cmds
+}
+
+// captureTimeoutState writes the state of the system to w, then sends
+// SIGQUIT to g, the command that timed out, and waits for up to
+// timeoutQuitGrace for it to exit, which exited is closed on.
+func captureTimeoutState(w io.Writer, g *processGroup, timeout time.Duration, exited <-chan struct{}) {
+	fmt.Fprintf(w, "\n:: Timed out after %v. Capturing the state of the system before killing the command (pid %d).\n", timeout, g.p.Pid)
+	for _, args := range timeoutStateCommands {
+		fmt.Fprintf(w, "\n:: %s\n", strings.Join(args, " "))
+		ctx, cancel := context.WithTimeout(context.Background(), timeoutStateCommandTimeout)
+		out, err := exec.CommandContext(ctx, args[0], args[1:]...).CombinedOutput()
+		cancel()
+		w.Write(out)
+		if err != nil {
+			fmt.Fprintf(w, ":: %s failed: %v\n", args[0], err)
+		}
+	}
+
+	if quitProcessTree == nil {
+		fmt.Fprintf(w, "\n:: Killing the command.\n\n")
+		return
+	}
+	fmt.Fprintf(w, "\n:: Sending SIGQUIT to the command and its descendants, for Go programs to dump their goroutines.\n\n")
+	if err := quitProcessTree(g.p); err != nil {
+		fmt.Fprintf(w, ":: SIGQUIT failed: %v\n", err)
+		return
+	}
+	t := time.NewTimer(timeoutQuitGrace)
+	defer t.Stop()
+	select {
+	case <-exited:
+	case <-t.C:
+		fmt.Fprintf(w, "\n:: The command didn't exit %v after SIGQUIT. Killing it.\n", timeoutQuitGrace)
+	}
+}
+
+// A lockedWriter serializes the writes to w, so that the buildlet can
+// write to a command's output while the command does.
+type lockedWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (lw *lockedWriter) Write(p []byte) (int, error) {
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+	return lw.w.Write(p)
+}
@@ -0,0 +1,188 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/build/types"
+)
+
+// wireGuardRefreshInterval is how often a buildlet in the WireGuard
+// mesh re-registers, so that a restarted coordinator relearns it.
+const wireGuardRefreshInterval = 5 * time.Minute
+
+// joinWireGuardMesh registers with the coordinator's WireGuard mesh,
+// configures the *wireGuardIface interface accordingly, and returns
+// a listener on the buildlet's mesh address for the coordinator to
+// connect to.
+func joinWireGuardMesh() (net.Listener, error) {
+	if runtime.GOOS != "linux" {
+		return nil, fmt.Errorf("-wireguard-iface is not supported on %s", runtime.GOOS)
+	}
+	setReverseHostname()
+	key, err := keyForMode(*reverseType)
+	if err != nil {
+		log.Fatalf("failed to find key for %s: %v", *reverseType, err)
+	}
+
+	// Use a new key pair for every process. The coordinator replaces
+	// the peer of an earlier process when it sees the new key.
+	privKey, err := runCmd(nil, "wg", "genkey")
+	if err != nil {
+		return nil, err
+	}
+	pubKey, err := runCmd(privKey, "wg", "pubkey")
+	if err != nil {
+		return nil, err
+	}
+	reg := &types.WireGuardRegistration{PublicKey: strings.TrimSpace(string(pubKey))}
+
+	log.Printf("Registering with coordinator's WireGuard mesh...")
+	cfg, err := registerWireGuard(key, reg)
+	if err != nil {
+		return nil, err
+	}
+	if err := configureWireGuard(cfg, privKey); err != nil {
+		return nil, err
+	}
+	addr := net.JoinHostPort(cfg.Address, "80")
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Joined WireGuard mesh as %s; serving on %s", cfg.Address, addr)
+
+	go func() {
+		for range time.Tick(wireGuardRefreshInterval) {
+			newCfg, err := registerWireGuard(key, reg)
+			if err != nil {
+				log.Printf("Refreshing WireGuard registration: %v", err)
+				continue
+			}
+			if *newCfg != *cfg {
+				// Exit so we restart and reconfigure from scratch.
+				log.Fatalf("WireGuard configuration changed from %+v to %+v", cfg, newCfg)
+			}
+		}
+	}()
+	return ln, nil
+}
+
+// registerWireGuard sends reg to the coordinator and returns the
+// configuration it assigns.
+func registerWireGuard(key string, reg *types.WireGuardRegistration) (*types.WireGuardConfig, error) {
+	body, err := json.Marshal(reg)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest("POST", "https://"+*coordinator+"/wireguard/register", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Go-Host-Type", *reverseType)
+	req.Header.Set("X-Go-Builder-Key", key)
+	req.Header.Set("X-Go-Builder-Hostname", *hostname)
+	req.Header.Set("X-Go-Builder-Version", strconv.Itoa(buildletVersion))
+	setSelfTestHeader(req)
+
+	c := &http.Client{
+		Timeout: time.Minute,
+		Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: isDevReverseMode()},
+		},
+	}
+	res, err := c.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("coordinator WireGuard registration failed: %v", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(res.Body, 1<<10))
+		return nil, fmt.Errorf("coordinator WireGuard registration failed: %v: %s", res.Status, bytes.TrimSpace(msg))
+	}
+	cfg := new(types.WireGuardConfig)
+	if err := json.NewDecoder(res.Body).Decode(cfg); err != nil {
+		return nil, fmt.Errorf("decoding coordinator WireGuard configuration: %v", err)
+	}
+	return cfg, nil
+}
+
+// configureWireGuard (re)creates the *wireGuardIface interface with
+// privKey and the configuration from the coordinator.
+func configureWireGuard(cfg *types.WireGuardConfig, privKey []byte) error {
+	network, err := netip.ParsePrefix(cfg.Network)
+	if err != nil {
+		return fmt.Errorf("invalid WireGuard network from coordinator: %v", err)
+	}
+	addr, err := netip.ParseAddr(cfg.Address)
+	if err != nil || !network.Contains(addr) {
+		return fmt.Errorf("invalid WireGuard address %q from coordinator", cfg.Address)
+	}
+
+	// wg only reads private keys from files.
+	f, err := os.CreateTemp("", "wireguard-key")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(privKey); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	iface := *wireGuardIface
+	// Remove any interface left over from an earlier process.
+	// It's fine if there is none.
+	exec.Command("ip", "link", "del", "dev", iface).Run()
+	for _, args := range [][]string{
+		{"ip", "link", "add", "dev", iface, "type", "wireguard"},
+		{"wg", "set", iface, "private-key", f.Name(),
+			"peer", cfg.CoordinatorPublicKey,
+			"endpoint", cfg.Endpoint,
+			"allowed-ips", network.String(),
+			"persistent-keepalive", "25"},
+		{"ip", "address", "add", netip.PrefixFrom(addr, network.Bits()).String(), "dev", iface},
+		{"ip", "link", "set", "up", "dev", iface},
+	} {
+		if _, err := runCmd(nil, args[0], args[1:]...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runCmd runs the named program with stdin and returns its standard
+// output.
+func runCmd(stdin []byte, name string, args ...string) ([]byte, error) {
+	cmd := exec.Command(name, args...)
+	cmd.Stdin = bytes.NewReader(stdin)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%s %s: %v: %s", name, strings.Join(args, " "), err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return out, nil
+}
@@ -0,0 +1,233 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"golang.org/x/build/buildlet"
+)
+
+// workDirQuota is the maximum total size in bytes of the files in
+// *workDir, as set by the coordinator with /quota, or 0 for no limit.
+// It's only enforced on files written by /write and /writetgz.
+var workDirQuota atomic.Int64
+
+// isDiskFull reports whether err means that the host's disk is full.
+// It is set non-nil on operating systems where that can be detected.
+var isDiskFull func(error) bool
+
+// errQuotaExceeded is returned by writes to the work directory that
+// would take it over workDirQuota.
+var errQuotaExceeded = errors.New("work directory quota exceeded")
+
+// storageError returns err with the HTTP status that tells the client
+// why a write to the work directory failed, if it failed for lack of
+// space.
+func storageError(err error) error {
+	switch {
+	case errors.Is(err, errQuotaExceeded):
+		return httpError{http.StatusRequestEntityTooLarge, err}
+	case isDiskFull != nil && isDiskFull(err):
+		return httpError{http.StatusInsufficientStorage, fmt.Errorf("host disk is full: %w", err)}
+	}
+	return err
+}
+
+// A workDirBudget is how many more bytes a request may write to the
+// work directory before going over workDirQuota. A nil *workDirBudget
+// is unlimited.
+type workDirBudget struct {
+	remaining atomic.Int64
+}
+
+// newWorkDirBudget returns the budget of a request that writes to the
+// work directory. It fails with errQuotaExceeded if the work directory
+// is already at its quota, so that the request can fail before it
+// reads its body.
+func newWorkDirBudget() (*workDirBudget, error) {
+	quota := workDirQuota.Load()
+	if quota <= 0 {
+		return nil, nil
+	}
+	used, err := diskUsage(*workDir)
+	if err != nil {
+		return nil, err
+	}
+	if used >= quota {
+		return nil, fmt.Errorf("%w: using %d of %d bytes", errQuotaExceeded, used, quota)
+	}
+	b := new(workDirBudget)
+	b.remaining.Store(quota - used)
+	return b, nil
+}
+
+// writer returns a writer that writes to w until b is spent.
+func (b *workDirBudget) writer(w io.Writer) io.Writer {
+	if b == nil {
+		return w
+	}
+	return budgetWriter{b, w}
+}
+
+type budgetWriter struct {
+	b *workDirBudget
+	w io.Writer
+}
+
+func (bw budgetWriter) Write(p []byte) (int, error) {
+	if bw.b.remaining.Add(-int64(len(p))) < 0 {
+		return 0, errQuotaExceeded
+	}
+	return bw.w.Write(p)
+}
+
+// diskUsage returns the total size of the regular files in dir.
+func diskUsage(dir string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) {
+			// Removed while walking, such as by a running command.
+			return nil
+		}
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		fi, err := d.Info()
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		size += fi.Size()
+		return nil
+	})
+	return size, err
+}
+
+func handleQuota(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "requires POST method", http.StatusBadRequest)
+		return
+	}
+	quota, err := strconv.ParseInt(r.FormValue("bytes"), 10, 64)
+	if err != nil || quota < 0 {
+		http.Error(w, "invalid 'bytes' parameter", http.StatusBadRequest)
+		return
+	}
+	workDirQuota.Store(quota)
+	log.Printf("Set work directory quota to %d bytes", quota)
+}
+
+// pristineDirs returns the directories that a pristine work directory
+// contains, empty: the ones created at startup for child processes.
+func pristineDirs() []string {
+	var dirs []string
+	for _, dir := range []string{processTmpDirEnv, processGoCacheEnv, processGoplsCacheEnv} {
+		if dir != "" {
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs
+}
+
+// handleClean returns the work directory to the state it was in when
+// the buildlet started, verifies that nothing was left behind, and
+// reports how much space was reclaimed. Unlike /removeall of ".", it
+// never removes the work directory itself, which may be a mountpoint.
+func handleClean(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "requires POST method", http.StatusBadRequest)
+		return
+	}
+	if !mkdirAllWorkdirOr500(w) {
+		return
+	}
+	before, err := diskUsage(*workDir)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	entries, err := os.ReadDir(*workDir)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var removeErr error
+	for _, e := range entries {
+		if err := removeAllIncludingReadonly(filepath.Join(*workDir, e.Name())); err != nil && removeErr == nil {
+			removeErr = err
+		}
+	}
+	for _, dir := range pristineDirs() {
+		if err := os.Mkdir(dir, 0755); err != nil && !errors.Is(err, fs.ErrExist) {
+			err = storageError(err)
+			http.Error(w, err.Error(), httpStatus(err))
+			return
+		}
+	}
+	if leftovers := notPristine(); len(leftovers) > 0 {
+		msg := fmt.Sprintf("work directory not pristine after cleaning; left behind: %s", strings.Join(leftovers, ", "))
+		if removeErr != nil {
+			msg += fmt.Sprintf(" (%v)", removeErr)
+		}
+		log.Printf("clean: %s", msg)
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
+	}
+	after, err := diskUsage(*workDir)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	res := buildlet.CleanResult{BytesReclaimed: before - after}
+	log.Printf("Cleaned work directory; reclaimed %d bytes", res.BytesReclaimed)
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(res)
+}
+
+// maxLeftovers is the maximum number of paths notPristine returns.
+const maxLeftovers = 10
+
+// notPristine returns the paths, relative to the work directory, of
+// up to maxLeftovers entries that a pristine work directory wouldn't
+// contain.
+func notPristine() []string {
+	pristine := make(map[string]bool)
+	for _, dir := range pristineDirs() {
+		pristine[dir] = true
+	}
+	var leftovers []string
+	filepath.WalkDir(*workDir, func(path string, d fs.DirEntry, err error) error {
+		if path == *workDir || pristine[path] && d.IsDir() {
+			return err
+		}
+		rel, relErr := filepath.Rel(*workDir, path)
+		if relErr != nil {
+			rel = path
+		}
+		leftovers = append(leftovers, filepath.ToSlash(rel))
+		switch {
+		case len(leftovers) == maxLeftovers:
+			return filepath.SkipAll
+		case d.IsDir():
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	return leftovers
+}
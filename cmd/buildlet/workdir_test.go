@@ -0,0 +1,138 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/build/buildlet"
+)
+
+// setTestWorkDir points the buildlet at a new, pristine work directory
+// for the duration of the test.
+func setTestWorkDir(t *testing.T) string {
+	dir := t.TempDir()
+	oldWorkDir, oldTmp, oldGoCache, oldGoplsCache := *workDir, processTmpDirEnv, processGoCacheEnv, processGoplsCacheEnv
+	t.Cleanup(func() {
+		*workDir, processTmpDirEnv, processGoCacheEnv, processGoplsCacheEnv = oldWorkDir, oldTmp, oldGoCache, oldGoplsCache
+		workDirQuota.Store(0)
+	})
+	*workDir = dir
+	processTmpDirEnv = filepath.Join(dir, "tmp")
+	processGoCacheEnv = filepath.Join(dir, "gocache")
+	processGoplsCacheEnv = ""
+	for _, d := range pristineDirs() {
+		if err := os.Mkdir(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func postForm(t *testing.T, h http.HandlerFunc, form url.Values) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest("POST", "/", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	h(w, req)
+	return w
+}
+
+func putFile(path, content string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("PUT", "/write?"+url.Values{"path": {path}, "mode": {"420"}}.Encode(), strings.NewReader(content))
+	w := httptest.NewRecorder()
+	handleWrite(w, req)
+	return w
+}
+
+func TestWorkDirQuota(t *testing.T) {
+	setTestWorkDir(t)
+
+	if w := postForm(t, handleQuota, url.Values{"bytes": {"10"}}); w.Code != http.StatusOK {
+		t.Fatalf("setting quota: %v %s", w.Code, w.Body)
+	}
+	if w := putFile("a/b", "123456"); w.Code != http.StatusOK {
+		t.Errorf("writing 6 bytes under a 10 byte quota: %v %s", w.Code, w.Body)
+	}
+	if w := putFile("a/c", "123456"); w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("writing 6 more bytes: %v %s, want status %v", w.Code, w.Body, http.StatusRequestEntityTooLarge)
+	}
+
+	if w := postForm(t, handleQuota, url.Values{"bytes": {"0"}}); w.Code != http.StatusOK {
+		t.Fatalf("removing quota: %v %s", w.Code, w.Body)
+	}
+	if w := putFile("a/c", "123456"); w.Code != http.StatusOK {
+		t.Errorf("writing 6 more bytes without a quota: %v %s", w.Code, w.Body)
+	}
+
+	if w := postForm(t, handleQuota, url.Values{"bytes": {"-1"}}); w.Code != http.StatusBadRequest {
+		t.Errorf("setting a negative quota: %v %s, want status %v", w.Code, w.Body, http.StatusBadRequest)
+	}
+}
+
+func TestClean(t *testing.T) {
+	dir := setTestWorkDir(t)
+	for _, f := range []string{"go/src/x.go", "tmp/y", "gocache/00/z"} {
+		if w := putFile(f, "1234"); w.Code != http.StatusOK {
+			t.Fatalf("writing %s: %v %s", f, w.Code, w.Body)
+		}
+	}
+	// Read-only files are removed too.
+	if err := os.Chmod(filepath.Join(dir, "go", "src"), 0555); err != nil {
+		t.Fatal(err)
+	}
+
+	w := postForm(t, handleClean, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("clean: %v %s", w.Code, w.Body)
+	}
+	var res buildlet.CleanResult
+	if err := json.NewDecoder(w.Body).Decode(&res); err != nil {
+		t.Fatal(err)
+	}
+	if res.BytesReclaimed != 12 {
+		t.Errorf("BytesReclaimed = %d, want 12", res.BytesReclaimed)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	if want := []string{"gocache", "tmp"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("work directory contains %q after clean, want %q", names, want)
+	}
+	if leftovers := notPristine(); len(leftovers) != 0 {
+		t.Errorf("notPristine() = %q after clean, want none", leftovers)
+	}
+}
+
+func TestNotPristine(t *testing.T) {
+	dir := setTestWorkDir(t)
+	for _, f := range []string{"a", "tmp/b", "c/d"} {
+		if w := putFile(f, "x"); w.Code != http.StatusOK {
+			t.Fatalf("writing %s: %v %s", f, w.Code, w.Body)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(dir, "e"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	got := notPristine()
+	want := []string{"a", "c", "e", "tmp/b"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("notPristine() = %q, want %q", got, want)
+	}
+}
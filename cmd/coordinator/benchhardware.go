@@ -0,0 +1,83 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.16 && (linux || darwin)
+// +build go1.16
+// +build linux darwin
+
+// Code related to the hardware inventory of benchmark builders.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/build/buildlet"
+	"golang.org/x/build/perfdata"
+)
+
+// benchHardwareScript prints the parts of /proc/cpuinfo and
+// /proc/meminfo that describe a Linux machine's hardware, and its
+// kernel, as "key: value" lines for parseBenchHardware.
+const benchHardwareScript = `grep -m1 '^model name' /proc/cpuinfo
+grep -m1 '^microcode' /proc/cpuinfo
+grep -m1 '^MemTotal' /proc/meminfo
+echo "kernel: $(uname -sr)"`
+
+// benchHardware returns the description of the hardware of st's
+// buildlet, for the perfdata hardware inventory.
+func (st *buildStatus) benchHardware() (*perfdata.Hardware, error) {
+	if goos := st.conf.GOOS(); goos != "linux" {
+		return nil, fmt.Errorf("hardware inventory not supported on %s", goos)
+	}
+	var out bytes.Buffer
+	remoteErr, err := st.bc.Exec(st.ctx, "/bin/sh", buildlet.ExecOpts{
+		Output:      &out,
+		Args:        []string{"-c", benchHardwareScript},
+		SystemLevel: true,
+	})
+	if err == nil {
+		err = remoteErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("describing hardware: %v\n%s", err, out.Bytes())
+	}
+	return parseBenchHardware(st.Name, out.String())
+}
+
+// parseBenchHardware parses the output of benchHardwareScript on
+// builder's buildlet.
+func parseBenchHardware(builder, out string) (*perfdata.Hardware, error) {
+	h := &perfdata.Hardware{Builder: builder}
+	for _, line := range strings.Split(out, "\n") {
+		k, v, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		v = strings.TrimSpace(v)
+		switch strings.TrimSpace(k) {
+		case "model name":
+			h.CPU = v
+		case "microcode":
+			h.Microcode = v
+		case "MemTotal":
+			kb, err := strconv.ParseInt(strings.TrimSuffix(v, " kB"), 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("malformed MemTotal %q", v)
+			}
+			// MemTotal excludes memory reserved by the kernel, so
+			// round to the nearest GiB.
+			h.Memory = fmt.Sprintf("%dGiB", (kb+1<<19)>>20)
+		case "kernel":
+			h.Kernel = v
+		}
+	}
+	if h.CPU == "" || h.Memory == "" || h.Kernel == "" {
+		return nil, fmt.Errorf("incomplete hardware description %+v", h)
+	}
+	return h, nil
+}
@@ -0,0 +1,41 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.16 && (linux || darwin)
+// +build go1.16
+// +build linux darwin
+
+package main
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.org/x/build/perfdata"
+)
+
+func TestParseBenchHardware(t *testing.T) {
+	const out = "model name\t: Intel(R) Xeon(R) CPU @ 3.10GHz\n" +
+		"microcode\t: 0xffffffff\n" +
+		"MemTotal:       32869476 kB\n" +
+		"kernel: Linux 6.1.0-13-cloud-amd64\n"
+	got, err := parseBenchHardware("linux-amd64-perf", out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &perfdata.Hardware{
+		Builder:   "linux-amd64-perf",
+		CPU:       "Intel(R) Xeon(R) CPU @ 3.10GHz",
+		Memory:    "31GiB",
+		Kernel:    "Linux 6.1.0-13-cloud-amd64",
+		Microcode: "0xffffffff",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("parseBenchHardware mismatch (-want +got):\n%s", diff)
+	}
+
+	if _, err := parseBenchHardware("linux-amd64-perf", "kernel: Linux\n"); err == nil {
+		t.Errorf("parseBenchHardware of an incomplete description succeeded; want error")
+	}
+}
@@ -39,9 +39,9 @@ import (
 	"golang.org/x/build/internal/spanlog"
 	"golang.org/x/build/livelog"
 	"golang.org/x/build/maintner/maintnerd/apipb"
+	"golang.org/x/build/perfdata"
 	"golang.org/x/build/types"
 	"golang.org/x/mod/semver"
-	perfstorage "golang.org/x/perf/storage"
 )
 
 // newBuild constructs a new *buildStatus from rev and commit details.
@@ -66,7 +66,7 @@ func newBuild(rev buildgo.BuilderRev, detail commitDetail) (*buildStatus, error)
 	}
 
 	ctx, cancel := context.WithCancel(context.Background())
-	return &buildStatus{
+	st := &buildStatus{
 		buildID:      "B" + randHex(9),
 		BuilderRev:   rev,
 		commitDetail: detail,
@@ -74,7 +74,11 @@ func newBuild(rev buildgo.BuilderRev, detail commitDetail) (*buildStatus, error)
 		startTime:    time.Now(),
 		ctx:          ctx,
 		cancel:       cancel,
-	}, nil
+	}
+	if buildLogStore != nil && !featureFlags.Killed(flagStreamLogsKill) {
+		st.stream = newLogStream(buildLogStore, fmt.Sprintf("%.8s/%s_%s.log", rev.Rev, rev.Name, st.buildID))
+	}
+	return st, nil
 }
 
 // buildStatus is the status of a build.
@@ -87,6 +91,19 @@ type buildStatus struct {
 	startTime time.Time // actually time of newBuild (~same thing)
 	trySet    *trySet   // or nil
 
+	// integration is whether this is an integration build, whose
+	// result isn't recorded on the dashboard; see integration.go.
+	integration bool
+
+	// speculative is whether this is a speculative build of a CL
+	// that's about to be submitted, whose result is only recorded
+	// on the dashboard once it's submitted; see speculative.go.
+	speculative bool
+
+	// stream, if non-nil, is where stdout and stderr are written
+	// instead of output, streaming them to buildLogStore.
+	stream *logStream
+
 	onceInitHelpers sync.Once // guards call of onceInitHelpersFunc
 	helpers         <-chan buildlet.Client
 	ctx             context.Context    // used to start the build
@@ -98,12 +115,20 @@ type buildStatus struct {
 	canceled        bool             // whether this build was forcefully canceled, so errors should be ignored
 	schedItem       *queue.SchedItem // for the initial buildlet (ignoring helpers for now)
 	logURL          string           // if non-empty, permanent URL of log
+	manifestURL     string           // if non-empty, permanent URL of the environment manifest
 	bc              buildlet.Client  // nil initially, until pool returns one
 	done            time.Time        // finished running
 	succeeded       bool             // set when done
-	output          livelog.Buffer   // stdout and stderr
+	testsFailed     bool             // whether the build or its tests failed, as opposed to the infrastructure
+	output          livelog.Buffer   // stdout and stderr, if not streamed
 	events          []eventAndTime
 	useSnapshotMemo map[string]bool // memoized result of useSnapshotFor(rev), where the key is rev
+	cpuTime         time.Duration   // total CPU time of the commands run on the build's buildlets
+	peakMemory      int64           // largest peak RSS in bytes of those commands
+	readBytes       int64           // bytes those commands read from storage
+	writeBytes      int64           // bytes those commands wrote to storage
+	netBytes        int64           // bytes received and sent on the network while they ran
+	topIO           []*execIO       // those commands with the most I/O, most first
 }
 
 func (st *buildStatus) NameAndBranch() string {
@@ -141,7 +166,7 @@ func (st *buildStatus) cancelBuild() {
 	}
 
 	st.canceled = true
-	st.output.Close()
+	st.out().Close()
 	// cancel the context, which stops the creation of helper
 	// buildlets, etc. The context isn't plumbed everywhere yet,
 	// so we also forcefully close its buildlet out from under it
@@ -168,7 +193,7 @@ func (st *buildStatus) setDone(succeeded bool) {
 	}
 	st.succeeded = succeeded
 	st.done = time.Now()
-	st.output.Close()
+	st.out().Close()
 	st.cancel()
 }
 
@@ -200,6 +225,7 @@ func (st *buildStatus) start() {
 			}
 			st.setDone(err == nil)
 			pool.CoordinatorProcess().PutBuildRecord(st.buildRecord())
+			st.recordUsage()
 		}
 		markDone(st.BuilderRev)
 	}()
@@ -280,13 +306,14 @@ func (st *buildStatus) getHelpers() <-chan buildlet.Client {
 
 func (st *buildStatus) onceInitHelpersFunc() {
 	schedTmpl := &queue.SchedItem{
-		BuilderRev: st.BuilderRev,
-		HostType:   st.conf.HostType,
-		IsTry:      st.isTry(),
-		CommitTime: st.commitTime(),
-		Branch:     st.RevBranch,
-		Repo:       st.RepoOrGo(),
-		User:       st.AuthorEmail,
+		BuilderRev:    st.BuilderRev,
+		HostType:      st.conf.HostType,
+		IsTry:         st.isTry(),
+		CommitTime:    st.commitTime(),
+		IsSpeculative: st.speculative,
+		Branch:        st.RevBranch,
+		Repo:          st.RepoOrGo(),
+		User:          st.AuthorEmail,
 	}
 	st.helpers = getBuildlets(st.ctx, st.conf.NumTestHelpers(st.isTry()), schedTmpl, st)
 }
@@ -363,13 +390,14 @@ var errSkipBuildDueToDeps = errors.New("build was skipped due to missing deps")
 
 func (st *buildStatus) getBuildlet() (buildlet.Client, error) {
 	schedItem := &queue.SchedItem{
-		HostType:   st.conf.HostType,
-		IsTry:      st.trySet != nil,
-		BuilderRev: st.BuilderRev,
-		CommitTime: st.commitTime(),
-		Repo:       st.RepoOrGo(),
-		Branch:     st.RevBranch,
-		User:       st.AuthorEmail,
+		HostType:      st.conf.HostType,
+		IsTry:         st.trySet != nil,
+		BuilderRev:    st.BuilderRev,
+		IsSpeculative: st.speculative,
+		CommitTime:    st.commitTime(),
+		Repo:          st.RepoOrGo(),
+		Branch:        st.RevBranch,
+		User:          st.AuthorEmail,
 	}
 	st.mu.Lock()
 	st.schedItem = schedItem
@@ -384,6 +412,7 @@ func (st *buildStatus) getBuildlet() (buildlet.Client, error) {
 		return nil, err
 	}
 	atomic.StoreInt32(&st.hasBuildlet, 1)
+	bc = st.trackUsage(bc)
 
 	st.mu.Lock()
 	st.bc = bc
@@ -420,18 +449,24 @@ func (st *buildStatus) build() error {
 	}
 	defer bc.Close()
 
+	st.writeEnvManifest(bc)
+
 	if st.useSnapshot() {
-		if err := st.writeGoSnapshot(); err != nil {
-			return err
-		}
+		err = st.writeGoSnapshot()
 	} else {
 		// Write the Go source and bootstrap tool chain in parallel.
 		var grp syncutil.Group
 		grp.Go(st.writeGoSource)
 		grp.Go(st.writeBootstrapToolchain)
-		if err := grp.Err(); err != nil {
-			return err
+		err = grp.Err()
+	}
+	if err != nil {
+		if errors.Is(err, buildlet.ErrDiskFull) {
+			// Don't give the buildlet to another build until
+			// someone frees up space on it.
+			bc.MarkBroken()
 		}
+		return err
 	}
 
 	execStartTime := time.Now()
@@ -445,6 +480,11 @@ func (st *buildStatus) build() error {
 
 	remoteErr, err := st.runAllSharded()
 	makeTest.Done(err)
+	if remoteErr != nil {
+		st.mu.Lock()
+		st.testsFailed = true
+		st.mu.Unlock()
+	}
 
 	// bc (aka st.bc) may be invalid past this point, so let's
 	// close it to make sure we don't accidentally use it.
@@ -480,7 +520,7 @@ func (st *buildStatus) build() error {
 		time.Sleep(5 * time.Minute)
 	}
 
-	if st.trySet == nil {
+	if st.trySet == nil && !st.integration && !st.speculative {
 		buildLog := st.logs()
 		if remoteErr != nil {
 			// If we just have the line-or-so little
@@ -493,7 +533,7 @@ func (st *buildStatus) build() error {
 				buildLog += "\n" + remoteErr.Error()
 			}
 		}
-		if err := recordResult(st.BuilderRev, remoteErr == nil, buildLog, time.Since(execStartTime)); err != nil {
+		if err := recordResult(st.BuilderRev, st.commitDetail, remoteErr == nil, buildLog, time.Since(execStartTime)); err != nil {
 			if remoteErr != nil {
 				return fmt.Errorf("Remote error was %q but failed to report it to the dashboard: %v", remoteErr, err)
 			}
@@ -562,14 +602,21 @@ func (st *buildStatus) buildRecord() *types.BuildRecord {
 	st.mu.Lock()
 	defer st.mu.Unlock()
 	// TODO: buildlet instance name
+	rec.ManifestURL = st.manifestURL
 	if !st.done.IsZero() {
 		rec.EndTime = st.done
 		rec.LogURL = st.logURL
 		rec.Seconds = rec.EndTime.Sub(rec.StartTime).Seconds()
+		rec.CPUSeconds = st.cpuTime.Seconds()
+		rec.PeakMemory = st.peakMemory
+		rec.ReadBytes = st.readBytes
+		rec.WriteBytes = st.writeBytes
+		rec.NetBytes = st.netBytes
 		if st.succeeded {
 			rec.Result = "ok"
 		} else {
 			rec.Result = "fail"
+			rec.InfraFailure = !st.testsFailed
 		}
 	}
 	return rec
@@ -690,7 +737,7 @@ func (st *buildStatus) writeGoSnapshotTo(rev, dir string) (err error) {
 	snapshotURL := pool.NewGCEConfiguration().BuildEnv().SnapshotURL(st.Name, rev)
 
 	if err := st.bc.PutTarFromURL(st.ctx, snapshotURL, dir); err != nil {
-		return fmt.Errorf("failed to put baseline snapshot to buildlet: %v", err)
+		return fmt.Errorf("failed to put baseline snapshot to buildlet: %w", err)
 	}
 	return nil
 }
@@ -703,16 +750,16 @@ func (st *buildStatus) writeGoSourceTo(bc buildlet.Client, rev, dir string) erro
 	// Write the VERSION file.
 	sp := st.CreateSpan("write_version_tar")
 	if err := bc.PutTar(st.ctx, buildgo.VersionTgz(rev), dir); err != nil {
-		return sp.Done(fmt.Errorf("writing VERSION tgz: %v", err))
+		return sp.Done(fmt.Errorf("writing VERSION tgz: %w", err))
 	}
 
-	srcTar, err := sourcecache.GetSourceTgz(st, "go", rev)
+	srcTar, err := sourceCache.GetSourceTgz(st.ctx, st, "go", rev)
 	if err != nil {
 		return err
 	}
 	sp = st.CreateSpan("write_go_src_tar")
 	if err := bc.PutTar(st.ctx, srcTar, dir); err != nil {
-		return sp.Done(fmt.Errorf("writing tarball from Gerrit: %v", err))
+		return sp.Done(fmt.Errorf("writing tarball from Gerrit: %w", err))
 	}
 	return sp.Done(nil)
 }
@@ -915,6 +962,7 @@ func (st *buildStatus) distTestList() (names []distTestName, remoteErr, err erro
 	remoteErr, err = st.bc.Exec(st.ctx, "./go/bin/go", buildlet.ExecOpts{
 		Output:      &buf,
 		ExtraEnv:    append(st.conf.Env(), "GOROOT="+goroot),
+		EnvProfile:  st.conf.EnvProfile(),
 		OnStartExec: func() { st.LogEventTime("discovering_tests") },
 		Path:        []string{st.conf.FilePathJoin("$WORKDIR", "go", "bin"), "$PATH"},
 		Args:        args,
@@ -1084,7 +1132,7 @@ func (st *buildStatus) runSubrepoTests() (remoteErr, err error) {
 	// Check out the provided sub-repo to the buildlet's workspace so we
 	// can find go.mod files and run tests in it.
 	{
-		tgz, err := sourcecache.GetSourceTgz(st, st.SubName, st.SubRev)
+		tgz, err := sourceCache.GetSourceTgz(st.ctx, st, st.SubName, st.SubRev)
 		if errors.As(err, new(sourcecache.TooBigError)) {
 			// Source being too big is a non-retryable error.
 			return err, nil
@@ -1149,21 +1197,21 @@ func (st *buildStatus) runSubrepoTests() (remoteErr, err error) {
 		if st.conf.IsRace() {
 			args = append(args, "-race")
 		}
-		if scale := st.conf.GoTestTimeoutScale(); scale != 1 {
-			const goTestDefaultTimeout = 10 * time.Minute // Default value taken from Go 1.20.
-			args = append(args, "-timeout="+(goTestDefaultTimeout*time.Duration(scale)).String())
+		if st.conf.GoTestTimeoutScale() != 1 {
+			args = append(args, "-timeout="+st.conf.GoTestTimeout().String())
 		}
 	}
 
 	var remoteErrors []error
 	for _, tr := range testRuns {
 		rErr, err := st.bc.Exec(st.ctx, "./go/bin/go", buildlet.ExecOpts{
-			Debug:    true, // make buildlet print extra debug in output for failures
-			Output:   st,
-			Dir:      tr.Dir,
-			ExtraEnv: env,
-			Path:     []string{st.conf.FilePathJoin("$WORKDIR", "go", "bin"), "$PATH"},
-			Args:     append(args, tr.Patterns...),
+			Debug:      true, // make buildlet print extra debug in output for failures
+			Output:     st,
+			Dir:        tr.Dir,
+			ExtraEnv:   env,
+			EnvProfile: st.conf.EnvProfile(),
+			Path:       []string{st.conf.FilePathJoin("$WORKDIR", "go", "bin"), "$PATH"},
+			Args:       append(args, tr.Patterns...),
 		})
 		if err != nil {
 			// A network/communication error. Give up here;
@@ -1388,12 +1436,13 @@ func (st *buildStatus) runBenchmarkTests() (remoteErr, err error) {
 		env = append(env, "BENCH_SUBREPO_BASELINE_PATH="+st.conf.FilePathJoin(workDir, subrepoBaselineDir))
 	}
 	rErr, err := st.bc.Exec(st.ctx, "./go/bin/go", buildlet.ExecOpts{
-		Debug:    true, // make buildlet print extra debug in output for failures
-		Output:   st,
-		Dir:      benchmarksDir,
-		ExtraEnv: env,
-		Path:     []string{st.conf.FilePathJoin("$WORKDIR", "go", "bin"), "$PATH"},
-		Args:     []string{"run", "golang.org/x/benchmarks/cmd/bench"},
+		Debug:      true, // make buildlet print extra debug in output for failures
+		Output:     st,
+		Dir:        benchmarksDir,
+		ExtraEnv:   env,
+		EnvProfile: st.conf.EnvProfile(),
+		Path:       []string{st.conf.FilePathJoin("$WORKDIR", "go", "bin"), "$PATH"},
+		Args:       []string{"run", "golang.org/x/benchmarks/cmd/bench"},
 	})
 	if err != nil || rErr != nil {
 		return rErr, err
@@ -1415,7 +1464,17 @@ func (st *buildStatus) uploadBenchResults(toolchainBaselineCommit, subrepoBaseli
 		log.Printf("No perfdata URL, skipping benchmark upload")
 		return nil
 	}
-	client := &perfstorage.Client{BaseURL: s, HTTPClient: pool.NewGCEConfiguration().OAuthHTTPClient()}
+	client := &perfdata.Client{BaseURL: s, HTTPClient: pool.NewGCEConfiguration().OAuthHTTPClient()}
+
+	// Record the builder's current hardware, so that the server
+	// labels the results with its inventory ID. The results are
+	// still worth uploading without it.
+	if hw, err := st.benchHardware(); err != nil {
+		log.Printf("%s: not recording benchmark hardware: %v", st.Name, err)
+	} else if _, err := client.RecordHardware(st.ctx, hw); err != nil {
+		log.Printf("%s: recording benchmark hardware: %v", st.Name, err)
+	}
+
 	u := client.NewUpload(st.ctx)
 	w, err := u.CreateFile("results")
 	if err != nil {
@@ -1442,6 +1501,7 @@ func (st *buildStatus) uploadBenchResults(toolchainBaselineCommit, subrepoBaseli
 	}
 	fmt.Fprintf(&b, "benchmarks-commit: %s\n", benchmarksCommit)
 	fmt.Fprintf(&b, "post-submit: %t\n", st.trySet == nil)
+	fmt.Fprintf(&b, "builder: %s\n", st.Name)
 	if _, err := w.Write([]byte(b.String())); err != nil {
 		u.Abort()
 		return fmt.Errorf("error writing perfdata metadata with contents %q: %w", b.String(), err)
@@ -1518,7 +1578,7 @@ func (st *buildStatus) fetchBenchmarksSource(benchmarksDir string) (rev string,
 	sp := st.CreateSpan("fetching_benchmarks")
 	defer func() { sp.Done(err) }()
 
-	tgz, err := sourcecache.GetSourceTgz(st, "benchmarks", rev)
+	tgz, err := sourceCache.GetSourceTgz(st.ctx, st, "benchmarks", rev)
 	if errors.As(err, new(sourcecache.TooBigError)) {
 		// Source being too big is a non-retryable error.
 		return "", err, nil
@@ -1537,7 +1597,7 @@ func (st *buildStatus) fetchBenchmarksSource(benchmarksDir string) (rev string,
 func (st *buildStatus) fetchSubrepoAndBaseline(repoDir, baselineDir string) (baselineRev string, remoteErr, err error) {
 	st.LogEventTime("fetching_subrepo", st.SubName)
 
-	tgz, err := sourcecache.GetSourceTgz(st, st.SubName, st.SubRev)
+	tgz, err := sourceCache.GetSourceTgz(st.ctx, st, st.SubName, st.SubRev)
 	if errors.As(err, new(sourcecache.TooBigError)) {
 		// Source being too big is a non-retryable error.
 		return "", err, nil
@@ -1557,7 +1617,7 @@ func (st *buildStatus) fetchSubrepoAndBaseline(repoDir, baselineDir string) (bas
 
 	fmt.Fprintf(st, "Baseline subrepo %s\n", baselineRev)
 
-	tgz, err = sourcecache.GetSourceTgz(st, st.SubName, baselineRev)
+	tgz, err = sourceCache.GetSourceTgz(st.ctx, st, st.SubName, baselineRev)
 	if errors.As(err, new(sourcecache.TooBigError)) {
 		// Source being too big is a non-retryable error.
 		return "", err, nil
@@ -1662,7 +1722,7 @@ func (st *buildStatus) runTests(helpers <-chan buildlet.Client) (remoteErr, err
 					st.runTestsOnBuildlet(bc, tis, goroot, gopath)
 				}
 				st.LogEventTime("test_helper_is_broken", bc.Name())
-			}(helper)
+			}(st.trackUsage(helper))
 		}
 	}()
 
@@ -1862,11 +1922,12 @@ func (st *buildStatus) runTestsOnBuildlet(bc buildlet.Client, tis []*testItem, g
 		// fail when dist tries to run the binary in dir "$GOROOT/src", since
 		// "$GOROOT/src" + "./go.exe" doesn't exist. Perhaps LookPath should return
 		// an absolute path.
-		Dir:      ".",
-		Output:   &buf, // see "maybe stream lines" TODO below
-		ExtraEnv: env,
-		Path:     []string{st.conf.FilePathJoin("$WORKDIR", "go", "bin"), "$PATH"},
-		Args:     args,
+		Dir:        ".",
+		Output:     &buf, // see "maybe stream lines" TODO below
+		ExtraEnv:   env,
+		EnvProfile: st.conf.EnvProfile(),
+		Path:       []string{st.conf.FilePathJoin("$WORKDIR", "go", "bin"), "$PATH"},
+		Args:       args,
 	})
 	execDuration := time.Since(t0)
 	sp.Done(err)
@@ -2016,6 +2077,9 @@ func (st *buildStatus) htmlStatus(detail buildStatusDetail) template.HTML {
 	} else {
 		fmt.Fprintf(&buf, "; <a href='%s'>%s</a>", html.EscapeString(st.logsURLLocked()), state)
 	}
+	if detail > singleLine && st.manifestURL != "" {
+		fmt.Fprintf(&buf, "; <a href='%s'>environment</a>", html.EscapeString(st.manifestURL))
+	}
 
 	t := st.done
 	if t.IsZero() {
@@ -2085,12 +2149,49 @@ func (st *buildStatus) writeEventsLocked(w io.Writer, htmlMode bool, numLines in
 	}
 }
 
+// buildOutput is the stdout and stderr of a build, which may be read
+// while it's written.
+type buildOutput interface {
+	io.WriteCloser
+	String() string
+	Bytes() []byte
+	Reader() io.ReadCloser
+}
+
+// out returns the build's output: st.stream if it's streamed, or
+// st.output if not.
+func (st *buildStatus) out() buildOutput {
+	if st.stream != nil {
+		return st.stream
+	}
+	return &st.output
+}
+
 func (st *buildStatus) logs() string {
-	return st.output.String()
+	return st.out().String()
 }
 
 func (st *buildStatus) Write(p []byte) (n int, err error) {
-	return st.output.Write(p)
+	return st.out().Write(p)
+}
+
+// saveLog waits for the build's log to be stored permanently and
+// returns its URL. If the log wasn't streamed, it uploads it as
+// objName.
+func (st *buildStatus) saveLog(objName string) (logURL string, err error) {
+	if st.stream != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+		defer cancel()
+		return st.stream.URL(), st.stream.Wait(ctx)
+	}
+	wr, logURL := newBuildLogBlob(objName)
+	if _, err := io.WriteString(wr, st.logs()); err != nil {
+		return "", err
+	}
+	if err := wr.Close(); err != nil {
+		return "", err
+	}
+	return logURL, nil
 }
 
 // repeatedCommunicationError takes a buildlet execution error (a
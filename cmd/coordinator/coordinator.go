@@ -21,7 +21,10 @@ import (
 	"crypto/rand"
 	"crypto/sha1"
 	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
 	"encoding/json"
+	"encoding/pem"
 	"errors"
 	"flag"
 	"fmt"
@@ -51,15 +54,19 @@ import (
 	"golang.org/x/build/internal/buildgo"
 	"golang.org/x/build/internal/buildstats"
 	"golang.org/x/build/internal/cloud"
+	"golang.org/x/build/internal/coordinator/buildletca"
 	"golang.org/x/build/internal/coordinator/pool"
 	"golang.org/x/build/internal/coordinator/pool/queue"
 	"golang.org/x/build/internal/coordinator/remote"
 	"golang.org/x/build/internal/coordinator/schedule"
+	"golang.org/x/build/internal/featureflag"
+	"golang.org/x/build/internal/gcsfs"
 	"golang.org/x/build/internal/gomote"
 	gomoteprotos "golang.org/x/build/internal/gomote/protos"
 	"golang.org/x/build/internal/https"
 	"golang.org/x/build/internal/metrics"
 	"golang.org/x/build/internal/secret"
+	"golang.org/x/build/internal/sourcecache"
 	"golang.org/x/build/internal/swarmclient"
 	"golang.org/x/build/kubernetes/gke"
 	"golang.org/x/build/maintner/maintnerd/apipb"
@@ -93,6 +100,17 @@ var (
 
 var sched = schedule.NewScheduler()
 
+// featureFlags are the build infrastructure's feature flags, or nil if
+// there's no datastore to read them from. They're edited in relui.
+var featureFlags *featureflag.Set
+
+// Feature flags evaluated by the coordinator.
+const (
+	// flagStreamLogsKill, when killed, stops new builds from
+	// streaming their logs, as if -stream-logs were false.
+	flagStreamLogsKill = "coordinator-stream-logs"
+)
+
 var Version string // set by linker -X
 
 // devPause is a debug option to pause for 5 minutes after the build
@@ -114,8 +132,39 @@ var (
 	devEnableGCE  = flag.Bool("dev_gce", false, "Whether or not to enable the GCE pool when in dev mode. The pool is enabled by default in prod mode.")
 	devEnableEC2  = flag.Bool("dev_ec2", false, "Whether or not to enable the EC2 pool when in dev mode. The pool is enabled by default in prod mode.")
 	sshAddr       = flag.String("ssh_addr", ":2222", "Address the gomote SSH server should listen on")
+
+	sshTranscripts         = flag.String("ssh-transcripts", "", "If non-empty, the file:// or gs:// URL where gomote SSH sessions are recorded, encrypted with the key in Secret Manager. Only clients that consent to it may then connect. Transcripts of sessions in progress are saved every minute, so a coordinator restart loses at most the last minute of them.")
+	sshTranscriptRetention = flag.Duration("ssh-transcript-retention", 30*24*time.Hour, "How long the -ssh-transcripts are kept.")
+	sshTranscriptViewers   = flag.String("ssh-transcript-viewers", "", "Comma-separated email addresses of the people who may view the -ssh-transcripts, at /gomote/ssh-transcripts/.")
+
+	releaseStatusURL = flag.String("release-status-url", "", "If non-empty, URL of the release status JSON published by relui, shown on the build dashboard.")
+
+	wireGuardIface    = flag.String("wireguard-iface", "", "If non-empty, the existing WireGuard interface that reverse buildlets may join as peers via /wireguard/register, instead of using revdial.")
+	wireGuardEndpoint = flag.String("wireguard-endpoint", "", "The public host:port of the -wireguard-iface listener, given to buildlets joining the mesh.")
+	wireGuardNetwork  = flag.String("wireguard-network", "10.200.0.0/16", "The WireGuard mesh network. The coordinator's -wireguard-iface must use its first host address.")
+
+	sourceCacheURLs = flag.String("source-cache", "", "If non-empty, comma-separated file:// or gs:// URLs of persistent layers of the source cache, fastest first, such as a local directory and a GCS bucket shared with relui.")
+
+	warmPool        = flag.String("warm-pool", "", "If non-empty, comma-separated hostType=count pairs of GCE host types to keep count buildlets booted for ahead of demand, such as host-linux-amd64-bullseye=4.")
+	warmPoolMaxIdle = flag.Duration("warm-pool-max-idle", 30*time.Minute, "How long a -warm-pool buildlet may sit idle before it's destroyed and replaced.")
+
+	notifyMailFrom = flag.String("notify-mail-from", "", "If non-empty, the address that build.golang.org notification emails are sent from, with SendGrid. Otherwise, subscriptions can only notify webhooks.")
+
+	buildletCA     = flag.Bool("buildlet-ca", false, "Whether to issue the TLS certificates of EC2 buildlets from the certificate authority whose root certificate and intermediate are in Secret Manager, rather than generate long-lived self-signed ones.")
+	buildletCACRL  = flag.String("buildlet-ca-crl", "", "If non-empty, the URL of a CRL signed by the -buildlet-ca root, listing revoked intermediates.")
+	buildletCAOCSP = flag.String("buildlet-ca-ocsp", "", "If non-empty, the URL of an OCSP responder for the intermediates of the -buildlet-ca root.")
+
+	streamLogs = flag.Bool("stream-logs", true, "Whether to stream build logs to the build environment's log bucket as builds run, rather than buffering them in memory until they finish.")
+
+	speculate = flag.Bool("speculative-builds", false, "Whether to speculatively run the post-submit builds of approved CLs that passed their TryBots, and reuse their results once the CLs are submitted.")
+
+	gomoteInstancesPerUser = flag.Int("gomote-instances-per-user", 0, "If non-zero, the maximum number of gomote instances each user may have at once. Adjustable at runtime via /admin/scheduler; runtime changes survive restarts after a drain unless this flag is set.")
 )
 
+// sourceCache is where builds get the source code of the repositories
+// they build.
+var sourceCache = sourcecache.New(sourcecache.Options{})
+
 // LOCK ORDER:
 //   statusMu, buildStatus.mu, trySet.mu
 // (Other locks, such as the remoteBuildlet mutex should
@@ -250,6 +299,17 @@ func main() {
 
 	gce := pool.NewGCEConfiguration()
 
+	mustInitSourceCache()
+	if *streamLogs && *mode != "dev" {
+		buildLogStore = &gcsLogStore{client: mustStorageClient(), bucket: gce.BuildEnv().LogBucket}
+	}
+	var flagStore featureflag.Store
+	if dsClient := gce.DSClient(); dsClient != nil {
+		flagStore = &featureflag.DatastoreStore{Client: dsClient}
+		featureFlags = featureflag.NewSet(flagStore)
+		go featureFlags.Run(context.Background(), time.Minute)
+	}
+
 	goKubeClient, err := gke.NewClient(context.Background(),
 		gce.BuildEnv().KubeServices.Name,
 		gce.BuildEnv().KubeServices.Location(),
@@ -304,7 +364,7 @@ func main() {
 	if err != nil && metadata.OnGCE() {
 		log.Println("metrics.GKEResource:", err)
 	}
-	if ms, err := metrics.NewService(gr, views); err != nil {
+	if ms, err := metrics.NewService(gr, append(views, sourcecache.Views...)); err != nil {
 		log.Println("failed to initialize metrics:", err)
 	} else {
 		mux.Handle("/metrics", ms)
@@ -325,8 +385,10 @@ func main() {
 
 	sshCA := mustRetrieveSSHCertificateAuthority()
 
-	var gomoteBucket string
+	var gomoteBucket, gomoteAttachmentBucket string
 	var opts []grpc.ServerOption
+	var subscriptions http.Handler // requires IAP
+	var behindIAP bool
 	if *buildEnvName == "" && *mode != "dev" && metadata.OnGCE() {
 		projectID, err := metadata.ProjectID()
 		if err != nil {
@@ -334,50 +396,124 @@ func main() {
 		}
 		env := buildenv.ByProjectID(projectID)
 		gomoteBucket = env.GomoteTransferBucket
+		gomoteAttachmentBucket = env.GomoteAttachmentBucket
 		var coordinatorBackend, serviceID = "coordinator-internal-iap", ""
 		if serviceID = env.IAPServiceID(coordinatorBackend); serviceID == "" {
 			log.Fatalf("unable to retrieve Service ID for backend service=%q", coordinatorBackend)
 		}
 		opts = append(opts, grpc.UnaryInterceptor(access.RequireIAPAuthUnaryInterceptor(access.IAPSkipAudienceValidation)))
 		opts = append(opts, grpc.StreamInterceptor(access.RequireIAPAuthStreamInterceptor(access.IAPSkipAudienceValidation)))
+		subscriptions = access.RequireIAPAuthHandler(legacydash.SubscriptionsHandler(), access.IAPSkipAudienceValidation)
+		behindIAP = true
 	}
+	opts = append(opts, grpc.ChainStreamInterceptor(drainStreamInterceptor(drain)))
 	// grpcServer is a shared gRPC server. It is global, as it needs to be used in places that aren't factored otherwise.
 	grpcServer := grpc.NewServer(opts...)
 
+	legacydash.ReleaseStatusURL = *releaseStatusURL
+	legacydash.Backfill = backfillBuilds
 	dashV1 := legacydash.Handler(gce.GoDSClient(), maintnerClient, string(masterKey()), grpcServer)
 	dashV2 := &builddash.Handler{Datastore: gce.GoDSClient(), Maintner: maintnerClient}
 	gs := &gRPCServer{dashboardURL: "https://build.golang.org"}
 	setSessionPool(sp)
+	if c := gce.DSClient(); c != nil {
+		drain.store = datastoreStateStore{client: c}
+		if err := restoreSchedulerState(context.Background(), drain.store, sched); err != nil {
+			log.Printf("restoring the scheduler state: %v", err)
+		}
+	}
+	// Flags that are set explicitly override the restored policy, so a
+	// deployment can still change it.
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name != "gomote-instances-per-user" {
+			return
+		}
+		policy := sched.Policy()
+		policy.GomoteInstances = *gomoteInstancesPerUser
+		if err := sched.SetPolicy(policy); err != nil {
+			log.Fatalf("invalid scheduling policy: %v", err)
+		}
+	})
 	gomoteServer := gomote.New(sp, sched, sshCA, gomoteBucket, mustStorageClient(), mustLUCIConfigClient())
+	gomoteServer.SetFeatureFlags(featureFlags)
+	if gomoteAttachmentBucket != "" {
+		gomoteServer.SetAttachmentBucket(mustStorageClient(), gomoteAttachmentBucket)
+	}
 	protos.RegisterCoordinatorServer(grpcServer, gs)
 	gomoteprotos.RegisterGomoteServiceServer(grpcServer, gomoteServer)
 	mux.HandleFunc("/", grpcHandlerFunc(grpcServer, handleStatus)) // Serve a status page at farmer.golang.org.
 	mux.Handle("build.golang.org/", dashV1)                        // Serve a build dashboard at build.golang.org.
 	mux.Handle("build-staging.golang.org/", dashV1)
 	mux.HandleFunc("/builders", handleBuilders)
+	mux.HandleFunc("/reports/builders", handleBuilderReports(queryBuilderReportsBigQuery))
+	mux.HandleFunc("/reports/usage", handleUsage(buildUsages))
 	mux.HandleFunc("/temporarylogs", handleLogs)
+	mux.HandleFunc("/buildlog/", handleBuildLog)
+	mux.HandleFunc("/logtail", handleLogTail)
+	if flagStore != nil {
+		mux.Handle("/flags", &featureflag.Handler{Store: flagStore}) // read-only; edited in relui
+	}
 	mux.HandleFunc("/reverse", pool.HandleReverse)
 	mux.Handle("/revdial", revdial.ConnHandler())
+	if *wireGuardIface != "" {
+		if *wireGuardEndpoint == "" {
+			log.Fatalf("-wireguard-endpoint is required with -wireguard-iface")
+		}
+		mesh, err := pool.NewWireGuardMesh(*wireGuardIface, *wireGuardEndpoint, *wireGuardNetwork)
+		if err != nil {
+			log.Fatalf("pool.NewWireGuardMesh: %v", err)
+		}
+		mux.HandleFunc("/wireguard/register", mesh.HandleRegister)
+	}
 	mux.HandleFunc("/style.css", handleStyleCSS)
 	mux.HandleFunc("/try", serveTryStatus(false))
 	mux.HandleFunc("/try.json", serveTryStatus(true))
+	mux.HandleFunc("/try/results.json", handleTryResults(queryTryResultsDatastore))
 	mux.HandleFunc("/status/post-submit-active.json", handlePostSubmitActiveJSON)
 	mux.Handle("/dashboard", dashV2)
 	mux.HandleFunc("/queues", handleQueues)
+	mux.HandleFunc("/admin/scheduler", handleSchedPolicy(sched, sp, masterKey()))
+	mux.HandleFunc("/admin/drain", handleDrain(drain, masterKey()))
+	mux.HandleFunc("/integration", handleIntegration)
+	mux.HandleFunc("/speculative", handleSpeculative)
+	if subscriptions != nil {
+		if *notifyMailFrom != "" {
+			legacydash.SendMail = mustSendGridMail(sc, *notifyMailFrom)
+		}
+		mux.Handle("/subscriptions", subscriptions)
+	}
 	if *mode == "dev" {
 		// TODO(crawshaw): do more in dev mode
 		gce.BuildletPool().SetEnabled(*devEnableGCE)
 		go findWorkLoop()
 	} else {
+		if *warmPool != "" {
+			targets, err := pool.ParseWarmTargets(*warmPool)
+			if err != nil {
+				log.Fatalf("-warm-pool: %v", err)
+			}
+			go gce.BuildletPool().SetWarmPool(targets, *warmPoolMaxIdle).Run(context.Background())
+			go reportWarmPoolMetrics()
+		}
 		go gce.BuildletPool().CleanUpOldVMs()
 
 		if gce.InStaging() {
 			dashboard.Builders = stagingClusterBuilders()
 		}
 
+		if err := initTryReporters(context.Background(), sc, gce.GerritClient()); err != nil {
+			log.Fatalf("initTryReporters: %v", err)
+		}
+
 		go listenAndServeInternalModuleProxy()
 		go findWorkLoop()
 		go findTryWorkLoop()
+		if !gce.InStaging() {
+			go integrationLoop()
+		}
+		if *speculate {
+			go speculativeLoop()
+		}
 		go reportReverseCountMetrics()
 		// TODO(cmang): gccgo will need its own findWorkLoop
 	}
@@ -394,6 +530,15 @@ func main() {
 	if err != nil {
 		log.Printf("unable to configure SSH server: %s", err)
 	} else {
+		if *sshTranscripts != "" {
+			ts := mustTranscriptStore(ctx, sc)
+			sshServ.SetTranscriptStore(ts)
+			go ts.SweepLoop(time.Hour)
+			if behindIAP {
+				viewers := strings.Split(*sshTranscriptViewers, ",")
+				mux.Handle("/gomote/ssh-transcripts/", access.RequireIAPAuthHandler(remote.NewTranscriptViewer(ts, viewers), access.IAPSkipAudienceValidation))
+			}
+		}
 		go func() {
 			log.Printf("running SSH server on %s", *sshAddr)
 			err := sshServ.ListenAndServe()
@@ -406,12 +551,15 @@ func main() {
 			}
 		}()
 	}
+	var handler http.Handler = mux
 	if *mode == "dev" {
 		// Use hostPathHandler in local development mode (only) to improve
 		// convenience of testing multiple domains that coordinator serves.
-		log.Fatalln(https.ListenAndServe(context.Background(), hostPathHandler(mux)))
+		handler = hostPathHandler(mux)
+	}
+	if err := https.ListenAndServe(context.Background(), handler); err != nil {
+		log.Fatalln(err)
 	}
-	log.Fatalln(https.ListenAndServe(context.Background(), mux))
 }
 
 // ignoreAllNewWork, when true, prevents addWork from doing anything.
@@ -468,6 +616,9 @@ func addWorkDetail(work buildgo.BuilderRev, detail commitDetail) {
 		}
 		return
 	}
+	if reuseSpeculativeResult(work, detail) {
+		return
+	}
 	st, err := newBuild(work, detail)
 	if err != nil {
 		log.Printf("Bad build work params %v: %v", work, err)
@@ -476,6 +627,33 @@ func addWorkDetail(work buildgo.BuilderRev, detail commitDetail) {
 	st.start()
 }
 
+// backfillBuilds starts post-submit builds of revs on builder for
+// bisection on the dashboard, and returns how many it started. Like
+// addWorkDetail, it skips those that mayBuildRev disallows.
+func backfillBuilds(builder string, revs []legacydash.BackfillRev) int {
+	started := 0
+	for _, r := range revs {
+		work := buildgo.BuilderRev{Name: builder, Rev: r.Hash}
+		detail := commitDetail{RevBranch: r.Branch}
+		if r.Repo != "go" {
+			work = buildgo.BuilderRev{Name: builder, Rev: r.GoHash, SubName: r.Repo, SubRev: r.Hash}
+			detail = commitDetail{RevBranch: "master", SubRevBranch: r.Branch}
+		}
+		if ignoreAllNewWork || !mayBuildRev(work) {
+			continue
+		}
+		st, err := newBuild(work, detail)
+		if err != nil {
+			log.Printf("Bad backfill build params %v: %v", work, err)
+			continue
+		}
+		log.Printf("backfilling %v for bisection", work)
+		st.start()
+		started++
+	}
+	return started
+}
+
 func stagingClusterBuilders() map[string]*dashboard.BuildConfig {
 	m := map[string]*dashboard.BuildConfig{}
 	for _, name := range []string{
@@ -519,10 +697,11 @@ var (
 )
 
 // mayBuildRev reports whether the build type & revision should be started.
-// It returns true if it's not already building, and if a reverse buildlet is
-// required, if an appropriate machine is registered.
+// It returns true if it's not already building, the coordinator isn't
+// draining, and if a reverse buildlet is required, if an appropriate
+// machine is registered.
 func mayBuildRev(rev buildgo.BuilderRev) bool {
-	if isBuilding(rev) {
+	if isBuilding(rev) || drain.isDraining() {
 		return false
 	}
 	if rev.SubName != "" {
@@ -829,7 +1008,7 @@ func handleLogs(w http.ResponseWriter, r *http.Request) {
 		if nostream {
 			fmt.Fprintf(w, "\n\n(live streaming disabled; reload manually to see status)\n")
 		}
-		w.Write(st.output.Bytes())
+		w.Write(st.out().Bytes())
 		return
 	}
 
@@ -840,7 +1019,7 @@ func handleLogs(w http.ResponseWriter, r *http.Request) {
 
 	w.(http.Flusher).Flush()
 
-	output := st.output.Reader()
+	output := st.out().Reader()
 	go func() {
 		<-r.Context().Done()
 		output.Close()
@@ -1102,6 +1281,8 @@ func findTryWork() error {
 			// already in progress
 			ts.wantedAsOf = now
 			continue
+		} else if drain.isDraining() {
+			continue
 		} else {
 			ts := newTrySet(work)
 			ts.wantedAsOf = now
@@ -1139,6 +1320,7 @@ type trySet struct {
 	// immutable
 	tryKey
 	tryID    string                   // "T" + 9 random hex
+	patchset int                      // Gerrit patch set number of Commit
 	slowBots []*dashboard.BuildConfig // any opt-in slower builders to run in a trybot run
 	xrepos   []*buildStatus           // any opt-in x/ repo builds to run in a trybot run
 
@@ -1152,7 +1334,8 @@ type trySet struct {
 	mu       sync.Mutex
 	canceled bool // try run is no longer wanted and its builds were canceled
 	trySetState
-	errMsg bytes.Buffer
+	failures []tryFailure // like failed, with the log URLs once written
+	clNumber int          // Gerrit change number, once looked up by changeNumber
 }
 
 type trySetState struct {
@@ -1201,8 +1384,9 @@ func newTrySet(work *apipb.GerritTryWorkItem) *trySet {
 	key := tryWorkItemKey(work)
 	log.Printf("Starting new trybot set for %v", key)
 	ts := &trySet{
-		tryKey: key,
-		tryID:  "T" + randHex(9),
+		tryKey:   key,
+		tryID:    "T" + randHex(9),
+		patchset: int(work.Version),
 		trySetState: trySetState{
 			builds: make([]*buildStatus, 0, len(builders)),
 		},
@@ -1477,8 +1661,8 @@ func (ts *trySet) statusPage() string {
 	return "https://farmer.golang.org/try?commit=" + ts.Commit[:8]
 }
 
-// notifyStarting runs in its own goroutine and posts to Gerrit that
-// the trybots have started on the user's CL with a link of where to watch.
+// notifyStarting runs in its own goroutine and reports that the
+// trybots have started on the user's CL with a link of where to watch.
 func (ts *trySet) notifyStarting() {
 	name := "TryBots"
 	if len(ts.slowBots) > 0 {
@@ -1499,44 +1683,25 @@ func (ts *trySet) notifyStarting() {
 		}
 	}
 
-	unresolved := true
-	ri := gerrit.ReviewInput{
-		Tag: tryBotsTag("beginning"),
-		Comments: map[string][]gerrit.CommentInput{
-			"/PATCHSET_LEVEL": {{Message: msg, Unresolved: &unresolved}},
-		},
-	}
-
-	// Mark as resolved old TryBot threads that don't have human comments on them.
-	gerritClient := pool.NewGCEConfiguration().GerritClient()
-	if patchSetThreads, err := listPatchSetThreads(gerritClient, ts.ChangeTriple()); err == nil {
-		for _, t := range patchSetThreads {
-			if !t.unresolved {
-				continue
-			}
-			hasHumanComments := false
-			for _, c := range t.thread {
-				if !isTryBotsTag(c.Tag) {
-					hasHumanComments = true
-					break
-				}
-			}
-			if hasHumanComments {
-				continue
-			}
-			unresolved := false
-			ri.Comments["/PATCHSET_LEVEL"] = append(ri.Comments["/PATCHSET_LEVEL"], gerrit.CommentInput{
-				InReplyTo:  t.root.ID,
-				Message:    "Superseded.",
-				Unresolved: &unresolved,
-			})
-		}
-	} else {
-		log.Printf("Error getting Gerrit threads on %s: %v", ts.ChangeTriple(), err)
-	}
+	tryReporters.report(context.Background(), ts.newReport(tryStarted, msg))
+}
 
-	if err := gerritClient.SetReview(context.Background(), ts.ChangeTriple(), ts.Commit, ri); err != nil {
-		log.Printf("Error leaving Gerrit comment on %s: %v", ts.Commit[:8], err)
+// newReport returns a report of the event ev, described by msg, with
+// the current state of ts.
+func (ts *trySet) newReport(ev tryEvent, msg string) *tryReport {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	return &tryReport{
+		Event:     ev,
+		Project:   ts.Project,
+		Branch:    ts.Branch,
+		ChangeID:  ts.ChangeID,
+		Commit:    ts.Commit,
+		StatusURL: ts.statusPage(),
+		Message:   msg,
+		Total:     len(ts.builds),
+		Remain:    ts.remain,
+		Failed:    append([]tryFailure(nil), ts.failures...),
 	}
 }
 
@@ -1616,24 +1781,25 @@ func (ts *trySet) cancelBuilds() {
 
 func (ts *trySet) noteBuildComplete(bs *buildStatus) {
 	bs.mu.Lock()
-	var (
-		succeeded = bs.succeeded
-		buildLog  = bs.output.String()
-	)
+	succeeded := bs.succeeded
 	bs.mu.Unlock()
+	buildLog := bs.logs()
 
 	ts.mu.Lock()
 	ts.remain--
 	remain := ts.remain
+	failIdx := -1
 	if !succeeded {
 		ts.failed = append(ts.failed, bs.NameAndBranch())
+		failIdx = len(ts.failures)
+		ts.failures = append(ts.failures, tryFailure{Builder: bs.NameAndBranch(), Diagnostics: parseDiagnostics(buildLog)})
 	}
 	numFail := len(ts.failed)
 	canceled := ts.canceled
 	ts.mu.Unlock()
 
 	if canceled {
-		// Be quiet and don't spam Gerrit.
+		// Be quiet and don't spam the reporters.
 		return
 	}
 
@@ -1642,12 +1808,8 @@ func (ts *trySet) noteBuildComplete(bs *buildStatus) {
 	s1 := sha1.New()
 	io.WriteString(s1, buildLog)
 	objName := fmt.Sprintf("%s/%s_%x.log", bs.Rev[:8], bs.Name, s1.Sum(nil)[:4])
-	wr, logURL := newBuildLogBlob(objName)
-	if _, err := io.WriteString(wr, buildLog); err != nil {
-		log.Printf("Failed to write to GCS: %v", err)
-		return
-	}
-	if err := wr.Close(); err != nil {
+	logURL, err := bs.saveLog(objName)
+	if err != nil {
 		log.Printf("Failed to write to GCS: %v", err)
 		return
 	}
@@ -1655,10 +1817,11 @@ func (ts *trySet) noteBuildComplete(bs *buildStatus) {
 	bs.mu.Lock()
 	bs.logURL = logURL
 	bs.mu.Unlock()
+	go ts.recordResult(bs, logURL)
 
 	if !succeeded {
 		ts.mu.Lock()
-		fmt.Fprintf(&ts.errMsg, "Failed on %s: %s\n", bs.NameAndBranch(), logURL)
+		ts.failures[failIdx].LogURL = logURL
 		ts.mu.Unlock()
 	}
 
@@ -1669,88 +1832,53 @@ func (ts *trySet) noteBuildComplete(bs *buildStatus) {
 		return
 	}
 
-	var (
-		gerritMsg   = &strings.Builder{}
-		gerritTag   string
-		gerritScore int
-	)
-
+	msg := new(strings.Builder)
+	ev := tryProgress
 	if postInProgressMessage {
-		fmt.Fprintf(gerritMsg, "Build is still in progress... "+
+		fmt.Fprintf(msg, "Build is still in progress... "+
 			"Status page: https://farmer.golang.org/try?commit=%s\n"+
 			"Failed on %s: %s\n"+
 			"Other builds still in progress; subsequent failure notices suppressed until final report.\n\n"+
 			failureFooter, ts.Commit[:8], bs.NameAndBranch(), logURL)
-		gerritTag = tryBotsTag("progress")
 	}
 
 	if postFinishedMessage {
+		ev = tryFinished
 		name := "TryBots"
 		if len(ts.slowBots) > 0 {
 			name = "SlowBots"
 		}
 
 		if numFail == 0 {
-			gerritScore = 1
-			fmt.Fprintf(gerritMsg, "%s are happy.\n", name)
-			gerritTag = tryBotsTag("happy")
+			fmt.Fprintf(msg, "%s are happy.\n", name)
 		} else {
-			gerritScore = -1
 			ts.mu.Lock()
-			errMsg := ts.errMsg.String()
+			var errMsg strings.Builder
+			for _, f := range ts.failures {
+				if f.LogURL != "" {
+					fmt.Fprintf(&errMsg, "Failed on %s: %s\n", f.Builder, f.LogURL)
+				}
+			}
 			ts.mu.Unlock()
-			fmt.Fprintf(gerritMsg, "%d of %d %s failed.\n%s\n"+failureFooter,
-				numFail, len(ts.builds), name, errMsg)
-			gerritTag = tryBotsTag("failed")
+			fmt.Fprintf(msg, "%d of %d %s failed.\n%s\n"+failureFooter,
+				numFail, len(ts.builds), name, errMsg.String())
 		}
-		fmt.Fprintln(gerritMsg)
+		fmt.Fprintln(msg)
 		if len(ts.slowBots) > 0 {
-			fmt.Fprintf(gerritMsg, "SlowBot builds that ran:\n")
+			fmt.Fprintf(msg, "SlowBot builds that ran:\n")
 			for _, c := range ts.slowBots {
-				fmt.Fprintf(gerritMsg, "* %s\n", c.Name)
+				fmt.Fprintf(msg, "* %s\n", c.Name)
 			}
 		}
 		if len(ts.xrepos) > 0 {
-			fmt.Fprintf(gerritMsg, "Also tested the following repos:\n")
+			fmt.Fprintf(msg, "Also tested the following repos:\n")
 			for _, st := range ts.xrepos {
-				fmt.Fprintf(gerritMsg, "* %s\n", st.NameAndBranch())
-			}
-		}
-	}
-
-	var inReplyTo string
-	gerritClient := pool.NewGCEConfiguration().GerritClient()
-	if patchSetThreads, err := listPatchSetThreads(gerritClient, ts.ChangeTriple()); err == nil {
-		for _, t := range patchSetThreads {
-			if t.root.Tag == tryBotsTag("beginning") && strings.Contains(t.root.Message, ts.statusPage()) {
-				inReplyTo = t.root.ID
+				fmt.Fprintf(msg, "* %s\n", st.NameAndBranch())
 			}
 		}
-	} else {
-		log.Printf("Error getting Gerrit threads on %s: %v", ts.ChangeTriple(), err)
 	}
 
-	// Mark resolved if TryBots are happy.
-	unresolved := gerritScore != 1
-
-	ri := gerrit.ReviewInput{
-		Tag: gerritTag,
-		Comments: map[string][]gerrit.CommentInput{
-			"/PATCHSET_LEVEL": {{
-				InReplyTo:  inReplyTo,
-				Message:    gerritMsg.String(),
-				Unresolved: &unresolved,
-			}},
-		},
-	}
-	if gerritScore != 0 {
-		ri.Labels = map[string]int{
-			"TryBot-Result": gerritScore,
-		}
-	}
-	if err := gerritClient.SetReview(context.Background(), ts.ChangeTriple(), ts.Commit, ri); err != nil {
-		log.Printf("Error leaving Gerrit comment on %s: %v", ts.Commit[:8], err)
-	}
+	tryReporters.report(context.Background(), ts.newReport(ev, msg.String()))
 }
 
 // getBuildlets creates up to n buildlets and sends them on the returned channel
@@ -2027,6 +2155,30 @@ func newBuildLogBlob(objName string) (obj io.WriteCloser, url_ string) {
 	return wr, fmt.Sprintf("https://storage.googleapis.com/%s/%s", bucket, objName)
 }
 
+// newManifestBlob returns a writer for the environment manifest of
+// the build with the given ID, and the URL it will be at.
+func newManifestBlob(buildID string) (obj io.WriteCloser, url_ string) {
+	objName := "manifest/" + buildID + ".json"
+	if *mode == "dev" {
+		return struct {
+			io.Writer
+			io.Closer
+		}{
+			io.Discard,
+			ioutil.NopCloser(nil),
+		}, "devmode://build-manifest/" + objName
+	}
+	if pool.NewGCEConfiguration().StorageClient() == nil {
+		panic("nil storageClient in newManifestBlob")
+	}
+	bucket := pool.NewGCEConfiguration().BuildEnv().LogBucket
+
+	wr := pool.NewGCEConfiguration().StorageClient().Bucket(bucket).Object(objName).NewWriter(context.Background())
+	wr.ContentType = "application/json"
+
+	return wr, fmt.Sprintf("https://storage.googleapis.com/%s/%s", bucket, objName)
+}
+
 func randHex(n int) string {
 	buf := make([]byte, n/2+1)
 	if _, err := rand.Read(buf); err != nil {
@@ -2207,13 +2359,55 @@ func mustCreateEC2BuildletPool(sc *secret.Client, isRemoteBuildlet func(instName
 		log.Fatalf("unable to create AWS client: %s", err)
 	}
 
-	ec2Pool, err := pool.NewEC2Buildlet(awsClient, buildenv.Production, dashboard.Hosts, isRemoteBuildlet)
+	var opts []pool.EC2Opt
+	if *buildletCA {
+		ca := mustCreateBuildletCA(sc)
+		go ca.RunCRLRefresh(context.Background(), time.Hour)
+		go reportBuildletCAMetrics(ca)
+		opts = append(opts, pool.WithBuildletCA(ca))
+	}
+	ec2Pool, err := pool.NewEC2Buildlet(awsClient, buildenv.Production, dashboard.Hosts, isRemoteBuildlet, opts...)
 	if err != nil {
 		log.Fatalf("unable to create EC2 buildlet pool: %s", err)
 	}
 	return ec2Pool
 }
 
+// mustCreateBuildletCA returns the certificate authority of buildlets'
+// TLS certificates, with the root certificate and the intermediate it
+// signs with in Secret Manager. The root's private key isn't needed.
+func mustCreateBuildletCA(sc *secret.Client) *buildletca.CA {
+	retrieve := func(name string) []byte {
+		v, err := sc.Retrieve(context.Background(), name)
+		if err != nil {
+			log.Fatalf("unable to retrieve secret %q: %s", name, err)
+		}
+		return []byte(v)
+	}
+	block, _ := pem.Decode(retrieve(secret.NameBuildletCACert))
+	if block == nil {
+		log.Fatalf("invalid buildlet CA root: no PEM data")
+	}
+	root, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		log.Fatalf("invalid buildlet CA root: %s", err)
+	}
+	intermediate, err := tls.X509KeyPair(retrieve(secret.NameBuildletCAIntermediateCert), retrieve(secret.NameBuildletCAIntermediateKey))
+	if err != nil {
+		log.Fatalf("invalid buildlet CA intermediate: %s", err)
+	}
+	ca, err := buildletca.New(buildletca.Options{
+		Root:         root,
+		Intermediate: &intermediate,
+		CRLURL:       *buildletCACRL,
+		OCSPURL:      *buildletCAOCSP,
+	})
+	if err != nil {
+		log.Fatalf("unable to create buildlet CA: %s", err)
+	}
+	return ca
+}
+
 func mustRetrieveSSHCertificateAuthority() (privateKey []byte) {
 	privateKey, _, err := remote.SSHKeyPair()
 	if err != nil {
@@ -2222,6 +2416,27 @@ func mustRetrieveSSHCertificateAuthority() (privateKey []byte) {
 	return
 }
 
+// mustInitSourceCache adds the layers named by the -source-cache flag
+// to sourceCache.
+func mustInitSourceCache() {
+	if *sourceCacheURLs == "" {
+		return
+	}
+	var stores []sourcecache.Store
+	for _, u := range strings.Split(*sourceCacheURLs, ",") {
+		var client *storage.Client
+		if strings.HasPrefix(u, "gs:") {
+			client = mustStorageClient()
+		}
+		st, err := sourcecache.NewStore(context.Background(), client, u)
+		if err != nil {
+			log.Fatalf("invalid -source-cache URL %q: %v", u, err)
+		}
+		stores = append(stores, st)
+	}
+	sourceCache = sourcecache.New(sourcecache.Options{Stores: stores})
+}
+
 func mustStorageClient() *storage.Client {
 	if metadata.OnGCE() {
 		return pool.NewGCEConfiguration().StorageClient()
@@ -2256,6 +2471,38 @@ func retrieveSSHKeys(ctx context.Context, sc *secret.Client, m string) (publicKe
 	return nil, nil, fmt.Errorf("unable to retrieve ssh keys")
 }
 
+// mustTranscriptStore returns the store of the -ssh-transcripts.
+func mustTranscriptStore(ctx context.Context, sc *secret.Client) *remote.TranscriptStore {
+	var client *storage.Client
+	if strings.HasPrefix(*sshTranscripts, "gs:") {
+		client = mustStorageClient()
+	}
+	fsys, err := gcsfs.FromURL(ctx, client, *sshTranscripts)
+	if err != nil {
+		log.Fatalf("invalid -ssh-transcripts URL %q: %v", *sshTranscripts, err)
+	}
+	var key []byte
+	if *mode == "dev" {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			log.Fatal(err)
+		}
+	} else {
+		keyS, err := fromSecret(ctx, sc, secret.NameGomoteSSHTranscriptKey)
+		if err != nil {
+			log.Fatalf("retrieving the SSH transcript key: %v", err)
+		}
+		if key, err = base64.StdEncoding.DecodeString(strings.TrimSpace(keyS)); err != nil {
+			log.Fatalf("decoding the SSH transcript key: %v", err)
+		}
+	}
+	ts, err := remote.NewTranscriptStore(fsys, key, *sshTranscriptRetention)
+	if err != nil {
+		log.Fatalf("configuring SSH transcripts: %v", err)
+	}
+	return ts
+}
+
 func mustLUCIConfigClient() *swarmclient.ConfigClient {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
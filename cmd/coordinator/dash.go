@@ -98,7 +98,9 @@ func dash(meth, cmd string, args url.Values, req, resp interface{}) error {
 // recordResult sends build results to the dashboard.
 // This is not used for trybot runs; only those after commit.
 // The URLs end up looking like https://build.golang.org/log/$HEXDIGEST
-func recordResult(br buildgo.BuilderRev, ok bool, buildLog string, runTime time.Duration) error {
+// The branch and commit times of detail let the dashboard notify the
+// subscribers to the results of br's builder, in commit order.
+func recordResult(br buildgo.BuilderRev, detail commitDetail, ok bool, buildLog string, runTime time.Duration) error {
 	req := map[string]interface{}{
 		"Builder":     br.Name,
 		"PackagePath": "",
@@ -107,11 +109,16 @@ func recordResult(br buildgo.BuilderRev, ok bool, buildLog string, runTime time.
 		"OK":          ok,
 		"Log":         buildLog,
 		"RunTime":     runTime,
+		"Branch":      detail.RevBranch,
+		"CommitTime":  detail.RevCommitTime,
 	}
 	if br.IsSubrepo() {
 		req["PackagePath"] = importPathOfRepo(br.SubName)
 		req["Hash"] = br.SubRev
 		req["GoHash"] = br.Rev
+		req["Branch"] = detail.SubRevBranch
+		req["CommitTime"] = detail.SubRevCommitTime
+		req["GoCommitTime"] = detail.RevCommitTime
 	}
 	args := url.Values{"key": {builderKey(br.Name)}, "builder": {br.Name}}
 	if *mode == "dev" {
@@ -0,0 +1,158 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.16 && (linux || darwin)
+// +build go1.16
+// +build linux darwin
+
+// Code related to finding source positions of errors in build logs,
+// so they can be reported as inline comments.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/build/gerrit"
+)
+
+// A tryDiagnostic is a compiler, vet, or test error at a line of a Go
+// source file, found in the log of a failed build.
+type tryDiagnostic struct {
+	// Path is the file's path as it appears in the log. It may be
+	// relative to the directory the failing command ran in, or
+	// absolute, so it's matched against the files of the change
+	// by suffix.
+	Path    string `json:"path"`
+	Line    int    `json:"line"`
+	Message string `json:"message"`
+}
+
+// maxDiagnostics is the maximum number of diagnostics kept from the log
+// of a failed build. Logs with more are likely failing for reasons that
+// inline comments won't help with.
+const maxDiagnostics = 20
+
+// diagnosticRx matches a line of output from the compiler, vet, or a
+// failing test that starts with a position in a Go file, like
+//
+//	./x.go:12:3: undefined: y
+//	vet: net/http/server.go:123:2: unreachable code
+//	    foo_test.go:45: got 1, want 2
+var diagnosticRx = regexp.MustCompile(`^\s*(?:vet: )?(?:\./)?(/?(?:[\w.+-]+/)*[\w.+-]+\.go):(\d+)(?::\d+)?: (.+)$`)
+
+// parseDiagnostics returns the diagnostics in buildLog, in order and
+// without duplicates, up to maxDiagnostics.
+func parseDiagnostics(buildLog string) []tryDiagnostic {
+	var diags []tryDiagnostic
+	seen := make(map[tryDiagnostic]bool)
+	sc := bufio.NewScanner(strings.NewReader(buildLog))
+	sc.Buffer(nil, 1<<20)
+	for sc.Scan() && len(diags) < maxDiagnostics {
+		m := diagnosticRx.FindStringSubmatch(sc.Text())
+		if m == nil {
+			continue
+		}
+		line, err := strconv.Atoi(m[2])
+		if err != nil || line < 1 {
+			continue
+		}
+		d := tryDiagnostic{Path: m[1], Line: line, Message: strings.TrimSpace(m[3])}
+		if seen[d] {
+			continue
+		}
+		seen[d] = true
+		diags = append(diags, d)
+	}
+	return diags
+}
+
+// maxInlineComments is the maximum number of inline comments posted
+// on a change for one trySet.
+const maxInlineComments = 50
+
+// inlineComments returns unresolved comments on the lines of files
+// that failures report diagnostics for, keyed by the file's path in
+// the change. files are the paths of the files in the change; Gerrit
+// only accepts comments on those, so diagnostics elsewhere are
+// dropped. Diagnostics reported by several builders are combined.
+func inlineComments(failures []tryFailure, files []string) map[string][]gerrit.CommentInput {
+	type position struct {
+		path    string
+		line    int
+		message string
+	}
+	var (
+		order    []position
+		builders = make(map[position][]string)
+	)
+	for _, f := range failures {
+		for _, d := range f.Diagnostics {
+			path, ok := changedFile(d.Path, files)
+			if !ok {
+				continue
+			}
+			p := position{path, d.Line, d.Message}
+			if _, ok := builders[p]; !ok {
+				if len(order) == maxInlineComments {
+					continue
+				}
+				order = append(order, p)
+			}
+			builders[p] = append(builders[p], f.Builder)
+		}
+	}
+	comments := make(map[string][]gerrit.CommentInput)
+	for _, p := range order {
+		unresolved := true
+		comments[p.path] = append(comments[p.path], gerrit.CommentInput{
+			Line:       p.line,
+			Message:    fmt.Sprintf("%s\n\nReported by %s.", p.message, strings.Join(builders[p], ", ")),
+			Unresolved: &unresolved,
+		})
+	}
+	return comments
+}
+
+// changedFile returns the file among files that the diagnostic path
+// refers to. The path and the file must be equal, or one must be a
+// suffix of the other at a path separator. Of several such files, the
+// one sharing the longest suffix with the path wins; ties are
+// ambiguous and match nothing.
+func changedFile(path string, files []string) (string, bool) {
+	path = strings.TrimPrefix(path, "./")
+	var (
+		match string
+		best  int // length of the suffix shared with match
+		tied  bool
+	)
+	for _, f := range files {
+		if f == path {
+			return f, true
+		}
+		var n int
+		switch {
+		case strings.HasSuffix(path, "/"+f):
+			n = len(f)
+		case strings.HasSuffix(f, "/"+path):
+			n = len(path)
+		default:
+			continue
+		}
+		switch {
+		case n > best:
+			match, best, tied = f, n, false
+		case n == best:
+			tied = true
+		}
+	}
+	if match == "" || tied {
+		return "", false
+	}
+	return match, true
+}
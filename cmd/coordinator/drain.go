@@ -0,0 +1,321 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.16 && (linux || darwin)
+// +build go1.16
+// +build linux darwin
+
+// Code related to draining the coordinator before it's restarted.
+
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/datastore"
+	"golang.org/x/build/internal/coordinator/schedule"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	grpcstatus "google.golang.org/grpc/status"
+)
+
+const (
+	// defaultDrainDeadline is how long a drain waits for running
+	// builds to finish, unless the request says otherwise.
+	defaultDrainDeadline = 30 * time.Minute
+	// maxRestoredStateAge is how old the scheduler state left by a
+	// drained coordinator can be for the next one to restore it.
+	// Older state is from a coordinator that wasn't restarted right
+	// after it was drained, and may have been superseded by flags.
+	maxRestoredStateAge = time.Hour
+)
+
+// drainPollInterval is how often a drain checks whether the running
+// builds have finished.
+var drainPollInterval = 5 * time.Second
+
+// drainer puts the coordinator in drain mode, in which it starts no
+// new builds or gomote instances, so that it can be restarted without
+// killing builds. Builds that are running when the drain starts are
+// given until its deadline to finish. Then, the scheduler state is
+// persisted for the next coordinator, and the coordinator is reported
+// ready to restart.
+type drainer struct {
+	sched *schedule.Scheduler
+	store schedulerStateStore // nil if there's nowhere to persist state
+	// running returns the names of the running builds.
+	running func() []string
+
+	mu        sync.Mutex
+	draining  bool
+	since     time.Time
+	deadline  time.Time
+	cancel    context.CancelFunc // cancels the goroutine waiting for builds
+	done      bool               // whether that goroutine finished
+	persisted bool
+	err       error // from persisting the scheduler state
+}
+
+// drain is the drainer of the coordinator.
+var drain = &drainer{
+	sched:   sched,
+	running: runningBuilds,
+}
+
+// runningBuilds returns the names of the builds in progress, sorted.
+func runningBuilds() []string {
+	statusMu.Lock()
+	defer statusMu.Unlock()
+	names := make([]string, 0, len(status))
+	for _, st := range status {
+		names = append(names, fmt.Sprintf("%s rev %s", st.NameAndBranch(), st.Rev))
+	}
+	sort.Strings(names)
+	return names
+}
+
+// isDraining reports whether the coordinator is in drain mode, in which
+// it mustn't start new builds or gomote instances.
+func (d *drainer) isDraining() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.draining
+}
+
+// start puts the coordinator in drain mode, giving running builds
+// until timeout from now to finish. If it's already draining, only the
+// deadline changes.
+func (d *drainer) start(timeout time.Duration) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.deadline = time.Now().Add(timeout)
+	if d.draining {
+		log.Printf("drain: deadline changed to %v", d.deadline)
+		return
+	}
+	log.Printf("drain: starting; running builds have until %v to finish", d.deadline)
+	d.draining = true
+	d.since = time.Now()
+	d.done, d.persisted, d.err = false, false, nil
+	ctx, cancel := context.WithCancel(context.Background())
+	d.cancel = cancel
+	go d.wait(ctx)
+}
+
+// stop takes the coordinator out of drain mode.
+func (d *drainer) stop() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !d.draining {
+		return
+	}
+	log.Printf("drain: canceled")
+	d.cancel()
+	d.draining = false
+}
+
+// wait waits for the running builds to finish or the deadline to pass,
+// and then persists the scheduler state.
+func (d *drainer) wait(ctx context.Context) {
+	t := time.NewTicker(drainPollInterval)
+	defer t.Stop()
+	for {
+		d.mu.Lock()
+		deadline := d.deadline
+		d.mu.Unlock()
+		if n := len(d.running()); n == 0 {
+			log.Printf("drain: all builds finished")
+			break
+		} else if time.Now().After(deadline) {
+			log.Printf("drain: deadline passed with %d builds running", n)
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+
+	var err error
+	if d.store != nil {
+		err = saveSchedulerState(ctx, d.store, d.sched)
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if ctx.Err() != nil {
+		return // canceled meanwhile
+	}
+	d.done = true
+	d.persisted, d.err = d.store != nil && err == nil, err
+	if err != nil {
+		log.Printf("drain: persisting scheduler state: %v", err)
+		return
+	}
+	log.Printf("drain: ready to restart")
+}
+
+// DrainStatus is the state of drain mode served by /admin/drain.
+type DrainStatus struct {
+	Draining bool
+	Since    time.Time `json:",omitempty"`
+	Deadline time.Time `json:",omitempty"`
+	// Running lists the builds still running.
+	Running []string
+	// StatePersisted is whether the scheduler state was saved for
+	// the next coordinator, and Error why it couldn't be.
+	StatePersisted bool
+	Error          string `json:",omitempty"`
+	// Ready is whether the coordinator can be restarted: it's
+	// draining, its running builds finished or ran out of time,
+	// and its state was persisted if there's somewhere to do so.
+	Ready bool
+}
+
+func (d *drainer) status() DrainStatus {
+	running := d.running()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	s := DrainStatus{
+		Draining: d.draining,
+		Running:  running,
+	}
+	if !d.draining {
+		return s
+	}
+	s.Since, s.Deadline = d.since, d.deadline
+	s.StatePersisted = d.persisted
+	if d.err != nil {
+		s.Error = d.err.Error()
+	}
+	s.Ready = d.done && d.err == nil
+	return s
+}
+
+// handleDrain serves the state of drain mode as a DrainStatus in JSON.
+// A POST starts draining, with running builds given the duration in
+// the timeout parameter, or defaultDrainDeadline, to finish, and a
+// DELETE stops it. Deployments drain the coordinator, then poll until
+// it's ready to restart. Requests must carry the builder master key
+// in the key parameter.
+func handleDrain(d *drainer, key []byte) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.FormValue("key")), key) != 1 {
+			http.Error(w, "missing or invalid key", http.StatusForbidden)
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPost:
+			timeout := defaultDrainDeadline
+			if v := r.FormValue("timeout"); v != "" {
+				t, err := time.ParseDuration(v)
+				if err != nil || t < 0 {
+					http.Error(w, "invalid timeout parameter: want a non-negative duration", http.StatusBadRequest)
+					return
+				}
+				timeout = t
+			}
+			d.start(timeout)
+		case http.MethodDelete:
+			d.stop()
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		e := json.NewEncoder(w)
+		e.SetIndent("", "\t")
+		if err := e.Encode(d.status()); err != nil {
+			log.Printf("handleDrain: %v", err)
+		}
+	}
+}
+
+// drainStreamInterceptor rejects requests to create gomote instances
+// while the coordinator is draining.
+func drainStreamInterceptor(d *drainer) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if info.FullMethod == "/protos.GomoteService/CreateInstance" && d.isDraining() {
+			return grpcstatus.Errorf(codes.Unavailable, "the coordinator is about to restart; try again in a few minutes")
+		}
+		return handler(srv, ss)
+	}
+}
+
+// schedulerStateRecord is the scheduler state a drained coordinator
+// leaves for the next one.
+type schedulerStateRecord struct {
+	Time   time.Time
+	Policy []byte `datastore:",noindex"` // schedule.Policy in JSON
+}
+
+// schedulerStateStore persists a schedulerStateRecord.
+type schedulerStateStore interface {
+	save(context.Context, *schedulerStateRecord) error
+	// load returns the saved record, or nil if there's none.
+	load(context.Context) (*schedulerStateRecord, error)
+}
+
+// datastoreStateStore is a schedulerStateStore in datastore.
+type datastoreStateStore struct {
+	client *datastore.Client
+}
+
+var schedulerStateKey = datastore.NameKey("SchedulerState", "coordinator", nil)
+
+func (s datastoreStateStore) save(ctx context.Context, r *schedulerStateRecord) error {
+	_, err := s.client.Put(ctx, schedulerStateKey, r)
+	return err
+}
+
+func (s datastoreStateStore) load(ctx context.Context) (*schedulerStateRecord, error) {
+	r := new(schedulerStateRecord)
+	if err := s.client.Get(ctx, schedulerStateKey, r); errors.Is(err, datastore.ErrNoSuchEntity) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func saveSchedulerState(ctx context.Context, store schedulerStateStore, sched *schedule.Scheduler) error {
+	p, err := json.Marshal(sched.Policy())
+	if err != nil {
+		return err
+	}
+	return store.save(ctx, &schedulerStateRecord{Time: time.Now(), Policy: p})
+}
+
+// restoreSchedulerState restores the scheduler state that a drained
+// coordinator left, if it's recent enough.
+func restoreSchedulerState(ctx context.Context, store schedulerStateStore, sched *schedule.Scheduler) error {
+	r, err := store.load(ctx)
+	if err != nil || r == nil {
+		return err
+	}
+	if age := time.Since(r.Time); age > maxRestoredStateAge {
+		log.Printf("not restoring the scheduler state saved %v ago", age.Round(time.Minute))
+		return nil
+	}
+	var p schedule.Policy
+	if err := json.Unmarshal(r.Policy, &p); err != nil {
+		return err
+	}
+	if err := sched.SetPolicy(p); err != nil {
+		return err
+	}
+	log.Printf("restored the scheduling policy saved at %v: %+v", r.Time, p)
+	return nil
+}
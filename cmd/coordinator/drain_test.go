@@ -0,0 +1,253 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.16 && (linux || darwin)
+// +build go1.16
+// +build linux darwin
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.org/x/build/internal/coordinator/schedule"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	grpcstatus "google.golang.org/grpc/status"
+)
+
+// memStateStore is a schedulerStateStore in memory.
+type memStateStore struct {
+	mu  sync.Mutex
+	rec *schedulerStateRecord
+	err error // returned by save
+}
+
+func (s *memStateStore) save(_ context.Context, r *schedulerStateRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	s.rec = r
+	return nil
+}
+
+func (s *memStateStore) load(context.Context) (*schedulerStateRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.rec, nil
+}
+
+// fakeBuilds is a set of running builds for a drainer.
+type fakeBuilds struct {
+	mu    sync.Mutex
+	names []string
+}
+
+func (b *fakeBuilds) running() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]string(nil), b.names...)
+}
+
+func (b *fakeBuilds) finishAll() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.names = nil
+}
+
+func setDrainPollInterval(t *testing.T, d time.Duration) {
+	old := drainPollInterval
+	drainPollInterval = d
+	t.Cleanup(func() { drainPollInterval = old })
+}
+
+// awaitDrainStatus waits for d's status to satisfy cond.
+func awaitDrainStatus(t *testing.T, d *drainer, cond func(DrainStatus) bool) DrainStatus {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		s := d.status()
+		if cond(s) {
+			return s
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("drain status %+v never satisfied the condition", s)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestDrain(t *testing.T) {
+	setDrainPollInterval(t, time.Millisecond)
+	sched := schedule.NewScheduler()
+	p := sched.Policy()
+	p.GomoteInstances = 3
+	if err := sched.SetPolicy(p); err != nil {
+		t.Fatal(err)
+	}
+	builds := &fakeBuilds{names: []string{"linux-amd64 rev abc"}}
+	store := &memStateStore{}
+	d := &drainer{sched: sched, store: store, running: builds.running}
+
+	if d.isDraining() {
+		t.Fatalf("new drainer is draining")
+	}
+	d.start(time.Hour)
+	if !d.isDraining() {
+		t.Fatalf("drainer isn't draining after start")
+	}
+	time.Sleep(10 * time.Millisecond)
+	if s := d.status(); s.Ready || s.StatePersisted || len(s.Running) != 1 {
+		t.Errorf("status with a running build = %+v; want one running build, not ready", s)
+	}
+
+	builds.finishAll()
+	s := awaitDrainStatus(t, d, func(s DrainStatus) bool { return s.Ready })
+	if !s.StatePersisted || s.Error != "" || len(s.Running) != 0 {
+		t.Errorf("ready status = %+v; want state persisted, no builds", s)
+	}
+	var got schedule.Policy
+	if err := json.Unmarshal(store.rec.Policy, &got); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(sched.Policy(), got); diff != "" {
+		t.Errorf("persisted policy mismatch (-want +got):\n%s", diff)
+	}
+
+	d.stop()
+	if d.isDraining() {
+		t.Errorf("drainer is draining after stop")
+	}
+	if s := d.status(); s.Ready {
+		t.Errorf("status after stop = %+v; want not ready", s)
+	}
+}
+
+func TestDrainDeadline(t *testing.T) {
+	setDrainPollInterval(t, time.Millisecond)
+	builds := &fakeBuilds{names: []string{"linux-amd64 rev abc", "windows-amd64 rev abc"}}
+	d := &drainer{sched: schedule.NewScheduler(), store: &memStateStore{}, running: builds.running}
+	d.start(20 * time.Millisecond)
+	s := awaitDrainStatus(t, d, func(s DrainStatus) bool { return s.Ready })
+	if len(s.Running) != 2 {
+		t.Errorf("ready status = %+v; want the builds still running past the deadline", s)
+	}
+}
+
+func TestDrainPersistError(t *testing.T) {
+	setDrainPollInterval(t, time.Millisecond)
+	d := &drainer{sched: schedule.NewScheduler(), store: &memStateStore{err: errors.New("datastore is down")}, running: (&fakeBuilds{}).running}
+	d.start(time.Hour)
+	s := awaitDrainStatus(t, d, func(s DrainStatus) bool { return s.Error != "" })
+	if s.Ready || s.StatePersisted {
+		t.Errorf("status after failing to persist = %+v; want not ready", s)
+	}
+}
+
+func TestHandleDrain(t *testing.T) {
+	setDrainPollInterval(t, time.Millisecond)
+	key := []byte("secret")
+	d := &drainer{sched: schedule.NewScheduler(), running: (&fakeBuilds{}).running}
+	do := func(method, query string) (int, DrainStatus) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		handleDrain(d, key)(w, httptest.NewRequest(method, "/admin/drain"+query, nil))
+		var s DrainStatus
+		if w.Code == http.StatusOK {
+			if err := json.Unmarshal(w.Body.Bytes(), &s); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return w.Code, s
+	}
+
+	if code, _ := do("POST", "?key=wrong"); code != http.StatusForbidden {
+		t.Errorf("POST with the wrong key: status %d; want %d", code, http.StatusForbidden)
+	}
+	if code, _ := do("POST", "?key=secret&timeout=soon"); code != http.StatusBadRequest {
+		t.Errorf("POST with an invalid timeout: status %d; want %d", code, http.StatusBadRequest)
+	}
+	if code, _ := do("PUT", "?key=secret"); code != http.StatusMethodNotAllowed {
+		t.Errorf("PUT: status %d; want %d", code, http.StatusMethodNotAllowed)
+	}
+	if d.isDraining() {
+		t.Fatalf("bad requests started draining")
+	}
+	if code, s := do("POST", "?key=secret&timeout=10m"); code != http.StatusOK || !s.Draining {
+		t.Errorf("POST: status %d, %+v; want draining", code, s)
+	}
+	awaitDrainStatus(t, d, func(s DrainStatus) bool { return s.Ready })
+	if code, s := do("GET", "?key=secret"); code != http.StatusOK || !s.Ready || s.StatePersisted {
+		t.Errorf("GET: status %d, %+v; want ready, with no state persisted", code, s)
+	}
+	if code, s := do("DELETE", "?key=secret"); code != http.StatusOK || s.Draining {
+		t.Errorf("DELETE: status %d, %+v; want not draining", code, s)
+	}
+}
+
+func TestDrainStreamInterceptor(t *testing.T) {
+	d := &drainer{sched: schedule.NewScheduler(), running: (&fakeBuilds{names: []string{"b"}}).running}
+	intercept := drainStreamInterceptor(d)
+	handler := func(interface{}, grpc.ServerStream) error { return nil }
+	call := func(method string) error {
+		return intercept(nil, nil, &grpc.StreamServerInfo{FullMethod: method}, handler)
+	}
+	if err := call("/protos.GomoteService/CreateInstance"); err != nil {
+		t.Errorf("CreateInstance while not draining = %v; want success", err)
+	}
+	d.start(time.Hour)
+	defer d.stop()
+	if err := call("/protos.GomoteService/CreateInstance"); grpcstatus.Code(err) != codes.Unavailable {
+		t.Errorf("CreateInstance while draining = %v; want Unavailable", err)
+	}
+	if err := call("/protos.GomoteService/ReadTGZToURL"); err != nil {
+		t.Errorf("other call while draining = %v; want success", err)
+	}
+}
+
+func TestRestoreSchedulerState(t *testing.T) {
+	saved := schedule.NewScheduler()
+	p := saved.Policy()
+	p.UserGomoteInstances = map[string]int{"gopher": 5}
+	if err := saved.SetPolicy(p); err != nil {
+		t.Fatal(err)
+	}
+	store := &memStateStore{}
+	if err := saveSchedulerState(context.Background(), store, saved); err != nil {
+		t.Fatal(err)
+	}
+
+	sched := schedule.NewScheduler()
+	if err := restoreSchedulerState(context.Background(), store, sched); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(saved.Policy(), sched.Policy()); diff != "" {
+		t.Errorf("restored policy mismatch (-want +got):\n%s", diff)
+	}
+
+	// State from long ago isn't restored.
+	store.rec.Time = time.Now().Add(-2 * maxRestoredStateAge)
+	sched = schedule.NewScheduler()
+	if err := restoreSchedulerState(context.Background(), store, sched); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(schedule.NewScheduler().Policy(), sched.Policy()); diff != "" {
+		t.Errorf("policy after restoring old state mismatch (-want +got):\n%s", diff)
+	}
+
+	// Nor is missing state.
+	if err := restoreSchedulerState(context.Background(), &memStateStore{}, sched); err != nil {
+		t.Errorf("restoring missing state = %v; want no error", err)
+	}
+}
@@ -0,0 +1,325 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.16 && (linux || darwin)
+// +build go1.16
+// +build linux darwin
+
+package main
+
+// Integration builds test the tip of each x/ repo against Go tip and
+// the latest Go release once a week, even when neither has changed,
+// to catch bit rot in repos that rarely see new commits. Their results
+// aren't recorded on build.golang.org, which tracks commits, but are
+// shown on the /integration page instead.
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"golang.org/x/build/dashboard"
+	"golang.org/x/build/internal/buildgo"
+	"golang.org/x/build/maintner/maintnerd/apipb"
+	"golang.org/x/build/repos"
+)
+
+const (
+	// integrationDay and integrationHour are when integration
+	// builds start each week, in UTC. It's a quiet time for the
+	// builders.
+	integrationDay  = time.Saturday
+	integrationHour = 6
+
+	// maxIntegrationBuilds is the number of integration builds
+	// that may run at once, so that they don't crowd out
+	// post-submit builds.
+	maxIntegrationBuilds = 8
+
+	// keepIntegrationRuns is how many weeks of integration
+	// results to show.
+	keepIntegrationRuns = 4
+)
+
+var (
+	integrationMu   sync.Mutex
+	integrationRuns []*integrationRun // newest first
+)
+
+// An integrationRun is one week's set of integration builds.
+type integrationRun struct {
+	Start  time.Time
+	Builds []*integrationBuild // sorted by repo, Go branch, and builder
+}
+
+// An integrationBuild is the integration build of one x/ repo on one
+// builder against one Go revision.
+type integrationBuild struct {
+	buildgo.BuilderRev
+	GoBranch string // "master" or a release branch
+
+	mu      sync.Mutex // guards following
+	skipped bool       // the coordinator couldn't run the build
+	st      *buildStatus
+	logURL  string // set once the build is done
+	logErr  error  // set if the build is done but its log couldn't be saved
+}
+
+// State describes the state of b: "waiting", "skipped", "running",
+// "ok", "failed", "canceled", or "incomplete" if the build didn't
+// finish. A build whose log couldn't be saved failed, since its
+// result can't be checked.
+func (b *integrationBuild) State() string {
+	b.mu.Lock()
+	skipped, st, logURL, logErr := b.skipped, b.st, b.logURL, b.logErr
+	b.mu.Unlock()
+	if skipped {
+		return "skipped"
+	}
+	if st == nil {
+		return "waiting"
+	}
+	done := st.hasEvent(eventDone)
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	switch {
+	case st.canceled:
+		return "canceled"
+	case st.isRunningLocked():
+		return "running"
+	case logErr != nil:
+		return "failed"
+	case logURL == "":
+		return "running" // saving the log
+	case !done:
+		return "incomplete"
+	case st.succeeded:
+		return "ok"
+	}
+	return "failed"
+}
+
+// LogURL returns the URL of b's build log, or the empty string if it
+// isn't done.
+func (b *integrationBuild) LogURL() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.logURL
+}
+
+// LogError returns why b's build log couldn't be saved, or the empty
+// string if it was or the build isn't done.
+func (b *integrationBuild) LogError() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.logErr == nil {
+		return ""
+	}
+	return b.logErr.Error()
+}
+
+// An integrationGoRev is a Go revision to run integration builds
+// against.
+type integrationGoRev struct {
+	branch string
+	rev    string
+}
+
+// nextIntegrationRun returns the time after t at which the next
+// integration builds should start.
+func nextIntegrationRun(t time.Time) time.Time {
+	t = t.UTC()
+	next := time.Date(t.Year(), t.Month(), t.Day(), integrationHour, 0, 0, 0, time.UTC)
+	next = next.AddDate(0, 0, int(integrationDay-t.Weekday()+7)%7)
+	if !next.After(t) {
+		next = next.AddDate(0, 0, 7)
+	}
+	return next
+}
+
+// integrationLoop starts integration builds every week.
+func integrationLoop() {
+	for {
+		time.Sleep(time.Until(nextIntegrationRun(time.Now())))
+		if err := startIntegrationRun(); err != nil {
+			log.Printf("failed to start integration builds: %v", err)
+		}
+	}
+}
+
+// startIntegrationRun starts this week's integration builds.
+// They continue to run in the background after it returns.
+func startIntegrationRun() error {
+	goTip, err := getRepoHead("go")
+	if err != nil {
+		return err
+	}
+	goRevs := []integrationGoRev{{"master", goTip}}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	res, err := maintnerClient.ListGoReleases(ctx, &apipb.ListGoReleasesRequest{})
+	if err != nil {
+		return err
+	}
+	if rels := res.GetReleases(); len(rels) > 0 {
+		goRevs = append(goRevs, integrationGoRev{rels[0].GetBranchName(), rels[0].GetTagCommit()})
+	}
+
+	repoHeads := map[string]string{}
+	for proj, r := range repos.ByGerritProject {
+		if !isIntegrationRepo(proj, r) {
+			continue
+		}
+		head, err := getRepoHead(proj)
+		if err != nil {
+			log.Printf("integration: %v", err)
+			continue
+		}
+		repoHeads[proj] = head
+	}
+
+	run := &integrationRun{
+		Start:  time.Now(),
+		Builds: integrationBuilds(goRevs, repoHeads),
+	}
+	integrationMu.Lock()
+	integrationRuns = append([]*integrationRun{run}, integrationRuns...)
+	if len(integrationRuns) > keepIntegrationRuns {
+		integrationRuns = integrationRuns[:keepIntegrationRuns]
+	}
+	integrationMu.Unlock()
+
+	go run.build()
+	return nil
+}
+
+// isIntegrationRepo reports whether r, the repo for Gerrit project
+// proj, gets integration builds.
+func isIntegrationRepo(proj string, r *repos.Repo) bool {
+	return proj != "go" && r.CoordinatorCanBuild && r.ImportPath != "" && r.ShowOnDashboard()
+}
+
+// integrationBuilds returns the integration builds of the repos in
+// repoHeads, which maps Gerrit projects to the revisions to test,
+// against each of goRevs. Each repo is built on its TryBot builders.
+func integrationBuilds(goRevs []integrationGoRev, repoHeads map[string]string) []*integrationBuild {
+	var builds []*integrationBuild
+	for proj, head := range repoHeads {
+		for _, g := range goRevs {
+			for _, conf := range dashboard.TryBuildersForProject(proj, "master", g.branch) {
+				builds = append(builds, &integrationBuild{
+					BuilderRev: buildgo.BuilderRev{
+						Name:    conf.Name,
+						Rev:     g.rev,
+						SubName: proj,
+						SubRev:  head,
+					},
+					GoBranch: g.branch,
+				})
+			}
+		}
+	}
+	sort.Slice(builds, func(i, j int) bool {
+		bi, bj := builds[i], builds[j]
+		if bi.SubName != bj.SubName {
+			return bi.SubName < bj.SubName
+		}
+		if bi.GoBranch != bj.GoBranch {
+			return bi.GoBranch == "master"
+		}
+		return bi.Name < bj.Name
+	})
+	return builds
+}
+
+// build runs the builds in run, at most maxIntegrationBuilds at a time.
+func (run *integrationRun) build() {
+	sem := make(chan struct{}, maxIntegrationBuilds)
+	for _, b := range run.Builds {
+		sem <- struct{}{}
+		go func(b *integrationBuild) {
+			defer func() { <-sem }()
+			b.build()
+		}(b)
+	}
+}
+
+// build runs b and waits for it to finish.
+func (b *integrationBuild) build() {
+	if !mayBuildRev(b.BuilderRev) {
+		b.mu.Lock()
+		b.skipped = true
+		b.mu.Unlock()
+		return
+	}
+	st, err := newBuild(b.BuilderRev, commitDetail{RevBranch: b.GoBranch, SubRevBranch: "master"})
+	if err != nil {
+		log.Printf("integration: bad build params %v: %v", b.BuilderRev, err)
+		b.mu.Lock()
+		b.skipped = true
+		b.mu.Unlock()
+		return
+	}
+	st.integration = true
+	b.mu.Lock()
+	b.st = st
+	b.mu.Unlock()
+	st.start()
+	<-st.ctx.Done()
+
+	objName := fmt.Sprintf("integration/%s/%s/%s-%s_%s.log", b.SubName, b.SubRev[:8], b.GoBranch, b.Rev[:8], b.Name)
+	logURL, err := st.saveLog(objName)
+	if err != nil {
+		log.Printf("Failed to write to GCS: %v", err)
+		b.mu.Lock()
+		b.logErr = fmt.Errorf("saving build log: %v", err)
+		b.mu.Unlock()
+		return
+	}
+	st.mu.Lock()
+	st.logURL = logURL
+	st.mu.Unlock()
+	b.mu.Lock()
+	b.logURL = logURL
+	b.mu.Unlock()
+}
+
+//go:embed templates/integration.html
+var integrationTmplStr string
+
+var integrationTmpl = template.Must(baseTmpl.New("integration.html").Funcs(template.FuncMap{
+	"shortSHA": func(rev string) string {
+		if len(rev) > 8 {
+			return rev[:8]
+		}
+		return rev
+	},
+}).Parse(integrationTmplStr))
+
+func handleIntegration(w http.ResponseWriter, r *http.Request) {
+	integrationMu.Lock()
+	data := struct {
+		Runs []*integrationRun
+		Next time.Time
+	}{
+		Runs: integrationRuns,
+		Next: nextIntegrationRun(time.Now()),
+	}
+	integrationMu.Unlock()
+
+	var buf bytes.Buffer
+	if err := integrationTmpl.Execute(&buf, data); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	buf.WriteTo(w)
+}
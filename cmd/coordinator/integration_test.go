@@ -0,0 +1,116 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.16 && (linux || darwin)
+// +build go1.16
+// +build linux darwin
+
+package main
+
+import (
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/build/dashboard"
+	"golang.org/x/build/internal/buildgo"
+	"golang.org/x/build/repos"
+)
+
+func TestNextIntegrationRun(t *testing.T) {
+	for _, tc := range []struct {
+		now, want string
+	}{
+		{"2023-04-12T10:00:00Z", "2023-04-15T06:00:00Z"},      // Wednesday
+		{"2023-04-15T05:59:59Z", "2023-04-15T06:00:00Z"},      // Saturday, before the run
+		{"2023-04-15T06:00:00Z", "2023-04-22T06:00:00Z"},      // Saturday, at the run
+		{"2023-04-16T00:00:00Z", "2023-04-22T06:00:00Z"},      // Sunday
+		{"2023-04-14T23:00:00-05:00", "2023-04-15T06:00:00Z"}, // Saturday in UTC
+	} {
+		now, err := time.Parse(time.RFC3339, tc.now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := nextIntegrationRun(now).Format(time.RFC3339); got != tc.want {
+			t.Errorf("nextIntegrationRun(%s) = %s, want %s", tc.now, got, tc.want)
+		}
+	}
+}
+
+func TestIntegrationBuilds(t *testing.T) {
+	goRevs := []integrationGoRev{{"release-branch.go1.20", "bbbbbbbbbb"}, {"master", "aaaaaaaaaa"}}
+	builds := integrationBuilds(goRevs, map[string]string{"net": "1111111111", "crypto": "2222222222"})
+
+	var want []string
+	for _, proj := range []string{"crypto", "net"} {
+		for _, branch := range []string{"master", "release-branch.go1.20"} {
+			for _, conf := range dashboard.TryBuildersForProject(proj, "master", branch) {
+				want = append(want, proj+" "+branch+" "+conf.Name)
+			}
+		}
+	}
+	if len(builds) != len(want) || len(want) == 0 {
+		t.Fatalf("got %d builds, want %d", len(builds), len(want))
+	}
+	for i, b := range builds {
+		if got := b.SubName + " " + b.GoBranch + " " + b.Name; got != want[i] {
+			t.Errorf("build %d is %s, want %s", i, got, want[i])
+		}
+		if (b.GoBranch == "master") != (b.Rev == "aaaaaaaaaa") {
+			t.Errorf("build %d has Go branch %s and revision %s", i, b.GoBranch, b.Rev)
+		}
+	}
+
+	if !isIntegrationRepo("net", repos.ByGerritProject["net"]) {
+		t.Errorf("isIntegrationRepo(net) = false, want true")
+	}
+	if isIntegrationRepo("go", repos.ByGerritProject["go"]) {
+		t.Errorf("isIntegrationRepo(go) = true, want false")
+	}
+}
+
+func TestIntegrationBuildState(t *testing.T) {
+	done := []eventAndTime{{evt: eventDone}}
+	for _, tc := range []struct {
+		desc string
+		b    *integrationBuild
+		want string
+	}{
+		{"waiting", &integrationBuild{}, "waiting"},
+		{"skipped", &integrationBuild{skipped: true}, "skipped"},
+		{"running", &integrationBuild{st: &buildStatus{}}, "running"},
+		{"saving log", &integrationBuild{st: &buildStatus{done: time.Now(), events: done, succeeded: true}}, "running"},
+		{"ok", &integrationBuild{st: &buildStatus{done: time.Now(), events: done, succeeded: true}, logURL: "https://example.com/log"}, "ok"},
+		{"failed", &integrationBuild{st: &buildStatus{done: time.Now(), events: done}, logURL: "https://example.com/log"}, "failed"},
+		{"log not saved", &integrationBuild{st: &buildStatus{done: time.Now(), events: done, succeeded: true}, logErr: errors.New("GCS is down")}, "failed"},
+		{"canceled", &integrationBuild{st: &buildStatus{done: time.Now(), canceled: true}, logErr: errors.New("GCS is down")}, "canceled"},
+	} {
+		if got := tc.b.State(); got != tc.want {
+			t.Errorf("%s: State() = %q, want %q", tc.desc, got, tc.want)
+		}
+	}
+}
+
+func TestHandleIntegration(t *testing.T) {
+	defer func(runs []*integrationRun) { integrationRuns = runs }(integrationRuns)
+	integrationRuns = []*integrationRun{{
+		Start: time.Date(2023, 4, 15, 6, 0, 0, 0, time.UTC),
+		Builds: []*integrationBuild{
+			{BuilderRev: buildgo.BuilderRev{Name: "linux-amd64", Rev: "aaaaaaaaaa", SubName: "net", SubRev: "1111111111"}, GoBranch: "master"},
+			{BuilderRev: buildgo.BuilderRev{Name: "linux-386", Rev: "aaaaaaaaaa", SubName: "net", SubRev: "1111111111"}, GoBranch: "master", skipped: true},
+			{BuilderRev: buildgo.BuilderRev{Name: "linux-arm64", Rev: "aaaaaaaaaa", SubName: "net", SubRev: "1111111111"}, GoBranch: "master",
+				st: &buildStatus{done: time.Now()}, logErr: errors.New("saving build log: GCS is down")},
+		},
+	}}
+	rec := httptest.NewRecorder()
+	handleIntegration(rec, httptest.NewRequest("GET", "/integration", nil))
+	body := rec.Body.String()
+	for _, want := range []string{"Sat, 15 Apr 2023 06:00 UTC", "linux-amd64", "11111111 / go aaaaaaaa", "waiting", "skipped", `<span title="saving build log: GCS is down">failed</span>`} {
+		if !strings.Contains(body, want) {
+			t.Errorf("/integration page doesn't contain %q:\n%s", want, body)
+		}
+	}
+}
@@ -0,0 +1,412 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.16
+// +build go1.16
+
+package legacydash
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/datastore"
+	"golang.org/x/build/maintner/maintnerd/apipb"
+	"golang.org/x/build/repos"
+)
+
+// Backfill, if non-nil, asks the coordinator to build revs on builder,
+// to fill in the results that bisection needs. It returns how many of
+// the builds it started.
+var Backfill func(builder string, revs []BackfillRev) int
+
+// A BackfillRev is a revision to build for bisection.
+type BackfillRev struct {
+	Repo   string // Gerrit project: "go", "net", ...
+	Branch string
+	Hash   string
+	GoHash string // Go commit to build Repo with, if it isn't "go"
+}
+
+const (
+	// defaultBisectCommits and maxBisectCommits are the default and
+	// maximum number of commits of history bisection looks through.
+	defaultBisectCommits = 200
+	maxBisectCommits     = 1000
+	// maxBackfillBuilds is the maximum number of builds one backfill
+	// request starts.
+	maxBackfillBuilds = 5
+)
+
+// States of a BisectCommit.
+const (
+	bisectOK           = "ok"            // the builder passed
+	bisectFail         = "fail"          // the builder failed the test
+	bisectOtherFailure = "other-failure" // the builder failed, but not the test
+	bisectUntested     = "untested"      // there's no result
+)
+
+// A BisectCommit is a commit of the history that bisection looks
+// through, and what its build result says about the failure.
+type BisectCommit struct {
+	Hash    string
+	GoHash  string `json:",omitempty"` // Go commit it was built with, if the repo isn't "go"
+	Title   string
+	Author  string
+	Time    time.Time
+	State   string // "ok", "fail", "other-failure", or "untested"
+	LogHash string `json:",omitempty"`
+}
+
+// A BisectResult reports where the newest failure of a builder, and
+// optionally a test, started in the history of a repo and branch.
+type BisectResult struct {
+	Builder string
+	Repo    string // Gerrit project
+	Branch  string
+	Test    string `json:",omitempty"` // test or package name; empty for any failure
+
+	Searched int // number of commits looked through
+
+	// FirstFailing is the oldest commit of the newest run of failures,
+	// and LastPassing the newest commit before it that passed. They
+	// are nil if there's no failure, or no pass before it, in the
+	// commits searched.
+	FirstFailing *BisectCommit
+	LastPassing  *BisectCommit
+	// Suspects are the commits between LastPassing and FirstFailing,
+	// newest first, whose results don't show whether they fail. The
+	// failure started at one of them or at FirstFailing.
+	Suspects []*BisectCommit
+	// Exact is whether FirstFailing is known to be the commit that
+	// the failure started at.
+	Exact bool
+
+	// Backfilled is the number of builds started by a backfill
+	// request.
+	Backfilled int `json:",omitempty"`
+}
+
+// bisect finds the newest run of failures in commits, which are ordered
+// newest first. The states of commits that failed are refined by fails,
+// which reports whether a failed commit failed in the test. It's only
+// called for the commits that bisection needs to look at, as it may
+// need to load logs.
+func bisect(commits []*BisectCommit, fails func(*BisectCommit) (bool, error)) (*BisectResult, error) {
+	res := &BisectResult{Searched: len(commits)}
+	var suspects []*BisectCommit
+	for _, c := range commits {
+		if c.State == bisectFail {
+			ok, err := fails(c)
+			if err != nil {
+				return nil, fmt.Errorf("checking the failure of %s: %v", c.Hash, err)
+			}
+			if !ok {
+				c.State = bisectOtherFailure
+			}
+		}
+		switch c.State {
+		case bisectFail:
+			res.FirstFailing = c
+			suspects = nil
+		case bisectOK:
+			if res.FirstFailing != nil {
+				res.LastPassing = c
+				res.Suspects = suspects
+				res.Exact = len(suspects) == 0
+				return res, nil
+			}
+		default:
+			if res.FirstFailing != nil {
+				suspects = append(suspects, c)
+			}
+		}
+	}
+	// No pass before the failure was found in the history searched.
+	res.Suspects = suspects
+	return res, nil
+}
+
+// backfillCandidates returns up to n of the untested suspects in
+// res to build, spread evenly between LastPassing and FirstFailing so
+// that their results narrow down the suspects the most.
+func backfillCandidates(res *BisectResult, n int) []*BisectCommit {
+	var untested []*BisectCommit
+	for _, c := range res.Suspects {
+		if c.State == bisectUntested {
+			untested = append(untested, c)
+		}
+	}
+	if len(untested) <= n {
+		return untested
+	}
+	cs := make([]*BisectCommit, n)
+	for i := range cs {
+		cs[i] = untested[(i+1)*len(untested)/(n+1)]
+	}
+	return cs
+}
+
+// logFailsTest reports whether the build log shows that test, a test
+// name or a package import path, failed. The failure of a test
+// includes those of its subtests.
+func logFailsTest(text []byte, test string) bool {
+	s := bufio.NewScanner(bytes.NewReader(text))
+	s.Buffer(nil, 1<<20)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if name, ok := strings.CutPrefix(line, "--- FAIL: "); ok {
+			name, _, _ = strings.Cut(name, " ")
+			if name == test || strings.HasPrefix(name, test+"/") {
+				return true
+			}
+			continue
+		}
+		if f := strings.Fields(line); len(f) >= 2 && f[0] == "FAIL" && f[1] == test {
+			return true
+		}
+	}
+	return false
+}
+
+// bisectHandler serves the bisection of the newest failure of a
+// builder on a repo and branch, as a page or, when the "format"
+// parameter is "json", as a BisectResult in a dashResponse.
+//
+// The builder, repo (a Gerrit project, "go" by default), branch
+// ("master" by default), test (a test or package name, or empty for
+// any failure), and commits (how much history to search) parameters
+// select what to bisect. When the history lacks the results to find
+// the exact commit, a POST with action "backfill" and the builder
+// master key asks the coordinator to build some of the suspects.
+func bisectHandler(w http.ResponseWriter, r *http.Request) {
+	jsonAPI := r.FormValue("format") == "json"
+	fail := func(code int, err error) {
+		if code == http.StatusInternalServerError {
+			log.Printf("bisect: %v", err)
+		}
+		if jsonAPI {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(code)
+			json.NewEncoder(w).Encode(dashResponse{Error: err.Error()})
+			return
+		}
+		http.Error(w, err.Error(), code)
+	}
+	backfill := false
+	switch r.Method {
+	case "GET", "HEAD":
+	case "POST":
+		if r.FormValue("action") != "backfill" {
+			fail(http.StatusBadRequest, errors.New("unknown action"))
+			return
+		}
+		if !isMasterKey(r.Context(), r.FormValue("key")) {
+			fail(http.StatusForbidden, errors.New("backfilling needs the builder master key"))
+			return
+		}
+		if Backfill == nil {
+			fail(http.StatusServiceUnavailable, errors.New("backfilling is not available"))
+			return
+		}
+		backfill = true
+	default:
+		fail(http.StatusMethodNotAllowed, errBadMethod(r.Method))
+		return
+	}
+
+	data := bisectPageData{
+		Builder: strings.TrimSpace(r.FormValue("builder")),
+		Repo:    strings.TrimSpace(r.FormValue("repo")),
+		Branch:  strings.TrimSpace(r.FormValue("branch")),
+		Test:    strings.TrimSpace(r.FormValue("test")),
+		Commits: defaultBisectCommits,
+	}
+	if data.Repo == "" {
+		data.Repo = "go"
+	}
+	if data.Branch == "" {
+		data.Branch = "master"
+	}
+	if s := r.FormValue("commits"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 || n > maxBisectCommits {
+			fail(http.StatusBadRequest, fmt.Errorf("commits must be a number between 1 and %d", maxBisectCommits))
+			return
+		}
+		data.Commits = n
+	}
+
+	if data.Builder != "" {
+		res, err := bisectRequest(r.Context(), data.Builder, data.Repo, data.Branch, data.Test, data.Commits)
+		if err != nil {
+			code := http.StatusInternalServerError
+			if errors.Is(err, errBadBisectRequest) {
+				code = http.StatusBadRequest
+			}
+			fail(code, err)
+			return
+		}
+		if backfill {
+			var revs []BackfillRev
+			for _, c := range backfillCandidates(res, maxBackfillBuilds) {
+				revs = append(revs, BackfillRev{Repo: res.Repo, Branch: res.Branch, Hash: c.Hash, GoHash: c.GoHash})
+			}
+			if len(revs) > 0 {
+				res.Backfilled = Backfill(res.Builder, revs)
+			}
+		}
+		data.Result = res
+		data.CanBackfill = Backfill != nil && len(backfillCandidates(res, 1)) > 0
+	} else if backfill {
+		fail(http.StatusBadRequest, errors.New("missing builder"))
+		return
+	}
+
+	if jsonAPI {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(dashResponse{Response: data.Result})
+		return
+	}
+	var buf bytes.Buffer
+	if err := bisectTemplate.Execute(&buf, data); err != nil {
+		fail(http.StatusInternalServerError, err)
+		return
+	}
+	buf.WriteTo(w)
+}
+
+// bisectPageData is the data of bisect.html.
+type bisectPageData struct {
+	Builder, Repo, Branch, Test string // the request
+	Commits                     int
+	Result                      *BisectResult // nil if no builder was given
+	CanBackfill                 bool
+}
+
+var errBadBisectRequest = errors.New("bad bisection request")
+
+// bisectRequest bisects the newest failure of test on builder in the
+// last n commits of repo and branch, using the results in datastore.
+func bisectRequest(ctx context.Context, builder, repo, branch, test string, n int) (*BisectResult, error) {
+	var importPath string
+	if repo != "go" {
+		r, ok := repos.ByGerritProject[repo]
+		if !ok || r.ImportPath == "" {
+			return nil, fmt.Errorf("%w: unknown repo %q", errBadBisectRequest, repo)
+		}
+		importPath = r.ImportPath
+	}
+	if isUntested(builder, repo, branch, "master") {
+		return nil, fmt.Errorf("%w: %s doesn't build %s on %s", errBadBisectRequest, builder, repo, branch)
+	}
+	dash, err := maintnerClient.GetDashboard(ctx, &apipb.DashboardRequest{
+		Repo:       importPath,
+		Branch:     branch,
+		MaxCommits: int32(n),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("maintner.GetDashboard: %v", err)
+	}
+	var keys []*datastore.Key
+	for _, dc := range dash.Commits {
+		keys = append(keys, (&Commit{PackagePath: importPath, Hash: dc.Commit}).Key())
+	}
+	dsCommits, err := fetchCommits(ctx, keys)
+	if err != nil {
+		return nil, fmt.Errorf("fetchCommits: %v", err)
+	}
+	byHash := make(map[string]*Commit)
+	for _, c := range dsCommits {
+		byHash[c.Hash] = c
+	}
+	commits := bisectCommits(dash.Commits, byHash, builder, importPath != "")
+
+	res, err := bisect(commits, func(c *BisectCommit) (bool, error) {
+		if test == "" {
+			return true, nil
+		}
+		if c.LogHash == "" {
+			return false, nil // can't tell
+		}
+		text, err := getLog(ctx, c.LogHash)
+		if err != nil {
+			return false, err
+		}
+		return logFailsTest(text, test), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	res.Builder, res.Repo, res.Branch, res.Test = builder, repo, branch, test
+	return res, nil
+}
+
+// bisectCommits returns the BisectCommits of the dashboard commits dcs,
+// with the results of builder from the datastore commits in byHash.
+// The results of x/ repos are those built with the Go commit at the
+// time of the commit, if any, or else the latest ones.
+func bisectCommits(dcs []*apipb.DashCommit, byHash map[string]*Commit, builder string, xRepo bool) []*BisectCommit {
+	var commits []*BisectCommit
+	for _, dc := range dcs {
+		c := &BisectCommit{
+			Hash:   dc.Commit,
+			Title:  dc.Title,
+			Author: formatGitAuthor(dc.AuthorName, dc.AuthorEmail),
+			Time:   time.Unix(dc.CommitTimeSec, 0).UTC(),
+			State:  bisectUntested,
+		}
+		if xRepo {
+			c.GoHash = dc.GoCommitAtTime
+			if c.GoHash == "" {
+				c.GoHash = dc.GoCommitLatest
+			}
+		}
+		var res *Result
+		if dsc := byHash[dc.Commit]; dsc != nil {
+			res = dsc.Result(builder, c.GoHash)
+			if res == nil && xRepo {
+				res = latestResult(dsc, builder)
+			}
+		}
+		if res != nil {
+			c.GoHash = res.GoHash
+			c.LogHash = res.LogHash
+			c.State = bisectFail
+			if res.OK {
+				c.State = bisectOK
+			}
+		}
+		commits = append(commits, c)
+	}
+	return commits
+}
+
+// latestResult returns the last result of builder recorded for c,
+// with any Go commit, or nil if there's none.
+func latestResult(c *Commit, builder string) *Result {
+	for i := len(c.ResultData) - 1; i >= 0; i-- {
+		p := strings.SplitN(c.ResultData[i], "|", 4)
+		if len(p) == 4 && p[0] == builder {
+			return partsToResult(c.Hash, c.PackagePath, p)
+		}
+	}
+	return nil
+}
+
+var bisectTemplate = template.Must(template.New("bisect.html").Funcs(tmplFuncs).Parse(bisectHTML))
+
+//go:embed bisect.html
+var bisectHTML string
@@ -0,0 +1,198 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.16
+// +build go1.16
+
+package legacydash
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.org/x/build/maintner/maintnerd/apipb"
+)
+
+// bisectHistory returns commits, newest first, whose states are given
+// by the letters of s: "o" is ok, "f" a failure in the test, "x" a
+// failure elsewhere, and "." untested. Their hashes are their indexes.
+func bisectHistory(s string) []*BisectCommit {
+	var commits []*BisectCommit
+	for i, r := range s {
+		c := &BisectCommit{Hash: string(rune('a' + i))}
+		switch r {
+		case 'o':
+			c.State = bisectOK
+		case 'f':
+			c.State, c.LogHash = bisectFail, "test"
+		case 'x':
+			c.State, c.LogHash = bisectFail, "other"
+		case '.':
+			c.State = bisectUntested
+		}
+		commits = append(commits, c)
+	}
+	return commits
+}
+
+func hashes(commits []*BisectCommit) string {
+	var s string
+	for _, c := range commits {
+		s += c.Hash
+	}
+	return s
+}
+
+func TestBisect(t *testing.T) {
+	for _, tt := range []struct {
+		history      string
+		firstFailing string // hash, or "" for nil
+		lastPassing  string
+		suspects     string
+		exact        bool
+	}{
+		{history: "ooo"},
+		{history: "...."},
+		{history: "fffoo", firstFailing: "c", lastPassing: "d", exact: true},
+		{history: "ofo", firstFailing: "b", lastPassing: "c", exact: true},
+		{history: "f..fo", firstFailing: "d", lastPassing: "e", exact: true},
+		{history: "ff..xo", firstFailing: "b", lastPassing: "f", suspects: "cde"},
+		{history: "..f.", firstFailing: "c", suspects: "d"},
+		{history: "oofxfooff", firstFailing: "e", lastPassing: "f", exact: true},
+	} {
+		var checked string
+		res, err := bisect(bisectHistory(tt.history), func(c *BisectCommit) (bool, error) {
+			checked += c.Hash
+			return c.LogHash == "test", nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := [3]string{hashes(res.Suspects)}
+		if res.FirstFailing != nil {
+			got[1] = res.FirstFailing.Hash
+		}
+		if res.LastPassing != nil {
+			got[2] = res.LastPassing.Hash
+		}
+		want := [3]string{tt.suspects, tt.firstFailing, tt.lastPassing}
+		if got != want || res.Exact != tt.exact {
+			t.Errorf("bisect(%q) = suspects %q, first failing %q, last passing %q, exact %v; want %q, %q, %q, %v",
+				tt.history, got[0], got[1], got[2], res.Exact, want[0], want[1], want[2], tt.exact)
+		}
+		if res.Searched != len(tt.history) {
+			t.Errorf("bisect(%q) searched %d commits; want %d", tt.history, res.Searched, len(tt.history))
+		}
+		// Failures older than the last pass don't need checking.
+		if tt.lastPassing != "" && strings.IndexFunc(checked, func(r rune) bool { return string(r) > tt.lastPassing }) >= 0 {
+			t.Errorf("bisect(%q) checked failures %q, some older than the last pass %q", tt.history, checked, tt.lastPassing)
+		}
+	}
+}
+
+func TestBackfillCandidates(t *testing.T) {
+	res := &BisectResult{Suspects: bisectHistory("..x......")}
+	for _, tt := range []struct {
+		n    int
+		want string
+	}{
+		{1, "f"},
+		{2, "dg"},
+		{10, "abdefghi"},
+	} {
+		if got := hashes(backfillCandidates(res, tt.n)); got != tt.want {
+			t.Errorf("backfillCandidates(%d) = %q; want %q", tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestLogFailsTest(t *testing.T) {
+	const log = `##### Testing packages.
+ok  	archive/tar	0.3s
+--- FAIL: TestDial (0.01s)
+    dial_test.go:42: connection refused
+--- FAIL: TestServe/http2 (1.20s)
+FAIL
+FAIL	net	12.5s
+`
+	for _, tt := range []struct {
+		test string
+		want bool
+	}{
+		{"TestDial", true},
+		{"TestDia", false},
+		{"TestServe", true},
+		{"TestServe/http2", true},
+		{"TestServe/http", false},
+		{"net", true},
+		{"net/http", false},
+		{"archive/tar", false},
+	} {
+		if got := logFailsTest([]byte(log), tt.test); got != tt.want {
+			t.Errorf("logFailsTest(%q) = %v; want %v", tt.test, got, tt.want)
+		}
+	}
+}
+
+func TestBisectCommits(t *testing.T) {
+	dcs := []*apipb.DashCommit{
+		{Commit: "c3", Title: "net: fix", AuthorName: "Gopher", AuthorEmail: "gopher@golang.org", GoCommitAtTime: "g2"},
+		{Commit: "c2", AuthorName: "Gopher", AuthorEmail: "gopher@golang.org", GoCommitAtTime: "g2"},
+		{Commit: "c1", AuthorName: "Gopher", AuthorEmail: "gopher@golang.org", GoCommitLatest: "g2"},
+	}
+	byHash := map[string]*Commit{
+		"c3": {Hash: "c3", ResultData: []string{"linux-amd64|false|log3|g1", "linux-amd64|true||g2"}},
+		"c2": {Hash: "c2", ResultData: []string{"linux-amd64|false|log2a|g0", "linux-amd64|false|log2b|g1", "linux-386|true||g2"}},
+	}
+	var got []BisectCommit
+	for _, c := range bisectCommits(dcs, byHash, "linux-amd64", true) {
+		got = append(got, *c)
+	}
+	want := []BisectCommit{
+		{Hash: "c3", GoHash: "g2", Title: "net: fix", Author: "Gopher <gopher@golang.org>", State: bisectOK},
+		{Hash: "c2", GoHash: "g1", Author: "Gopher <gopher@golang.org>", State: bisectFail, LogHash: "log2b"},
+		{Hash: "c1", GoHash: "g2", Author: "Gopher <gopher@golang.org>", State: bisectUntested},
+	}
+	for i := range got {
+		got[i].Time = want[i].Time
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("bisectCommits mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestBisectTemplate(t *testing.T) {
+	history := bisectHistory("ff..o")
+	for _, res := range []*BisectResult{
+		nil,
+		{Builder: "linux-amd64", Repo: "go", Branch: "master", Searched: 5},
+		{Builder: "linux-amd64", Repo: "go", Branch: "master", Searched: 5, FirstFailing: history[1], Suspects: history[2:4], LastPassing: history[4], Backfilled: 2},
+		{Builder: "linux-amd64", Repo: "go", Branch: "master", Searched: 2, FirstFailing: history[1], Exact: true},
+	} {
+		data := bisectPageData{Builder: "linux-amd64", Commits: 5, Result: res, CanBackfill: true}
+		var buf bytes.Buffer
+		if err := bisectTemplate.Execute(&buf, data); err != nil {
+			t.Errorf("executing the template with %+v: %v", res, err)
+		}
+	}
+}
+
+func TestBisectHandlerBackfillKey(t *testing.T) {
+	masterKey = "secret"
+	t.Cleanup(func() { masterKey = "" })
+	for _, query := range []string{
+		"?action=backfill&builder=linux-amd64",
+		"?action=backfill&builder=linux-amd64&key=wrong",
+	} {
+		w := httptest.NewRecorder()
+		bisectHandler(w, httptest.NewRequest("POST", "/bisect"+query, nil))
+		if w.Code != http.StatusForbidden {
+			t.Errorf("POST %s: status %d; want %d", query, w.Code, http.StatusForbidden)
+		}
+	}
+}
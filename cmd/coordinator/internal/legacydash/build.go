@@ -18,6 +18,7 @@ import (
 	"math/rand"
 	pathpkg "path"
 	"strings"
+	"time"
 
 	"cloud.google.com/go/datastore"
 	"golang.org/x/build/dashboard"
@@ -409,6 +410,13 @@ type Result struct {
 	LogHash     string `datastore:",noindex"` // Key to the Log record.
 
 	RunTime int64 // time to build+test in nanoseconds
+
+	// Branch is the branch of the repo at Hash, and CommitTime and
+	// GoCommitTime the committer times of Hash and GoHash, for
+	// notifying subscriptions. They aren't stored.
+	Branch       string    `datastore:"-"`
+	CommitTime   time.Time `datastore:"-"`
+	GoCommitTime time.Time `datastore:"-"`
 }
 
 func (r *Result) Key() *datastore.Key {
@@ -39,6 +39,11 @@ var (
 	// The builder master key.
 	masterKey string
 
+	// ReleaseStatusURL, if non-empty, is the URL of the release status
+	// JSON published by relui. In-progress releases are shown at the
+	// top of the dashboard.
+	ReleaseStatusURL string
+
 	// TODO(golang.org/issue/38337): Keep moving away from package scope
 	// variables during future refactors.
 )
@@ -63,6 +68,7 @@ func Handler(dc *datastore.Client, mc apipb.MaintnerServiceClient, key string, g
 	// public handlers
 	mux.Handle("/", GRPCHandler(grpcServer, hstsGzip(http.HandlerFunc(uiHandler)))) // enables GRPC server for build.golang.org
 	mux.Handle("/log/", hstsGzip(http.HandlerFunc(logHandler)))
+	mux.Handle("/bisect", hstsGzip(http.HandlerFunc(bisectHandler)))
 
 	// static handler
 	fs := http.FileServer(http.FS(static))
@@ -18,6 +18,7 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 	"unicode/utf8"
 
 	"cloud.google.com/go/datastore"
@@ -76,38 +77,49 @@ func resultHandler(r *http.Request) (interface{}, error) {
 		}
 		return nil
 	}
-	_, err := datastoreClient.RunInTransaction(ctx, tx)
-	return nil, err
+	if _, err := datastoreClient.RunInTransaction(ctx, tx); err != nil {
+		return nil, err
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		if err := notifyResult(ctx, res); err != nil {
+			log.Printf("notifying subscribers of %s result for %s: %v", res.Builder, res.Hash, err)
+		}
+	}()
+	return nil, nil
 }
 
 // logHandler displays log text for a given hash.
 // It handles paths like "/log/hash".
 func logHandler(w http.ResponseWriter, r *http.Request) {
-	c := r.Context()
 	hash := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+	b, err := getLog(r.Context(), hash)
+	if err != nil {
+		log.Printf("Error: %v", err)
+		http.Error(w, "Error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-type", "text/plain; charset=utf-8")
+	w.Write(b)
+}
+
+// getLog returns the text of the log with the given hash.
+func getLog(ctx context.Context, hash string) ([]byte, error) {
 	key := dsKey("Log", hash, nil)
 	l := new(Log)
-	if err := datastoreClient.Get(c, key, l); err != nil {
+	if err := datastoreClient.Get(ctx, key, l); err != nil {
 		if err == datastore.ErrNoSuchEntity {
 			// Fall back to default namespace;
 			// maybe this was on the old dashboard.
 			key.Namespace = ""
-			err = datastoreClient.Get(c, key, l)
+			err = datastoreClient.Get(ctx, key, l)
 		}
 		if err != nil {
-			log.Printf("Error: %v", err)
-			http.Error(w, "Error: "+err.Error(), http.StatusInternalServerError)
-			return
+			return nil, err
 		}
 	}
-	b, err := l.Text()
-	if err != nil {
-		log.Printf("Error: %v", err)
-		http.Error(w, "Error: "+err.Error(), http.StatusInternalServerError)
-		return
-	}
-	w.Header().Set("Content-type", "text/plain; charset=utf-8")
-	w.Write(b)
+	return l.Text()
 }
 
 // clearResultsHandler purge a single build failure from the dashboard.
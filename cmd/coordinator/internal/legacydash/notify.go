@@ -0,0 +1,445 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.16
+// +build go1.16
+
+package legacydash
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"cloud.google.com/go/datastore"
+	"golang.org/x/build/dashboard"
+	"golang.org/x/build/internal/access"
+	"golang.org/x/build/repos"
+)
+
+// SendMail, if non-nil, sends a plain text email. Subscriptions that
+// notify by email can only be created if it's set.
+var SendMail func(to, subject, body string) error
+
+// maxSubscriptionsPerUser is the maximum number of subscriptions a
+// user may have.
+const maxSubscriptionsPerUser = 50
+
+// A Subscription asks for a notification when the results of a builder
+// for a repo and branch start failing, and when they pass again.
+// Empty Builder, Repo, and Branch fields match any value.
+//
+// Each Subscription entity is a root entity with a numeric ID.
+type Subscription struct {
+	ID      int64  `datastore:"-"`
+	Owner   string // email address of the user who created it
+	Builder string // "linux-amd64", ...
+	Repo    string // Gerrit project: "go", "net", ...
+	Branch  string // "master", "release-branch.go1.21", ...
+
+	Email   string `datastore:",noindex"` // address to mail, if any
+	Webhook string `datastore:",noindex"` // URL to POST a BuildEvent to, if any
+
+	Created time.Time
+}
+
+func (s *Subscription) matches(ev *BuildEvent) bool {
+	return (s.Builder == "" || s.Builder == ev.Builder) &&
+		(s.Repo == "" || s.Repo == ev.Repo) &&
+		(s.Branch == "" || s.Branch == ev.Branch)
+}
+
+// A BuildEvent is a change in the results of a builder for a repo and
+// branch. It is the body of the webhook requests of subscriptions.
+type BuildEvent struct {
+	Builder string
+	Repo    string // Gerrit project: "go", "net", ...
+	Branch  string
+	Hash    string // commit of Repo whose result changed
+	GoHash  string // Go commit it was built with, if Repo isn't "go"
+	OK      bool   // whether the builder passes again, rather than started failing
+	LogURL  string `json:",omitempty"` // log of the failure
+}
+
+func (ev *BuildEvent) summary() string {
+	if ev.OK {
+		return fmt.Sprintf("%s is passing again on %s (%s)", ev.Builder, ev.Repo, ev.Branch)
+	}
+	return fmt.Sprintf("%s is failing on %s (%s)", ev.Builder, ev.Repo, ev.Branch)
+}
+
+// builderState is the result of a builder for the latest commit of a
+// repo and branch, kept to notice when it changes.
+type builderState struct {
+	OK   bool
+	Hash string `datastore:",noindex"`
+
+	// CommitTime and GoCommitTime are those of the Result.
+	CommitTime   time.Time `datastore:",noindex"`
+	GoCommitTime time.Time `datastore:",noindex"`
+}
+
+// newerThan reports whether st is the state of a later commit than
+// res, which then doesn't change it: builds finish out of commit order,
+// and an old commit failing after a new one passed doesn't mean the
+// builder is broken. Results without commit times are never older.
+func (st *builderState) newerThan(res *Result) bool {
+	if res.CommitTime.IsZero() {
+		return false
+	}
+	if !st.CommitTime.Equal(res.CommitTime) {
+		return st.CommitTime.After(res.CommitTime)
+	}
+	return st.GoCommitTime.After(res.GoCommitTime)
+}
+
+func builderStateKey(builder, packagePath, branch string) *datastore.Key {
+	return dsKey("BuilderState", builder+"|"+packagePath+"|"+branch, nil)
+}
+
+// buildEvent returns the event that res is, given the previous result
+// of its builder for its repo and branch, or nil if it doesn't change
+// the state of the builder. A failure with no previous result is a
+// change, as the builder may be new.
+func buildEvent(res *Result, prev *builderState) *BuildEvent {
+	if prev == nil && res.OK || prev != nil && prev.OK == res.OK {
+		return nil
+	}
+	ev := &BuildEvent{
+		Builder: res.Builder,
+		Repo:    "go",
+		Branch:  res.Branch,
+		Hash:    res.Hash,
+		GoHash:  res.GoHash,
+		OK:      res.OK,
+	}
+	if res.PackagePath != "" {
+		ev.Repo = strings.TrimPrefix(res.PackagePath, "golang.org/x/")
+		if r, ok := repos.ByImportPath[res.PackagePath]; ok {
+			ev.Repo = r.GoGerritProject
+		}
+	}
+	if !res.OK && res.LogHash != "" {
+		ev.LogURL = "https://build.golang.org/log/" + res.LogHash
+	}
+	return ev
+}
+
+// notifyResult notifies the subscribers to the builder, repo, and
+// branch of res if its result differs from that of the latest commit
+// built before, unless res is of an earlier commit.
+func notifyResult(ctx context.Context, res *Result) error {
+	if res.Branch == "" {
+		// Sent by a coordinator that predates subscriptions.
+		return nil
+	}
+	var ev *BuildEvent
+	key := builderStateKey(res.Builder, res.PackagePath, res.Branch)
+	_, err := datastoreClient.RunInTransaction(ctx, func(tx *datastore.Transaction) error {
+		ev = nil
+		var prev *builderState
+		st := new(builderState)
+		if err := tx.Get(key, st); err == nil {
+			prev = st
+		} else if err != datastore.ErrNoSuchEntity {
+			return err
+		}
+		if prev != nil && prev.newerThan(res) {
+			return nil
+		}
+		ev = buildEvent(res, prev)
+		_, err := tx.Put(key, &builderState{OK: res.OK, Hash: res.Hash, CommitTime: res.CommitTime, GoCommitTime: res.GoCommitTime})
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("updating builder state: %v", err)
+	}
+	if ev == nil {
+		return nil
+	}
+	var subs []*Subscription
+	if _, err := getSubscriptions(ctx, datastore.NewQuery("Subscription").Namespace("Git"), &subs); err != nil {
+		return fmt.Errorf("getting subscriptions: %v", err)
+	}
+	var errs []error
+	for _, s := range subs {
+		if !s.matches(ev) {
+			continue
+		}
+		if err := deliver(ctx, s, ev); err != nil {
+			errs = append(errs, fmt.Errorf("subscription %d of %s: %v", s.ID, s.Owner, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// getSubscriptions runs q and sets the IDs of the subscriptions it
+// returns.
+func getSubscriptions(ctx context.Context, q *datastore.Query, subs *[]*Subscription) ([]*datastore.Key, error) {
+	keys, err := datastoreClient.GetAll(ctx, q, subs)
+	if err != nil {
+		return nil, err
+	}
+	for i, k := range keys {
+		(*subs)[i].ID = k.ID
+	}
+	return keys, nil
+}
+
+// deliver sends the notification of ev for s.
+func deliver(ctx context.Context, s *Subscription, ev *BuildEvent) error {
+	if s.Email != "" && SendMail != nil {
+		if err := SendMail(s.Email, ev.summary(), mailBody(ev)); err != nil {
+			return err
+		}
+	}
+	if s.Webhook != "" {
+		body, err := json.Marshal(ev)
+		if err != nil {
+			return err
+		}
+		ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		defer cancel()
+		req, err := http.NewRequestWithContext(ctx, "POST", s.Webhook, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := webhookClient.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode/100 != 2 {
+			return fmt.Errorf("webhook responded %v", resp.Status)
+		}
+	}
+	return nil
+}
+
+// webhookClient is the HTTP client of subscription webhooks, whose
+// URLs anyone can choose. It only connects to public addresses and
+// doesn't follow redirects, so webhooks can't reach the coordinator's
+// internal network or the metadata server.
+var webhookClient = &http.Client{
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout: 10 * time.Second,
+			Control: func(network, address string, _ syscall.RawConn) error {
+				host, _, err := net.SplitHostPort(address)
+				if err != nil {
+					return err
+				}
+				if ip := net.ParseIP(host); ip == nil || !isPublicIP(ip) {
+					return fmt.Errorf("webhook address %s is not public", host)
+				}
+				return nil
+			},
+		}).DialContext,
+		TLSHandshakeTimeout: 10 * time.Second,
+	},
+	CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// isPublicIP reports whether ip is a globally routable unicast
+// address, unlike loopback, private, and link-local ones, which
+// include the metadata server's 169.254.169.254.
+func isPublicIP(ip net.IP) bool {
+	return ip.IsGlobalUnicast() && !ip.IsPrivate() && !ip.IsLinkLocalUnicast()
+}
+
+func mailBody(ev *BuildEvent) string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%s at commit %s", ev.summary(), ev.Hash)
+	if ev.GoHash != "" {
+		fmt.Fprintf(&buf, " with Go commit %s", ev.GoHash)
+	}
+	buf.WriteString(".\n")
+	if ev.LogURL != "" {
+		fmt.Fprintf(&buf, "\nLog: %s\n", ev.LogURL)
+	}
+	fmt.Fprintf(&buf, "\nDashboard: https://build.golang.org/\n")
+	buf.WriteString("\nYou are receiving this because you subscribed to notifications for this builder.\n")
+	return buf.String()
+}
+
+// SubscriptionsHandler returns a handler that lets users list, create,
+// and delete their subscriptions, with a page or, when the "format"
+// parameter is "json", a JSON API. It must run behind Identity Aware
+// Proxy, which identifies the users.
+//
+// GET lists the subscriptions of the user. POST creates one from the
+// builder, repo, branch, email ("true" to mail the user), and webhook
+// parameters, or, with an "id" parameter and action "delete", deletes
+// one.
+func SubscriptionsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		iap, err := access.IAPFromContext(r.Context())
+		if err != nil {
+			http.Error(w, "not authenticated", http.StatusUnauthorized)
+			return
+		}
+		user := iap.Email
+		if i := strings.LastIndex(user, ":"); i >= 0 {
+			user = user[i+1:] // "accounts.google.com:gopher@golang.org"
+		}
+		jsonAPI := r.FormValue("format") == "json"
+		fail := func(code int, err error) {
+			if code == http.StatusInternalServerError {
+				log.Printf("subscriptions of %s: %v", user, err)
+			}
+			if jsonAPI {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(code)
+				json.NewEncoder(w).Encode(dashResponse{Error: err.Error()})
+				return
+			}
+			http.Error(w, err.Error(), code)
+		}
+
+		ctx := r.Context()
+		var subs []*Subscription
+		keys, err := getSubscriptions(ctx, datastore.NewQuery("Subscription").Namespace("Git").Filter("Owner =", user), &subs)
+		if err != nil {
+			fail(http.StatusInternalServerError, err)
+			return
+		}
+		switch r.Method {
+		case "GET":
+		case "POST":
+			var resp interface{}
+			if r.FormValue("action") == "delete" {
+				id, _ := strconv.ParseInt(r.FormValue("id"), 10, 64)
+				i := subscriptionIndex(subs, id)
+				if i < 0 {
+					fail(http.StatusNotFound, fmt.Errorf("no subscription %q", r.FormValue("id")))
+					return
+				}
+				if err := datastoreClient.Delete(ctx, keys[i]); err != nil {
+					fail(http.StatusInternalServerError, err)
+					return
+				}
+				subs = append(subs[:i], subs[i+1:]...)
+			} else {
+				if len(subs) >= maxSubscriptionsPerUser {
+					fail(http.StatusBadRequest, fmt.Errorf("users may have at most %d subscriptions", maxSubscriptionsPerUser))
+					return
+				}
+				s, err := newSubscription(user, r.Form)
+				if err != nil {
+					fail(http.StatusBadRequest, err)
+					return
+				}
+				k := datastore.IncompleteKey("Subscription", nil)
+				k.Namespace = "Git"
+				k, err = datastoreClient.Put(ctx, k, s)
+				if err != nil {
+					fail(http.StatusInternalServerError, err)
+					return
+				}
+				s.ID = k.ID
+				subs = append(subs, s)
+				resp = s
+			}
+			if !jsonAPI {
+				http.Redirect(w, r, r.URL.Path, http.StatusSeeOther)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(dashResponse{Response: resp})
+			return
+		default:
+			fail(http.StatusMethodNotAllowed, errBadMethod(r.Method))
+			return
+		}
+
+		sort.Slice(subs, func(i, j int) bool { return subs[i].Created.Before(subs[j].Created) })
+		if jsonAPI {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(dashResponse{Response: subs})
+			return
+		}
+		var buf bytes.Buffer
+		data := struct {
+			User          string
+			Subscriptions []*Subscription
+			CanMail       bool
+		}{user, subs, SendMail != nil}
+		if err := subscriptionsTemplate.Execute(&buf, data); err != nil {
+			fail(http.StatusInternalServerError, err)
+			return
+		}
+		buf.WriteTo(w)
+	})
+}
+
+func subscriptionIndex(subs []*Subscription, id int64) int {
+	for i, s := range subs {
+		if s.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// newSubscription returns the subscription of user described by form.
+func newSubscription(user string, form url.Values) (*Subscription, error) {
+	s := &Subscription{
+		Owner:   user,
+		Builder: strings.TrimSpace(form.Get("builder")),
+		Repo:    strings.TrimSpace(form.Get("repo")),
+		Branch:  strings.TrimSpace(form.Get("branch")),
+		Webhook: strings.TrimSpace(form.Get("webhook")),
+		Created: time.Now(),
+	}
+	if form.Get("email") == "true" || form.Get("email") == "on" {
+		if SendMail == nil {
+			return nil, errors.New("email notifications are not available")
+		}
+		s.Email = user
+	}
+	if s.Email == "" && s.Webhook == "" {
+		return nil, errors.New("subscription needs an email or a webhook to notify")
+	}
+	if s.Builder != "" {
+		if _, ok := dashboard.Builders[s.Builder]; !ok {
+			return nil, fmt.Errorf("unknown builder %q", s.Builder)
+		}
+	}
+	if s.Repo != "" {
+		if _, ok := repos.ByGerritProject[s.Repo]; !ok {
+			return nil, fmt.Errorf("unknown repo %q", s.Repo)
+		}
+	}
+	if s.Builder == "" && s.Repo == "" {
+		return nil, errors.New("subscription needs a builder or a repo")
+	}
+	if s.Webhook != "" {
+		u, err := url.Parse(s.Webhook)
+		if err != nil || u.Scheme != "https" || u.Host == "" {
+			return nil, fmt.Errorf("webhook %q is not an https URL", s.Webhook)
+		}
+	}
+	return s, nil
+}
+
+var subscriptionsTemplate = template.Must(template.New("subscriptions.html").Parse(subscriptionsHTML))
+
+//go:embed subscriptions.html
+var subscriptionsHTML string
@@ -0,0 +1,174 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.16
+// +build go1.16
+
+package legacydash
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestBuildEvent(t *testing.T) {
+	pass := &builderState{OK: true}
+	fail := &builderState{OK: false}
+	goResult := func(ok bool) *Result {
+		return &Result{Builder: "linux-amd64", Hash: "abc", Branch: "master", OK: ok, LogHash: "log"}
+	}
+	tests := []struct {
+		name string
+		res  *Result
+		prev *builderState
+		want *BuildEvent
+	}{
+		{"first pass", goResult(true), nil, nil},
+		{"still passing", goResult(true), pass, nil},
+		{"still failing", goResult(false), fail, nil},
+		{
+			name: "first failure",
+			res:  goResult(false),
+			want: &BuildEvent{Builder: "linux-amd64", Repo: "go", Branch: "master", Hash: "abc", LogURL: "https://build.golang.org/log/log"},
+		},
+		{
+			name: "broken",
+			res:  goResult(false),
+			prev: pass,
+			want: &BuildEvent{Builder: "linux-amd64", Repo: "go", Branch: "master", Hash: "abc", LogURL: "https://build.golang.org/log/log"},
+		},
+		{
+			name: "fixed",
+			res:  goResult(true),
+			prev: fail,
+			want: &BuildEvent{Builder: "linux-amd64", Repo: "go", Branch: "master", Hash: "abc", OK: true},
+		},
+		{
+			name: "subrepo",
+			res:  &Result{Builder: "linux-amd64", PackagePath: "golang.org/x/net", Hash: "def", GoHash: "abc", Branch: "master"},
+			prev: pass,
+			want: &BuildEvent{Builder: "linux-amd64", Repo: "net", Branch: "master", Hash: "def", GoHash: "abc"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := buildEvent(tt.res, tt.prev)
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("buildEvent mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestBuilderStateNewerThan(t *testing.T) {
+	t0 := time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC)
+	t1 := t0.Add(time.Hour)
+	st := &builderState{CommitTime: t1, GoCommitTime: t1}
+	tests := []struct {
+		name string
+		res  *Result
+		want bool
+	}{
+		{"earlier commit", &Result{CommitTime: t0, GoCommitTime: t1}, true},
+		{"later commit", &Result{CommitTime: t1.Add(time.Hour), GoCommitTime: t0}, false},
+		{"earlier Go commit", &Result{CommitTime: t1, GoCommitTime: t0}, true},
+		{"same commits", &Result{CommitTime: t1, GoCommitTime: t1}, false},
+		{"no commit time", &Result{}, false},
+	}
+	for _, tt := range tests {
+		if got := st.newerThan(tt.res); got != tt.want {
+			t.Errorf("%s: newerThan = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestWebhookClient(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer s.Close()
+	if resp, err := webhookClient.Post(s.URL, "application/json", nil); err == nil {
+		resp.Body.Close()
+		t.Errorf("webhook request to loopback server %s succeeded, want error", s.URL)
+	}
+	for ip, want := range map[string]bool{
+		"8.8.8.8":         true,
+		"2001:4860::8888": true,
+		"127.0.0.1":       false,
+		"10.0.0.1":        false,
+		"169.254.169.254": false,
+		"fd00::1":         false,
+		"::1":             false,
+		"0.0.0.0":         false,
+	} {
+		if got := isPublicIP(net.ParseIP(ip)); got != want {
+			t.Errorf("isPublicIP(%s) = %v, want %v", ip, got, want)
+		}
+	}
+}
+
+func TestSubscriptionMatches(t *testing.T) {
+	ev := &BuildEvent{Builder: "linux-amd64", Repo: "net", Branch: "master"}
+	tests := []struct {
+		sub  Subscription
+		want bool
+	}{
+		{Subscription{Builder: "linux-amd64"}, true},
+		{Subscription{Repo: "net"}, true},
+		{Subscription{Builder: "linux-amd64", Repo: "net", Branch: "master"}, true},
+		{Subscription{Builder: "linux-386"}, false},
+		{Subscription{Builder: "linux-amd64", Repo: "go"}, false},
+		{Subscription{Repo: "net", Branch: "release-branch.go1.21"}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.sub.matches(ev); got != tt.want {
+			t.Errorf("%+v.matches(%+v) = %v, want %v", tt.sub, ev, got, tt.want)
+		}
+	}
+}
+
+func TestNewSubscription(t *testing.T) {
+	defer func(f func(to, subject, body string) error) { SendMail = f }(SendMail)
+	SendMail = func(to, subject, body string) error { return nil }
+
+	s, err := newSubscription("gopher@golang.org", url.Values{"builder": {"linux-amd64"}, "email": {"true"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Owner != "gopher@golang.org" || s.Email != "gopher@golang.org" || s.Builder != "linux-amd64" {
+		t.Errorf("newSubscription = %+v, want one mailing its owner about linux-amd64", s)
+	}
+
+	for _, form := range []url.Values{
+		{"builder": {"linux-amd64"}},
+		{"email": {"true"}},
+		{"builder": {"no-such-builder"}, "email": {"true"}},
+		{"repo": {"no-such-repo"}, "email": {"true"}},
+		{"repo": {"net"}, "webhook": {"http://example.com/hook"}},
+	} {
+		if s, err := newSubscription("gopher@golang.org", form); err == nil {
+			t.Errorf("newSubscription(%v) = %+v, want error", form, s)
+		}
+	}
+
+	SendMail = nil
+	if _, err := newSubscription("gopher@golang.org", url.Values{"repo": {"net"}, "email": {"true"}}); err == nil {
+		t.Errorf("newSubscription with email but no SendMail succeeded")
+	}
+}
+
+func TestMailBody(t *testing.T) {
+	ev := &BuildEvent{Builder: "linux-amd64", Repo: "net", Branch: "master", Hash: "def", GoHash: "abc", LogURL: "https://build.golang.org/log/log"}
+	body := mailBody(ev)
+	for _, want := range []string{"linux-amd64 is failing on net (master) at commit def with Go commit abc.", ev.LogURL} {
+		if !strings.Contains(body, want) {
+			t.Errorf("mailBody = %q, want it to contain %q", body, want)
+		}
+	}
+}
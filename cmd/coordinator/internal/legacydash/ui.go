@@ -25,6 +25,7 @@ import (
 
 	"cloud.google.com/go/datastore"
 	"golang.org/x/build/dashboard"
+	"golang.org/x/build/internal/releasestatus"
 	"golang.org/x/build/internal/releasetargets"
 	"golang.org/x/build/maintner/maintnerd/apipb"
 	"golang.org/x/build/repos"
@@ -64,6 +65,10 @@ func uiHandler(w http.ResponseWriter, r *http.Request) {
 			tb.activeBuilds = getActiveBuilds(ctx)
 			return nil
 		})
+		rpcs.Go(func() error {
+			tb.releaseStatus = releasestatus.Get(ctx, ReleaseStatusURL)
+			return nil
+		})
 	}
 	if err := rpcs.Wait(); err != nil {
 		http.Error(w, "maintner.GetDashboard: "+err.Error(), httpStatusOfErr(err))
@@ -117,6 +122,8 @@ type uiTemplateDataBuilder struct {
 	req          *apipb.DashboardRequest
 	res          *apipb.DashboardResponse
 	activeBuilds []types.ActivePostSubmitBuild // optional; for blue gopher links
+	// releaseStatus is the status of in-progress releases. Optional.
+	releaseStatus *types.ReleaseStatus
 
 	// testCommitData, if non-nil, provides an alternate data
 	// source to use for testing instead of making real datastore
@@ -371,6 +378,9 @@ func (tb *uiTemplateDataBuilder) buildTemplateData(ctx context.Context) (*uiTemp
 	if tb.view.ShowsActiveBuilds() {
 		// Populate building URLs for the HTML UI only.
 		data.populateBuildingURLs(ctx, tb.activeBuilds)
+		if tb.releaseStatus != nil {
+			data.Releases = tb.releaseStatus.Workflows
+		}
 	}
 
 	return data, nil
@@ -732,6 +742,8 @@ type uiTemplateData struct {
 	Branches   []string
 	Branch     string
 	Repo       string // the repo gerrit project name. "go" if unspecified in the request.
+
+	Releases []types.ReleaseWorkflowStatus // in-progress release workflows, if known
 }
 
 // getActiveBuilds returns the builds that coordinator is currently doing.
@@ -0,0 +1,596 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.16 && (linux || darwin)
+// +build go1.16
+// +build linux darwin
+
+// Code related to streaming build logs to GCS as builds run.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"golang.org/x/build/livelog"
+)
+
+var (
+	// logChunkSize is how much unflushed output a logStream holds
+	// before it appends it to the store.
+	logChunkSize = 256 << 10
+
+	// logFlushInterval is how often a logStream appends its unflushed
+	// output to the store, however little there is.
+	logFlushInterval = 15 * time.Second
+)
+
+// maxLogComponents is the component count at which gcsLogStore
+// rewrites a log as a single object. Each append adds a component,
+// and GCS refuses to compose objects of more than 1024.
+const maxLogComponents = 1000
+
+// maxStreamedLogSize is the most output a logStream keeps; later
+// writes are dropped.
+const maxStreamedLogSize = 64 << 20
+
+const logTruncationMessage = "\n\n... log truncated ...\n"
+
+// buildLogStore is where build logs are streamed, or nil if they're
+// buffered in memory and uploaded once builds finish.
+var buildLogStore logStore
+
+// A logStore stores streamed build logs.
+type logStore interface {
+	// Append appends data to the named log, whose size is off.
+	// If off is 0, it creates the log.
+	Append(ctx context.Context, name string, off int64, data []byte) error
+	// NewRangeReader reads length bytes of the named log starting at
+	// off. If length is negative, it reads to the end of the log.
+	NewRangeReader(ctx context.Context, name string, off, length int64) (io.ReadCloser, error)
+	// Size returns the size of the named log. If there's no such log,
+	// the error is fs.ErrNotExist.
+	Size(ctx context.Context, name string) (int64, error)
+	// URL returns the permanent, public URL of the named log.
+	URL(name string) string
+}
+
+// gcsLogStore is a logStore in a GCS bucket. A log is appended to by
+// writing the new data to a temporary object and composing the log
+// from itself and that object. Once the log has maxLogComponents
+// components, it's compacted by rewriting it whole.
+type gcsLogStore struct {
+	client *storage.Client
+	bucket string
+}
+
+func (s *gcsLogStore) Append(ctx context.Context, name string, off int64, data []byte) error {
+	obj := s.client.Bucket(s.bucket).Object(name)
+	if off == 0 {
+		return s.write(ctx, obj, data)
+	}
+	part := s.client.Bucket(s.bucket).Object(fmt.Sprintf("%s.part%d", name, off))
+	if err := s.write(ctx, part, data); err != nil {
+		return err
+	}
+	defer func() {
+		if err := part.Delete(ctx); err != nil {
+			log.Printf("deleting streamed log part %s: %v", part.ObjectName(), err)
+		}
+	}()
+	c := obj.ComposerFrom(obj, part)
+	c.ContentType = "text/plain; charset=utf-8"
+	attrs, err := c.Run(ctx)
+	if err != nil {
+		return err
+	}
+	if attrs.ComponentCount >= maxLogComponents {
+		return s.compact(ctx, obj)
+	}
+	return nil
+}
+
+// compact rewrites the composite object obj as a single object, so it
+// can be composed further.
+func (s *gcsLogStore) compact(ctx context.Context, obj *storage.ObjectHandle) error {
+	r, err := obj.NewReader(ctx)
+	if err != nil {
+		return err
+	}
+	data, err := io.ReadAll(r)
+	r.Close()
+	if err != nil {
+		return err
+	}
+	return s.write(ctx, obj, data)
+}
+
+func (s *gcsLogStore) write(ctx context.Context, obj *storage.ObjectHandle, data []byte) error {
+	wr := obj.NewWriter(ctx)
+	wr.ContentType = "text/plain; charset=utf-8"
+	if _, err := wr.Write(data); err != nil {
+		wr.Close()
+		return err
+	}
+	return wr.Close()
+}
+
+func (s *gcsLogStore) NewRangeReader(ctx context.Context, name string, off, length int64) (io.ReadCloser, error) {
+	return s.client.Bucket(s.bucket).Object(name).NewRangeReader(ctx, off, length)
+}
+
+func (s *gcsLogStore) Size(ctx context.Context, name string) (int64, error) {
+	attrs, err := s.client.Bucket(s.bucket).Object(name).Attrs(ctx)
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return 0, fs.ErrNotExist
+	} else if err != nil {
+		return 0, err
+	}
+	return attrs.Size, nil
+}
+
+func (s *gcsLogStore) URL(name string) string {
+	return fmt.Sprintf("https://storage.googleapis.com/%s/%s", s.bucket, name)
+}
+
+var (
+	liveLogsMu sync.Mutex
+	liveLogs   = map[string]*logStream{} // by name; streams with a running flushLoop
+)
+
+// A logStream is the output of a build, streamed to a logStore as
+// the build runs. Only the output that hasn't been appended to the
+// store yet is kept in memory.
+//
+// Like livelog.Buffer, which it replaces for streamed builds, it may
+// be read by many Readers while it's written to.
+type logStream struct {
+	store logStore
+	name  string
+	kick  chan struct{} // wakes flushLoop early
+	done  chan struct{} // closed when flushLoop returns
+
+	mu      sync.Mutex
+	cond    *sync.Cond // broadcast when the log grows or is closed
+	flushed int64      // bytes in the store
+	pending []byte     // bytes written after the first flushed
+	created bool       // whether the log exists in the store
+	started bool       // whether flushLoop was started
+	closed  bool
+	err     error // the last error appending to the store
+}
+
+func newLogStream(store logStore, name string) *logStream {
+	s := &logStream{
+		store: store,
+		name:  name,
+		kick:  make(chan struct{}, 1),
+		done:  make(chan struct{}),
+	}
+	s.cond = sync.NewCond(&s.mu)
+	return s
+}
+
+// URL returns the permanent URL of the log. It's complete once Wait
+// returns nil.
+func (s *logStream) URL() string { return s.store.URL(s.name) }
+
+// Write appends p to the log. It doesn't wait for p to be stored.
+func (s *logStream) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := len(p)
+	if s.closed {
+		return n, nil
+	}
+	size := s.flushed + int64(len(s.pending))
+	if size >= maxStreamedLogSize {
+		// Already truncated.
+		return n, nil
+	}
+	if room := maxStreamedLogSize - int64(len(logTruncationMessage)) - size; int64(len(p)) > room {
+		p = append(p[:room:room], logTruncationMessage...)
+	}
+	s.pending = append(s.pending, p...)
+	s.startLocked()
+	if len(s.pending) >= logChunkSize {
+		s.wake()
+	}
+	s.cond.Broadcast()
+	return n, nil
+}
+
+// Close marks the end of the log. The rest of it is stored
+// asynchronously; see Wait.
+func (s *logStream) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	s.startLocked()
+	s.wake()
+	s.cond.Broadcast()
+	return nil
+}
+
+// Wait waits for the closed log to be stored, returning the error
+// that prevented it if it wasn't.
+func (s *logStream) Wait(ctx context.Context) error {
+	select {
+	case <-s.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.pending) > 0 || !s.created {
+		return fmt.Errorf("storing log %s: %v", s.name, s.err)
+	}
+	return nil
+}
+
+func (s *logStream) wake() {
+	select {
+	case s.kick <- struct{}{}:
+	default:
+	}
+}
+
+// startLocked starts flushLoop if it isn't running.
+// s.mu must be held.
+func (s *logStream) startLocked() {
+	if s.started {
+		return
+	}
+	s.started = true
+	liveLogsMu.Lock()
+	liveLogs[s.name] = s
+	liveLogsMu.Unlock()
+	go s.flushLoop()
+}
+
+// flushLoop appends pending output to the store when there's a chunk
+// of it, or every logFlushInterval, until the log is closed and
+// stored. If the store keeps failing after the log is closed, it
+// gives up, leaving the rest of the output in memory.
+func (s *logStream) flushLoop() {
+	defer close(s.done)
+	defer func() {
+		liveLogsMu.Lock()
+		delete(liveLogs, s.name)
+		liveLogsMu.Unlock()
+	}()
+	t := time.NewTicker(logFlushInterval)
+	defer t.Stop()
+	failuresAfterClose := 0
+	for {
+		select {
+		case <-s.kick:
+		case <-t.C:
+		}
+		s.mu.Lock()
+		off, data, closed, created := s.flushed, s.pending, s.closed, s.created
+		s.mu.Unlock()
+
+		var err error
+		if len(data) > 0 || (closed && !created) {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			err = s.store.Append(ctx, s.name, off, data)
+			cancel()
+			s.mu.Lock()
+			if err != nil {
+				log.Printf("streaming build log %s: %v", s.name, err)
+				s.err = err
+			} else {
+				s.flushed += int64(len(data))
+				s.pending = append([]byte(nil), s.pending[len(data):]...)
+				s.created = true
+			}
+			s.mu.Unlock()
+		}
+		if !closed {
+			continue
+		}
+		s.mu.Lock()
+		stored := len(s.pending) == 0 && s.created
+		s.mu.Unlock()
+		if err != nil {
+			failuresAfterClose++
+		}
+		if stored || failuresAfterClose == 3 {
+			return
+		}
+	}
+}
+
+// Len returns the number of bytes written to the log.
+func (s *logStream) Len() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.flushed + int64(len(s.pending))
+}
+
+// String returns the log, truncated to livelog.MaxBufferSize like the
+// output of builds that aren't streamed. The output that's in the
+// store is read from it.
+func (s *logStream) String() string {
+	s.mu.Lock()
+	flushed := s.flushed
+	pending := s.pending
+	size := flushed + int64(len(pending))
+	if max := livelog.MaxBufferSize - flushed; int64(len(pending)) > max {
+		pending = pending[:max]
+	}
+	pending = append([]byte(nil), pending...)
+	s.mu.Unlock()
+
+	var sb strings.Builder
+	if n := flushed; n > 0 {
+		if n > livelog.MaxBufferSize {
+			n = livelog.MaxBufferSize
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		rc, err := s.store.NewRangeReader(ctx, s.name, 0, n)
+		if err == nil {
+			_, err = io.Copy(&sb, rc)
+			rc.Close()
+		}
+		if err != nil {
+			log.Printf("reading streamed build log %s: %v", s.name, err)
+			fmt.Fprintf(&sb, "\n\n... error reading log: %v ...\n\n", err)
+		}
+	}
+	sb.Write(pending)
+	if size > livelog.MaxBufferSize {
+		sb.WriteString(logTruncationMessage)
+	}
+	return sb.String()
+}
+
+// Bytes returns the log, truncated like String.
+func (s *logStream) Bytes() []byte {
+	return []byte(s.String())
+}
+
+// Reader returns a ReadCloser that emits the whole log, waiting for
+// more until it's closed. It is safe to call Read and Close
+// concurrently.
+func (s *logStream) Reader() io.ReadCloser {
+	return s.readerAt(0)
+}
+
+// readerAt is like Reader, but starts at byte off of the log.
+func (s *logStream) readerAt(off int64) *logStreamReader {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &logStreamReader{s: s, off: off, ctx: ctx, cancel: cancel}
+}
+
+type logStreamReader struct {
+	s      *logStream
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// Accessed by only the Read method.
+	off   int64
+	rc    io.ReadCloser // reading the store, up to rcEnd
+	rcEnd int64
+
+	closed bool // guarded by s.mu
+}
+
+func (r *logStreamReader) Read(p []byte) (int, error) {
+	if r.rc != nil {
+		return r.readStore(p)
+	}
+	s := r.s
+	s.mu.Lock()
+	// Wait for data or the end of the log or reader closed.
+	for r.off >= s.flushed+int64(len(s.pending)) && !s.closed && !r.closed {
+		s.cond.Wait()
+	}
+	if r.off >= s.flushed+int64(len(s.pending)) || r.closed {
+		s.mu.Unlock()
+		return 0, io.EOF
+	}
+	if r.off >= s.flushed {
+		n := copy(p, s.pending[r.off-s.flushed:])
+		r.off += int64(n)
+		s.mu.Unlock()
+		return n, nil
+	}
+	flushed := s.flushed
+	s.mu.Unlock()
+
+	rc, err := s.store.NewRangeReader(r.ctx, s.name, r.off, flushed-r.off)
+	if err != nil {
+		return 0, err
+	}
+	r.rc, r.rcEnd = rc, flushed
+	return r.readStore(p)
+}
+
+func (r *logStreamReader) readStore(p []byte) (int, error) {
+	if max := r.rcEnd - r.off; int64(len(p)) > max {
+		p = p[:max]
+	}
+	n, err := r.rc.Read(p)
+	r.off += int64(n)
+	if r.off == r.rcEnd || err != nil {
+		r.rc.Close()
+		r.rc = nil
+		if err == io.EOF && r.off < r.rcEnd {
+			err = io.ErrUnexpectedEOF
+		} else if err == io.EOF {
+			err = nil
+		}
+	}
+	return n, err
+}
+
+func (r *logStreamReader) Close() error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	r.closed = true
+	r.cancel()
+	// Wake any sleeping readers to unblock a pending read on this reader.
+	r.s.cond.Broadcast()
+	return nil
+}
+
+// handleBuildLog serves /buildlog/<name>, a build log streamed to
+// buildLogStore, including the logs of builds that are still running.
+// It supports single range requests, including suffix ranges such as
+// "bytes=-65536" for the end of the log. With the follow parameter,
+// it keeps sending the log of a running build as it's written, from
+// the start of the range if there is one, until the build finishes.
+func handleBuildLog(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/buildlog/")
+	if buildLogStore == nil || !strings.HasSuffix(name, ".log") {
+		http.NotFound(w, r)
+		return
+	}
+	liveLogsMu.Lock()
+	s := liveLogs[name]
+	liveLogsMu.Unlock()
+
+	var size int64
+	if s != nil {
+		size = s.Len()
+	} else {
+		var err error
+		size, err = buildLogStore.Size(r.Context(), name)
+		if errors.Is(err, fs.ErrNotExist) {
+			http.NotFound(w, r)
+			return
+		} else if err != nil {
+			log.Printf("handleBuildLog: %v", err)
+			http.Error(w, "error reading build log", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Accept-Ranges", "bytes")
+	off, length, ok := parseLogRange(r.Header.Get("Range"), size)
+	if !ok {
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+		http.Error(w, "requested range not satisfiable", http.StatusRequestedRangeNotSatisfiable)
+		return
+	}
+	follow := s != nil && r.FormValue("follow") != "" && off+length == size
+	code := http.StatusOK
+	if off != 0 || length != size {
+		code = http.StatusPartialContent
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", off, off+length-1, size))
+	}
+	if !follow {
+		w.Header().Set("Content-Length", strconv.FormatInt(length, 10))
+	}
+	w.WriteHeader(code)
+	if r.Method == "HEAD" || length == 0 && !follow {
+		return
+	}
+
+	var rc io.ReadCloser
+	if s != nil {
+		sr := s.readerAt(off)
+		go func() {
+			<-r.Context().Done()
+			sr.Close()
+		}()
+		rc = sr
+		if !follow {
+			rc = struct {
+				io.Reader
+				io.Closer
+			}{io.LimitReader(sr, length), sr}
+		}
+	} else {
+		var err error
+		rc, err = buildLogStore.NewRangeReader(r.Context(), name, off, length)
+		if err != nil {
+			log.Printf("handleBuildLog: %v", err)
+			return
+		}
+	}
+	defer rc.Close()
+	buf := make([]byte, 65536)
+	for {
+		n, err := rc.Read(buf)
+		if _, err2 := w.Write(buf[:n]); err2 != nil {
+			return
+		}
+		if follow {
+			w.(http.Flusher).Flush()
+		}
+		if err != nil {
+			if err != io.EOF {
+				log.Printf("handleBuildLog: reading %s: %v", name, err)
+			}
+			return
+		}
+	}
+}
+
+// parseLogRange parses the Range header of a request for a log of
+// the given size, returning the requested offset and length.
+// Headers other than a single byte range are ignored, so the whole
+// log is requested. It reports false if the range isn't satisfiable.
+func parseLogRange(h string, size int64) (off, length int64, ok bool) {
+	spec, found := strings.CutPrefix(h, "bytes=")
+	if !found || strings.Contains(spec, ",") {
+		return 0, size, true
+	}
+	first, last, found := strings.Cut(strings.TrimSpace(spec), "-")
+	if !found {
+		return 0, size, true
+	}
+	if first == "" {
+		// A suffix range: the last bytes of the log.
+		n, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || n < 0 {
+			return 0, size, true
+		}
+		if n == 0 && size > 0 {
+			return 0, 0, false
+		}
+		if n > size {
+			n = size
+		}
+		return size - n, n, true
+	}
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 {
+		return 0, size, true
+	}
+	end := size - 1
+	if last != "" {
+		end, err = strconv.ParseInt(last, 10, 64)
+		if err != nil || end < start {
+			return 0, size, true
+		}
+		if end >= size {
+			end = size - 1
+		}
+	}
+	if start >= size {
+		return 0, 0, false
+	}
+	return start, end - start + 1, true
+}
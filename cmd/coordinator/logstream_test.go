@@ -0,0 +1,239 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.16 && (linux || darwin)
+// +build go1.16
+// +build linux darwin
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memLogStore is a logStore in memory.
+type memLogStore struct {
+	mu      sync.Mutex
+	logs    map[string][]byte
+	appends int
+}
+
+func (s *memLogStore) Append(ctx context.Context, name string, off int64, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.logs == nil {
+		s.logs = make(map[string][]byte)
+	}
+	if int64(len(s.logs[name])) != off {
+		return fmt.Errorf("appending to %s at %d; size is %d", name, off, len(s.logs[name]))
+	}
+	s.logs[name] = append(s.logs[name][:off:off], data...)
+	s.appends++
+	return nil
+}
+
+func (s *memLogStore) NewRangeReader(ctx context.Context, name string, off, length int64) (io.ReadCloser, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.logs[name]
+	if !ok {
+		return nil, fs.ErrNotExist
+	}
+	b = b[off:]
+	if length >= 0 {
+		b = b[:length]
+	}
+	return io.NopCloser(bytes.NewReader(b)), nil
+}
+
+func (s *memLogStore) Size(ctx context.Context, name string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.logs[name]
+	if !ok {
+		return 0, fs.ErrNotExist
+	}
+	return int64(len(b)), nil
+}
+
+func (s *memLogStore) URL(name string) string { return "mem://" + name }
+
+func (s *memLogStore) get(name string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return string(s.logs[name])
+}
+
+func setLogFlushing(t *testing.T, chunkSize int, interval time.Duration) {
+	oldChunkSize, oldInterval := logChunkSize, logFlushInterval
+	logChunkSize, logFlushInterval = chunkSize, interval
+	t.Cleanup(func() { logChunkSize, logFlushInterval = oldChunkSize, oldInterval })
+}
+
+func TestLogStream(t *testing.T) {
+	setLogFlushing(t, 8, time.Hour)
+	store := new(memLogStore)
+	s := newLogStream(store, "abc/linux-amd64_B1.log")
+
+	// A reader that starts before anything is written sees it all,
+	// whether it's been stored yet or not.
+	live := s.Reader()
+	got := make(chan string)
+	go func() {
+		b, err := io.ReadAll(live)
+		if err != nil {
+			t.Error(err)
+		}
+		got <- string(b)
+	}()
+
+	const want = "building...\nok  \tfmt\t0.01s\nALL TESTS PASSED\n"
+	var written string
+	for _, line := range []string{"building...\n", "ok  \tfmt\t0.01s\n", "ALL TESTS PASSED\n"} {
+		if _, err := io.WriteString(s, line); err != nil {
+			t.Fatal(err)
+		}
+		// Each line is a chunk, so it's stored without waiting for
+		// logFlushInterval.
+		written += line
+		for deadline := time.Now().Add(10 * time.Second); store.get(s.name) != written; time.Sleep(time.Millisecond) {
+			if time.Now().After(deadline) {
+				t.Fatalf("stored log = %q; want %q", store.get(s.name), written)
+			}
+		}
+	}
+	if got := s.String(); got != want {
+		t.Errorf("String before Close = %q; want %q", got, want)
+	}
+	s.Close()
+	if got := <-got; got != want {
+		t.Errorf("live reader read %q; want %q", got, want)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := s.Wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := store.get(s.name); got != want {
+		t.Errorf("stored log = %q; want %q", got, want)
+	}
+	if store.appends != 3 {
+		t.Errorf("log was stored in %d appends; want 3", store.appends)
+	}
+	if got := s.URL(); got != "mem://abc/linux-amd64_B1.log" {
+		t.Errorf("URL = %q", got)
+	}
+
+	// Once it's all stored, readers read it from the store.
+	s.mu.Lock()
+	pending := len(s.pending)
+	s.mu.Unlock()
+	if pending != 0 {
+		t.Errorf("%d bytes still pending after Wait", pending)
+	}
+	b, err := io.ReadAll(s.Reader())
+	if err != nil || string(b) != want {
+		t.Errorf("reading stored log = %q, %v; want %q", b, err, want)
+	}
+	if got := s.String(); got != want {
+		t.Errorf("String after Close = %q; want %q", got, want)
+	}
+}
+
+func TestLogStreamEmpty(t *testing.T) {
+	store := new(memLogStore)
+	s := newLogStream(store, "empty.log")
+	s.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := s.Wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if size, err := store.Size(ctx, "empty.log"); err != nil || size != 0 {
+		t.Errorf("Size = %d, %v; want an empty log", size, err)
+	}
+}
+
+func TestHandleBuildLog(t *testing.T) {
+	setLogFlushing(t, 4, time.Hour)
+	store := &memLogStore{logs: map[string][]byte{"done/x.log": []byte("0123456789")}}
+	oldStore := buildLogStore
+	buildLogStore = store
+	t.Cleanup(func() { buildLogStore = oldStore })
+
+	for _, tt := range []struct {
+		path, rangeHeader string
+		wantCode          int
+		wantBody          string
+		wantContentRange  string
+	}{
+		{"/buildlog/done/x.log", "", http.StatusOK, "0123456789", ""},
+		{"/buildlog/done/x.log", "bytes=2-4", http.StatusPartialContent, "234", "bytes 2-4/10"},
+		{"/buildlog/done/x.log", "bytes=7-", http.StatusPartialContent, "789", "bytes 7-9/10"},
+		{"/buildlog/done/x.log", "bytes=-3", http.StatusPartialContent, "789", "bytes 7-9/10"},
+		{"/buildlog/done/x.log", "bytes=-30", http.StatusOK, "0123456789", ""},
+		{"/buildlog/done/x.log", "bytes=5-100", http.StatusPartialContent, "56789", "bytes 5-9/10"},
+		{"/buildlog/done/x.log", "bytes=0-1,4-5", http.StatusOK, "0123456789", ""},
+		{"/buildlog/done/x.log", "bytes=10-", http.StatusRequestedRangeNotSatisfiable, "", "bytes */10"},
+		{"/buildlog/missing.log", "", http.StatusNotFound, "", ""},
+		{"/buildlog/done/x.txt", "", http.StatusNotFound, "", ""},
+	} {
+		req := httptest.NewRequest("GET", tt.path, nil)
+		if tt.rangeHeader != "" {
+			req.Header.Set("Range", tt.rangeHeader)
+		}
+		rec := httptest.NewRecorder()
+		handleBuildLog(rec, req)
+		if rec.Code != tt.wantCode {
+			t.Errorf("%s with Range %q: status = %d; want %d", tt.path, tt.rangeHeader, rec.Code, tt.wantCode)
+			continue
+		}
+		if got := rec.Header().Get("Content-Range"); got != tt.wantContentRange {
+			t.Errorf("%s with Range %q: Content-Range = %q; want %q", tt.path, tt.rangeHeader, got, tt.wantContentRange)
+		}
+		if tt.wantCode/100 == 2 && rec.Body.String() != tt.wantBody {
+			t.Errorf("%s with Range %q: body = %q; want %q", tt.path, tt.rangeHeader, rec.Body, tt.wantBody)
+		}
+	}
+
+	// Following the log of a running build sends what's written until
+	// the build finishes.
+	s := newLogStream(store, "live/y.log")
+	io.WriteString(s, "start\n")
+	srv := httptest.NewServer(http.HandlerFunc(handleBuildLog))
+	defer srv.Close()
+	req, err := http.NewRequest("GET", srv.URL+"/buildlog/live/y.log?follow=1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Range", "bytes=2-")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusPartialContent {
+		t.Fatalf("following live log: status = %v; want 206", resp.Status)
+	}
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(resp.Body, buf); err != nil || string(buf) != "art\n" {
+		t.Fatalf("following live log: read %q, %v; want %q", buf, err, "art\n")
+	}
+	io.WriteString(s, "more output\n")
+	s.Close()
+	rest, err := io.ReadAll(resp.Body)
+	if err != nil || string(rest) != "more output\n" {
+		t.Errorf("following live log: read %q, %v; want %q", rest, err, "more output\n")
+	}
+}
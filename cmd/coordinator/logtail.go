@@ -0,0 +1,241 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.16 && (linux || darwin)
+// +build go1.16
+// +build linux darwin
+
+// Code related to tailing the logs of running builds.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/build/internal/buildgo"
+)
+
+var (
+	// maxLogTails is how many clients may tail build logs at once.
+	// Others are asked to retry later.
+	maxLogTails = 256
+
+	// logTailChunkSize is the most log output sent at once.
+	logTailChunkSize = 64 << 10
+
+	// logTailWriteTimeout is how long a client may take to accept a
+	// chunk of log output before it's disconnected, so that slow
+	// clients don't hold on to coordinator resources. They may
+	// resume from where they were cut off.
+	logTailWriteTimeout = 30 * time.Second
+
+	// logTailKeepAlive is how often an idle event stream gets a
+	// comment, so that proxies don't close it.
+	logTailKeepAlive = 30 * time.Second
+
+	// logTailMaxDuration is how long a client may tail a log before
+	// it's disconnected and has to resume.
+	logTailMaxDuration = time.Hour
+)
+
+// logTails limits the number of clients tailing build logs.
+var logTails = make(chan struct{}, maxLogTails)
+
+// handleLogTail serves /logtail, which streams the log of a build as
+// it's written until the build finishes. Builds are identified by the
+// same parameters as in /temporarylogs.
+//
+// If the request accepts text/event-stream, the log is sent as
+// server-sent events: "log" events whose data is a chunk of the log,
+// with carriage returns removed, and whose ID is the offset in bytes
+// of the log after it, then a final "end" event whose data is "ok" or
+// "fail". Clients that reconnect with that ID in the Last-Event-ID
+// header, as EventSource does, resume where they left off.
+// Otherwise, the log is sent as plain text, and the X-Log-Offset
+// header holds the offset where it starts. The offset parameter sets
+// it in either case.
+//
+// To limit the load of slow or numerous clients, the coordinator
+// reads the log only as fast as a client consumes it, disconnects
+// clients that stop reading or tail a log for too long, and turns
+// clients away with 503 Service Unavailable when too many tail logs.
+func handleLogTail(w http.ResponseWriter, r *http.Request) {
+	br := buildgo.BuilderRev{
+		Name:    r.FormValue("name"),
+		Rev:     r.FormValue("rev"),
+		SubName: r.FormValue("subName"), // may be empty
+		SubRev:  r.FormValue("subRev"),  // may be empty
+	}
+	st := getStatus(br, r.FormValue("st"))
+	if st == nil {
+		http.NotFound(w, r)
+		return
+	}
+	serveLogTail(w, r, st)
+}
+
+func serveLogTail(w http.ResponseWriter, r *http.Request, st *buildStatus) {
+	offStr := r.FormValue("offset")
+	if id := r.Header.Get("Last-Event-ID"); id != "" {
+		offStr = id
+	}
+	var off int64
+	if offStr != "" {
+		var err error
+		off, err = strconv.ParseInt(offStr, 10, 64)
+		if err != nil || off < 0 {
+			http.Error(w, fmt.Sprintf("invalid offset %q", offStr), http.StatusBadRequest)
+			return
+		}
+	}
+	select {
+	case logTails <- struct{}{}:
+		defer func() { <-logTails }()
+	default:
+		w.Header().Set("Retry-After", "60")
+		http.Error(w, "too many clients are tailing build logs; try again later", http.StatusServiceUnavailable)
+		return
+	}
+
+	rc, err := logReaderAt(st.out(), off)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusRequestedRangeNotSatisfiable)
+		return
+	}
+	defer rc.Close()
+
+	sse := strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+	if sse {
+		w.Header().Set("Content-Type", "text/event-stream")
+	} else {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("X-Log-Offset", strconv.FormatInt(off, 10))
+	}
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	rw := http.NewResponseController(w)
+	// write writes to the client, giving up if it's too slow.
+	write := func(p []byte) error {
+		rw.SetWriteDeadline(time.Now().Add(logTailWriteTimeout))
+		if _, err := w.Write(p); err != nil {
+			return err
+		}
+		return rw.Flush()
+	}
+	if err := write(nil); err != nil {
+		return
+	}
+
+	// Read the log in its own goroutine, so that the client gets
+	// keep-alives while it waits for output. The unbuffered channel
+	// keeps the reader from getting ahead of the client. The reader
+	// always sends its reason for stopping to readErr before closing
+	// chunks, so that the loop below never waits for it in vain.
+	chunks := make(chan []byte)
+	readErr := make(chan error, 1)
+	go func() {
+		defer close(chunks)
+		for {
+			buf := make([]byte, logTailChunkSize)
+			n, err := rc.Read(buf)
+			if n > 0 {
+				select {
+				case chunks <- buf[:n]:
+				case <-r.Context().Done():
+					readErr <- r.Context().Err()
+					return
+				}
+			}
+			if err != nil {
+				readErr <- err
+				return
+			}
+		}
+	}()
+	keepAlive := time.NewTicker(logTailKeepAlive)
+	defer keepAlive.Stop()
+	deadline := time.NewTimer(logTailMaxDuration)
+	defer deadline.Stop()
+	for {
+		select {
+		case chunk, ok := <-chunks:
+			if !ok {
+				if err := <-readErr; err != io.EOF {
+					return
+				}
+				if sse {
+					st.mu.Lock()
+					result := "fail"
+					if st.succeeded {
+						result = "ok"
+					}
+					st.mu.Unlock()
+					write([]byte("event: end\ndata: " + result + "\n\n"))
+				}
+				return
+			}
+			off += int64(len(chunk))
+			if sse {
+				chunk = logTailEvent(chunk, off)
+			}
+			if err := write(chunk); err != nil {
+				return
+			}
+		case <-keepAlive.C:
+			if sse {
+				if err := write([]byte(": keep-alive\n\n")); err != nil {
+					return
+				}
+			}
+		case <-deadline.C:
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// logTailEvent returns the server-sent event of a chunk of log, after
+// which the log is off bytes long.
+func logTailEvent(chunk []byte, off int64) []byte {
+	// Event data can't hold carriage returns, and its lines are
+	// joined by newlines.
+	chunk = bytes.ReplaceAll(chunk, []byte("\r"), nil)
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "event: log\nid: %d\n", off)
+	for _, line := range bytes.Split(chunk, []byte("\n")) {
+		buf.WriteString("data: ")
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes()
+}
+
+// logReaderAt returns a reader of out that starts at byte off, and
+// like out.Reader waits for more until out is closed.
+func logReaderAt(out buildOutput, off int64) (io.ReadCloser, error) {
+	if s, ok := out.(*logStream); ok {
+		if off > s.Len() {
+			return nil, fmt.Errorf("offset %d is past the end of the log", off)
+		}
+		return s.readerAt(off), nil
+	}
+	rc := out.Reader()
+	if _, err := io.CopyN(io.Discard, rc, off); err != nil {
+		rc.Close()
+		if errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("offset %d is past the end of the log", off)
+		}
+		return nil, err
+	}
+	return rc, nil
+}
@@ -0,0 +1,150 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.16 && (linux || darwin)
+// +build go1.16
+// +build linux darwin
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestServeLogTail(t *testing.T) {
+	st := &buildStatus{}
+	st.output.Write([]byte("line 1\r\nline 2\n"))
+	tail := func(t *testing.T, target string, header http.Header) *httptest.ResponseRecorder {
+		t.Helper()
+		r := httptest.NewRequest("GET", target, nil)
+		for k, vs := range header {
+			for _, v := range vs {
+				r.Header.Add(k, v)
+			}
+		}
+		w := httptest.NewRecorder()
+		done := make(chan struct{})
+		go func() {
+			serveLogTail(w, r, st)
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(10 * time.Second):
+			t.Fatalf("GET %s didn't finish", target)
+		}
+		return w
+	}
+
+	// Output written while a client tails the log reaches it, and the
+	// tail ends with the build.
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		st.output.Write([]byte("line 3\n"))
+		st.mu.Lock()
+		st.succeeded = true
+		st.mu.Unlock()
+		st.output.Close()
+	}()
+	w := tail(t, "/logtail", nil)
+	if got, want := w.Body.String(), "line 1\r\nline 2\nline 3\n"; got != want {
+		t.Errorf("body = %q; want %q", got, want)
+	}
+	if got, want := w.Header().Get("X-Log-Offset"), "0"; got != want {
+		t.Errorf("X-Log-Offset = %q; want %q", got, want)
+	}
+
+	w = tail(t, "/logtail?offset=8", nil)
+	if got, want := w.Body.String(), "line 2\nline 3\n"; got != want {
+		t.Errorf("with offset, body = %q; want %q", got, want)
+	}
+
+	w = tail(t, "/logtail", http.Header{
+		"Accept":        {"text/event-stream"},
+		"Last-Event-ID": {"8"},
+	})
+	if got, want := w.Header().Get("Content-Type"), "text/event-stream"; got != want {
+		t.Errorf("Content-Type = %q; want %q", got, want)
+	}
+	want := "event: log\nid: 22\ndata: line 2\ndata: line 3\ndata: \n\nevent: end\ndata: ok\n\n"
+	if got := w.Body.String(); got != want {
+		t.Errorf("event stream = %q; want %q", got, want)
+	}
+
+	for _, tt := range []struct {
+		target string
+		code   int
+	}{
+		{"/logtail?offset=x", http.StatusBadRequest},
+		{"/logtail?offset=-1", http.StatusBadRequest},
+		{"/logtail?offset=100", http.StatusRequestedRangeNotSatisfiable},
+	} {
+		if w := tail(t, tt.target, nil); w.Code != tt.code {
+			t.Errorf("GET %s: code = %d; want %d", tt.target, w.Code, tt.code)
+		}
+	}
+
+	// Clients beyond the limit are turned away.
+	for i := 0; i < cap(logTails); i++ {
+		logTails <- struct{}{}
+	}
+	w = tail(t, "/logtail", nil)
+	for i := 0; i < cap(logTails); i++ {
+		<-logTails
+	}
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") == "" {
+		t.Errorf("with too many clients, code = %d, Retry-After = %q; want %d and a delay", w.Code, w.Header().Get("Retry-After"), http.StatusServiceUnavailable)
+	}
+}
+
+// firstWriteRecorder is a ResponseRecorder that reports when the first
+// log output is written to it.
+type firstWriteRecorder struct {
+	*httptest.ResponseRecorder
+	wrote chan struct{}
+}
+
+func (w *firstWriteRecorder) Write(p []byte) (int, error) {
+	if len(p) > 0 && w.wrote != nil {
+		close(w.wrote)
+		w.wrote = nil
+	}
+	return w.ResponseRecorder.Write(p)
+}
+
+func TestServeLogTailClientGone(t *testing.T) {
+	// The log has more output than fits in a chunk, so that the
+	// reader is usually waiting to send the next chunk when the
+	// client goes away.
+	st := &buildStatus{}
+	st.output.Write(bytes.Repeat([]byte("log output\n"), 4*logTailChunkSize/len("log output\n")))
+	defer st.output.Close()
+
+	for i := 0; i < 100; i++ {
+		ctx, cancel := context.WithCancel(context.Background())
+		r := httptest.NewRequest("GET", "/logtail", nil).WithContext(ctx)
+		wrote := make(chan struct{})
+		w := &firstWriteRecorder{httptest.NewRecorder(), wrote}
+		done := make(chan struct{})
+		go func() {
+			serveLogTail(w, r, st)
+			close(done)
+		}()
+		<-wrote
+		cancel()
+		select {
+		case <-done:
+		case <-time.After(10 * time.Second):
+			t.Fatalf("tail %d didn't finish after the client went away", i)
+		}
+		if n := len(logTails); n != 0 {
+			t.Fatalf("after tail %d, %d clients are still counted as tailing logs; want 0", i, n)
+		}
+	}
+}
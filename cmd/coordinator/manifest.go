@@ -0,0 +1,167 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.16 && (linux || darwin)
+// +build go1.16
+// +build linux darwin
+
+// Code related to recording the environment each build ran in.
+
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"golang.org/x/build/buildlet"
+	"golang.org/x/build/dashboard"
+	"golang.org/x/build/internal/coordinator/pool"
+	"golang.org/x/build/internal/envutil"
+)
+
+// An envManifest records the environment a build ran in, in enough
+// detail to recreate it when investigating an old failure. The
+// coordinator stores it as JSON alongside the build logs and refers
+// to it from the build's BuildRecord and TryBotResult as ManifestURL.
+type envManifest struct {
+	BuildID string    `json:"buildID"`
+	Builder string    `json:"builder"`
+	Time    time.Time `json:"time"`
+	Rev     string    `json:"rev"`               // Go revision
+	SubName string    `json:"subName,omitempty"` // e.g. "net"
+	SubRev  string    `json:"subRev,omitempty"`
+
+	// ConfigHash is the SHA-256 of the builder's BuildConfig and
+	// HostConfig as JSON, which changes whenever either does.
+	ConfigHash string `json:"configHash"`
+
+	HostType        string `json:"hostType"`
+	VMImage         string `json:"vmImage,omitempty"`
+	ContainerImage  string `json:"containerImage,omitempty"`
+	KonletVMImage   string `json:"konletVMImage,omitempty"`
+	BuildletVersion int    `json:"buildletVersion,omitempty"`
+	Buildlet        string `json:"buildlet,omitempty"` // the buildlet's name or address
+
+	// Env is the environment every command of the build ran with,
+	// on top of the buildlet's own.
+	Env []string `json:"env"`
+
+	// EnvProfile is the environment profile the build's commands
+	// ran in, if any.
+	EnvProfile *envutil.Profile `json:"envProfile,omitempty"`
+
+	// BootstrapURL is the URL of the bootstrap toolchain written to
+	// the buildlet, and BootstrapHash its hash as reported by the
+	// bucket it's in, such as "md5:0123…". They're empty if the
+	// build used a snapshot or the host has no bootstrap toolchain.
+	BootstrapURL  string `json:"bootstrapURL,omitempty"`
+	BootstrapHash string `json:"bootstrapHash,omitempty"`
+	Snapshot      bool   `json:"snapshot,omitempty"`
+}
+
+// configHash returns the hex SHA-256 of conf and its host
+// configuration encoded as JSON.
+func configHash(conf *dashboard.BuildConfig) (string, error) {
+	b, err := json.Marshal(struct {
+		Build *dashboard.BuildConfig
+		Host  *dashboard.HostConfig
+	}{conf, conf.HostConfig()})
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// newEnvManifest returns the manifest of st's environment, with bc
+// as its buildlet.
+func (st *buildStatus) newEnvManifest(bc buildlet.Client) (*envManifest, error) {
+	hash, err := configHash(st.conf)
+	if err != nil {
+		return nil, fmt.Errorf("hashing builder config: %v", err)
+	}
+	hc := st.conf.HostConfig()
+	m := &envManifest{
+		BuildID:        st.buildID,
+		Builder:        st.Name,
+		Time:           st.startTime.UTC(),
+		Rev:            st.Rev,
+		SubName:        st.SubName,
+		SubRev:         st.SubRev,
+		ConfigHash:     hash,
+		HostType:       hc.HostType,
+		VMImage:        hc.VMImage,
+		ContainerImage: hc.ContainerImage,
+		KonletVMImage:  hc.KonletVMImage,
+		Env:            st.conf.Env(),
+		EnvProfile:     st.conf.EnvProfile(),
+		Snapshot:       st.useSnapshot(),
+	}
+	if bc != nil {
+		m.Buildlet = bc.String()
+		ctx, cancel := context.WithTimeout(st.ctx, 10*time.Second)
+		defer cancel()
+		if status, err := bc.Status(ctx); err == nil {
+			m.BuildletVersion = status.Version
+		}
+	}
+	if !m.Snapshot {
+		m.BootstrapURL = st.conf.GoBootstrapURL(pool.NewGCEConfiguration().BuildEnv())
+		m.BootstrapHash = bootstrapHash(st.ctx, m.BootstrapURL)
+	}
+	return m, nil
+}
+
+// bootstrapHash returns the hash of the bootstrap toolchain at u, as
+// recorded by Cloud Storage, or the empty string if it's unknown.
+func bootstrapHash(ctx context.Context, u string) string {
+	const prefix = "https://storage.googleapis.com/"
+	sc := pool.NewGCEConfiguration().StorageClient()
+	if sc == nil || !strings.HasPrefix(u, prefix) {
+		return ""
+	}
+	bucket, object, ok := strings.Cut(strings.TrimPrefix(u, prefix), "/")
+	if !ok {
+		return ""
+	}
+	attrs, err := sc.Bucket(bucket).Object(object).Attrs(ctx)
+	if err != nil {
+		log.Printf("bootstrapHash(%q): %v", u, err)
+		return ""
+	}
+	if len(attrs.MD5) > 0 {
+		return "md5:" + hex.EncodeToString(attrs.MD5)
+	}
+	return fmt.Sprintf("crc32c:%08x", attrs.CRC32C)
+}
+
+// writeEnvManifest stores the manifest of st's environment and
+// records its URL in st. Failing to store it doesn't fail the build.
+func (st *buildStatus) writeEnvManifest(bc buildlet.Client) {
+	m, err := st.newEnvManifest(bc)
+	if err != nil {
+		log.Printf("%v: environment manifest: %v", st.BuilderRev, err)
+		return
+	}
+	wr, u := newManifestBlob(st.buildID)
+	enc := json.NewEncoder(wr)
+	enc.SetIndent("", "\t")
+	if err := enc.Encode(m); err != nil {
+		log.Printf("%v: writing environment manifest: %v", st.BuilderRev, err)
+		return
+	}
+	if err := wr.Close(); err != nil {
+		log.Printf("%v: writing environment manifest: %v", st.BuilderRev, err)
+		return
+	}
+	st.mu.Lock()
+	st.manifestURL = u
+	st.mu.Unlock()
+}
@@ -0,0 +1,72 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.16 && (linux || darwin)
+// +build go1.16
+// +build linux darwin
+
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.org/x/build/dashboard"
+	"golang.org/x/build/internal/buildgo"
+)
+
+func TestConfigHash(t *testing.T) {
+	seen := make(map[string]string)
+	for name, conf := range dashboard.Builders {
+		h, err := configHash(conf)
+		if err != nil {
+			t.Fatalf("configHash(%q): %v", name, err)
+		}
+		if h2, _ := configHash(conf); h2 != h {
+			t.Errorf("configHash(%q) = %s, then %s; want stable hash", name, h, h2)
+		}
+		if other, ok := seen[h]; ok {
+			t.Errorf("configHash(%q) = configHash(%q) = %s", name, other, h)
+		}
+		seen[h] = name
+	}
+}
+
+func TestNewEnvManifest(t *testing.T) {
+	const rev = "0123456789abcdef0123456789abcdef01234567"
+	conf := dashboard.Builders["linux-amd64"]
+	start := time.Date(2023, 9, 1, 12, 0, 0, 0, time.UTC)
+	st := &buildStatus{
+		BuilderRev:      buildgo.BuilderRev{Name: conf.Name, Rev: rev, SubName: "net", SubRev: rev},
+		buildID:         "B0123456789",
+		conf:            conf,
+		startTime:       start,
+		ctx:             context.Background(),
+		useSnapshotMemo: map[string]bool{rev: true},
+	}
+	got, err := st.newEnvManifest(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash, _ := configHash(conf)
+	want := &envManifest{
+		BuildID:        "B0123456789",
+		Builder:        conf.Name,
+		Time:           start,
+		Rev:            rev,
+		SubName:        "net",
+		SubRev:         rev,
+		ConfigHash:     hash,
+		HostType:       conf.HostType,
+		ContainerImage: conf.HostConfig().ContainerImage,
+		Env:            conf.Env(),
+		EnvProfile:     conf.EnvProfile(),
+		Snapshot:       true,
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("newEnvManifest mismatch (-want +got):\n%s", diff)
+	}
+}
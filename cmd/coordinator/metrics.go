@@ -17,6 +17,7 @@ import (
 	"go.opencensus.io/stats"
 	"go.opencensus.io/stats/view"
 	"go.opencensus.io/tag"
+	"golang.org/x/build/internal/coordinator/buildletca"
 	"golang.org/x/build/internal/coordinator/pool"
 )
 
@@ -29,6 +30,29 @@ var (
 	mGomoteRDPCount     = stats.Int64("go-build/coordinator/gomote_rdp_count", "counter for gomote RDP invocations", stats.UnitDimensionless)
 	mGomoteSSHCount     = stats.Int64("go-build/coordinator/gomote_ssh_count", "counter for gomote SSH invocations", stats.UnitDimensionless)
 	mReverseBuildlets   = stats.Int64("go-build/coordinator/reverse_buildlets_count", "number of reverse buildlets", stats.UnitDimensionless)
+
+	kWarmStart      = tag.MustNewKey("go-build/coordinator/keys/warm_start")
+	mWarmPoolIdle   = stats.Int64("go-build/coordinator/warm_pool_idle_count", "number of idle warm pool buildlets", stats.UnitDimensionless)
+	mWarmPoolStarts = stats.Int64("go-build/coordinator/warm_pool_starts", "cumulative count of GCE buildlet starts", stats.UnitDimensionless)
+
+	mBuildletCAIssuerAge  = stats.Float64("go-build/coordinator/buildlet_ca_issuer_age", "age of the current intermediate certificate of the buildlet CA", stats.UnitSeconds)
+	mBuildletCertsOldest  = stats.Float64("go-build/coordinator/buildlet_certs_oldest_age", "age of the oldest outstanding buildlet certificate", stats.UnitSeconds)
+	mBuildletCerts        = stats.Int64("go-build/coordinator/buildlet_certs_count", "number of outstanding buildlet certificates", stats.UnitDimensionless)
+	mBuildletCertsRevoked = stats.Int64("go-build/coordinator/buildlet_certs_revoked_count", "number of unexpired revoked buildlet certificates", stats.UnitDimensionless)
+	mBuildletCACRLAge     = stats.Float64("go-build/coordinator/buildlet_ca_crl_age", "time since the buildlet CA's CRL was fetched", stats.UnitSeconds)
+
+	mBuildWallSeconds = stats.Float64("go-build/coordinator/build_wall_seconds", "wall time of a finished build", stats.UnitSeconds)
+	mBuildCPUSeconds  = stats.Float64("go-build/coordinator/build_cpu_seconds", "CPU time of the commands of a finished build", stats.UnitSeconds)
+	mBuildPeakMemory  = stats.Int64("go-build/coordinator/build_peak_memory", "largest peak resident set size of the commands of a finished build", stats.UnitBytes)
+	mBuildDiskBytes   = stats.Int64("go-build/coordinator/build_disk_bytes", "bytes read from and written to storage by the commands of a finished build", stats.UnitBytes)
+	mBuildNetBytes    = stats.Int64("go-build/coordinator/build_net_bytes", "bytes received and sent on the network while the commands of a finished build ran", stats.UnitBytes)
+)
+
+// Bucket boundaries of the distributions of build resource usage.
+var (
+	buildSecondsBuckets = []float64{30, 60, 120, 300, 600, 900, 1200, 1800, 2700, 3600, 5400, 7200}
+	buildMemoryBuckets  = []float64{128 << 20, 256 << 20, 512 << 20, 1 << 30, 2 << 30, 4 << 30, 8 << 30, 16 << 30, 32 << 30}
+	buildIOBuckets      = []float64{64 << 20, 256 << 20, 1 << 30, 4 << 30, 16 << 30, 64 << 30, 256 << 30}
 )
 
 // views should contain all measurements. All *view.View added to this
@@ -67,6 +91,85 @@ var views = []*view.View{
 		Measure:     mGomoteRDPCount,
 		Aggregation: view.Count(),
 	},
+	{
+		Name:        "go-build/coordinator/warm_pool_idle_count",
+		Description: "Number of idle warm pool buildlets",
+		Measure:     mWarmPoolIdle,
+		TagKeys:     []tag.Key{kHostType},
+		Aggregation: view.LastValue(),
+	},
+	{
+		Name:        "go-build/coordinator/warm_pool_starts",
+		Description: "Cumulative count of GCE buildlet starts, warm from the warm pool or cold",
+		Measure:     mWarmPoolStarts,
+		TagKeys:     []tag.Key{kHostType, kWarmStart},
+		Aggregation: view.LastValue(),
+	},
+	{
+		Name:        "go-build/coordinator/buildlet_ca_issuer_age",
+		Description: "Age of the current intermediate certificate of the buildlet CA, in seconds",
+		Measure:     mBuildletCAIssuerAge,
+		Aggregation: view.LastValue(),
+	},
+	{
+		Name:        "go-build/coordinator/buildlet_certs_oldest_age",
+		Description: "Age of the oldest outstanding buildlet certificate, in seconds",
+		Measure:     mBuildletCertsOldest,
+		Aggregation: view.LastValue(),
+	},
+	{
+		Name:        "go-build/coordinator/buildlet_certs_count",
+		Description: "Number of outstanding buildlet certificates",
+		Measure:     mBuildletCerts,
+		Aggregation: view.LastValue(),
+	},
+	{
+		Name:        "go-build/coordinator/buildlet_certs_revoked_count",
+		Description: "Number of unexpired revoked buildlet certificates",
+		Measure:     mBuildletCertsRevoked,
+		Aggregation: view.LastValue(),
+	},
+	{
+		Name:        "go-build/coordinator/buildlet_ca_crl_age",
+		Description: "Time since the buildlet CA's CRL was last fetched, in seconds",
+		Measure:     mBuildletCACRLAge,
+		Aggregation: view.LastValue(),
+	},
+	{
+		Name:        "go-build/coordinator/build_wall_seconds",
+		Description: "Distribution of the wall time of finished builds, in seconds",
+		Measure:     mBuildWallSeconds,
+		TagKeys:     []tag.Key{kBuilderType, kHostType},
+		Aggregation: view.Distribution(buildSecondsBuckets...),
+	},
+	{
+		Name:        "go-build/coordinator/build_cpu_seconds",
+		Description: "Distribution of the total CPU time of the commands of finished builds, in seconds",
+		Measure:     mBuildCPUSeconds,
+		TagKeys:     []tag.Key{kBuilderType, kHostType},
+		Aggregation: view.Distribution(buildSecondsBuckets...),
+	},
+	{
+		Name:        "go-build/coordinator/build_peak_memory",
+		Description: "Distribution of the largest peak resident set size of the commands of finished builds, in bytes",
+		Measure:     mBuildPeakMemory,
+		TagKeys:     []tag.Key{kBuilderType, kHostType},
+		Aggregation: view.Distribution(buildMemoryBuckets...),
+	},
+	{
+		Name:        "go-build/coordinator/build_disk_bytes",
+		Description: "Distribution of the bytes read from and written to storage by the commands of finished builds",
+		Measure:     mBuildDiskBytes,
+		TagKeys:     []tag.Key{kBuilderType, kHostType},
+		Aggregation: view.Distribution(buildIOBuckets...),
+	},
+	{
+		Name:        "go-build/coordinator/build_net_bytes",
+		Description: "Distribution of the bytes received and sent on the network while the commands of finished builds ran",
+		Measure:     mBuildNetBytes,
+		TagKeys:     []tag.Key{kBuilderType, kHostType},
+		Aggregation: view.Distribution(buildIOBuckets...),
+	},
 }
 
 // reportReverseCountMetrics gathers and reports
@@ -86,6 +189,38 @@ func reportReverseCountMetrics() {
 	}
 }
 
+// reportWarmPoolMetrics reports the idle buildlets of the GCE warm pool
+// and the counts of warm and cold GCE buildlet starts, per host type.
+func reportWarmPoolMetrics() {
+	for {
+		for hostType, st := range pool.NewGCEConfiguration().BuildletPool().WarmPool().Stats() {
+			ctx := context.Background()
+			host := tag.Upsert(kHostType, hostType)
+			stats.RecordWithTags(ctx, []tag.Mutator{host}, mWarmPoolIdle.M(int64(st.Idle)))
+			stats.RecordWithTags(ctx, []tag.Mutator{host, tag.Upsert(kWarmStart, "warm")}, mWarmPoolStarts.M(st.Warm))
+			stats.RecordWithTags(ctx, []tag.Mutator{host, tag.Upsert(kWarmStart, "cold")}, mWarmPoolStarts.M(st.Cold))
+		}
+
+		time.Sleep(time.Minute)
+	}
+}
+
+// reportBuildletCAMetrics reports the ages of the certificates of the
+// buildlet CA ca.
+func reportBuildletCAMetrics(ca *buildletca.CA) {
+	for {
+		st := ca.Stats()
+		stats.Record(context.Background(),
+			mBuildletCAIssuerAge.M(st.IssuerAge.Seconds()),
+			mBuildletCertsOldest.M(st.OldestCert.Seconds()),
+			mBuildletCerts.M(int64(st.Certs)),
+			mBuildletCertsRevoked.M(int64(st.Revoked)),
+			mBuildletCACRLAge.M(st.CRLAge.Seconds()))
+
+		time.Sleep(time.Minute)
+	}
+}
+
 // recordBuildletCreate records information about gomote creates and sends them
 // to the configured metrics backend.
 func recordBuildletCreate(ctx context.Context, builderType string) {
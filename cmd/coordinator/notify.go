@@ -0,0 +1,46 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.16 && (linux || darwin)
+// +build go1.16
+// +build linux darwin
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+
+	sendgrid "github.com/sendgrid/sendgrid-go"
+	sendgridmail "github.com/sendgrid/sendgrid-go/helpers/mail"
+	"golang.org/x/build/internal/secret"
+)
+
+// mustSendGridMail returns a function that sends plain text emails from
+// the address from with SendGrid, for build.golang.org notifications.
+func mustSendGridMail(sc *secret.Client, from string) func(to, subject, body string) error {
+	apiKey, err := sc.Retrieve(context.Background(), secret.NameSendGridAPIKey)
+	if err != nil {
+		log.Fatalf("unable to retrieve secret %q: %s", secret.NameSendGridAPIKey, err)
+	}
+	sg := sendgrid.NewSendClient(apiKey)
+	return func(to, subject, body string) error {
+		req := sendgridmail.NewSingleEmail(sendgridmail.NewEmail("Go Build Dashboard", from), subject, sendgridmail.NewEmail("", to), body, "")
+		no := false
+		req.TrackingSettings = &sendgridmail.TrackingSettings{
+			ClickTracking:        &sendgridmail.ClickTrackingSetting{Enable: &no},
+			OpenTracking:         &sendgridmail.OpenTrackingSetting{Enable: &no},
+			SubscriptionTracking: &sendgridmail.SubscriptionTrackingSetting{Enable: &no},
+		}
+		resp, err := sg.Send(req)
+		if err != nil {
+			return err
+		} else if resp.StatusCode != http.StatusAccepted {
+			return fmt.Errorf("unexpected status %d %s, want 202 Accepted; body = %s", resp.StatusCode, http.StatusText(resp.StatusCode), resp.Body)
+		}
+		return nil
+	}
+}
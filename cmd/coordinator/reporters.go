@@ -0,0 +1,549 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.16 && (linux || darwin)
+// +build go1.16
+// +build linux darwin
+
+// Code related to reporting TryBot results.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v48/github"
+	"golang.org/x/build/gerrit"
+	"golang.org/x/build/internal/secret"
+	"golang.org/x/build/repos"
+	"golang.org/x/oauth2"
+)
+
+var (
+	tryReportersFlag      = flag.String("try-reporters", "", `Space-separated list of project=reporter,... entries choosing where the TryBot results of a repo are reported, such as "vscode-go=gerrit,github". The reporters are gerrit, github, and webhook. Repos that aren't listed report to gerrit.`)
+	tryWebhookURL         = flag.String("try-webhook-url", "", "URL that the webhook reporter POSTs TryBot results to, as JSON.")
+	githubAppID           = flag.Int64("github-checks-app-id", 0, "ID of the GitHub App that the github reporter creates check runs as. Its private key is the secret "+secret.NameGitHubChecksAppKey+".")
+	githubAppInstallation = flag.Int64("github-checks-app-installation", 0, "ID of the installation of the -github-checks-app-id App in the golang GitHub organization.")
+)
+
+// A tryEvent is a point in the life of a trySet that is reported.
+type tryEvent string
+
+const (
+	tryStarted  tryEvent = "started"  // the builds have started
+	tryProgress tryEvent = "progress" // the first build failed, and others are still running
+	tryFinished tryEvent = "finished" // all builds have completed
+)
+
+// A tryReport describes the state of a trySet at an event.
+// It's the body of the requests made by the webhook reporter.
+type tryReport struct {
+	Event     tryEvent `json:"event"`
+	Project   string   `json:"project"`  // "go", "net", etc.
+	Branch    string   `json:"branch"`   // "master"
+	ChangeID  string   `json:"changeID"` // Gerrit Change-Id
+	Commit    string   `json:"commit"`
+	StatusURL string   `json:"statusURL"`
+	// Message describes the event for humans, as posted to Gerrit.
+	Message string `json:"message"`
+	// Total is the number of builds, and Remain the number of
+	// those still running.
+	Total  int `json:"total"`
+	Remain int `json:"remain"`
+	// Failed are the builds that have failed so far.
+	Failed []tryFailure `json:"failed,omitempty"`
+}
+
+// A tryFailure is a failed build of a trySet.
+type tryFailure struct {
+	Builder string `json:"builder"` // builder name, with optional " ($branch)" suffix
+	LogURL  string `json:"logURL"`
+	// Diagnostics are the errors at source positions found in the
+	// build's log.
+	Diagnostics []tryDiagnostic `json:"diagnostics,omitempty"`
+}
+
+// passed reports whether r is the final report of a trySet whose
+// builds all succeeded.
+func (r *tryReport) passed() bool {
+	return r.Event == tryFinished && len(r.Failed) == 0
+}
+
+func (r *tryReport) changeTriple() string {
+	return (&tryKey{Project: r.Project, Branch: r.Branch, ChangeID: r.ChangeID}).ChangeTriple()
+}
+
+// A reporter reports TryBot results to a place where contributors
+// will see them.
+type reporter interface {
+	// name returns the name of the reporter in -try-reporters.
+	name() string
+	// report reports r. It's called in order for the events of a
+	// trySet, but may be called concurrently for different trySets.
+	report(ctx context.Context, r *tryReport) error
+}
+
+// tryReporters holds the reporters of each project. It's initialized
+// by initTryReporters; until then, results aren't reported.
+var tryReporters reporterSet
+
+// A reporterSet maps from a Gerrit project name to the reporters of
+// its TryBot results.
+type reporterSet struct {
+	byProject map[string][]reporter
+	def       []reporter // for projects not in byProject
+}
+
+func (s *reporterSet) forProject(proj string) []reporter {
+	if rs, ok := s.byProject[proj]; ok {
+		return rs
+	}
+	return s.def
+}
+
+// report sends r to each of the reporters of its project.
+// Failures are logged.
+func (s *reporterSet) report(ctx context.Context, r *tryReport) {
+	for _, rep := range s.forProject(r.Project) {
+		if err := rep.report(ctx, r); err != nil {
+			log.Printf("%s reporter: error reporting %s event of %s: %v", rep.name(), r.Event, r.Commit[:8], err)
+		}
+	}
+}
+
+// parseTryReporters parses the value of the -try-reporters flag,
+// returning the names of the reporters of each project it lists.
+func parseTryReporters(spec string) (map[string][]string, error) {
+	m := make(map[string][]string)
+	for _, f := range strings.Fields(spec) {
+		proj, names, ok := strings.Cut(f, "=")
+		if !ok || proj == "" || names == "" {
+			return nil, fmt.Errorf("%q is not of the form project=reporter,...", f)
+		}
+		r := repos.ByGerritProject[proj]
+		if r == nil {
+			return nil, fmt.Errorf("unknown project %q", proj)
+		}
+		if _, dup := m[proj]; dup {
+			return nil, fmt.Errorf("project %q is listed more than once", proj)
+		}
+		for _, name := range strings.Split(names, ",") {
+			switch name {
+			case "gerrit", "webhook":
+			case "github":
+				if r.GitHubRepo == "" {
+					return nil, fmt.Errorf("project %q has no GitHub repo to report to", proj)
+				}
+			default:
+				return nil, fmt.Errorf("unknown reporter %q for project %q", name, proj)
+			}
+			m[proj] = append(m[proj], name)
+		}
+	}
+	return m, nil
+}
+
+// initTryReporters initializes tryReporters from the -try-reporters
+// flag. Only the reporters that are used are created.
+func initTryReporters(ctx context.Context, sc *secret.Client, gerritClient *gerrit.Client) error {
+	names, err := parseTryReporters(*tryReportersFlag)
+	if err != nil {
+		return fmt.Errorf("invalid -try-reporters: %v", err)
+	}
+	gr := &gerritReporter{c: gerritClient}
+	created := map[string]reporter{"gerrit": gr}
+	get := func(name string) (reporter, error) {
+		if r, ok := created[name]; ok {
+			return r, nil
+		}
+		var r reporter
+		switch name {
+		case "webhook":
+			if *tryWebhookURL == "" {
+				return nil, errors.New("the webhook reporter requires -try-webhook-url")
+			}
+			r = &webhookReporter{url: *tryWebhookURL, hc: &http.Client{Timeout: 30 * time.Second}}
+		case "github":
+			if *githubAppID == 0 || *githubAppInstallation == 0 {
+				return nil, errors.New("the github reporter requires -github-checks-app-id and -github-checks-app-installation")
+			}
+			pemKey, err := sc.Retrieve(ctx, secret.NameGitHubChecksAppKey)
+			if err != nil {
+				return nil, fmt.Errorf("retrieving secret %q: %v", secret.NameGitHubChecksAppKey, err)
+			}
+			key, err := parseRSAPrivateKey([]byte(pemKey))
+			if err != nil {
+				return nil, fmt.Errorf("secret %q: %v", secret.NameGitHubChecksAppKey, err)
+			}
+			ts := &githubAppTokenSource{appID: *githubAppID, installationID: *githubAppInstallation, key: key}
+			r = newGitHubChecksReporter(github.NewClient(oauth2.NewClient(ctx, oauth2.ReuseTokenSource(nil, ts))), gerritClient)
+		}
+		created[name] = r
+		return r, nil
+	}
+	tryReporters = reporterSet{byProject: make(map[string][]reporter), def: []reporter{gr}}
+	projs := make([]string, 0, len(names))
+	for proj := range names {
+		projs = append(projs, proj)
+	}
+	sort.Strings(projs)
+	for _, proj := range projs {
+		for _, name := range names[proj] {
+			r, err := get(name)
+			if err != nil {
+				return err
+			}
+			tryReporters.byProject[proj] = append(tryReporters.byProject[proj], r)
+		}
+		log.Printf("Reporting TryBot results of %s to %s", proj, strings.Join(names[proj], ", "))
+	}
+	return nil
+}
+
+// gerritReporter reports TryBot results as comments on the CL, and
+// its final result as a TryBot-Result vote.
+type gerritReporter struct {
+	c *gerrit.Client
+}
+
+func (g *gerritReporter) name() string { return "gerrit" }
+
+func (g *gerritReporter) report(ctx context.Context, r *tryReport) error {
+	var tag string
+	switch {
+	case r.Event == tryStarted:
+		tag = tryBotsTag("beginning")
+	case r.Event == tryProgress:
+		tag = tryBotsTag("progress")
+	case r.passed():
+		tag = tryBotsTag("happy")
+	default:
+		tag = tryBotsTag("failed")
+	}
+	// Mark resolved if TryBots are happy.
+	unresolved := !r.passed()
+	comment := gerrit.CommentInput{Message: r.Message, Unresolved: &unresolved}
+	ri := gerrit.ReviewInput{Tag: tag}
+	if r.Event == tryFinished {
+		score := -1
+		if r.passed() {
+			score = 1
+		}
+		ri.Labels = map[string]int{"TryBot-Result": score}
+	}
+
+	threads, err := listPatchSetThreads(g.c, r.changeTriple())
+	if err != nil {
+		log.Printf("Error getting Gerrit threads on %s: %v", r.changeTriple(), err)
+	}
+	var superseded []gerrit.CommentInput
+	for _, t := range threads {
+		switch r.Event {
+		case tryStarted:
+			// Mark as resolved old TryBot threads that don't have human comments on them.
+			if !t.unresolved {
+				continue
+			}
+			hasHumanComments := false
+			for _, c := range t.thread {
+				if !isTryBotsTag(c.Tag) {
+					hasHumanComments = true
+					break
+				}
+			}
+			if hasHumanComments {
+				continue
+			}
+			resolved := false
+			superseded = append(superseded, gerrit.CommentInput{
+				InReplyTo:  t.root.ID,
+				Message:    "Superseded.",
+				Unresolved: &resolved,
+			})
+		default:
+			// Reply to the thread of this run's "beginning" comment.
+			if t.root.Tag == tryBotsTag("beginning") && strings.Contains(t.root.Message, r.StatusURL) {
+				comment.InReplyTo = t.root.ID
+			}
+		}
+	}
+	ri.Comments = map[string][]gerrit.CommentInput{}
+	inline := false
+	if r.Event == tryFinished && len(r.Failed) > 0 {
+		// Point out the errors on the offending lines, too.
+		if files, err := g.c.ListFiles(ctx, r.changeTriple(), r.Commit); err != nil {
+			log.Printf("Error listing files of %s: %v", r.changeTriple(), err)
+		} else {
+			var paths []string
+			for path, fi := range files {
+				if !strings.HasPrefix(path, "/") && fi.Status != "D" {
+					paths = append(paths, path)
+				}
+			}
+			ri.Comments = inlineComments(r.Failed, paths)
+			inline = len(ri.Comments) > 0
+		}
+	}
+	patchSetComments := append([]gerrit.CommentInput{comment}, superseded...)
+	ri.Comments["/PATCHSET_LEVEL"] = patchSetComments
+	err = g.c.SetReview(ctx, r.changeTriple(), r.Commit, ri)
+	if err != nil && inline {
+		// Gerrit rejects the whole review if it rejects any
+		// comment, such as one on a line the file doesn't have.
+		// The inline comments are only a convenience, so don't
+		// let them cost the vote.
+		log.Printf("Error setting review with inline comments on %s: %v; retrying without them", r.changeTriple(), err)
+		ri.Comments = map[string][]gerrit.CommentInput{"/PATCHSET_LEVEL": patchSetComments}
+		err = g.c.SetReview(ctx, r.changeTriple(), r.Commit, ri)
+	}
+	return err
+}
+
+// githubChecksCheckName is the name of the check runs created by
+// githubChecksReporter.
+const githubChecksCheckName = "TryBots"
+
+// githubLastRevFooter is the footer that gerritbot adds to the commit
+// messages of the CLs it imports from GitHub pull requests, naming the
+// head commit of the pull request.
+const githubLastRevFooter = "GitHub-Last-Rev:"
+
+// githubChecksReporter reports TryBot results as a check run on the
+// commit in the project's GitHub repo, for repos that take
+// contributions as GitHub pull requests.
+//
+// The commits that TryBots test are the ones gerritbot creates in
+// Gerrit, which GitHub doesn't have, so the check runs are on the head
+// commits of the pull requests they were imported from instead.
+type githubChecksReporter struct {
+	c      *github.Client
+	gerrit *gerrit.Client // to look up the pull request of a commit
+
+	mu   sync.Mutex
+	runs map[string]int64 // check run IDs of in-progress trySets, keyed by GitHub repo and commit
+}
+
+func newGitHubChecksReporter(c *github.Client, gerritClient *gerrit.Client) *githubChecksReporter {
+	return &githubChecksReporter{c: c, gerrit: gerritClient, runs: make(map[string]int64)}
+}
+
+// headSHA returns the head commit of the pull request that the commit
+// of r was imported from, as recorded by gerritbot in its commit
+// message.
+func (g *githubChecksReporter) headSHA(ctx context.Context, r *tryReport) (string, error) {
+	ci, err := g.gerrit.GetChange(ctx, r.changeTriple(), gerrit.QueryChangesOpt{Fields: []string{"ALL_REVISIONS", "ALL_COMMITS"}})
+	if err != nil {
+		return "", err
+	}
+	rev, ok := ci.Revisions[r.Commit]
+	if !ok || rev.Commit == nil {
+		return "", fmt.Errorf("change %s has no revision %s", r.changeTriple(), r.Commit)
+	}
+	for _, line := range strings.Split(rev.Commit.Message, "\n") {
+		if sha, ok := strings.CutPrefix(line, githubLastRevFooter); ok {
+			return strings.TrimSpace(sha), nil
+		}
+	}
+	return "", fmt.Errorf("commit %s of %s wasn't imported from a GitHub pull request: it has no %s footer", r.Commit, r.changeTriple(), githubLastRevFooter)
+}
+
+func (g *githubChecksReporter) name() string { return "github" }
+
+func (g *githubChecksReporter) report(ctx context.Context, r *tryReport) error {
+	repo := repos.ByGerritProject[r.Project]
+	if repo == nil || repo.GitHubRepo == "" {
+		return fmt.Errorf("project %q has no GitHub repo", r.Project)
+	}
+	owner, name, _ := strings.Cut(repo.GitHubRepo, "/")
+	key := repo.GitHubRepo + "@" + r.Commit
+
+	title := fmt.Sprintf("%d of %d builds done", r.Total-r.Remain, r.Total)
+	if len(r.Failed) > 0 {
+		title += fmt.Sprintf(", %d failed", len(r.Failed))
+	}
+	output := &github.CheckRunOutput{Title: &title, Summary: github.String(r.Message)}
+	status := "in_progress"
+	var conclusion *string
+	var completedAt *github.Timestamp
+	if r.Event == tryFinished {
+		status = "completed"
+		conclusion = github.String("failure")
+		if r.passed() {
+			conclusion = github.String("success")
+		}
+		completedAt = &github.Timestamp{Time: time.Now()}
+	}
+
+	g.mu.Lock()
+	id, ok := g.runs[key]
+	if r.Event == tryFinished {
+		delete(g.runs, key)
+	}
+	g.mu.Unlock()
+
+	if ok {
+		_, _, err := g.c.Checks.UpdateCheckRun(ctx, owner, name, id, github.UpdateCheckRunOptions{
+			Name:        githubChecksCheckName,
+			DetailsURL:  &r.StatusURL,
+			Status:      &status,
+			Conclusion:  conclusion,
+			CompletedAt: completedAt,
+			Output:      output,
+		})
+		return err
+	}
+	// Create a check run at the start of a trySet, or later if the
+	// coordinator restarted after the start.
+	headSHA, err := g.headSHA(ctx, r)
+	if err != nil {
+		return err
+	}
+	run, _, err := g.c.Checks.CreateCheckRun(ctx, owner, name, github.CreateCheckRunOptions{
+		Name:        githubChecksCheckName,
+		HeadSHA:     headSHA,
+		DetailsURL:  &r.StatusURL,
+		ExternalID:  github.String(r.ChangeID),
+		Status:      &status,
+		Conclusion:  conclusion,
+		CompletedAt: completedAt,
+		Output:      output,
+	})
+	if err != nil {
+		return err
+	}
+	if r.Event != tryFinished {
+		g.mu.Lock()
+		g.runs[key] = run.GetID()
+		g.mu.Unlock()
+	}
+	return nil
+}
+
+// githubAppTokenSource is an oauth2.TokenSource of access tokens for
+// an installation of a GitHub App.
+type githubAppTokenSource struct {
+	appID          int64
+	installationID int64
+	key            *rsa.PrivateKey
+	baseURL        *url.URL // GitHub API URL; nil means the default
+}
+
+func (s *githubAppTokenSource) Token() (*oauth2.Token, error) {
+	jwt, err := s.jwt(time.Now())
+	if err != nil {
+		return nil, err
+	}
+	c := github.NewClient(oauth2.NewClient(context.Background(), oauth2.StaticTokenSource(&oauth2.Token{AccessToken: jwt})))
+	if s.baseURL != nil {
+		c.BaseURL = s.baseURL
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	tok, _, err := c.Apps.CreateInstallationToken(ctx, s.installationID, nil)
+	if err != nil {
+		return nil, fmt.Errorf("creating GitHub App installation token: %v", err)
+	}
+	return &oauth2.Token{AccessToken: tok.GetToken(), Expiry: tok.GetExpiresAt()}, nil
+}
+
+// jwt returns a JSON Web Token that authenticates as the GitHub App
+// at time now, as described at
+// https://docs.github.com/en/apps/creating-github-apps/authenticating-with-a-github-app/generating-a-json-web-token-jwt-for-a-github-app.
+func (s *githubAppTokenSource) jwt(now time.Time) (string, error) {
+	enc := func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return base64.RawURLEncoding.EncodeToString(b), err
+	}
+	header, err := enc(map[string]string{"alg": "RS256", "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+	claims, err := enc(map[string]int64{
+		"iat": now.Add(-time.Minute).Unix(), // allow for clock drift
+		"exp": now.Add(9 * time.Minute).Unix(),
+		"iss": s.appID,
+	})
+	if err != nil {
+		return "", err
+	}
+	signed := header + "." + claims
+	sum := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, s.key, crypto.SHA256, sum[:])
+	if err != nil {
+		return "", err
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+// parseRSAPrivateKey parses a PEM-encoded RSA private key in PKCS #1
+// form, as GitHub provides them, or PKCS #8 form.
+func parseRSAPrivateKey(data []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("got a %T, want an RSA private key", key)
+	}
+	return rsaKey, nil
+}
+
+// webhookReporter reports TryBot results by POSTing each tryReport as
+// JSON to a URL.
+type webhookReporter struct {
+	url string
+	hc  *http.Client
+}
+
+func (w *webhookReporter) name() string { return "webhook" }
+
+func (w *webhookReporter) report(ctx context.Context, r *tryReport) error {
+	body, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := w.hc.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(res.Body, 1<<10))
+		return fmt.Errorf("POST %s: %s: %s", w.url, res.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
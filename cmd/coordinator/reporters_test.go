@@ -0,0 +1,414 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.16 && (linux || darwin)
+// +build go1.16
+// +build linux darwin
+
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-github/v48/github"
+	"golang.org/x/build/gerrit"
+)
+
+func TestParseTryReporters(t *testing.T) {
+	for _, tt := range []struct {
+		spec    string
+		want    map[string][]string
+		wantErr string
+	}{
+		{spec: "", want: map[string][]string{}},
+		{
+			spec: "vscode-go=gerrit,github  net=webhook",
+			want: map[string][]string{"vscode-go": {"gerrit", "github"}, "net": {"webhook"}},
+		},
+		{spec: "vscode-go", wantErr: `"vscode-go" is not of the form project=reporter,...`},
+		{spec: "nosuchproject=gerrit", wantErr: `unknown project "nosuchproject"`},
+		{spec: "net=gerrit net=webhook", wantErr: `project "net" is listed more than once`},
+		{spec: "net=email", wantErr: `unknown reporter "email" for project "net"`},
+	} {
+		got, err := parseTryReporters(tt.spec)
+		if tt.wantErr != "" {
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("parseTryReporters(%q) = %v, %v; want error %q", tt.spec, got, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseTryReporters(%q) = %v", tt.spec, err)
+			continue
+		}
+		if diff := cmp.Diff(tt.want, got); diff != "" {
+			t.Errorf("parseTryReporters(%q) mismatch (-want +got):\n%s", tt.spec, diff)
+		}
+	}
+}
+
+func TestGerritReporter(t *testing.T) {
+	var review gerrit.ReviewInput
+	rejectInline := false // whether to reject reviews with inline comments
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		switch {
+		case r.Method == "GET" && strings.HasSuffix(r.URL.Path, "/comments"):
+			w.Write(listPatchSetThreadsResponse)
+		case r.Method == "GET" && strings.HasSuffix(r.URL.Path, "/files"):
+			w.Write([]byte(`)]}'
+{"/COMMIT_MSG": {"status": "A"}, "src/cmd/go/build.go": {}, "src/cmd/go/old.go": {"status": "D"}}`))
+		case r.Method == "POST" && strings.HasSuffix(r.URL.Path, "/review"):
+			review = gerrit.ReviewInput{}
+			if err := json.NewDecoder(r.Body).Decode(&review); err != nil {
+				t.Errorf("decoding review: %v", err)
+			}
+			if rejectInline && len(review.Comments) > 1 {
+				http.Error(w, "range (line 12) is not in file", http.StatusBadRequest)
+				return
+			}
+			w.Write([]byte(")]}'\n{}"))
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL)
+			http.NotFound(w, r)
+		}
+	}))
+	defer s.Close()
+	g := &gerritReporter{c: gerrit.NewClient(s.URL, gerrit.NoAuth)}
+
+	r := &tryReport{
+		Event:     tryFinished,
+		Project:   "go",
+		Branch:    "master",
+		ChangeID:  "I92400996cb051ab30e99bfffafd91ff32a1e7087",
+		Commit:    "39ad506d874d4711015184f52585b4215c9b84cc",
+		StatusURL: "https://farmer.golang.org/try?commit=39ad506d",
+		Message:   "1 of 2 TryBots failed.",
+		Total:     2,
+		Failed: []tryFailure{{
+			Builder: "linux-amd64",
+			LogURL:  "https://example.com/log",
+			Diagnostics: []tryDiagnostic{
+				{Path: "cmd/go/build.go", Line: 12, Message: "undefined: x"},
+				{Path: "cmd/go/old.go", Line: 3, Message: "in a deleted file"},
+			},
+		}},
+	}
+	if err := g.report(context.Background(), r); err != nil {
+		t.Fatalf("report: %v", err)
+	}
+	unresolved := true
+	wantInline := []gerrit.CommentInput{{Line: 12, Message: "undefined: x\n\nReported by linux-amd64.", Unresolved: &unresolved}}
+	if diff := cmp.Diff(wantInline, review.Comments["src/cmd/go/build.go"]); diff != "" || len(review.Comments) != 2 {
+		t.Errorf("inline comments in %v mismatch (-want +got):\n%s", review.Comments, diff)
+	}
+	if review.Tag != tryBotsTag("failed") {
+		t.Errorf("review tag = %q, want %q", review.Tag, tryBotsTag("failed"))
+	}
+	if diff := cmp.Diff(map[string]int{"TryBot-Result": -1}, review.Labels); diff != "" {
+		t.Errorf("review labels mismatch (-want +got):\n%s", diff)
+	}
+	comments := review.Comments["/PATCHSET_LEVEL"]
+	if len(comments) != 1 {
+		t.Fatalf("got %d comments, want 1", len(comments))
+	}
+	if c := comments[0]; c.Message != r.Message || c.InReplyTo != "aaf7aa39_658707c2" || c.Unresolved == nil || !*c.Unresolved {
+		t.Errorf("comment = %+v, want unresolved reply to aaf7aa39_658707c2 with message %q", c, r.Message)
+	}
+
+	// If Gerrit rejects an inline comment, the vote is still set.
+	rejectInline = true
+	review = gerrit.ReviewInput{}
+	if err := g.report(context.Background(), r); err != nil {
+		t.Fatalf("report with a rejected inline comment: %v", err)
+	}
+	if len(review.Comments) != 1 || len(review.Comments["/PATCHSET_LEVEL"]) != 1 {
+		t.Errorf("comments after a rejected inline comment = %v; want only the patch set comment", review.Comments)
+	}
+	if diff := cmp.Diff(map[string]int{"TryBot-Result": -1}, review.Labels); diff != "" {
+		t.Errorf("review labels after a rejected inline comment mismatch (-want +got):\n%s", diff)
+	}
+	rejectInline = false
+
+	review = gerrit.ReviewInput{}
+	r.Event, r.Failed = tryStarted, nil
+	if err := g.report(context.Background(), r); err != nil {
+		t.Fatalf("report: %v", err)
+	}
+	if review.Tag != tryBotsTag("beginning") || review.Labels != nil {
+		t.Errorf("review for started event = %+v, want tag %q and no labels", review, tryBotsTag("beginning"))
+	}
+}
+
+func TestParseDiagnostics(t *testing.T) {
+	const buildLog = `##### Building packages.
+# cmd/go/internal/work
+./build.go:12:3: undefined: x
+./build.go:12:3: undefined: x
+vet: net/http/server.go:123:2: unreachable code
+--- FAIL: TestFoo (0.00s)
+    foo_test.go:45: got 1, want 2
+panic: oops
+	/workdir/go/src/runtime/proc.go:250 +0x1a
+/workdir/go/src/os/file.go:7: absolute
+x.go:0: no such line
+`
+	want := []tryDiagnostic{
+		{Path: "build.go", Line: 12, Message: "undefined: x"},
+		{Path: "net/http/server.go", Line: 123, Message: "unreachable code"},
+		{Path: "foo_test.go", Line: 45, Message: "got 1, want 2"},
+		{Path: "/workdir/go/src/os/file.go", Line: 7, Message: "absolute"},
+	}
+	if diff := cmp.Diff(want, parseDiagnostics(buildLog)); diff != "" {
+		t.Errorf("parseDiagnostics mismatch (-want +got):\n%s", diff)
+	}
+
+	var long strings.Builder
+	for i := 1; i <= 2*maxDiagnostics; i++ {
+		fmt.Fprintf(&long, "x.go:%d: error\n", i)
+	}
+	if got := parseDiagnostics(long.String()); len(got) != maxDiagnostics {
+		t.Errorf("parseDiagnostics of %d errors returned %d, want %d", 2*maxDiagnostics, len(got), maxDiagnostics)
+	}
+}
+
+func TestChangedFile(t *testing.T) {
+	files := []string{"src/net/http/server.go", "src/net/http/server_test.go", "src/os/file.go", "src/io/fs/file.go", "file.go"}
+	for _, tt := range []struct {
+		path, want string
+	}{
+		{"net/http/server.go", "src/net/http/server.go"},
+		{"./server_test.go", "src/net/http/server_test.go"},
+		{"/workdir/go/src/os/file.go", "src/os/file.go"},
+		{"file.go", "file.go"}, // exact matches win
+		{"fs/file.go", "src/io/fs/file.go"},
+		{"http/client.go", ""},
+		{"erver.go", ""},
+	} {
+		got, ok := changedFile(tt.path, files)
+		if got != tt.want || ok != (tt.want != "") {
+			t.Errorf("changedFile(%q) = %q, %v; want %q", tt.path, got, ok, tt.want)
+		}
+	}
+	if got, ok := changedFile("file.go", files[2:4]); ok {
+		t.Errorf("changedFile of an ambiguous path = %q, want no match", got)
+	}
+}
+
+func TestInlineComments(t *testing.T) {
+	failures := []tryFailure{
+		{Builder: "linux-amd64", Diagnostics: []tryDiagnostic{{Path: "a.go", Line: 1, Message: "bad"}, {Path: "b.go", Line: 2, Message: "worse"}}},
+		{Builder: "windows-386", Diagnostics: []tryDiagnostic{{Path: "a.go", Line: 1, Message: "bad"}, {Path: "elsewhere.go", Line: 3, Message: "not in the change"}}},
+	}
+	unresolved := true
+	want := map[string][]gerrit.CommentInput{
+		"a.go": {{Line: 1, Message: "bad\n\nReported by linux-amd64, windows-386.", Unresolved: &unresolved}},
+		"b.go": {{Line: 2, Message: "worse\n\nReported by linux-amd64.", Unresolved: &unresolved}},
+	}
+	if diff := cmp.Diff(want, inlineComments(failures, []string{"a.go", "b.go"})); diff != "" {
+		t.Errorf("inlineComments mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestGitHubChecksReporter(t *testing.T) {
+	var (
+		mu   sync.Mutex
+		reqs []string // method, path, and status of each request
+	)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Name       string `json:"name"`
+			HeadSHA    string `json:"head_sha"`
+			Status     string `json:"status"`
+			Conclusion string `json:"conclusion"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("decoding request body: %v", err)
+		}
+		mu.Lock()
+		reqs = append(reqs, fmt.Sprintf("%s %s %s %s %s", r.Method, r.URL.Path, body.HeadSHA, body.Status, body.Conclusion))
+		mu.Unlock()
+		if body.Name != githubChecksCheckName {
+			t.Errorf("check run name = %q, want %q", body.Name, githubChecksCheckName)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id": 7}`))
+	}))
+	defer s.Close()
+	c := github.NewClient(nil)
+	c.BaseURL, _ = url.Parse(s.URL + "/")
+	// The Gerrit commits were imported from pull requests whose head
+	// commits are their reverse.
+	gs := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		w.Write([]byte(`)]}'
+{"revisions": {
+	"abcdef0123456789": {"commit": {"message": "x/y: fix\n\nGitHub-Last-Rev: 9876543210fedcba\nGitHub-Pull-Request: golang/vscode-go#1\n"}},
+	"0123456789abcdef": {"commit": {"message": "x/y: fix\n\nGitHub-Last-Rev: fedcba9876543210\n"}}
+}}`))
+	}))
+	defer gs.Close()
+	g := newGitHubChecksReporter(c, gerrit.NewClient(gs.URL, gerrit.NoAuth))
+
+	r := &tryReport{Event: tryStarted, Project: "vscode-go", Branch: "master", ChangeID: "I0123", Commit: "abcdef0123456789", Total: 2, Remain: 2}
+	for _, ev := range []tryEvent{tryStarted, tryProgress, tryFinished} {
+		r.Event = ev
+		if ev != tryStarted {
+			r.Remain--
+			r.Failed = []tryFailure{{Builder: "linux-amd64"}}
+		}
+		if err := g.report(context.Background(), r); err != nil {
+			t.Fatalf("report of %s event: %v", ev, err)
+		}
+	}
+	// A finished trySet whose start wasn't reported gets a new check run.
+	r.Commit, r.Failed = "0123456789abcdef", nil
+	if err := g.report(context.Background(), r); err != nil {
+		t.Fatalf("report: %v", err)
+	}
+
+	want := []string{
+		"POST /repos/golang/vscode-go/check-runs 9876543210fedcba in_progress ",
+		"PATCH /repos/golang/vscode-go/check-runs/7  in_progress ",
+		"PATCH /repos/golang/vscode-go/check-runs/7  completed failure",
+		"POST /repos/golang/vscode-go/check-runs fedcba9876543210 completed success",
+	}
+	if diff := cmp.Diff(want, reqs); diff != "" {
+		t.Errorf("requests mismatch (-want +got):\n%s", diff)
+	}
+	if len(g.runs) != 0 {
+		t.Errorf("check runs of finished trySets weren't forgotten: %v", g.runs)
+	}
+}
+
+func TestGitHubAppTokenSource(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expiry := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.URL.Path != "/app/installations/42/access_tokens" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL)
+		}
+		jwt := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		parts := strings.Split(jwt, ".")
+		if len(parts) != 3 {
+			t.Errorf("malformed JWT %q", jwt)
+			return
+		}
+		sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		sum := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+		if err := rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, sum[:], sig); err != nil {
+			t.Errorf("JWT signature doesn't verify: %v", err)
+		}
+		claims, err := base64.RawURLEncoding.DecodeString(parts[1])
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		var c struct{ Iss int64 }
+		if err := json.Unmarshal(claims, &c); err != nil || c.Iss != 1234 {
+			t.Errorf("JWT claims = %s, want issuer 1234", claims)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"token": "installation-token", "expires_at": %q}`, expiry.Format(time.RFC3339))
+	}))
+	defer s.Close()
+
+	base, _ := url.Parse(s.URL + "/")
+	ts := &githubAppTokenSource{appID: 1234, installationID: 42, key: key, baseURL: base}
+	tok, err := ts.Token()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tok.AccessToken != "installation-token" || !tok.Expiry.Equal(expiry) {
+		t.Errorf("Token() = %q expiring at %v, want %q expiring at %v", tok.AccessToken, tok.Expiry, "installation-token", expiry)
+	}
+}
+
+func TestParseRSAPrivateKey(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, block := range []*pem.Block{
+		{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)},
+		{Type: "PRIVATE KEY", Bytes: pkcs8},
+	} {
+		got, err := parseRSAPrivateKey(pem.EncodeToMemory(block))
+		if err != nil || !got.Equal(key) {
+			t.Errorf("parseRSAPrivateKey of %s = %v, want the key", block.Type, err)
+		}
+	}
+	if _, err := parseRSAPrivateKey([]byte("not a key")); err == nil {
+		t.Errorf("parseRSAPrivateKey of garbage succeeded")
+	}
+}
+
+func TestWebhookReporter(t *testing.T) {
+	var got tryReport
+	code := http.StatusOK
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ct := r.Header.Get("Content-Type"); ct != "application/json" {
+			t.Errorf("Content-Type = %q, want application/json", ct)
+		}
+		body, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(body, &got); err != nil {
+			t.Errorf("decoding %s: %v", body, err)
+		}
+		w.WriteHeader(code)
+		io.WriteString(w, "go away")
+	}))
+	defer s.Close()
+	w := &webhookReporter{url: s.URL, hc: s.Client()}
+
+	r := &tryReport{
+		Event:     tryFinished,
+		Project:   "net",
+		Branch:    "master",
+		ChangeID:  "I0123",
+		Commit:    "abcdef0123456789",
+		StatusURL: "https://farmer.golang.org/try?commit=abcdef01",
+		Message:   "TryBots are happy.",
+		Total:     3,
+	}
+	if err := w.report(context.Background(), r); err != nil {
+		t.Fatalf("report: %v", err)
+	}
+	if diff := cmp.Diff(r, &got); diff != "" {
+		t.Errorf("webhook body mismatch (-want +got):\n%s", diff)
+	}
+
+	code = http.StatusForbidden
+	if err := w.report(context.Background(), r); err == nil || !strings.Contains(err.Error(), "403 Forbidden: go away") {
+		t.Errorf("report to a failing webhook = %v, want a 403 error", err)
+	}
+}
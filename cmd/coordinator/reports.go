@@ -0,0 +1,163 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.16 && (linux || darwin)
+// +build go1.16
+// +build linux darwin
+
+// Code related to the monthly health reports of builders.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/build/internal/buildstats"
+	"golang.org/x/build/internal/coordinator/pool"
+)
+
+// currentReportTTL is how long the report of the current month,
+// which is still changing, is cached. Reports of past months are
+// cached until the coordinator restarts.
+const currentReportTTL = time.Hour
+
+// A builderReportsQueryFunc returns the reports of all builders for
+// the month starting at month.
+type builderReportsQueryFunc func(ctx context.Context, month time.Time) ([]*buildstats.BuilderReport, error)
+
+// queryBuilderReportsBigQuery is the builderReportsQueryFunc of the
+// coordinator, which reads the build records synced to BigQuery by
+// cmd/buildstats.
+func queryBuilderReportsBigQuery(ctx context.Context, month time.Time) ([]*buildstats.BuilderReport, error) {
+	return buildstats.QueryBuilderReports(ctx, pool.NewGCEConfiguration().BuildEnv(), month)
+}
+
+// builderReportsCache caches the results of a builderReportsQueryFunc
+// by month.
+type builderReportsCache struct {
+	query builderReportsQueryFunc
+	now   func() time.Time
+
+	mu      sync.Mutex
+	reports map[time.Time]cachedBuilderReports
+}
+
+type cachedBuilderReports struct {
+	reports []*buildstats.BuilderReport
+	asOf    time.Time
+}
+
+func (c *builderReportsCache) get(ctx context.Context, month time.Time) ([]*buildstats.BuilderReport, error) {
+	now := c.now()
+	c.mu.Lock()
+	cr, ok := c.reports[month]
+	c.mu.Unlock()
+	if ok && (cr.asOf.After(month.AddDate(0, 1, 0)) || now.Sub(cr.asOf) < currentReportTTL) {
+		return cr.reports, nil
+	}
+	reports, err := c.query(ctx, month)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	c.reports[month] = cachedBuilderReports{reports: reports, asOf: now}
+	c.mu.Unlock()
+	return reports, nil
+}
+
+// parseReportMonth parses the month parameter of a builder reports
+// request, of the form "2023-05". The default is the last full month.
+func parseReportMonth(s string, now time.Time) (time.Time, error) {
+	if s == "" {
+		now = now.UTC()
+		return time.Date(now.Year(), now.Month()-1, 1, 0, 0, 0, 0, time.UTC), nil
+	}
+	month, err := time.Parse("2006-01", s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid month %q: want YYYY-MM", s)
+	}
+	if month.After(now) {
+		return time.Time{}, fmt.Errorf("invalid month %q: in the future", s)
+	}
+	return month, nil
+}
+
+// handleBuilderReports serves /reports/builders, the monthly health
+// reports of all builders: their availability, average queue latency,
+// failure rates split into infrastructure and test failures, and share
+// of flaky test failures.
+//
+// The month parameter selects the month, as YYYY-MM; the default is
+// the last full month. If the mode parameter is "json", the reports
+// are served as JSON instead of HTML.
+func handleBuilderReports(query builderReportsQueryFunc) http.HandlerFunc {
+	cache := &builderReportsCache{
+		query:   query,
+		now:     time.Now,
+		reports: make(map[time.Time]cachedBuilderReports),
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		month, err := parseReportMonth(r.FormValue("month"), cache.now())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		reports, err := cache.get(r.Context(), month)
+		if err != nil {
+			log.Printf("builder reports for %s: %v", month.Format("2006-01"), err)
+			http.Error(w, "error querying builder reports", http.StatusInternalServerError)
+			return
+		}
+		if reports == nil {
+			reports = []*buildstats.BuilderReport{}
+		}
+		if r.FormValue("mode") == "json" {
+			j, err := json.MarshalIndent(reports, "", "\t")
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.Write(j)
+			return
+		}
+		data := struct {
+			Title             string
+			Month, Prev, Next string
+			Reports           []*buildstats.BuilderReport
+		}{
+			Title:   month.Format("January 2006"),
+			Month:   month.Format("2006-01"),
+			Prev:    month.AddDate(0, -1, 0).Format("2006-01"),
+			Reports: reports,
+		}
+		if next := month.AddDate(0, 1, 0); !next.After(cache.now()) {
+			data.Next = next.Format("2006-01")
+		}
+		var buf bytes.Buffer
+		if err := builderReportsTmpl.Execute(&buf, data); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		buf.WriteTo(w)
+	}
+}
+
+//go:embed templates/reports.html
+var builderReportsTmplStr string
+
+var builderReportsTmpl = template.Must(baseTmpl.New("reports.html").Funcs(template.FuncMap{
+	"percent": func(f float64) string { return fmt.Sprintf("%.1f%%", 100*f) },
+	"seconds": func(s float64) string { return humanDuration(time.Duration(s * float64(time.Second))) },
+}).Parse(builderReportsTmplStr))
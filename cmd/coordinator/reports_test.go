@@ -0,0 +1,102 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.16 && (linux || darwin)
+// +build go1.16
+// +build linux darwin
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.org/x/build/internal/buildstats"
+)
+
+func TestParseReportMonth(t *testing.T) {
+	now := time.Date(2023, time.May, 10, 12, 0, 0, 0, time.UTC)
+	for _, tt := range []struct {
+		in      string
+		want    time.Time
+		wantErr bool
+	}{
+		{in: "", want: time.Date(2023, time.April, 1, 0, 0, 0, 0, time.UTC)},
+		{in: "2023-05", want: time.Date(2023, time.May, 1, 0, 0, 0, 0, time.UTC)},
+		{in: "2022-12", want: time.Date(2022, time.December, 1, 0, 0, 0, 0, time.UTC)},
+		{in: "2023-06", wantErr: true},
+		{in: "May 2023", wantErr: true},
+	} {
+		got, err := parseReportMonth(tt.in, now)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseReportMonth(%q) error = %v; want error %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if !got.Equal(tt.want) {
+			t.Errorf("parseReportMonth(%q) = %v; want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestHandleBuilderReports(t *testing.T) {
+	report := &buildstats.BuilderReport{
+		Builder:         "linux-amd64",
+		Month:           "2023-04",
+		Builds:          100,
+		OK:              90,
+		TestFailures:    6,
+		InfraFailures:   4,
+		Flakes:          3,
+		AvgQueueSeconds: 42,
+		Availability:    0.96,
+	}
+	queries := 0
+	query := func(ctx context.Context, month time.Time) ([]*buildstats.BuilderReport, error) {
+		queries++
+		if want := time.Date(2023, time.April, 1, 0, 0, 0, 0, time.UTC); !month.Equal(want) {
+			t.Errorf("query of month %v; want %v", month, want)
+		}
+		return []*buildstats.BuilderReport{report}, nil
+	}
+	h := handleBuilderReports(query)
+
+	rec := httptest.NewRecorder()
+	h(rec, httptest.NewRequest("GET", "/reports/builders?month=2023-04&mode=json", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("JSON status = %d; want %d", rec.Code, http.StatusOK)
+	}
+	var got []*buildstats.BuilderReport
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("decoding response %q: %v", rec.Body, err)
+	}
+	if diff := cmp.Diff([]*buildstats.BuilderReport{report}, got); diff != "" {
+		t.Errorf("JSON response mismatch (-want +got):\n%s", diff)
+	}
+
+	rec = httptest.NewRecorder()
+	h(rec, httptest.NewRequest("GET", "/reports/builders?month=2023-04", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("HTML status = %d; want %d", rec.Code, http.StatusOK)
+	}
+	for _, want := range []string{"April 2023", "linux-amd64", "96.0%", "42s"} {
+		if !strings.Contains(rec.Body.String(), want) {
+			t.Errorf("HTML response doesn't contain %q", want)
+		}
+	}
+	if queries != 1 {
+		t.Errorf("queried %d times; want 1, for a cached past month", queries)
+	}
+
+	rec = httptest.NewRecorder()
+	h(rec, httptest.NewRequest("GET", "/reports/builders?month=2023-4x", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("invalid month status = %d; want %d", rec.Code, http.StatusBadRequest)
+	}
+}
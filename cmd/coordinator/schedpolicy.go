@@ -0,0 +1,88 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.16 && (linux || darwin)
+// +build go1.16
+// +build linux darwin
+
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+
+	"golang.org/x/build/internal/coordinator/remote"
+	"golang.org/x/build/internal/coordinator/schedule"
+)
+
+// SchedPolicyResponse is the state of the scheduling policy served by
+// /admin/scheduler.
+type SchedPolicyResponse struct {
+	Policy schedule.Policy
+	// Gomotes lists the gomote instances of each user who has any,
+	// ordered by user name.
+	Gomotes []GomoteAllocation
+}
+
+// A GomoteAllocation is the set of gomote instances of a user.
+type GomoteAllocation struct {
+	User      string
+	Limit     int // 0 if there's no limit
+	Instances []string
+}
+
+// handleSchedPolicy serves the scheduling policy of sched and the
+// gomote instances in sp, as JSON. A POST with a schedule.Policy in
+// JSON replaces the policy. Requests must carry the builder master key
+// in their "key" parameter.
+func handleSchedPolicy(sched *schedule.Scheduler, sp *remote.SessionPool, key []byte) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.FormValue("key")), key) != 1 {
+			http.Error(w, "missing or invalid key", http.StatusForbidden)
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPost:
+			var p schedule.Policy
+			if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+				http.Error(w, "invalid policy: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			if err := sched.SetPolicy(p); err != nil {
+				http.Error(w, "invalid policy: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			log.Printf("scheduling policy changed to %+v", p)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		resp := SchedPolicyResponse{Policy: sched.Policy()}
+		byUser := make(map[string]*GomoteAllocation)
+		for _, s := range sp.List() {
+			a, ok := byUser[s.Username]
+			if !ok {
+				a = &GomoteAllocation{User: s.Username, Limit: sched.GomoteInstanceLimit(s.Username)}
+				byUser[s.Username] = a
+			}
+			a.Instances = append(a.Instances, s.ID)
+		}
+		for _, a := range byUser {
+			resp.Gomotes = append(resp.Gomotes, *a)
+		}
+		sort.Slice(resp.Gomotes, func(i, j int) bool { return resp.Gomotes[i].User < resp.Gomotes[j].User })
+
+		w.Header().Set("Content-Type", "application/json")
+		e := json.NewEncoder(w)
+		e.SetIndent("", "\t")
+		if err := e.Encode(resp); err != nil {
+			log.Printf("handleSchedPolicy: %v", err)
+		}
+	}
+}
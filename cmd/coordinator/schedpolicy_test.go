@@ -0,0 +1,70 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.16 && (linux || darwin)
+// +build go1.16
+// +build linux darwin
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"golang.org/x/build/buildlet"
+	"golang.org/x/build/internal/coordinator/pool/queue"
+	"golang.org/x/build/internal/coordinator/remote"
+	"golang.org/x/build/internal/coordinator/schedule"
+)
+
+func TestHandleSchedPolicy(t *testing.T) {
+	defer queue.SetTiers(queue.DefaultTiers)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sp := remote.NewSessionPool(ctx)
+	defer sp.Close()
+	sp.AddSession("accounts.google.com:1", "gopher", "linux-amd64", "host-linux-amd64", &buildlet.FakeClient{})
+	sp.AddSession("accounts.google.com:1", "gopher", "linux-amd64", "host-linux-amd64", &buildlet.FakeClient{})
+	sched := schedule.NewScheduler()
+	h := handleSchedPolicy(sched, sp, []byte("key"))
+
+	rec := httptest.NewRecorder()
+	h(rec, httptest.NewRequest("GET", "/admin/scheduler?key=wrong", nil))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("GET with the wrong key: status %d, want %d", rec.Code, http.StatusForbidden)
+	}
+
+	rec = httptest.NewRecorder()
+	h(rec, httptest.NewRequest("POST", "/admin/scheduler?key=key", strings.NewReader(`{"GomoteInstances": 3, "UserGomoteInstances": {"gopher": 1}}`)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("POST: status %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+	if got := sched.GomoteInstanceLimit("gopher"); got != 1 {
+		t.Errorf("after POST, GomoteInstanceLimit(gopher) = %d, want 1", got)
+	}
+
+	rec = httptest.NewRecorder()
+	h(rec, httptest.NewRequest("GET", "/admin/scheduler?key=key", nil))
+	var resp SchedPolicyResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Policy.GomoteInstances != 3 || len(resp.Gomotes) != 1 {
+		t.Fatalf("GET = %+v, want a limit of 3 and one user", resp)
+	}
+	if g := resp.Gomotes[0]; g.User != "gopher" || g.Limit != 1 || len(g.Instances) != 2 {
+		t.Errorf("GET: gomotes of gopher = %+v, want 2 instances and a limit of 1", g)
+	}
+
+	rec = httptest.NewRecorder()
+	h(rec, httptest.NewRequest("POST", "/admin/scheduler?key=key", strings.NewReader(`{"Tiers": ["nightly"]}`)))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("POST of an invalid policy: status %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,509 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.16 && (linux || darwin)
+// +build go1.16
+// +build linux darwin
+
+package main
+
+// Speculative builds run the post-submit builders of CLs that are
+// about to be submitted, that is, that have been approved and have
+// passed the TryBots, against the current tip of their branch. This
+// detects breakage that the TryBots, which only cover some builders,
+// missed before the CL is submitted, and it lets the post-submit
+// builds of the submitted commit reuse the speculative results when
+// the CL is submitted on top of the tip it was built against. They
+// only run with the -speculative-builds flag, after any post-submit
+// builds waiting for the same buildlets, and are shown on the
+// /speculative page. The first failure of a patch set is reported on
+// its CL.
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"golang.org/x/build/dashboard"
+	"golang.org/x/build/gerrit"
+	"golang.org/x/build/internal/buildgo"
+	"golang.org/x/build/internal/coordinator/pool"
+	"golang.org/x/build/repos"
+)
+
+const (
+	// speculativeQuery finds the CLs that are likely to be
+	// submitted soon.
+	speculativeQuery = "status:open branch:master label:Code-Review=2 label:TryBot-Result=1 -is:wip"
+
+	// speculativeInterval is how often to look for CLs to build
+	// speculatively.
+	speculativeInterval = 5 * time.Minute
+
+	// maxSpeculativeBuilds is the number of speculative builds
+	// that may run at once, so that they don't crowd out
+	// post-submit builds.
+	maxSpeculativeBuilds = 8
+
+	// speculativeResultTTL is how long the results of speculative
+	// builds are kept for reuse after they finish.
+	speculativeResultTTL = 24 * time.Hour
+)
+
+var (
+	speculativeMu sync.Mutex
+	// speculativeResults are the speculative builds, keyed by
+	// builder and the commit of the CL patch set that was built.
+	speculativeResults = map[speculativeKey]*speculativeBuild{}
+	// speculativeSubmitted caches, for each post-submit commit
+	// looked up by reuseSpeculativeResult, the commits of the
+	// patch sets whose builds it may reuse, and their parent. A
+	// nil value means the commit doesn't come from a CL that
+	// could have been built speculatively.
+	speculativeSubmitted = map[string]*submittedPatchSets{}
+	// speculativeReported holds the commits of the patch sets whose
+	// first failed speculative build was reported on their CL.
+	speculativeReported = map[string]bool{}
+
+	speculativeSem = make(chan struct{}, maxSpeculativeBuilds)
+)
+
+type speculativeKey struct {
+	builder string
+	commit  string
+}
+
+// submittedPatchSets are the patch set commits of a submitted CL
+// whose speculative builds stand for the submitted commit.
+type submittedPatchSets struct {
+	commits []string
+	parent  string
+}
+
+// A speculativeBuild is the speculative build of one CL patch set on
+// one builder.
+type speculativeBuild struct {
+	buildgo.BuilderRev
+	Project  string
+	Change   int
+	PatchSet int
+	Commit   string // the patch set's commit; Rev or SubRev
+	Parent   string // the tip of master that the patch set is based on
+	Created  time.Time
+
+	mu       sync.Mutex   // guards following
+	skipped  bool         // the coordinator couldn't run the build
+	st       *buildStatus // while the build runs; it holds the log
+	done     bool         // set once the build finishes
+	finished time.Time
+	ok       bool
+	runTime  time.Duration
+	logURL   string // of the build log, which is only kept in GCS
+	reused   bool   // the result was recorded for the submitted commit
+}
+
+// State describes the state of b: "waiting", "skipped", "running",
+// "ok" or "failed".
+func (b *speculativeBuild) State() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch {
+	case b.skipped:
+		return "skipped"
+	case b.done && b.ok:
+		return "ok"
+	case b.done:
+		return "failed"
+	case b.st == nil:
+		return "waiting"
+	}
+	return "running"
+}
+
+// LogURL returns the URL of b's build log, or the empty string if it
+// isn't done.
+func (b *speculativeBuild) LogURL() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.logURL
+}
+
+// Reused reports whether b's result was recorded on the dashboard
+// for the commit the CL was submitted as.
+func (b *speculativeBuild) Reused() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.reused
+}
+
+// speculativeLoop starts speculative builds of the CLs that are about
+// to be submitted.
+func speculativeLoop() {
+	ticker := time.NewTicker(speculativeInterval)
+	for range ticker.C {
+		if err := findSpeculativeWork(); err != nil {
+			log.Printf("failed to find speculative work: %v", err)
+		}
+	}
+}
+
+// findSpeculativeWork starts the speculative builds of the CLs that
+// are likely to be submitted and haven't been built yet. The builds
+// continue to run in the background after it returns.
+func findSpeculativeWork() error {
+	gerritClient := pool.NewGCEConfiguration().GerritClient()
+	if gerritClient == nil || ignoreAllNewWork || drain.isDraining() {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	cis, err := gerritClient.QueryChanges(ctx, speculativeQuery, gerrit.QueryChangesOpt{
+		N:      100,
+		Fields: []string{"CURRENT_REVISION", "CURRENT_COMMIT"},
+	})
+	if err != nil {
+		return err
+	}
+	goTip, err := getRepoHead("go")
+	if err != nil {
+		return err
+	}
+	heads := map[string]string{"go": goTip}
+
+	now := time.Now()
+	var started []*speculativeBuild
+	speculativeMu.Lock()
+	pruneSpeculativeResultsLocked(now)
+	speculativeMu.Unlock()
+	for _, ci := range cis {
+		if r, ok := repos.ByGerritProject[ci.Project]; !ok || !r.CoordinatorCanBuild {
+			continue
+		}
+		head, ok := heads[ci.Project]
+		if !ok {
+			if head, err = getRepoHead(ci.Project); err != nil {
+				log.Printf("speculative: %v", err)
+				continue
+			}
+			heads[ci.Project] = head
+		}
+		speculativeMu.Lock()
+		for _, b := range speculativeBuildsForChange(ci, head, goTip) {
+			key := speculativeKey{b.Name, b.Commit}
+			if _, ok := speculativeResults[key]; ok {
+				continue
+			}
+			b.Created = now
+			speculativeResults[key] = b
+			started = append(started, b)
+		}
+		speculativeMu.Unlock()
+	}
+	for _, b := range started {
+		go func(b *speculativeBuild) {
+			speculativeSem <- struct{}{}
+			defer func() { <-speculativeSem }()
+			b.build()
+		}(b)
+	}
+	return nil
+}
+
+// pruneSpeculativeResultsLocked forgets the speculative builds that
+// finished more than speculativeResultTTL before now.
+// speculativeMu must be held.
+func pruneSpeculativeResultsLocked(now time.Time) {
+	for key, b := range speculativeResults {
+		b.mu.Lock()
+		expired := (b.done || b.skipped) && now.Sub(b.finished) > speculativeResultTTL
+		b.mu.Unlock()
+		if expired {
+			delete(speculativeResults, key)
+		}
+	}
+	if len(speculativeSubmitted) > 10000 {
+		speculativeSubmitted = map[string]*submittedPatchSets{}
+	}
+	if len(speculativeReported) > 10000 {
+		speculativeReported = map[string]bool{}
+	}
+}
+
+// speculativeBuildsForChange returns the speculative builds of the
+// current patch set of ci on the post-submit builders of its project,
+// or nil if the patch set isn't based on head, the tip of master. A
+// CL to an x/ repo is built against goTip.
+func speculativeBuildsForChange(ci *gerrit.ChangeInfo, head, goTip string) []*speculativeBuild {
+	rev, ok := ci.Revisions[ci.CurrentRevision]
+	if ci.Branch != "master" || !ok || rev.Commit == nil || len(rev.Commit.Parents) != 1 || rev.Commit.Parents[0].CommitID != head {
+		return nil
+	}
+	var builds []*speculativeBuild
+	for _, conf := range dashboard.Builders {
+		if !conf.BuildsRepoPostSubmit(ci.Project, "master", "master") {
+			continue
+		}
+		br := buildgo.BuilderRev{Name: conf.Name, Rev: ci.CurrentRevision}
+		if ci.Project != "go" {
+			br = buildgo.BuilderRev{Name: conf.Name, Rev: goTip, SubName: ci.Project, SubRev: ci.CurrentRevision}
+		}
+		builds = append(builds, &speculativeBuild{
+			BuilderRev: br,
+			Project:    ci.Project,
+			Change:     ci.ChangeNumber,
+			PatchSet:   rev.PatchSetNumber,
+			Commit:     ci.CurrentRevision,
+			Parent:     head,
+		})
+	}
+	sort.Slice(builds, func(i, j int) bool { return builds[i].Name < builds[j].Name })
+	return builds
+}
+
+// build runs b and waits for it to finish.
+func (b *speculativeBuild) build() {
+	skip := func() {
+		b.mu.Lock()
+		b.skipped, b.finished = true, time.Now()
+		b.mu.Unlock()
+	}
+	if !mayBuildRev(b.BuilderRev) {
+		skip()
+		return
+	}
+	st, err := newBuild(b.BuilderRev, commitDetail{RevBranch: "master", SubRevBranch: "master"})
+	if err != nil {
+		log.Printf("speculative: bad build params %v: %v", b.BuilderRev, err)
+		skip()
+		return
+	}
+	st.speculative = true
+	b.mu.Lock()
+	b.st = st
+	b.mu.Unlock()
+	st.start()
+	<-st.ctx.Done()
+
+	done := st.hasEvent(eventDone)
+	st.mu.Lock()
+	ok := st.succeeded
+	st.mu.Unlock()
+	runTime := time.Since(st.startTime)
+	objName := fmt.Sprintf("speculative/%s/%d/%d_%s.log", b.Project, b.Change, b.PatchSet, b.Name)
+	logURL, err := st.saveLog(objName)
+	if err != nil {
+		log.Printf("Failed to write to GCS: %v", err)
+	} else {
+		st.mu.Lock()
+		st.logURL = logURL
+		st.mu.Unlock()
+	}
+	if done && !ok {
+		log.Printf("speculative: CL %d patch set %d failed on %s: %s", b.Change, b.PatchSet, b.Name, logURL)
+		if err := b.reportFailure(logURL); err != nil {
+			log.Printf("speculative: reporting the failure of CL %d patch set %d on %s: %v", b.Change, b.PatchSet, b.Name, err)
+		}
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.finished, b.logURL = time.Now(), logURL
+	b.st = nil
+	if !done {
+		// The build was canceled or didn't run to completion,
+		// so there's no result to reuse.
+		b.skipped = true
+		return
+	}
+	b.done, b.ok, b.runTime = true, ok, runTime
+}
+
+// reportFailure posts a comment on b's CL about its failure, unless
+// another speculative build of the same patch set already failed, so
+// that the author and reviewers learn that it'll likely break the
+// build before it's submitted.
+func (b *speculativeBuild) reportFailure(logURL string) error {
+	gerritClient := pool.NewGCEConfiguration().GerritClient()
+	if gerritClient == nil {
+		return nil
+	}
+	speculativeMu.Lock()
+	reported := speculativeReported[b.Commit]
+	speculativeReported[b.Commit] = true
+	speculativeMu.Unlock()
+	if reported {
+		return nil
+	}
+	msg := fmt.Sprintf("This patch set failed to build on %s on top of the current tip of master, so it will likely break that builder once submitted.\n\nLog: %s\n\nOther builders may fail too; see https://farmer.golang.org/speculative.", b.Name, logURL)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	return gerritClient.SetReview(ctx, fmt.Sprint(b.Change), b.Commit, gerrit.ReviewInput{Message: msg})
+}
+
+// reuseSpeculativeResult records the result of the speculative build
+// that work, a post-submit build, duplicates, if there is one, and
+// reports whether it did. The post-submit build then needn't run. The
+// recorded log refers to the speculative build's log in GCS, so only
+// builds whose log was saved there can be reused.
+func reuseSpeculativeResult(work buildgo.BuilderRev, detail commitDetail) bool {
+	if !*speculate {
+		return false
+	}
+	commit, goRev := work.Rev, ""
+	if work.IsSubrepo() {
+		commit, goRev = work.SubRev, work.Rev
+	}
+	psets, err := submittedPatchSetsOf(work.SubName, commit)
+	if err != nil {
+		log.Printf("speculative: looking up the CL of %s: %v", commit, err)
+		return false
+	}
+	if psets == nil {
+		return false
+	}
+
+	speculativeMu.Lock()
+	var b *speculativeBuild
+	for _, c := range psets.commits {
+		if sb, ok := speculativeResults[speculativeKey{work.Name, c}]; ok {
+			b = sb
+			break
+		}
+	}
+	speculativeMu.Unlock()
+	if b == nil || b.Parent != psets.parent || (goRev != "" && b.Rev != goRev) {
+		return false
+	}
+	b.mu.Lock()
+	if !b.done || b.reused || b.logURL == "" {
+		b.mu.Unlock()
+		return false
+	}
+	b.reused = true
+	ok, logURL, runTime := b.ok, b.logURL, b.runTime
+	b.mu.Unlock()
+
+	buildLog := fmt.Sprintf("Result of the speculative build of CL %d patch set %d (%s) before it was submitted.\n\nLog: %s\n", b.Change, b.PatchSet, b.Commit, logURL)
+	if err := recordResult(work, detail, ok, buildLog, runTime); err != nil {
+		log.Printf("speculative: error recording result of %v: %v", work, err)
+		b.mu.Lock()
+		b.reused = false
+		b.mu.Unlock()
+		return false
+	}
+	log.Printf("speculative: reused the result of CL %d patch set %d for %v", b.Change, b.PatchSet, work)
+	return true
+}
+
+// submittedPatchSetsOf returns the patch sets whose speculative builds
+// stand for commit, submitted to the project (the go repo if project is
+// empty), or nil if there are none. The result is cached.
+func submittedPatchSetsOf(project, commit string) (*submittedPatchSets, error) {
+	speculativeMu.Lock()
+	psets, ok := speculativeSubmitted[commit]
+	speculativeMu.Unlock()
+	if ok {
+		return psets, nil
+	}
+	gerritClient := pool.NewGCEConfiguration().GerritClient()
+	if gerritClient == nil {
+		return nil, nil
+	}
+	if project == "" {
+		project = "go"
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	cis, err := gerritClient.QueryChanges(ctx, fmt.Sprintf("project:%s commit:%s", project, commit), gerrit.QueryChangesOpt{
+		Fields: []string{"ALL_REVISIONS", "ALL_COMMITS"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(cis) == 1 {
+		psets = submittedPatchSetsOfChange(cis[0], commit)
+	}
+	speculativeMu.Lock()
+	speculativeSubmitted[commit] = psets
+	speculativeMu.Unlock()
+	return psets, nil
+}
+
+// submittedPatchSetsOfChange returns the patch sets of ci whose builds
+// stand for commit, the commit ci was submitted as, or nil if there
+// are none. When Gerrit rebases a CL to submit it, the submitted
+// commit is a new patch set with the same parent and tree as the
+// approved one, which differs only in its commit message footers.
+func submittedPatchSetsOfChange(ci *gerrit.ChangeInfo, commit string) *submittedPatchSets {
+	submitted, ok := ci.Revisions[commit]
+	if !ok || submitted.Commit == nil || len(submitted.Commit.Parents) != 1 {
+		return nil
+	}
+	psets := &submittedPatchSets{commits: []string{commit}, parent: submitted.Commit.Parents[0].CommitID}
+	if submitted.Kind != "NO_CODE_CHANGE" && submitted.Kind != "NO_CHANGE" {
+		// The submitted commit's tree differs from the previous
+		// patch set's, so only its own builds stand for it.
+		return psets
+	}
+	for c, rev := range ci.Revisions {
+		if rev.PatchSetNumber == submitted.PatchSetNumber-1 && rev.Commit != nil &&
+			len(rev.Commit.Parents) == 1 && rev.Commit.Parents[0].CommitID == psets.parent {
+			psets.commits = append(psets.commits, c)
+		}
+	}
+	return psets
+}
+
+//go:embed templates/speculative.html
+var speculativeTmplStr string
+
+var speculativeTmpl = template.Must(baseTmpl.New("speculative.html").Funcs(template.FuncMap{
+	"shortSHA": func(rev string) string {
+		if len(rev) > 8 {
+			return rev[:8]
+		}
+		return rev
+	},
+}).Parse(speculativeTmplStr))
+
+func handleSpeculative(w http.ResponseWriter, r *http.Request) {
+	speculativeMu.Lock()
+	builds := make([]*speculativeBuild, 0, len(speculativeResults))
+	for _, b := range speculativeResults {
+		builds = append(builds, b)
+	}
+	speculativeMu.Unlock()
+	sort.Slice(builds, func(i, j int) bool {
+		bi, bj := builds[i], builds[j]
+		if bi.Change != bj.Change {
+			return bi.Change > bj.Change
+		}
+		if bi.PatchSet != bj.PatchSet {
+			return bi.PatchSet > bj.PatchSet
+		}
+		return bi.Name < bj.Name
+	})
+	data := struct {
+		Enabled bool
+		Builds  []*speculativeBuild
+	}{
+		Enabled: *speculate,
+		Builds:  builds,
+	}
+
+	var buf bytes.Buffer
+	if err := speculativeTmpl.Execute(&buf, data); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	buf.WriteTo(w)
+}
@@ -0,0 +1,108 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.16 && (linux || darwin)
+// +build go1.16
+// +build linux darwin
+
+package main
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"golang.org/x/build/dashboard"
+	"golang.org/x/build/gerrit"
+	"golang.org/x/build/internal/buildgo"
+)
+
+func parentCommit(parent string) *gerrit.CommitInfo {
+	return &gerrit.CommitInfo{Parents: []gerrit.CommitInfo{{CommitID: parent}}}
+}
+
+func TestSpeculativeBuildsForChange(t *testing.T) {
+	ci := &gerrit.ChangeInfo{
+		Project:         "net",
+		Branch:          "master",
+		ChangeNumber:    1234,
+		CurrentRevision: "cccccccccc",
+		Revisions: map[string]gerrit.RevisionInfo{
+			"cccccccccc": {PatchSetNumber: 3, Commit: parentCommit("1111111111")},
+		},
+	}
+	builds := speculativeBuildsForChange(ci, "1111111111", "aaaaaaaaaa")
+	var want []string
+	for _, conf := range dashboard.Builders {
+		if conf.BuildsRepoPostSubmit("net", "master", "master") {
+			want = append(want, conf.Name)
+		}
+	}
+	sort.Strings(want)
+	if len(builds) != len(want) || len(want) == 0 {
+		t.Fatalf("got %d builds, want %d", len(builds), len(want))
+	}
+	for i, b := range builds {
+		wantRev := buildgo.BuilderRev{Name: want[i], Rev: "aaaaaaaaaa", SubName: "net", SubRev: "cccccccccc"}
+		if b.BuilderRev != wantRev || b.Change != 1234 || b.PatchSet != 3 || b.Commit != "cccccccccc" || b.Parent != "1111111111" {
+			t.Errorf("build %d is %+v, want %v of CL 1234 patch set 3", i, b, wantRev)
+		}
+	}
+
+	if builds := speculativeBuildsForChange(ci, "2222222222", "aaaaaaaaaa"); builds != nil {
+		t.Errorf("CL based on an old tip got %d builds, want none", len(builds))
+	}
+	ci.Branch = "release-branch.go1.21"
+	if builds := speculativeBuildsForChange(ci, "1111111111", "aaaaaaaaaa"); builds != nil {
+		t.Errorf("CL to a release branch got %d builds, want none", len(builds))
+	}
+}
+
+func TestSubmittedPatchSetsOfChange(t *testing.T) {
+	ci := &gerrit.ChangeInfo{
+		Revisions: map[string]gerrit.RevisionInfo{
+			"c1": {PatchSetNumber: 1, Commit: parentCommit("p0")},
+			"c2": {PatchSetNumber: 2, Commit: parentCommit("p1"), Kind: "REWORK"},
+			"c3": {PatchSetNumber: 3, Commit: parentCommit("p1"), Kind: "NO_CODE_CHANGE"},
+		},
+	}
+	for _, tc := range []struct {
+		commit string
+		want   *submittedPatchSets
+	}{
+		// Gerrit added the footers to patch set 2 to submit it.
+		{"c3", &submittedPatchSets{commits: []string{"c3", "c2"}, parent: "p1"}},
+		// Patch set 2 changed the code of patch set 1.
+		{"c2", &submittedPatchSets{commits: []string{"c2"}, parent: "p1"}},
+		{"c4", nil},
+	} {
+		if got := submittedPatchSetsOfChange(ci, tc.commit); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("submittedPatchSetsOfChange(%s) = %+v, want %+v", tc.commit, got, tc.want)
+		}
+	}
+}
+
+func TestHandleSpeculative(t *testing.T) {
+	defer func(m map[speculativeKey]*speculativeBuild) { speculativeResults = m }(speculativeResults)
+	speculativeResults = map[speculativeKey]*speculativeBuild{}
+	for _, b := range []*speculativeBuild{
+		{BuilderRev: buildgo.BuilderRev{Name: "linux-amd64", Rev: "aaaaaaaaaa", SubName: "net", SubRev: "1111111111"}, Project: "net", Change: 1234, PatchSet: 3, Commit: "1111111111"},
+		{BuilderRev: buildgo.BuilderRev{Name: "linux-386", Rev: "2222222222"}, Project: "go", Change: 1235, PatchSet: 1, Commit: "2222222222", done: true, ok: true, st: new(buildStatus), reused: true},
+	} {
+		speculativeResults[speculativeKey{b.Name, b.Commit}] = b
+	}
+	rec := httptest.NewRecorder()
+	handleSpeculative(rec, httptest.NewRequest("GET", "/speculative", nil))
+	body := rec.Body.String()
+	for _, want := range []string{"net CL 1234/3", "11111111 / go aaaaaaaa", "waiting", "go CL 1235/1", "<td>ok</td>", "<td>yes</td>"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("/speculative page doesn't contain %q:\n%s", want, body)
+		}
+	}
+	if i, j := strings.Index(body, "CL 1235"), strings.Index(body, "CL 1234"); i > j {
+		t.Errorf("/speculative page doesn't list the newest CL first:\n%s", body)
+	}
+}
@@ -140,7 +140,7 @@ func addHealthChecker(mux *http.ServeMux, hc *healthChecker) {
 	mux.Handle("/status/"+hc.ID, healthCheckerHandler(hc))
 }
 
-// basePinErr is the status of the start-up time basepin disk creation
+// basePinErr is the status of the latest basepin disk creation
 // in gce.go. It's of type string; no value means no result yet,
 // empty string means success, and non-empty means an error.
 var basePinErr atomic.Value
@@ -0,0 +1,301 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.16 && (linux || darwin)
+// +build go1.16
+// +build linux darwin
+
+// Code related to retaining TryBot results and the TryBot results API.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"cloud.google.com/go/datastore"
+	"golang.org/x/build/internal/coordinator/pool"
+	"golang.org/x/build/types"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	grpcstatus "google.golang.org/grpc/status"
+)
+
+// recordResult stores the result of bs, a completed build of ts, for
+// the TryBot results API.
+func (ts *trySet) recordResult(bs *buildStatus, logURL string) {
+	if pool.NewGCEConfiguration().DSClient() == nil {
+		return
+	}
+	bs.mu.Lock()
+	r := &types.TryBotResult{
+		TryID:     ts.tryID,
+		Project:   ts.Project,
+		Branch:    ts.Branch,
+		ChangeID:  ts.ChangeID,
+		Patchset:  ts.patchset,
+		Commit:    ts.Commit,
+		Builder:   bs.Name,
+		Result:    "fail",
+		StartTime: bs.startTime,
+		EndTime:   bs.done,
+		Seconds:   bs.done.Sub(bs.startTime).Seconds(),
+		LogURL:    logURL,
+
+		ManifestURL: bs.manifestURL,
+	}
+	if bs.succeeded {
+		r.Result = "ok"
+	}
+	bs.mu.Unlock()
+	if bs.hasEvent(eventSkipBuildMissingDep) {
+		r.Result = "skip"
+	}
+	if bs.IsSubrepo() {
+		r.GoCommit = bs.Rev
+		r.GoBranch = bs.RevBranch
+		if ts.Project == "go" {
+			r.SubRepo = bs.SubName
+			r.SubCommit = bs.SubRev
+			r.SubBranch = bs.SubRevBranch
+		}
+	}
+	r.IsSlowBot = bs.isSlowBot()
+	r.CL = ts.changeNumber()
+	pool.CoordinatorProcess().PutTryBotResult(r)
+}
+
+// changeNumber returns the Gerrit change number of ts, looking it up
+// the first time it's needed. It returns 0 if the lookup fails.
+func (ts *trySet) changeNumber() int {
+	ts.mu.Lock()
+	n := ts.clNumber
+	ts.mu.Unlock()
+	gerritClient := pool.NewGCEConfiguration().GerritClient()
+	if n != 0 || gerritClient == nil {
+		return n
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	ci, err := gerritClient.GetChange(ctx, ts.ChangeTriple())
+	if err != nil {
+		log.Printf("looking up the change number of %s: %v", ts.ChangeTriple(), err)
+		return 0
+	}
+	ts.mu.Lock()
+	ts.clNumber = ci.ChangeNumber
+	ts.mu.Unlock()
+	return ci.ChangeNumber
+}
+
+const (
+	defaultTryResults = 100  // results per page if there's no limit parameter
+	maxTryResults     = 1000 // most results per page
+)
+
+// tryResultsFilters are the equality filters of the TryBot results
+// API: the query parameters, the TryBotResult fields they filter on,
+// and how their values are parsed.
+var tryResultsFilters = []struct {
+	param, field string
+	parse        func(string) (interface{}, error)
+}{
+	{"project", "Project", parseString},
+	{"branch", "Branch", parseString},
+	{"change", "ChangeID", parseString},
+	{"cl", "CL", parseInt},
+	{"patchset", "Patchset", parseInt},
+	{"commit", "Commit", parseString},
+	{"builder", "Builder", parseString},
+	{"result", "Result", parseResult},
+	{"slowbot", "IsSlowBot", func(s string) (interface{}, error) { return strconv.ParseBool(s) }},
+}
+
+func parseString(s string) (interface{}, error) { return s, nil }
+func parseInt(s string) (interface{}, error)    { return strconv.Atoi(s) }
+
+func parseResult(s string) (interface{}, error) {
+	switch s {
+	case "ok", "fail", "skip":
+		return s, nil
+	}
+	return nil, fmt.Errorf("want ok, fail, or skip")
+}
+
+// A tryResultsQuery is a query of the TryBot results API, parsed
+// from the parameters of a /try/results.json request.
+type tryResultsQuery struct {
+	Filters      []tryResultsFilter // all must match
+	Since, Until time.Time          // bounds of EndTime; zero means unbounded
+	Limit        int
+	Cursor       string // where to continue a previous query
+}
+
+// A tryResultsFilter requires a TryBotResult field to equal a value.
+type tryResultsFilter struct {
+	Field string
+	Value interface{}
+}
+
+// parseTryResultsQuery parses the query parameters of the TryBot
+// results API.
+func parseTryResultsQuery(v url.Values) (*tryResultsQuery, error) {
+	q := &tryResultsQuery{Limit: defaultTryResults}
+	known := map[string]bool{"since": true, "until": true, "limit": true, "cursor": true}
+	for _, f := range tryResultsFilters {
+		known[f.param] = true
+		if !v.Has(f.param) {
+			continue
+		}
+		val, err := f.parse(v.Get(f.param))
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s %q: %v", f.param, v.Get(f.param), err)
+		}
+		q.Filters = append(q.Filters, tryResultsFilter{Field: f.field, Value: val})
+	}
+	for param := range v {
+		if !known[param] {
+			return nil, fmt.Errorf("unknown parameter %q", param)
+		}
+	}
+	for _, t := range []struct {
+		param string
+		dst   *time.Time
+	}{{"since", &q.Since}, {"until", &q.Until}} {
+		if s := v.Get(t.param); s != "" {
+			var err error
+			if *t.dst, err = time.Parse(time.RFC3339, s); err != nil {
+				return nil, fmt.Errorf("invalid %s %q: want an RFC 3339 time", t.param, s)
+			}
+		}
+	}
+	if s := v.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 || n > maxTryResults {
+			return nil, fmt.Errorf("invalid limit %q: want 1 to %d", s, maxTryResults)
+		}
+		q.Limit = n
+	}
+	q.Cursor = v.Get("cursor")
+	return q, nil
+}
+
+// errInvalidQuery is wrapped by the errors of a tryResultsQueryFunc
+// that are the fault of the query, such as a malformed cursor.
+var errInvalidQuery = errors.New("invalid query")
+
+// A tryResultsQueryFunc runs a query of the TryBot results API,
+// returning the results, most recent first, and the cursor of the
+// next page if there may be more.
+type tryResultsQueryFunc func(context.Context, *tryResultsQuery) (results []*types.TryBotResult, next string, _ error)
+
+// handleTryResults serves /try/results.json, the public API for
+// querying the results of past TryBot runs.
+//
+// Query parameters filter the results: project, branch, change
+// (Change-Id), cl, patchset, commit, builder, result (ok, fail, or
+// skip), and slowbot (true or false) must match exactly, and since and
+// until bound when the builds finished, as RFC 3339 times. Results are
+// ordered most recent first. The response has at most limit results
+// (default 100); if there may be more, its "next" field is the cursor
+// parameter that gets the next page.
+func handleTryResults(query tryResultsQueryFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		if r.Method == "OPTIONS" {
+			// This is likely a pre-flight CORS request.
+			return
+		}
+		var resp struct {
+			Error   string                `json:"error,omitempty"`
+			Results []*types.TryBotResult `json:"results"`
+			Next    string                `json:"next,omitempty"`
+		}
+		code := http.StatusOK
+		q, err := parseTryResultsQuery(r.URL.Query())
+		if err == nil {
+			resp.Results, resp.Next, err = query(r.Context(), q)
+			if err != nil && !errors.Is(err, errInvalidQuery) {
+				log.Printf("TryBot results query %q: %v", r.URL.RawQuery, err)
+				code, err = http.StatusInternalServerError, errors.New("internal error")
+			}
+		}
+		if err != nil {
+			if code == http.StatusOK {
+				code = http.StatusBadRequest
+			}
+			resp.Error, resp.Results, resp.Next = err.Error(), nil, ""
+		}
+		if resp.Results == nil {
+			resp.Results = []*types.TryBotResult{}
+		}
+		var buf bytes.Buffer
+		if err := json.NewEncoder(&buf).Encode(resp); err != nil {
+			log.Printf("Could not encode JSON response: %v", err)
+			http.Error(w, "error encoding JSON", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		w.Write(buf.Bytes())
+	}
+}
+
+// queryTryResultsDatastore is the tryResultsQueryFunc of the
+// coordinator, which reads the results that recordResult stored in
+// datastore.
+func queryTryResultsDatastore(ctx context.Context, q *tryResultsQuery) ([]*types.TryBotResult, string, error) {
+	dsClient := pool.NewGCEConfiguration().DSClient()
+	if dsClient == nil {
+		return nil, "", errors.New("no datastore client")
+	}
+	dq := datastore.NewQuery("TryBotResult")
+	for _, f := range q.Filters {
+		dq = dq.Filter(f.Field+" =", f.Value)
+	}
+	if !q.Since.IsZero() {
+		dq = dq.Filter("EndTime >=", q.Since)
+	}
+	if !q.Until.IsZero() {
+		dq = dq.Filter("EndTime <", q.Until)
+	}
+	dq = dq.Order("-EndTime").Limit(q.Limit)
+	if q.Cursor != "" {
+		c, err := datastore.DecodeCursor(q.Cursor)
+		if err != nil {
+			return nil, "", fmt.Errorf("%w: malformed cursor", errInvalidQuery)
+		}
+		dq = dq.Start(c)
+	}
+	var results []*types.TryBotResult
+	it := dsClient.Run(ctx, dq)
+	for {
+		r := new(types.TryBotResult)
+		_, err := it.Next(r)
+		if err == iterator.Done {
+			break
+		} else if grpcstatus.Code(err) == codes.FailedPrecondition {
+			return nil, "", fmt.Errorf("%w: this combination of filters isn't indexed; see cmd/coordinator/index.yaml", errInvalidQuery)
+		} else if err != nil {
+			return nil, "", err
+		}
+		results = append(results, r)
+	}
+	if len(results) < q.Limit {
+		return results, "", nil
+	}
+	c, err := it.Cursor()
+	if err != nil {
+		return nil, "", err
+	}
+	return results, c.String(), nil
+}
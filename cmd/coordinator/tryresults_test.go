@@ -0,0 +1,136 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.16 && (linux || darwin)
+// +build go1.16
+// +build linux darwin
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.org/x/build/types"
+)
+
+func TestParseTryResultsQuery(t *testing.T) {
+	since := time.Date(2023, time.April, 1, 0, 0, 0, 0, time.UTC)
+	for _, tt := range []struct {
+		query   string
+		want    *tryResultsQuery
+		wantErr string
+	}{
+		{query: "", want: &tryResultsQuery{Limit: defaultTryResults}},
+		{
+			query: "project=go&builder=linux-amd64-race&result=fail&cl=12345&slowbot=false&since=2023-04-01T00:00:00Z&limit=10&cursor=abc",
+			want: &tryResultsQuery{
+				Filters: []tryResultsFilter{
+					{Field: "Project", Value: "go"},
+					{Field: "CL", Value: 12345},
+					{Field: "Builder", Value: "linux-amd64-race"},
+					{Field: "Result", Value: "fail"},
+					{Field: "IsSlowBot", Value: false},
+				},
+				Since:  since,
+				Limit:  10,
+				Cursor: "abc",
+			},
+		},
+		{query: "cl=abc", wantErr: `invalid cl "abc"`},
+		{query: "result=flaky", wantErr: `invalid result "flaky"`},
+		{query: "since=yesterday", wantErr: `invalid since "yesterday"`},
+		{query: "limit=5000", wantErr: `invalid limit "5000"`},
+		{query: "limit=0", wantErr: `invalid limit "0"`},
+		{query: "buidler=linux-amd64", wantErr: `unknown parameter "buidler"`},
+	} {
+		v, err := url.ParseQuery(tt.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := parseTryResultsQuery(v)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("parseTryResultsQuery(%q) = %v, %v; want error containing %q", tt.query, got, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseTryResultsQuery(%q): %v", tt.query, err)
+			continue
+		}
+		if diff := cmp.Diff(tt.want, got); diff != "" {
+			t.Errorf("parseTryResultsQuery(%q) mismatch (-want +got):\n%s", tt.query, diff)
+		}
+	}
+}
+
+func TestHandleTryResults(t *testing.T) {
+	result := &types.TryBotResult{
+		TryID:    "T0123456789",
+		Project:  "go",
+		Branch:   "master",
+		ChangeID: "I1a27695838409259d1586a0adfa9f92bccf7ceba",
+		CL:       12345,
+		Patchset: 2,
+		Commit:   "ecf3dffc81dc21408fb02159af352651882a8383",
+		Builder:  "linux-amd64-race",
+		Result:   "fail",
+		EndTime:  time.Date(2023, time.April, 1, 0, 0, 0, 0, time.UTC),
+		Seconds:  600,
+		LogURL:   "https://farmer.golang.org/log/x",
+	}
+	query := func(ctx context.Context, q *tryResultsQuery) ([]*types.TryBotResult, string, error) {
+		switch q.Cursor {
+		case "":
+			return []*types.TryBotResult{result}, "page2", nil
+		case "page2":
+			return nil, "", nil
+		case "bad":
+			return nil, "", fmt.Errorf("%w: malformed cursor", errInvalidQuery)
+		}
+		return nil, "", errors.New("datastore is down")
+	}
+	type response struct {
+		Error   string                `json:"error"`
+		Results []*types.TryBotResult `json:"results"`
+		Next    string                `json:"next"`
+	}
+	for _, tt := range []struct {
+		query    string
+		wantCode int
+		want     response
+	}{
+		{"builder=linux-amd64-race", http.StatusOK, response{Results: []*types.TryBotResult{result}, Next: "page2"}},
+		{"cursor=page2", http.StatusOK, response{Results: []*types.TryBotResult{}}},
+		{"cl=x", http.StatusBadRequest, response{Error: `invalid cl "x": strconv.Atoi: parsing "x": invalid syntax`, Results: []*types.TryBotResult{}}},
+		{"cursor=bad", http.StatusBadRequest, response{Error: "invalid query: malformed cursor", Results: []*types.TryBotResult{}}},
+		{"cursor=fail", http.StatusInternalServerError, response{Error: "internal error", Results: []*types.TryBotResult{}}},
+	} {
+		rec := httptest.NewRecorder()
+		handleTryResults(query)(rec, httptest.NewRequest("GET", "/try/results.json?"+tt.query, nil))
+		if rec.Code != tt.wantCode {
+			t.Errorf("%q: status = %d; want %d", tt.query, rec.Code, tt.wantCode)
+		}
+		if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "*" {
+			t.Errorf("%q: Access-Control-Allow-Origin = %q; want *", tt.query, got)
+		}
+		var got response
+		if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+			t.Fatalf("%q: decoding response %q: %v", tt.query, rec.Body, err)
+		}
+		if diff := cmp.Diff(tt.want, got); diff != "" {
+			t.Errorf("%q: response mismatch (-want +got):\n%s", tt.query, diff)
+		}
+	}
+}
@@ -0,0 +1,380 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.16 && (linux || darwin)
+// +build go1.16
+// +build linux darwin
+
+// Code related to accounting for the resources used by builds.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/tag"
+	"golang.org/x/build/buildlet"
+)
+
+// maxRecentBuildUsage is how many of the most recent builds usageStore
+// keeps the resource usage of.
+const maxRecentBuildUsage = 5000
+
+// maxBuildTopIO is how many of its commands with the most I/O a
+// buildUsage keeps, and maxTopCommands how many commands with the most
+// I/O across builds /reports/usage serves.
+const (
+	maxBuildTopIO  = 5
+	maxTopCommands = 50
+)
+
+// buildUsage is the resource usage of a finished build.
+type buildUsage struct {
+	BuildID     string    `json:"buildID"`
+	Builder     string    `json:"builder"`
+	HostType    string    `json:"hostType"`
+	Repo        string    `json:"repo"`
+	Rev         string    `json:"rev"`
+	IsTry       bool      `json:"isTry"`
+	StartTime   time.Time `json:"startTime"`
+	Result      string    `json:"result"` // "ok" or "fail"
+	WallSeconds float64   `json:"wallSeconds"`
+	// CPUSeconds is the total user and system CPU time of the
+	// commands run on the build's buildlets, and PeakMemory the
+	// largest peak resident set size, in bytes, of any of them.
+	// Either is zero if the buildlets didn't report it.
+	CPUSeconds float64 `json:"cpuSeconds"`
+	PeakMemory int64   `json:"peakMemory"`
+	// ReadBytes and WriteBytes are the bytes the commands read from
+	// and wrote to storage, and NetBytes those received and sent on
+	// the network while they ran. They're zero where the buildlets
+	// didn't report them. TopIO holds the commands with the most I/O.
+	ReadBytes  int64     `json:"readBytes"`
+	WriteBytes int64     `json:"writeBytes"`
+	NetBytes   int64     `json:"netBytes"`
+	TopIO      []*execIO `json:"topIO,omitempty"`
+}
+
+// execIO is the I/O of a command run by a build.
+type execIO struct {
+	// Command is the command and its arguments, other than flags,
+	// like "go/bin/go tool dist test go_test:net".
+	Command    string  `json:"command"`
+	Seconds    float64 `json:"seconds"`
+	ReadBytes  int64   `json:"readBytes"`
+	WriteBytes int64   `json:"writeBytes"`
+	NetBytes   int64   `json:"netBytes"`
+}
+
+func (e *execIO) total() int64 { return e.ReadBytes + e.WriteBytes + e.NetBytes }
+
+// commandIO sums up the I/O of the runs of a command in recent builds.
+type commandIO struct {
+	Command    string  `json:"command"`
+	Builder    string  `json:"builder"`
+	Runs       int     `json:"runs"`
+	Seconds    float64 `json:"seconds"` // total
+	ReadBytes  int64   `json:"readBytes"`
+	WriteBytes int64   `json:"writeBytes"`
+	NetBytes   int64   `json:"netBytes"`
+	// MaxBytes is the most I/O of a run, in bytes read, written, and
+	// sent and received on the network.
+	MaxBytes int64 `json:"maxBytes"`
+}
+
+// builderUsage sums up the resource usage of the recent builds of a
+// builder.
+type builderUsage struct {
+	Builder        string  `json:"builder"`
+	HostType       string  `json:"hostType"`
+	Builds         int     `json:"builds"`
+	WallSeconds    float64 `json:"wallSeconds"` // total
+	CPUSeconds     float64 `json:"cpuSeconds"`  // total
+	AvgWallSeconds float64 `json:"avgWallSeconds"`
+	AvgCPUSeconds  float64 `json:"avgCPUSeconds"`
+	MaxPeakMemory  int64   `json:"maxPeakMemory"`
+	ReadBytes      int64   `json:"readBytes"`  // total
+	WriteBytes     int64   `json:"writeBytes"` // total
+	NetBytes       int64   `json:"netBytes"`   // total
+}
+
+// usageStore holds the resource usage of the most recent builds, since
+// the coordinator started.
+type usageStore struct {
+	max int
+
+	mu     sync.Mutex
+	builds []*buildUsage // oldest first
+}
+
+// buildUsages is the usageStore of the coordinator.
+var buildUsages = &usageStore{max: maxRecentBuildUsage}
+
+func (s *usageStore) add(u *buildUsage) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.builds = append(s.builds, u)
+	if n := len(s.builds) - s.max; n > 0 {
+		s.builds = append(s.builds[:0], s.builds[n:]...)
+	}
+}
+
+// query returns the usage of the stored builds for which keep returns
+// true, newest first, and its sum by builder, sorted by total CPU time.
+func (s *usageStore) query(keep func(*buildUsage) bool) ([]*buildUsage, []*builderUsage) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var builds []*buildUsage
+	byBuilder := make(map[string]*builderUsage)
+	for i := len(s.builds) - 1; i >= 0; i-- {
+		u := s.builds[i]
+		if !keep(u) {
+			continue
+		}
+		builds = append(builds, u)
+		bu := byBuilder[u.Builder]
+		if bu == nil {
+			bu = &builderUsage{Builder: u.Builder, HostType: u.HostType}
+			byBuilder[u.Builder] = bu
+		}
+		bu.Builds++
+		bu.WallSeconds += u.WallSeconds
+		bu.CPUSeconds += u.CPUSeconds
+		if u.PeakMemory > bu.MaxPeakMemory {
+			bu.MaxPeakMemory = u.PeakMemory
+		}
+		bu.ReadBytes += u.ReadBytes
+		bu.WriteBytes += u.WriteBytes
+		bu.NetBytes += u.NetBytes
+	}
+	builders := make([]*builderUsage, 0, len(byBuilder))
+	for _, bu := range byBuilder {
+		bu.AvgWallSeconds = bu.WallSeconds / float64(bu.Builds)
+		bu.AvgCPUSeconds = bu.CPUSeconds / float64(bu.Builds)
+		builders = append(builders, bu)
+	}
+	sort.Slice(builders, func(i, j int) bool {
+		if builders[i].CPUSeconds != builders[j].CPUSeconds {
+			return builders[i].CPUSeconds > builders[j].CPUSeconds
+		}
+		return builders[i].Builder < builders[j].Builder
+	})
+	return builds, builders
+}
+
+// topCommands returns the commands with the most I/O in builds, by
+// builder, sorted by their total I/O.
+func topCommands(builds []*buildUsage) []*commandIO {
+	type key struct{ builder, command string }
+	byKey := make(map[key]*commandIO)
+	for _, u := range builds {
+		for _, e := range u.TopIO {
+			k := key{u.Builder, e.Command}
+			c := byKey[k]
+			if c == nil {
+				c = &commandIO{Command: e.Command, Builder: u.Builder}
+				byKey[k] = c
+			}
+			c.Runs++
+			c.Seconds += e.Seconds
+			c.ReadBytes += e.ReadBytes
+			c.WriteBytes += e.WriteBytes
+			c.NetBytes += e.NetBytes
+			if t := e.total(); t > c.MaxBytes {
+				c.MaxBytes = t
+			}
+		}
+	}
+	cmds := make([]*commandIO, 0, len(byKey))
+	for _, c := range byKey {
+		cmds = append(cmds, c)
+	}
+	sort.Slice(cmds, func(i, j int) bool {
+		ti := cmds[i].ReadBytes + cmds[i].WriteBytes + cmds[i].NetBytes
+		tj := cmds[j].ReadBytes + cmds[j].WriteBytes + cmds[j].NetBytes
+		if ti != tj {
+			return ti > tj
+		}
+		if cmds[i].Builder != cmds[j].Builder {
+			return cmds[i].Builder < cmds[j].Builder
+		}
+		return cmds[i].Command < cmds[j].Command
+	})
+	if len(cmds) > maxTopCommands {
+		cmds = cmds[:maxTopCommands]
+	}
+	return cmds
+}
+
+// handleUsage serves /reports/usage, the resource usage of recent
+// builds as JSON: the sum by builder, the commands with the most I/O,
+// which find tests that are slow on builders with network-attached
+// disks, and unless the summary parameter is set, the usage of each
+// build, newest first. The builder, hostType and repo parameters
+// restrict it to matching builds, and the since parameter, an RFC 3339
+// time, to those started at or after it.
+func handleUsage(s *usageStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var since time.Time
+		if v := r.FormValue("since"); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				http.Error(w, "invalid since parameter: want RFC 3339 time", http.StatusBadRequest)
+				return
+			}
+			since = t
+		}
+		builder, hostType, repo := r.FormValue("builder"), r.FormValue("hostType"), r.FormValue("repo")
+		builds, builders := s.query(func(u *buildUsage) bool {
+			return (builder == "" || u.Builder == builder) &&
+				(hostType == "" || u.HostType == hostType) &&
+				(repo == "" || u.Repo == repo) &&
+				!u.StartTime.Before(since)
+		})
+		data := struct {
+			Builders []*builderUsage `json:"builders"`
+			Commands []*commandIO    `json:"commands,omitempty"`
+			Builds   []*buildUsage   `json:"builds,omitempty"`
+		}{
+			Builders: builders,
+			Commands: topCommands(builds),
+		}
+		if r.FormValue("summary") == "" {
+			data.Builds = builds
+		}
+		j, err := json.MarshalIndent(data, "", "\t")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(j)
+	}
+}
+
+// usageClient is a buildlet.Client that adds the resource usage of the
+// commands it runs to that of a build.
+type usageClient struct {
+	buildlet.Client
+	st *buildStatus
+}
+
+// trackUsage returns bc, adding the resource usage of the commands run
+// on it to that of the build.
+func (st *buildStatus) trackUsage(bc buildlet.Client) buildlet.Client {
+	return usageClient{Client: bc, st: st}
+}
+
+func (c usageClient) Exec(ctx context.Context, cmd string, opts buildlet.ExecOpts) (remoteErr, execErr error) {
+	onUsage := opts.OnUsage
+	start := time.Now()
+	opts.OnUsage = func(u buildlet.ExecUsage) {
+		c.st.addUsage(execCommand(cmd, opts.Args), time.Since(start), u)
+		if onUsage != nil {
+			onUsage(u)
+		}
+	}
+	return c.Client.Exec(ctx, cmd, opts)
+}
+
+// execCommand returns the Command of an execIO for cmd run with args.
+// Flags are left out, as they may vary between runs, like --banner,
+// or just be noise.
+func execCommand(cmd string, args []string) string {
+	const maxLen = 200
+	s := cmd
+	for _, a := range args {
+		if strings.HasPrefix(a, "-") {
+			continue
+		}
+		s += " " + a
+		if len(s) > maxLen {
+			return s[:maxLen-3] + "..."
+		}
+	}
+	return s
+}
+
+func (st *buildStatus) addUsage(command string, d time.Duration, u buildlet.ExecUsage) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.cpuTime += u.CPUTime
+	if u.MaxRSS > st.peakMemory {
+		st.peakMemory = u.MaxRSS
+	}
+	e := &execIO{
+		Command:    command,
+		Seconds:    d.Seconds(),
+		ReadBytes:  u.ReadBytes,
+		WriteBytes: u.WriteBytes,
+		NetBytes:   u.NetRecvBytes + u.NetSentBytes,
+	}
+	st.readBytes += e.ReadBytes
+	st.writeBytes += e.WriteBytes
+	st.netBytes += e.NetBytes
+	if e.total() == 0 {
+		return
+	}
+	// Keep the commands with the most I/O, most first.
+	i := sort.Search(len(st.topIO), func(i int) bool { return st.topIO[i].total() < e.total() })
+	if i == maxBuildTopIO {
+		return
+	}
+	st.topIO = append(st.topIO, nil)
+	copy(st.topIO[i+1:], st.topIO[i:])
+	st.topIO[i] = e
+	if len(st.topIO) > maxBuildTopIO {
+		st.topIO = st.topIO[:maxBuildTopIO]
+	}
+}
+
+// recordUsage records the resource usage of the finished build to the
+// coordinator's usageStore and metrics.
+func (st *buildStatus) recordUsage() {
+	rec := st.buildRecord()
+	u := &buildUsage{
+		BuildID:     rec.ID,
+		Builder:     rec.Builder,
+		HostType:    st.conf.HostType,
+		Repo:        rec.Repo,
+		Rev:         rec.Rev,
+		IsTry:       rec.IsTry,
+		StartTime:   rec.StartTime,
+		Result:      rec.Result,
+		WallSeconds: rec.Seconds,
+		CPUSeconds:  rec.CPUSeconds,
+		PeakMemory:  rec.PeakMemory,
+		ReadBytes:   rec.ReadBytes,
+		WriteBytes:  rec.WriteBytes,
+		NetBytes:    rec.NetBytes,
+	}
+	st.mu.Lock()
+	u.TopIO = st.topIO
+	st.mu.Unlock()
+	buildUsages.add(u)
+
+	ms := []stats.Measurement{mBuildWallSeconds.M(u.WallSeconds)}
+	if u.CPUSeconds > 0 {
+		ms = append(ms, mBuildCPUSeconds.M(u.CPUSeconds))
+	}
+	if u.PeakMemory > 0 {
+		ms = append(ms, mBuildPeakMemory.M(u.PeakMemory))
+	}
+	if n := u.ReadBytes + u.WriteBytes; n > 0 {
+		ms = append(ms, mBuildDiskBytes.M(n))
+	}
+	if u.NetBytes > 0 {
+		ms = append(ms, mBuildNetBytes.M(u.NetBytes))
+	}
+	stats.RecordWithTags(context.Background(),
+		[]tag.Mutator{tag.Upsert(kBuilderType, u.Builder), tag.Upsert(kHostType, u.HostType)},
+		ms...)
+}
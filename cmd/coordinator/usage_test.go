@@ -0,0 +1,213 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.16 && (linux || darwin)
+// +build go1.16
+// +build linux darwin
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.org/x/build/buildlet"
+)
+
+func TestUsageStore(t *testing.T) {
+	start := time.Date(2023, time.June, 1, 0, 0, 0, 0, time.UTC)
+	s := &usageStore{max: 3}
+	for i, u := range []*buildUsage{
+		{BuildID: "B1", Builder: "linux-amd64", CPUSeconds: 1000, PeakMemory: 1 << 30}, // evicted
+		{BuildID: "B2", Builder: "linux-amd64", WallSeconds: 100, CPUSeconds: 300, PeakMemory: 2 << 30},
+		{BuildID: "B3", Builder: "darwin-arm64", WallSeconds: 200, CPUSeconds: 500},
+		{BuildID: "B4", Builder: "linux-amd64", WallSeconds: 300, CPUSeconds: 500, PeakMemory: 1 << 30},
+	} {
+		u.StartTime = start.Add(time.Duration(i) * time.Hour)
+		s.add(u)
+	}
+
+	builds, builders := s.query(func(*buildUsage) bool { return true })
+	var ids []string
+	for _, u := range builds {
+		ids = append(ids, u.BuildID)
+	}
+	if diff := cmp.Diff([]string{"B4", "B3", "B2"}, ids); diff != "" {
+		t.Errorf("query builds mismatch (-want +got):\n%s", diff)
+	}
+	want := []*builderUsage{
+		{Builder: "linux-amd64", Builds: 2, WallSeconds: 400, CPUSeconds: 800, AvgWallSeconds: 200, AvgCPUSeconds: 400, MaxPeakMemory: 2 << 30},
+		{Builder: "darwin-arm64", Builds: 1, WallSeconds: 200, CPUSeconds: 500, AvgWallSeconds: 200, AvgCPUSeconds: 500},
+	}
+	if diff := cmp.Diff(want, builders); diff != "" {
+		t.Errorf("query builders mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestHandleUsage(t *testing.T) {
+	start := time.Date(2023, time.June, 1, 0, 0, 0, 0, time.UTC)
+	s := &usageStore{max: 10}
+	s.add(&buildUsage{BuildID: "B1", Builder: "linux-amd64", Repo: "go", StartTime: start, CPUSeconds: 100})
+	s.add(&buildUsage{BuildID: "B2", Builder: "linux-amd64", Repo: "net", StartTime: start.Add(time.Hour), CPUSeconds: 200})
+	s.add(&buildUsage{BuildID: "B3", Builder: "windows-amd64", Repo: "go", StartTime: start.Add(2 * time.Hour), CPUSeconds: 50})
+
+	for _, tt := range []struct {
+		query        string
+		wantBuilds   []string
+		wantBuilders []string
+		wantStatus   int
+	}{
+		{query: "", wantBuilds: []string{"B3", "B2", "B1"}, wantBuilders: []string{"linux-amd64", "windows-amd64"}},
+		{query: "?builder=linux-amd64", wantBuilds: []string{"B2", "B1"}, wantBuilders: []string{"linux-amd64"}},
+		{query: "?repo=go", wantBuilds: []string{"B3", "B1"}, wantBuilders: []string{"linux-amd64", "windows-amd64"}},
+		{query: "?since=2023-06-01T01:00:00Z", wantBuilds: []string{"B3", "B2"}, wantBuilders: []string{"linux-amd64", "windows-amd64"}},
+		{query: "?summary=1", wantBuilders: []string{"linux-amd64", "windows-amd64"}},
+		{query: "?since=yesterday", wantStatus: http.StatusBadRequest},
+	} {
+		req := httptest.NewRequest("GET", "/reports/usage"+tt.query, nil)
+		w := httptest.NewRecorder()
+		handleUsage(s)(w, req)
+		if tt.wantStatus != 0 {
+			if w.Code != tt.wantStatus {
+				t.Errorf("GET %s: status %d; want %d", tt.query, w.Code, tt.wantStatus)
+			}
+			continue
+		}
+		if w.Code != http.StatusOK {
+			t.Errorf("GET %s: status %d; want %d", tt.query, w.Code, http.StatusOK)
+			continue
+		}
+		var got struct {
+			Builders []*builderUsage
+			Builds   []*buildUsage
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+			t.Fatalf("GET %s: %v", tt.query, err)
+		}
+		var builds, builders []string
+		for _, u := range got.Builds {
+			builds = append(builds, u.BuildID)
+		}
+		for _, u := range got.Builders {
+			builders = append(builders, u.Builder)
+		}
+		if diff := cmp.Diff(tt.wantBuilds, builds); diff != "" {
+			t.Errorf("GET %s: builds mismatch (-want +got):\n%s", tt.query, diff)
+		}
+		if diff := cmp.Diff(tt.wantBuilders, builders); diff != "" {
+			t.Errorf("GET %s: builders mismatch (-want +got):\n%s", tt.query, diff)
+		}
+	}
+}
+
+func TestTrackUsage(t *testing.T) {
+	st := &buildStatus{}
+	var hooked []buildlet.ExecUsage
+	bc := st.trackUsage(&usageFakeClient{usages: []buildlet.ExecUsage{
+		{CPUTime: 2 * time.Second, MaxRSS: 100},
+		{CPUTime: 3 * time.Second, MaxRSS: 300},
+		{CPUTime: time.Second, MaxRSS: 200},
+	}})
+	for i := 0; i < 3; i++ {
+		bc.Exec(context.Background(), "go", buildlet.ExecOpts{
+			OnUsage: func(u buildlet.ExecUsage) { hooked = append(hooked, u) },
+		})
+	}
+	if st.cpuTime != 6*time.Second || st.peakMemory != 300 {
+		t.Errorf("usage = %v, %d; want 6s, 300", st.cpuTime, st.peakMemory)
+	}
+	if len(hooked) != 3 {
+		t.Errorf("OnUsage of the caller ran %d times; want 3", len(hooked))
+	}
+}
+
+func TestTrackUsageIO(t *testing.T) {
+	st := &buildStatus{}
+	var usages []buildlet.ExecUsage
+	for i := 1; i <= maxBuildTopIO+2; i++ {
+		usages = append(usages, buildlet.ExecUsage{ReadBytes: int64(i) << 20, WriteBytes: 1 << 20, NetRecvBytes: 10, NetSentBytes: 20})
+	}
+	usages = append(usages, buildlet.ExecUsage{CPUTime: time.Second}) // an old buildlet
+	bc := st.trackUsage(&usageFakeClient{usages: usages})
+	for i := range usages {
+		bc.Exec(context.Background(), "go/bin/go", buildlet.ExecOpts{
+			Args: []string{"tool", "dist", "test", "--no-rebuild", "--banner=XXXBANNERXXX", fmt.Sprintf("test%d", i+1)},
+		})
+	}
+	n := int64(maxBuildTopIO + 2)
+	if want := n * (n + 1) / 2 << 20; st.readBytes != want || st.writeBytes != n<<20 || st.netBytes != n*30 {
+		t.Errorf("I/O = %d, %d, %d; want %d, %d, %d", st.readBytes, st.writeBytes, st.netBytes, want, n<<20, n*30)
+	}
+	var got []string
+	for _, e := range st.topIO {
+		got = append(got, e.Command)
+	}
+	want := []string{
+		"go/bin/go tool dist test test7",
+		"go/bin/go tool dist test test6",
+		"go/bin/go tool dist test test5",
+		"go/bin/go tool dist test test4",
+		"go/bin/go tool dist test test3",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("top I/O commands mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestTopCommands(t *testing.T) {
+	builds := []*buildUsage{
+		{Builder: "linux-amd64", TopIO: []*execIO{
+			{Command: "go test net", ReadBytes: 100, Seconds: 10},
+			{Command: "go test os", WriteBytes: 10, Seconds: 1},
+		}},
+		{Builder: "linux-amd64", TopIO: []*execIO{
+			{Command: "go test net", ReadBytes: 300, NetBytes: 50, Seconds: 20},
+		}},
+		{Builder: "darwin-arm64", TopIO: []*execIO{
+			{Command: "go test net", ReadBytes: 30},
+		}},
+		{Builder: "windows-amd64"},
+	}
+	want := []*commandIO{
+		{Command: "go test net", Builder: "linux-amd64", Runs: 2, Seconds: 30, ReadBytes: 400, NetBytes: 50, MaxBytes: 350},
+		{Command: "go test net", Builder: "darwin-arm64", Runs: 1, ReadBytes: 30, MaxBytes: 30},
+		{Command: "go test os", Builder: "linux-amd64", Runs: 1, Seconds: 1, WriteBytes: 10, MaxBytes: 10},
+	}
+	if diff := cmp.Diff(want, topCommands(builds)); diff != "" {
+		t.Errorf("topCommands mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestExecCommand(t *testing.T) {
+	if got, want := execCommand("go/bin/go", []string{"tool", "dist", "test", "--no-rebuild", "--banner=X", "-k", "go_test:net"}), "go/bin/go tool dist test go_test:net"; got != want {
+		t.Errorf("execCommand = %q; want %q", got, want)
+	}
+	var names []string
+	for i := 0; i < 100; i++ {
+		names = append(names, fmt.Sprintf("go_test:pkg%d", i))
+	}
+	if got := execCommand("go/bin/go", names); len(got) != 200 || !strings.HasSuffix(got, "...") {
+		t.Errorf("execCommand of many tests = %q; want it truncated to 200 bytes", got)
+	}
+}
+
+// usageFakeClient is a buildlet.Client whose commands report usages in
+// turn.
+type usageFakeClient struct {
+	buildlet.Client
+	usages []buildlet.ExecUsage
+}
+
+func (c *usageFakeClient) Exec(ctx context.Context, cmd string, opts buildlet.ExecOpts) (remoteErr, execErr error) {
+	opts.OnUsage(c.usages[0])
+	c.usages = c.usages[1:]
+	return nil, nil
+}
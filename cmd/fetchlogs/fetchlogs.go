@@ -23,6 +23,16 @@
 // failure, use:
 //
 //	grep -lR <regexp> rev | sort
+//
+// Fetchlogs also extracts the failures from each log into a SQLite
+// index, index.db, which the query subcommand searches:
+//
+//	fetchlogs query [-builder regexp] [-since date] [-before date] [-group] <regexp>
+//
+// For example, to count the occurrences of each distinct failure
+// mentioning "timeout" on Windows builders since April 2023, use:
+//
+//	fetchlogs query -builder windows -since 2023-04-01 -group timeout
 package main
 
 import (
@@ -31,9 +41,7 @@ import (
 	"encoding/json"
 	"flag"
 	"fmt"
-	"io"
 	"log"
-	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
@@ -42,6 +50,7 @@ import (
 	"sync"
 	"time"
 
+	"golang.org/x/build/internal/buildlog"
 	"golang.org/x/build/maintner"
 	"golang.org/x/build/maintner/godata"
 	"golang.org/x/build/repos"
@@ -64,6 +73,13 @@ func main() {
 	log.SetFlags(0)
 
 	flag.Parse()
+	if flag.NArg() > 0 && flag.Arg(0) == "query" {
+		if err := os.Chdir(*flagDir); err != nil {
+			log.Fatal(err)
+		}
+		runQuery(flag.Args()[1:])
+		return
+	}
 	if flag.NArg() != 0 {
 		flag.Usage()
 		os.Exit(2)
@@ -83,9 +99,16 @@ func main() {
 	}
 	ensureDir("log")
 	ensureDir("rev")
+	idx, err := openIndex(indexFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer idx.Close()
 
 	// Set up fetchers.
-	fetcher := newFetcher(*flagPar)
+	ctx := context.Background()
+	fetcher := buildlog.NewFetcher(*flagPar)
+	fetcher.OnGet = func(url string) { fmt.Println("fetching", url) }
 	wg := sync.WaitGroup{}
 
 	// Fetch dashboard pages.
@@ -101,7 +124,7 @@ func main() {
 				if branch != "" {
 					dashURL += "&branch=" + url.QueryEscape(branch)
 				}
-				index, err := fetcher.get(dashURL)
+				index, err := fetcher.Get(ctx, dashURL)
 				if err != nil {
 					log.Fatal(err)
 				}
@@ -157,6 +180,9 @@ func main() {
 						goDate = commit.CommitTime
 					}
 					revDir, revDirDepth := revToDir(rev.Revision, date, rev.GoRevision, goDate)
+					if goDate.After(date) {
+						date = goDate
+					}
 					ensureDir(revDir)
 
 					if rev.GoRevision != "" {
@@ -176,7 +202,7 @@ func main() {
 					if err = enc.Encode(rev); err != nil {
 						log.Fatal(err)
 					}
-					if err = writeFileAtomic(filepath.Join(revDir, ".rev.json"), &buf); err != nil {
+					if err = buildlog.WriteFileAtomic(filepath.Join(revDir, ".rev.json"), &buf); err != nil {
 						log.Fatal("error saving revision metadata: ", err)
 					}
 
@@ -185,7 +211,7 @@ func main() {
 					if err = enc.Encode(status.Builders); err != nil {
 						log.Fatal(err)
 					}
-					if err = writeFileAtomic(filepath.Join(revDir, ".builders.json"), &buf); err != nil {
+					if err = buildlog.WriteFileAtomic(filepath.Join(revDir, ".builders.json"), &buf); err != nil {
 						log.Fatal("error saving builders metadata: ", err)
 					}
 
@@ -196,17 +222,26 @@ func main() {
 						}
 
 						wg.Add(1)
-						go func(builder, logURL string) {
+						go func(info logInfo, logURL string) {
 							defer wg.Done()
-							logPath := filepath.Join("log", filepath.Base(logURL))
-							err := fetcher.getFile(logURL, logPath)
+							err := fetcher.GetFile(ctx, logURL, info.Path)
 							if err != nil {
 								log.Fatal("error fetching log: ", err)
 							}
-							if err := linkLog(revDir, revDirDepth, builder, logPath); err != nil {
+							if err := linkLog(revDir, revDirDepth, info.Builder, info.Path); err != nil {
 								log.Fatal("error linking log: ", err)
 							}
-						}(status.Builders[i], res)
+							if err := idx.add(info); err != nil {
+								log.Fatal("error indexing log: ", err)
+							}
+						}(logInfo{
+							Path:       filepath.Join("log", filepath.Base(res)),
+							Builder:    status.Builders[i],
+							Repo:       project,
+							Revision:   rev.Revision,
+							GoRevision: rev.GoRevision,
+							Date:       date,
+						}, res)
 					}
 				}
 			}
@@ -267,92 +302,6 @@ func parseRepoFlag() (rs []*repos.Repo) {
 	return rs
 }
 
-// A fetcher downloads files over HTTP concurrently. It allows
-// limiting the number of concurrent downloads and correctly handles
-// multiple (possibly concurrent) fetches from the same URL to the
-// same file.
-type fetcher struct {
-	tokens chan struct{}
-
-	pending struct {
-		sync.Mutex
-		m map[string]*pendingFetch
-	}
-}
-
-type pendingFetch struct {
-	wchan chan struct{} // closed when fetch completes
-
-	// err is the error, if any, that occurred during this fetch.
-	// It will be set before wchan is closed.
-	err error
-}
-
-func newFetcher(jobs int) *fetcher {
-	f := new(fetcher)
-
-	f.tokens = make(chan struct{}, *flagPar)
-	for i := 0; i < jobs; i++ {
-		f.tokens <- struct{}{}
-	}
-
-	f.pending.m = make(map[string]*pendingFetch)
-
-	return f
-}
-
-// get performs an HTTP GET for URL and returns the body, while
-// obeying the job limit on fetcher.
-func (f *fetcher) get(url string) (io.ReadCloser, error) {
-	<-f.tokens
-	fmt.Println("fetching", url)
-	resp, err := http.Get(url)
-	f.tokens <- struct{}{}
-	if err != nil {
-		return nil, err
-	}
-	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("GET %s: %v %s", url, resp.StatusCode, http.StatusText(resp.StatusCode))
-	}
-
-	return resp.Body, nil
-}
-
-// getFile performs an HTTP GET for URL and writes it to filename. If
-// the destination file already exists, this returns immediately. If
-// another goroutine is currently fetching filename, this blocks until
-// the fetch is done and then returns.
-func (f *fetcher) getFile(url string, filename string) error {
-	// Do we already have it?
-	if _, err := os.Stat(filename); err == nil {
-		return nil
-	} else if !os.IsNotExist(err) {
-		return err
-	}
-
-	// Check if another fetcher is working on it.
-	f.pending.Lock()
-	if p, ok := f.pending.m[filename]; ok {
-		f.pending.Unlock()
-		<-p.wchan
-		return p.err
-	}
-
-	p := &pendingFetch{wchan: make(chan struct{})}
-	f.pending.m[filename] = p
-	f.pending.Unlock()
-
-	r, err := f.get(url)
-	if err == nil {
-		err = writeFileAtomic(filename, r)
-		r.Close()
-	}
-	p.err = err
-
-	close(p.wchan)
-	return p.err
-}
-
 var (
 	goProjectMu     sync.Mutex
 	cachedGoProject *maintner.GerritProject
@@ -401,33 +350,6 @@ func ensureDir(name string) {
 	}
 }
 
-// writeFileAtomic atomically creates a file called filename and
-// copies the data from r to the file.
-func writeFileAtomic(filename string, r io.Reader) error {
-	tmpPath := filename + ".tmp"
-	if f, err := os.Create(tmpPath); err != nil {
-		return err
-	} else {
-		_, err := io.Copy(f, r)
-		if err == nil {
-			err = f.Sync()
-		}
-		err2 := f.Close()
-		if err == nil {
-			err = err2
-		}
-		if err != nil {
-			os.Remove(tmpPath)
-			return err
-		}
-	}
-	if err := os.Rename(tmpPath, filename); err != nil {
-		os.Remove(tmpPath)
-		return err
-	}
-	return nil
-}
-
 // linkLog creates a symlink for finding logPath based on its git
 // revision and builder.
 func linkLog(revDir string, revDirDepth int, builder, logPath string) error {
@@ -0,0 +1,163 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+	"golang.org/x/build/internal/buildlog"
+)
+
+// indexFile is the name of the index database in the -dir directory.
+const indexFile = "index.db"
+
+const indexSchema = `
+CREATE TABLE IF NOT EXISTS Logs (
+	LogID INTEGER PRIMARY KEY,
+	Path TEXT NOT NULL,
+	Builder TEXT NOT NULL,
+	Repo TEXT NOT NULL,
+	Revision TEXT NOT NULL,
+	GoRevision TEXT NOT NULL,
+	Date INTEGER NOT NULL,
+	UNIQUE (Builder, Revision, GoRevision)
+);
+CREATE INDEX IF NOT EXISTS LogsByDate ON Logs (Date);
+CREATE TABLE IF NOT EXISTS Failures (
+	LogID INTEGER NOT NULL REFERENCES Logs,
+	Section TEXT NOT NULL,
+	Pkg TEXT NOT NULL,
+	Test TEXT NOT NULL,
+	Mode TEXT NOT NULL,
+	Snippet TEXT NOT NULL,
+	SnippetHash TEXT NOT NULL,
+	Output TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS FailuresByLog ON Failures (LogID);
+`
+
+// A logIndex is a SQLite database of the failures in downloaded logs.
+// It is safe for concurrent use.
+type logIndex struct {
+	mu sync.Mutex // serializes transactions
+	db *sql.DB
+}
+
+// openIndex opens the index database at path, creating it if needed.
+func openIndex(path string) (*logIndex, error) {
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(indexSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("creating index %s: %v", path, err)
+	}
+	return &logIndex{db: db}, nil
+}
+
+func (x *logIndex) Close() error { return x.db.Close() }
+
+// A logInfo describes a downloaded log.
+type logInfo struct {
+	Path       string // relative to the -dir directory, as "log/<hash>"
+	Builder    string
+	Repo       string
+	Revision   string
+	GoRevision string    // empty for the go repo
+	Date       time.Time // date of the revision directory
+}
+
+// add parses the failures in the log described by l and adds them to
+// the index, unless it already has that log.
+func (x *logIndex) add(l logInfo) error {
+	x.mu.Lock()
+	var n int
+	err := x.db.QueryRow(`SELECT COUNT(*) FROM Logs WHERE Builder = ? AND Revision = ? AND GoRevision = ?`, l.Builder, l.Revision, l.GoRevision).Scan(&n)
+	x.mu.Unlock()
+	if err != nil || n > 0 {
+		return err
+	}
+
+	fails, err := buildlog.ReadFailures(l.Path)
+	if err != nil {
+		return err
+	}
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	tx, err := x.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	res, err := tx.Exec(`INSERT OR IGNORE INTO Logs (Path, Builder, Repo, Revision, GoRevision, Date) VALUES (?, ?, ?, ?, ?, ?)`,
+		l.Path, l.Builder, l.Repo, l.Revision, l.GoRevision, l.Date.Unix())
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return nil // indexed concurrently
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	for _, f := range fails {
+		_, err := tx.Exec(`INSERT INTO Failures (LogID, Section, Pkg, Test, Mode, Snippet, SnippetHash, Output) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			id, f.Section, f.Pkg, f.Test, f.Mode, f.Snippet, f.SnippetHash, f.Output)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// An indexedFailure is a failure found in the index.
+type indexedFailure struct {
+	logInfo
+	buildlog.Failure
+}
+
+// failures calls fn for each failure in logs of revisions dated in
+// [since, before), newest first. A zero before means no upper bound.
+// Iteration stops if fn returns false.
+func (x *logIndex) failures(since, before time.Time, fn func(*indexedFailure) bool) error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	end := int64(1<<63 - 1)
+	if !before.IsZero() {
+		end = before.Unix()
+	}
+	rows, err := x.db.Query(`SELECT l.Path, l.Builder, l.Repo, l.Revision, l.GoRevision, l.Date,
+		f.Section, f.Pkg, f.Test, f.Mode, f.Snippet, f.SnippetHash, f.Output
+		FROM Failures f JOIN Logs l ON f.LogID = l.LogID
+		WHERE l.Date >= ? AND l.Date < ?
+		ORDER BY l.Date DESC, l.Builder`, since.Unix(), end)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var f indexedFailure
+		var date int64
+		if err := rows.Scan(&f.Path, &f.Builder, &f.Repo, &f.Revision, &f.GoRevision, &date,
+			&f.Section, &f.Pkg, &f.Test, &f.Mode, &f.Snippet, &f.SnippetHash, &f.Output); err != nil {
+			return err
+		}
+		f.Date = time.Unix(date, 0).UTC()
+		if !fn(&f) {
+			break
+		}
+	}
+	return rows.Err()
+}
@@ -0,0 +1,145 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testLog returns a build log with a failure of test in pkg, whose
+// output is msg.
+func testLog(pkg, test, msg string) string {
+	return fmt.Sprintf("##### Testing packages.\n--- FAIL: %s (0.00s)\n    x_test.go:10: %s\nFAIL\nFAIL\t%s\t1.234s\n", test, msg, pkg)
+}
+
+// newTestIndex returns an index in a temporary directory, with a log
+// for each of logs, whose Path holds the contents given by the map.
+func newTestIndex(t *testing.T, logs map[logInfo]string) *logIndex {
+	t.Helper()
+	dir := t.TempDir()
+	idx, err := openIndex(filepath.Join(dir, indexFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { idx.Close() })
+	for l, data := range logs {
+		l.Path = filepath.Join(dir, l.Path)
+		if err := os.WriteFile(l.Path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := idx.add(l); err != nil {
+			t.Fatalf("add(%+v): %v", l, err)
+		}
+	}
+	return idx
+}
+
+func day(d int) time.Time {
+	return time.Date(2023, time.April, d, 0, 0, 0, 0, time.UTC)
+}
+
+// rev returns a fake 40-character revision.
+func rev(c byte) string {
+	b := make([]byte, 40)
+	for i := range b {
+		b[i] = c
+	}
+	return string(b)
+}
+
+func TestIndex(t *testing.T) {
+	idx := newTestIndex(t, map[logInfo]string{
+		{Path: "a", Builder: "linux-amd64", Repo: "go", Revision: rev('a'), Date: day(1)}:                        testLog("net/http", "TestA", "timeout"),
+		{Path: "b", Builder: "windows-amd64", Repo: "go", Revision: rev('b'), Date: day(2)}:                      testLog("os", "TestB", "access denied"),
+		{Path: "c", Builder: "linux-amd64", Repo: "net", Revision: rev('c'), GoRevision: rev('b'), Date: day(3)}: testLog("golang.org/x/net/http2", "TestC", "timeout"),
+	})
+
+	failures := func(since, before time.Time) (got []string) {
+		t.Helper()
+		err := idx.failures(since, before, func(f *indexedFailure) bool {
+			got = append(got, fmt.Sprintf("%s %s %s %s", f.Date.Format(rfc3339Date), f.Builder, f.Pkg, f.Test))
+			return true
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return got
+	}
+	check := func(name string, got []string, want ...string) {
+		t.Helper()
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("%s:\ngot  %q\nwant %q", name, got, want)
+		}
+	}
+
+	all := []string{
+		"2023-04-03 linux-amd64 golang.org/x/net/http2 TestC",
+		"2023-04-02 windows-amd64 os TestB",
+		"2023-04-01 linux-amd64 net/http TestA",
+	}
+	check("all failures", failures(time.Time{}, time.Time{}), all...)
+	check("since", failures(day(2), time.Time{}), all[:2]...)
+	check("before", failures(time.Time{}, day(2)), all[2:]...)
+	check("range", failures(day(2), day(3)), all[1])
+
+	// Iteration stops when fn returns false.
+	var n int
+	if err := idx.failures(time.Time{}, time.Time{}, func(*indexedFailure) bool { n++; return false }); err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("failures called fn %d times after it returned false; want 1", n)
+	}
+
+	// A log that's already indexed isn't read or added again.
+	dup := logInfo{Path: "missing", Builder: "linux-amd64", Repo: "go", Revision: rev('a'), Date: day(1)}
+	if err := idx.add(dup); err != nil {
+		t.Errorf("adding indexed log again: %v", err)
+	}
+	check("after adding a duplicate", failures(time.Time{}, time.Time{}), all...)
+
+	// The fields of a failure round-trip through the index.
+	err := idx.failures(day(3), time.Time{}, func(f *indexedFailure) bool {
+		if f.Repo != "net" || f.Revision != rev('c') || f.GoRevision != rev('b') || f.Mode != "test" ||
+			f.Section != "Testing packages." || f.SnippetHash == "" || f.Output != f.Snippet {
+			t.Errorf("indexed failure = %+v", f)
+		}
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestIndexReopen(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, indexFile)
+	logPath := filepath.Join(dir, "log")
+	if err := os.WriteFile(logPath, []byte(testLog("os", "TestA", "boom")), 0644); err != nil {
+		t.Fatal(err)
+	}
+	l := logInfo{Path: logPath, Builder: "linux-amd64", Repo: "go", Revision: rev('a'), Date: day(1)}
+	for i := 0; i < 2; i++ {
+		idx, err := openIndex(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := idx.add(l); err != nil {
+			t.Fatal(err)
+		}
+		var n int
+		if err := idx.failures(time.Time{}, time.Time{}, func(*indexedFailure) bool { n++; return true }); err != nil {
+			t.Fatal(err)
+		}
+		if n != 1 {
+			t.Errorf("open %d: found %d failures; want 1", i+1, n)
+		}
+		idx.Close()
+	}
+}
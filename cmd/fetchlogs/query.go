@@ -0,0 +1,195 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+const queryUsage = `usage: fetchlogs [-dir dir] query [flags] regexp
+
+Query searches the failures in the logs indexed by previous runs of
+fetchlogs for the Go regexp, which is matched against the output of
+each failure, and prints the matching failures, newest first.
+
+Flags:
+`
+
+// runQuery implements the query subcommand.
+func runQuery(args []string) {
+	fs := flag.NewFlagSet("query", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), queryUsage)
+		fs.PrintDefaults()
+	}
+	var since, before timeFlag
+	fs.Var(&since, "since", "list only failures on revisions since this date, as an RFC-3339 date or date-time")
+	fs.Var(&before, "before", "list only failures on revisions before this date, in the same format as -since")
+	builder := fs.String("builder", "", "list only failures on builders matching `regexp`")
+	repo := fs.String("repo", "", "list only failures in `repo`, such as go or net")
+	group := fs.Bool("group", false, "group identical failures, and list them by number of occurrences")
+	limit := fs.Int("n", 50, "list at most `N` failures or groups; 0 means no limit")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	rx, err := regexp.Compile(fs.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	var builderRx *regexp.Regexp
+	if *builder != "" {
+		if builderRx, err = regexp.Compile(*builder); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if _, err := os.Stat(indexFile); err != nil {
+		log.Fatalf("no index in %s; run fetchlogs first", *flagDir)
+	}
+	idx, err := openIndex(indexFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer idx.Close()
+
+	q := &failureQuery{
+		rx:        rx,
+		builderRx: builderRx,
+		repo:      *repo,
+		since:     since.Time,
+		before:    before.Time,
+	}
+	if *group {
+		groups, err := q.group(idx)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if *limit > 0 && len(groups) > *limit {
+			groups = groups[:*limit]
+		}
+		for _, g := range groups {
+			g.print()
+		}
+		return
+	}
+	n := 0
+	err = q.find(idx, func(f *indexedFailure) bool {
+		printFailure(f)
+		n++
+		return *limit == 0 || n < *limit
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// A failureQuery selects failures in the index.
+type failureQuery struct {
+	rx            *regexp.Regexp // matched against the output of failures
+	builderRx     *regexp.Regexp // if non-nil, matched against the builder
+	repo          string         // if non-empty, the repo of the failures
+	since, before time.Time      // the range of revision dates; see logIndex.failures
+}
+
+// find calls fn for each failure in idx that q selects, newest first.
+// Iteration stops if fn returns false.
+func (q *failureQuery) find(idx *logIndex, fn func(*indexedFailure) bool) error {
+	return idx.failures(q.since, q.before, func(f *indexedFailure) bool {
+		if q.repo != "" && f.Repo != q.repo ||
+			q.builderRx != nil && !q.builderRx.MatchString(f.Builder) ||
+			!q.rx.MatchString(f.Output) {
+			return true
+		}
+		return fn(f)
+	})
+}
+
+// group returns the failures in idx that q selects grouped by their
+// snippet, most frequent first.
+func (q *failureQuery) group(idx *logIndex) ([]*failureGroup, error) {
+	var groups []*failureGroup
+	byHash := make(map[string]*failureGroup)
+	err := q.find(idx, func(f *indexedFailure) bool {
+		g := byHash[f.SnippetHash]
+		if g == nil {
+			g = &failureGroup{first: f, builders: make(map[string]bool)}
+			byHash[f.SnippetHash] = g
+			groups = append(groups, g)
+		}
+		g.count++
+		g.builders[f.Builder] = true
+		g.oldest = f.Date
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	// Groups are in order of their newest failure, so a stable
+	// sort keeps recent failures first among equals.
+	sort.SliceStable(groups, func(i, j int) bool { return groups[i].count > groups[j].count })
+	return groups, nil
+}
+
+// printFailure prints a failure matched by a query.
+func printFailure(f *indexedFailure) {
+	rev := f.Revision[:7]
+	if f.GoRevision != "" {
+		rev += "-" + f.GoRevision[:7]
+	}
+	fmt.Printf("%s %s %s %s\n", f.Date.Format(rfc3339DateTime), rev, f.Builder, failureName(f))
+	fmt.Printf("\t%s\n", f.Path)
+	fmt.Print(indent(f.Snippet))
+}
+
+// failureName returns a short description of where f happened.
+func failureName(f *indexedFailure) string {
+	name := f.Pkg
+	if f.Test != "" {
+		name += " " + f.Test
+	}
+	if name == "" {
+		name = f.Section
+	}
+	return name
+}
+
+// A failureGroup is a set of failures with the same snippet.
+type failureGroup struct {
+	first    *indexedFailure // the newest
+	count    int
+	builders map[string]bool
+	oldest   time.Time
+}
+
+func (g *failureGroup) print() {
+	var builders []string
+	for b := range g.builders {
+		builders = append(builders, b)
+	}
+	sort.Strings(builders)
+	fmt.Printf("%d× %s %s (%s to %s)\n", g.count, g.first.SnippetHash, failureName(g.first),
+		g.oldest.Format(rfc3339Date), g.first.Date.Format(rfc3339Date))
+	fmt.Printf("\tbuilders: %s\n", strings.Join(builders, ", "))
+	fmt.Printf("\tnewest: %s\n", g.first.Path)
+	fmt.Print(indent(g.first.Snippet))
+}
+
+// indent indents each line of s with two tabs, ending it with a newline.
+func indent(s string) string {
+	s = strings.TrimRight(s, "\n")
+	if s == "" {
+		return ""
+	}
+	return "\t\t" + strings.ReplaceAll(s, "\n", "\n\t\t") + "\n"
+}
@@ -0,0 +1,108 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestQuery(t *testing.T) {
+	idx := newTestIndex(t, map[logInfo]string{
+		{Path: "1", Builder: "linux-amd64", Repo: "go", Revision: rev('1'), Date: day(1)}:                        testLog("net/http", "TestA", "timeout"),
+		{Path: "2", Builder: "windows-amd64", Repo: "go", Revision: rev('2'), Date: day(2)}:                      testLog("net/http", "TestA", "timeout"),
+		{Path: "3", Builder: "windows-386", Repo: "go", Revision: rev('3'), Date: day(3)}:                        testLog("os", "TestB", "access denied"),
+		{Path: "4", Builder: "linux-amd64", Repo: "net", Revision: rev('4'), GoRevision: rev('3'), Date: day(4)}: testLog("golang.org/x/net/http2", "TestC", "timeout"),
+		{Path: "5", Builder: "windows-amd64", Repo: "go", Revision: rev('5'), Date: day(5)}:                      testLog("net/http", "TestA", "timeout"),
+	})
+
+	for _, tt := range []struct {
+		name string
+		q    failureQuery
+		want []string // as "<date> <builder> <test>"
+	}{
+		{
+			name: "output",
+			q:    failureQuery{rx: regexp.MustCompile("timeout")},
+			want: []string{"05 windows-amd64 TestA", "04 linux-amd64 TestC", "02 windows-amd64 TestA", "01 linux-amd64 TestA"},
+		},
+		{
+			name: "builder",
+			q:    failureQuery{rx: regexp.MustCompile(""), builderRx: regexp.MustCompile("^windows")},
+			want: []string{"05 windows-amd64 TestA", "03 windows-386 TestB", "02 windows-amd64 TestA"},
+		},
+		{
+			name: "repo",
+			q:    failureQuery{rx: regexp.MustCompile("timeout"), repo: "go"},
+			want: []string{"05 windows-amd64 TestA", "02 windows-amd64 TestA", "01 linux-amd64 TestA"},
+		},
+		{
+			name: "dates",
+			q:    failureQuery{rx: regexp.MustCompile("timeout"), since: day(2), before: day(5)},
+			want: []string{"04 linux-amd64 TestC", "02 windows-amd64 TestA"},
+		},
+		{
+			name: "no match",
+			q:    failureQuery{rx: regexp.MustCompile("panic")},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			err := tt.q.find(idx, func(f *indexedFailure) bool {
+				got = append(got, fmt.Sprintf("%s %s %s", f.Date.Format("02"), f.Builder, f.Test))
+				return true
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("find:\ngot  %q\nwant %q", got, tt.want)
+			}
+		})
+	}
+
+	// Grouping counts identical failures, most frequent first.
+	q := failureQuery{rx: regexp.MustCompile("")}
+	groups, err := q.group(idx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, g := range groups {
+		var builders []string
+		for b := range g.builders {
+			builders = append(builders, b)
+		}
+		sort.Strings(builders)
+		got = append(got, fmt.Sprintf("%d %s %s-%s %s %s", g.count, failureName(g.first),
+			g.oldest.Format("02"), g.first.Date.Format("02"), g.first.Path[len(g.first.Path)-1:], strings.Join(builders, ",")))
+	}
+	want := []string{
+		"3 net/http TestA 01-05 5 linux-amd64,windows-amd64",
+		"1 golang.org/x/net/http2 TestC 04-04 4 linux-amd64",
+		"1 os TestB 03-03 3 windows-386",
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("group:\ngot  %q\nwant %q", got, want)
+	}
+}
+
+func TestIndent(t *testing.T) {
+	for _, tt := range []struct {
+		in, want string
+	}{
+		{"", ""},
+		{"\n", ""},
+		{"a", "\t\ta\n"},
+		{"a\nb\n", "\t\ta\n\t\tb\n"},
+	} {
+		if got := indent(tt.in); got != tt.want {
+			t.Errorf("indent(%q) = %q; want %q", tt.in, got, tt.want)
+		}
+	}
+}
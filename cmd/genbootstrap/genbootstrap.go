@@ -14,6 +14,10 @@ Usage:
 
 The argument list can be a single glob pattern (for example '*'),
 which expands to all known targets matching that pattern.
+
+The "Build bootstrap toolchains" workflow in relui does the same on a
+buildlet and uploads the results along with their checksums; prefer it
+to running genbootstrap -upload by hand.
 */
 package main
 
@@ -35,6 +39,7 @@ import (
 	"cloud.google.com/go/storage"
 	"golang.org/x/build/dashboard"
 	"golang.org/x/build/internal/envutil"
+	"golang.org/x/build/internal/task"
 )
 
 var skipBuild = flag.String("skip_build", "", "skip bootstrap.bash and reuse output in `dir` instead")
@@ -183,16 +188,7 @@ List:
 				return err
 			}
 			rel := strings.TrimPrefix(strings.TrimPrefix(path, outDir), "/")
-			base := filepath.Base(path)
-			var pkgrel string // relative to pkg/<goos>_<goarch>/, or empty
-			if strings.HasPrefix(rel, "pkg/") && strings.Count(rel, "/") >= 2 {
-				pkgrel = strings.TrimPrefix(rel, "pkg/")
-				pkgrel = pkgrel[strings.Index(pkgrel, "/")+1:]
-				if *verbose {
-					log.Printf("rel %q => %q", rel, pkgrel)
-				}
-			}
-			remove := func() error {
+			if rel != "" && !task.KeepBootstrapFile(filepath.ToSlash(rel), fi.Mode()) {
 				if err := os.RemoveAll(path); err != nil {
 					return err
 				}
@@ -201,45 +197,6 @@ List:
 				}
 				return nil
 			}
-			switch pkgrel {
-			case "cmd":
-				return remove()
-			}
-			switch rel {
-			case "api",
-				"bin/gofmt",
-				"doc",
-				"misc/android",
-				"misc/cgo",
-				"misc/chrome",
-				"misc/swig",
-				"test":
-				return remove()
-			}
-			if base == "testdata" {
-				return remove()
-			}
-			if strings.HasPrefix(rel, "pkg/tool/") {
-				switch base {
-				case "addr2line", "api", "cgo", "cover",
-					"dist", "doc", "fix", "nm",
-					"objdump", "pack", "pprof",
-					"trace", "vet", "yacc":
-					return remove()
-				}
-			}
-			if fi.IsDir() {
-				return nil
-			}
-			if isEditorJunkFile(path) {
-				return remove()
-			}
-			if !fi.Mode().IsRegular() {
-				return remove()
-			}
-			if strings.HasSuffix(path, "_test.go") {
-				return remove()
-			}
 			if *verbose {
 				log.Printf("keeping: %s\n", rel)
 			}
@@ -299,17 +256,6 @@ List:
 	}
 }
 
-func isEditorJunkFile(path string) bool {
-	path = filepath.Base(path)
-	if strings.HasPrefix(path, "#") && strings.HasSuffix(path, "#") {
-		return true
-	}
-	if strings.HasSuffix(path, "~") {
-		return true
-	}
-	return false
-}
-
 // allPairs returns a list of all known builder GOOS/GOARCH pairs.
 func allPairs() []string {
 	have := make(map[string]bool)
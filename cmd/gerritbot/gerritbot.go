@@ -29,6 +29,7 @@ import (
 	"github.com/google/go-github/v48/github"
 	"github.com/gregjones/httpcache"
 	"golang.org/x/build/gerrit"
+	"golang.org/x/build/internal/cleanup"
 	"golang.org/x/build/internal/https"
 	"golang.org/x/build/internal/secret"
 	"golang.org/x/build/maintner"
@@ -44,27 +45,32 @@ var (
 	gitcookiesFile  = flag.String("gitcookies-file", "", "if non-empty, write a git http cookiefile to this location using secret manager")
 	dryRun          = flag.Bool("dry-run", false, "print out mutating actions but don’t perform any")
 	singlePR        = flag.String("single-pr", "", "process only this PR, specified in GitHub shortlink format, e.g. golang/go#1")
+	staleBranchAge  = flag.Duration("stale-branch-age", 7*24*time.Hour, "delete temporary branches left in the work repositories under -workdir once they are this old; 0 disables the cleanup")
 )
 
 // TODO(amedee): set to this value until the SLO numbers are published
 const secretClientTimeout = 10 * time.Second
 
+// secretCheckInterval is how often the git cookies, GitHub token and
+// Gerrit token are checked for rotations.
+const secretCheckInterval = 10 * time.Minute
+
 func main() {
 	https.RegisterFlags(flag.CommandLine)
 	flag.Parse()
 
-	var secretClient *secret.Client
+	var secretCache *secret.Cache
 	if metadata.OnGCE() {
-		secretClient = secret.MustNewClient()
+		secretCache = secret.NewCache(secret.MustNewClient(), secretCheckInterval)
 	}
-	if err := writeCookiesFile(secretClient); err != nil {
+	if err := writeCookiesFile(secretCache); err != nil {
 		log.Fatalf("writeCookiesFile(): %v", err)
 	}
-	ghc, err := githubClient(secretClient)
+	ghc, err := githubClient(secretCache)
 	if err != nil {
 		log.Fatalf("githubClient(): %v", err)
 	}
-	gc, err := gerritClient(secretClient)
+	gc, err := gerritClient(secretCache)
 	if err != nil {
 		log.Fatalf("gerritClient(): %v", err)
 	}
@@ -74,7 +80,9 @@ func main() {
 	b.initCorpus(ctx)
 	go b.corpusUpdateLoop(ctx)
 
-	log.Fatalln(https.ListenAndServe(ctx, http.HandlerFunc(handleIndex)))
+	if err := https.ListenAndServe(ctx, http.HandlerFunc(handleIndex)); err != nil {
+		log.Fatalln(err)
+	}
 }
 
 func configDir() string {
@@ -93,7 +101,7 @@ func cacheDir() string {
 	return filepath.Join(cd, "gerritbot")
 }
 
-func writeCookiesFile(sc *secret.Client) error {
+func writeCookiesFile(sc *secret.Cache) error {
 	if *gitcookiesFile == "" {
 		return nil
 	}
@@ -109,16 +117,33 @@ func writeCookiesFile(sc *secret.Client) error {
 	if err != nil {
 		return fmt.Errorf("secret.Retrieve(ctx, %q): %q, %w", secret.NameGerritbotGitCookies, cookies, err)
 	}
-	return ioutil.WriteFile(*gitcookiesFile, []byte(cookies), 0600)
+	// Rewrite the file each time the cookies are rotated. Watch calls
+	// the function with the cookies just retrieved before it returns.
+	var writeErr error
+	first := true
+	err = sc.Watch(context.Background(), secret.NameGerritbotGitCookies, func(cookies string) {
+		err := ioutil.WriteFile(*gitcookiesFile, []byte(cookies), 0600)
+		if first {
+			writeErr, first = err, false
+		} else if err != nil {
+			log.Printf("Rewriting rotated git http cookies file %q: %v", *gitcookiesFile, err)
+		} else {
+			log.Printf("Rewrote rotated git http cookies file %q.", *gitcookiesFile)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return writeErr
 }
 
-func githubClient(sc *secret.Client) (*github.Client, error) {
-	token, err := githubToken(sc)
+func githubClient(sc *secret.Cache) (*github.Client, error) {
+	ts, err := githubTokenSource(sc)
 	if err != nil {
 		return nil, err
 	}
 	oauthTransport := &oauth2.Transport{
-		Source: oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token}),
+		Source: ts,
 	}
 	cachingTransport := &httpcache.Transport{
 		Transport:           oauthTransport,
@@ -131,7 +156,9 @@ func githubClient(sc *secret.Client) (*github.Client, error) {
 	return github.NewClient(httpClient), nil
 }
 
-func githubToken(sc *secret.Client) (string, error) {
+// githubTokenSource returns the source of the GitHub token, which
+// follows the token's rotations when it comes from the secret manager.
+func githubTokenSource(sc *secret.Cache) (oauth2.TokenSource, error) {
 	if metadata.OnGCE() {
 		ctx, cancel := context.WithTimeout(context.Background(), secretClientTimeout)
 		defer cancel()
@@ -140,47 +167,95 @@ func githubToken(sc *secret.Client) (string, error) {
 		if err != nil {
 			log.Printf("secret.Retrieve(ctx, %q): %q, %v", secret.NameMaintnerGitHubToken, token, err)
 		} else {
-			return token, nil
+			ts := new(rotatingTokenSource)
+			if err := sc.Watch(context.Background(), secret.NameMaintnerGitHubToken, ts.set); err != nil {
+				return nil, err
+			}
+			return ts, nil
 		}
 	}
 	slurp, err := ioutil.ReadFile(*githubTokenFile)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	tok := strings.TrimSpace(string(slurp))
 	if len(tok) == 0 {
-		return "", fmt.Errorf("token from file %q cannot be empty", *githubTokenFile)
+		return nil, fmt.Errorf("token from file %q cannot be empty", *githubTokenFile)
 	}
-	return tok, nil
+	return oauth2.StaticTokenSource(&oauth2.Token{AccessToken: tok}), nil
+}
+
+// rotatingTokenSource is an oauth2.TokenSource of the latest value of a
+// token that is rotated.
+type rotatingTokenSource struct {
+	mu    sync.Mutex
+	token string
+}
+
+func (ts *rotatingTokenSource) set(token string) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	ts.token = token
+}
+
+func (ts *rotatingTokenSource) Token() (*oauth2.Token, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	return &oauth2.Token{AccessToken: ts.token}, nil
 }
 
-func gerritClient(sc *secret.Client) (*gerrit.Client, error) {
-	username, token, err := gerritAuth(sc)
+func gerritClient(sc *secret.Cache) (*gerrit.Client, error) {
+	auth, err := gerritAuth(sc)
 	if err != nil {
 		return nil, err
 	}
-	c := gerrit.NewClient("https://go-review.googlesource.com", gerrit.BasicAuth(username, token))
+	c := gerrit.NewClient("https://go-review.googlesource.com", auth)
 	return c, nil
 }
 
-func gerritAuth(sc *secret.Client) (string, string, error) {
-	var slurp string
+// gerritAuth returns the authentication of the Gerrit client, which
+// follows the rotations of the token when it comes from the secret
+// manager.
+func gerritAuth(sc *secret.Cache) (gerrit.Auth, error) {
 	if metadata.OnGCE() {
-		var err error
 		ctx, cancel := context.WithTimeout(context.Background(), secretClientTimeout)
 		defer cancel()
-		slurp, err = sc.Retrieve(ctx, secret.NameGobotPassword)
+
+		slurp, err := sc.Retrieve(ctx, secret.NameGobotPassword)
 		if err != nil {
 			log.Printf("secret.Retrieve(ctx, %q): %q, %v", secret.NameGobotPassword, slurp, err)
+		} else if _, _, err := parseGerritToken(slurp); err != nil {
+			return nil, err
+		} else {
+			a := new(rotatingBasicAuth)
+			err := sc.Watch(context.Background(), secret.NameGobotPassword, func(slurp string) {
+				username, token, err := parseGerritToken(slurp)
+				if err != nil {
+					log.Printf("Ignoring rotated Gerrit token: %v", err)
+					return
+				}
+				a.set(username, token)
+			})
+			if err != nil {
+				return nil, err
+			}
+			return gerrit.BasicAuthFunc(a.get), nil
 		}
 	}
-	if len(slurp) == 0 {
-		slurpBytes, err := ioutil.ReadFile(*gerritTokenFile)
-		if err != nil {
-			return "", "", err
-		}
-		slurp = string(slurpBytes)
+	slurp, err := ioutil.ReadFile(*gerritTokenFile)
+	if err != nil {
+		return nil, err
 	}
+	username, token, err := parseGerritToken(string(slurp))
+	if err != nil {
+		return nil, err
+	}
+	return gerrit.BasicAuth(username, token), nil
+}
+
+// parseGerritToken parses a Gerrit token of the form <git-email>:<token>,
+// or just <token>.
+func parseGerritToken(slurp string) (username, token string, err error) {
 	f := strings.SplitN(strings.TrimSpace(slurp), ":", 2)
 	if len(f) == 1 {
 		// Assume the whole thing is the token.
@@ -192,6 +267,25 @@ func gerritAuth(sc *secret.Client) (string, string, error) {
 	return f[0], f[1], nil
 }
 
+// rotatingBasicAuth holds the latest username and token of a Gerrit
+// token that is rotated.
+type rotatingBasicAuth struct {
+	mu              sync.Mutex
+	username, token string
+}
+
+func (a *rotatingBasicAuth) set(username, token string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.username, a.token = username, token
+}
+
+func (a *rotatingBasicAuth) get() (username, token string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.username, a.token
+}
+
 func handleIndex(w http.ResponseWriter, r *http.Request) {
 	r.Header.Set("Content-Type", "text/html; charset=utf-8")
 	fmt.Fprintln(w, "Hello, GerritBot! 🤖")
@@ -265,8 +359,13 @@ func (b *bot) initCorpus(ctx context.Context) {
 // channel is closed.
 func (b *bot) corpusUpdateLoop(ctx context.Context) {
 	log.Println("Starting corpus update loop ...")
+	var lastCleanup time.Time
 	for {
 		b.checkPullRequests()
+		if time.Since(lastCleanup) > workRepoCleanupInterval {
+			cleanupWorkRepos(ctx)
+			lastCleanup = time.Now()
+		}
 		err := b.corpus.UpdateWithLocker(ctx, &b.RWMutex)
 		if err != nil {
 			if err == maintner.ErrSplit {
@@ -288,6 +387,40 @@ func (b *bot) corpusUpdateLoop(ctx context.Context) {
 	}
 }
 
+// workRepoCleanupInterval is how often cleanupWorkRepos runs.
+const workRepoCleanupInterval = time.Hour
+
+// workRepoBranchPatterns match the temporary branches that
+// importGerritChangeFromPR creates in the work repositories: one per
+// worktree, and one named after the PR's short link.
+var workRepoBranchPatterns = []string{"refs/heads/worktree_*", "refs/heads/*/*#*"}
+
+// cleanupWorkRepos deletes temporary branches that were left in the
+// work repositories, for instance because gerritbot was restarted
+// while importing a PR, so they don't slow down fetches forever.
+// It must not run concurrently with importGerritChangeFromPR.
+func cleanupWorkRepos(ctx context.Context) {
+	if *staleBranchAge <= 0 {
+		return
+	}
+	dirs, err := filepath.Glob(filepath.Join(reposRoot(), "*"))
+	if err != nil {
+		log.Printf("cleanupWorkRepos: %v", err)
+		return
+	}
+	p := cleanup.Policy{MaxAge: *staleBranchAge, DryRun: *dryRun}
+	for _, dir := range dirs {
+		r, err := cleanup.GitRefs(ctx, dir, workRepoBranchPatterns, p)
+		if err != nil {
+			log.Printf("cleanupWorkRepos: %v", err)
+			continue
+		}
+		if len(r.Stale) > 0 {
+			log.Println(r)
+		}
+	}
+}
+
 func (b *bot) checkPullRequests() {
 	b.Lock()
 	defer b.Unlock()
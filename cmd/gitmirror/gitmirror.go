@@ -5,7 +5,25 @@
 // The gitmirror binary watches the specified Gerrit repositories for
 // new commits and syncs them to mirror repositories.
 //
-// It also serves tarballs over HTTP for the build system.
+// It also serves tarballs over HTTP for the build system, and serves
+// git fetches of its repos to internal networks.
+//
+// With -verify-branches, it only mirrors the new commits of protected
+// branches that are signed by an allowed key or were merged through
+// Gerrit review, holding back branches with commits that aren't and
+// reporting them as unhealthy. The last verified commit of each branch
+// is kept in -verified-state, which must outlive the cache.
+//
+// Gerrit projects that aren't in golang.org/x/build/repos are reported
+// with an ALERT log line when they're discovered, or if they match
+// -auto-add-projects, watched and mirrored as golang.org/x repos. They
+// don't count against /healthz until they've synced once.
+//
+// With -leader-lock, several replicas can run in mirroring mode for
+// high availability. They elect a leader by taking a lock in Cloud
+// Storage, and only the leader pushes to the mirrors; the others keep
+// fetching, so that one can take over within -leader-lease of the
+// leader dying.
 package main
 
 import (
@@ -14,24 +32,30 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"html"
+	"io"
 	"io/ioutil"
 	"log"
 	"net/http"
 	"os"
 	"os/exec"
 	"os/signal"
+	"path"
 	"path/filepath"
 	"runtime"
 	"sort"
-	"strconv"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 
+	"cloud.google.com/go/storage"
 	"golang.org/x/build/gerrit"
 	"golang.org/x/build/internal/envutil"
+	"golang.org/x/build/internal/gcsfs"
 	"golang.org/x/build/internal/gitauth"
 	"golang.org/x/build/internal/secret"
+	"golang.org/x/build/internal/sourcecache"
 	"golang.org/x/build/maintner"
 	"golang.org/x/build/maintner/godata"
 	repospkg "golang.org/x/build/repos"
@@ -46,6 +70,18 @@ var (
 	flagMirrorGitHub = flag.Bool("mirror-github", true, "whether to mirror to GitHub when mirroring is enabled")
 	flagMirrorCSR    = flag.Bool("mirror-csr", true, "whether to mirror to Cloud Source Repositories when mirroring is enabled")
 	flagSecretsDir   = flag.String("secretsdir", "", "directory to load secrets from instead of GCP")
+	flagGitServeNets = flag.String("git-serve-nets", defaultGitServeNets, "comma-separated CIDR networks allowed to git fetch from the mirror at /git/<repo>; empty disables serving")
+	flagGitServeMax  = flag.Int("git-serve-max", 8, "maximum number of concurrent git fetches served")
+
+	flagVerifyBranches = flag.String("verify-branches", "", "comma-separated patterns of protected branches, such as master,release-branch.*, whose new commits must be signed by an allowed key or merged through Gerrit review to be mirrored; empty disables verification")
+	flagAllowedSigners = flag.String("allowed-signers", "", "with -verify-branches, the SSH allowed signers file of the keys commits may be signed with")
+	flagVerifiedState  = flag.String("verified-state", "", "with -verify-branches, where to keep the last verified commit of each protected branch, as gs://bucket/path or file:///path; it must outlive -cachedir, or restarts trust the branches as they are upstream")
+	flagVerifyGerrit   = flag.Bool("verify-gerrit", true, "with -verify-branches, whether commits merged through Gerrit review are verified")
+
+	flagAutoAddProjects = flag.String("auto-add-projects", "", "comma-separated patterns, such as exp,vuln*, of new Gerrit projects that aren't in golang.org/x/build/repos to start watching and mirroring as golang.org/x repos mirrored to GitHub; other new projects are reported with an ALERT log line")
+
+	flagLeaderLock  = flag.String("leader-lock", "", "with -mirror, the Cloud Storage object, as gs://bucket/object, that replicas lock to elect the one that pushes to the mirrors; empty means this is the only replica")
+	flagLeaderLease = flag.Duration("leader-lease", 15*time.Second, "with -leader-lock, how long the leader lock lasts without being renewed")
 )
 
 func main() {
@@ -83,8 +119,52 @@ func main() {
 		gerritClient: gerrit.NewClient("https://go-review.googlesource.com", gerrit.NoAuth),
 		mirrorGitHub: *flagMirrorGitHub,
 		mirrorCSR:    *flagMirrorCSR,
+		mirroring:    *flagMirror,
 		timeoutScale: 1,
 	}
+	if *flagAutoAddProjects != "" {
+		m.autoAdd = strings.Split(*flagAutoAddProjects, ",")
+		for _, pattern := range m.autoAdd {
+			if _, err := path.Match(pattern, ""); err != nil {
+				log.Fatalf("-auto-add-projects: bad pattern %q: %v", pattern, err)
+			}
+		}
+	}
+	m.archives = m.newArchiveCache()
+	if *flagVerifyBranches != "" {
+		if *flagVerifiedState == "" {
+			log.Fatalf("-verify-branches requires -verified-state")
+		}
+		sc, err := storage.NewClient(context.Background())
+		if err != nil {
+			log.Fatalf("storage.NewClient: %v", err)
+		}
+		state, err := gcsfs.FromURL(context.Background(), sc, *flagVerifiedState)
+		if err != nil {
+			log.Fatalf("-verified-state: %v", err)
+		}
+		m.verifier = &commitVerifier{
+			state:          state,
+			branches:       strings.Split(*flagVerifyBranches, ","),
+			allowedSigners: *flagAllowedSigners,
+		}
+		if *flagVerifyGerrit {
+			m.verifier.reviewed = gerritReviewed(m.gerritClient)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var electorDone chan struct{}
+	if *flagMirror && *flagLeaderLock != "" {
+		store, err := newGCSLockStore(ctx, *flagLeaderLock)
+		if err != nil {
+			log.Fatalf("-leader-lock: %v", err)
+		}
+		host, _ := os.Hostname()
+		m.elector = newElector(store, fmt.Sprintf("%s-%d", host, os.Getpid()), *flagLeaderLease)
+		m.elector.onElected = m.notifyAllChanged
+	}
 
 	var eg errgroup.Group
 	for _, repo := range repospkg.ByGerritProject {
@@ -94,13 +174,22 @@ func main() {
 
 	http.HandleFunc("/", m.handleRoot)
 	http.HandleFunc("/healthz", m.handleHealth)
+	gitNets, err := parseNets(*flagGitServeNets)
+	if err != nil {
+		log.Fatalf("invalid -git-serve-nets: %v", err)
+	}
+	if len(gitNets) > 0 {
+		if err := m.serveGit(gitNets, *flagGitServeMax); err != nil {
+			log.Fatalf("serving git: %v", err)
+		}
+	}
 
 	if err := eg.Wait(); err != nil {
 		log.Fatalf("initializing repos: %v", err)
 	}
 
 	if *flagMirror {
-		if err := writeCredentials(credsDir); err != nil {
+		if err := writeCredentials(ctx, credsDir); err != nil {
 			log.Fatalf("writing git credentials: %v", err)
 		}
 		if err := m.addMirrors(); err != nil {
@@ -108,6 +197,13 @@ func main() {
 		}
 	}
 
+	if m.elector != nil {
+		electorDone = make(chan struct{})
+		go func() {
+			m.elector.run(ctx)
+			close(electorDone)
+		}()
+	}
 	for _, repo := range m.repos {
 		go repo.loop()
 	}
@@ -115,14 +211,19 @@ func main() {
 	go m.subscribeToMaintnerAndTickleLoop()
 
 	shutdown := make(chan os.Signal, 1)
-	signal.Notify(shutdown, os.Interrupt)
+	signal.Notify(shutdown, os.Interrupt, syscall.SIGTERM)
 	<-shutdown
+	if electorDone != nil {
+		// Release the leader lock, so another replica takes over now.
+		cancel()
+		<-electorDone
+	}
 }
 
-func writeCredentials(home string) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
+// writeCredentials writes the git and ssh configuration to home. Keys
+// from the secret manager are rewritten when they're rotated, until ctx
+// is done.
+func writeCredentials(ctx context.Context, home string) error {
 	sshConfig := &bytes.Buffer{}
 	gitConfig := &bytes.Buffer{}
 	sshConfigPath := filepath.Join(home, "ssh_config")
@@ -131,13 +232,12 @@ func writeCredentials(home string) error {
 
 	// GitHub key, used as the default SSH private key.
 	if *flagMirrorGitHub {
-		privKey, err := retrieveSecret(ctx, secret.NameGitHubSSHKey)
-		if err != nil {
-			return fmt.Errorf("reading github key from secret manager: %v", err)
-		}
 		privKeyPath := filepath.Join(home, secret.NameGitHubSSHKey)
-		if err := ioutil.WriteFile(privKeyPath, []byte(privKey+"\n"), 0600); err != nil {
-			return err
+		err := watchSecret(ctx, secret.NameGitHubSSHKey, func(privKey string) error {
+			return ioutil.WriteFile(privKeyPath, []byte(privKey+"\n"), 0600)
+		})
+		if err != nil {
+			return fmt.Errorf("writing github key: %v", err)
 		}
 		fmt.Fprintf(sshConfig, "Host github.com\n  IdentityFile %v\n", privKeyPath)
 	}
@@ -157,14 +257,45 @@ func writeCredentials(home string) error {
 	return nil
 }
 
-func retrieveSecret(ctx context.Context, name string) (string, error) {
+// secretCheckInterval is how often secrets from the secret manager are
+// checked for rotations.
+const secretCheckInterval = 10 * time.Minute
+
+// watchSecret calls fn with the named secret, and returns its error.
+// Unless the secret comes from -secretsdir, fn is called again each time
+// the secret is rotated, until ctx is done, and its errors are logged.
+func watchSecret(ctx context.Context, name string, fn func(value string) error) error {
 	if *flagSecretsDir != "" {
 		secret, err := ioutil.ReadFile(filepath.Join(*flagSecretsDir, name))
-		return string(secret), err
+		if err != nil {
+			return err
+		}
+		return fn(string(secret))
+	}
+	cache := secret.NewCache(secret.MustNewClient(), secretCheckInterval)
+	retrieveCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	if _, err := cache.Retrieve(retrieveCtx, name); err != nil {
+		return fmt.Errorf("reading %q from secret manager: %v", name, err)
 	}
-	sc := secret.MustNewClient()
-	defer sc.Close()
-	return sc.Retrieve(ctx, name)
+	// Watch calls the function with the value just retrieved before it
+	// returns, and then with each rotated value.
+	var fnErr error
+	first := true
+	err := cache.Watch(ctx, name, func(value string) {
+		err := fn(value)
+		if first {
+			fnErr, first = err, false
+		} else if err != nil {
+			log.Printf("updating rotated secret %q: %v", name, err)
+		} else {
+			log.Printf("updated rotated secret %q", name)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return fnErr
 }
 
 func createCacheDir() (string, error) {
@@ -205,6 +336,51 @@ type gitMirror struct {
 	gerritClient            *gerrit.Client
 	mirrorGitHub, mirrorCSR bool
 	timeoutScale            int
+	// archives caches the archives served by repos, so that the
+	// builds of a commit all share one run of git archive.
+	archives *sourcecache.Cache
+	// verifier, if non-nil, verifies the commits on protected
+	// branches before they're mirrored.
+	verifier *commitVerifier
+	// mirroring is whether repos are mirrored, as opposed to only
+	// being served.
+	mirroring bool
+	// autoAdd are the path.Match patterns of the Gerrit projects
+	// that aren't in the repos package but are watched and mirrored
+	// when they're discovered.
+	autoAdd []string
+	// elector, if non-nil, elects the replica that pushes to the
+	// mirrors, when several are running.
+	elector *elector
+
+	mu sync.Mutex // guards repos after startup, and unmirrored
+	// unmirrored is the set of discovered Gerrit projects that aren't
+	// watched, because they don't match autoAdd.
+	unmirrored map[string]bool
+}
+
+// newArchiveCache returns a cache of the archives of m's repos.
+func (m *gitMirror) newArchiveCache() *sourcecache.Cache {
+	return sourcecache.New(sourcecache.Options{
+		Origins: []sourcecache.Origin{{Name: "git", Fetch: m.archive}},
+	})
+}
+
+// archive returns a gzip-compressed tarball of the named repo at rev.
+func (m *gitMirror) archive(ctx context.Context, name, rev string) (io.ReadCloser, error) {
+	r, ok := m.repo(name)
+	if !ok {
+		return nil, fmt.Errorf("unknown repo %q", name)
+	}
+	if err := r.fetchRevIfNeeded(ctx, rev); err != nil {
+		// Try the archive anyway, it might work
+		r.logf("error fetching revision %s: %v", rev, err)
+	}
+	tgz, _, err := r.runGitQuiet("archive", "--format=tgz", rev)
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(tgz)), nil
 }
 
 func (m *gitMirror) addRepo(meta *repospkg.Repo) *repo {
@@ -219,29 +395,126 @@ func (m *gitMirror) addRepo(meta *repospkg.Repo) *repo {
 	}
 	m.mux.Handle("/"+name+".tar.gz", r)
 	m.mux.Handle("/debug/watcher/"+r.name, r)
+	m.mu.Lock()
 	m.repos[name] = r
+	m.mu.Unlock()
 	return r
 }
 
+// repo returns the named repo, if it's watched.
+func (m *gitMirror) repo(name string) (*repo, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	r, ok := m.repos[name]
+	return r, ok
+}
+
+// allRepos returns the watched repos, sorted by name.
+func (m *gitMirror) allRepos() []*repo {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	repos := make([]*repo, 0, len(m.repos))
+	for _, r := range m.repos {
+		repos = append(repos, r)
+	}
+	sort.Slice(repos, func(i, j int) bool { return repos[i].name < repos[j].name })
+	return repos
+}
+
+// isLeader reports whether this replica pushes to the mirrors.
+func (m *gitMirror) isLeader() bool {
+	return m.elector == nil || m.elector.isLeader()
+}
+
 // addMirrors sets up mirroring for repositories that need it.
 func (m *gitMirror) addMirrors() error {
-	for _, repo := range m.repos {
-		if m.mirrorGitHub && repo.meta.MirrorToGitHub {
-			if err := repo.addRemote("github", "git@github.com:"+repo.meta.GitHubRepo+".git", ""); err != nil {
-				return fmt.Errorf("adding GitHub remote: %v", err)
-			}
+	for _, repo := range m.allRepos() {
+		if err := m.addMirrorRemotes(repo); err != nil {
+			return err
 		}
-		if m.mirrorCSR && repo.meta.MirrorToCSRProject != "" {
-			// Option "nokeycheck" skips Cloud Source Repositories' private
-			// key checking. We have dummy keys checked in as test data.
-			if err := repo.addRemote("csr", "https://source.developers.google.com/p/"+repo.meta.MirrorToCSRProject+"/r/"+repo.name, "nokeycheck"); err != nil {
-				return fmt.Errorf("adding CSR remote: %v", err)
-			}
+	}
+	return nil
+}
+
+// addMirrorRemotes sets up mirroring for repo, if it needs it.
+func (m *gitMirror) addMirrorRemotes(repo *repo) error {
+	if m.mirrorGitHub && repo.meta.MirrorToGitHub {
+		if err := repo.addRemote("github", "git@github.com:"+repo.meta.GitHubRepo+".git", ""); err != nil {
+			return fmt.Errorf("adding GitHub remote: %v", err)
+		}
+	}
+	if m.mirrorCSR && repo.meta.MirrorToCSRProject != "" {
+		// Option "nokeycheck" skips Cloud Source Repositories' private
+		// key checking. We have dummy keys checked in as test data.
+		if err := repo.addRemote("csr", "https://source.developers.google.com/p/"+repo.meta.MirrorToCSRProject+"/r/"+repo.name, "nokeycheck"); err != nil {
+			return fmt.Errorf("adding CSR remote: %v", err)
 		}
 	}
 	return nil
 }
 
+// discoverProjects compares projects, the Gerrit projects, with the
+// watched repos. It adds the repos of new projects that match autoAdd
+// and returns them, to be started with startRepo, and raises an alert
+// for each other new project, once.
+func (m *gitMirror) discoverProjects(projects []string) []*repo {
+	var added []*repo
+	for _, proj := range projects {
+		if _, ok := m.repo(proj); ok {
+			continue
+		}
+		if m.shouldAutoAdd(proj) {
+			meta := repospkg.ForNewGerritProject(proj)
+			log.Printf("discovered Gerrit project %s; watching it as %s", proj, meta.ImportPath)
+			r := m.addRepo(meta)
+			r.mu.Lock()
+			r.autoAdded = true
+			r.mu.Unlock()
+			added = append(added, r)
+			continue
+		}
+		m.mu.Lock()
+		reported := m.unmirrored[proj]
+		if m.unmirrored == nil {
+			m.unmirrored = make(map[string]bool)
+		}
+		m.unmirrored[proj] = true
+		m.mu.Unlock()
+		if !reported {
+			log.Printf("ALERT: Gerrit project %s isn't watched or mirrored; add it to golang.org/x/build/repos", proj)
+		}
+	}
+	return added
+}
+
+// shouldAutoAdd reports whether the new Gerrit project proj matches
+// autoAdd.
+func (m *gitMirror) shouldAutoAdd(proj string) bool {
+	for _, pattern := range m.autoAdd {
+		if ok, _ := path.Match(pattern, proj); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// startRepo sets up and watches r, a repo added after startup.
+func (m *gitMirror) startRepo(r *repo) {
+	for {
+		err := r.init()
+		if err == nil && m.mirroring {
+			err = m.addMirrorRemotes(r)
+		}
+		if err == nil {
+			break
+		}
+		r.logf("initializing: %v", err)
+		r.setErr(err)
+		time.Sleep(time.Minute)
+	}
+	r.loop()
+}
+
 // GET /
 // or:
 // GET /debug/watcher/
@@ -252,22 +525,35 @@ func (m *gitMirror) handleRoot(w http.ResponseWriter, r *http.Request) {
 	}
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	fmt.Fprint(w, "<html><body><pre>")
-	var names []string
-	for name := range m.repos {
-		names = append(names, name)
+	if m.elector != nil {
+		fmt.Fprintf(w, "Replica: %s\n\n", html.EscapeString(m.elector.status()))
+	}
+	for _, r := range m.allRepos() {
+		fmt.Fprintf(w, "<a href='/debug/watcher/%s'>%s</a> - %s\n", r.name, r.name, r.statusLine())
 	}
-	sort.Strings(names)
-	for _, name := range names {
-		fmt.Fprintf(w, "<a href='/debug/watcher/%s'>%s</a> - %s\n", name, name, m.repos[name].statusLine())
+	m.mu.Lock()
+	var unmirrored []string
+	for proj := range m.unmirrored {
+		unmirrored = append(unmirrored, proj)
+	}
+	m.mu.Unlock()
+	if len(unmirrored) > 0 {
+		sort.Strings(unmirrored)
+		fmt.Fprintf(w, "\nGerrit projects not watched or mirrored: %s\n", strings.Join(unmirrored, ", "))
 	}
 	fmt.Fprint(w, "</pre></body></html>")
 }
 
 func (m *gitMirror) handleHealth(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-	for _, r := range m.repos {
+	for _, r := range m.allRepos() {
 		r.mu.Lock()
 		err := r.err
+		// An auto-added project may not be set up to mirror yet,
+		// so it's healthy until it's first synced.
+		if r.autoAdded && r.lastGood.IsZero() {
+			err = nil
+		}
 		r.mu.Unlock()
 
 		if err != nil {
@@ -343,6 +629,12 @@ type repo struct {
 	lastBad   time.Time
 	firstGood time.Time
 	lastGood  time.Time
+	// quarantined maps the protected branches that aren't mirrored
+	// to why; see verifyBranches.
+	quarantined map[string]string
+	// autoAdded is whether the repo was discovered and added by
+	// -auto-add-projects.
+	autoAdded bool
 }
 
 // init sets up the repo, cloning the repository to the local root.
@@ -369,6 +661,16 @@ func (r *repo) init() error {
 		}
 		r.setStatus("cloned")
 	}
+	// Let clients of serveGit make partial clones and fetch any
+	// commit, such as one that's only reachable from a CL's ref.
+	for _, kv := range [][2]string{
+		{"uploadpack.allowFilter", "true"},
+		{"uploadpack.allowAnySHA1InWant", "true"},
+	} {
+		if _, _, err := r.runGitLogged("config", kv[0], kv[1]); err != nil {
+			return fmt.Errorf("configuring %s: %v", r.root, err)
+		}
+	}
 	return nil
 }
 
@@ -499,13 +801,31 @@ func (r *repo) loopOnce() error {
 		r.setErr(err)
 		return err
 	}
-	for _, dest := range r.dests {
-		if err := r.push(dest); err != nil {
-			r.logf("push failed: %v", err)
+	if r.mirror.verifier != nil {
+		if err := r.verifyBranches(); err != nil {
+			r.logf("verification failed: %v", err)
 			r.setErr(err)
 			return err
 		}
 	}
+	if r.mirror.isLeader() {
+		for _, dest := range r.dests {
+			if err := r.push(dest); err != nil {
+				r.logf("push failed: %v", err)
+				r.setErr(err)
+				return err
+			}
+		}
+	} else if len(r.dests) > 0 {
+		r.setStatus("standby; not pushing to mirrors")
+	}
+	if err := r.quarantineErr(); err != nil {
+		// The rest of the repo is mirrored, and the quarantine is
+		// rechecked when it next changes.
+		r.setErr(err)
+		r.setStatus("waiting; " + err.Error())
+		return nil
+	}
 	r.setErr(nil)
 	r.setStatus("waiting")
 	return nil
@@ -533,16 +853,24 @@ func (r *repo) fetch() error {
 	return err
 }
 
-// push runs "git push -f --mirror dest" in the repository root.
+// push runs "git push -f --mirror dest" in the repository root,
+// or, if any branches are quarantined, pushes all but them.
 // It tries three times, just in case it failed because of a transient error.
 func (r *repo) push(dest remote) error {
 	err := r.try(3, func(attempt int) error {
 		r.setStatus(fmt.Sprintf("syncing to %v, attempt %d", dest, attempt))
-		args := []string{"push", "-f", "--mirror"}
+		refspecs := r.pushRefspecs()
+		args := []string{"push", "-f"}
+		if refspecs == nil {
+			args = append(args, "--mirror")
+		} else {
+			args = append(args, "--prune")
+		}
 		if dest.pushOption != "" {
 			args = append(args, "--push-option", dest.pushOption)
 		}
 		args = append(args, dest.name)
+		args = append(args, refspecs...)
 		if _, stderr, err := r.runGitLogged(args...); err != nil {
 			return fmt.Errorf("%v\n\n%s", err, stderr)
 		}
@@ -581,20 +909,13 @@ func (r *repo) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
-	ctx, cancel := context.WithTimeout(req.Context(), 30*time.Second)
-	defer cancel()
-	if err := r.fetchRevIfNeeded(ctx, rev); err != nil {
-		// Try the archive anyway, it might work
-		r.logf("error fetching revision %s: %v", rev, err)
-	}
-	tgz, _, err := r.runGitQuiet("archive", "--format=tgz", rev)
+	tgz, err := r.mirror.archives.GetSourceTgz(req.Context(), nil, r.name, rev)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	w.Header().Set("Content-Length", strconv.Itoa(len(tgz)))
 	w.Header().Set("Content-Type", "application/x-compressed")
-	w.Write(tgz)
+	io.Copy(w, tgz)
 }
 
 func (r *repo) serveStatus(w http.ResponseWriter, req *http.Request) {
@@ -624,7 +945,7 @@ func (r *repo) try(n int, fn func(attempt int) error) error {
 }
 
 func (m *gitMirror) notifyChanged(name string) {
-	repo, ok := m.repos[name]
+	repo, ok := m.repo(name)
 	if !ok {
 		return
 	}
@@ -634,10 +955,18 @@ func (m *gitMirror) notifyChanged(name string) {
 	}
 }
 
+// notifyAllChanged wakes up the pollers of all repos.
+func (m *gitMirror) notifyAllChanged() {
+	for _, r := range m.allRepos() {
+		m.notifyChanged(r.name)
+	}
+}
+
 // pollGerritAndTickleLoop polls Gerrit's JSON meta URL of all its URLs
 // and their current branch heads.  When this sees that one has
 // changed, it tickles the channel for that repo and wakes up its
-// poller, if its poller is in a sleep.
+// poller, if its poller is in a sleep. It also discovers projects that
+// aren't watched yet; see discoverProjects.
 func (m *gitMirror) pollGerritAndTickleLoop() {
 	last := map[string]string{} // repo -> last seen hash
 	for {
@@ -646,6 +975,14 @@ func (m *gitMirror) pollGerritAndTickleLoop() {
 			log.Printf("pollGerritAndTickle: gerritMetaMap failed, skipping: %v", err)
 			gerritRepos = nil
 		}
+		projects := make([]string, 0, len(gerritRepos))
+		for proj := range gerritRepos {
+			projects = append(projects, proj)
+		}
+		sort.Strings(projects)
+		for _, r := range m.discoverProjects(projects) {
+			go m.startRepo(r)
+		}
 		for repo, hash := range gerritRepos {
 			if hash != last[repo] {
 				last[repo] = hash
@@ -5,7 +5,9 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"io/fs"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
@@ -14,8 +16,10 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"golang.org/x/build/internal/envutil"
+	"golang.org/x/build/internal/gcsfs"
 	repospkg "golang.org/x/build/repos"
 )
 
@@ -94,6 +98,262 @@ func TestMirrorInitiallyEmpty(t *testing.T) {
 	}
 }
 
+func TestMirrorStandby(t *testing.T) {
+	tm := newTestMirror(t)
+	store := &memLockStore{}
+	if _, err := store.write(context.Background(), lockRecord{Holder: "other"}, 0); err != nil {
+		t.Fatal(err)
+	}
+	tm.m.elector = newElector(store, "test", time.Minute)
+	tm.m.elector.onElected = tm.m.notifyAllChanged
+
+	// A standby fetches, but doesn't push.
+	tm.commit("first commit")
+	tm.m.elector.step(context.Background())
+	tm.loopOnce()
+	if out, err := exec.Command("git", "-C", tm.github, "rev-parse", "--verify", "-q", "HEAD").Output(); err == nil {
+		t.Errorf("standby pushed to github: HEAD is %s", out)
+	}
+	if body := tm.get("/"); !strings.Contains(body, "leader is other") {
+		t.Errorf("GET /: want the leader in body, got %s", body)
+	}
+
+	// Once elected, it pushes.
+	if err := store.remove(context.Background(), 1); err != nil {
+		t.Fatal(err)
+	}
+	tm.m.elector.step(context.Background())
+	select {
+	case <-tm.buildRepo.changed:
+	case <-time.After(10 * time.Second):
+		t.Fatal("repo wasn't tickled on election")
+	}
+	tm.loopOnce()
+	rev := tm.git(tm.gerrit, "rev-parse", "HEAD")
+	if githubRev := tm.git(tm.github, "rev-parse", "HEAD"); rev != githubRev {
+		t.Errorf("github HEAD is %v, want %v", githubRev, rev)
+	}
+}
+
+func TestServeGit(t *testing.T) {
+	tm := newTestMirror(t)
+	for i := 0; i < 3; i++ {
+		tm.commit(fmt.Sprintf("revision %v", i))
+	}
+	tm.loopOnce()
+	rev := strings.TrimSpace(tm.git(tm.gerrit, "rev-parse", "HEAD"))
+
+	nets, err := parseNets("127.0.0.0/8,::1/128")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tm.m.serveGit(nets, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	// A shallow, partial clone gets only the tip commit and no blobs.
+	dir := filepath.Join(t.TempDir(), "clone")
+	tm.git(t.TempDir(), "clone", "--depth=1", "--filter=blob:none", "--no-checkout", tm.server.URL+"/git/build", dir)
+	if got := strings.TrimSpace(tm.git(dir, "rev-parse", "HEAD")); got != rev {
+		t.Errorf("cloned HEAD = %v; want %v", got, rev)
+	}
+	if got := strings.TrimSpace(tm.git(dir, "rev-list", "--count", "HEAD")); got != "1" {
+		t.Errorf("shallow clone has %v commits; want 1", got)
+	}
+	if got := tm.git(dir, "rev-list", "--objects", "--missing=print", "HEAD"); !strings.Contains(got, "?") {
+		t.Errorf("partial clone has all objects; want blobs missing:\n%s", got)
+	}
+
+	// Pushes, unknown repos, and the dumb protocol aren't served.
+	for _, tt := range []struct {
+		method, path string
+		want         int
+	}{
+		{"GET", "/git/build/info/refs?service=git-receive-pack", http.StatusForbidden},
+		{"POST", "/git/build/git-receive-pack", http.StatusForbidden},
+		{"GET", "/git/build/HEAD", http.StatusForbidden},
+		{"GET", "/git/nope/info/refs?service=git-upload-pack", http.StatusNotFound},
+		{"GET", "/git/build.git/info/refs?service=git-upload-pack", http.StatusOK},
+	} {
+		req, err := http.NewRequest(tt.method, tm.server.URL+tt.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tt.want {
+			t.Errorf("%s %s: status %v; want %v", tt.method, tt.path, resp.StatusCode, tt.want)
+		}
+	}
+
+	// Clients outside the allowed networks are turned away.
+	h := &gitHandler{m: tm.m, nets: nets}
+	for addr, want := range map[string]bool{"127.0.0.1:1234": true, "[::1]:1234": true, "8.8.8.8:1234": false} {
+		if got := h.allowed(addr); got != want {
+			t.Errorf("allowed(%q) = %v; want %v", addr, got, want)
+		}
+	}
+}
+
+func TestVerifyBranches(t *testing.T) {
+	tm := newTestMirror(t)
+	branch := strings.TrimSpace(tm.git(tm.gerrit, "symbolic-ref", "--short", "HEAD"))
+	head := func(dir, ref string) string {
+		return strings.TrimSpace(tm.git(dir, "rev-parse", ref))
+	}
+
+	keyDir := t.TempDir()
+	key := filepath.Join(keyDir, "key")
+	if out, err := exec.Command("ssh-keygen", "-q", "-t", "ed25519", "-N", "", "-f", key).CombinedOutput(); err != nil {
+		t.Skipf("ssh-keygen: %v\n%s", err, out)
+	}
+	pub, err := os.ReadFile(key + ".pub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	allowedSigners := filepath.Join(keyDir, "allowed_signers")
+	if err := os.WriteFile(allowedSigners, []byte("gopher@golang.org "+string(pub)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	reviewed := map[string]bool{}
+	state := gcsfs.DirFS(t.TempDir())
+	tm.m.verifier = &commitVerifier{
+		state:          state,
+		branches:       []string{branch},
+		allowedSigners: allowedSigners,
+		reviewed: func(ctx context.Context, project, commit string) (bool, error) {
+			return project == "build" && reviewed[commit], nil
+		},
+	}
+	loopOnce := func() error {
+		t.Helper()
+		if err := tm.buildRepo.loopOnce(); err != nil {
+			t.Fatal(err)
+		}
+		return tm.buildRepo.quarantineErr()
+	}
+
+	// The branch is trusted as it is the first time it's seen.
+	tm.commit("unverified but first")
+	if err := loopOnce(); err != nil {
+		t.Fatalf("first sight of the branch: %v", err)
+	}
+
+	// Reviewed and signed commits are mirrored.
+	tm.commit("reviewed")
+	reviewed[head(tm.gerrit, "HEAD")] = true
+	if err := os.WriteFile(filepath.Join(tm.gerrit, "README"), []byte("signed"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tm.git(tm.gerrit, "-c", "gpg.format=ssh", "-c", "user.signingkey="+key, "commit", "-a", "-S", "-m", "signed")
+	if err := loopOnce(); err != nil {
+		t.Fatalf("reviewed and signed commits: %v", err)
+	}
+	verifiedRev := head(tm.gerrit, "HEAD")
+	if got := head(tm.github, branch); got != verifiedRev {
+		t.Fatalf("github %s is %v; want %v", branch, got, verifiedRev)
+	}
+	// The verified commit is kept in the durable state, not the
+	// cache, and survives the cache being emptied.
+	if b, err := fs.ReadFile(state, verifiedFile("build")); err != nil || !strings.Contains(string(b), verifiedRev) {
+		t.Fatalf("state of build = %q, %v; want it to record %v", b, err, verifiedRev)
+	}
+
+	// Other commits quarantine the branch, but the rest of the
+	// repo is still mirrored.
+	tm.commit("tampered")
+	tm.git(tm.gerrit, "branch", "dev")
+	if err := loopOnce(); err == nil || !strings.Contains(err.Error(), "neither signed") {
+		t.Errorf("unverified commit: quarantine error is %v; want one about the commit", err)
+	}
+	if got := head(tm.github, branch); got != verifiedRev {
+		t.Errorf("github %s is %v; want it held back at %v", branch, got, verifiedRev)
+	}
+	if got, want := head(tm.github, "dev"), head(tm.gerrit, "dev"); got != want {
+		t.Errorf("github dev is %v; want %v", got, want)
+	}
+	rec := httptest.NewRecorder()
+	tm.m.handleHealth(rec, httptest.NewRequest("GET", "/healthz", nil))
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("healthz with a quarantined branch: status %v; want 500", rec.Code)
+	}
+
+	// Rewriting history is caught too.
+	tm.git(tm.gerrit, "reset", "--hard", verifiedRev+"~1")
+	if err := loopOnce(); err == nil || !strings.Contains(err.Error(), "fast-forward") {
+		t.Errorf("rewritten branch: quarantine error is %v; want one about the rewrite", err)
+	}
+
+	// Once the branch is restored upstream, it's mirrored again.
+	tm.git(tm.gerrit, "reset", "--hard", verifiedRev)
+	tm.commit("reviewed again")
+	reviewed[head(tm.gerrit, "HEAD")] = true
+	if err := loopOnce(); err != nil {
+		t.Errorf("restored branch: %v", err)
+	}
+	if got, want := head(tm.github, branch), head(tm.gerrit, "HEAD"); got != want {
+		t.Errorf("github %s is %v; want %v", branch, got, want)
+	}
+}
+
+func TestDiscoverProjects(t *testing.T) {
+	tm := newTestMirror(t)
+
+	// New projects are reported, once, but not watched by default.
+	for i := 0; i < 2; i++ {
+		if added := tm.m.discoverProjects([]string{"build", "newx"}); len(added) != 0 {
+			t.Errorf("discoverProjects without autoAdd added %d repos; want 0", len(added))
+		}
+	}
+	// Nor if they don't match autoAdd.
+	tm.m.autoAdd = []string{"other*"}
+	if added := tm.m.discoverProjects([]string{"build", "newx"}); len(added) != 0 {
+		t.Errorf("discoverProjects with autoAdd %q added %d repos; want 0", tm.m.autoAdd, len(added))
+	}
+	if _, ok := tm.m.repo("newx"); ok {
+		t.Errorf("discoverProjects without autoAdd watches newx")
+	}
+	if body := tm.get("/"); !strings.Contains(body, "not watched or mirrored: newx") {
+		t.Errorf("homepage doesn't report newx as unmirrored: %q", body)
+	}
+
+	// If they match autoAdd, they're watched as golang.org/x repos.
+	newx := filepath.Join(strings.TrimSuffix(tm.m.goBase, "/"), "newx")
+	tm.git(tm.gerrit, "init", newx)
+	tm.git(newx, "-c", "user.name=Gopher", "-c", "user.email=gopher@golang.org", "commit", "--allow-empty", "-m", "initial commit")
+	tm.m.autoAdd = []string{"other*", "new*"}
+	added := tm.m.discoverProjects([]string{"build", "newx"})
+	if len(added) != 1 || added[0].name != "newx" {
+		t.Fatalf("discoverProjects with autoAdd added %v; want newx", added)
+	}
+	if r, ok := tm.m.repo("newx"); !ok || r.meta.ImportPath != "golang.org/x/newx" {
+		t.Fatalf("newx repo = %v, %v; want a golang.org/x repo", r, ok)
+	}
+	// It's healthy until it first syncs, however it fails.
+	added[0].setErr(fmt.Errorf("no GitHub repo yet"))
+	rec := httptest.NewRecorder()
+	tm.m.handleHealth(rec, httptest.NewRequest("GET", "/healthz", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("healthz with an unsynced discovered repo: status %v; want 200", rec.Code)
+	}
+	if err := added[0].init(); err != nil {
+		t.Fatal(err)
+	}
+	if err := added[0].loopOnce(); err != nil {
+		t.Errorf("loopOnce of the discovered repo: %v", err)
+	}
+	tm.get("/newx.tar.gz?rev=HEAD")
+	added[0].setErr(fmt.Errorf("broken"))
+	rec = httptest.NewRecorder()
+	tm.m.handleHealth(rec, httptest.NewRequest("GET", "/healthz", nil))
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("healthz with a broken discovered repo that synced: status %v; want 500", rec.Code)
+	}
+}
+
 type testMirror struct {
 	// Local paths to the copies of the build repo.
 	gerrit, github, csr string
@@ -139,6 +399,7 @@ func newTestMirror(t *testing.T) *testMirror {
 		},
 		t: t,
 	}
+	tm.m.archives = tm.m.newArchiveCache()
 	tm.m.mux.HandleFunc("/", tm.m.handleRoot)
 	tm.server = httptest.NewServer(tm.m.mux)
 	t.Cleanup(tm.server.Close)
@@ -0,0 +1,260 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/googleapi"
+)
+
+// errLockConflict is returned by a lockStore when the lock changed
+// since the generation a write or removal was conditioned on.
+var errLockConflict = errors.New("lock changed since it was read")
+
+// A lockStore holds the lock that replicas of gitmirror take to become
+// the leader, the one replica that pushes to the mirrors. Every change
+// to the lock gets a new generation, which changes are conditioned on.
+type lockStore interface {
+	// read returns the lock and its generation, or a zero
+	// generation if nobody holds it.
+	read(ctx context.Context) (l lockRecord, gen int64, err error)
+	// write writes l if the lock's generation is still gen, and
+	// returns its new generation.
+	write(ctx context.Context, l lockRecord, gen int64) (newGen int64, err error)
+	// remove releases the lock if its generation is still gen.
+	remove(ctx context.Context, gen int64) error
+}
+
+// A lockRecord is the content of the leader lock.
+type lockRecord struct {
+	Holder  string    `json:"holder"`
+	Renewed time.Time `json:"renewed"` // for humans; replicas don't compare clocks
+}
+
+// gcsLockStore is a lockStore in a Cloud Storage object.
+type gcsLockStore struct {
+	obj *storage.ObjectHandle
+}
+
+// newGCSLockStore returns a lockStore in the object at uri, of the
+// form gs://bucket/object.
+func newGCSLockStore(ctx context.Context, uri string) (*gcsLockStore, error) {
+	bucket, object, ok := strings.Cut(strings.TrimPrefix(uri, "gs://"), "/")
+	if !strings.HasPrefix(uri, "gs://") || !ok || bucket == "" || object == "" {
+		return nil, fmt.Errorf("invalid lock %q; want gs://bucket/object", uri)
+	}
+	sc, err := storage.NewClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &gcsLockStore{obj: sc.Bucket(bucket).Object(object)}, nil
+}
+
+func (s *gcsLockStore) read(ctx context.Context) (lockRecord, int64, error) {
+	rd, err := s.obj.NewReader(ctx)
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return lockRecord{}, 0, nil
+	} else if err != nil {
+		return lockRecord{}, 0, err
+	}
+	defer rd.Close()
+	var l lockRecord
+	if err := json.NewDecoder(rd).Decode(&l); err != nil {
+		// Still let the lock be taken over once it's stale.
+		log.Printf("leader lock: decoding %s: %v", s.obj.ObjectName(), err)
+	}
+	return l, rd.Attrs.Generation, nil
+}
+
+func (s *gcsLockStore) write(ctx context.Context, l lockRecord, gen int64) (int64, error) {
+	cond := storage.Conditions{GenerationMatch: gen}
+	if gen == 0 {
+		cond = storage.Conditions{DoesNotExist: true}
+	}
+	w := s.obj.If(cond).NewWriter(ctx)
+	w.ContentType = "application/json"
+	w.CacheControl = "no-store"
+	if err := json.NewEncoder(w).Encode(l); err != nil {
+		w.Close()
+		return 0, err
+	}
+	if err := w.Close(); err != nil {
+		return 0, lockErr(err)
+	}
+	return w.Attrs().Generation, nil
+}
+
+func (s *gcsLockStore) remove(ctx context.Context, gen int64) error {
+	return lockErr(s.obj.If(storage.Conditions{GenerationMatch: gen}).Delete(ctx))
+}
+
+// lockErr returns errLockConflict if err is a failed precondition,
+// and err otherwise.
+func lockErr(err error) error {
+	var gerr *googleapi.Error
+	if errors.As(err, &gerr) && gerr.Code == http.StatusPreconditionFailed {
+		return errLockConflict
+	}
+	return err
+}
+
+// An elector elects one of the replicas sharing a lockStore as the
+// leader. The leader renews the lock every third of the lease. The
+// others take it over once they've seen it go unchanged for the whole
+// lease, and the leader steps down if it fails to renew it for two
+// thirds of the lease, so that there's never more than one leader,
+// whatever the replicas' clocks say.
+type elector struct {
+	store lockStore
+	id    string        // identifies this replica in the lock
+	lease time.Duration // how long the lock lasts without renewal
+	now   func() time.Time
+
+	// onElected, if non-nil, is called in its own goroutine when
+	// this replica becomes the leader.
+	onElected func()
+
+	mu      sync.Mutex
+	leader  bool
+	holder  string    // holder of the lock, when last read
+	gen     int64     // generation of the lock, when last read
+	seen    time.Time // when gen was first seen
+	renewed time.Time // when this replica last wrote the lock
+}
+
+func newElector(store lockStore, id string, lease time.Duration) *elector {
+	return &elector{store: store, id: id, lease: lease, now: time.Now}
+}
+
+// isLeader reports whether this replica is the leader.
+func (e *elector) isLeader() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.leader && e.now().Sub(e.renewed) < e.lease*2/3
+}
+
+// status returns a line describing the state of the election.
+func (e *elector) status() string {
+	if e.isLeader() {
+		return fmt.Sprintf("leader (%s)", e.id)
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.gen == 0 {
+		return fmt.Sprintf("standby (%s); no leader", e.id)
+	}
+	return fmt.Sprintf("standby (%s); leader is %s", e.id, e.holder)
+}
+
+// run takes part in the election until ctx is done, when it releases
+// the lock if this replica holds it.
+func (e *elector) run(ctx context.Context) {
+	t := time.NewTicker(e.lease / 3)
+	defer t.Stop()
+	for {
+		stepCtx, cancel := context.WithTimeout(ctx, e.lease/3)
+		e.step(stepCtx)
+		cancel()
+		select {
+		case <-ctx.Done():
+			releaseCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := e.release(releaseCtx); err != nil {
+				log.Printf("leader lock: releasing: %v", err)
+			}
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// step reads the lock, and takes or renews it if it's free, stale or
+// already held by this replica.
+func (e *elector) step(ctx context.Context) {
+	l, gen, err := e.store.read(ctx)
+	if err != nil {
+		log.Printf("leader lock: reading: %v", err)
+		e.checkStale()
+		return
+	}
+	now := e.now()
+	e.mu.Lock()
+	if gen != e.gen {
+		e.gen, e.holder, e.seen = gen, l.Holder, now
+	}
+	free := gen == 0 || l.Holder == e.id || now.Sub(e.seen) >= e.lease
+	e.mu.Unlock()
+	if !free {
+		e.setLeader(false)
+		return
+	}
+	newGen, err := e.store.write(ctx, lockRecord{Holder: e.id, Renewed: now.UTC()}, gen)
+	if err != nil {
+		if !errors.Is(err, errLockConflict) {
+			log.Printf("leader lock: writing: %v", err)
+		}
+		e.checkStale()
+		return
+	}
+	e.mu.Lock()
+	e.gen, e.holder, e.seen, e.renewed = newGen, e.id, now, now
+	e.mu.Unlock()
+	e.setLeader(true)
+}
+
+// checkStale steps down if this replica is the leader but hasn't
+// renewed the lock in time.
+func (e *elector) checkStale() {
+	if !e.isLeader() {
+		e.setLeader(false)
+	}
+}
+
+func (e *elector) setLeader(leader bool) {
+	e.mu.Lock()
+	changed := e.leader != leader
+	e.leader = leader
+	holder := e.holder
+	e.mu.Unlock()
+	switch {
+	case !changed:
+	case leader:
+		log.Printf("leader lock: %s is now the leader", e.id)
+		if e.onElected != nil {
+			go e.onElected()
+		}
+	case holder == e.id:
+		log.Printf("leader lock: %s is no longer the leader", e.id)
+	default:
+		log.Printf("leader lock: %s is no longer the leader; the lock is held by %q", e.id, holder)
+	}
+}
+
+// release releases the lock if this replica holds it, so that another
+// can take over without waiting for the lease to run out.
+func (e *elector) release(ctx context.Context) error {
+	e.mu.Lock()
+	held := e.leader && e.holder == e.id
+	gen := e.gen
+	e.mu.Unlock()
+	if !held {
+		return nil
+	}
+	e.setLeader(false)
+	if err := e.store.remove(ctx, gen); err != nil && !errors.Is(err, errLockConflict) {
+		return err
+	}
+	return nil
+}
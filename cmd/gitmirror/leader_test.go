@@ -0,0 +1,139 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memLockStore is a lockStore in memory.
+type memLockStore struct {
+	mu  sync.Mutex
+	l   lockRecord
+	gen int64
+	n   int64 // last generation handed out
+	err error // if non-nil, returned by all operations
+}
+
+func (s *memLockStore) read(ctx context.Context) (lockRecord, int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.l, s.gen, s.err
+}
+
+func (s *memLockStore) write(ctx context.Context, l lockRecord, gen int64) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return 0, s.err
+	}
+	if gen != s.gen {
+		return 0, errLockConflict
+	}
+	s.n++
+	s.l, s.gen = l, s.n
+	return s.gen, nil
+}
+
+func (s *memLockStore) remove(ctx context.Context, gen int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	if gen != s.gen {
+		return errLockConflict
+	}
+	s.l, s.gen = lockRecord{}, 0
+	return nil
+}
+
+func TestElector(t *testing.T) {
+	const lease = 15 * time.Second
+	store := &memLockStore{}
+	now := time.Date(2023, 9, 1, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+	a := newElector(store, "a", lease)
+	b := newElector(store, "b", lease)
+	a.now, b.now = clock, clock
+	elected := make(chan string, 2)
+	a.onElected = func() { elected <- "a" }
+	b.onElected = func() { elected <- "b" }
+	ctx := context.Background()
+	check := func(wantA, wantB bool) {
+		t.Helper()
+		if gotA, gotB := a.isLeader(), b.isLeader(); gotA != wantA || gotB != wantB {
+			t.Fatalf("at %v: a.isLeader() = %v, b.isLeader() = %v; want %v, %v", now, gotA, gotB, wantA, wantB)
+		}
+	}
+	wantElected := func(id string) {
+		t.Helper()
+		select {
+		case got := <-elected:
+			if got != id {
+				t.Fatalf("%s was elected; want %s", got, id)
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatalf("%s wasn't elected", id)
+		}
+	}
+
+	// The first to try takes the free lock, and keeps it as long as
+	// it renews it.
+	a.step(ctx)
+	b.step(ctx)
+	check(true, false)
+	wantElected("a")
+	for i := 0; i < 5; i++ {
+		now = now.Add(lease / 3)
+		a.step(ctx)
+		b.step(ctx)
+		check(true, false)
+	}
+	if got := b.status(); !strings.Contains(got, "leader is a") {
+		t.Errorf("b.status() = %q; want it to name a as the leader", got)
+	}
+
+	// The leader stops renewing the lock, say because it's hung: it
+	// steps down before the standby takes over.
+	now = now.Add(lease * 2 / 3)
+	check(false, false)
+	b.step(ctx)
+	check(false, false)
+	now = now.Add(lease / 3)
+	b.step(ctx)
+	check(false, true)
+	wantElected("b")
+	a.step(ctx)
+	check(false, true)
+
+	// The leader can't reach the store: it steps down in time, and
+	// comes back once it can reach it again.
+	store.err = errors.New("unavailable")
+	for i := 0; i < 3; i++ {
+		now = now.Add(lease / 3)
+		a.step(ctx)
+		b.step(ctx)
+	}
+	check(false, false)
+	store.err = nil
+	b.step(ctx)
+	check(false, true)
+	wantElected("b")
+
+	// Releasing the lock lets the standby take over at once.
+	if err := b.release(ctx); err != nil {
+		t.Fatal(err)
+	}
+	check(false, false)
+	a.step(ctx)
+	check(true, false)
+	wantElected("a")
+}
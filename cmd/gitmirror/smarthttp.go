@@ -0,0 +1,127 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/cgi"
+	"os/exec"
+	"strings"
+)
+
+// defaultGitServeNets are the networks allowed to clone from the
+// mirror by default: loopback and private networks, which is where
+// internal consumers such as the build infrastructure's clusters are.
+const defaultGitServeNets = "127.0.0.0/8,::1/128,10.0.0.0/8,172.16.0.0/12,192.168.0.0/16,fc00::/7"
+
+// parseNets parses a comma-separated list of CIDR networks.
+func parseNets(s string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, f := range strings.Split(s, ",") {
+		f = strings.TrimSpace(f)
+		if f == "" {
+			continue
+		}
+		_, n, err := net.ParseCIDR(f)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+// serveGit serves the Git smart HTTP protocol for fetching from m's
+// repos under /git/, so that internal consumers can clone from the
+// mirror rather than from Gerrit. Shallow (--depth) and partial
+// (--filter) clones are supported. Only clients in nets may fetch, at
+// most maxConcurrent at a time; pushing is never allowed.
+//
+// Fetching a repo that the mirror doesn't have yet fails, rather than
+// falling back to Gerrit.
+func (m *gitMirror) serveGit(nets []*net.IPNet, maxConcurrent int) error {
+	gitPath, err := exec.LookPath("git")
+	if err != nil {
+		return err
+	}
+	h := &gitHandler{
+		m:    m,
+		nets: nets,
+		sem:  make(chan struct{}, maxConcurrent),
+		backend: &cgi.Handler{
+			Path: gitPath,
+			Args: []string{"http-backend"},
+			Root: "/git",
+			Dir:  m.cacheDir,
+			Env: []string{
+				"GIT_PROJECT_ROOT=" + m.cacheDir,
+				"GIT_HTTP_EXPORT_ALL=1",
+				"HOME=" + m.homeDir,
+			},
+		},
+	}
+	m.mux.Handle("/git/", h)
+	return nil
+}
+
+type gitHandler struct {
+	m       *gitMirror
+	nets    []*net.IPNet
+	sem     chan struct{} // limits concurrent requests
+	backend http.Handler  // git http-backend
+}
+
+// GET /git/<name>/info/refs?service=git-upload-pack
+// POST /git/<name>/git-upload-pack
+func (h *gitHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if !h.allowed(req.RemoteAddr) {
+		http.Error(w, "fetching from the mirror is restricted to internal networks", http.StatusForbidden)
+		return
+	}
+	name, op, ok := strings.Cut(strings.TrimPrefix(req.URL.Path, "/git/"), "/")
+	if _, known := h.m.repo(strings.TrimSuffix(name, ".git")); !ok || !known {
+		http.NotFound(w, req)
+		return
+	}
+	switch {
+	case req.Method == "GET" && op == "info/refs" && req.FormValue("service") == "git-upload-pack":
+	case req.Method == "POST" && op == "git-upload-pack":
+	default:
+		// Pushes and the dumb HTTP protocol.
+		http.Error(w, fmt.Sprintf("%s %s is not supported; the mirror only serves git fetch", req.Method, req.URL.Path), http.StatusForbidden)
+		return
+	}
+	select {
+	case h.sem <- struct{}{}:
+		defer func() { <-h.sem }()
+	case <-req.Context().Done():
+		return
+	}
+	if strings.HasSuffix(name, ".git") {
+		// The repos are stored without the suffix.
+		req.URL.Path = "/git/" + strings.TrimSuffix(name, ".git") + "/" + op
+	}
+	h.backend.ServeHTTP(w, req)
+}
+
+// allowed reports whether a client at addr may fetch.
+func (h *gitHandler) allowed(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, n := range h.nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,238 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/build/gerrit"
+	"golang.org/x/build/internal/gcsfs"
+)
+
+// A commitVerifier checks that the new commits on protected branches
+// are legitimate before they're mirrored, to detect tampering with
+// the repos upstream of the mirror.
+//
+// A commit is legitimate if it's signed by an allowed key or was
+// merged through Gerrit review. A protected branch with a commit
+// that isn't, or that was rewritten, is quarantined: it's left at
+// its last verified commit in the mirrors until it verifies again,
+// such as once the commit is removed upstream or its signer is
+// allowed.
+//
+// The first time a protected branch is seen, it's trusted as it is.
+// The last verified commit of each branch is kept in durable storage,
+// not in the mirror's cache, so that a restart with an empty cache
+// doesn't trust whatever the branches upstream have by then.
+type commitVerifier struct {
+	// state holds the last verified commit of each protected branch
+	// of each repo, such as in a GCS bucket (see gcsfs.FromURL).
+	state fs.FS
+	// branches are the path.Match patterns of the protected branches,
+	// such as "master" or "release-branch.*".
+	branches []string
+	// allowedSigners, if non-empty, is the path of the SSH allowed
+	// signers file listing the keys commits may be signed with.
+	// See ssh-keygen(1).
+	allowedSigners string
+	// reviewed, if non-nil, reports whether commit was merged
+	// through Gerrit review in project.
+	reviewed func(ctx context.Context, project, commit string) (bool, error)
+}
+
+// gerritReviewed returns a commitVerifier.reviewed func that asks
+// Gerrit.
+func gerritReviewed(c *gerrit.Client) func(ctx context.Context, project, commit string) (bool, error) {
+	return func(ctx context.Context, project, commit string) (bool, error) {
+		cis, err := c.QueryChanges(ctx, fmt.Sprintf("project:%s commit:%s status:merged", project, commit))
+		if err != nil {
+			return false, err
+		}
+		return len(cis) > 0, nil
+	}
+}
+
+// protects reports whether branch is protected.
+func (v *commitVerifier) protects(branch string) bool {
+	for _, pattern := range v.branches {
+		if ok, _ := path.Match(pattern, branch); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// verifiedFile returns the name of the file in the verifier's state
+// that records the last verified commit of each protected branch of
+// repo.
+func verifiedFile(repo string) string {
+	return repo + ".json"
+}
+
+// verifyBranches verifies the commits on r's protected branches that
+// are new since they were last verified, quarantining the branches
+// with commits that fail. It returns an error only if it can't tell.
+func (r *repo) verifyBranches() error {
+	v := r.mirror.verifier
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	verified := make(map[string]string) // branch → commit
+	if b, err := fs.ReadFile(v.state, verifiedFile(r.name)); err == nil {
+		if err := json.Unmarshal(b, &verified); err != nil {
+			return fmt.Errorf("reading %s: %v", verifiedFile(r.name), err)
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	out, _, err := r.runGitQuiet("for-each-ref", "--format=%(refname:lstrip=2) %(objectname)", "refs/heads/")
+	if err != nil {
+		return err
+	}
+	quarantined := make(map[string]string) // branch → reason
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		branch, tip, ok := strings.Cut(line, " ")
+		if !ok || !v.protects(branch) {
+			continue
+		}
+		last, ok := verified[branch]
+		if !ok {
+			r.logf("trusting protected branch %s at %s on first sight", branch, tip)
+			verified[branch] = tip
+			continue
+		}
+		if last == tip {
+			continue
+		}
+		reason, err := r.verifyUpdate(ctx, last, tip)
+		if err != nil {
+			return fmt.Errorf("verifying %s: %v", branch, err)
+		}
+		if reason != "" {
+			quarantined[branch] = reason
+			continue
+		}
+		verified[branch] = tip
+	}
+
+	b, err := json.MarshalIndent(verified, "", "\t")
+	if err != nil {
+		return err
+	}
+	if err := writeState(v.state, verifiedFile(r.name), b); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for branch, reason := range quarantined {
+		if r.quarantined[branch] != reason {
+			r.logf("ALERT: quarantining branch %s, not mirroring it past %s: %s", branch, verified[branch], reason)
+		}
+	}
+	for branch := range r.quarantined {
+		if _, ok := quarantined[branch]; !ok {
+			r.logf("branch %s verified again; lifting its quarantine", branch)
+		}
+	}
+	r.quarantined = quarantined
+	return nil
+}
+
+// writeState replaces the named file of fsys with data. GCS replaces
+// objects when they're written, but gcsfs.DirFS doesn't.
+func writeState(fsys fs.FS, name string, data []byte) error {
+	err := gcsfs.WriteFile(fsys, name, data)
+	if err == nil {
+		return nil
+	}
+	if _, statErr := fs.Stat(fsys, name); statErr != nil {
+		return err
+	}
+	if err := gcsfs.Remove(fsys, name); err != nil {
+		return err
+	}
+	return gcsfs.WriteFile(fsys, name, data)
+}
+
+// verifyUpdate verifies the update of a protected branch from commit
+// last to tip, returning why it isn't legitimate, or "" if it is.
+func (r *repo) verifyUpdate(ctx context.Context, last, tip string) (reason string, _ error) {
+	if _, _, err := r.runGitQuiet("merge-base", "--is-ancestor", last, tip); err != nil {
+		return fmt.Sprintf("%s isn't a fast-forward of %s", tip, last), nil
+	}
+	out, _, err := r.runGitQuiet("rev-list", "--reverse", tip, "^"+last)
+	if err != nil {
+		return "", err
+	}
+	for _, commit := range strings.Fields(string(out)) {
+		ok, err := r.verifyCommit(ctx, commit)
+		if err != nil {
+			return "", err
+		}
+		if !ok {
+			return fmt.Sprintf("commit %s is neither signed by an allowed key nor merged through Gerrit review", commit), nil
+		}
+	}
+	return "", nil
+}
+
+// verifyCommit reports whether commit is signed by an allowed key or
+// was merged through Gerrit review.
+func (r *repo) verifyCommit(ctx context.Context, commit string) (bool, error) {
+	v := r.mirror.verifier
+	if v.allowedSigners != "" {
+		if _, _, err := r.runGitQuiet("-c", "gpg.ssh.allowedSignersFile="+v.allowedSigners, "verify-commit", commit); err == nil {
+			return true, nil
+		}
+	}
+	if v.reviewed != nil {
+		return v.reviewed(ctx, r.name, commit)
+	}
+	return false, nil
+}
+
+// quarantineErr returns an error describing r's quarantined branches,
+// or nil if there are none.
+func (r *repo) quarantineErr() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.quarantined) == 0 {
+		return nil
+	}
+	var branches []string
+	for branch, reason := range r.quarantined {
+		branches = append(branches, branch+": "+reason)
+	}
+	sort.Strings(branches)
+	return fmt.Errorf("quarantined branches with unverified commits: %s", strings.Join(branches, "; "))
+}
+
+// pushRefspecs returns the refspecs that push to a mirror: those of
+// its published branches and tags, except quarantined branches.
+// It returns nil if nothing is quarantined, and everything is
+// mirrored.
+func (r *repo) pushRefspecs() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.quarantined) == 0 {
+		return nil
+	}
+	refspecs := []string{"+refs/heads/*:refs/heads/*", "+refs/tags/*:refs/tags/*"}
+	for branch := range r.quarantined {
+		refspecs = append(refspecs, "^refs/heads/"+branch)
+	}
+	sort.Strings(refspecs[2:])
+	return refspecs
+}
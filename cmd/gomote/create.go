@@ -160,31 +160,17 @@ func create(args []string) error {
 	var tmpOutDir string
 	var tmpOutDirOnce sync.Once
 	eg, ctx := errgroup.WithContext(context.Background())
-	client := gomoteServerClient(ctx)
 	for i := 0; i < count; i++ {
 		i := i
 		eg.Go(func() error {
-			start := time.Now()
-			stream, err := client.CreateInstance(ctx, &protos.CreateInstanceRequest{BuilderType: builderType})
+			inst, err := doCreate(ctx, builderType, status, i)
 			if err != nil {
-				return fmt.Errorf("failed to create buildlet: %w", err)
-			}
-			var inst string
-		updateLoop:
-			for {
-				update, err := stream.Recv()
-				switch {
-				case err == io.EOF:
-					break updateLoop
-				case err != nil:
-					return fmt.Errorf("failed to create buildlet (%d): %w", i+1, err)
-				case update.GetStatus() != protos.CreateInstanceResponse_COMPLETE && status:
-					fmt.Fprintf(os.Stderr, "# still creating %s (%d) after %v; %d requests ahead of you\n", builderType, i+1, time.Since(start).Round(time.Second), update.GetWaitersAhead())
-				case update.GetStatus() == protos.CreateInstanceResponse_COMPLETE:
-					inst = update.GetInstance().GetGomoteId()
-				}
+				return err
 			}
 			fmt.Println(inst)
+			if err := recordCreate(inst, builderType, setup); err != nil {
+				fmt.Fprintf(os.Stderr, "# Not recording the setup of %s: %v\n", inst, err)
+			}
 			if group != nil {
 				groupMu.Lock()
 				group.Instances = append(group.Instances, inst)
@@ -218,7 +204,7 @@ func create(args []string) error {
 
 			// Run make.bash or make.bat.
 			cmd := "go/src/make.bash"
-			if strings.Contains(builderType, "windows") {
+			if isWindowsBuilder(builderType) {
 				cmd = "go/src/make.bat"
 			}
 
@@ -252,3 +238,29 @@ func create(args []string) error {
 	}
 	return nil
 }
+
+// doCreate creates an instance of builderType, the i'th of a create
+// command, and returns its name. If status is set, it prints regular
+// status updates while waiting.
+func doCreate(ctx context.Context, builderType string, status bool, i int) (string, error) {
+	client := gomoteServerClient(ctx)
+	start := time.Now()
+	stream, err := client.CreateInstance(ctx, &protos.CreateInstanceRequest{BuilderType: builderType})
+	if err != nil {
+		return "", fmt.Errorf("failed to create buildlet: %w", err)
+	}
+	var inst string
+	for {
+		update, err := stream.Recv()
+		switch {
+		case err == io.EOF:
+			return inst, nil
+		case err != nil:
+			return "", fmt.Errorf("failed to create buildlet (%d): %w", i+1, err)
+		case update.GetStatus() != protos.CreateInstanceResponse_COMPLETE && status:
+			fmt.Fprintf(os.Stderr, "# still creating %s (%d) after %v; %d requests ahead of you\n", builderType, i+1, time.Since(start).Round(time.Second), update.GetWaitersAhead())
+		case update.GetStatus() == protos.CreateInstanceResponse_COMPLETE:
+			inst = update.GetInstance().GetGomoteId()
+		}
+	}
+}
@@ -62,6 +62,9 @@ func destroy(args []string) error {
 		}); err != nil {
 			return fmt.Errorf("unable to destroy instance: %w", err)
 		}
+		if err := deleteHistory(name); err != nil {
+			return err
+		}
 	}
 	if activeGroup != nil {
 		if destroyGroup {
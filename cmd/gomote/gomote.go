@@ -36,7 +36,9 @@ To list the subcommands, run "gomote" without arguments:
 	  rm         delete files or directories
 	  rdp        RDP (Remote Desktop Protocol) to a Windows buildlet
 	  run        run a command on a buildlet
+	  share      upload a file from a buildlet, to link to from an issue
 	  ssh        ssh to a buildlet
+	  tail       follow a file on a buildlet as it's appended to
 
 To list all the builder types available, run "create" with no arguments:
 
@@ -113,6 +115,48 @@ As this example demonstrates, groups are useful even if the group
 contains only a single instance: it can dramatically shorten most gomote
 commands.
 
+# Unhealthy instances
+
+The health command checks that instances are reachable, have free disk
+space, and have accurate clocks. With the -watch flag, it keeps checking
+and sends a desktop notification when an instance becomes unhealthy:
+
+	$ gomote health -watch=5m
+
+The setup commands run on an instance (push, put, puttar, putbootstrap,
+rm, and run) are recorded, so that an unhealthy instance can be replaced
+with one command. The replace command destroys the instance, creates a
+new one of the same type in the same groups, and prints its setup
+commands. With the -replay flag, it runs them on the new instance:
+
+	$ gomote replace -replay user-username-linux-amd64-0
+
+# Sharing files
+
+The share command uploads a file from an instance to a public bucket and
+prints a Markdown link to it, ready to paste into an issue. Shared files
+may be up to 25 MiB, and are deleted after 30 days:
+
+	$ gomote share user-username-linux-amd64-0 go/src/repro.log
+	[repro.log](https://storage.googleapis.com/...) (from user-username-linux-amd64-0, 12.3 KiB, available until 2023-07-01)
+
+# Following logs
+
+The tail command prints a file on an instance and keeps printing what's
+appended to it until interrupted, like tail -f. It follows the file by
+name, so it continues with the new file if a test rotates its log:
+
+	$ gomote tail -c 4096 user-username-linux-amd64-0 go/src/test.log
+
+# Authentication
+
+Gomote authenticates to the coordinator with a login in the browser,
+which it remembers in the user's config directory. To authenticate as a
+service account instead, such as on a CI machine, use the -impersonate
+global flag or the GOMOTE_IMPERSONATE environment variable. This requires
+Application Default Credentials allowed to impersonate the service
+account, as set up by "gcloud auth application-default login".
+
 # Tips and tricks
 
   - The create command accepts the -setup flag which also pushes a GOROOT
@@ -209,6 +253,7 @@ func registerCommands() {
 	registerCommand("destroy", "destroy a buildlet", destroy)
 	registerCommand("gettar", "extract a tar.gz from a buildlet", getTar)
 	registerCommand("group", "manage groups of instances", group)
+	registerCommand("health", "check the health of buildlets", health)
 	registerCommand("ls", "list the contents of a directory on a buildlet", ls)
 	registerCommand("list", "list active buildlets", list)
 	registerCommand("ping", "test whether a buildlet is alive and reachable ", ping)
@@ -216,14 +261,18 @@ func registerCommands() {
 	registerCommand("put", "put files on a buildlet", put)
 	registerCommand("putbootstrap", "put bootstrap toolchain in place", putBootstrap)
 	registerCommand("puttar", "extract a tar.gz to a buildlet", putTar)
+	registerCommand("replace", "replace a buildlet with a new one and print or replay its setup", replace)
 	registerCommand("rdp", "Unimplimented: RDP (Remote Desktop Protocol) to a Windows buildlet", rdp)
 	registerCommand("rm", "delete files or directories", rm)
 	registerCommand("run", "run a command on a buildlet", run)
+	registerCommand("share", "upload a file from a buildlet, to link to from an issue", share)
 	registerCommand("ssh", "ssh to a buildlet", ssh)
+	registerCommand("tail", "follow a file on a buildlet as it's appended to", tail)
 }
 
 var (
-	serverAddr = flag.String("server", "build.golang.org:443", "Address for GRPC server")
+	serverAddr  = flag.String("server", "build.golang.org:443", "Address for GRPC server")
+	impersonate = flag.String("impersonate", os.Getenv("GOMOTE_IMPERSONATE"), "email of a service account to authenticate as, using Application Default Credentials (default is $GOMOTE_IMPERSONATE)")
 )
 
 func main() {
@@ -270,12 +319,15 @@ func main() {
 	if err := cmd.run(args[1:]); err != nil {
 		logAndExitf("Error running %s: %v\n", cmdName, err)
 	}
+	if err := recordSetup(args); err != nil {
+		fmt.Fprintf(os.Stderr, "# Not recording the %s command for gomote replace: %v\n", cmdName, err)
+	}
 }
 
 // gomoteServerClient returns a gomote server client which can be used to interact with the gomote GRPC server.
 // It will either retrieve a previously created authentication token or attempt to create a new one.
 func gomoteServerClient(ctx context.Context) protos.GomoteServiceClient {
-	grpcClient, err := iapclient.GRPCClient(ctx, *serverAddr)
+	grpcClient, err := iapclient.GRPCClient(ctx, *serverAddr, iapclient.ImpersonateServiceAccount(*impersonate))
 	if err != nil {
 		logAndExitf("dialing the server=%s failed with: %s", *serverAddr, err)
 	}
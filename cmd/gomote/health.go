@@ -0,0 +1,342 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/build/internal/gomote/protos"
+)
+
+// A healthProbe checks one aspect of the health of an instance.
+type healthProbe struct {
+	name string
+	// check returns an error describing why inst is unhealthy.
+	check func(ctx context.Context, inst string, hp *healthParams) error
+}
+
+type healthParams struct {
+	builderType string
+	minFreeDisk int64         // bytes
+	maxSkew     time.Duration // of the instance's clock
+}
+
+var healthProbes = []healthProbe{
+	{"connectivity", probeConnectivity},
+	{"disk", probeDisk},
+	{"clock", probeClock},
+}
+
+// errProbeSkipped is returned by probes that don't apply to an instance.
+var errProbeSkipped = errors.New("skipped")
+
+func health(args []string) error {
+	fs := flag.NewFlagSet("health", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "health usage: gomote health [health-opts] [instance]")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Checks the connectivity, free disk space, and clock of instances.")
+		fmt.Fprintln(os.Stderr, "With -watch, keeps checking and sends a desktop notification when one")
+		fmt.Fprintln(os.Stderr, "becomes unhealthy.")
+		fmt.Fprintln(os.Stderr, "Instance argument is optional with a group.")
+		fs.PrintDefaults()
+		os.Exit(1)
+	}
+	var watch time.Duration
+	fs.DurationVar(&watch, "watch", 0, "if non-zero, check again at this interval until interrupted")
+	var minFreeDiskMB int64
+	fs.Int64Var(&minFreeDiskMB, "min-free-disk", 1024, "minimum free disk space in the work directory, in MiB")
+	var maxSkew time.Duration
+	fs.DurationVar(&maxSkew, "max-clock-skew", time.Minute, "maximum difference between the instance's clock and the local one")
+	fs.Parse(args)
+
+	var checkSet []string
+	if fs.NArg() == 1 {
+		checkSet = []string{fs.Arg(0)}
+	} else if fs.NArg() == 0 && activeGroup != nil {
+		checkSet = append(checkSet, activeGroup.Instances...)
+	} else {
+		fs.Usage()
+	}
+
+	ctx := context.Background()
+	builderTypes, err := instanceBuilderTypes(ctx)
+	if err != nil {
+		return err
+	}
+	unhealthy := make(map[string]bool)
+	for {
+		for _, inst := range checkSet {
+			hp := &healthParams{
+				builderType: builderTypes[inst],
+				minFreeDisk: minFreeDiskMB << 20,
+				maxSkew:     maxSkew,
+			}
+			problems := checkHealth(ctx, inst, hp)
+			switch {
+			case len(problems) == 0:
+				if watch == 0 || unhealthy[inst] {
+					fmt.Fprintf(os.Stderr, "%s: healthy\n", inst)
+				}
+				unhealthy[inst] = false
+			case watch == 0 || !unhealthy[inst]:
+				bell := ""
+				if watch != 0 {
+					// Get the attention of the owner, who is
+					// likely not looking at this terminal.
+					msg := fmt.Sprintf("%s: %s", inst, strings.Join(problems, "; "))
+					if err := notify("gomote: unhealthy instance", msg); err != nil {
+						bell = "\a"
+					}
+				}
+				fmt.Fprintf(os.Stderr, "%s%s: unhealthy: %s\n", bell, inst, strings.Join(problems, "; "))
+				fmt.Fprintf(os.Stderr, "# To replace it with a new instance and replay its setup, run:\n#\tgomote replace -replay %s\n", inst)
+				unhealthy[inst] = true
+			}
+		}
+		if watch == 0 {
+			return nil
+		}
+		time.Sleep(watch)
+	}
+}
+
+// checkHealth runs each health probe on inst, and returns the problems
+// found. A connectivity problem skips the other probes.
+func checkHealth(ctx context.Context, inst string, hp *healthParams) []string {
+	var problems []string
+	for _, p := range healthProbes {
+		ctx, cancel := context.WithTimeout(ctx, time.Minute)
+		err := p.check(ctx, inst, hp)
+		cancel()
+		if err == nil || err == errProbeSkipped {
+			continue
+		}
+		problems = append(problems, fmt.Sprintf("%s: %v", p.name, err))
+		if p.name == "connectivity" {
+			break
+		}
+	}
+	return problems
+}
+
+// instanceBuilderTypes returns the builder type of each active instance.
+func instanceBuilderTypes(ctx context.Context) (map[string]string, error) {
+	client := gomoteServerClient(ctx)
+	resp, err := client.ListInstances(ctx, &protos.ListInstancesRequest{})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list instances: %w", err)
+	}
+	m := make(map[string]string)
+	for _, inst := range resp.GetInstances() {
+		m[inst.GetGomoteId()] = inst.GetBuilderType()
+	}
+	return m, nil
+}
+
+func probeConnectivity(ctx context.Context, inst string, hp *healthParams) error {
+	return doPing(ctx, inst)
+}
+
+// unixProbesOK reports whether the probes that run Unix commands can
+// run on an instance of builderType.
+func unixProbesOK(builderType string) bool {
+	return builderType != "" && !isWindowsBuilder(builderType) && !strings.HasPrefix(builderType, "plan9-")
+}
+
+func isWindowsBuilder(builderType string) bool {
+	return strings.Contains(builderType, "windows")
+}
+
+func probeDisk(ctx context.Context, inst string, hp *healthParams) error {
+	if !unixProbesOK(hp.builderType) {
+		return errProbeSkipped
+	}
+	var out bytes.Buffer
+	if err := doRun(ctx, inst, "df", []string{"-Pk", "."}, runWriters(&out)); err != nil {
+		return err
+	}
+	free, err := parseDFAvailable(out.String())
+	if err != nil {
+		return err
+	}
+	if free < hp.minFreeDisk {
+		return fmt.Errorf("only %d MiB free in the work directory", free>>20)
+	}
+	return nil
+}
+
+// parseDFAvailable returns the available bytes reported by "df -Pk".
+func parseDFAvailable(out string) (int64, error) {
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) < 2 {
+		return 0, fmt.Errorf("unexpected df output %q", out)
+	}
+	f := strings.Fields(lines[len(lines)-1])
+	if len(f) < 4 {
+		return 0, fmt.Errorf("unexpected df output %q", out)
+	}
+	kb, err := strconv.ParseInt(f[3], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("unexpected df output %q: %v", out, err)
+	}
+	return kb << 10, nil
+}
+
+func probeClock(ctx context.Context, inst string, hp *healthParams) error {
+	if !unixProbesOK(hp.builderType) {
+		return errProbeSkipped
+	}
+	var out bytes.Buffer
+	before := time.Now()
+	if err := doRun(ctx, inst, "date", []string{"-u", "+%s"}, runWriters(&out)); err != nil {
+		return err
+	}
+	return checkClock(out.String(), before, time.Now(), hp.maxSkew)
+}
+
+// checkClock checks that the time an instance printed with "date +%s",
+// between before and after, is off by at most maxSkew.
+func checkClock(out string, before, after time.Time, maxSkew time.Duration) error {
+	sec, err := strconv.ParseInt(strings.TrimSpace(out), 10, 64)
+	if err != nil {
+		return fmt.Errorf("unexpected date output %q", out)
+	}
+	remote := time.Unix(sec, 0)
+	// The output is truncated to the second.
+	switch {
+	case remote.Before(before.Add(-maxSkew - time.Second)):
+		return fmt.Errorf("clock is %v behind", before.Sub(remote).Round(time.Second))
+	case remote.After(after.Add(maxSkew)):
+		return fmt.Errorf("clock is %v ahead", remote.Sub(after).Round(time.Second))
+	}
+	return nil
+}
+
+func replace(args []string) error {
+	fs := flag.NewFlagSet("replace", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "replace usage: gomote replace [replace-opts] <instance>")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Destroys an instance, creates a new one of the same builder type in")
+		fmt.Fprintln(os.Stderr, "its groups, and prints the setup commands (push, put, puttar,")
+		fmt.Fprintln(os.Stderr, "putbootstrap, rm, and run) that were run on the old instance.")
+		fmt.Fprintln(os.Stderr, "With -replay, runs them on the new instance instead.")
+		fs.PrintDefaults()
+		os.Exit(1)
+	}
+	var replay bool
+	fs.BoolVar(&replay, "replay", false, "run the setup commands run on the old instance, rather than only printing them")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+	}
+	old := fs.Arg(0)
+
+	ctx := context.Background()
+	h, err := loadHistory(old)
+	if err != nil {
+		return err
+	}
+	if h == nil {
+		// Created by an older gomote, or on another machine.
+		builderTypes, err := instanceBuilderTypes(ctx)
+		if err != nil {
+			return err
+		}
+		if builderTypes[old] == "" {
+			return fmt.Errorf("unknown instance %q", old)
+		}
+		h = &instanceHistory{Instance: old, BuilderType: builderTypes[old]}
+		fmt.Fprintf(os.Stderr, "# No setup commands were recorded for %s.\n", old)
+	}
+	groups, err := loadAllGroups()
+	if err != nil {
+		return fmt.Errorf("loading groups: %w", err)
+	}
+
+	fmt.Fprintf(os.Stderr, "# Destroying %s\n", old)
+	client := gomoteServerClient(ctx)
+	if _, err := client.DestroyInstance(ctx, &protos.DestroyInstanceRequest{GomoteId: old}); err != nil && !instanceDoesNotExist(err) {
+		return fmt.Errorf("unable to destroy instance: %w", err)
+	}
+	inst, err := doCreate(ctx, h.BuilderType, true, 0)
+	if err != nil {
+		return err
+	}
+	fmt.Println(inst)
+	for _, g := range groups {
+		if !g.has(old) {
+			continue
+		}
+		for i := range g.Instances {
+			if g.Instances[i] == old {
+				g.Instances[i] = inst
+			}
+		}
+		if err := storeGroup(g); err != nil {
+			return err
+		}
+	}
+	newHist := &instanceHistory{Instance: inst, BuilderType: h.BuilderType}
+	if err := storeHistory(newHist); err != nil {
+		return err
+	}
+	if err := deleteHistory(old); err != nil {
+		return err
+	}
+	if !replay {
+		// The setup commands include arbitrary run commands, so
+		// only run them again when asked to.
+		if len(h.Setup) > 0 {
+			fmt.Fprintf(os.Stderr, "# To set up %s like %s, run these commands, or replace with -replay:\n", inst, old)
+			for _, step := range h.Setup {
+				stepArgs, _ := step.forInstance(old, inst)
+				fmt.Fprintf(os.Stderr, "#\t%s\n", replayCommandLine(stepArgs, step.Group))
+			}
+		}
+		return nil
+	}
+
+	for _, step := range h.Setup {
+		stepArgs, group := step.forInstance(old, inst)
+		fmt.Fprintf(os.Stderr, "# Replaying: gomote %s\n", strings.Join(stepArgs, " "))
+		cmd, ok := commands[stepArgs[0]]
+		if !ok {
+			return fmt.Errorf("unknown command %q in the history of %s", stepArgs[0], old)
+		}
+		saved := activeGroup
+		activeGroup = group
+		err := cmd.run(stepArgs[1:])
+		activeGroup = saved
+		if err != nil {
+			return fmt.Errorf("replaying %q: %w", strings.Join(stepArgs, " "), err)
+		}
+		newHist.Setup = append(newHist.Setup, setupStep{Args: stepArgs, Group: step.Group})
+		if err := storeHistory(newHist); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// replayCommandLine returns the gomote command line that runs a setup
+// step with the arguments args. If the step ran on the active group,
+// it says so, since the command has no instance argument.
+func replayCommandLine(args []string, group bool) string {
+	line := "gomote " + strings.Join(args, " ")
+	if group {
+		line += " # on the active group"
+	}
+	return line
+}
@@ -0,0 +1,153 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"reflect"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestParseDFAvailable(t *testing.T) {
+	out := `Filesystem     1024-blocks     Used Available Capacity Mounted on
+/dev/sda1         20511312 14443964   5002388      75% /
+`
+	got, err := parseDFAvailable(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := int64(5002388) << 10; got != want {
+		t.Errorf("parseDFAvailable() = %d, want %d", got, want)
+	}
+	if _, err := parseDFAvailable("df: .: No such file or directory\n"); err == nil {
+		t.Errorf("parseDFAvailable of an error message succeeded, want error")
+	}
+}
+
+func TestCheckClock(t *testing.T) {
+	before := time.Unix(1700000000, 500e6)
+	after := before.Add(2 * time.Second)
+	for _, tc := range []struct {
+		out    string
+		wantOK bool
+	}{
+		{"1700000000\n", true},
+		{"1700000002\n", true},
+		{"1699999950\n", true},
+		{"1699999900\n", false},
+		{"1700000100\n", false},
+		{"Sat Nov 14 22:13:20 UTC 2023\n", false},
+	} {
+		err := checkClock(tc.out, before, after, time.Minute)
+		if (err == nil) != tc.wantOK {
+			t.Errorf("checkClock(%q) = %v, want ok %v", tc.out, err, tc.wantOK)
+		}
+	}
+}
+
+func setTestConfigDir(t *testing.T) {
+	dir := t.TempDir()
+	switch runtime.GOOS {
+	case "windows":
+		t.Setenv("AppData", dir)
+	case "darwin", "ios":
+		t.Setenv("HOME", dir)
+	case "plan9":
+		t.Setenv("home", dir)
+	default:
+		t.Setenv("XDG_CONFIG_HOME", dir)
+	}
+	oldGroup := activeGroup
+	t.Cleanup(func() { activeGroup = oldGroup })
+	activeGroup = nil
+}
+
+func TestRecordSetup(t *testing.T) {
+	setTestConfigDir(t)
+
+	if err := recordCreate("user-a-linux-amd64-0", "linux-amd64", true); err != nil {
+		t.Fatal(err)
+	}
+	if err := recordCreate("user-a-linux-amd64-1", "linux-amd64", false); err != nil {
+		t.Fatal(err)
+	}
+	activeGroup = &groupData{Name: "debug", Instances: []string{"user-a-linux-amd64-0", "user-a-linux-amd64-1"}}
+	for _, args := range [][]string{
+		{"put", "user-a-linux-amd64-1", "file.txt"},
+		{"run", "go/bin/go", "test", "os"},
+		{"ls", "user-a-linux-amd64-1"}, // not a setup command
+	} {
+		if err := recordSetup(args); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	h, err := loadHistory("user-a-linux-amd64-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &instanceHistory{
+		Instance:    "user-a-linux-amd64-1",
+		BuilderType: "linux-amd64",
+		Setup: []setupStep{
+			{Args: []string{"put", "user-a-linux-amd64-1", "file.txt"}},
+			{Args: []string{"run", "go/bin/go", "test", "os"}, Group: true},
+		},
+	}
+	if !reflect.DeepEqual(h, want) {
+		t.Errorf("history = %+v, want %+v", h, want)
+	}
+	h, err = loadHistory("user-a-linux-amd64-0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(h.Setup) != 3 || !reflect.DeepEqual(h.Setup[0].Args, []string{"push", "user-a-linux-amd64-0"}) {
+		t.Errorf("history of the instance created with -setup = %+v, want push, make.bash, and run steps", h)
+	}
+
+	// Replaying the steps on a replacement names it instead.
+	args, group := want.Setup[0].forInstance("user-a-linux-amd64-1", "user-a-linux-amd64-2")
+	if wantArgs := []string{"put", "user-a-linux-amd64-2", "file.txt"}; !reflect.DeepEqual(args, wantArgs) || group != nil {
+		t.Errorf("forInstance(explicit step) = %q, %v, want %q, nil", args, group, wantArgs)
+	}
+	args, group = want.Setup[1].forInstance("user-a-linux-amd64-1", "user-a-linux-amd64-2")
+	if !reflect.DeepEqual(args, want.Setup[1].Args) || group == nil || !reflect.DeepEqual(group.Instances, []string{"user-a-linux-amd64-2"}) {
+		t.Errorf("forInstance(group step) = %q, %+v, want the same args in a group of just the replacement", args, group)
+	}
+
+	if err := deleteHistory("user-a-linux-amd64-1"); err != nil {
+		t.Fatal(err)
+	}
+	if h, err := loadHistory("user-a-linux-amd64-1"); h != nil || err != nil {
+		t.Errorf("loadHistory after deleteHistory = %+v, %v, want nil, nil", h, err)
+	}
+}
+
+func TestNotifyCommand(t *testing.T) {
+	testCases := []struct {
+		goos string
+		want []string
+	}{
+		{"darwin", []string{"osascript", "-e", `display notification "inst: \"disk\" full" with title "gomote"`}},
+		{"linux", []string{"notify-send", "gomote", `inst: "disk" full`}},
+		{"plan9", nil},
+	}
+	for _, tc := range testCases {
+		got, err := notifyCommand(tc.goos, "gomote", `inst: "disk" full`)
+		if !reflect.DeepEqual(got, tc.want) || (err != nil) != (tc.want == nil) {
+			t.Errorf("notifyCommand(%q) = %q, %v, want %q", tc.goos, got, err, tc.want)
+		}
+	}
+}
+
+func TestReplayCommandLine(t *testing.T) {
+	if got, want := replayCommandLine([]string{"put", "user-a-linux-amd64-2", "file.txt"}, false), "gomote put user-a-linux-amd64-2 file.txt"; got != want {
+		t.Errorf("replayCommandLine(explicit step) = %q, want %q", got, want)
+	}
+	if got, want := replayCommandLine([]string{"run", "go/bin/go", "test", "os"}, true), "gomote run go/bin/go test os # on the active group"; got != want {
+		t.Errorf("replayCommandLine(group step) = %q, want %q", got, want)
+	}
+}
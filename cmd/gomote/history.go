@@ -0,0 +1,182 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// setupCommands are the commands that set up an instance, which are
+// recorded in its history so that "gomote replace" can replay them on
+// a replacement instance.
+var setupCommands = map[string]bool{
+	"push":         true,
+	"put":          true,
+	"putbootstrap": true,
+	"puttar":       true,
+	"rm":           true,
+	"run":          true,
+}
+
+type instanceHistory struct {
+	// Instance is the name of the instance.
+	Instance string `json:"instance"`
+
+	// BuilderType is the builder type the instance was created with.
+	BuilderType string `json:"builder_type"`
+
+	// Setup is the list of setup commands run on the instance, in order.
+	Setup []setupStep `json:"setup"`
+}
+
+// A setupStep is a setup command run on an instance.
+type setupStep struct {
+	// Args are the command's name and arguments, without global flags.
+	Args []string `json:"args"`
+
+	// Group is whether the command applied to the instance because it
+	// was in the active group, rather than by naming the instance.
+	Group bool `json:"group,omitempty"`
+}
+
+// forInstance returns the arguments that run s on inst, an instance
+// replacing the old one, and the group to run them with.
+func (s setupStep) forInstance(old, inst string) ([]string, *groupData) {
+	if s.Group {
+		return s.Args, &groupData{Name: "replace-" + inst, Instances: []string{inst}}
+	}
+	args := make([]string, len(s.Args))
+	for i, a := range s.Args {
+		if a == old {
+			a = inst
+		}
+		args[i] = a
+	}
+	return args, nil
+}
+
+// recordCreate starts the history of inst, a new instance of
+// builderType. If setup is set, it was set up by "gomote create -setup".
+func recordCreate(inst, builderType string, setup bool) error {
+	h := &instanceHistory{Instance: inst, BuilderType: builderType}
+	if setup {
+		cmd := "go/src/make.bash"
+		if isWindowsBuilder(builderType) {
+			cmd = "go/src/make.bat"
+		}
+		h.Setup = []setupStep{{Args: []string{"push", inst}}, {Args: []string{"run", inst, cmd}}}
+	}
+	return storeHistory(h)
+}
+
+// recordSetup appends the setup command args, which succeeded, to the
+// histories of the instances it ran on: those named in args that have
+// a history or, if none are, those in the active group.
+func recordSetup(args []string) error {
+	if len(args) == 0 || !setupCommands[args[0]] {
+		return nil
+	}
+	var hs []*instanceHistory
+	for _, a := range args[1:] {
+		if !isInstanceName(a) {
+			continue
+		}
+		h, err := loadHistory(a)
+		if err != nil {
+			return err
+		}
+		if h != nil {
+			hs = append(hs, h)
+		}
+	}
+	group := len(hs) == 0
+	if group && activeGroup != nil {
+		for _, inst := range activeGroup.Instances {
+			h, err := loadHistory(inst)
+			if err != nil {
+				return err
+			}
+			if h != nil {
+				hs = append(hs, h)
+			}
+		}
+	}
+	for _, h := range hs {
+		h.Setup = append(h.Setup, setupStep{Args: args, Group: group})
+		if err := storeHistory(h); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadHistory returns the history of inst, or nil if it has none.
+func loadHistory(inst string) (*instanceHistory, error) {
+	fname, err := historyFilePath(inst)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(fname)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("loading history of %q: %w", inst, err)
+	}
+	h := new(instanceHistory)
+	if err := json.Unmarshal(data, h); err != nil {
+		return nil, fmt.Errorf("loading history of %q: %w", inst, err)
+	}
+	return h, nil
+}
+
+func storeHistory(h *instanceHistory) error {
+	fname, err := historyFilePath(h.Instance)
+	if err != nil {
+		return fmt.Errorf("storing history of %q: %w", h.Instance, err)
+	}
+	if err := os.MkdirAll(filepath.Dir(fname), 0755); err != nil {
+		return fmt.Errorf("storing history of %q: %w", h.Instance, err)
+	}
+	data, err := json.Marshal(h)
+	if err != nil {
+		return fmt.Errorf("storing history of %q: %w", h.Instance, err)
+	}
+	if err := os.WriteFile(fname, data, 0644); err != nil {
+		return fmt.Errorf("storing history of %q: %w", h.Instance, err)
+	}
+	return nil
+}
+
+func deleteHistory(inst string) error {
+	fname, err := historyFilePath(inst)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(fname); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("deleting history of %q: %w", inst, err)
+	}
+	return nil
+}
+
+// isInstanceName reports whether s could be the name of an instance.
+func isInstanceName(s string) bool {
+	return s != "" && s != "." && s != ".." && s == filepath.Base(s)
+}
+
+func historyFilePath(inst string) (string, error) {
+	if !isInstanceName(inst) {
+		return "", fmt.Errorf("invalid instance name %q", inst)
+	}
+	cfgDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(cfgDir, "gomote", "history", inst+".json"), nil
+}
@@ -0,0 +1,40 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strconv"
+)
+
+// notify shows a desktop notification with title and msg.
+func notify(title, msg string) error {
+	args, err := notifyCommand(runtime.GOOS, title, msg)
+	if err != nil {
+		return err
+	}
+	if out, err := exec.Command(args[0], args[1:]...).CombinedOutput(); err != nil {
+		return fmt.Errorf("%s: %v: %s", args[0], err, out)
+	}
+	return nil
+}
+
+// notifyCommand returns the command that shows a desktop notification
+// on goos.
+func notifyCommand(goos, title, msg string) ([]string, error) {
+	switch goos {
+	case "darwin":
+		// AppleScript string literals are quoted like Go's,
+		// except for non-ASCII escapes, which strconv.Quote
+		// doesn't produce for printable characters.
+		script := fmt.Sprintf("display notification %s with title %s", strconv.Quote(msg), strconv.Quote(title))
+		return []string{"osascript", "-e", script}, nil
+	case "linux", "freebsd", "netbsd", "openbsd":
+		return []string{"notify-send", title, msg}, nil
+	}
+	return nil, fmt.Errorf("desktop notifications aren't supported on %s", goos)
+}
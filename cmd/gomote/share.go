@@ -0,0 +1,103 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"golang.org/x/build/internal/gomote/protos"
+	"golang.org/x/sync/errgroup"
+)
+
+func share(args []string) error {
+	fs := flag.NewFlagSet("share", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "share usage: gomote share [instance] <file>")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Uploads a file from the instance's work directory to a public")
+		fmt.Fprintln(os.Stderr, "bucket and prints a Markdown link to it, to paste into an issue.")
+		fmt.Fprintln(os.Stderr, "Files of up to 25 MiB may be shared, and are deleted after 30 days.")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Instance name is optional if a group is specified, in which case")
+		fmt.Fprintln(os.Stderr, "the file is shared from every instance in the group.")
+		fs.PrintDefaults()
+		os.Exit(1)
+	}
+	fs.Parse(args)
+
+	var shareSet []string
+	var file string
+	switch fs.NArg() {
+	case 1:
+		if activeGroup == nil {
+			fmt.Fprintln(os.Stderr, "error: not enough arguments")
+			fs.Usage()
+		}
+		shareSet = append(shareSet, activeGroup.Instances...)
+		file = fs.Arg(0)
+	case 2:
+		shareSet = []string{fs.Arg(0)}
+		file = fs.Arg(1)
+	default:
+		fs.Usage()
+	}
+
+	links := make([]string, len(shareSet))
+	eg, ctx := errgroup.WithContext(context.Background())
+	for i, inst := range shareSet {
+		i, inst := i, inst
+		eg.Go(func() error {
+			res, err := doShare(ctx, inst, file)
+			if err != nil {
+				return fmt.Errorf("%s: %w", inst, err)
+			}
+			links[i] = shareLink(inst, file, res)
+			return nil
+		})
+	}
+	if err := eg.Wait(); err != nil {
+		return err
+	}
+	for _, l := range links {
+		fmt.Println(l)
+	}
+	return nil
+}
+
+func doShare(ctx context.Context, inst, file string) (*protos.ShareFileResponse, error) {
+	client := gomoteServerClient(ctx)
+	res, err := client.ShareFile(ctx, &protos.ShareFileRequest{
+		GomoteId: inst,
+		Path:     file,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to share file: %w", err)
+	}
+	return res, nil
+}
+
+// shareLink returns a Markdown link to a file shared from inst.
+func shareLink(inst, file string, res *protos.ShareFileResponse) string {
+	name := path.Base(strings.ReplaceAll(file, `\`, "/"))
+	expires := time.Unix(res.GetExpires(), 0).UTC().Format("2006-01-02")
+	return fmt.Sprintf("[%s](%s) (from %s, %s, available until %s)", name, res.GetUrl(), inst, byteSize(res.GetSize()), expires)
+}
+
+// byteSize formats n bytes for people.
+func byteSize(n int64) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MiB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KiB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%d bytes", n)
+}
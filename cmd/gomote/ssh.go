@@ -30,6 +30,8 @@ func ssh(args []string) error {
 		fs.PrintDefaults()
 		os.Exit(1)
 	}
+	var acceptRecording bool
+	fs.BoolVar(&acceptRecording, "accept-recording", false, "consent to the session being recorded, which the gomote SSH server may require")
 	fs.Parse(args)
 	if fs.NArg() != 1 {
 		fs.Usage()
@@ -61,7 +63,7 @@ func ssh(args []string) error {
 	if err != nil {
 		return err
 	}
-	return sshConnect(name, priKey, certPath)
+	return sshConnect(name, priKey, certPath, acceptRecording)
 }
 
 func sshConfigDirectory() (string, error) {
@@ -115,12 +117,17 @@ func writeCertificateToDisk(b []byte) (string, error) {
 	return tf.Name(), tf.Close()
 }
 
-func sshConnect(name string, priKey, certPath string) error {
+func sshConnect(name string, priKey, certPath string, acceptRecording bool) error {
 	ssh, err := exec.LookPath("ssh")
 	if err != nil {
 		return fmt.Errorf("path to ssh not found: %w", err)
 	}
-	cli := []string{"-o", fmt.Sprintf("CertificateFile=%s", certPath), "-i", priKey, "-p", "2222", name + "@farmer.golang.org"}
+	cli := []string{"-o", fmt.Sprintf("CertificateFile=%s", certPath), "-i", priKey, "-p", "2222"}
+	if acceptRecording {
+		// See remote.TranscriptConsentEnv.
+		cli = append(cli, "-o", "SetEnv=GOMOTE_SSH_RECORDING=accept")
+	}
+	cli = append(cli, name+"@farmer.golang.org")
 	fmt.Printf("$ %s %s\n", ssh, strings.Join(cli, " "))
 	cmd := exec.Command(ssh, cli...)
 	cmd.Stdout = os.Stdout
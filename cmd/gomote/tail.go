@@ -0,0 +1,139 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"golang.org/x/build/internal/gomote/protos"
+	"golang.org/x/sync/errgroup"
+)
+
+func tail(args []string) error {
+	fs := flag.NewFlagSet("tail", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "tail usage: gomote tail [tail-opts] [instance] <file>")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Prints a file in the instance's work directory and follows it as")
+		fmt.Fprintln(os.Stderr, "it's appended to, like tail -f, until interrupted. If the file is")
+		fmt.Fprintln(os.Stderr, "replaced or truncated, as by log rotation, tail continues with the")
+		fmt.Fprintln(os.Stderr, "new contents.")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Instance name is optional if a group is specified, in which case")
+		fmt.Fprintln(os.Stderr, "the file is followed on every instance in the group, and each line")
+		fmt.Fprintln(os.Stderr, "is prefixed with the name of its instance.")
+		fs.PrintDefaults()
+		os.Exit(1)
+	}
+	var last int64
+	fs.Int64Var(&last, "c", 0, "if positive, start with only the last c bytes of the file, rather than all of it")
+	fs.Parse(args)
+
+	var tailSet []string
+	var file string
+	switch fs.NArg() {
+	case 1:
+		if activeGroup == nil {
+			fmt.Fprintln(os.Stderr, "error: not enough arguments")
+			fs.Usage()
+		}
+		tailSet = append(tailSet, activeGroup.Instances...)
+		file = fs.Arg(0)
+	case 2:
+		tailSet = []string{fs.Arg(0)}
+		file = fs.Arg(1)
+	default:
+		fs.Usage()
+	}
+	var offset int64
+	if last > 0 {
+		offset = -last
+	}
+
+	if len(tailSet) == 1 {
+		return doTail(context.Background(), tailSet[0], file, offset, os.Stdout)
+	}
+	var mu sync.Mutex
+	eg, ctx := errgroup.WithContext(context.Background())
+	for _, inst := range tailSet {
+		inst := inst
+		eg.Go(func() error {
+			w := &linePrefixWriter{mu: &mu, w: os.Stdout, prefix: inst + ": "}
+			if err := doTail(ctx, inst, file, offset, w); err != nil {
+				return fmt.Errorf("%s: %w", inst, err)
+			}
+			return nil
+		})
+	}
+	return eg.Wait()
+}
+
+// doTail writes the contents of file on inst to w as they're appended,
+// starting at offset, until ctx is done.
+func doTail(ctx context.Context, inst, file string, offset int64, w io.Writer) error {
+	client := gomoteServerClient(ctx)
+	stream, err := client.TailFile(ctx, &protos.TailFileRequest{
+		GomoteId: inst,
+		Path:     file,
+		Offset:   offset,
+	})
+	if err != nil {
+		return fmt.Errorf("unable to tail file: %w", err)
+	}
+	for {
+		update, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("unable to tail file: %w", err)
+		}
+		if update.GetRotated() {
+			fmt.Fprintf(os.Stderr, "# %s: %s was replaced or truncated; following its new contents\n", inst, file)
+		}
+		if _, err := w.Write(update.GetData()); err != nil {
+			return err
+		}
+	}
+}
+
+// linePrefixWriter writes complete lines to w, each prefixed by
+// prefix, holding on to a final incomplete line until its end is
+// written. Several linePrefixWriters may share w, holding mu while
+// they write to it.
+type linePrefixWriter struct {
+	mu     *sync.Mutex
+	w      io.Writer
+	prefix string
+	buf    []byte // incomplete line
+}
+
+func (lw *linePrefixWriter) Write(p []byte) (int, error) {
+	lw.buf = append(lw.buf, p...)
+	i := bytes.LastIndexByte(lw.buf, '\n')
+	if i < 0 {
+		return len(p), nil
+	}
+	var out bytes.Buffer
+	for _, line := range bytes.SplitAfter(lw.buf[:i+1], []byte("\n")) {
+		if len(line) > 0 {
+			out.WriteString(lw.prefix)
+			out.Write(line)
+		}
+	}
+	lw.buf = append(lw.buf[:0], lw.buf[i+1:]...)
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+	if _, err := lw.w.Write(out.Bytes()); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
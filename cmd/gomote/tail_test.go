@@ -0,0 +1,36 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+)
+
+func TestLinePrefixWriter(t *testing.T) {
+	var mu sync.Mutex
+	var buf bytes.Buffer
+	a := &linePrefixWriter{mu: &mu, w: &buf, prefix: "a: "}
+	b := &linePrefixWriter{mu: &mu, w: &buf, prefix: "b: "}
+	for _, w := range []struct {
+		lw *linePrefixWriter
+		s  string
+	}{
+		{a, "one\ntw"},
+		{b, "uno\n"},
+		{a, "o\nthree"},
+		{b, "dos\n\ntres\n"},
+		{a, "\n"},
+	} {
+		if n, err := w.lw.Write([]byte(w.s)); n != len(w.s) || err != nil {
+			t.Fatalf("Write(%q) = %d, %v; want %d, nil", w.s, n, err, len(w.s))
+		}
+	}
+	want := "a: one\nb: uno\na: two\nb: dos\nb: \nb: tres\na: three\n"
+	if got := buf.String(); got != want {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+}
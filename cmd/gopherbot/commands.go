@@ -0,0 +1,421 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/build/dashboard"
+	"golang.org/x/build/gerrit"
+	"golang.org/x/build/maintner"
+)
+
+// A command is an instruction to gopherbot at the start of a line in
+// an issue comment, like:
+//
+//	@gopherbot backport to go1.22 and go1.21
+//	@gopherbot, please run slowbots linux-arm, windows-amd64
+//
+// gopherbot acknowledges each comment containing commands with a
+// reaction and a reply describing what it did. Label commands, which
+// may appear anywhere in a line, are handled separately by
+// applyLabelsFromComments.
+type command struct {
+	name    string   // name of the command's handler, like "run slowbots"
+	args    []string // lower-cased words following the name, without filler words
+	text    string   // the command as written, for replies
+	comment *maintner.GitHubComment
+}
+
+// A commandHandler describes a command gopherbot understands.
+type commandHandler struct {
+	name  string // one or more words that start the command
+	usage string
+
+	// maintainersOnly restricts the command to maintainers of the
+	// repository. See (*gopherbot).maintainers.
+	maintainersOnly bool
+
+	// run carries out cmd on issue gi in repo and returns a reply
+	// describing the outcome. Problems with the command itself are
+	// reported to its author by returning a commandError; other
+	// errors cause the command to be retried on the next run.
+	run func(b *gopherbot, ctx context.Context, repo *maintner.GitHubRepo, gi *maintner.GitHubIssue, cmd *command) (string, error)
+}
+
+// commandHandlers are the commands gopherbot understands.
+// To add a command, add it here.
+var commandHandlers = []*commandHandler{
+	{
+		name:  "backport",
+		usage: "@gopherbot backport to go1.N [and go1.M]",
+		run:   (*gopherbot).backportCommand,
+	},
+	{
+		name:            "run slowbots",
+		usage:           "@gopherbot run slowbots <builder> [<builder>...]",
+		maintainersOnly: true,
+		run:             (*gopherbot).slowbotsCommand,
+	},
+}
+
+// A commandError is a problem with a command that is reported back to
+// its author rather than retried.
+type commandError string
+
+func (e commandError) Error() string { return string(e) }
+
+// parseCommands returns the commands in body. Lines that start with
+// @gopherbot but don't name a known command are ignored; they're
+// usually label commands.
+func parseCommands(body string) []*command {
+	var cmds []*command
+	for _, line := range strings.Split(body, "\n") {
+		line = strings.TrimSpace(line)
+		if len(line) < len("@gopherbot") || !strings.EqualFold(line[:len("@gopherbot")], "@gopherbot") {
+			continue
+		}
+		words := strings.Fields(strings.ToLower(strings.TrimLeft(line[len("@gopherbot"):], ",:")))
+		if len(words) > 0 && words[0] == "please" {
+			words = words[1:]
+		}
+	Handlers:
+		for _, h := range commandHandlers {
+			name := strings.Fields(h.name)
+			if len(words) < len(name) {
+				continue
+			}
+			for i, w := range name {
+				if words[i] != w {
+					continue Handlers
+				}
+			}
+			cmds = append(cmds, &command{
+				name: h.name,
+				args: commandArgs(words[len(name):]),
+				text: strings.Join(strings.Fields(line), " "),
+			})
+			break
+		}
+	}
+	return cmds
+}
+
+// commandArgs returns the arguments in words, splitting lists like
+// "a, b and c" into their elements.
+func commandArgs(words []string) []string {
+	var args []string
+	for _, w := range words {
+		for _, arg := range strings.FieldsFunc(w, func(r rune) bool { return r == ',' || r == ';' }) {
+			arg = strings.TrimRight(arg, ".!?:")
+			switch arg {
+			case "", "and", "to", "on", "for", "the":
+				continue
+			}
+			args = append(args, arg)
+		}
+	}
+	return args
+}
+
+// hasCommand reports whether c contains a command with the given name
+// that handleCommands is responsible for.
+func (b *gopherbot) hasCommand(c *maintner.GitHubComment, name string) bool {
+	if c.Created.Before(b.commandsEpoch()) {
+		return false
+	}
+	for _, cmd := range parseCommands(c.Body) {
+		if cmd.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// commandReplyRx matches the marker in gopherbot's reply to a comment
+// containing commands, which records that the comment was handled.
+var commandReplyRx = regexp.MustCompile(`<!-- gopherbot: handled commands in comment (\d+) -->`)
+
+func commandReplyMarker(commentID int64) string {
+	return fmt.Sprintf("<!-- gopherbot: handled commands in comment %d -->", commentID)
+}
+
+// commandsEpoch returns when gopherbot started handling commands: the
+// time of the first comment it replied to with commandReplyRx's marker,
+// or, if it has never replied to one, when it was first called in this
+// process. Earlier comments are ignored, so that requests that predate
+// the command syntax, like "@gopherbot please backport", aren't handled
+// a second time.
+func (b *gopherbot) commandsEpoch() time.Time {
+	if !b.commandsSince.IsZero() {
+		return b.commandsSince
+	}
+	b.commandsSince = time.Now()
+	b.corpus.GitHub().ForeachRepo(func(repo *maintner.GitHubRepo) error {
+		return repo.ForeachIssue(func(gi *maintner.GitHubIssue) error {
+			handled := make(map[int64]bool)
+			gi.ForeachComment(func(c *maintner.GitHubComment) error {
+				if c.User != nil && c.User.ID == gopherbotGitHubID {
+					if m := commandReplyRx.FindStringSubmatch(c.Body); m != nil {
+						id, _ := strconv.ParseInt(m[1], 10, 64)
+						handled[id] = true
+					}
+				}
+				return nil
+			})
+			if len(handled) == 0 {
+				return nil
+			}
+			return gi.ForeachComment(func(c *maintner.GitHubComment) error {
+				if handled[c.ID] && c.Created.Before(b.commandsSince) {
+					b.commandsSince = c.Created
+				}
+				return nil
+			})
+		})
+	})
+	return b.commandsSince
+}
+
+// handleCommands carries out the commands in issue comments and
+// replies to them.
+func (b *gopherbot) handleCommands(ctx context.Context) error {
+	return b.corpus.GitHub().ForeachRepo(func(repo *maintner.GitHubRepo) error {
+		if !gardenIssues(repo) {
+			return nil
+		}
+		epoch := b.commandsEpoch()
+		var maintainers map[string]bool // computed when first needed
+		return b.foreachIssue(repo, open|closed|includePRs, func(gi *maintner.GitHubIssue) error {
+			if gi.Locked {
+				return nil
+			}
+			handled := make(map[int64]bool)
+			var pending []*maintner.GitHubComment
+			gi.ForeachComment(func(c *maintner.GitHubComment) error {
+				if c.User != nil && c.User.ID == gopherbotGitHubID {
+					if m := commandReplyRx.FindStringSubmatch(c.Body); m != nil {
+						id, _ := strconv.ParseInt(m[1], 10, 64)
+						handled[id] = true
+					}
+					return nil
+				}
+				if !c.Created.Before(epoch) && c.User != nil && len(parseCommands(c.Body)) > 0 {
+					pending = append(pending, c)
+				}
+				return nil
+			})
+			for _, c := range pending {
+				if handled[c.ID] {
+					continue
+				}
+				if maintainers == nil {
+					maintainers = b.maintainers(repo)
+				}
+				if err := b.handleComment(ctx, repo, gi, c, maintainers[strings.ToLower(c.User.Login)]); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	})
+}
+
+// handleComment carries out the commands in comment c on issue gi, and
+// acknowledges them with a reaction and a reply.
+func (b *gopherbot) handleComment(ctx context.Context, repo *maintner.GitHubRepo, gi *maintner.GitHubIssue, c *maintner.GitHubComment, isMaintainer bool) error {
+	b.printIssue("handle-commands", repo.ID(), gi)
+	var (
+		reply strings.Builder
+		ok    = true
+	)
+	fmt.Fprintf(&reply, "%s\n@%s:\n", commandReplyMarker(c.ID), c.User.Login)
+	for _, cmd := range parseCommands(c.Body) {
+		cmd.comment = c
+		var h *commandHandler
+		for _, h = range commandHandlers {
+			if h.name == cmd.name {
+				break
+			}
+		}
+		var result string
+		if h.maintainersOnly && !isMaintainer {
+			result = fmt.Sprintf("Sorry, only maintainers of %s can use this command.", repo.ID())
+			ok = false
+		} else {
+			var err error
+			result, err = h.run(b, ctx, repo, gi, cmd)
+			if cerr, isCmdErr := err.(commandError); isCmdErr {
+				result = fmt.Sprintf("%s\nUsage: `%s`", cerr, h.usage)
+				ok = false
+			} else if err != nil {
+				return fmt.Errorf("%s command in %v#%d comment %d: %v", cmd.name, repo.ID(), gi.Number, c.ID, err)
+			}
+		}
+		fmt.Fprintf(&reply, "\n- `%s`: %s", cmd.text, strings.ReplaceAll(result, "\n", "\n  "))
+	}
+
+	reaction := "+1"
+	if !ok {
+		reaction = "confused"
+	}
+	if err := b.addCommentReaction(ctx, repo.ID(), c.ID, reaction); err != nil {
+		// The reply is what matters; don't retry just for the reaction.
+		log.Printf("Unable to react to comment %d on %v#%d: %v", c.ID, repo.ID(), gi.Number, err)
+	}
+	return b.addGitHubComment(ctx, repo, gi.Number, reply.String())
+}
+
+// addCommentReaction adds a reaction, like "+1", to an issue comment.
+func (b *gopherbot) addCommentReaction(ctx context.Context, repoID maintner.GitHubRepoID, commentID int64, content string) error {
+	if !b.act(actReact) {
+		log.Printf("[dry-run] would react with %q to comment %d in %s", content, commentID, repoID)
+		return nil
+	}
+	_, _, err := b.ghc.Reactions.CreateIssueCommentReaction(ctx, repoID.Owner, repoID.Repo, commentID, content)
+	return err
+}
+
+// maintainers returns the lower-cased logins of the maintainers of repo.
+// GitHub only lets people with triage access to a repository label its
+// issues and set their milestones, so anyone maintner has seen do that
+// is a maintainer.
+func (b *gopherbot) maintainers(repo *maintner.GitHubRepo) map[string]bool {
+	m := make(map[string]bool)
+	repo.ForeachIssue(func(gi *maintner.GitHubIssue) error {
+		return gi.ForeachEvent(func(ge *maintner.GitHubIssueEvent) error {
+			switch ge.Type {
+			case "labeled", "unlabeled", "milestoned", "demilestoned":
+				if ge.Actor != nil && ge.Actor.ID != gopherbotGitHubID {
+					m[strings.ToLower(ge.Actor.Login)] = true
+				}
+			}
+			return nil
+		})
+	})
+	return m
+}
+
+// backportCommand opens backport issues for the releases in cmd, or for
+// the supported releases if there are none.
+func (b *gopherbot) backportCommand(ctx context.Context, repo *maintner.GitHubRepo, gi *maintner.GitHubIssue, cmd *command) (string, error) {
+	if repo != b.gorepo {
+		return "", commandError("Backports are only supported for issues in golang/go.")
+	}
+	if gi.PullRequest {
+		return "", commandError("Backports are requested on issues, not pull requests.")
+	}
+	majorReleases, _, err := b.fetchReleases(ctx)
+	if err != nil {
+		return "", err
+	}
+	releases, err := backportReleases(cmd.args, majorReleases)
+	if err != nil {
+		return "", err
+	}
+	opened, err := b.openBackportIssues(ctx, gi, cmd.comment, releases)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("Backport issue(s) opened: %s.\n\nRemember to create the cherry-pick CL(s) as soon as the patch is submitted to master, according to https://go.dev/wiki/MinorReleases.", strings.Join(opened, ", ")), nil
+}
+
+var backportReleaseRx = regexp.MustCompile(`^(?:go)?(\d+\.\d+)$`)
+
+// backportReleases returns the releases named by args, which are of
+// the form "go1.N" or "1.N". majorReleases are the supported releases
+// and the upcoming one, as returned by fetchReleases. Like requests
+// for backports in prose, if args name no releases it returns the
+// supported releases.
+func backportReleases(args, majorReleases []string) ([]string, error) {
+	var releases []string
+	for _, arg := range args {
+		m := backportReleaseRx.FindStringSubmatch(arg)
+		if m == nil {
+			continue
+		}
+		found := false
+		for _, r := range majorReleases {
+			if r == m[1] {
+				found = true
+			}
+		}
+		if !found {
+			return nil, commandError(fmt.Sprintf("Go %s is not a supported release; backports can go to %s.", m[1], strings.Join(majorReleases, ", ")))
+		}
+		releases = append(releases, m[1])
+	}
+	if len(releases) == 0 {
+		// Only backport to major releases unless explicitly
+		// asked to backport to the upcoming release.
+		releases = majorReleases[:len(majorReleases)-1]
+	}
+	return releases, nil
+}
+
+// slowbotsCommand requests SlowBots for the builders in cmd on the open
+// CLs that refer to gi.
+func (b *gopherbot) slowbotsCommand(ctx context.Context, repo *maintner.GitHubRepo, gi *maintner.GitHubIssue, cmd *command) (string, error) {
+	if len(cmd.args) == 0 {
+		return "", commandError("No builders given.")
+	}
+	for _, term := range cmd.args {
+		found := false
+		for _, bc := range dashboard.Builders {
+			if bc.MatchesSlowBotTerm(term) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return "", commandError(fmt.Sprintf("Unknown builder %q.", term))
+		}
+	}
+
+	var changes []gerritChange
+	b.corpus.Gerrit().ForeachProjectUnsorted(func(gp *maintner.GerritProject) error {
+		if gp.Server() != "go.googlesource.com" {
+			return nil
+		}
+		return gp.ForeachOpenCL(func(cl *maintner.GerritCL) error {
+			for _, ref := range cl.GitHubIssueRefs {
+				if ref.Repo == repo && ref.Number == gi.Number {
+					changes = append(changes, gerritChange{gp.Project(), cl.Number})
+					break
+				}
+			}
+			return nil
+		})
+	})
+	if len(changes) == 0 {
+		return "", commandError(fmt.Sprintf("No open CLs refer to %v#%d.", repo.ID(), gi.Number))
+	}
+
+	// The coordinator runs the builders named in a TRY= message
+	// that accompanies a Run-TryBot+1 vote.
+	review := gerrit.ReviewInput{
+		Message: "TRY=" + strings.Join(cmd.args, ", "),
+		Labels:  map[string]int{"Run-TryBot": 1},
+	}
+	var cls []string
+	for _, gc := range changes {
+		if b.deletedChanges[gc] {
+			continue
+		}
+		if !b.act(actReview) {
+			log.Printf("[dry-run] would request SlowBots %v on %s", cmd.args, gc)
+		} else if err := b.gerrit.SetReview(ctx, gc.ID(), "current", review); err != nil {
+			return "", err
+		}
+		cls = append(cls, fmt.Sprintf("https://go.dev/cl/%d", gc.num))
+	}
+	return fmt.Sprintf("Requested SlowBots on %s.", strings.Join(cls, ", ")), nil
+}
@@ -56,7 +56,12 @@ var (
 	// token file with a colon in between the email and password.
 	gerritTokenFile = flag.String("gerrit-token-file", filepath.Join(os.Getenv("HOME"), "keys", "gerrit-gobot"), `File to load Gerrit token from. File should be of form <git-email>:<token>`)
 
-	onlyRun = flag.String("only-run", "", "if non-empty, the name of a task to run. Mostly for debugging, but tasks (like 'kicktrain') may choose to only run in explicit mode")
+	onlyRun = flag.String("only-run", "", "if non-empty, the name of a rule to run. Mostly for debugging, but some rules (like 'kicktrain') only run in explicit mode")
+
+	rulesConfigFile = flag.String("rules-config", "", `if non-empty, a JSON file configuring rules, of the form {"rule name": {"disabled": true, "dry_run": true}}`)
+	disableRules    = flag.String("disable-rules", "", "comma-separated names of rules not to run")
+	dryRunRules     = flag.String("dry-run-rules", "", "comma-separated names of rules to run in dry-run mode")
+	listen          = flag.String("listen", "", "if non-empty, the address on which to serve metrics at /debug/vars")
 )
 
 func init() {
@@ -65,9 +70,9 @@ func init() {
 		fmt.Fprintf(output, "gopherbot runs Go's gopherbot role account on GitHub and Gerrit.\n\n")
 		flag.PrintDefaults()
 		fmt.Fprintln(output, "")
-		fmt.Fprintln(output, "Tasks (can be used for the --only-run flag):")
-		for _, t := range tasks {
-			fmt.Fprintf(output, "  %q\n", t.name)
+		fmt.Fprintln(output, "Rules (can be used for the --only-run, --disable-rules, and --dry-run-rules flags):")
+		for _, r := range rules {
+			fmt.Fprintf(output, "  %q\n\treads %s; actions: %v\n", r.name, strings.Join(r.reads, ", "), r.actions)
 		}
 	}
 }
@@ -225,6 +230,14 @@ type githubIssue struct {
 
 func main() {
 	flag.Parse()
+	if err := loadRuleConfigs(); err != nil {
+		log.Fatal(err)
+	}
+	if *listen != "" {
+		go func() {
+			log.Fatal(http.ListenAndServe(*listen, nil))
+		}()
+	}
 
 	var sc *secret.Client
 	if metadata.OnGCE() {
@@ -373,7 +386,7 @@ func main() {
 
 	for {
 		t0 := time.Now()
-		taskErrors := bot.doTasks(ctx)
+		taskErrors := bot.runRules(ctx)
 		for _, err := range taskErrors {
 			log.Print(err)
 		}
@@ -431,50 +444,13 @@ type gopherbot struct {
 		major      []string          // Last two releases and the next upcoming release, like: "1.9", "1.10", "1.11".
 		nextMinor  map[string]string // Key is a major release like "1.9", value is its next minor release like "1.9.7".
 	}
-}
 
-var tasks = []struct {
-	name string
-	fn   func(*gopherbot, context.Context) error
-}{
-	// Tasks that are specific to the golang/go repo.
-	{"kicktrain", (*gopherbot).getOffKickTrain},
-	{"label build issues", (*gopherbot).labelBuildIssues},
-	{"label compiler/runtime issues", (*gopherbot).labelCompilerRuntimeIssues},
-	{"label mobile issues", (*gopherbot).labelMobileIssues},
-	{"label tools issues", (*gopherbot).labelToolsIssues},
-	{"label website issues", (*gopherbot).labelWebsiteIssues},
-	{"label pkgsite issues", (*gopherbot).labelPkgsiteIssues},
-	{"label proxy.golang.org issues", (*gopherbot).labelProxyIssues},
-	{"label vulncheck or vulndb issues", (*gopherbot).labelVulnIssues},
-	{"label proposals", (*gopherbot).labelProposals},
-	{"handle gopls issues", (*gopherbot).handleGoplsIssues},
-	{"handle telemetry issues", (*gopherbot).handleTelemetryIssues},
-	{"open cherry pick issues", (*gopherbot).openCherryPickIssues},
-	{"close cherry pick issues", (*gopherbot).closeCherryPickIssues},
-	{"set subrepo milestones", (*gopherbot).setSubrepoMilestones},
-	{"set misc milestones", (*gopherbot).setMiscMilestones},
-	{"apply minor release milestones", (*gopherbot).setMinorMilestones},
-	{"update needs", (*gopherbot).updateNeeds},
-
-	// Tasks that can be applied to many repos.
-	{"freeze old issues", (*gopherbot).freezeOldIssues},
-	{"label documentation issues", (*gopherbot).labelDocumentationIssues},
-	{"close stale WaitingForInfo", (*gopherbot).closeStaleWaitingForInfo},
-	{"apply labels from comments", (*gopherbot).applyLabelsFromComments},
-
-	// Gerrit tasks are applied to all projects by default.
-	{"abandon scratch reviews", (*gopherbot).abandonScratchReviews},
-	{"assign reviewers to CLs", (*gopherbot).assignReviewersToCLs},
-	{"auto-submit CLs", (*gopherbot).autoSubmitCLs},
-
-	// Tasks that are specific to the golang/vscode-go repo.
-	{"set vscode-go milestones", (*gopherbot).setVSCodeGoMilestones},
-
-	{"access", (*gopherbot).whoNeedsAccess},
-	{"cl2issue", (*gopherbot).cl2issue},
-	{"congratulate new contributors", (*gopherbot).congratulateNewContributors},
-	{"un-wait CLs", (*gopherbot).unwaitCLs},
+	// rule is the rule being run, if any, and ruleDryRun reports
+	// whether it's configured to run in dry-run mode. See act.
+	rule       *rule
+	ruleDryRun bool
+
+	commandsSince time.Time // see commandsEpoch; zero until first needed
 }
 
 // gardenIssues reports whether GopherBot should perform general issue
@@ -506,22 +482,6 @@ func (b *gopherbot) initCorpus() {
 	b.gorepo = repo
 }
 
-// doTasks performs tasks in sequence. It doesn't stop if
-// if encounters an error, but reports errors at the end.
-func (b *gopherbot) doTasks(ctx context.Context) []error {
-	var errs []error
-	for _, task := range tasks {
-		if *onlyRun != "" && task.name != *onlyRun {
-			continue
-		}
-		err := task.fn(b, ctx)
-		if err != nil {
-			errs = append(errs, fmt.Errorf("%s: %v", task.name, err))
-		}
-	}
-	return errs
-}
-
 // issuesService represents portions of github.IssuesService that we want to override in tests.
 type issuesService interface {
 	ListLabelsByIssue(ctx context.Context, owner string, repo string, number int, opt *github.ListOptions) ([]*github.Label, *github.Response, error)
@@ -540,11 +500,11 @@ func (b *gopherbot) addLabels(ctx context.Context, repoID maintner.GitHubRepoID,
 			log.Printf("Issue %d already has label %q; no need to send request to add it", gi.Number, label)
 			continue
 		}
-		printIssue("label-"+label, repoID, gi)
+		b.printIssue("label-"+label, repoID, gi)
 		toAdd = append(toAdd, label)
 	}
 
-	if *dryRun || len(toAdd) == 0 {
+	if len(toAdd) == 0 || !b.act(actLabel) {
 		return nil
 	}
 
@@ -571,11 +531,11 @@ func (b *gopherbot) removeLabels(ctx context.Context, repoID maintner.GitHubRepo
 			log.Printf("Issue %d (in maintner) does not have label %q; no need to send request to remove it", gi.Number, l)
 			continue
 		}
-		printIssue("label-"+l, repoID, gi)
+		b.printIssue("label-"+l, repoID, gi)
 		removeLabels = true
 	}
 
-	if *dryRun || !removeLabels {
+	if !removeLabels || !b.act(actLabel) {
 		return nil
 	}
 
@@ -624,8 +584,8 @@ func removeLabelFromIssue(ctx context.Context, repoID maintner.GitHubRepoID, iss
 }
 
 func (b *gopherbot) setMilestone(ctx context.Context, repoID maintner.GitHubRepoID, gi *maintner.GitHubIssue, m milestone) error {
-	printIssue("milestone-"+m.Name, repoID, gi)
-	if *dryRun {
+	b.printIssue("milestone-"+m.Name, repoID, gi)
+	if !b.act(actMilestone) {
 		return nil
 	}
 	_, _, err := b.ghc.Issues.Edit(ctx, repoID.Owner, repoID.Repo, int(gi.Number), &github.IssueRequest{
@@ -676,7 +636,7 @@ func (b *gopherbot) addGitHubComment(ctx context.Context, repo *maintner.GitHubR
 			return nil
 		}
 	}
-	if *dryRun {
+	if !b.act(actComment) {
 		log.Printf("[dry-run] would add comment to github.com/%s/issues/%d: %v", repo.ID(), issueNum, msg)
 		return nil
 	}
@@ -731,7 +691,7 @@ func (b *gopherbot) createGitHubIssue(ctx context.Context, title, msg string, la
 			return i.GetNumber(), nil
 		}
 	}
-	if *dryRun {
+	if !b.act(actCreateIssue) {
 		log.Printf("[dry-run] would create issue with title %s and labels %v\n%s", title, labels, msg)
 		return 4242, nil
 	}
@@ -755,7 +715,7 @@ var (
 // closeGitHubIssue closes a GitHub issue.
 // reason specifies why it's being closed. (GitHub's default reason on 2023-06-12 is "completed".)
 func (b *gopherbot) closeGitHubIssue(ctx context.Context, repoID maintner.GitHubRepoID, number int32, reason issueCloseReason) error {
-	if *dryRun {
+	if !b.act(actClose) {
 		var suffix string
 		if reason != nil {
 			suffix = " as " + *reason
@@ -787,7 +747,7 @@ func (b *gopherbot) addGerritComment(ctx context.Context, changeID, comment stri
 	if b == nil {
 		panic("nil gopherbot")
 	}
-	if *dryRun {
+	if !b.act(actComment) {
 		log.Printf("[dry-run] would add comment to golang.org/cl/%s: %v", changeID, comment)
 		return nil
 	}
@@ -826,11 +786,6 @@ func (b *gopherbot) addGerritComment(ctx context.Context, changeID, comment stri
 
 // Move any issue to "Unplanned" if it looks like it keeps getting kicked along between releases.
 func (b *gopherbot) getOffKickTrain(ctx context.Context) error {
-	// We only run this task if it was explicitly requested via
-	// the --only-run flag.
-	if *onlyRun == "" {
-		return nil
-	}
 	type match struct {
 		url   string
 		title string
@@ -889,7 +844,7 @@ func (b *gopherbot) getOffKickTrain(ctx context.Context) error {
 	fmt.Printf("%d issues:\n", len(matches))
 	for _, m := range matches {
 		fmt.Printf("%-30s - %s\n", m.url, m.title)
-		if !*dryRun {
+		if !b.isDryRun() {
 			if err := b.setMilestone(ctx, b.gorepo.ID(), m.gi, unplanned); err != nil {
 				return err
 			}
@@ -918,8 +873,8 @@ func (b *gopherbot) freezeOldIssues(ctx context.Context) error {
 			if gi.Locked || gi.Updated.After(tooOld) {
 				return nil
 			}
-			printIssue("freeze", repo.ID(), gi)
-			if *dryRun {
+			b.printIssue("freeze", repo.ID(), gi)
+			if !b.act(actLock) {
 				return nil
 			}
 			_, err := b.ghc.Issues.Lock(ctx, repo.ID().Owner, repo.ID().Repo, int(gi.Number), nil)
@@ -1273,7 +1228,7 @@ func (b *gopherbot) closeStaleWaitingForInfo(ctx context.Context) error {
 				return nil
 			}
 
-			printIssue("close-stale-waiting-for-info", repo.ID(), gi)
+			b.printIssue("close-stale-waiting-for-info", repo.ID(), gi)
 			// TODO: write a task that reopens issues if the OP speaks up.
 			if err := b.addGitHubComment(ctx, repo, gi.Number,
 				"Timed out in state WaitingForInfo. Closing.\n\n(I am just a bot, though. Please speak up if this is a mistake or you have the requested information.)"); err != nil {
@@ -1320,7 +1275,7 @@ func (b *gopherbot) cl2issue(ctx context.Context) error {
 				if hasComment {
 					continue
 				}
-				printIssue("cl2issue", ref.Repo.ID(), gi)
+				b.printIssue("cl2issue", ref.Repo.ID(), gi)
 				msg := fmt.Sprintf("Change https://go.dev/cl/%d mentions this issue: `%s`", cl.Number, cl.Commit.Summary())
 				if err := b.addGitHubComment(ctx, ref.Repo, gi.Number, msg); err != nil {
 					return err
@@ -1391,7 +1346,7 @@ func (b *gopherbot) updateNeeds(ctx context.Context) error {
 			if !strings.HasPrefix(key, "needs") || labels[key] == maxPos {
 				continue
 			}
-			printIssue("updateneeds", b.gorepo.ID(), gi)
+			b.printIssue("updateneeds", b.gorepo.ID(), gi)
 			fmt.Printf("\t... removing label %q\n", lab.Name)
 			if err := b.removeLabel(ctx, b.gorepo.ID(), gi, lab.Name); err != nil {
 				return err
@@ -1581,7 +1536,7 @@ func (b *gopherbot) unwaitCLs(ctx context.Context) error {
 				if hasReplied {
 					log.Printf("https://go.dev/cl/%d -- remove wait-author; reply from %s", cl.Number, cl.Owner())
 					err := b.onLatestCL(ctx, cl, func() error {
-						if *dryRun {
+						if !b.act(actHashtag) {
 							log.Printf("[dry run] would remove hashtag 'wait-author' from CL %d", cl.Number)
 							return nil
 						}
@@ -1691,6 +1646,10 @@ func (b *gopherbot) openCherryPickIssues(ctx context.Context) error {
 				backportComment = nil
 				return errStopIteration
 			}
+			if b.hasCommand(c, "backport") {
+				// Handled by handleCommands.
+				return nil
+			}
 			body := strings.ToLower(c.Body)
 			if strings.Contains(body, "@gopherbot") &&
 				strings.Contains(body, "please") &&
@@ -1722,36 +1681,47 @@ func (b *gopherbot) openCherryPickIssues(ctx context.Context) error {
 			selectedReleases = majorReleases[:len(majorReleases)-1]
 		}
 
-		// Figure out extra labels to include from the main issue.
-		// Only copy a subset that's relevant to backport issue management.
-		var extraLabels []string
-		for _, l := range [...]string{
-			"Security",
-			"GoCommand",
-		} {
-			if gi.HasLabel(l) {
-				extraLabels = append(extraLabels, l)
-			}
-		}
-
-		// Open backport issues.
-		var openedIssues []string
-		for _, rel := range selectedReleases {
-			printIssue("open-backport-issue-"+rel, b.gorepo.ID(), gi)
-			id, err := b.createGitHubIssue(ctx,
-				fmt.Sprintf("%s [%s backport]", gi.Title, rel),
-				fmt.Sprintf("@%s requested issue #%d to be considered for backport to the next %s minor release.\n\n%s\n",
-					backportComment.User.Login, gi.Number, rel, blockqoute(backportComment.Body)),
-				append([]string{"CherryPickCandidate"}, extraLabels...), backportComment.Created)
-			if err != nil {
-				return err
-			}
-			openedIssues = append(openedIssues, fmt.Sprintf("#%d (for %s)", id, rel))
+		openedIssues, err := b.openBackportIssues(ctx, gi, backportComment, selectedReleases)
+		if err != nil {
+			return err
 		}
 		return b.addGitHubComment(ctx, b.gorepo, gi.Number, fmt.Sprintf("Backport issue(s) opened: %s.\n\nRemember to create the cherry-pick CL(s) as soon as the patch is submitted to master, according to https://go.dev/wiki/MinorReleases.", strings.Join(openedIssues, ", ")))
 	})
 }
 
+// openBackportIssues opens a CherryPickCandidate issue for gi for each
+// of releases, as requested by comment c, and describes them as "#123
+// (for 1.21)" and so on.
+func (b *gopherbot) openBackportIssues(ctx context.Context, gi *maintner.GitHubIssue, c *maintner.GitHubComment, releases []string) ([]string, error) {
+	// Figure out extra labels to include from the main issue.
+	// Only copy a subset that's relevant to backport issue management.
+	var extraLabels []string
+	for _, l := range [...]string{
+		"Security",
+		"GoCommand",
+	} {
+		if gi.HasLabel(l) {
+			extraLabels = append(extraLabels, l)
+		}
+	}
+
+	// Open backport issues.
+	var openedIssues []string
+	for _, rel := range releases {
+		b.printIssue("open-backport-issue-"+rel, b.gorepo.ID(), gi)
+		id, err := b.createGitHubIssue(ctx,
+			fmt.Sprintf("%s [%s backport]", gi.Title, rel),
+			fmt.Sprintf("@%s requested issue #%d to be considered for backport to the next %s minor release.\n\n%s\n",
+				c.User.Login, gi.Number, rel, blockqoute(c.Body)),
+			append([]string{"CherryPickCandidate"}, extraLabels...), c.Created)
+		if err != nil {
+			return nil, err
+		}
+		openedIssues = append(openedIssues, fmt.Sprintf("#%d (for %s)", id, rel))
+	}
+	return openedIssues, nil
+}
+
 // setMinorMilestones applies the next minor release milestone
 // to issues with [1.X backport] in the title.
 func (b *gopherbot) setMinorMilestones(ctx context.Context) error {
@@ -1837,7 +1807,7 @@ func (b *gopherbot) closeCherryPickIssues(ctx context.Context) error {
 					// doesn't match the CL branch goX.Y version, so skip it.
 					continue
 				}
-				printIssue("close-cherry-pick", ref.Repo.ID(), gi)
+				b.printIssue("close-cherry-pick", ref.Repo.ID(), gi)
 				if err := b.addGitHubComment(ctx, ref.Repo, gi.Number, fmt.Sprintf(
 					"Closed by merging %s to %s.", cl.Commit.Hash, cl.Branch())); err != nil {
 					return err
@@ -2136,7 +2106,7 @@ func (b *gopherbot) assignReviewersToCLs(ctx context.Context) error {
 			if len(merged.Primary) == 0 && len(merged.Secondary) == 0 {
 				// No owners found for the change. Add the #no-owners tag.
 				log.Printf("Adding no-owners tag to change %s...", changeURL)
-				if *dryRun {
+				if !b.act(actHashtag) {
 					return nil
 				}
 				if _, err := b.gerrit.AddHashtags(ctx, gc.ID(), tagNoOwners); err != nil {
@@ -2161,7 +2131,7 @@ func (b *gopherbot) assignReviewersToCLs(ctx context.Context) error {
 				log.Printf("Setting review %+v on %s would have no effect, continuing", review, changeURL)
 				return nil
 			}
-			if *dryRun {
+			if !b.act(actReview) {
 				log.Printf("[dry run] Would set review on %s: %+v", changeURL, review)
 				return nil
 			}
@@ -2220,7 +2190,7 @@ func (b *gopherbot) abandonScratchReviews(ctx context.Context) error {
 			if b.deletedChanges[gerritChange{gp.Project(), cl.Number}] || !cl.Meta.Commit.CommitTime.Before(tooOld) {
 				return nil
 			}
-			if *dryRun {
+			if !b.act(actAbandon) {
 				log.Printf("[dry-run] would've closed scratch CL https://go.dev/cl/%d ...", cl.Number)
 				return nil
 			}
@@ -2235,11 +2205,6 @@ func (b *gopherbot) abandonScratchReviews(ctx context.Context) error {
 }
 
 func (b *gopherbot) whoNeedsAccess(ctx context.Context) error {
-	// We only run this task if it was explicitly requested via
-	// the --only-run flag.
-	if *onlyRun == "" {
-		return nil
-	}
 	level := map[int64]int{} // gerrit id -> 1 for try, 2 for submit
 	ais, err := b.gerrit.GetGroupMembers(ctx, "may-start-trybots")
 	if err != nil {
@@ -2477,7 +2442,7 @@ func (b *gopherbot) autoSubmitCLs(ctx context.Context) error {
 				}
 			}
 
-			if *dryRun {
+			if !b.act(actSubmit) {
 				log.Printf("[dry-run] would've submitted CL https://golang.org/cl/%d ...", cl.Number)
 				return nil
 			}
@@ -2760,8 +2725,8 @@ func isGoplsTitle(t string) bool {
 
 var lastTask string
 
-func printIssue(task string, repoID maintner.GitHubRepoID, gi *maintner.GitHubIssue) {
-	if *dryRun {
+func (b *gopherbot) printIssue(task string, repoID maintner.GitHubRepoID, gi *maintner.GitHubIssue) {
+	if b.isDryRun() {
 		task = task + " [dry-run]"
 	}
 	if task != lastTask {
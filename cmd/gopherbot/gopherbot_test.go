@@ -6,6 +6,7 @@ package main
 
 import (
 	"context"
+	"expvar"
 	"flag"
 	"net/http"
 	"testing"
@@ -110,6 +111,74 @@ func TestLabelCommandsFromComments(t *testing.T) {
 	}
 }
 
+func TestParseCommands(t *testing.T) {
+	testCases := []struct {
+		desc string
+		body string
+		want []*command
+	}{
+		{
+			"backport to two releases",
+			"@gopherbot backport to go1.22 and go1.21",
+			[]*command{{name: "backport", args: []string{"go1.22", "go1.21"}, text: "@gopherbot backport to go1.22 and go1.21"}},
+		},
+		{
+			"slowbots with punctuation and please",
+			"Looks good.\n  @GopherBot, please run SlowBots linux-arm, windows-amd64.",
+			[]*command{{name: "run slowbots", args: []string{"linux-arm", "windows-amd64"}, text: "@GopherBot, please run SlowBots linux-arm, windows-amd64."}},
+		},
+		{
+			"several commands",
+			"@gopherbot backport\n@gopherbot: run slowbots linux-arm",
+			[]*command{
+				{name: "backport", text: "@gopherbot backport"},
+				{name: "run slowbots", args: []string{"linux-arm"}, text: "@gopherbot: run slowbots linux-arm"},
+			},
+		},
+		{
+			"label commands are not commands",
+			"@gopherbot add NeedsFix\n@gopherbot run tests",
+			nil,
+		},
+		{
+			"mention in prose",
+			"Could someone ask @gopherbot backport to go1.22?",
+			nil,
+		},
+	}
+	for _, tc := range testCases {
+		got := parseCommands(tc.body)
+		if diff := cmp.Diff(tc.want, got, cmp.AllowUnexported(command{})); diff != "" {
+			t.Errorf("%s: commands differ: (-want +got)\n%s", tc.desc, diff)
+		}
+	}
+}
+
+func TestBackportReleases(t *testing.T) {
+	major := []string{"1.21", "1.22", "1.23"}
+	testCases := []struct {
+		args    []string
+		want    []string
+		wantErr bool
+	}{
+		{nil, []string{"1.21", "1.22"}, false},
+		{[]string{"go1.22"}, []string{"1.22"}, false},
+		{[]string{"1.21", "go1.23"}, []string{"1.21", "1.23"}, false},
+		{[]string{"this", "go1.22"}, []string{"1.22"}, false},
+		{[]string{"go1.19"}, nil, true},
+	}
+	for _, tc := range testCases {
+		got, err := backportReleases(tc.args, major)
+		if _, isCmdErr := err.(commandError); isCmdErr != tc.wantErr || (err != nil && !isCmdErr) {
+			t.Errorf("backportReleases(%q) error = %v, want command error: %v", tc.args, err, tc.wantErr)
+			continue
+		}
+		if diff := cmp.Diff(tc.want, got); diff != "" {
+			t.Errorf("backportReleases(%q) differs: (-want +got)\n%s", tc.args, diff)
+		}
+	}
+}
+
 func TestLabelMutations(t *testing.T) {
 	testCases := []struct {
 		desc   string
@@ -353,6 +422,59 @@ func TestRemoveLabels(t *testing.T) {
 	}
 }
 
+func TestRules(t *testing.T) {
+	seen := make(map[string]bool)
+	for _, r := range rules {
+		if seen[r.name] {
+			t.Errorf("duplicate rule %q", r.name)
+		}
+		seen[r.name] = true
+		if len(r.reads) == 0 {
+			t.Errorf("rule %q doesn't declare what it reads", r.name)
+		}
+		if r.fn == nil {
+			t.Errorf("rule %q has no func", r.name)
+		}
+	}
+}
+
+func TestRuleDryRun(t *testing.T) {
+	const name = "label build issues"
+	defer func() { ruleConfigs = map[string]ruleConfig{} }()
+	*dryRunRules = name
+	defer func() { *dryRunRules = "" }()
+	if err := loadRuleConfigs(); err != nil {
+		t.Fatal(err)
+	}
+
+	gi := &maintner.GitHubIssue{Number: 1}
+	fis := &fakeIssuesService{}
+	b := &gopherbot{is: fis}
+	key := name + ": " + string(actLabel)
+	for _, dryRun := range []bool{true, false} {
+		r := lookupRule(name)
+		b.rule, b.ruleDryRun = r, ruleConfigs[r.name].DryRun
+		if err := b.addLabel(context.Background(), maintner.GitHubRepoID{Owner: "golang", Repo: "go"}, gi, "Builders"); err != nil {
+			t.Fatal(err)
+		}
+		if got := len(fis.labels[1]) == 0; got != dryRun {
+			t.Errorf("with dry run %v, labels added = %v", dryRun, fis.labels[1])
+		}
+		// Run the rule for real the second time around.
+		ruleConfigs[name] = ruleConfig{}
+	}
+	for _, m := range []*expvar.Map{actionsSkipped, actionsTaken} {
+		if v, ok := m.Get(key).(*expvar.Int); !ok || v.Value() != 1 {
+			t.Errorf("counter %q = %v, want 1", key, m.Get(key))
+		}
+	}
+
+	*dryRunRules = "no such rule"
+	if err := loadRuleConfigs(); err == nil {
+		t.Errorf("loadRuleConfigs with an unknown rule succeeded")
+	}
+}
+
 func TestHumanReviewersInMetas(t *testing.T) {
 	testCases := []struct {
 		desc      string
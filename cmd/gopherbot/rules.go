@@ -0,0 +1,231 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+// A rule is one of gopherbot's automations. Each rule declares the
+// corpus data it examines and the kinds of action it may take, and
+// can be disabled or put in dry-run mode on its own; see ruleConfig.
+//
+// To add a rule, write a gopherbot method that looks at the corpus
+// and takes actions through the helpers that call b.act, such as
+// addLabels or addGitHubComment, and add it to rules.
+type rule struct {
+	name string
+	// reads describes the corpus data the rule examines.
+	reads []string
+	// actions lists the kinds of action the rule may take.
+	actions []action
+	// explicit rules run only when named by the -only-run flag.
+	explicit bool
+	fn       func(*gopherbot, context.Context) error
+}
+
+// An action is a kind of change that gopherbot makes on GitHub or Gerrit.
+type action string
+
+const (
+	actLabel       action = "label"        // add or remove issue labels
+	actMilestone   action = "milestone"    // set an issue's milestone
+	actComment     action = "comment"      // comment on an issue or CL
+	actReact       action = "react"        // react to an issue comment
+	actCreateIssue action = "create-issue" // open an issue
+	actClose       action = "close"        // close an issue
+	actLock        action = "lock"         // lock an issue's conversation
+	actHashtag     action = "hashtag"      // add or remove CL hashtags
+	actReview      action = "review"       // set reviewers or votes on a CL
+	actAbandon     action = "abandon"      // abandon a CL
+	actSubmit      action = "submit"       // submit a CL
+)
+
+// Descriptions of the corpus data examined by rules.
+const (
+	goIssues       = "golang/go issues"
+	gardenedIssues = "issues in gardened repos" // see gardenIssues
+	vscodeIssues   = "golang/vscode-go issues"
+	gerritCLs      = "Gerrit CLs"
+	gerritAPI      = "Gerrit API"
+)
+
+var rules = []*rule{
+	// Rules that are specific to the golang/go repo.
+	{name: "kicktrain", reads: []string{goIssues}, actions: []action{actMilestone}, explicit: true, fn: (*gopherbot).getOffKickTrain},
+	{name: "label build issues", reads: []string{goIssues}, actions: []action{actLabel}, fn: (*gopherbot).labelBuildIssues},
+	{name: "label compiler/runtime issues", reads: []string{goIssues}, actions: []action{actLabel}, fn: (*gopherbot).labelCompilerRuntimeIssues},
+	{name: "label mobile issues", reads: []string{goIssues}, actions: []action{actLabel}, fn: (*gopherbot).labelMobileIssues},
+	{name: "label tools issues", reads: []string{goIssues}, actions: []action{actLabel}, fn: (*gopherbot).labelToolsIssues},
+	{name: "label website issues", reads: []string{goIssues}, actions: []action{actLabel}, fn: (*gopherbot).labelWebsiteIssues},
+	{name: "label pkgsite issues", reads: []string{goIssues}, actions: []action{actLabel}, fn: (*gopherbot).labelPkgsiteIssues},
+	{name: "label proxy.golang.org issues", reads: []string{goIssues}, actions: []action{actLabel}, fn: (*gopherbot).labelProxyIssues},
+	{name: "label vulncheck or vulndb issues", reads: []string{goIssues}, actions: []action{actLabel}, fn: (*gopherbot).labelVulnIssues},
+	{name: "label proposals", reads: []string{goIssues}, actions: []action{actLabel, actMilestone}, fn: (*gopherbot).labelProposals},
+	{name: "handle gopls issues", reads: []string{goIssues}, actions: []action{actLabel}, fn: (*gopherbot).handleGoplsIssues},
+	{name: "handle telemetry issues", reads: []string{goIssues}, actions: []action{actLabel}, fn: (*gopherbot).handleTelemetryIssues},
+	{name: "open cherry pick issues", reads: []string{goIssues}, actions: []action{actCreateIssue, actComment, actLabel}, fn: (*gopherbot).openCherryPickIssues},
+	{name: "close cherry pick issues", reads: []string{goIssues, gerritCLs}, actions: []action{actComment, actClose}, fn: (*gopherbot).closeCherryPickIssues},
+	{name: "set subrepo milestones", reads: []string{goIssues}, actions: []action{actMilestone}, fn: (*gopherbot).setSubrepoMilestones},
+	{name: "set misc milestones", reads: []string{goIssues}, actions: []action{actMilestone}, fn: (*gopherbot).setMiscMilestones},
+	{name: "apply minor release milestones", reads: []string{goIssues}, actions: []action{actMilestone}, fn: (*gopherbot).setMinorMilestones},
+	{name: "update needs", reads: []string{goIssues}, actions: []action{actLabel}, fn: (*gopherbot).updateNeeds},
+
+	// Rules that can be applied to many repos.
+	{name: "freeze old issues", reads: []string{gardenedIssues}, actions: []action{actLock, actLabel}, fn: (*gopherbot).freezeOldIssues},
+	{name: "label documentation issues", reads: []string{gardenedIssues}, actions: []action{actLabel}, fn: (*gopherbot).labelDocumentationIssues},
+	{name: "close stale WaitingForInfo", reads: []string{gardenedIssues}, actions: []action{actComment, actClose}, fn: (*gopherbot).closeStaleWaitingForInfo},
+	{name: "apply labels from comments", reads: []string{gardenedIssues}, actions: []action{actLabel}, fn: (*gopherbot).applyLabelsFromComments},
+	{name: "handle commands", reads: []string{gardenedIssues, gerritCLs}, actions: []action{actReact, actComment, actCreateIssue, actReview}, fn: (*gopherbot).handleCommands},
+
+	// Gerrit rules are applied to all projects by default.
+	{name: "abandon scratch reviews", reads: []string{gerritCLs}, actions: []action{actAbandon}, fn: (*gopherbot).abandonScratchReviews},
+	{name: "assign reviewers to CLs", reads: []string{gerritCLs}, actions: []action{actHashtag, actReview}, fn: (*gopherbot).assignReviewersToCLs},
+	{name: "auto-submit CLs", reads: []string{gerritCLs, gerritAPI}, actions: []action{actSubmit}, fn: (*gopherbot).autoSubmitCLs},
+
+	// Rules that are specific to the golang/vscode-go repo.
+	{name: "set vscode-go milestones", reads: []string{vscodeIssues}, actions: []action{actMilestone}, fn: (*gopherbot).setVSCodeGoMilestones},
+
+	{name: "access", reads: []string{gerritCLs, gerritAPI}, explicit: true, fn: (*gopherbot).whoNeedsAccess},
+	{name: "cl2issue", reads: []string{gerritCLs, gardenedIssues}, actions: []action{actComment}, fn: (*gopherbot).cl2issue},
+	{name: "congratulate new contributors", reads: []string{gerritCLs}, actions: []action{actComment}, fn: (*gopherbot).congratulateNewContributors},
+	{name: "un-wait CLs", reads: []string{gerritCLs}, actions: []action{actHashtag}, fn: (*gopherbot).unwaitCLs},
+}
+
+// declares reports whether r declares that it may take actions of kind a.
+func (r *rule) declares(a action) bool {
+	for _, ra := range r.actions {
+		if ra == a {
+			return true
+		}
+	}
+	return false
+}
+
+// A ruleConfig configures a single rule.
+type ruleConfig struct {
+	// Disabled rules are not run.
+	Disabled bool `json:"disabled"`
+	// DryRun rules report what they would've done, like -dry-run,
+	// without changing anything.
+	DryRun bool `json:"dry_run"`
+}
+
+// ruleConfigs is the configuration of each rule, keyed by rule name.
+// Rules without an entry are enabled.
+var ruleConfigs = map[string]ruleConfig{}
+
+// loadRuleConfigs sets ruleConfigs from the JSON file named by the
+// -rules-config flag, if any, and then the -disable-rules and
+// -dry-run-rules flags.
+func loadRuleConfigs() error {
+	if *rulesConfigFile != "" {
+		data, err := os.ReadFile(*rulesConfigFile)
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal(data, &ruleConfigs); err != nil {
+			return fmt.Errorf("parsing %s: %v", *rulesConfigFile, err)
+		}
+	}
+	for _, name := range splitRuleNames(*disableRules) {
+		c := ruleConfigs[name]
+		c.Disabled = true
+		ruleConfigs[name] = c
+	}
+	for _, name := range splitRuleNames(*dryRunRules) {
+		c := ruleConfigs[name]
+		c.DryRun = true
+		ruleConfigs[name] = c
+	}
+	for name := range ruleConfigs {
+		if lookupRule(name) == nil {
+			return fmt.Errorf("configuration for unknown rule %q", name)
+		}
+	}
+	return nil
+}
+
+// splitRuleNames splits a comma-separated list of rule names.
+func splitRuleNames(list string) []string {
+	var names []string
+	for _, name := range strings.Split(list, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func lookupRule(name string) *rule {
+	for _, r := range rules {
+		if r.name == name {
+			return r
+		}
+	}
+	return nil
+}
+
+// Counters of the actions taken and skipped by each rule, keyed by
+// "<rule>: <action>". Actions are skipped in dry-run mode.
+var (
+	actionsTaken   = expvar.NewMap("gopherbot_actions_taken")
+	actionsSkipped = expvar.NewMap("gopherbot_actions_skipped")
+)
+
+// runRules runs the enabled rules in sequence. It doesn't stop if
+// it encounters an error, but reports errors at the end.
+func (b *gopherbot) runRules(ctx context.Context) []error {
+	var errs []error
+	for _, r := range rules {
+		if *onlyRun != "" && r.name != *onlyRun {
+			continue
+		}
+		if r.explicit && *onlyRun == "" {
+			continue
+		}
+		c := ruleConfigs[r.name]
+		if c.Disabled {
+			continue
+		}
+		b.rule, b.ruleDryRun = r, c.DryRun
+		err := r.fn(b, ctx)
+		b.rule, b.ruleDryRun = nil, false
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %v", r.name, err))
+		}
+	}
+	return errs
+}
+
+// isDryRun reports whether the rule being run is in dry-run mode.
+func (b *gopherbot) isDryRun() bool {
+	return *dryRun || b.ruleDryRun
+}
+
+// act reports whether the rule being run should take an action of
+// kind a, which it shouldn't in dry-run mode, and counts the action
+// as taken or skipped accordingly.
+func (b *gopherbot) act(a action) bool {
+	name := "(none)"
+	if b.rule != nil {
+		name = b.rule.name
+		if !b.rule.declares(a) {
+			log.Printf("rule %q took undeclared action %q", name, a)
+		}
+	}
+	if b.isDryRun() {
+		actionsSkipped.Add(name+": "+string(a), 1)
+		return false
+	}
+	actionsTaken.Add(name+": "+string(a), 1)
+	return true
+}
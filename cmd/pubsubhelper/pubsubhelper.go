@@ -3,8 +3,9 @@
 // license that can be found in the LICENSE file.
 
 // The pubsubhelper is an SMTP server for Gerrit updates and an HTTP
-// server for Github webhook updates. It then lets other clients subscribe
-// to those changes.
+// server for Github webhook updates and for events that other services
+// post to named streams. It then lets other clients subscribe to those
+// changes.
 package main
 
 import (
@@ -39,8 +40,34 @@ var (
 	botEmail      = flag.String("rcpt", "\x67\x6f\x70\x68\x65\x72\x62\x6f\x74@pubsubhelper.golang.org", "email address of bot. incoming emails must be to this address.")
 	smtpListen    = flag.String("smtp", ":25", "SMTP listen address")
 	webhookSecret = flag.String("webhook-secret", "", "Development mode GitHub webhook secret. This flag should not be used in production.")
+	keepEvents    = nonNegativeIntFlag("keep-events", 50, "minimum number of recent events to keep for replay, regardless of their age")
 )
 
+// nonNegativeIntFlag defines an int flag like flag.Int, whose value
+// may not be negative.
+func nonNegativeIntFlag(name string, value int, usage string) *int {
+	p := &value
+	flag.Var((*nonNegativeInt)(p), name, usage)
+	return p
+}
+
+// nonNegativeInt is a flag.Value for an int that may not be negative.
+type nonNegativeInt int
+
+func (n *nonNegativeInt) String() string { return strconv.Itoa(int(*n)) }
+
+func (n *nonNegativeInt) Set(s string) error {
+	v, err := strconv.ParseInt(s, 0, strconv.IntSize)
+	if err != nil {
+		return err
+	}
+	if v < 0 {
+		return errors.New("must not be negative")
+	}
+	*n = nonNegativeInt(v)
+	return nil
+}
+
 func main() {
 	https.RegisterFlags(flag.CommandLine)
 	flag.Parse()
@@ -73,6 +100,7 @@ func main() {
 	http.HandleFunc("/waitevent", handleWaitEvent)
 	http.HandleFunc("/recent", handleRecent)
 	http.HandleFunc("/github-webhook", handleGithubWebhook)
+	http.HandleFunc("/webhook/", handleWebhook)
 
 	errc := make(chan error)
 	go func() {
@@ -86,7 +114,9 @@ func main() {
 		err := s.ListenAndServe()
 		errc <- fmt.Errorf("SMTP ListenAndServe: %v", err)
 	}()
-	log.Fatalln(https.ListenAndServe(ctx, http.DefaultServeMux))
+	if err := https.ListenAndServe(ctx, http.DefaultServeMux); err != nil {
+		log.Fatalln(err)
+	}
 }
 
 func handleRoot(w http.ResponseWriter, r *http.Request) {
@@ -99,10 +129,14 @@ func handleRoot(w http.ResponseWriter, r *http.Request) {
   This is <a href="https://godoc.org/golang.org/x/build/cmd/pubsubhelper">pubsubhelper</a>.
 
 <ul>
-   <li><b><a href="/waitevent">/waitevent</a></b>: long-poll wait 30s for next event (use ?after=[RFC3339Nano] to resume at point)</li>
-   <li><b><a href="/recent">/recent</a></b>: recent events, without long-polling.</li>
+   <li><b><a href="/waitevent">/waitevent</a></b>: long-poll wait 30s for next event (use ?after=[RFC3339Nano] to resume at point, or ?replay=N to start at the Nth most recent event)</li>
+   <li><b><a href="/recent">/recent</a></b>: recent events, without long-polling (use ?n=N for only the N most recent).</li>
+   <li><b>/webhook/<i>stream</i></b>: POST a JSON object with optional "type", "project", and "payload" fields to publish an event to a named stream, signed like a GitHub webhook.</li>
 </ul>
 
+Both /waitevent and /recent accept ?stream=, ?type=, and ?project= parameters to select events.
+The built-in streams are "gerrit" and "github".
+
 </body>
 </html>
 `)
@@ -115,6 +149,7 @@ func handleWaitEvent(w http.ResponseWriter, r *http.Request) {
 	}
 
 	ch := make(chan *eventAndJSON, 1)
+	f := parseFilter(r)
 
 	var after time.Time
 	if v := r.FormValue("after"); v != "" {
@@ -124,11 +159,18 @@ func handleWaitEvent(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, "'after' parameter is not in time.RFC3339Nano format", http.StatusBadRequest)
 			return
 		}
+	} else if v := r.FormValue("replay"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			http.Error(w, "'replay' parameter is not a positive number", http.StatusBadRequest)
+			return
+		}
+		after = replayStart(f, n)
 	} else {
 		after = time.Now()
 	}
 
-	register(ch, after)
+	register(ch, after, f)
 	defer unregister(ch)
 	ctx := r.Context()
 
@@ -162,14 +204,24 @@ func handleRecent(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 	}
+	limit := -1
+	if v := r.FormValue("n"); v != "" {
+		var err error
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit < 0 {
+			http.Error(w, "'n' parameter is not a non-negative number", http.StatusBadRequest)
+			return
+		}
+	}
+	f := parseFilter(r)
 
 	var buf bytes.Buffer
 	mu.Lock()
 	buf.WriteString("[\n")
 	n := 0
-	for i := len(recent) - 1; i >= 0; i-- {
+	for i := len(recent) - 1; i >= 0 && n != limit; i-- {
 		ev := recent[i]
-		if ev.Time.Time().Before(after) {
+		if ev.Time.Time().Before(after) || !f.matches(ev.Event) {
 			continue
 		}
 		if n > 0 {
@@ -285,24 +337,63 @@ type eventAndJSON struct {
 var (
 	mu      sync.Mutex      // guards following
 	recent  []*eventAndJSON // newest at end
-	waiting = map[chan *eventAndJSON]struct{}{}
+	waiting = map[chan *eventAndJSON]filter{}
 )
 
-const (
-	keepMin = 50
-	maxAge  = 1 * time.Hour
-)
+const maxAge = 1 * time.Hour
+
+// A filter selects the events a client is interested in.
+// Empty fields match all events.
+type filter struct {
+	stream, typ, project string
+}
+
+func parseFilter(r *http.Request) filter {
+	return filter{
+		stream:  r.FormValue("stream"),
+		typ:     r.FormValue("type"),
+		project: r.FormValue("project"),
+	}
+}
+
+// matches reports whether e is selected by f.
+// Long poll timeouts match every filter.
+func (f filter) matches(e *pubsubtypes.Event) bool {
+	if e.LongPollTimeout {
+		return true
+	}
+	return (f.stream == "" || f.stream == e.Stream()) &&
+		(f.typ == "" || f.typ == e.Type()) &&
+		(f.project == "" || f.project == e.Project())
+}
 
-func register(ch chan *eventAndJSON, after time.Time) {
+// replayStart returns the time just before the nth most recent event
+// matching f, so that waiting for events after it replays the last n.
+// If fewer than n events match, it returns the zero time, which
+// replays all the matching events that are kept.
+func replayStart(f filter, n int) time.Time {
+	mu.Lock()
+	defer mu.Unlock()
+	for i := len(recent) - 1; i >= 0; i-- {
+		if e := recent[i]; f.matches(e.Event) {
+			if n--; n == 0 {
+				return e.Time.Time().Add(-time.Nanosecond)
+			}
+		}
+	}
+	return time.Time{}
+}
+
+func register(ch chan *eventAndJSON, after time.Time, f filter) {
 	mu.Lock()
 	defer mu.Unlock()
 	for _, e := range recent {
-		if e.Time.Time().After(after) {
+		if e.Time.Time().After(after) && f.matches(e.Event) {
 			ch <- e
 			return
 		}
 	}
-	waiting[ch] = struct{}{}
+	waiting[ch] = f
 }
 
 func unregister(ch chan *eventAndJSON) {
@@ -312,14 +403,14 @@ func unregister(ch chan *eventAndJSON) {
 }
 
 // numOldInRecentLocked returns how many leading items of recent are
-// too old.
+// too old, leaving at least *keepEvents.
 func numOldInRecentLocked() int {
-	if len(recent) <= keepMin {
+	if len(recent) <= *keepEvents {
 		return 0
 	}
 	n := 0
 	tooOld := time.Now().Add(-maxAge)
-	for _, e := range recent {
+	for _, e := range recent[:len(recent)-*keepEvents] {
 		if e.Time.Time().After(tooOld) {
 			break
 		}
@@ -354,9 +445,11 @@ func publish(e *pubsubtypes.Event) {
 		recent = recent[:len(recent)-n]
 	}
 
-	for ch := range waiting {
-		ch <- ej
-		delete(waiting, ch)
+	for ch, f := range waiting {
+		if f.matches(e) {
+			ch <- ej
+			delete(waiting, ch)
+		}
 	}
 }
 
@@ -0,0 +1,172 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.org/x/build/cmd/pubsubhelper/pubsubtypes"
+)
+
+func resetEvents(t *testing.T) {
+	mu.Lock()
+	defer mu.Unlock()
+	recent = nil
+	waiting = map[chan *eventAndJSON]filter{}
+	t.Cleanup(func() {
+		mu.Lock()
+		defer mu.Unlock()
+		recent = nil
+	})
+}
+
+func postWebhook(t *testing.T, stream, body string) int {
+	t.Helper()
+	old := *webhookSecret
+	*webhookSecret = "test-secret"
+	defer func() { *webhookSecret = old }()
+
+	mac := hmac.New(sha256.New, []byte("test-secret"))
+	mac.Write([]byte(body))
+	req := httptest.NewRequest("POST", "https://pubsubhelper.golang.org/webhook/"+stream, strings.NewReader(body))
+	req.Header.Set("X-Hub-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	rec := httptest.NewRecorder()
+	handleWebhook(rec, req)
+	return rec.Code
+}
+
+func TestWebhook(t *testing.T) {
+	resetEvents(t)
+
+	for _, tc := range []struct {
+		stream, body string
+		want         int
+	}{
+		{"gitmirror", `{"type": "mirrored", "project": "go", "payload": {"rev": "abc"}}`, http.StatusNoContent},
+		{"gerrit", `{}`, http.StatusBadRequest},
+		{"Bad_Name", `{}`, http.StatusBadRequest},
+		{"gitmirror", `not json`, http.StatusBadRequest},
+	} {
+		if got := postWebhook(t, tc.stream, tc.body); got != tc.want {
+			t.Errorf("posting %s to stream %q: got status %d, want %d", tc.body, tc.stream, got, tc.want)
+		}
+	}
+
+	req := httptest.NewRequest("POST", "https://pubsubhelper.golang.org/webhook/gitmirror", strings.NewReader(`{}`))
+	req.Header.Set("X-Hub-Signature", "sha256=00")
+	rec := httptest.NewRecorder()
+	handleWebhook(rec, req)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("posting with a bad signature: got status %d, want %d", rec.Code, http.StatusForbidden)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(recent) != 1 {
+		t.Fatalf("got %d events, want 1", len(recent))
+	}
+	wh := recent[0].Webhook
+	if wh == nil || wh.Stream != "gitmirror" || wh.Type != "mirrored" || wh.Project != "go" || string(wh.Payload) != `{"rev": "abc"}` {
+		t.Errorf("published event %s, want the posted gitmirror event", recent[0].json)
+	}
+}
+
+func TestFilterAndReplay(t *testing.T) {
+	resetEvents(t)
+	publish(&pubsubtypes.Event{Gerrit: &pubsubtypes.GerritEvent{Project: "go", ChangeNumber: 1}})
+	publish(&pubsubtypes.Event{GitHub: &pubsubtypes.GitHubEvent{Action: "opened", RepoOwner: "golang", Repo: "go", IssueNumber: 2}})
+	publish(&pubsubtypes.Event{Gerrit: &pubsubtypes.GerritEvent{Project: "build", ChangeNumber: 3}})
+	publish(&pubsubtypes.Event{Gerrit: &pubsubtypes.GerritEvent{Project: "go", ChangeNumber: 4}})
+
+	recentNumbers := func(query string) []int {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		handleRecent(rec, httptest.NewRequest("GET", "/recent?"+query, nil))
+		var evs []pubsubtypes.Event
+		if err := json.NewDecoder(rec.Body).Decode(&evs); err != nil {
+			t.Fatalf("decoding /recent?%s: %v", query, err)
+		}
+		var nums []int
+		for _, e := range evs {
+			switch {
+			case e.Gerrit != nil:
+				nums = append(nums, e.Gerrit.ChangeNumber)
+			case e.GitHub != nil:
+				nums = append(nums, e.GitHub.IssueNumber)
+			}
+		}
+		return nums
+	}
+	for query, want := range map[string][]int{
+		"":                             {4, 3, 2, 1},
+		"n=2":                          {4, 3},
+		"stream=gerrit":                {4, 3, 1},
+		"stream=gerrit&project=go":     {4, 1},
+		"project=golang/go":            {2},
+		"stream=github&type=closed":    nil,
+		"stream=gerrit&project=go&n=1": {4},
+	} {
+		if got := recentNumbers(query); !cmp.Equal(got, want) {
+			t.Errorf("/recent?%s = %v, want %v", query, got, want)
+		}
+	}
+
+	// Replaying the last 2 Gerrit events for "go" starts at change 1,
+	// and resuming after it yields change 4.
+	waitEvent := func(query string) *pubsubtypes.Event {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		handleWaitEvent(rec, httptest.NewRequest("GET", "/waitevent?"+query, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("/waitevent?%s: got status %d: %s", query, rec.Code, rec.Body)
+		}
+		var e pubsubtypes.Event
+		if err := json.NewDecoder(rec.Body).Decode(&e); err != nil {
+			t.Fatal(err)
+		}
+		return &e
+	}
+	e := waitEvent("stream=gerrit&project=go&replay=2")
+	if e.Gerrit == nil || e.Gerrit.ChangeNumber != 1 {
+		t.Fatalf("replay=2 returned %+v, want change 1", e)
+	}
+	after := url.QueryEscape(e.Time.Time().Format(time.RFC3339Nano))
+	if e := waitEvent("stream=gerrit&project=go&after=" + after); e.Gerrit == nil || e.Gerrit.ChangeNumber != 4 {
+		t.Errorf("resuming after change 1 returned %+v, want change 4", e)
+	}
+	if e := waitEvent("replay=10"); e.Gerrit == nil || e.Gerrit.ChangeNumber != 1 {
+		t.Errorf("replay=10 returned %+v, want the oldest event, change 1", e)
+	}
+}
+
+func TestNonNegativeIntFlag(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	n := 50
+	fs.Var((*nonNegativeInt)(&n), "n", "")
+	if err := fs.Parse([]string{"-n", "0x10"}); err != nil || n != 16 {
+		t.Errorf("parsing -n 0x10: n = %d, err = %v; want 16, nil", n, err)
+	}
+	for _, arg := range []string{"-1", "many"} {
+		if err := fs.Parse([]string{"-n", arg}); err == nil {
+			t.Errorf("parsing -n %s succeeded; want error", arg)
+		}
+	}
+	if n != 16 {
+		t.Errorf("after bad values, n = %d; want 16", n)
+	}
+}
@@ -6,6 +6,8 @@
 package pubsubtypes
 
 import (
+	"encoding/json"
+
 	"go4.org/types"
 )
 
@@ -25,6 +27,50 @@ type Event struct {
 
 	// Github is non-nil for GitHub events.
 	GitHub *GitHubEvent `json:",omitempty"`
+
+	// Webhook is non-nil for events posted to a named stream.
+	Webhook *WebhookEvent `json:",omitempty"`
+}
+
+// Stream returns the name of the stream e belongs to: "gerrit",
+// "github", or the stream a webhook event was posted to. It returns
+// the empty string for long poll timeouts.
+func (e *Event) Stream() string {
+	switch {
+	case e.Gerrit != nil:
+		return "gerrit"
+	case e.GitHub != nil:
+		return "github"
+	case e.Webhook != nil:
+		return e.Webhook.Stream
+	}
+	return ""
+}
+
+// Type returns the type of e within its stream: the action of GitHub
+// events, or the type of webhook events. Gerrit events have no type.
+func (e *Event) Type() string {
+	switch {
+	case e.GitHub != nil:
+		return e.GitHub.Action
+	case e.Webhook != nil:
+		return e.Webhook.Type
+	}
+	return ""
+}
+
+// Project returns the project e is about: the Gerrit project, the
+// GitHub repo in "owner/repo" form, or the project of webhook events.
+func (e *Event) Project() string {
+	switch {
+	case e.Gerrit != nil:
+		return e.Gerrit.Project
+	case e.GitHub != nil:
+		return e.GitHub.RepoOwner + "/" + e.GitHub.Repo
+	case e.Webhook != nil:
+		return e.Webhook.Project
+	}
+	return ""
 }
 
 // GerritEvent is a type of Event.
@@ -53,3 +99,21 @@ type GitHubEvent struct {
 	IssueNumber       int    `json:",omitempty"`
 	PullRequestNumber int    `json:",omitempty"`
 }
+
+// WebhookEvent is a type of Event, posted by another service to the
+// pubsubhelper's /webhook/<stream> endpoint.
+type WebhookEvent struct {
+	// Stream is the name of the stream the event was posted to,
+	// such as "gitmirror".
+	Stream string
+
+	// Type is the type of the event, as defined by the poster.
+	Type string `json:",omitempty"`
+
+	// Project is the project the event is about, if any, such as
+	// "go" or "golang/go".
+	Project string `json:",omitempty"`
+
+	// Payload is the event's content, as defined by the poster.
+	Payload json.RawMessage `json:",omitempty"`
+}
@@ -0,0 +1,74 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+
+	"golang.org/x/build/cmd/pubsubhelper/pubsubtypes"
+)
+
+// handleWebhook publishes an event posted to /webhook/<stream> by
+// another service. The body is a webhookRequest, signed with the
+// webhook secret in an X-Hub-Signature header like GitHub's webhooks.
+func handleWebhook(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "requires POST", http.StatusMethodNotAllowed)
+		return
+	}
+	if r.TLS == nil {
+		http.Error(w, "HTTPS required", http.StatusBadRequest)
+		return
+	}
+	stream := strings.TrimPrefix(r.URL.Path, "/webhook/")
+	if !validStreamName(stream) {
+		http.Error(w, "invalid stream name", http.StatusBadRequest)
+		return
+	}
+	body, err := validateGithubRequest(w, r)
+	if err != nil {
+		log.Printf("failed to validate webhook request for stream %q: %v", stream, err)
+		http.Error(w, "invalid signature", http.StatusForbidden)
+		return
+	}
+	var req webhookRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		http.Error(w, "invalid JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	publish(&pubsubtypes.Event{
+		Webhook: &pubsubtypes.WebhookEvent{
+			Stream:  stream,
+			Type:    req.Type,
+			Project: req.Project,
+			Payload: req.Payload,
+		},
+	})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type webhookRequest struct {
+	Type    string          `json:"type"`
+	Project string          `json:"project"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// validStreamName reports whether name can be used for a webhook
+// stream. Names are lowercase letters, digits, and dashes, and the
+// names of the built-in streams are reserved.
+func validStreamName(name string) bool {
+	if name == "" || name == "gerrit" || name == "github" {
+		return false
+	}
+	for _, r := range name {
+		if !('a' <= r && r <= 'z' || '0' <= r && r <= '9' || r == '-') {
+			return false
+		}
+	}
+	return true
+}
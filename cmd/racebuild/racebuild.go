@@ -6,6 +6,13 @@
 // Usage:
 //
 //	$ racebuild -rev <llvm_git_revision> -goroot <path_to_go_repo>
+//
+// The platforms are built in parallel, from the matrix in platforms.
+// The progress of the run is saved in the -state file after each
+// platform's build, so if some platforms fail, running racebuild again
+// with the same revisions only rebuilds those. The -manifest flag
+// writes a JSON summary of the built syso files and their hashes,
+// such as to attach to a release workflow.
 package main
 
 import (
@@ -25,6 +32,7 @@ import (
 	"regexp"
 	"strings"
 	"sync"
+	"text/template"
 
 	"golang.org/x/build/internal/envutil"
 	"golang.org/x/sync/errgroup"
@@ -37,169 +45,47 @@ var (
 	flagCheckout   = flag.String("checkout", "", "go.googlesource.com CL reference to check out on top of Go repo (takes form 'refs/changes/NNN/<CL number>/<patchset number>') (optional)")
 	flagCopyOnFail = flag.Bool("copyonfail", false, "Attempt to copy newly built race syso into Go repo even if script fails.")
 	flagGoRev      = flag.String("gorev", "HEAD", "Go repository revision to use; HEAD is relative to --goroot")
-	flagPlatforms  = flag.String("platforms", "all", `comma-separated platforms (such as "linux/amd64") to rebuild, or "all"`)
+	flagPlatforms  = flag.String("platforms", "all", `comma-separated platforms (such as "linux/amd64v1") to rebuild, or "all"`)
+	flagParallel   = flag.Int("parallel", 0, "maximum number of platforms to build at once, or 0 for no limit")
+	flagState      = flag.String("state", "racebuild-state.json", "file to save the progress of the run in, to resume it from if it's run again with the same revisions; empty to not save progress")
+	flagManifest   = flag.String("manifest", "", "file to write a JSON manifest of the built race runtimes to (optional)")
 )
 
 // goRev is the resolved commit ID of flagGoRev.
 var goRev string
 
+// Setup commands that install a build's dependencies.
+const (
+	aptSetup = "apt-get update --allow-releaseinfo-change\napt-get install -y git g++"
+	yumSetup = "cat /etc/os-release\nyum install -y gcc-c++ git golang-bin"
+)
+
+// platforms is the matrix of platforms racebuild builds the race
+// runtime for. Their build scripts are generated from bashScript,
+// except where a Platform has its own Script.
+//
 // TODO: use buildlet package instead of calling out to gomote.
 var platforms = []*Platform{
-	&Platform{
-		OS:   "openbsd",
-		Arch: "amd64",
-		Type: "openbsd-amd64-70",
-		Script: `#!/usr/bin/env bash
-set -e
-git clone https://go.googlesource.com/go
-pushd go
-git checkout $GOREV
-if [ "$GOGITOP" != "" ]; then
-  git fetch https://go.googlesource.com/go "$GOSRCREF"
-  git $GOGITOP FETCH_HEAD
-fi
-popd
-git clone https://github.com/llvm/llvm-project
-(cd llvm-project && git checkout $REV)
-(cd llvm-project/compiler-rt/lib/tsan/go && CC=clang ./buildgo.sh)
-cp llvm-project/compiler-rt/lib/tsan/go/race_openbsd_amd64.syso go/src/runtime/race/internal/amd64v1/race_openbsd.syso
-(cd go/src && ./race.bash)
-			`,
-	},
-	&Platform{
-		OS:   "freebsd",
-		Arch: "amd64",
-		Type: "freebsd-amd64-race",
-		Script: `#!/usr/bin/env bash
-set -e
-git clone https://go.googlesource.com/go
-pushd go
-git checkout $GOREV
-if [ "$GOGITOP" != "" ]; then
-  git fetch https://go.googlesource.com/go "$GOSRCREF"
-  git $GOGITOP FETCH_HEAD
-fi
-popd
-git clone https://github.com/llvm/llvm-project
-(cd llvm-project && git checkout $REV)
-(cd llvm-project/compiler-rt/lib/tsan/go && CC=clang ./buildgo.sh)
-cp llvm-project/compiler-rt/lib/tsan/go/race_freebsd_amd64.syso go/src/runtime/race/internal/amd64v1/race_freebsd.syso
-(cd go/src && ./race.bash)
-			`,
-	},
-	&Platform{
-		OS:      "darwin",
-		Arch:    "amd64",
-		SubArch: "v1",
-		Type:    "darwin-amd64-12_0",
-		Script: `#!/usr/bin/env bash
-set -e
-git clone https://go.googlesource.com/go
-pushd go
-git checkout $GOREV
-if [ "$GOGITOP" != "" ]; then
-  git fetch https://go.googlesource.com/go "$GOSRCREF"
-  git $GOGITOP FETCH_HEAD
-fi
-popd
-git clone https://github.com/llvm/llvm-project
-(cd llvm-project && git checkout $REV)
-(cd llvm-project/compiler-rt/lib/tsan/go && CC=clang ./buildgo.sh)
-cp llvm-project/compiler-rt/lib/tsan/go/race_darwin_amd64.syso go/src/runtime/race/internal/amd64v1/race_darwin.syso
-(cd go/src && ./race.bash)
-			`,
-	},
-	&Platform{
-		OS:      "darwin",
-		Arch:    "amd64",
-		SubArch: "v3",
-		Type:    "darwin-amd64-12_0",
-		Script: `#!/usr/bin/env bash
-set -e
-git clone https://go.googlesource.com/go
-pushd go
-git checkout $GOREV
-popd
-git clone https://github.com/llvm/llvm-project
-(cd llvm-project && git checkout $REV)
-(cd llvm-project/compiler-rt/lib/tsan/go && CC=clang GOAMD64=v3 ./buildgo.sh)
-cp llvm-project/compiler-rt/lib/tsan/go/race_darwin_amd64.syso go/src/runtime/race/internal/amd64v3/race_darwin.syso
-(cd go/src && GOAMD64=v3 ./race.bash)
-			`,
-	},
-	&Platform{
-		OS:   "darwin",
-		Arch: "arm64",
-		Type: "darwin-arm64-12",
-		Script: `#!/usr/bin/env bash
-set -e
-git clone https://go.googlesource.com/go
-pushd go
-git checkout $GOREV
-if [ "$GOGITOP" != "" ]; then
-  git fetch https://go.googlesource.com/go "$GOSRCREF"
-  git $GOGITOP FETCH_HEAD
-fi
-popd
-git clone https://github.com/llvm/llvm-project
-(cd llvm-project && git checkout $REV)
-(cd llvm-project/compiler-rt/lib/tsan/go && CC=clang ./buildgo.sh)
-cp llvm-project/compiler-rt/lib/tsan/go/race_darwin_arm64.syso go/src/runtime/race
-(cd go/src && ./race.bash)
-			`,
-	},
-	&Platform{
-		OS:      "linux",
-		Arch:    "amd64",
-		SubArch: "v1",
-		Type:    "linux-amd64-race",
-		Script: `#!/usr/bin/env bash
-set -e
-apt-get update --allow-releaseinfo-change
-apt-get install -y git g++
-git clone https://go.googlesource.com/go
-pushd go
-git checkout $GOREV
-if [ "$GOGITOP" != "" ]; then
-  git fetch https://go.googlesource.com/go "$GOSRCREF"
-  git $GOGITOP FETCH_HEAD
-fi
-popd
-git clone https://github.com/llvm/llvm-project
-(cd llvm-project && git checkout $REV)
-(cd llvm-project/compiler-rt/lib/tsan/go && ./buildgo.sh)
-cp llvm-project/compiler-rt/lib/tsan/go/race_linux_amd64.syso go/src/runtime/race/internal/amd64v1/race_linux.syso
-(cd go/src && ./race.bash)
-			`,
-	},
-	&Platform{
-		OS:      "linux",
-		Arch:    "amd64",
-		SubArch: "v3",
-		Type:    "linux-amd64-race",
-		Script: `#!/usr/bin/env bash
-set -e
-apt-get update
-apt-get install -y git g++
-git clone https://go.googlesource.com/go
-pushd go
-git checkout $GOREV
-popd
-git clone https://github.com/llvm/llvm-project
-(cd llvm-project && git checkout $REV)
-(cd llvm-project/compiler-rt/lib/tsan/go && GOAMD64=v3 ./buildgo.sh)
-cp llvm-project/compiler-rt/lib/tsan/go/race_linux_amd64.syso go/src/runtime/race/internal/amd64v3/race_linux.syso
-(cd go/src && GOAMD64=v3 ./race.bash)
-			`,
-	},
-	&Platform{
-		OS:   "linux",
-		Arch: "ppc64le",
-		Type: "linux-ppc64le-buildlet",
-		Script: `#!/usr/bin/env bash
+	{OS: "openbsd", Arch: "amd64", SubArch: "v1", Type: "openbsd-amd64-70", CC: "clang"},
+	{OS: "freebsd", Arch: "amd64", SubArch: "v1", Type: "freebsd-amd64-race", CC: "clang"},
+	{OS: "darwin", Arch: "amd64", SubArch: "v1", Type: "darwin-amd64-12_0", CC: "clang"},
+	{OS: "darwin", Arch: "amd64", SubArch: "v3", Type: "darwin-amd64-12_0", CC: "clang"},
+	{OS: "darwin", Arch: "arm64", Type: "darwin-arm64-12", CC: "clang"},
+	{OS: "linux", Arch: "amd64", SubArch: "v1", Type: "linux-amd64-race", Setup: aptSetup},
+	{OS: "linux", Arch: "amd64", SubArch: "v3", Type: "linux-amd64-race", Setup: aptSetup},
+	{OS: "linux", Arch: "ppc64le", Type: "linux-ppc64le-buildlet", Setup: aptSetup, BuildDir: "/tmp", SkipTest: "23731"},
+	{OS: "linux", Arch: "arm64", Type: "linux-arm64", Setup: aptSetup},
+	{OS: "netbsd", Arch: "amd64", SubArch: "v1", Type: "netbsd-amd64-9_3", CC: "clang", SkipTest: "24322"},
+	{OS: "windows", Arch: "amd64", SubArch: "v1", Type: "windows-amd64-race", Script: windowsScript},
+	{OS: "linux", Arch: "s390x", Type: "linux-s390x-ibm", Setup: yumSetup},
+}
+
+// bashScript is the template of the build scripts of platforms with
+// a bash shell.
+var bashScript = template.Must(template.New("script").Parse(`#!/usr/bin/env bash
 set -e
-apt-get update --allow-releaseinfo-change
-apt-get install -y git g++
+{{with .Setup}}{{.}}
+{{end -}}
 git clone https://go.googlesource.com/go
 pushd go
 git checkout $GOREV
@@ -209,66 +95,21 @@ if [ "$GOGITOP" != "" ]; then
 fi
 popd
 workdir=$(pwd)
-pushd /tmp
-git clone https://github.com/llvm/llvm-project
-(cd llvm-project && git checkout $REV)
-(cd llvm-project/compiler-rt/lib/tsan/go && ./buildgo.sh)
-cp llvm-project/compiler-rt/lib/tsan/go/race_linux_ppc64le.syso $workdir/go/src/runtime/race
-popd
-# TODO(#23731): Uncomment to test the syso file before accepting it.
-# (cd go/src && ./race.bash)
-			`,
-	},
-	&Platform{
-		OS:   "linux",
-		Arch: "arm64",
-		Type: "linux-arm64",
-		Script: `#!/usr/bin/env bash
-set -e
-apt-get update --allow-releaseinfo-change
-apt-get install -y git g++
-git clone https://go.googlesource.com/go
-pushd go
-git checkout $GOREV
-if [ "$GOGITOP" != "" ]; then
-  git fetch https://go.googlesource.com/go "$GOSRCREF"
-  git $GOGITOP FETCH_HEAD
-fi
-popd
+pushd {{or .BuildDir "."}}
 git clone https://github.com/llvm/llvm-project
 (cd llvm-project && git checkout $REV)
-(cd llvm-project/compiler-rt/lib/tsan/go && ./buildgo.sh)
-cp llvm-project/compiler-rt/lib/tsan/go/race_linux_arm64.syso go/src/runtime/race
-(cd go/src && ./race.bash)
-			`,
-	},
-	&Platform{
-		OS:   "netbsd",
-		Arch: "amd64",
-		Type: "netbsd-amd64-9_3",
-		Script: `#!/usr/bin/env bash
-set -e
-git clone https://go.googlesource.com/go
-pushd go
-git checkout $GOREV
-if [ "$GOGITOP" != "" ]; then
-  git fetch https://go.googlesource.com/go "$GOSRCREF"
-  git $GOGITOP FETCH_HEAD
-fi
+(cd llvm-project/compiler-rt/lib/tsan/go && {{with .CC}}CC={{.}} {{end}}{{.GOAMD64Env}}./buildgo.sh)
+cp llvm-project/compiler-rt/lib/tsan/go/race_{{.OS}}_{{.Arch}}.syso $workdir/go/src/runtime/race/{{.Basename}}
 popd
-git clone https://github.com/llvm/llvm-project
-(cd llvm-project && git checkout $REV)
-(cd llvm-project/compiler-rt/lib/tsan/go && CC=clang ./buildgo.sh)
-cp llvm-project/compiler-rt/lib/tsan/go/race_netbsd_amd64.syso go/src/runtime/race/internal/amd64v1/race_netbsd.syso
-# TODO(#24322): Uncomment to test the syso file before accepting it.
-# (cd go/src && ./race.bash)
-			`,
-	},
-	&Platform{
-		OS:   "windows",
-		Arch: "amd64",
-		Type: "windows-amd64-race",
-		Script: `
+{{if .SkipTest -}}
+# TODO(#{{.SkipTest}}): Uncomment to test the syso file before accepting it.
+# (cd go/src && {{.GOAMD64Env}}./race.bash)
+{{- else -}}
+(cd go/src && {{.GOAMD64Env}}./race.bash)
+{{- end}}
+`))
+
+const windowsScript = `
 @"%SystemRoot%\System32\WindowsPowerShell\v1.0\powershell.exe" -NoProfile -InputFormat None -ExecutionPolicy Bypass -Command "[System.net.ServicePointManager]::SecurityProtocol = 3072; iex ((New-Object System.Net.WebClient).DownloadString('https://chocolatey.org/install.ps1'))" && SET "PATH=%PATH%;%ALLUSERSPROFILE%\chocolatey\bin"
 choco install git -y
 if %errorlevel% neq 0 exit /b %errorlevel%
@@ -305,32 +146,7 @@ if %errorlevel% neq 0 exit /b %errorlevel%
 cd go/src
 call race.bat
 if %errorlevel% neq 0 exit /b %errorlevel%
-			`,
-	},
-	&Platform{
-		OS:   "linux",
-		Arch: "s390x",
-		Type: "linux-s390x-ibm",
-		Script: `#!/usr/bin/env bash
-set -e
-cat /etc/os-release
-yum install -y gcc-c++ git golang-bin
-git clone https://go.googlesource.com/go
-pushd go
-git checkout $GOREV
-if [ "$GOGITOP" != "" ]; then
-  git fetch https://go.googlesource.com/go "$GOSRCREF"
-  git $GOGITOP FETCH_HEAD
-fi
-popd
-git clone https://github.com/llvm/llvm-project
-(cd llvm-project && git checkout $REV)
-(cd llvm-project/compiler-rt/lib/tsan/go && ./buildgo.sh)
-cp llvm-project/compiler-rt/lib/tsan/go/race_linux_s390x.syso go/src/runtime/race
-(cd go/src && ./race.bash)
-			`,
-	},
-}
+`
 
 func init() {
 	// Ensure that there are no duplicate platform entries.
@@ -407,33 +223,71 @@ func main() {
 		cancel()
 	}()
 
-	g, ctx := errgroup.WithContext(ctx)
+	gogitop, gosrcref := setupForGoRepoGitOp()
+	state, err := loadRunState(*flagState, &Manifest{LLVMRev: *flagRev, GoRev: goRev, GoGitOp: gogitop, GoSrcRef: gosrcref})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// A platform's failure doesn't stop the others' builds, so that
+	// they needn't be rebuilt when the run is resumed.
+	var g errgroup.Group
+	if *flagParallel > 0 {
+		g.SetLimit(*flagParallel)
+	}
 	for _, p := range platforms {
 		if !platformEnabled[p.Name()] {
 			continue
 		}
+		if state.done(p, *flagGoroot) {
+			log.Printf("%v: already built in this run, skipping", p.Name())
+			continue
+		}
 
 		p := p
 		g.Go(func() error {
-			if err := p.Build(ctx); err != nil {
-				return fmt.Errorf("%v failed: %v", p.Name(), err)
+			err := p.Build(ctx)
+			if err == nil {
+				err = p.UpdateReadme()
+			}
+			if err != nil {
+				err = fmt.Errorf("%v failed: %v", p.Name(), err)
+			}
+			if rerr := state.record(p, *flagGoroot, err); rerr != nil {
+				log.Printf("%v: saving progress: %v", p.Name(), rerr)
 			}
-			return p.UpdateReadme()
+			return err
 		})
 	}
+	err = g.Wait()
 
-	if err := g.Wait(); err != nil {
+	m := state.manifest()
+	for _, line := range m.summary() {
+		log.Print(line)
+	}
+	if *flagManifest != "" {
+		if err := writeManifest(*flagManifest, m); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if err != nil {
 		log.Fatal(err)
 	}
 }
 
+// A Platform is a platform the race runtime is built for.
 type Platform struct {
 	OS      string
 	Arch    string
-	SubArch string
+	SubArch string // GOAMD64 level, for amd64
 	Type    string // gomote instance type
 	Inst    string // actual gomote instance name
-	Script  string
+
+	Setup    string // shell commands that install the build's dependencies
+	CC       string // C compiler, if not the default
+	BuildDir string // directory to build LLVM in, if not the work directory
+	SkipTest string // issue number of why race.bash isn't run, if it isn't
+	Script   string // build script, if not generated from bashScript
 }
 
 func (p *Platform) Name() string {
@@ -451,6 +305,27 @@ func (p *Platform) Basename() string {
 	return fmt.Sprintf("race_%v_%s.syso", p.OS, p.Arch)
 }
 
+// GOAMD64Env returns the GOAMD64 environment variable assignment that
+// prefixes the build commands of p, if any.
+func (p *Platform) GOAMD64Env() string {
+	if p.SubArch == "" {
+		return ""
+	}
+	return "GOAMD64=" + p.SubArch + " "
+}
+
+// BuildScript returns the script that builds the race runtime for p.
+func (p *Platform) BuildScript() (string, error) {
+	if p.Script != "" {
+		return p.Script, nil
+	}
+	var buf bytes.Buffer
+	if err := bashScript.Execute(&buf, p); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
 func setupForGoRepoGitOp() (string, string) {
 	if *flagCherryPick != "" {
 		return "cherry-pick -n", *flagCherryPick
@@ -499,7 +374,11 @@ func (p *Platform) Build(ctx context.Context) error {
 		script.Close()
 		os.Remove(script.Name())
 	}()
-	if _, err := script.Write([]byte(p.Script)); err != nil {
+	body, err := p.BuildScript()
+	if err != nil {
+		return fmt.Errorf("generating build script: %v", err)
+	}
+	if _, err := script.Write([]byte(body)); err != nil {
 		return fmt.Errorf("failed to write temp file: %v", err)
 	}
 	script.Close()
@@ -534,7 +413,7 @@ func (p *Platform) Build(ctx context.Context) error {
 		return fmt.Errorf("%v", err)
 	}
 	if scriptRunErr != nil {
-		return err
+		return scriptRunErr
 	}
 
 	log.Printf("%v: build completed", p.Name())
@@ -0,0 +1,97 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBuildScript(t *testing.T) {
+	for _, p := range platforms {
+		script, err := p.BuildScript()
+		if err != nil {
+			t.Errorf("%v: %v", p.Name(), err)
+			continue
+		}
+		if p.Script != "" {
+			continue
+		}
+		for _, want := range []string{
+			"git checkout $GOREV\n",
+			"cp llvm-project/compiler-rt/lib/tsan/go/race_" + p.OS + "_" + p.Arch + ".syso $workdir/go/src/runtime/race/" + p.Basename() + "\n",
+		} {
+			if !strings.Contains(script, want) {
+				t.Errorf("%v: script doesn't contain %q:\n%s", p.Name(), want, script)
+			}
+		}
+		if tested := strings.Contains(script, "\n(cd go/src && "+p.GOAMD64Env()+"./race.bash)"); tested != (p.SkipTest == "") {
+			t.Errorf("%v: script runs race.bash = %v, want %v:\n%s", p.Name(), tested, p.SkipTest == "", script)
+		}
+	}
+}
+
+func TestRunStateResume(t *testing.T) {
+	goroot := t.TempDir()
+	stateFile := filepath.Join(t.TempDir(), "state.json")
+	linux := &Platform{OS: "linux", Arch: "amd64", SubArch: "v1"}
+	darwin := &Platform{OS: "darwin", Arch: "arm64"}
+	syso := filepath.Join(goroot, "src", "runtime", "race", linux.Basename())
+	if err := os.MkdirAll(filepath.Dir(syso), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(syso, []byte("race runtime"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	run := Manifest{LLVMRev: "llvm1", GoRev: "go1"}
+	m := run
+	s, err := loadRunState(stateFile, &m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.record(linux, goroot, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.record(darwin, goroot, os.ErrDeadlineExceeded); err != nil {
+		t.Fatal(err)
+	}
+
+	// Resuming the same run skips only the platforms that were built.
+	m = run
+	s, err = loadRunState(stateFile, &m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !s.done(linux, goroot) {
+		t.Errorf("resumed run: %v isn't done, want done", linux.Name())
+	}
+	if s.done(darwin, goroot) {
+		t.Errorf("resumed run: failed %v is done, want not done", darwin.Name())
+	}
+	if got := s.manifest().summary(); len(got) != 2 || !strings.HasPrefix(got[0], "darwin/arm64: FAILED") || !strings.HasPrefix(got[1], "linux/amd64v1: ok") {
+		t.Errorf("resumed run summary = %q", got)
+	}
+
+	// A syso file changed since it was built is rebuilt.
+	if err := os.WriteFile(syso, []byte("something else"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if s.done(linux, goroot) {
+		t.Errorf("resumed run: %v with a changed syso file is done, want not done", linux.Name())
+	}
+
+	// Another run starts over.
+	m = Manifest{LLVMRev: "llvm2", GoRev: "go1"}
+	s, err = loadRunState(stateFile, &m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.manifest().Platforms) != 0 {
+		t.Errorf("run of other revisions resumed %v", s.manifest().Platforms)
+	}
+}
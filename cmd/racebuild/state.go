@@ -0,0 +1,193 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// A Manifest records the race runtimes built by a racebuild run.
+// It's saved as the run progresses, so that a run that fails on some
+// platforms can be resumed without rebuilding the others, and it
+// summarizes the run once it's done.
+type Manifest struct {
+	LLVMRev  string
+	GoRev    string
+	GoGitOp  string `json:",omitempty"` // git operation applied to GoSrcRef, if any
+	GoSrcRef string `json:",omitempty"`
+
+	// Platforms is the result of each platform's build, by name.
+	Platforms map[string]*PlatformResult
+}
+
+// A PlatformResult is the result of building the race runtime for a
+// platform.
+type PlatformResult struct {
+	Name     string
+	GOOS     string
+	GOARCH   string
+	SubArch  string    `json:",omitempty"`
+	Syso     string    // relative to src/runtime/race
+	SHA256   string    `json:",omitempty"` // of the syso file, if it was built
+	Size     int64     `json:",omitempty"`
+	Error    string    `json:",omitempty"`
+	Finished time.Time // when the build finished or failed
+}
+
+// OK reports whether the build succeeded.
+func (r *PlatformResult) OK() bool { return r.Error == "" && r.SHA256 != "" }
+
+// sameRun reports whether m is for the same revisions as o, so that
+// the results of one stand for the other.
+func (m *Manifest) sameRun(o *Manifest) bool {
+	return m.LLVMRev == o.LLVMRev && m.GoRev == o.GoRev && m.GoGitOp == o.GoGitOp && m.GoSrcRef == o.GoSrcRef
+}
+
+// readManifest reads the manifest saved at file.
+func readManifest(file string) (*Manifest, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	m := new(Manifest)
+	if err := json.Unmarshal(b, m); err != nil {
+		return nil, fmt.Errorf("reading %s: %v", file, err)
+	}
+	return m, nil
+}
+
+// writeManifest saves m at file, replacing it atomically.
+func writeManifest(file string, m *Manifest) error {
+	b, err := json.MarshalIndent(m, "", "\t")
+	if err != nil {
+		return err
+	}
+	tmp := file + ".tmp"
+	if err := os.WriteFile(tmp, append(b, '\n'), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, file)
+}
+
+// A runState is the progress of this run, saved to a state file
+// after each platform's build.
+type runState struct {
+	file string // state file; empty to not save progress
+
+	mu sync.Mutex
+	m  *Manifest
+}
+
+// loadRunState returns the state of the run of m, resuming the run
+// saved at file if it was of the same revisions.
+func loadRunState(file string, m *Manifest) (*runState, error) {
+	if m.Platforms == nil {
+		m.Platforms = make(map[string]*PlatformResult)
+	}
+	s := &runState{file: file, m: m}
+	if file == "" {
+		return s, nil
+	}
+	saved, err := readManifest(file)
+	if os.IsNotExist(err) {
+		return s, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if !saved.sameRun(m) {
+		log.Printf("state file %s is of another run (LLVM %s, Go %s); starting over", file, saved.LLVMRev, saved.GoRev)
+		return s, nil
+	}
+	for name, r := range saved.Platforms {
+		m.Platforms[name] = r
+	}
+	return s, nil
+}
+
+// done reports whether p's race runtime was already built in this
+// run, and is still in place in goroot.
+func (s *runState) done(p *Platform, goroot string) bool {
+	s.mu.Lock()
+	r, ok := s.m.Platforms[p.Name()]
+	s.mu.Unlock()
+	if !ok || !r.OK() {
+		return false
+	}
+	sum, _, err := hashFile(filepath.Join(goroot, "src", "runtime", "race", r.Syso))
+	return err == nil && sum == r.SHA256
+}
+
+// record records the result of building p's race runtime into goroot,
+// saving the run's progress.
+func (s *runState) record(p *Platform, goroot string, buildErr error) error {
+	r := &PlatformResult{
+		Name:     p.Name(),
+		GOOS:     p.OS,
+		GOARCH:   p.Arch,
+		SubArch:  p.SubArch,
+		Syso:     p.Basename(),
+		Finished: time.Now().UTC(),
+	}
+	if buildErr != nil {
+		r.Error = buildErr.Error()
+	} else {
+		sum, size, err := hashFile(filepath.Join(goroot, "src", "runtime", "race", r.Syso))
+		if err != nil {
+			return err
+		}
+		r.SHA256, r.Size = sum, size
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.m.Platforms[r.Name] = r
+	if s.file == "" {
+		return nil
+	}
+	return writeManifest(s.file, s.m)
+}
+
+// manifest returns the manifest of the results of the run so far.
+func (s *runState) manifest() *Manifest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m := *s.m
+	m.Platforms = make(map[string]*PlatformResult, len(s.m.Platforms))
+	for name, r := range s.m.Platforms {
+		m.Platforms[name] = r
+	}
+	return &m
+}
+
+// summary returns a line describing the result of each platform in m.
+func (m *Manifest) summary() []string {
+	var lines []string
+	for _, r := range m.Platforms {
+		if r.OK() {
+			lines = append(lines, fmt.Sprintf("%s: ok: %s (%d bytes, sha256 %s)", r.Name, r.Syso, r.Size, r.SHA256))
+		} else {
+			lines = append(lines, fmt.Sprintf("%s: FAILED: %s", r.Name, r.Error))
+		}
+	}
+	sort.Strings(lines)
+	return lines
+}
+
+// hashFile returns the hex SHA-256 and size of file.
+func hashFile(file string) (string, int64, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return "", 0, err
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(b)), int64(len(b)), nil
+}
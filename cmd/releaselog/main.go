@@ -0,0 +1,154 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Releaselog verifies Go release files against the transparency log
+// of their checksums that relui appends to when it publishes them.
+//
+// Usage:
+//
+//	releaselog verify -log URL -key vkey [-state file] file...
+//	releaselog genkey name
+//
+// The verify command checks that each named file, such as a
+// downloaded go1.21.0.linux-amd64.tar.gz, has the size and SHA-256
+// checksum that the log served at URL records for its filename, and
+// that the log's checkpoint is signed by the verifier key vkey. With
+// -state, it also checks that the log only grew since the checkpoint
+// saved in the file by its previous run, so that a log that shows
+// different records to different users is detected.
+//
+// The genkey command prints a new signer key and verifier key for a
+// log named name, for relui's -release-log-key and -release-log-vkey
+// flags.
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/build/internal/releaselog"
+	"golang.org/x/mod/sumdb/note"
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: releaselog verify -log URL -key vkey [-state file] file...\n")
+	fmt.Fprintf(os.Stderr, "       releaselog genkey name\n")
+	os.Exit(2)
+}
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("releaselog: ")
+	if len(os.Args) < 2 {
+		usage()
+	}
+	switch os.Args[1] {
+	case "verify":
+		verify(os.Args[2:])
+	case "genkey":
+		if len(os.Args) != 3 {
+			usage()
+		}
+		skey, vkey, err := note.GenerateKey(rand.Reader, os.Args[2])
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("signer key:   %s\nverifier key: %s\n", skey, vkey)
+	default:
+		usage()
+	}
+}
+
+func verify(args []string) {
+	flags := flag.NewFlagSet("verify", flag.ExitOnError)
+	logURL := flags.String("log", "", "The base URL of the release log.")
+	vkey := flags.String("key", "", "The verifier key of the release log.")
+	state := flags.String("state", "", "If non-empty, a file to check the log's checkpoint against and save it to.")
+	flags.Usage = usage
+	flags.Parse(args)
+	if *logURL == "" || *vkey == "" || flags.NArg() == 0 {
+		usage()
+	}
+	verifier, err := note.NewVerifier(*vkey)
+	if err != nil {
+		log.Fatalf("bad -key: %v", err)
+	}
+
+	ctx := context.Background()
+	c := &releaselog.Client{URL: *logURL, Verifier: verifier}
+	tree, err := c.Checkpoint(ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *state != "" {
+		if err := checkState(ctx, c, *state, tree); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	failed := false
+	for _, file := range flags.Args() {
+		if err := verifyFile(ctx, c, tree, file); err != nil {
+			log.Print(err)
+			failed = true
+			continue
+		}
+		fmt.Printf("%s: ok\n", file)
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// checkState checks that tree is consistent with the tree saved in the
+// state file, if there is one, and saves tree to it.
+func checkState(ctx context.Context, c *releaselog.Client, state string, tree tlog.Tree) error {
+	data, err := os.ReadFile(state)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if err == nil {
+		old, err := tlog.ParseTree(data)
+		if err != nil {
+			return fmt.Errorf("%s: %v", state, err)
+		}
+		if err := c.CheckConsistency(ctx, old, tree); err != nil {
+			return err
+		}
+	}
+	return os.WriteFile(state, tlog.FormatTree(tree), 0666)
+}
+
+// verifyFile checks the size and checksum of file against its record
+// in tree.
+func verifyFile(ctx context.Context, c *releaselog.Client, tree tlog.Tree, file string) error {
+	r, err := c.Lookup(ctx, tree, filepath.Base(file))
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	h := sha256.New()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return err
+	}
+	if sum := fmt.Sprintf("%x", h.Sum(nil)); size != r.Size || sum != r.SHA256 {
+		return fmt.Errorf("%s: size %d and SHA-256 %s don't match the log's %d and %s for %s", file, size, sum, r.Size, r.SHA256, r.Version)
+	}
+	return nil
+}
@@ -4,6 +4,9 @@
 
 // The relnote command summarizes the Go changes in Gerrit marked with
 // RELNOTE annotations for the release notes.
+//
+// The "draft release notes" workflow in relui produces a similar
+// summary in Markdown, without needing a local Go checkout.
 package main
 
 import (
@@ -24,6 +27,7 @@ import (
 	"time"
 
 	"golang.org/x/build/gerrit"
+	"golang.org/x/build/internal/relnote"
 	"golang.org/x/build/maintner"
 	"golang.org/x/build/maintner/godata"
 	"golang.org/x/build/repos"
@@ -108,16 +112,11 @@ func main() {
 		log.Fatalf("cannot find Version in src/internal/goversion/goversion.go")
 	}
 	version := m[1]
-
-	// Releases are every 6 months. Walk forward by 6 month increments to next release.
-	cutoff := time.Date(2016, time.August, 1, 00, 00, 00, 0, time.UTC)
-	now := time.Now()
-	for cutoff.Before(now) {
-		cutoff = cutoff.AddDate(0, 6, 0)
+	x, err := strconv.Atoi(version)
+	if err != nil {
+		log.Fatal(err)
 	}
-
-	// Previous release was 6 months earlier.
-	cutoff = cutoff.AddDate(0, -6, 0)
+	cutoff := relnote.DevCycleStart(x)
 
 	// The maintner corpus doesn't track inline comments. See go.dev/issue/24863.
 	// So we need to use a Gerrit API client to fetch them instead. If maintner starts
@@ -268,25 +267,10 @@ func findCLsWithRelNote(client *gerrit.Client, since time.Time) (map[int]*gerrit
 	return m, nil
 }
 
-// packagePrefix returns the package prefix at the start of s.
-// For example packagePrefix("net/http: add HTTP 5 support") == "net/http".
-// If there's no package prefix, packagePrefix returns "".
-func packagePrefix(s string) string {
-	i := strings.Index(s, ":")
-	if i < 0 {
-		return ""
-	}
-	s = s[:i]
-	if strings.Trim(s, "abcdefghijklmnopqrstuvwxyz0123456789/") != "" {
-		return ""
-	}
-	return s
-}
-
 // clPackage returns the package import path from the CL's commit message,
 // or "??" if it's formatted unconventionally.
 func clPackage(cl *maintner.GerritCL) string {
-	pkg := packagePrefix(cl.Subject())
+	pkg := relnote.PackagePrefix(cl.Subject())
 	if pkg == "" {
 		return "??"
 	}
@@ -304,7 +288,7 @@ func clPackage(cl *maintner.GerritCL) string {
 func clRelNote(cl *maintner.GerritCL, comments map[string][]gerrit.CommentInfo) string {
 	msg := cl.Commit.Msg
 	if strings.Contains(msg, "RELNOTE") {
-		return parseRelNote(msg)
+		return relnote.ParseRelNote(msg)
 	}
 	// Since July 2020, Gerrit UI has replaced top-level comments
 	// with patchset-level inline comments, so don't bother looking
@@ -313,29 +297,17 @@ func clRelNote(cl *maintner.GerritCL, comments map[string][]gerrit.CommentInfo)
 	for _, cs := range comments {
 		for _, c := range cs {
 			if strings.Contains(c.Message, "RELNOTE") {
-				return parseRelNote(c.Message)
+				return relnote.ParseRelNote(c.Message)
 			}
 		}
 	}
 	return ""
 }
 
-// parseRelNote parses a RELNOTE annotation from the string s.
-// It returns the empty string if no such annotation exists.
-func parseRelNote(s string) string {
-	m := relNoteRx.FindStringSubmatch(s)
-	if m == nil {
-		return ""
-	}
-	return m[1]
-}
-
-var relNoteRx = regexp.MustCompile(`RELNOTES?=(.+)`)
-
 // issuePackage returns the package import path from the issue's title,
 // or "??" if it's formatted unconventionally.
 func issuePackage(issue *maintner.GitHubIssue) string {
-	pkg := packagePrefix(issue.Title)
+	pkg := relnote.PackagePrefix(issue.Title)
 	if pkg == "" {
 		return "??"
 	}
@@ -344,7 +316,7 @@ func issuePackage(issue *maintner.GitHubIssue) string {
 
 // issueSubject returns the issue's title with the package prefix removed.
 func issueSubject(issue *maintner.GitHubIssue) string {
-	pkg := packagePrefix(issue.Title)
+	pkg := relnote.PackagePrefix(issue.Title)
 	if pkg == "" {
 		return issue.Title
 	}
@@ -10,43 +10,61 @@ import (
 	"context"
 	"crypto/hmac"
 	"crypto/md5"
+	"crypto/tls"
 	"encoding/json"
 	"flag"
 	"fmt"
 	"io"
+	"io/fs"
 	"io/ioutil"
 	"log"
 	"math/rand"
 	"net/http"
 	"net/mail"
 	"net/url"
+	"strconv"
 	"strings"
 	"time"
 
 	cloudbuild "cloud.google.com/go/cloudbuild/apiv1/v2"
 	"cloud.google.com/go/compute/metadata"
+	"cloud.google.com/go/datastore"
 	"cloud.google.com/go/storage"
 	"github.com/google/go-github/github"
+	"github.com/google/uuid"
 	"github.com/jackc/pgx/v4/pgxpool"
 	"github.com/shurcooL/githubv4"
 	"go.opencensus.io/plugin/ochttp"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
 	"golang.org/x/build/buildlet"
 	"golang.org/x/build/gerrit"
 	"golang.org/x/build/internal/access"
+	"golang.org/x/build/internal/cleanup"
+	"golang.org/x/build/internal/featureflag"
+	"golang.org/x/build/internal/gcsfs"
 	gomotepb "golang.org/x/build/internal/gomote/protos"
 	"golang.org/x/build/internal/https"
 	"golang.org/x/build/internal/iapclient"
 	"golang.org/x/build/internal/metrics"
+	"golang.org/x/build/internal/releaselog"
 	"golang.org/x/build/internal/relui"
 	"golang.org/x/build/internal/relui/db"
 	"golang.org/x/build/internal/relui/protos"
 	"golang.org/x/build/internal/relui/sign"
 	"golang.org/x/build/internal/secret"
+	"golang.org/x/build/internal/sourcecache"
 	"golang.org/x/build/internal/task"
+	"golang.org/x/build/maintner/maintnerd/apipb"
 	"golang.org/x/build/repos"
+	"golang.org/x/mod/sumdb/note"
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
+	"google.golang.org/api/cloudidentity/v1"
+	"google.golang.org/api/option"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 )
 
 var (
@@ -58,10 +76,26 @@ var (
 	migrateOnly = flag.Bool("migrate-only", false, "Exit after running migrations. Migrations are run by default.")
 	pgConnect   = flag.String("pg-connect", "", "Postgres connection string or URI. If empty, libpq connection defaults are used.")
 
-	scratchFilesBase = flag.String("scratch-files-base", "", "Storage for scratch files. gs://bucket/path or file:///path/to/scratch.")
-	servingFilesBase = flag.String("serving-files-base", "", "Storage for serving files. gs://bucket/path or file:///path/to/serving.")
-	edgeCacheURL     = flag.String("edge-cache-url", "", "URL release files appear at when published to the CDN, e.g. https://dl.google.com/go.")
-	websiteUploadURL = flag.String("website-upload-url", "", "URL to POST website file data to, e.g. https://go.dev/dl/upload.")
+	scratchFilesBase  = flag.String("scratch-files-base", "", "Storage for scratch files. gs://bucket/path or file:///path/to/scratch.")
+	servingFilesBase  = flag.String("serving-files-base", "", "Storage for serving files. gs://bucket/path or file:///path/to/serving.")
+	edgeCacheURL      = flag.String("edge-cache-url", "", "URL release files appear at when published to the CDN, e.g. https://dl.google.com/go.")
+	websiteUploadURL  = flag.String("website-upload-url", "", "URL to POST website file data to, e.g. https://go.dev/dl/upload.")
+	scratchMaxAge     = flag.Duration("scratch-max-age", 0, "If positive, periodically delete scratch files older than this. Must exceed the lifetime of any workflow.")
+	scratchDryRun     = flag.Bool("scratch-cleanup-dry-run", false, "Only log the scratch files that -scratch-max-age would delete.")
+	taskSubprocesses  = flag.Bool("task-subprocesses", false, "Run workflow tasks in subprocesses, so that a misbehaving task can't take down relui.")
+	taskMemoryLimitMB = flag.Int64("task-memory-limit-mb", 0, "With -task-subprocesses, the maximum heap memory in MiB a task may use before it's stopped. 0 means no limit.")
+	sourceCacheBase   = flag.String("source-cache-base", "", "If non-empty, storage to cache source tarballs in, shared with the coordinator. gs://bucket/path or file:///path/to/cache. Relui only writes to it: since the coordinator can write to it too, release sources are always fetched from Gerrit.")
+	releaseStatusBase = flag.String("release-status-base", "", "If non-empty, storage to periodically publish release-status.json to, for the build dashboard and devapp. gs://bucket/path or file:///path/to/status.")
+	releaseLogBase    = flag.String("release-log-base", "", "If non-empty, storage for the transparency log of the checksums of published release files, served publicly over HTTP. gs://bucket/path or file:///path/to/log. Requires -release-log-key.")
+	releaseLogVKey    = flag.String("release-log-vkey", "", "The verifier key of the -release-log-base log's checkpoints, as generated by the releaselog command.")
+
+	recordWorkflow = flag.String("record-workflow", "", "If non-empty, the ID of a workflow to print a recording of, as JSON for workflowtest.Replay, before exiting.")
+
+	featureFlagsProject = flag.String("feature-flags-project", "", "If non-empty, the GCP project whose datastore holds the build infrastructure's feature flags, to evaluate and edit at /flags.")
+
+	otlpEndpoint      = flag.String("otlp-endpoint", "", "If non-empty, the OTLP/HTTP endpoint of an OpenTelemetry collector to export workflow runs to as traces, e.g. http://otel-collector:4318.")
+	otlpServiceName   = flag.String("otlp-service-name", "relui", "The service name of the traces exported to -otlp-endpoint.")
+	otlpFlushInterval = flag.Duration("otlp-flush-interval", 10*time.Second, "How often to send finished spans to -otlp-endpoint.")
 )
 
 func main() {
@@ -69,7 +103,7 @@ func main() {
 	if err := secret.InitFlagSupport(context.Background()); err != nil {
 		log.Fatalln(err)
 	}
-	sendgridAPIKey := secret.Flag("sendgrid-api-key", "SendGrid API key for workflows involving sending email.")
+	sendgridAPIKey := secret.WatchedFlag("sendgrid-api-key", "SendGrid API key for workflows involving sending email.")
 	var annMail task.MailHeader
 	addressVarFlag(&annMail.From, "announce-mail-from", "The From address to use for the (pre-)announcement mail.")
 	addressVarFlag(&annMail.To, "announce-mail-to", "The To address to use for the (pre-)announcement mail.")
@@ -80,12 +114,35 @@ func main() {
 	addressListVarFlag(&schedMail.BCC, "schedule-mail-bcc", "The BCC address list to use for the scheduled workflow failure mail.")
 	var twitterAPI secret.TwitterCredentials
 	secret.JSONVarFlag(&twitterAPI, "twitter-api-secret", "Twitter API secret to use for workflows involving tweeting.")
+	namespaceMembers := make(map[string][]string)
+	membersVarFlag(namespaceMembers, "namespace-members", "A namespace and the comma-separated email addresses of the users allowed to act on its workflows, as name=email,... May be repeated. Namespaces without members are open to all users.")
+	namespaceGroups := make(map[string][]string)
+	membersVarFlag(namespaceGroups, "namespace-groups", "A namespace and the comma-separated email addresses of the Google Groups whose members are allowed to act on its workflows, as name=email,... May be repeated. Membership is synced every -group-sync-interval.")
+	groupSyncInterval := flag.Duration("group-sync-interval", 10*time.Minute, "How often to sync the membership of -namespace-groups.")
+	resourceLimits := map[string]int{relui.MacOSSignerResource: 1, relui.WindowsSignerResource: 1}
+	limitVarFlag(resourceLimits, "resource-limit", "A resource and the maximum number of tasks that may use it at once, as name=n. May be repeated. A limit of 0 removes it. The macOS and Windows signers default to 1.")
+	releaseLogKey := secret.Flag("release-log-key", "The signer key of the -release-log-base log's checkpoints.")
 	masterKey := secret.Flag("builder-master-key", "Builder master key")
-	githubToken := secret.Flag("github-token", "GitHub API token")
+	githubToken := secret.WatchedFlag("github-token", "GitHub API token")
+	secretCheckInterval := flag.Duration("secret-check-interval", 10*time.Minute, "How often to check the secrets of -sendgrid-api-key and -github-token for rotations.")
 	https.RegisterFlags(flag.CommandLine)
 	flag.Parse()
 
 	ctx := context.Background()
+	df := &definitionFlags{
+		annMail:        annMail,
+		twitterAPI:     twitterAPI,
+		sendgridAPIKey: sendgridAPIKey,
+		githubToken:    githubToken,
+		masterKey:      *masterKey,
+	}
+	if relui.IsTaskWorker() {
+		if err := serveTask(ctx, df); err != nil {
+			log.Fatalf("serveTask() = %v", err)
+		}
+		return
+	}
+
 	if err := relui.InitDB(ctx, *pgConnect); err != nil {
 		log.Fatalf("relui.InitDB() = %v", err)
 	}
@@ -98,6 +155,14 @@ func main() {
 		}
 		return
 	}
+	if *recordWorkflow != "" {
+		if err := printRecording(ctx, *recordWorkflow); err != nil {
+			log.Fatalf("printRecording() = %v", err)
+		}
+		return
+	}
+
+	defer startTracing(ctx)()
 
 	// Define the site header and external service configuration.
 	// The site header communicates to humans what will happen
@@ -107,46 +172,19 @@ func main() {
 		Title:    *siteTitle,
 		CSSClass: *siteHeaderCSS,
 	}
-	creds, err := google.FindDefaultCredentials(ctx, gerrit.OAuth2Scopes...)
-	if err != nil {
-		log.Fatalf("reading GCP credentials: %v", err)
-	}
-	gerritClient := &task.RealGerritClient{
-		Client: gerrit.NewClient("https://go-review.googlesource.com", gerrit.OAuth2Auth(creds.TokenSource)),
-	}
-	mailFunc := task.NewSendGridMailClient(*sendgridAPIKey).SendMail
-	commTasks := task.CommunicationTasks{
-		AnnounceMailTasks: task.AnnounceMailTasks{
-			SendMail:           mailFunc,
-			AnnounceMailHeader: annMail,
-		},
-		TweetTasks: task.TweetTasks{
-			TwitterClient: task.NewTwitterClient(twitterAPI),
-		},
-	}
-	dh := relui.NewDefinitionHolder()
-	userPassAuth := buildlet.UserPass{
-		Username: "user-relui",
-		Password: key(*masterKey, "user-relui"),
+	for _, v := range []*secret.Value{sendgridAPIKey, githubToken} {
+		if err := v.Watch(ctx, *secretCheckInterval); err != nil {
+			log.Fatalf("watching secret: %v", err)
+		}
 	}
-	cc, err := iapclient.GRPCClient(ctx, "build.golang.org:443")
+	svcs, err := newWorkflowServices(ctx, df)
 	if err != nil {
-		log.Fatalf("Could not connect to coordinator: %v", err)
-	}
-	coordinator := &buildlet.GRPCCoordinatorClient{
-		Client: gomotepb.NewGomoteServiceClient(cc),
+		log.Fatal(err)
 	}
-	if _, err := coordinator.Client.Authenticate(ctx, &gomotepb.AuthenticateRequest{}); err != nil {
+	if _, err := svcs.coordinator.Client.Authenticate(ctx, &gomotepb.AuthenticateRequest{}); err != nil {
 		log.Fatalf("Broken coordinator client: %v", err)
 	}
-	gcsClient, err := storage.NewClient(ctx)
-	if err != nil {
-		log.Fatalf("Could not connect to GCS: %v", err)
-	}
-	cloudbuildClient, err := cloudbuild.NewClient(ctx)
-	if err != nil {
-		log.Fatalf("Could not connect to Cloud Build: %v", err)
-	}
+	gcsClient := svcs.gcs
 	var dbPool db.PGDBTX
 	dbPool, err = pgxpool.Connect(ctx, *pgConnect)
 	if err != nil {
@@ -154,6 +192,7 @@ func main() {
 	}
 	defer dbPool.Close()
 	dbPool = &relui.MetricsDB{dbPool}
+	svcs.db = dbPool
 
 	var gr *metrics.MonitoredResource
 	if metadata.OnGCE() {
@@ -162,7 +201,8 @@ func main() {
 			log.Println("metrics.GKEResource:", err)
 		}
 	}
-	ms, err := metrics.NewService(gr, relui.Views)
+	views := append(append(relui.Views, cleanup.Views...), sourcecache.Views...)
+	ms, err := metrics.NewService(gr, views)
 	if err != nil {
 		log.Println("failed to initialize metrics:", err)
 	} else {
@@ -172,45 +212,265 @@ func main() {
 		grpc.StreamInterceptor(access.RequireIAPAuthStreamInterceptor(access.IAPSkipAudienceValidation)))
 	signServer := sign.NewServer()
 	protos.RegisterReleaseServiceServer(grpcServer, signServer)
+	svcs.sign = signServer
+
+	dh := relui.NewDefinitionHolder()
+	for _, ns := range []relui.Namespace{
+		{Name: relui.ReleaseNamespace, Title: "Go Releases"},
+		{Name: relui.XReposNamespace, Title: "x/ Repo Tagging"},
+		{Name: relui.InfraNamespace, Title: "Infrastructure"},
+		{Name: relui.DefaultNamespace, Title: "Other"},
+	} {
+		ns.Members = namespaceMembers[ns.Name]
+		ns.Groups = namespaceGroups[ns.Name]
+		dh.RegisterNamespace(ns)
+	}
+	buildTasks, err := registerDefinitions(ctx, dh, df, svcs)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *releaseLogBase != "" {
+		l, err := newReleaseLog(ctx, gcsClient, *releaseLogBase, *releaseLogKey, *releaseLogVKey)
+		if err != nil {
+			log.Fatalf("newReleaseLog: %v", err)
+		}
+		buildTasks.LogFiles = func(ctx context.Context, files []task.WebsiteFile) error {
+			var recs []releaselog.Record
+			for _, f := range files {
+				recs = append(recs, releaselog.Record{Filename: f.Filename, Version: f.Version, Size: f.Size, SHA256: f.ChecksumSHA256})
+			}
+			return l.Append(ctx, recs)
+		}
+	}
+
+	if len(namespaceGroups) != 0 {
+		identityService, err := cloudidentity.NewService(ctx, option.WithScopes(cloudidentity.CloudIdentityGroupsReadonlyScope))
+		if err != nil {
+			log.Fatalf("cloudidentity.NewService: %v", err)
+		}
+		gs := &relui.GroupSyncer{Holder: dh, Lister: &relui.CloudIdentityGroups{Service: identityService}}
+		go gs.Run(ctx, *groupSyncInterval)
+	}
+
+	var base *url.URL
+	if *baseURL != "" {
+		base, err = url.Parse(*baseURL)
+		if err != nil {
+			log.Fatalf("url.Parse(%q) = %v, %v", *baseURL, base, err)
+		}
+	}
+	var l relui.Listener = &relui.PGListener{
+		DB:                        dbPool,
+		BaseURL:                   base,
+		ScheduleFailureMailHeader: schedMail,
+		SendMail:                  svcs.mail,
+	}
+	if *otlpEndpoint != "" {
+		l = relui.NewTracingListener(l, otel.GetTracerProvider())
+	}
+	w := relui.NewWorker(dh, dbPool, l)
+	for name, limit := range resourceLimits {
+		w.Resources().SetLimit(name, limit)
+	}
+	if *taskSubprocesses {
+		w.SetSubprocessExecutor(&relui.SubprocessExecutor{MemoryLimit: *taskMemoryLimitMB << 20})
+	}
+	var flagStore featureflag.Store
+	var flags *featureflag.Set
+	if *featureFlagsProject != "" {
+		dsClient, err := datastore.NewClient(ctx, *featureFlagsProject)
+		if err != nil {
+			log.Fatalf("datastore.NewClient(%q) = %v", *featureFlagsProject, err)
+		}
+		flagStore = &featureflag.DatastoreStore{Client: dsClient}
+		flags = featureflag.NewSet(flagStore)
+		go flags.Run(ctx, time.Minute)
+		w.SetFeatureFlags(flags)
+	}
+	go w.Run(ctx)
+	if *releaseStatusBase != "" {
+		statusFS, err := gcsfs.FromURL(ctx, gcsClient, *releaseStatusBase)
+		if err != nil {
+			log.Fatalf("gcsfs.FromURL(%q) = %v", *releaseStatusBase, err)
+		}
+		sp := &relui.StatusPublisher{DB: dbPool, BaseURL: base, FS: statusFS}
+		go sp.Run(ctx, time.Minute)
+	}
+	if *scratchMaxAge > 0 {
+		scratchFS, err := gcsfs.FromURL(ctx, gcsClient, *scratchFilesBase)
+		if err != nil {
+			log.Fatalf("gcsfs.FromURL(%q) = %v", *scratchFilesBase, err)
+		}
+		go cleanupScratchLoop(ctx, scratchFS, cleanup.Policy{MaxAge: *scratchMaxAge, DryRun: *scratchDryRun})
+	}
+	if err := w.ResumeAll(ctx); err != nil {
+		log.Printf("w.ResumeAll() = %v", err)
+	}
+	s := relui.NewServer(dbPool, w, base, siteHeader, ms)
+	if flagStore != nil {
+		s.HandleFeatureFlags(flagStore, flags)
+	}
+	var h http.Handler = s
+	if metadata.OnGCE() {
+		project, err := metadata.ProjectID()
+		if err != nil {
+			log.Fatal("failed to read project ID from metadata server")
+		}
+		if project == "symbolic-datum-552" {
+			h = access.RequireIAPAuthHandler(h, access.IAPSkipAudienceValidation)
+		}
+	}
+	if err := https.ListenAndServe(ctx, &ochttp.Handler{Handler: GRPCHandler(grpcServer, h)}); err != nil {
+		log.Fatalln(err)
+	}
+}
+
+// definitionFlags are the flags that configure the workflow
+// definitions, which task workers build too.
+type definitionFlags struct {
+	annMail        task.MailHeader
+	twitterAPI     secret.TwitterCredentials
+	sendgridAPIKey *secret.Value
+	githubToken    *secret.Value
+	masterKey      string
+}
+
+// workflowServices are the clients of the services that the tasks of
+// the workflow definitions use.
+type workflowServices struct {
+	gerrit      *task.RealGerritClient
+	gerritHTTP  *http.Client
+	github      *http.Client
+	coordinator *buildlet.GRPCCoordinatorClient
+	gcs         *storage.Client
+	cloudBuild  *cloudbuild.Client
+	maintner    apipb.MaintnerServiceClient
+	mail        func(task.MailHeader, task.MailContent) error
+
+	// db and sign are set by the caller of newWorkflowServices.
+	// Task workers leave sign nil, since signing tasks run in the
+	// server's process.
+	db   db.PGDBTX
+	sign sign.Service
+}
+
+// newWorkflowServices creates the clients of the services that
+// workflows use. It doesn't call any of them.
+func newWorkflowServices(ctx context.Context, df *definitionFlags) (*workflowServices, error) {
+	creds, err := google.FindDefaultCredentials(ctx, gerrit.OAuth2Scopes...)
+	if err != nil {
+		return nil, fmt.Errorf("reading GCP credentials: %v", err)
+	}
+	s := &workflowServices{
+		gerrit: &task.RealGerritClient{
+			Client: gerrit.NewClient("https://go-review.googlesource.com", gerrit.OAuth2Auth(creds.TokenSource)),
+		},
+		gerritHTTP: oauth2.NewClient(ctx, creds.TokenSource),
+		// Not oauth2.NewClient, which would reuse the first token forever.
+		github: &http.Client{Transport: &oauth2.Transport{Source: secretTokenSource{df.githubToken}}},
+		mail: func(h task.MailHeader, m task.MailContent) error {
+			return task.NewSendGridMailClient(df.sendgridAPIKey.Get()).SendMail(h, m)
+		},
+	}
+	cc, err := iapclient.GRPCClient(ctx, "build.golang.org:443", iapclient.GRPCDialOptions(
+		grpc.WithUnaryInterceptor(otelgrpc.UnaryClientInterceptor()),
+		grpc.WithStreamInterceptor(otelgrpc.StreamClientInterceptor()),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("could not connect to coordinator: %v", err)
+	}
+	s.coordinator = &buildlet.GRPCCoordinatorClient{
+		Client: gomotepb.NewGomoteServiceClient(cc),
+	}
+	if s.gcs, err = storage.NewClient(ctx); err != nil {
+		return nil, fmt.Errorf("could not connect to GCS: %v", err)
+	}
+	if s.cloudBuild, err = cloudbuild.NewClient(ctx); err != nil {
+		return nil, fmt.Errorf("could not connect to Cloud Build: %v", err)
+	}
+	maintnerConn, err := grpc.Dial("maintner.golang.org:443", grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{NextProtos: []string{"h2"}})))
+	if err != nil {
+		return nil, fmt.Errorf("dialing maintner: %v", err)
+	}
+	s.maintner = apipb.NewMaintnerServiceClient(maintnerConn)
+	return s, nil
+}
+
+// registerDefinitions registers the workflow definitions in dh, using
+// the services of s. It returns the build tasks, for the server to
+// finish configuring.
+func registerDefinitions(ctx context.Context, dh *relui.DefinitionHolder, df *definitionFlags, s *workflowServices) (*relui.BuildReleaseTasks, error) {
+	commTasks := task.CommunicationTasks{
+		AnnounceMailTasks: task.AnnounceMailTasks{
+			SendMail:           s.mail,
+			AnnounceMailHeader: df.annMail,
+		},
+		TweetTasks: task.TweetTasks{
+			TwitterClient: task.NewTwitterClient(df.twitterAPI),
+		},
+	}
+	userPassAuth := buildlet.UserPass{
+		Username: "user-relui",
+		Password: key(df.masterKey, "user-relui"),
+	}
+	sourceCacheOpts := sourcecache.Options{
+		// Source tarballs of the main repo are large, and releases
+		// only need a few revisions of it at a time.
+		MemoryEntries: 4,
+		Origins:       []sourcecache.Origin{sourcecache.GerritOrigin(s.gerritHTTP, "https://go.googlesource.com")},
+	}
+	if *sourceCacheBase != "" {
+		store, err := sourcecache.NewStore(ctx, s.gcs, *sourceCacheBase)
+		if err != nil {
+			return nil, fmt.Errorf("sourcecache.NewStore(%q) = %v", *sourceCacheBase, err)
+		}
+		// The coordinator can write to the store too, so relui
+		// doesn't trust its tarballs.
+		store.WriteOnly = true
+		sourceCacheOpts.Stores = []sourcecache.Store{store}
+	}
 	buildTasks := &relui.BuildReleaseTasks{
-		GerritClient:             gerritClient,
-		GerritHTTPClient:         oauth2.NewClient(ctx, creds.TokenSource),
+		Services: task.Services{
+			Gerrit:     s.gerrit,
+			Storage:    task.GCSStorage(s.gcs),
+			Sign:       s.sign,
+			CloudBuild: &task.RealCloudBuildClient{Client: s.cloudBuild},
+		},
+		GerritHTTPClient:         s.gerritHTTP,
 		GerritURL:                "https://go.googlesource.com/go",
 		PrivateGerritURL:         "https://team.googlesource.com/golang/go-private",
-		CreateBuildlet:           coordinator.CreateBuildlet,
-		SignService:              signServer,
-		GCSClient:                gcsClient,
+		SourceCache:              sourcecache.New(sourceCacheOpts),
+		CreateBuildlet:           s.coordinator.CreateBuildlet,
+		CheckSigned:              sign.CheckSignedStructure,
 		ScratchURL:               *scratchFilesBase,
 		ServingURL:               *servingFilesBase,
 		DownloadURL:              *edgeCacheURL,
 		ProxyPrefix:              "https://proxy.golang.org/golang.org/toolchain/@v",
-		CloudBuildClient:         &task.RealCloudBuildClient{Client: cloudbuildClient},
 		GoogleDockerBuildProject: "symbolic-datum-552",
 		GoogleDockerBuildTrigger: "golang-publish-internal-boringcrypto",
 		PublishFile: func(f task.WebsiteFile) error {
 			return publishFile(*websiteUploadURL, userPassAuth, f)
 		},
-		ApproveAction: relui.ApproveActionDep(dbPool),
+		ApproveAction: relui.ApproveActionDep(s.db),
 	}
-	githubHTTPClient := oauth2.NewClient(ctx, oauth2.StaticTokenSource(&oauth2.Token{AccessToken: *githubToken}))
 	milestoneTasks := &task.MilestoneTasks{
 		Client: &task.GitHubClient{
-			V3: github.NewClient(githubHTTPClient),
-			V4: githubv4.NewClient(githubHTTPClient),
+			V3: github.NewClient(s.github),
+			V4: githubv4.NewClient(s.github),
 		},
 		RepoOwner:     "golang",
 		RepoName:      "go",
-		ApproveAction: relui.ApproveActionDep(dbPool),
+		ApproveAction: relui.ApproveActionDep(s.db),
 	}
 	versionTasks := &task.VersionTasks{
-		Gerrit:           gerritClient,
+		Gerrit:           s.gerrit,
 		GerritURL:        "https://go.googlesource.com",
 		GoProject:        "go",
-		CreateBuildlet:   coordinator.CreateBuildlet,
+		CreateBuildlet:   s.coordinator.CreateBuildlet,
 		LatestGoBinaries: task.LatestGoBinaries,
 	}
 	if err := relui.RegisterReleaseWorkflows(ctx, dh, buildTasks, milestoneTasks, versionTasks, commTasks); err != nil {
-		log.Fatalf("RegisterReleaseWorkflows: %v", err)
+		return nil, fmt.Errorf("RegisterReleaseWorkflows: %v", err)
 	}
 
 	ignoreProjects := map[string]bool{}
@@ -220,52 +480,130 @@ func main() {
 	ignoreProjects["vuln"] = true // x/vuln only has manual tagging for now. See issue 59686.
 	tagTasks := &task.TagXReposTasks{
 		IgnoreProjects:   ignoreProjects,
-		Gerrit:           gerritClient,
+		Gerrit:           s.gerrit,
 		GerritURL:        "https://go.googlesource.com",
-		CreateBuildlet:   coordinator.CreateBuildlet,
+		CreateBuildlet:   s.coordinator.CreateBuildlet,
 		LatestGoBinaries: task.LatestGoBinaries,
 		DashboardURL:     "https://build.golang.org",
+		ApproveAction:    relui.ApproveActionDep(s.db),
 	}
-	dh.RegisterDefinition("Tag x/ repos", tagTasks.NewDefinition())
-	dh.RegisterDefinition("Tag a single x/ repo", tagTasks.NewSingleDefinition())
+	dh.RegisterNamespacedDefinition(relui.XReposNamespace, "Tag x/ repos", tagTasks.NewDefinition())
+	dh.RegisterNamespacedDefinition(relui.XReposNamespace, "Tag a single x/ repo", tagTasks.NewSingleDefinition())
 
 	bundleTasks := &task.BundleNSSRootsTask{
-		Gerrit:           gerritClient,
+		Gerrit:           s.gerrit,
 		GerritURL:        "https://go.googlesource.com",
-		CreateBuildlet:   coordinator.CreateBuildlet,
+		CreateBuildlet:   s.coordinator.CreateBuildlet,
 		LatestGoBinaries: task.LatestGoBinaries,
 	}
-	dh.RegisterDefinition("Update x/crypto NSS root bundle", bundleTasks.NewDefinition())
+	dh.RegisterNamespacedDefinition(relui.InfraNamespace, "Update x/crypto NSS root bundle", bundleTasks.NewDefinition())
 
-	var base *url.URL
-	if *baseURL != "" {
-		base, err = url.Parse(*baseURL)
-		if err != nil {
-			log.Fatalf("url.Parse(%q) = %v, %v", *baseURL, base, err)
-		}
+	bootstrapTasks := &task.BootstrapTasks{
+		Services:         task.Services{Storage: task.GCSStorage(s.gcs)},
+		GerritURL:        "https://go.googlesource.com",
+		CreateBuildlet:   s.coordinator.CreateBuildlet,
+		LatestGoBinaries: task.LatestGoBinaries,
+		OutputURL:        "gs://go-builder-data",
+		DownloadURL:      "https://storage.googleapis.com/go-builder-data",
 	}
-	l := &relui.PGListener{
-		DB:                        dbPool,
-		BaseURL:                   base,
-		ScheduleFailureMailHeader: schedMail,
-		SendMail:                  mailFunc,
+	dh.RegisterNamespacedDefinition(relui.InfraNamespace, "Build bootstrap toolchains", bootstrapTasks.NewDefinition())
+
+	onboardTasks := &task.OnboardRepoTasks{
+		Gerrit: s.gerrit,
+		GitHub: &task.GitHubClient{
+			V3: github.NewClient(s.github),
+			V4: githubv4.NewClient(s.github),
+		},
+		GitHubOrg:    "golang",
+		BuildProject: "build",
+		DashboardURL: "https://build.golang.org",
+		Maintner:     s.maintner,
 	}
-	w := relui.NewWorker(dh, dbPool, l)
-	go w.Run(ctx)
-	if err := w.ResumeAll(ctx); err != nil {
-		log.Printf("w.ResumeAll() = %v", err)
+	dh.RegisterNamespacedDefinition(relui.XReposNamespace, "Onboard a new x/ repo", onboardTasks.NewDefinition())
+
+	releaseNotesTasks := &task.ReleaseNotesTasks{
+		Gerrit:          s.gerrit.Client,
+		GoProject:       "go",
+		GetDevelVersion: versionTasks.GetDevelVersion,
 	}
-	var h http.Handler = relui.NewServer(dbPool, w, base, siteHeader, ms)
-	if metadata.OnGCE() {
-		project, err := metadata.ProjectID()
-		if err != nil {
-			log.Fatal("failed to read project ID from metadata server")
-		}
-		if project == "symbolic-datum-552" {
-			h = access.RequireIAPAuthHandler(h, access.IAPSkipAudienceValidation)
+	dh.RegisterNamespacedDefinition(relui.ReleaseNamespace, "draft release notes for the development version", releaseNotesTasks.NewDefinition())
+	return buildTasks, nil
+}
+
+// serveTask runs the task that the relui server sent to this task
+// worker. The server runs task workers with its own flags, and has
+// already set up the database. Task workers build the workflow
+// definitions and the clients their tasks use, but nothing else the
+// server needs: they don't watch secrets, export metrics, or serve
+// anything, and tasks that depend on the server's state, like signing
+// and publishing, run in the server.
+func serveTask(ctx context.Context, df *definitionFlags) error {
+	defer startTracing(ctx)()
+	s, err := newWorkflowServices(ctx, df)
+	if err != nil {
+		return err
+	}
+	// Only tasks that wait for approval use the database.
+	cfg, err := pgxpool.ParseConfig(*pgConnect)
+	if err != nil {
+		return err
+	}
+	cfg.LazyConnect = true
+	pool, err := pgxpool.ConnectConfig(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer pool.Close()
+	s.db = pool
+	dh := relui.NewDefinitionHolder()
+	if _, err := registerDefinitions(ctx, dh, df, s); err != nil {
+		return err
+	}
+	return relui.ServeTask(ctx, dh)
+}
+
+// startTracing sets up the export of traces to -otlp-endpoint, if set,
+// and returns a function that exports the last spans. Task workers
+// export the spans of their calls too, which the propagated trace
+// context puts in the trace of their task.
+func startTracing(ctx context.Context) (shutdown func()) {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	if *otlpEndpoint == "" {
+		return func() {}
+	}
+	tp, err := relui.NewTracerProvider(ctx, *otlpEndpoint, *otlpServiceName, *otlpFlushInterval)
+	if err != nil {
+		log.Fatalf("relui.NewTracerProvider() = %v", err)
+	}
+	otel.SetTracerProvider(tp)
+	return func() {
+		ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		defer cancel()
+		if err := tp.Shutdown(ctx); err != nil {
+			log.Printf("Shutting down tracing: %v", err)
 		}
 	}
-	log.Fatalln(https.ListenAndServe(ctx, &ochttp.Handler{Handler: GRPCHandler(grpcServer, h)}))
+}
+
+// newReleaseLog returns the release log stored at baseURL, whose
+// checkpoints are signed with skey and verified with vkey.
+func newReleaseLog(ctx context.Context, gcsClient *storage.Client, baseURL, skey, vkey string) (*releaselog.Log, error) {
+	fsys, err := gcsfs.FromURL(ctx, gcsClient, baseURL)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := note.NewSigner(skey)
+	if err != nil {
+		return nil, fmt.Errorf("bad -release-log-key: %v", err)
+	}
+	verifier, err := note.NewVerifier(vkey)
+	if err != nil {
+		return nil, fmt.Errorf("bad -release-log-vkey: %v", err)
+	}
+	if signer.Name() != verifier.Name() || signer.KeyHash() != verifier.KeyHash() {
+		return nil, fmt.Errorf("-release-log-key and -release-log-vkey aren't a key pair")
+	}
+	return &releaselog.Log{FS: fsys, Signer: signer, Verifier: verifier}, nil
 }
 
 // GRPCHandler creates handler which intercepts requests intended for a GRPC server and directs the calls to the server.
@@ -339,3 +677,95 @@ func addressListVarFlag(p *[]mail.Address, name, usage string) {
 		return nil
 	})
 }
+
+// membersVarFlag defines a repeatable flag with specified name and usage string
+// whose values have the form name=email,email,....
+// The email addresses are stored in m under the name.
+func membersVarFlag(m map[string][]string, name, usage string) {
+	flag.Func(name, usage, func(s string) error {
+		ns, list, ok := strings.Cut(s, "=")
+		if !ok || ns == "" {
+			return fmt.Errorf("%q is not of the form name=email,...", s)
+		}
+		as, err := mail.ParseAddressList(list)
+		if err != nil {
+			return err
+		}
+		for _, a := range as {
+			m[ns] = append(m[ns], a.Address)
+		}
+		return nil
+	})
+}
+
+// limitVarFlag defines a repeatable flag with specified name and usage
+// string that sets the limit of a named resource in m.
+func limitVarFlag(m map[string]int, name, usage string) {
+	flag.Func(name, usage, func(s string) error {
+		resource, limit, ok := strings.Cut(s, "=")
+		if !ok || resource == "" {
+			return fmt.Errorf("%q is not of the form name=n", s)
+		}
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 0 {
+			return fmt.Errorf("limit of %q must be a non-negative integer, got %q", resource, limit)
+		}
+		m[resource] = n
+		return nil
+	})
+}
+
+// cleanupScratchLoop deletes stale scratch files once a day until ctx
+// is done.
+func cleanupScratchLoop(ctx context.Context, fsys fs.FS, p cleanup.Policy) {
+	t := time.NewTicker(24 * time.Hour)
+	defer t.Stop()
+	for {
+		r, err := cleanup.ScratchFiles(ctx, fsys, *scratchFilesBase, p)
+		if err != nil {
+			log.Printf("cleanup.ScratchFiles() = %v", err)
+		}
+		if r != nil {
+			log.Println(r)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// printRecording prints a recording of the workflow with the given ID
+// to stdout.
+func printRecording(ctx context.Context, id string) error {
+	wfID, err := uuid.Parse(id)
+	if err != nil {
+		return err
+	}
+	p, err := pgxpool.Connect(ctx, *pgConnect)
+	if err != nil {
+		return err
+	}
+	defer p.Close()
+	rec, err := relui.WorkflowRecording(ctx, p, wfID)
+	if err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(rec, "", "\t")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Printf("%s\n", b)
+	return err
+}
+
+// secretTokenSource is an oauth2.TokenSource of the current value of a
+// secret flag, so that requests use a rotated token right away.
+type secretTokenSource struct {
+	v *secret.Value
+}
+
+func (s secretTokenSource) Token() (*oauth2.Token, error) {
+	return &oauth2.Token{AccessToken: s.v.Get()}, nil
+}
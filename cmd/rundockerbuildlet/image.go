@@ -0,0 +1,191 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Containers are always run from an image reference pinned to a
+// digest, such as golang/builder@sha256:..., so that all containers
+// run the same image and a new image is only used once it's fully
+// pulled and, with --verify-key, verified. With --pull, a new version
+// of --image is prefetched every --pull-interval, and containers are
+// switched to it. If too many of its containers then fail, they're
+// switched back to the previous image.
+
+// imageTracker tracks the images that containers are run from.
+type imageTracker struct {
+	image string // as given by --image; may be a tag or pinned
+
+	current  string // pinned reference of the image to run; empty until resolved
+	previous string // pinned reference of the image before current, if any
+
+	switched  time.Time       // when current replaced previous
+	failures  int             // of containers of current since switched
+	bad       map[string]bool // pinned references that were rolled back
+	lastCheck time.Time       // of --image for a new version
+}
+
+// needsCheck reports whether the tracker should check for a new
+// version of its image.
+func (t *imageTracker) needsCheck(now time.Time) bool {
+	if t.current == "" {
+		return true
+	}
+	return *pull && !isPinned(t.image) && now.Sub(t.lastCheck) >= *pullInterval
+}
+
+// switchTo makes ref the image that containers are run from.
+func (t *imageTracker) switchTo(ref string, now time.Time) {
+	if t.current != "" {
+		log.Printf("Switching from image %s to %s.", t.current, ref)
+	} else {
+		log.Printf("Using image %s.", ref)
+	}
+	t.previous, t.current = t.current, ref
+	t.switched = now
+	t.failures = 0
+}
+
+// onProbation reports whether failures of the current image's
+// containers cause a rollback.
+func (t *imageTracker) onProbation(now time.Time) bool {
+	return t.previous != "" && now.Sub(t.switched) < *rollbackWindow
+}
+
+// noteFailure records that a container of image ref failed, and rolls
+// back to the previous image if the current one failed too often.
+// It reports whether it rolled back.
+func (t *imageTracker) noteFailure(ref string, now time.Time) bool {
+	if ref != t.current || !t.onProbation(now) {
+		return false
+	}
+	t.failures++
+	if t.failures < *rollbackFailures {
+		return false
+	}
+	log.Printf("%d containers of image %s failed within %v; rolling back to %s.", t.failures, t.current, now.Sub(t.switched).Round(time.Second), t.previous)
+	if t.bad == nil {
+		t.bad = make(map[string]bool)
+	}
+	t.bad[t.current] = true
+	t.current, t.previous = t.previous, ""
+	t.failures = 0
+	return true
+}
+
+// check resolves the image to a pinned reference, pulling and
+// verifying it, and switches to it if it's new.
+func (t *imageTracker) check() error {
+	now := time.Now()
+	t.lastCheck = now
+	ref := t.image
+	if !isPinned(ref) {
+		log.Printf("Pulling %s ...", ref)
+		if err := pullImage(ref); err != nil {
+			return err
+		}
+		var err error
+		ref, err = resolveDigest(ref)
+		if err != nil {
+			return err
+		}
+	} else if t.current == "" {
+		// Fetch it ahead of time, rather than on each
+		// docker run.
+		log.Printf("Pulling %s ...", ref)
+		if err := pullImage(ref); err != nil {
+			return err
+		}
+	}
+	if ref == t.current {
+		return nil
+	}
+	if t.bad[ref] {
+		log.Printf("Not switching to image %s, which was rolled back.", ref)
+		return nil
+	}
+	if *verifyKey != "" {
+		if err := verifyImage(ref); err != nil {
+			return err
+		}
+	}
+	t.switchTo(ref, now)
+	return nil
+}
+
+// isPinned reports whether image reference ref is pinned to a digest.
+func isPinned(ref string) bool {
+	return strings.Contains(ref, "@sha256:")
+}
+
+// repoName returns the repository of image reference ref, without a
+// tag or digest.
+func repoName(ref string) string {
+	if i := strings.Index(ref, "@"); i >= 0 {
+		ref = ref[:i]
+	}
+	if i := strings.LastIndex(ref, ":"); i > strings.LastIndex(ref, "/") {
+		ref = ref[:i]
+	}
+	return ref
+}
+
+func pullImage(ref string) error {
+	out, err := exec.Command("docker", "pull", ref).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("docker pull %s failed: %v, %s", ref, err, out)
+	}
+	return nil
+}
+
+// resolveDigest returns the reference of the local image ref pinned to
+// its digest.
+func resolveDigest(ref string) (string, error) {
+	out, err := exec.Command("docker", "image", "inspect", "--format", "{{range .RepoDigests}}{{println .}}{{end}}", ref).Output()
+	if err != nil {
+		return "", fmt.Errorf("error running docker image inspect %s: %v", ref, err)
+	}
+	// Out is like:
+	// golang/builder@sha256:4b8d52c7...
+	repo := repoName(ref)
+	for _, line := range strings.Split(string(out), "\n") {
+		if repoName(line) == repo && isPinned(line) {
+			return line, nil
+		}
+	}
+	return "", fmt.Errorf("no digest of %s in %q", ref, out)
+}
+
+// verifyImage checks the signature of image ref with cosign.
+func verifyImage(ref string) error {
+	out, err := exec.Command("cosign", "verify", "--key", *verifyKey, ref).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("cosign verify of image %s failed: %v, %s", ref, err, bytes.TrimSpace(out))
+	}
+	log.Printf("Verified the signature of image %s.", ref)
+	return nil
+}
+
+var exitedRx = regexp.MustCompile(`^Exited \((-?\d+)\)`)
+
+// exitCode returns the exit code in the docker ps status of a
+// container, such as "Exited (1) About a minute ago", if it exited.
+func exitCode(status string) (code int, ok bool) {
+	m := exitedRx.FindStringSubmatch(status)
+	if m == nil {
+		return 0, false
+	}
+	code, err := strconv.Atoi(m[1])
+	return code, err == nil
+}
@@ -0,0 +1,85 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRepoName(t *testing.T) {
+	for ref, want := range map[string]string{
+		"golang/builder":                           "golang/builder",
+		"golang/builder:latest":                    "golang/builder",
+		"golang/builder@sha256:abc":                "golang/builder",
+		"localhost:5000/builder:v2":                "localhost:5000/builder",
+		"localhost:5000/builder":                   "localhost:5000/builder",
+		"gcr.io/symbolic-datum-552/builder@sha256": "gcr.io/symbolic-datum-552/builder",
+	} {
+		if got := repoName(ref); got != want {
+			t.Errorf("repoName(%q) = %q; want %q", ref, got, want)
+		}
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	for _, tt := range []struct {
+		status string
+		code   int
+		ok     bool
+	}{
+		{"Exited (0) About a minute ago", 0, true},
+		{"Exited (137) 2 hours ago", 137, true},
+		{"Up 23 minutes", 0, false},
+		{"Created", 0, false},
+	} {
+		code, ok := exitCode(tt.status)
+		if code != tt.code || ok != tt.ok {
+			t.Errorf("exitCode(%q) = %d, %v; want %d, %v", tt.status, code, ok, tt.code, tt.ok)
+		}
+	}
+}
+
+func TestImageRollback(t *testing.T) {
+	const (
+		oldRef = "golang/builder@sha256:old"
+		newRef = "golang/builder@sha256:new"
+	)
+	now := time.Now()
+	it := &imageTracker{image: "golang/builder"}
+	it.switchTo(oldRef, now)
+	for i := 0; i < *rollbackFailures; i++ {
+		if it.noteFailure(oldRef, now) {
+			t.Fatalf("rolled back the first image")
+		}
+	}
+
+	it.switchTo(newRef, now)
+	if it.noteFailure(oldRef, now) {
+		t.Errorf("failure of a container of the previous image caused a rollback")
+	}
+	for i := 1; i < *rollbackFailures; i++ {
+		if it.noteFailure(newRef, now) {
+			t.Fatalf("rolled back after %d failures; want %d", i, *rollbackFailures)
+		}
+	}
+	if !it.noteFailure(newRef, now) {
+		t.Fatalf("didn't roll back after %d failures", *rollbackFailures)
+	}
+	if it.current != oldRef || !it.bad[newRef] {
+		t.Errorf("after rollback, current = %q, bad = %v; want %q and %q bad", it.current, it.bad, oldRef, newRef)
+	}
+
+	// Failures after the rollback window don't count.
+	it = &imageTracker{image: "golang/builder"}
+	it.switchTo(oldRef, now)
+	it.switchTo(newRef, now)
+	later := now.Add(*rollbackWindow)
+	for i := 0; i < *rollbackFailures; i++ {
+		if it.noteFailure(newRef, later) {
+			t.Fatalf("rolled back after the rollback window")
+		}
+	}
+}
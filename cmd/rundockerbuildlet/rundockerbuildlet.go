@@ -35,7 +35,12 @@ var (
 	keyFile    = flag.String("key", "/etc/gobuild.key", "go build key file")
 	builderEnv = flag.String("env", "", "optional GO_BUILDER_ENV environment variable value to set in the guests")
 	cpu        = flag.Int("cpu", 0, "if non-zero, how many CPUs to assign from the host and pass to docker run --cpuset-cpus")
-	pull       = flag.Bool("pull", false, "whether to pull the --image before each container starting")
+	pull       = flag.Bool("pull", false, "whether to check for new versions of --image, if it's not pinned to a digest, and switch to them once they're pulled")
+
+	pullInterval     = flag.Duration("pull-interval", 15*time.Minute, "with --pull, how often to check for a new version of --image")
+	verifyKey        = flag.String("verify-key", "", "if non-empty, the key that images must be signed with, as accepted by cosign verify --key; images that fail verification aren't run")
+	rollbackWindow   = flag.Duration("rollback-window", 30*time.Minute, "how long after switching to a new version of --image failures of its containers cause a rollback to the previous version")
+	rollbackFailures = flag.Int("rollback-failures", 3, "how many containers of a new version of --image may fail within --rollback-window before rolling back")
 )
 
 var (
@@ -46,6 +51,8 @@ var (
 	ec2UD *cloud.EC2UserData
 	// ec2MetaClient is an EC2 metadata client.
 	ec2MetaClient *ec2metadata.EC2Metadata
+	// images tracks the version of --image that containers run.
+	images *imageTracker
 )
 
 func main() {
@@ -70,6 +77,7 @@ func main() {
 		log.Fatalf("docker --image is required")
 	}
 
+	images = &imageTracker{image: *image}
 	log.Printf("Started. Will keep %d copies of %s running.", *numInst, *image)
 	for {
 		if err := checkFix(); err != nil {
@@ -113,28 +121,40 @@ func getBuildKey() []byte {
 }
 
 func checkFix() error {
+	if images.needsCheck(time.Now()) {
+		if err := images.check(); err != nil {
+			if images.current == "" {
+				return err
+			}
+			log.Printf("Checking for a new version of %s: %v", *image, err)
+		}
+	}
+
 	running := map[string]bool{}
 
-	out, err := exec.Command("docker", "ps", "-a", "--format", "{{.ID}} {{.Names}} {{.Status}}").Output()
+	out, err := exec.Command("docker", "ps", "-a", "--format", "{{.ID}} {{.Names}} {{.Image}} {{.Status}}").Output()
 	if err != nil {
 		return fmt.Errorf("error running docker ps: %v", err)
 	}
 	// Out is like:
-	// b1dc9ec2e646 packet14 Up 23 minutes
-	// eeb458938447 packet11 Exited (0) About a minute ago
+	// b1dc9ec2e646 packet14 golang/builder@sha256:4b8d52c7... Up 23 minutes
+	// eeb458938447 packet11 golang/builder@sha256:4b8d52c7... Exited (0) About a minute ago
 	// ...
 	lines := strings.Split(string(out), "\n")
 	for _, line := range lines {
-		f := strings.SplitN(line, " ", 3)
-		if len(f) < 3 {
+		f := strings.SplitN(line, " ", 4)
+		if len(f) < 4 {
 			continue
 		}
-		container, name, status := f[0], f[1], f[2]
+		container, name, ref, status := f[0], f[1], f[2], f[3]
 		prefix := *basename
 		if !strings.HasPrefix(name, prefix) {
 			continue
 		}
 		if strings.HasPrefix(status, "Exited") {
+			if code, ok := exitCode(status); ok && code != 0 {
+				images.noteFailure(ref, time.Now())
+			}
 			removeContainer(container)
 		}
 		running[name] = strings.HasPrefix(status, "Up")
@@ -174,14 +194,6 @@ func checkFix() error {
 			continue
 		}
 
-		if *pull {
-			log.Printf("Pulling %s ...", *image)
-			out, err := exec.Command("docker", "pull", *image).CombinedOutput()
-			if err != nil {
-				log.Printf("docker pull %s failed: %v, %s", *image, err, out)
-			}
-		}
-
 		log.Printf("Creating %s ...", name)
 		keyFile := fmt.Sprintf("/tmp/buildkey%02d/gobuildkey", num)
 		if err := os.MkdirAll(filepath.Dir(keyFile), 0700); err != nil {
@@ -214,10 +226,12 @@ func checkFix() error {
 			"-e", "GO_BUILD_KEY_PATH=/buildkey/gobuildkey",
 			"-e", "GO_BUILD_KEY_DELETE_AFTER_READ=true",
 		)
-		cmd.Args = append(cmd.Args, *image)
+		ref := images.current
+		cmd.Args = append(cmd.Args, ref)
 		out, err := cmd.CombinedOutput()
 		if err != nil {
 			log.Printf("Error creating %s: %v, %s", name, err, out)
+			images.noteFailure(ref, time.Now())
 			continue
 		}
 		log.Printf("Created %v", name)
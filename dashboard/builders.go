@@ -15,6 +15,7 @@ import (
 	"time"
 
 	"golang.org/x/build/buildenv"
+	"golang.org/x/build/internal/envutil"
 	"golang.org/x/build/internal/gophers"
 	"golang.org/x/build/maintner/maintnerd/maintapi/version"
 	"golang.org/x/build/types"
@@ -154,6 +155,7 @@ var Hosts = map[string]*HostConfig{
 		ExpectNum:       2,
 		Notes:           "AWS macOS Mojave (10.14) VM under QEMU",
 		SSHUsername:     "gopher",
+		EnvProfile:      "unix",
 		HermeticReverse: true, // we destroy the VM when done & recreate
 		GoogleReverse:   true,
 	},
@@ -162,6 +164,7 @@ var Hosts = map[string]*HostConfig{
 		ExpectNum:       2,
 		Notes:           "AWS macOS Catalina (10.15) VM under QEMU",
 		SSHUsername:     "gopher",
+		EnvProfile:      "unix",
 		HermeticReverse: true, // we destroy the VM when done & recreate
 		GoogleReverse:   true,
 	},
@@ -170,6 +173,7 @@ var Hosts = map[string]*HostConfig{
 		ExpectNum:       2,
 		Notes:           "AWS macOS Big Sur (11) VM under QEMU",
 		SSHUsername:     "gopher",
+		EnvProfile:      "unix",
 		HermeticReverse: true, // we destroy the VM when done & recreate
 		GoogleReverse:   true,
 	},
@@ -178,6 +182,7 @@ var Hosts = map[string]*HostConfig{
 		ExpectNum:       6,
 		Notes:           "AWS macOS Monterey (12) VM under QEMU",
 		SSHUsername:     "gopher",
+		EnvProfile:      "unix",
 		HermeticReverse: true, // we destroy the VM when done & recreate
 		GoogleReverse:   true,
 	},
@@ -186,6 +191,7 @@ var Hosts = map[string]*HostConfig{
 		ExpectNum:       2,
 		Notes:           "AWS macOS Ventura (13) VM under QEMU",
 		SSHUsername:     "gopher",
+		EnvProfile:      "unix",
 		HermeticReverse: true, // we destroy the VM when done & recreate
 		GoogleReverse:   true,
 	},
@@ -194,6 +200,7 @@ var Hosts = map[string]*HostConfig{
 		Notes:         "macOS Big Sur (11) ARM64 (M1) on Mac minis in a Google office",
 		ExpectNum:     3,
 		SSHUsername:   "gopher",
+		EnvProfile:    "unix",
 		GoogleReverse: true,
 	},
 	"host-darwin-arm64-12": {
@@ -201,6 +208,7 @@ var Hosts = map[string]*HostConfig{
 		ExpectNum:     3,
 		Notes:         "macOS Monterey (12) ARM64 (M1) on Mac minis in a Google office",
 		SSHUsername:   "gopher",
+		EnvProfile:    "unix",
 		GoogleReverse: true,
 	},
 	"host-dragonfly-amd64-622": {
@@ -273,22 +281,26 @@ var Hosts = map[string]*HostConfig{
 		Notes:          "Debian Bookworm",
 		ContainerImage: "linux-x86-bookworm:latest",
 		SSHUsername:    "root",
+		EnvProfile:     "unix",
 	},
 	"host-linux-amd64-bullseye": {
 		Notes:          "Debian Bullseye",
 		ContainerImage: "linux-x86-bullseye:latest",
 		SSHUsername:    "root",
+		EnvProfile:     "unix",
 	},
 	"host-linux-amd64-bullseye-vmx": {
 		Notes:          "Debian Bullseye w/ Nested Virtualization (VMX CPU bit) enabled",
 		ContainerImage: "linux-x86-bullseye:latest",
 		NestedVirt:     true,
 		SSHUsername:    "root",
+		EnvProfile:     "unix",
 	},
 	"host-linux-amd64-buster": {
 		Notes:          "Debian Buster",
 		ContainerImage: "linux-x86-buster:latest",
 		SSHUsername:    "root",
+		EnvProfile:     "unix",
 	},
 	"host-linux-amd64-clang": {
 		Notes:          "Container with clang.",
@@ -331,11 +343,13 @@ var Hosts = map[string]*HostConfig{
 		Notes:          "Debian sid, updated occasionally.",
 		ContainerImage: "linux-x86-sid:latest",
 		SSHUsername:    "root",
+		EnvProfile:     "unix",
 	},
 	"host-linux-amd64-stretch": {
 		Notes:          "Debian Stretch",
 		ContainerImage: "linux-x86-stretch:latest",
 		SSHUsername:    "root",
+		EnvProfile:     "unix",
 	},
 	"host-linux-amd64-wasip1-wasm-wasmedge": {
 		Notes:          "Container with wasmedge for testing wasip1/wasm.",
@@ -376,6 +390,7 @@ var Hosts = map[string]*HostConfig{
 		ContainerImage:  "linux-arm64-bullseye:latest",
 		machineType:     "t2a",
 		SSHUsername:     "root",
+		EnvProfile:      "unix",
 		cosArchitecture: CosArchARM64,
 	},
 	"host-linux-arm64-bullseye-high-disk": {
@@ -383,6 +398,7 @@ var Hosts = map[string]*HostConfig{
 		ContainerImage:  "linux-arm64-bullseye:latest",
 		machineType:     "t2a",
 		SSHUsername:     "root",
+		EnvProfile:      "unix",
 		cosArchitecture: CosArchARM64,
 		RootDriveSizeGB: 20,
 	},
@@ -542,9 +558,9 @@ var Hosts = map[string]*HostConfig{
 		Owners:    []*gophers.Person{gh("0intro")},
 	},
 	"host-plan9-386-gce": {
-		VMImage: "plan9-386-v7",
-		Notes:   "Plan 9 from 0intro; GCE VM, built from build/env/plan9-386",
-		env:     []string{"GO_TEST_TIMEOUT_SCALE=3"},
+		VMImage:    "plan9-386-v7",
+		SpeedClass: SpeedSlow,
+		Notes:      "Plan 9 from 0intro; GCE VM, built from build/env/plan9-386",
 	},
 	"host-plan9-amd64-0intro": {
 		IsReverse: true,
@@ -657,9 +673,51 @@ func init() {
 		if nSet != 1 {
 			panic(fmt.Sprintf("exactly one of VMImage, ContainerImage, IsReverse must be set for host %q; got %v", key, nSet))
 		}
+		if _, ok := speedScales[c.SpeedClass]; c.SpeedClass != "" && !ok {
+			panic(fmt.Sprintf("unknown SpeedClass %q for host %q", c.SpeedClass, key))
+		}
+		if setsTimeoutScale(c.env) {
+			panic(fmt.Sprintf("host %q sets GO_TEST_TIMEOUT_SCALE; use SpeedClass", key))
+		}
+		if _, ok := EnvProfiles[c.EnvProfile]; c.EnvProfile != "" && !ok {
+			panic(fmt.Sprintf("unknown EnvProfile %q for host %q", c.EnvProfile, key))
+		}
+	}
+	for key, p := range EnvProfiles {
+		if p.Name == "" {
+			p.Name = key
+		}
+		if p.Name != key {
+			panic(fmt.Sprintf("EnvProfile Name %q != key %q", p.Name, key))
+		}
 	}
 }
 
+// unixEnvAllow are the variables a Unix build command may inherit from
+// the buildlet under the Unix environment profiles. Anything else a
+// build needs is set by the coordinator or the buildlet itself.
+var unixEnvAllow = []string{"HOME", "USER", "LOGNAME", "SHELL", "LANG", "LC_*", "TZ"}
+
+// EnvProfiles are the environment profiles that hosts can opt into
+// with HostConfig.EnvProfile, keyed by name.
+var EnvProfiles = map[string]*envutil.Profile{
+	// unix reports, but keeps, the variables a build inherits that
+	// unix-hermetic would remove, to find what a host depends on
+	// before moving it to unix-hermetic.
+	"unix": {
+		Allow: unixEnvAllow,
+	},
+	// unix-hermetic runs builds with only the allowed variables and
+	// a fixed PATH and TMPDIR. Hosts move to it one at a time, once
+	// their violation logs under unix are clean.
+	"unix-hermetic": {
+		Allow:  unixEnvAllow,
+		Path:   []string{"/usr/local/bin", "/usr/bin", "/bin"},
+		TmpDir: "tmp",
+		Strict: true,
+	},
+}
+
 // CosArch defines the diffrent COS images types used.
 type CosArch string
 
@@ -728,10 +786,16 @@ type HostConfig struct {
 	// (This is generally an internal implementation detail, currently left behind only for the -perf builder.)
 	CustomDeleteTimeout time.Duration
 
+	// SpeedClass is how fast the host is, which scales the timeouts of
+	// builds on it and the default delete timeout of its VMs.
+	// Empty means SpeedFast.
+	SpeedClass SpeedClass
+
 	// Reverse options
-	ExpectNum       int  // expected number of reverse buildlets of this type
-	HermeticReverse bool // whether reverse buildlet has fresh env per conn
-	GoogleReverse   bool // whether this reverse builder is owned by Google
+	ExpectNum       int   // expected number of reverse buildlets of this type
+	HermeticReverse bool  // whether reverse buildlet has fresh env per conn
+	GoogleReverse   bool  // whether this reverse builder is owned by Google
+	WorkDirQuotaGB  int64 // optional limit on the size of the buildlet's work directory in base-2 GB
 
 	// Container image options, if ContainerImage != "":
 	NestedVirt    bool   // container requires VMX nested virtualization. e2 and n2d instances are not supported.
@@ -740,6 +804,10 @@ type HostConfig struct {
 	// Optional base env.
 	env []string
 
+	// EnvProfile optionally names the profile in EnvProfiles that the
+	// environment of the host's build commands is restricted to.
+	EnvProfile string
+
 	Owners []*gophers.Person // owners; empty means golang-dev
 	Notes  string            // notes for humans
 
@@ -782,6 +850,11 @@ type BuildConfig struct {
 
 	Notes string // notes for humans
 
+	// SpeedClass optionally overrides the speed class of the host,
+	// for builders that are slower than their host, such as those
+	// that cross-compile for or emulate a slow architecture.
+	SpeedClass SpeedClass
+
 	// tryBot optionally specifies a policy func for whether trybots are enabled.
 	// nil means off. Even if tryBot returns true, BuildConfig.BuildsRepo must also
 	// return true. See the implementation of BuildConfig.BuildsRepoTryBot.
@@ -922,6 +995,9 @@ func (c *BuildConfig) Env() []string {
 		// without the default -short flag. See go.dev/issue/12508.
 		env = append(env, "GO_TEST_SHORT=0")
 	}
+	if scale := c.GoTestTimeoutScale(); scale != 1 {
+		env = append(env, "GO_TEST_TIMEOUT_SCALE="+strconv.Itoa(scale))
+	}
 	env = append(env, c.HostConfig().env...)
 	return append(env, c.env...)
 }
@@ -987,28 +1063,79 @@ func (c *BuildConfig) DistTestsExecTimeout(distTests []string) time.Duration {
 	// now we have the TestStats in the coordinator. Pass in a
 	// *buildstats.TestStats and use historical data times some
 	// fudge factor? For now just use the old 20 minute limit
-	// we've used since 2014, but scale it by the
-	// GO_TEST_TIMEOUT_SCALE for the super slow builders which
-	// struggle with, say, the cgo tests. (which should be broken
-	// up into separate dist tests or shards, like the test/ dir
-	// was)
+	// we've used since 2014, but scale it for the super slow
+	// builders which struggle with, say, the cgo tests. (which
+	// should be broken up into separate dist tests or shards,
+	// like the test/ dir was)
 	d := 20 * time.Minute
 	d *= time.Duration(c.GoTestTimeoutScale())
 	return d
 }
 
-// GoTestTimeoutScale returns this builder's GO_TEST_TIMEOUT_SCALE value, or 1.
+// GoTestTimeout returns the -timeout value for go test invocations
+// of this builder, which is the go test default scaled by
+// GoTestTimeoutScale.
+func (c *BuildConfig) GoTestTimeout() time.Duration {
+	const goTestDefaultTimeout = 10 * time.Minute // Default value taken from Go 1.20.
+	return goTestDefaultTimeout * time.Duration(c.GoTestTimeoutScale())
+}
+
+// GoTestTimeoutScale returns the factor by which this builder's test
+// timeouts are scaled, which is the scale of its speed class.
 func (c *BuildConfig) GoTestTimeoutScale() int {
-	const pfx = "GO_TEST_TIMEOUT_SCALE="
-	for _, env := range [][]string{c.env, c.HostConfig().env} {
-		for _, kv := range env {
-			if strings.HasPrefix(kv, pfx) {
-				if n, err := strconv.Atoi(kv[len(pfx):]); err == nil && n > 0 {
-					return n
-				}
-			}
+	return c.Speed().TimeoutScale()
+}
+
+// Speed returns the speed class of the builder.
+func (c *BuildConfig) Speed() SpeedClass {
+	if c.SpeedClass != "" {
+		return c.SpeedClass
+	}
+	if hc := c.HostConfig(); hc.SpeedClass != "" {
+		return hc.SpeedClass
+	}
+	return SpeedFast
+}
+
+// A SpeedClass describes how fast a builder runs the tests, relative
+// to a typical linux-amd64 builder. Timeouts are scaled by the
+// TimeoutScale of the speed class, so that slow ports don't time out
+// spuriously. It's passed to cmd/dist as GO_TEST_TIMEOUT_SCALE, which
+// builder and host envs must not set themselves.
+type SpeedClass string
+
+const (
+	SpeedFast     SpeedClass = "fast"     // typical amd64 and arm64 machines
+	SpeedMedium   SpeedClass = "medium"   // 32-bit arm, ppc64, race builders
+	SpeedSlow     SpeedClass = "slow"     // mips, riscv64 boards, longtest builders
+	SpeedEmulated SpeedClass = "emulated" // architectures emulated by QEMU or similar, the slowest boards
+)
+
+// speedScales maps each speed class to its TimeoutScale.
+var speedScales = map[SpeedClass]int{
+	SpeedFast:     1,
+	SpeedMedium:   2,
+	SpeedSlow:     5,
+	SpeedEmulated: 10,
+}
+
+// setsTimeoutScale reports whether env sets GO_TEST_TIMEOUT_SCALE,
+// which is derived from the speed class instead.
+func setsTimeoutScale(env []string) bool {
+	for _, kv := range env {
+		if strings.HasPrefix(kv, "GO_TEST_TIMEOUT_SCALE=") {
+			return true
 		}
 	}
+	return false
+}
+
+// TimeoutScale returns the factor by which timeouts are scaled for
+// builders of speed class s.
+func (s SpeedClass) TimeoutScale() int {
+	if n, ok := speedScales[s]; ok {
+		return n
+	}
 	return 1
 }
 
@@ -1023,6 +1150,12 @@ func (c *BuildConfig) HostConfig() *HostConfig {
 	panic(fmt.Sprintf("missing buildlet config for buildlet %q", c.Name))
 }
 
+// EnvProfile returns the environment profile this builder's commands
+// run in, or nil if its host doesn't have one.
+func (c *BuildConfig) EnvProfile() *envutil.Profile {
+	return EnvProfiles[c.HostConfig().EnvProfile]
+}
+
 // GoBootstrapURL returns the URL of a built Go 1.4+ tar.gz for the
 // build configuration type c, or empty string if there isn't one.
 func (c *BuildConfig) GoBootstrapURL(e *buildenv.Environment) string {
@@ -1952,9 +2085,10 @@ func init() {
 		},
 	})
 	addBuilder(BuildConfig{
-		Name:     "linux-amd64-longtest",
-		HostType: "host-linux-amd64-bullseye",
-		Notes:    "Debian Bullseye with go test -short=false",
+		Name:       "linux-amd64-longtest",
+		HostType:   "host-linux-amd64-bullseye",
+		SpeedClass: SpeedSlow, // give them lots of time
+		Notes:      "Debian Bullseye with go test -short=false",
 		tryBot: func(repo, branch, goBranch string) bool {
 			onReleaseBranch := strings.HasPrefix(branch, "release-branch.")
 			return repo == "go" && onReleaseBranch // See issue 37827.
@@ -1964,29 +2098,25 @@ func init() {
 			// For golang.org/x repos, don't test non-latest versions.
 			return repo == "go" || (branch == "master" && goBranch == "master")
 		},
-		env: []string{
-			"GO_TEST_TIMEOUT_SCALE=5", // give them lots of time
-		},
 		numTryTestHelpers: 4, // Target time is < 15 min for go.dev/issue/42661.
 	})
 	addBuilder(BuildConfig{
-		Name:     "linux-amd64-longtest-race",
-		HostType: "host-linux-amd64-bullseye",
-		Notes:    "Debian Bullseye with the race detector enabled and go test -short=false",
+		Name:       "linux-amd64-longtest-race",
+		HostType:   "host-linux-amd64-bullseye",
+		SpeedClass: SpeedSlow, // Inherited from the longtest builder.
+		Notes:      "Debian Bullseye with the race detector enabled and go test -short=false",
 		buildsRepo: func(repo, branch, goBranch string) bool {
 			// Test all repos, ignoring buildRepoByDefault.
 			// For golang.org/x repos, don't test non-latest versions.
 			return repo == "go" || (branch == "master" && goBranch == "master")
 		},
-		env: []string{
-			"GO_TEST_TIMEOUT_SCALE=5", // Inherited from the longtest builder.
-		},
 		numTryTestHelpers: 4, // Target time is < 15 min for go.dev/issue/56907.
 	})
 	addBuilder(BuildConfig{
-		Name:     "linux-386-longtest",
-		HostType: "host-linux-amd64-bullseye",
-		Notes:    "Debian Bullseye with go test -short=false; to get 32-bit coverage",
+		Name:       "linux-386-longtest",
+		HostType:   "host-linux-amd64-bullseye",
+		SpeedClass: SpeedSlow, // give them lots of time
+		Notes:      "Debian Bullseye with go test -short=false; to get 32-bit coverage",
 		tryBot: func(repo, branch, goBranch string) bool {
 			onReleaseBranch := strings.HasPrefix(branch, "release-branch.")
 			return repo == "go" && onReleaseBranch // See issue 37827.
@@ -2002,7 +2132,6 @@ func init() {
 		env: []string{
 			"GOARCH=386",
 			"GOHOSTARCH=386",
-			"GO_TEST_TIMEOUT_SCALE=5", // give them lots of time
 		},
 		numTryTestHelpers: 4, // Target time is < 15 min for go.dev/issue/42661.
 	})
@@ -2097,6 +2226,7 @@ func init() {
 	addBuilder(BuildConfig{
 		Name:         "openbsd-arm-jsing",
 		HostType:     "host-openbsd-arm-joelsing",
+		SpeedClass:   SpeedSlow, // the machine is slow
 		SkipSnapshot: true,
 		FlakyNet:     true,
 		buildsRepo: func(repo, branch, goBranch string) bool {
@@ -2109,14 +2239,11 @@ func init() {
 		},
 		distTestAdjust: noTestDirAndNoReboot,
 		tryBot:         nil,
-		env: []string{
-			// The machine is slow.
-			"GO_TEST_TIMEOUT_SCALE=5",
-		},
 	})
 	addBuilder(BuildConfig{
 		Name:         "openbsd-arm64-jsing",
 		HostType:     "host-openbsd-arm64-joelsing",
+		SpeedClass:   SpeedSlow, // the machine is slow
 		SkipSnapshot: true,
 		FlakyNet:     true,
 		buildsRepo: func(repo, branch, goBranch string) bool {
@@ -2129,14 +2256,11 @@ func init() {
 		},
 		distTestAdjust: noTestDirAndNoReboot,
 		tryBot:         nil,
-		env: []string{
-			// The machine is slow.
-			"GO_TEST_TIMEOUT_SCALE=5",
-		},
 	})
 	addBuilder(BuildConfig{
 		Name:         "openbsd-mips64-jsing",
 		HostType:     "host-openbsd-mips64-joelsing",
+		SpeedClass:   SpeedSlow, // the machine is slow
 		KnownIssues:  []int{36435, 58110, 61546},
 		SkipSnapshot: true,
 		FlakyNet:     true,
@@ -2150,10 +2274,6 @@ func init() {
 		},
 		distTestAdjust: noTestDirAndNoReboot,
 		tryBot:         nil,
-		env: []string{
-			// The machine is slow.
-			"GO_TEST_TIMEOUT_SCALE=5",
-		},
 		makeScriptArgs: []string{"-force"}, // Port is marked broken.
 		allScriptArgs:  []string{"-force"}, // Port is marked broken.
 	})
@@ -2179,6 +2299,7 @@ func init() {
 	addBuilder(BuildConfig{
 		Name:         "openbsd-riscv64-jsing",
 		HostType:     "host-openbsd-riscv64-joelsing",
+		SpeedClass:   SpeedSlow, // the machine is slow
 		KnownIssues:  []int{55999},
 		SkipSnapshot: true,
 		FlakyNet:     true,
@@ -2192,10 +2313,6 @@ func init() {
 		},
 		distTestAdjust: noTestDirAndNoReboot,
 		tryBot:         nil,
-		env: []string{
-			// The machine is slow.
-			"GO_TEST_TIMEOUT_SCALE=3",
-		},
 		makeScriptArgs: []string{"-force"}, // Port is incomplete.
 		allScriptArgs:  []string{"-force"}, // Port is incomplete.
 	})
@@ -2211,8 +2328,9 @@ func init() {
 		tryBot:         explicitTrySet("sys"),
 	})
 	addBuilder(BuildConfig{
-		Name:     "netbsd-arm-bsiegert",
-		HostType: "host-netbsd-arm-bsiegert",
+		Name:       "netbsd-arm-bsiegert",
+		HostType:   "host-netbsd-arm-bsiegert",
+		SpeedClass: SpeedEmulated, // the machine is slow
 		buildsRepo: func(repo, branch, goBranch string) bool {
 			if repo == "review" {
 				// https://go.dev/issue/49530: This test seems to be too slow even
@@ -2223,22 +2341,15 @@ func init() {
 		},
 		distTestAdjust: noTestDirAndNoReboot,
 		tryBot:         nil,
-		env: []string{
-			// The machine is slow.
-			"GO_TEST_TIMEOUT_SCALE=10",
-		},
-		FlakyNet: true,
+		FlakyNet:       true,
 	})
 	addBuilder(BuildConfig{
 		Name:           "netbsd-arm64-bsiegert",
 		HostType:       "host-netbsd-arm64-bsiegert",
+		SpeedClass:     SpeedEmulated, // the machine is slow
 		distTestAdjust: noTestDirAndNoReboot,
 		tryBot:         nil,
-		env: []string{
-			// The machine is slow.
-			"GO_TEST_TIMEOUT_SCALE=10",
-		},
-		FlakyNet: true,
+		FlakyNet:       true,
 	})
 	addBuilder(BuildConfig{
 		Name:           "plan9-386",
@@ -2259,6 +2370,7 @@ func init() {
 	addBuilder(BuildConfig{
 		Name:           "windows-amd64-2008",
 		HostType:       "host-windows-amd64-2008",
+		SpeedClass:     SpeedMedium, // cmd/go takes over the 180s default dist test timeout
 		distTestAdjust: noTestDirAndNoReboot,
 		buildsRepo: func(repo, branch, goBranch string) bool {
 			// This builder has modern/recent C compilers installed,
@@ -2273,16 +2385,12 @@ func init() {
 		env: []string{
 			"GOARCH=amd64",
 			"GOHOSTARCH=amd64",
-			// cmd/go takes ~188 seconds on windows-amd64
-			// now, which is over the 180 second default
-			// dist test timeout. So, bump this builder
-			// up:
-			"GO_TEST_TIMEOUT_SCALE=2",
 		},
 	})
 	addBuilder(BuildConfig{
 		Name:           "windows-amd64-2008-oldcc",
 		HostType:       "host-windows-amd64-2008-oldcc",
+		SpeedClass:     SpeedMedium, // cmd/go takes over the 180s default dist test timeout
 		distTestAdjust: noTestDirAndNoReboot,
 		buildsRepo: func(repo, branch, goBranch string) bool {
 			// This builder has legacy C compilers installed, suitable
@@ -2296,11 +2404,6 @@ func init() {
 		env: []string{
 			"GOARCH=amd64",
 			"GOHOSTARCH=amd64",
-			// cmd/go takes ~188 seconds on windows-amd64
-			// now, which is over the 180 second default
-			// dist test timeout. So, bump this builder
-			// up:
-			"GO_TEST_TIMEOUT_SCALE=2",
 		},
 	})
 	addBuilder(BuildConfig{
@@ -2432,6 +2535,7 @@ func init() {
 	addBuilder(BuildConfig{
 		Name:           "windows-amd64-2012-oldcc",
 		HostType:       "host-windows-amd64-2012-oldcc",
+		SpeedClass:     SpeedMedium, // cmd/go takes over the 180s default dist test timeout
 		distTestAdjust: noTestDirAndNoReboot,
 		buildsRepo: func(repo, branch, goBranch string) bool {
 			// This builder has legacy C compilers installed, suitable
@@ -2445,16 +2549,12 @@ func init() {
 		env: []string{
 			"GOARCH=amd64",
 			"GOHOSTARCH=amd64",
-			// cmd/go takes ~188 seconds on windows-amd64
-			// now, which is over the 180 second default
-			// dist test timeout. So, bump this builder
-			// up:
-			"GO_TEST_TIMEOUT_SCALE=2",
 		},
 	})
 	addBuilder(BuildConfig{
 		Name:           "windows-amd64-2012",
 		HostType:       "host-windows-amd64-2012",
+		SpeedClass:     SpeedMedium, // cmd/go takes over the 180s default dist test timeout
 		distTestAdjust: noTestDirAndNoReboot,
 		buildsRepo: func(repo, branch, goBranch string) bool {
 			// This builder has modern/recent C compilers installed,
@@ -2469,16 +2569,12 @@ func init() {
 		env: []string{
 			"GOARCH=amd64",
 			"GOHOSTARCH=amd64",
-			// cmd/go takes ~188 seconds on windows-amd64
-			// now, which is over the 180 second default
-			// dist test timeout. So, bump this builder
-			// up:
-			"GO_TEST_TIMEOUT_SCALE=2",
 		},
 	})
 	addBuilder(BuildConfig{
-		Name:     "windows-amd64-2016",
-		HostType: "host-windows-amd64-2016",
+		Name:       "windows-amd64-2016",
+		HostType:   "host-windows-amd64-2016",
+		SpeedClass: SpeedMedium, // cmd/go takes over the 180s default dist test timeout
 		buildsRepo: func(repo, branch, goBranch string) bool {
 			// This builder has modern/recent C compilers installed,
 			// meaning that we only want to use it with 1.20+ versions
@@ -2492,11 +2588,6 @@ func init() {
 		env: []string{
 			"GOARCH=amd64",
 			"GOHOSTARCH=amd64",
-			// cmd/go takes ~188 seconds on windows-amd64
-			// now, which is over the 180 second default
-			// dist test timeout. So, bump this builder
-			// up:
-			"GO_TEST_TIMEOUT_SCALE=2",
 		},
 		tryBot: func(repo, branch, goBranch string) bool {
 			// See comment above about the atLeastGo1 call below.
@@ -2507,8 +2598,9 @@ func init() {
 		numTryTestHelpers: 5,
 	})
 	addBuilder(BuildConfig{
-		Name:     "windows-amd64-2016-oldcc",
-		HostType: "host-windows-amd64-2016-oldcc",
+		Name:       "windows-amd64-2016-oldcc",
+		HostType:   "host-windows-amd64-2016-oldcc",
+		SpeedClass: SpeedMedium, // cmd/go takes over the 180s default dist test timeout
 		buildsRepo: func(repo, branch, goBranch string) bool {
 			// This builder has legacy C compilers installed, suitable
 			// for versions of Go prior to 1.20, hence the atMostGo1
@@ -2522,11 +2614,6 @@ func init() {
 		env: []string{
 			"GOARCH=amd64",
 			"GOHOSTARCH=amd64",
-			// cmd/go takes ~188 seconds on windows-amd64
-			// now, which is over the 180 second default
-			// dist test timeout. So, bump this builder
-			// up:
-			"GO_TEST_TIMEOUT_SCALE=2",
 		},
 		tryBot: func(repo, branch, goBranch string) bool {
 			// See comment above about the atMostGo1 call below.
@@ -2537,9 +2624,10 @@ func init() {
 		numTryTestHelpers: 5,
 	})
 	addBuilder(BuildConfig{
-		Name:     "windows-amd64-longtest-oldcc",
-		HostType: "host-windows-amd64-2016-big-oldcc",
-		Notes:    "Windows Server 2016 with go test -short=false",
+		Name:       "windows-amd64-longtest-oldcc",
+		HostType:   "host-windows-amd64-2016-big-oldcc",
+		SpeedClass: SpeedSlow, // give them lots of time
+		Notes:      "Windows Server 2016 with go test -short=false",
 		tryBot: func(repo, branch, goBranch string) bool {
 			onReleaseBranch := strings.HasPrefix(branch, "release-branch.")
 			return repo == "go" && onReleaseBranch // See issue 37827.
@@ -2558,15 +2646,13 @@ func init() {
 			}
 			return b
 		},
-		env: []string{
-			"GO_TEST_TIMEOUT_SCALE=5", // give them lots of time
-		},
 		numTryTestHelpers: 4, // Target time is < 15 min for go.dev/issue/42661.
 	})
 	addBuilder(BuildConfig{
-		Name:     "windows-amd64-longtest",
-		HostType: "host-windows-amd64-2016-big",
-		Notes:    "Windows Server 2016 with go test -short=false",
+		Name:       "windows-amd64-longtest",
+		HostType:   "host-windows-amd64-2016-big",
+		SpeedClass: SpeedSlow, // give them lots of time
+		Notes:      "Windows Server 2016 with go test -short=false",
 		tryBot: func(repo, branch, goBranch string) bool {
 			onReleaseBranch := strings.HasPrefix(branch, "release-branch.")
 			return repo == "go" && onReleaseBranch // See issue 37827.
@@ -2585,15 +2671,13 @@ func init() {
 			}
 			return b
 		},
-		env: []string{
-			"GO_TEST_TIMEOUT_SCALE=5", // give them lots of time
-		},
 		numTryTestHelpers: 4, // Target time is < 15 min for go.dev/issue/42661.
 	})
 	addBuilder(BuildConfig{
-		Name:     "windows-amd64-oldcc-race",
-		HostType: "host-windows-amd64-2016-oldcc",
-		Notes:    "Only runs -race tests (./race.bat)",
+		Name:       "windows-amd64-oldcc-race",
+		HostType:   "host-windows-amd64-2016-oldcc",
+		SpeedClass: SpeedMedium, // cmd/go takes over the 180s default dist test timeout
+		Notes:      "Only runs -race tests (./race.bat)",
 		buildsRepo: func(repo, branch, goBranch string) bool {
 			// This builder has legacy C compilers installed, suitable
 			// for versions of Go prior to 1.20, hence the atMostGo1
@@ -2606,16 +2690,13 @@ func init() {
 		env: []string{
 			"GOARCH=amd64",
 			"GOHOSTARCH=amd64",
-			// cmd/go takes ~188 seconds on windows-amd64
-			// now, which is over the 180 second default
-			// dist test timeout. So, bump this builder
-			// up:
-			"GO_TEST_TIMEOUT_SCALE=2"},
+		},
 	})
 	addBuilder(BuildConfig{
-		Name:     "windows-amd64-race",
-		HostType: "host-windows-amd64-2016",
-		Notes:    "Only runs -race tests (./race.bat)",
+		Name:       "windows-amd64-race",
+		HostType:   "host-windows-amd64-2016",
+		SpeedClass: SpeedMedium, // cmd/go takes over the 180s default dist test timeout
+		Notes:      "Only runs -race tests (./race.bat)",
 		buildsRepo: func(repo, branch, goBranch string) bool {
 			// This builder has modern/recent C compilers installed,
 			// meaning that we only want to use it with 1.20+ versions
@@ -2628,18 +2709,15 @@ func init() {
 		env: []string{
 			"GOARCH=amd64",
 			"GOHOSTARCH=amd64",
-			// cmd/go takes ~188 seconds on windows-amd64
-			// now, which is over the 180 second default
-			// dist test timeout. So, bump this builder
-			// up:
-			"GO_TEST_TIMEOUT_SCALE=2"},
+		},
 	})
 	addBuilder(BuildConfig{
-		Name:     "windows-arm-zx2c4",
-		HostType: "host-windows-arm64-zx2c4",
+		Name:       "windows-arm-zx2c4",
+		HostType:   "host-windows-arm64-zx2c4",
+		SpeedClass: SpeedSlow,
 		env: []string{
 			"GOARM=7",
-			"GO_TEST_TIMEOUT_SCALE=3"},
+		},
 	})
 	addBuilder(BuildConfig{
 		Name:              "windows-arm64-11",
@@ -2693,7 +2771,11 @@ func init() {
 	addBuilder(BuildConfig{
 		Name:     "darwin-amd64-longtest",
 		HostType: "host-darwin-amd64-13-aws",
-		Notes:    "macOS 13 with go test -short=false",
+		// Most longtest builders are SpeedSlow, to give them lots of
+		// time. This particular builder is not as fast as the rest,
+		// so we give it 2x headroom. See go.dev/issue/60919.
+		SpeedClass: SpeedEmulated,
+		Notes:      "macOS 13 with go test -short=false",
 		buildsRepo: func(repo, branch, goBranch string) bool {
 			b := buildRepoByDefault(repo)
 			if repo == "go" && !atLeastGo1(goBranch, 21) {
@@ -2710,13 +2792,6 @@ func init() {
 			}
 			return b
 		},
-		env: []string{
-			// We use a timeout scale value of 5 for most longtest builders
-			// to give them lots of time. This particular builder is not as fast
-			// as the rest, so we give it 2x headroom for a scale value of 10.
-			// See go.dev/issue/60919.
-			"GO_TEST_TIMEOUT_SCALE=10",
-		},
 	})
 	addBuilder(BuildConfig{
 		Name:           "darwin-arm64-11",
@@ -2731,20 +2806,18 @@ func init() {
 		buildsRepo:     defaultPlusExpBuild,
 	})
 	addBuilder(BuildConfig{
-		Name:           "darwin-amd64-race",
-		HostType:       "host-darwin-amd64-12-aws",
+		Name:     "darwin-amd64-race",
+		HostType: "host-darwin-amd64-12-aws",
+		// Increase the timeout scale for this builder: it was observed to be
+		// timing out frequently in
+		// https://go.dev/issue/55311#issuecomment-1571986012.
+		//
+		// TODO(bcmills): The darwin-amd64-longtest builder was running extremely
+		// slowly because it was hitting swap. Race-enabled builds are also
+		// memory-hungry — is it possible that the -race builder is also swapping?
+		SpeedClass:     SpeedMedium,
 		distTestAdjust: macTestPolicy,
 		buildsRepo:     onlyGo,
-		env: []string{
-			// Increase the timeout scale for this builder: it was observed to be
-			// timing out frequently in
-			// https://go.dev/issue/55311#issuecomment-1571986012.
-			//
-			// TODO(bcmills): The darwin-amd64-longtest builder was running extremely
-			// slowly because it was hitting swap. Race-enabled builds are also
-			// memory-hungry — is it possible that the -race builder is also swapping?
-			"GO_TEST_TIMEOUT_SCALE=2",
-		},
 	})
 	addBuilder(BuildConfig{
 		Name:     "ios-arm64-corellium",
@@ -2763,16 +2836,16 @@ func init() {
 		},
 	})
 	addBuilder(BuildConfig{
-		Name:     "android-arm-corellium",
-		HostType: "host-android-arm64-corellium-android",
-		Notes:    "Virtual Android running on Corellium; owned by zenly (github.com/znly)",
+		Name:       "android-arm-corellium",
+		HostType:   "host-android-arm64-corellium-android",
+		SpeedClass: SpeedMedium, // cmd/dist's default for GOARCH=arm
+		Notes:      "Virtual Android running on Corellium; owned by zenly (github.com/znly)",
 		buildsRepo: func(repo, branch, goBranch string) bool {
 			return repo == "go" && branch == "master" && goBranch == "master"
 		},
 		env: []string{
 			"CGO_ENABLED=1",
 			"GOARCH=arm",
-			"GO_TEST_TIMEOUT_SCALE=2", // inherited from cmd/dist's default for GOARCH=arm
 		},
 	})
 	addBuilder(BuildConfig{
@@ -2855,16 +2928,16 @@ func init() {
 	addBuilder(BuildConfig{
 		Name:           "linux-ppc64-sid-buildlet",
 		HostType:       "host-linux-ppc64-sid",
+		SpeedClass:     SpeedMedium, // see go.dev/issues/44422
 		FlakyNet:       true,
 		distTestAdjust: ppc64DistTestPolicy,
-		env:            []string{"GO_TEST_TIMEOUT_SCALE=2"}, // see go.dev/issues/44422
 	})
 	addBuilder(BuildConfig{
 		Name:           "linux-ppc64-sid-power10",
 		HostType:       "host-linux-ppc64-sid-power10",
+		SpeedClass:     SpeedMedium, // see go.dev/issues/44422
 		FlakyNet:       true,
 		distTestAdjust: ppc64DistTestPolicy,
-		env:            []string{"GO_TEST_TIMEOUT_SCALE=2"}, // see go.dev/issues/44422
 		buildsRepo: func(repo, branch, goBranch string) bool {
 			return atLeastGo1(goBranch, 20) && buildRepoByDefault(repo)
 		},
@@ -2872,23 +2945,23 @@ func init() {
 	addBuilder(BuildConfig{
 		Name:           "linux-ppc64le-buildlet",
 		HostType:       "host-linux-ppc64le-osu",
+		SpeedClass:     SpeedMedium, // see go.dev/issues/44422
 		FlakyNet:       true,
 		distTestAdjust: ppc64DistTestPolicy,
-		env:            []string{"GO_TEST_TIMEOUT_SCALE=2"}, // see go.dev/issues/44422
 	})
 	addBuilder(BuildConfig{
 		Name:           "linux-ppc64le-power9osu",
 		HostType:       "host-linux-ppc64le-power9-osu",
+		SpeedClass:     SpeedMedium, // see go.dev/issues/44422
 		FlakyNet:       true,
 		distTestAdjust: ppc64DistTestPolicy,
-		env:            []string{"GO_TEST_TIMEOUT_SCALE=2"}, // see go.dev/issues/44422
 	})
 	addBuilder(BuildConfig{
 		Name:           "linux-ppc64le-power10osu",
 		HostType:       "host-linux-ppc64le-power10-osu",
+		SpeedClass:     SpeedMedium, // see go.dev/issues/44422
 		FlakyNet:       true,
 		distTestAdjust: ppc64DistTestPolicy,
-		env:            []string{"GO_TEST_TIMEOUT_SCALE=2"}, // see go.dev/issues/44422
 		buildsRepo: func(repo, branch, goBranch string) bool {
 			return atLeastGo1(goBranch, 20) && buildRepoByDefault(repo)
 		},
@@ -2915,9 +2988,10 @@ func init() {
 		},
 	})
 	addBuilder(BuildConfig{
-		Name:     "linux-arm64-longtest",
-		HostType: "host-linux-arm64-bullseye-high-disk",
-		Notes:    "Debian Bullseye with go test -short=false",
+		Name:       "linux-arm64-longtest",
+		HostType:   "host-linux-arm64-bullseye-high-disk",
+		SpeedClass: SpeedSlow, // give them lots of time
+		Notes:      "Debian Bullseye with go test -short=false",
 		tryBot: func(repo, branch, goBranch string) bool {
 			onReleaseBranch := strings.HasPrefix(branch, "release-branch.")
 			return repo == "go" && onReleaseBranch // See issue 37827.
@@ -2930,14 +3004,12 @@ func init() {
 			}
 			return b
 		},
-		env: []string{
-			"GO_TEST_TIMEOUT_SCALE=5", // give them lots of time
-		},
 		numTryTestHelpers: 4, // Target time is < 15 min for go.dev/issue/42661.
 	})
 	addBuilder(BuildConfig{
 		Name:              "linux-arm-aws",
 		HostType:          "host-linux-arm-aws",
+		SpeedClass:        SpeedMedium, // cmd/dist's default for GOARCH=arm
 		numTryTestHelpers: 1,
 		env: []string{
 			"GOARCH=arm",
@@ -2945,7 +3017,6 @@ func init() {
 			"GOHOSTARCH=arm",
 			"CGO_CFLAGS=-march=armv6",
 			"CGO_LDFLAGS=-march=armv6",
-			"GO_TEST_TIMEOUT_SCALE=2", // inherited from cmd/dist's default for GOARCH=arm
 		},
 	})
 	addBuilder(BuildConfig{
@@ -2979,6 +3050,7 @@ func init() {
 	addBuilder(BuildConfig{
 		FlakyNet:       true,
 		HostType:       "host-linux-mips64le-rtrk",
+		SpeedClass:     SpeedSlow, // at least cmd/dist's default for GOARCH=mips{,le,64,64le}
 		Name:           "linux-mips64le-rtrk",
 		SkipSnapshot:   true,
 		distTestAdjust: mipsDistTestPolicy,
@@ -2986,12 +3058,12 @@ func init() {
 		env: []string{
 			"GOARCH=mips64le",
 			"GOHOSTARCH=mips64le",
-			"GO_TEST_TIMEOUT_SCALE=4", // inherited from cmd/dist's default for GOARCH=mips{,le,64,64le}
 		},
 	})
 	addBuilder(BuildConfig{
 		FlakyNet:       true,
 		HostType:       "host-linux-mips64le-rtrk",
+		SpeedClass:     SpeedSlow, // at least cmd/dist's default for GOARCH=mips{,le,64,64le}
 		Name:           "linux-mipsle-rtrk",
 		SkipSnapshot:   true,
 		distTestAdjust: mipsDistTestPolicy,
@@ -2999,12 +3071,12 @@ func init() {
 		env: []string{
 			"GOARCH=mipsle",
 			"GOHOSTARCH=mipsle",
-			"GO_TEST_TIMEOUT_SCALE=4", // inherited from cmd/dist's default for GOARCH=mips{,le,64,64le}
 		},
 	})
 	addBuilder(BuildConfig{
 		FlakyNet:       true,
 		HostType:       "host-linux-mips64-rtrk",
+		SpeedClass:     SpeedSlow, // at least cmd/dist's default for GOARCH=mips{,le,64,64le}
 		Name:           "linux-mips64-rtrk",
 		SkipSnapshot:   true,
 		distTestAdjust: mipsDistTestPolicy,
@@ -3012,12 +3084,12 @@ func init() {
 		env: []string{
 			"GOARCH=mips64",
 			"GOHOSTARCH=mips64",
-			"GO_TEST_TIMEOUT_SCALE=4", // inherited from cmd/dist's default for GOARCH=mips{,le,64,64le}
 		},
 	})
 	addBuilder(BuildConfig{
 		FlakyNet:       true,
 		HostType:       "host-linux-mips64-rtrk",
+		SpeedClass:     SpeedSlow, // at least cmd/dist's default for GOARCH=mips{,le,64,64le}
 		Name:           "linux-mips-rtrk",
 		SkipSnapshot:   true,
 		distTestAdjust: mipsDistTestPolicy,
@@ -3025,15 +3097,14 @@ func init() {
 		env: []string{
 			"GOARCH=mips",
 			"GOHOSTARCH=mips",
-			"GO_TEST_TIMEOUT_SCALE=4", // inherited from cmd/dist's default for GOARCH=mips{,le,64,64le}
 		},
 	})
 	addBuilder(BuildConfig{
 		HostType:       "host-linux-riscv64-joelsing",
+		SpeedClass:     SpeedSlow,
 		Name:           "linux-riscv64-jsing",
 		SkipSnapshot:   true,
 		FlakyNet:       true,
-		env:            []string{"GO_TEST_TIMEOUT_SCALE=4"},
 		distTestAdjust: riscvDistTestPolicy,
 		buildsRepo: func(repo, branch, goBranch string) bool {
 			switch repo {
@@ -3046,8 +3117,8 @@ func init() {
 	})
 	addBuilder(BuildConfig{
 		HostType:       "host-linux-riscv64-unmatched",
+		SpeedClass:     SpeedSlow,
 		Name:           "linux-riscv64-unmatched",
-		env:            []string{"GO_TEST_TIMEOUT_SCALE=4"},
 		FlakyNet:       true,
 		distTestAdjust: riscvDistTestPolicy,
 		privateGoProxy: true, // this builder is behind firewall
@@ -3066,14 +3137,14 @@ func init() {
 		FlakyNet:       true,
 	})
 	addBuilder(BuildConfig{
-		Name:     "linux-s390x-ibm-race",
-		HostType: "host-linux-s390x",
-		Notes:    "Only runs -race tests (./race.bash)",
-		FlakyNet: true,
+		Name:       "linux-s390x-ibm-race",
+		HostType:   "host-linux-s390x",
+		SpeedClass: SpeedMedium,
+		Notes:      "Only runs -race tests (./race.bash)",
+		FlakyNet:   true,
 		buildsRepo: func(repo, branch, goBranch string) bool {
 			return repo == "go" && goBranch == "master"
 		},
-		env: []string{"GO_TEST_TIMEOUT_SCALE=2"},
 	})
 	addBuilder(BuildConfig{
 		Name:        "linux-s390x-crosscompile",
@@ -3106,6 +3177,7 @@ func init() {
 	addBuilder(BuildConfig{
 		Name:           "freebsd-arm-paulzhol",
 		HostType:       "host-freebsd-arm-paulzhol",
+		SpeedClass:     SpeedEmulated, // GO_TEST_TIMEOUT_SCALE=8 in builder's local environment as of 2022-12-06
 		distTestAdjust: noTestDirAndNoReboot,
 		SkipSnapshot:   true,
 		FlakyNet:       true,
@@ -3122,7 +3194,6 @@ func init() {
 		env: []string{
 			"GOARM=7",
 			"CGO_ENABLED=1",
-			"GO_TEST_TIMEOUT_SCALE=8", // from builder's local environment as of 2022-12-06
 		},
 	})
 	addBuilder(BuildConfig{
@@ -3132,7 +3203,7 @@ func init() {
 	addBuilder(BuildConfig{
 		Name:           "freebsd-riscv64-unmatched",
 		HostType:       "host-freebsd-riscv64-unmatched",
-		env:            []string{"GO_TEST_TIMEOUT_SCALE=4"},
+		SpeedClass:     SpeedSlow,
 		FlakyNet:       true,
 		distTestAdjust: riscvDistTestPolicy,
 		privateGoProxy: true, // this builder is behind firewall
@@ -3148,12 +3219,10 @@ func init() {
 	addBuilder(BuildConfig{
 		Name:           "plan9-arm",
 		HostType:       "host-plan9-arm-0intro",
+		SpeedClass:     SpeedSlow, // GO_TEST_TIMEOUT_SCALE=3 in builder's local environment as of 2022-12-06
 		distTestAdjust: noTestDirAndNoReboot,
 		buildsRepo:     plan9Default,
 		KnownIssues:    []int{49338},
-		env: []string{
-			"GO_TEST_TIMEOUT_SCALE=3", // from builder's local environment as of 2022-12-06
-		},
 	})
 	addBuilder(BuildConfig{
 		Name:     "plan9-amd64-0intro",
@@ -3341,6 +3410,12 @@ func addBuilder(c BuildConfig) {
 			panic(fmt.Errorf("config %q's KnownIssues slice has a zero issue at index %d", c.Name, i))
 		}
 	}
+	if _, ok := speedScales[c.SpeedClass]; c.SpeedClass != "" && !ok {
+		panic(fmt.Sprintf("config %q has unknown SpeedClass %q", c.Name, c.SpeedClass))
+	}
+	if setsTimeoutScale(c.env) {
+		panic(fmt.Sprintf("config %q sets GO_TEST_TIMEOUT_SCALE; use SpeedClass", c.Name))
+	}
 
 	types := 0
 	for _, fn := range []func() bool{c.IsReverse, c.IsContainer, c.IsVM} {
@@ -43,27 +43,15 @@ func TestDistTestsExecTimeout(t *testing.T) {
 		},
 		{
 			&BuildConfig{
-				env:          []string{"GO_TEST_TIMEOUT_SCALE=2"},
-				TestHostConf: &HostConfig{},
+				TestHostConf: &HostConfig{SpeedClass: SpeedSlow},
 			},
-			40 * time.Minute,
+			100 * time.Minute,
 		},
+		// BuildConfig's speed class takes precedence:
 		{
 			&BuildConfig{
-				env: []string{},
-				TestHostConf: &HostConfig{
-					env: []string{"GO_TEST_TIMEOUT_SCALE=3"},
-				},
-			},
-			60 * time.Minute,
-		},
-		// BuildConfig's env takes precedence:
-		{
-			&BuildConfig{
-				env: []string{"GO_TEST_TIMEOUT_SCALE=2"},
-				TestHostConf: &HostConfig{
-					env: []string{"GO_TEST_TIMEOUT_SCALE=3"},
-				},
+				SpeedClass:   SpeedMedium,
+				TestHostConf: &HostConfig{SpeedClass: SpeedSlow},
 			},
 			40 * time.Minute,
 		},
@@ -76,6 +64,39 @@ func TestDistTestsExecTimeout(t *testing.T) {
 	}
 }
 
+// TestSpeedClassEnv tests that the timeout scale of a builder's speed
+// class is passed on to cmd/dist.
+func TestSpeedClassEnv(t *testing.T) {
+	tests := []struct {
+		builder string
+		want    string // GO_TEST_TIMEOUT_SCALE values in Env, comma-separated
+	}{
+		{"linux-amd64", ""},
+		{"linux-arm-aws", "2"},
+		{"linux-mips-rtrk", "5"},
+		{"linux-riscv64-unmatched", "5"},
+		{"linux-amd64-longtest", "5"},
+		{"windows-amd64-race", "2"},
+		{"netbsd-arm-bsiegert", "10"},
+	}
+	for _, tt := range tests {
+		c, ok := Builders[tt.builder]
+		if !ok {
+			t.Errorf("unknown builder %q", tt.builder)
+			continue
+		}
+		var vals []string
+		for _, kv := range c.Env() {
+			if v, ok := strings.CutPrefix(kv, "GO_TEST_TIMEOUT_SCALE="); ok {
+				vals = append(vals, v)
+			}
+		}
+		if got := strings.Join(vals, ","); got != tt.want {
+			t.Errorf("%s: GO_TEST_TIMEOUT_SCALE values in Env = %q; want %q", tt.builder, got, tt.want)
+		}
+	}
+}
+
 // TestTrybots tests that a given repo & its branch yields the provided complete
 // set of builders. See also: TestPostSubmit, which tests only post-submit
 // builders, and TestBuilderConfig, which tests both trybots and post-submit
@@ -1404,6 +1425,37 @@ func TestWindowsCCSetup(t *testing.T) {
 	}
 }
 
+func TestBuildConfigEnvProfile(t *testing.T) {
+	for key, p := range EnvProfiles {
+		if p.Name != key {
+			t.Errorf("EnvProfiles[%q].Name = %q; want %q", key, p.Name, key)
+		}
+	}
+	c := &BuildConfig{Name: "test", TestHostConf: &HostConfig{}}
+	if p := c.EnvProfile(); p != nil {
+		t.Errorf("EnvProfile() with no profile = %+v; want nil", p)
+	}
+	c.TestHostConf.EnvProfile = "unix-hermetic"
+	if p := c.EnvProfile(); p != EnvProfiles["unix-hermetic"] {
+		t.Errorf("EnvProfile() = %+v; want unix-hermetic profile", p)
+	}
+}
+
+func TestHostEnvProfiles(t *testing.T) {
+	for _, hc := range Hosts {
+		if hc.EnvProfile == "unix-hermetic" && !hc.IsContainer() {
+			t.Errorf("host %q uses the unix-hermetic profile, which is only for container hosts with known images", hc.HostType)
+		}
+	}
+	// The main TryBot hosts report what they'd lose under
+	// unix-hermetic before moving to it.
+	for _, name := range []string{"linux-amd64", "linux-arm64"} {
+		if p := Builders[name].EnvProfile(); p == nil || p.Name != "unix" {
+			t.Errorf("%s EnvProfile() = %+v; want unix", name, p)
+		}
+	}
+}
+
 // listPorts lists supported Go ports
 // found by running go tool dist list.
 func listPorts() ([]string, error) {
@@ -0,0 +1,279 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/build/maintner"
+	"golang.org/x/build/maintner/maintnerd/maintapi/version"
+)
+
+// backportTitleRE matches the titles of backport issues, as opened by
+// gopherbot, capturing the release they're for. For example,
+// "net/http: fix a crash [1.21 backport]".
+var backportTitleRE = regexp.MustCompile(`\[(1\.\d+) backport\]$`)
+
+// The states of a backport issue, in the order of the attention they
+// need before a minor release.
+const (
+	backportReady     = "ready"     // approved, and a cherry-pick CL is approved but not submitted
+	backportMissing   = "missing"   // approved, but there's no cherry-pick CL
+	backportInReview  = "in review" // a cherry-pick CL is in review
+	backportCandidate = "candidate" // not yet approved, and there's no cherry-pick CL
+	backportSubmitted = "submitted" // a cherry-pick CL is submitted
+)
+
+var backportStateRank = map[string]int{
+	backportReady:     0,
+	backportMissing:   1,
+	backportInReview:  2,
+	backportCandidate: 3,
+	backportSubmitted: 4,
+}
+
+type backportsData struct {
+	LastUpdated string            `json:"lastUpdated"`
+	Branches    []*backportBranch `json:"branches"` // latest release first
+
+	// dirty is set if this data needs to be updated due to a corpus change.
+	dirty bool
+}
+
+// A backportBranch is the backport status of an open release branch.
+type backportBranch struct {
+	Release string           `json:"release"` // "1.21"
+	Branch  string           `json:"branch"`  // "release-branch.go1.21"
+	Issues  []*backportIssue `json:"issues"`  // most in need of attention first
+
+	// The numbers of Issues that are ready to submit or missing
+	// their cherry-pick CL.
+	Ready   int `json:"ready"`
+	Missing int `json:"missing"`
+}
+
+// A backportIssue is an open backport issue and the cherry-pick CLs
+// that reference it on its release branch.
+type backportIssue struct {
+	Number    int32           `json:"number"`
+	Title     string          `json:"title"`
+	Milestone string          `json:"milestone,omitempty"`
+	Approved  bool            `json:"approved"` // labeled CherryPickApproved
+	State     string          `json:"state"`    // one of the backport* constants
+	CLs       []*cherryPickCL `json:"cls"`
+
+	branch string
+}
+
+// A cherryPickCL is a CL on a release branch.
+type cherryPickCL struct {
+	Number  int32  `json:"number"`
+	Subject string `json:"subject"`
+	Status  string `json:"status"`  // "new", "merged" or "abandoned"
+	PlusTwo bool   `json:"plusTwo"` // has a Code-Review +2 vote
+}
+
+// backportState returns the state of a backport issue, which is
+// approved for cherry-picking if approved, given its cherry-pick CLs.
+// A backport is only ready to submit once the issue is approved, even
+// if its cherry-pick CL already has a +2.
+func backportState(approved bool, cls []*cherryPickCL) string {
+	var inReview, ready bool
+	for _, cl := range cls {
+		switch cl.Status {
+		case "merged":
+			return backportSubmitted
+		case "new":
+			inReview = true
+			ready = ready || cl.PlusTwo
+		}
+	}
+	switch {
+	case ready && approved:
+		return backportReady
+	case inReview:
+		return backportInReview
+	case approved:
+		return backportMissing
+	}
+	return backportCandidate
+}
+
+// openReleases returns the Go releases, such as "1.21", whose release
+// branches get backports: the two latest major releases among refs,
+// latest first.
+func openReleases(refs []string) []string {
+	branches := make(map[int]bool)
+	released := make(map[int]bool)
+	for _, ref := range refs {
+		switch {
+		case strings.HasPrefix(ref, "refs/heads/release-branch.go"):
+			if major, minor, ok := version.ParseReleaseBranch(strings.TrimPrefix(ref, "refs/heads/")); ok && major == 1 {
+				branches[minor] = true
+			}
+		case strings.HasPrefix(ref, "refs/tags/go"):
+			if major, minor, _, ok := version.ParseTag(strings.TrimPrefix(ref, "refs/tags/")); ok && major == 1 {
+				released[minor] = true
+			}
+		}
+	}
+	var minors []int
+	for m := range branches {
+		if released[m] {
+			minors = append(minors, m)
+		}
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(minors)))
+	if len(minors) > 2 {
+		minors = minors[:2]
+	}
+	var rels []string
+	for _, m := range minors {
+		rels = append(rels, fmt.Sprintf("1.%d", m))
+	}
+	return rels
+}
+
+func (s *server) updateBackportsData() error {
+	log.Println("Updating backports data ...")
+	s.cMu.Lock()
+	defer s.cMu.Unlock()
+
+	var refs []string
+	s.proj.ForeachNonChangeRef(func(ref string, _ maintner.GitHash) error {
+		refs = append(refs, ref)
+		return nil
+	})
+	var branches []*backportBranch
+	releaseBranch := make(map[string]*backportBranch)
+	for _, rel := range openReleases(refs) {
+		b := &backportBranch{Release: rel, Branch: "release-branch.go" + rel}
+		branches = append(branches, b)
+		releaseBranch[rel] = b
+	}
+
+	issues := make(map[int32]*backportIssue)
+	s.repo.ForeachIssue(func(gi *maintner.GitHubIssue) error {
+		if gi.Closed || gi.PullRequest || gi.NotExist {
+			return nil
+		}
+		m := backportTitleRE.FindStringSubmatch(gi.Title)
+		if m == nil || releaseBranch[m[1]] == nil {
+			return nil
+		}
+		bi := &backportIssue{
+			Number:   gi.Number,
+			Title:    gi.Title,
+			Approved: gi.HasLabel("CherryPickApproved"),
+			branch:   releaseBranch[m[1]].Branch,
+		}
+		if !gi.Milestone.IsNone() && !gi.Milestone.IsUnknown() {
+			bi.Milestone = gi.Milestone.Title
+		}
+		releaseBranch[m[1]].Issues = append(releaseBranch[m[1]].Issues, bi)
+		issues[gi.Number] = bi
+		return nil
+	})
+
+	err := s.proj.ForeachCLUnsorted(withoutDeletedCLs(s.proj, func(cl *maintner.GerritCL) error {
+		if !strings.HasPrefix(cl.Branch(), "release-branch.go") {
+			return nil
+		}
+		var cp *cherryPickCL
+		for _, ref := range cl.GitHubIssueRefs {
+			bi := issues[ref.Number]
+			if bi == nil || ref.Repo != s.repo || bi.branch != cl.Branch() {
+				continue
+			}
+			if cp == nil {
+				cp = &cherryPickCL{Number: cl.Number, Subject: cl.Subject(), Status: cl.Status}
+				if len(cl.Metas) > 0 {
+					votes, err := cl.Metas[len(cl.Metas)-1].LabelVotes()
+					if err != nil {
+						return fmt.Errorf("error updating backports data for CL %d: %v", cl.Number, err)
+					}
+					for _, v := range votes["Code-Review"] {
+						cp.PlusTwo = cp.PlusTwo || v == 2
+					}
+				}
+			}
+			bi.CLs = append(bi.CLs, cp)
+		}
+		return nil
+	}))
+	if err != nil {
+		return err
+	}
+
+	for _, b := range branches {
+		for _, bi := range b.Issues {
+			sort.Slice(bi.CLs, func(i, j int) bool { return bi.CLs[i].Number < bi.CLs[j].Number })
+			bi.State = backportState(bi.Approved, bi.CLs)
+			switch bi.State {
+			case backportReady:
+				b.Ready++
+			case backportMissing:
+				b.Missing++
+			}
+		}
+		sort.Slice(b.Issues, func(i, j int) bool {
+			x, y := b.Issues[i], b.Issues[j]
+			if rx, ry := backportStateRank[x.State], backportStateRank[y.State]; rx != ry {
+				return rx < ry
+			}
+			return x.Number < y.Number
+		})
+	}
+	s.data.backports.Branches = branches
+	s.data.backports.LastUpdated = time.Now().UTC().Format(time.UnixDate)
+	s.data.backports.dirty = false
+	return nil
+}
+
+// handleBackports serves dev.golang.org/backports, and its data as
+// JSON at /backports.json.
+func (s *server) handleBackports(t *template.Template, w http.ResponseWriter, r *http.Request) {
+	s.cMu.RLock()
+	dirty := s.data.backports.dirty
+	s.cMu.RUnlock()
+	if dirty {
+		if err := s.updateBackportsData(); err != nil {
+			log.Println("updateBackportsData:", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	s.cMu.RLock()
+	defer s.cMu.RUnlock()
+	var buf bytes.Buffer
+	if strings.HasSuffix(r.URL.Path, ".json") {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(&buf).Encode(s.data.backports); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	} else {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := t.Execute(&buf, s.data.backports); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	if _, err := io.Copy(w, &buf); err != nil {
+		log.Printf("io.Copy(w, %+v) = %v", buf, err)
+	}
+}
@@ -0,0 +1,101 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"html/template"
+	"io"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestBackportState(t *testing.T) {
+	open := &cherryPickCL{Status: "new"}
+	approved := &cherryPickCL{Status: "new", PlusTwo: true}
+	merged := &cherryPickCL{Status: "merged", PlusTwo: true}
+	abandoned := &cherryPickCL{Status: "abandoned"}
+	for _, tt := range []struct {
+		approved bool
+		cls      []*cherryPickCL
+		want     string
+	}{
+		{false, nil, backportCandidate},
+		{true, nil, backportMissing},
+		{true, []*cherryPickCL{abandoned}, backportMissing},
+		{false, []*cherryPickCL{open}, backportInReview},
+		{true, []*cherryPickCL{abandoned, open}, backportInReview},
+		{true, []*cherryPickCL{open, approved}, backportReady},
+		{false, []*cherryPickCL{approved}, backportInReview},
+		{true, []*cherryPickCL{approved}, backportReady},
+		{true, []*cherryPickCL{approved, merged}, backportSubmitted},
+	} {
+		if got := backportState(tt.approved, tt.cls); got != tt.want {
+			var statuses []string
+			for _, cl := range tt.cls {
+				statuses = append(statuses, cl.Status)
+			}
+			t.Errorf("backportState(%v, %v) = %q, want %q", tt.approved, statuses, got, tt.want)
+		}
+	}
+}
+
+func TestBackportTitle(t *testing.T) {
+	for _, tt := range []struct {
+		title, want string
+	}{
+		{"net/http: fix a crash [1.21 backport]", "1.21"},
+		{"cmd/go: [1.20 backport] in the middle", ""},
+		{"runtime: crash on go1.21", ""},
+	} {
+		var got string
+		if m := backportTitleRE.FindStringSubmatch(tt.title); m != nil {
+			got = m[1]
+		}
+		if got != tt.want {
+			t.Errorf("release of %q = %q, want %q", tt.title, got, tt.want)
+		}
+	}
+}
+
+func TestOpenReleases(t *testing.T) {
+	refs := []string{
+		"refs/heads/master",
+		"refs/heads/release-branch.go1.19",
+		"refs/heads/release-branch.go1.20",
+		"refs/heads/release-branch.go1.21",
+		"refs/heads/release-branch.go1.22", // not yet released
+		"refs/tags/go1.19.13",
+		"refs/tags/go1.20",
+		"refs/tags/go1.20.8",
+		"refs/tags/go1.21.1",
+		"refs/tags/go1.22rc1",
+		"refs/tags/weekly.2011-11-18",
+	}
+	if diff := cmp.Diff([]string{"1.21", "1.20"}, openReleases(refs)); diff != "" {
+		t.Errorf("openReleases mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestBackportsTemplate(t *testing.T) {
+	tmpl := template.Must(template.ParseFiles("templates/backports.tmpl"))
+	data := backportsData{
+		LastUpdated: "now",
+		Branches: []*backportBranch{
+			{Release: "1.21", Branch: "release-branch.go1.21", Ready: 1, Issues: []*backportIssue{{
+				Number:    1,
+				Title:     "net/http: fix a crash [1.21 backport]",
+				Milestone: "Go1.21.2",
+				Approved:  true,
+				State:     backportReady,
+				CLs:       []*cherryPickCL{{Number: 2, Subject: "[release-branch.go1.21] net/http: fix a crash", Status: "new", PlusTwo: true}},
+			}}},
+			{Release: "1.20", Branch: "release-branch.go1.20"},
+		},
+	}
+	if err := tmpl.Execute(io.Discard, data); err != nil {
+		t.Error(err)
+	}
+}
@@ -22,6 +22,8 @@ var (
 	staticDir   = flag.String("static-dir", "./static/", "location of static directory relative to binary location")
 	templateDir = flag.String("template-dir", "./templates/", "location of templates directory relative to binary location")
 	reload      = flag.Bool("reload", false, "reload content on each page load")
+
+	releaseStatusURL = flag.String("release-status-url", "", "if non-empty, URL of the release status JSON published by relui, shown on the release dashboard")
 )
 
 func init() {
@@ -37,11 +39,14 @@ func main() {
 	rand.Seed(time.Now().UnixNano())
 
 	s := newServer(http.NewServeMux(), *staticDir, *templateDir, *reload)
+	s.releaseStatusURL = *releaseStatusURL
 	ctx := context.Background()
 	if err := s.initCorpus(ctx); err != nil {
 		log.Fatalf("Could not init corpus: %v", err)
 	}
 	go s.corpusUpdateLoop(ctx)
 
-	log.Fatalln(https.ListenAndServe(ctx, s))
+	if err := https.ListenAndServe(ctx, s); err != nil {
+		log.Fatalln(err)
+	}
 }
@@ -78,6 +78,16 @@ func match(path string) *Entry {
 	return entries[deepestPath]
 }
 
+// Match returns the owners of path, the repo name and full path of a
+// file or directory within that repo, such as
+// "go/src/runtime/trace/trace.go". It's the deepest entry in the file
+// hierarchy of path, or nil if there's none.
+//
+// The returned Entry must not be modified.
+func Match(path string) *Entry {
+	return match(path)
+}
+
 // hasPathPrefix reports whether the slash-separated path s
 // begins with the elements in prefix.
 //
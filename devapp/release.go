@@ -18,8 +18,10 @@ import (
 	"strings"
 	"time"
 
+	"golang.org/x/build/internal/releasestatus"
 	"golang.org/x/build/maintner"
 	"golang.org/x/build/maintner/maintnerd/maintapi/version"
+	"golang.org/x/build/types"
 )
 
 const (
@@ -545,9 +547,20 @@ func (s *server) handleRelease(t *template.Template, w http.ResponseWriter, r *h
 		s.updateReleaseData()
 	}
 
+	// Fetch the release status before taking the lock,
+	// so that a slow response doesn't block corpus updates.
+	var releases []types.ReleaseWorkflowStatus
+	if st := releasestatus.Get(r.Context(), s.releaseStatusURL); st != nil {
+		releases = st.Workflows
+	}
+
 	s.cMu.RLock()
 	defer s.cMu.RUnlock()
-	if err := t.Execute(w, s.data.release); err != nil {
+	data := struct {
+		releaseData
+		Releases []types.ReleaseWorkflowStatus // In-progress release workflows.
+	}{s.data.release, releases}
+	if err := t.Execute(w, data); err != nil {
 		log.Printf("t.Execute(w, nil) = %v", err)
 		return
 	}
@@ -15,6 +15,7 @@ import (
 	"strings"
 	"time"
 
+	"golang.org/x/build/devapp/owners"
 	"golang.org/x/build/internal/foreach"
 	"golang.org/x/build/internal/gophers"
 	"golang.org/x/build/maintner"
@@ -52,6 +53,13 @@ type change struct {
 	TryBotPlusOne    bool
 	SearchTerms      string
 	ReleaseMilestone string
+
+	// Reviewers are the Gerrit emails of the CL's reviewers, other
+	// than its owner.
+	Reviewers []string
+	// SuggestedReviewers are the reviewers suggested for the CL,
+	// best first.
+	SuggestedReviewers []*reviewerSuggestion
 }
 
 type reviewsData struct {
@@ -128,9 +136,20 @@ func (s *server) updateReviewsData() error {
 		projects     []*project
 		totalChanges int
 	)
+	st := &reviewerStats{open: make(map[string]int), recent: make(map[string]int)}
+	cutoff := time.Now().Add(-recentActivityWindow)
 	err := s.corpus.Gerrit().ForeachProjectUnsorted(filterProjects(func(p *maintner.GerritProject) error {
 		proj := &project{GerritProject: p}
-		err := p.ForeachOpenCL(withoutDeletedCLs(p, func(cl *maintner.GerritCL) error {
+		err := p.ForeachCLUnsorted(withoutDeletedCLs(p, func(cl *maintner.GerritCL) error {
+			if cl.Owner() != nil && len(cl.Messages) > 0 && !cl.Messages[len(cl.Messages)-1].Date.Before(cutoff) {
+				st.addRecentActivity(cl, cutoff)
+			}
+			return nil
+		}))
+		if err != nil {
+			return err
+		}
+		err = p.ForeachOpenCL(withoutDeletedCLs(p, func(cl *maintner.GerritCL) error {
 			if cl.WorkInProgress() ||
 				cl.Owner() == nil ||
 				strings.Contains(cl.Commit.Msg, "DO NOT REVIEW") {
@@ -170,6 +189,14 @@ func (s *server) updateReviewsData() error {
 			}
 
 			searchTerms = append(searchTerms, searchTermsFromReviewerFields(cl)...)
+			reviewers, _ := reviewerFields(cl)
+			for id := range reviewers {
+				if email := gerritEmail(id); email != "" && email != cl.Owner().Email() {
+					c.Reviewers = append(c.Reviewers, email)
+					st.open[email]++
+				}
+			}
+			sort.Strings(c.Reviewers)
 			labelVotes, err := cl.Metas[len(cl.Metas)-1].LabelVotes()
 			if err != nil {
 				return fmt.Errorf("error updating review data for CL %d: %v", cl.Number, err)
@@ -231,6 +258,15 @@ func (s *server) updateReviewsData() error {
 	sort.Slice(projects, func(i, j int) bool {
 		return projects[i].Project() < projects[j].Project()
 	})
+	// Suggest reviewers once the review load of everyone is known.
+	for _, p := range projects {
+		for _, c := range p.Changes {
+			c.SuggestedReviewers = suggestReviewers(clPaths(p.Project(), c.GerritCL), c.Owner().Email(), st, owners.Match)
+			if len(c.Reviewers) == 0 && len(c.SuggestedReviewers) > 0 {
+				c.SearchTerms += " t:unassigned"
+			}
+		}
+	}
 	s.data.reviews.Projects = projects
 	s.data.reviews.TotalChanges = totalChanges
 	s.data.reviews.dirty = false
@@ -239,25 +275,19 @@ func (s *server) updateReviewsData() error {
 
 // hasHumanComments reports whether cl has any comments from a human on it.
 func hasHumanComments(cl *maintner.GerritCL) bool {
-	const (
-		gobotID     = "5976@62eb7196-b449-3ce5-99f1-c037f21e1705"
-		gerritbotID = "12446@62eb7196-b449-3ce5-99f1-c037f21e1705"
-	)
-
 	for _, m := range cl.Messages {
-		if email := m.Author.Email(); email != gobotID && email != gerritbotID {
+		if !m.Author.IsBot() {
 			return true
 		}
 	}
 	return false
 }
 
-// searchTermsFromReviewerFields returns a slice of terms generated from
-// the reviewer and cc fields of a Gerrit change.
-func searchTermsFromReviewerFields(cl *maintner.GerritCL) []string {
-	var searchTerms []string
-	reviewers := make(map[string]bool)
-	ccs := make(map[string]bool)
+// reviewerFields returns the Gerrit IDs of the reviewers and CCs of a
+// Gerrit change.
+func reviewerFields(cl *maintner.GerritCL) (reviewers, ccs map[string]bool) {
+	reviewers = make(map[string]bool)
+	ccs = make(map[string]bool)
 	for _, m := range cl.Metas {
 		if !strings.Contains(m.Commit.Msg, "Reviewer:") &&
 			!strings.Contains(m.Commit.Msg, "CC:") &&
@@ -284,6 +314,14 @@ func searchTermsFromReviewerFields(cl *maintner.GerritCL) []string {
 			return nil
 		})
 	}
+	return reviewers, ccs
+}
+
+// searchTermsFromReviewerFields returns a slice of terms generated from
+// the reviewer and cc fields of a Gerrit change.
+func searchTermsFromReviewerFields(cl *maintner.GerritCL) []string {
+	var searchTerms []string
+	reviewers, ccs := reviewerFields(cl)
 	for r := range reviewers {
 		if p := gophers.GetPerson(r); p != nil && p.Gerrit != cl.Owner().Email() {
 			searchTerms = append(searchTerms, "involves:"+p.Gerrit)
@@ -31,6 +31,10 @@ type server struct {
 	templateDir string
 	reloadTmpls bool
 
+	// releaseStatusURL is the URL of the release status JSON
+	// published by relui. Optional.
+	releaseStatusURL string
+
 	cMu              sync.RWMutex // Used to protect the fields below.
 	corpus           *maintner.Corpus
 	repo             *maintner.GitHubRepo    // The golang/go repo.
@@ -50,9 +54,10 @@ type issueData struct {
 }
 
 type pageData struct {
-	release releaseData
-	reviews reviewsData
-	stats   statsData
+	backports backportsData
+	release   releaseData
+	reviews   reviewsData
+	stats     statsData
 }
 
 func newServer(mux *http.ServeMux, staticDir, templateDir string, reloadTmpls bool) *server {
@@ -65,8 +70,12 @@ func newServer(mux *http.ServeMux, staticDir, templateDir string, reloadTmpls bo
 	}
 	s.mux.Handle("/", http.FileServer(http.Dir(s.staticDir)))
 	s.mux.HandleFunc("/favicon.ico", s.handleFavicon)
+	backports := s.withTemplate("/backports.tmpl", s.handleBackports)
+	s.mux.HandleFunc("/backports", backports)
+	s.mux.HandleFunc("/backports.json", backports)
 	s.mux.HandleFunc("/release", s.withTemplate("/release.tmpl", s.handleRelease))
 	s.mux.HandleFunc("/reviews", s.withTemplate("/reviews.tmpl", s.handleReviews))
+	s.mux.HandleFunc("/reviews/suggest", s.handleSuggestReviewers)
 	s.mux.HandleFunc("/stats", s.withTemplate("/stats.tmpl", s.handleStats))
 	s.mux.HandleFunc("/dir/", handleDirRedirect)
 	s.mux.HandleFunc("/owners", owners.Handler)
@@ -118,6 +127,7 @@ func (s *server) corpusUpdateLoop(ctx context.Context) {
 		log.Println("Updating activities ...")
 		s.updateActivities()
 		s.cMu.Lock()
+		s.data.backports.dirty = true
 		s.data.release.dirty = true
 		s.data.reviews.dirty = true
 		s.data.stats.dirty = true
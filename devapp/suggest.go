@@ -0,0 +1,190 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"golang.org/x/build/devapp/owners"
+	"golang.org/x/build/internal/gophers"
+	"golang.org/x/build/maintner"
+)
+
+// Reviewer suggestions are owners of the files a CL changes, weighted
+// so that reviews are spread among the owners who are around.
+const (
+	// maxSuggestions is the number of reviewers suggested per CL.
+	maxSuggestions = 3
+	// recentActivityWindow is how far back recent review activity
+	// is counted.
+	recentActivityWindow = 30 * 24 * time.Hour
+	// secondaryOwnerWeight is the weight of a secondary owner of a
+	// file, relative to a primary owner.
+	secondaryOwnerWeight = 0.5
+	// inactiveWeight is the weight of an owner with no recent review
+	// activity, who may be away, relative to an active one.
+	inactiveWeight = 0.25
+)
+
+// A reviewerSuggestion is a reviewer suggested for a CL.
+type reviewerSuggestion struct {
+	Email string  `json:"email"` // Gerrit email
+	Score float64 `json:"score"` // higher is better
+	// OpenReviews is the number of open CLs the reviewer is a
+	// reviewer of.
+	OpenReviews int `json:"openReviews"`
+	// RecentReviews is the number of messages the reviewer left on
+	// others' CLs within recentActivityWindow.
+	RecentReviews int `json:"recentReviews"`
+}
+
+// reviewerStats are the review load and recent review activity of
+// people, by Gerrit email.
+type reviewerStats struct {
+	open   map[string]int
+	recent map[string]int
+}
+
+// gerritEmail returns the Gerrit email of the person with the given
+// Gerrit ID, such as "5206@62eb7196-b449-3ce5-99f1-c037f21e1705",
+// or "" if they're unknown.
+func gerritEmail(id string) string {
+	if p := gophers.GetPerson(id); p != nil {
+		return p.Gerrit
+	}
+	return ""
+}
+
+// addRecentActivity counts the review messages left on cl since cutoff.
+func (st *reviewerStats) addRecentActivity(cl *maintner.GerritCL, cutoff time.Time) {
+	owner := cl.Owner().Email()
+	for _, m := range cl.Messages {
+		if m.Date.Before(cutoff) || m.Author.IsBot() {
+			continue
+		}
+		if email := gerritEmail(m.Author.Email()); email != "" && email != owner {
+			st.recent[email]++
+		}
+	}
+}
+
+// suggestReviewers suggests reviewers for a CL by owner that changes
+// paths, the repo name and full path of each file. Each candidate is
+// scored by the share of paths they own, weighted down by their open
+// review load and if they have no recent review activity.
+func suggestReviewers(paths []string, owner string, st *reviewerStats, match func(path string) *owners.Entry) []*reviewerSuggestion {
+	if len(paths) == 0 {
+		return nil
+	}
+	ownership := make(map[string]float64)
+	for _, path := range paths {
+		e := match(path)
+		if e == nil {
+			continue
+		}
+		for _, o := range e.Primary {
+			ownership[o.GerritEmail] += 1 / float64(len(paths))
+		}
+		for _, o := range e.Secondary {
+			ownership[o.GerritEmail] += secondaryOwnerWeight / float64(len(paths))
+		}
+	}
+	var suggestions []*reviewerSuggestion
+	for email, share := range ownership {
+		if email == "" || email == owner { // teams have no Gerrit email
+			continue
+		}
+		s := &reviewerSuggestion{
+			Email:         email,
+			OpenReviews:   st.open[email],
+			RecentReviews: st.recent[email],
+		}
+		s.Score = share / float64(1+s.OpenReviews)
+		if s.RecentReviews == 0 {
+			s.Score *= inactiveWeight
+		}
+		suggestions = append(suggestions, s)
+	}
+	sort.Slice(suggestions, func(i, j int) bool {
+		if suggestions[i].Score != suggestions[j].Score {
+			return suggestions[i].Score > suggestions[j].Score
+		}
+		return suggestions[i].Email < suggestions[j].Email
+	})
+	if len(suggestions) > maxSuggestions {
+		suggestions = suggestions[:maxSuggestions]
+	}
+	return suggestions
+}
+
+// clPaths returns the repo name and full path of the files cl changes.
+func clPaths(project string, cl *maintner.GerritCL) []string {
+	var paths []string
+	for _, f := range cl.Commit.Files {
+		paths = append(paths, project+"/"+f.File)
+	}
+	return paths
+}
+
+// handleSuggestReviewers serves dev.golang.org/reviews/suggest, the
+// reviewers suggested for an open CL, as JSON. Its query parameters
+// are "cl", the CL number, and "repo", the Gerrit project, which
+// defaults to "go".
+func (s *server) handleSuggestReviewers(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	repo := r.FormValue("repo")
+	if repo == "" {
+		repo = "go"
+	}
+	number, err := strconv.ParseInt(r.FormValue("cl"), 10, 32)
+	if err != nil {
+		http.Error(w, "cl must be a CL number", http.StatusBadRequest)
+		return
+	}
+
+	s.cMu.RLock()
+	dirty := s.data.reviews.dirty
+	s.cMu.RUnlock()
+	if dirty {
+		if err := s.updateReviewsData(); err != nil {
+			log.Println("updateReviewsData:", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	s.cMu.RLock()
+	defer s.cMu.RUnlock()
+	for _, p := range s.data.reviews.Projects {
+		if p.Project() != repo {
+			continue
+		}
+		for _, c := range p.Changes {
+			if c.Number != int32(number) {
+				continue
+			}
+			suggestions := c.SuggestedReviewers
+			if suggestions == nil {
+				suggestions = []*reviewerSuggestion{}
+			}
+			w.Header().Set("Content-Type", "application/json")
+			if err := json.NewEncoder(w).Encode(struct {
+				Repo        string                `json:"repo"`
+				CL          int32                 `json:"cl"`
+				Reviewers   []string              `json:"reviewers"` // current reviewers
+				Suggestions []*reviewerSuggestion `json:"suggestions"`
+			}{repo, c.Number, c.Reviewers, suggestions}); err != nil {
+				log.Printf("handleSuggestReviewers: encoding response: %v", err)
+			}
+			return
+		}
+	}
+	http.Error(w, "no such open CL on the reviews dashboard", http.StatusNotFound)
+}
@@ -0,0 +1,87 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"path"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.org/x/build/devapp/owners"
+)
+
+func TestSuggestReviewers(t *testing.T) {
+	table := map[string]*owners.Entry{
+		"go/src/net/http": {
+			Primary:   []owners.Owner{{GerritEmail: "busy@golang.org"}, {GerritEmail: "free@golang.org"}},
+			Secondary: []owners.Owner{{GerritEmail: "second@golang.org"}},
+		},
+		"go/src/net": {
+			Primary: []owners.Owner{{GerritEmail: "away@golang.org"}, {GitHubUsername: "golang/net-team"}},
+		},
+	}
+	match := func(file string) *owners.Entry {
+		for p := file; p != "."; p = path.Dir(p) {
+			if e, ok := table[p]; ok {
+				return e
+			}
+		}
+		return nil
+	}
+	st := &reviewerStats{
+		open:   map[string]int{"busy@golang.org": 3, "free@golang.org": 0},
+		recent: map[string]int{"busy@golang.org": 10, "free@golang.org": 2, "second@golang.org": 1},
+	}
+
+	for _, tt := range []struct {
+		desc  string
+		paths []string
+		owner string
+		want  []string
+	}{
+		{
+			desc:  "least loaded owner first",
+			paths: []string{"go/src/net/http/server.go"},
+			owner: "someone@golang.org",
+			want:  []string{"free@golang.org", "second@golang.org", "busy@golang.org"},
+		},
+		{
+			desc:  "not the CL's owner",
+			paths: []string{"go/src/net/http/server.go"},
+			owner: "free@golang.org",
+			want:  []string{"second@golang.org", "busy@golang.org"},
+		},
+		{
+			// busy@ and away@ each own half the files, and are
+			// weighted down to the same score, so they're in order
+			// of email.
+			desc:  "loaded and inactive owners",
+			paths: []string{"go/src/net/http/server.go", "go/src/net/dial.go"},
+			owner: "someone@golang.org",
+			want:  []string{"free@golang.org", "second@golang.org", "away@golang.org"},
+		},
+		{
+			desc:  "only inactive owners",
+			paths: []string{"go/src/net/dial.go"},
+			owner: "someone@golang.org",
+			want:  []string{"away@golang.org"},
+		},
+		{
+			desc:  "no owners",
+			paths: []string{"tools/gopls/main.go"},
+			want:  nil,
+		},
+	} {
+		t.Run(tt.desc, func(t *testing.T) {
+			var got []string
+			for _, s := range suggestReviewers(tt.paths, tt.owner, st, match) {
+				got = append(got, s.Email)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("suggestReviewers(%q) mismatch (-want +got):\n%s", tt.paths, diff)
+			}
+		})
+	}
+}
@@ -45,6 +45,20 @@ func (ba basicAuth) setAuth(c *Client, r *http.Request) error {
 	return nil
 }
 
+// BasicAuthFunc is like BasicAuth, but calls fn for the username and
+// password of each request, so that they can change, for example when
+// the password is rotated.
+func BasicAuthFunc(fn func() (username, password string)) Auth {
+	return basicAuthFunc(fn)
+}
+
+type basicAuthFunc func() (username, password string)
+
+func (fn basicAuthFunc) setAuth(c *Client, r *http.Request) error {
+	r.SetBasicAuth(fn())
+	return nil
+}
+
 // GitCookiesAuth derives the Gerrit authentication token from
 // gitcookies based on the URL of the Gerrit request.
 // The cookie file used is determined by running "git config
@@ -46,6 +46,32 @@ func TestBasicAuth(t *testing.T) {
 	}
 }
 
+func TestBasicAuthFunc(t *testing.T) {
+	var got []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u, p, _ := r.BasicAuth()
+		got = append(got, u+" "+p)
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		fmt.Fprintln(w, ")]}")
+		json.NewEncoder(w).Encode(AccountInfo{})
+	}))
+	defer ts.Close()
+
+	password := "Password1"
+	c := NewClient(ts.URL, BasicAuthFunc(func() (string, string) {
+		return "User", password
+	}))
+	for _, p := range []string{"Password1", "Password2"} {
+		password = p
+		if _, err := c.GetAccountInfo(context.Background(), "self"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if want := []string{"User Password1", "User Password2"}; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("requests used %q, want %q", got, want)
+	}
+}
+
 func TestDigestAuth(t *testing.T) {
 	const (
 		user   = "User"
@@ -712,6 +712,8 @@ type ProjectInput struct {
 	Description string `json:"description,omitempty"`
 	SubmitType  string `json:"submit_type,omitempty"`
 
+	CreateEmptyCommit bool `json:"create_empty_commit,omitempty"`
+
 	CreateNewChangeForAllNotInTarget string `json:"create_new_change_for_all_not_in_target,omitempty"`
 
 	// TODO(bradfitz): more, as needed.
@@ -61,6 +61,9 @@ func IAPFromContext(ctx context.Context) (*IAPFields, error) {
 	return &iap, nil
 }
 
+// RequireIAPAuthHandler creates a handler that requires Identity Aware Proxy
+// authentication. Upon a successful authentication the associated headers
+// will be copied into the request context.
 func RequireIAPAuthHandler(h http.Handler, audience string) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		jwt := r.Header.Get("x-goog-iap-jwt-assertion")
@@ -74,7 +77,8 @@ func RequireIAPAuthHandler(h http.Handler, audience string) http.Handler {
 			log.Printf("JWT validation error: %v", err)
 			return
 		}
-		h.ServeHTTP(w, r)
+		iap := IAPFields{Email: r.Header.Get(iapHeaderEmail), ID: r.Header.Get(iapHeaderID)}
+		h.ServeHTTP(w, r.WithContext(ContextWithIAP(r.Context(), iap)))
 	})
 }
 
@@ -112,10 +112,11 @@ func (gb GoBuilder) RunMake(ctx context.Context, bc buildlet.Client, w io.Writer
 		env = append(env, "GOROOT_BOOTSTRAP="+gb.GorootBootstrap)
 	}
 	remoteErr, err = bc.Exec(ctx, path.Join(gb.Goroot, gb.Conf.MakeScript()), buildlet.ExecOpts{
-		Output:   w,
-		ExtraEnv: env,
-		Debug:    true,
-		Args:     gb.Conf.MakeScriptArgs(),
+		Output:     w,
+		ExtraEnv:   env,
+		EnvProfile: gb.Conf.EnvProfile(),
+		Debug:      true,
+		Args:       gb.Conf.MakeScriptArgs(),
 	})
 	if err != nil {
 		makeSpan.Done(err)
@@ -131,10 +132,11 @@ func (gb GoBuilder) RunMake(ctx context.Context, bc buildlet.Client, w io.Writer
 	if pkgs := gb.Conf.GoInstallRacePackages(); len(pkgs) > 0 {
 		sp := gb.CreateSpan("install_race_std")
 		remoteErr, err = bc.Exec(ctx, path.Join(gb.Goroot, "bin/go"), buildlet.ExecOpts{
-			Output:   w,
-			ExtraEnv: append(gb.Conf.Env(), "GOBIN="),
-			Debug:    true,
-			Args:     append([]string{"install", "-race"}, pkgs...),
+			Output:     w,
+			ExtraEnv:   append(gb.Conf.Env(), "GOBIN="),
+			EnvProfile: gb.Conf.EnvProfile(),
+			Debug:      true,
+			Args:       append([]string{"install", "-race"}, pkgs...),
 		})
 		if err != nil {
 			sp.Done(err)
@@ -163,10 +165,11 @@ func (gb GoBuilder) RunMake(ctx context.Context, bc buildlet.Client, w io.Writer
 func (gb GoBuilder) runConcurrentGoBuildStdCmd(ctx context.Context, bc buildlet.Client, w io.Writer) (remoteErr, err error) {
 	span := gb.CreateSpan("go_build_c128_std_cmd")
 	remoteErr, err = bc.Exec(ctx, path.Join(gb.Goroot, "bin/go"), buildlet.ExecOpts{
-		Output:   w,
-		ExtraEnv: append(gb.Conf.Env(), "GOBIN="),
-		Debug:    true,
-		Args:     []string{"build", "-a", "-gcflags=-c=8", "std", "cmd"},
+		Output:     w,
+		ExtraEnv:   append(gb.Conf.Env(), "GOBIN="),
+		EnvProfile: gb.Conf.EnvProfile(),
+		Debug:      true,
+		Args:       []string{"build", "-a", "-gcflags=-c=8", "std", "cmd"},
 	})
 	if err != nil {
 		span.Done(err)
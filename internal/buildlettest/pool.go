@@ -0,0 +1,89 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build linux || darwin
+// +build linux darwin
+
+package buildlettest
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/build/buildlet"
+	"golang.org/x/build/dashboard"
+	"golang.org/x/build/internal/coordinator/pool"
+	"golang.org/x/build/internal/coordinator/pool/queue"
+)
+
+var _ pool.Buildlet = (*Pool)(nil)
+
+// Pool is a fake coordinator buildlet pool. Every buildlet it hands
+// out is backed by a new in-process Server.
+//
+// The exported fields must not be modified while the pool is in use.
+type Pool struct {
+	// Delay is how long GetBuildlet waits before the requested
+	// buildlet becomes available. It is used to exercise
+	// timeouts and cancellation while waiting for a buildlet.
+	Delay time.Duration
+
+	// Err, if non-nil, is returned by GetBuildlet once Delay has elapsed.
+	Err error
+
+	t       testing.TB
+	mu      sync.Mutex
+	servers []*Server
+}
+
+// NewPool returns a new Pool which starts its buildlets within the
+// lifetime of test t.
+func NewPool(t testing.TB) *Pool {
+	return &Pool{t: t}
+}
+
+// Install registers p as the buildlet pool for every host type via
+// pool.TestPoolHook, so that the coordinator scheduler gets its
+// buildlets from p. The hook is removed when the test completes.
+func (p *Pool) Install() {
+	pool.TestPoolHook = func(*dashboard.HostConfig) pool.Buildlet { return p }
+	p.t.Cleanup(func() { pool.TestPoolHook = nil })
+}
+
+// GetBuildlet starts a new in-process buildlet and returns a client for it.
+func (p *Pool) GetBuildlet(ctx context.Context, hostType string, lg pool.Logger, item *queue.SchedItem) (buildlet.Client, error) {
+	sp := lg.CreateSpan("get_buildlettest_buildlet", hostType)
+	if p.Delay > 0 {
+		t := time.NewTimer(p.Delay)
+		defer t.Stop()
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return nil, sp.Done(ctx.Err())
+		}
+	}
+	if p.Err != nil {
+		return nil, sp.Done(p.Err)
+	}
+	s := NewServer(p.t)
+	p.mu.Lock()
+	p.servers = append(p.servers, s)
+	p.mu.Unlock()
+	bc := s.Client()
+	bc.SetDescription(fmt.Sprintf("buildlettest buildlet for %s", hostType))
+	return bc, sp.Done(nil)
+}
+
+// Servers returns the buildlets the pool has handed out so far,
+// in the order they were created.
+func (p *Pool) Servers() []*Server {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]*Server(nil), p.servers...)
+}
+
+func (p *Pool) String() string { return "buildlettest pool" }
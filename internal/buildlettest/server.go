@@ -0,0 +1,560 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package buildlettest provides an in-process buildlet, and a
+// coordinator buildlet pool handing out such buildlets, for use in
+// integration tests of the coordinator and the gomote server.
+//
+// The buildlets served by this package speak the same HTTP protocol
+// as cmd/buildlet and execute commands against the local operating
+// system, rooted in a temporary work directory. They are intended to
+// exercise timeouts, cancellation and file transfers across
+// components without requiring any cloud resources.
+package buildlettest
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha1"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/build/buildlet"
+)
+
+// Version is the buildlet version reported by Server's status handler.
+const Version = 27
+
+// Server is an in-process buildlet. Its zero value is not usable;
+// create one with NewServer.
+type Server struct {
+	// WorkDir is the absolute path of the buildlet's work directory.
+	WorkDir string
+
+	ts      *httptest.Server
+	mu      sync.Mutex
+	halted  bool
+	running map[*exec.Cmd]bool
+	execs   int
+}
+
+// NewServer starts a new in-process buildlet with a fresh temporary
+// work directory. The buildlet and its work directory are removed
+// when the test completes.
+func NewServer(t testing.TB) *Server {
+	s := &Server{
+		WorkDir: t.TempDir(),
+		running: make(map[*exec.Cmd]bool),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/exec", s.handleExec)
+	mux.HandleFunc("/write", s.handleWrite)
+	mux.HandleFunc("/writetgz", s.handleWriteTGZ)
+	mux.HandleFunc("/tgz", s.handleGetTGZ)
+	mux.HandleFunc("/ls", s.handleLs)
+	mux.HandleFunc("/removeall", s.handleRemoveAll)
+	mux.HandleFunc("/workdir", s.handleWorkDir)
+	mux.HandleFunc("/status", s.handleStatus)
+	mux.HandleFunc("/halt", s.handleHalt)
+	s.ts = httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+	return s
+}
+
+// Client returns a new buildlet client connected to s.
+func (s *Server) Client() buildlet.Client {
+	u, err := url.Parse(s.ts.URL)
+	if err != nil {
+		panic(err) // httptest always produces a valid URL.
+	}
+	bc := buildlet.NewClient(u.Host, buildlet.NoKeyPair)
+	bc.SetName("buildlettest-" + path.Base(s.WorkDir))
+	return bc
+}
+
+// Close shuts down the buildlet, killing any running commands.
+func (s *Server) Close() {
+	s.mu.Lock()
+	for cmd := range s.running {
+		cmd.Process.Kill()
+	}
+	s.mu.Unlock()
+	s.ts.CloseClientConnections()
+	s.ts.Close()
+}
+
+// Halted reports whether the buildlet has received a halt request.
+func (s *Server) Halted() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.halted
+}
+
+// Running returns the number of commands currently executing on the buildlet.
+func (s *Server) Running() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.running)
+}
+
+// Execs returns the number of commands the buildlet has started.
+func (s *Server) Execs() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.execs
+}
+
+// hdrProcessState matches the trailer set by cmd/buildlet's /exec handler.
+const hdrProcessState = "Process-State"
+
+func (s *Server) handleExec(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "requires POST method", http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Trailer", hdrProcessState)
+
+	sysMode := r.FormValue("mode") == "sys"
+	absCmd, err := s.absExecCmd(r.FormValue("cmd"), sysMode)
+	if err != nil {
+		http.Error(w, "invalid 'cmd' parameter: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	dir := s.WorkDir
+	if d := r.FormValue("dir"); d != "" {
+		if filepath.IsAbs(d) {
+			dir = filepath.Clean(d)
+		} else if rel, err := nativeRelPath(d); err != nil {
+			http.Error(w, "invalid 'dir' parameter: "+err.Error(), http.StatusBadRequest)
+			return
+		} else {
+			dir = filepath.Join(s.WorkDir, rel)
+		}
+	} else if !sysMode {
+		dir = filepath.Dir(absCmd)
+	}
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+
+	cmd := exec.CommandContext(r.Context(), absCmd, r.PostForm["cmdArg"]...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "WORKDIR="+s.WorkDir, "TMPDIR="+s.WorkDir)
+	cmd.Env = append(cmd.Env, r.PostForm["env"]...)
+	out := flushWriter{w}
+	cmd.Stdout = out
+	cmd.Stderr = out
+	cmd.WaitDelay = time.Second
+	if debug, _ := strconv.ParseBool(r.FormValue("debug")); debug {
+		fmt.Fprintf(out, ":: Running %s with args %q in dir %s\n\n", cmd.Path, cmd.Args, cmd.Dir)
+	}
+
+	err = cmd.Start()
+	if err == nil {
+		s.mu.Lock()
+		s.running[cmd] = true
+		s.execs++
+		s.mu.Unlock()
+		err = cmd.Wait()
+		s.mu.Lock()
+		delete(s.running, cmd)
+		s.mu.Unlock()
+	}
+	state := "ok"
+	if err != nil {
+		if ps := cmd.ProcessState; ps != nil {
+			state = ps.String()
+		} else {
+			state = err.Error()
+		}
+	}
+	w.Header().Set(hdrProcessState, state)
+}
+
+// absExecCmd resolves a command the same way cmd/buildlet does:
+// relative paths are relative to the work directory, and bare names
+// are looked up in the work directory before the system PATH unless
+// sysMode is set.
+func (s *Server) absExecCmd(cmdArg string, sysMode bool) (string, error) {
+	if cmdArg == "" {
+		return "", errors.New("requires 'cmd' parameter")
+	}
+	if filepath.IsAbs(cmdArg) {
+		return filepath.Clean(cmdArg), nil
+	}
+	rel, err := nativeRelPath(cmdArg)
+	if err != nil {
+		return "", err
+	}
+	if strings.Contains(rel, string(filepath.Separator)) {
+		if sysMode {
+			return "", errors.New("'sys' mode requires absolute or system 'cmd' path")
+		}
+		return filepath.Join(s.WorkDir, rel), nil
+	}
+	if !sysMode {
+		if abs, err := exec.LookPath(filepath.Join(s.WorkDir, rel)); err == nil {
+			return abs, nil
+		}
+	}
+	return exec.LookPath(cmdArg)
+}
+
+func (s *Server) handleWrite(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "PUT" {
+		http.Error(w, "requires PUT method", http.StatusBadRequest)
+		return
+	}
+	param, _ := url.ParseQuery(r.URL.RawQuery)
+	rel, err := nativeRelPath(param.Get("path"))
+	if err != nil {
+		http.Error(w, "invalid 'path' parameter: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	modeInt, err := strconv.ParseInt(param.Get("mode"), 10, 64)
+	mode := os.FileMode(modeInt)
+	if err != nil || !mode.IsRegular() {
+		http.Error(w, "bad mode", http.StatusBadRequest)
+		return
+	}
+	abs := filepath.Join(s.WorkDir, rel)
+	if err := os.MkdirAll(filepath.Dir(abs), 0755); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := writeFile(r.Body, abs, mode); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	io.WriteString(w, "OK")
+}
+
+func (s *Server) handleWriteTGZ(w http.ResponseWriter, r *http.Request) {
+	urlParam, _ := url.ParseQuery(r.URL.RawQuery)
+	baseDir := s.WorkDir
+	if dir := urlParam.Get("dir"); dir != "" {
+		rel, err := nativeRelPath(dir)
+		if err != nil {
+			http.Error(w, "invalid 'dir' parameter: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		baseDir = filepath.Join(baseDir, rel)
+	}
+	var tgz io.Reader
+	switch r.Method {
+	case "PUT":
+		tgz = r.Body
+	case "POST":
+		urlStr := r.FormValue("url")
+		if urlStr == "" {
+			http.Error(w, "missing url POST param", http.StatusBadRequest)
+			return
+		}
+		res, err := http.Get(urlStr)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("fetching URL %s: %v", urlStr, err), http.StatusInternalServerError)
+			return
+		}
+		defer res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			http.Error(w, fmt.Sprintf("writetgz: fetching provided URL %q: %s", urlStr, res.Status), http.StatusInternalServerError)
+			return
+		}
+		tgz = res.Body
+	default:
+		http.Error(w, "requires PUT or POST method", http.StatusBadRequest)
+		return
+	}
+	if err := untar(tgz, baseDir); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	io.WriteString(w, "OK")
+}
+
+func (s *Server) handleGetTGZ(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "requires GET method", http.StatusBadRequest)
+		return
+	}
+	base := s.WorkDir
+	if dir := r.FormValue("dir"); dir != "" {
+		rel, err := nativeRelPath(dir)
+		if err != nil {
+			http.Error(w, "invalid 'dir' parameter: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		base = filepath.Join(base, rel)
+	}
+	zw := gzip.NewWriter(w)
+	tw := tar.NewWriter(zw)
+	err := filepath.Walk(base, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel := strings.TrimPrefix(filepath.ToSlash(strings.TrimPrefix(path, base)), "/")
+		if rel == "" {
+			return nil
+		}
+		th, err := tar.FileInfoHeader(fi, "")
+		if err != nil {
+			return err
+		}
+		th.Name = rel
+		if fi.IsDir() {
+			th.Name += "/"
+		}
+		if err := tw.WriteHeader(th); err != nil {
+			return err
+		}
+		if !fi.Mode().IsRegular() {
+			return nil
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(tw, f)
+		return err
+	})
+	if err != nil {
+		log.Printf("buildlettest: tgz walk error: %v", err)
+		panic(http.ErrAbortHandler)
+	}
+	tw.Close()
+	zw.Close()
+}
+
+func (s *Server) handleLs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "requires GET method", http.StatusBadRequest)
+		return
+	}
+	base := s.WorkDir
+	if dir := r.FormValue("dir"); dir != "" {
+		rel, err := nativeRelPath(dir)
+		if err != nil {
+			http.Error(w, "invalid 'dir' parameter: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		base = filepath.Join(base, rel)
+	}
+	recursive, _ := strconv.ParseBool(r.FormValue("recursive"))
+	digest, _ := strconv.ParseBool(r.FormValue("digest"))
+	skip := r.Form["skip"]
+	err := filepath.Walk(base, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel := strings.TrimPrefix(filepath.ToSlash(strings.TrimPrefix(path, base)), "/")
+		if rel == "" && fi.IsDir() {
+			return nil
+		}
+		if fi.IsDir() {
+			for _, v := range skip {
+				if rel == v {
+					return filepath.SkipDir
+				}
+			}
+		}
+		fmt.Fprintf(w, "%s\t%s", fi.Mode(), rel)
+		if fi.Mode().IsRegular() {
+			fmt.Fprintf(w, "\t%d\t%s", fi.Size(), fi.ModTime().UTC().Format(time.RFC3339))
+			if digest {
+				sum, err := fileSHA1(path)
+				if err != nil {
+					return err
+				}
+				io.WriteString(w, "\t"+sum)
+			}
+		} else if fi.IsDir() {
+			io.WriteString(w, "/")
+		}
+		io.WriteString(w, "\n")
+		if fi.IsDir() && !recursive {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		http.Error(w, "Walk error: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func (s *Server) handleRemoveAll(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "requires POST method", http.StatusBadRequest)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	paths := r.Form["path"]
+	if len(paths) == 0 {
+		http.Error(w, "requires 'path' parameter", http.StatusBadRequest)
+		return
+	}
+	for _, p := range paths {
+		rel, err := nativeRelPath(p)
+		if err != nil {
+			http.Error(w, "invalid 'path' parameter: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := os.RemoveAll(filepath.Join(s.WorkDir, rel)); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	// Like cmd/buildlet, removing "." leaves an empty work directory behind.
+	if err := os.MkdirAll(s.WorkDir, 0755); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func (s *Server) handleWorkDir(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "requires GET method", http.StatusBadRequest)
+		return
+	}
+	fmt.Fprint(w, s.WorkDir)
+}
+
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "requires GET method", http.StatusBadRequest)
+		return
+	}
+	b, err := json.Marshal(buildlet.Status{Version: Version})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Write(b)
+}
+
+func (s *Server) handleHalt(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "requires POST method", http.StatusBadRequest)
+		return
+	}
+	s.mu.Lock()
+	s.halted = true
+	for cmd := range s.running {
+		cmd.Process.Kill()
+	}
+	s.mu.Unlock()
+}
+
+// flushWriter is an io.Writer that Flushes after each Write if the
+// underlying Writer implements http.Flusher.
+type flushWriter struct {
+	rw http.ResponseWriter
+}
+
+func (fw flushWriter) Write(p []byte) (n int, err error) {
+	n, err = fw.rw.Write(p)
+	if f, ok := fw.rw.(http.Flusher); ok {
+		f.Flush()
+	}
+	return
+}
+
+func writeFile(r io.Reader, path string, mode os.FileMode) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// untar reads the gzip-compressed tar file from r and writes it into dir.
+func untar(r io.Reader, dir string) error {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return fmt.Errorf("requires gzip-compressed body: %w", err)
+	}
+	tr := tar.NewReader(zr)
+	for {
+		f, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("tar error: %w", err)
+		}
+		if f.Typeflag == tar.TypeXGlobalHeader {
+			continue
+		}
+		rel, err := nativeRelPath(f.Name)
+		if err != nil {
+			return fmt.Errorf("tar file contained invalid name %q: %v", f.Name, err)
+		}
+		abs := filepath.Join(dir, rel)
+		mode := f.FileInfo().Mode()
+		switch {
+		case mode.IsRegular():
+			if err := os.MkdirAll(filepath.Dir(abs), 0755); err != nil {
+				return err
+			}
+			if err := writeFile(tr, abs, mode.Perm()); err != nil {
+				return err
+			}
+		case mode.IsDir():
+			if err := os.MkdirAll(abs, 0755); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func fileSHA1(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	s1 := sha1.New()
+	if _, err := io.Copy(s1, f); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", s1.Sum(nil)), nil
+}
+
+// nativeRelPath validates a slash-separated relative path and
+// returns it using the native path separator.
+func nativeRelPath(p string) (string, error) {
+	if p == "" {
+		return "", errors.New("path not provided")
+	}
+	clean := path.Clean(p)
+	if path.IsAbs(clean) {
+		return "", fmt.Errorf("path %q is not relative", p)
+	}
+	if clean == ".." || strings.HasPrefix(clean, "../") {
+		return "", fmt.Errorf("path %q refers to a parent directory", p)
+	}
+	return filepath.FromSlash(clean), nil
+}
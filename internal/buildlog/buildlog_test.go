@@ -0,0 +1,91 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package buildlog
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestGetFile(t *testing.T) {
+	var requests int32
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		<-release
+		w.Write([]byte("log contents"))
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	f := NewFetcher(2)
+	dir := t.TempDir()
+	name := filepath.Join(dir, "log")
+
+	// Concurrent fetches of the same file make a single request.
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := f.GetFile(ctx, srv.URL+"/log", name); err != nil {
+				t.Errorf("GetFile: %v", err)
+			}
+		}()
+	}
+	close(release)
+	wg.Wait()
+	if got, err := os.ReadFile(name); err != nil || string(got) != "log contents" {
+		t.Errorf("fetched file = %q, %v; want %q", got, err, "log contents")
+	}
+
+	// An existing file isn't fetched again.
+	if err := f.GetFile(ctx, srv.URL+"/log", name); err != nil {
+		t.Errorf("GetFile of existing file: %v", err)
+	}
+	if n := atomic.LoadInt32(&requests); n != 1 {
+		t.Errorf("server got %d requests; want 1", n)
+	}
+
+	// A failed fetch leaves nothing behind.
+	missing := filepath.Join(dir, "missing")
+	if err := f.GetFile(ctx, srv.URL+"/missing", missing); err == nil {
+		t.Errorf("GetFile of missing log succeeded; want error")
+	}
+	if _, err := os.Stat(missing); !os.IsNotExist(err) {
+		t.Errorf("after failed GetFile, Stat = %v; want not exist", err)
+	}
+}
+
+func TestReadFailures(t *testing.T) {
+	files, _ := filepath.Glob("../logparser/testdata/*.log")
+	if len(files) == 0 {
+		t.Fatalf("no testdata")
+	}
+	for _, file := range files {
+		fails, err := ReadFailures(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(fails) == 0 {
+			t.Errorf("%s: no failures", file)
+		}
+		for _, f := range fails {
+			if want := SnippetHash(f.Snippet); f.SnippetHash != want || len(want) != 12 {
+				t.Errorf("%s: SnippetHash = %q; want %q", file, f.SnippetHash, want)
+			}
+		}
+	}
+}
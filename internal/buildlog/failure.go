@@ -0,0 +1,47 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package buildlog
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"os"
+
+	"golang.org/x/build/internal/logparser"
+)
+
+// A Failure is a single failure extracted from a build log.
+type Failure struct {
+	logparser.Fail
+	// SnippetHash is a short hash of the failure's snippet, which
+	// identifies the same failure across logs.
+	SnippetHash string
+}
+
+// Failures returns the failures in a build log.
+// It always returns at least one failure.
+func Failures(log string) []*Failure {
+	var fails []*Failure
+	for _, f := range logparser.Parse(log) {
+		fails = append(fails, &Failure{Fail: *f, SnippetHash: SnippetHash(f.Snippet)})
+	}
+	return fails
+}
+
+// ReadFailures returns the failures in the build log in the named file.
+func ReadFailures(filename string) ([]*Failure, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return Failures(string(data)), nil
+}
+
+// SnippetHash returns a short hash of a failure snippet, which
+// identifies identical failures across logs.
+func SnippetHash(snippet string) string {
+	h := sha1.Sum([]byte(snippet))
+	return hex.EncodeToString(h[:6])
+}
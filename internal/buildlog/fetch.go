@@ -0,0 +1,143 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package buildlog downloads, caches, and extracts failures from
+// builder logs, for tools that analyze failures across many builds,
+// such as fetchlogs and watchflakes.
+package buildlog
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+)
+
+// A Fetcher downloads files over HTTP concurrently. It limits the
+// number of concurrent downloads and correctly handles multiple
+// (possibly concurrent) fetches from the same URL to the same file.
+type Fetcher struct {
+	// Client is the HTTP client to use. If nil, http.DefaultClient
+	// is used.
+	Client *http.Client
+	// OnGet, if non-nil, is called before each HTTP request.
+	OnGet func(url string)
+
+	tokens chan struct{}
+
+	pending struct {
+		sync.Mutex
+		m map[string]*pendingFetch
+	}
+}
+
+type pendingFetch struct {
+	wchan chan struct{} // closed when fetch completes
+
+	// err is the error, if any, that occurred during this fetch.
+	// It will be set before wchan is closed.
+	err error
+}
+
+// NewFetcher returns a Fetcher that runs at most jobs requests at once.
+func NewFetcher(jobs int) *Fetcher {
+	f := new(Fetcher)
+
+	f.tokens = make(chan struct{}, jobs)
+	for i := 0; i < jobs; i++ {
+		f.tokens <- struct{}{}
+	}
+
+	f.pending.m = make(map[string]*pendingFetch)
+
+	return f
+}
+
+// Get performs an HTTP GET for url and returns the body, while
+// obeying the job limit of f.
+func (f *Fetcher) Get(ctx context.Context, url string) (io.ReadCloser, error) {
+	<-f.tokens
+	defer func() { f.tokens <- struct{}{} }()
+	if f.OnGet != nil {
+		f.OnGet(url)
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	client := f.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("GET %s: %v %s", url, resp.StatusCode, http.StatusText(resp.StatusCode))
+	}
+	return resp.Body, nil
+}
+
+// GetFile performs an HTTP GET for url and writes it to filename.
+// Logs are immutable, so if filename already exists, GetFile returns
+// immediately. If another goroutine is currently fetching filename,
+// GetFile blocks until that fetch is done and returns its result.
+func (f *Fetcher) GetFile(ctx context.Context, url, filename string) error {
+	// Do we already have it?
+	if _, err := os.Stat(filename); err == nil {
+		return nil
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	// Check if another fetch is working on it.
+	f.pending.Lock()
+	if p, ok := f.pending.m[filename]; ok {
+		f.pending.Unlock()
+		<-p.wchan
+		return p.err
+	}
+
+	p := &pendingFetch{wchan: make(chan struct{})}
+	f.pending.m[filename] = p
+	f.pending.Unlock()
+
+	r, err := f.Get(ctx, url)
+	if err == nil {
+		err = WriteFileAtomic(filename, r)
+		r.Close()
+	}
+	p.err = err
+
+	close(p.wchan)
+	return p.err
+}
+
+// WriteFileAtomic atomically creates a file called filename and
+// copies the data from r to the file.
+func WriteFileAtomic(filename string, r io.Reader) error {
+	tmpPath := filename + ".tmp"
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, r)
+	if err == nil {
+		err = f.Sync()
+	}
+	if err2 := f.Close(); err == nil {
+		err = err2
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, filename)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+	}
+	return err
+}
@@ -51,16 +51,28 @@ func SyncBuilds(ctx context.Context, env *buildenv.Environment) error {
 	if Verbose {
 		log.Printf("buildstats: Builds metadata: %#v", meta)
 	}
+	schema, err := bigquery.InferSchema(types.BuildRecord{})
+	if err != nil {
+		return fmt.Errorf("InferSchema: %v", err)
+	}
 	if len(meta.Schema) == 0 {
 		if Verbose {
 			log.Printf("buildstats: builds table has empty schema")
 		}
-		schema, err := bigquery.InferSchema(types.BuildRecord{})
+		blindWrite := ""
+		meta, err = buildsTable.Update(ctx, bigquery.TableMetadataToUpdate{Schema: schema}, blindWrite)
 		if err != nil {
-			return fmt.Errorf("InferSchema: %v", err)
+			return fmt.Errorf("table.Update schema: %v", err)
+		}
+	} else if added := missingFields(meta.Schema, schema); len(added) > 0 {
+		// BuildRecord has grown fields since the table was created.
+		// Columns can only be added as NULLABLE, so rows synced
+		// before then have NULL values.
+		if Verbose {
+			log.Printf("buildstats: adding %d columns to the Builds table", len(added))
 		}
 		blindWrite := ""
-		meta, err = buildsTable.Update(ctx, bigquery.TableMetadataToUpdate{Schema: schema}, blindWrite)
+		meta, err = buildsTable.Update(ctx, bigquery.TableMetadataToUpdate{Schema: append(meta.Schema, added...)}, blindWrite)
 		if err != nil {
 			return fmt.Errorf("table.Update schema: %v", err)
 		}
@@ -174,6 +186,24 @@ func SyncBuilds(ctx context.Context, env *buildenv.Environment) error {
 	}
 }
 
+// missingFields returns the fields of want that aren't in have, as
+// optional fields.
+func missingFields(have, want bigquery.Schema) bigquery.Schema {
+	names := make(map[string]bool)
+	for _, fs := range have {
+		names[fs.Name] = true
+	}
+	var missing bigquery.Schema
+	for _, fs := range want {
+		if !names[fs.Name] {
+			f := *fs
+			f.Required = false
+			missing = append(missing, &f)
+		}
+	}
+	return missing
+}
+
 // SyncSpans syncs the datastore "Span" entities to the BigQuery "Spans" table.
 // These contain the fine-grained timing details of how a build ran.
 func SyncSpans(ctx context.Context, env *buildenv.Environment) error {
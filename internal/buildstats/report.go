@@ -0,0 +1,178 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package buildstats
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"golang.org/x/build/buildenv"
+	"google.golang.org/api/iterator"
+)
+
+// BuilderReport is the health record of a builder (a build
+// configuration) over a month, for port maintainers and the owners of
+// the build infrastructure.
+type BuilderReport struct {
+	Builder string `json:"builder"` // "linux-amd64-race"
+	Month   string `json:"month"`   // "2023-05"
+
+	Builds        int `json:"builds"` // finished builds, TryBots included
+	OK            int `json:"ok"`
+	TestFailures  int `json:"testFailures"`  // failures of the code being built or its tests
+	InfraFailures int `json:"infraFailures"` // failures of the build infrastructure
+
+	// Flakes is the number of test failures of revisions that the
+	// builder also built successfully that month.
+	Flakes int `json:"flakes"`
+
+	// AvgQueueSeconds is the average time builds waited for a
+	// buildlet.
+	AvgQueueSeconds float64 `json:"avgQueueSeconds"`
+
+	// The following are computed from the counts above.
+
+	// Availability is the fraction of builds that didn't fail
+	// because of the build infrastructure.
+	Availability     float64 `json:"availability"`
+	TestFailureRate  float64 `json:"testFailureRate"`
+	InfraFailureRate float64 `json:"infraFailureRate"`
+	// FlakeShare is the builder's fraction of the flakes of all
+	// builders that month.
+	FlakeShare float64 `json:"flakeShare"`
+}
+
+// QueryBuilderReports returns the reports of all builders that
+// finished a build in the month of month, in UTC, sorted by builder.
+//
+// Builds that finished before BuildRecord.InfraFailure existed count
+// as test failures when they failed.
+func QueryBuilderReports(ctx context.Context, env *buildenv.Environment, month time.Time) ([]*BuilderReport, error) {
+	start := time.Date(month.Year(), month.Month(), 1, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(0, 1, 0)
+
+	bq, err := bigquery.NewClient(ctx, env.ProjectName)
+	if err != nil {
+		return nil, err
+	}
+	defer bq.Close()
+	params := []bigquery.QueryParameter{
+		{Name: "start", Value: start},
+		{Name: "end", Value: end},
+	}
+
+	byBuilder := map[string]*BuilderReport{}
+	q := bq.Query(`
+WITH
+    b AS (
+        SELECT Builder, Repo, Rev, GoRev, Result, IFNULL(InfraFailure, FALSE) AS InfraFailure
+        FROM builds.Builds
+        WHERE EndTime >= @start AND EndTime < @end AND Result IN ('ok', 'fail')
+    ),
+    passed AS (
+        SELECT DISTINCT Builder, Repo, Rev, GoRev, TRUE AS Passed
+        FROM b
+        WHERE Result = 'ok'
+    )
+SELECT
+    Builder,
+    COUNT(*) AS Builds,
+    COUNTIF(Result = 'ok') AS OK,
+    COUNTIF(Result = 'fail' AND NOT InfraFailure) AS TestFailures,
+    COUNTIF(Result = 'fail' AND InfraFailure) AS InfraFailures,
+    COUNTIF(Result = 'fail' AND NOT InfraFailure AND Passed) AS Flakes
+FROM
+    b LEFT JOIN passed USING (Builder, Repo, Rev, GoRev)
+GROUP BY 1
+`)
+	q.Parameters = params
+	it, err := q.Read(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		var row struct {
+			Builder                                         string
+			Builds, OK, TestFailures, InfraFailures, Flakes int
+		}
+		err := it.Next(&row)
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		byBuilder[row.Builder] = &BuilderReport{
+			Builder:       row.Builder,
+			Builds:        row.Builds,
+			OK:            row.OK,
+			TestFailures:  row.TestFailures,
+			InfraFailures: row.InfraFailures,
+			Flakes:        row.Flakes,
+		}
+	}
+
+	q = bq.Query(`
+SELECT
+    Builder, AVG(Seconds) AS AvgQueueSeconds
+FROM
+    builds.Spans
+WHERE
+    Event = 'get_buildlet' AND StartTime >= @start AND StartTime < @end
+GROUP BY 1
+`)
+	q.Parameters = params
+	it, err = q.Read(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		var row struct {
+			Builder         string
+			AvgQueueSeconds float64
+		}
+		err := it.Next(&row)
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if r, ok := byBuilder[row.Builder]; ok {
+			r.AvgQueueSeconds = row.AvgQueueSeconds
+		}
+	}
+
+	reports := make([]*BuilderReport, 0, len(byBuilder))
+	for _, r := range byBuilder {
+		r.Month = start.Format("2006-01")
+		reports = append(reports, r)
+	}
+	finishReports(reports)
+	return reports, nil
+}
+
+// finishReports computes the rates of reports from their counts, and
+// sorts them by builder.
+func finishReports(reports []*BuilderReport) {
+	flakes := 0
+	for _, r := range reports {
+		flakes += r.Flakes
+	}
+	for _, r := range reports {
+		if r.Builds > 0 {
+			n := float64(r.Builds)
+			r.Availability = 1 - float64(r.InfraFailures)/n
+			r.TestFailureRate = float64(r.TestFailures) / n
+			r.InfraFailureRate = float64(r.InfraFailures) / n
+		}
+		if flakes > 0 {
+			r.FlakeShare = float64(r.Flakes) / float64(flakes)
+		}
+	}
+	sort.Slice(reports, func(i, j int) bool { return reports[i].Builder < reports[j].Builder })
+}
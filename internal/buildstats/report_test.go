@@ -0,0 +1,28 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package buildstats
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestFinishReports(t *testing.T) {
+	reports := []*BuilderReport{
+		{Builder: "linux-amd64", Builds: 100, OK: 90, TestFailures: 6, InfraFailures: 4, Flakes: 3},
+		{Builder: "freebsd-arm64", Builds: 10, OK: 5, TestFailures: 5, Flakes: 1},
+		{Builder: "plan9-386"},
+	}
+	finishReports(reports)
+	want := []*BuilderReport{
+		{Builder: "freebsd-arm64", Builds: 10, OK: 5, TestFailures: 5, Flakes: 1, Availability: 1, TestFailureRate: 0.5, FlakeShare: 0.25},
+		{Builder: "linux-amd64", Builds: 100, OK: 90, TestFailures: 6, InfraFailures: 4, Flakes: 3, Availability: 0.96, TestFailureRate: 0.06, InfraFailureRate: 0.04, FlakeShare: 0.75},
+		{Builder: "plan9-386"},
+	}
+	if diff := cmp.Diff(want, reports); diff != "" {
+		t.Errorf("finishReports mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,285 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package cleanup finds and deletes stale temporary state that build
+// infrastructure leaves behind, such as branches in work repositories
+// and files in scratch buckets, so that it doesn't grow without bound.
+package cleanup
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+	"golang.org/x/build/internal/gcsfs"
+)
+
+// A Policy decides which items are stale and what to do with them.
+type Policy struct {
+	// MaxAge is the age after which an item is stale.
+	MaxAge time.Duration
+	// DryRun, if set, reports stale items without deleting them.
+	DryRun bool
+}
+
+// An Item is a ref or file found by a cleanup.
+type Item struct {
+	Name string
+	Time time.Time // when the item was created or last modified
+}
+
+// A Report describes the outcome of a cleanup.
+type Report struct {
+	Source  string // the repository or file system that was cleaned up
+	Policy  Policy
+	Scanned int    // number of candidate items examined
+	Stale   []Item // stale items, sorted by name
+	Deleted int    // number of stale items deleted
+}
+
+// String returns a human-readable summary of r, listing each stale item.
+func (r *Report) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "cleanup of %s: %d of %d items older than %v are stale", r.Source, len(r.Stale), r.Scanned, r.Policy.MaxAge)
+	if r.Policy.DryRun {
+		b.WriteString(" (dry run)")
+	} else {
+		fmt.Fprintf(&b, ", %d deleted", r.Deleted)
+	}
+	for _, it := range r.Stale {
+		fmt.Fprintf(&b, "\n\t%s\t%s", it.Time.UTC().Format(time.RFC3339), it.Name)
+	}
+	return b.String()
+}
+
+// GitRefs cleans up the refs in the git repository at dir that match
+// any of patterns, which use the syntax of git for-each-ref.
+//
+// A ref's age is the time since GitRefs first saw it pointing where it
+// does, not the date of the commit it points to: a branch created
+// today for an old commit is new. GitRefs records when it saw each ref
+// in the file gitRefsSeenFile of the git directory, so a ref is stale
+// at the earliest MaxAge after the first cleanup that sees it.
+//
+// The refs are deleted in a single transaction that fails, deleting
+// nothing, if any of them was updated concurrently.
+func GitRefs(ctx context.Context, dir string, patterns []string, p Policy) (*Report, error) {
+	r := &Report{Source: dir, Policy: p}
+	seenPath, err := git(ctx, dir, nil, "rev-parse", "--git-path", gitRefsSeenFile)
+	if err != nil {
+		return nil, err
+	}
+	seenFile := strings.TrimSpace(string(seenPath))
+	if !filepath.IsAbs(seenFile) {
+		seenFile = filepath.Join(dir, seenFile)
+	}
+	seen, err := readRefsSeen(seenFile)
+	if err != nil {
+		return nil, err
+	}
+	args := append([]string{"for-each-ref", "--format=%(refname) %(objectname)"}, patterns...)
+	out, err := git(ctx, dir, nil, args...)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	cutoff := now.Add(-p.MaxAge)
+	nowSeen := make(map[refState]time.Time)
+	var stale []refState
+	var deletes bytes.Buffer
+	s := bufio.NewScanner(bytes.NewReader(out))
+	for s.Scan() {
+		f := strings.Fields(s.Text())
+		if len(f) != 2 {
+			return nil, fmt.Errorf("unexpected git for-each-ref output %q", s.Text())
+		}
+		r.Scanned++
+		ref := refState{name: f[0], object: f[1]}
+		t, ok := seen[ref]
+		if !ok {
+			t = now
+		}
+		nowSeen[ref] = t
+		if !t.Before(cutoff) {
+			continue
+		}
+		r.Stale = append(r.Stale, Item{Name: ref.name, Time: t})
+		stale = append(stale, ref)
+		fmt.Fprintf(&deletes, "delete %s %s\n", ref.name, ref.object)
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	if !p.DryRun && len(r.Stale) > 0 {
+		if _, err := git(ctx, dir, &deletes, "update-ref", "--stdin"); err != nil {
+			return nil, err
+		}
+		r.Deleted = len(r.Stale)
+		for _, ref := range stale {
+			delete(nowSeen, ref)
+		}
+	}
+	if err := writeRefsSeen(seenFile, nowSeen); err != nil {
+		return nil, err
+	}
+	record(ctx, "git-refs", r)
+	return r, nil
+}
+
+// gitRefsSeenFile is the name of the file in a git directory where
+// GitRefs records when it first saw each ref it considers.
+const gitRefsSeenFile = "cleanup-refs-seen"
+
+// A refState is a ref and the object it points to.
+type refState struct {
+	name, object string
+}
+
+// readRefsSeen reads a file written by writeRefsSeen. A missing file
+// means no ref has been seen yet.
+func readRefsSeen(file string) (map[refState]time.Time, error) {
+	seen := make(map[refState]time.Time)
+	b, err := os.ReadFile(file)
+	if errors.Is(err, fs.ErrNotExist) {
+		return seen, nil
+	} else if err != nil {
+		return nil, err
+	}
+	for _, line := range strings.Split(strings.TrimSpace(string(b)), "\n") {
+		f := strings.Fields(line)
+		if len(f) == 0 {
+			continue
+		}
+		if len(f) != 3 {
+			return nil, fmt.Errorf("%s: malformed line %q", file, line)
+		}
+		sec, err := strconv.ParseInt(f[2], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s: malformed time in line %q: %v", file, line, err)
+		}
+		seen[refState{name: f[0], object: f[1]}] = time.Unix(sec, 0)
+	}
+	return seen, nil
+}
+
+// writeRefsSeen atomically replaces file with the times refs in seen
+// were first seen, one "refname object unix-time" line per ref.
+func writeRefsSeen(file string, seen map[refState]time.Time) error {
+	var lines []string
+	for ref, t := range seen {
+		lines = append(lines, fmt.Sprintf("%s %s %d\n", ref.name, ref.object, t.Unix()))
+	}
+	sort.Strings(lines)
+	tmp := file + ".tmp"
+	if err := os.WriteFile(tmp, []byte(strings.Join(lines, "")), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, file)
+}
+
+func git(ctx context.Context, dir string, stdin *bytes.Buffer, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	if stdin != nil {
+		cmd.Stdin = stdin
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git %s in %s: %v\n%s", args[0], dir, err, stderr.Bytes())
+	}
+	return out, nil
+}
+
+// ScratchFiles cleans up the files in fsys by their modification
+// time. fsys must be a gcsfs.RemoveFS unless p.DryRun is set. source
+// names fsys in the report.
+//
+// Deletion continues past errors; the first one is returned along
+// with the report.
+func ScratchFiles(ctx context.Context, fsys fs.FS, source string, p Policy) (*Report, error) {
+	r := &Report{Source: source, Policy: p}
+	cutoff := time.Now().Add(-p.MaxAge)
+	err := fs.WalkDir(fsys, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		r.Scanned++
+		if info.ModTime().Before(cutoff) {
+			r.Stale = append(r.Stale, Item{Name: path, Time: info.ModTime()})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(r.Stale, func(i, j int) bool { return r.Stale[i].Name < r.Stale[j].Name })
+	var firstErr error
+	if !p.DryRun {
+		for _, it := range r.Stale {
+			if err := gcsfs.Remove(fsys, it.Name); err != nil {
+				if firstErr == nil {
+					firstErr = err
+				}
+				continue
+			}
+			r.Deleted++
+		}
+	}
+	record(ctx, "scratch-files", r)
+	return r, firstErr
+}
+
+var (
+	kKind    = tag.MustNewKey("go-build/cleanup/kind")
+	kDryRun  = tag.MustNewKey("go-build/cleanup/dry_run")
+	mStale   = stats.Int64("go-build/cleanup/stale_count", "number of stale items found by a cleanup", stats.UnitDimensionless)
+	mDeleted = stats.Int64("go-build/cleanup/deleted_count", "number of stale items deleted by a cleanup", stats.UnitDimensionless)
+)
+
+// Views contains the views of the metrics recorded by cleanups.
+// Programs that export metrics should register them.
+var Views = []*view.View{
+	{
+		Name:        "go-build/cleanup/stale_count",
+		Description: "Number of stale items found by the most recent cleanup",
+		Measure:     mStale,
+		TagKeys:     []tag.Key{kKind, kDryRun},
+		Aggregation: view.LastValue(),
+	},
+	{
+		Name:        "go-build/cleanup/deleted_count",
+		Description: "Total number of stale items deleted",
+		Measure:     mDeleted,
+		TagKeys:     []tag.Key{kKind},
+		Aggregation: view.Sum(),
+	},
+}
+
+func record(ctx context.Context, kind string, r *Report) {
+	stats.RecordWithTags(ctx,
+		[]tag.Mutator{tag.Upsert(kKind, kind), tag.Upsert(kDryRun, strconv.FormatBool(r.Policy.DryRun))},
+		mStale.M(int64(len(r.Stale))), mDeleted.M(int64(r.Deleted)))
+}
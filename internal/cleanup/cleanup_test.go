@@ -0,0 +1,139 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cleanup
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/build/internal/gcsfs"
+)
+
+func TestGitRefs(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+	ctx := context.Background()
+	dir := t.TempDir()
+	runGit := func(date string, args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(),
+			"GIT_AUTHOR_NAME=gopher", "GIT_AUTHOR_EMAIL=gopher@golang.org", "GIT_AUTHOR_DATE="+date,
+			"GIT_COMMITTER_NAME=gopher", "GIT_COMMITTER_EMAIL=gopher@golang.org", "GIT_COMMITTER_DATE="+date)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	old := time.Now().Add(-30 * 24 * time.Hour).Format(time.RFC3339)
+	runGit(old, "init", "-q", "-b", "master")
+	runGit(old, "commit", "-q", "--allow-empty", "-m", "old")
+	runGit(old, "branch", "worktree_old")
+	runGit(old, "branch", "worktree_updated")
+	runGit(old, "branch", "keep_old")
+
+	// Refs are new when they're first seen, however old their commits.
+	patterns := []string{"refs/heads/worktree_*"}
+	p := Policy{MaxAge: 7 * 24 * time.Hour, DryRun: true}
+	r, err := GitRefs(ctx, dir, patterns, p)
+	if err != nil {
+		t.Fatalf("GitRefs(first run) = %v", err)
+	}
+	if r.Scanned != 2 || len(r.Stale) != 0 {
+		t.Errorf("GitRefs(first run) report = %v, want 2 refs scanned and none stale", r)
+	}
+
+	// Pretend they were first seen a month ago, then update one of
+	// them, which makes it new again.
+	seenFile := filepath.Join(dir, ".git", gitRefsSeenFile)
+	seen, err := readRefsSeen(seenFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for ref := range seen {
+		seen[ref] = time.Now().Add(-30 * 24 * time.Hour)
+	}
+	if err := writeRefsSeen(seenFile, seen); err != nil {
+		t.Fatal(err)
+	}
+	runGit(old, "commit", "-q", "--allow-empty", "-m", "another old")
+	runGit(old, "branch", "-f", "worktree_updated")
+
+	r, err = GitRefs(ctx, dir, patterns, p)
+	if err != nil {
+		t.Fatalf("GitRefs(dry run) = %v", err)
+	}
+	if r.Scanned != 2 || len(r.Stale) != 1 || r.Stale[0].Name != "refs/heads/worktree_old" || r.Deleted != 0 {
+		t.Errorf("GitRefs(dry run) report = %v, want 1 of 2 refs stale and none deleted", r)
+	}
+	if !strings.Contains(r.String(), "(dry run)") {
+		t.Errorf("dry run report doesn't say so: %v", r)
+	}
+
+	p.DryRun = false
+	r, err = GitRefs(ctx, dir, patterns, p)
+	if err != nil {
+		t.Fatalf("GitRefs = %v", err)
+	}
+	if r.Deleted != 1 {
+		t.Errorf("GitRefs report = %v, want 1 ref deleted", r)
+	}
+	out, err := exec.Command("git", "-C", dir, "for-each-ref", "--format=%(refname)").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := strings.Fields(string(out))
+	want := []string{"refs/heads/keep_old", "refs/heads/master", "refs/heads/worktree_updated"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("refs after cleanup = %q, want %q", got, want)
+	}
+}
+
+func TestScratchFiles(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	fsys := gcsfs.DirFS(dir)
+	for _, name := range []string{"wf1/old.tar.gz", "wf1/recent.tar.gz", "wf2/old.zip"} {
+		if err := gcsfs.WriteFile(fsys, name, []byte("data")); err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(name, "old") {
+			mtime := time.Now().Add(-30 * 24 * time.Hour)
+			if err := os.Chtimes(filepath.Join(dir, name), mtime, mtime); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	p := Policy{MaxAge: 7 * 24 * time.Hour, DryRun: true}
+	r, err := ScratchFiles(ctx, fsys, "file://"+dir, p)
+	if err != nil {
+		t.Fatalf("ScratchFiles(dry run) = %v", err)
+	}
+	var stale []string
+	for _, it := range r.Stale {
+		stale = append(stale, it.Name)
+	}
+	if want := []string{"wf1/old.tar.gz", "wf2/old.zip"}; r.Scanned != 3 || !reflect.DeepEqual(stale, want) || r.Deleted != 0 {
+		t.Errorf("ScratchFiles(dry run) = %v, want stale files %q and none deleted", r, want)
+	}
+
+	p.DryRun = false
+	if r, err = ScratchFiles(ctx, fsys, "file://"+dir, p); err != nil || r.Deleted != 2 {
+		t.Errorf("ScratchFiles = %v, %v, want 2 files deleted", r, err)
+	}
+	for name, exists := range map[string]bool{"wf1/old.tar.gz": false, "wf1/recent.tar.gz": true, "wf2/old.zip": false} {
+		if _, err := os.Stat(filepath.Join(dir, name)); (err == nil) != exists {
+			t.Errorf("after cleanup, Stat(%q) = %v, want exists = %v", name, err, exists)
+		}
+	}
+}
@@ -0,0 +1,441 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package buildletca implements the certificate authority that issues
+// the TLS certificates of buildlets that the coordinator talks to over
+// the internet, such as EC2 buildlets.
+//
+// Each buildlet gets its own certificate, valid for little longer than
+// the buildlet's VM may live, from an issuing certificate whose key the
+// CA rotates regularly. Issuing certificates stay valid for the
+// lifetime of the last certificate they may have issued, so rotation
+// never breaks running buildlets.
+//
+// Issuing certificates are signed by an intermediate, whose key the
+// coordinator holds online, typically in Secret Manager. The root's
+// key is kept offline, and only ever signs intermediates, so the
+// coordinator's keys can be replaced by signing a new intermediate
+// without redistributing the root.
+//
+// The coordinator verifies buildlets' certificates against the root,
+// and checks that none of the certificates they chain through are
+// revoked: certificates of destroyed buildlets are revoked locally,
+// and the operators of the root may revoke intermediates with an
+// external CRL or OCSP responder, such as after a leak of the
+// coordinator's keys.
+package buildletca
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/build/buildlet"
+)
+
+const (
+	// DefaultRotateEvery is the default Options.RotateEvery.
+	DefaultRotateEvery = 24 * time.Hour
+	// DefaultMaxLifetime is the default Options.MaxLifetime, enough for
+	// the buildlets with the longest delete timeouts.
+	DefaultMaxLifetime = 24 * time.Hour
+
+	// clockSkew is how far in the past certificates become valid, to
+	// allow for buildlets with clocks running behind.
+	clockSkew = 5 * time.Minute
+)
+
+// Options configures a CA.
+type Options struct {
+	// Root is the certificate of the root of the CA. Its private key
+	// isn't needed.
+	Root *x509.Certificate
+	// Intermediate is the certificate and private key of an
+	// intermediate signed by Root, which signs the CA's issuing
+	// certificates. It must allow a path length of at least one.
+	//
+	// If Root and Intermediate are nil, New generates both, lasting
+	// as long as the CA.
+	Intermediate *tls.Certificate
+
+	// RotateEvery is how often the CA replaces its issuing
+	// certificate and key. Zero means DefaultRotateEvery.
+	RotateEvery time.Duration
+	// MaxLifetime is the maximum lifetime of buildlet certificates.
+	// Zero means DefaultMaxLifetime.
+	MaxLifetime time.Duration
+
+	// CRLURL, if non-empty, is the URL of a CRL signed by the root,
+	// listing revoked intermediates. It's fetched by RefreshCRL.
+	CRLURL string
+	// OCSPURL, if non-empty, is the URL of an OCSP responder for the
+	// intermediates signed by the root.
+	OCSPURL string
+	// HTTPClient is used to fetch the CRL and query the OCSP
+	// responder. Nil means http.DefaultClient.
+	HTTPClient *http.Client
+}
+
+// A CA issues and verifies the TLS certificates of buildlets.
+// It's safe for concurrent use.
+type CA struct {
+	opts            Options
+	root            *x509.Certificate
+	intermediate    *x509.Certificate
+	intermediatePEM []byte
+	intermediateKey crypto.Signer
+	now             func() time.Time
+
+	mu         sync.Mutex
+	issuer     *issuer
+	certs      map[string]*x509.Certificate // outstanding certificates by buildlet name
+	revoked    map[string]time.Time         // locally revoked serial numbers → expiry
+	crl        *crl                         // nil until the CRL is first fetched
+	ocspStatus map[string]ocspStatus        // by serial number of intermediate
+}
+
+// An issuer is an issuing certificate and its key.
+type issuer struct {
+	cert    *x509.Certificate
+	certPEM []byte
+	key     crypto.Signer
+}
+
+// New returns a CA configured by opts.
+func New(opts Options) (*CA, error) {
+	if opts.RotateEvery == 0 {
+		opts.RotateEvery = DefaultRotateEvery
+	}
+	if opts.MaxLifetime == 0 {
+		opts.MaxLifetime = DefaultMaxLifetime
+	}
+	if opts.HTTPClient == nil {
+		opts.HTTPClient = http.DefaultClient
+	}
+	if opts.Root == nil && opts.Intermediate == nil {
+		root, _, intermediate, err := newRoot(time.Now())
+		if err != nil {
+			return nil, fmt.Errorf("generating root: %v", err)
+		}
+		opts.Root, opts.Intermediate = root, intermediate
+	}
+	if opts.Root == nil || opts.Intermediate == nil {
+		return nil, errors.New("Root and Intermediate must both be set, or neither")
+	}
+	intermediate, err := x509.ParseCertificate(opts.Intermediate.Certificate[0])
+	if err != nil {
+		return nil, fmt.Errorf("parsing intermediate certificate: %v", err)
+	}
+	if err := intermediate.CheckSignatureFrom(opts.Root); err != nil {
+		return nil, fmt.Errorf("intermediate isn't signed by the root: %v", err)
+	}
+	key, ok := opts.Intermediate.PrivateKey.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("intermediate private key is a %T, not a crypto.Signer", opts.Intermediate.PrivateKey)
+	}
+	return &CA{
+		opts:            opts,
+		root:            opts.Root,
+		intermediate:    intermediate,
+		intermediatePEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: intermediate.Raw}),
+		intermediateKey: key,
+		now:             time.Now,
+		certs:           make(map[string]*x509.Certificate),
+		revoked:         make(map[string]time.Time),
+		ocspStatus:      make(map[string]ocspStatus),
+	}, nil
+}
+
+// Issue returns a new key pair for the buildlet with the given name,
+// valid for lifetime, at most Options.MaxLifetime. The key pair's
+// certificate PEM includes its issuing certificate and intermediate,
+// and the key pair verifies
+// the buildlet's certificate with Verify.
+//
+// A buildlet that's issued a new key pair, such as a reused name, has
+// its previous certificate revoked.
+func (ca *CA) Issue(name string, lifetime time.Duration) (buildlet.KeyPair, error) {
+	if lifetime <= 0 || lifetime > ca.opts.MaxLifetime {
+		lifetime = ca.opts.MaxLifetime
+	}
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return buildlet.KeyPair{}, err
+	}
+
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+	now := ca.now()
+	iss, err := ca.issuerLocked(now)
+	if err != nil {
+		return buildlet.KeyPair{}, err
+	}
+	serial, err := newSerial()
+	if err != nil {
+		return buildlet.KeyPair{}, err
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{Organization: []string{"Go Build Infrastructure"}, CommonName: name},
+		NotBefore:             now.Add(-clockSkew),
+		NotAfter:              now.Add(lifetime),
+		KeyUsage:              x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		DNSNames:              []string{name, "localhost"},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, iss.cert, &priv.PublicKey, iss.key)
+	if err != nil {
+		return buildlet.KeyPair{}, fmt.Errorf("creating certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return buildlet.KeyPair{}, err
+	}
+	if old, ok := ca.certs[name]; ok {
+		ca.revoked[old.SerialNumber.String()] = old.NotAfter
+	}
+	ca.certs[name] = cert
+
+	var certPEM bytes.Buffer
+	pem.Encode(&certPEM, &pem.Block{Type: "CERTIFICATE", Bytes: der})
+	certPEM.Write(iss.certPEM)
+	certPEM.Write(ca.intermediatePEM)
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(priv)})
+	return buildlet.KeyPair{
+		CertPEM: certPEM.String(),
+		KeyPEM:  string(keyPEM),
+		Verify:  ca.Verify,
+	}, nil
+}
+
+// Revoke revokes the certificate of the buildlet with the given name,
+// such as once it's destroyed. Revoking a buildlet without a
+// certificate does nothing.
+func (ca *CA) Revoke(name string) {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+	if cert, ok := ca.certs[name]; ok {
+		ca.revoked[cert.SerialNumber.String()] = cert.NotAfter
+		delete(ca.certs, name)
+	}
+}
+
+// issuerLocked returns the current issuer, rotating it if it's due.
+func (ca *CA) issuerLocked(now time.Time) (*issuer, error) {
+	if ca.issuer != nil && now.Sub(ca.issuer.cert.NotBefore.Add(clockSkew)) < ca.opts.RotateEvery {
+		return ca.issuer, nil
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	serial, err := newSerial()
+	if err != nil {
+		return nil, err
+	}
+	// The issuing certificate must outlive the certificates it
+	// issues until its rotation by up to MaxLifetime.
+	notAfter := now.Add(ca.opts.RotateEvery + ca.opts.MaxLifetime)
+	if notAfter.After(ca.intermediate.NotAfter) {
+		return nil, fmt.Errorf("intermediate certificate expires at %v, before a new issuing certificate would", ca.intermediate.NotAfter)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{Organization: []string{"Go Build Infrastructure"}, CommonName: "buildlet issuing CA"},
+		NotBefore:             now.Add(-clockSkew),
+		NotAfter:              notAfter,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.intermediate, key.Public(), ca.intermediateKey)
+	if err != nil {
+		return nil, fmt.Errorf("creating issuing certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	ca.issuer = &issuer{
+		cert:    cert,
+		certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		key:     key,
+	}
+	return ca.issuer, nil
+}
+
+// Verify verifies chain, the certificates presented by a buildlet,
+// leaf first. It returns an error unless the leaf chains up to the
+// root and none of the certificates it chains through has been revoked.
+//
+// A revocation status that can't be determined, such as because the
+// CRL is stale or the OCSP responder is down, is logged but doesn't
+// fail verification; see Stats for the age of the CRL.
+func (ca *CA) Verify(chain []*x509.Certificate) error {
+	if len(chain) == 0 {
+		return errors.New("no certificates")
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.root)
+	intermediates := x509.NewCertPool()
+	for _, c := range chain[1:] {
+		intermediates.AddCert(c)
+	}
+	now := ca.now()
+	verified, err := chain[0].Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   now,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	})
+	if err != nil {
+		return err
+	}
+	// All chains have the same leaf, issuing certificate and
+	// intermediate, by construction.
+	v := verified[0]
+	for _, c := range v[:len(v)-1] {
+		if err := ca.checkRevoked(c); err != nil {
+			return err
+		}
+	}
+	if len(v) >= 3 {
+		if err := ca.checkOCSP(v[len(v)-2], now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Stats describes the state of a CA at a point in time.
+type Stats struct {
+	// IssuerAge is the age of the current issuing certificate, or
+	// zero if there is none yet.
+	IssuerAge time.Duration
+	// Certs is the number of outstanding buildlet certificates, which
+	// are neither expired nor revoked.
+	Certs int
+	// OldestCert is the age of the oldest outstanding certificate.
+	OldestCert time.Duration
+	// Revoked is the number of certificates revoked locally that
+	// haven't expired.
+	Revoked int
+	// CRLAge is the time since the CRL was last fetched, or zero if
+	// it never was.
+	CRLAge time.Duration
+}
+
+// Stats returns the current state of the CA. It also forgets about
+// expired certificates.
+func (ca *CA) Stats() Stats {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+	now := ca.now()
+	ca.pruneLocked(now)
+	var st Stats
+	if ca.issuer != nil {
+		st.IssuerAge = now.Sub(ca.issuer.cert.NotBefore.Add(clockSkew))
+	}
+	st.Certs = len(ca.certs)
+	for _, c := range ca.certs {
+		if age := now.Sub(c.NotBefore.Add(clockSkew)); age > st.OldestCert {
+			st.OldestCert = age
+		}
+	}
+	st.Revoked = len(ca.revoked)
+	if ca.crl != nil {
+		st.CRLAge = now.Sub(ca.crl.fetched)
+	}
+	return st
+}
+
+// pruneLocked forgets about expired certificates.
+func (ca *CA) pruneLocked(now time.Time) {
+	for name, c := range ca.certs {
+		if now.After(c.NotAfter) {
+			delete(ca.certs, name)
+		}
+	}
+	for serial, notAfter := range ca.revoked {
+		if now.After(notAfter) {
+			delete(ca.revoked, serial)
+		}
+	}
+	for serial, st := range ca.ocspStatus {
+		if now.After(st.nextUpdate) {
+			delete(ca.ocspStatus, serial)
+		}
+	}
+}
+
+func newSerial() (*big.Int, error) {
+	return rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+}
+
+// newRoot generates a self-signed root certificate and its key, and an
+// intermediate signed by it, for CAs without a configured root.
+func newRoot(now time.Time) (*x509.Certificate, crypto.Signer, *tls.Certificate, error) {
+	rootKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	serial, err := newSerial()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{Organization: []string{"Go Build Infrastructure"}, CommonName: "buildlet root CA"},
+		NotBefore:             now.Add(-clockSkew),
+		NotAfter:              now.Add(10 * 365 * 24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, rootKey.Public(), rootKey)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	root, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if serial, err = newSerial(); err != nil {
+		return nil, nil, nil, err
+	}
+	tmpl = &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{Organization: []string{"Go Build Infrastructure"}, CommonName: "buildlet intermediate CA"},
+		NotBefore:             now.Add(-clockSkew),
+		NotAfter:              root.NotAfter,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLen:            1,
+	}
+	if der, err = x509.CreateCertificate(rand.Reader, tmpl, root, key.Public(), rootKey); err != nil {
+		return nil, nil, nil, err
+	}
+	return root, rootKey, &tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, nil
+}
@@ -0,0 +1,257 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package buildletca
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang.org/x/build/buildlet"
+	"golang.org/x/crypto/ocsp"
+)
+
+// fakeClock is a settable clock for CAs.
+type fakeClock struct{ t time.Time }
+
+func (c *fakeClock) now() time.Time { return c.t }
+
+// newTestCA returns a CA configured by opts, with a new root and
+// intermediate, the clock of the CA, and the root's private key.
+func newTestCA(t *testing.T, opts Options) (*CA, *fakeClock, crypto.Signer) {
+	t.Helper()
+	clock := &fakeClock{t: time.Now().Truncate(time.Second)}
+	root, rootKey, intermediate, err := newRoot(clock.t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts.Root, opts.Intermediate = root, intermediate
+	ca, err := New(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca.now = clock.now
+	return ca, clock, rootKey
+}
+
+func TestNewChecksIntermediate(t *testing.T) {
+	root, _, _, err := newRoot(time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, otherIntermediate, err := newRoot(time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := New(Options{Root: root, Intermediate: otherIntermediate}); err == nil {
+		t.Errorf("New with an intermediate of another root = nil error; want error")
+	}
+	if _, err := New(Options{Root: root}); err == nil {
+		t.Errorf("New with a root and no intermediate = nil error; want error")
+	}
+}
+
+// presentedChain returns the certificates a buildlet with kp presents
+// in a TLS handshake.
+func presentedChain(t *testing.T, kp buildlet.KeyPair) []*x509.Certificate {
+	t.Helper()
+	cert, err := tls.X509KeyPair([]byte(kp.CertPEM), []byte(kp.KeyPEM))
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, client := net.Pipe()
+	defer client.Close()
+	go func() {
+		defer server.Close()
+		tls.Server(server, &tls.Config{Certificates: []tls.Certificate{cert}}).Handshake()
+	}()
+	conn := tls.Client(client, &tls.Config{InsecureSkipVerify: true})
+	if err := conn.Handshake(); err != nil {
+		t.Fatal(err)
+	}
+	return conn.ConnectionState().PeerCertificates
+}
+
+func TestIssueAndRevoke(t *testing.T) {
+	ca, _, _ := newTestCA(t, Options{})
+	kp, err := ca.Issue("buildlet-a", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain := presentedChain(t, kp)
+	if len(chain) != 3 {
+		t.Fatalf("buildlet presented %d certificates; want leaf, issuing certificate and intermediate", len(chain))
+	}
+	if got, want := chain[0].NotAfter.Sub(chain[0].NotBefore), time.Hour+clockSkew; got != want {
+		t.Errorf("certificate lifetime = %v; want %v", got, want)
+	}
+	if err := kp.Verify(chain); err != nil {
+		t.Errorf("Verify of issued certificate = %v; want nil", err)
+	}
+	if st := ca.Stats(); st.Certs != 1 || st.Revoked != 0 {
+		t.Errorf("Stats() = %+v; want 1 certificate, 0 revoked", st)
+	}
+
+	other, _, _ := newTestCA(t, Options{})
+	if err := other.Verify(chain); err == nil {
+		t.Errorf("Verify by another CA = nil; want error")
+	}
+
+	ca.Revoke("buildlet-a")
+	if err := ca.Verify(chain); err == nil {
+		t.Errorf("Verify of revoked certificate = nil; want error")
+	}
+	if st := ca.Stats(); st.Certs != 0 || st.Revoked != 1 {
+		t.Errorf("Stats() after Revoke = %+v; want 0 certificates, 1 revoked", st)
+	}
+}
+
+func TestRotation(t *testing.T) {
+	ca, clock, _ := newTestCA(t, Options{RotateEvery: 24 * time.Hour, MaxLifetime: 12 * time.Hour})
+	kpA, err := ca.Issue("buildlet-a", 100*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chainA := presentedChain(t, kpA)
+	if got, want := chainA[0].NotAfter.Sub(chainA[0].NotBefore), 12*time.Hour+clockSkew; got != want {
+		t.Errorf("certificate lifetime = %v; want MaxLifetime, %v", got, want)
+	}
+
+	// Just before rotation, a certificate is issued that lasts until
+	// well after it.
+	clock.t = clock.t.Add(23 * time.Hour)
+	kpB, err := ca.Issue("buildlet-b", 12*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chainB := presentedChain(t, kpB)
+	clock.t = clock.t.Add(2 * time.Hour)
+	kpC, err := ca.Issue("buildlet-c", 12*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chainC := presentedChain(t, kpC)
+	if chainB[1].Equal(chainC[1]) {
+		t.Fatalf("issuing certificate wasn't rotated after RotateEvery")
+	}
+	if st := ca.Stats(); st.IssuerAge != 0 || st.Certs != 2 || st.OldestCert != 2*time.Hour {
+		t.Errorf("Stats() after rotation = %+v; want a new issuer and 2 certificates, the oldest 2h old", st)
+	}
+
+	// The old issuing certificate is still valid until all its
+	// certificates have expired.
+	clock.t = clock.t.Add(9 * time.Hour)
+	for _, chain := range [][]*x509.Certificate{chainB, chainC} {
+		if err := ca.Verify(chain); err != nil {
+			t.Errorf("Verify(%s) across rotation = %v; want nil", chain[0].Subject.CommonName, err)
+		}
+	}
+	if err := ca.Verify(chainA); err == nil {
+		t.Errorf("Verify of expired certificate = nil; want error")
+	}
+}
+
+func TestCRL(t *testing.T) {
+	ca, clock, rootKey := newTestCA(t, Options{})
+	kp, err := ca.Issue("buildlet-a", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain := presentedChain(t, kp)
+
+	var revoked []pkix.RevokedCertificate
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		crl, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+			Number:              big.NewInt(1),
+			ThisUpdate:          clock.t,
+			NextUpdate:          clock.t.Add(time.Hour),
+			RevokedCertificates: revoked,
+		}, ca.root, rootKey)
+		if err != nil {
+			t.Errorf("creating CRL: %v", err)
+		}
+		w.Write(crl)
+	}))
+	defer srv.Close()
+	ca.opts.CRLURL = srv.URL
+
+	ctx := context.Background()
+	if err := ca.RefreshCRL(ctx); err != nil {
+		t.Fatalf("RefreshCRL() = %v", err)
+	}
+	if err := ca.Verify(chain); err != nil {
+		t.Errorf("Verify with empty CRL = %v; want nil", err)
+	}
+	revoked = append(revoked, pkix.RevokedCertificate{SerialNumber: chain[2].SerialNumber, RevocationTime: clock.t})
+	if err := ca.RefreshCRL(ctx); err != nil {
+		t.Fatalf("RefreshCRL() = %v", err)
+	}
+	if err := ca.Verify(chain); err == nil {
+		t.Errorf("Verify with revoked intermediate = nil; want error")
+	}
+
+	// A CRL that isn't signed by the root is rejected.
+	other, _, _ := newTestCA(t, Options{CRLURL: srv.URL})
+	if err := other.RefreshCRL(ctx); err == nil {
+		t.Errorf("RefreshCRL() of CRL signed by another root = nil; want error")
+	}
+}
+
+func TestOCSP(t *testing.T) {
+	ca, clock, rootKey := newTestCA(t, Options{})
+	kp, err := ca.Issue("buildlet-a", 3*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain := presentedChain(t, kp)
+
+	status, queries := ocsp.Good, 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries++
+		b, _ := io.ReadAll(r.Body)
+		req, err := ocsp.ParseRequest(b)
+		if err != nil {
+			t.Errorf("parsing OCSP request: %v", err)
+		}
+		resp, err := ocsp.CreateResponse(ca.root, ca.root, ocsp.Response{
+			Status:       status,
+			SerialNumber: req.SerialNumber,
+			ThisUpdate:   clock.t,
+			NextUpdate:   clock.t.Add(time.Hour),
+			RevokedAt:    clock.t,
+		}, rootKey)
+		if err != nil {
+			t.Errorf("creating OCSP response: %v", err)
+		}
+		w.Write(resp)
+	}))
+	defer srv.Close()
+	ca.opts.OCSPURL = srv.URL
+
+	if err := ca.Verify(chain); err != nil {
+		t.Errorf("Verify with good OCSP status = %v; want nil", err)
+	}
+	status = ocsp.Revoked
+	if err := ca.Verify(chain); err != nil {
+		t.Errorf("Verify with cached good OCSP status = %v; want nil", err)
+	}
+	if queries != 1 {
+		t.Errorf("OCSP responder queried %d times; want 1", queries)
+	}
+	clock.t = clock.t.Add(61 * time.Minute)
+	if err := ca.Verify(chain); err == nil {
+		t.Errorf("Verify with revoked OCSP status = nil; want error")
+	}
+}
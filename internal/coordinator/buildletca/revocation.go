@@ -0,0 +1,184 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package buildletca
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"golang.org/x/build/internal"
+	"golang.org/x/crypto/ocsp"
+)
+
+// ocspRetryAfter is how long an OCSP status that couldn't be
+// determined is cached before the responder is queried again.
+const ocspRetryAfter = 5 * time.Minute
+
+// A crl is the content of a fetched CRL.
+type crl struct {
+	revoked    map[string]bool // by serial number
+	nextUpdate time.Time
+	fetched    time.Time
+}
+
+// An ocspStatus is the cached result of an OCSP query.
+type ocspStatus struct {
+	err        error // non-nil if the certificate is revoked
+	nextUpdate time.Time
+}
+
+// checkRevoked returns an error if c was revoked locally or by the
+// CRL.
+func (ca *CA) checkRevoked(c *x509.Certificate) error {
+	serial := c.SerialNumber.String()
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+	if _, ok := ca.revoked[serial]; ok {
+		return fmt.Errorf("certificate %s (%s) was revoked", serial, c.Subject.CommonName)
+	}
+	if ca.crl != nil && ca.crl.revoked[serial] {
+		return fmt.Errorf("certificate %s (%s) was revoked by the CRL", serial, c.Subject.CommonName)
+	}
+	return nil
+}
+
+// RunCRLRefresh fetches the CRL now and then every interval until ctx
+// is done. It does nothing if there's no Options.CRLURL.
+func (ca *CA) RunCRLRefresh(ctx context.Context, interval time.Duration) {
+	if ca.opts.CRLURL == "" {
+		return
+	}
+	refresh := func(ctx context.Context, _ time.Time) {
+		if err := ca.RefreshCRL(ctx); err != nil {
+			log.Printf("buildletca: refreshing CRL: %v", err)
+		}
+	}
+	refresh(ctx, time.Now())
+	internal.PeriodicallyDo(ctx, interval, refresh)
+}
+
+// RefreshCRL fetches the CRL at Options.CRLURL, PEM or DER encoded, and
+// uses it for verification if it's signed by the root. The previous CRL
+// stays in use if it can't be fetched.
+func (ca *CA) RefreshCRL(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", ca.opts.CRLURL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := ca.opts.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("fetching %s: %s", ca.opts.CRLURL, resp.Status)
+	}
+	b, err := io.ReadAll(io.LimitReader(resp.Body, 16<<20))
+	if err != nil {
+		return err
+	}
+	if block, _ := pem.Decode(b); block != nil {
+		b = block.Bytes
+	}
+	list, err := x509.ParseRevocationList(b)
+	if err != nil {
+		return fmt.Errorf("parsing CRL: %v", err)
+	}
+	if err := list.CheckSignatureFrom(ca.root); err != nil {
+		return fmt.Errorf("CRL isn't signed by the root: %v", err)
+	}
+	c := &crl{
+		revoked:    make(map[string]bool),
+		nextUpdate: list.NextUpdate,
+		fetched:    ca.now(),
+	}
+	for _, r := range list.RevokedCertificates {
+		c.revoked[r.SerialNumber.String()] = true
+	}
+	if !c.nextUpdate.IsZero() && c.fetched.After(c.nextUpdate) {
+		log.Printf("buildletca: CRL at %s is stale: its next update was due at %v", ca.opts.CRLURL, c.nextUpdate)
+	}
+	ca.mu.Lock()
+	ca.crl = c
+	ca.mu.Unlock()
+	return nil
+}
+
+// checkOCSP returns an error if the OCSP responder says that c, an
+// intermediate issued by the root, is revoked. Statuses are cached
+// until the responder's next update.
+func (ca *CA) checkOCSP(c *x509.Certificate, now time.Time) error {
+	if ca.opts.OCSPURL == "" {
+		return nil
+	}
+	serial := c.SerialNumber.String()
+	ca.mu.Lock()
+	st, ok := ca.ocspStatus[serial]
+	ca.mu.Unlock()
+	if ok && now.Before(st.nextUpdate) {
+		return st.err
+	}
+
+	st, err := ca.queryOCSP(c, now)
+	if err != nil {
+		log.Printf("buildletca: OCSP status of certificate %s unknown: %v", serial, err)
+		st = ocspStatus{nextUpdate: now.Add(ocspRetryAfter)}
+	}
+	ca.mu.Lock()
+	ca.ocspStatus[serial] = st
+	ca.mu.Unlock()
+	return st.err
+}
+
+func (ca *CA) queryOCSP(c *x509.Certificate, now time.Time) (ocspStatus, error) {
+	reqDER, err := ocsp.CreateRequest(c, ca.root, nil)
+	if err != nil {
+		return ocspStatus{}, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "POST", ca.opts.OCSPURL, bytes.NewReader(reqDER))
+	if err != nil {
+		return ocspStatus{}, err
+	}
+	req.Header.Set("Content-Type", "application/ocsp-request")
+	resp, err := ca.opts.HTTPClient.Do(req)
+	if err != nil {
+		return ocspStatus{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return ocspStatus{}, fmt.Errorf("querying %s: %s", ca.opts.OCSPURL, resp.Status)
+	}
+	b, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return ocspStatus{}, err
+	}
+	r, err := ocsp.ParseResponseForCert(b, c, ca.root)
+	if err != nil {
+		return ocspStatus{}, err
+	}
+	st := ocspStatus{nextUpdate: r.NextUpdate}
+	if st.nextUpdate.IsZero() {
+		st.nextUpdate = now.Add(time.Hour)
+	}
+	switch r.Status {
+	case ocsp.Good:
+	case ocsp.Revoked:
+		st.err = fmt.Errorf("certificate %s (%s) was revoked by the OCSP responder at %v", c.SerialNumber, c.Subject.CommonName, r.RevokedAt)
+	default:
+		return ocspStatus{}, fmt.Errorf("responder doesn't know the certificate")
+	}
+	return st, nil
+}
@@ -22,6 +22,7 @@ import (
 	"golang.org/x/build/dashboard"
 	"golang.org/x/build/internal"
 	"golang.org/x/build/internal/cloud"
+	"golang.org/x/build/internal/coordinator/buildletca"
 	"golang.org/x/build/internal/coordinator/pool/queue"
 	"golang.org/x/build/internal/spanlog"
 )
@@ -88,6 +89,18 @@ type EC2Buildlet struct {
 	cancelPoll context.CancelFunc
 	// pollWait waits for all pollers to terminate polling.
 	pollWait sync.WaitGroup
+	// ca, if non-nil, issues the TLS certificates of buildlets.
+	ca *buildletca.CA
+}
+
+// WithBuildletCA makes the pool issue the TLS certificates of its
+// buildlets with ca, valid for as long as each VM may live, rather than
+// generate long-lived self-signed ones. Certificates of destroyed VMs
+// are revoked.
+func WithBuildletCA(ca *buildletca.CA) EC2Opt {
+	return func(eb *EC2Buildlet) {
+		eb.ca = ca
+	}
 }
 
 // ec2BuildletClient represents an EC2 buildlet client in the buildlet package.
@@ -160,7 +173,7 @@ func (eb *EC2Buildlet) GetBuildlet(ctx context.Context, hostType string, lg Logg
 	}
 	instName := instanceName(hostType, 7)
 	log.Printf("Creating EC2 VM %q for %s", instName, hostType)
-	kp, err := buildlet.NewKeyPair()
+	kp, err := eb.newKeyPair(instName, hconf)
 	if err != nil {
 		log.Printf("failed to create TLS key pair for %s: %s", hostType, err)
 		return nil, fmt.Errorf("failed to create TLS key pair: %w", err)
@@ -209,6 +222,9 @@ func (eb *EC2Buildlet) GetBuildlet(ctx context.Context, hostType string, lg Logg
 			log.Printf("EC2 VM %q failed initialize buildlet client. deleting...", instName)
 			eb.buildletDone(instName)
 		} else {
+			if eb.ca != nil {
+				eb.ca.Revoke(instName)
+			}
 			eb.ledger.Remove(instName)
 		}
 		return nil, err
@@ -223,6 +239,16 @@ func (eb *EC2Buildlet) GetBuildlet(ctx context.Context, hostType string, lg Logg
 	return bc, nil
 }
 
+// newKeyPair returns the TLS key pair of the new VM instName of hconf.
+func (eb *EC2Buildlet) newKeyPair(instName string, hconf *dashboard.HostConfig) (buildlet.KeyPair, error) {
+	if eb.ca == nil {
+		return buildlet.NewKeyPair()
+	}
+	// The VM is deleted after its delete timeout at the latest; allow
+	// for the time it takes to boot.
+	return eb.ca.Issue(instName, determineDeleteTimeout(hconf)+10*time.Minute)
+}
+
 func (eb *EC2Buildlet) QuotaStats() map[string]*queue.QuotaStats {
 	return map[string]*queue.QuotaStats{
 		"ec2-cpu": eb.ledger.cpuQueue.ToExported(),
@@ -261,6 +287,9 @@ func (eb *EC2Buildlet) WriteHTMLStatus(w io.Writer) {
 // untracked instances will be cleaned up by the polling cleanupUnusedVMs
 // method.
 func (eb *EC2Buildlet) buildletDone(instName string) {
+	if eb.ca != nil {
+		eb.ca.Revoke(instName)
+	}
 	vmID := eb.ledger.InstanceID(instName)
 	if vmID == "" {
 		log.Printf("EC2 vm %s not found", instName)
@@ -351,6 +351,8 @@ type GCEBuildlet struct {
 	n2dcpuQueue *queue.Quota
 	t2acpuQueue *queue.Quota
 	inst        map[string]time.Time // GCE VM instance name -> creationTime
+
+	warm *WarmPool // set by SetWarmPool
 }
 
 func (p *GCEBuildlet) pollQuotaLoop() {
@@ -440,6 +442,35 @@ func (p *GCEBuildlet) GetBuildlet(ctx context.Context, hostType string, lg Logge
 	if p.disabled {
 		return nil, errors.New("pool disabled by configuration")
 	}
+	if _, ok := dashboard.Hosts[hostType]; !ok {
+		return nil, fmt.Errorf("gcepool: unknown host type %q", hostType)
+	}
+	if bc := p.warm.Take(hostType); bc != nil {
+		lg.LogEventTime("got_warm_buildlet", bc.InstanceName())
+		return bc, nil
+	}
+	return p.createBuildlet(ctx, hostType, lg, si, 0)
+}
+
+// SetWarmPool configures p to keep targets[hostType] idle buildlets of
+// each host type booted, for at most maxIdle each, and returns the warm
+// pool, which must be Run. It must be called before p is used.
+func (p *GCEBuildlet) SetWarmPool(targets map[string]int, maxIdle time.Duration) *WarmPool {
+	p.warm = NewWarmPool(func(ctx context.Context, hostType string, lg Logger, si *queue.SchedItem) (buildlet.Client, error) {
+		return p.createBuildlet(ctx, hostType, lg, si, maxIdle)
+	}, targets, maxIdle)
+	return p.warm
+}
+
+// WarmPool returns p's warm pool, or nil if it has none.
+func (p *GCEBuildlet) WarmPool() *WarmPool {
+	return p.warm
+}
+
+// createBuildlet boots a VM buildlet of hostType. Its VM is deleted
+// after the host type's delete timeout plus idle, the longest it may
+// sit unused first.
+func (p *GCEBuildlet) createBuildlet(ctx context.Context, hostType string, lg Logger, si *queue.SchedItem, idle time.Duration) (bc buildlet.Client, err error) {
 	hconf, ok := dashboard.Hosts[hostType]
 	if !ok {
 		return nil, fmt.Errorf("gcepool: unknown host type %q", hostType)
@@ -486,7 +517,7 @@ func (p *GCEBuildlet) GetBuildlet(ctx context.Context, hostType string, lg Logge
 	attempts := 1
 	for {
 		bc, err = buildlet.StartNewVM(gcpCreds, buildEnv, instName, hostType, buildlet.VMOpts{
-			DeleteIn: determineDeleteTimeout(hconf),
+			DeleteIn: determineDeleteTimeout(hconf) + idle,
 			OnInstanceRequested: func() {
 				log.Printf("GCE VM %q now booting", instName)
 			},
@@ -539,6 +570,7 @@ func (p *GCEBuildlet) WriteHTMLStatus(w io.Writer) {
 		}
 		fmt.Fprintf(w, "</ul>")
 	}
+	p.warm.WriteHTMLStatus(w)
 }
 
 func (p *GCEBuildlet) String() string {
@@ -807,11 +839,16 @@ func syncBuildStatsLoop(env *buildenv.Environment) {
 	}
 }
 
+// basepinInterval is how often basepin disks are brought up to date
+// with the VM images.
+const basepinInterval = time.Hour
+
 // createBasepinDisks creates zone-local copies of VM disk images, to
-// speed up VM creations in the future.
+// speed up VM creations in the future. It keeps them up to date, so
+// that images added or updated after start-up are pinned too.
 //
-// Other than a list call, this a no-op unless new VM images were
-// added or updated recently.
+// Other than a list call, each pass is a no-op unless new VM images
+// were added or updated recently.
 func createBasepinDisks(ctx context.Context) {
 	for {
 		t0 := time.Now()
@@ -831,7 +868,7 @@ func createBasepinDisks(ctx context.Context) {
 		}
 		basePinErr.Store("")
 		log.Printf("basepin: created basepin disks after %v", d)
-		return
+		time.Sleep(basepinInterval)
 	}
 }
 
@@ -106,6 +106,23 @@ func (p *Process) PutBuildRecord(br *types.BuildRecord) {
 	}
 }
 
+// PutTryBotResult records the result of a build of a TryBot run.
+// Results are keyed by run, so running the TryBots again on the same
+// commit adds new results rather than replacing the old ones, and by
+// every branch and repo that a run builds a builder with, so the
+// builds of a Go CL with each x/ repo don't replace each other.
+func (p *Process) PutTryBotResult(r *types.TryBotResult) {
+	dsClient := NewGCEConfiguration().DSClient()
+	if dsClient == nil {
+		return
+	}
+	ctx := context.Background()
+	key := datastore.NameKey("TryBotResult", fmt.Sprintf("%s-%s-%s-%s-%s", r.TryID, r.Builder, r.GoBranch, r.SubRepo, r.SubBranch), nil)
+	if _, err := dsClient.Put(ctx, key, r); err != nil {
+		log.Printf("datastore TryBotResult Put: %v", err)
+	}
+}
+
 func (p *Process) PutSpanRecord(sr *types.SpanRecord) {
 	dsClient := NewGCEConfiguration().DSClient()
 	if dsClient == nil {
@@ -73,7 +73,7 @@ func instanceName(hostType string, length int) string {
 // with the following priority:
 //
 // 1. Host type override from host config.
-// 2. Global default.
+// 2. Global default, scaled by the host's speed class.
 func determineDeleteTimeout(host *dashboard.HostConfig) time.Duration {
 	if host.CustomDeleteTimeout != 0 {
 		return host.CustomDeleteTimeout
@@ -102,7 +102,7 @@ func determineDeleteTimeout(host *dashboard.HostConfig) time.Duration {
 	// A global timeout of 45 minutes was chosen in 2015.
 	// Longtest builders were added in 2018 started to reach 45 mins by 2021-2022.
 	// Try 2 hours next, which might last some years (depending on test volume and test speed).
-	return 2 * time.Hour
+	return 2 * time.Hour * time.Duration(host.SpeedClass.TimeoutScale())
 }
 
 // isBuildlet checks the name string in order to determine if the name is for a buildlet.
@@ -18,6 +18,7 @@ func TestPoolDetermineDeleteTimeout(t *testing.T) {
 	testCases := []struct {
 		desc        string
 		hostValue   time.Duration
+		speedClass  dashboard.SpeedClass
 		wantTimeout time.Duration
 	}{
 		{
@@ -29,11 +30,23 @@ func TestPoolDetermineDeleteTimeout(t *testing.T) {
 			hostValue:   8 * time.Hour,
 			wantTimeout: 8 * time.Hour,
 		},
+		{
+			desc:        "slow-host",
+			speedClass:  dashboard.SpeedSlow,
+			wantTimeout: 10 * time.Hour,
+		},
+		{
+			desc:        "slow-host-with-override",
+			hostValue:   3 * time.Hour,
+			speedClass:  dashboard.SpeedSlow,
+			wantTimeout: 3 * time.Hour,
+		},
 	}
 	for _, tc := range testCases {
 		t.Run(tc.desc, func(t *testing.T) {
 			h := &dashboard.HostConfig{
 				CustomDeleteTimeout: tc.hostValue,
+				SpeedClass:          tc.speedClass,
 			}
 			if got := determineDeleteTimeout(h); got != tc.wantTimeout {
 				t.Errorf("determineDeleteTimeout(%+v) = %s; want %s", h, got, tc.wantTimeout)
@@ -11,16 +11,10 @@ import (
 	"golang.org/x/build/internal/buildgo"
 )
 
+// BuildletPriority is the rank of the tier of a buildlet request under
+// the current tiers (see SetTiers). Lower values are more important.
 type BuildletPriority int
 
-const (
-	// PriorityUrgent is reserved for Go releases.
-	PriorityUrgent BuildletPriority = iota
-	PriorityInteractive
-	PriorityAutomated
-	PriorityBatch
-)
-
 // SchedItem is a specification of a requested buildlet in its
 // exported fields, and internal scheduler state used while waiting
 // for that buildlet.
@@ -33,6 +27,7 @@ type SchedItem struct {
 	IsGomote           bool
 	IsTry              bool
 	IsHelper           bool
+	IsSpeculative      bool
 	Repo               string
 	Branch             string // the Go repository branch
 
@@ -45,20 +40,27 @@ type SchedItem struct {
 	User        string
 }
 
-// Priority returns the BuildletPriority for a SchedItem.
-func (s *SchedItem) Priority() BuildletPriority {
+// Kind returns the kind of request a SchedItem is.
+func (s *SchedItem) Kind() Kind {
 	switch {
 	case s.IsRelease:
-		return PriorityUrgent
+		return KindRelease
 	case s.IsGomote:
-		return PriorityInteractive
+		return KindGomote
 	case s.IsTry:
-		return PriorityAutomated
+		return KindTry
+	case s.IsSpeculative:
+		return KindSpeculative
 	default:
-		return PriorityBatch
+		return KindPostSubmit
 	}
 }
 
+// Priority returns the BuildletPriority for a SchedItem.
+func (s *SchedItem) Priority() BuildletPriority {
+	return (*tiers.Load())[s.Kind()]
+}
+
 func (s *SchedItem) SortTime() time.Time {
 	if s.IsGomote || s.IsTry || s.CommitTime.IsZero() {
 		return s.RequestTime
@@ -75,10 +77,10 @@ func (s *SchedItem) Less(other *SchedItem) bool {
 	// Release branch work tends to starve because the Go commits are old.
 	// Prioritize release branch work over other branches.
 	releaseBranch := func(i *SchedItem) bool { return strings.HasPrefix(s.Branch, "release-branch") }
-	if s.Priority() == PriorityAutomated && releaseBranch(s) != releaseBranch(other) {
+	if s.Kind() == KindTry && releaseBranch(s) != releaseBranch(other) {
 		return releaseBranch(s)
 	}
-	if s.Priority() == PriorityBatch {
+	if s.Kind() == KindPostSubmit {
 		// Batch items are completed in LIFO.
 		return s.SortTime().After(other.SortTime())
 	}
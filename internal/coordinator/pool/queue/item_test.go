@@ -5,6 +5,7 @@
 package queue
 
 import (
+	"reflect"
 	"testing"
 	"time"
 )
@@ -29,9 +30,21 @@ func TestSchedItemLess(t *testing.T) {
 			want: true,
 		},
 		{
-			name: "gomote over try",
+			name: "try over gomote",
 			a: &SchedItem{
+				IsTry:       true,
+				RequestTime: t2,
+			},
+			b: &SchedItem{
 				IsGomote:    true,
+				RequestTime: t1,
+			},
+			want: true,
+		},
+		{
+			name: "release over try",
+			a: &SchedItem{
+				IsRelease:   true,
 				RequestTime: t2,
 			},
 			b: &SchedItem{
@@ -75,6 +88,17 @@ func TestSchedItemLess(t *testing.T) {
 			},
 			want: true,
 		},
+		{
+			name: "reg over speculative",
+			a: &SchedItem{
+				CommitTime: t1,
+			},
+			b: &SchedItem{
+				IsSpeculative: true,
+				RequestTime:   t1,
+			},
+			want: true,
+		},
 		{
 			name: "release branch less than master",
 			a: &SchedItem{
@@ -100,3 +124,29 @@ func TestSchedItemLess(t *testing.T) {
 		})
 	}
 }
+
+func TestSetTiers(t *testing.T) {
+	defer SetTiers(DefaultTiers)
+
+	gomote := &SchedItem{IsGomote: true, RequestTime: time.Now()}
+	try := &SchedItem{IsTry: true, RequestTime: time.Now()}
+	if !try.Less(gomote) {
+		t.Errorf("with the default tiers, gomote ranks before try")
+	}
+	if err := SetTiers([]Kind{KindGomote}); err != nil {
+		t.Fatal(err)
+	}
+	if !gomote.Less(try) {
+		t.Errorf("with gomote tiered first, try ranks before gomote")
+	}
+	want := []Kind{KindGomote, KindRelease, KindTry, KindPostSubmit, KindSpeculative}
+	if got := Tiers(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Tiers() = %v, want %v", got, want)
+	}
+
+	for _, kinds := range [][]Kind{{"nightly"}, {KindTry, KindTry}} {
+		if err := SetTiers(kinds); err == nil {
+			t.Errorf("SetTiers(%v) = nil, want error", kinds)
+		}
+	}
+}
@@ -27,12 +27,24 @@ type Quota struct {
 	// On GCE, other instances run in the same project as buildlet
 	// instances. Track those separately, and subtract from available.
 	untrackedUsed int
+	// tiersGen is the tiersGen the queue was ordered under.
+	tiersGen int64
+}
+
+// reorder restores the order of the queue if the tiers changed.
+// The Quota lock must be held.
+func (q *Quota) reorder() {
+	if gen := tiersGen.Load(); gen != q.tiersGen {
+		heap.Init(q.queue)
+		q.tiersGen = gen
+	}
 }
 
 func (q *Quota) push(item *Item) {
 	defer q.updated()
 	q.mu.Lock()
 	defer q.mu.Unlock()
+	q.reorder()
 	heap.Push(q.queue, item)
 }
 
@@ -40,6 +52,7 @@ func (q *Quota) cancel(item *Item) {
 	defer q.updated()
 	q.mu.Lock()
 	defer q.mu.Unlock()
+	q.reorder()
 	if item.index != -1 {
 		heap.Remove(q.queue, item.index)
 	}
@@ -58,6 +71,7 @@ func (q *Quota) updated() {
 func (q *Quota) tryPop() *Item {
 	q.mu.Lock()
 	defer q.mu.Unlock()
+	q.reorder()
 	if !(q.queue.Len() != 0 && q.queue.Peek().cost <= q.limit-q.used-q.untrackedUsed) {
 		return nil
 	}
@@ -205,12 +205,12 @@ func TestQueueToExported(t *testing.T) {
 		},
 		Items: []ItemStats{
 			{Build: &SchedItem{IsRelease: true}, Cost: 100},
-			{Build: &SchedItem{IsGomote: true}, Cost: 100},
-			{Build: &SchedItem{IsGomote: true}, Cost: 100},
-			{Build: &SchedItem{IsGomote: true}, Cost: 100},
 			{Build: &SchedItem{IsTry: true}, Cost: 100},
 			{Build: &SchedItem{IsTry: true}, Cost: 100},
 			{Build: &SchedItem{IsTry: true}, Cost: 100},
+			{Build: &SchedItem{IsGomote: true}, Cost: 100},
+			{Build: &SchedItem{IsGomote: true}, Cost: 100},
+			{Build: &SchedItem{IsGomote: true}, Cost: 100},
 		},
 	}
 	got := q.ToExported()
@@ -218,3 +218,20 @@ func TestQueueToExported(t *testing.T) {
 		t.Errorf("q.ToExported() mismatch (-want +got):\n%s", diff)
 	}
 }
+
+func TestQueueSetTiers(t *testing.T) {
+	defer SetTiers(DefaultTiers)
+
+	q := NewQuota()
+	gomote := q.Enqueue(1, &SchedItem{IsGomote: true})
+	q.Enqueue(1, &SchedItem{IsTry: true})
+	if err := SetTiers([]Kind{KindGomote}); err != nil {
+		t.Fatal(err)
+	}
+	q.UpdateLimit(1)
+	select {
+	case <-gomote.popped:
+	default:
+		t.Errorf("after tiering gomote first, the try item was popped first")
+	}
+}
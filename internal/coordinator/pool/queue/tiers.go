@@ -0,0 +1,91 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package queue
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// A Kind is a kind of buildlet request. The scheduling policy ranks
+// kinds into priority tiers.
+type Kind string
+
+const (
+	KindRelease    Kind = "release"     // Go releases
+	KindTry        Kind = "try"         // trybots
+	KindGomote     Kind = "gomote"      // gomote instances
+	KindPostSubmit Kind = "post-submit" // post-submit builds
+	// KindSpeculative requests are for speculative builds of CLs
+	// before they're submitted, which are only worth running when
+	// post-submit builds aren't waiting.
+	KindSpeculative Kind = "speculative"
+)
+
+// DefaultTiers is the default ranking of kinds of requests, most
+// important first: release builds over trybots over gomote instances
+// over post-submit builds.
+var DefaultTiers = []Kind{KindRelease, KindTry, KindGomote, KindPostSubmit, KindSpeculative}
+
+// tierRanks maps each kind to its BuildletPriority.
+type tierRanks map[Kind]BuildletPriority
+
+var (
+	// tiers holds the current tierRanks.
+	tiers atomic.Pointer[tierRanks]
+	// tiersGen is incremented by each SetTiers call, so that queues
+	// know to restore their heap order.
+	tiersGen atomic.Int64
+)
+
+func init() {
+	if err := SetTiers(DefaultTiers); err != nil {
+		panic(err)
+	}
+}
+
+// SetTiers sets the ranking of kinds of requests, most important
+// first. Kinds that aren't listed rank after those that are, in their
+// DefaultTiers order. Requests already waiting are reordered.
+func SetTiers(kinds []Kind) error {
+	r := make(tierRanks)
+	for _, k := range kinds {
+		if !k.valid() {
+			return fmt.Errorf("unknown kind of request %q", k)
+		}
+		if _, ok := r[k]; ok {
+			return fmt.Errorf("kind of request %q is listed twice", k)
+		}
+		r[k] = BuildletPriority(len(r))
+	}
+	for _, k := range DefaultTiers {
+		if _, ok := r[k]; !ok {
+			r[k] = BuildletPriority(len(r))
+		}
+	}
+	tiers.Store(&r)
+	tiersGen.Add(1)
+	return nil
+}
+
+// Tiers returns the current ranking of all kinds of requests, most
+// important first.
+func Tiers() []Kind {
+	r := *tiers.Load()
+	kinds := make([]Kind, len(r))
+	for k, p := range r {
+		kinds[p] = k
+	}
+	return kinds
+}
+
+func (k Kind) valid() bool {
+	for _, d := range DefaultTiers {
+		if k == d {
+			return true
+		}
+	}
+	return false
+}
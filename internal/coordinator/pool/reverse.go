@@ -35,14 +35,18 @@ import (
 	"context"
 	"crypto/hmac"
 	"crypto/md5"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"html"
 	"io"
 	"log"
 	"math/rand"
 	"net"
 	"net/http"
 	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -50,10 +54,15 @@ import (
 	"golang.org/x/build/dashboard"
 	"golang.org/x/build/internal/coordinator/pool/queue"
 	"golang.org/x/build/revdial/v2"
+	"golang.org/x/build/types"
 )
 
 const minBuildletVersion = 23
 
+// maxClockSkew is how far a buildlet's clock may be from the
+// coordinator's before its self-test is considered failed.
+const maxClockSkew = 5 * time.Minute
+
 var (
 	reversePool = &ReverseBuildletPool{
 		hostLastGood: make(map[string]time.Time),
@@ -115,16 +124,16 @@ func (p *ReverseBuildletPool) BuildletLastSeen(host string) (time.Time, bool) {
 	return t, ok
 }
 
-// tryToGrab returns non-nil bc on success if a buildlet is free.
+// tryToGrab returns non-nil b on success if a buildlet is free.
 //
 // Otherwise it returns how many were busy, which might be 0 if none
-// were (yet?) registered. The busy valid is only valid if bc == nil.
-func (p *ReverseBuildletPool) tryToGrab(hostType string) (bc buildlet.Client, busy int) {
+// were (yet?) registered. The busy valid is only valid if b == nil.
+func (p *ReverseBuildletPool) tryToGrab(hostType string) (_ *reverseBuildlet, busy int) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 	defer p.updateQuotasLocked()
 	for _, b := range p.buildlets {
-		if b.hostType != hostType {
+		if b.hostType != hostType || b.selfTestErr != nil {
 			continue
 		}
 		if b.inUse {
@@ -134,7 +143,7 @@ func (p *ReverseBuildletPool) tryToGrab(hostType string) (bc buildlet.Client, bu
 		// Found an unused match.
 		b.inUse = true
 		b.inUseTime = time.Now()
-		return b.client, 0
+		return b, 0
 	}
 	return nil, busy
 }
@@ -148,7 +157,9 @@ func (p *ReverseBuildletPool) nukeBuildlet(victim buildlet.Client) {
 	defer p.updateQuotasLocked()
 	for i, rb := range p.buildlets {
 		if rb.client == victim {
-			defer rb.conn.Close()
+			if rb.conn != nil {
+				defer rb.conn.Close()
+			}
 			p.buildlets = append(p.buildlets[:i], p.buildlets[i+1:]...)
 			return
 		}
@@ -250,10 +261,10 @@ func (p *ReverseBuildletPool) GetBuildlet(ctx context.Context, hostType string,
 
 	seenErrInUse := false
 	for {
-		bc, busy := p.tryToGrab(hostType)
-		if bc != nil {
+		b, busy := p.tryToGrab(hostType)
+		if b != nil {
 			sp.Done(nil)
-			return p.cleanedBuildlet(bc, lg)
+			return p.cleanedBuildlet(b, lg)
 		}
 		if busy > 0 && !seenErrInUse {
 			lg.LogEventTime("waiting_machine_in_use")
@@ -267,16 +278,38 @@ func (p *ReverseBuildletPool) GetBuildlet(ctx context.Context, hostType string,
 	}
 }
 
-func (p *ReverseBuildletPool) cleanedBuildlet(b buildlet.Client, lg Logger) (buildlet.Client, error) {
-	// Clean up any files from previous builds.
-	sp := lg.CreateSpan("clean_buildlet", b.String())
-	err := b.RemoveAll(context.Background(), ".")
+// cleanWorkDirVersion is the first buildlet version that supports
+// cleaning its work directory to pristine and work directory quotas.
+const cleanWorkDirVersion = 28
+
+func (p *ReverseBuildletPool) cleanedBuildlet(b *reverseBuildlet, lg Logger) (buildlet.Client, error) {
+	bc := b.client
+	// Clean up any files from previous builds. Newer buildlets also
+	// verify that none were left behind to break this one.
+	sp := lg.CreateSpan("clean_buildlet", bc.String())
+	if v, _ := strconv.Atoi(b.version); v < cleanWorkDirVersion {
+		err := bc.RemoveAll(context.Background(), ".")
+		sp.Done(err)
+		if err != nil {
+			bc.Close()
+			return nil, err
+		}
+		return bc, nil
+	}
+	res, err := bc.CleanWorkDir(context.Background())
 	sp.Done(err)
 	if err != nil {
-		b.Close()
+		bc.Close()
 		return nil, err
 	}
-	return b, nil
+	lg.LogEventTime("cleaned_buildlet", fmt.Sprintf("reclaimed %d bytes", res.BytesReclaimed))
+	if hc := dashboard.Hosts[b.hostType]; hc != nil && hc.WorkDirQuotaGB > 0 {
+		if err := bc.SetWorkDirQuota(context.Background(), hc.WorkDirQuotaGB<<30); err != nil {
+			bc.Close()
+			return nil, err
+		}
+	}
+	return bc, nil
 }
 
 // WriteHTMLStatus writes a status of the reverse buildlet pool, in HTML format,
@@ -303,15 +336,20 @@ func (p *ReverseBuildletPool) WriteHTMLStatus(w io.Writer) {
 		if b.inUse {
 			machStatus = "working"
 			numInUse++
+		} else if b.selfTestErr != nil {
+			machStatus = "<b>unschedulable</b>"
 		}
 		fmt.Fprintf(&buf, "<li>%s (%s) version %s, %s: connected %s, %s for %s</li>\n",
 			b.hostname,
-			b.conn.RemoteAddr(),
+			b.remoteAddr,
 			b.version,
 			b.hostType,
 			friendlyDuration(time.Since(b.regTime)),
 			machStatus,
 			friendlyDuration(time.Since(b.inUseTime)))
+		if b.selfTestErr != nil {
+			fmt.Fprintf(&buf, "<ul><li>self-test failed: %s</li></ul>\n", html.EscapeString(b.selfTestErr.Error()))
+		}
 		total[b.hostType]++
 		if b.inUse && !b.inHealthCheck {
 
@@ -402,12 +440,13 @@ func (p *ReverseBuildletPool) HostTypes() (types []string) {
 }
 
 // CanBuild reports whether the pool has a machine capable of building mode,
-// even if said machine isn't currently idle.
+// even if said machine isn't currently idle. Machines that failed their
+// self-test aren't capable.
 func (p *ReverseBuildletPool) CanBuild(hostType string) bool {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 	for _, b := range p.buildlets {
-		if b.hostType == hostType {
+		if b.hostType == hostType && b.selfTestErr == nil {
 			return true
 		}
 	}
@@ -424,6 +463,9 @@ func (p *ReverseBuildletPool) updateQuotasLocked() {
 	limits := make(map[string]int)
 	used := make(map[string]int)
 	for _, b := range p.buildlets {
+		if b.selfTestErr != nil {
+			continue
+		}
 		limits[b.hostType] += 1
 		if b.inUse {
 			used[b.hostType] += 1
@@ -468,9 +510,14 @@ type reverseBuildlet struct {
 	// sessRand is the unique random number for every unique buildlet session.
 	sessRand string
 
-	client  buildlet.Client
-	conn    net.Conn
-	regTime time.Time // when it was first connected
+	client buildlet.Client
+	// conn is the revdial connection to the buildlet.
+	// It is nil for buildlets reached over the WireGuard mesh.
+	conn net.Conn
+	// remoteAddr is the address the buildlet connected from, or its
+	// mesh address.
+	remoteAddr string
+	regTime    time.Time // when it was first connected
 
 	// hostType is the configuration of this machine.
 	// It is the key into the dashboard.Hosts map.
@@ -483,6 +530,35 @@ type reverseBuildlet struct {
 	inUse         bool
 	inUseTime     time.Time
 	inHealthCheck bool
+
+	// selfTest is the buildlet's startup self-test report, or nil
+	// if it didn't send one. selfTestErr describes why it failed;
+	// such buildlets stay connected, so that they show up on the
+	// status page, but aren't given work.
+	selfTest    *types.BuildletSelfTest
+	selfTestErr error
+}
+
+// parseSelfTest parses the self-test report a buildlet sent in h
+// and checks it against the coordinator's clock, now. It returns a
+// nil report and error if there's no report, as with older buildlets.
+func parseSelfTest(h http.Header, now time.Time) (*types.BuildletSelfTest, error) {
+	v := h.Get(types.BuildletSelfTestHeader)
+	if v == "" {
+		return nil, nil
+	}
+	st := new(types.BuildletSelfTest)
+	if err := json.Unmarshal([]byte(v), st); err != nil {
+		return nil, fmt.Errorf("malformed self-test report: %v", err)
+	}
+	failures := append([]string(nil), st.Failures...)
+	if skew := now.Sub(st.Time); skew > maxClockSkew || skew < -maxClockSkew {
+		failures = append(failures, fmt.Sprintf("clock: %v off from the coordinator's", skew.Round(time.Second)))
+	}
+	if len(failures) > 0 {
+		return st, errors.New(strings.Join(failures, "; "))
+	}
+	return st, nil
 }
 
 // HandleReverse handles reverse buildlet connections.
@@ -525,6 +601,7 @@ func HandleReverse(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "invalid build key", http.StatusPreconditionFailed)
 		return
 	}
+	selfTest, selfTestErr := parseSelfTest(r.Header, time.Now())
 
 	conn, _, err := w.(http.Hijacker).Hijack()
 	if err != nil {
@@ -593,16 +670,22 @@ func HandleReverse(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	log.Printf("Buildlet %s/%s: %+v for %s", hostname, r.RemoteAddr, status, hostType)
+	if selfTestErr != nil {
+		log.Printf("Buildlet %s/%s for %s failed its self-test; not scheduling work on it: %v", hostname, r.RemoteAddr, hostType, selfTestErr)
+	}
 
 	now := time.Now()
 	b := &reverseBuildlet{
-		hostname:  hostname,
-		version:   buildletVersion,
-		hostType:  hostType,
-		client:    client,
-		conn:      conn,
-		inUseTime: now,
-		regTime:   now,
+		hostname:    hostname,
+		version:     buildletVersion,
+		hostType:    hostType,
+		client:      client,
+		conn:        conn,
+		remoteAddr:  r.RemoteAddr,
+		inUseTime:   now,
+		regTime:     now,
+		selfTest:    selfTest,
+		selfTestErr: selfTestErr,
 	}
 	reversePool.addBuildlet(b)
 }
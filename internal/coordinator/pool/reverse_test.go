@@ -0,0 +1,85 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build linux || darwin
+// +build linux darwin
+
+package pool
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/build/internal/coordinator/pool/queue"
+	"golang.org/x/build/types"
+)
+
+func TestParseSelfTest(t *testing.T) {
+	now := time.Date(2023, time.June, 1, 12, 0, 0, 0, time.UTC)
+	header := func(st *types.BuildletSelfTest) http.Header {
+		j, err := json.Marshal(st)
+		if err != nil {
+			t.Fatal(err)
+		}
+		h := make(http.Header)
+		h.Set(types.BuildletSelfTestHeader, string(j))
+		return h
+	}
+	tests := []struct {
+		desc    string
+		h       http.Header
+		wantErr string // substring; empty means no error
+	}{
+		{desc: "no report", h: http.Header{}},
+		{desc: "passed", h: header(&types.BuildletSelfTest{Time: now.Add(-time.Minute), DiskMBps: 100})},
+		{
+			desc:    "failed",
+			h:       header(&types.BuildletSelfTest{Time: now, Failures: []string{"disk: too slow", "network: unreachable"}}),
+			wantErr: "disk: too slow; network: unreachable",
+		},
+		{desc: "clock behind", h: header(&types.BuildletSelfTest{Time: now.Add(-time.Hour)}), wantErr: "clock: 1h0m0s off"},
+		{desc: "clock ahead", h: header(&types.BuildletSelfTest{Time: now.Add(10 * time.Minute)}), wantErr: "clock: -10m0s off"},
+		{desc: "malformed", h: http.Header{types.BuildletSelfTestHeader: []string{"{"}}, wantErr: "malformed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			_, err := parseSelfTest(tt.h, now)
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("parseSelfTest = %v; want no error", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("parseSelfTest = %v; want error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestReversePoolSkipsFailedSelfTest(t *testing.T) {
+	p := &ReverseBuildletPool{
+		hostLastGood: make(map[string]time.Time),
+		hostQueue:    make(map[string]*queue.Quota),
+	}
+	const hostType = "host-test-reverse"
+	p.buildlets = []*reverseBuildlet{
+		{hostname: "bad", hostType: hostType, selfTestErr: errors.New("disk: too slow")},
+	}
+	if p.CanBuild(hostType) {
+		t.Errorf("CanBuild with only a failed buildlet = true; want false")
+	}
+	if b, _ := p.tryToGrab(hostType); b != nil {
+		t.Errorf("tryToGrab returned %q, which failed its self-test", b.hostname)
+	}
+
+	p.buildlets = append(p.buildlets, &reverseBuildlet{hostname: "good", hostType: hostType})
+	if !p.CanBuild(hostType) {
+		t.Errorf("CanBuild with a good buildlet = false; want true")
+	}
+	if b, _ := p.tryToGrab(hostType); b == nil || b.hostname != "good" {
+		t.Errorf("tryToGrab = %v; want the good buildlet", b)
+	}
+}
@@ -0,0 +1,306 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build linux || darwin
+// +build linux darwin
+
+package pool
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/build/buildlet"
+	"golang.org/x/build/dashboard"
+	"golang.org/x/build/internal/coordinator/pool/queue"
+	"golang.org/x/build/internal/spanlog"
+)
+
+// warmFillTimeout is how long filling a warm pool may wait for quota
+// and for a buildlet to boot.
+const warmFillTimeout = 15 * time.Minute
+
+// warmRefillInterval is how often a warm pool is topped up, in
+// addition to after every buildlet taken from it.
+const warmRefillInterval = 30 * time.Second
+
+// A WarmPool keeps buildlets of some host types booted ahead of
+// demand, so that builds on those host types, which are mostly
+// trybots, don't wait minutes for a VM to boot and, on container
+// hosts, to pull its image.
+//
+// A nil *WarmPool is empty.
+type WarmPool struct {
+	// create boots a buildlet, such as GCEBuildlet.createBuildlet.
+	create  func(ctx context.Context, hostType string, lg Logger, si *queue.SchedItem) (buildlet.Client, error)
+	targets map[string]int // host type -> number of idle buildlets to keep
+	maxIdle time.Duration
+	now     func() time.Time
+
+	kick  chan struct{}
+	fills sync.WaitGroup
+
+	mu      sync.Mutex
+	idle    map[string][]*warmBuildlet // host type -> idle buildlets, oldest first
+	filling map[string]int             // host type -> buildlets booting
+	stats   map[string]*WarmStats      // host type -> stats
+}
+
+// warmBuildlet is an idle buildlet in a warm pool.
+type warmBuildlet struct {
+	bc    buildlet.Client
+	ready time.Time
+}
+
+// WarmStats are the statistics of a host type's buildlet starts.
+type WarmStats struct {
+	Target  int // number of idle buildlets kept
+	Idle    int // idle buildlets
+	Filling int // buildlets booting to be idle
+
+	Warm int64 // buildlets taken from the warm pool
+	Cold int64 // buildlets booted on demand
+}
+
+// NewWarmPool returns a warm pool that keeps targets[hostType] idle
+// buildlets of each host type, booted with create. Idle buildlets are
+// destroyed after maxIdle, to cap how long their VMs run unused.
+func NewWarmPool(create func(ctx context.Context, hostType string, lg Logger, si *queue.SchedItem) (buildlet.Client, error), targets map[string]int, maxIdle time.Duration) *WarmPool {
+	p := &WarmPool{
+		create:  create,
+		targets: targets,
+		maxIdle: maxIdle,
+		now:     time.Now,
+		kick:    make(chan struct{}, 1),
+		idle:    make(map[string][]*warmBuildlet),
+		filling: make(map[string]int),
+		stats:   make(map[string]*WarmStats),
+	}
+	for hostType, n := range targets {
+		p.stats[hostType] = &WarmStats{Target: n}
+	}
+	return p
+}
+
+// ParseWarmTargets parses a comma-separated list of hostType=count
+// pairs, such as "host-linux-amd64-bullseye=4,host-windows-amd64-2016=2",
+// into warm pool targets. Only GCE VM and container host types may
+// have warm buildlets.
+func ParseWarmTargets(s string) (map[string]int, error) {
+	targets := make(map[string]int)
+	for _, kv := range strings.Split(s, ",") {
+		kv = strings.TrimSpace(kv)
+		if kv == "" {
+			continue
+		}
+		hostType, count, ok := strings.Cut(kv, "=")
+		if !ok {
+			return nil, fmt.Errorf("warm pool target %q is not of the form hostType=count", kv)
+		}
+		n, err := strconv.Atoi(count)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("warm pool target %q: invalid count %q", kv, count)
+		}
+		hconf, ok := dashboard.Hosts[hostType]
+		if !ok {
+			return nil, fmt.Errorf("warm pool target %q: unknown host type %q", kv, hostType)
+		}
+		if hconf.IsEC2 || !(hconf.IsVM() || hconf.IsContainer()) {
+			return nil, fmt.Errorf("warm pool target %q: host type %q doesn't run on GCE", kv, hostType)
+		}
+		targets[hostType] = n
+	}
+	return targets, nil
+}
+
+// Take returns an idle buildlet of hostType, or nil if there's none,
+// in which case the caller must boot one itself. Either way, it counts
+// the buildlet start and tops up the pool.
+func (p *WarmPool) Take(hostType string) buildlet.Client {
+	if p == nil {
+		return nil
+	}
+	var bc buildlet.Client
+	var stale []buildlet.Client
+	p.mu.Lock()
+	st := p.statsLocked(hostType)
+	for len(p.idle[hostType]) > 0 {
+		wb := p.idle[hostType][0]
+		p.idle[hostType] = p.idle[hostType][1:]
+		if p.usable(wb) {
+			bc = wb.bc
+			break
+		}
+		stale = append(stale, wb.bc)
+	}
+	if bc != nil {
+		st.Warm++
+	} else {
+		st.Cold++
+	}
+	p.mu.Unlock()
+
+	for _, bc := range stale {
+		bc.Close()
+	}
+	if _, ok := p.targets[hostType]; ok {
+		select {
+		case p.kick <- struct{}{}:
+		default:
+		}
+	}
+	return bc
+}
+
+// usable reports whether an idle buildlet may be handed out.
+func (p *WarmPool) usable(wb *warmBuildlet) bool {
+	return !wb.bc.IsBroken() && p.now().Sub(wb.ready) < p.maxIdle
+}
+
+// statsLocked returns the stats of hostType. p.mu must be held.
+func (p *WarmPool) statsLocked(hostType string) *WarmStats {
+	st, ok := p.stats[hostType]
+	if !ok {
+		st = new(WarmStats)
+		p.stats[hostType] = st
+	}
+	return st
+}
+
+// Run keeps p topped up until ctx is done, and then destroys its idle
+// buildlets.
+func (p *WarmPool) Run(ctx context.Context) {
+	t := time.NewTicker(warmRefillInterval)
+	defer t.Stop()
+	for {
+		p.refill(ctx)
+		select {
+		case <-ctx.Done():
+			p.fills.Wait()
+			p.mu.Lock()
+			idle := p.idle
+			p.idle = make(map[string][]*warmBuildlet)
+			p.mu.Unlock()
+			for _, wbs := range idle {
+				for _, wb := range wbs {
+					wb.bc.Close()
+				}
+			}
+			return
+		case <-t.C:
+		case <-p.kick:
+		}
+	}
+}
+
+// refill destroys idle buildlets that are broken or too old, and starts
+// booting buildlets for every host type below its target.
+func (p *WarmPool) refill(ctx context.Context) {
+	var stale []buildlet.Client
+	p.mu.Lock()
+	for hostType, target := range p.targets {
+		var keep []*warmBuildlet
+		for _, wb := range p.idle[hostType] {
+			if p.usable(wb) {
+				keep = append(keep, wb)
+			} else {
+				stale = append(stale, wb.bc)
+			}
+		}
+		p.idle[hostType] = keep
+		for n := len(keep) + p.filling[hostType]; n < target && ctx.Err() == nil; n++ {
+			p.filling[hostType]++
+			p.fills.Add(1)
+			go p.fill(ctx, hostType)
+		}
+	}
+	p.mu.Unlock()
+
+	for _, bc := range stale {
+		bc.Close()
+	}
+}
+
+// fill boots an idle buildlet of hostType.
+func (p *WarmPool) fill(ctx context.Context, hostType string) {
+	defer p.fills.Done()
+	ctx, cancel := context.WithTimeout(ctx, warmFillTimeout)
+	defer cancel()
+	// A SchedItem with no times ranks after all other post-submit
+	// work, so warm buildlets only use quota nothing else is waiting
+	// for.
+	bc, err := p.create(ctx, hostType, warmLogger{hostType}, &queue.SchedItem{HostType: hostType})
+	if err != nil {
+		log.Printf("warm pool: booting %s buildlet: %v", hostType, err)
+	}
+	p.mu.Lock()
+	p.filling[hostType]--
+	if err == nil {
+		p.idle[hostType] = append(p.idle[hostType], &warmBuildlet{bc: bc, ready: p.now()})
+	}
+	p.mu.Unlock()
+}
+
+// Stats returns the stats of each host type that has been started or
+// has a target.
+func (p *WarmPool) Stats() map[string]WarmStats {
+	if p == nil {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	stats := make(map[string]WarmStats, len(p.stats))
+	for hostType, st := range p.stats {
+		s := *st
+		s.Idle = len(p.idle[hostType])
+		s.Filling = p.filling[hostType]
+		stats[hostType] = s
+	}
+	return stats
+}
+
+// WriteHTMLStatus writes the status of the warm pool to an io.Writer.
+func (p *WarmPool) WriteHTMLStatus(w io.Writer) {
+	stats := p.Stats()
+	if len(stats) == 0 {
+		return
+	}
+	hostTypes := make([]string, 0, len(stats))
+	for hostType := range stats {
+		hostTypes = append(hostTypes, hostType)
+	}
+	sort.Strings(hostTypes)
+	fmt.Fprintf(w, "<b>Warm pool</b>, idle/target (booting), warm/cold starts:<ul>")
+	for _, hostType := range hostTypes {
+		st := stats[hostType]
+		fmt.Fprintf(w, "<li>%s: %d/%d (%d), %d/%d</li>\n", html.EscapeString(hostType), st.Idle, st.Target, st.Filling, st.Warm, st.Cold)
+	}
+	fmt.Fprintf(w, "</ul>")
+}
+
+// warmLogger is the Logger of buildlets booted for a warm pool, which
+// aren't part of any build yet.
+type warmLogger struct {
+	hostType string
+}
+
+func (l warmLogger) LogEventTime(event string, optText ...string) {
+	log.Printf("warm pool: %s: %s %s", l.hostType, event, strings.Join(optText, " "))
+}
+
+func (l warmLogger) CreateSpan(event string, optText ...string) spanlog.Span {
+	return warmSpan{}
+}
+
+type warmSpan struct{}
+
+func (warmSpan) Done(err error) error { return nil }
@@ -0,0 +1,147 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build linux || darwin
+// +build linux darwin
+
+package pool
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.org/x/build/buildlet"
+	"golang.org/x/build/internal/coordinator/pool/queue"
+)
+
+// warmTestClient is a buildlet client that tracks whether it's closed.
+type warmTestClient struct {
+	buildlet.Client
+	name string
+
+	mu             sync.Mutex
+	broken, closed bool
+}
+
+func (c *warmTestClient) IsBroken() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.broken
+}
+
+func (c *warmTestClient) MarkBroken() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.broken = true
+}
+
+func (c *warmTestClient) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	return nil
+}
+
+func (c *warmTestClient) isClosed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closed
+}
+
+func TestWarmPool(t *testing.T) {
+	var mu sync.Mutex
+	var created []*warmTestClient
+	create := func(ctx context.Context, hostType string, lg Logger, si *queue.SchedItem) (buildlet.Client, error) {
+		if si.HostType != hostType {
+			t.Errorf("create(%q) with SchedItem for %q", hostType, si.HostType)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		c := &warmTestClient{Client: &buildlet.FakeClient{}, name: fmt.Sprintf("%s-%d", hostType, len(created))}
+		created = append(created, c)
+		return c, nil
+	}
+	now := time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+	p := NewWarmPool(create, map[string]int{"host-linux-amd64-bullseye": 2}, 30*time.Minute)
+	p.now = func() time.Time { return now }
+	ctx := context.Background()
+	refill := func() {
+		p.refill(ctx)
+		p.fills.Wait()
+	}
+
+	if bc := p.Take("host-linux-amd64-bullseye"); bc != nil {
+		t.Errorf("Take from an empty pool = %v; want nil", bc)
+	}
+	refill()
+	refill() // no-op, the pool is full
+	if len(created) != 2 {
+		t.Fatalf("after filling, created %d buildlets; want 2", len(created))
+	}
+
+	// Buildlets are taken oldest first, and skipped if broken.
+	created[0].MarkBroken()
+	bc := p.Take("host-linux-amd64-bullseye")
+	if bc != created[1] {
+		t.Errorf("Take = %v; want %v", bc, created[1].name)
+	}
+	if !created[0].isClosed() {
+		t.Errorf("broken idle buildlet wasn't closed")
+	}
+	if bc := p.Take("host-linux-amd64-buster"); bc != nil {
+		t.Errorf("Take of a host type with no target = %v; want nil", bc)
+	}
+
+	// Idle buildlets expire.
+	refill()
+	now = now.Add(time.Hour)
+	refill()
+	if len(created) != 6 {
+		t.Fatalf("after expiry, created %d buildlets; want 6", len(created))
+	}
+	for _, c := range created[2:4] {
+		if !c.isClosed() {
+			t.Errorf("expired buildlet %s wasn't closed", c.name)
+		}
+	}
+
+	want := map[string]WarmStats{
+		"host-linux-amd64-bullseye": {Target: 2, Idle: 2, Warm: 1, Cold: 1},
+		"host-linux-amd64-buster":   {Cold: 1},
+	}
+	if diff := cmp.Diff(want, p.Stats()); diff != "" {
+		t.Errorf("Stats mismatch (-want +got):\n%s", diff)
+	}
+
+	var nilPool *WarmPool
+	if bc := nilPool.Take("host-linux-amd64-bullseye"); bc != nil || nilPool.Stats() != nil {
+		t.Errorf("nil WarmPool isn't empty")
+	}
+}
+
+func TestParseWarmTargets(t *testing.T) {
+	got, err := ParseWarmTargets("host-linux-amd64-bullseye=4, host-linux-amd64-buster=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]int{"host-linux-amd64-bullseye": 4, "host-linux-amd64-buster": 1}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("ParseWarmTargets mismatch (-want +got):\n%s", diff)
+	}
+	for _, bad := range []string{
+		"host-linux-amd64-bullseye",
+		"host-linux-amd64-bullseye=-1",
+		"host-nonexistent=1",
+		"host-darwin-arm64-12=1",     // reverse
+		"host-darwin-amd64-13-aws=1", // EC2
+	} {
+		if _, err := ParseWarmTargets(bad); err == nil {
+			t.Errorf("ParseWarmTargets(%q) succeeded; want error", bad)
+		}
+	}
+}
@@ -0,0 +1,338 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build linux || darwin
+// +build linux darwin
+
+package pool
+
+/*
+This file implements WireGuard mesh buildlets, an alternative to the
+revdial scheme in reverse.go. Instead of holding open a TLS connection
+to the coordinator, a reverse buildlet started with -wireguard-iface
+generates a WireGuard key pair and POSTs its public key to
+/wireguard/register. The coordinator adds the buildlet as a peer on
+its own WireGuard interface, assigns it a stable address in the mesh
+network, and replies with a types.WireGuardConfig. The buildlet
+configures its end of the tunnel and serves the ordinary buildlet
+HTTP protocol on port 80 of its mesh address, which the coordinator
+then dials directly.
+
+Because the buildlet initiates the WireGuard handshake and keeps it
+alive, this works behind NAT, and the builder's firewall only needs
+to permit outbound UDP to the coordinator's endpoint.
+
+The coordinator's interface must already exist and be listening, e.g.:
+
+	$ ip link add dev wg0 type wireguard
+	$ wg set wg0 listen-port 51820 private-key /path/to/key
+	$ ip address add 10.200.0.1/16 dev wg0
+	$ ip link set up dev wg0
+	$ coordinator -wireguard-iface=wg0 -wireguard-endpoint=farmer.golang.org:51820 -wireguard-network=10.200.0.0/16
+*/
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/build/buildlet"
+	"golang.org/x/build/types"
+)
+
+// wireGuardConnectTimeout is how long the coordinator waits for a
+// newly registered buildlet to answer on its mesh address.
+const wireGuardConnectTimeout = 2 * time.Minute
+
+// WireGuardMesh manages the coordinator's side of a WireGuard mesh
+// of reverse buildlets.
+type WireGuardMesh struct {
+	iface     string
+	endpoint  string
+	network   netip.Prefix
+	coordAddr netip.Addr
+	publicKey string
+
+	// wg runs the wg(8) tool with args. It is replaced in tests.
+	wg func(ctx context.Context, args ...string) ([]byte, error)
+	// connect dials the buildlet registered as p and adds it to
+	// the reverse buildlet pool. It is replaced in tests.
+	connect func(p *wireGuardPeer)
+
+	mu    sync.Mutex
+	peers map[string]*wireGuardPeer // keyed by hostname
+	used  map[netip.Addr]string     // mesh address to hostname
+}
+
+// wireGuardPeer is a buildlet registered with a WireGuardMesh.
+// Its fields are guarded by the WireGuardMesh mutex.
+type wireGuardPeer struct {
+	hostname  string
+	hostType  string
+	version   string
+	publicKey string
+	addr      netip.Addr
+
+	// selfTest and selfTestErr are from the latest registration;
+	// see the reverseBuildlet fields of the same names.
+	selfTest    *types.BuildletSelfTest
+	selfTestErr error
+
+	// client is the buildlet client added to the reverse pool for
+	// this peer, or nil if there is none yet or it has failed.
+	client buildlet.Client
+}
+
+// NewWireGuardMesh returns a WireGuardMesh that adds buildlets as
+// peers of the existing WireGuard interface iface. endpoint is the
+// host:port buildlets use to reach the interface, and network is the
+// mesh network in CIDR notation. The first host address in network
+// is the coordinator's own address.
+func NewWireGuardMesh(iface, endpoint, network string) (*WireGuardMesh, error) {
+	prefix, err := netip.ParsePrefix(network)
+	if err != nil {
+		return nil, fmt.Errorf("invalid WireGuard network: %v", err)
+	}
+	if !prefix.Addr().Is4() || prefix.Bits() > 30 {
+		return nil, fmt.Errorf("WireGuard network %v must be an IPv4 network of at least 4 addresses", prefix)
+	}
+	m := newWireGuardMesh(iface, endpoint, prefix.Masked())
+	out, err := m.wg(context.Background(), "show", iface, "public-key")
+	if err != nil {
+		return nil, fmt.Errorf("reading public key of WireGuard interface %q: %v", iface, err)
+	}
+	m.publicKey = strings.TrimSpace(string(out))
+	return m, nil
+}
+
+func newWireGuardMesh(iface, endpoint string, network netip.Prefix) *WireGuardMesh {
+	m := &WireGuardMesh{
+		iface:     iface,
+		endpoint:  endpoint,
+		network:   network,
+		coordAddr: network.Addr().Next(),
+		wg:        runWG,
+		peers:     make(map[string]*wireGuardPeer),
+		used:      make(map[netip.Addr]string),
+	}
+	m.connect = m.connectBuildlet
+	return m
+}
+
+func runWG(ctx context.Context, args ...string) ([]byte, error) {
+	out, err := exec.CommandContext(ctx, "wg", args...).CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("wg %s: %v: %s", strings.Join(args, " "), err, out)
+	}
+	return out, nil
+}
+
+// HandleRegister handles WireGuard registrations from reverse
+// buildlets. Like HandleReverse, it authenticates them with the
+// builder key for their host type.
+func (m *WireGuardMesh) HandleRegister(w http.ResponseWriter, r *http.Request) {
+	if r.TLS == nil {
+		http.Error(w, "buildlet registration requires SSL", http.StatusInternalServerError)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var (
+		hostType        = r.Header.Get("X-Go-Host-Type")
+		buildKey        = r.Header.Get("X-Go-Builder-Key")
+		buildletVersion = r.Header.Get("X-Go-Builder-Version")
+		hostname        = r.Header.Get("X-Go-Builder-Hostname")
+	)
+	if hostname == "" {
+		http.Error(w, "missing X-Go-Builder-Hostname header", http.StatusBadRequest)
+		return
+	}
+	if hostType == "" {
+		http.Error(w, "missing X-Go-Host-Type; old buildlet binary?", http.StatusBadRequest)
+		return
+	}
+	if buildKey != builderKey(hostType) {
+		http.Error(w, "invalid build key", http.StatusPreconditionFailed)
+		return
+	}
+	var reg types.WireGuardRegistration
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<10)).Decode(&reg); err != nil {
+		http.Error(w, "invalid registration: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if key, err := base64.StdEncoding.DecodeString(reg.PublicKey); err != nil || len(key) != 32 {
+		http.Error(w, "invalid WireGuard public key", http.StatusBadRequest)
+		return
+	}
+
+	selfTest, selfTestErr := parseSelfTest(r.Header, time.Now())
+
+	p, connect, err := m.register(r.Context(), hostname, hostType, buildletVersion, reg.PublicKey, selfTest, selfTestErr)
+	if err != nil {
+		log.Printf("WireGuard registration of %q (%s) failed: %v", hostname, hostType, err)
+		http.Error(w, "registration failed", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Registered WireGuard buildlet %q (%s) at %v for host type %v; buildletVersion=%v",
+		hostname, r.RemoteAddr, p.addr, hostType, buildletVersion)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(&types.WireGuardConfig{
+		Address:              p.addr.String(),
+		Network:              m.network.String(),
+		CoordinatorPublicKey: m.publicKey,
+		Endpoint:             m.endpoint,
+		CoordinatorAddress:   m.coordAddr.String(),
+	})
+	if connect {
+		go m.connect(p)
+	}
+}
+
+// register adds or updates the peer for hostname and reports whether
+// the coordinator needs to connect to it. Buildlets re-register
+// periodically, so registering an unchanged peer that is already in
+// the pool is cheap.
+func (m *WireGuardMesh) register(ctx context.Context, hostname, hostType, version, publicKey string, selfTest *types.BuildletSelfTest, selfTestErr error) (_ *wireGuardPeer, connect bool, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	p := m.peers[hostname]
+	if p != nil && p.publicKey != publicKey {
+		// The buildlet restarted with a new key. Drop the old peer
+		// so its key can no longer use the address.
+		if _, err := m.wg(ctx, "set", m.iface, "peer", p.publicKey, "remove"); err != nil {
+			return nil, false, err
+		}
+		if p.client != nil {
+			go p.client.Close()
+			p.client = nil
+		}
+	}
+	if p == nil {
+		addr, err := m.allocateLocked(hostname)
+		if err != nil {
+			return nil, false, err
+		}
+		p = &wireGuardPeer{hostname: hostname, addr: addr}
+		m.peers[hostname] = p
+		m.used[addr] = hostname
+	}
+	p.hostType, p.version, p.publicKey = hostType, version, publicKey
+	p.selfTest, p.selfTestErr = selfTest, selfTestErr
+	if _, err := m.wg(ctx, "set", m.iface, "peer", publicKey, "allowed-ips", netip.PrefixFrom(p.addr, 32).String()); err != nil {
+		return nil, false, err
+	}
+	if p.client != nil && p.client.IsBroken() {
+		p.client = nil
+	}
+	return p, p.client == nil, nil
+}
+
+// allocateLocked returns an unused address for hostname. The address
+// is derived from a hash of hostname so that a buildlet usually gets
+// the same address across coordinator restarts, which keeps firewall
+// rules and logs easy to follow.
+func (m *WireGuardMesh) allocateLocked(hostname string) (netip.Addr, error) {
+	base := m.network.Addr().As4()
+	start := binary.BigEndian.Uint32(base[:])
+	// Exclude the network address, the coordinator's address and
+	// the broadcast address.
+	size := uint32(1)<<(32-m.network.Bits()) - 3
+	h := fnv.New32a()
+	h.Write([]byte(hostname))
+	off := h.Sum32() % size
+	for i := uint32(0); i < size; i++ {
+		var b [4]byte
+		binary.BigEndian.PutUint32(b[:], start+2+(off+i)%size)
+		addr := netip.AddrFrom4(b)
+		if _, ok := m.used[addr]; !ok {
+			return addr, nil
+		}
+	}
+	return netip.Addr{}, fmt.Errorf("no free addresses in WireGuard network %v", m.network)
+}
+
+// connectBuildlet waits for the buildlet registered as p to answer
+// on its mesh address and then adds it to the reverse buildlet pool.
+func (m *WireGuardMesh) connectBuildlet(p *wireGuardPeer) {
+	m.mu.Lock()
+	hostname, hostType, version, addr := p.hostname, p.hostType, p.version, p.addr
+	selfTest, selfTestErr := p.selfTest, p.selfTestErr
+	m.mu.Unlock()
+
+	ipPort := net.JoinHostPort(addr.String(), "80")
+	client := buildlet.NewClient(ipPort, buildlet.NoKeyPair)
+	client.SetDescription(fmt.Sprintf("WireGuard peer %s/%s for host type %v", hostname, addr, hostType))
+
+	ctx, cancel := context.WithTimeout(context.Background(), wireGuardConnectTimeout)
+	defer cancel()
+	tstatus := time.Now()
+	var status buildlet.Status
+	for {
+		var err error
+		status, err = client.Status(ctx)
+		if err == nil {
+			break
+		}
+		if ctx.Err() != nil {
+			log.Printf("WireGuard buildlet %s/%s for %s did not answer status after %v: %v",
+				hostname, addr, hostType, time.Since(tstatus).Round(time.Second), err)
+			return
+		}
+		time.Sleep(5 * time.Second)
+	}
+	if status.Version < minBuildletVersion {
+		log.Printf("Buildlet too old (need version %d or newer): %s/%s, %+v", minBuildletVersion, hostname, addr, status)
+		return
+	}
+	log.Printf("Buildlet %s/%s: %+v for %s", hostname, addr, status, hostType)
+	if selfTestErr != nil {
+		log.Printf("Buildlet %s/%s for %s failed its self-test; not scheduling work on it: %v", hostname, addr, hostType, selfTestErr)
+	}
+
+	m.mu.Lock()
+	if m.peers[hostname] != p || p.client != nil || p.addr != addr {
+		// Replaced or connected by a concurrent registration.
+		m.mu.Unlock()
+		return
+	}
+	p.client = client
+	m.mu.Unlock()
+
+	client.SetOnHeartbeatFailure(func() {
+		reversePool.nukeBuildlet(client)
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		if p.client == client {
+			p.client = nil
+		}
+	})
+	now := time.Now()
+	reversePool.addBuildlet(&reverseBuildlet{
+		hostname:    hostname,
+		version:     version,
+		hostType:    hostType,
+		client:      client,
+		remoteAddr:  addr.String(),
+		inUseTime:   now,
+		regTime:     now,
+		selfTest:    selfTest,
+		selfTestErr: selfTestErr,
+	})
+}
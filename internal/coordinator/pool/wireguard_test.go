@@ -0,0 +1,135 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build linux || darwin
+// +build linux darwin
+
+package pool
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+
+	"golang.org/x/build/types"
+)
+
+func testWireGuardMesh(t *testing.T) (*WireGuardMesh, *[]string) {
+	t.Helper()
+	oldKey := builderMasterKey
+	builderMasterKey = []byte("test master key")
+	t.Cleanup(func() { builderMasterKey = oldKey })
+
+	m := newWireGuardMesh("wg0", "coordinator.example:51820", netip.MustParsePrefix("10.200.0.0/29"))
+	m.publicKey = "coordinator-key"
+	var cmds []string
+	m.wg = func(ctx context.Context, args ...string) ([]byte, error) {
+		cmds = append(cmds, strings.Join(args, " "))
+		return nil, nil
+	}
+	m.connect = func(p *wireGuardPeer) {}
+	return m, &cmds
+}
+
+func wireGuardRegister(m *WireGuardMesh, hostname, key, publicKey string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(types.WireGuardRegistration{PublicKey: publicKey})
+	req := httptest.NewRequest(http.MethodPost, "/wireguard/register", strings.NewReader(string(body)))
+	req.TLS = &tls.ConnectionState{}
+	req.Header.Set("X-Go-Host-Type", "host-linux-amd64-test")
+	req.Header.Set("X-Go-Builder-Key", key)
+	req.Header.Set("X-Go-Builder-Hostname", hostname)
+	req.Header.Set("X-Go-Builder-Version", "32")
+	rec := httptest.NewRecorder()
+	m.HandleRegister(rec, req)
+	return rec
+}
+
+func TestWireGuardRegister(t *testing.T) {
+	m, cmds := testWireGuardMesh(t)
+	key := builderKey("host-linux-amd64-test")
+	pub1 := base64.StdEncoding.EncodeToString(make([]byte, 32))
+	pub2 := base64.StdEncoding.EncodeToString([]byte(strings.Repeat("k", 32)))
+
+	rec := wireGuardRegister(m, "builder-1", key, pub1)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("register: got status %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+	var cfg types.WireGuardConfig
+	if err := json.NewDecoder(rec.Body).Decode(&cfg); err != nil {
+		t.Fatalf("decoding config: %v", err)
+	}
+	addr, err := netip.ParseAddr(cfg.Address)
+	if err != nil {
+		t.Fatalf("invalid address %q: %v", cfg.Address, err)
+	}
+	if !m.network.Contains(addr) || addr == m.coordAddr || addr == m.network.Addr() || addr.String() == "10.200.0.7" {
+		t.Errorf("address = %v, want a host address in %v other than the coordinator's", addr, m.network)
+	}
+	want := types.WireGuardConfig{
+		Address:              cfg.Address,
+		Network:              "10.200.0.0/29",
+		CoordinatorPublicKey: "coordinator-key",
+		Endpoint:             "coordinator.example:51820",
+		CoordinatorAddress:   "10.200.0.1",
+	}
+	if cfg != want {
+		t.Errorf("config = %+v, want %+v", cfg, want)
+	}
+
+	// Registering again with a new key keeps the address and
+	// replaces the old peer.
+	*cmds = nil
+	rec = wireGuardRegister(m, "builder-1", key, pub2)
+	var cfg2 types.WireGuardConfig
+	if err := json.NewDecoder(rec.Body).Decode(&cfg2); err != nil {
+		t.Fatalf("decoding config: %v", err)
+	}
+	if cfg2.Address != cfg.Address {
+		t.Errorf("re-registered address = %v, want %v", cfg2.Address, cfg.Address)
+	}
+	wantCmds := []string{
+		"set wg0 peer " + pub1 + " remove",
+		"set wg0 peer " + pub2 + " allowed-ips " + cfg.Address + "/32",
+	}
+	if strings.Join(*cmds, "\n") != strings.Join(wantCmds, "\n") {
+		t.Errorf("wg commands = %q, want %q", *cmds, wantCmds)
+	}
+
+	// The /29 has 5 addresses for buildlets; all must be distinct.
+	seen := map[string]bool{cfg.Address: true}
+	for _, h := range []string{"builder-2", "builder-3", "builder-4", "builder-5"} {
+		rec := wireGuardRegister(m, h, key, pub1)
+		var c types.WireGuardConfig
+		if err := json.NewDecoder(rec.Body).Decode(&c); err != nil {
+			t.Fatalf("decoding config for %s: %v", h, err)
+		}
+		if seen[c.Address] {
+			t.Errorf("%s got duplicate address %v", h, c.Address)
+		}
+		seen[c.Address] = true
+	}
+	if rec := wireGuardRegister(m, "builder-6", key, pub1); rec.Code != http.StatusInternalServerError {
+		t.Errorf("register with full network: got status %d, want %d", rec.Code, http.StatusInternalServerError)
+	}
+}
+
+func TestWireGuardRegisterRejects(t *testing.T) {
+	m, cmds := testWireGuardMesh(t)
+	pub := base64.StdEncoding.EncodeToString(make([]byte, 32))
+	if rec := wireGuardRegister(m, "builder-1", "bogus", pub); rec.Code != http.StatusPreconditionFailed {
+		t.Errorf("register with bad builder key: got status %d, want %d", rec.Code, http.StatusPreconditionFailed)
+	}
+	if rec := wireGuardRegister(m, "builder-1", builderKey("host-linux-amd64-test"), "short"); rec.Code != http.StatusBadRequest {
+		t.Errorf("register with bad public key: got status %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+	if len(*cmds) != 0 {
+		t.Errorf("rejected registrations ran wg commands: %q", *cmds)
+	}
+}
@@ -29,6 +29,7 @@ type Session struct {
 	HostType    string
 	ID          string // unique identifier for instance "user-bradfitz-linux-amd64-0"
 	OwnerID     string // identity aware proxy user id: "accounts.google.com:userIDvalue"
+	Username    string // displayed user name of the owner: "bradfitz"
 	buildlet    buildlet.Client
 }
 
@@ -90,6 +91,7 @@ func (sp *SessionPool) AddSession(ownerID, username, builderType, hostType strin
 				HostType:    hostType,
 				ID:          name,
 				OwnerID:     ownerID,
+				Username:    username,
 			}
 			return name
 		}
@@ -168,6 +170,7 @@ func (sp *SessionPool) List() []*Session {
 			HostType:    s.HostType,
 			ID:          s.ID,
 			OwnerID:     s.OwnerID,
+			Username:    s.Username,
 			Created:     s.Created,
 		})
 	}
@@ -196,6 +199,7 @@ func (sp *SessionPool) Session(buildletName string) (*Session, error) {
 			HostType:    s.HostType,
 			ID:          s.ID,
 			OwnerID:     s.OwnerID,
+			Username:    s.Username,
 		}, nil
 	}
 	return nil, fmt.Errorf("remote buildlet does not exist=%s", buildletName)
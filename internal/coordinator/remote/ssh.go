@@ -99,6 +99,7 @@ type SSHServer struct {
 	privateHostKeyFile string
 	server             *gssh.Server
 	sessionPool        *SessionPool
+	transcripts        *TranscriptStore // if non-nil, sessions are recorded
 }
 
 // NewSSHServer creates an SSH server used to access remote buildlet sessions.
@@ -132,6 +133,13 @@ func NewSSHServer(addr string, hostPrivateKey, gomotePublicKey, caPrivateKey []b
 	return s, nil
 }
 
+// SetTranscriptStore makes the server record sessions in ts, only
+// letting in the clients that consent to it by setting
+// TranscriptConsentEnv. It must be called before the server starts.
+func (ss *SSHServer) SetTranscriptStore(ts *TranscriptStore) {
+	ss.transcripts = ts
+}
+
 // ListenAndServe attempts to start the SSH server. This blocks until the server stops.
 func (ss *SSHServer) ListenAndServe() error {
 	return ss.server.ListenAndServe()
@@ -173,6 +181,33 @@ func (ss *SSHServer) HandleIncomingSSHPostAuth(s gssh.Session) {
 		return
 	}
 
+	var rec *transcriptRecorder
+	if ss.transcripts != nil {
+		if !recordingAccepted(s.Environ()) {
+			fmt.Fprint(s, "# Sessions on this gomote SSH server are recorded, and their\n")
+			fmt.Fprintf(s, "# transcripts kept, encrypted, for %v for incident investigations.\n", ss.transcripts.Retention())
+			fmt.Fprintf(s, "# To consent to that, connect with `gomote ssh -accept-recording %s`.\n", inst)
+			return
+		}
+		rec = ss.transcripts.start(inst, rs.OwnerID, ptyReq.Window)
+		flushCtx, stopFlushing := context.WithCancel(s.Context())
+		go ss.transcripts.flushLoop(flushCtx, rec)
+		defer func() {
+			stopFlushing()
+			t, err := ss.transcripts.finish(rec)
+			if err != nil {
+				log.Printf("ssh: saving transcript %s of session=%s: %v", t.ID, inst, err)
+				return
+			}
+			log.Printf("ssh: saved transcript %s of session=%s", t.ID, inst)
+		}()
+	}
+	// out is the session's output, which rec records, if recording.
+	var out io.Writer = s
+	if rec != nil {
+		out = io.MultiWriter(s, rec)
+	}
+
 	ctx, cancel := context.WithCancel(s.Context())
 	defer cancel()
 	if err := ss.sessionPool.KeepAlive(ctx, inst); err != nil {
@@ -182,31 +217,34 @@ func (ss *SSHServer) HandleIncomingSSHPostAuth(s gssh.Session) {
 	sshUser := hostConf.SSHUsername
 	useLocalSSHProxy := bconf.GOOS() != "plan9"
 	if sshUser == "" && useLocalSSHProxy {
-		fmt.Fprintf(s, "instance %q host type %q does not have SSH configured\n", inst, rs.HostType)
+		fmt.Fprintf(out, "instance %q host type %q does not have SSH configured\n", inst, rs.HostType)
 		return
 	}
 	if !hostConf.IsHermetic() {
-		fmt.Fprintf(s, "WARNING: instance %q host type %q is not currently\n", inst, rs.HostType)
-		fmt.Fprintf(s, "configured to have a hermetic filesystem per boot.\n")
-		fmt.Fprintf(s, "You must be careful not to modify machine state\n")
-		fmt.Fprintf(s, "that will affect future builds.\n")
+		fmt.Fprintf(out, "WARNING: instance %q host type %q is not currently\n", inst, rs.HostType)
+		fmt.Fprintf(out, "configured to have a hermetic filesystem per boot.\n")
+		fmt.Fprintf(out, "You must be careful not to modify machine state\n")
+		fmt.Fprintf(out, "that will affect future builds.\n")
 	}
 	log.Printf("connecting to ssh to instance %q ...", inst)
-	fmt.Fprint(s, "# Welcome to the gomote ssh proxy.\n")
-	fmt.Fprint(s, "# Connecting to/starting remote ssh...\n")
-	fmt.Fprint(s, "#\n")
+	fmt.Fprint(out, "# Welcome to the gomote ssh proxy.\n")
+	if rec != nil {
+		fmt.Fprint(out, "# This session is being recorded.\n")
+	}
+	fmt.Fprint(out, "# Connecting to/starting remote ssh...\n")
+	fmt.Fprint(out, "#\n")
 
 	var localProxyPort int
 	bc, err := ss.sessionPool.BuildletClient(inst)
 	if err != nil {
-		fmt.Fprintf(s, "failed to connect to ssh on %s: %v\n", inst, err)
+		fmt.Fprintf(out, "failed to connect to ssh on %s: %v\n", inst, err)
 		return
 	}
 	if useLocalSSHProxy {
-		sshConn, err := bc.ConnectSSH(sshUser, ss.gomotePublicKey)
+		sshConn, err := bc.ConnectSSH(ctx, sshUser, ss.gomotePublicKey)
 		log.Printf("buildlet(%q).ConnectSSH = %T, %v", inst, sshConn, err)
 		if err != nil {
-			fmt.Fprintf(s, "failed to connect to ssh on %s: %v\n", inst, err)
+			fmt.Fprintf(out, "failed to connect to ssh on %s: %v\n", inst, err)
 			return
 		}
 		defer sshConn.Close()
@@ -215,7 +253,7 @@ func (ss *SSHServer) HandleIncomingSSHPostAuth(s gssh.Session) {
 		// The openssh ssh command line tool will connect to this IP.
 		ln, err := net.Listen("tcp", "localhost:0")
 		if err != nil {
-			fmt.Fprintf(s, "local listen error: %v\n", err)
+			fmt.Fprintf(out, "local listen error: %v\n", err)
 			return
 		}
 		localProxyPort = ln.Addr().(*net.TCPAddr).Port
@@ -247,17 +285,17 @@ func (ss *SSHServer) HandleIncomingSSHPostAuth(s gssh.Session) {
 	}
 	workDir, err := bc.WorkDir(ctx)
 	if err != nil {
-		fmt.Fprintf(s, "Error getting WorkDir: %v\n", err)
+		fmt.Fprintf(out, "Error getting WorkDir: %v\n", err)
 		return
 	}
 	ip, _, ipErr := net.SplitHostPort(bc.IPPort())
 
-	fmt.Fprint(s, "# `gomote push` and the builders use:\n")
-	fmt.Fprintf(s, "# - workdir: %s\n", workDir)
-	fmt.Fprintf(s, "# - GOROOT: %s/go\n", workDir)
-	fmt.Fprintf(s, "# - GOPATH: %s/gopath\n", workDir)
-	fmt.Fprintf(s, "# - env: %s\n", strings.Join(bconf.Env(), " ")) // TODO: shell quote?
-	fmt.Fprint(s, "# Happy debugging.\n")
+	fmt.Fprint(out, "# `gomote push` and the builders use:\n")
+	fmt.Fprintf(out, "# - workdir: %s\n", workDir)
+	fmt.Fprintf(out, "# - GOROOT: %s/go\n", workDir)
+	fmt.Fprintf(out, "# - GOPATH: %s/gopath\n", workDir)
+	fmt.Fprintf(out, "# - env: %s\n", strings.Join(bconf.Env(), " ")) // TODO: shell quote?
+	fmt.Fprint(out, "# Happy debugging.\n")
 
 	log.Printf("ssh to %s: starting ssh -p %d for %s@localhost", inst, localProxyPort, sshUser)
 	var cmd *exec.Cmd
@@ -270,9 +308,9 @@ func (ss *SSHServer) HandleIncomingSSHPostAuth(s gssh.Session) {
 			"-i", ss.privateHostKeyFile,
 			sshUser+"@localhost")
 	case "plan9":
-		fmt.Fprintf(s, "# Plan9 user/pass: glenda/glenda123\n")
+		fmt.Fprintf(out, "# Plan9 user/pass: glenda/glenda123\n")
 		if ipErr != nil {
-			fmt.Fprintf(s, "# Failed to get IP out of %q: %v\n", bc.IPPort(), ipErr)
+			fmt.Fprintf(out, "# Failed to get IP out of %q: %v\n", bc.IPPort(), ipErr)
 			return
 		}
 		cmd = exec.Command("/usr/local/bin/drawterm",
@@ -288,13 +326,16 @@ func (ss *SSHServer) HandleIncomingSSHPostAuth(s gssh.Session) {
 	go func() {
 		for win := range winCh {
 			setWinsize(f, win.Width, win.Height)
+			if rec != nil {
+				rec.resize(win.Width, win.Height)
+			}
 		}
 	}()
 	go func() {
 		ss.setupRemoteSSHEnv(bconf, workDir, f)
 		io.Copy(f, s) // stdin
 	}()
-	io.Copy(s, f) // stdout
+	io.Copy(out, f) // stdout
 	cmd.Process.Kill()
 	cmd.Wait()
 }
@@ -327,6 +368,17 @@ func (ss *SSHServer) setupRemoteSSHEnv(bconf *dashboard.BuildConfig, workDir str
 	}
 }
 
+// recordingAccepted reports whether env, the environment an SSH client
+// set, consents to the session being recorded.
+func recordingAccepted(env []string) bool {
+	for _, kv := range env {
+		if k, v, _ := strings.Cut(kv, "="); k == TranscriptConsentEnv {
+			return v == "accept"
+		}
+	}
+	return false
+}
+
 // WriteSSHPrivateKeyToTempFile writes a key to a temporary file on the local file system. It also
 // sets the permissions on the file to what is expected by OpenSSH implementations of SSH.
 func WriteSSHPrivateKeyToTempFile(key []byte) (path string, err error) {
@@ -0,0 +1,513 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.16 && (linux || darwin)
+// +build go1.16
+// +build linux darwin
+
+package remote
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	gssh "github.com/gliderlabs/ssh"
+	"golang.org/x/build/internal/access"
+	"golang.org/x/build/internal/gcsfs"
+)
+
+// TranscriptConsentEnv is the environment variable that SSH clients
+// set to "accept" to consent to their session being recorded, on
+// servers that record sessions. gomote ssh -accept-recording sets it.
+const TranscriptConsentEnv = "GOMOTE_SSH_RECORDING"
+
+// maxTranscriptSize is how much output a transcript records, after
+// which the rest of the session goes unrecorded.
+const maxTranscriptSize = 64 << 20
+
+// transcriptExt is the extension of the encrypted transcript files.
+const transcriptExt = ".enc"
+
+// transcriptFlushInterval is how often the transcript of a session in
+// progress is saved, so that a restart of the coordinator only loses
+// the end of it.
+const transcriptFlushInterval = time.Minute
+
+// A Transcript is the recording of an SSH session. It records what the
+// session displayed, and when, so that it can be replayed; what was
+// typed is only recorded as far as the remote system echoed it, so
+// that passwords typed at prompts that don't echo aren't kept.
+type Transcript struct {
+	ID       string            `json:"id"`
+	Instance string            `json:"instance"`
+	OwnerID  string            `json:"ownerID"`
+	Start    time.Time         `json:"start"`
+	End      time.Time         `json:"end"` // or of the last flush, if the session didn't end cleanly
+	Width    int               `json:"width"`
+	Height   int               `json:"height"`
+	Events   []TranscriptEvent `json:"events"`
+}
+
+// A TranscriptEvent is something that happened in an SSH session.
+type TranscriptEvent struct {
+	Time time.Duration `json:"t"` // since the start of the session
+	// Type is "o" for output, whose bytes are in Data, or "r" for
+	// a resize of the terminal, to the Width and Height.
+	Type   string `json:"type"`
+	Data   []byte `json:"data,omitempty"`
+	Width  int    `json:"width,omitempty"`
+	Height int    `json:"height,omitempty"`
+}
+
+// WriteCast writes t to w in the asciicast v2 format, which asciinema
+// and other terminal session players can replay.
+func (t *Transcript) WriteCast(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	header := map[string]interface{}{
+		"version":   2,
+		"width":     t.Width,
+		"height":    t.Height,
+		"timestamp": t.Start.Unix(),
+		"title":     fmt.Sprintf("gomote ssh %s (%s)", t.Instance, t.OwnerID),
+	}
+	if err := enc.Encode(header); err != nil {
+		return err
+	}
+	// Output events may split a UTF-8 sequence, but asciicast events
+	// hold strings; carry incomplete sequences over to the next one.
+	var carry []byte
+	for _, e := range t.Events {
+		var ev []interface{}
+		switch e.Type {
+		case "o":
+			data := append(carry, e.Data...)
+			carry = nil
+			if i := incompleteSuffix(data); i < len(data) {
+				data, carry = data[:i], append([]byte(nil), data[i:]...)
+			}
+			ev = []interface{}{e.Time.Seconds(), "o", string(data)}
+		case "r":
+			ev = []interface{}{e.Time.Seconds(), "r", fmt.Sprintf("%dx%d", e.Width, e.Height)}
+		default:
+			continue
+		}
+		if err := enc.Encode(ev); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// incompleteSuffix returns the index in b of the start of a trailing
+// incomplete UTF-8 sequence, or len(b) if there isn't one.
+func incompleteSuffix(b []byte) int {
+	for i := len(b) - 1; i >= 0 && i >= len(b)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(b[i]) {
+			if !utf8.FullRune(b[i:]) {
+				return i
+			}
+			break
+		}
+	}
+	return len(b)
+}
+
+// transcriptRecorder records a Transcript as the session goes. It's an
+// io.Writer of the session's output.
+type transcriptRecorder struct {
+	start  time.Time  // with a monotonic reading, unlike t.Start
+	saveMu sync.Mutex // serializes the saves of t, so the last one wins
+	saved  bool       // whether t was saved before; guarded by saveMu
+
+	mu        sync.Mutex
+	t         *Transcript
+	size      int
+	truncated bool
+	flushed   int  // len(t.Events) when it was last saved
+	done      bool // whether finish was called
+}
+
+func (r *transcriptRecorder) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.truncated {
+		return len(p), nil
+	}
+	data := append([]byte(nil), p...)
+	if r.size+len(data) > maxTranscriptSize {
+		data = []byte("\r\n[transcript truncated]\r\n")
+		r.truncated = true
+	}
+	r.size += len(data)
+	r.t.Events = append(r.t.Events, TranscriptEvent{Time: time.Since(r.start), Type: "o", Data: data})
+	return len(p), nil
+}
+
+func (r *transcriptRecorder) resize(w, h int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.t.Events = append(r.t.Events, TranscriptEvent{Time: time.Since(r.start), Type: "r", Width: w, Height: h})
+}
+
+// finish ends the recording and returns the transcript.
+func (r *transcriptRecorder) finish() *Transcript {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.done = true
+	r.t.End = r.t.Start.Add(time.Since(r.start))
+	return r.t
+}
+
+// snapshot returns a copy of the transcript so far, if the recording
+// isn't finished and has recorded something since the last snapshot.
+func (r *transcriptRecorder) snapshot() (*Transcript, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.done || len(r.t.Events) == r.flushed {
+		return nil, false
+	}
+	r.flushed = len(r.t.Events)
+	t := *r.t
+	// Events are only appended, so the copy can share them.
+	t.Events = t.Events[:len(t.Events):len(t.Events)]
+	t.End = t.Start.Add(time.Since(r.start))
+	return &t, true
+}
+
+// A TranscriptStore stores the transcripts of SSH sessions, encrypted,
+// and deletes them once they're older than its retention period.
+type TranscriptStore struct {
+	fsys      fs.FS
+	aead      cipher.AEAD
+	retention time.Duration
+	now       func() time.Time
+}
+
+// NewTranscriptStore returns a TranscriptStore that keeps transcripts
+// in fsys, which must support gcsfs.WriteFile and gcsfs.Remove, for the
+// retention period. They're encrypted with AES-256-GCM, using key,
+// which must be 32 bytes long.
+func NewTranscriptStore(fsys fs.FS, key []byte, retention time.Duration) (*TranscriptStore, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("transcript key is %d bytes long; want 32", len(key))
+	}
+	if retention <= 0 {
+		return nil, fmt.Errorf("invalid transcript retention %v", retention)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &TranscriptStore{fsys: fsys, aead: aead, retention: retention, now: time.Now}, nil
+}
+
+// Retention returns how long ts keeps transcripts.
+func (ts *TranscriptStore) Retention() time.Duration { return ts.retention }
+
+// transcriptTimeFormat is the format of the time that transcript IDs
+// start with, which sorts chronologically.
+const transcriptTimeFormat = "20060102T150405Z"
+
+// start starts recording a session on inst, owned by ownerID. The ID
+// of the transcript ends in a random suffix, so that sessions that
+// start on the same instance in the same second don't overwrite each
+// other's transcript.
+func (ts *TranscriptStore) start(inst, ownerID string, win gssh.Window) *transcriptRecorder {
+	start := ts.now()
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		panic(err)
+	}
+	id := start.UTC().Format(transcriptTimeFormat) + "-" + strings.Map(func(r rune) rune {
+		if r == '/' || r == '.' || r == '\\' {
+			return '_'
+		}
+		return r
+	}, inst) + "-" + hex.EncodeToString(suffix)
+	return &transcriptRecorder{
+		start: time.Now(),
+		t: &Transcript{
+			ID:       id,
+			Instance: inst,
+			OwnerID:  ownerID,
+			Start:    start.UTC(),
+			Width:    win.Width,
+			Height:   win.Height,
+		},
+	}
+}
+
+// flushLoop saves the transcript that r records every
+// transcriptFlushInterval until ctx is done, so that the session isn't
+// lost if the coordinator restarts before it ends.
+func (ts *TranscriptStore) flushLoop(ctx context.Context, r *transcriptRecorder) {
+	tick := time.NewTicker(transcriptFlushInterval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+		}
+		if err := ts.flush(r); err != nil {
+			log.Printf("ssh transcripts: flushing %s: %v", r.t.ID, err)
+		}
+	}
+}
+
+// flush saves the transcript that r has recorded so far, unless it's
+// unchanged or finished.
+func (ts *TranscriptStore) flush(r *transcriptRecorder) error {
+	r.saveMu.Lock()
+	defer r.saveMu.Unlock()
+	t, ok := r.snapshot()
+	if !ok {
+		return nil
+	}
+	return ts.saveRecording(r, t)
+}
+
+// finish ends the recording of r, and saves the transcript.
+func (ts *TranscriptStore) finish(r *transcriptRecorder) (*Transcript, error) {
+	r.saveMu.Lock()
+	defer r.saveMu.Unlock()
+	t := r.finish()
+	return t, ts.saveRecording(r, t)
+}
+
+// saveRecording saves t, the transcript that r records, replacing what
+// was saved of it before. r.saveMu must be held.
+func (ts *TranscriptStore) saveRecording(r *transcriptRecorder, t *Transcript) error {
+	if r.saved {
+		// Not every gcsfs file system lets files be overwritten.
+		if err := gcsfs.Remove(ts.fsys, t.ID+transcriptExt); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	if err := ts.save(t); err != nil {
+		return err
+	}
+	r.saved = true
+	return nil
+}
+
+// save encrypts and stores t. The ID is authenticated along with it,
+// so that a transcript can't be passed off as another.
+func (ts *TranscriptStore) save(t *Transcript) error {
+	plaintext, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, ts.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	sealed := ts.aead.Seal(nonce, nonce, plaintext, []byte(t.ID))
+	return gcsfs.WriteFile(ts.fsys, t.ID+transcriptExt, sealed)
+}
+
+// Load returns the transcript with the given ID.
+func (ts *TranscriptStore) Load(id string) (*Transcript, error) {
+	if !fs.ValidPath(id) || strings.Contains(id, "/") {
+		return nil, fmt.Errorf("invalid transcript ID %q", id)
+	}
+	sealed, err := fs.ReadFile(ts.fsys, id+transcriptExt)
+	if err != nil {
+		return nil, err
+	}
+	n := ts.aead.NonceSize()
+	if len(sealed) < n {
+		return nil, fmt.Errorf("transcript %s is truncated", id)
+	}
+	plaintext, err := ts.aead.Open(nil, sealed[:n], sealed[n:], []byte(id))
+	if err != nil {
+		return nil, fmt.Errorf("decrypting transcript %s: %v", id, err)
+	}
+	t := new(Transcript)
+	if err := json.Unmarshal(plaintext, t); err != nil {
+		return nil, fmt.Errorf("decoding transcript %s: %v", id, err)
+	}
+	return t, nil
+}
+
+// TranscriptInfo describes a stored transcript, without decrypting it.
+type TranscriptInfo struct {
+	ID       string
+	Instance string
+	Start    time.Time
+}
+
+// List returns the stored transcripts, most recent first.
+func (ts *TranscriptStore) List() ([]TranscriptInfo, error) {
+	ents, err := fs.ReadDir(ts.fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+	var infos []TranscriptInfo
+	for _, ent := range ents {
+		id, ok := strings.CutSuffix(ent.Name(), transcriptExt)
+		if !ok || ent.IsDir() {
+			continue
+		}
+		info, ok := parseTranscriptID(id)
+		if !ok {
+			continue
+		}
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].ID > infos[j].ID })
+	return infos, nil
+}
+
+// parseTranscriptID parses the ID of a transcript, which is its start
+// time, instance and random suffix, separated by dashes.
+func parseTranscriptID(id string) (TranscriptInfo, bool) {
+	ts, rest, ok := strings.Cut(id, "-")
+	if !ok {
+		return TranscriptInfo{}, false
+	}
+	i := strings.LastIndex(rest, "-")
+	if i < 0 {
+		return TranscriptInfo{}, false
+	}
+	inst := rest[:i]
+	start, err := time.Parse(transcriptTimeFormat, ts)
+	if err != nil {
+		return TranscriptInfo{}, false
+	}
+	return TranscriptInfo{ID: id, Instance: inst, Start: start}, true
+}
+
+// Sweep deletes the transcripts older than the retention period, and
+// returns how many it deleted.
+func (ts *TranscriptStore) Sweep() (int, error) {
+	infos, err := ts.List()
+	if err != nil {
+		return 0, err
+	}
+	cutoff := ts.now().Add(-ts.retention)
+	var n int
+	var errs []error
+	for _, info := range infos {
+		if !info.Start.Before(cutoff) {
+			continue
+		}
+		if err := gcsfs.Remove(ts.fsys, info.ID+transcriptExt); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			errs = append(errs, err)
+			continue
+		}
+		n++
+	}
+	return n, errors.Join(errs...)
+}
+
+// SweepLoop calls Sweep every interval, forever.
+func (ts *TranscriptStore) SweepLoop(interval time.Duration) {
+	for {
+		n, err := ts.Sweep()
+		if err != nil {
+			log.Printf("ssh transcripts: sweeping: %v", err)
+		}
+		if n > 0 {
+			log.Printf("ssh transcripts: deleted %d transcripts older than %v", n, ts.retention)
+		}
+		time.Sleep(interval)
+	}
+}
+
+// NewTranscriptViewer returns a handler that lists the transcripts in
+// ts, and serves them in the asciicast v2 format, as <id>.cast, to the
+// given viewers only. The viewers are identified by the email address
+// that Identity Aware Proxy authenticated, so the handler must be
+// wrapped in access.RequireIAPAuthHandler. Every access is logged.
+func NewTranscriptViewer(ts *TranscriptStore, viewers []string) http.Handler {
+	allowed := make(map[string]bool)
+	for _, v := range viewers {
+		allowed[strings.TrimPrefix(v, "accounts.google.com:")] = true
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		iap, err := access.IAPFromContext(r.Context())
+		if err != nil {
+			http.Error(w, "unauthenticated", http.StatusUnauthorized)
+			return
+		}
+		viewer := strings.TrimPrefix(iap.Email, "accounts.google.com:")
+		if !allowed[viewer] {
+			log.Printf("ssh transcripts: denied %s access to %s", viewer, r.URL.Path)
+			http.Error(w, "you are not allowed to view SSH session transcripts", http.StatusForbidden)
+			return
+		}
+		name := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+		if name == "" {
+			infos, err := ts.List()
+			if err != nil {
+				log.Printf("ssh transcripts: listing: %v", err)
+				http.Error(w, "error listing transcripts", http.StatusInternalServerError)
+				return
+			}
+			log.Printf("ssh transcripts: %s listed transcripts", viewer)
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			transcriptsTmpl.Execute(w, struct {
+				Transcripts []TranscriptInfo
+				Retention   time.Duration
+			}{infos, ts.retention})
+			return
+		}
+		id, ok := strings.CutSuffix(name, ".cast")
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		t, err := ts.Load(id)
+		if errors.Is(err, fs.ErrNotExist) {
+			http.NotFound(w, r)
+			return
+		} else if err != nil {
+			log.Printf("ssh transcripts: loading %s: %v", id, err)
+			http.Error(w, "error loading transcript", http.StatusInternalServerError)
+			return
+		}
+		log.Printf("ssh transcripts: %s viewed %s", viewer, id)
+		w.Header().Set("Content-Type", "application/x-asciicast")
+		w.Header().Set("Cache-Control", "no-store")
+		if err := t.WriteCast(w); err != nil {
+			log.Printf("ssh transcripts: writing %s: %v", id, err)
+		}
+	})
+}
+
+var transcriptsTmpl = template.Must(template.New("transcripts").Parse(`<!DOCTYPE html>
+<html>
+<head><title>gomote SSH session transcripts</title></head>
+<body>
+<h1>gomote SSH session transcripts</h1>
+<p>Transcripts are kept for {{.Retention}}. Replay one with <code>asciinema play &lt;id&gt;.cast</code>.</p>
+<table>
+<tr><th align=left>Started</th><th align=left>Instance</th><th></th></tr>
+{{range .Transcripts}}<tr><td>{{.Start.Format "2006-01-02 15:04:05 MST"}}</td><td>{{.Instance}}</td><td><a href="{{.ID}}.cast">{{.ID}}.cast</a></td></tr>
+{{else}}<tr><td colspan=3>No transcripts.</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
@@ -0,0 +1,264 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.16 && (linux || darwin)
+// +build go1.16
+// +build linux darwin
+
+package remote
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	gssh "github.com/gliderlabs/ssh"
+	"github.com/google/go-cmp/cmp"
+	"golang.org/x/build/internal/access"
+	"golang.org/x/build/internal/gcsfs"
+)
+
+func newTestTranscriptStore(t *testing.T) (*TranscriptStore, string) {
+	dir := t.TempDir()
+	ts, err := NewTranscriptStore(gcsfs.DirFS(dir), bytes.Repeat([]byte{1}, 32), 24*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ts, dir
+}
+
+func TestTranscriptStore(t *testing.T) {
+	ts, dir := newTestTranscriptStore(t)
+	now := time.Date(2023, 9, 1, 12, 0, 0, 0, time.UTC)
+	ts.now = func() time.Time { return now }
+
+	rec := ts.start("user-maria-linux-amd64-0", "accounts.google.com:userIDvalue", gssh.Window{Width: 80, Height: 24})
+	rec.Write([]byte("$ go version\r\n"))
+	rec.resize(100, 30)
+	want, err := ts.finish(rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !regexp.MustCompile(`^20230901T120000Z-user-maria-linux-amd64-0-[0-9a-f]{8}$`).MatchString(want.ID) {
+		t.Errorf("ID = %q", want.ID)
+	}
+	got, err := ts.Load(want.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Load mismatch (-want +got):\n%s", diff)
+	}
+
+	// The transcript isn't stored in the clear, and can't be passed
+	// off as another.
+	sealed, err := os.ReadFile(filepath.Join(dir, want.ID+transcriptExt))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(sealed, []byte("go version")) {
+		t.Errorf("stored transcript contains its output in the clear")
+	}
+	const otherID = "20230901T130000Z-user-maria-linux-amd64-1-0123abcd"
+	if err := os.WriteFile(filepath.Join(dir, otherID+transcriptExt), sealed, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ts.Load(otherID); err == nil {
+		t.Errorf("Load(%q) of a renamed transcript succeeded; want error", otherID)
+	}
+	if _, err := ts.Load("../" + want.ID); err == nil {
+		t.Errorf("Load of a path outside the store succeeded; want error")
+	}
+
+	infos, err := ts.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantInfos := []TranscriptInfo{
+		{ID: otherID, Instance: "user-maria-linux-amd64-1", Start: now.Add(time.Hour)},
+		{ID: want.ID, Instance: "user-maria-linux-amd64-0", Start: now},
+	}
+	if diff := cmp.Diff(wantInfos, infos); diff != "" {
+		t.Errorf("List mismatch (-want +got):\n%s", diff)
+	}
+
+	// Only the transcripts older than the retention are swept.
+	now = now.Add(24*time.Hour + time.Minute)
+	if n, err := ts.Sweep(); err != nil || n != 1 {
+		t.Errorf("Sweep() = %d, %v; want 1, nil", n, err)
+	}
+	if _, err := ts.Load(want.ID); err == nil {
+		t.Errorf("Load(%q) after it expired succeeded; want error", want.ID)
+	}
+	if infos, _ := ts.List(); len(infos) != 1 || infos[0].ID != otherID {
+		t.Errorf("List() after Sweep = %v; want only %s", infos, otherID)
+	}
+}
+
+func TestTranscriptWriteCast(t *testing.T) {
+	tr := &Transcript{
+		Instance: "user-maria-linux-amd64-0",
+		OwnerID:  "accounts.google.com:userIDvalue",
+		Start:    time.Unix(1693569600, 0),
+		Width:    80,
+		Height:   24,
+		Events: []TranscriptEvent{
+			{Time: 500 * time.Millisecond, Type: "o", Data: []byte("caf\xc3")},
+			{Time: time.Second, Type: "o", Data: []byte("\xa9\r\n")},
+			{Time: 2 * time.Second, Type: "r", Width: 100, Height: 30},
+		},
+	}
+	var buf bytes.Buffer
+	if err := tr.WriteCast(&buf); err != nil {
+		t.Fatal(err)
+	}
+	want := `{"height":24,"timestamp":1693569600,"title":"gomote ssh user-maria-linux-amd64-0 (accounts.google.com:userIDvalue)","version":2,"width":80}
+[0.5,"o","caf"]
+[1,"o","é\r\n"]
+[2,"r","100x30"]
+`
+	if diff := cmp.Diff(want, buf.String()); diff != "" {
+		t.Errorf("WriteCast mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestTranscriptIDsUnique(t *testing.T) {
+	ts, _ := newTestTranscriptStore(t)
+	now := time.Date(2023, 9, 1, 12, 0, 0, 0, time.UTC)
+	ts.now = func() time.Time { return now }
+
+	// Two sessions on one instance in the same second each keep
+	// their transcript.
+	var ids []string
+	for _, out := range []string{"first\r\n", "second\r\n"} {
+		rec := ts.start("inst", "owner", gssh.Window{})
+		rec.Write([]byte(out))
+		tr, err := ts.finish(rec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, tr.ID)
+	}
+	if ids[0] == ids[1] {
+		t.Fatalf("both sessions have ID %q", ids[0])
+	}
+	infos, err := ts.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 2 {
+		t.Fatalf("List() = %v; want 2 transcripts", infos)
+	}
+	for _, info := range infos {
+		if info.Instance != "inst" || !info.Start.Equal(now) {
+			t.Errorf("List() has %+v; want instance inst, start %v", info, now)
+		}
+	}
+}
+
+func TestTranscriptFlush(t *testing.T) {
+	ts, _ := newTestTranscriptStore(t)
+	rec := ts.start("inst", "owner", gssh.Window{})
+	rec.Write([]byte("$ make\r\n"))
+	if err := ts.flush(rec); err != nil {
+		t.Fatal(err)
+	}
+	// A session in progress can be read back up to the last flush.
+	got, err := ts.Load(rec.t.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Events) != 1 {
+		t.Errorf("flushed transcript has %d events; want 1", len(got.Events))
+	}
+
+	rec.Write([]byte("ok\r\n"))
+	want, err := ts.finish(rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Flushes after the session ended don't overwrite its transcript.
+	if err := ts.flush(rec); err != nil {
+		t.Fatal(err)
+	}
+	got, err = ts.Load(want.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Load mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestTranscriptRecorderTruncates(t *testing.T) {
+	ts, _ := newTestTranscriptStore(t)
+	rec := ts.start("inst", "owner", gssh.Window{})
+	chunk := make([]byte, maxTranscriptSize/2+1)
+	for i := 0; i < 3; i++ {
+		if n, err := rec.Write(chunk); n != len(chunk) || err != nil {
+			t.Fatalf("Write = %d, %v; want %d, nil", n, err, len(chunk))
+		}
+	}
+	tr := rec.finish()
+	if len(tr.Events) != 2 || !strings.Contains(string(tr.Events[1].Data), "truncated") {
+		t.Errorf("transcript has %d events; want the first chunk and a truncation notice", len(tr.Events))
+	}
+}
+
+func TestTranscriptViewer(t *testing.T) {
+	ts, _ := newTestTranscriptStore(t)
+	rec := ts.start("user-maria-linux-amd64-0", "owner", gssh.Window{Width: 80, Height: 24})
+	rec.Write([]byte("hello\r\n"))
+	tr := rec.finish()
+	if err := ts.save(tr); err != nil {
+		t.Fatal(err)
+	}
+	h := NewTranscriptViewer(ts, []string{"viewer@golang.org"})
+	tests := []struct {
+		email, path string
+		wantCode    int
+		wantBody    string
+	}{
+		{"", "/gomote/ssh-transcripts/", http.StatusUnauthorized, ""},
+		{"accounts.google.com:other@golang.org", "/gomote/ssh-transcripts/", http.StatusForbidden, ""},
+		{"accounts.google.com:other@golang.org", "/gomote/ssh-transcripts/" + tr.ID + ".cast", http.StatusForbidden, ""},
+		{"accounts.google.com:viewer@golang.org", "/gomote/ssh-transcripts/", http.StatusOK, tr.ID + ".cast"},
+		{"accounts.google.com:viewer@golang.org", "/gomote/ssh-transcripts/" + tr.ID + ".cast", http.StatusOK, `"o","hello\r\n"]`},
+		{"accounts.google.com:viewer@golang.org", "/gomote/ssh-transcripts/20230901T120000Z-nope.cast", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", tt.path, nil)
+		if tt.email != "" {
+			req = req.WithContext(access.ContextWithIAP(req.Context(), access.IAPFields{Email: tt.email, ID: "id"}))
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if w.Code != tt.wantCode || !strings.Contains(w.Body.String(), tt.wantBody) {
+			t.Errorf("GET %s as %q = %d %q; want %d containing %q", tt.path, tt.email, w.Code, w.Body.String(), tt.wantCode, tt.wantBody)
+		}
+	}
+}
+
+func TestRecordingAccepted(t *testing.T) {
+	tests := []struct {
+		env  []string
+		want bool
+	}{
+		{nil, false},
+		{[]string{"TERM=xterm", TranscriptConsentEnv + "=accept"}, true},
+		{[]string{TranscriptConsentEnv + "=no"}, false},
+		{[]string{TranscriptConsentEnv + "accept=accept"}, false},
+	}
+	for _, tt := range tests {
+		if got := recordingAccepted(tt.env); got != tt.want {
+			t.Errorf("recordingAccepted(%q) = %v; want %v", tt.env, got, tt.want)
+		}
+	}
+}
@@ -20,6 +20,9 @@ import (
 type Fake struct {
 	mu    sync.Mutex
 	state SchedulerState
+
+	// GomoteLimit is returned by GomoteInstanceLimit.
+	GomoteLimit int
 }
 
 // NewFake returns a fake scheduler.
@@ -46,3 +49,6 @@ func (f *Fake) WaiterState(waiter *queue.SchedItem) (ws types.BuildletWaitStatus
 func (f *Fake) GetBuildlet(ctx context.Context, si *queue.SchedItem) (buildlet.Client, error) {
 	return &buildlet.FakeClient{}, nil
 }
+
+// GomoteInstanceLimit returns f.GomoteLimit.
+func (f *Fake) GomoteInstanceLimit(user string) int { return f.GomoteLimit }
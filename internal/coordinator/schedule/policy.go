@@ -0,0 +1,93 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build linux || darwin
+// +build linux darwin
+
+package schedule
+
+import (
+	"fmt"
+
+	"golang.org/x/build/internal/coordinator/pool/queue"
+)
+
+// A Policy configures how the scheduler shares buildlets.
+type Policy struct {
+	// Tiers ranks the kinds of buildlet requests, most important
+	// first. See queue.SetTiers.
+	Tiers []queue.Kind
+
+	// GomoteInstances is the maximum number of gomote instances
+	// each user may have at once, or 0 for no limit.
+	GomoteInstances int
+
+	// UserGomoteInstances overrides GomoteInstances for the users
+	// it lists, keyed by user name (as in gomote instance names).
+	UserGomoteInstances map[string]int
+}
+
+// DefaultPolicy returns the policy of a new Scheduler.
+func DefaultPolicy() Policy {
+	return Policy{Tiers: append([]queue.Kind(nil), queue.DefaultTiers...)}
+}
+
+func (p Policy) validate() error {
+	if p.GomoteInstances < 0 {
+		return fmt.Errorf("negative gomote instance limit %d", p.GomoteInstances)
+	}
+	for user, n := range p.UserGomoteInstances {
+		if n < 0 {
+			return fmt.Errorf("negative gomote instance limit %d for user %q", n, user)
+		}
+	}
+	return nil
+}
+
+// clone returns a deep copy of p.
+func (p Policy) clone() Policy {
+	p.Tiers = append([]queue.Kind(nil), p.Tiers...)
+	users := make(map[string]int, len(p.UserGomoteInstances))
+	for user, n := range p.UserGomoteInstances {
+		users[user] = n
+	}
+	p.UserGomoteInstances = users
+	return p
+}
+
+// Policy returns the current policy of the scheduler.
+func (s *Scheduler) Policy() Policy {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p := s.policy.clone()
+	p.Tiers = queue.Tiers()
+	return p
+}
+
+// SetPolicy changes the policy of the scheduler. The new tiers apply
+// to waiting requests as well as new ones; the new gomote limits
+// apply to instances created from then on.
+func (s *Scheduler) SetPolicy(p Policy) error {
+	if err := p.validate(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := queue.SetTiers(p.Tiers); err != nil {
+		return err
+	}
+	s.policy = p.clone()
+	return nil
+}
+
+// GomoteInstanceLimit returns the maximum number of gomote instances
+// that user may have at once, or 0 if there's no limit.
+func (s *Scheduler) GomoteInstanceLimit(user string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if n, ok := s.policy.UserGomoteInstances[user]; ok {
+		return n
+	}
+	return s.policy.GomoteInstances
+}
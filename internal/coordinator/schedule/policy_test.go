@@ -0,0 +1,60 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build linux || darwin
+// +build linux darwin
+
+package schedule
+
+import (
+	"reflect"
+	"testing"
+
+	"golang.org/x/build/internal/coordinator/pool/queue"
+)
+
+func TestSchedulerPolicy(t *testing.T) {
+	defer queue.SetTiers(queue.DefaultTiers)
+
+	s := NewScheduler()
+	if got, want := s.Policy(), DefaultPolicy(); !reflect.DeepEqual(got.Tiers, want.Tiers) || got.GomoteInstances != 0 {
+		t.Errorf("new scheduler's policy = %+v, want %+v", got, want)
+	}
+
+	err := s.SetPolicy(Policy{
+		Tiers:               []queue.Kind{queue.KindGomote},
+		GomoteInstances:     2,
+		UserGomoteInstances: map[string]int{"gopher": 5},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := s.GomoteInstanceLimit("gopher"), 5; got != want {
+		t.Errorf("GomoteInstanceLimit(gopher) = %d, want %d", got, want)
+	}
+	if got, want := s.GomoteInstanceLimit("someone"), 2; got != want {
+		t.Errorf("GomoteInstanceLimit(someone) = %d, want %d", got, want)
+	}
+	p := s.Policy()
+	if want := []queue.Kind{queue.KindGomote, queue.KindRelease, queue.KindTry, queue.KindPostSubmit, queue.KindSpeculative}; !reflect.DeepEqual(p.Tiers, want) {
+		t.Errorf("Policy().Tiers = %v, want %v", p.Tiers, want)
+	}
+	p.UserGomoteInstances["gopher"] = 1
+	if got, want := s.GomoteInstanceLimit("gopher"), 5; got != want {
+		t.Errorf("modifying the result of Policy changed GomoteInstanceLimit(gopher) to %d", got)
+	}
+
+	for _, p := range []Policy{
+		{Tiers: []queue.Kind{"nightly"}},
+		{GomoteInstances: -1},
+		{UserGomoteInstances: map[string]int{"gopher": -1}},
+	} {
+		if err := s.SetPolicy(p); err == nil {
+			t.Errorf("SetPolicy(%+v) = nil, want error", p)
+		}
+	}
+	if got, want := s.GomoteInstanceLimit("someone"), 2; got != want {
+		t.Errorf("after invalid policies, GomoteInstanceLimit(someone) = %d, want %d", got, want)
+	}
+}
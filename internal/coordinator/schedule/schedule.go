@@ -39,6 +39,8 @@ type Scheduler struct {
 	hostsCreating map[string]int // hostType -> count
 
 	lastProgress map[string]time.Time // hostType -> time last delivered buildlet
+
+	policy Policy
 }
 
 // NewScheduler returns a new scheduler.
@@ -47,6 +49,7 @@ func NewScheduler() *Scheduler {
 		hostsCreating: make(map[string]int),
 		waiting:       make(map[string]map[*queue.SchedItem]bool),
 		lastProgress:  make(map[string]time.Time),
+		policy:        DefaultPolicy(),
 	}
 	return s
 }
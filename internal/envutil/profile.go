@@ -0,0 +1,83 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package envutil
+
+import "strings"
+
+// A Profile describes the environment that build commands run in, so
+// that it's the same however the machine running them is set up: the
+// variables they may inherit from it, the directories on their PATH,
+// and where their temporary files go.
+type Profile struct {
+	// Name identifies the profile in logs, such as "unix-hermetic".
+	Name string `json:"name"`
+
+	// Allow lists the variables commands may inherit. An entry
+	// ending in "*" allows all variables with that prefix, such as
+	// "GO*". Variables the caller sets explicitly aren't subject to
+	// it, nor is PWD, which SetDir sets, or PATH or TMPDIR if the
+	// profile sets them.
+	Allow []string `json:"allow,omitempty"`
+
+	// Path, if non-nil, replaces the inherited PATH, with the same
+	// expansions as the Path of buildlet.ExecOpts.
+	Path []string `json:"path,omitempty"`
+
+	// TmpDir, if non-empty, is the slash-separated directory,
+	// relative to the work directory, that TMPDIR is set to.
+	TmpDir string `json:"tmpDir,omitempty"`
+
+	// Strict is whether to remove the variables the profile doesn't
+	// allow. Otherwise they're kept, and only reported as violations.
+	Strict bool `json:"strict,omitempty"`
+}
+
+// Allows reports whether p allows commands to inherit variable key,
+// interpreted as if on the given GOOS.
+func (p *Profile) Allows(goos, key string) bool {
+	if goos == "windows" {
+		key = strings.ToUpper(key)
+	}
+	switch {
+	case key == "PWD",
+		key == "PATH" && p.Path != nil,
+		key == "path" && goos == "plan9" && p.Path != nil,
+		key == "TMPDIR" && p.TmpDir != "":
+		return true
+	}
+	for _, pat := range p.Allow {
+		if goos == "windows" {
+			pat = strings.ToUpper(pat)
+		}
+		if prefix, ok := strings.CutSuffix(pat, "*"); ok {
+			if strings.HasPrefix(key, prefix) {
+				return true
+			}
+		} else if key == pat {
+			return true
+		}
+	}
+	return false
+}
+
+// Apply returns env with p applied, along with the keys of the
+// variables in env that p doesn't allow, in the order they appear.
+// If p is Strict, those variables are removed from the result.
+//
+// Apply doesn't set PATH or TMPDIR; it's up to the caller to do so.
+func (p *Profile) Apply(goos string, env []string) (out, violations []string) {
+	out = make([]string, 0, len(env))
+	for _, kv := range env {
+		k, _ := Split(kv)
+		if !p.Allows(goos, k) {
+			violations = append(violations, k)
+			if p.Strict {
+				continue
+			}
+		}
+		out = append(out, kv)
+	}
+	return out, violations
+}
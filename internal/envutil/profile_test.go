@@ -0,0 +1,65 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package envutil
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestProfileAllows(t *testing.T) {
+	p := &Profile{
+		Allow:  []string{"HOME", "GO*"},
+		TmpDir: "tmp",
+	}
+	tests := []struct {
+		goos, key string
+		want      bool
+	}{
+		{"linux", "HOME", true},
+		{"linux", "HOMEDIR", false},
+		{"linux", "home", false},
+		{"windows", "home", true},
+		{"linux", "GOROOT", true},
+		{"linux", "GO", true},
+		{"linux", "goroot", false},
+		{"windows", "GoRoot", true},
+		{"linux", "TMPDIR", true},
+		{"linux", "PWD", true},
+		{"linux", "PATH", false},
+		{"plan9", "path", false},
+	}
+	for _, tt := range tests {
+		if got := p.Allows(tt.goos, tt.key); got != tt.want {
+			t.Errorf("Allows(%q, %q) = %v; want %v", tt.goos, tt.key, got, tt.want)
+		}
+	}
+
+	p.Path = []string{"/bin"}
+	for _, tt := range []struct{ goos, key string }{{"linux", "PATH"}, {"windows", "Path"}, {"plan9", "path"}} {
+		if !p.Allows(tt.goos, tt.key) {
+			t.Errorf("Allows(%q, %q) = false with Path set; want true", tt.goos, tt.key)
+		}
+	}
+}
+
+func TestProfileApply(t *testing.T) {
+	env := []string{"HOME=/home/gopher", "SECRET=1", "GOPATH=/go", "CC=clang", "PATH=/usr/bin"}
+	tests := []struct {
+		strict         bool
+		want           []string
+		wantViolations []string
+	}{
+		{false, env, []string{"SECRET", "CC", "PATH"}},
+		{true, []string{"HOME=/home/gopher", "GOPATH=/go"}, []string{"SECRET", "CC", "PATH"}},
+	}
+	for _, tt := range tests {
+		p := &Profile{Allow: []string{"HOME", "GO*"}, Strict: tt.strict}
+		got, violations := p.Apply("linux", env)
+		if !reflect.DeepEqual(got, tt.want) || !reflect.DeepEqual(violations, tt.wantViolations) {
+			t.Errorf("Apply (strict=%v) = %q, %q; want %q, %q", tt.strict, got, violations, tt.want, tt.wantViolations)
+		}
+	}
+}
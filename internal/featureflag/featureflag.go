@@ -0,0 +1,189 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package featureflag implements feature flags for the build
+// infrastructure, so that risky changes to its behavior can be rolled
+// out gradually, and turned off, without redeploying.
+//
+// Flags are stored in datastore, edited with the Handler's UI or API,
+// and evaluated with a Set, which keeps an up-to-date copy of them.
+// A flag is either a percentage rollout of new behavior, evaluated by
+// Enabled, or a kill switch for existing behavior, evaluated by Killed.
+package featureflag
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/datastore"
+)
+
+// A Flag is a feature flag.
+type Flag struct {
+	Name        string
+	Description string `datastore:",noindex"`
+	// Percent is the percentage, from 0 to 100, of keys the flag is
+	// enabled for.
+	Percent int
+	// Killed turns the flag's behavior off everywhere, whatever its
+	// Percent.
+	Killed    bool
+	Updated   time.Time
+	UpdatedBy string
+}
+
+// Valid reports whether f is a valid flag.
+func (f *Flag) Valid() error {
+	if f.Name == "" {
+		return fmt.Errorf("flag has no name")
+	}
+	if f.Percent < 0 || f.Percent > 100 {
+		return fmt.Errorf("flag %q: percent %d is out of range [0, 100]", f.Name, f.Percent)
+	}
+	return nil
+}
+
+// Enabled reports whether f is enabled for key: whether it isn't
+// killed, and key falls in its rollout percentage. Each key falls in
+// the same percentile of a flag's rollout every time, so raising the
+// percentage of a flag only enables it for more keys.
+func (f *Flag) Enabled(key string) bool {
+	if f.Killed || f.Percent <= 0 {
+		return false
+	}
+	if f.Percent >= 100 {
+		return true
+	}
+	h := fnv.New32a()
+	h.Write([]byte(f.Name))
+	h.Write([]byte{0})
+	h.Write([]byte(key))
+	return int(h.Sum32()%100) < f.Percent
+}
+
+// A Store stores feature flags.
+type Store interface {
+	// Flags returns all flags.
+	Flags(ctx context.Context) ([]*Flag, error)
+	// Put creates or replaces the flag with f's name.
+	Put(ctx context.Context, f *Flag) error
+}
+
+// kind is the datastore kind of flags.
+const kind = "FeatureFlag"
+
+// DatastoreStore is a Store of flags in datastore, keyed by name.
+type DatastoreStore struct {
+	Client *datastore.Client
+}
+
+func (s *DatastoreStore) Flags(ctx context.Context) ([]*Flag, error) {
+	var flags []*Flag
+	if _, err := s.Client.GetAll(ctx, datastore.NewQuery(kind), &flags); err != nil {
+		return nil, err
+	}
+	return flags, nil
+}
+
+func (s *DatastoreStore) Put(ctx context.Context, f *Flag) error {
+	_, err := s.Client.Put(ctx, datastore.NameKey(kind, f.Name, nil), f)
+	return err
+}
+
+// A Set evaluates feature flags, from a copy of the flags of a Store
+// kept up to date by Run.
+//
+// A nil *Set has no flags, so that flags can be evaluated whether
+// they're configured or not.
+type Set struct {
+	store Store
+
+	mu    sync.RWMutex
+	flags map[string]*Flag // by name
+}
+
+// NewSet returns a Set of the flags in store. It has no flags until
+// its first Refresh.
+func NewSet(store Store) *Set {
+	return &Set{store: store}
+}
+
+// Run refreshes s every interval until ctx is done.
+func (s *Set) Run(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		if err := s.Refresh(ctx); err != nil {
+			log.Printf("featureflag: Refresh() = %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// Refresh updates s's copy of the flags of its store.
+// If it fails, s keeps its last copy.
+func (s *Set) Refresh(ctx context.Context) error {
+	flags, err := s.store.Flags(ctx)
+	if err != nil {
+		return err
+	}
+	m := make(map[string]*Flag, len(flags))
+	for _, f := range flags {
+		m[f.Name] = f
+	}
+	s.mu.Lock()
+	s.flags = m
+	s.mu.Unlock()
+	return nil
+}
+
+// Flag returns the flag with the given name, or nil if there's none.
+func (s *Set) Flag(name string) *Flag {
+	if s == nil {
+		return nil
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.flags[name]
+}
+
+// Flags returns s's flags, sorted by name.
+func (s *Set) Flags() []*Flag {
+	if s == nil {
+		return nil
+	}
+	s.mu.RLock()
+	flags := make([]*Flag, 0, len(s.flags))
+	for _, f := range s.flags {
+		flags = append(flags, f)
+	}
+	s.mu.RUnlock()
+	sort.Slice(flags, func(i, j int) bool { return flags[i].Name < flags[j].Name })
+	return flags
+}
+
+// Enabled reports whether the rollout of the flag with the given name
+// includes key, such as a builder or user name. Flags that don't exist
+// aren't enabled.
+func (s *Set) Enabled(name, key string) bool {
+	f := s.Flag(name)
+	return f != nil && f.Enabled(key)
+}
+
+// Killed reports whether the flag with the given name is killed, to
+// turn off the existing behavior it guards. Flags that don't exist
+// aren't killed.
+func (s *Set) Killed(name string) bool {
+	f := s.Flag(name)
+	return f != nil && f.Killed
+}
@@ -0,0 +1,202 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package featureflag
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// memStore is a Store in memory.
+type memStore struct {
+	mu    sync.Mutex
+	flags map[string]Flag
+}
+
+func (s *memStore) Flags(ctx context.Context) ([]*Flag, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var flags []*Flag
+	for _, f := range s.flags {
+		f := f
+		flags = append(flags, &f)
+	}
+	return flags, nil
+}
+
+func (s *memStore) Put(ctx context.Context, f *Flag) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.flags == nil {
+		s.flags = make(map[string]Flag)
+	}
+	s.flags[f.Name] = *f
+	return nil
+}
+
+func TestFlagEnabled(t *testing.T) {
+	var keys []string
+	for i := 0; i < 1000; i++ {
+		keys = append(keys, fmt.Sprintf("builder-%d", i))
+	}
+	enabled := make(map[string]bool)
+	for _, percent := range []int{0, 10, 50, 90, 100} {
+		f := &Flag{Name: "rollout", Percent: percent}
+		n := 0
+		for _, k := range keys {
+			on := f.Enabled(k)
+			if enabled[k] && !on {
+				t.Errorf("raising percent to %d disabled key %q", percent, k)
+			}
+			enabled[k] = on
+			if on {
+				n++
+			}
+		}
+		// Allow for some unevenness in the hash.
+		if want := percent * len(keys) / 100; n < want-50 || n > want+50 {
+			t.Errorf("flag at %d%% is enabled for %d of %d keys", percent, n, len(keys))
+		}
+		f.Killed = true
+		for _, k := range keys {
+			if f.Enabled(k) {
+				t.Fatalf("killed flag at %d%% is enabled for %q", percent, k)
+			}
+		}
+	}
+}
+
+func TestSet(t *testing.T) {
+	var nilSet *Set
+	if nilSet.Enabled("x", "key") || nilSet.Killed("x") {
+		t.Errorf("nil Set has flags")
+	}
+
+	store := new(memStore)
+	store.Put(context.Background(), &Flag{Name: "on", Percent: 100})
+	store.Put(context.Background(), &Flag{Name: "kill", Killed: true})
+	s := NewSet(store)
+	if s.Enabled("on", "key") {
+		t.Errorf("Set has flags before its first Refresh")
+	}
+	if err := s.Refresh(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		name          string
+		enabled, kill bool
+	}{
+		{"on", true, false},
+		{"kill", false, true},
+		{"missing", false, false},
+	} {
+		if got := s.Enabled(tt.name, "key"); got != tt.enabled {
+			t.Errorf("Enabled(%q) = %v; want %v", tt.name, got, tt.enabled)
+		}
+		if got := s.Killed(tt.name); got != tt.kill {
+			t.Errorf("Killed(%q) = %v; want %v", tt.name, got, tt.kill)
+		}
+	}
+}
+
+func TestHandler(t *testing.T) {
+	store := new(memStore)
+	set := NewSet(store)
+	h := &Handler{
+		Store: store,
+		Set:   set,
+		Authorize: func(w http.ResponseWriter, r *http.Request) (string, bool) {
+			if r.Header.Get("X-User") == "" {
+				http.Error(w, "who are you?", http.StatusForbidden)
+				return "", false
+			}
+			return r.Header.Get("X-User"), true
+		},
+	}
+
+	// Create a flag with the form.
+	form := url.Values{"name": {"new-scheduler"}, "description": {"Use the new scheduler."}, "percent": {"25"}}
+	req := httptest.NewRequest("POST", "/flags", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("X-User", "gopher@golang.org")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusSeeOther {
+		t.Fatalf("form POST: status = %d; want %d: %s", rec.Code, http.StatusSeeOther, rec.Body)
+	}
+	if f := set.Flag("new-scheduler"); f == nil || f.Percent != 25 || f.UpdatedBy != "gopher@golang.org" {
+		t.Errorf("after form POST, Set has flag %+v", f)
+	}
+
+	// Kill it with the API.
+	req = httptest.NewRequest("POST", "/flags", strings.NewReader(`{"Name": "new-scheduler", "Percent": 25, "Killed": true}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-User", "oncall@golang.org")
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("JSON POST: status = %d; want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+	if !set.Killed("new-scheduler") {
+		t.Errorf("after JSON POST, flag isn't killed")
+	}
+
+	// Invalid and unauthorized updates are rejected.
+	for _, tt := range []struct {
+		body, user string
+		want       int
+	}{
+		{`{"Name": "x", "Percent": 101}`, "gopher@golang.org", http.StatusBadRequest},
+		{`{"Percent": 1}`, "gopher@golang.org", http.StatusBadRequest},
+		{`{"Name": "x"}`, "", http.StatusForbidden},
+	} {
+		req := httptest.NewRequest("POST", "/flags", strings.NewReader(tt.body))
+		req.Header.Set("Content-Type", "application/json")
+		if tt.user != "" {
+			req.Header.Set("X-User", tt.user)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("POST %s by %q: status = %d; want %d", tt.body, tt.user, rec.Code, tt.want)
+		}
+	}
+
+	// List the flags.
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/flags?format=json", nil))
+	var got []*Flag
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("listing flags: %v: %s", err, rec.Body)
+	}
+	want := []*Flag{{Name: "new-scheduler", Description: "", Percent: 25, Killed: true, UpdatedBy: "oncall@golang.org"}}
+	if diff := cmp.Diff(want, got, cmpIgnoreUpdated); diff != "" {
+		t.Errorf("listed flags mismatch (-want +got):\n%s", diff)
+	}
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/flags", nil))
+	if !strings.Contains(rec.Body.String(), "new-scheduler") {
+		t.Errorf("flags page doesn't list new-scheduler:\n%s", rec.Body)
+	}
+
+	// Without Authorize, flags are read-only.
+	ro := &Handler{Store: store}
+	rec = httptest.NewRecorder()
+	ro.ServeHTTP(rec, httptest.NewRequest("POST", "/flags", strings.NewReader(`{"Name": "x"}`)))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST to read-only Handler: status = %d; want %d", rec.Code, http.StatusMethodNotAllowed)
+	}
+}
+
+var cmpIgnoreUpdated = cmp.FilterPath(func(p cmp.Path) bool { return p.Last().String() == ".Updated" }, cmp.Ignore())
@@ -0,0 +1,179 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package featureflag
+
+import (
+	"encoding/json"
+	"html/template"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A Handler serves the UI and API of the flags of a Store.
+//
+// GET requests list the flags, as an HTML page, or as JSON if the
+// request has the query parameter "format=json" or accepts
+// application/json. POST requests create or update a flag, from an
+// HTML form with the fields "name", "description", "percent" and
+// "killed", or from a JSON Flag.
+type Handler struct {
+	Store Store
+	// Set, if non-nil, is refreshed after each update so that the
+	// update takes effect immediately where it's served.
+	Set *Set
+	// Authorize, if non-nil, reports who's responsible for a POST
+	// request and whether they may update flags, replying with an
+	// error if not. If Authorize is nil, flags are read-only.
+	Authorize func(w http.ResponseWriter, r *http.Request) (actor string, ok bool)
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		h.serveList(w, r)
+	case http.MethodPost:
+		h.serveUpdate(w, r)
+	default:
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	}
+}
+
+func wantsJSON(r *http.Request) bool {
+	return r.FormValue("format") == "json" || strings.Contains(r.Header.Get("Accept"), "application/json") ||
+		strings.HasPrefix(r.Header.Get("Content-Type"), "application/json")
+}
+
+func (h *Handler) serveList(w http.ResponseWriter, r *http.Request) {
+	flags, err := h.Store.Flags(r.Context())
+	if err != nil {
+		log.Printf("featureflag: Flags() = %v", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	sort.Slice(flags, func(i, j int) bool { return flags[i].Name < flags[j].Name })
+	if wantsJSON(r) {
+		if flags == nil {
+			flags = []*Flag{}
+		}
+		writeJSON(w, http.StatusOK, flags)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := listTmpl.Execute(w, struct {
+		Flags    []*Flag
+		Editable bool
+	}{flags, h.Authorize != nil}); err != nil {
+		log.Printf("featureflag: listTmpl.Execute() = %v", err)
+	}
+}
+
+func (h *Handler) serveUpdate(w http.ResponseWriter, r *http.Request) {
+	if h.Authorize == nil {
+		http.Error(w, "flags are read-only here", http.StatusMethodNotAllowed)
+		return
+	}
+	actor, ok := h.Authorize(w, r)
+	if !ok {
+		return
+	}
+	f := new(Flag)
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		if err := json.NewDecoder(r.Body).Decode(f); err != nil {
+			http.Error(w, "malformed flag: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	} else {
+		f.Name = strings.TrimSpace(r.FormValue("name"))
+		f.Description = r.FormValue("description")
+		f.Killed = r.FormValue("killed") != ""
+		if p := r.FormValue("percent"); p != "" {
+			var err error
+			if f.Percent, err = strconv.Atoi(p); err != nil {
+				http.Error(w, "malformed percent: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+	}
+	if err := f.Valid(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	f.Updated = time.Now().UTC()
+	f.UpdatedBy = actor
+	if err := h.Store.Put(r.Context(), f); err != nil {
+		log.Printf("featureflag: Put(%q) = %v", f.Name, err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	log.Printf("featureflag: %s set %q to percent=%d killed=%v", actor, f.Name, f.Percent, f.Killed)
+	if h.Set != nil {
+		if err := h.Set.Refresh(r.Context()); err != nil {
+			log.Printf("featureflag: Refresh() = %v", err)
+		}
+	}
+	if wantsJSON(r) {
+		writeJSON(w, http.StatusOK, f)
+		return
+	}
+	http.Redirect(w, r, r.URL.Path, http.StatusSeeOther)
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	e := json.NewEncoder(w)
+	e.SetIndent("", "\t")
+	if err := e.Encode(v); err != nil {
+		log.Printf("featureflag: writing JSON: %v", err)
+	}
+}
+
+var listTmpl = template.Must(template.New("flags").Parse(`<!DOCTYPE html>
+<html lang="en">
+<title>Feature flags</title>
+<h1>Feature flags</h1>
+<table>
+  <thead>
+    <tr><th>Name</th><th>Description</th><th>Percent</th><th>Killed</th><th>Updated</th>{{if .Editable}}<th></th>{{end}}</tr>
+  </thead>
+  <tbody>
+  {{- range .Flags}}
+    {{- if $.Editable}}
+    <tr><form method="post">
+      <td><input type="hidden" name="name" value="{{.Name}}">{{.Name}}</td>
+      <td><input type="text" name="description" value="{{.Description}}"></td>
+      <td><input type="number" name="percent" min="0" max="100" value="{{.Percent}}"></td>
+      <td><input type="checkbox" name="killed" value="1"{{if .Killed}} checked{{end}}></td>
+      <td>{{.Updated.Format "2006-01-02 15:04:05Z07:00"}} by {{.UpdatedBy}}</td>
+      <td><input type="submit" value="Update"></td>
+    </form></tr>
+    {{- else}}
+    <tr>
+      <td>{{.Name}}</td>
+      <td>{{.Description}}</td>
+      <td>{{.Percent}}</td>
+      <td>{{if .Killed}}killed{{end}}</td>
+      <td>{{.Updated.Format "2006-01-02 15:04:05Z07:00"}} by {{.UpdatedBy}}</td>
+    </tr>
+    {{- end}}
+  {{- end}}
+  </tbody>
+</table>
+{{- if .Editable}}
+<h2>New flag</h2>
+<form method="post">
+  <label>Name <input type="text" name="name" required></label>
+  <label>Description <input type="text" name="description"></label>
+  <label>Percent <input type="number" name="percent" min="0" max="100" value="0"></label>
+  <label>Killed <input type="checkbox" name="killed" value="1"></label>
+  <input type="submit" value="Create">
+</form>
+{{- end}}
+</html>
+`))
@@ -7,15 +7,18 @@ package gcsfs
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"io/fs"
+	"net/http"
 	"net/url"
 	"path"
 	"strings"
 	"time"
 
 	"cloud.google.com/go/storage"
+	"google.golang.org/api/googleapi"
 	"google.golang.org/api/iterator"
 )
 
@@ -58,6 +61,56 @@ type CreateFS interface {
 	Create(string) (WriterFile, error)
 }
 
+// Remove removes the named file from fsys, which must be a RemoveFS.
+func Remove(fsys fs.FS, name string) error {
+	rfs, ok := fsys.(RemoveFS)
+	if !ok {
+		return &fs.PathError{Op: "remove", Path: name, Err: fmt.Errorf("not implemented on type %T", fsys)}
+	}
+	return rfs.Remove(name)
+}
+
+// RemoveFS is an fs.FS that supports removing files.
+type RemoveFS interface {
+	fs.FS
+	Remove(string) error
+}
+
+// ReadFileGeneration reads the named file from fsys, which must be a
+// GenerationFS, and returns its contents and generation.
+func ReadFileGeneration(fsys fs.FS, name string) ([]byte, int64, error) {
+	gfs, ok := fsys.(GenerationFS)
+	if !ok {
+		return nil, 0, &fs.PathError{Op: "read", Path: name, Err: fmt.Errorf("not implemented on type %T", fsys)}
+	}
+	return gfs.ReadFileGeneration(name)
+}
+
+// WriteFileIfGeneration writes the named file to fsys, which must be a
+// GenerationFS, if it's still at generation gen, or if gen is 0, if it
+// doesn't exist. Otherwise it returns an error matching
+// ErrGenerationMismatch.
+func WriteFileIfGeneration(fsys fs.FS, name string, contents []byte, gen int64) error {
+	gfs, ok := fsys.(GenerationFS)
+	if !ok {
+		return &fs.PathError{Op: "write", Path: name, Err: fmt.Errorf("not implemented on type %T", fsys)}
+	}
+	return gfs.WriteFileIfGeneration(name, contents, gen)
+}
+
+// ErrGenerationMismatch is the error of a conditional write to a file
+// that was written since it was read.
+var ErrGenerationMismatch = errors.New("file generation mismatch")
+
+// GenerationFS is an fs.FS whose files have a generation, a non-zero
+// number that changes each time a file is written, so that a file can
+// be updated only if nobody else has written it since it was read.
+type GenerationFS interface {
+	fs.FS
+	ReadFileGeneration(name string) ([]byte, int64, error)
+	WriteFileIfGeneration(name string, contents []byte, gen int64) error
+}
+
 // WriterFile is an fs.File that can be written to.
 // The behavior of writing and reading the same file is undefined.
 type WriterFile interface {
@@ -88,6 +141,8 @@ type gcsFS struct {
 
 var _ = fs.FS((*gcsFS)(nil))
 var _ = CreateFS((*gcsFS)(nil))
+var _ = RemoveFS((*gcsFS)(nil))
+var _ = GenerationFS((*gcsFS)(nil))
 var _ = fs.SubFS((*gcsFS)(nil))
 
 // NewFS creates a new fs.FS that uses ctx for all of its operations.
@@ -131,6 +186,66 @@ func (fsys *gcsFS) Create(name string) (WriterFile, error) {
 	return f.(*GCSFile), nil
 }
 
+// Remove removes the named file.
+func (fsys *gcsFS) Remove(name string) error {
+	if !validPath(name) {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrInvalid}
+	}
+	err := fsys.object(name).Delete(fsys.ctx)
+	if err == storage.ErrObjectNotExist {
+		err = fs.ErrNotExist
+	}
+	if err != nil {
+		return &fs.PathError{Op: "remove", Path: name, Err: err}
+	}
+	return nil
+}
+
+// ReadFileGeneration reads the named file and returns its generation.
+func (fsys *gcsFS) ReadFileGeneration(name string) ([]byte, int64, error) {
+	if !validPath(name) {
+		return nil, 0, &fs.PathError{Op: "read", Path: name, Err: fs.ErrInvalid}
+	}
+	r, err := fsys.object(name).NewReader(fsys.ctx)
+	if err == storage.ErrObjectNotExist {
+		err = fs.ErrNotExist
+	}
+	if err != nil {
+		return nil, 0, &fs.PathError{Op: "read", Path: name, Err: err}
+	}
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, 0, &fs.PathError{Op: "read", Path: name, Err: err}
+	}
+	return data, r.Attrs.Generation, nil
+}
+
+// WriteFileIfGeneration writes the named file if it's at generation
+// gen, or doesn't exist if gen is 0.
+func (fsys *gcsFS) WriteFileIfGeneration(name string, contents []byte, gen int64) error {
+	if !validPath(name) {
+		return &fs.PathError{Op: "write", Path: name, Err: fs.ErrInvalid}
+	}
+	cond := storage.Conditions{GenerationMatch: gen}
+	if gen == 0 {
+		cond = storage.Conditions{DoesNotExist: true}
+	}
+	w := fsys.object(name).If(cond).NewWriter(fsys.ctx)
+	if _, err := w.Write(contents); err != nil {
+		w.Close()
+		return &fs.PathError{Op: "write", Path: name, Err: err}
+	}
+	err := w.Close()
+	if e := (*googleapi.Error)(nil); errors.As(err, &e) && e.Code == http.StatusPreconditionFailed {
+		err = ErrGenerationMismatch
+	}
+	if err != nil {
+		return &fs.PathError{Op: "write", Path: name, Err: err}
+	}
+	return nil
+}
+
 func (fsys *gcsFS) Sub(dir string) (fs.FS, error) {
 	copy := *fsys
 	copy.prefix = path.Join(fsys.prefix, dir)
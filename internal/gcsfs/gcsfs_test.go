@@ -6,6 +6,7 @@ package gcsfs
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"io/fs"
 	"io/ioutil"
@@ -90,3 +91,46 @@ func TestDirFSWrite(t *testing.T) {
 		t.Fatalf("unexpected file contents %q, want %q", string(b), "hey\n")
 	}
 }
+
+func TestDirFSRemove(t *testing.T) {
+	temp := t.TempDir()
+	fsys := DirFS(temp)
+	if err := WriteFile(fsys, "dir/fsystest.txt", []byte("hey\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := Remove(fsys, "dir/fsystest.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(temp, "dir/fsystest.txt")); !os.IsNotExist(err) {
+		t.Errorf("file still exists after Remove: %v", err)
+	}
+	if err := Remove(fsys, "dir/fsystest.txt"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Remove of missing file = %v, want %v", err, fs.ErrNotExist)
+	}
+}
+
+func TestDirFSWriteIfGeneration(t *testing.T) {
+	fsys := DirFS(t.TempDir())
+	if err := WriteFileIfGeneration(fsys, "f", []byte("1"), 0); err != nil {
+		t.Fatalf("creating new file: %v", err)
+	}
+	if err := WriteFileIfGeneration(fsys, "f", []byte("x"), 0); !errors.Is(err, ErrGenerationMismatch) {
+		t.Errorf("creating existing file = %v, want %v", err, ErrGenerationMismatch)
+	}
+	data, gen, err := ReadFileGeneration(fsys, "f")
+	if err != nil || string(data) != "1" || gen == 0 {
+		t.Fatalf("ReadFileGeneration = %q, %d, %v; want %q, non-zero generation, no error", data, gen, err, "1")
+	}
+	if err := WriteFileIfGeneration(fsys, "f", []byte("2"), gen); err != nil {
+		t.Fatalf("writing file at its generation: %v", err)
+	}
+	if err := WriteFileIfGeneration(fsys, "f", []byte("3"), gen); !errors.Is(err, ErrGenerationMismatch) {
+		t.Errorf("writing file at old generation = %v, want %v", err, ErrGenerationMismatch)
+	}
+	if data, _, _ := ReadFileGeneration(fsys, "f"); string(data) != "2" {
+		t.Errorf("after writes, file contains %q, want %q", data, "2")
+	}
+	if err := WriteFileIfGeneration(fsys, "missing", []byte("x"), gen); !errors.Is(err, ErrGenerationMismatch) {
+		t.Errorf("writing missing file at a generation = %v, want %v", err, ErrGenerationMismatch)
+	}
+}
@@ -5,6 +5,8 @@
 package gcsfs
 
 import (
+	"crypto/sha256"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"io/fs"
@@ -12,10 +14,13 @@ import (
 	"path"
 	"runtime"
 	"strings"
+	"sync"
 )
 
 var _ = fs.FS((*dirFS)(nil))
 var _ = CreateFS((*dirFS)(nil))
+var _ = RemoveFS((*dirFS)(nil))
+var _ = GenerationFS((*dirFS)(nil))
 
 // DirFS is a variant of os.DirFS that supports file creation and is a suitable
 // test fake for the GCS FS.
@@ -82,6 +87,54 @@ func (dir dirFS) Create(name string) (WriterFile, error) {
 	return &atomicWriteFile{temp, finalize}, nil
 }
 
+func (dir dirFS) Remove(name string) error {
+	if !fs.ValidPath(name) || runtime.GOOS == "windows" && containsAny(name, `\:`) {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrInvalid}
+	}
+	return os.Remove(string(dir) + "/" + name)
+}
+
+// dirGenerationMu makes the conditional writes of dirFSs atomic. It
+// only excludes the writers in this process, which is enough for a
+// test fake.
+var dirGenerationMu sync.Mutex
+
+// dirGeneration returns the generation of a file in a dirFS with the
+// given contents. Files don't record their generation, so it's derived
+// from their contents: a write of the same contents doesn't change it.
+func dirGeneration(contents []byte) int64 {
+	sum := sha256.Sum256(contents)
+	return int64(binary.BigEndian.Uint64(sum[:])>>1) | 1
+}
+
+func (dir dirFS) ReadFileGeneration(name string) ([]byte, int64, error) {
+	data, err := fs.ReadFile(dir, name)
+	if err != nil {
+		return nil, 0, err
+	}
+	return data, dirGeneration(data), nil
+}
+
+func (dir dirFS) WriteFileIfGeneration(name string, contents []byte, gen int64) error {
+	dirGenerationMu.Lock()
+	defer dirGenerationMu.Unlock()
+	switch old, err := fs.ReadFile(dir, name); {
+	case errors.Is(err, fs.ErrNotExist):
+		if gen != 0 {
+			return &fs.PathError{Op: "write", Path: name, Err: ErrGenerationMismatch}
+		}
+	case err != nil:
+		return err
+	case gen != dirGeneration(old):
+		return &fs.PathError{Op: "write", Path: name, Err: ErrGenerationMismatch}
+	default:
+		if err := dir.Remove(name); err != nil {
+			return err
+		}
+	}
+	return WriteFile(dir, name, contents)
+}
+
 type atomicWriteFile struct {
 	*os.File
 	finalize func() error
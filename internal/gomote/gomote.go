@@ -8,6 +8,9 @@
 package gomote
 
 import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
 	"context"
 	"errors"
 	"fmt"
@@ -15,8 +18,10 @@ import (
 	"io/fs"
 	"log"
 	"net/http"
+	"path"
 	"regexp"
 	"strings"
+	"sync"
 	"time"
 
 	"cloud.google.com/go/storage"
@@ -29,6 +34,7 @@ import (
 	"golang.org/x/build/internal/coordinator/remote"
 	"golang.org/x/build/internal/coordinator/schedule"
 	"golang.org/x/build/internal/envutil"
+	"golang.org/x/build/internal/featureflag"
 	"golang.org/x/build/internal/gomote/protos"
 	"golang.org/x/build/internal/swarmclient"
 	"golang.org/x/build/types"
@@ -41,6 +47,7 @@ type scheduler interface {
 	State() (st schedule.SchedulerState)
 	WaiterState(waiter *queue.SchedItem) (ws types.BuildletWaitStatus)
 	GetBuildlet(ctx context.Context, si *queue.SchedItem) (buildlet.Client, error)
+	GomoteInstanceLimit(user string) int
 }
 
 // bucketHandle interface used to enable testing of the storage.bucketHandle.
@@ -50,6 +57,35 @@ type bucketHandle interface {
 	Object(name string) *storage.ObjectHandle
 }
 
+// attachmentStore stores files shared from gomote instances.
+type attachmentStore interface {
+	// Put stores the contents of r as a publicly readable object
+	// and returns its URL.
+	Put(ctx context.Context, object, contentType string, r io.Reader) (url string, err error)
+}
+
+// gcsAttachmentStore is an attachmentStore in a GCS bucket.
+type gcsAttachmentStore struct {
+	bucket     *storage.BucketHandle
+	bucketName string
+}
+
+func (s *gcsAttachmentStore) Put(ctx context.Context, object, contentType string, r io.Reader) (string, error) {
+	// Cancel the context to stop writing without saving the data if a
+	// problem is encountered, as in ReadTGZToURL.
+	writeCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	w := s.bucket.Object(object).NewWriter(writeCtx)
+	w.ContentType = contentType
+	if _, err := io.Copy(w, r); err != nil {
+		return "", err
+	}
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("https://storage.googleapis.com/%s/%s", s.bucketName, object), nil
+}
+
 // Server is a gomote server implementation.
 type Server struct {
 	// embed the unimplemented server.
@@ -61,8 +97,23 @@ type Server struct {
 	scheduler               scheduler
 	sshCertificateAuthority ssh.Signer
 	luciConfigClient        *swarmclient.ConfigClient
+	featureFlags            *featureflag.Set
+	attachments             attachmentStore
+
+	mu sync.Mutex
+	// pendingInstances is the number of gomote instances each user
+	// is waiting for CreateInstance to create. They count against
+	// the user's limit.
+	pendingInstances map[string]int
 }
 
+// Feature flags evaluated by the gomote server.
+const (
+	// flagCreateInstanceKill, when killed, stops the creation of new
+	// gomote instances, such as during an incident.
+	flagCreateInstanceKill = "gomote-create-instance"
+)
+
 // New creates a gomote server. If the rawCAPriKey is invalid, the program will exit.
 func New(rsp *remote.SessionPool, sched *schedule.Scheduler, rawCAPriKey []byte, gomoteGCSBucket string, storageClient *storage.Client, configClient *swarmclient.ConfigClient) *Server {
 	signer, err := ssh.ParsePrivateKey(rawCAPriKey)
@@ -79,6 +130,20 @@ func New(rsp *remote.SessionPool, sched *schedule.Scheduler, rawCAPriKey []byte,
 	}
 }
 
+// SetFeatureFlags sets the feature flags the server evaluates.
+// It must be called before the server starts serving.
+func (s *Server) SetFeatureFlags(flags *featureflag.Set) {
+	s.featureFlags = flags
+}
+
+// SetAttachmentBucket sets the GCS bucket that files shared with
+// ShareFile are uploaded to. It must be publicly readable, and delete
+// objects after sharedFileRetention. It must be called before the
+// server starts serving.
+func (s *Server) SetAttachmentBucket(storageClient *storage.Client, bucketName string) {
+	s.attachments = &gcsAttachmentStore{bucket: storageClient.Bucket(bucketName), bucketName: bucketName}
+}
+
 // AddBootstrap adds the bootstrap version of Go to an instance and returns the URL for the bootstrap version. If no
 // bootstrap version is defined then the returned version URL will be empty.
 func (s *Server) AddBootstrap(ctx context.Context, req *protos.AddBootstrapRequest) (*protos.AddBootstrapResponse, error) {
@@ -124,6 +189,9 @@ func (s *Server) CreateInstance(req *protos.CreateInstanceRequest, stream protos
 		log.Printf("CreateInstance access.IAPFromContext(ctx) = nil, %s", err)
 		return status.Errorf(codes.Unauthenticated, "request does not contain the required authentication")
 	}
+	if s.featureFlags.Killed(flagCreateInstanceKill) {
+		return status.Errorf(codes.Unavailable, "creating gomote instances is temporarily disabled")
+	}
 	if req.GetBuilderType() == "" {
 		return status.Errorf(codes.InvalidArgument, "invalid builder type")
 	}
@@ -138,6 +206,12 @@ func (s *Server) CreateInstance(req *protos.CreateInstanceRequest, stream protos
 	if err != nil {
 		return status.Errorf(codes.Internal, "invalid user email format")
 	}
+	limit := s.scheduler.GomoteInstanceLimit(userName)
+	release, ok := s.reserveInstance(userName, limit)
+	if !ok {
+		return status.Errorf(codes.ResourceExhausted, "user already has the maximum of %d gomote instances", limit)
+	}
+	defer release()
 	si := &queue.SchedItem{
 		HostType:  bconf.HostType,
 		IsGomote:  true,
@@ -277,7 +351,7 @@ func (s *Server) ListInstances(ctx context.Context, req *protos.ListInstancesReq
 }
 
 // ListSwarmingBuilders lists all of the swarming builders which run for gotip. The requester must be authenticated.
-func (s Server) ListSwarmingBuilders(ctx context.Context, req *protos.ListSwarmingBuildersRequest) (*protos.ListSwarmingBuildersResponse, error) {
+func (s *Server) ListSwarmingBuilders(ctx context.Context, req *protos.ListSwarmingBuildersRequest) (*protos.ListSwarmingBuildersResponse, error) {
 	_, err := access.IAPFromContext(ctx)
 	if err != nil {
 		log.Printf("ListSwarmingInstances access.IAPFromContext(ctx) = nil, %s", err)
@@ -441,6 +515,78 @@ func (s *Server) RemoveFiles(ctx context.Context, req *protos.RemoveFilesRequest
 	return &protos.RemoveFilesResponse{}, nil
 }
 
+// Limits of files shared with ShareFile.
+const (
+	// maxSharedFileSize is the size in bytes of the largest file that
+	// can be shared.
+	maxSharedFileSize = 25 << 20
+	// sharedFileRetention is how long shared files are kept before the
+	// attachment bucket's lifecycle rule deletes them.
+	sharedFileRetention = 30 * 24 * time.Hour
+)
+
+// ShareFile retrieves a file from the gomote instance and uploads it to a public bucket, where it's deleted after
+// sharedFileRetention. It returns the file's public URL, which is intended to be linked to from an issue.
+func (s *Server) ShareFile(ctx context.Context, req *protos.ShareFileRequest) (*protos.ShareFileResponse, error) {
+	creds, err := access.IAPFromContext(ctx)
+	if err != nil {
+		log.Printf("ShareFile access.IAPFromContext(ctx) = nil, %s", err)
+		return nil, status.Errorf(codes.Unauthenticated, "request does not contain the required authentication")
+	}
+	if s.attachments == nil {
+		return nil, status.Errorf(codes.Unimplemented, "sharing files is not configured")
+	}
+	if req.GetPath() == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "missing file path")
+	}
+	_, bc, err := s.sessionAndClient(ctx, req.GetGomoteId(), creds.ID)
+	if err != nil {
+		// the helper function returns meaningful GRPC error.
+		return nil, err
+	}
+	tgz, err := bc.GetTar(ctx, req.GetPath())
+	if err != nil {
+		return nil, status.Errorf(codes.Aborted, "unable to retrieve file from gomote instance: %s", err)
+	}
+	defer tgz.Close()
+	zr, err := gzip.NewReader(tgz)
+	if err != nil {
+		return nil, status.Errorf(codes.Aborted, "unable to read file from gomote instance: %s", err)
+	}
+	tr := tar.NewReader(zr)
+	// When the path is a regular file, the buildlet sends a tarball
+	// of just that file, with no name.
+	hdr, err := tr.Next()
+	if err == io.EOF || err == nil && (hdr.Name != "" || hdr.Typeflag != tar.TypeReg) {
+		return nil, status.Errorf(codes.InvalidArgument, "%s is not a regular file", req.GetPath())
+	} else if err != nil {
+		return nil, status.Errorf(codes.Aborted, "unable to read file from gomote instance: %s", err)
+	}
+	if hdr.Size > maxSharedFileSize {
+		return nil, status.Errorf(codes.InvalidArgument, "%s is %d bytes, larger than the limit of %d bytes", req.GetPath(), hdr.Size, maxSharedFileSize)
+	}
+	// Serve text, including HTML, as plain text, so that logs display
+	// in the browser and nothing shared is rendered as a page.
+	br := bufio.NewReader(tr)
+	sniff, _ := br.Peek(512)
+	contentType := http.DetectContentType(sniff)
+	if strings.HasPrefix(contentType, "text/") {
+		contentType = "text/plain; charset=utf-8"
+	}
+	// Keep the file's name, on any OS, so that it's shown in the URL.
+	objectName := uuid.NewString() + "/" + path.Base(strings.ReplaceAll(req.GetPath(), `\`, "/"))
+	url, err := s.attachments.Put(ctx, objectName, contentType, br)
+	if err != nil {
+		log.Printf("ShareFile: storing %s: %s", objectName, err)
+		return nil, status.Errorf(codes.Aborted, "unable to store file")
+	}
+	return &protos.ShareFileResponse{
+		Url:     url,
+		Size:    hdr.Size,
+		Expires: time.Now().Add(sharedFileRetention).Unix(),
+	}, nil
+}
+
 // SignSSHKey signs the public SSH key with a certificate. The signed public SSH key is intended for use with the gomote service SSH
 // server. It will be signed by the certificate authority of the server and will restrict access to the gomote instance that it was
 // signed for.
@@ -463,6 +609,42 @@ func (s *Server) SignSSHKey(ctx context.Context, req *protos.SignSSHKeyRequest)
 	}, nil
 }
 
+// TailFile streams the contents of a file on the gomote instance as they're appended to it, like tail -f, until the caller
+// cancels the call. The file is followed by name, so a rotated file is followed to its replacement.
+func (s *Server) TailFile(req *protos.TailFileRequest, stream protos.GomoteService_TailFileServer) error {
+	creds, err := access.IAPFromContext(stream.Context())
+	if err != nil {
+		return status.Errorf(codes.Unauthenticated, "request does not contain the required authentication")
+	}
+	if req.GetPath() == "" {
+		return status.Errorf(codes.InvalidArgument, "missing file path")
+	}
+	_, bc, err := s.sessionAndClient(stream.Context(), req.GetGomoteId(), creds.ID)
+	if err != nil {
+		// the helper function returns meaningful GRPC error.
+		return err
+	}
+	var sendErr error
+	err = bc.Tail(stream.Context(), req.GetPath(), buildlet.TailOpts{Offset: req.GetOffset()}, func(ev buildlet.TailEvent) error {
+		sendErr = stream.Send(&protos.TailFileResponse{
+			Rotated: ev.Rotated,
+			Data:    ev.Data,
+			Offset:  ev.Offset,
+		})
+		return sendErr
+	})
+	switch {
+	case sendErr != nil:
+		return fmt.Errorf("unable to send data=%w", sendErr)
+	case stream.Context().Err() != nil:
+		// The caller stopped following the file.
+		return nil
+	case err != nil:
+		return status.Errorf(codes.Aborted, "unable to follow file: %s", err)
+	}
+	return nil
+}
+
 // UploadFile creates a URL and a set of HTTP post fields which are used to upload a file to a staging GCS bucket. Uploaded files are made available to the
 // gomote instances via a subsequent call to one of the WriteFromURL endpoints.
 func (s *Server) UploadFile(ctx context.Context, req *protos.UploadFileRequest) (*protos.UploadFileResponse, error) {
@@ -626,6 +808,40 @@ func (s *Server) sessionAndClient(ctx context.Context, gomoteID, ownerID string)
 	return session, bc, nil
 }
 
+// reserveInstance reserves one of the user's limit of gomote instances
+// while CreateInstance creates it, so that concurrent calls can't
+// exceed the limit. A limit of 0 or less means no limit. release must
+// be called once the instance is created, or creating it fails.
+func (s *Server) reserveInstance(user string, limit int) (release func(), ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if limit > 0 && s.userInstances(user)+s.pendingInstances[user] >= limit {
+		return nil, false
+	}
+	if s.pendingInstances == nil {
+		s.pendingInstances = make(map[string]int)
+	}
+	s.pendingInstances[user]++
+	return func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.pendingInstances[user]--; s.pendingInstances[user] == 0 {
+			delete(s.pendingInstances, user)
+		}
+	}, true
+}
+
+// userInstances returns the number of gomote instances user has.
+func (s *Server) userInstances(user string) int {
+	var n int
+	for _, session := range s.buildlets.List() {
+		if session.Username == user {
+			n++
+		}
+	}
+	return n
+}
+
 // isPrivilegedUser returns true if the user is trusted to use sensitive machines.
 // The user has to be a part of the appropriate IAM group.
 func isPrivilegedUser(email string) bool {
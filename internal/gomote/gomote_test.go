@@ -15,11 +15,13 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
 	"cloud.google.com/go/storage"
 	"github.com/google/go-cmp/cmp"
+	"golang.org/x/build/buildlet"
 	"golang.org/x/build/internal/access"
 	"golang.org/x/build/internal/coordinator/remote"
 	"golang.org/x/build/internal/coordinator/schedule"
@@ -35,7 +37,7 @@ import (
 
 const testBucketName = "unit-testing-bucket"
 
-func fakeGomoteServer(t *testing.T, ctx context.Context, configClient *swarmclient.ConfigClient) protos.GomoteServiceServer {
+func fakeGomoteServer(t *testing.T, ctx context.Context, configClient *swarmclient.ConfigClient, sched scheduler) protos.GomoteServiceServer {
 	signer, err := ssh.ParsePrivateKey([]byte(devCertCAPrivate))
 	if err != nil {
 		t.Fatalf("unable to parse raw certificate authority private key into signer=%s", err)
@@ -44,13 +46,18 @@ func fakeGomoteServer(t *testing.T, ctx context.Context, configClient *swarmclie
 		bucket:                  &fakeBucketHandler{bucketName: testBucketName},
 		buildlets:               remote.NewSessionPool(ctx),
 		gceBucketName:           testBucketName,
-		scheduler:               schedule.NewFake(),
+		scheduler:               sched,
 		sshCertificateAuthority: signer,
 		luciConfigClient:        configClient,
+		attachments:             &fakeAttachmentStore{bucketName: testBucketName},
 	}
 }
 
 func setupGomoteTest(t *testing.T, ctx context.Context) protos.GomoteServiceClient {
+	return setupGomoteTestWithScheduler(t, ctx, schedule.NewFake())
+}
+
+func setupGomoteTestWithScheduler(t *testing.T, ctx context.Context, sched scheduler) protos.GomoteServiceClient {
 	contents, err := os.ReadFile("../swarmclient/testdata/bb-sample.cfg")
 	if err != nil {
 		t.Fatalf("unable to read test buildbucket config: %s", err)
@@ -64,7 +71,7 @@ func setupGomoteTest(t *testing.T, ctx context.Context) protos.GomoteServiceClie
 	}
 	sopts := access.FakeIAPAuthInterceptorOptions()
 	s := grpc.NewServer(sopts...)
-	protos.RegisterGomoteServiceServer(s, fakeGomoteServer(t, ctx, configClient))
+	protos.RegisterGomoteServiceServer(s, fakeGomoteServer(t, ctx, configClient, sched))
 	go s.Serve(lis)
 
 	// create GRPC client
@@ -250,6 +257,44 @@ func TestCreateInstanceError(t *testing.T) {
 	}
 }
 
+func TestCreateInstanceLimit(t *testing.T) {
+	sched := schedule.NewFake()
+	sched.GomoteLimit = 1
+	client := setupGomoteTestWithScheduler(t, context.Background(), sched)
+	mustCreateInstance(t, client, fakeIAP())
+
+	ctx := access.FakeContextWithOutgoingIAPAuth(context.Background(), fakeIAP())
+	req := &protos.CreateInstanceRequest{BuilderType: "linux-amd64"}
+	stream, err := client.CreateInstance(ctx, req)
+	if err != nil {
+		t.Fatalf("client.CreateInstance(ctx, %v) = %v,  %s; want no error", req, stream, err)
+	}
+	if _, err := stream.Recv(); status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("stream.Recv() = %v; want %s", err, codes.ResourceExhausted)
+	}
+}
+
+func TestReserveInstance(t *testing.T) {
+	s := &Server{buildlets: remote.NewSessionPool(context.Background())}
+	release, ok := s.reserveInstance("alice", 2)
+	if !ok {
+		t.Fatal("reserveInstance(alice, 2) failed with no instances")
+	}
+	if _, ok := s.reserveInstance("alice", 2); !ok {
+		t.Fatal("reserveInstance(alice, 2) failed with one pending instance")
+	}
+	if _, ok := s.reserveInstance("alice", 2); ok {
+		t.Fatal("reserveInstance(alice, 2) succeeded with two pending instances")
+	}
+	if _, ok := s.reserveInstance("bob", 2); !ok {
+		t.Fatal("reserveInstance(bob, 2) failed with another user's pending instances")
+	}
+	release()
+	if _, ok := s.reserveInstance("alice", 2); !ok {
+		t.Fatal("reserveInstance(alice, 2) failed after a pending instance was released")
+	}
+}
+
 func TestInstanceAlive(t *testing.T) {
 	client := setupGomoteTest(t, context.Background())
 	gomoteID := mustCreateInstance(t, client, fakeIAP())
@@ -768,6 +813,89 @@ func TestRemoveFilesError(t *testing.T) {
 	}
 }
 
+func TestShareFile(t *testing.T) {
+	ctx := access.FakeContextWithOutgoingIAPAuth(context.Background(), fakeIAP())
+	client := setupGomoteTest(t, context.Background())
+	gomoteID := mustCreateInstance(t, client, fakeIAP())
+	res, err := client.ShareFile(ctx, &protos.ShareFileRequest{
+		GomoteId: gomoteID,
+		Path:     `go\src\out.log`,
+	})
+	if err != nil {
+		t.Fatalf("client.ShareFile(ctx, req) = response, %s; want no error", err)
+	}
+	if want := fmt.Sprintf("https://localhost/%s/", testBucketName); !strings.HasPrefix(res.GetUrl(), want) || !strings.HasSuffix(res.GetUrl(), "/out.log") {
+		t.Errorf("ShareFile URL = %q; want %s<uuid>/out.log", res.GetUrl(), want)
+	}
+	if want := int64(len(buildlet.FakeTarContents)); res.GetSize() != want {
+		t.Errorf("ShareFile size = %d; want %d", res.GetSize(), want)
+	}
+	if expires := time.Unix(res.GetExpires(), 0); expires.Before(time.Now().Add(sharedFileRetention - time.Hour)) {
+		t.Errorf("ShareFile expires = %v; want about %v from now", expires, sharedFileRetention)
+	}
+}
+
+func TestShareFileError(t *testing.T) {
+	// This test will create a gomote instance and attempt to call ShareFile.
+	// If overrideID is set to true, the test will use a different gomoteID than
+	// the one created for the test.
+	testCases := []struct {
+		desc       string
+		ctx        context.Context
+		overrideID bool
+		gomoteID   string // Used iff overrideID is true.
+		path       string
+		wantCode   codes.Code
+	}{
+		{
+			desc:     "unauthenticated request",
+			ctx:      context.Background(),
+			path:     "out.log",
+			wantCode: codes.Unauthenticated,
+		},
+		{
+			desc:     "missing path",
+			ctx:      access.FakeContextWithOutgoingIAPAuth(context.Background(), fakeIAP()),
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			desc:       "gomote does not exist",
+			ctx:        access.FakeContextWithOutgoingIAPAuth(context.Background(), fakeIAPWithUser("foo", "bar")),
+			overrideID: true,
+			gomoteID:   "chucky",
+			path:       "out.log",
+			wantCode:   codes.NotFound,
+		},
+		{
+			desc:       "wrong gomote id",
+			ctx:        access.FakeContextWithOutgoingIAPAuth(context.Background(), fakeIAPWithUser("foo", "bar")),
+			overrideID: false,
+			path:       "out.log",
+			wantCode:   codes.PermissionDenied,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			client := setupGomoteTest(t, context.Background())
+			gomoteID := mustCreateInstance(t, client, fakeIAP())
+			if tc.overrideID {
+				gomoteID = tc.gomoteID
+			}
+			req := &protos.ShareFileRequest{
+				GomoteId: gomoteID,
+				Path:     tc.path,
+			}
+			got, err := client.ShareFile(tc.ctx, req)
+			if err != nil && status.Code(err) != tc.wantCode {
+				t.Fatalf("unexpected error: %s; want %s", err, tc.wantCode)
+			}
+			if err == nil {
+				t.Fatalf("client.ShareFile(ctx, %v) = %v, nil; want error", req, got)
+			}
+		})
+	}
+}
+
 func TestSignSSHKey(t *testing.T) {
 	ctx := access.FakeContextWithOutgoingIAPAuth(context.Background(), fakeIAP())
 	client := setupGomoteTest(t, context.Background())
@@ -847,6 +975,96 @@ func TestSignSSHKeyError(t *testing.T) {
 	}
 }
 
+func TestTailFile(t *testing.T) {
+	ctx := access.FakeContextWithOutgoingIAPAuth(context.Background(), fakeIAP())
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	client := setupGomoteTest(t, context.Background())
+	gomoteID := mustCreateInstance(t, client, fakeIAP())
+	stream, err := client.TailFile(ctx, &protos.TailFileRequest{
+		GomoteId: gomoteID,
+		Path:     "go/src/test.log",
+		Offset:   -6,
+	})
+	if err != nil {
+		t.Fatalf("client.TailFile(ctx, req) = response, %s; want no error", err)
+	}
+	res, err := stream.Recv()
+	if err != nil {
+		t.Fatalf("stream.Recv() = _, %s; want no error", err)
+	}
+	if want := buildlet.FakeTarContents[len(buildlet.FakeTarContents)-6:]; string(res.GetData()) != want {
+		t.Errorf("TailFile data = %q; want %q", res.GetData(), want)
+	}
+	if want := int64(len(buildlet.FakeTarContents) - 6); res.GetOffset() != want {
+		t.Errorf("TailFile offset = %d; want %d", res.GetOffset(), want)
+	}
+}
+
+func TestTailFileError(t *testing.T) {
+	// This test will create a gomote instance and attempt to call TailFile.
+	// If overrideID is set to true, the test will use a different gomoteID than
+	// the one created for the test.
+	testCases := []struct {
+		desc       string
+		ctx        context.Context
+		overrideID bool
+		gomoteID   string // Used iff overrideID is true.
+		path       string
+		wantCode   codes.Code
+	}{
+		{
+			desc:     "unauthenticated request",
+			ctx:      context.Background(),
+			path:     "test.log",
+			wantCode: codes.Unauthenticated,
+		},
+		{
+			desc:     "missing path",
+			ctx:      access.FakeContextWithOutgoingIAPAuth(context.Background(), fakeIAP()),
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			desc:       "gomote does not exist",
+			ctx:        access.FakeContextWithOutgoingIAPAuth(context.Background(), fakeIAPWithUser("foo", "bar")),
+			overrideID: true,
+			gomoteID:   "chucky",
+			path:       "test.log",
+			wantCode:   codes.NotFound,
+		},
+		{
+			desc:       "wrong gomote id",
+			ctx:        access.FakeContextWithOutgoingIAPAuth(context.Background(), fakeIAPWithUser("foo", "bar")),
+			overrideID: false,
+			path:       "test.log",
+			wantCode:   codes.PermissionDenied,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			client := setupGomoteTest(t, context.Background())
+			gomoteID := mustCreateInstance(t, client, fakeIAP())
+			if tc.overrideID {
+				gomoteID = tc.gomoteID
+			}
+			stream, err := client.TailFile(tc.ctx, &protos.TailFileRequest{
+				GomoteId: gomoteID,
+				Path:     tc.path,
+			})
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			res, err := stream.Recv()
+			if err != nil && status.Code(err) != tc.wantCode {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if err == nil {
+				t.Fatalf("client.TailFile(ctx, req) = %v, nil; want error", res)
+			}
+		})
+	}
+}
+
 func TestUploadFile(t *testing.T) {
 	ctx := access.FakeContextWithOutgoingIAPAuth(context.Background(), fakeIAP())
 	client := setupGomoteTest(t, context.Background())
@@ -1231,3 +1449,16 @@ func (fbc *fakeBucketHandler) SignedURL(object string, opts *storage.SignedURLOp
 func (fbc *fakeBucketHandler) Object(name string) *storage.ObjectHandle {
 	return &storage.ObjectHandle{}
 }
+
+type fakeAttachmentStore struct{ bucketName string }
+
+func (fas *fakeAttachmentStore) Put(ctx context.Context, object, contentType string, r io.Reader) (string, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+	if string(b) != buildlet.FakeTarContents || contentType != "text/plain; charset=utf-8" {
+		return "", fmt.Errorf("stored %q as %q; want %q as text", b, contentType, buildlet.FakeTarContents)
+	}
+	return fmt.Sprintf("https://localhost/%s/%s", fas.bucketName, object), nil
+}
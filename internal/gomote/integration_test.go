@@ -0,0 +1,302 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build linux || darwin
+// +build linux darwin
+
+package gomote
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/build/internal/access"
+	"golang.org/x/build/internal/buildlettest"
+	"golang.org/x/build/internal/coordinator/remote"
+	"golang.org/x/build/internal/coordinator/schedule"
+	"golang.org/x/build/internal/gomote/protos"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/net/nettest"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// setupIntegrationTest wires a gomote server to the real coordinator
+// scheduler, backed by a pool of in-process buildlets.
+func setupIntegrationTest(t *testing.T, p *buildlettest.Pool) protos.GomoteServiceClient {
+	p.Install()
+	signer, err := ssh.ParsePrivateKey([]byte(devCertCAPrivate))
+	if err != nil {
+		t.Fatalf("unable to parse raw certificate authority private key into signer=%s", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	srv := &Server{
+		bucket:                  &fakeBucketHandler{bucketName: testBucketName},
+		buildlets:               remote.NewSessionPool(ctx),
+		gceBucketName:           testBucketName,
+		scheduler:               schedule.NewScheduler(),
+		sshCertificateAuthority: signer,
+	}
+	lis, err := nettest.NewLocalListener("tcp")
+	if err != nil {
+		t.Fatalf("unable to create net listener: %s", err)
+	}
+	s := grpc.NewServer(access.FakeIAPAuthInterceptorOptions()...)
+	protos.RegisterGomoteServiceServer(s, srv)
+	go s.Serve(lis)
+	conn, err := grpc.Dial(lis.Addr().String(), grpc.WithInsecure(), grpc.WithBlock(), grpc.WithTimeout(5*time.Second))
+	if err != nil {
+		lis.Close()
+		t.Fatalf("unable to create GRPC client: %s", err)
+	}
+	t.Cleanup(func() {
+		conn.Close()
+		s.Stop()
+		lis.Close()
+	})
+	return protos.NewGomoteServiceClient(conn)
+}
+
+// executeCommand runs a command on a gomote instance and returns its output.
+func executeCommand(ctx context.Context, client protos.GomoteServiceClient, req *protos.ExecuteCommandRequest) ([]byte, error) {
+	stream, err := client.ExecuteCommand(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	var out []byte
+	for {
+		res, err := stream.Recv()
+		if err == io.EOF {
+			return out, nil
+		}
+		if err != nil {
+			return out, err
+		}
+		out = append(out, res.GetOutput()...)
+	}
+}
+
+// waitFor polls cond until it reports true or the timeout expires.
+func waitFor(t *testing.T, timeout time.Duration, cond func() bool) bool {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if cond() {
+			return true
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return cond()
+}
+
+func TestIntegrationExecuteCommand(t *testing.T) {
+	p := buildlettest.NewPool(t)
+	client := setupIntegrationTest(t, p)
+	ctx := access.FakeContextWithOutgoingIAPAuth(context.Background(), fakeIAP())
+	gomoteID := mustCreateInstance(t, client, fakeIAP())
+
+	const content = "the gopher goes to the sea\n"
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, content)
+	}))
+	defer ts.Close()
+	if _, err := client.WriteFileFromURL(ctx, &protos.WriteFileFromURLRequest{
+		GomoteId: gomoteID,
+		Url:      ts.URL,
+		Filename: "dir/sea.txt",
+		Mode:     0644,
+	}); err != nil {
+		t.Fatalf("client.WriteFileFromURL(ctx, req) = response, %s; want no error", err)
+	}
+	out, err := executeCommand(ctx, client, &protos.ExecuteCommandRequest{
+		GomoteId:    gomoteID,
+		Command:     "cat",
+		SystemLevel: true,
+		Args:        []string{"dir/sea.txt"},
+	})
+	if err != nil {
+		t.Fatalf("executeCommand(cat) = %q, %s; want no error", out, err)
+	}
+	if string(out) != content {
+		t.Errorf("executeCommand(cat) = %q; want %q", out, content)
+	}
+
+	_, err = executeCommand(ctx, client, &protos.ExecuteCommandRequest{
+		GomoteId:    gomoteID,
+		Command:     "false",
+		SystemLevel: true,
+	})
+	if status.Code(err) != codes.Unknown {
+		t.Errorf("executeCommand(false) = _, %v; want code %s", err, codes.Unknown)
+	}
+}
+
+func TestIntegrationTGZTransfer(t *testing.T) {
+	p := buildlettest.NewPool(t)
+	client := setupIntegrationTest(t, p)
+	ctx := access.FakeContextWithOutgoingIAPAuth(context.Background(), fakeIAP())
+	gomoteID := mustCreateInstance(t, client, fakeIAP())
+
+	tgz := mustTGZ(t, map[string]string{
+		"src/a.go":     "package a\n",
+		"src/b/b.go":   "package b\n",
+		"README":       "hello\n",
+		"src/b/c.data": "some data",
+	})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(tgz)
+	}))
+	defer ts.Close()
+	if _, err := client.WriteTGZFromURL(ctx, &protos.WriteTGZFromURLRequest{
+		GomoteId:  gomoteID,
+		Directory: "go",
+		Url:       ts.URL,
+	}); err != nil {
+		t.Fatalf("client.WriteTGZFromURL(ctx, req) = response, %s; want no error", err)
+	}
+	res, err := client.ListDirectory(ctx, &protos.ListDirectoryRequest{
+		GomoteId:  gomoteID,
+		Directory: "go",
+		Recursive: true,
+		SkipFiles: []string{"src/b"},
+	})
+	if err != nil {
+		t.Fatalf("client.ListDirectory(ctx, req) = response, %s; want no error", err)
+	}
+	var names []string
+	for _, e := range res.GetEntries() {
+		names = append(names, strings.Split(e, "\t")[1])
+	}
+	if got, want := strings.Join(names, " "), "README src/ src/a.go"; got != want {
+		t.Errorf("ListDirectory entries = %q; want %q", got, want)
+	}
+
+	if _, err := client.RemoveFiles(ctx, &protos.RemoveFilesRequest{
+		GomoteId: gomoteID,
+		Paths:    []string{"go/src"},
+	}); err != nil {
+		t.Fatalf("client.RemoveFiles(ctx, req) = response, %s; want no error", err)
+	}
+	wd := p.Servers()[0].WorkDir
+	if _, err := os.Stat(filepath.Join(wd, "go", "src")); !os.IsNotExist(err) {
+		t.Errorf("os.Stat(go/src) = %v; want not exist", err)
+	}
+	if _, err := os.Stat(filepath.Join(wd, "go", "README")); err != nil {
+		t.Errorf("os.Stat(go/README) = %v; want no error", err)
+	}
+}
+
+func TestIntegrationCreateInstanceTimeout(t *testing.T) {
+	p := buildlettest.NewPool(t)
+	p.Delay = time.Minute
+	client := setupIntegrationTest(t, p)
+	ctx, cancel := context.WithTimeout(access.FakeContextWithOutgoingIAPAuth(context.Background(), fakeIAP()), 500*time.Millisecond)
+	defer cancel()
+	stream, err := client.CreateInstance(ctx, &protos.CreateInstanceRequest{BuilderType: "linux-amd64"})
+	if err != nil {
+		t.Fatalf("client.CreateInstance(ctx, req) = _, %s; want no error", err)
+	}
+	for {
+		_, err = stream.Recv()
+		if err != nil {
+			break
+		}
+	}
+	if code := status.Code(err); code != codes.DeadlineExceeded {
+		t.Errorf("stream.Recv() = _, %v; want code %s", err, codes.DeadlineExceeded)
+	}
+	if n := len(p.Servers()); n != 0 {
+		t.Errorf("pool created %d buildlets after the request timed out; want 0", n)
+	}
+}
+
+func TestIntegrationExecuteCommandCancel(t *testing.T) {
+	p := buildlettest.NewPool(t)
+	client := setupIntegrationTest(t, p)
+	gomoteID := mustCreateInstance(t, client, fakeIAP())
+	bl := p.Servers()[0]
+
+	ctx, cancel := context.WithCancel(access.FakeContextWithOutgoingIAPAuth(context.Background(), fakeIAP()))
+	errc := make(chan error, 1)
+	go func() {
+		_, err := executeCommand(ctx, client, &protos.ExecuteCommandRequest{
+			GomoteId:    gomoteID,
+			Command:     "sleep",
+			SystemLevel: true,
+			Args:        []string{"60"},
+		})
+		errc <- err
+	}()
+	if !waitFor(t, 10*time.Second, func() bool { return bl.Running() == 1 }) {
+		t.Fatalf("command never started on the buildlet")
+	}
+	cancel()
+	if err := <-errc; status.Code(err) != codes.Canceled {
+		t.Errorf("executeCommand(sleep) = _, %v; want code %s", err, codes.Canceled)
+	}
+	if !waitFor(t, 10*time.Second, func() bool { return bl.Running() == 0 }) {
+		t.Errorf("command still running on the buildlet after the caller canceled")
+	}
+}
+
+func TestIntegrationDestroyInstance(t *testing.T) {
+	p := buildlettest.NewPool(t)
+	client := setupIntegrationTest(t, p)
+	ctx := access.FakeContextWithOutgoingIAPAuth(context.Background(), fakeIAP())
+	gomoteID := mustCreateInstance(t, client, fakeIAP())
+	if _, err := client.DestroyInstance(ctx, &protos.DestroyInstanceRequest{GomoteId: gomoteID}); err != nil {
+		t.Fatalf("client.DestroyInstance(ctx, req) = response, %s; want no error", err)
+	}
+	if bl := p.Servers()[0]; !waitFor(t, 10*time.Second, bl.Halted) {
+		t.Errorf("buildlet was not halted after the gomote instance was destroyed")
+	}
+	_, err := executeCommand(ctx, client, &protos.ExecuteCommandRequest{
+		GomoteId:    gomoteID,
+		Command:     "true",
+		SystemLevel: true,
+	})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("executeCommand after destroy = _, %v; want code %s", err, codes.NotFound)
+	}
+}
+
+// mustTGZ returns a gzip-compressed tar archive of the provided files.
+func mustTGZ(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(zw)
+	for name, content := range files {
+		if err := tw.WriteHeader(&tar.Header{
+			Name:     name,
+			Mode:     0644,
+			Size:     int64(len(content)),
+			Typeflag: tar.TypeReg,
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.WriteString(tw, content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
@@ -1321,6 +1321,132 @@ func (*RemoveFilesResponse) Descriptor() ([]byte, []int) {
 	return file_gomote_proto_rawDescGZIP(), []int{22}
 }
 
+// ShareFileRequest specifies the data needed to share a file from a gomote instance.
+type ShareFileRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// The unique identifier for a gomote instance.
+	GomoteId string `protobuf:"bytes,1,opt,name=gomote_id,json=gomoteId,proto3" json:"gomote_id,omitempty"`
+	// The path of the file to share, relative to the work directory.
+	Path string `protobuf:"bytes,2,opt,name=path,proto3" json:"path,omitempty"`
+}
+
+func (x *ShareFileRequest) Reset() {
+	*x = ShareFileRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_gomote_proto_msgTypes[23]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ShareFileRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ShareFileRequest) ProtoMessage() {}
+
+func (x *ShareFileRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_gomote_proto_msgTypes[23]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ShareFileRequest.ProtoReflect.Descriptor instead.
+func (*ShareFileRequest) Descriptor() ([]byte, []int) {
+	return file_gomote_proto_rawDescGZIP(), []int{23}
+}
+
+func (x *ShareFileRequest) GetGomoteId() string {
+	if x != nil {
+		return x.GomoteId
+	}
+	return ""
+}
+
+func (x *ShareFileRequest) GetPath() string {
+	if x != nil {
+		return x.Path
+	}
+	return ""
+}
+
+// ShareFileResponse contains the public URL of a file shared from a gomote instance.
+type ShareFileResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// Public URL to retrieve the file from.
+	Url string `protobuf:"bytes,1,opt,name=url,proto3" json:"url,omitempty"`
+	// The size of the file in bytes.
+	Size int64 `protobuf:"varint,2,opt,name=size,proto3" json:"size,omitempty"`
+	// The timestamp for when the shared file will be deleted. It is
+	// represented in Unix epoch time format.
+	Expires int64 `protobuf:"varint,3,opt,name=expires,proto3" json:"expires,omitempty"`
+}
+
+func (x *ShareFileResponse) Reset() {
+	*x = ShareFileResponse{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_gomote_proto_msgTypes[24]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ShareFileResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ShareFileResponse) ProtoMessage() {}
+
+func (x *ShareFileResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_gomote_proto_msgTypes[24]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ShareFileResponse.ProtoReflect.Descriptor instead.
+func (*ShareFileResponse) Descriptor() ([]byte, []int) {
+	return file_gomote_proto_rawDescGZIP(), []int{24}
+}
+
+func (x *ShareFileResponse) GetUrl() string {
+	if x != nil {
+		return x.Url
+	}
+	return ""
+}
+
+func (x *ShareFileResponse) GetSize() int64 {
+	if x != nil {
+		return x.Size
+	}
+	return 0
+}
+
+func (x *ShareFileResponse) GetExpires() int64 {
+	if x != nil {
+		return x.Expires
+	}
+	return 0
+}
+
 // SignSSHKeyRequest specifies the data needed to sign a public SSH key which attaches a certificate to the key.
 type SignSSHKeyRequest struct {
 	state         protoimpl.MessageState
@@ -1336,7 +1462,7 @@ type SignSSHKeyRequest struct {
 func (x *SignSSHKeyRequest) Reset() {
 	*x = SignSSHKeyRequest{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_gomote_proto_msgTypes[23]
+		mi := &file_gomote_proto_msgTypes[25]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -1349,7 +1475,7 @@ func (x *SignSSHKeyRequest) String() string {
 func (*SignSSHKeyRequest) ProtoMessage() {}
 
 func (x *SignSSHKeyRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_gomote_proto_msgTypes[23]
+	mi := &file_gomote_proto_msgTypes[25]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -1362,7 +1488,7 @@ func (x *SignSSHKeyRequest) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use SignSSHKeyRequest.ProtoReflect.Descriptor instead.
 func (*SignSSHKeyRequest) Descriptor() ([]byte, []int) {
-	return file_gomote_proto_rawDescGZIP(), []int{23}
+	return file_gomote_proto_rawDescGZIP(), []int{25}
 }
 
 func (x *SignSSHKeyRequest) GetGomoteId() string {
@@ -1393,7 +1519,7 @@ type SignSSHKeyResponse struct {
 func (x *SignSSHKeyResponse) Reset() {
 	*x = SignSSHKeyResponse{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_gomote_proto_msgTypes[24]
+		mi := &file_gomote_proto_msgTypes[26]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -1406,7 +1532,7 @@ func (x *SignSSHKeyResponse) String() string {
 func (*SignSSHKeyResponse) ProtoMessage() {}
 
 func (x *SignSSHKeyResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_gomote_proto_msgTypes[24]
+	mi := &file_gomote_proto_msgTypes[26]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -1419,7 +1545,7 @@ func (x *SignSSHKeyResponse) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use SignSSHKeyResponse.ProtoReflect.Descriptor instead.
 func (*SignSSHKeyResponse) Descriptor() ([]byte, []int) {
-	return file_gomote_proto_rawDescGZIP(), []int{24}
+	return file_gomote_proto_rawDescGZIP(), []int{26}
 }
 
 func (x *SignSSHKeyResponse) GetSignedPublicSshKey() []byte {
@@ -1429,6 +1555,141 @@ func (x *SignSSHKeyResponse) GetSignedPublicSshKey() []byte {
 	return nil
 }
 
+// TailFileRequest specifies the data needed to follow a file on a gomote instance.
+type TailFileRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// The unique identifier for a gomote instance.
+	GomoteId string `protobuf:"bytes,1,opt,name=gomote_id,json=gomoteId,proto3" json:"gomote_id,omitempty"`
+	// The path of the file to follow, relative to the work directory.
+	Path string `protobuf:"bytes,2,opt,name=path,proto3" json:"path,omitempty"`
+	// The offset in the file to start following it at. If negative, it counts back from the end of the file.
+	Offset int64 `protobuf:"varint,3,opt,name=offset,proto3" json:"offset,omitempty"`
+}
+
+func (x *TailFileRequest) Reset() {
+	*x = TailFileRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_gomote_proto_msgTypes[27]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *TailFileRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TailFileRequest) ProtoMessage() {}
+
+func (x *TailFileRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_gomote_proto_msgTypes[27]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TailFileRequest.ProtoReflect.Descriptor instead.
+func (*TailFileRequest) Descriptor() ([]byte, []int) {
+	return file_gomote_proto_rawDescGZIP(), []int{27}
+}
+
+func (x *TailFileRequest) GetGomoteId() string {
+	if x != nil {
+		return x.GomoteId
+	}
+	return ""
+}
+
+func (x *TailFileRequest) GetPath() string {
+	if x != nil {
+		return x.Path
+	}
+	return ""
+}
+
+func (x *TailFileRequest) GetOffset() int64 {
+	if x != nil {
+		return x.Offset
+	}
+	return 0
+}
+
+// TailFileResponse contains a change in a file followed on a gomote instance.
+type TailFileResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// Rotated reports that the file was replaced or truncated. The responses that follow are of the new contents, from
+	// their start.
+	Rotated bool `protobuf:"varint,1,opt,name=rotated,proto3" json:"rotated,omitempty"`
+	// Content appended to the file.
+	Data []byte `protobuf:"bytes,2,opt,name=data,proto3" json:"data,omitempty"`
+	// The offset of data in the file.
+	Offset int64 `protobuf:"varint,3,opt,name=offset,proto3" json:"offset,omitempty"`
+}
+
+func (x *TailFileResponse) Reset() {
+	*x = TailFileResponse{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_gomote_proto_msgTypes[28]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *TailFileResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TailFileResponse) ProtoMessage() {}
+
+func (x *TailFileResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_gomote_proto_msgTypes[28]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TailFileResponse.ProtoReflect.Descriptor instead.
+func (*TailFileResponse) Descriptor() ([]byte, []int) {
+	return file_gomote_proto_rawDescGZIP(), []int{28}
+}
+
+func (x *TailFileResponse) GetRotated() bool {
+	if x != nil {
+		return x.Rotated
+	}
+	return false
+}
+
+func (x *TailFileResponse) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+func (x *TailFileResponse) GetOffset() int64 {
+	if x != nil {
+		return x.Offset
+	}
+	return 0
+}
+
 // UploadFileRequest specifies the data needed to create a request to upload an object to GCS.
 type UploadFileRequest struct {
 	state         protoimpl.MessageState
@@ -1439,7 +1700,7 @@ type UploadFileRequest struct {
 func (x *UploadFileRequest) Reset() {
 	*x = UploadFileRequest{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_gomote_proto_msgTypes[25]
+		mi := &file_gomote_proto_msgTypes[29]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -1452,7 +1713,7 @@ func (x *UploadFileRequest) String() string {
 func (*UploadFileRequest) ProtoMessage() {}
 
 func (x *UploadFileRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_gomote_proto_msgTypes[25]
+	mi := &file_gomote_proto_msgTypes[29]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -1465,7 +1726,7 @@ func (x *UploadFileRequest) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use UploadFileRequest.ProtoReflect.Descriptor instead.
 func (*UploadFileRequest) Descriptor() ([]byte, []int) {
-	return file_gomote_proto_rawDescGZIP(), []int{25}
+	return file_gomote_proto_rawDescGZIP(), []int{29}
 }
 
 // UploadFileResponse contains the results from a request to upload an object to GCS.
@@ -1485,7 +1746,7 @@ type UploadFileResponse struct {
 func (x *UploadFileResponse) Reset() {
 	*x = UploadFileResponse{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_gomote_proto_msgTypes[26]
+		mi := &file_gomote_proto_msgTypes[30]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -1498,7 +1759,7 @@ func (x *UploadFileResponse) String() string {
 func (*UploadFileResponse) ProtoMessage() {}
 
 func (x *UploadFileResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_gomote_proto_msgTypes[26]
+	mi := &file_gomote_proto_msgTypes[30]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -1511,7 +1772,7 @@ func (x *UploadFileResponse) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use UploadFileResponse.ProtoReflect.Descriptor instead.
 func (*UploadFileResponse) Descriptor() ([]byte, []int) {
-	return file_gomote_proto_rawDescGZIP(), []int{26}
+	return file_gomote_proto_rawDescGZIP(), []int{30}
 }
 
 func (x *UploadFileResponse) GetUrl() string {
@@ -1555,7 +1816,7 @@ type WriteFileFromURLRequest struct {
 func (x *WriteFileFromURLRequest) Reset() {
 	*x = WriteFileFromURLRequest{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_gomote_proto_msgTypes[27]
+		mi := &file_gomote_proto_msgTypes[31]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -1568,7 +1829,7 @@ func (x *WriteFileFromURLRequest) String() string {
 func (*WriteFileFromURLRequest) ProtoMessage() {}
 
 func (x *WriteFileFromURLRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_gomote_proto_msgTypes[27]
+	mi := &file_gomote_proto_msgTypes[31]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -1581,7 +1842,7 @@ func (x *WriteFileFromURLRequest) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use WriteFileFromURLRequest.ProtoReflect.Descriptor instead.
 func (*WriteFileFromURLRequest) Descriptor() ([]byte, []int) {
-	return file_gomote_proto_rawDescGZIP(), []int{27}
+	return file_gomote_proto_rawDescGZIP(), []int{31}
 }
 
 func (x *WriteFileFromURLRequest) GetGomoteId() string {
@@ -1622,7 +1883,7 @@ type WriteFileFromURLResponse struct {
 func (x *WriteFileFromURLResponse) Reset() {
 	*x = WriteFileFromURLResponse{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_gomote_proto_msgTypes[28]
+		mi := &file_gomote_proto_msgTypes[32]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -1635,7 +1896,7 @@ func (x *WriteFileFromURLResponse) String() string {
 func (*WriteFileFromURLResponse) ProtoMessage() {}
 
 func (x *WriteFileFromURLResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_gomote_proto_msgTypes[28]
+	mi := &file_gomote_proto_msgTypes[32]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -1648,7 +1909,7 @@ func (x *WriteFileFromURLResponse) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use WriteFileFromURLResponse.ProtoReflect.Descriptor instead.
 func (*WriteFileFromURLResponse) Descriptor() ([]byte, []int) {
-	return file_gomote_proto_rawDescGZIP(), []int{28}
+	return file_gomote_proto_rawDescGZIP(), []int{32}
 }
 
 // WriteTGZFromURLRequest specifies the data needed to retrieve a file and expand it onto the file system of a gomote instance.
@@ -1669,7 +1930,7 @@ type WriteTGZFromURLRequest struct {
 func (x *WriteTGZFromURLRequest) Reset() {
 	*x = WriteTGZFromURLRequest{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_gomote_proto_msgTypes[29]
+		mi := &file_gomote_proto_msgTypes[33]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -1682,7 +1943,7 @@ func (x *WriteTGZFromURLRequest) String() string {
 func (*WriteTGZFromURLRequest) ProtoMessage() {}
 
 func (x *WriteTGZFromURLRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_gomote_proto_msgTypes[29]
+	mi := &file_gomote_proto_msgTypes[33]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -1695,7 +1956,7 @@ func (x *WriteTGZFromURLRequest) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use WriteTGZFromURLRequest.ProtoReflect.Descriptor instead.
 func (*WriteTGZFromURLRequest) Descriptor() ([]byte, []int) {
-	return file_gomote_proto_rawDescGZIP(), []int{29}
+	return file_gomote_proto_rawDescGZIP(), []int{33}
 }
 
 func (x *WriteTGZFromURLRequest) GetGomoteId() string {
@@ -1729,7 +1990,7 @@ type WriteTGZFromURLResponse struct {
 func (x *WriteTGZFromURLResponse) Reset() {
 	*x = WriteTGZFromURLResponse{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_gomote_proto_msgTypes[30]
+		mi := &file_gomote_proto_msgTypes[34]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -1742,7 +2003,7 @@ func (x *WriteTGZFromURLResponse) String() string {
 func (*WriteTGZFromURLResponse) ProtoMessage() {}
 
 func (x *WriteTGZFromURLResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_gomote_proto_msgTypes[30]
+	mi := &file_gomote_proto_msgTypes[34]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -1755,7 +2016,7 @@ func (x *WriteTGZFromURLResponse) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use WriteTGZFromURLResponse.ProtoReflect.Descriptor instead.
 func (*WriteTGZFromURLResponse) Descriptor() ([]byte, []int) {
-	return file_gomote_proto_rawDescGZIP(), []int{30}
+	return file_gomote_proto_rawDescGZIP(), []int{34}
 }
 
 var File_gomote_proto protoreflect.FileDescriptor
@@ -1871,17 +2132,38 @@ var file_gomote_proto_rawDesc = []byte{
 	0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x67, 0x6f, 0x6d, 0x6f, 0x74, 0x65, 0x49, 0x64, 0x12,
 	0x14, 0x0a, 0x05, 0x70, 0x61, 0x74, 0x68, 0x73, 0x18, 0x02, 0x20, 0x03, 0x28, 0x09, 0x52, 0x05,
 	0x70, 0x61, 0x74, 0x68, 0x73, 0x22, 0x15, 0x0a, 0x13, 0x52, 0x65, 0x6d, 0x6f, 0x76, 0x65, 0x46,
-	0x69, 0x6c, 0x65, 0x73, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x22, 0x56, 0x0a, 0x11,
-	0x53, 0x69, 0x67, 0x6e, 0x53, 0x53, 0x48, 0x4b, 0x65, 0x79, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73,
-	0x74, 0x12, 0x1b, 0x0a, 0x09, 0x67, 0x6f, 0x6d, 0x6f, 0x74, 0x65, 0x5f, 0x69, 0x64, 0x18, 0x01,
-	0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x67, 0x6f, 0x6d, 0x6f, 0x74, 0x65, 0x49, 0x64, 0x12, 0x24,
-	0x0a, 0x0e, 0x70, 0x75, 0x62, 0x6c, 0x69, 0x63, 0x5f, 0x73, 0x73, 0x68, 0x5f, 0x6b, 0x65, 0x79,
-	0x18, 0x02, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x0c, 0x70, 0x75, 0x62, 0x6c, 0x69, 0x63, 0x53, 0x73,
-	0x68, 0x4b, 0x65, 0x79, 0x22, 0x47, 0x0a, 0x12, 0x53, 0x69, 0x67, 0x6e, 0x53, 0x53, 0x48, 0x4b,
-	0x65, 0x79, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x31, 0x0a, 0x15, 0x73, 0x69,
-	0x67, 0x6e, 0x65, 0x64, 0x5f, 0x70, 0x75, 0x62, 0x6c, 0x69, 0x63, 0x5f, 0x73, 0x73, 0x68, 0x5f,
-	0x6b, 0x65, 0x79, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x12, 0x73, 0x69, 0x67, 0x6e, 0x65,
-	0x64, 0x50, 0x75, 0x62, 0x6c, 0x69, 0x63, 0x53, 0x73, 0x68, 0x4b, 0x65, 0x79, 0x22, 0x13, 0x0a,
+	0x69, 0x6c, 0x65, 0x73, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x22, 0x43, 0x0a, 0x10,
+	0x53, 0x68, 0x61, 0x72, 0x65, 0x46, 0x69, 0x6c, 0x65, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74,
+	0x12, 0x1b, 0x0a, 0x09, 0x67, 0x6f, 0x6d, 0x6f, 0x74, 0x65, 0x5f, 0x69, 0x64, 0x18, 0x01, 0x20,
+	0x01, 0x28, 0x09, 0x52, 0x08, 0x67, 0x6f, 0x6d, 0x6f, 0x74, 0x65, 0x49, 0x64, 0x12, 0x12, 0x0a,
+	0x04, 0x70, 0x61, 0x74, 0x68, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x70, 0x61, 0x74,
+	0x68, 0x22, 0x53, 0x0a, 0x11, 0x53, 0x68, 0x61, 0x72, 0x65, 0x46, 0x69, 0x6c, 0x65, 0x52, 0x65,
+	0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x10, 0x0a, 0x03, 0x75, 0x72, 0x6c, 0x18, 0x01, 0x20,
+	0x01, 0x28, 0x09, 0x52, 0x03, 0x75, 0x72, 0x6c, 0x12, 0x12, 0x0a, 0x04, 0x73, 0x69, 0x7a, 0x65,
+	0x18, 0x02, 0x20, 0x01, 0x28, 0x03, 0x52, 0x04, 0x73, 0x69, 0x7a, 0x65, 0x12, 0x18, 0x0a, 0x07,
+	0x65, 0x78, 0x70, 0x69, 0x72, 0x65, 0x73, 0x18, 0x03, 0x20, 0x01, 0x28, 0x03, 0x52, 0x07, 0x65,
+	0x78, 0x70, 0x69, 0x72, 0x65, 0x73, 0x22, 0x56, 0x0a, 0x11, 0x53, 0x69, 0x67, 0x6e, 0x53, 0x53,
+	0x48, 0x4b, 0x65, 0x79, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x1b, 0x0a, 0x09, 0x67,
+	0x6f, 0x6d, 0x6f, 0x74, 0x65, 0x5f, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08,
+	0x67, 0x6f, 0x6d, 0x6f, 0x74, 0x65, 0x49, 0x64, 0x12, 0x24, 0x0a, 0x0e, 0x70, 0x75, 0x62, 0x6c,
+	0x69, 0x63, 0x5f, 0x73, 0x73, 0x68, 0x5f, 0x6b, 0x65, 0x79, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0c,
+	0x52, 0x0c, 0x70, 0x75, 0x62, 0x6c, 0x69, 0x63, 0x53, 0x73, 0x68, 0x4b, 0x65, 0x79, 0x22, 0x47,
+	0x0a, 0x12, 0x53, 0x69, 0x67, 0x6e, 0x53, 0x53, 0x48, 0x4b, 0x65, 0x79, 0x52, 0x65, 0x73, 0x70,
+	0x6f, 0x6e, 0x73, 0x65, 0x12, 0x31, 0x0a, 0x15, 0x73, 0x69, 0x67, 0x6e, 0x65, 0x64, 0x5f, 0x70,
+	0x75, 0x62, 0x6c, 0x69, 0x63, 0x5f, 0x73, 0x73, 0x68, 0x5f, 0x6b, 0x65, 0x79, 0x18, 0x01, 0x20,
+	0x01, 0x28, 0x0c, 0x52, 0x12, 0x73, 0x69, 0x67, 0x6e, 0x65, 0x64, 0x50, 0x75, 0x62, 0x6c, 0x69,
+	0x63, 0x53, 0x73, 0x68, 0x4b, 0x65, 0x79, 0x22, 0x5a, 0x0a, 0x0f, 0x54, 0x61, 0x69, 0x6c, 0x46,
+	0x69, 0x6c, 0x65, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x1b, 0x0a, 0x09, 0x67, 0x6f,
+	0x6d, 0x6f, 0x74, 0x65, 0x5f, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x67,
+	0x6f, 0x6d, 0x6f, 0x74, 0x65, 0x49, 0x64, 0x12, 0x12, 0x0a, 0x04, 0x70, 0x61, 0x74, 0x68, 0x18,
+	0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x70, 0x61, 0x74, 0x68, 0x12, 0x16, 0x0a, 0x06, 0x6f,
+	0x66, 0x66, 0x73, 0x65, 0x74, 0x18, 0x03, 0x20, 0x01, 0x28, 0x03, 0x52, 0x06, 0x6f, 0x66, 0x66,
+	0x73, 0x65, 0x74, 0x22, 0x58, 0x0a, 0x10, 0x54, 0x61, 0x69, 0x6c, 0x46, 0x69, 0x6c, 0x65, 0x52,
+	0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x18, 0x0a, 0x07, 0x72, 0x6f, 0x74, 0x61, 0x74,
+	0x65, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x08, 0x52, 0x07, 0x72, 0x6f, 0x74, 0x61, 0x74, 0x65,
+	0x64, 0x12, 0x12, 0x0a, 0x04, 0x64, 0x61, 0x74, 0x61, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0c, 0x52,
+	0x04, 0x64, 0x61, 0x74, 0x61, 0x12, 0x16, 0x0a, 0x06, 0x6f, 0x66, 0x66, 0x73, 0x65, 0x74, 0x18,
+	0x03, 0x20, 0x01, 0x28, 0x03, 0x52, 0x06, 0x6f, 0x66, 0x66, 0x73, 0x65, 0x74, 0x22, 0x13, 0x0a,
 	0x11, 0x55, 0x70, 0x6c, 0x6f, 0x61, 0x64, 0x46, 0x69, 0x6c, 0x65, 0x52, 0x65, 0x71, 0x75, 0x65,
 	0x73, 0x74, 0x22, 0xc2, 0x01, 0x0a, 0x12, 0x55, 0x70, 0x6c, 0x6f, 0x61, 0x64, 0x46, 0x69, 0x6c,
 	0x65, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x10, 0x0a, 0x03, 0x75, 0x72, 0x6c,
@@ -1913,7 +2195,7 @@ var file_gomote_proto_rawDesc = []byte{
 	0x6f, 0x72, 0x79, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x09, 0x64, 0x69, 0x72, 0x65, 0x63,
 	0x74, 0x6f, 0x72, 0x79, 0x22, 0x19, 0x0a, 0x17, 0x57, 0x72, 0x69, 0x74, 0x65, 0x54, 0x47, 0x5a,
 	0x46, 0x72, 0x6f, 0x6d, 0x55, 0x52, 0x4c, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x32,
-	0xd2, 0x09, 0x0a, 0x0d, 0x47, 0x6f, 0x6d, 0x6f, 0x74, 0x65, 0x53, 0x65, 0x72, 0x76, 0x69, 0x63,
+	0xd9, 0x0a, 0x0a, 0x0d, 0x47, 0x6f, 0x6d, 0x6f, 0x74, 0x65, 0x53, 0x65, 0x72, 0x76, 0x69, 0x63,
 	0x65, 0x12, 0x4b, 0x0a, 0x0c, 0x41, 0x75, 0x74, 0x68, 0x65, 0x6e, 0x74, 0x69, 0x63, 0x61, 0x74,
 	0x65, 0x12, 0x1b, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x73, 0x2e, 0x41, 0x75, 0x74, 0x68, 0x65,
 	0x6e, 0x74, 0x69, 0x63, 0x61, 0x74, 0x65, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x1c,
@@ -1970,30 +2252,38 @@ var file_gomote_proto_rawDesc = []byte{
 	0x72, 0x6f, 0x74, 0x6f, 0x73, 0x2e, 0x52, 0x65, 0x6d, 0x6f, 0x76, 0x65, 0x46, 0x69, 0x6c, 0x65,
 	0x73, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x1b, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f,
 	0x73, 0x2e, 0x52, 0x65, 0x6d, 0x6f, 0x76, 0x65, 0x46, 0x69, 0x6c, 0x65, 0x73, 0x52, 0x65, 0x73,
-	0x70, 0x6f, 0x6e, 0x73, 0x65, 0x22, 0x00, 0x12, 0x45, 0x0a, 0x0a, 0x53, 0x69, 0x67, 0x6e, 0x53,
-	0x53, 0x48, 0x4b, 0x65, 0x79, 0x12, 0x19, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x73, 0x2e, 0x53,
-	0x69, 0x67, 0x6e, 0x53, 0x53, 0x48, 0x4b, 0x65, 0x79, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74,
-	0x1a, 0x1a, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x73, 0x2e, 0x53, 0x69, 0x67, 0x6e, 0x53, 0x53,
-	0x48, 0x4b, 0x65, 0x79, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x22, 0x00, 0x12, 0x45,
-	0x0a, 0x0a, 0x55, 0x70, 0x6c, 0x6f, 0x61, 0x64, 0x46, 0x69, 0x6c, 0x65, 0x12, 0x19, 0x2e, 0x70,
-	0x72, 0x6f, 0x74, 0x6f, 0x73, 0x2e, 0x55, 0x70, 0x6c, 0x6f, 0x61, 0x64, 0x46, 0x69, 0x6c, 0x65,
-	0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x1a, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x73,
-	0x2e, 0x55, 0x70, 0x6c, 0x6f, 0x61, 0x64, 0x46, 0x69, 0x6c, 0x65, 0x52, 0x65, 0x73, 0x70, 0x6f,
-	0x6e, 0x73, 0x65, 0x22, 0x00, 0x12, 0x57, 0x0a, 0x10, 0x57, 0x72, 0x69, 0x74, 0x65, 0x46, 0x69,
-	0x6c, 0x65, 0x46, 0x72, 0x6f, 0x6d, 0x55, 0x52, 0x4c, 0x12, 0x1f, 0x2e, 0x70, 0x72, 0x6f, 0x74,
-	0x6f, 0x73, 0x2e, 0x57, 0x72, 0x69, 0x74, 0x65, 0x46, 0x69, 0x6c, 0x65, 0x46, 0x72, 0x6f, 0x6d,
-	0x55, 0x52, 0x4c, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x20, 0x2e, 0x70, 0x72, 0x6f,
-	0x74, 0x6f, 0x73, 0x2e, 0x57, 0x72, 0x69, 0x74, 0x65, 0x46, 0x69, 0x6c, 0x65, 0x46, 0x72, 0x6f,
-	0x6d, 0x55, 0x52, 0x4c, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x22, 0x00, 0x12, 0x54,
-	0x0a, 0x0f, 0x57, 0x72, 0x69, 0x74, 0x65, 0x54, 0x47, 0x5a, 0x46, 0x72, 0x6f, 0x6d, 0x55, 0x52,
-	0x4c, 0x12, 0x1e, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x73, 0x2e, 0x57, 0x72, 0x69, 0x74, 0x65,
-	0x54, 0x47, 0x5a, 0x46, 0x72, 0x6f, 0x6d, 0x55, 0x52, 0x4c, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73,
-	0x74, 0x1a, 0x1f, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x73, 0x2e, 0x57, 0x72, 0x69, 0x74, 0x65,
-	0x54, 0x47, 0x5a, 0x46, 0x72, 0x6f, 0x6d, 0x55, 0x52, 0x4c, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e,
-	0x73, 0x65, 0x22, 0x00, 0x42, 0x2b, 0x5a, 0x29, 0x67, 0x6f, 0x6c, 0x61, 0x6e, 0x67, 0x2e, 0x6f,
-	0x72, 0x67, 0x2f, 0x78, 0x2f, 0x62, 0x75, 0x69, 0x6c, 0x64, 0x2f, 0x69, 0x6e, 0x74, 0x65, 0x72,
-	0x6e, 0x61, 0x6c, 0x2f, 0x67, 0x6f, 0x6d, 0x6f, 0x74, 0x65, 0x2f, 0x70, 0x72, 0x6f, 0x74, 0x6f,
-	0x73, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+	0x70, 0x6f, 0x6e, 0x73, 0x65, 0x22, 0x00, 0x12, 0x42, 0x0a, 0x09, 0x53, 0x68, 0x61, 0x72, 0x65,
+	0x46, 0x69, 0x6c, 0x65, 0x12, 0x18, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x73, 0x2e, 0x53, 0x68,
+	0x61, 0x72, 0x65, 0x46, 0x69, 0x6c, 0x65, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x19,
+	0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x73, 0x2e, 0x53, 0x68, 0x61, 0x72, 0x65, 0x46, 0x69, 0x6c,
+	0x65, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x22, 0x00, 0x12, 0x45, 0x0a, 0x0a, 0x53,
+	0x69, 0x67, 0x6e, 0x53, 0x53, 0x48, 0x4b, 0x65, 0x79, 0x12, 0x19, 0x2e, 0x70, 0x72, 0x6f, 0x74,
+	0x6f, 0x73, 0x2e, 0x53, 0x69, 0x67, 0x6e, 0x53, 0x53, 0x48, 0x4b, 0x65, 0x79, 0x52, 0x65, 0x71,
+	0x75, 0x65, 0x73, 0x74, 0x1a, 0x1a, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x73, 0x2e, 0x53, 0x69,
+	0x67, 0x6e, 0x53, 0x53, 0x48, 0x4b, 0x65, 0x79, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65,
+	0x22, 0x00, 0x12, 0x41, 0x0a, 0x08, 0x54, 0x61, 0x69, 0x6c, 0x46, 0x69, 0x6c, 0x65, 0x12, 0x17,
+	0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x73, 0x2e, 0x54, 0x61, 0x69, 0x6c, 0x46, 0x69, 0x6c, 0x65,
+	0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x18, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x73,
+	0x2e, 0x54, 0x61, 0x69, 0x6c, 0x46, 0x69, 0x6c, 0x65, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73,
+	0x65, 0x22, 0x00, 0x30, 0x01, 0x12, 0x45, 0x0a, 0x0a, 0x55, 0x70, 0x6c, 0x6f, 0x61, 0x64, 0x46,
+	0x69, 0x6c, 0x65, 0x12, 0x19, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x73, 0x2e, 0x55, 0x70, 0x6c,
+	0x6f, 0x61, 0x64, 0x46, 0x69, 0x6c, 0x65, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x1a,
+	0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x73, 0x2e, 0x55, 0x70, 0x6c, 0x6f, 0x61, 0x64, 0x46, 0x69,
+	0x6c, 0x65, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x22, 0x00, 0x12, 0x57, 0x0a, 0x10,
+	0x57, 0x72, 0x69, 0x74, 0x65, 0x46, 0x69, 0x6c, 0x65, 0x46, 0x72, 0x6f, 0x6d, 0x55, 0x52, 0x4c,
+	0x12, 0x1f, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x73, 0x2e, 0x57, 0x72, 0x69, 0x74, 0x65, 0x46,
+	0x69, 0x6c, 0x65, 0x46, 0x72, 0x6f, 0x6d, 0x55, 0x52, 0x4c, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73,
+	0x74, 0x1a, 0x20, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x73, 0x2e, 0x57, 0x72, 0x69, 0x74, 0x65,
+	0x46, 0x69, 0x6c, 0x65, 0x46, 0x72, 0x6f, 0x6d, 0x55, 0x52, 0x4c, 0x52, 0x65, 0x73, 0x70, 0x6f,
+	0x6e, 0x73, 0x65, 0x22, 0x00, 0x12, 0x54, 0x0a, 0x0f, 0x57, 0x72, 0x69, 0x74, 0x65, 0x54, 0x47,
+	0x5a, 0x46, 0x72, 0x6f, 0x6d, 0x55, 0x52, 0x4c, 0x12, 0x1e, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f,
+	0x73, 0x2e, 0x57, 0x72, 0x69, 0x74, 0x65, 0x54, 0x47, 0x5a, 0x46, 0x72, 0x6f, 0x6d, 0x55, 0x52,
+	0x4c, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x1f, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f,
+	0x73, 0x2e, 0x57, 0x72, 0x69, 0x74, 0x65, 0x54, 0x47, 0x5a, 0x46, 0x72, 0x6f, 0x6d, 0x55, 0x52,
+	0x4c, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x22, 0x00, 0x42, 0x2b, 0x5a, 0x29, 0x67,
+	0x6f, 0x6c, 0x61, 0x6e, 0x67, 0x2e, 0x6f, 0x72, 0x67, 0x2f, 0x78, 0x2f, 0x62, 0x75, 0x69, 0x6c,
+	0x64, 0x2f, 0x69, 0x6e, 0x74, 0x65, 0x72, 0x6e, 0x61, 0x6c, 0x2f, 0x67, 0x6f, 0x6d, 0x6f, 0x74,
+	0x65, 0x2f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x73, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
 }
 
 var (
@@ -2009,7 +2299,7 @@ func file_gomote_proto_rawDescGZIP() []byte {
 }
 
 var file_gomote_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
-var file_gomote_proto_msgTypes = make([]protoimpl.MessageInfo, 32)
+var file_gomote_proto_msgTypes = make([]protoimpl.MessageInfo, 36)
 var file_gomote_proto_goTypes = []interface{}{
 	(CreateInstanceResponse_Status)(0),   // 0: protos.CreateInstanceResponse.Status
 	(*AuthenticateRequest)(nil),          // 1: protos.AuthenticateRequest
@@ -2035,21 +2325,25 @@ var file_gomote_proto_goTypes = []interface{}{
 	(*ReadTGZToURLResponse)(nil),         // 21: protos.ReadTGZToURLResponse
 	(*RemoveFilesRequest)(nil),           // 22: protos.RemoveFilesRequest
 	(*RemoveFilesResponse)(nil),          // 23: protos.RemoveFilesResponse
-	(*SignSSHKeyRequest)(nil),            // 24: protos.SignSSHKeyRequest
-	(*SignSSHKeyResponse)(nil),           // 25: protos.SignSSHKeyResponse
-	(*UploadFileRequest)(nil),            // 26: protos.UploadFileRequest
-	(*UploadFileResponse)(nil),           // 27: protos.UploadFileResponse
-	(*WriteFileFromURLRequest)(nil),      // 28: protos.WriteFileFromURLRequest
-	(*WriteFileFromURLResponse)(nil),     // 29: protos.WriteFileFromURLResponse
-	(*WriteTGZFromURLRequest)(nil),       // 30: protos.WriteTGZFromURLRequest
-	(*WriteTGZFromURLResponse)(nil),      // 31: protos.WriteTGZFromURLResponse
-	nil,                                  // 32: protos.UploadFileResponse.FieldsEntry
+	(*ShareFileRequest)(nil),             // 24: protos.ShareFileRequest
+	(*ShareFileResponse)(nil),            // 25: protos.ShareFileResponse
+	(*SignSSHKeyRequest)(nil),            // 26: protos.SignSSHKeyRequest
+	(*SignSSHKeyResponse)(nil),           // 27: protos.SignSSHKeyResponse
+	(*TailFileRequest)(nil),              // 28: protos.TailFileRequest
+	(*TailFileResponse)(nil),             // 29: protos.TailFileResponse
+	(*UploadFileRequest)(nil),            // 30: protos.UploadFileRequest
+	(*UploadFileResponse)(nil),           // 31: protos.UploadFileResponse
+	(*WriteFileFromURLRequest)(nil),      // 32: protos.WriteFileFromURLRequest
+	(*WriteFileFromURLResponse)(nil),     // 33: protos.WriteFileFromURLResponse
+	(*WriteTGZFromURLRequest)(nil),       // 34: protos.WriteTGZFromURLRequest
+	(*WriteTGZFromURLResponse)(nil),      // 35: protos.WriteTGZFromURLResponse
+	nil,                                  // 36: protos.UploadFileResponse.FieldsEntry
 }
 var file_gomote_proto_depIdxs = []int32{
 	11, // 0: protos.CreateInstanceResponse.instance:type_name -> protos.Instance
 	0,  // 1: protos.CreateInstanceResponse.status:type_name -> protos.CreateInstanceResponse.Status
 	11, // 2: protos.ListInstancesResponse.instances:type_name -> protos.Instance
-	32, // 3: protos.UploadFileResponse.fields:type_name -> protos.UploadFileResponse.FieldsEntry
+	36, // 3: protos.UploadFileResponse.fields:type_name -> protos.UploadFileResponse.FieldsEntry
 	1,  // 4: protos.GomoteService.Authenticate:input_type -> protos.AuthenticateRequest
 	4,  // 5: protos.GomoteService.AddBootstrap:input_type -> protos.AddBootstrapRequest
 	3,  // 6: protos.GomoteService.CreateInstance:input_type -> protos.CreateInstanceRequest
@@ -2061,27 +2355,31 @@ var file_gomote_proto_depIdxs = []int32{
 	18, // 12: protos.GomoteService.ListSwarmingBuilders:input_type -> protos.ListSwarmingBuildersRequest
 	20, // 13: protos.GomoteService.ReadTGZToURL:input_type -> protos.ReadTGZToURLRequest
 	22, // 14: protos.GomoteService.RemoveFiles:input_type -> protos.RemoveFilesRequest
-	24, // 15: protos.GomoteService.SignSSHKey:input_type -> protos.SignSSHKeyRequest
-	26, // 16: protos.GomoteService.UploadFile:input_type -> protos.UploadFileRequest
-	28, // 17: protos.GomoteService.WriteFileFromURL:input_type -> protos.WriteFileFromURLRequest
-	30, // 18: protos.GomoteService.WriteTGZFromURL:input_type -> protos.WriteTGZFromURLRequest
-	2,  // 19: protos.GomoteService.Authenticate:output_type -> protos.AuthenticateResponse
-	5,  // 20: protos.GomoteService.AddBootstrap:output_type -> protos.AddBootstrapResponse
-	6,  // 21: protos.GomoteService.CreateInstance:output_type -> protos.CreateInstanceResponse
-	8,  // 22: protos.GomoteService.DestroyInstance:output_type -> protos.DestroyInstanceResponse
-	10, // 23: protos.GomoteService.ExecuteCommand:output_type -> protos.ExecuteCommandResponse
-	13, // 24: protos.GomoteService.InstanceAlive:output_type -> protos.InstanceAliveResponse
-	15, // 25: protos.GomoteService.ListDirectory:output_type -> protos.ListDirectoryResponse
-	17, // 26: protos.GomoteService.ListInstances:output_type -> protos.ListInstancesResponse
-	19, // 27: protos.GomoteService.ListSwarmingBuilders:output_type -> protos.ListSwarmingBuildersResponse
-	21, // 28: protos.GomoteService.ReadTGZToURL:output_type -> protos.ReadTGZToURLResponse
-	23, // 29: protos.GomoteService.RemoveFiles:output_type -> protos.RemoveFilesResponse
-	25, // 30: protos.GomoteService.SignSSHKey:output_type -> protos.SignSSHKeyResponse
-	27, // 31: protos.GomoteService.UploadFile:output_type -> protos.UploadFileResponse
-	29, // 32: protos.GomoteService.WriteFileFromURL:output_type -> protos.WriteFileFromURLResponse
-	31, // 33: protos.GomoteService.WriteTGZFromURL:output_type -> protos.WriteTGZFromURLResponse
-	19, // [19:34] is the sub-list for method output_type
-	4,  // [4:19] is the sub-list for method input_type
+	24, // 15: protos.GomoteService.ShareFile:input_type -> protos.ShareFileRequest
+	26, // 16: protos.GomoteService.SignSSHKey:input_type -> protos.SignSSHKeyRequest
+	28, // 17: protos.GomoteService.TailFile:input_type -> protos.TailFileRequest
+	30, // 18: protos.GomoteService.UploadFile:input_type -> protos.UploadFileRequest
+	32, // 19: protos.GomoteService.WriteFileFromURL:input_type -> protos.WriteFileFromURLRequest
+	34, // 20: protos.GomoteService.WriteTGZFromURL:input_type -> protos.WriteTGZFromURLRequest
+	2,  // 21: protos.GomoteService.Authenticate:output_type -> protos.AuthenticateResponse
+	5,  // 22: protos.GomoteService.AddBootstrap:output_type -> protos.AddBootstrapResponse
+	6,  // 23: protos.GomoteService.CreateInstance:output_type -> protos.CreateInstanceResponse
+	8,  // 24: protos.GomoteService.DestroyInstance:output_type -> protos.DestroyInstanceResponse
+	10, // 25: protos.GomoteService.ExecuteCommand:output_type -> protos.ExecuteCommandResponse
+	13, // 26: protos.GomoteService.InstanceAlive:output_type -> protos.InstanceAliveResponse
+	15, // 27: protos.GomoteService.ListDirectory:output_type -> protos.ListDirectoryResponse
+	17, // 28: protos.GomoteService.ListInstances:output_type -> protos.ListInstancesResponse
+	19, // 29: protos.GomoteService.ListSwarmingBuilders:output_type -> protos.ListSwarmingBuildersResponse
+	21, // 30: protos.GomoteService.ReadTGZToURL:output_type -> protos.ReadTGZToURLResponse
+	23, // 31: protos.GomoteService.RemoveFiles:output_type -> protos.RemoveFilesResponse
+	25, // 32: protos.GomoteService.ShareFile:output_type -> protos.ShareFileResponse
+	27, // 33: protos.GomoteService.SignSSHKey:output_type -> protos.SignSSHKeyResponse
+	29, // 34: protos.GomoteService.TailFile:output_type -> protos.TailFileResponse
+	31, // 35: protos.GomoteService.UploadFile:output_type -> protos.UploadFileResponse
+	33, // 36: protos.GomoteService.WriteFileFromURL:output_type -> protos.WriteFileFromURLResponse
+	35, // 37: protos.GomoteService.WriteTGZFromURL:output_type -> protos.WriteTGZFromURLResponse
+	21, // [21:38] is the sub-list for method output_type
+	4,  // [4:21] is the sub-list for method input_type
 	4,  // [4:4] is the sub-list for extension type_name
 	4,  // [4:4] is the sub-list for extension extendee
 	0,  // [0:4] is the sub-list for field type_name
@@ -2370,7 +2668,7 @@ func file_gomote_proto_init() {
 			}
 		}
 		file_gomote_proto_msgTypes[23].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*SignSSHKeyRequest); i {
+			switch v := v.(*ShareFileRequest); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -2382,7 +2680,7 @@ func file_gomote_proto_init() {
 			}
 		}
 		file_gomote_proto_msgTypes[24].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*SignSSHKeyResponse); i {
+			switch v := v.(*ShareFileResponse); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -2394,7 +2692,7 @@ func file_gomote_proto_init() {
 			}
 		}
 		file_gomote_proto_msgTypes[25].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*UploadFileRequest); i {
+			switch v := v.(*SignSSHKeyRequest); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -2406,7 +2704,7 @@ func file_gomote_proto_init() {
 			}
 		}
 		file_gomote_proto_msgTypes[26].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*UploadFileResponse); i {
+			switch v := v.(*SignSSHKeyResponse); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -2418,7 +2716,7 @@ func file_gomote_proto_init() {
 			}
 		}
 		file_gomote_proto_msgTypes[27].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*WriteFileFromURLRequest); i {
+			switch v := v.(*TailFileRequest); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -2430,7 +2728,7 @@ func file_gomote_proto_init() {
 			}
 		}
 		file_gomote_proto_msgTypes[28].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*WriteFileFromURLResponse); i {
+			switch v := v.(*TailFileResponse); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -2442,7 +2740,7 @@ func file_gomote_proto_init() {
 			}
 		}
 		file_gomote_proto_msgTypes[29].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*WriteTGZFromURLRequest); i {
+			switch v := v.(*UploadFileRequest); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -2454,6 +2752,54 @@ func file_gomote_proto_init() {
 			}
 		}
 		file_gomote_proto_msgTypes[30].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*UploadFileResponse); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_gomote_proto_msgTypes[31].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*WriteFileFromURLRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_gomote_proto_msgTypes[32].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*WriteFileFromURLResponse); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_gomote_proto_msgTypes[33].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*WriteTGZFromURLRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_gomote_proto_msgTypes[34].Exporter = func(v interface{}, i int) interface{} {
 			switch v := v.(*WriteTGZFromURLResponse); i {
 			case 0:
 				return &v.state
@@ -2472,7 +2818,7 @@ func file_gomote_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: file_gomote_proto_rawDesc,
 			NumEnums:      1,
-			NumMessages:   32,
+			NumMessages:   36,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
@@ -45,8 +45,14 @@ type GomoteServiceClient interface {
 	ReadTGZToURL(ctx context.Context, in *ReadTGZToURLRequest, opts ...grpc.CallOption) (*ReadTGZToURLResponse, error)
 	// RemoveFiles removes files or directories from the gomote instance.
 	RemoveFiles(ctx context.Context, in *RemoveFilesRequest, opts ...grpc.CallOption) (*RemoveFilesResponse, error)
+	// ShareFile uploads a file from the gomote instance to a public bucket, where it's kept for a limited time, and returns
+	// a URL where it can be downloaded from, such as to link to it from an issue.
+	ShareFile(ctx context.Context, in *ShareFileRequest, opts ...grpc.CallOption) (*ShareFileResponse, error)
 	// SignSSHKey signs an SSH public key which can be used to SSH into instances owned by the caller.
 	SignSSHKey(ctx context.Context, in *SignSSHKeyRequest, opts ...grpc.CallOption) (*SignSSHKeyResponse, error)
+	// TailFile streams the contents of a file on the gomote instance as they're appended to it, following the file
+	// across rotations, until the caller cancels the call.
+	TailFile(ctx context.Context, in *TailFileRequest, opts ...grpc.CallOption) (GomoteService_TailFileClient, error)
 	// UploadFile generates a signed URL and associated fields to be used when uploading the object to GCS. Once uploaded
 	// the corresponding Write endpoint can be used to send the file to the gomote instance.
 	UploadFile(ctx context.Context, in *UploadFileRequest, opts ...grpc.CallOption) (*UploadFileResponse, error)
@@ -209,6 +215,15 @@ func (c *gomoteServiceClient) RemoveFiles(ctx context.Context, in *RemoveFilesRe
 	return out, nil
 }
 
+func (c *gomoteServiceClient) ShareFile(ctx context.Context, in *ShareFileRequest, opts ...grpc.CallOption) (*ShareFileResponse, error) {
+	out := new(ShareFileResponse)
+	err := c.cc.Invoke(ctx, "/protos.GomoteService/ShareFile", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (c *gomoteServiceClient) SignSSHKey(ctx context.Context, in *SignSSHKeyRequest, opts ...grpc.CallOption) (*SignSSHKeyResponse, error) {
 	out := new(SignSSHKeyResponse)
 	err := c.cc.Invoke(ctx, "/protos.GomoteService/SignSSHKey", in, out, opts...)
@@ -218,6 +233,38 @@ func (c *gomoteServiceClient) SignSSHKey(ctx context.Context, in *SignSSHKeyRequ
 	return out, nil
 }
 
+func (c *gomoteServiceClient) TailFile(ctx context.Context, in *TailFileRequest, opts ...grpc.CallOption) (GomoteService_TailFileClient, error) {
+	stream, err := c.cc.NewStream(ctx, &GomoteService_ServiceDesc.Streams[2], "/protos.GomoteService/TailFile", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &gomoteServiceTailFileClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type GomoteService_TailFileClient interface {
+	Recv() (*TailFileResponse, error)
+	grpc.ClientStream
+}
+
+type gomoteServiceTailFileClient struct {
+	grpc.ClientStream
+}
+
+func (x *gomoteServiceTailFileClient) Recv() (*TailFileResponse, error) {
+	m := new(TailFileResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 func (c *gomoteServiceClient) UploadFile(ctx context.Context, in *UploadFileRequest, opts ...grpc.CallOption) (*UploadFileResponse, error) {
 	out := new(UploadFileResponse)
 	err := c.cc.Invoke(ctx, "/protos.GomoteService/UploadFile", in, out, opts...)
@@ -272,8 +319,14 @@ type GomoteServiceServer interface {
 	ReadTGZToURL(context.Context, *ReadTGZToURLRequest) (*ReadTGZToURLResponse, error)
 	// RemoveFiles removes files or directories from the gomote instance.
 	RemoveFiles(context.Context, *RemoveFilesRequest) (*RemoveFilesResponse, error)
+	// ShareFile uploads a file from the gomote instance to a public bucket, where it's kept for a limited time, and returns
+	// a URL where it can be downloaded from, such as to link to it from an issue.
+	ShareFile(context.Context, *ShareFileRequest) (*ShareFileResponse, error)
 	// SignSSHKey signs an SSH public key which can be used to SSH into instances owned by the caller.
 	SignSSHKey(context.Context, *SignSSHKeyRequest) (*SignSSHKeyResponse, error)
+	// TailFile streams the contents of a file on the gomote instance as they're appended to it, following the file
+	// across rotations, until the caller cancels the call.
+	TailFile(*TailFileRequest, GomoteService_TailFileServer) error
 	// UploadFile generates a signed URL and associated fields to be used when uploading the object to GCS. Once uploaded
 	// the corresponding Write endpoint can be used to send the file to the gomote instance.
 	UploadFile(context.Context, *UploadFileRequest) (*UploadFileResponse, error)
@@ -321,9 +374,15 @@ func (UnimplementedGomoteServiceServer) ReadTGZToURL(context.Context, *ReadTGZTo
 func (UnimplementedGomoteServiceServer) RemoveFiles(context.Context, *RemoveFilesRequest) (*RemoveFilesResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method RemoveFiles not implemented")
 }
+func (UnimplementedGomoteServiceServer) ShareFile(context.Context, *ShareFileRequest) (*ShareFileResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ShareFile not implemented")
+}
 func (UnimplementedGomoteServiceServer) SignSSHKey(context.Context, *SignSSHKeyRequest) (*SignSSHKeyResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method SignSSHKey not implemented")
 }
+func (UnimplementedGomoteServiceServer) TailFile(*TailFileRequest, GomoteService_TailFileServer) error {
+	return status.Errorf(codes.Unimplemented, "method TailFile not implemented")
+}
 func (UnimplementedGomoteServiceServer) UploadFile(context.Context, *UploadFileRequest) (*UploadFileResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method UploadFile not implemented")
 }
@@ -550,6 +609,24 @@ func _GomoteService_RemoveFiles_Handler(srv interface{}, ctx context.Context, de
 	return interceptor(ctx, in, info, handler)
 }
 
+func _GomoteService_ShareFile_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ShareFileRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GomoteServiceServer).ShareFile(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/protos.GomoteService/ShareFile",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GomoteServiceServer).ShareFile(ctx, req.(*ShareFileRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 func _GomoteService_SignSSHKey_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(SignSSHKeyRequest)
 	if err := dec(in); err != nil {
@@ -568,6 +645,27 @@ func _GomoteService_SignSSHKey_Handler(srv interface{}, ctx context.Context, dec
 	return interceptor(ctx, in, info, handler)
 }
 
+func _GomoteService_TailFile_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(TailFileRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(GomoteServiceServer).TailFile(m, &gomoteServiceTailFileServer{stream})
+}
+
+type GomoteService_TailFileServer interface {
+	Send(*TailFileResponse) error
+	grpc.ServerStream
+}
+
+type gomoteServiceTailFileServer struct {
+	grpc.ServerStream
+}
+
+func (x *gomoteServiceTailFileServer) Send(m *TailFileResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
 func _GomoteService_UploadFile_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(UploadFileRequest)
 	if err := dec(in); err != nil {
@@ -665,6 +763,10 @@ var GomoteService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "RemoveFiles",
 			Handler:    _GomoteService_RemoveFiles_Handler,
 		},
+		{
+			MethodName: "ShareFile",
+			Handler:    _GomoteService_ShareFile_Handler,
+		},
 		{
 			MethodName: "SignSSHKey",
 			Handler:    _GomoteService_SignSSHKey_Handler,
@@ -693,6 +795,11 @@ var GomoteService_ServiceDesc = grpc.ServiceDesc{
 			Handler:       _GomoteService_ExecuteCommand_Handler,
 			ServerStreams: true,
 		},
+		{
+			StreamName:    "TailFile",
+			Handler:       _GomoteService_TailFile_Handler,
+			ServerStreams: true,
+		},
 	},
 	Metadata: "gomote.proto",
 }
@@ -19,7 +19,7 @@ type Person struct {
 	Gerrit  string   // "foo@bar.com" (lowercase)
 	Emails  []string // all lower
 	Googler bool     // whether person is (or was) a Googler; determined via heuristics
-	Bot     bool     // whether it's a known bot (GopherBot, Gerrit Bot)
+	Bot     bool     // whether it's a known bot (GopherBot, Gerrit Bot, Kokoro)
 }
 
 func strSliceContains(ss []string, s string) bool {
@@ -115,6 +115,7 @@ func init() {
 	// Not people, but hereby granted personhood:
 	addPerson("Gopherbot", "gobot@golang.org", "@gopherbot", "5976@62eb7196-b449-3ce5-99f1-c037f21e1705", "*bot")
 	addPerson("Gerrit Bot", "letsusegerrit@gmail.com", "12446@62eb7196-b449-3ce5-99f1-c037f21e1705", "*bot")
+	addPerson("Kokoro", "37747@62eb7196-b449-3ce5-99f1-c037f21e1705", "*bot")
 	addPerson("Fuzzing Team", "@golang/fuzzing")
 	addPerson("Security Team", "@golang/security")
 	addPerson("VulnDB Team", "@golang/vulndb")
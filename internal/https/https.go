@@ -3,6 +3,11 @@
 // license that can be found in the LICENSE file.
 
 // Package https contains helpers for starting an HTTP/HTTPS server.
+//
+// Commands call RegisterFlags at the beginning of main and
+// ListenAndServe at the end. Besides serving their handler over HTTP
+// and HTTPS, they then get a separate debug server for DebugMux, and
+// shut down gracefully on SIGTERM.
 package https // import "golang.org/x/build/internal/https"
 
 import (
@@ -13,11 +18,16 @@ import (
 	"crypto/tls"
 	"crypto/x509"
 	"crypto/x509/pkix"
+	"expvar"
 	"flag"
 	"fmt"
+	"log"
 	"math/big"
 	"net/http"
+	"net/http/pprof"
+	"os/signal"
 	"strings"
+	"syscall"
 	"time"
 
 	"cloud.google.com/go/storage"
@@ -32,14 +42,44 @@ type Options struct {
 	AutocertAddr string
 	// If non-empty, listen on this address and serve HTTPS using a self-signed cert.
 	SelfSignedAddr string
+	// If non-empty, listen on this address and serve HTTPS using the cert in CertFile and KeyFile.
+	CertAddr string
+	// Specifies the PEM-encoded certificate and key files to use with CertAddr.
+	CertFile, KeyFile string
 	// If non-empty, listen on this address and serve HTTP.
 	HTTPAddr string
 	// If non-empty, respond unconditionally with 200 OK to requests on this path.
 	HealthPath string
+	// If non-empty, listen on this address and serve DebugMux over HTTP.
+	// It should be a localhost address.
+	DebugAddr string
+	// How long to wait for in-flight requests to finish when shutting down.
+	// If zero, requests are given 30 seconds.
+	ShutdownTimeout time.Duration
 }
 
 var DefaultOptions = &Options{}
 
+// DebugMux is served on the debug address. It has the net/http/pprof
+// handlers under /debug/pprof/ and the expvar handler at /debug/vars,
+// and commands may add their own, such as for metrics.
+//
+// Those handlers are never served on the other addresses, even though
+// importing net/http/pprof and expvar registers them on
+// http.DefaultServeMux.
+var DebugMux = newDebugMux()
+
+func newDebugMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
+	return mux
+}
+
 // RegisterFlags registers flags that control DefaultOptions, which will be
 // used with ListenAndServe below.
 // Typical usage is to call RegisterFlags at the beginning of main, then
@@ -48,21 +88,33 @@ func RegisterFlags(set *flag.FlagSet) {
 	set.StringVar(&DefaultOptions.AutocertBucket, "autocert-bucket", "", "specifies the GCS bucket to use with autocert-addr")
 	set.StringVar(&DefaultOptions.AutocertAddr, "listen-https-autocert", "", "if non-empty, listen on this address and serve HTTPS using a Let's Encrypt cert stored in autocert-bucket")
 	set.StringVar(&DefaultOptions.SelfSignedAddr, "listen-https-selfsigned", "", "if non-empty, listen on this address and serve HTTPS using a self-signed cert")
+	set.StringVar(&DefaultOptions.CertAddr, "listen-https-cert", "", "if non-empty, listen on this address and serve HTTPS using the cert in cert-file and key-file")
+	set.StringVar(&DefaultOptions.CertFile, "cert-file", "", "specifies the PEM-encoded certificate file to use with listen-https-cert")
+	set.StringVar(&DefaultOptions.KeyFile, "key-file", "", "specifies the PEM-encoded key file to use with listen-https-cert")
 	set.StringVar(&DefaultOptions.HTTPAddr, "listen-http", "", "if non-empty, listen on this address and serve HTTP")
 	set.StringVar(&DefaultOptions.HealthPath, "health-path", "/healthz", "if non-empty, respond unconditionally with 200 OK to requests on this path")
+	set.StringVar(&DefaultOptions.DebugAddr, "listen-debug", "localhost:6060", "if non-empty, listen on this address and serve the pprof and expvar debug handlers over HTTP")
+	set.DurationVar(&DefaultOptions.ShutdownTimeout, "shutdown-timeout", 30*time.Second, "how long to wait for in-flight requests to finish when shutting down")
 }
 
-// ListenAndServe runs the servers configured by DefaultOptions. It always
-// returns a non-nil error.
+// ListenAndServe runs the servers configured by DefaultOptions.
+// See ListenAndServeOpts.
 func ListenAndServe(ctx context.Context, handler http.Handler) error {
 	return ListenAndServeOpts(ctx, handler, DefaultOptions)
 }
 
-// ListenAndServeOpts runs the servers configured by opts. It always
-// returns a non-nil error.
+// ListenAndServeOpts runs the servers configured by opts until one of
+// them fails, in which case it returns a non-nil error, or until the
+// process receives SIGTERM or ctx is done, in which case it shuts the
+// servers down gracefully and returns nil once in-flight requests have
+// finished.
+//
+// A failure of the debug server is logged, but doesn't stop the others.
 func ListenAndServeOpts(ctx context.Context, handler http.Handler, opts *Options) error {
-	errc := make(chan error, 3)
+	ctx, stop := signal.NotifyContext(ctx, syscall.SIGTERM)
+	defer stop()
 
+	handler = withoutDebugHandlers(handler)
 	if opts.HealthPath != "" {
 		wrapped := handler
 		handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -75,10 +127,26 @@ func ListenAndServeOpts(ctx context.Context, handler http.Handler, opts *Options
 		})
 	}
 
+	var servers []*http.Server
+	defer func() {
+		for _, s := range servers {
+			s.Close()
+		}
+	}()
+	errc := make(chan error, 4)
+	serve := func(s *http.Server, useTLS bool) {
+		servers = append(servers, s)
+		go func() {
+			if useTLS {
+				errc <- s.ListenAndServeTLS("", "")
+			} else {
+				errc <- s.ListenAndServe()
+			}
+		}()
+	}
+
 	if opts.HTTPAddr != "" {
-		server := &http.Server{Addr: opts.HTTPAddr, Handler: handler}
-		defer server.Close()
-		go func() { errc <- server.ListenAndServe() }()
+		serve(&http.Server{Addr: opts.HTTPAddr, Handler: handler}, false)
 	}
 
 	if opts.AutocertAddr != "" {
@@ -89,8 +157,7 @@ func ListenAndServeOpts(ctx context.Context, handler http.Handler, opts *Options
 		if err != nil {
 			return err
 		}
-		defer server.Close()
-		go func() { errc <- server.ListenAndServeTLS("", "") }()
+		serve(server, true)
 	}
 
 	if opts.SelfSignedAddr != "" {
@@ -98,11 +165,81 @@ func ListenAndServeOpts(ctx context.Context, handler http.Handler, opts *Options
 		if err != nil {
 			return err
 		}
-		defer server.Close()
-		go func() { errc <- server.ListenAndServeTLS("", "") }()
+		serve(server, true)
+	}
+
+	if opts.CertAddr != "" {
+		if opts.CertFile == "" || opts.KeyFile == "" {
+			return fmt.Errorf("must specify cert-file and key-file with listen-https-cert")
+		}
+		server, err := certServer(opts.CertAddr, opts.CertFile, opts.KeyFile, handler)
+		if err != nil {
+			return err
+		}
+		serve(server, true)
+	}
+
+	if opts.DebugAddr != "" {
+		debug := &http.Server{Addr: opts.DebugAddr, Handler: DebugMux}
+		defer debug.Close()
+		go func() {
+			if err := debug.ListenAndServe(); err != http.ErrServerClosed {
+				log.Printf("https: debug server on %s: %v", opts.DebugAddr, err)
+			}
+		}()
 	}
 
-	return <-errc
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+
+	timeout := opts.ShutdownTimeout
+	if timeout == 0 {
+		timeout = 30 * time.Second
+	}
+	log.Printf("https: shutting down; waiting up to %v for in-flight requests", timeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	shutdownErrc := make(chan error, len(servers))
+	for _, s := range servers {
+		s := s
+		go func() { shutdownErrc <- s.Shutdown(shutdownCtx) }()
+	}
+	var shutdownErr error
+	for range servers {
+		if err := <-shutdownErrc; err != nil && shutdownErr == nil {
+			shutdownErr = fmt.Errorf("https: shutting down: %v", err)
+		}
+	}
+	return shutdownErr
+}
+
+// withoutDebugHandlers returns a handler that serves h, except for the
+// handlers that belong on DebugMux.
+func withoutDebugHandlers(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/debug/pprof/") || r.URL.Path == "/debug/vars" {
+			http.NotFound(w, r)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// certServer returns an http.Server that is configured to serve HTTPS
+// on addr using the certificate and key in certFile and keyFile.
+func certServer(addr, certFile, keyFile string, handler http.Handler) (*http.Server, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Server{
+		Addr:      addr,
+		Handler:   handler,
+		TLSConfig: &tls.Config{Certificates: []tls.Certificate{cert}},
+	}, nil
 }
 
 // autocertServer returns an http.Server that is configured to serve
@@ -0,0 +1,162 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package https
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// freeAddr returns a localhost address that is likely to be free.
+func freeAddr(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	return ln.Addr().String()
+}
+
+// get returns the status code and body of a GET of url, retrying
+// until the server at url starts listening.
+func get(t *testing.T, url string) (int, string) {
+	t.Helper()
+	var err error
+	for i := 0; i < 50; i++ {
+		var resp *http.Response
+		resp, err = http.Get(url)
+		if err != nil {
+			time.Sleep(20 * time.Millisecond)
+			continue
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode, string(body)
+	}
+	t.Fatalf("GET %s: %v", url, err)
+	return 0, ""
+}
+
+func TestListenAndServe(t *testing.T) {
+	opts := &Options{
+		HTTPAddr:   freeAddr(t),
+		DebugAddr:  freeAddr(t),
+		HealthPath: "/healthz",
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) { io.WriteString(w, "hello") })
+	mux.HandleFunc("/debug/pprof/", func(w http.ResponseWriter, r *http.Request) { io.WriteString(w, "public pprof") })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() { errc <- ListenAndServeOpts(ctx, mux, opts) }()
+
+	for _, tc := range []struct {
+		url      string
+		wantCode int
+		wantBody string
+	}{
+		{"http://" + opts.HTTPAddr + "/", http.StatusOK, "hello"},
+		{"http://" + opts.HTTPAddr + "/healthz", http.StatusOK, "ok"},
+		{"http://" + opts.HTTPAddr + "/debug/pprof/", http.StatusNotFound, ""},
+		{"http://" + opts.HTTPAddr + "/debug/vars", http.StatusNotFound, ""},
+		{"http://" + opts.DebugAddr + "/debug/vars", http.StatusOK, ""},
+		{"http://" + opts.DebugAddr + "/debug/pprof/cmdline", http.StatusOK, ""},
+	} {
+		code, body := get(t, tc.url)
+		if code != tc.wantCode || tc.wantBody != "" && body != tc.wantBody {
+			t.Errorf("GET %s = %d %q, want %d %q", tc.url, code, body, tc.wantCode, tc.wantBody)
+		}
+	}
+
+	cancel()
+	select {
+	case err := <-errc:
+		if err != nil {
+			t.Errorf("ListenAndServeOpts returned %v after ctx was canceled, want nil", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("ListenAndServeOpts didn't return after ctx was canceled")
+	}
+}
+
+func TestGracefulShutdown(t *testing.T) {
+	opts := &Options{HTTPAddr: freeAddr(t)}
+	started, release := make(chan bool), make(chan bool)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			started <- true
+			<-release
+		}
+		io.WriteString(w, "done")
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() { errc <- ListenAndServeOpts(ctx, handler, opts) }()
+	get(t, "http://"+opts.HTTPAddr+"/")
+
+	type result struct {
+		code int
+		body string
+	}
+	resc := make(chan result, 1)
+	go func() {
+		resp, err := http.Get("http://" + opts.HTTPAddr + "/slow")
+		if err != nil {
+			resc <- result{}
+			return
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		resc <- result{resp.StatusCode, string(body)}
+	}()
+	<-started
+	cancel()
+
+	select {
+	case err := <-errc:
+		t.Fatalf("ListenAndServeOpts returned %v with a request in flight", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	close(release)
+	if res := <-resc; res.code != http.StatusOK || res.body != "done" {
+		t.Errorf("in-flight request got %d %q, want 200 %q", res.code, res.body, "done")
+	}
+	if err := <-errc; err != nil {
+		t.Errorf("ListenAndServeOpts = %v, want nil", err)
+	}
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	opts := &Options{HTTPAddr: freeAddr(t), ShutdownTimeout: 50 * time.Millisecond}
+	started, release := make(chan bool), make(chan bool)
+	defer close(release)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			started <- true
+			<-release
+		}
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() { errc <- ListenAndServeOpts(ctx, handler, opts) }()
+	get(t, "http://"+opts.HTTPAddr+"/")
+	go http.Get("http://" + opts.HTTPAddr + "/slow")
+	<-started
+	cancel()
+	if err := <-errc; err == nil {
+		t.Errorf("ListenAndServeOpts = nil with a request outlasting the shutdown timeout, want error")
+	}
+}
@@ -0,0 +1,205 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package iapclient
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// minTokenLifetime is how long a cached token must remain valid to be
+// used, so that it doesn't expire in the middle of a request.
+const minTokenLifetime = 2 * time.Minute
+
+// A tokenCache stores an IAP token on disk, encrypted with a key kept
+// in a separate file, so that copies of the cache directory (such as
+// in backups) don't leak usable tokens.
+type tokenCache struct {
+	path    string // the encrypted token
+	keyPath string // the AES-256 key, in hex
+}
+
+// newTokenCache returns the cache of tokens for name, a string that
+// identifies the audience and identity of the tokens. The token is
+// stored in the user's cache directory, and the key in the user's
+// config directory alongside the refresh token.
+func newTokenCache(name string) (*tokenCache, error) {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return nil, err
+	}
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256([]byte(name))
+	return &tokenCache{
+		path:    filepath.Join(cacheDir, "gomote", "iap-token-"+hex.EncodeToString(sum[:8])),
+		keyPath: filepath.Join(configDir, "gomote", "iap-token-cache-key"),
+	}, nil
+}
+
+// key returns the encryption key, creating it if create is set and
+// there's none yet. It returns nil if there's no key.
+func (c *tokenCache) key(create bool) ([]byte, error) {
+	data, err := os.ReadFile(c.keyPath)
+	if err == nil {
+		key, err := hex.DecodeString(strings.TrimSpace(string(data)))
+		if err != nil || len(key) != 32 {
+			return nil, fmt.Errorf("malformed token cache key in %s", c.keyPath)
+		}
+		return key, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) || !create {
+		return nil, nil
+	}
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(c.keyPath), 0755); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(c.keyPath, []byte(hex.EncodeToString(key)+"\n"), 0600); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// load returns the cached token, or nil if there's none, or it can't
+// be decrypted, or it's about to expire.
+func (c *tokenCache) load() (*oauth2.Token, error) {
+	key, err := c.key(false)
+	if err != nil || key == nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(c.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < gcm.NonceSize() {
+		return nil, nil
+	}
+	plain, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if err != nil {
+		// Probably encrypted with a previous key.
+		return nil, nil
+	}
+	var tok oauth2.Token
+	if err := json.Unmarshal(plain, &tok); err != nil {
+		return nil, nil
+	}
+	if tok.AccessToken == "" || time.Until(tok.Expiry) < minTokenLifetime {
+		return nil, nil
+	}
+	return &tok, nil
+}
+
+// store caches tok.
+func (c *tokenCache) store(tok *oauth2.Token) error {
+	key, err := c.key(true)
+	if err != nil {
+		return err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return err
+	}
+	plain, err := json.Marshal(tok)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(c.path, gcm.Seal(nonce, nonce, plain, nil), 0600)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// cachingTokenSource is an oauth2.TokenSource that returns the token
+// in its cache while it's valid, and otherwise gets a new token from
+// its base source and caches it.
+type cachingTokenSource struct {
+	base  oauth2.TokenSource
+	cache *tokenCache
+
+	mu  sync.Mutex
+	tok *oauth2.Token
+}
+
+func (s *cachingTokenSource) Token() (*oauth2.Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.tok != nil && time.Until(s.tok.Expiry) >= minTokenLifetime {
+		return s.tok, nil
+	}
+	if tok, err := s.cache.load(); err == nil && tok != nil {
+		s.tok = tok
+		return tok, nil
+	}
+	tok, err := s.base.Token()
+	if err != nil {
+		return nil, err
+	}
+	if !tok.Expiry.IsZero() {
+		if err := s.cache.store(tok); err != nil {
+			fmt.Fprintf(os.Stderr, "warning: could not cache IAP token: %v\n", err)
+		}
+	}
+	s.tok = tok
+	return tok, nil
+}
+
+// jwtExpiry returns the expiration time of the JWT token, or the zero
+// time if it can't be determined.
+func jwtExpiry(token string) time.Time {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return time.Time{}
+	}
+	var claims struct {
+		Exp int64 `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.Exp == 0 {
+		return time.Time{}
+	}
+	return time.Unix(claims.Exp, 0)
+}
@@ -0,0 +1,126 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package iapclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+func testTokenCache(t *testing.T) *tokenCache {
+	dir := t.TempDir()
+	return &tokenCache{
+		path:    filepath.Join(dir, "cache", "token"),
+		keyPath: filepath.Join(dir, "config", "key"),
+	}
+}
+
+func TestTokenCache(t *testing.T) {
+	c := testTokenCache(t)
+	if tok, err := c.load(); tok != nil || err != nil {
+		t.Fatalf("load of empty cache = %v, %v; want nil, nil", tok, err)
+	}
+
+	want := &oauth2.Token{AccessToken: "secret", TokenType: "Bearer", Expiry: time.Now().Add(time.Hour).Round(time.Second)}
+	if err := c.store(want); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(c.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) == "" || bytes.Contains(data, []byte("secret")) {
+		t.Errorf("cached token isn't encrypted: %q", data)
+	}
+	got, err := c.load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got == nil || got.AccessToken != want.AccessToken || !got.Expiry.Equal(want.Expiry) {
+		t.Errorf("load = %+v; want %+v", got, want)
+	}
+
+	// A token about to expire isn't used.
+	if err := c.store(&oauth2.Token{AccessToken: "old", Expiry: time.Now().Add(time.Minute)}); err != nil {
+		t.Fatal(err)
+	}
+	if tok, err := c.load(); tok != nil || err != nil {
+		t.Errorf("load of expiring token = %v, %v; want nil, nil", tok, err)
+	}
+
+	// Neither is a token encrypted with another key.
+	if err := c.store(want); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(c.keyPath); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.key(true); err != nil {
+		t.Fatal(err)
+	}
+	if tok, err := c.load(); tok != nil || err != nil {
+		t.Errorf("load with a new key = %v, %v; want nil, nil", tok, err)
+	}
+}
+
+type countingTokenSource struct{ n int }
+
+func (s *countingTokenSource) Token() (*oauth2.Token, error) {
+	s.n++
+	return &oauth2.Token{AccessToken: fmt.Sprint("token", s.n), Expiry: time.Now().Add(time.Hour)}, nil
+}
+
+func TestCachingTokenSource(t *testing.T) {
+	c := testTokenCache(t)
+	base := new(countingTokenSource)
+	for i := 0; i < 2; i++ {
+		// A new source, as in a new gomote invocation, uses the
+		// token cached by the previous one.
+		ts := &cachingTokenSource{base: base, cache: c}
+		tok, err := ts.Token()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tok.AccessToken != "token1" {
+			t.Errorf("Token #%d = %q; want token1", i, tok.AccessToken)
+		}
+	}
+	if base.n != 1 {
+		t.Errorf("base source called %d times; want 1", base.n)
+	}
+}
+
+func TestJWTExpiry(t *testing.T) {
+	payload := base64.RawURLEncoding.EncodeToString([]byte(`{"aud":"x","exp":1700000000}`))
+	if got, want := jwtExpiry("header."+payload+".sig"), time.Unix(1700000000, 0); !got.Equal(want) {
+		t.Errorf("jwtExpiry = %v; want %v", got, want)
+	}
+	for _, tok := range []string{"", "a.b", "a.!!!.c", "a." + base64.RawURLEncoding.EncodeToString([]byte(`{}`)) + ".c"} {
+		if got := jwtExpiry(tok); !got.IsZero() {
+			t.Errorf("jwtExpiry(%q) = %v; want zero", tok, got)
+		}
+	}
+}
+
+func TestImpersonateWithoutCredentials(t *testing.T) {
+	// Without Application Default Credentials, impersonation fails
+	// rather than falling back to browser login.
+	t.Setenv("GOOGLE_APPLICATION_CREDENTIALS", filepath.Join(t.TempDir(), "missing.json"))
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	ts, err := TokenSource(context.Background(), ImpersonateServiceAccount("bot@example.iam.gserviceaccount.com"))
+	if err == nil || !strings.Contains(err.Error(), "impersonating bot@example.iam.gserviceaccount.com") {
+		t.Errorf("TokenSource = %v, %v; want impersonation error", ts, err)
+	}
+}
@@ -8,6 +8,15 @@
 // Login will be done as necessary using offline browser-based authentication,
 // similarly to gcloud auth login. Credentials will be stored in the user's
 // config directory.
+//
+// Alternatively, with the ImpersonateServiceAccount option, tokens are
+// obtained by impersonating a service account with the Application Default
+// Credentials, as set up by gcloud auth application-default login. If there
+// are no such credentials, or impersonation fails, an error is returned;
+// browser-based login is never used instead.
+//
+// IAP tokens are cached, encrypted, in the user's cache directory, and
+// refreshed automatically when they expire.
 package iapclient
 
 import (
@@ -27,6 +36,7 @@ import (
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
 	"google.golang.org/api/idtoken"
+	"google.golang.org/api/impersonate"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/oauth"
@@ -138,30 +148,85 @@ func cachedToken() (*oauth2.Token, error) {
 	return &refreshToken, nil
 }
 
+// An Option configures how TokenSource, HTTPClient and GRPCClient
+// authenticate and connect.
+type Option func(*options)
+
+type options struct {
+	serviceAccount string
+	dialOpts       []grpc.DialOption
+}
+
+// ImpersonateServiceAccount returns an Option to authenticate as the
+// service account with the given email, by impersonating it with the
+// Application Default Credentials. The caller must have the Service
+// Account Token Creator role on the service account. An empty email
+// has no effect.
+func ImpersonateServiceAccount(email string) Option {
+	return func(o *options) { o.serviceAccount = email }
+}
+
+// GRPCDialOptions returns an Option that makes GRPCClient dial with
+// opts too, such as interceptors. It has no effect on TokenSource and
+// HTTPClient.
+func GRPCDialOptions(opts ...grpc.DialOption) Option {
+	return func(o *options) { o.dialOpts = append(o.dialOpts, opts...) }
+}
+
 // TokenSource returns a TokenSource that can be used to access Go's
 // IAP-protected sites. It will prompt for login if necessary.
-func TokenSource(ctx context.Context) (oauth2.TokenSource, error) {
+func TokenSource(ctx context.Context, opts ...Option) (oauth2.TokenSource, error) {
 	const audience = "872405196845-b6fu2qpi0fehdssmc8qo47h2u3cepi0e.apps.googleusercontent.com" // Go build IAP client ID.
 
-	if metadata.OnGCE() {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	if metadata.OnGCE() && o.serviceAccount == "" {
 		if project, err := metadata.ProjectID(); err == nil && (project == "symbolic-datum-552" || project == "go-security-trybots") {
 			return idtoken.NewTokenSource(ctx, audience)
 		}
 	}
 
-	refresh, err := cachedToken()
-	if err != nil {
-		return nil, err
-	}
-	if refresh == nil {
-		refresh, err = login(ctx)
+	var base oauth2.TokenSource
+	cacheName := audience
+	if o.serviceAccount != "" {
+		if _, err := google.FindDefaultCredentials(ctx); err != nil {
+			return nil, fmt.Errorf("impersonating %s: no Application Default Credentials: %v", o.serviceAccount, err)
+		}
+		var err error
+		base, err = impersonate.IDTokenSource(ctx, impersonate.IDTokenConfig{
+			Audience:        audience,
+			TargetPrincipal: o.serviceAccount,
+			IncludeEmail:    true,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("impersonating %s: %v", o.serviceAccount, err)
+		}
+		cacheName += " " + o.serviceAccount
+	} else {
+		refresh, err := cachedToken()
 		if err != nil {
 			return nil, err
 		}
+		if refresh == nil {
+			refresh, err = login(ctx)
+			if err != nil {
+				return nil, err
+			}
+		}
+		base = &jwtTokenSource{gomoteConfig, audience, refresh}
 	}
-	tokenSource := oauth2.ReuseTokenSource(nil, &jwtTokenSource{gomoteConfig, audience, refresh})
+	if cache, err := newTokenCache(cacheName); err == nil {
+		base = &cachingTokenSource{base: base, cache: cache}
+	}
+	tokenSource := oauth2.ReuseTokenSource(nil, base)
 	// Eagerly request a token to verify we're good. The source will cache it.
 	if _, err := tokenSource.Token(); err != nil {
+		if o.serviceAccount != "" {
+			return nil, fmt.Errorf("impersonating %s: %v", o.serviceAccount, err)
+		}
 		return nil, err
 	}
 	return tokenSource, nil
@@ -169,8 +234,8 @@ func TokenSource(ctx context.Context) (oauth2.TokenSource, error) {
 
 // HTTPClient returns an http.Client that can be used to access Go's
 // IAP-protected sites. It will prompt for login if necessary.
-func HTTPClient(ctx context.Context) (*http.Client, error) {
-	ts, err := TokenSource(ctx)
+func HTTPClient(ctx context.Context, opts ...Option) (*http.Client, error) {
+	ts, err := TokenSource(ctx, opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -179,17 +244,22 @@ func HTTPClient(ctx context.Context) (*http.Client, error) {
 
 // GRPCClient returns a *gprc.ClientConn that can access Go's IAP-protected
 // servers. It will prompt for login if necessary.
-func GRPCClient(ctx context.Context, addr string) (*grpc.ClientConn, error) {
-	ts, err := TokenSource(ctx)
+func GRPCClient(ctx context.Context, addr string, opts ...Option) (*grpc.ClientConn, error) {
+	ts, err := TokenSource(ctx, opts...)
 	if err != nil {
 		return nil, err
 	}
-	opts := []grpc.DialOption{
+	dialOpts := []grpc.DialOption{
 		grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{InsecureSkipVerify: strings.HasPrefix(addr, "localhost:")})),
 		grpc.WithDefaultCallOptions(grpc.PerRPCCredentials(oauth.TokenSource{TokenSource: ts})),
 		grpc.WithBlock(),
 	}
-	return grpc.DialContext(ctx, addr, opts...)
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	dialOpts = append(dialOpts, o.dialOpts...)
+	return grpc.DialContext(ctx, addr, dialOpts...)
 }
 
 type jwtTokenSource struct {
@@ -227,6 +297,7 @@ func (s *jwtTokenSource) Token() (*oauth2.Token, error) {
 	return &oauth2.Token{
 		TokenType:   "Bearer",
 		AccessToken: token.IDToken,
+		Expiry:      jwtExpiry(token.IDToken),
 	}, nil
 }
 
@@ -0,0 +1,101 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package releaselog
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"strings"
+
+	"golang.org/x/mod/sumdb/note"
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+// A Client looks up records in a release log served over HTTP, and
+// verifies them.
+type Client struct {
+	URL        string        // the base URL of the log's files
+	Verifier   note.Verifier // verifies the log's checkpoints
+	HTTPClient *http.Client  // if nil, http.DefaultClient is used
+}
+
+// Checkpoint returns the log's latest tree, after verifying its
+// signature.
+func (c *Client) Checkpoint(ctx context.Context) (tlog.Tree, error) {
+	msg, err := c.get(ctx, "checkpoint")
+	if err != nil {
+		return tlog.Tree{}, err
+	}
+	return openCheckpoint(msg, c.Verifier)
+}
+
+// Lookup returns the record of the release file filename in tree,
+// which must be a verified tree of the log, such as one returned by
+// Checkpoint. The record is proven to be in tree. If the log has no
+// record of the file, Lookup returns an error that matches
+// fs.ErrNotExist.
+func (c *Client) Lookup(ctx context.Context, tree tlog.Tree, filename string) (Record, error) {
+	tr := c.tileReader(ctx)
+	r, ok, err := lookup(tr, tlog.TileHashReader(tree, tr), tree, filename)
+	if err != nil {
+		return Record{}, err
+	}
+	if !ok {
+		return Record{}, fmt.Errorf("%s: %w", filename, fs.ErrNotExist)
+	}
+	return r, nil
+}
+
+// CheckConsistency verifies that old, a tree of the log seen earlier,
+// is a prefix of tree, that is, that the log has only been appended to
+// since. Clients that keep the last tree they verified should check
+// that each new one is consistent with it, to detect a log that shows
+// different records to different clients.
+func (c *Client) CheckConsistency(ctx context.Context, old, tree tlog.Tree) error {
+	if old.N > tree.N {
+		return fmt.Errorf("tree of size %d is older than the tree of size %d", tree.N, old.N)
+	}
+	h, err := tlog.TreeHash(old.N, tlog.TileHashReader(tree, c.tileReader(ctx)))
+	if err != nil {
+		return err
+	}
+	if h != old.Hash {
+		return fmt.Errorf("log has forked: tree of size %d isn't a prefix of the tree of size %d", old.N, tree.N)
+	}
+	return nil
+}
+
+func (c *Client) tileReader(ctx context.Context) *tileReader {
+	return &tileReader{read: func(path string) ([]byte, error) { return c.get(ctx, path) }}
+}
+
+// get fetches the named file of the log. It returns an error that
+// matches fs.ErrNotExist if there's no such file.
+func (c *Client) get(ctx context.Context, name string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", strings.TrimSuffix(c.URL, "/")+"/"+name, nil)
+	if err != nil {
+		return nil, err
+	}
+	hc := c.HTTPClient
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	resp, err := hc.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, &fs.PathError{Op: "get", Path: req.URL.String(), Err: fs.ErrNotExist}
+	default:
+		return nil, fmt.Errorf("GET %s: %s", req.URL, resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+}
@@ -0,0 +1,430 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package releaselog implements a transparency log of the checksums of
+// Go release files, so that downstream distributors can detect release
+// files that were tampered with or published by mistake.
+//
+// The log is a tiled Merkle tree in the format of the Go checksum
+// database (see golang.org/x/mod/sumdb/tlog), stored as static files
+// that can be served over HTTP by any file server:
+//
+//	checkpoint           the signed note of the latest tree
+//	tile/8/L/N[.p/W]     hash tiles
+//	tile/8/data/N[.p/W]  data tiles: the records, one per line
+//	lookup/<filename>    the index of the record of a release file
+//	pending/N            the records appended at index N, written
+//	                     before they're added to the tree
+//
+// Relui appends the records of a release's files to the log when it
+// publishes them, and Client looks up and verifies records.
+package releaselog
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/build/internal/gcsfs"
+	"golang.org/x/mod/sumdb/note"
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+// tileHeight is the height of the log's tiles.
+const tileHeight = 8
+
+// A Record is the log entry of a release file.
+type Record struct {
+	Filename string // e.g. "go1.21.0.linux-amd64.tar.gz"
+	Version  string // e.g. "go1.21.0"
+	Size     int64
+	SHA256   string // hex-encoded
+}
+
+// text returns the text of r in the log.
+func (r Record) text() []byte {
+	return []byte(fmt.Sprintf("%s %s %d %s\n", r.Filename, r.Version, r.Size, r.SHA256))
+}
+
+func (r Record) validate() error {
+	if r.Filename == "" || strings.ContainsAny(r.Filename, " \n/\\") || r.Filename[0] == '.' {
+		return fmt.Errorf("invalid filename %q", r.Filename)
+	}
+	if r.Version == "" || strings.ContainsAny(r.Version, " \n") {
+		return fmt.Errorf("invalid version %q for %s", r.Version, r.Filename)
+	}
+	if r.Size < 0 {
+		return fmt.Errorf("invalid size %d for %s", r.Size, r.Filename)
+	}
+	if b, err := hex.DecodeString(r.SHA256); err != nil || len(b) != 32 || strings.ToLower(r.SHA256) != r.SHA256 {
+		return fmt.Errorf("invalid SHA-256 %q for %s", r.SHA256, r.Filename)
+	}
+	return nil
+}
+
+func parseRecord(line []byte) (Record, error) {
+	f := strings.Fields(string(line))
+	if len(f) != 4 {
+		return Record{}, fmt.Errorf("malformed record %q", line)
+	}
+	size, err := strconv.ParseInt(f[2], 10, 64)
+	if err != nil {
+		return Record{}, fmt.Errorf("malformed record %q", line)
+	}
+	r := Record{Filename: f[0], Version: f[1], Size: size, SHA256: f[3]}
+	if err := r.validate(); err != nil {
+		return Record{}, err
+	}
+	if !bytes.Equal(r.text(), line) {
+		return Record{}, fmt.Errorf("non-canonical record %q", line)
+	}
+	return r, nil
+}
+
+// A Log appends records to a release log stored in a file system
+// created by gcsfs.
+type Log struct {
+	FS       fs.FS
+	Signer   note.Signer   // signs new checkpoints
+	Verifier note.Verifier // verifies the stored checkpoint
+
+	mu sync.Mutex
+}
+
+// Append appends records to the log, and returns once the checkpoint
+// that includes them is stored. It skips the records that are already
+// in the log, so that it can be retried, and fails without appending
+// any records if the log has a different record for one of their
+// files.
+//
+// Appends to the same log may run at the same time, in this process or
+// others. Each claims the end of the log by creating pending/N, where
+// N is the size of the tree it read, and only then adds its records.
+// An append that finds a claim completes it and starts over, so the
+// log grows even if the append that made the claim fails. The
+// checkpoint is only replaced if it hasn't changed since it was read,
+// so that it always extends the previous one.
+func (l *Log) Append(ctx context.Context, records []Record) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, r := range records {
+		if err := r.validate(); err != nil {
+			return err
+		}
+	}
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		done, err := l.tryAppend(ctx, records)
+		if err != nil || done {
+			return err
+		}
+	}
+}
+
+// tryAppend attempts to append records to the log, and reports whether
+// they're in it. It returns false and no error if another append got
+// in the way, in which case it should be tried again.
+func (l *Log) tryAppend(ctx context.Context, records []Record) (bool, error) {
+	tree, gen, err := l.tree()
+	if err != nil {
+		return false, err
+	}
+	tr := &tileReader{read: func(path string) ([]byte, error) { return fs.ReadFile(l.FS, path) }}
+
+	// Complete the append that claimed the end of the log, if any.
+	claimed, err := fs.ReadFile(l.FS, pendingPath(tree.N))
+	if err == nil {
+		return false, l.commit(ctx, tr, tree, gen, splitRecords(claimed))
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return false, err
+	}
+
+	old := tlog.TileHashReader(tree, tr)
+	var add [][]byte
+	seen := map[string]Record{}
+	for _, r := range records {
+		if prev, ok := seen[r.Filename]; ok {
+			if prev != r {
+				return false, fmt.Errorf("conflicting records for %s", r.Filename)
+			}
+			continue
+		}
+		seen[r.Filename] = r
+		logged, ok, err := lookup(tr, old, tree, r.Filename)
+		if err != nil {
+			return false, err
+		}
+		if ok && logged != r {
+			return false, fmt.Errorf("%s is already logged as %+v, not %+v", r.Filename, logged, r)
+		}
+		if !ok {
+			add = append(add, r.text())
+		}
+	}
+	if len(add) == 0 {
+		return true, nil
+	}
+	err = gcsfs.WriteFileIfGeneration(l.FS, pendingPath(tree.N), bytes.Join(add, nil), 0)
+	if errors.Is(err, gcsfs.ErrGenerationMismatch) {
+		// Another append claimed the end of the log first.
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	if err := l.commit(ctx, tr, tree, gen, add); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// pendingPath returns the path of the claim of the append at index n.
+func pendingPath(n int64) string {
+	return fmt.Sprintf("pending/%d", n)
+}
+
+// commit adds the records add, which were claimed at the end of tree,
+// to the log: it writes their tiles and lookup entries, then replaces
+// the checkpoint of tree, which is at generation gen, with one that
+// includes them. Everything it writes is determined by tree and add,
+// so appends can commit the same claim at the same time. If the
+// checkpoint changed since it was read, the claim was already
+// committed, and commit succeeds without replacing it.
+func (l *Log) commit(ctx context.Context, tr *tileReader, tree tlog.Tree, gen int64, add [][]byte) error {
+	if len(add) == 0 {
+		return fmt.Errorf("empty claim %s", pendingPath(tree.N))
+	}
+	for _, text := range add {
+		if _, err := parseRecord(text); err != nil {
+			return fmt.Errorf("claim %s: %v", pendingPath(tree.N), err)
+		}
+	}
+
+	// Compute the hashes stored for the new records, which may
+	// depend on those already in the log.
+	old := tlog.TileHashReader(tree, tr)
+	oldCount := tlog.StoredHashCount(tree.N)
+	var hashes []tlog.Hash
+	hr := tlog.HashReaderFunc(func(indexes []int64) ([]tlog.Hash, error) {
+		var out []tlog.Hash
+		for _, x := range indexes {
+			if x >= oldCount {
+				out = append(out, hashes[x-oldCount])
+				continue
+			}
+			h, err := old.ReadHashes([]int64{x})
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, h[0])
+		}
+		return out, nil
+	})
+	for i, text := range add {
+		h, err := tlog.StoredHashes(tree.N+int64(i), text, hr)
+		if err != nil {
+			return err
+		}
+		hashes = append(hashes, h...)
+	}
+	newTree := tlog.Tree{N: tree.N + int64(len(add))}
+	var err error
+	if newTree.Hash, err = tlog.TreeHash(newTree.N, hr); err != nil {
+		return err
+	}
+
+	// Write the new tiles and lookup entries before the checkpoint,
+	// which commits them.
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	partialStart := tree.N >> tileHeight << tileHeight
+	var partial [][]byte // the records of the tree's last partial data tile
+	if w := tree.N - partialStart; w != 0 {
+		data, err := tr.read(tlog.Tile{H: tileHeight, L: -1, N: tree.N >> tileHeight, W: int(w)}.Path())
+		if err != nil {
+			return err
+		}
+		partial = splitRecords(data)
+	}
+	for _, t := range tlog.NewTiles(tileHeight, tree.N, newTree.N) {
+		data, err := tlog.ReadTileData(t, hr)
+		if err != nil {
+			return err
+		}
+		if err := writeFile(l.FS, t.Path(), data); err != nil {
+			return err
+		}
+		if t.L != 0 {
+			continue
+		}
+		var recs []byte
+		for n := t.N << tileHeight; n < t.N<<tileHeight+int64(t.W); n++ {
+			switch {
+			case n >= tree.N:
+				recs = append(recs, add[n-tree.N]...)
+			case n >= partialStart && n-partialStart < int64(len(partial)):
+				recs = append(recs, partial[n-partialStart]...)
+			default:
+				return fmt.Errorf("tile %v rewrites record %d", t.Path(), n)
+			}
+		}
+		dt := t
+		dt.L = -1
+		if err := writeFile(l.FS, dt.Path(), recs); err != nil {
+			return err
+		}
+	}
+	for i, text := range add {
+		r, _ := parseRecord(text)
+		if err := writeFile(l.FS, "lookup/"+r.Filename, []byte(fmt.Sprintf("%d\n", tree.N+int64(i)))); err != nil {
+			return err
+		}
+	}
+	msg, err := note.Sign(&note.Note{Text: string(tlog.FormatTree(newTree))}, l.Signer)
+	if err != nil {
+		return err
+	}
+	err = gcsfs.WriteFileIfGeneration(l.FS, "checkpoint", msg, gen)
+	if errors.Is(err, gcsfs.ErrGenerationMismatch) {
+		// Another append committed the claim first.
+		return nil
+	}
+	return err
+}
+
+// writeFile writes the named file of the log to fsys, replacing any
+// existing one. GCS replaces files when they're written, but
+// gcsfs.DirFS doesn't. Files that another append already wrote are
+// left alone.
+func writeFile(fsys fs.FS, name string, data []byte) error {
+	if old, err := fs.ReadFile(fsys, name); err == nil && bytes.Equal(old, data) {
+		return nil
+	}
+	err := gcsfs.WriteFile(fsys, name, data)
+	if err == nil {
+		return nil
+	}
+	if _, statErr := fs.Stat(fsys, name); statErr != nil {
+		return err
+	}
+	if err := gcsfs.Remove(fsys, name); err != nil {
+		return err
+	}
+	return gcsfs.WriteFile(fsys, name, data)
+}
+
+// tree returns the tree of the stored checkpoint and the checkpoint's
+// generation, or the empty tree and 0 if there's none yet.
+func (l *Log) tree() (tlog.Tree, int64, error) {
+	msg, gen, err := gcsfs.ReadFileGeneration(l.FS, "checkpoint")
+	if errors.Is(err, fs.ErrNotExist) {
+		return tlog.Tree{}, 0, nil
+	} else if err != nil {
+		return tlog.Tree{}, 0, err
+	}
+	tree, err := openCheckpoint(msg, l.Verifier)
+	return tree, gen, err
+}
+
+func openCheckpoint(msg []byte, v note.Verifier) (tlog.Tree, error) {
+	n, err := note.Open(msg, note.VerifierList(v))
+	if err != nil {
+		return tlog.Tree{}, fmt.Errorf("opening checkpoint: %w", err)
+	}
+	return tlog.ParseTree([]byte(n.Text))
+}
+
+// lookup returns the record of filename in tree, and whether there is
+// one, verifying that it's in the tree.
+func lookup(tr *tileReader, hr tlog.HashReader, tree tlog.Tree, filename string) (Record, bool, error) {
+	data, err := tr.read("lookup/" + filename)
+	if errors.Is(err, fs.ErrNotExist) {
+		return Record{}, false, nil
+	} else if err != nil {
+		return Record{}, false, err
+	}
+	id, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil || id < 0 {
+		return Record{}, false, fmt.Errorf("malformed lookup entry %q for %s", data, filename)
+	}
+	if id >= tree.N {
+		// Left behind by an Append that failed.
+		return Record{}, false, nil
+	}
+	t := tlog.Tile{H: tileHeight, L: -1, N: id >> tileHeight, W: 1 << tileHeight}
+	if end := (t.N + 1) << tileHeight; end > tree.N {
+		t.W = int(tree.N - t.N<<tileHeight)
+	}
+	data, err = tr.read(t.Path())
+	if err != nil {
+		return Record{}, false, err
+	}
+	recs := splitRecords(data)
+	if int64(len(recs)) != int64(t.W) {
+		return Record{}, false, fmt.Errorf("data tile %s has %d records, want %d", t.Path(), len(recs), t.W)
+	}
+	text := recs[id-t.N<<tileHeight]
+	hashes, err := hr.ReadHashes([]int64{tlog.StoredHashIndex(0, id)})
+	if err != nil {
+		return Record{}, false, err
+	}
+	if hashes[0] != tlog.RecordHash(text) {
+		return Record{}, false, fmt.Errorf("record %d isn't in the tree of size %d", id, tree.N)
+	}
+	r, err := parseRecord(text)
+	if err != nil {
+		return Record{}, false, err
+	}
+	if r.Filename != filename {
+		return Record{}, false, fmt.Errorf("lookup entry of %s is the record of %s", filename, r.Filename)
+	}
+	return r, true, nil
+}
+
+// splitRecords splits a data tile into its records.
+func splitRecords(data []byte) [][]byte {
+	var recs [][]byte
+	for len(data) > 0 {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			i = len(data) - 1
+		}
+		recs = append(recs, data[:i+1])
+		data = data[i+1:]
+	}
+	return recs
+}
+
+// A tileReader reads tiles of height tileHeight with read, which reads
+// a file of the log.
+type tileReader struct {
+	read func(path string) ([]byte, error)
+}
+
+func (r *tileReader) Height() int { return tileHeight }
+
+func (r *tileReader) ReadTiles(tiles []tlog.Tile) ([][]byte, error) {
+	data := make([][]byte, len(tiles))
+	for i, t := range tiles {
+		var err error
+		if data[i], err = r.read(t.Path()); err != nil {
+			return nil, err
+		}
+		if len(data[i]) != t.W*tlog.HashSize {
+			return nil, fmt.Errorf("tile %s has %d bytes, want %d", t.Path(), len(data[i]), t.W*tlog.HashSize)
+		}
+	}
+	return data, nil
+}
+
+func (r *tileReader) SaveTiles([]tlog.Tile, [][]byte) {}
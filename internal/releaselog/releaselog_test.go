@@ -0,0 +1,248 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package releaselog
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"golang.org/x/build/internal/gcsfs"
+	"golang.org/x/mod/sumdb/note"
+	"golang.org/x/mod/sumdb/tlog"
+	"golang.org/x/sync/errgroup"
+)
+
+func testRecord(version, filename string) Record {
+	return Record{
+		Filename: filename,
+		Version:  version,
+		Size:     int64(len(filename)),
+		SHA256:   fmt.Sprintf("%x", sha256.Sum256([]byte(filename))),
+	}
+}
+
+func testRelease(version string, n int) []Record {
+	var recs []Record
+	for i := 0; i < n; i++ {
+		recs = append(recs, testRecord(version, fmt.Sprintf("%s.file%d.tar.gz", version, i)))
+	}
+	return recs
+}
+
+func TestLog(t *testing.T) {
+	ctx := context.Background()
+	skey, vkey, err := note.GenerateKey(rand.Reader, "releaselog.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := note.NewSigner(skey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier, err := note.NewVerifier(vkey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	l := &Log{FS: gcsfs.DirFS(dir), Signer: signer, Verifier: verifier}
+	srv := httptest.NewServer(http.FileServer(http.Dir(dir)))
+	defer srv.Close()
+	c := &Client{URL: srv.URL, Verifier: verifier}
+
+	// Log releases of various sizes, so that the log spans several
+	// full and partial tiles.
+	var all []Record
+	for i, n := range []int{3, 1, 300, 10} {
+		recs := testRelease(fmt.Sprintf("go1.21.%d", i), n)
+		if err := l.Append(ctx, recs); err != nil {
+			t.Fatalf("Append(release %d) = %v", i, err)
+		}
+		all = append(all, recs...)
+	}
+	tree, err := c.Checkpoint(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tree.N != int64(len(all)) {
+		t.Fatalf("log has %d records, want %d", tree.N, len(all))
+	}
+	for _, want := range all {
+		got, err := c.Lookup(ctx, tree, want.Filename)
+		if err != nil {
+			t.Fatalf("Lookup(%s) = %v", want.Filename, err)
+		}
+		if got != want {
+			t.Errorf("Lookup(%s) = %+v, want %+v", want.Filename, got, want)
+		}
+	}
+	if _, err := c.Lookup(ctx, tree, "go1.22.0.src.tar.gz"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Lookup of an unlogged file = %v, want ErrNotExist", err)
+	}
+
+	// Appending the same records again, as a retried task does,
+	// leaves the log as it is.
+	if err := l.Append(ctx, all[:5]); err != nil {
+		t.Fatalf("Append of logged records = %v", err)
+	}
+	if again, err := c.Checkpoint(ctx); err != nil || again != tree {
+		t.Errorf("Append of logged records changed the tree from %v to %v (%v)", tree, again, err)
+	}
+	// A different record for a logged file is refused.
+	changed := all[0]
+	changed.SHA256 = strings.Repeat("0", 64)
+	if err := l.Append(ctx, []Record{testRecord("go1.21.4", "go1.21.4.src.tar.gz"), changed}); err == nil || !strings.Contains(err.Error(), "already logged") {
+		t.Errorf("Append of a changed record = %v, want already logged error", err)
+	}
+
+	// Later trees are consistent with earlier ones.
+	old := tree
+	if err := l.Append(ctx, testRelease("go1.21.4", 2)); err != nil {
+		t.Fatal(err)
+	}
+	if tree, err = c.Checkpoint(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.CheckConsistency(ctx, old, tree); err != nil {
+		t.Errorf("CheckConsistency(old, new) = %v", err)
+	}
+	forked := old
+	forked.Hash[0] ^= 1
+	if err := c.CheckConsistency(ctx, forked, tree); err == nil {
+		t.Errorf("CheckConsistency of a forked tree succeeded")
+	}
+
+	// A record that was tampered with fails verification.
+	path := filepath.Join(dir, "tile/8/data/000")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(strings.Replace(string(data), all[1].SHA256, all[0].SHA256, 1)), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Lookup(ctx, tree, all[1].Filename); err == nil {
+		t.Errorf("Lookup of a tampered record succeeded")
+	}
+
+	// So does a checkpoint signed by another key.
+	_, otherKey, _ := note.GenerateKey(rand.Reader, "releaselog.test")
+	other, _ := note.NewVerifier(otherKey)
+	if _, err := (&Client{URL: srv.URL, Verifier: other}).Checkpoint(ctx); err == nil {
+		t.Errorf("Checkpoint with the wrong key succeeded")
+	}
+}
+
+func TestConcurrentAppend(t *testing.T) {
+	ctx := context.Background()
+	skey, vkey, err := note.GenerateKey(rand.Reader, "releaselog.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, _ := note.NewSigner(skey)
+	verifier, _ := note.NewVerifier(vkey)
+	dir := t.TempDir()
+	srv := httptest.NewServer(http.FileServer(http.Dir(dir)))
+	defer srv.Close()
+	c := &Client{URL: srv.URL, Verifier: verifier}
+
+	// An append that claimed the end of the log and then failed is
+	// completed by the next one.
+	abandoned := testRelease("go1.20.0", 3)
+	var claim []byte
+	for _, r := range abandoned {
+		claim = append(claim, r.text()...)
+	}
+	if err := gcsfs.WriteFile(gcsfs.DirFS(dir), pendingPath(0), claim); err != nil {
+		t.Fatal(err)
+	}
+
+	// Two processes append releases to the same log at once, like
+	// the tasks publishing paired minor releases.
+	const releases = 20
+	var (
+		mu       sync.Mutex
+		appended = append([]Record(nil), abandoned...)
+		trees    []tlog.Tree // the trees seen after each append
+	)
+	var eg errgroup.Group
+	for _, major := range []string{"go1.21", "go1.22"} {
+		major := major
+		l := &Log{FS: gcsfs.DirFS(dir), Signer: signer, Verifier: verifier}
+		eg.Go(func() error {
+			for i := 0; i < releases; i++ {
+				recs := testRelease(fmt.Sprintf("%s.%d", major, i), 1+i%7)
+				if err := l.Append(ctx, recs); err != nil {
+					return fmt.Errorf("Append(%s.%d) = %v", major, i, err)
+				}
+				tree, err := c.Checkpoint(ctx)
+				if err != nil {
+					return err
+				}
+				mu.Lock()
+				appended = append(appended, recs...)
+				trees = append(trees, tree)
+				mu.Unlock()
+			}
+			return nil
+		})
+	}
+	if err := eg.Wait(); err != nil {
+		t.Fatal(err)
+	}
+
+	tree, err := c.Checkpoint(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tree.N != int64(len(appended)) {
+		t.Errorf("log has %d records, want %d", tree.N, len(appended))
+	}
+	for _, want := range appended {
+		got, err := c.Lookup(ctx, tree, want.Filename)
+		if err != nil || got != want {
+			t.Errorf("Lookup(%s) = %+v, %v; want %+v", want.Filename, got, err, want)
+		}
+	}
+	for _, old := range trees {
+		if err := c.CheckConsistency(ctx, old, tree); err != nil {
+			t.Errorf("CheckConsistency(%v, %v) = %v; the log forked", old, tree, err)
+		}
+	}
+}
+
+func TestRecordValidate(t *testing.T) {
+	good := testRecord("go1.21.0", "go1.21.0.src.tar.gz")
+	if err := good.validate(); err != nil {
+		t.Fatalf("validate(%+v) = %v", good, err)
+	}
+	if r, err := parseRecord(good.text()); err != nil || r != good {
+		t.Errorf("parseRecord(%q) = %+v, %v; want %+v", good.text(), r, err, good)
+	}
+	for _, f := range []func(*Record){
+		func(r *Record) { r.Filename = "../checkpoint" },
+		func(r *Record) { r.Filename = "go1.21.0 src.tar.gz" },
+		func(r *Record) { r.Version = "" },
+		func(r *Record) { r.Size = -1 },
+		func(r *Record) { r.SHA256 = "abc" },
+		func(r *Record) { r.SHA256 = strings.ToUpper(r.SHA256) },
+	} {
+		r := good
+		f(&r)
+		if err := r.validate(); err == nil {
+			t.Errorf("validate(%+v) succeeded, want error", r)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package releasestatus fetches the status of the releases in progress,
+// as published by relui, for the dashboards that show it.
+package releasestatus
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"golang.org/x/build/types"
+)
+
+// Get returns the status of the releases in progress, as published by
+// relui at url. It returns nil if url is empty or the status is
+// unavailable. Errors are only logged, so that a missing status doesn't
+// break the page showing it.
+func Get(ctx context.Context, url string) *types.ReleaseStatus {
+	if url == "" {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		log.Printf("releasestatus.Get: %v", err)
+		return nil
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		log.Printf("releasestatus.Get: Do: %v", err)
+		return nil
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		log.Printf("releasestatus.Get: %v", res.Status)
+		return nil
+	}
+	status := new(types.ReleaseStatus)
+	if err := json.NewDecoder(res.Body).Decode(status); err != nil {
+		log.Printf("releasestatus.Get: JSON decode: %v", err)
+		return nil
+	}
+	return status
+}
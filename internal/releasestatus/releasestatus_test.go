@@ -0,0 +1,37 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package releasestatus
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGet(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"workflows": [{"name": "Minor releases for Go 1.21 and 1.20", "steps": ["Build"], "tasksDone": 3, "tasksTotal": 10}]}`))
+	}))
+	defer ts.Close()
+
+	st := Get(context.Background(), ts.URL)
+	if st == nil || len(st.Workflows) != 1 {
+		t.Fatalf("Get() = %+v, want one workflow", st)
+	}
+	if got := st.Workflows[0]; got.Name != "Minor releases for Go 1.21 and 1.20" || got.TasksDone != 3 || got.TasksTotal != 10 {
+		t.Errorf("Get().Workflows[0] = %+v", got)
+	}
+
+	if st := Get(context.Background(), ""); st != nil {
+		t.Errorf("Get() with no URL = %+v, want nil", st)
+	}
+
+	notFound := httptest.NewServer(http.NotFoundHandler())
+	defer notFound.Close()
+	if st := Get(context.Background(), notFound.URL); st != nil {
+		t.Errorf("Get() of missing status = %+v, want nil", st)
+	}
+}
@@ -0,0 +1,199 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package relnote drafts the release notes of a Go release from the
+// RELNOTE annotations on its CLs and the API additions listed in the
+// api/next directory of the main Go repository.
+package relnote
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A Note is an entry in the release notes.
+type Note struct {
+	// Package is the import path of the package the note is about,
+	// or "" if it isn't known.
+	Package string
+	// CL is the number of the CL the note came from, if any.
+	CL int
+	// Issue is the number of the issue, typically an accepted
+	// proposal, that the note is about, if any.
+	Issue int
+	// Text is the text of the note: the RELNOTE annotation, or the
+	// subject of the CL if the annotation was just "yes".
+	Text string
+	// API is the list of API additions the note is about, in the
+	// format of the api/next files.
+	API []string
+}
+
+// DevCycleStart returns the approximate start of the development cycle
+// of Go 1.x, the date after which changes are for its release notes.
+// Releases are every 6 months; the cycle of Go 1.8 started in August 2016.
+func DevCycleStart(x int) time.Time {
+	return time.Date(2016, time.August, 1, 0, 0, 0, 0, time.UTC).AddDate(0, 6*(x-8), 0)
+}
+
+// PackagePrefix returns the package prefix at the start of s.
+// For example PackagePrefix("net/http: add HTTP 5 support") == "net/http".
+// If there's no package prefix, PackagePrefix returns "".
+func PackagePrefix(s string) string {
+	i := strings.Index(s, ":")
+	if i < 0 {
+		return ""
+	}
+	s = s[:i]
+	if strings.Trim(s, "abcdefghijklmnopqrstuvwxyz0123456789/") != "" {
+		return ""
+	}
+	return s
+}
+
+// ParseRelNote parses a RELNOTE annotation from the string s.
+// It returns the empty string if no such annotation exists.
+func ParseRelNote(s string) string {
+	m := relNoteRx.FindStringSubmatch(s)
+	if m == nil {
+		return ""
+	}
+	return strings.TrimSpace(m[1])
+}
+
+var relNoteRx = regexp.MustCompile(`RELNOTES?=(.+)`)
+
+// CLNote returns the note for a CL with the given number and subject
+// that has the RELNOTE annotation relnote.
+func CLNote(number int, subject, relnote string) Note {
+	pkg := PackagePrefix(subject)
+	text := strings.TrimSpace(strings.TrimPrefix(subject, pkg+":"))
+	if relnote != "yes" && relnote != "y" {
+		text += "; " + relnote
+	}
+	return Note{Package: pkg, CL: number, Text: text}
+}
+
+// ParseAPI parses the contents of an api/next file, and returns a note
+// for each package and issue that it adds API for. Lines look like
+//
+//	pkg net/http, method (*Request) PathValue(string) string #61410
+func ParseAPI(data []byte) ([]Note, error) {
+	type key struct {
+		pkg   string
+		issue int
+	}
+	var notes []Note
+	index := make(map[key]int)
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		pkg, api, ok := strings.Cut(strings.TrimPrefix(line, "pkg "), ", ")
+		if !ok || !strings.HasPrefix(line, "pkg ") {
+			return nil, fmt.Errorf("malformed API line %q", line)
+		}
+		// Drop build contexts, as in "pkg syscall (windows-386), ...".
+		pkg, _, _ = strings.Cut(pkg, " ")
+		var issue int
+		if i := strings.LastIndex(api, " #"); i >= 0 {
+			n, err := strconv.Atoi(api[i+len(" #"):])
+			if err != nil {
+				return nil, fmt.Errorf("malformed issue number in API line %q", line)
+			}
+			api, issue = api[:i], n
+		}
+		k := key{pkg, issue}
+		i, ok := index[k]
+		if !ok {
+			i = len(notes)
+			index[k] = i
+			notes = append(notes, Note{Package: pkg, Issue: issue})
+		}
+		notes[i].API = append(notes[i].API, api)
+	}
+	return notes, sc.Err()
+}
+
+// Markdown returns a draft of the release notes of Go 1.x made of
+// notes, with a section for each package.
+func Markdown(x int, notes []Note) string {
+	byPkg := make(map[string][]Note)
+	for _, n := range notes {
+		byPkg[n.Package] = append(byPkg[n.Package], n)
+	}
+	var tools, std []string
+	for pkg, notes := range byPkg {
+		sort.SliceStable(notes, func(i, j int) bool {
+			x, y := notes[i], notes[j]
+			if x.Issue != y.Issue {
+				return x.Issue < y.Issue
+			}
+			return x.CL < y.CL
+		})
+		switch {
+		case pkg == "":
+		case pkg == "cmd" || strings.HasPrefix(pkg, "cmd/"):
+			tools = append(tools, pkg)
+		default:
+			std = append(std, pkg)
+		}
+	}
+	sort.Strings(tools)
+	sort.Strings(std)
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "# Go 1.%d release notes (draft)\n", x)
+	section := func(title string, pkgs []string) {
+		if len(pkgs) == 0 {
+			return
+		}
+		fmt.Fprintf(&buf, "\n## %s\n", title)
+		for _, pkg := range pkgs {
+			fmt.Fprintf(&buf, "\n### %s\n\n", pkg)
+			for _, n := range byPkg[pkg] {
+				writeNote(&buf, n)
+			}
+		}
+	}
+	section("Tools", tools)
+	section("Standard library", std)
+	if notes := byPkg[""]; len(notes) > 0 {
+		fmt.Fprintf(&buf, "\n## Other changes\n\n")
+		for _, n := range notes {
+			writeNote(&buf, n)
+		}
+	}
+	return buf.String()
+}
+
+func writeNote(buf *bytes.Buffer, n Note) {
+	var refs []string
+	if n.Issue != 0 {
+		refs = append(refs, fmt.Sprintf("[#%d](https://go.dev/issue/%d)", n.Issue, n.Issue))
+	}
+	if n.CL != 0 {
+		refs = append(refs, fmt.Sprintf("[CL %d](https://go.dev/cl/%d)", n.CL, n.CL))
+	}
+	text := n.Text
+	if text == "" && len(n.API) > 0 {
+		text = "new API"
+	}
+	fmt.Fprintf(buf, "- TODO: %s", text)
+	if len(refs) > 0 {
+		fmt.Fprintf(buf, " (%s)", strings.Join(refs, ", "))
+	}
+	buf.WriteString("\n")
+	for _, api := range n.API {
+		fmt.Fprintf(buf, "  - `%s`\n", api)
+	}
+}
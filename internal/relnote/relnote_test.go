@@ -0,0 +1,110 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package relnote
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestPackagePrefix(t *testing.T) {
+	for _, tc := range []struct {
+		in, want string
+	}{
+		{"net/http: add HTTP 5 support", "net/http"},
+		{"cmd/go: fix a bug", "cmd/go"},
+		{"all: fix typos", "all"},
+		{"Revert \"runtime: something\"", ""},
+		{"no package here", ""},
+	} {
+		if got := PackagePrefix(tc.in); got != tc.want {
+			t.Errorf("PackagePrefix(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestParseRelNote(t *testing.T) {
+	for _, tc := range []struct {
+		in, want string
+	}{
+		{"net/http: fix\n\nRELNOTE=yes\n", "yes"},
+		{"RELNOTES=adds a flag ", "adds a flag"},
+		{"no annotation", ""},
+	} {
+		if got := ParseRelNote(tc.in); got != tc.want {
+			t.Errorf("ParseRelNote(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestDevCycleStart(t *testing.T) {
+	if got, want := DevCycleStart(22), time.Date(2023, time.August, 1, 0, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("DevCycleStart(22) = %v, want %v", got, want)
+	}
+}
+
+func TestParseAPI(t *testing.T) {
+	data := []byte(`pkg go/types, method (*Func) Origin() *Func #51682
+pkg go/types, method (*Var) Origin() *Var #51682
+pkg syscall (windows-386), const WSAENOPROTOOPT = 10042 #61000
+pkg syscall (windows-amd64), const WSAENOPROTOOPT = 10042 #61000
+pkg unicode, const Version = "15.0.0"
+`)
+	got, err := ParseAPI(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Note{
+		{Package: "go/types", Issue: 51682, API: []string{"method (*Func) Origin() *Func", "method (*Var) Origin() *Var"}},
+		{Package: "syscall", Issue: 61000, API: []string{"const WSAENOPROTOOPT = 10042", "const WSAENOPROTOOPT = 10042"}},
+		{Package: "unicode", API: []string{`const Version = "15.0.0"`}},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("ParseAPI mismatch (-want +got):\n%s", diff)
+	}
+
+	if _, err := ParseAPI([]byte("func Foo()\n")); err == nil {
+		t.Errorf("ParseAPI of a malformed line succeeded, want error")
+	}
+}
+
+func TestMarkdown(t *testing.T) {
+	notes := []Note{
+		CLNote(3, "os: add Foo", "yes"),
+		CLNote(2, "cmd/compile: faster", "builds are 5% faster"),
+		CLNote(1, "all: fix typos", "y"),
+		CLNote(4, "Update the README", "mentions the new website"),
+		{Package: "os", Issue: 1234, API: []string{"func Foo()"}},
+	}
+	want := `# Go 1.21 release notes (draft)
+
+## Tools
+
+### cmd/compile
+
+- TODO: faster; builds are 5% faster ([CL 2](https://go.dev/cl/2))
+
+## Standard library
+
+### all
+
+- TODO: fix typos ([CL 1](https://go.dev/cl/1))
+
+### os
+
+- TODO: add Foo ([CL 3](https://go.dev/cl/3))
+- TODO: new API ([#1234](https://go.dev/issue/1234))
+  - ` + "`func Foo()`" + `
+
+## Other changes
+
+- TODO: Update the README; mentions the new website ([CL 4](https://go.dev/cl/4))
+`
+	if diff := cmp.Diff(want, Markdown(21, notes)); diff != "" {
+		t.Errorf("Markdown mismatch (-want +got):\n%s", diff)
+	}
+}
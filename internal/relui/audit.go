@@ -0,0 +1,189 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package relui
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/build/internal/relui/db"
+	"golang.org/x/exp/slices"
+)
+
+// An AuditAction names a kind of state-changing action recorded in
+// the audit log.
+type AuditAction string
+
+const (
+	AuditWorkflowCreated  AuditAction = "workflow-created"
+	AuditWorkflowCanceled AuditAction = "workflow-canceled"
+	AuditTaskApproved     AuditAction = "task-approved"
+	AuditTaskRetried      AuditAction = "task-retried"
+	AuditScheduleCreated  AuditAction = "schedule-created"
+	AuditScheduleDeleted  AuditAction = "schedule-deleted"
+)
+
+// AuditActions is the list of all audited actions, in the order they
+// are presented in the UI.
+var AuditActions = []AuditAction{
+	AuditWorkflowCreated,
+	AuditWorkflowCanceled,
+	AuditTaskApproved,
+	AuditTaskRetried,
+	AuditScheduleCreated,
+	AuditScheduleDeleted,
+}
+
+// auditPageSize is the maximum number of events shown on the audit page.
+const auditPageSize = 500
+
+// iapHeaderEmail is the header in which Identity Aware Proxy passes
+// the authenticated user's email address, for example
+// "accounts.google.com:example@gmail.com".
+const iapHeaderEmail = "X-Goog-Authenticated-User-Email"
+
+// requestActor returns the name of the user responsible for r.
+func requestActor(r *http.Request) string {
+	email := r.Header.Get(iapHeaderEmail)
+	if email == "" {
+		return "unknown"
+	}
+	if _, after, ok := strings.Cut(email, ":"); ok {
+		return after
+	}
+	return email
+}
+
+// An auditEvent is a single entry in the audit log.
+type auditEvent struct {
+	Action     AuditAction
+	WorkflowID uuid.UUID // Optional.
+	TaskName   string    // Optional.
+	ScheduleID int32     // Optional.
+	// Before and After are the state of the affected object before
+	// and after the action. They are recorded as JSON, and nil is
+	// recorded as no state.
+	Before, After interface{}
+}
+
+// writeAudit appends e, performed by actor, to the audit log with q,
+// which should be in the database transaction of the action, so that
+// the action and its record commit together.
+func writeAudit(ctx context.Context, q *db.Queries, actor string, e auditEvent) error {
+	before, err := auditState(e.Before)
+	if err != nil {
+		return err
+	}
+	after, err := auditState(e.After)
+	if err != nil {
+		return err
+	}
+	_, err = q.CreateAuditEvent(ctx, db.CreateAuditEventParams{
+		Actor:      actor,
+		Action:     string(e.Action),
+		WorkflowID: e.WorkflowID,
+		TaskName:   e.TaskName,
+		ScheduleID: sql.NullInt32{Int32: e.ScheduleID, Valid: e.ScheduleID != 0},
+		Before:     before,
+		After:      after,
+		CreatedAt:  time.Now(),
+	})
+	return err
+}
+
+type auditContextKey struct{}
+
+// A pendingAudit is an audit event carried by the context of the
+// action it records.
+type pendingAudit struct {
+	actor string
+	event auditEvent
+}
+
+// withAudit returns the context for an action requested by r that is
+// carried out by the Scheduler or a Listener, such as creating a
+// schedule or a workflow. The database transaction of the action
+// appends e, performed by the user responsible for r, to the audit log
+// with appendAudit.
+func withAudit(r *http.Request, e auditEvent) context.Context {
+	return context.WithValue(r.Context(), auditContextKey{}, &pendingAudit{actor: requestActor(r), event: e})
+}
+
+// appendAudit appends the audit event that ctx carries, if any, to the
+// audit log with q, as writeAudit does. If complete isn't nil, it's
+// called first to fill in the parts of the event that are only known in
+// the transaction, such as the ID of a new object.
+func appendAudit(ctx context.Context, q *db.Queries, complete func(*auditEvent)) error {
+	pa, ok := ctx.Value(auditContextKey{}).(*pendingAudit)
+	if !ok {
+		return nil
+	}
+	e := pa.event
+	if complete != nil {
+		complete(&e)
+	}
+	return writeAudit(ctx, q, pa.actor, e)
+}
+
+func auditState(v interface{}) (sql.NullString, error) {
+	if v == nil {
+		return sql.NullString{}, nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return sql.NullString{}, err
+	}
+	return sql.NullString{String: string(b), Valid: true}, nil
+}
+
+type auditResponse struct {
+	SiteHeader SiteHeader
+	Actions    []AuditAction
+	Filter     db.AuditEventsParams
+	Events     []db.AuditEvent
+}
+
+// auditHandler renders the audit log, filtered by the action, actor
+// and workflow query parameters.
+func (s *Server) auditHandler(w http.ResponseWriter, r *http.Request) {
+	filter := db.AuditEventsParams{
+		Action:     r.FormValue("action"),
+		Actor:      r.FormValue("actor"),
+		WorkflowID: r.FormValue("workflow"),
+		MaxRows:    auditPageSize,
+	}
+	if filter.Action != "" && !slices.Contains(AuditActions, AuditAction(filter.Action)) {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	events, err := db.New(s.db).AuditEvents(r.Context(), filter)
+	if err != nil {
+		log.Printf("auditHandler: %v", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	resp := &auditResponse{
+		SiteHeader: s.header,
+		Actions:    AuditActions,
+		Filter:     filter,
+		Events:     events,
+	}
+	resp.SiteHeader.Subtitle = "Audit Log"
+	out := bytes.Buffer{}
+	if err := s.auditTmpl.Execute(&out, resp); err != nil {
+		log.Printf("auditHandler: %v", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	io.Copy(w, &out)
+}
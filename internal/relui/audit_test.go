@@ -0,0 +1,126 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package relui
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"golang.org/x/build/internal/relui/db"
+)
+
+func TestRequestActor(t *testing.T) {
+	cases := []struct {
+		header string
+		want   string
+	}{
+		{header: "", want: "unknown"},
+		{header: "accounts.google.com:gopher@golang.org", want: "gopher@golang.org"},
+		{header: "gopher@golang.org", want: "gopher@golang.org"},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if c.header != "" {
+			req.Header.Set(iapHeaderEmail, c.header)
+		}
+		if got := requestActor(req); got != c.want {
+			t.Errorf("requestActor() with %s: %q = %q, wanted %q", iapHeaderEmail, c.header, got, c.want)
+		}
+	}
+}
+
+func TestServerAuditHandler(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	p := testDB(ctx, t)
+	s := NewServer(p, NewWorker(NewDefinitionHolder(), p, &PGListener{DB: p}), nil, SiteHeader{}, nil)
+
+	wfID := uuid.New()
+	events := []auditEvent{
+		{Action: AuditWorkflowCreated, WorkflowID: wfID, After: map[string]string{"name": "echo"}},
+		{Action: AuditTaskApproved, WorkflowID: wfID, TaskName: "approve please"},
+		{Action: AuditScheduleDeleted, ScheduleID: 3},
+	}
+	for _, e := range events {
+		if err := writeAudit(ctx, db.New(p), "gopher@golang.org", e); err != nil {
+			t.Fatalf("writeAudit(_, _, _, %v) = %v, wanted no error", e, err)
+		}
+	}
+
+	got, err := db.New(p).AuditEvents(ctx, db.AuditEventsParams{WorkflowID: wfID.String(), MaxRows: auditPageSize})
+	if err != nil {
+		t.Fatalf("AuditEvents() = %v, wanted no error", err)
+	}
+	if len(got) != 2 {
+		t.Errorf("AuditEvents(workflow: %q) returned %d events, wanted 2", wfID, len(got))
+	}
+	if _, err := p.Exec(ctx, "DELETE FROM audit_events"); err == nil {
+		t.Errorf("deleting from audit_events succeeded, wanted error")
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/audit?action="+string(AuditTaskApproved), nil)
+	rec := httptest.NewRecorder()
+	s.m.ServeHTTP(rec, req)
+	resp := rec.Result()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("resp.StatusCode = %d, wanted %d", resp.StatusCode, http.StatusOK)
+	}
+	body := rec.Body.String()
+	if !strings.Contains(body, "approve please") || strings.Contains(body, "Schedule 3") {
+		t.Errorf("audit page filtered by %q = %q, wanted only the approval", AuditTaskApproved, body)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/audit?action=invalid", nil)
+	rec = httptest.NewRecorder()
+	s.m.ServeHTTP(rec, req)
+	if rec.Result().StatusCode != http.StatusBadRequest {
+		t.Errorf("resp.StatusCode = %d, wanted %d", rec.Result().StatusCode, http.StatusBadRequest)
+	}
+}
+
+func TestAuditInActionTransaction(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	p := testDB(ctx, t)
+	w := NewWorker(NewDefinitionHolder(), p, &PGListener{DB: p})
+	s := NewServer(p, w, nil, SiteHeader{}, nil)
+	req := httptest.NewRequest(http.MethodPost, "/", nil)
+	req.Header.Set(iapHeaderEmail, "accounts.google.com:gopher@golang.org")
+	q := db.New(p)
+
+	// A schedule's audit event has its ID, filled in by the
+	// transaction that creates it.
+	row, err := s.scheduler.Create(withAudit(req, auditEvent{Action: AuditScheduleCreated}), Schedule{Type: ScheduleCron, Cron: "0 0 1 1 *"}, "echo", map[string]any{"greeting": "hello", "farewell": "bye"})
+	if err != nil {
+		t.Fatalf("s.scheduler.Create() = %v, wanted no error", err)
+	}
+	events, err := q.AuditEvents(ctx, db.AuditEventsParams{Action: string(AuditScheduleCreated), MaxRows: auditPageSize})
+	if err != nil {
+		t.Fatalf("AuditEvents() = %v, wanted no error", err)
+	}
+	if len(events) == 0 || events[0].ScheduleID.Int32 != row.ID || events[0].Actor != "gopher@golang.org" {
+		t.Errorf("AuditEvents(action: %q) = %+v, wanted an event for schedule %d by gopher@golang.org", AuditScheduleCreated, events, row.ID)
+	}
+
+	// Actions that fail leave no audit event.
+	id := uuid.New()
+	if err := s.cancelWorkflow(req, id); err != errWorkflowNotRunning {
+		t.Errorf("s.cancelWorkflow(_, %q) = %v, wanted %v", id, err, errWorkflowNotRunning)
+	}
+	if err := s.approveTask(req, id, "approve please"); err == nil {
+		t.Errorf("s.approveTask(_, %q, %q) = nil, wanted an error for a missing task", id, "approve please")
+	}
+	events, err = q.AuditEvents(ctx, db.AuditEventsParams{WorkflowID: id.String(), MaxRows: auditPageSize})
+	if err != nil {
+		t.Fatalf("AuditEvents() = %v, wanted no error", err)
+	}
+	if len(events) != 0 {
+		t.Errorf("AuditEvents(workflow: %q) = %+v, wanted none for failed actions", id, events)
+	}
+}
@@ -35,6 +35,7 @@ import (
 	"golang.org/x/build/internal"
 	"golang.org/x/build/internal/gcsfs"
 	"golang.org/x/build/internal/releasetargets"
+	"golang.org/x/build/internal/sourcecache"
 	"golang.org/x/build/internal/task"
 	"golang.org/x/build/internal/workflow"
 )
@@ -97,10 +98,12 @@ type releaseTestDeps struct {
 	buildlets      *task.FakeBuildlets
 	goRepo         *task.FakeRepo
 	gerrit         *reviewerCheckGerrit
+	calls          *task.CallLog
 	versionTasks   *task.VersionTasks
 	buildTasks     *BuildReleaseTasks
 	milestoneTasks *task.MilestoneTasks
 	publishedFiles map[string]task.WebsiteFile
+	loggedFiles    map[string]task.WebsiteFile
 }
 
 func newReleaseTestDeps(t *testing.T, previousTag string, major int, wantVersion string) *releaseTestDeps {
@@ -173,6 +176,18 @@ esac
 		files[strings.TrimPrefix(f.Filename, wantVersion+".")] = f
 		return nil
 	}
+	logged := map[string]task.WebsiteFile{}
+	logFiles := func(ctx context.Context, fs []task.WebsiteFile) error {
+		filesMu.Lock()
+		defer filesMu.Unlock()
+		for _, f := range fs {
+			if _, ok := files[strings.TrimPrefix(f.Filename, wantVersion+".")]; ok {
+				return fmt.Errorf("%s was published before it was logged", f.Filename)
+			}
+			logged[f.Filename] = f
+		}
+		return nil
+	}
 
 	goRepo := task.NewFakeRepo(t, "go")
 	base := goRepo.Commit(goFiles)
@@ -215,24 +230,36 @@ esac
 
 	const dockerProject, dockerTrigger = "docker-build-project", "docker-build-trigger"
 
+	sourceCache := sourcecache.New(sourcecache.Options{
+		Origins: []sourcecache.Origin{sourcecache.GerritOrigin(http.DefaultClient, fakeGerrit.GerritURL())},
+	})
+	signService := task.NewFakeSignService(t)
+	calls := new(task.CallLog)
+	services := task.Services{
+		Gerrit:  gerrit,
+		Storage: task.GCSStorage(nil),
+		Sign:    signService,
+		CloudBuild: &task.FakeCloudBuild{
+			Project:       dockerProject,
+			AllowedBuilds: map[string]map[string]string{dockerTrigger: {"_GO_VERSION": wantVersion[2:]}},
+		},
+	}.Record(calls)
+	versionTasks.Gerrit = services.Gerrit
 	buildTasks := &BuildReleaseTasks{
-		GerritClient:             gerrit,
+		Services:                 services,
 		GerritHTTPClient:         http.DefaultClient,
 		GerritURL:                fakeGerrit.GerritURL() + "/go",
-		GCSClient:                nil,
+		SourceCache:              sourceCache,
 		ScratchURL:               "file://" + filepath.ToSlash(t.TempDir()),
 		ServingURL:               "file://" + filepath.ToSlash(servingDir),
 		CreateBuildlet:           fakeBuildlets.CreateBuildlet,
-		SignService:              task.NewFakeSignService(t),
+		CheckSigned:              signService.CheckSignedStructure,
 		DownloadURL:              dlServer.URL,
 		ProxyPrefix:              dlServer.URL,
 		PublishFile:              publishFile,
+		LogFiles:                 logFiles,
 		GoogleDockerBuildProject: dockerProject,
 		GoogleDockerBuildTrigger: dockerTrigger,
-		CloudBuildClient: &task.FakeCloudBuild{
-			Project:       dockerProject,
-			AllowedBuilds: map[string]map[string]string{dockerTrigger: {"_GO_VERSION": wantVersion[2:]}},
-		},
 		ApproveAction: func(ctx *workflow.TaskContext) error {
 			if strings.Contains(ctx.TaskName, "Release Coordinator Approval") {
 				return nil
@@ -249,10 +276,12 @@ esac
 		buildlets:      fakeBuildlets,
 		goRepo:         goRepo,
 		gerrit:         gerrit,
+		calls:          calls,
 		versionTasks:   versionTasks,
 		buildTasks:     buildTasks,
 		milestoneTasks: milestoneTasks,
 		publishedFiles: files,
+		loggedFiles:    logged,
 	}
 }
 
@@ -307,6 +336,9 @@ func testRelease(t *testing.T, prevTag string, major int, wantVersion string, ki
 			t.Errorf("file %s has unexpected kind: got %q, want %q", f.Filename, got, want)
 		}
 		delete(wantPublishedFiles, f.Filename)
+		if logged := deps.loggedFiles[f.Filename]; logged != f {
+			t.Errorf("file %s was logged as %+v, want %+v", f.Filename, logged, f)
+		}
 
 		checkFile(t, dlURL, files, strings.TrimPrefix(f.Filename, wantVersion+"."), f, func(t *testing.T, b []byte) {
 			if got, want := len(b), int(f.Size); got != want {
@@ -415,6 +447,37 @@ func testRelease(t *testing.T, prevTag string, major int, wantVersion string, ki
 			t.Errorf("VERSION file is %q, expected %q", version, versionFile)
 		}
 	}
+
+	// Check the external calls of the tasks that tag and announce the
+	// release, which can't be undone.
+	wantCalls := map[string][]string{
+		"Tag version": {
+			fmt.Sprintf(`Gerrit.Tag("go", %q, %q)`, wantVersion, tag.Revision),
+		},
+		"Start Google Docker build": {
+			fmt.Sprintf(`CloudBuild.RunBuildTrigger("docker-build-project", "docker-build-trigger", {"_GO_VERSION":%q})`, wantVersion[2:]),
+		},
+		"Await Google Docker build": {
+			`CloudBuild.Completed("docker-build-project", "build-12345")`,
+		},
+	}
+	if kind != task.KindBeta {
+		wantCalls["Check branch state matches source archive"] = []string{
+			fmt.Sprintf(`Gerrit.ReadBranchHead("go", "release-branch.go1.%d")`, major),
+		}
+	}
+	for task, want := range wantCalls {
+		// Storage calls are to randomly-named scratch files.
+		var got []string
+		for _, c := range deps.calls.TaskCalls(task) {
+			if !strings.HasPrefix(c, "Storage.") {
+				got = append(got, c)
+			}
+		}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("task %q made unexpected calls (-want +got):\n%s", task, diff)
+		}
+	}
 }
 
 func testSecurity(t *testing.T, mergeFixes bool) {
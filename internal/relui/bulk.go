@@ -0,0 +1,219 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package relui
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+	"golang.org/x/build/internal/relui/db"
+)
+
+// The actions of bulk requests.
+const (
+	BulkCancel  = "cancel"  // cancel running workflows
+	BulkRetry   = "retry"   // retry the failed tasks of running workflows
+	BulkApprove = "approve" // approve the tasks waiting for approval
+)
+
+// maxBulkWorkflows is the maximum number of workflows in a bulk
+// request.
+const maxBulkWorkflows = 500
+
+// A BulkRequest is the body of a request to /api/workflows/bulk, which
+// applies an action to many workflows at once, such as after an
+// incident in which many scheduled workflows failed the same way.
+type BulkRequest struct {
+	Action    string      `json:"action"` // BulkCancel, BulkRetry or BulkApprove
+	Workflows []uuid.UUID `json:"workflows"`
+}
+
+// A BulkResponse is the response to a BulkRequest. It has a result
+// for each of the request's workflows, in order.
+type BulkResponse struct {
+	Results []BulkResult `json:"results"`
+}
+
+// A BulkResult is the outcome of a bulk action on one workflow.
+type BulkResult struct {
+	Workflow uuid.UUID `json:"workflow"`
+	OK       bool      `json:"ok"`
+	Error    string    `json:"error,omitempty"`
+	// Tasks lists the tasks that were retried or approved. They may
+	// be set even if the action failed partway through.
+	Tasks []string `json:"tasks,omitempty"`
+}
+
+// bulkHandler serves /api/workflows/bulk. It applies the action of a
+// BulkRequest to each of its workflows that the user may act on, and
+// replies with a BulkResponse. The failure of an action on one
+// workflow doesn't stop the others.
+func (s *Server) bulkHandler(w http.ResponseWriter, r *http.Request) {
+	var req BulkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("invalid request: %v", err), http.StatusBadRequest)
+		return
+	}
+	switch req.Action {
+	case BulkCancel, BulkRetry, BulkApprove:
+	default:
+		http.Error(w, fmt.Sprintf("unknown action %q", req.Action), http.StatusBadRequest)
+		return
+	}
+	if len(req.Workflows) > maxBulkWorkflows {
+		http.Error(w, fmt.Sprintf("too many workflows: %d > %d", len(req.Workflows), maxBulkWorkflows), http.StatusBadRequest)
+		return
+	}
+	resp := BulkResponse{Results: []BulkResult{}}
+	for _, id := range req.Workflows {
+		res := BulkResult{Workflow: id}
+		var err error
+		res.Tasks, err = s.bulkAction(r, req.Action, id)
+		if err != nil {
+			res.Error = err.Error()
+		} else {
+			res.OK = true
+		}
+		resp.Results = append(resp.Results, res)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// bulkAction applies action to the workflow with the given ID on
+// behalf of the user responsible for r, and returns the names of the
+// tasks it retried or approved.
+func (s *Server) bulkAction(r *http.Request, action string, id uuid.UUID) ([]string, error) {
+	q := db.New(s.db)
+	wf, err := q.Workflow(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) || errors.Is(err, pgx.ErrNoRows) {
+		return nil, errors.New("no such workflow")
+	} else if err != nil {
+		log.Printf("bulkAction: q.Workflow(_, %q) = %v", id, err)
+		return nil, errors.New(http.StatusText(http.StatusInternalServerError))
+	}
+	if err := s.authorizationError(r, wf.Namespace); err != nil {
+		return nil, err
+	}
+	if action == BulkCancel {
+		if err := s.cancelWorkflow(r, id); err != nil && err != errWorkflowNotRunning {
+			log.Printf("bulkAction: s.cancelWorkflow(_, %q) = %v", id, err)
+			return nil, errors.New(http.StatusText(http.StatusInternalServerError))
+		} else if err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+
+	tasks, err := q.TasksForWorkflow(r.Context(), id)
+	if err != nil {
+		log.Printf("bulkAction: q.TasksForWorkflow(_, %q) = %v", id, err)
+		return nil, errors.New(http.StatusText(http.StatusInternalServerError))
+	}
+	var done []string
+	for _, t := range tasks {
+		switch action {
+		case BulkRetry:
+			if !t.Error.Valid {
+				continue
+			}
+			err = s.retryTask(r, id, t.Name)
+		case BulkApprove:
+			if !t.ReadyForApproval || t.ApprovedAt.Valid {
+				continue
+			}
+			err = s.approveTask(r, id, t.Name)
+		}
+		if err != nil {
+			return done, fmt.Errorf("task %q: %v", t.Name, err)
+		}
+		done = append(done, t.Name)
+	}
+	if len(done) == 0 {
+		if action == BulkRetry {
+			return nil, errors.New("no failed tasks")
+		}
+		return nil, errors.New("no tasks waiting for approval")
+	}
+	return done, nil
+}
+
+// errWorkflowNotRunning is returned for actions on a workflow that
+// isn't running.
+var errWorkflowNotRunning = errors.New("workflow isn't running")
+
+// cancelWorkflow cancels the running workflow with the given ID on
+// behalf of the user responsible for r. The cancellation isn't
+// recorded in the database, so only its audit event is, in a
+// transaction that's rolled back if the workflow isn't running.
+func (s *Server) cancelWorkflow(r *http.Request, id uuid.UUID) error {
+	return s.db.BeginFunc(r.Context(), func(tx pgx.Tx) error {
+		err := writeAudit(r.Context(), db.New(tx), requestActor(r), auditEvent{
+			Action:     AuditWorkflowCanceled,
+			WorkflowID: id,
+			Before:     map[string]bool{"running": true},
+			After:      map[string]bool{"running": false},
+		})
+		if err != nil {
+			return err
+		}
+		if !s.w.cancelWorkflow(id) {
+			return errWorkflowNotRunning
+		}
+		return nil
+	})
+}
+
+// retryTask retries the named task of the running workflow with the
+// given ID on behalf of the user responsible for r. Like
+// cancelWorkflow, it only records the audit event if the retry
+// succeeds.
+func (s *Server) retryTask(r *http.Request, id uuid.UUID, name string) error {
+	return s.db.BeginFunc(r.Context(), func(tx pgx.Tx) error {
+		q := db.New(tx)
+		before, err := q.Task(r.Context(), db.TaskParams{WorkflowID: id, Name: name})
+		if err != nil {
+			return err
+		}
+		if err := writeAudit(r.Context(), q, requestActor(r), auditEvent{Action: AuditTaskRetried, WorkflowID: id, TaskName: name, Before: before}); err != nil {
+			return err
+		}
+		return s.w.RetryTask(r.Context(), id, name)
+	})
+}
+
+// approveTask approves the named task of the workflow with the given
+// ID on behalf of the user responsible for r.
+func (s *Server) approveTask(r *http.Request, id uuid.UUID, name string) error {
+	var t db.Task
+	err := s.db.BeginFunc(r.Context(), func(tx pgx.Tx) error {
+		q := db.New(tx)
+		before, err := q.Task(r.Context(), db.TaskParams{WorkflowID: id, Name: name})
+		if err != nil {
+			return err
+		}
+		t, err = q.ApproveTask(r.Context(), db.ApproveTaskParams{
+			WorkflowID: id,
+			Name:       name,
+			ApprovedAt: sql.NullTime{Time: time.Now(), Valid: true},
+		})
+		if err != nil {
+			return err
+		}
+		return writeAudit(r.Context(), q, requestActor(r), auditEvent{Action: AuditTaskApproved, WorkflowID: id, TaskName: t.Name, Before: before, After: t})
+	})
+	if err != nil {
+		return err
+	}
+	s.w.l.Logger(id, t.Name).Printf("USER-APPROVED")
+	return nil
+}
@@ -0,0 +1,115 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package relui
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/uuid"
+	"golang.org/x/build/internal/relui/db"
+	"golang.org/x/build/internal/workflow"
+)
+
+func TestServerBulkHandler(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	p := testDB(ctx, t)
+	q := db.New(p)
+	hourAgo := time.Now().Add(-1 * time.Hour)
+
+	running, waiting, restricted, missing := uuid.New(), uuid.New(), uuid.New(), uuid.New()
+	for _, wf := range []db.CreateWorkflowParams{
+		{ID: running, Name: nullString("echo"), Namespace: DefaultNamespace, CreatedAt: hourAgo, UpdatedAt: hourAgo},
+		{ID: waiting, Name: nullString("echo"), Namespace: DefaultNamespace, CreatedAt: hourAgo, UpdatedAt: hourAgo},
+		{ID: restricted, Name: nullString("echo"), Namespace: "restricted", CreatedAt: hourAgo, UpdatedAt: hourAgo},
+	} {
+		if _, err := q.CreateWorkflow(ctx, wf); err != nil {
+			t.Fatalf("CreateWorkflow(_, %v) = _, %v, wanted no error", wf, err)
+		}
+		tp := db.CreateTaskParams{WorkflowID: wf.ID, Name: "approve please", ReadyForApproval: wf.ID != running, CreatedAt: hourAgo, UpdatedAt: hourAgo}
+		if _, err := q.CreateTask(ctx, tp); err != nil {
+			t.Fatalf("CreateTask(_, %v) = _, %v, wanted no error", tp, err)
+		}
+	}
+
+	dh := NewDefinitionHolder()
+	dh.RegisterNamespace(Namespace{Name: "restricted", Members: []string{"member@example.com"}})
+	worker := NewWorker(dh, p, &PGListener{DB: p})
+	wfCtx, wfCancel := context.WithCancel(ctx)
+	defer wfCancel()
+	if err := worker.markRunning(&workflow.Workflow{ID: running}, wfCancel); err != nil {
+		t.Fatalf("worker.markRunning(%v) = %v, wanted no error", running, err)
+	}
+	s := NewServer(p, worker, nil, SiteHeader{}, nil)
+
+	do := func(req BulkRequest) []BulkResult {
+		t.Helper()
+		b, err := json.Marshal(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := httptest.NewRequest(http.MethodPost, "/api/workflows/bulk", strings.NewReader(string(b)))
+		r.Header.Set(iapHeaderEmail, "accounts.google.com:other@example.com")
+		rec := httptest.NewRecorder()
+		s.m.ServeHTTP(rec, r)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: resp.StatusCode = %d, wanted %d", req.Action, rec.Code, http.StatusOK)
+		}
+		var resp BulkResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("%s: decoding response %q: %v", req.Action, rec.Body, err)
+		}
+		return resp.Results
+	}
+
+	got := do(BulkRequest{Action: BulkApprove, Workflows: []uuid.UUID{waiting, restricted, missing, running}})
+	want := []BulkResult{
+		{Workflow: waiting, OK: true, Tasks: []string{"approve please"}},
+		{Workflow: restricted, Error: `other@example.com is not a member of namespace "restricted"`},
+		{Workflow: missing, Error: "no such workflow"},
+		{Workflow: running, Error: "no tasks waiting for approval"},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("approve results mismatch (-want +got):\n%s", diff)
+	}
+	if task, err := q.Task(ctx, db.TaskParams{WorkflowID: waiting, Name: "approve please"}); err != nil || !task.ApprovedAt.Valid {
+		t.Errorf("q.Task(_, %v) = %v, %v; wanted an approved task", waiting, task, err)
+	}
+
+	got = do(BulkRequest{Action: BulkCancel, Workflows: []uuid.UUID{running, waiting}})
+	want = []BulkResult{
+		{Workflow: running, OK: true},
+		{Workflow: waiting, Error: "workflow isn't running"},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("cancel results mismatch (-want +got):\n%s", diff)
+	}
+	<-wfCtx.Done()
+}
+
+func TestServerBulkHandlerBadRequest(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	p := testDB(ctx, t)
+	s := NewServer(p, NewWorker(NewDefinitionHolder(), p, &PGListener{DB: p}), nil, SiteHeader{}, nil)
+
+	for _, body := range []string{
+		`not json`,
+		`{"action": "delete", "workflows": []}`,
+	} {
+		rec := httptest.NewRecorder()
+		s.m.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/workflows/bulk", strings.NewReader(body)))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("body %q: resp.StatusCode = %d, wanted %d", body, rec.Code, http.StatusBadRequest)
+		}
+	}
+}
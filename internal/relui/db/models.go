@@ -11,6 +11,18 @@ import (
 	"github.com/google/uuid"
 )
 
+type AuditEvent struct {
+	ID         int32
+	Actor      string
+	Action     string
+	WorkflowID uuid.UUID
+	TaskName   string
+	ScheduleID sql.NullInt32
+	Before     sql.NullString
+	After      sql.NullString
+	CreatedAt  time.Time
+}
+
 type Schedule struct {
 	ID              int32
 	WorkflowName    string
@@ -20,6 +32,7 @@ type Schedule struct {
 	IntervalMinutes int32
 	CreatedAt       time.Time
 	UpdatedAt       time.Time
+	Namespace       string
 }
 
 type Task struct {
@@ -34,6 +47,17 @@ type Task struct {
 	ReadyForApproval bool
 	Started          bool
 	RetryCount       int32
+	StartedAt        sql.NullTime
+	FinishedAt       sql.NullTime
+	Args             sql.NullString
+}
+
+type TaskEffect struct {
+	Key        string
+	WorkflowID uuid.UUID
+	TaskName   string
+	Result     sql.NullString
+	CreatedAt  time.Time
 }
 
 type TaskLog struct {
@@ -43,6 +67,9 @@ type TaskLog struct {
 	Body       string
 	CreatedAt  time.Time
 	UpdatedAt  time.Time
+	Level      string
+	Fields     sql.NullString
+	Progress   sql.NullFloat64
 }
 
 type Workflow struct {
@@ -55,4 +82,13 @@ type Workflow struct {
 	Output     string
 	Error      string
 	ScheduleID sql.NullInt32
+	Definition sql.NullString
+	DryRun     bool
+	Namespace  string
+}
+
+type WorkflowDependency struct {
+	WorkflowID  uuid.UUID
+	DependsOnID uuid.UUID
+	CreatedAt   time.Time
 }
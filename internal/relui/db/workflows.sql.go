@@ -19,7 +19,7 @@ SET approved_at = $3,
     updated_at  = $3
 WHERE workflow_id = $1
   AND name = $2
-RETURNING workflow_id, name, finished, result, error, created_at, updated_at, approved_at, ready_for_approval, started, retry_count
+RETURNING workflow_id, name, finished, result, error, created_at, updated_at, approved_at, ready_for_approval, started, retry_count, started_at, finished_at, args
 `
 
 type ApproveTaskParams struct {
@@ -43,6 +43,9 @@ func (q *Queries) ApproveTask(ctx context.Context, arg ApproveTaskParams) (Task,
 		&i.ReadyForApproval,
 		&i.Started,
 		&i.RetryCount,
+		&i.StartedAt,
+		&i.FinishedAt,
+		&i.Args,
 	)
 	return i, err
 }
@@ -75,9 +78,9 @@ func (q *Queries) ClearWorkflowSchedule(ctx context.Context, dollar_1 int32) ([]
 }
 
 const createSchedule = `-- name: CreateSchedule :one
-INSERT INTO schedules (workflow_name, workflow_params, spec, once, interval_minutes, created_at, updated_at)
-VALUES ($1, $2, $3, $4, $5, $6, $7)
-RETURNING id, workflow_name, workflow_params, spec, once, interval_minutes, created_at, updated_at
+INSERT INTO schedules (workflow_name, workflow_params, spec, once, interval_minutes, created_at, updated_at, namespace)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+RETURNING id, workflow_name, workflow_params, spec, once, interval_minutes, created_at, updated_at, namespace
 `
 
 type CreateScheduleParams struct {
@@ -88,6 +91,7 @@ type CreateScheduleParams struct {
 	IntervalMinutes int32
 	CreatedAt       time.Time
 	UpdatedAt       time.Time
+	Namespace       string
 }
 
 func (q *Queries) CreateSchedule(ctx context.Context, arg CreateScheduleParams) (Schedule, error) {
@@ -99,6 +103,7 @@ func (q *Queries) CreateSchedule(ctx context.Context, arg CreateScheduleParams)
 		arg.IntervalMinutes,
 		arg.CreatedAt,
 		arg.UpdatedAt,
+		arg.Namespace,
 	)
 	var i Schedule
 	err := row.Scan(
@@ -110,6 +115,7 @@ func (q *Queries) CreateSchedule(ctx context.Context, arg CreateScheduleParams)
 		&i.IntervalMinutes,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.Namespace,
 	)
 	return i, err
 }
@@ -118,7 +124,7 @@ const createTask = `-- name: CreateTask :one
 INSERT INTO tasks (workflow_id, name, finished, result, error, created_at, updated_at, approved_at,
                    ready_for_approval)
 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
-RETURNING workflow_id, name, finished, result, error, created_at, updated_at, approved_at, ready_for_approval, started, retry_count
+RETURNING workflow_id, name, finished, result, error, created_at, updated_at, approved_at, ready_for_approval, started, retry_count, started_at, finished_at, args
 `
 
 type CreateTaskParams struct {
@@ -158,24 +164,37 @@ func (q *Queries) CreateTask(ctx context.Context, arg CreateTaskParams) (Task, e
 		&i.ReadyForApproval,
 		&i.Started,
 		&i.RetryCount,
+		&i.StartedAt,
+		&i.FinishedAt,
+		&i.Args,
 	)
 	return i, err
 }
 
 const createTaskLog = `-- name: CreateTaskLog :one
-INSERT INTO task_logs (workflow_id, task_name, body)
-VALUES ($1, $2, $3)
-RETURNING id, workflow_id, task_name, body, created_at, updated_at
+INSERT INTO task_logs (workflow_id, task_name, body, level, fields, progress)
+VALUES ($1, $2, $3, $4, $5, $6)
+RETURNING id, workflow_id, task_name, body, created_at, updated_at, level, fields, progress
 `
 
 type CreateTaskLogParams struct {
 	WorkflowID uuid.UUID
 	TaskName   string
 	Body       string
+	Level      string
+	Fields     sql.NullString
+	Progress   sql.NullFloat64
 }
 
 func (q *Queries) CreateTaskLog(ctx context.Context, arg CreateTaskLogParams) (TaskLog, error) {
-	row := q.db.QueryRow(ctx, createTaskLog, arg.WorkflowID, arg.TaskName, arg.Body)
+	row := q.db.QueryRow(ctx, createTaskLog,
+		arg.WorkflowID,
+		arg.TaskName,
+		arg.Body,
+		arg.Level,
+		arg.Fields,
+		arg.Progress,
+	)
 	var i TaskLog
 	err := row.Scan(
 		&i.ID,
@@ -184,14 +203,17 @@ func (q *Queries) CreateTaskLog(ctx context.Context, arg CreateTaskLogParams) (T
 		&i.Body,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.Level,
+		&i.Fields,
+		&i.Progress,
 	)
 	return i, err
 }
 
 const createWorkflow = `-- name: CreateWorkflow :one
-INSERT INTO workflows (id, params, name, schedule_id, created_at, updated_at)
-VALUES ($1, $2, $3, $4, $5, $6)
-RETURNING id, params, name, created_at, updated_at, finished, output, error, schedule_id
+INSERT INTO workflows (id, params, name, schedule_id, created_at, updated_at, definition, dry_run, namespace)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+RETURNING id, params, name, created_at, updated_at, finished, output, error, schedule_id, definition, dry_run, namespace
 `
 
 type CreateWorkflowParams struct {
@@ -201,6 +223,9 @@ type CreateWorkflowParams struct {
 	ScheduleID sql.NullInt32
 	CreatedAt  time.Time
 	UpdatedAt  time.Time
+	Definition sql.NullString
+	DryRun     bool
+	Namespace  string
 }
 
 func (q *Queries) CreateWorkflow(ctx context.Context, arg CreateWorkflowParams) (Workflow, error) {
@@ -211,6 +236,9 @@ func (q *Queries) CreateWorkflow(ctx context.Context, arg CreateWorkflowParams)
 		arg.ScheduleID,
 		arg.CreatedAt,
 		arg.UpdatedAt,
+		arg.Definition,
+		arg.DryRun,
+		arg.Namespace,
 	)
 	var i Workflow
 	err := row.Scan(
@@ -223,6 +251,9 @@ func (q *Queries) CreateWorkflow(ctx context.Context, arg CreateWorkflowParams)
 		&i.Output,
 		&i.Error,
 		&i.ScheduleID,
+		&i.Definition,
+		&i.DryRun,
+		&i.Namespace,
 	)
 	return i, err
 }
@@ -231,7 +262,7 @@ const deleteSchedule = `-- name: DeleteSchedule :one
 DELETE
 FROM schedules
 WHERE id = $1
-RETURNING id, workflow_name, workflow_params, spec, once, interval_minutes, created_at, updated_at
+RETURNING id, workflow_name, workflow_params, spec, once, interval_minutes, created_at, updated_at, namespace
 `
 
 func (q *Queries) DeleteSchedule(ctx context.Context, id int32) (Schedule, error) {
@@ -246,6 +277,7 @@ func (q *Queries) DeleteSchedule(ctx context.Context, id int32) (Schedule, error
 		&i.IntervalMinutes,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.Namespace,
 	)
 	return i, err
 }
@@ -255,7 +287,8 @@ UPDATE tasks
     SET finished = TRUE,
     started      = TRUE,
     error        = 'task interrupted before completion',
-    updated_at   = $2
+    updated_at   = $2,
+    finished_at  = $2
 WHERE workflow_id = $1 and started and not finished
 `
 
@@ -270,7 +303,7 @@ func (q *Queries) FailUnfinishedTasks(ctx context.Context, arg FailUnfinishedTas
 }
 
 const schedules = `-- name: Schedules :many
-SELECT id, workflow_name, workflow_params, spec, once, interval_minutes, created_at, updated_at
+SELECT id, workflow_name, workflow_params, spec, once, interval_minutes, created_at, updated_at, namespace
 FROM schedules
 ORDER BY id
 `
@@ -293,6 +326,7 @@ func (q *Queries) Schedules(ctx context.Context) ([]Schedule, error) {
 			&i.IntervalMinutes,
 			&i.CreatedAt,
 			&i.UpdatedAt,
+			&i.Namespace,
 		); err != nil {
 			return nil, err
 		}
@@ -354,7 +388,7 @@ func (q *Queries) SchedulesLastRun(ctx context.Context) ([]SchedulesLastRunRow,
 }
 
 const task = `-- name: Task :one
-SELECT tasks.workflow_id, tasks.name, tasks.finished, tasks.result, tasks.error, tasks.created_at, tasks.updated_at, tasks.approved_at, tasks.ready_for_approval, tasks.started, tasks.retry_count
+SELECT tasks.workflow_id, tasks.name, tasks.finished, tasks.result, tasks.error, tasks.created_at, tasks.updated_at, tasks.approved_at, tasks.ready_for_approval, tasks.started, tasks.retry_count, tasks.started_at, tasks.finished_at, tasks.args
 FROM tasks
 WHERE workflow_id = $1
   AND name = $2
@@ -381,12 +415,15 @@ func (q *Queries) Task(ctx context.Context, arg TaskParams) (Task, error) {
 		&i.ReadyForApproval,
 		&i.Started,
 		&i.RetryCount,
+		&i.StartedAt,
+		&i.FinishedAt,
+		&i.Args,
 	)
 	return i, err
 }
 
 const taskLogs = `-- name: TaskLogs :many
-SELECT task_logs.id, task_logs.workflow_id, task_logs.task_name, task_logs.body, task_logs.created_at, task_logs.updated_at
+SELECT task_logs.id, task_logs.workflow_id, task_logs.task_name, task_logs.body, task_logs.created_at, task_logs.updated_at, task_logs.level, task_logs.fields, task_logs.progress
 FROM task_logs
 ORDER BY created_at
 `
@@ -407,6 +444,9 @@ func (q *Queries) TaskLogs(ctx context.Context) ([]TaskLog, error) {
 			&i.Body,
 			&i.CreatedAt,
 			&i.UpdatedAt,
+			&i.Level,
+			&i.Fields,
+			&i.Progress,
 		); err != nil {
 			return nil, err
 		}
@@ -419,7 +459,7 @@ func (q *Queries) TaskLogs(ctx context.Context) ([]TaskLog, error) {
 }
 
 const taskLogsForTask = `-- name: TaskLogsForTask :many
-SELECT task_logs.id, task_logs.workflow_id, task_logs.task_name, task_logs.body, task_logs.created_at, task_logs.updated_at
+SELECT task_logs.id, task_logs.workflow_id, task_logs.task_name, task_logs.body, task_logs.created_at, task_logs.updated_at, task_logs.level, task_logs.fields, task_logs.progress
 FROM task_logs
 WHERE workflow_id = $1
   AND task_name = $2
@@ -447,6 +487,9 @@ func (q *Queries) TaskLogsForTask(ctx context.Context, arg TaskLogsForTaskParams
 			&i.Body,
 			&i.CreatedAt,
 			&i.UpdatedAt,
+			&i.Level,
+			&i.Fields,
+			&i.Progress,
 		); err != nil {
 			return nil, err
 		}
@@ -459,7 +502,7 @@ func (q *Queries) TaskLogsForTask(ctx context.Context, arg TaskLogsForTaskParams
 }
 
 const taskLogsForWorkflow = `-- name: TaskLogsForWorkflow :many
-SELECT task_logs.id, task_logs.workflow_id, task_logs.task_name, task_logs.body, task_logs.created_at, task_logs.updated_at
+SELECT task_logs.id, task_logs.workflow_id, task_logs.task_name, task_logs.body, task_logs.created_at, task_logs.updated_at, task_logs.level, task_logs.fields, task_logs.progress
 FROM task_logs
 WHERE workflow_id = $1
 ORDER BY created_at
@@ -481,6 +524,9 @@ func (q *Queries) TaskLogsForWorkflow(ctx context.Context, workflowID uuid.UUID)
 			&i.Body,
 			&i.CreatedAt,
 			&i.UpdatedAt,
+			&i.Level,
+			&i.Fields,
+			&i.Progress,
 		); err != nil {
 			return nil, err
 		}
@@ -498,7 +544,7 @@ WITH most_recent_logs AS (
     FROM task_logs
     GROUP BY workflow_id, task_name
 )
-SELECT tasks.workflow_id, tasks.name, tasks.finished, tasks.result, tasks.error, tasks.created_at, tasks.updated_at, tasks.approved_at, tasks.ready_for_approval, tasks.started, tasks.retry_count,
+SELECT tasks.workflow_id, tasks.name, tasks.finished, tasks.result, tasks.error, tasks.created_at, tasks.updated_at, tasks.approved_at, tasks.ready_for_approval, tasks.started, tasks.retry_count, tasks.started_at, tasks.finished_at, tasks.args,
        GREATEST(most_recent_logs.updated_at, tasks.updated_at)::timestamptz AS most_recent_update
 FROM tasks
 LEFT JOIN most_recent_logs ON tasks.workflow_id = most_recent_logs.workflow_id AND
@@ -518,6 +564,9 @@ type TasksRow struct {
 	ReadyForApproval bool
 	Started          bool
 	RetryCount       int32
+	StartedAt        sql.NullTime
+	FinishedAt       sql.NullTime
+	Args             sql.NullString
 	MostRecentUpdate time.Time
 }
 
@@ -542,6 +591,9 @@ func (q *Queries) Tasks(ctx context.Context) ([]TasksRow, error) {
 			&i.ReadyForApproval,
 			&i.Started,
 			&i.RetryCount,
+			&i.StartedAt,
+			&i.FinishedAt,
+			&i.Args,
 			&i.MostRecentUpdate,
 		); err != nil {
 			return nil, err
@@ -555,7 +607,7 @@ func (q *Queries) Tasks(ctx context.Context) ([]TasksRow, error) {
 }
 
 const tasksForWorkflow = `-- name: TasksForWorkflow :many
-SELECT tasks.workflow_id, tasks.name, tasks.finished, tasks.result, tasks.error, tasks.created_at, tasks.updated_at, tasks.approved_at, tasks.ready_for_approval, tasks.started, tasks.retry_count
+SELECT tasks.workflow_id, tasks.name, tasks.finished, tasks.result, tasks.error, tasks.created_at, tasks.updated_at, tasks.approved_at, tasks.ready_for_approval, tasks.started, tasks.retry_count, tasks.started_at, tasks.finished_at, tasks.args
 FROM tasks
 WHERE workflow_id = $1
 ORDER BY created_at
@@ -582,6 +634,9 @@ func (q *Queries) TasksForWorkflow(ctx context.Context, workflowID uuid.UUID) ([
 			&i.ReadyForApproval,
 			&i.Started,
 			&i.RetryCount,
+			&i.StartedAt,
+			&i.FinishedAt,
+			&i.Args,
 		); err != nil {
 			return nil, err
 		}
@@ -599,7 +654,7 @@ WITH most_recent_logs AS (
     FROM task_logs
     GROUP BY workflow_id, task_name
 )
-SELECT tasks.workflow_id, tasks.name, tasks.finished, tasks.result, tasks.error, tasks.created_at, tasks.updated_at, tasks.approved_at, tasks.ready_for_approval, tasks.started, tasks.retry_count,
+SELECT tasks.workflow_id, tasks.name, tasks.finished, tasks.result, tasks.error, tasks.created_at, tasks.updated_at, tasks.approved_at, tasks.ready_for_approval, tasks.started, tasks.retry_count, tasks.started_at, tasks.finished_at, tasks.args,
        GREATEST(most_recent_logs.updated_at, tasks.updated_at)::timestamptz AS most_recent_update
 FROM tasks
 LEFT JOIN most_recent_logs ON tasks.workflow_id = most_recent_logs.workflow_id AND
@@ -620,6 +675,9 @@ type TasksForWorkflowSortedRow struct {
 	ReadyForApproval bool
 	Started          bool
 	RetryCount       int32
+	StartedAt        sql.NullTime
+	FinishedAt       sql.NullTime
+	Args             sql.NullString
 	MostRecentUpdate time.Time
 }
 
@@ -644,6 +702,9 @@ func (q *Queries) TasksForWorkflowSorted(ctx context.Context, workflowID uuid.UU
 			&i.ReadyForApproval,
 			&i.Started,
 			&i.RetryCount,
+			&i.StartedAt,
+			&i.FinishedAt,
+			&i.Args,
 			&i.MostRecentUpdate,
 		); err != nil {
 			return nil, err
@@ -657,7 +718,7 @@ func (q *Queries) TasksForWorkflowSorted(ctx context.Context, workflowID uuid.UU
 }
 
 const unfinishedWorkflows = `-- name: UnfinishedWorkflows :many
-SELECT workflows.id, workflows.params, workflows.name, workflows.created_at, workflows.updated_at, workflows.finished, workflows.output, workflows.error, workflows.schedule_id
+SELECT workflows.id, workflows.params, workflows.name, workflows.created_at, workflows.updated_at, workflows.finished, workflows.output, workflows.error, workflows.schedule_id, workflows.definition, workflows.dry_run, workflows.namespace
 FROM workflows
 WHERE workflows.finished = FALSE
 `
@@ -681,6 +742,9 @@ func (q *Queries) UnfinishedWorkflows(ctx context.Context) ([]Workflow, error) {
 			&i.Output,
 			&i.Error,
 			&i.ScheduleID,
+			&i.Definition,
+			&i.DryRun,
+			&i.Namespace,
 		); err != nil {
 			return nil, err
 		}
@@ -697,7 +761,7 @@ UPDATE tasks
 SET ready_for_approval = $3
 WHERE workflow_id = $1
   AND name = $2
-RETURNING workflow_id, name, finished, result, error, created_at, updated_at, approved_at, ready_for_approval, started, retry_count
+RETURNING workflow_id, name, finished, result, error, created_at, updated_at, approved_at, ready_for_approval, started, retry_count, started_at, finished_at, args
 `
 
 type UpdateTaskReadyForApprovalParams struct {
@@ -721,14 +785,17 @@ func (q *Queries) UpdateTaskReadyForApproval(ctx context.Context, arg UpdateTask
 		&i.ReadyForApproval,
 		&i.Started,
 		&i.RetryCount,
+		&i.StartedAt,
+		&i.FinishedAt,
+		&i.Args,
 	)
 	return i, err
 }
 
 const upsertTask = `-- name: UpsertTask :one
 INSERT INTO tasks (workflow_id, name, started, finished, result, error, created_at, updated_at,
-                   retry_count)
-VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+                   retry_count, started_at, finished_at, args)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
 ON CONFLICT (workflow_id, name) DO UPDATE
     SET workflow_id = excluded.workflow_id,
         name        = excluded.name,
@@ -737,8 +804,15 @@ ON CONFLICT (workflow_id, name) DO UPDATE
         result      = excluded.result,
         error       = excluded.error,
         updated_at  = excluded.updated_at,
-        retry_count = excluded.retry_count
-RETURNING workflow_id, name, finished, result, error, created_at, updated_at, approved_at, ready_for_approval, started, retry_count
+        retry_count = excluded.retry_count,
+        -- started_at is when the task first started, so that it
+        -- includes retries. finished_at is when the task last
+        -- finished, and is cleared when it's retried.
+        started_at  = COALESCE(tasks.started_at, excluded.started_at),
+        finished_at = CASE WHEN excluded.finished THEN COALESCE(tasks.finished_at, excluded.finished_at) END,
+        -- args are kept while a task waits to be retried.
+        args        = COALESCE(excluded.args, tasks.args)
+RETURNING workflow_id, name, finished, result, error, created_at, updated_at, approved_at, ready_for_approval, started, retry_count, started_at, finished_at, args
 `
 
 type UpsertTaskParams struct {
@@ -751,6 +825,9 @@ type UpsertTaskParams struct {
 	CreatedAt  time.Time
 	UpdatedAt  time.Time
 	RetryCount int32
+	StartedAt  sql.NullTime
+	FinishedAt sql.NullTime
+	Args       sql.NullString
 }
 
 func (q *Queries) UpsertTask(ctx context.Context, arg UpsertTaskParams) (Task, error) {
@@ -764,6 +841,9 @@ func (q *Queries) UpsertTask(ctx context.Context, arg UpsertTaskParams) (Task, e
 		arg.CreatedAt,
 		arg.UpdatedAt,
 		arg.RetryCount,
+		arg.StartedAt,
+		arg.FinishedAt,
+		arg.Args,
 	)
 	var i Task
 	err := row.Scan(
@@ -778,12 +858,15 @@ func (q *Queries) UpsertTask(ctx context.Context, arg UpsertTaskParams) (Task, e
 		&i.ReadyForApproval,
 		&i.Started,
 		&i.RetryCount,
+		&i.StartedAt,
+		&i.FinishedAt,
+		&i.Args,
 	)
 	return i, err
 }
 
 const workflow = `-- name: Workflow :one
-SELECT id, params, name, created_at, updated_at, finished, output, error, schedule_id
+SELECT id, params, name, created_at, updated_at, finished, output, error, schedule_id, definition, dry_run, namespace
 FROM workflows
 WHERE id = $1
 `
@@ -801,6 +884,9 @@ func (q *Queries) Workflow(ctx context.Context, id uuid.UUID) (Workflow, error)
 		&i.Output,
 		&i.Error,
 		&i.ScheduleID,
+		&i.Definition,
+		&i.DryRun,
+		&i.Namespace,
 	)
 	return i, err
 }
@@ -824,7 +910,7 @@ SET finished   = $2,
     error      = $4,
     updated_at = $5
 WHERE workflows.id = $1
-RETURNING id, params, name, created_at, updated_at, finished, output, error, schedule_id
+RETURNING id, params, name, created_at, updated_at, finished, output, error, schedule_id, definition, dry_run, namespace
 `
 
 type WorkflowFinishedParams struct {
@@ -854,6 +940,9 @@ func (q *Queries) WorkflowFinished(ctx context.Context, arg WorkflowFinishedPara
 		&i.Output,
 		&i.Error,
 		&i.ScheduleID,
+		&i.Definition,
+		&i.DryRun,
+		&i.Namespace,
 	)
 	return i, err
 }
@@ -884,15 +973,16 @@ func (q *Queries) WorkflowNames(ctx context.Context) ([]string, error) {
 }
 
 const workflowSidebar = `-- name: WorkflowSidebar :many
-SELECT name, COUNT(*)
+SELECT namespace, name, COUNT(*)
 FROM workflows
-GROUP BY name
+GROUP BY namespace, name
 ORDER BY name
 `
 
 type WorkflowSidebarRow struct {
-	Name  sql.NullString
-	Count int64
+	Namespace string
+	Name      sql.NullString
+	Count     int64
 }
 
 func (q *Queries) WorkflowSidebar(ctx context.Context) ([]WorkflowSidebarRow, error) {
@@ -904,7 +994,7 @@ func (q *Queries) WorkflowSidebar(ctx context.Context) ([]WorkflowSidebarRow, er
 	var items []WorkflowSidebarRow
 	for rows.Next() {
 		var i WorkflowSidebarRow
-		if err := rows.Scan(&i.Name, &i.Count); err != nil {
+		if err := rows.Scan(&i.Namespace, &i.Name, &i.Count); err != nil {
 			return nil, err
 		}
 		items = append(items, i)
@@ -917,7 +1007,7 @@ func (q *Queries) WorkflowSidebar(ctx context.Context) ([]WorkflowSidebarRow, er
 
 const workflows = `-- name: Workflows :many
 
-SELECT id, params, name, created_at, updated_at, finished, output, error, schedule_id
+SELECT id, params, name, created_at, updated_at, finished, output, error, schedule_id, definition, dry_run, namespace
 FROM workflows
 ORDER BY created_at DESC
 `
@@ -944,6 +1034,9 @@ func (q *Queries) Workflows(ctx context.Context) ([]Workflow, error) {
 			&i.Output,
 			&i.Error,
 			&i.ScheduleID,
+			&i.Definition,
+			&i.DryRun,
+			&i.Namespace,
 		); err != nil {
 			return nil, err
 		}
@@ -956,7 +1049,7 @@ func (q *Queries) Workflows(ctx context.Context) ([]Workflow, error) {
 }
 
 const workflowsByName = `-- name: WorkflowsByName :many
-SELECT id, params, name, created_at, updated_at, finished, output, error, schedule_id
+SELECT id, params, name, created_at, updated_at, finished, output, error, schedule_id, definition, dry_run, namespace
 FROM workflows
 WHERE name = $1
 ORDER BY created_at DESC
@@ -981,6 +1074,9 @@ func (q *Queries) WorkflowsByName(ctx context.Context, name sql.NullString) ([]W
 			&i.Output,
 			&i.Error,
 			&i.ScheduleID,
+			&i.Definition,
+			&i.DryRun,
+			&i.Namespace,
 		); err != nil {
 			return nil, err
 		}
@@ -993,7 +1089,7 @@ func (q *Queries) WorkflowsByName(ctx context.Context, name sql.NullString) ([]W
 }
 
 const workflowsByNames = `-- name: WorkflowsByNames :many
-SELECT id, params, name, created_at, updated_at, finished, output, error, schedule_id
+SELECT id, params, name, created_at, updated_at, finished, output, error, schedule_id, definition, dry_run, namespace
 FROM workflows
 WHERE name = ANY($1::text[])
 ORDER BY created_at DESC
@@ -1018,6 +1114,9 @@ func (q *Queries) WorkflowsByNames(ctx context.Context, names []string) ([]Workf
 			&i.Output,
 			&i.Error,
 			&i.ScheduleID,
+			&i.Definition,
+			&i.DryRun,
+			&i.Namespace,
 		); err != nil {
 			return nil, err
 		}
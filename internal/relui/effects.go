@@ -0,0 +1,50 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package relui
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+	"golang.org/x/build/internal/relui/db"
+	"golang.org/x/build/internal/workflow"
+)
+
+// PGEffectStore implements workflow.EffectStore, recording the side
+// effects of tasks in the task_effects table.
+type PGEffectStore struct {
+	DB db.PGDBTX
+}
+
+var _ workflow.EffectStore = (*PGEffectStore)(nil)
+
+// Effect returns the result recorded for the side effect with key.
+func (s *PGEffectStore) Effect(ctx context.Context, key string) (json.RawMessage, bool, error) {
+	e, err := db.New(s.DB).TaskEffect(ctx, key)
+	if errors.Is(err, sql.ErrNoRows) || errors.Is(err, pgx.ErrNoRows) {
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, err
+	}
+	if !e.Result.Valid {
+		return nil, true, nil
+	}
+	return json.RawMessage(e.Result.String), true, nil
+}
+
+// RecordEffect records result for the side effect with key, unless it
+// already has one.
+func (s *PGEffectStore) RecordEffect(ctx context.Context, key string, workflowID uuid.UUID, task string, result json.RawMessage) error {
+	return db.New(s.DB).CreateTaskEffect(ctx, db.CreateTaskEffectParams{
+		Key:        key,
+		WorkflowID: workflowID,
+		TaskName:   task,
+		Result:     sql.NullString{String: string(result), Valid: result != nil},
+	})
+}
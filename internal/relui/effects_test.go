@@ -0,0 +1,40 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package relui
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestPGEffectStore(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s := &PGEffectStore{DB: testDB(ctx, t)}
+	wfID := uuid.New()
+
+	if _, ok, err := s.Effect(ctx, "tag go1.21.0"); err != nil || ok {
+		t.Fatalf("Effect of unrecorded key = _, %v, %v; want false, nil", ok, err)
+	}
+	for _, result := range []json.RawMessage{json.RawMessage(`"abc123"`), json.RawMessage(`"def456"`)} {
+		if err := s.RecordEffect(ctx, "tag go1.21.0", wfID, "tag", result); err != nil {
+			t.Fatalf("RecordEffect(%s) = %v", result, err)
+		}
+	}
+	got, ok, err := s.Effect(ctx, "tag go1.21.0")
+	if err != nil || !ok || string(got) != `"abc123"` {
+		t.Errorf("Effect = %s, %v, %v; want the first recorded result, true, nil", got, ok, err)
+	}
+
+	if err := s.RecordEffect(ctx, "mail announcement", wfID, "mail", nil); err != nil {
+		t.Fatalf("RecordEffect(nil) = %v", err)
+	}
+	if got, ok, err := s.Effect(ctx, "mail announcement"); err != nil || !ok || got != nil {
+		t.Errorf("Effect of action = %s, %v, %v; want nil, true, nil", got, ok, err)
+	}
+}
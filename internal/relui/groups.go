@@ -0,0 +1,108 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package relui
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"golang.org/x/exp/slices"
+	"google.golang.org/api/cloudidentity/v1"
+)
+
+// A GroupLister lists the members of groups.
+type GroupLister interface {
+	// GroupMembers returns the email addresses of the members of
+	// the group with the given email address, including the members
+	// of groups nested in it.
+	GroupMembers(ctx context.Context, group string) ([]string, error)
+}
+
+// A GroupSyncer keeps the members of the Groups of namespaces up to
+// date, so that access to namespaces follows group membership.
+type GroupSyncer struct {
+	Holder *DefinitionHolder
+	Lister GroupLister
+}
+
+// Run syncs group membership every interval until ctx is done.
+func (s *GroupSyncer) Run(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		if err := s.Sync(ctx); err != nil {
+			log.Printf("GroupSyncer.Sync() = %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// Sync syncs group membership once. A namespace with a group whose
+// members can't be listed keeps the members of its last sync.
+func (s *GroupSyncer) Sync(ctx context.Context) error {
+	listed := make(map[string][]string) // by group, as groups may be shared by namespaces
+	var errs []error
+	for _, ns := range s.Holder.Namespaces() {
+		if len(ns.Groups) == 0 {
+			continue
+		}
+		var members []string
+		var err error
+		for _, g := range ns.Groups {
+			m, ok := listed[g]
+			if !ok {
+				m, err = s.Lister.GroupMembers(ctx, g)
+				if err != nil {
+					err = fmt.Errorf("listing members of group %s of namespace %q: %w", g, ns.Name, err)
+					break
+				}
+				listed[g] = m
+			}
+			members = append(members, m...)
+		}
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		sort.Strings(members)
+		s.Holder.setGroupMembers(ns.Name, slices.Compact(members))
+	}
+	return errors.Join(errs...)
+}
+
+// CloudIdentityGroups is a GroupLister of Google Groups, using the
+// Cloud Identity API. The service needs the
+// cloudidentity.CloudIdentityGroupsReadonlyScope scope.
+type CloudIdentityGroups struct {
+	Service *cloudidentity.Service
+}
+
+func (g *CloudIdentityGroups) GroupMembers(ctx context.Context, group string) ([]string, error) {
+	resp, err := g.Service.Groups.Lookup().GroupKeyId(group).Context(ctx).Do()
+	if err != nil {
+		return nil, err
+	}
+	var members []string
+	err = g.Service.Groups.Memberships.SearchTransitiveMemberships(resp.Name).Pages(ctx, func(r *cloudidentity.SearchTransitiveMembershipsResponse) error {
+		for _, m := range r.Memberships {
+			for _, k := range m.PreferredMemberKey {
+				members = append(members, k.Id)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return members, nil
+}
@@ -0,0 +1,85 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package relui
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+type fakeGroupLister map[string][]string
+
+func (l fakeGroupLister) GroupMembers(ctx context.Context, group string) ([]string, error) {
+	members, ok := l[group]
+	if !ok {
+		return nil, errors.New("no such group")
+	}
+	return members, nil
+}
+
+func TestGroupSyncer(t *testing.T) {
+	h := NewDefinitionHolder()
+	h.RegisterNamespace(Namespace{Name: ReleaseNamespace, Members: []string{"owner@example.com"}, Groups: []string{"release@example.com"}})
+	h.RegisterNamespace(Namespace{Name: XReposNamespace, Groups: []string{"release@example.com", "x@example.com"}})
+	h.RegisterNamespace(Namespace{Name: InfraNamespace})
+
+	// Until the first sync, only members are allowed in namespaces
+	// with groups.
+	for ns, email := range map[string]string{ReleaseNamespace: "releaser@example.com", XReposNamespace: "gopher@example.com"} {
+		if h.Namespace(ns).Allows(email) {
+			t.Errorf("namespace %q allows %s before syncing its groups", ns, email)
+		}
+	}
+	if !h.Namespace(ReleaseNamespace).Allows("owner@example.com") {
+		t.Errorf("namespace %q doesn't allow its member before syncing its groups", ReleaseNamespace)
+	}
+
+	lister := fakeGroupLister{
+		"release@example.com": {"releaser@example.com"},
+		"x@example.com":       {"gopher@example.com", "releaser@example.com"},
+	}
+	s := &GroupSyncer{Holder: h, Lister: lister}
+	if err := s.Sync(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		ns, email string
+		want      bool
+	}{
+		{ReleaseNamespace, "owner@example.com", true},
+		{ReleaseNamespace, "releaser@example.com", true},
+		{ReleaseNamespace, "gopher@example.com", false},
+		{XReposNamespace, "releaser@example.com", true},
+		{XReposNamespace, "gopher@example.com", true},
+		{XReposNamespace, "owner@example.com", false},
+		{InfraNamespace, "anyone@example.com", true},
+	} {
+		if got := h.Namespace(tt.ns).Allows(tt.email); got != tt.want {
+			t.Errorf("after sync, namespace %q Allows(%s) = %v; want %v", tt.ns, tt.email, got, tt.want)
+		}
+	}
+
+	// Membership changes are picked up by the next sync, except in
+	// namespaces with groups that can't be listed.
+	lister["release@example.com"] = []string{"newreleaser@example.com"}
+	delete(lister, "x@example.com")
+	if err := s.Sync(context.Background()); err == nil {
+		t.Errorf("Sync with a missing group succeeded; want error")
+	}
+	for _, tt := range []struct {
+		ns, email string
+		want      bool
+	}{
+		{ReleaseNamespace, "newreleaser@example.com", true},
+		{ReleaseNamespace, "releaser@example.com", false},
+		{XReposNamespace, "releaser@example.com", true},
+		{XReposNamespace, "newreleaser@example.com", false},
+	} {
+		if got := h.Namespace(tt.ns).Allows(tt.email); got != tt.want {
+			t.Errorf("after second sync, namespace %q Allows(%s) = %v; want %v", tt.ns, tt.email, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package relui
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/uuid"
+	"golang.org/x/build/internal/relui/db"
+	"golang.org/x/build/internal/workflow"
+)
+
+// TestServerWorkerFlows exercises a workflow end to end through the
+// Server's handlers and a Worker backed by a real database: it's
+// created, waits for approval, fails, survives a restart of the
+// Worker, and finishes once its failed task is retried.
+func TestServerWorkerFlows(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+	p := testDB(ctx, t)
+	q := db.New(p)
+
+	var failing atomic.Bool
+	failing.Store(true)
+	dh := NewDefinitionHolder()
+	wd := workflow.New()
+	greeting := workflow.Param(wd, workflow.ParamDef[string]{Name: "greeting"})
+	greet := workflow.Task1(wd, "greet", func(ctx context.Context, s string) (string, error) {
+		return s + ", world", nil
+	}, greeting)
+	approved := workflow.Action0(wd, "approve", ApproveActionDep(p), workflow.After(greet))
+	flaky := workflow.Task1(wd, "flaky", func(ctx context.Context, s string) (string, error) {
+		if failing.Load() {
+			return "", errors.New("flaky failure")
+		}
+		return s + "!", nil
+	}, greet, workflow.After(approved))
+	workflow.Output(wd, "result", flaky)
+	dh.RegisterDefinition(t.Name(), wd)
+
+	finished := make(chan bool, 1)
+	stalled := make(chan bool, 1)
+	newWorker := func() *Worker {
+		return NewWorker(dh, p, &testWorkflowListener{
+			Listener:   &PGListener{DB: p},
+			onFinished: func() { finished <- true },
+			onStalled: func() {
+				select {
+				case stalled <- true:
+				default:
+				}
+			},
+		})
+	}
+	waitStalled := func() {
+		t.Helper()
+		select {
+		case <-stalled:
+		case <-ctx.Done():
+			t.Fatalf("workflow didn't stall: %v", ctx.Err())
+		}
+	}
+
+	// Create the workflow, as the new workflow form would.
+	w := newWorker()
+	wctx, wcancel := context.WithCancel(ctx)
+	runDone := make(chan bool)
+	go func() {
+		w.Run(wctx)
+		close(runDone)
+	}()
+	s := NewServer(p, w, nil, SiteHeader{}, nil)
+	resp := postForm(t, s, "/workflows", url.Values{
+		"workflow.name":            []string{t.Name()},
+		"workflow.params.greeting": []string{"hello"},
+	})
+	loc := resp.Header.Get("Location")
+	id, err := uuid.Parse(path.Base(loc))
+	if err != nil {
+		t.Fatalf("create redirected to %q, not a workflow: %v", loc, err)
+	}
+
+	// Approve it once the approval task is waiting.
+	waitTask(t, ctx, q, id, "approve", func(task db.Task) bool { return task.ReadyForApproval })
+	postForm(t, s, path.Join("/workflows", id.String(), "tasks", "approve", "approve"), nil)
+
+	// The flaky task exhausts its retries, stalling the workflow.
+	waitStalled()
+	task := waitTask(t, ctx, q, id, "flaky", func(task db.Task) bool { return task.Finished })
+	if !strings.Contains(task.Error.String, "flaky failure") {
+		t.Errorf("flaky task error = %q, want flaky failure", task.Error.String)
+	}
+
+	// Restart the worker, as in a redeployment, and resume the workflow.
+	wcancel()
+	<-runDone
+	select {
+	case <-finished: // the interrupted run
+	default:
+	}
+	select {
+	case <-stalled:
+	default:
+	}
+	w = newWorker()
+	go w.Run(ctx)
+	s = NewServer(p, w, nil, SiteHeader{}, nil)
+	if err := w.Resume(ctx, id); err != nil {
+		t.Fatalf("w.Resume(_, %v) = %v, wanted no error", id, err)
+	}
+	waitStalled()
+
+	// Retrying the failed task finishes the workflow.
+	failing.Store(false)
+	postForm(t, s, path.Join("/workflows", id.String(), "tasks", "flaky", "retry"), nil)
+	select {
+	case <-finished:
+	case <-ctx.Done():
+		t.Fatalf("workflow didn't finish: %v", ctx.Err())
+	}
+	wf, err := q.Workflow(ctx, id)
+	if err != nil {
+		t.Fatalf("q.Workflow(_, %v) = %v, wanted no error", id, err)
+	}
+	if !wf.Finished || wf.Error != "" || !strings.Contains(wf.Output, "hello, world!") {
+		t.Errorf("finished workflow = %+v, want finished with output %q and no error", wf, "hello, world!")
+	}
+	events, err := q.AuditEvents(ctx, db.AuditEventsParams{WorkflowID: id.String(), MaxRows: 10})
+	if err != nil {
+		t.Fatalf("q.AuditEvents(_, %v) = %v, wanted no error", id, err)
+	}
+	var actions []string
+	for _, e := range events {
+		actions = append(actions, e.Action)
+	}
+	want := []string{string(AuditTaskRetried), string(AuditTaskApproved), string(AuditWorkflowCreated)}
+	if diff := cmp.Diff(want, actions); diff != "" {
+		t.Errorf("audit events mismatch (-want +got):\n%s", diff)
+	}
+}
+
+// postForm posts form to s at target, and checks that it redirects.
+func postForm(t *testing.T, s *Server, target string, form url.Values) *http.Response {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	resp := rec.Result()
+	if resp.StatusCode != http.StatusSeeOther {
+		t.Fatalf("POST %s: status %d, want %d\n%s", target, resp.StatusCode, http.StatusSeeOther, rec.Body)
+	}
+	return resp
+}
+
+// waitTask polls the named task of workflow id until cond is true.
+func waitTask(t *testing.T, ctx context.Context, q *db.Queries, id uuid.UUID, name string, cond func(db.Task) bool) db.Task {
+	t.Helper()
+	for {
+		task, err := q.Task(ctx, db.TaskParams{WorkflowID: id, Name: name})
+		if err == nil && cond(task) {
+			return task
+		}
+		select {
+		case <-ctx.Done():
+			t.Fatalf("waiting for task %q: %v (last state %+v, %v)", name, ctx.Err(), task, err)
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+}
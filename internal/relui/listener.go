@@ -76,6 +76,9 @@ func (l *PGListener) TaskStateChanged(workflowID uuid.UUID, taskName string, sta
 			CreatedAt:  updated,
 			UpdatedAt:  updated,
 			RetryCount: int32(state.RetryCount),
+			StartedAt:  sql.NullTime{Time: updated, Valid: state.Started},
+			FinishedAt: sql.NullTime{Time: updated, Valid: state.Finished},
+			Args:       sql.NullString{String: string(state.SerializedArgs), Valid: state.SerializedArgs != nil},
 		})
 		return err
 	})
@@ -85,13 +88,18 @@ func (l *PGListener) TaskStateChanged(workflowID uuid.UUID, taskName string, sta
 	return err
 }
 
-// WorkflowStarted persists a new workflow execution in the database.
-func (l *PGListener) WorkflowStarted(ctx context.Context, workflowID uuid.UUID, name string, params map[string]interface{}, scheduleID int) error {
-	q := db.New(l.DB)
+// WorkflowStarted persists a new workflow execution in the database,
+// along with the shape of the definition it was started with, and the
+// audit event that ctx carries, if the workflow was started by a user.
+func (l *PGListener) WorkflowStarted(ctx context.Context, workflowID uuid.UUID, name, namespace string, params map[string]interface{}, definition *workflow.Graph, scheduleID int, dryRun bool) error {
 	m, err := json.Marshal(params)
 	if err != nil {
 		return err
 	}
+	def, err := json.Marshal(definition)
+	if err != nil {
+		return err
+	}
 	updated := time.Now()
 	wfp := db.CreateWorkflowParams{
 		ID:         workflowID,
@@ -100,9 +108,17 @@ func (l *PGListener) WorkflowStarted(ctx context.Context, workflowID uuid.UUID,
 		ScheduleID: sql.NullInt32{Int32: int32(scheduleID), Valid: scheduleID != 0},
 		CreatedAt:  updated,
 		UpdatedAt:  updated,
+		Definition: sql.NullString{String: string(def), Valid: definition != nil},
+		DryRun:     dryRun,
+		Namespace:  namespace,
 	}
-	_, err = q.CreateWorkflow(ctx, wfp)
-	return err
+	return l.DB.BeginFunc(ctx, func(tx pgx.Tx) error {
+		q := db.New(tx)
+		if _, err := q.CreateWorkflow(ctx, wfp); err != nil {
+			return err
+		}
+		return appendAudit(ctx, q, func(e *auditEvent) { e.WorkflowID = workflowID })
+	})
 }
 
 type scheduledFailureEmailBody struct {
@@ -152,7 +168,8 @@ func (l *PGListener) Logger(workflowID uuid.UUID, taskName string) workflow.Logg
 	}
 }
 
-// postgresLogger logs task output to the database. It implements workflow.Logger.
+// postgresLogger logs task output to the database. It implements
+// workflow.RecordLogger.
 type postgresLogger struct {
 	db         db.PGDBTX
 	workflowID uuid.UUID
@@ -160,22 +177,37 @@ type postgresLogger struct {
 }
 
 func (l *postgresLogger) Printf(format string, v ...interface{}) {
+	l.Log(workflow.Record{Level: workflow.LevelInfo, Message: fmt.Sprintf(format, v...), Progress: -1})
+}
+
+func (l *postgresLogger) Log(r workflow.Record) {
 	ctx := context.Background()
+	var fields sql.NullString
+	if len(r.Fields) > 0 {
+		b, err := json.Marshal(r.Fields)
+		if err != nil {
+			// Keep the record, but note why its fields are missing.
+			b, _ = json.Marshal(map[string]string{"!ERROR": err.Error()})
+		}
+		fields = sql.NullString{String: string(b), Valid: true}
+	}
 	err := l.db.BeginFunc(ctx, func(tx pgx.Tx) error {
 		q := db.New(tx)
-		body := fmt.Sprintf(format, v...)
 		_, err := q.CreateTaskLog(ctx, db.CreateTaskLogParams{
 			WorkflowID: l.workflowID,
 			TaskName:   l.taskName,
-			Body:       body,
+			Body:       r.Message,
+			Level:      r.Level.String(),
+			Fields:     fields,
+			Progress:   sql.NullFloat64{Float64: r.Progress, Valid: r.Progress >= 0},
 		})
 		if err != nil {
-			log.Printf("q.CreateTaskLog(%v, %v, %q) = %v", l.workflowID, l.taskName, body, err)
+			log.Printf("q.CreateTaskLog(%v, %v, %q) = %v", l.workflowID, l.taskName, r.Message, err)
 		}
 		return err
 	})
 	if err != nil {
-		log.Printf("l.Printf(%q, %v) = %v", format, v, err)
+		log.Printf("l.Log(%v) = %v", r, err)
 	}
 }
 
@@ -43,11 +43,12 @@ func TestListenerTaskStateChanged(t *testing.T) {
 			},
 			want: []db.Task{
 				{
-					Name:      "TestTask",
-					Finished:  true,
-					Result:    sql.NullString{String: `{"Value": 5}`, Valid: true},
-					CreatedAt: time.Now(), // cmpopts.EquateApproxTime
-					UpdatedAt: time.Now(), // cmpopts.EquateApproxTime
+					Name:       "TestTask",
+					Finished:   true,
+					Result:     sql.NullString{String: `{"Value": 5}`, Valid: true},
+					CreatedAt:  time.Now(), // cmpopts.EquateApproxTime
+					UpdatedAt:  time.Now(), // cmpopts.EquateApproxTime
+					FinishedAt: sql.NullTime{Time: time.Now(), Valid: true},
 				},
 			},
 		},
@@ -62,12 +63,13 @@ func TestListenerTaskStateChanged(t *testing.T) {
 			},
 			want: []db.Task{
 				{
-					Name:      "TestTask",
-					Finished:  true,
-					Result:    sql.NullString{String: `{"Value": 5}`, Valid: true},
-					Error:     sql.NullString{String: "it's completely broken and hopeless", Valid: true},
-					CreatedAt: time.Now(), // cmpopts.EquateApproxTime
-					UpdatedAt: time.Now(), // cmpopts.EquateApproxTime
+					Name:       "TestTask",
+					Finished:   true,
+					Result:     sql.NullString{String: `{"Value": 5}`, Valid: true},
+					Error:      sql.NullString{String: "it's completely broken and hopeless", Valid: true},
+					CreatedAt:  time.Now(), // cmpopts.EquateApproxTime
+					UpdatedAt:  time.Now(), // cmpopts.EquateApproxTime
+					FinishedAt: sql.NullTime{Time: time.Now(), Valid: true},
 				},
 			},
 		},
@@ -116,6 +118,12 @@ func TestListenerLogger(t *testing.T) {
 
 	l := &PGListener{DB: dbp}
 	l.Logger(wf.ID, "TestTask").Printf("A fancy log line says %q", "hello")
+	l.Logger(wf.ID, "TestTask").(workflow.RecordLogger).Log(workflow.Record{
+		Level:    workflow.LevelWarn,
+		Message:  "Halfway there",
+		Fields:   map[string]interface{}{"file": "go.tar.gz"},
+		Progress: 0.5,
+	})
 
 	logs, err := q.TaskLogs(ctx)
 	if err != nil {
@@ -127,6 +135,16 @@ func TestListenerLogger(t *testing.T) {
 		Body:       `A fancy log line says "hello"`,
 		CreatedAt:  time.Now(), // cmpopts.EquateApproxTime
 		UpdatedAt:  time.Now(), // cmpopts.EquateApproxTime
+		Level:      "INFO",
+	}, {
+		WorkflowID: wf.ID,
+		TaskName:   "TestTask",
+		Body:       "Halfway there",
+		CreatedAt:  time.Now(), // cmpopts.EquateApproxTime
+		UpdatedAt:  time.Now(), // cmpopts.EquateApproxTime
+		Level:      "WARN",
+		Fields:     nullString(`{"file": "go.tar.gz"}`),
+		Progress:   sql.NullFloat64{Float64: 0.5, Valid: true},
 	}}
 	if diff := cmp.Diff(want, logs, cmpopts.EquateApproxTime(time.Minute), cmpopts.IgnoreFields(db.TaskLog{}, "ID")); diff != "" {
 		t.Errorf("q.TaskLogs(_, %q) mismatch (-want +got):\n%s", wf.ID, diff)
@@ -0,0 +1,9 @@
+-- Copyright 2023 The Go Authors. All rights reserved.
+-- Use of this source code is governed by a BSD-style
+-- license that can be found in the LICENSE file.
+
+DROP TRIGGER audit_events_append_only ON audit_events;
+
+DROP FUNCTION audit_events_append_only();
+
+DROP TABLE audit_events;
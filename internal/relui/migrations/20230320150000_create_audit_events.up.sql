@@ -0,0 +1,32 @@
+-- Copyright 2023 The Go Authors. All rights reserved.
+-- Use of this source code is governed by a BSD-style
+-- license that can be found in the LICENSE file.
+
+CREATE TABLE audit_events
+(
+    id          SERIAL PRIMARY KEY,
+    actor       text                     NOT NULL,
+    action      text                     NOT NULL,
+    workflow_id uuid,
+    task_name   text                     NOT NULL DEFAULT '',
+    schedule_id integer,
+    before      jsonb,
+    after       jsonb,
+    created_at  timestamp WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX audit_events_workflow_id_ix ON audit_events (workflow_id);
+
+-- The audit log is append-only.
+CREATE FUNCTION audit_events_append_only() RETURNS trigger AS
+$$
+BEGIN
+    RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_events_append_only
+    BEFORE UPDATE OR DELETE
+    ON audit_events
+    FOR EACH ROW
+EXECUTE FUNCTION audit_events_append_only();
@@ -0,0 +1,8 @@
+-- Copyright 2023 The Go Authors. All rights reserved.
+-- Use of this source code is governed by a BSD-style
+-- license that can be found in the LICENSE file.
+
+ALTER TABLE task_logs
+    DROP COLUMN level,
+    DROP COLUMN fields,
+    DROP COLUMN progress;
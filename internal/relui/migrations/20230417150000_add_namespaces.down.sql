@@ -0,0 +1,9 @@
+-- Copyright 2023 The Go Authors. All rights reserved.
+-- Use of this source code is governed by a BSD-style
+-- license that can be found in the LICENSE file.
+
+ALTER TABLE schedules
+    DROP COLUMN namespace;
+
+ALTER TABLE workflows
+    DROP COLUMN namespace;
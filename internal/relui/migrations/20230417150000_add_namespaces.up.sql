@@ -0,0 +1,27 @@
+-- Copyright 2023 The Go Authors. All rights reserved.
+-- Use of this source code is governed by a BSD-style
+-- license that can be found in the LICENSE file.
+
+ALTER TABLE workflows
+    ADD COLUMN namespace text NOT NULL DEFAULT 'default';
+
+ALTER TABLE schedules
+    ADD COLUMN namespace text NOT NULL DEFAULT 'default';
+
+-- Move existing workflows and schedules to the namespaces their
+-- definitions are registered in.
+UPDATE workflows
+SET namespace = CASE
+    WHEN name IN ('Tag x/ repos', 'Tag a single x/ repo') THEN 'x-repos'
+    WHEN name = 'Update x/crypto NSS root bundle' THEN 'infra'
+    WHEN name = 'echo' THEN 'default'
+    ELSE 'releases'
+END;
+
+UPDATE schedules
+SET namespace = CASE
+    WHEN workflow_name IN ('Tag x/ repos', 'Tag a single x/ repo') THEN 'x-repos'
+    WHEN workflow_name = 'Update x/crypto NSS root bundle' THEN 'infra'
+    WHEN workflow_name = 'echo' THEN 'default'
+    ELSE 'releases'
+END;
@@ -0,0 +1,7 @@
+-- Copyright 2023 The Go Authors. All rights reserved.
+-- Use of this source code is governed by a BSD-style
+-- license that can be found in the LICENSE file.
+
+ALTER TABLE tasks
+    DROP COLUMN started_at,
+    DROP COLUMN finished_at;
@@ -0,0 +1,7 @@
+-- Copyright 2023 The Go Authors. All rights reserved.
+-- Use of this source code is governed by a BSD-style
+-- license that can be found in the LICENSE file.
+
+ALTER TABLE tasks
+    ADD COLUMN started_at  timestamp with time zone,
+    ADD COLUMN finished_at timestamp with time zone;
@@ -0,0 +1,14 @@
+-- Copyright 2023 The Go Authors. All rights reserved.
+-- Use of this source code is governed by a BSD-style
+-- license that can be found in the LICENSE file.
+
+-- task_effects records the side effects of tasks by their idempotency
+-- keys, so that they happen at most once. See workflow.IdempotencyKey.
+CREATE TABLE task_effects
+(
+    key         text PRIMARY KEY,
+    workflow_id uuid                     NOT NULL,
+    task_name   text                     NOT NULL,
+    result      jsonb,
+    created_at  timestamp WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,14 @@
+-- Copyright 2023 The Go Authors. All rights reserved.
+-- Use of this source code is governed by a BSD-style
+-- license that can be found in the LICENSE file.
+
+-- workflow_dependencies records the workflows that only start once
+-- another workflow succeeds. See Worker.StartWorkflowAfter.
+CREATE TABLE workflow_dependencies
+(
+    workflow_id   uuid PRIMARY KEY REFERENCES workflows (id),
+    depends_on_id uuid                     NOT NULL REFERENCES workflows (id),
+    created_at    timestamp WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX workflow_dependencies_depends_on_id_idx ON workflow_dependencies (depends_on_id);
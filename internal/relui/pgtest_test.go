@@ -0,0 +1,177 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package relui
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+var flagDisposableDB = flag.String("test-disposable-pg", "auto", "whether to start a disposable postgres server for database tests: auto (only if no PGDATABASE or PGHOST is set), always, or never")
+
+// disposableDB is the disposable postgres server started for this
+// test binary, if any. It's stopped by TestMain.
+var disposableDB *disposablePostgres
+
+func TestMain(m *testing.M) {
+	flag.Parse()
+	code := m.Run()
+	if disposableDB != nil {
+		disposableDB.stop()
+	}
+	os.Exit(code)
+}
+
+// useDisposableDB reports whether testDB should start a disposable
+// postgres server rather than connect to the one configured by the
+// environment.
+func useDisposableDB() bool {
+	switch *flagDisposableDB {
+	case "always":
+		return true
+	case "never":
+		return false
+	}
+	return *flagTestDB == "" && os.Getenv("PGHOST") == ""
+}
+
+// errNoDisposableDB is returned by startDisposablePostgres when
+// neither a local postgres installation nor docker is available.
+var errNoDisposableDB = errors.New("no postgres binaries or docker found")
+
+// A disposablePostgres is a postgres server that exists only for the
+// duration of a test run, in the manner of testcontainers. It is
+// either a local server whose data directory is a temporary
+// directory, or a docker container.
+type disposablePostgres struct {
+	conn string // libpq key/value connection string, without database
+	stop func()
+}
+
+// startDisposablePostgres starts a disposable postgres server, using
+// the postgres binaries on $PATH or in the standard Debian location
+// if there are any, and otherwise docker.
+func startDisposablePostgres(ctx context.Context) (*disposablePostgres, error) {
+	if bin := postgresBinDir(); bin != "" {
+		return startLocalPostgres(ctx, bin)
+	}
+	if _, err := exec.LookPath("docker"); err == nil {
+		return startDockerPostgres(ctx)
+	}
+	return nil, errNoDisposableDB
+}
+
+// postgresBinDir returns the directory containing initdb and pg_ctl,
+// or the empty string if there is none.
+func postgresBinDir() string {
+	if p, err := exec.LookPath("pg_ctl"); err == nil {
+		return filepath.Dir(p)
+	}
+	// Debian and Ubuntu keep the server binaries out of $PATH.
+	dirs, _ := filepath.Glob("/usr/lib/postgresql/*/bin")
+	sort.Strings(dirs)
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if _, err := os.Stat(filepath.Join(dirs[i], "pg_ctl")); err == nil {
+			return dirs[i]
+		}
+	}
+	return ""
+}
+
+// startLocalPostgres initializes a cluster in a temporary directory
+// and starts a server for it that only listens on a Unix socket in
+// that directory.
+func startLocalPostgres(ctx context.Context, bin string) (*disposablePostgres, error) {
+	dir, err := os.MkdirTemp("", "relui-pg-")
+	if err != nil {
+		return nil, err
+	}
+	data := filepath.Join(dir, "data")
+	run := func(name string, args ...string) error {
+		cmd := exec.CommandContext(ctx, filepath.Join(bin, name), args...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("%s: %v\n%s", name, err, out)
+		}
+		return nil
+	}
+	if err := run("initdb", "-D", data, "-U", "postgres", "--auth=trust", "--no-sync"); err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	opts := fmt.Sprintf("-c listen_addresses='' -k %s -F", dir)
+	if err := run("pg_ctl", "-D", data, "-l", filepath.Join(dir, "log"), "-o", opts, "-w", "start"); err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	return &disposablePostgres{
+		conn: fmt.Sprintf("host=%s user=postgres", dir),
+		stop: func() {
+			exec.Command(filepath.Join(bin, "pg_ctl"), "-D", data, "-m", "immediate", "-w", "stop").Run()
+			os.RemoveAll(dir)
+		},
+	}, nil
+}
+
+// startDockerPostgres starts a postgres container that is removed
+// when it's stopped, and waits for it to accept connections.
+func startDockerPostgres(ctx context.Context) (*disposablePostgres, error) {
+	out, err := exec.CommandContext(ctx, "docker", "run", "--detach", "--rm",
+		"--env", "POSTGRES_HOST_AUTH_METHOD=trust",
+		"--publish", "127.0.0.1::5432",
+		"postgres:15").Output()
+	if err != nil {
+		return nil, fmt.Errorf("docker run: %v", err)
+	}
+	id := strings.TrimSpace(string(out))
+	stop := func() { exec.Command("docker", "rm", "--force", id).Run() }
+	out, err = exec.CommandContext(ctx, "docker", "port", id, "5432/tcp").Output()
+	if err != nil {
+		stop()
+		return nil, fmt.Errorf("docker port: %v", err)
+	}
+	addr, _, _ := bytes.Cut(bytes.TrimSpace(out), []byte("\n"))
+	host, port, err := net.SplitHostPort(string(addr))
+	if err != nil {
+		stop()
+		return nil, fmt.Errorf("docker port: unexpected output %q", out)
+	}
+	pg := &disposablePostgres{
+		conn: fmt.Sprintf("host=%s port=%s user=postgres", host, port),
+		stop: stop,
+	}
+	// The server restarts once after creating its initial database,
+	// so wait until it accepts connections consistently.
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+	for ok := 0; ok < 3; {
+		conn, err := pgx.Connect(ctx, pg.conn+" database=postgres")
+		if err == nil {
+			conn.Close(ctx)
+			ok++
+		} else {
+			ok = 0
+		}
+		select {
+		case <-ctx.Done():
+			stop()
+			return nil, fmt.Errorf("waiting for postgres container: %v", err)
+		case <-time.After(500 * time.Millisecond):
+		}
+	}
+	return pg, nil
+}
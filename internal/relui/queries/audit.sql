@@ -0,0 +1,17 @@
+-- Copyright 2023 The Go Authors. All rights reserved.
+-- Use of this source code is governed by a BSD-style
+-- license that can be found in the LICENSE file.
+
+-- name: CreateAuditEvent :one
+INSERT INTO audit_events (actor, action, workflow_id, task_name, schedule_id, before, after, created_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+RETURNING *;
+
+-- name: AuditEvents :many
+SELECT *
+FROM audit_events
+WHERE (@action::text = '' OR action = @action::text)
+  AND (@actor::text = '' OR actor = @actor::text)
+  AND (@workflow_id::text = '' OR workflow_id::text = @workflow_id::text)
+ORDER BY created_at DESC, id DESC
+LIMIT @max_rows::int;
@@ -0,0 +1,28 @@
+-- Copyright 2023 The Go Authors. All rights reserved.
+-- Use of this source code is governed by a BSD-style
+-- license that can be found in the LICENSE file.
+
+-- name: CreateWorkflowDependency :exec
+INSERT INTO workflow_dependencies (workflow_id, depends_on_id)
+VALUES ($1, $2);
+
+-- name: WorkflowDependency :one
+SELECT *
+FROM workflow_dependencies
+WHERE workflow_id = $1;
+
+-- name: WorkflowDependents :many
+SELECT workflows.*
+FROM workflows
+JOIN workflow_dependencies ON workflows.id = workflow_dependencies.workflow_id
+WHERE workflow_dependencies.depends_on_id = $1
+ORDER BY workflows.created_at;
+
+-- name: LatestUnfailedWorkflowByName :one
+SELECT *
+FROM workflows
+WHERE name = $1
+  AND error = ''
+  AND dry_run = false
+ORDER BY created_at DESC
+LIMIT 1;
@@ -0,0 +1,13 @@
+-- Copyright 2023 The Go Authors. All rights reserved.
+-- Use of this source code is governed by a BSD-style
+-- license that can be found in the LICENSE file.
+
+-- name: TaskEffect :one
+SELECT *
+FROM task_effects
+WHERE key = $1;
+
+-- name: CreateTaskEffect :exec
+INSERT INTO task_effects (key, workflow_id, task_name, result)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT (key) DO NOTHING;
@@ -33,14 +33,14 @@ SELECT COUNT(*)
 FROM workflows;
 
 -- name: WorkflowSidebar :many
-SELECT name, COUNT(*)
+SELECT namespace, name, COUNT(*)
 FROM workflows
-GROUP BY name
+GROUP BY namespace, name
 ORDER BY name;
 
 -- name: CreateWorkflow :one
-INSERT INTO workflows (id, params, name, schedule_id, created_at, updated_at)
-VALUES ($1, $2, $3, $4, $5, $6)
+INSERT INTO workflows (id, params, name, schedule_id, created_at, updated_at, definition, dry_run, namespace)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
 RETURNING *;
 
 -- name: CreateTask :one
@@ -51,8 +51,8 @@ RETURNING *;
 
 -- name: UpsertTask :one
 INSERT INTO tasks (workflow_id, name, started, finished, result, error, created_at, updated_at,
-                   retry_count)
-VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+                   retry_count, started_at, finished_at, args)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
 ON CONFLICT (workflow_id, name) DO UPDATE
     SET workflow_id = excluded.workflow_id,
         name        = excluded.name,
@@ -61,7 +61,14 @@ ON CONFLICT (workflow_id, name) DO UPDATE
         result      = excluded.result,
         error       = excluded.error,
         updated_at  = excluded.updated_at,
-        retry_count = excluded.retry_count
+        retry_count = excluded.retry_count,
+        -- started_at is when the task first started, so that it
+        -- includes retries. finished_at is when the task last
+        -- finished, and is cleared when it's retried.
+        started_at  = COALESCE(tasks.started_at, excluded.started_at),
+        finished_at = CASE WHEN excluded.finished THEN COALESCE(tasks.finished_at, excluded.finished_at) END,
+        -- args are kept while a task waits to be retried.
+        args        = COALESCE(excluded.args, tasks.args)
 RETURNING *;
 
 -- name: Tasks :many
@@ -105,8 +112,8 @@ WHERE workflow_id = $1
 LIMIT 1;
 
 -- name: CreateTaskLog :one
-INSERT INTO task_logs (workflow_id, task_name, body)
-VALUES ($1, $2, $3)
+INSERT INTO task_logs (workflow_id, task_name, body, level, fields, progress)
+VALUES ($1, $2, $3, $4, $5, $6)
 RETURNING *;
 
 -- name: TaskLogsForTask :many
@@ -137,7 +144,8 @@ UPDATE tasks
     SET finished = TRUE,
     started      = TRUE,
     error        = 'task interrupted before completion',
-    updated_at   = $2
+    updated_at   = $2,
+    finished_at  = $2
 WHERE workflow_id = $1 and started and not finished;
 
 -- name: WorkflowFinished :one
@@ -170,8 +178,8 @@ FROM schedules
 ORDER BY id;
 
 -- name: CreateSchedule :one
-INSERT INTO schedules (workflow_name, workflow_params, spec, once, interval_minutes, created_at, updated_at)
-VALUES ($1, $2, $3, $4, $5, $6, $7)
+INSERT INTO schedules (workflow_name, workflow_params, spec, once, interval_minutes, created_at, updated_at, namespace)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
 RETURNING *;
 
 -- name: DeleteSchedule :one
@@ -0,0 +1,54 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package relui
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/google/uuid"
+	"golang.org/x/build/internal/relui/db"
+	"golang.org/x/build/internal/workflow/workflowtest"
+)
+
+// WorkflowRecording returns a recording of the workflow with the given
+// ID, for replaying its definition with workflowtest.Replay. The
+// arguments of tasks that started before relui recorded them, or that
+// can't be marshaled, are unknown.
+func WorkflowRecording(ctx context.Context, p db.PGDBTX, id uuid.UUID) (*workflowtest.Recording, error) {
+	q := db.New(p)
+	wf, err := q.Workflow(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	rec := &workflowtest.Recording{
+		Params: map[string]json.RawMessage{},
+		DryRun: wf.DryRun,
+		Tasks:  map[string]*workflowtest.RecordedTask{},
+	}
+	if wf.Params.Valid {
+		if err := json.Unmarshal([]byte(wf.Params.String), &rec.Params); err != nil {
+			return nil, fmt.Errorf("unmarshaling params of workflow %v: %v", id, err)
+		}
+	}
+	tasks, err := q.TasksForWorkflow(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range tasks {
+		rt := &workflowtest.RecordedTask{Error: t.Error.String, Finished: t.Finished}
+		if t.Result.Valid && t.Result.String != "" {
+			rt.Result = json.RawMessage(t.Result.String)
+		}
+		if t.Args.Valid {
+			if err := json.Unmarshal([]byte(t.Args.String), &rt.Args); err != nil {
+				return nil, fmt.Errorf("unmarshaling args of task %q: %v", t.Name, err)
+			}
+		}
+		rec.Tasks[t.Name] = rt
+	}
+	return rec, nil
+}
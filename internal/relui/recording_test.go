@@ -0,0 +1,64 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package relui
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/uuid"
+	"golang.org/x/build/internal/relui/db"
+	"golang.org/x/build/internal/workflow/workflowtest"
+)
+
+func TestWorkflowRecording(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	p := testDB(ctx, t)
+	q := db.New(p)
+	now := time.Now()
+
+	id := uuid.New()
+	wp := db.CreateWorkflowParams{ID: id, Name: nullString("echo"), Params: nullString(`{"greeting": "hello"}`), Namespace: DefaultNamespace, CreatedAt: now, UpdatedAt: now}
+	if _, err := q.CreateWorkflow(ctx, wp); err != nil {
+		t.Fatalf("CreateWorkflow(_, %v) = _, %v, wanted no error", wp, err)
+	}
+	for _, tp := range []db.CreateTaskParams{
+		{WorkflowID: id, Name: "echo", Finished: true, Result: nullString(`"hello"`), CreatedAt: now, UpdatedAt: now},
+		{WorkflowID: id, Name: "fail", Finished: true, Error: nullString("oops"), CreatedAt: now, UpdatedAt: now},
+		{WorkflowID: id, Name: "wait", CreatedAt: now, UpdatedAt: now},
+	} {
+		if _, err := q.CreateTask(ctx, tp); err != nil {
+			t.Fatalf("CreateTask(_, %v) = _, %v, wanted no error", tp, err)
+		}
+	}
+	up := db.UpsertTaskParams{WorkflowID: id, Name: "echo", Started: true, Finished: true, Result: nullString(`"hello"`), CreatedAt: now, UpdatedAt: now, Args: nullString(`["hello"]`)}
+	if _, err := q.UpsertTask(ctx, up); err != nil {
+		t.Fatalf("UpsertTask(_, %v) = _, %v, wanted no error", up, err)
+	}
+
+	got, err := WorkflowRecording(ctx, p, id)
+	if err != nil {
+		t.Fatalf("WorkflowRecording(_, _, %v) = %v", id, err)
+	}
+	want := &workflowtest.Recording{
+		Params: map[string]json.RawMessage{"greeting": json.RawMessage(`"hello"`)},
+		Tasks: map[string]*workflowtest.RecordedTask{
+			"echo": {Args: []json.RawMessage{json.RawMessage(`"hello"`)}, Result: json.RawMessage(`"hello"`), Finished: true},
+			"fail": {Error: "oops", Finished: true},
+			"wait": {},
+		},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("WorkflowRecording() mismatch (-want +got):\n%s", diff)
+	}
+
+	if _, err := WorkflowRecording(ctx, p, uuid.New()); err == nil {
+		t.Errorf("WorkflowRecording of unknown workflow = nil, wanted error")
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package relui
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+	"github.com/julienschmidt/httprouter"
+	"golang.org/x/build/internal/relui/db"
+	"golang.org/x/build/internal/task"
+)
+
+// workflowReleaseNotes returns the release notes drafted by w, if it's
+// a finished workflow with a task.ReleaseNotesOutput output.
+func workflowReleaseNotes(w db.Workflow) (task.ReleaseNotes, bool) {
+	if w.Output == "" {
+		return task.ReleaseNotes{}, false
+	}
+	var outputs map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(w.Output), &outputs); err != nil {
+		return task.ReleaseNotes{}, false
+	}
+	raw, ok := outputs[task.ReleaseNotesOutput]
+	if !ok {
+		return task.ReleaseNotes{}, false
+	}
+	var notes task.ReleaseNotes
+	if err := json.Unmarshal(raw, &notes); err != nil || notes.Markdown == "" {
+		return task.ReleaseNotes{}, false
+	}
+	return notes, true
+}
+
+type releaseNotesResponse struct {
+	SiteHeader SiteHeader
+	Workflow   db.Workflow
+	Notes      task.ReleaseNotes
+}
+
+// releaseNotesHandler shows the release notes drafted by a workflow,
+// or with the format=md query parameter, serves them as a Markdown
+// file for download.
+func (s *Server) releaseNotesHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	id, err := uuid.Parse(params.ByName("id"))
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	wf, err := db.New(s.db).Workflow(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) || errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("releaseNotesHandler: q.Workflow(_, %q) = %v", id, err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	notes, ok := workflowReleaseNotes(wf)
+	if !ok {
+		http.Error(w, "workflow has no release notes", http.StatusNotFound)
+		return
+	}
+	if r.FormValue("format") == "md" {
+		w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=go1.%d-release-notes.md", notes.Version))
+		io.WriteString(w, notes.Markdown)
+		return
+	}
+	resp := &releaseNotesResponse{SiteHeader: s.header, Workflow: wf, Notes: notes}
+	resp.SiteHeader.Subtitle = fmt.Sprintf("Go 1.%d release notes", notes.Version)
+	out := bytes.Buffer{}
+	if err := s.releaseNotesTmpl.Execute(&out, resp); err != nil {
+		log.Printf("releaseNotesHandler: %v", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	io.Copy(w, &out)
+}
@@ -0,0 +1,38 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package relui
+
+import (
+	"testing"
+
+	"golang.org/x/build/internal/relui/db"
+	"golang.org/x/build/internal/task"
+)
+
+func TestWorkflowReleaseNotes(t *testing.T) {
+	for _, tc := range []struct {
+		desc   string
+		output string
+		want   task.ReleaseNotes
+		wantOK bool
+	}{
+		{
+			desc:   "release notes",
+			output: `{"Release notes": {"Version": 22, "Markdown": "# Go 1.22"}}`,
+			want:   task.ReleaseNotes{Version: 22, Markdown: "# Go 1.22"},
+			wantOK: true,
+		},
+		{desc: "unfinished", output: ""},
+		{desc: "other outputs", output: `{"greeting": "hello"}`},
+		{desc: "wrong type", output: `{"Release notes": "hello"}`},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			got, ok := workflowReleaseNotes(db.Workflow{Output: tc.output})
+			if got != tc.want || ok != tc.wantOK {
+				t.Errorf("workflowReleaseNotes() = %+v, %v, want %+v, %v", got, ok, tc.want, tc.wantOK)
+			}
+		})
+	}
+}
@@ -145,14 +145,18 @@ func (s *Scheduler) Create(ctx context.Context, sched Schedule, workflowName str
 			Spec:           sched.Cron,
 			CreatedAt:      now,
 			UpdatedAt:      now,
+			Namespace:      s.w.dh.DefinitionNamespace(workflowName),
 		})
 		if err != nil {
 			return err
 		}
-		return nil
+		return appendAudit(ctx, q, func(e *auditEvent) { e.ScheduleID, e.After = row.ID, row })
 	})
+	if err != nil {
+		return row, err
+	}
 	s.cron.Schedule(cronSched, &WorkflowSchedule{Schedule: row, worker: s.w, Params: params})
-	return row, err
+	return row, nil
 }
 
 // Resume fetches schedules from the database and schedules them.
@@ -237,9 +241,7 @@ func (s *Scheduler) Delete(ctx context.Context, id int) error {
 	if i == -1 {
 		return ErrScheduleNotFound
 	}
-	entry := entries[i]
-	s.cron.Remove(entry.ID)
-	return s.db.BeginFunc(ctx, func(tx pgx.Tx) error {
+	err := s.db.BeginFunc(ctx, func(tx pgx.Tx) error {
 		q := db.New(tx)
 		if _, err := q.ClearWorkflowSchedule(ctx, int32(id)); err != nil {
 			return err
@@ -247,8 +249,13 @@ func (s *Scheduler) Delete(ctx context.Context, id int) error {
 		if _, err := q.DeleteSchedule(ctx, int32(id)); err != nil {
 			return err
 		}
-		return nil
+		return appendAudit(ctx, q, nil)
 	})
+	if err != nil {
+		return err
+	}
+	s.cron.Remove(entries[i].ID)
+	return nil
 }
 
 type ScheduleEntry struct {
@@ -272,10 +279,18 @@ type WorkflowSchedule struct {
 
 // Run starts a Workflow.
 func (w *WorkflowSchedule) Run() {
+	if w.worker.flags.Killed(flagSchedulesKill) {
+		log.Printf("not starting scheduled workflow %q (schedule %d): feature flag %q is killed", w.Schedule.WorkflowName, w.Schedule.ID, flagSchedulesKill)
+		return
+	}
 	id, err := w.worker.StartWorkflow(context.Background(), w.Schedule.WorkflowName, w.Params, int(w.Schedule.ID))
 	log.Printf("StartWorkflow(_, %q, %v, %d) = %q, %q", w.Schedule.WorkflowName, w.Params, w.Schedule.ID, id, err)
 }
 
+// flagSchedulesKill is the feature flag that, when killed, stops
+// scheduled workflows from starting.
+const flagSchedulesKill = "relui-schedules"
+
 // RunOnce is a cron.Schedule for running a job at a specific time.
 type RunOnce struct {
 	next time.Time
@@ -43,6 +43,7 @@ func TestSchedulerCreate(t *testing.T) {
 			params:       map[string]any{"greeting": "hello", "farewell": "bye"},
 			want: db.Schedule{
 				WorkflowName: "echo",
+				Namespace:    DefaultNamespace,
 				WorkflowParams: sql.NullString{
 					String: `{"farewell": "bye", "greeting": "hello"}`,
 					Valid:  true,
@@ -58,6 +59,7 @@ func TestSchedulerCreate(t *testing.T) {
 					Job: &WorkflowSchedule{
 						Schedule: db.Schedule{
 							WorkflowName: "echo",
+							Namespace:    DefaultNamespace,
 							WorkflowParams: sql.NullString{
 								String: `{"farewell": "bye", "greeting": "hello"}`,
 								Valid:  true,
@@ -78,6 +80,7 @@ func TestSchedulerCreate(t *testing.T) {
 			params:       map[string]any{"greeting": "hello", "farewell": "bye"},
 			want: db.Schedule{
 				WorkflowName: "echo",
+				Namespace:    DefaultNamespace,
 				WorkflowParams: sql.NullString{
 					String: `{"farewell": "bye", "greeting": "hello"}`,
 					Valid:  true,
@@ -93,6 +96,7 @@ func TestSchedulerCreate(t *testing.T) {
 					Job: &WorkflowSchedule{
 						Schedule: db.Schedule{
 							WorkflowName: "echo",
+							Namespace:    DefaultNamespace,
 							WorkflowParams: sql.NullString{
 								String: `{"farewell": "bye", "greeting": "hello"}`,
 								Valid:  true,
@@ -0,0 +1,279 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sign
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf16"
+)
+
+// CheckSignedStructure checks that r has the structure of an artifact
+// signed for bt, as returned by a signing service: a macOS installer
+// package with a signature, a Windows installer with an Authenticode
+// signature, or an ASCII-armored GPG signature.
+//
+// It doesn't validate the signature itself, which needs the platform's
+// tools and trust roots; it only catches artifacts that a signing
+// service returned unsigned or mangled.
+func CheckSignedStructure(bt BuildType, r io.Reader) error {
+	switch bt {
+	case BuildMacOS:
+		return checkPKG(r)
+	case BuildWindows:
+		return checkMSI(r)
+	case BuildGPG:
+		return checkGPG(r)
+	default:
+		return fmt.Errorf("can't check %v signatures", bt)
+	}
+}
+
+// checkPKG checks that r holds a xar archive, the format of macOS
+// installer packages, whose table of contents has a signature.
+// See https://github.com/mackyle/xar/wiki/xarformat.
+func checkPKG(r io.Reader) error {
+	var hdr struct {
+		Magic            [4]byte
+		Size             uint16
+		Version          uint16
+		TOCLen, TOCUnLen uint64
+		ChecksumAlg      uint32
+	}
+	if err := binary.Read(r, binary.BigEndian, &hdr); err != nil {
+		return fmt.Errorf("reading xar header: %v", err)
+	}
+	if string(hdr.Magic[:]) != "xar!" {
+		return errors.New("not a xar archive")
+	}
+	if _, err := io.CopyN(io.Discard, r, int64(hdr.Size)-int64(binary.Size(hdr))); err != nil {
+		return fmt.Errorf("reading xar header: %v", err)
+	}
+	zr, err := zlib.NewReader(io.LimitReader(r, int64(hdr.TOCLen)))
+	if err != nil {
+		return fmt.Errorf("reading xar table of contents: %v", err)
+	}
+	var toc struct {
+		Signature *struct {
+			Style string `xml:"style,attr"`
+		} `xml:"toc>signature"`
+	}
+	if err := xml.NewDecoder(zr).Decode(&toc); err != nil {
+		return fmt.Errorf("reading xar table of contents: %v", err)
+	}
+	if toc.Signature == nil {
+		return errors.New("package isn't signed")
+	}
+	return nil
+}
+
+// checkMSI checks that r holds a compound file, the format of Windows
+// installers, whose root storage has a non-empty \x05DigitalSignature
+// stream, which holds its Authenticode signature. See
+// https://learn.microsoft.com/en-us/openspecs/windows_protocols/ms-cfb.
+func checkMSI(r io.Reader) error {
+	ra, ok := r.(io.ReaderAt)
+	if !ok {
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		ra = bytes.NewReader(data)
+	}
+	cf, err := openCompoundFile(ra)
+	if err != nil {
+		return err
+	}
+	size, ok, err := cf.rootStreamSize("\x05DigitalSignature")
+	if err != nil {
+		return err
+	}
+	if !ok || size == 0 {
+		return errors.New("installer isn't signed")
+	}
+	return nil
+}
+
+// Special sector numbers in compound files.
+const (
+	cfbEndOfChain = 0xfffffffe
+	cfbNoStream   = 0xffffffff
+)
+
+// A compoundFile is an open compound file.
+type compoundFile struct {
+	r          io.ReaderAt
+	sectorSize int64
+	fat        []uint32 // the next sector of each sector's chain
+	dirStart   uint32
+}
+
+// openCompoundFile reads the header and file allocation table of the
+// compound file in r.
+func openCompoundFile(r io.ReaderAt) (*compoundFile, error) {
+	var hdr struct {
+		Magic            [8]byte
+		_                [16]byte // CLSID
+		MinorVersion     uint16
+		MajorVersion     uint16
+		ByteOrder        uint16
+		SectorShift      uint16
+		MiniSectorShift  uint16
+		_                [6]byte
+		NumDirSectors    uint32
+		NumFATSectors    uint32
+		FirstDirSector   uint32
+		_                uint32 // transaction signature
+		MiniStreamCutoff uint32
+		FirstMiniFAT     uint32
+		NumMiniFAT       uint32
+		FirstDIFATSector uint32
+		NumDIFATSectors  uint32
+		DIFAT            [109]uint32
+	}
+	if err := binary.Read(io.NewSectionReader(r, 0, 512), binary.LittleEndian, &hdr); err != nil {
+		return nil, fmt.Errorf("reading compound file header: %v", err)
+	}
+	if hdr.Magic != [8]byte{0xd0, 0xcf, 0x11, 0xe0, 0xa1, 0xb1, 0x1a, 0xe1} {
+		return nil, errors.New("not a compound file")
+	}
+	if hdr.SectorShift != 9 && hdr.SectorShift != 12 {
+		return nil, fmt.Errorf("bad compound file sector shift %d", hdr.SectorShift)
+	}
+	cf := &compoundFile{r: r, sectorSize: 1 << hdr.SectorShift, dirStart: hdr.FirstDirSector}
+	perSector := int(cf.sectorSize / 4)
+
+	// The sectors of the FAT are listed by the DIFAT, which starts in
+	// the header and continues in a chain of DIFAT sectors, the last
+	// entry of each pointing to the next.
+	fatSectors := hdr.DIFAT[:]
+	next := hdr.FirstDIFATSector
+	for i := uint32(0); i < hdr.NumDIFATSectors && next != cfbEndOfChain; i++ {
+		entries, err := cf.readSector(next)
+		if err != nil {
+			return nil, fmt.Errorf("reading DIFAT: %v", err)
+		}
+		fatSectors = append(fatSectors, entries[:perSector-1]...)
+		next = entries[perSector-1]
+	}
+	if uint32(len(fatSectors)) < hdr.NumFATSectors {
+		return nil, errors.New("compound file DIFAT is truncated")
+	}
+	for _, sector := range fatSectors[:hdr.NumFATSectors] {
+		entries, err := cf.readSector(sector)
+		if err != nil {
+			return nil, fmt.Errorf("reading FAT: %v", err)
+		}
+		cf.fat = append(cf.fat, entries...)
+	}
+	return cf, nil
+}
+
+// readSector returns the contents of sector n as little-endian uint32s.
+func (cf *compoundFile) readSector(n uint32) ([]uint32, error) {
+	entries := make([]uint32, cf.sectorSize/4)
+	sr := io.NewSectionReader(cf.r, (int64(n)+1)*cf.sectorSize, cf.sectorSize)
+	if err := binary.Read(sr, binary.LittleEndian, entries); err != nil {
+		return nil, fmt.Errorf("sector %d: %v", n, err)
+	}
+	return entries, nil
+}
+
+// A cfbDirEntry is an entry of a compound file's directory.
+type cfbDirEntry struct {
+	Name        [32]uint16
+	NameLen     uint16 // in bytes, including the terminating NUL
+	Type        uint8  // 1 for storages, 2 for streams, 5 for the root
+	_           uint8  // color
+	Left, Right uint32 // siblings in the parent's red-black tree
+	Child       uint32 // root of the tree of a storage's children
+	_           [36]byte
+	StartSector uint32
+	Size        uint64
+}
+
+// rootStreamSize returns the size of the stream of the root storage
+// with the given name, and whether there is one.
+func (cf *compoundFile) rootStreamSize(name string) (size uint64, ok bool, _ error) {
+	var dir []cfbDirEntry
+	for sector, n := cf.dirStart, 0; sector != cfbEndOfChain; sector, n = cf.fat[sector], n+1 {
+		// A chain can't be longer than the FAT, unless it loops.
+		if int(sector) >= len(cf.fat) || n > len(cf.fat) {
+			return 0, false, errors.New("compound file directory is corrupt")
+		}
+		entries := make([]cfbDirEntry, cf.sectorSize/128)
+		sr := io.NewSectionReader(cf.r, (int64(sector)+1)*cf.sectorSize, cf.sectorSize)
+		if err := binary.Read(sr, binary.LittleEndian, entries); err != nil {
+			return 0, false, fmt.Errorf("reading compound file directory: %v", err)
+		}
+		dir = append(dir, entries...)
+	}
+	if len(dir) == 0 || dir[0].Type != 5 {
+		return 0, false, errors.New("compound file has no root storage")
+	}
+	// Walk the tree of the root's children, guarding against cycles.
+	stack := []uint32{dir[0].Child}
+	seen := make(map[uint32]bool)
+	for len(stack) > 0 {
+		i := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if i == cfbNoStream || seen[i] {
+			continue
+		}
+		if int(i) >= len(dir) {
+			return 0, false, errors.New("compound file directory is corrupt")
+		}
+		seen[i] = true
+		e := dir[i]
+		if n := int(e.NameLen/2) - 1; e.Type == 2 && n > 0 && n <= len(e.Name) && string(utf16.Decode(e.Name[:n])) == name {
+			return e.Size, true, nil
+		}
+		stack = append(stack, e.Left, e.Right)
+	}
+	return 0, false, nil
+}
+
+// checkGPG checks that r holds an ASCII-armored OpenPGP signature.
+// See RFC 4880, section 6.2.
+func checkGPG(r io.Reader) error {
+	data, err := io.ReadAll(io.LimitReader(r, 1<<20))
+	if err != nil {
+		return err
+	}
+	const begin, end = "-----BEGIN PGP SIGNATURE-----", "-----END PGP SIGNATURE-----"
+	lines := strings.Split(strings.TrimSpace(strings.ReplaceAll(string(data), "\r\n", "\n")), "\n")
+	if len(lines) < 3 || lines[0] != begin || lines[len(lines)-1] != end {
+		return errors.New("not an armored PGP signature")
+	}
+	lines = lines[1 : len(lines)-1]
+	// Skip the armor headers, which end with a blank line.
+	for i, l := range lines {
+		if l == "" {
+			lines = lines[i+1:]
+			break
+		}
+	}
+	// The last line may be a checksum, like "=njUN".
+	if n := len(lines); n > 0 && strings.HasPrefix(lines[n-1], "=") {
+		lines = lines[:n-1]
+	}
+	body, err := base64.StdEncoding.DecodeString(strings.Join(lines, ""))
+	if err != nil || len(body) == 0 {
+		return errors.New("armored PGP signature has no valid data")
+	}
+	// The first packet must be a signature packet (tag 2), in either
+	// the old or the new packet format.
+	if tag := body[0]; tag&0x80 == 0 || (tag&0x40 == 0 && (tag>>2)&0xf != 2) || (tag&0x40 != 0 && tag&0x3f != 2) {
+		return errors.New("armored data isn't a PGP signature")
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sign
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/base64"
+	"encoding/binary"
+	"strings"
+	"testing"
+	"unicode/utf16"
+)
+
+// fakeXar returns a xar archive with table of contents toc.
+func fakeXar(t *testing.T, toc string) []byte {
+	var z bytes.Buffer
+	zw := zlib.NewWriter(&z)
+	zw.Write([]byte(toc))
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	var b bytes.Buffer
+	b.WriteString("xar!")
+	binary.Write(&b, binary.BigEndian, uint16(28))
+	binary.Write(&b, binary.BigEndian, uint16(1))
+	binary.Write(&b, binary.BigEndian, uint64(z.Len()))
+	binary.Write(&b, binary.BigEndian, uint64(len(toc)))
+	binary.Write(&b, binary.BigEndian, uint32(1))
+	b.Write(z.Bytes())
+	b.WriteString("heap")
+	return b.Bytes()
+}
+
+// fakeCompoundFile returns a compound file with 512-byte sectors
+// whose root storage has streams with the given names and sizes. The
+// streams have no data.
+func fakeCompoundFile(streams ...interface{}) []byte {
+	const freeSect, endOfChain, fatSect, noStream = 0xffffffff, 0xfffffffe, 0xfffffffd, 0xffffffff
+	var b bytes.Buffer
+	// Header, with the FAT in sector 0 and the directory in sector 1.
+	b.Write([]byte{0xd0, 0xcf, 0x11, 0xe0, 0xa1, 0xb1, 0x1a, 0xe1})
+	b.Write(make([]byte, 16))
+	for _, v := range []uint16{0x3e, 3, 0xfffe, 9, 6} {
+		binary.Write(&b, binary.LittleEndian, v)
+	}
+	b.Write(make([]byte, 6))
+	for _, v := range []uint32{0, 1, 1, 0, 4096, endOfChain, 0, endOfChain, 0, 0} {
+		binary.Write(&b, binary.LittleEndian, v)
+	}
+	for b.Len() < 512 {
+		binary.Write(&b, binary.LittleEndian, uint32(freeSect))
+	}
+	// FAT.
+	binary.Write(&b, binary.LittleEndian, []uint32{fatSect, endOfChain})
+	for b.Len() < 1024 {
+		binary.Write(&b, binary.LittleEndian, uint32(freeSect))
+	}
+	// Directory: the root, then the streams, each the right sibling
+	// of the one before.
+	entry := func(name string, typ uint8, right, child uint32, size uint64) {
+		var e [128]byte
+		n := utf16.Encode([]rune(name))
+		for i, c := range n {
+			binary.LittleEndian.PutUint16(e[2*i:], c)
+		}
+		binary.LittleEndian.PutUint16(e[64:], uint16(2*len(n)+2))
+		e[66] = typ
+		binary.LittleEndian.PutUint32(e[68:], noStream)
+		binary.LittleEndian.PutUint32(e[72:], right)
+		binary.LittleEndian.PutUint32(e[76:], child)
+		binary.LittleEndian.PutUint32(e[116:], endOfChain)
+		binary.LittleEndian.PutUint64(e[120:], size)
+		b.Write(e[:])
+	}
+	n := uint32(len(streams) / 2)
+	child := uint32(noStream)
+	if n > 0 {
+		child = 1
+	}
+	entry("Root Entry", 5, noStream, child, 0)
+	for i := uint32(0); i < n; i++ {
+		right := uint32(noStream)
+		if i+1 < n {
+			right = i + 2
+		}
+		entry(streams[2*i].(string), 2, right, noStream, uint64(streams[2*i+1].(int)))
+	}
+	for b.Len() < 1536 {
+		b.WriteByte(0)
+	}
+	return b.Bytes()
+}
+
+// utf16Bytes returns s encoded as little-endian UTF-16.
+func utf16Bytes(s string) []byte {
+	var b []byte
+	for _, c := range utf16.Encode([]rune(s)) {
+		b = binary.LittleEndian.AppendUint16(b, c)
+	}
+	return b
+}
+
+func fakeArmor(body []byte) []byte {
+	return []byte("-----BEGIN PGP SIGNATURE-----\nComment: test\n\n" +
+		base64.StdEncoding.EncodeToString(body) + "\n=njUN\n-----END PGP SIGNATURE-----\n")
+}
+
+func TestCheckSignedStructure(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		bt      BuildType
+		data    []byte
+		wantErr bool
+	}{
+		{"signed pkg", BuildMacOS, fakeXar(t, `<?xml version="1.0"?><xar><toc><signature style="RSA"></signature><file/></toc></xar>`), false},
+		{"unsigned pkg", BuildMacOS, fakeXar(t, `<?xml version="1.0"?><xar><toc><file/></toc></xar>`), true},
+		{"not a pkg", BuildMacOS, []byte("I'm a PKG!\n"), true},
+		{"signed msi", BuildWindows, fakeCompoundFile("\x05SummaryInformation", 100, "\x05DigitalSignature", 6000), false},
+		{"unsigned msi", BuildWindows, fakeCompoundFile("\x05SummaryInformation", 100), true},
+		{"empty signature", BuildWindows, fakeCompoundFile("\x05SummaryInformation", 100, "\x05DigitalSignature", 0), true},
+		{"signature name in data", BuildWindows, append(fakeCompoundFile("\x05SummaryInformation", 100), utf16Bytes("\x05DigitalSignature")...), true},
+		{"truncated msi", BuildWindows, fakeCompoundFile("\x05DigitalSignature", 6000)[:1024], true},
+		{"not an msi", BuildWindows, []byte("I'm an MSI!\n"), true},
+		{"old format signature", BuildGPG, fakeArmor([]byte{0x89, 0x01, 0x33, 0x04}), false},
+		{"new format signature", BuildGPG, fakeArmor([]byte{0xc2, 0xc0, 0x73, 0x04}), false},
+		{"public key", BuildGPG, fakeArmor([]byte{0x99, 0x01, 0x0d, 0x04}), true},
+		{"bad base64", BuildGPG, []byte("-----BEGIN PGP SIGNATURE-----\n\n!!!\n-----END PGP SIGNATURE-----\n"), true},
+		{"not armored", BuildGPG, []byte("I'm a GPG signature!"), true},
+		{"unspecified", BuildUnspecified, nil, true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckSignedStructure(tt.bt, bytes.NewReader(tt.data))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("CheckSignedStructure(%v) = %v; want error %v", tt.bt, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckGPGCRLF(t *testing.T) {
+	data := strings.ReplaceAll(string(fakeArmor([]byte{0x89, 0x01, 0x33, 0x04})), "\n", "\r\n")
+	if err := CheckSignedStructure(BuildGPG, strings.NewReader(data)); err != nil {
+		t.Errorf("CheckSignedStructure of a signature with CRLF line endings = %v", err)
+	}
+}
@@ -84,9 +84,102 @@
     });
   };
 
+  /**
+   * registerWizardListeners registers listeners for the steps of the new
+   * workflow wizard: removing pre-filled slice rows, and checking that
+   * required slice parameters have a value before going to the next
+   * step. Other fields are checked by the browser.
+   *
+   * @param {string} selector - css selector for the wizard form
+   */
+  const registerWizardListeners = (selector) => {
+    document.querySelectorAll(".NewWorkflow-removeSliceRowButton").forEach((button) => {
+      button.addEventListener("click", (e) => {
+        e.preventDefault();
+        button.parentElement.remove();
+      });
+    });
+    document.querySelectorAll(selector).forEach((form) => {
+      form.addEventListener("submit", (e) => {
+        if (e.submitter && e.submitter.formNoValidate) {
+          return;
+        }
+        for (const param of form.querySelectorAll(".NewWorkflow-parameter--slice[data-required]")) {
+          const values = Array.from(param.querySelectorAll("input, textarea"), (input) => input.value.trim());
+          if (!values.some((v) => v !== "")) {
+            e.preventDefault();
+            alert(`${param.querySelector("label").textContent} needs at least one value.`);
+            return;
+          }
+        }
+      });
+    });
+  };
+
+  /**
+   * registerBulkActionListeners registers listeners for the bulk actions
+   * on selected workflows, which are sent to the bulk API. The result
+   * for each workflow is listed below the actions.
+   *
+   * @param {string} selector - css selector for the bulk actions container
+   */
+  const registerBulkActionListeners = (selector) => {
+    document.querySelectorAll(".WorkflowList-selectAll").forEach((element) => {
+      element.addEventListener("change", () => {
+        element
+          .closest("table")
+          .querySelectorAll(".WorkflowList-select")
+          .forEach((box) => (box.checked = element.checked));
+      });
+    });
+    document.querySelectorAll(selector).forEach((container) => {
+      const results = container.querySelector(".WorkflowList-bulkResults");
+      container.querySelectorAll("button[data-action]").forEach((button) => {
+        button.addEventListener("click", async (e) => {
+          e.preventDefault();
+          const workflows = Array.from(
+            document.querySelectorAll(".WorkflowList-select:checked"),
+            (box) => box.value
+          );
+          if (workflows.length === 0) {
+            alert("Select the workflows to act on first.");
+            return;
+          }
+          if (!confirm(`${button.dataset.confirm}\n\nReady to proceed with ${workflows.length} workflow(s)?`)) {
+            return;
+          }
+          results.replaceChildren();
+          const resp = await fetch(container.dataset.url, {
+            method: "POST",
+            headers: {"Content-Type": "application/json"},
+            body: JSON.stringify({action: button.dataset.action, workflows: workflows}),
+          });
+          if (!resp.ok) {
+            const li = document.createElement("li");
+            li.textContent = `Error: ${await resp.text()}`;
+            results.appendChild(li);
+            return;
+          }
+          for (const r of (await resp.json()).results) {
+            const li = document.createElement("li");
+            li.className = r.ok ? "WorkflowList-bulkResult--ok" : "WorkflowList-bulkResult--error";
+            let text = `${r.workflow}: ${r.ok ? "done" : r.error}`;
+            if (r.tasks) {
+              text += ` (tasks: ${r.tasks.join(", ")})`;
+            }
+            li.textContent = text;
+            results.appendChild(li);
+          }
+        });
+      });
+    });
+  };
+
   const registerListeners = () => {
     registerTaskListExpandListeners(".TaskList-expandableItem");
     addSliceRowListener(".NewWorkflow-addSliceRowButton");
+    registerWizardListeners(".NewWorkflow-wizard");
+    registerBulkActionListeners(".WorkflowList-bulkActions");
   };
   if (document.readyState === "loading") {
     document.addEventListener("DOMContentLoaded", registerListeners);
@@ -0,0 +1,158 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package relui
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"io/fs"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"golang.org/x/build/internal/gcsfs"
+	"golang.org/x/build/internal/relui/db"
+	"golang.org/x/build/types"
+)
+
+// ReleaseStatusFile is the name of the file StatusPublisher writes.
+const ReleaseStatusFile = "release-status.json"
+
+// etaSampleSize is the number of earlier successful runs of a
+// workflow used to estimate how long it takes.
+const etaSampleSize = 5
+
+// releaseStatus summarizes the unfinished workflows of ReleaseNamespace
+// in the database. Other namespaces are left out, since the status is
+// public. link is used to construct links to the workflow pages.
+func releaseStatus(ctx context.Context, p db.PGDBTX, link func(string, ...string) string) (*types.ReleaseStatus, error) {
+	q := db.New(p)
+	wfs, err := q.UnfinishedWorkflows(ctx)
+	if err != nil {
+		return nil, err
+	}
+	status := &types.ReleaseStatus{Updated: time.Now(), Workflows: []types.ReleaseWorkflowStatus{}}
+	durations := make(map[string]time.Duration)
+	for _, wf := range wfs {
+		if wf.Namespace != ReleaseNamespace {
+			continue
+		}
+		tasks, err := q.TasksForWorkflowSorted(ctx, wf.ID)
+		if err != nil {
+			return nil, err
+		}
+		ws := types.ReleaseWorkflowStatus{
+			Name:       wf.Name.String,
+			Namespace:  wf.Namespace,
+			URL:        link("/workflows", wf.ID.String()),
+			Started:    wf.CreatedAt,
+			Steps:      []string{},
+			TasksTotal: len(tasks),
+		}
+		for _, t := range tasks {
+			switch {
+			case t.Finished && t.Error.Valid:
+				ws.Failed = true
+			case t.Finished:
+				ws.TasksDone++
+			case t.ReadyForApproval && !t.ApprovedAt.Valid:
+				ws.Waiting = true
+				ws.Steps = append(ws.Steps, t.Name)
+			case t.Started:
+				ws.Steps = append(ws.Steps, t.Name)
+			}
+		}
+		d, ok := durations[wf.Name.String]
+		if !ok {
+			d, err = typicalDuration(ctx, q, wf.Name)
+			if err != nil {
+				return nil, err
+			}
+			durations[wf.Name.String] = d
+		}
+		if d != 0 {
+			eta := wf.CreatedAt.Add(d)
+			ws.ETA = &eta
+		}
+		status.Workflows = append(status.Workflows, ws)
+	}
+	return status, nil
+}
+
+// typicalDuration returns the mean duration of the most recent
+// successful runs of the named workflow, or 0 if there are none.
+func typicalDuration(ctx context.Context, q *db.Queries, name sql.NullString) (time.Duration, error) {
+	wfs, err := q.WorkflowsByName(ctx, name)
+	if err != nil {
+		return 0, err
+	}
+	var total time.Duration
+	var n int
+	for _, wf := range wfs {
+		if !wf.Finished || wf.Error != "" {
+			continue
+		}
+		total += wf.UpdatedAt.Sub(wf.CreatedAt)
+		if n++; n == etaSampleSize {
+			break
+		}
+	}
+	if n == 0 {
+		return 0, nil
+	}
+	return total / time.Duration(n), nil
+}
+
+// releaseStatusHandler serves the release status as JSON.
+func (s *Server) releaseStatusHandler(w http.ResponseWriter, r *http.Request) {
+	status, err := releaseStatus(r.Context(), s.db, s.BaseLink)
+	if err != nil {
+		log.Printf("releaseStatusHandler: %v", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
+
+// A StatusPublisher periodically publishes the release status as
+// ReleaseStatusFile in a file system, so that tools without access
+// to relui can display it.
+type StatusPublisher struct {
+	DB      db.PGDBTX
+	BaseURL *url.URL // Used for links to workflows. nil means "/".
+	FS      fs.FS    // Must be writable with gcsfs.Create.
+}
+
+// Run publishes the release status every interval until ctx is done.
+func (p *StatusPublisher) Run(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		if err := p.Publish(ctx); err != nil {
+			log.Printf("StatusPublisher.Publish() = %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// Publish publishes the current release status once.
+func (p *StatusPublisher) Publish(ctx context.Context) error {
+	status, err := releaseStatus(ctx, p.DB, BaseLink(p.BaseURL))
+	if err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(status, "", "\t")
+	if err != nil {
+		return err
+	}
+	return gcsfs.WriteFile(p.FS, ReleaseStatusFile, b)
+}
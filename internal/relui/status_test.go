@@ -0,0 +1,71 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package relui
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/google/uuid"
+	"golang.org/x/build/internal/relui/db"
+	"golang.org/x/build/types"
+)
+
+func TestReleaseStatus(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	p := testDB(ctx, t)
+	q := db.New(p)
+
+	dayAgo := time.Now().Add(-24 * time.Hour)
+	hourAgo := time.Now().Add(-1 * time.Hour)
+	// An earlier run of the workflow, which took two hours.
+	done := db.CreateWorkflowParams{ID: uuid.New(), Name: nullString("echo"), Namespace: ReleaseNamespace, CreatedAt: dayAgo, UpdatedAt: dayAgo}
+	if _, err := q.CreateWorkflow(ctx, done); err != nil {
+		t.Fatalf("CreateWorkflow(_, %v) = _, %v, wanted no error", done, err)
+	}
+	if _, err := q.WorkflowFinished(ctx, db.WorkflowFinishedParams{ID: done.ID, Finished: true, Output: "{}", UpdatedAt: dayAgo.Add(2 * time.Hour)}); err != nil {
+		t.Fatalf("WorkflowFinished() = _, %v, wanted no error", err)
+	}
+	running := db.CreateWorkflowParams{ID: uuid.New(), Name: nullString("echo"), Namespace: ReleaseNamespace, CreatedAt: hourAgo, UpdatedAt: hourAgo}
+	// Workflows of other namespaces aren't part of the public status.
+	other := db.CreateWorkflowParams{ID: uuid.New(), Name: nullString("echo"), Namespace: InfraNamespace, CreatedAt: hourAgo, UpdatedAt: hourAgo}
+	for _, wf := range []db.CreateWorkflowParams{running, other} {
+		if _, err := q.CreateWorkflow(ctx, wf); err != nil {
+			t.Fatalf("CreateWorkflow(_, %v) = _, %v, wanted no error", wf, err)
+		}
+	}
+	for _, tp := range []db.CreateTaskParams{
+		{WorkflowID: running.ID, Name: "greeting", Finished: true, CreatedAt: hourAgo, UpdatedAt: hourAgo},
+		{WorkflowID: running.ID, Name: "approve please", ReadyForApproval: true, CreatedAt: hourAgo, UpdatedAt: hourAgo},
+	} {
+		if _, err := q.CreateTask(ctx, tp); err != nil {
+			t.Fatalf("CreateTask(_, %v) = _, %v, wanted no error", tp, err)
+		}
+	}
+
+	got, err := releaseStatus(ctx, p, BaseLink(nil))
+	if err != nil {
+		t.Fatalf("releaseStatus() = %v, wanted no error", err)
+	}
+	eta := hourAgo.Add(2 * time.Hour)
+	want := []types.ReleaseWorkflowStatus{{
+		Name:       "echo",
+		Namespace:  ReleaseNamespace,
+		URL:        "/workflows/" + running.ID.String(),
+		Started:    hourAgo,
+		Steps:      []string{"approve please"},
+		Waiting:    true,
+		TasksDone:  1,
+		TasksTotal: 2,
+		ETA:        &eta,
+	}}
+	if diff := cmp.Diff(want, got.Workflows, cmpopts.EquateApproxTime(time.Minute)); diff != "" {
+		t.Errorf("releaseStatus() mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,269 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package relui
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"runtime/debug"
+	"runtime/metrics"
+	"sync"
+	"time"
+
+	"golang.org/x/build/internal/workflow"
+)
+
+// taskWorkerEnv is set in the environment of the processes started by
+// a SubprocessExecutor, to tell them to run a task rather than serve.
+const taskWorkerEnv = "RELUI_TASK_WORKER"
+
+// IsTaskWorker reports whether this process was started by a
+// SubprocessExecutor to run a task. Such a process must register the
+// same workflow definitions as its parent, then call ServeTask instead
+// of serving.
+func IsTaskWorker() bool {
+	return os.Getenv(taskWorkerEnv) != ""
+}
+
+// A SubprocessExecutor runs the tasks of workflows in task worker
+// subprocesses, one per task, so that a task that panics or leaks
+// memory can't take down relui in the middle of a release.
+type SubprocessExecutor struct {
+	// Command returns the command that starts a task worker. If nil,
+	// the current binary is run again with the same arguments.
+	Command func(ctx context.Context) *exec.Cmd
+	// MemoryLimit is the maximum number of bytes of heap memory a task
+	// may use before it's stopped, or 0 for no limit.
+	MemoryLimit int64
+}
+
+// taskWorkerRequest is sent to a task worker on its standard input.
+type taskWorkerRequest struct {
+	Workflow    string // the name of the workflow's definition
+	MemoryLimit int64
+	Task        *workflow.TaskRequest
+}
+
+// A taskWorkerMessage is sent by a task worker to its parent on file
+// descriptor 3: a Record for each of the task's logs, then the
+// Response.
+type taskWorkerMessage struct {
+	Record   *workflow.Record       `json:",omitempty"`
+	Response *workflow.TaskResponse `json:",omitempty"`
+}
+
+// forWorkflow returns an Executor for workflows of the named definition.
+func (e *SubprocessExecutor) forWorkflow(name string) workflow.Executor {
+	return &subprocessWorkflowExecutor{e, name}
+}
+
+func (e *SubprocessExecutor) command(ctx context.Context) (*exec.Cmd, error) {
+	if e.Command != nil {
+		return e.Command(ctx), nil
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.CommandContext(ctx, exe, os.Args[1:]...)
+	// Give the task a chance to clean up when its workflow is stopped.
+	cmd.Cancel = func() error { return cmd.Process.Signal(os.Interrupt) }
+	cmd.WaitDelay = time.Minute
+	return cmd, nil
+}
+
+type subprocessWorkflowExecutor struct {
+	*SubprocessExecutor
+	workflow string
+}
+
+// maxStderrTail is how much of the end of a task worker's standard
+// error is kept to explain a crash.
+const maxStderrTail = 8 << 10
+
+func (e *subprocessWorkflowExecutor) Execute(ctx context.Context, req *workflow.TaskRequest, logger workflow.Logger) (*workflow.TaskResponse, error) {
+	body, err := json.Marshal(taskWorkerRequest{Workflow: e.workflow, MemoryLimit: e.MemoryLimit, Task: req})
+	if err != nil {
+		return nil, err
+	}
+	cmd, err := e.command(ctx)
+	if err != nil {
+		return nil, err
+	}
+	cmd.Env = append(cmd.Environ(), taskWorkerEnv+"=1")
+	cmd.Stdin = bytes.NewReader(body)
+	if cmd.Stdout == nil {
+		cmd.Stdout = os.Stdout
+	}
+	if cmd.Stderr == nil {
+		cmd.Stderr = os.Stderr
+	}
+	stderr := &tailBuffer{max: maxStderrTail}
+	cmd.Stderr = io.MultiWriter(cmd.Stderr, stderr)
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	cmd.ExtraFiles = []*os.File{w}
+	err = cmd.Start()
+	w.Close()
+	if err != nil {
+		return nil, fmt.Errorf("starting task worker: %v", err)
+	}
+
+	var resp *workflow.TaskResponse
+	dec := json.NewDecoder(r)
+	for {
+		var m taskWorkerMessage
+		if err := dec.Decode(&m); err != nil {
+			break
+		}
+		switch {
+		case m.Record != nil:
+			logRecord(logger, *m.Record)
+		case m.Response != nil && resp == nil:
+			resp = m.Response
+		}
+	}
+	waitErr := cmd.Wait()
+	switch {
+	case resp != nil:
+		return resp, nil
+	case ctx.Err() != nil:
+		return nil, ctx.Err()
+	}
+	return nil, fmt.Errorf("task worker exited without a result: %v\n%s", waitErr, stderr)
+}
+
+// logRecord logs r to l, preserving its structure if l supports it.
+func logRecord(l workflow.Logger, r workflow.Record) {
+	if rl, ok := l.(workflow.RecordLogger); ok {
+		rl.Log(r)
+		return
+	}
+	l.Printf("%s", r)
+}
+
+// tailBuffer is an io.Writer that keeps the last max bytes written.
+type tailBuffer struct {
+	mu  sync.Mutex
+	max int
+	buf []byte
+}
+
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.buf = append(b.buf, p...)
+	if over := len(b.buf) - b.max; over > 0 {
+		b.buf = append(b.buf[:0], b.buf[over:]...)
+	}
+	return len(p), nil
+}
+
+func (b *tailBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return string(b.buf)
+}
+
+// ServeTask runs the task that a SubprocessExecutor started this
+// process for, finding its workflow's definition in dh, and reports the
+// outcome to the parent. See IsTaskWorker.
+func ServeTask(ctx context.Context, dh *DefinitionHolder) error {
+	var req taskWorkerRequest
+	if err := json.NewDecoder(os.Stdin).Decode(&req); err != nil {
+		return fmt.Errorf("reading task request: %v", err)
+	}
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	defer stop()
+	out := os.NewFile(3, "task-worker-messages")
+	defer out.Close()
+	return serveTask(ctx, dh, &req, &taskWorkerLogger{enc: json.NewEncoder(out)}, func() { os.Exit(1) })
+}
+
+// serveTask runs the task of req, sending its logs and outcome to l.
+// If the task exceeds its memory limit, serveTask reports that and
+// calls exit.
+func serveTask(ctx context.Context, dh *DefinitionHolder, req *taskWorkerRequest, l *taskWorkerLogger, exit func()) error {
+	d := dh.Definition(req.Workflow)
+	if d == nil {
+		return l.send(taskWorkerMessage{Response: &workflow.TaskResponse{Error: fmt.Sprintf("unknown workflow %q", req.Workflow), DisableRetries: true}})
+	}
+	if req.MemoryLimit > 0 {
+		// Collect garbage harder when nearing the limit, and stop
+		// the task if it goes over anyway.
+		debug.SetMemoryLimit(req.MemoryLimit)
+		memCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		go func() {
+			if enforceMemoryLimit(memCtx, req.MemoryLimit, time.Second) {
+				l.send(taskWorkerMessage{Response: &workflow.TaskResponse{
+					Error:          fmt.Sprintf("task exceeded its memory limit of %d MiB", req.MemoryLimit>>20),
+					DisableRetries: true,
+				}})
+				exit()
+			}
+		}()
+	}
+	resp := workflow.ExecuteTask(ctx, d, req.Task, l)
+	return l.send(taskWorkerMessage{Response: resp})
+}
+
+// enforceMemoryLimit checks the heap size every interval until ctx is
+// done, and reports whether it went over limit.
+func enforceMemoryLimit(ctx context.Context, limit int64, interval time.Duration) bool {
+	sample := []metrics.Sample{{Name: "/memory/classes/heap/objects:bytes"}}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-t.C:
+		}
+		metrics.Read(sample)
+		if sample[0].Value.Kind() == metrics.KindUint64 && sample[0].Value.Uint64() > uint64(limit) {
+			return true
+		}
+	}
+}
+
+// taskWorkerLogger is the Logger of a task run by a task worker. It
+// sends the task's logs to the parent.
+type taskWorkerLogger struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+func (l *taskWorkerLogger) send(m taskWorkerMessage) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.enc.Encode(m)
+}
+
+func (l *taskWorkerLogger) Printf(format string, v ...interface{}) {
+	l.Log(workflow.Record{Level: workflow.LevelInfo, Message: fmt.Sprintf(format, v...), Progress: -1})
+}
+
+func (l *taskWorkerLogger) Log(r workflow.Record) {
+	if err := l.send(taskWorkerMessage{Record: &r}); err == nil {
+		return
+	}
+	// Some field couldn't be marshaled. Send them as text instead.
+	fields := make(map[string]interface{}, len(r.Fields))
+	for k, v := range r.Fields {
+		fields[k] = fmt.Sprint(v)
+	}
+	r.Fields = fields
+	l.send(taskWorkerMessage{Record: &r})
+}
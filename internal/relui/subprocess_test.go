@@ -0,0 +1,112 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package relui
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/uuid"
+	"golang.org/x/build/internal/workflow"
+)
+
+// taskWorkerDefinitions returns the definitions served by the task
+// worker of TestTaskWorkerHelper.
+func taskWorkerDefinitions() *DefinitionHolder {
+	dh := NewDefinitionHolder()
+	wd := workflow.New()
+	greeting := workflow.Task1(wd, "greet", func(ctx *workflow.TaskContext, name string) (string, error) {
+		ctx.Log(workflow.LevelWarn, "greeting", "name", name)
+		return "hello " + name, nil
+	}, workflow.Const("gopher"))
+	workflow.Output(wd, "greeting", greeting)
+	workflow.Output(wd, "panic", workflow.Task0(wd, "panic", func(context.Context) (string, error) {
+		panic("oh no")
+	}))
+	workflow.Output(wd, "hog", workflow.Task0(wd, "hog", func(ctx context.Context) (string, error) {
+		var hog [][]byte
+		for ctx.Err() == nil {
+			hog = append(hog, make([]byte, 1<<20))
+			time.Sleep(time.Millisecond)
+		}
+		return "", ctx.Err()
+	}))
+	dh.RegisterDefinition("test", wd)
+	return dh
+}
+
+// TestTaskWorkerHelper is the task worker run by the other tests.
+func TestTaskWorkerHelper(t *testing.T) {
+	if !IsTaskWorker() {
+		t.Skip("not a task worker")
+	}
+	if err := ServeTask(context.Background(), taskWorkerDefinitions()); err != nil {
+		t.Fatal(err)
+	}
+	os.Exit(0)
+}
+
+func TestSubprocessExecutor(t *testing.T) {
+	e := &SubprocessExecutor{
+		Command: func(ctx context.Context) *exec.Cmd {
+			cmd := exec.CommandContext(ctx, os.Args[0], "-test.run=^TestTaskWorkerHelper$")
+			cmd.Stdout, cmd.Stderr = io.Discard, io.Discard
+			return cmd
+		},
+		MemoryLimit: 64 << 20,
+	}
+	te := e.forWorkflow("test")
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	logger := &recordingLogger{}
+	resp, err := te.Execute(ctx, &workflow.TaskRequest{WorkflowID: uuid.New(), Task: "greet", Args: []json.RawMessage{[]byte(`"gopher"`)}}, logger)
+	if err != nil {
+		t.Fatalf("Execute(greet) = %v", err)
+	}
+	if diff := cmp.Diff(&workflow.TaskResponse{Result: []byte(`"hello gopher"`)}, resp); diff != "" {
+		t.Errorf("Execute(greet) mismatch (-want +got):\n%s", diff)
+	}
+	wantRecords := []workflow.Record{{Level: workflow.LevelWarn, Message: "greeting", Fields: map[string]interface{}{"name": "gopher"}, Progress: -1}}
+	if diff := cmp.Diff(wantRecords, logger.records); diff != "" {
+		t.Errorf("Execute(greet) logs mismatch (-want +got):\n%s", diff)
+	}
+
+	// A panicking task doesn't take down this process.
+	if _, err := te.Execute(ctx, &workflow.TaskRequest{Task: "panic"}, logger); err == nil || !strings.Contains(err.Error(), "panic: oh no") {
+		t.Errorf("Execute(panic) = %v, want a crash with the panic message", err)
+	}
+
+	// Nor does one that uses too much memory.
+	resp, err = te.Execute(ctx, &workflow.TaskRequest{Task: "hog"}, logger)
+	if err != nil || !strings.Contains(resp.Error, "exceeded its memory limit of 64 MiB") || !resp.DisableRetries {
+		t.Errorf("Execute(hog) = %+v, %v, want a memory limit error", resp, err)
+	}
+
+	resp, err = e.forWorkflow("missing").Execute(ctx, &workflow.TaskRequest{Task: "greet"}, logger)
+	if err != nil || resp.Error != `unknown workflow "missing"` {
+		t.Errorf("Execute of a missing workflow = %+v, %v, want an unknown workflow error", resp, err)
+	}
+}
+
+type recordingLogger struct {
+	records []workflow.Record
+}
+
+func (l *recordingLogger) Printf(format string, v ...interface{}) {
+	l.Log(workflow.Record{Level: workflow.LevelInfo, Message: fmt.Sprintf(format, v...), Progress: -1})
+}
+
+func (l *recordingLogger) Log(r workflow.Record) {
+	l.records = append(l.records, r)
+}
@@ -0,0 +1,174 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package relui
+
+import (
+	"fmt"
+	"html/template"
+	"sort"
+	"time"
+
+	"golang.org/x/build/internal/relui/db"
+	"golang.org/x/build/internal/workflow"
+)
+
+// A timeline is a Gantt chart of the tasks of a workflow. Each task
+// is queued from when its dependencies finished until it first
+// started, and then runs until it finished, including any retries.
+type timeline struct {
+	Start, End time.Time
+	// Tasks are the tasks that have started, in order of their start.
+	Tasks []*timelineTask
+	// CriticalPath is the chain of tasks that gated the end of the
+	// timeline, from the first to the last to finish: each task
+	// waited on the previous one longer than on any other dependency.
+	CriticalPath []string
+}
+
+// A timelineTask is a row of a timeline.
+type timelineTask struct {
+	Name       string
+	Ready      time.Time // when its dependencies finished
+	Started    time.Time
+	Finished   time.Time // the end of the timeline, if Running
+	Running    bool
+	Failed     bool
+	RetryCount int
+	Critical   bool
+
+	// queued and running are the spans' offsets and widths, in
+	// percent of the width of the timeline.
+	queued, running [2]float64
+}
+
+// Queued returns how long t waited to start.
+func (t *timelineTask) Queued() time.Duration {
+	return t.Started.Sub(t.Ready).Round(time.Second)
+}
+
+// Ran returns how long t has run.
+func (t *timelineTask) Ran() time.Duration {
+	return t.Finished.Sub(t.Started).Round(time.Second)
+}
+
+// QueuedStyle returns the CSS positioning t's queued span.
+func (t *timelineTask) QueuedStyle() template.CSS {
+	return spanStyle(t.queued)
+}
+
+// RunningStyle returns the CSS positioning t's running span.
+func (t *timelineTask) RunningStyle() template.CSS {
+	return spanStyle(t.running)
+}
+
+func spanStyle(span [2]float64) template.CSS {
+	return template.CSS(fmt.Sprintf("left: %.3f%%; width: %.3f%%", span[0], span[1]))
+}
+
+// Duration returns the length of the timeline.
+func (tl *timeline) Duration() time.Duration {
+	return tl.End.Sub(tl.Start).Round(time.Second)
+}
+
+// buildTimeline returns the timeline of wf, whose tasks' dependencies
+// are described by g, at time now. g may be nil, in which case no
+// task is shown as queued. It returns nil if no task has started.
+func buildTimeline(wf db.Workflow, tasks []db.TasksForWorkflowSortedRow, g *workflow.Graph, now time.Time) *timeline {
+	tl := &timeline{Start: wf.CreatedAt, End: wf.CreatedAt}
+	byName := make(map[string]*timelineTask)
+	for _, t := range tasks {
+		if !t.StartedAt.Valid {
+			// Not started, or started before start times were recorded.
+			continue
+		}
+		tt := &timelineTask{
+			Name:       t.Name,
+			Started:    t.StartedAt.Time,
+			Finished:   t.FinishedAt.Time,
+			Running:    !t.FinishedAt.Valid,
+			Failed:     t.Error.Valid && t.Error.String != "",
+			RetryCount: int(t.RetryCount),
+		}
+		if tt.Started.Before(tl.Start) {
+			tl.Start = tt.Started
+		}
+		if tt.Running {
+			tl.End = now
+		} else if tt.Finished.After(tl.End) {
+			tl.End = tt.Finished
+		}
+		byName[t.Name] = tt
+		tl.Tasks = append(tl.Tasks, tt)
+	}
+	if len(tl.Tasks) == 0 {
+		return nil
+	}
+	deps := make(map[string][]string)
+	if g != nil {
+		for _, t := range g.Tasks {
+			deps[t.Name] = t.Deps
+		}
+	}
+	for _, tt := range tl.Tasks {
+		if tt.Running {
+			tt.Finished = tl.End
+		}
+	}
+
+	// A task is ready when its last dependency finishes. Tasks
+	// that aren't in the graph, such as those added by expansions,
+	// are considered ready when they start.
+	for _, tt := range tl.Tasks {
+		tt.Ready = tt.Started
+		ds, ok := deps[tt.Name]
+		if !ok {
+			continue
+		}
+		tt.Ready = tl.Start
+		for _, d := range ds {
+			if dt := byName[d]; dt != nil && dt.Finished.After(tt.Ready) {
+				tt.Ready = dt.Finished
+			}
+		}
+		if tt.Ready.After(tt.Started) {
+			// A dependency was retried after the task started.
+			tt.Ready = tt.Started
+		}
+	}
+
+	// Walk back from the last task to finish through the dependency
+	// that finished last, which is the one that held each task up.
+	var last *timelineTask
+	for _, tt := range tl.Tasks {
+		if last == nil || tt.Finished.After(last.Finished) {
+			last = tt
+		}
+	}
+	for cur := last; cur != nil; {
+		cur.Critical = true
+		tl.CriticalPath = append([]string{cur.Name}, tl.CriticalPath...)
+		var next *timelineTask
+		for _, d := range deps[cur.Name] {
+			if dt := byName[d]; dt != nil && !dt.Critical && (next == nil || dt.Finished.After(next.Finished)) {
+				next = dt
+			}
+		}
+		cur = next
+	}
+
+	sort.SliceStable(tl.Tasks, func(i, j int) bool { return tl.Tasks[i].Started.Before(tl.Tasks[j].Started) })
+	total := float64(tl.End.Sub(tl.Start))
+	if total <= 0 {
+		total = 1
+	}
+	percent := func(from, to time.Time) [2]float64 {
+		return [2]float64{float64(from.Sub(tl.Start)) / total * 100, float64(to.Sub(from)) / total * 100}
+	}
+	for _, tt := range tl.Tasks {
+		tt.queued = percent(tt.Ready, tt.Started)
+		tt.running = percent(tt.Started, tt.Finished)
+	}
+	return tl
+}
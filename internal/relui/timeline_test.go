@@ -0,0 +1,88 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package relui
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.org/x/build/internal/relui/db"
+	"golang.org/x/build/internal/workflow"
+)
+
+func TestBuildTimeline(t *testing.T) {
+	start := time.Date(2023, time.May, 2, 12, 0, 0, 0, time.UTC)
+	at := func(minutes int) sql.NullTime {
+		return sql.NullTime{Time: start.Add(time.Duration(minutes) * time.Minute), Valid: true}
+	}
+	// build-linux and build-darwin run in parallel after tag;
+	// publish needs both, and build-darwin finishes last.
+	g := &workflow.Graph{Tasks: []workflow.GraphTask{
+		{Name: "build-darwin", Deps: []string{"tag"}},
+		{Name: "build-linux", Deps: []string{"tag"}},
+		{Name: "publish", Deps: []string{"build-darwin", "build-linux"}},
+		{Name: "tag"},
+	}}
+	wf := db.Workflow{CreatedAt: start}
+	tasks := []db.TasksForWorkflowSortedRow{
+		{Name: "tag", StartedAt: at(0), FinishedAt: at(5)},
+		{Name: "build-linux", StartedAt: at(5), FinishedAt: at(20)},
+		{Name: "build-darwin", StartedAt: at(6), FinishedAt: at(40), RetryCount: 1},
+		{Name: "publish", StartedAt: at(45)},
+		{Name: "announce"}, // not started
+	}
+	now := start.Add(50 * time.Minute)
+
+	tl := buildTimeline(wf, tasks, g, now)
+	if tl == nil {
+		t.Fatal("buildTimeline = nil")
+	}
+	if got, want := tl.Duration(), 50*time.Minute; got != want {
+		t.Errorf("Duration = %v; want %v", got, want)
+	}
+	if diff := cmp.Diff([]string{"tag", "build-darwin", "publish"}, tl.CriticalPath); diff != "" {
+		t.Errorf("CriticalPath mismatch (-want +got):\n%s", diff)
+	}
+
+	type row struct {
+		Name         string
+		Queued, Ran  time.Duration
+		Running      bool
+		Critical     bool
+		QueuedStyle  string
+		RunningStyle string
+	}
+	var got []row
+	for _, tt := range tl.Tasks {
+		got = append(got, row{tt.Name, tt.Queued(), tt.Ran(), tt.Running, tt.Critical, string(tt.QueuedStyle()), string(tt.RunningStyle())})
+	}
+	want := []row{
+		{"tag", 0, 5 * time.Minute, false, true, "left: 0.000%; width: 0.000%", "left: 0.000%; width: 10.000%"},
+		{"build-linux", 0, 15 * time.Minute, false, false, "left: 10.000%; width: 0.000%", "left: 10.000%; width: 30.000%"},
+		{"build-darwin", time.Minute, 34 * time.Minute, false, true, "left: 10.000%; width: 2.000%", "left: 12.000%; width: 68.000%"},
+		{"publish", 5 * time.Minute, 5 * time.Minute, true, true, "left: 80.000%; width: 10.000%", "left: 90.000%; width: 10.000%"},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Tasks mismatch (-want +got):\n%s", diff)
+	}
+
+	// Without a graph, nothing is queued and the critical path is
+	// just the last task.
+	tl = buildTimeline(wf, tasks, nil, now)
+	if diff := cmp.Diff([]string{"publish"}, tl.CriticalPath); diff != "" {
+		t.Errorf("CriticalPath without a graph mismatch (-want +got):\n%s", diff)
+	}
+	for _, tt := range tl.Tasks {
+		if tt.Queued() != 0 {
+			t.Errorf("task %q queued for %v without a graph; want 0", tt.Name, tt.Queued())
+		}
+	}
+
+	if tl := buildTimeline(wf, tasks[4:], g, now); tl != nil {
+		t.Errorf("buildTimeline with no started tasks = %+v; want nil", tl)
+	}
+}
@@ -0,0 +1,231 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package relui
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/build/internal/workflow"
+)
+
+// TracingListener is a Listener that traces each workflow run with
+// OpenTelemetry: a span for the workflow, with a child span for each
+// run of each of its tasks, recording its retries and error. The
+// trace ID is the workflow ID, so the spans of a workflow resumed after
+// a restart of relui join the same trace, as long as the tracer
+// provider is one from NewTracerProvider. The span of a task is in the
+// context of its run, so its calls to other services, such as the
+// coordinator, join the trace too. TracingListener passes all events
+// on to its Listener.
+type TracingListener struct {
+	Listener
+	tracer trace.Tracer
+	now    func() time.Time
+
+	mu   sync.Mutex
+	runs map[uuid.UUID]*tracedRun
+}
+
+// NewTracingListener returns a TracingListener that wraps l, and
+// creates spans with tp.
+func NewTracingListener(l Listener, tp trace.TracerProvider) *TracingListener {
+	return &TracingListener{
+		Listener: l,
+		tracer:   tp.Tracer("golang.org/x/build/internal/relui"),
+		now:      time.Now,
+		runs:     map[uuid.UUID]*tracedRun{},
+	}
+}
+
+// A tracedRun is the trace of a workflow run in progress.
+type tracedRun struct {
+	root  trace.Span
+	tasks map[string]trace.Span // running tasks
+}
+
+// run returns the run of the workflow with the given ID, starting one
+// if there's none, as happens for resumed workflows. l.mu must be held.
+func (l *TracingListener) run(workflowID uuid.UUID, name string, attrs ...attribute.KeyValue) *tracedRun {
+	if r, ok := l.runs[workflowID]; ok {
+		return r
+	}
+	if name == "" {
+		name = "workflow " + workflowID.String()
+		attrs = append(attrs, attribute.Bool("relui.workflow.resumed", true))
+	}
+	ctx := context.WithValue(context.Background(), workflowSpanKey{}, workflowID)
+	_, root := l.tracer.Start(ctx, name,
+		trace.WithNewRoot(),
+		trace.WithTimestamp(l.now()),
+		trace.WithAttributes(attribute.String("relui.workflow.id", workflowID.String())),
+		trace.WithAttributes(attrs...))
+	r := &tracedRun{root: root, tasks: map[string]trace.Span{}}
+	l.runs[workflowID] = r
+	return r
+}
+
+func (l *TracingListener) WorkflowStarted(ctx context.Context, workflowID uuid.UUID, name, namespace string, params map[string]interface{}, definition *workflow.Graph, scheduleID int, dryRun bool) error {
+	attrs := []attribute.KeyValue{
+		attribute.String("relui.workflow.name", name),
+		attribute.String("relui.workflow.namespace", namespace),
+		attribute.Bool("relui.workflow.dry_run", dryRun),
+	}
+	if scheduleID != 0 {
+		attrs = append(attrs, attribute.Int("relui.workflow.schedule_id", scheduleID))
+	}
+	l.mu.Lock()
+	l.run(workflowID, name, attrs...)
+	l.mu.Unlock()
+	return l.Listener.WorkflowStarted(ctx, workflowID, name, namespace, params, definition, scheduleID, dryRun)
+}
+
+func (l *TracingListener) TaskStateChanged(workflowID uuid.UUID, taskName string, state *workflow.TaskState) error {
+	l.mu.Lock()
+	r := l.run(workflowID, "")
+	sp, running := r.tasks[taskName]
+	switch {
+	case !running && state.Started && !state.Finished:
+		_, sp = l.tracer.Start(trace.ContextWithSpan(context.Background(), r.root), taskName,
+			trace.WithTimestamp(l.now()),
+			trace.WithAttributes(
+				attribute.String("relui.workflow.id", workflowID.String()),
+				attribute.String("relui.task.name", taskName)))
+		r.tasks[taskName] = sp
+	case running && !state.Started && state.RetryCount > 0:
+		// The task failed and will be retried.
+		sp.AddEvent("retry", trace.WithTimestamp(l.now()), trace.WithAttributes(attribute.Int("relui.task.retry", state.RetryCount)))
+		sp.SetAttributes(attribute.Int("relui.task.retries", state.RetryCount))
+	case state.Finished:
+		if !running {
+			// Expansions and tasks that finished before a
+			// restart only report that they finished.
+			break
+		}
+		delete(r.tasks, taskName)
+		if state.RetryCount > 0 {
+			sp.SetAttributes(attribute.Int("relui.task.retries", state.RetryCount))
+		}
+		endSpan(sp, state.Error, l.now())
+	}
+	l.mu.Unlock()
+	return l.Listener.TaskStateChanged(workflowID, taskName, state)
+}
+
+// TaskContext returns ctx with the span of the running task, so that
+// the calls the task makes are part of the workflow's trace. It
+// implements workflow.TaskContextListener.
+func (l *TracingListener) TaskContext(ctx context.Context, workflowID uuid.UUID, taskName string) context.Context {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if r, ok := l.runs[workflowID]; ok {
+		if sp, ok := r.tasks[taskName]; ok {
+			return trace.ContextWithSpan(ctx, sp)
+		}
+	}
+	return ctx
+}
+
+func (l *TracingListener) WorkflowFinished(ctx context.Context, workflowID uuid.UUID, outputs map[string]interface{}, workflowErr error) error {
+	l.mu.Lock()
+	r := l.run(workflowID, "")
+	delete(l.runs, workflowID)
+	now := l.now()
+	for _, sp := range r.tasks {
+		endSpan(sp, "workflow ended while the task was running", now)
+	}
+	var msg string
+	if workflowErr != nil {
+		msg = workflowErr.Error()
+	}
+	endSpan(r.root, msg, now)
+	l.mu.Unlock()
+	return l.Listener.WorkflowFinished(ctx, workflowID, outputs, workflowErr)
+}
+
+// endSpan ends sp at t, with the error errMsg if it's not empty.
+func endSpan(sp trace.Span, errMsg string, t time.Time) {
+	if errMsg != "" {
+		sp.SetStatus(codes.Error, errMsg)
+	} else {
+		sp.SetStatus(codes.Ok, "")
+	}
+	sp.End(trace.WithTimestamp(t))
+}
+
+// NewTracerProvider returns a tracer provider for TracingListener that
+// exports spans in batches to the OpenTelemetry collector at endpoint,
+// such as http://otel-collector:4318, with OTLP over HTTP, every
+// interval. It identifies the spans as coming from serviceName. The
+// caller must shut it down to export the last spans.
+func NewTracerProvider(ctx context.Context, endpoint, serviceName string, interval time.Duration) (*sdktrace.TracerProvider, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	opts := []otlptracehttp.Option{
+		otlptracehttp.WithEndpoint(u.Host),
+		otlptracehttp.WithURLPath(strings.TrimSuffix(u.Path, "/") + "/v1/traces"),
+	}
+	switch u.Scheme {
+	case "http":
+		opts = append(opts, otlptracehttp.WithInsecure())
+	case "https":
+	default:
+		return nil, fmt.Errorf("OTLP endpoint %q is not an http or https URL", endpoint)
+	}
+	exp, err := otlptracehttp.New(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return newTracerProvider(serviceName, sdktrace.WithBatcher(exp, sdktrace.WithBatchTimeout(interval))), nil
+}
+
+func newTracerProvider(serviceName string, opts ...sdktrace.TracerProviderOption) *sdktrace.TracerProvider {
+	opts = append(opts,
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", serviceName))),
+		sdktrace.WithIDGenerator(workflowIDGenerator{}))
+	return sdktrace.NewTracerProvider(opts...)
+}
+
+// workflowSpanKey is the context key of the ID of the workflow whose
+// span is being started.
+type workflowSpanKey struct{}
+
+// workflowIDGenerator generates the IDs of spans. The span of a
+// workflow, whose ID is in the context under workflowSpanKey, has the
+// workflow ID as its trace ID and a span ID derived from it, so that
+// task spans from resumed runs have the same parent. Other IDs are
+// random.
+type workflowIDGenerator struct{}
+
+func (g workflowIDGenerator) NewIDs(ctx context.Context) (trace.TraceID, trace.SpanID) {
+	if id, ok := ctx.Value(workflowSpanKey{}).(uuid.UUID); ok {
+		var sid trace.SpanID
+		copy(sid[:], id[8:])
+		return trace.TraceID(id), sid
+	}
+	var tid trace.TraceID
+	rand.Read(tid[:])
+	return tid, g.NewSpanID(ctx, tid)
+}
+
+func (workflowIDGenerator) NewSpanID(ctx context.Context, traceID trace.TraceID) trace.SpanID {
+	var sid trace.SpanID
+	rand.Read(sid[:])
+	return sid
+}
@@ -0,0 +1,136 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package relui
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/build/internal/workflow"
+)
+
+type nopListener struct{}
+
+func (nopListener) TaskStateChanged(uuid.UUID, string, *workflow.TaskState) error { return nil }
+func (nopListener) Logger(uuid.UUID, string) workflow.Logger                      { return nil }
+func (nopListener) WorkflowStalled(uuid.UUID) error                               { return nil }
+func (nopListener) WorkflowStarted(context.Context, uuid.UUID, string, string, map[string]interface{}, *workflow.Graph, int, bool) error {
+	return nil
+}
+func (nopListener) WorkflowFinished(context.Context, uuid.UUID, map[string]interface{}, error) error {
+	return nil
+}
+
+func TestTracingListener(t *testing.T) {
+	exp := tracetest.NewInMemoryExporter()
+	tp := newTracerProvider("relui-test", sdktrace.WithSyncer(exp))
+	defer tp.Shutdown(context.Background())
+	l := NewTracingListener(nopListener{}, tp)
+	start := time.Unix(1693569600, 0)
+	now := start
+	l.now = func() time.Time { now = now.Add(time.Second); return now }
+
+	ctx := context.Background()
+	id := uuid.MustParse("0123456789abcdef0123456789abcdef")
+	l.WorkflowStarted(ctx, id, "release", "go", nil, nil, 0, true)
+	l.TaskStateChanged(id, "build", &workflow.TaskState{Name: "build"})
+	l.TaskStateChanged(id, "build", &workflow.TaskState{Name: "build", Started: true})
+	l.TaskStateChanged(id, "build", &workflow.TaskState{Name: "build", RetryCount: 1})
+	l.TaskStateChanged(id, "build", &workflow.TaskState{Name: "build", Started: true, RetryCount: 1})
+	l.TaskStateChanged(id, "build", &workflow.TaskState{Name: "build", Started: true, Finished: true, RetryCount: 1})
+	l.TaskStateChanged(id, "sign", &workflow.TaskState{Name: "sign", Started: true})
+
+	// The context of a running task has its span.
+	signCtx := trace.SpanContextFromContext(l.TaskContext(ctx, id, "sign"))
+	if !signCtx.IsValid() {
+		t.Errorf("TaskContext of running task has no span")
+	}
+	if sc := trace.SpanContextFromContext(l.TaskContext(ctx, id, "build")); sc.IsValid() {
+		t.Errorf("TaskContext of finished task has span %v; want none", sc.SpanID())
+	}
+
+	l.TaskStateChanged(id, "sign", &workflow.TaskState{Name: "sign", Started: true, Finished: true, Error: "signing failed"})
+	l.TaskStateChanged(id, "tag", &workflow.TaskState{Name: "tag", Started: true})
+	l.WorkflowFinished(ctx, id, nil, errors.New("task sign failed"))
+
+	type span struct {
+		Name, Parent string
+		Start, End   int64 // seconds after start
+		Events       []string
+		Status       sdktrace.Status
+	}
+	var got []span
+	for _, sp := range exp.GetSpans() {
+		if sp.SpanContext.TraceID().String() != "0123456789abcdef0123456789abcdef" {
+			t.Errorf("span %q has trace ID %s; want the workflow ID", sp.Name, sp.SpanContext.TraceID())
+		}
+		if sp.Name == "sign" && sp.SpanContext.SpanID() != signCtx.SpanID() {
+			t.Errorf("span %q has ID %s; want %s, from TaskContext", sp.Name, sp.SpanContext.SpanID(), signCtx.SpanID())
+		}
+		s := span{Name: sp.Name, Status: sp.Status}
+		if sp.Parent.IsValid() {
+			s.Parent = sp.Parent.SpanID().String()
+		}
+		s.Start = sp.StartTime.Unix() - start.Unix()
+		s.End = sp.EndTime.Unix() - start.Unix()
+		for _, ev := range sp.Events {
+			s.Events = append(s.Events, ev.Name)
+		}
+		got = append(got, s)
+	}
+	const root = "0123456789abcdef"
+	want := []span{
+		{Name: "build", Parent: root, Start: 2, End: 4, Events: []string{"retry"}, Status: sdktrace.Status{Code: codes.Ok}},
+		{Name: "sign", Parent: root, Start: 5, End: 6, Status: sdktrace.Status{Code: codes.Error, Description: "signing failed"}},
+		{Name: "tag", Parent: root, Start: 7, End: 8, Status: sdktrace.Status{Code: codes.Error, Description: "workflow ended while the task was running"}},
+		{Name: "release", Start: 1, End: 8, Status: sdktrace.Status{Code: codes.Error, Description: "task sign failed"}},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("exported spans mismatch (-want +got):\n%s", diff)
+	}
+	for _, sp := range exp.GetSpans() {
+		if v, _ := sp.Resource.Set().Value("service.name"); v != attribute.StringValue("relui-test") {
+			t.Errorf("span %q has service.name %q; want relui-test", sp.Name, v.Emit())
+		}
+	}
+}
+
+func TestTracingListenerResumed(t *testing.T) {
+	exp := tracetest.NewInMemoryExporter()
+	tp := newTracerProvider("relui-test", sdktrace.WithSyncer(exp))
+	defer tp.Shutdown(context.Background())
+	l := NewTracingListener(nopListener{}, tp)
+
+	// A workflow resumed after a restart only reports its tasks.
+	ctx := context.Background()
+	id := uuid.MustParse("0123456789abcdef0123456789abcdef")
+	l.TaskStateChanged(id, "build", &workflow.TaskState{Name: "build", Started: true})
+	l.TaskStateChanged(id, "build", &workflow.TaskState{Name: "build", Started: true, Finished: true})
+	l.WorkflowFinished(ctx, id, nil, nil)
+
+	spans := exp.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("got %d spans; want 2", len(spans))
+	}
+	task, root := spans[0], spans[1]
+	if got, want := root.SpanContext.SpanID().String(), "0123456789abcdef"; got != want {
+		t.Errorf("workflow span ID = %s; want %s", got, want)
+	}
+	if task.Parent.SpanID() != root.SpanContext.SpanID() {
+		t.Errorf("task span parent = %s; want the workflow span %s", task.Parent.SpanID(), root.SpanContext.SpanID())
+	}
+	if got, want := root.Name, "workflow "+id.String(); got != want {
+		t.Errorf("workflow span name = %q; want %q", got, want)
+	}
+}
@@ -25,6 +25,7 @@ import (
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v4"
 	"github.com/julienschmidt/httprouter"
+	"golang.org/x/build/internal/featureflag"
 	"golang.org/x/build/internal/metrics"
 	"golang.org/x/build/internal/relui/db"
 	"golang.org/x/build/internal/task"
@@ -40,6 +41,8 @@ type SiteHeader struct {
 	CSSClass  string // Site header CSS class name. Optional.
 	Subtitle  string
 	NameParam string
+	// NamespaceParam is the name of the namespace being viewed, if any.
+	NamespaceParam string
 }
 
 // Server implements the http handlers for relui.
@@ -53,9 +56,11 @@ type Server struct {
 	// mux used if baseURL is set
 	bm *http.ServeMux
 
-	templates       *template.Template
-	homeTmpl        *template.Template
-	newWorkflowTmpl *template.Template
+	templates        *template.Template
+	homeTmpl         *template.Template
+	newWorkflowTmpl  *template.Template
+	auditTmpl        *template.Template
+	releaseNotesTmpl *template.Template
 }
 
 // NewServer initializes a server with the provided connection pool,
@@ -78,6 +83,7 @@ func NewServer(p db.PGDBTX, w *Worker, baseURL *url.URL, header SiteHeader, ms *
 		"allWorkflowsCount":     s.allWorkflowsCount,
 		"baseLink":              s.BaseLink,
 		"hasPrefix":             strings.HasPrefix,
+		"join":                  strings.Join,
 		"pathBase":              path.Base,
 		"prettySize":            prettySize,
 		"sidebarWorkflows":      s.sidebarWorkflows,
@@ -86,14 +92,21 @@ func NewServer(p db.PGDBTX, w *Worker, baseURL *url.URL, header SiteHeader, ms *
 	s.templates = template.Must(template.New("").Funcs(helpers).ParseFS(templates, "templates/*.html"))
 	s.homeTmpl = s.mustLookup("home.html")
 	s.newWorkflowTmpl = s.mustLookup("new_workflow.html")
+	s.auditTmpl = s.mustLookup("audit.html")
+	s.releaseNotesTmpl = s.mustLookup("release_notes.html")
 	s.m.GET("/workflows/:id", s.showWorkflowHandler)
+	s.m.GET("/workflows/:id/release-notes", s.releaseNotesHandler)
 	s.m.POST("/workflows/:id/stop", s.stopWorkflowHandler)
 	s.m.POST("/workflows/:id/tasks/:name/retry", s.retryTaskHandler)
 	s.m.POST("/workflows/:id/tasks/:name/approve", s.approveTaskHandler)
 	s.m.POST("/schedules/:id/delete", s.deleteScheduleHandler)
 	s.m.Handler(http.MethodGet, "/metrics", ms)
 	s.m.Handler(http.MethodGet, "/new_workflow", http.HandlerFunc(s.newWorkflowHandler))
+	s.m.Handler(http.MethodPost, "/new_workflow", http.HandlerFunc(s.newWorkflowHandler))
+	s.m.Handler(http.MethodGet, "/audit", http.HandlerFunc(s.auditHandler))
+	s.m.Handler(http.MethodGet, "/api/release-status", http.HandlerFunc(s.releaseStatusHandler))
 	s.m.Handler(http.MethodPost, "/workflows", http.HandlerFunc(s.createWorkflowHandler))
+	s.m.Handler(http.MethodPost, "/api/workflows/bulk", http.HandlerFunc(s.bulkHandler))
 	s.m.ServeFiles("/static/*filepath", http.FS(static))
 	s.m.Handler(http.MethodGet, "/", http.HandlerFunc(s.homeHandler))
 	if baseURL != nil && baseURL.Path != "/" && baseURL.Path != "" {
@@ -105,6 +118,22 @@ func NewServer(p db.PGDBTX, w *Worker, baseURL *url.URL, header SiteHeader, ms *
 	return s
 }
 
+// HandleFeatureFlags serves the UI and API of the build
+// infrastructure's feature flags in store at /flags. Members of the
+// infrastructure namespace may edit them. If set is non-nil, it's
+// refreshed after each edit.
+func (s *Server) HandleFeatureFlags(store featureflag.Store, set *featureflag.Set) {
+	h := &featureflag.Handler{
+		Store: store,
+		Set:   set,
+		Authorize: func(w http.ResponseWriter, r *http.Request) (string, bool) {
+			return requestActor(r), s.authorize(w, r, InfraNamespace)
+		},
+	}
+	s.m.Handler(http.MethodGet, "/flags", h)
+	s.m.Handler(http.MethodPost, "/flags", h)
+}
+
 func (s *Server) allWorkflowsCount() int64 {
 	count, err := db.New(s.db).WorkflowCount(context.Background())
 	if err != nil {
@@ -113,26 +142,77 @@ func (s *Server) allWorkflowsCount() int64 {
 	return count
 }
 
-func (s *Server) sidebarWorkflows(nameParam string) []db.WorkflowSidebarRow {
+// A sidebarNamespace is a group of workflow rows in the sidebar.
+type sidebarNamespace struct {
+	Namespace *Namespace // nil for the final group, of workflows with no registered definition
+	Workflows []db.WorkflowSidebarRow
+}
+
+func (s *Server) sidebarWorkflows(nameParam string) []sidebarNamespace {
 	sb, err := db.New(s.db).WorkflowSidebar(context.Background())
 	if err != nil {
 		panic(fmt.Sprintf("sidebarWorkflows: %q", err))
 	}
-	var filtered []db.WorkflowSidebarRow
+	var groups []sidebarNamespace
+	index := make(map[string]int) // namespace name → index in groups
+	for _, ns := range s.w.dh.Namespaces() {
+		index[ns.Name] = len(groups)
+		groups = append(groups, sidebarNamespace{Namespace: ns})
+	}
 	others := db.WorkflowSidebarRow{Name: sql.NullString{String: "Others", Valid: true}}
 	for _, row := range sb {
-		if s.w.dh.Definition(row.Name.String) == nil {
+		i, ok := index[row.Namespace]
+		if !ok || s.w.dh.Definition(row.Name.String) == nil {
 			others.Count += row.Count
 			continue
 		}
-		filtered = append(filtered, row)
+		groups[i].Workflows = append(groups[i].Workflows, row)
 	}
-	filtered = append(filtered, others)
 	// Add a new row when on the newWorkflowsHandler if the workflow has never been run.
-	if s.w.dh.Definition(nameParam) != nil && slices.IndexFunc(filtered, func(row db.WorkflowSidebarRow) bool { return row.Name.String == nameParam }) == -1 {
-		filtered = append(filtered, db.WorkflowSidebarRow{Name: sql.NullString{String: nameParam, Valid: true}})
+	if i, ok := index[s.w.dh.DefinitionNamespace(nameParam)]; ok && slices.IndexFunc(groups[i].Workflows, func(row db.WorkflowSidebarRow) bool { return row.Name.String == nameParam }) == -1 {
+		groups[i].Workflows = append(groups[i].Workflows, db.WorkflowSidebarRow{Namespace: groups[i].Namespace.Name, Name: sql.NullString{String: nameParam, Valid: true}})
 	}
-	return filtered
+	return append(groups, sidebarNamespace{Workflows: []db.WorkflowSidebarRow{others}})
+}
+
+// authorize reports whether the user responsible for r may act on
+// the workflows and schedules of the namespace with the given name.
+// If not, it replies with a 403 Forbidden error.
+//
+// Namespaces that aren't registered, such as those of workflows whose
+// definitions have since been removed, have no restrictions.
+func (s *Server) authorize(w http.ResponseWriter, r *http.Request, namespace string) bool {
+	if err := s.authorizationError(r, namespace); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// authorizationError is like authorize, but returns an error instead
+// of replying.
+func (s *Server) authorizationError(r *http.Request, namespace string) error {
+	ns := s.w.dh.Namespace(namespace)
+	if ns == nil || ns.Allows(requestActor(r)) {
+		return nil
+	}
+	return fmt.Errorf("%s is not a member of namespace %q", requestActor(r), ns.Name)
+}
+
+// authorizeWorkflow is like authorize, for the namespace of the
+// workflow with the given ID. It replies with a 404 Not Found error if
+// there is no such workflow.
+func (s *Server) authorizeWorkflow(w http.ResponseWriter, r *http.Request, id uuid.UUID) bool {
+	wf, err := db.New(s.db).Workflow(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) || errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return false
+	} else if err != nil {
+		log.Printf("q.Workflow(_, %q) = %v", id, err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return false
+	}
+	return s.authorize(w, r, wf.Namespace)
 }
 
 func (s *Server) mustLookup(name string) *template.Template {
@@ -175,9 +255,28 @@ func (s *Server) BaseLink(target string, extras ...string) string {
 
 type homeResponse struct {
 	SiteHeader        SiteHeader
+	Namespace         *Namespace // the namespace being viewed, if any
 	ActiveWorkflows   []db.Workflow
 	InactiveWorkflows []db.Workflow
 	Schedules         []ScheduleEntry
+	// Resources describes the use of limited resources by running
+	// workflows, including tasks queued for them.
+	Resources []workflow.ResourceStatus
+}
+
+// A workflowList is a list of workflows on the homepage. The
+// workflows of a selectable list can be selected for bulk actions.
+type workflowList struct {
+	Workflows  []db.Workflow
+	Selectable bool
+}
+
+func (h *homeResponse) ActiveWorkflowList() workflowList {
+	return workflowList{Workflows: h.ActiveWorkflows, Selectable: true}
+}
+
+func (h *homeResponse) InactiveWorkflowList() workflowList {
+	return workflowList{Workflows: h.InactiveWorkflows}
 }
 
 // homeHandler renders the homepage.
@@ -199,6 +298,7 @@ func (s *Server) homeHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	name := r.URL.Query().Get("name")
+	namespace := r.URL.Query().Get("namespace")
 	hr := &homeResponse{SiteHeader: s.header}
 	hr.SiteHeader.NameParam = name
 	var ws []db.Workflow
@@ -220,8 +320,24 @@ func (s *Server) homeHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
 	}
+	if namespace != "" {
+		hr.Namespace = s.w.dh.Namespace(namespace)
+		if hr.Namespace == nil {
+			http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+			return
+		}
+		if hr.SiteHeader.NameParam == "All Workflows" {
+			hr.SiteHeader.NameParam = ""
+		}
+		hr.SiteHeader.NamespaceParam = namespace
+		ws = slices.DeleteFunc(ws, func(w db.Workflow) bool { return w.Namespace != namespace })
+		hr.Schedules = slices.DeleteFunc(hr.Schedules, func(e ScheduleEntry) bool {
+			return e.WorkflowJob().Schedule.Namespace != namespace
+		})
+	}
+	hr.Resources = s.w.resources.Status()
 	for _, w := range ws {
-		if ok := s.w.workflowRunning(w.ID); ok {
+		if s.w.workflowRunning(w.ID) || s.w.workflowWaiting(w.ID) {
 			hr.ActiveWorkflows = append(hr.ActiveWorkflows, w)
 			continue
 		}
@@ -240,9 +356,38 @@ type showWorkflowResponse struct {
 	SiteHeader SiteHeader
 	Workflow   db.Workflow
 	Tasks      []db.TasksForWorkflowSortedRow
-	// TaskLogs is a map of all logs for a db.Task, keyed on
-	// (db.Task).Name
+	// TaskLogs is a map of all logs for a db.Task at or above LogLevel,
+	// keyed on (db.Task).Name
 	TaskLogs map[string][]db.TaskLog
+	// TaskProgress is a map of the most recently reported progress
+	// of a db.Task, as a percentage, keyed on (db.Task).Name.
+	TaskProgress map[string]float64
+	// LogLevel is the minimum level of the logs in TaskLogs.
+	LogLevel  workflow.Level
+	LogLevels []workflow.Level
+	// DefinitionWarnings describes how the registered definition of
+	// the workflow differs from the one it was started with.
+	DefinitionWarnings []string
+	// DryRunTasks is the set of tasks that honor dry runs, keyed by
+	// name. It's only set for dry-run workflows.
+	DryRunTasks map[string]bool
+	// WaitingTasks holds the resources that each task queued for a
+	// limited resource is waiting for, keyed by task name.
+	WaitingTasks map[string][]string
+	// HasReleaseNotes reports whether the workflow drafted release
+	// notes, which are shown on their own page.
+	HasReleaseNotes bool
+	// Timeline is the timeline of the workflow's tasks, or nil if
+	// none have started.
+	Timeline *timeline
+	// Upstream is the chain of workflows that the workflow starts
+	// after, from the first one to the one it directly depends on.
+	Upstream []db.Workflow
+	// Waiting reports whether the workflow is waiting for the last
+	// workflow of Upstream to succeed.
+	Waiting bool
+	// Dependents are the workflows that start after this one.
+	Dependents []db.Workflow
 }
 
 func (s *Server) showWorkflowHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
@@ -252,7 +397,14 @@ func (s *Server) showWorkflowHandler(w http.ResponseWriter, r *http.Request, par
 		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
 		return
 	}
-	resp, err := s.buildShowWorkflowResponse(r.Context(), id)
+	level := workflow.LevelDebug
+	if v := r.FormValue("log_level"); v != "" {
+		if level, err = workflow.ParseLevel(v); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	resp, err := s.buildShowWorkflowResponse(r.Context(), id, level)
 	if err != nil {
 		log.Printf("showWorkflowHandler: %v", err)
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
@@ -267,7 +419,7 @@ func (s *Server) showWorkflowHandler(w http.ResponseWriter, r *http.Request, par
 	io.Copy(w, &out)
 }
 
-func (s *Server) buildShowWorkflowResponse(ctx context.Context, id uuid.UUID) (*showWorkflowResponse, error) {
+func (s *Server) buildShowWorkflowResponse(ctx context.Context, id uuid.UUID, level workflow.Level) (*showWorkflowResponse, error) {
 	q := db.New(s.db)
 	w, err := q.Workflow(ctx, id)
 	if err != nil {
@@ -282,19 +434,131 @@ func (s *Server) buildShowWorkflowResponse(ctx context.Context, id uuid.UUID) (*
 		return nil, err
 	}
 	sr := &showWorkflowResponse{
-		SiteHeader: s.header,
-		TaskLogs:   make(map[string][]db.TaskLog),
-		Tasks:      tasks,
-		Workflow:   w,
+		SiteHeader:   s.header,
+		TaskLogs:     make(map[string][]db.TaskLog),
+		TaskProgress: make(map[string]float64),
+		LogLevel:     level,
+		LogLevels:    []workflow.Level{workflow.LevelDebug, workflow.LevelInfo, workflow.LevelWarn, workflow.LevelError},
+		Tasks:        tasks,
+		Workflow:     w,
 	}
 	sr.SiteHeader.Subtitle = w.Name.String
 	sr.SiteHeader.NameParam = w.Name.String
+	_, sr.HasReleaseNotes = workflowReleaseNotes(w)
 	for _, l := range tlogs {
+		if l.Progress.Valid {
+			sr.TaskProgress[l.TaskName] = l.Progress.Float64 * 100
+		}
+		if logLevel(l) < level {
+			continue
+		}
 		sr.TaskLogs[l.TaskName] = append(sr.TaskLogs[l.TaskName], l)
 	}
+	var stored *workflow.Graph
+	if w.Definition.Valid {
+		stored = new(workflow.Graph)
+		if err := json.Unmarshal([]byte(w.Definition.String), stored); err != nil {
+			return nil, err
+		}
+	}
+	d := s.w.dh.Definition(w.Name.String)
+	if d != nil && stored != nil {
+		sr.DefinitionWarnings = workflow.CheckCompatibility(stored, d.Graph())
+	}
+	for _, rs := range s.w.resources.Status() {
+		for _, waiter := range rs.Waiting {
+			if waiter.WorkflowID != id {
+				continue
+			}
+			if sr.WaitingTasks == nil {
+				sr.WaitingTasks = make(map[string][]string)
+			}
+			sr.WaitingTasks[waiter.TaskName] = append(sr.WaitingTasks[waiter.TaskName], rs.Name)
+		}
+	}
+	g := stored
+	if g == nil && d != nil {
+		g = d.Graph()
+	}
+	if w.DryRun && g != nil {
+		sr.DryRunTasks = dryRunTasks(g)
+	}
+	sr.Timeline = buildTimeline(w, tasks, g, time.Now())
+	if sr.Upstream, err = upstreamWorkflows(ctx, q, id); err != nil {
+		return nil, err
+	}
+	sr.Waiting = s.w.workflowWaiting(id)
+	if sr.Dependents, err = q.WorkflowDependents(ctx, id); err != nil {
+		return nil, err
+	}
 	return sr, nil
 }
 
+// upstreamWorkflows returns the chain of workflows that the workflow
+// with the given ID starts after, from the first one to the one it
+// directly depends on.
+func upstreamWorkflows(ctx context.Context, q *db.Queries, id uuid.UUID) ([]db.Workflow, error) {
+	var chain []db.Workflow
+	seen := map[uuid.UUID]bool{id: true}
+	for {
+		dep, err := q.WorkflowDependency(ctx, id)
+		if errors.Is(err, pgx.ErrNoRows) {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		if seen[dep.DependsOnID] {
+			break
+		}
+		seen[dep.DependsOnID] = true
+		wf, err := q.Workflow(ctx, dep.DependsOnID)
+		if err != nil {
+			return nil, err
+		}
+		chain = append([]db.Workflow{wf}, chain...)
+		id = dep.DependsOnID
+	}
+	return chain, nil
+}
+
+// logLevel returns the level of l. Logs with unknown levels are
+// treated as informational.
+func logLevel(l db.TaskLog) workflow.Level {
+	level, err := workflow.ParseLevel(l.Level)
+	if err != nil {
+		return workflow.LevelInfo
+	}
+	return level
+}
+
+// dryRunTasks returns the set of tasks in g that honor dry runs.
+func dryRunTasks(g *workflow.Graph) map[string]bool {
+	m := make(map[string]bool)
+	for _, t := range g.Tasks {
+		if t.HonorsDryRun {
+			m[t.Name] = true
+		}
+	}
+	return m
+}
+
+// checkDryRun returns an error if g has tasks that don't honor dry
+// runs, which would make their externally visible changes in a dry
+// run. Expansions are refused too, since the tasks they add are
+// unknown until they run.
+func checkDryRun(g *workflow.Graph) error {
+	var names []string
+	for _, t := range g.Tasks {
+		if !t.HonorsDryRun || t.Expansion {
+			names = append(names, t.Name)
+		}
+	}
+	if len(names) != 0 {
+		return fmt.Errorf("this workflow can't be dry run: its tasks %s don't honor dry runs", strings.Join(names, ", "))
+	}
+	return nil
+}
+
 type newWorkflowResponse struct {
 	SiteHeader      SiteHeader
 	Definitions     map[string]*workflow.Definition
@@ -302,29 +566,69 @@ type newWorkflowResponse struct {
 	ScheduleTypes   []ScheduleType
 	Schedule        ScheduleType
 	ScheduleMinTime string
+
+	// Step is the wizard step to show once a definition is selected.
+	Step string
+	// Form holds the values entered in the wizard so far.
+	Form url.Values
+	// Errors are the problems with the values entered in the step
+	// that was submitted.
+	Errors []string
+	// Review summarizes the new workflow in the review step.
+	Review []reviewRow
+	// Previous is the last workflow created with the selected
+	// definition, which the review step compares against, if any.
+	Previous *db.Workflow
 }
 
 func (n *newWorkflowResponse) Selected() *workflow.Definition {
 	return n.Definitions[n.Name]
 }
 
-// newWorkflowHandler presents a form for creating a new workflow.
+// DryRunError returns why the selected workflow can't be dry run, or
+// the empty string if it can.
+func (n *newWorkflowResponse) DryRunError() string {
+	d := n.Selected()
+	if d == nil {
+		return ""
+	}
+	if err := checkDryRun(d.Graph()); err != nil {
+		return err.Error()
+	}
+	return ""
+}
+
+// newWorkflowHandler presents a wizard for creating a new workflow:
+// once a definition is selected, its required parameters, its optional
+// parameters and schedule, and a review of the new workflow. Each step
+// is submitted back to it to be validated.
 func (s *Server) newWorkflowHandler(w http.ResponseWriter, r *http.Request) {
 	out := bytes.Buffer{}
 	name := r.FormValue("workflow.name")
+	namespace := r.FormValue("namespace")
+	defs := s.w.dh.Definitions()
+	if namespace != "" {
+		defs = s.w.dh.NamespaceDefinitions(namespace)
+	}
 	resp := &newWorkflowResponse{
 		SiteHeader:      s.header,
-		Definitions:     s.w.dh.Definitions(),
+		Definitions:     defs,
 		Name:            name,
 		ScheduleTypes:   ScheduleTypes,
 		Schedule:        ScheduleImmediate,
 		ScheduleMinTime: time.Now().UTC().Format(DatetimeLocalLayout),
+		Step:            wizardCore,
+		Form:            r.Form,
 	}
 	resp.SiteHeader.NameParam = name
+	resp.SiteHeader.NamespaceParam = namespace
 	selectedSchedule := ScheduleType(r.FormValue("workflow.schedule"))
 	if slices.Contains(ScheduleTypes, selectedSchedule) {
 		resp.Schedule = selectedSchedule
 	}
+	if r.Method == http.MethodPost && resp.Selected() != nil {
+		s.advanceWizard(r, resp)
+	}
 	if err := s.newWorkflowTmpl.Execute(&out, resp); err != nil {
 		log.Printf("newWorkflowHandler: %v", err)
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
@@ -342,82 +646,59 @@ func (s *Server) createWorkflowHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
 		return
 	}
+	if !s.authorize(w, r, s.w.dh.DefinitionNamespace(name)) {
+		return
+	}
 	params := make(map[string]interface{})
 	for _, p := range d.Parameters() {
-		switch p.Type().String() {
-		case "string":
-			v := r.FormValue(fmt.Sprintf("workflow.params.%s", p.Name()))
-			if err := p.Valid(v); err != nil {
-				http.Error(w, err.Error(), http.StatusBadRequest)
-				return
-			}
-			params[p.Name()] = v
-		case "[]string":
-			v := r.Form[fmt.Sprintf("workflow.params.%s", p.Name())]
-			if err := p.Valid(v); err != nil {
-				http.Error(w, err.Error(), http.StatusBadRequest)
-				return
-			}
-			params[p.Name()] = v
-		case "task.Date":
-			t, err := time.Parse("2006-01-02", r.FormValue(fmt.Sprintf("workflow.params.%s", p.Name())))
-			if err != nil {
-				http.Error(w, fmt.Sprintf("parameter %q parsing error: %v", p.Name(), err), http.StatusBadRequest)
-				return
-			}
-			v := task.Date{Year: t.Year(), Month: t.Month(), Day: t.Day()}
-			if err := p.Valid(v); err != nil {
-				http.Error(w, err.Error(), http.StatusBadRequest)
-				return
-			}
-			params[p.Name()] = v
-		case "bool":
-			vStr := r.FormValue(fmt.Sprintf("workflow.params.%s", p.Name()))
-			var v bool
-			switch vStr {
-			case "on":
-				v = true
-			case "":
-				v = false
-			default:
-				http.Error(w, fmt.Sprintf("parameter %q has an unexpected value %q", p.Name(), vStr), http.StatusBadRequest)
-				return
-			}
-			if err := p.Valid(v); err != nil {
-				http.Error(w, err.Error(), http.StatusBadRequest)
-				return
-			}
-			params[p.Name()] = v
-		default:
-			http.Error(w, fmt.Sprintf("parameter %q has an unsupported type %q", p.Name(), p.Type()), http.StatusInternalServerError)
+		v, err := formParam(r, p)
+		if errors.Is(err, errUnsupportedParam) {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
+		params[p.Name()] = v
 	}
-	sched := Schedule{Type: ScheduleType(r.FormValue("workflow.schedule"))}
-	if sched.Type != ScheduleImmediate {
-		switch sched.Type {
-		case ScheduleOnce:
-			t, err := time.ParseInLocation(DatetimeLocalLayout, r.FormValue("workflow.schedule.datetime"), time.UTC)
-			if err != nil || t.Before(time.Now()) {
-				http.Error(w, fmt.Sprintf("parameter %q parsing error: %v", "workflow.schedule.datetime", err), http.StatusBadRequest)
-				return
-			}
-			sched.Once = t
-		case ScheduleCron:
-			sched.Cron = r.FormValue("workflow.schedule.cron")
-		}
-		if err := sched.Valid(); err != nil {
-			http.Error(w, fmt.Sprintf("parameter %q parsing error: %v", "workflow.schedule", err), http.StatusBadRequest)
+	dryRun, sched, err := formSchedule(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if dryRun {
+		if err := checkDryRun(d.Graph()); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
-		if _, err := s.scheduler.Create(r.Context(), sched, name, params); err != nil {
+	}
+	after, err := s.formAfter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if sched.Type != ScheduleImmediate {
+		_, err := s.scheduler.Create(withAudit(r, auditEvent{Action: AuditScheduleCreated}), sched, name, params)
+		if err != nil {
 			http.Error(w, fmt.Sprintf("failed to create schedule: %v", err), http.StatusInternalServerError)
 			return
 		}
 		http.Redirect(w, r, s.BaseLink("/"), http.StatusSeeOther)
 		return
 	}
-	id, err := s.w.StartWorkflow(r.Context(), name, params, 0)
+	ctx := withAudit(r, auditEvent{
+		Action: AuditWorkflowCreated,
+		After:  map[string]interface{}{"name": name, "params": params, "dry_run": dryRun, "after": after},
+	})
+	var id uuid.UUID
+	switch {
+	case dryRun:
+		id, err = s.w.StartDryRunWorkflow(ctx, name, params)
+	case after != uuid.Nil:
+		id, err = s.w.StartWorkflowAfter(ctx, name, params, after)
+	default:
+		id, err = s.w.StartWorkflow(ctx, name, params, 0)
+	}
 	if err != nil {
 		log.Printf("s.w.StartWorkflow(%v, %v, %v): %v", r.Context(), d, params, err)
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
@@ -426,6 +707,119 @@ func (s *Server) createWorkflowHandler(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, s.BaseLink("/workflows", id.String()), http.StatusSeeOther)
 }
 
+// errUnsupportedParam is returned for parameters whose type can't be
+// entered in forms.
+var errUnsupportedParam = errors.New("unsupported type")
+
+// formParam returns the value of parameter p in the form of r, or an
+// error if it's invalid.
+func formParam(r *http.Request, p workflow.MetaParameter) (interface{}, error) {
+	name := fmt.Sprintf("workflow.params.%s", p.Name())
+	var v interface{}
+	switch p.Type().String() {
+	case "string":
+		v = r.FormValue(name)
+	case "[]string":
+		r.ParseForm()
+		v = r.Form[name]
+	case "task.Date":
+		t, err := time.Parse("2006-01-02", r.FormValue(name))
+		if err != nil {
+			return nil, fmt.Errorf("parameter %q parsing error: %v", p.Name(), err)
+		}
+		v = task.Date{Year: t.Year(), Month: t.Month(), Day: t.Day()}
+	case "bool":
+		switch vStr := r.FormValue(name); vStr {
+		case "on":
+			v = true
+		case "":
+			v = false
+		default:
+			return nil, fmt.Errorf("parameter %q has an unexpected value %q", p.Name(), vStr)
+		}
+	default:
+		return nil, fmt.Errorf("parameter %q has an %w %q", p.Name(), errUnsupportedParam, p.Type())
+	}
+	if err := p.Valid(v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// formSchedule returns whether the form of r asks for a dry run, and
+// its schedule, or an error if they're invalid.
+func formSchedule(r *http.Request) (dryRun bool, sched Schedule, err error) {
+	switch v := r.FormValue("workflow.dryrun"); v {
+	case "on":
+		dryRun = true
+	case "":
+	default:
+		return false, Schedule{}, fmt.Errorf("parameter %q has an unexpected value %q", "workflow.dryrun", v)
+	}
+	sched = Schedule{Type: ScheduleType(r.FormValue("workflow.schedule"))}
+	if sched.Type == ScheduleImmediate {
+		return dryRun, sched, nil
+	}
+	if dryRun {
+		return false, Schedule{}, errors.New("dry runs can only be run immediately")
+	}
+	switch sched.Type {
+	case ScheduleOnce:
+		t, err := time.ParseInLocation(DatetimeLocalLayout, r.FormValue("workflow.schedule.datetime"), time.UTC)
+		if err != nil || t.Before(time.Now()) {
+			return false, Schedule{}, fmt.Errorf("parameter %q parsing error: %v", "workflow.schedule.datetime", err)
+		}
+		sched.Once = t
+	case ScheduleCron:
+		sched.Cron = r.FormValue("workflow.schedule.cron")
+	}
+	if err := sched.Valid(); err != nil {
+		return false, Schedule{}, fmt.Errorf("parameter %q parsing error: %v", "workflow.schedule", err)
+	}
+	return dryRun, sched, nil
+}
+
+// formAfter returns the ID of the workflow that the form of r asks the
+// new workflow to start after, or uuid.Nil if it should start right
+// away. The form names either a workflow by its ID, or a definition,
+// whose latest workflow that hasn't failed and isn't a dry run is the
+// one to start after, even if it's still running. The user responsible
+// for r must be allowed to act on the namespace of that workflow.
+func (s *Server) formAfter(r *http.Request) (uuid.UUID, error) {
+	v := strings.TrimSpace(r.FormValue("workflow.after"))
+	if v == "" {
+		return uuid.Nil, nil
+	}
+	if ScheduleType(r.FormValue("workflow.schedule")) != ScheduleImmediate || r.FormValue("workflow.dryrun") != "" {
+		return uuid.Nil, errors.New("only immediate runs that aren't dry runs can start after another workflow")
+	}
+	id, err := uuid.Parse(v)
+	if err != nil {
+		if s.w.dh.Definition(v) == nil {
+			return uuid.Nil, fmt.Errorf("parameter %q: %q is neither a workflow ID nor a workflow name", "workflow.after", v)
+		}
+		if id, err = s.w.LatestWorkflow(r.Context(), v); err != nil {
+			return uuid.Nil, err
+		}
+	}
+	wf, err := db.New(s.db).Workflow(r.Context(), id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return uuid.Nil, fmt.Errorf("parameter %q: no workflow %v", "workflow.after", id)
+	} else if err != nil {
+		return uuid.Nil, err
+	}
+	if wf.Error != "" {
+		return uuid.Nil, fmt.Errorf("parameter %q: workflow %v failed", "workflow.after", id)
+	}
+	if wf.DryRun {
+		return uuid.Nil, fmt.Errorf("parameter %q: workflow %v is a dry run", "workflow.after", id)
+	}
+	if err := s.authorizationError(r, wf.Namespace); err != nil {
+		return uuid.Nil, fmt.Errorf("parameter %q: %v", "workflow.after", err)
+	}
+	return id, nil
+}
+
 func (s *Server) retryTaskHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
 	id, err := uuid.Parse(params.ByName("id"))
 	if err != nil {
@@ -433,8 +827,11 @@ func (s *Server) retryTaskHandler(w http.ResponseWriter, r *http.Request, params
 		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
 		return
 	}
-	if err := s.w.RetryTask(r.Context(), id, params.ByName("name")); err != nil {
-		log.Printf("s.w.RetryTask(_, %q): %v", id, err)
+	if !s.authorizeWorkflow(w, r, id) {
+		return
+	}
+	if err := s.retryTask(r, id, params.ByName("name")); err != nil {
+		log.Printf("s.retryTask(_, %q, %q): %v", id, params.ByName("name"), err)
 	}
 	http.Redirect(w, r, s.BaseLink("/workflows", id.String()), http.StatusSeeOther)
 }
@@ -446,21 +843,18 @@ func (s *Server) approveTaskHandler(w http.ResponseWriter, r *http.Request, para
 		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
 		return
 	}
-	q := db.New(s.db)
-	t, err := q.ApproveTask(r.Context(), db.ApproveTaskParams{
-		WorkflowID: id,
-		Name:       params.ByName("name"),
-		ApprovedAt: sql.NullTime{Time: time.Now(), Valid: true},
-	})
+	if !s.authorizeWorkflow(w, r, id) {
+		return
+	}
+	err = s.approveTask(r, id, params.ByName("name"))
 	if errors.Is(err, sql.ErrNoRows) || errors.Is(err, pgx.ErrNoRows) {
 		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
 		return
 	} else if err != nil {
-		log.Printf("q.ApproveTask(_, %q) = %v, %v", id, t, err)
+		log.Printf("s.approveTask(_, %q, %q) = %v", id, params.ByName("name"), err)
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
 	}
-	s.w.l.Logger(id, t.Name).Printf("USER-APPROVED")
 	http.Redirect(w, r, s.BaseLink("/workflows", id.String()), http.StatusSeeOther)
 }
 
@@ -471,9 +865,16 @@ func (s *Server) stopWorkflowHandler(w http.ResponseWriter, r *http.Request, par
 		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
 		return
 	}
-	if !s.w.cancelWorkflow(id) {
+	if !s.authorizeWorkflow(w, r, id) {
+		return
+	}
+	if err := s.cancelWorkflow(r, id); err == errWorkflowNotRunning {
 		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
 		return
+	} else if err != nil {
+		log.Printf("s.cancelWorkflow(_, %q) = %v", id, err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
 	}
 	http.Redirect(w, r, s.BaseLink("/"), http.StatusSeeOther)
 }
@@ -485,7 +886,16 @@ func (s *Server) deleteScheduleHandler(w http.ResponseWriter, r *http.Request, p
 		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
 		return
 	}
-	err = s.scheduler.Delete(r.Context(), id)
+	var before *db.Schedule
+	for _, e := range s.scheduler.Entries() {
+		if sched := e.WorkflowJob().Schedule; int(sched.ID) == id {
+			before = &sched
+		}
+	}
+	if before != nil && !s.authorize(w, r, before.Namespace) {
+		return
+	}
+	err = s.scheduler.Delete(withAudit(r, auditEvent{Action: AuditScheduleDeleted, ScheduleID: int32(id), Before: before}), id)
 	if err == ErrScheduleNotFound {
 		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
 		return
@@ -8,6 +8,7 @@ import (
 	"context"
 	"database/sql"
 	"embed"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
@@ -122,6 +123,7 @@ func TestServerHomeHandler(t *testing.T) {
 	w := httptest.NewRecorder()
 
 	s := NewServer(p, NewWorker(NewDefinitionHolder(), p, &PGListener{DB: p}), nil, SiteHeader{}, nil)
+	s.w.Resources().SetLimit(MacOSSignerResource, 1)
 
 	s.homeHandler(w, req)
 	resp := w.Result()
@@ -129,6 +131,15 @@ func TestServerHomeHandler(t *testing.T) {
 	if resp.StatusCode != http.StatusOK {
 		t.Errorf("resp.StatusCode = %d, wanted %d", resp.StatusCode, http.StatusOK)
 	}
+
+	for namespace, wantCode := range map[string]int{DefaultNamespace: http.StatusOK, "no such namespace": http.StatusNotFound} {
+		req := httptest.NewRequest(http.MethodGet, "/?namespace="+url.QueryEscape(namespace), nil)
+		w := httptest.NewRecorder()
+		s.homeHandler(w, req)
+		if resp := w.Result(); resp.StatusCode != wantCode {
+			t.Errorf("homeHandler with namespace %q: resp.StatusCode = %d, wanted %d", namespace, resp.StatusCode, wantCode)
+		}
+	}
 }
 
 func TestServerNewWorkflowHandler(t *testing.T) {
@@ -151,6 +162,11 @@ func TestServerNewWorkflowHandler(t *testing.T) {
 			params:   url.Values{"workflow.name": []string{"this workflow does not exist"}},
 			wantCode: http.StatusOK,
 		},
+		{
+			desc:     "namespace",
+			params:   url.Values{"namespace": []string{DefaultNamespace}},
+			wantCode: http.StatusOK,
+		},
 	}
 	for _, c := range cases {
 		t.Run(c.desc, func(t *testing.T) {
@@ -218,6 +234,7 @@ func TestServerCreateWorkflowHandler(t *testing.T) {
 					ID:        uuid.New(), // SameUUIDVariant
 					Params:    nullString(`{"farewell": "bye", "greeting": "hello"}`),
 					Name:      nullString(`echo`),
+					Namespace: DefaultNamespace,
 					Output:    "{}",
 					CreatedAt: now, // cmpopts.EquateApproxTime
 					UpdatedAt: now, // cmpopts.EquateApproxTime
@@ -238,12 +255,48 @@ func TestServerCreateWorkflowHandler(t *testing.T) {
 					ID:        uuid.New(), // SameUUIDVariant
 					Params:    nullString(`{"farewell": "bye", "greeting": "hello"}`),
 					Name:      nullString(`echo`),
+					Namespace: DefaultNamespace,
+					Output:    "{}",
+					CreatedAt: now, // cmpopts.EquateApproxTime
+					UpdatedAt: now, // cmpopts.EquateApproxTime
+				},
+			},
+		},
+		{
+			desc: "successful creation: dry run",
+			params: url.Values{
+				"workflow.name":            []string{"echo"},
+				"workflow.params.greeting": []string{"hello"},
+				"workflow.params.farewell": []string{"bye"},
+				"workflow.schedule":        []string{string(ScheduleImmediate)},
+				"workflow.dryrun":          []string{"on"},
+			},
+			wantCode: http.StatusSeeOther,
+			wantWorkflows: []db.Workflow{
+				{
+					ID:        uuid.New(), // SameUUIDVariant
+					Params:    nullString(`{"farewell": "bye", "greeting": "hello"}`),
+					Name:      nullString(`echo`),
+					Namespace: DefaultNamespace,
 					Output:    "{}",
+					DryRun:    true,
 					CreatedAt: now, // cmpopts.EquateApproxTime
 					UpdatedAt: now, // cmpopts.EquateApproxTime
 				},
 			},
 		},
+		{
+			desc: "dry run with a schedule",
+			params: url.Values{
+				"workflow.name":              []string{"echo"},
+				"workflow.params.greeting":   []string{"hello"},
+				"workflow.params.farewell":   []string{"bye"},
+				"workflow.schedule":          []string{string(ScheduleOnce)},
+				"workflow.schedule.datetime": []string{now.UTC().AddDate(1, 0, 0).Format(DatetimeLocalLayout)},
+				"workflow.dryrun":            []string{"on"},
+			},
+			wantCode: http.StatusBadRequest,
+		},
 		{
 			desc: "successful creation: schedule once",
 			params: url.Values{
@@ -257,6 +310,7 @@ func TestServerCreateWorkflowHandler(t *testing.T) {
 			wantSchedules: []db.Schedule{
 				{
 					WorkflowName:   "echo",
+					Namespace:      DefaultNamespace,
 					WorkflowParams: nullString(`{"farewell": "bye", "greeting": "hello"}`),
 					Once:           now.UTC().AddDate(1, 0, 0),
 					CreatedAt:      now, // cmpopts.EquateApproxTime
@@ -277,6 +331,7 @@ func TestServerCreateWorkflowHandler(t *testing.T) {
 			wantSchedules: []db.Schedule{
 				{
 					WorkflowName:   "echo",
+					Namespace:      DefaultNamespace,
 					WorkflowParams: nullString(`{"farewell": "bye", "greeting": "hello"}`),
 					Spec:           "0 0 1 1 0",
 					CreatedAt:      now, // cmpopts.EquateApproxTime
@@ -376,7 +431,9 @@ var flagTestDB = flag.String("test-pgdatabase", os.Getenv("PGDATABASE"), "postgr
 // The connection pool is closed as part of a t.Cleanup handler.
 // Database connections are expected to be configured through libpq
 // compatible environment variables. If no PGDATABASE is specified,
-// relui-test will be used.
+// relui-test will be used. If neither PGDATABASE nor PGHOST is
+// specified, and postgres or docker is installed, the database is
+// created in a disposable server instead; see -test-disposable-pg.
 //
 // https://www.postgresql.org/docs/current/libpq-envars.html
 func testDB(ctx context.Context, t *testing.T) *pgxpool.Pool {
@@ -389,10 +446,21 @@ func testDB(ctx context.Context, t *testing.T) *pgxpool.Pool {
 		if pgdb == "" {
 			pgdb = "relui-test"
 		}
-		if err := InitDB(ctx, fmt.Sprintf("database=%v", pgdb)); err != nil {
+		conn := fmt.Sprintf("database=%v", pgdb)
+		if useDisposableDB() {
+			pg, err := startDisposablePostgres(ctx)
+			if err != nil && (*flagDisposableDB == "always" || !errors.Is(err, errNoDisposableDB)) {
+				t.Skipf("Skipping database integration test: starting disposable postgres: %v", err)
+			}
+			if pg != nil {
+				disposableDB = pg
+				conn = pg.conn + " " + conn
+			}
+		}
+		if err := InitDB(ctx, conn); err != nil {
 			t.Skipf("Skipping database integration test: %v", err)
 		}
-		p, err := pgxpool.Connect(ctx, fmt.Sprintf("database=%v", pgdb))
+		p, err := pgxpool.Connect(ctx, conn)
 		if err != nil {
 			t.Skipf("Skipping database integration test: %v", err)
 		}
@@ -706,7 +774,12 @@ func TestServerStopWorkflow(t *testing.T) {
 				t.Fatalf("worker.markRunning(%v, %v) = %v, wanted no error", wf, cancel, err)
 			}
 
-			s := NewServer(testDB(ctx, t), worker, nil, SiteHeader{}, nil)
+			p := testDB(ctx, t)
+			wfp := db.CreateWorkflowParams{ID: wfID, Name: nullString("echo"), Namespace: DefaultNamespace}
+			if _, err := db.New(p).CreateWorkflow(ctx, wfp); err != nil {
+				t.Fatalf("CreateWorkflow(_, %v) = _, %v, wanted no error", wfp, err)
+			}
+			s := NewServer(p, worker, nil, SiteHeader{}, nil)
 			s.m.ServeHTTP(rec, req)
 			resp := rec.Result()
 
@@ -729,6 +802,124 @@ func TestServerStopWorkflow(t *testing.T) {
 	}
 }
 
+func TestServerNamespaceAuthorization(t *testing.T) {
+	hourAgo := time.Now().Add(-1 * time.Hour)
+	cases := []struct {
+		desc     string
+		actor    string
+		method   string
+		target   string // "%s" is replaced by the workflow ID
+		body     url.Values
+		wantCode int
+	}{
+		{
+			desc:     "create: member",
+			actor:    "accounts.google.com:member@example.com",
+			method:   http.MethodPost,
+			target:   "/workflows",
+			body:     url.Values{"workflow.name": {"echo"}, "workflow.params.greeting": {"hello"}, "workflow.params.farewell": {"bye"}, "workflow.schedule": {string(ScheduleImmediate)}},
+			wantCode: http.StatusSeeOther,
+		},
+		{
+			desc:     "create: non-member",
+			actor:    "accounts.google.com:other@example.com",
+			method:   http.MethodPost,
+			target:   "/workflows",
+			body:     url.Values{"workflow.name": {"echo"}, "workflow.params.greeting": {"hello"}, "workflow.params.farewell": {"bye"}, "workflow.schedule": {string(ScheduleImmediate)}},
+			wantCode: http.StatusForbidden,
+		},
+		{
+			desc:     "create: open namespace",
+			actor:    "accounts.google.com:other@example.com",
+			method:   http.MethodPost,
+			target:   "/workflows",
+			body:     url.Values{"workflow.name": {"open echo"}, "workflow.params.greeting": {"hello"}, "workflow.params.farewell": {"bye"}, "workflow.schedule": {string(ScheduleImmediate)}},
+			wantCode: http.StatusSeeOther,
+		},
+		{
+			desc:     "approve: member",
+			actor:    "accounts.google.com:member@example.com",
+			method:   http.MethodPost,
+			target:   "/workflows/%s/tasks/approve%20please/approve",
+			wantCode: http.StatusSeeOther,
+		},
+		{
+			desc:     "approve: non-member",
+			actor:    "accounts.google.com:other@example.com",
+			method:   http.MethodPost,
+			target:   "/workflows/%s/tasks/approve%20please/approve",
+			wantCode: http.StatusForbidden,
+		},
+		{
+			desc:     "retry: non-member",
+			method:   http.MethodPost,
+			target:   "/workflows/%s/tasks/approve%20please/retry",
+			wantCode: http.StatusForbidden,
+		},
+		{
+			desc:     "stop: non-member",
+			actor:    "accounts.google.com:other@example.com",
+			method:   http.MethodPost,
+			target:   "/workflows/%s/stop",
+			wantCode: http.StatusForbidden,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.desc, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			p := testDB(ctx, t)
+			q := db.New(p)
+
+			wf := db.CreateWorkflowParams{ID: uuid.New(), Name: nullString("echo"), Namespace: DefaultNamespace, CreatedAt: hourAgo, UpdatedAt: hourAgo}
+			if _, err := q.CreateWorkflow(ctx, wf); err != nil {
+				t.Fatalf("CreateWorkflow(_, %v) = _, %v, wanted no error", wf, err)
+			}
+			tp := db.CreateTaskParams{WorkflowID: wf.ID, Name: "approve please", ReadyForApproval: true, CreatedAt: hourAgo, UpdatedAt: hourAgo}
+			if _, err := q.CreateTask(ctx, tp); err != nil {
+				t.Fatalf("CreateTask(_, %v) = _, %v, wanted no error", tp, err)
+			}
+
+			dh := NewDefinitionHolder()
+			dh.RegisterNamespace(Namespace{Name: DefaultNamespace, Members: []string{"member@example.com"}})
+			dh.RegisterNamespacedDefinition("open", "open echo", newEchoWorkflow())
+			s := NewServer(p, NewWorker(dh, p, &PGListener{DB: p}), nil, SiteHeader{}, nil)
+
+			target := c.target
+			if strings.Contains(target, "%s") {
+				target = fmt.Sprintf(target, wf.ID)
+			}
+			req := httptest.NewRequest(c.method, target, strings.NewReader(c.body.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			if c.actor != "" {
+				req.Header.Set(iapHeaderEmail, c.actor)
+			}
+			rec := httptest.NewRecorder()
+			s.m.ServeHTTP(rec, req)
+
+			if got := rec.Result().StatusCode; got != c.wantCode {
+				t.Errorf("%s %s: resp.StatusCode = %d, wanted %d", c.method, target, got, c.wantCode)
+			}
+		})
+	}
+}
+
+func TestCheckDryRun(t *testing.T) {
+	noop := func(ctx *workflow.TaskContext) (string, error) { return "", nil }
+	safe := workflow.New()
+	workflow.Output(safe, "checked", workflow.Task0(safe, "checked", noop, workflow.HonorsDryRun()))
+	if err := checkDryRun(safe.Graph()); err != nil {
+		t.Errorf("checkDryRun(definition whose tasks all honor dry runs) = %v, wanted no error", err)
+	}
+
+	unsafe := workflow.New()
+	checked := workflow.Task0(unsafe, "checked", noop, workflow.HonorsDryRun())
+	workflow.Output(unsafe, "publish", workflow.Task1(unsafe, "publish", func(ctx *workflow.TaskContext, s string) (string, error) { return s, nil }, checked))
+	if err := checkDryRun(unsafe.Graph()); err == nil || !strings.Contains(err.Error(), "publish") {
+		t.Errorf("checkDryRun(definition with a task that doesn't honor dry runs) = %v, wanted an error naming it", err)
+	}
+}
+
 func TestResultDetail(t *testing.T) {
 	cases := []struct {
 		desc     string
@@ -0,0 +1,291 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package relui
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+	"golang.org/x/build/internal/relui/db"
+	"golang.org/x/build/internal/workflow"
+	"golang.org/x/exp/slices"
+)
+
+// The steps of the wizard that creates a new workflow once its
+// definition is selected. Each is validated before the next is shown.
+const (
+	wizardCore      = "core"      // required parameters
+	wizardOverrides = "overrides" // optional parameters, schedule, dry run and start after
+	wizardReview    = "review"    // summary, compared to the last run
+)
+
+var wizardSteps = []string{wizardCore, wizardOverrides, wizardReview}
+
+var wizardStepTitles = map[string]string{
+	wizardCore:      "Parameters",
+	wizardOverrides: "Optional overrides",
+	wizardReview:    "Review",
+}
+
+// scheduleFields are the names of the form fields of the schedule, dry
+// run and start after settings.
+var scheduleFields = []string{
+	"workflow.schedule",
+	"workflow.schedule.datetime",
+	"workflow.schedule.interval",
+	"workflow.schedule.cron",
+	"workflow.dryrun",
+	"workflow.after",
+}
+
+// A wizardStep is an entry in the wizard's list of steps.
+type wizardStep struct {
+	Title   string
+	Current bool
+	Done    bool
+}
+
+// A paramField is the form field of a workflow parameter, with the
+// value entered so far.
+type paramField struct {
+	workflow.MetaParameter
+	Value  string
+	Values []string // for slices
+}
+
+// A hiddenField is a value entered in another step of the wizard,
+// carried in the form of the current one.
+type hiddenField struct {
+	Name, Value string
+}
+
+// A reviewRow is a row of the summary of a new workflow, comparing a
+// setting to that of the previous workflow with the same definition.
+type reviewRow struct {
+	Name     string
+	Value    string
+	Previous string // empty if there's no previous workflow
+	Changed  bool
+}
+
+// Steps returns the wizard's list of steps, including selecting the
+// definition.
+func (n *newWorkflowResponse) Steps() []wizardStep {
+	steps := []wizardStep{{Title: "Workflow", Done: n.Selected() != nil, Current: n.Selected() == nil}}
+	current := slices.Index(wizardSteps, n.Step)
+	for i, name := range wizardSteps {
+		steps = append(steps, wizardStep{
+			Title:   wizardStepTitles[name],
+			Current: n.Selected() != nil && i == current,
+			Done:    n.Selected() != nil && i < current,
+		})
+	}
+	return steps
+}
+
+// CoreParameters returns the fields of the selected definition's
+// required parameters.
+func (n *newWorkflowResponse) CoreParameters() []paramField {
+	return n.paramFields(true)
+}
+
+// OptionalParameters returns the fields of the selected definition's
+// optional parameters.
+func (n *newWorkflowResponse) OptionalParameters() []paramField {
+	return n.paramFields(false)
+}
+
+func (n *newWorkflowResponse) paramFields(required bool) []paramField {
+	var fields []paramField
+	for _, p := range n.Selected().Parameters() {
+		if p.RequireNonZero() != required {
+			continue
+		}
+		name := "workflow.params." + p.Name()
+		fields = append(fields, paramField{MetaParameter: p, Value: n.Form.Get(name), Values: n.Form[name]})
+	}
+	return fields
+}
+
+// FormValue returns the value entered so far in the named field.
+func (n *newWorkflowResponse) FormValue(name string) string {
+	return n.Form.Get(name)
+}
+
+// Hidden returns the values entered in the steps of the wizard other
+// than the current one, to carry in its form.
+func (n *newWorkflowResponse) Hidden() []hiddenField {
+	shown := map[string]bool{}
+	switch n.Step {
+	case wizardCore:
+		for _, f := range n.CoreParameters() {
+			shown["workflow.params."+f.Name()] = true
+		}
+	case wizardOverrides:
+		for _, f := range n.OptionalParameters() {
+			shown["workflow.params."+f.Name()] = true
+		}
+		for _, name := range scheduleFields {
+			shown[name] = true
+		}
+	}
+	var names []string
+	for name := range n.Form {
+		if !shown[name] && (strings.HasPrefix(name, "workflow.params.") || slices.Contains(scheduleFields, name)) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	var fields []hiddenField
+	for _, name := range names {
+		for _, v := range n.Form[name] {
+			fields = append(fields, hiddenField{Name: name, Value: v})
+		}
+	}
+	return fields
+}
+
+// advanceWizard handles the submission of a wizard step in r. It sets
+// resp to show the next step if the submitted one is valid, the same
+// one with errors if not, or the previous one if the user went back.
+func (s *Server) advanceWizard(r *http.Request, resp *newWorkflowResponse) {
+	i := slices.Index(wizardSteps, r.FormValue("workflow.step"))
+	if i < 0 {
+		return
+	}
+	if r.FormValue("workflow.back") != "" {
+		if i > 0 {
+			i--
+		}
+		resp.Step = wizardSteps[i]
+		return
+	}
+	resp.Step = wizardSteps[i]
+	if resp.Errors = s.validateWizardStep(r, resp.Selected(), resp.Step); len(resp.Errors) != 0 || resp.Step == wizardReview {
+		return
+	}
+	resp.Step = wizardSteps[i+1]
+	if resp.Step != wizardReview {
+		return
+	}
+	// Check the earlier steps again, since their values were carried
+	// by the client.
+	for _, step := range wizardSteps[:i] {
+		if resp.Errors = s.validateWizardStep(r, resp.Selected(), step); len(resp.Errors) != 0 {
+			resp.Step = step
+			return
+		}
+	}
+	s.reviewWorkflow(r, resp)
+}
+
+// validateWizardStep returns the problems with the values entered in
+// the form of r for step of the wizard for d.
+func (s *Server) validateWizardStep(r *http.Request, d *workflow.Definition, step string) []string {
+	var errs []string
+	if step == wizardReview {
+		return nil
+	}
+	for _, p := range d.Parameters() {
+		if p.RequireNonZero() != (step == wizardCore) {
+			continue
+		}
+		if _, err := formParam(r, p); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if step == wizardOverrides {
+		if dryRun, _, err := formSchedule(r); err != nil {
+			errs = append(errs, err.Error())
+		} else if dryRun {
+			if err := checkDryRun(d.Graph()); err != nil {
+				errs = append(errs, err.Error())
+			}
+		}
+		if _, err := s.formAfter(r); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	return errs
+}
+
+// reviewWorkflow fills in the summary of the new workflow described by
+// the form of r, compared to the previous workflow with the same
+// definition.
+func (s *Server) reviewWorkflow(r *http.Request, resp *newWorkflowResponse) {
+	prevParams := map[string]json.RawMessage{}
+	if wfs, err := db.New(s.db).WorkflowsByName(r.Context(), sql.NullString{String: resp.Name, Valid: true}); err != nil {
+		log.Printf("reviewWorkflow: q.WorkflowsByName(_, %q) = %v", resp.Name, err)
+	} else if len(wfs) != 0 {
+		resp.Previous = &wfs[0]
+		if err := json.Unmarshal([]byte(resp.Previous.Params.String), &prevParams); err != nil {
+			log.Printf("reviewWorkflow: unmarshaling params of %v: %v", resp.Previous.ID, err)
+		}
+	}
+	row := func(name, value, previous string) {
+		resp.Review = append(resp.Review, reviewRow{
+			Name:     name,
+			Value:    value,
+			Previous: previous,
+			Changed:  resp.Previous != nil && value != previous,
+		})
+	}
+	for _, p := range resp.Selected().Parameters() {
+		v, _ := formParam(r, p)
+		row(p.Name(), reviewValue(v), reviewRawValue(prevParams[p.Name()]))
+	}
+	dryRun, sched, _ := formSchedule(r)
+	prevDryRun := ""
+	if resp.Previous != nil {
+		prevDryRun = fmt.Sprint(resp.Previous.DryRun)
+	}
+	row("Dry run", fmt.Sprint(dryRun), prevDryRun)
+	// Schedules aren't compared: the previous workflow may have been
+	// started by one, but that's not a setting of the workflow.
+	schedule := string(sched.Type)
+	switch sched.Type {
+	case ScheduleOnce:
+		schedule += " at " + sched.Once.Format(DatetimeLocalLayout) + " UTC"
+	case ScheduleCron:
+		schedule += ": " + sched.Cron
+	}
+	resp.Review = append(resp.Review, reviewRow{Name: "Schedule", Value: schedule})
+	if after, _ := s.formAfter(r); after != uuid.Nil {
+		resp.Review = append(resp.Review, reviewRow{Name: "Starts after workflow", Value: after.String()})
+	}
+}
+
+// reviewValue formats a parameter value for the review step.
+func reviewValue(v interface{}) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return reviewRawValue(b)
+}
+
+// reviewRawValue formats a JSON-encoded parameter value for the review
+// step, such that equal values of workflows that were and weren't
+// stored in the database are formatted the same.
+func reviewRawValue(raw json.RawMessage) string {
+	if raw == nil {
+		return ""
+	}
+	var v interface{}
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return string(raw)
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return string(raw)
+	}
+	return string(b)
+}
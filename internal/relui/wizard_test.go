@@ -0,0 +1,108 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package relui
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/build/internal/relui/db"
+)
+
+func TestServerNewWorkflowWizard(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	p := testDB(ctx, t)
+	hourAgo := time.Now().Add(-1 * time.Hour)
+	wp := db.CreateWorkflowParams{ID: uuid.New(), Name: nullString("echo"), Params: nullString(`{"greeting": "hi", "farewell": "bye"}`), Namespace: DefaultNamespace, CreatedAt: hourAgo, UpdatedAt: hourAgo}
+	if _, err := db.New(p).CreateWorkflow(ctx, wp); err != nil {
+		t.Fatalf("CreateWorkflow(_, %v) = _, %v, wanted no error", wp, err)
+	}
+	s := NewServer(p, NewWorker(NewDefinitionHolder(), p, &PGListener{DB: p}), nil, SiteHeader{}, nil)
+
+	cases := []struct {
+		desc     string
+		form     url.Values
+		wantStep string
+		want     []string // in the response body
+	}{
+		{
+			desc:     "invalid parameters",
+			form:     url.Values{"workflow.step": {wizardCore}, "workflow.params.greeting": {""}, "workflow.params.farewell": {"bye"}},
+			wantStep: wizardCore,
+			want:     []string{`parameter &#34;greeting&#34; must have non-zero value`},
+		},
+		{
+			desc:     "valid parameters",
+			form:     url.Values{"workflow.step": {wizardCore}, "workflow.params.greeting": {"hello"}, "workflow.params.farewell": {"bye"}},
+			wantStep: wizardOverrides,
+			want:     []string{`<input type="hidden" name="workflow.params.greeting" value="hello" />`},
+		},
+		{
+			desc:     "invalid schedule",
+			form:     url.Values{"workflow.step": {wizardOverrides}, "workflow.params.greeting": {"hello"}, "workflow.params.farewell": {"bye"}, "workflow.schedule": {string(ScheduleCron)}, "workflow.dryrun": {"on"}},
+			wantStep: wizardOverrides,
+			want:     []string{"dry runs can only be run immediately"},
+		},
+		{
+			desc:     "invalid start after",
+			form:     url.Values{"workflow.step": {wizardOverrides}, "workflow.params.greeting": {"hello"}, "workflow.params.farewell": {"bye"}, "workflow.schedule": {string(ScheduleImmediate)}, "workflow.after": {"no such workflow"}},
+			wantStep: wizardOverrides,
+			want:     []string{`&#34;no such workflow&#34; is neither a workflow ID nor a workflow name`},
+		},
+		{
+			desc:     "review",
+			form:     url.Values{"workflow.step": {wizardOverrides}, "workflow.params.greeting": {"hello"}, "workflow.params.farewell": {"bye"}, "workflow.schedule": {string(ScheduleImmediate)}},
+			wantStep: wizardReview,
+			want: []string{
+				// Only greeting changed since the last workflow.
+				`<td>greeting</td>`,
+				`<td><code>&#34;hi&#34;</code></td>`,
+				`NewWorkflow-reviewRow--changed`,
+			},
+		},
+		{
+			desc:     "tampered review",
+			form:     url.Values{"workflow.step": {wizardOverrides}, "workflow.params.greeting": {""}, "workflow.params.farewell": {"bye"}, "workflow.schedule": {string(ScheduleImmediate)}},
+			wantStep: wizardCore,
+			want:     []string{`parameter &#34;greeting&#34; must have non-zero value`},
+		},
+		{
+			desc:     "back",
+			form:     url.Values{"workflow.step": {wizardReview}, "workflow.back": {"Back"}, "workflow.params.greeting": {"hello"}, "workflow.params.farewell": {"bye"}},
+			wantStep: wizardOverrides,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.desc, func(t *testing.T) {
+			c.form.Set("workflow.name", "echo")
+			req := httptest.NewRequest(http.MethodPost, "/new_workflow", strings.NewReader(c.form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			w := httptest.NewRecorder()
+			s.m.ServeHTTP(w, req)
+			if w.Code != http.StatusOK {
+				t.Fatalf("resp.StatusCode = %d, wanted %d", w.Code, http.StatusOK)
+			}
+			body := w.Body.String()
+			if step := `<input type="hidden" name="workflow.step" value="` + c.wantStep + `" />`; !strings.Contains(body, step) {
+				t.Errorf("response isn't for step %q:\n%s", c.wantStep, body)
+			}
+			if c.wantStep == wizardReview && strings.Count(body, "NewWorkflow-reviewRow--changed") != 1 {
+				t.Errorf("response doesn't highlight exactly one change:\n%s", body)
+			}
+			for _, want := range c.want {
+				if !strings.Contains(body, want) {
+					t.Errorf("response doesn't contain %q:\n%s", want, body)
+				}
+			}
+		})
+	}
+}
@@ -6,6 +6,7 @@ package relui
 
 import (
 	"context"
+	"database/sql"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -16,6 +17,7 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v4"
+	"golang.org/x/build/internal/featureflag"
 	"golang.org/x/build/internal/relui/db"
 	"golang.org/x/build/internal/workflow"
 	"golang.org/x/sync/errgroup"
@@ -24,7 +26,7 @@ import (
 type Listener interface {
 	workflow.Listener
 
-	WorkflowStarted(ctx context.Context, workflowID uuid.UUID, name string, params map[string]interface{}, scheduleID int) error
+	WorkflowStarted(ctx context.Context, workflowID uuid.UUID, name, namespace string, params map[string]interface{}, definition *workflow.Graph, scheduleID int, dryRun bool) error
 	WorkflowFinished(ctx context.Context, workflowID uuid.UUID, outputs map[string]interface{}, err error) error
 }
 
@@ -32,8 +34,11 @@ type Listener interface {
 type Worker struct {
 	dh *DefinitionHolder
 
-	db db.PGDBTX
-	l  Listener
+	db        db.PGDBTX
+	l         Listener
+	resources *workflow.Resources
+	executor  *SubprocessExecutor
+	flags     *featureflag.Set
 
 	done    chan struct{}
 	pending chan *workflow.Workflow
@@ -43,6 +48,14 @@ type Worker struct {
 	// this set to prevent starting a simultaneous execution of a
 	// currently running Workflow.
 	running map[string]runningWorkflow
+
+	// depMu guards waiting, and is held while the state of a
+	// dependency is read, so that the dependency can't finish
+	// between then and its dependent being added to waiting.
+	depMu sync.Mutex
+	// waiting holds the workflows that start once another workflow
+	// succeeds, keyed by the ID of that workflow.
+	waiting map[uuid.UUID][]*workflow.Workflow
 }
 
 type runningWorkflow struct {
@@ -53,12 +66,14 @@ type runningWorkflow struct {
 // NewWorker returns a Worker ready to accept and run workflows.
 func NewWorker(dh *DefinitionHolder, db db.PGDBTX, l Listener) *Worker {
 	return &Worker{
-		dh:      dh,
-		db:      db,
-		l:       l,
-		done:    make(chan struct{}),
-		pending: make(chan *workflow.Workflow, 1),
-		running: make(map[string]runningWorkflow),
+		dh:        dh,
+		db:        db,
+		l:         l,
+		resources: workflow.NewResources(),
+		done:      make(chan struct{}),
+		pending:   make(chan *workflow.Workflow, 1),
+		running:   make(map[string]runningWorkflow),
+		waiting:   make(map[uuid.UUID][]*workflow.Workflow),
 	}
 }
 
@@ -87,8 +102,8 @@ func (w *Worker) Run(ctx context.Context) error {
 				defer w.markStopped(wf)
 
 				outputs, err := wf.Run(runCtx, w.l)
-				if wfErr := w.l.WorkflowFinished(ctx, wf.ID, outputs, err); wfErr != nil {
-					return fmt.Errorf("w.l.WorkflowFinished(_, %q, %v, %q) = %w", wf.ID, outputs, err, wfErr)
+				if wfErr := w.finishWorkflow(ctx, wf.ID, outputs, err); wfErr != nil {
+					return fmt.Errorf("w.finishWorkflow(_, %q, %v, %q) = %w", wf.ID, outputs, err, wfErr)
 				}
 				return nil
 			})
@@ -113,6 +128,9 @@ func (w *Worker) markStopped(wf *workflow.Workflow) {
 }
 
 func (w *Worker) cancelWorkflow(id uuid.UUID) bool {
+	if w.cancelWaiting(id) {
+		return true
+	}
 	w.mu.Lock()
 	defer w.mu.Unlock()
 	rwf, ok := w.running[id.String()]
@@ -123,7 +141,59 @@ func (w *Worker) cancelWorkflow(id uuid.UUID) bool {
 	return ok
 }
 
+// cancelWaiting cancels the workflow with the given ID if it's waiting
+// for another workflow to succeed, and reports whether it was.
+func (w *Worker) cancelWaiting(id uuid.UUID) bool {
+	w.depMu.Lock()
+	var found bool
+	for dep, wfs := range w.waiting {
+		for i, wf := range wfs {
+			if wf.ID == id {
+				w.waiting[dep] = append(wfs[:i:i], wfs[i+1:]...)
+				found = true
+				break
+			}
+		}
+	}
+	w.depMu.Unlock()
+	if !found {
+		return false
+	}
+	if err := w.finishWorkflow(context.Background(), id, nil, context.Canceled); err != nil {
+		log.Printf("w.finishWorkflow(_, %q, nil, %q) = %v", id, context.Canceled, err)
+	}
+	return true
+}
+
+// Resources returns the resource pools shared by the Worker's
+// workflows. Set their limits before starting workflows.
+func (w *Worker) Resources() *workflow.Resources {
+	return w.resources
+}
+
+// SetSubprocessExecutor makes the Worker run the tasks of workflows it
+// starts or resumes afterwards with e. Task workers must be set up as
+// described by IsTaskWorker.
+func (w *Worker) SetSubprocessExecutor(e *SubprocessExecutor) {
+	w.executor = e
+}
+
+// SetFeatureFlags sets the feature flags the Worker evaluates.
+func (w *Worker) SetFeatureFlags(flags *featureflag.Set) {
+	w.flags = flags
+}
+
+// setExecutor sets the Executor of wf, a workflow of the named
+// definition, if the Worker has one.
+func (w *Worker) setExecutor(wf *workflow.Workflow, name string) {
+	if w.executor != nil {
+		wf.Executor = w.executor.forWorkflow(name)
+	}
+}
+
 func (w *Worker) run(wf *workflow.Workflow) error {
+	wf.Resources = w.resources
+	wf.Effects = &PGEffectStore{DB: w.db}
 	select {
 	case <-w.done:
 		return errors.New("worker stopped")
@@ -139,19 +209,149 @@ func (w *Worker) workflowRunning(id uuid.UUID) bool {
 	return ok
 }
 
+// workflowWaiting reports whether the workflow with the given ID is
+// waiting for another workflow to succeed.
+func (w *Worker) workflowWaiting(id uuid.UUID) bool {
+	w.depMu.Lock()
+	defer w.depMu.Unlock()
+	for _, wfs := range w.waiting {
+		for _, wf := range wfs {
+			if wf.ID == id {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// runAfter runs wf once the workflow with ID dep succeeds, or fails it
+// if dep fails.
+func (w *Worker) runAfter(ctx context.Context, wf *workflow.Workflow, dep uuid.UUID) error {
+	w.depMu.Lock()
+	d, err := db.New(w.db).Workflow(ctx, dep)
+	if err != nil {
+		w.depMu.Unlock()
+		return fmt.Errorf("q.Workflow(_, %v) = %w", dep, err)
+	}
+	if !d.Finished {
+		w.waiting[dep] = append(w.waiting[dep], wf)
+		w.depMu.Unlock()
+		return nil
+	}
+	w.depMu.Unlock()
+	var depErr error
+	if d.Error != "" {
+		depErr = errors.New(d.Error)
+	}
+	return w.startDependent(ctx, wf, dep, depErr)
+}
+
+// startDependent runs wf, which waited for the workflow with ID dep,
+// if dep succeeded, and fails it with depErr if not.
+func (w *Worker) startDependent(ctx context.Context, wf *workflow.Workflow, dep uuid.UUID, depErr error) error {
+	if depErr != nil {
+		return w.finishWorkflow(ctx, wf.ID, nil, fmt.Errorf("workflow %v, which this workflow starts after, failed: %w", dep, depErr))
+	}
+	return w.run(wf)
+}
+
+// finishWorkflow reports that the workflow with the given ID finished
+// to the Worker's Listener, then starts or fails the workflows waiting
+// for it.
+func (w *Worker) finishWorkflow(ctx context.Context, id uuid.UUID, outputs map[string]interface{}, err error) error {
+	wfErr := w.l.WorkflowFinished(ctx, id, outputs, err)
+	w.depMu.Lock()
+	dependents := w.waiting[id]
+	delete(w.waiting, id)
+	w.depMu.Unlock()
+	for _, wf := range dependents {
+		if startErr := w.startDependent(ctx, wf, id, err); startErr != nil {
+			log.Printf("w.startDependent(_, %q, %q, %v) = %v", wf.ID, id, err, startErr)
+		}
+	}
+	return wfErr
+}
+
 // StartWorkflow persists and starts running a workflow.
 func (w *Worker) StartWorkflow(ctx context.Context, name string, params map[string]interface{}, scheduleID int) (uuid.UUID, error) {
+	return w.startWorkflow(ctx, name, params, scheduleID, false, uuid.Nil)
+}
+
+// StartWorkflowAfter is like StartWorkflow, but holds the new workflow
+// until the workflow with ID after succeeds, which may already have
+// happened. If that workflow fails or is stopped, so is the new one.
+// A dry run can't be started after, since it changes nothing the new
+// workflow could rely on.
+// Chaining workflows this way lets the stages of a release, such as
+// tagging the x/ repos after a Go release, start without anyone
+// watching for the previous stage to finish.
+func (w *Worker) StartWorkflowAfter(ctx context.Context, name string, params map[string]interface{}, after uuid.UUID) (uuid.UUID, error) {
+	if after == uuid.Nil {
+		return uuid.UUID{}, errors.New("no workflow to start after")
+	}
+	return w.startWorkflow(ctx, name, params, 0, false, after)
+}
+
+// LatestWorkflow returns the ID of the most recent workflow of the named
+// definition that hasn't failed and isn't a dry run, for
+// StartWorkflowAfter to start a workflow after the latest run of
+// another definition. That workflow may still be running, in which
+// case the new one waits for it to succeed.
+func (w *Worker) LatestWorkflow(ctx context.Context, name string) (uuid.UUID, error) {
+	wf, err := db.New(w.db).LatestUnfailedWorkflowByName(ctx, sql.NullString{String: name, Valid: true})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return uuid.UUID{}, fmt.Errorf("no %q workflow that hasn't failed and isn't a dry run", name)
+	} else if err != nil {
+		return uuid.UUID{}, err
+	}
+	return wf.ID, nil
+}
+
+// StartDryRunWorkflow is like StartWorkflow, but starts a dry run of
+// the workflow, in which tasks that honor it make no externally
+// visible changes. See workflow.HonorsDryRun.
+func (w *Worker) StartDryRunWorkflow(ctx context.Context, name string, params map[string]interface{}) (uuid.UUID, error) {
+	return w.startWorkflow(ctx, name, params, 0, true, uuid.Nil)
+}
+
+func (w *Worker) startWorkflow(ctx context.Context, name string, params map[string]interface{}, scheduleID int, dryRun bool, after uuid.UUID) (uuid.UUID, error) {
 	d := w.dh.Definition(name)
 	if d == nil {
 		return uuid.UUID{}, fmt.Errorf("no workflow named %q", name)
 	}
+	if dryRun {
+		if err := checkDryRun(d.Graph()); err != nil {
+			return uuid.UUID{}, err
+		}
+	}
 	wf, err := workflow.Start(d, params)
 	if err != nil {
 		return uuid.UUID{}, err
 	}
-	if err := w.l.WorkflowStarted(ctx, wf.ID, name, params, scheduleID); err != nil {
+	wf.DryRun = dryRun
+	w.setExecutor(wf, name)
+	if after != uuid.Nil {
+		dep, err := db.New(w.db).Workflow(ctx, after)
+		if err != nil {
+			return uuid.UUID{}, fmt.Errorf("workflow %v to start after: %w", after, err)
+		}
+		if dep.Error != "" {
+			return uuid.UUID{}, fmt.Errorf("workflow %v to start after failed: %v", after, dep.Error)
+		}
+		if dep.DryRun {
+			return uuid.UUID{}, fmt.Errorf("workflow %v to start after is a dry run", after)
+		}
+	}
+	if err := w.l.WorkflowStarted(ctx, wf.ID, name, w.dh.DefinitionNamespace(name), params, d.Graph(), scheduleID, dryRun); err != nil {
 		return wf.ID, err
 	}
+	if after != uuid.Nil {
+		if err := db.New(w.db).CreateWorkflowDependency(ctx, db.CreateWorkflowDependencyParams{WorkflowID: wf.ID, DependsOnID: after}); err != nil {
+			w.l.WorkflowFinished(ctx, wf.ID, nil, err)
+			return wf.ID, err
+		}
+		return wf.ID, w.runAfter(ctx, wf, after)
+	}
 	if err := w.run(wf); err != nil {
 		return wf.ID, err
 	}
@@ -178,6 +378,8 @@ func (w *Worker) Resume(ctx context.Context, id uuid.UUID) error {
 	var err error
 	var wf db.Workflow
 	var tasks []db.Task
+	var dep db.WorkflowDependency
+	var hasDep bool
 	err = w.db.BeginFunc(ctx, func(tx pgx.Tx) error {
 		q := db.New(w.db)
 		wf, err = q.Workflow(ctx, id)
@@ -194,6 +396,11 @@ func (w *Worker) Resume(ctx context.Context, id uuid.UUID) error {
 		if err != nil {
 			return fmt.Errorf("q.TasksForWorkflow(_, %v) = %w", id, err)
 		}
+		dep, err = q.WorkflowDependency(ctx, id)
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return fmt.Errorf("q.WorkflowDependency(_, %v) = %w", id, err)
+		}
+		hasDep = err == nil
 		return nil
 	})
 	if err != nil {
@@ -202,17 +409,17 @@ func (w *Worker) Resume(ctx context.Context, id uuid.UUID) error {
 	d := w.dh.Definition(wf.Name.String)
 	if d == nil {
 		err := fmt.Errorf("no workflow named %q", wf.Name.String)
-		w.l.WorkflowFinished(ctx, wf.ID, nil, err)
+		w.finishWorkflow(ctx, wf.ID, nil, err)
 		return err
 	}
 
 	params, err := UnmarshalWorkflow(wf.Params.String, d)
 	if err != nil {
 		err := fmt.Errorf("UnmarshalWorkflow %q: %w", wf.ID, err)
-		w.l.WorkflowFinished(ctx, wf.ID, nil, err)
+		w.finishWorkflow(ctx, wf.ID, nil, err)
 		return err
 	}
-	state := &workflow.WorkflowState{ID: wf.ID, Params: params}
+	state := &workflow.WorkflowState{ID: wf.ID, Params: params, DryRun: wf.DryRun}
 
 	taskStates := make(map[string]*workflow.TaskState)
 	for _, t := range tasks {
@@ -227,11 +434,32 @@ func (w *Worker) Resume(ctx context.Context, id uuid.UUID) error {
 		}
 		taskStates[t.Name] = ts
 	}
+	if wf.Definition.Valid {
+		stored := new(workflow.Graph)
+		if err := json.Unmarshal([]byte(wf.Definition.String), stored); err != nil {
+			err := fmt.Errorf("unmarshaling definition of %q: %w", wf.ID, err)
+			w.finishWorkflow(ctx, wf.ID, nil, err)
+			return err
+		}
+		current := d.Graph()
+		for _, warning := range workflow.CheckCompatibility(stored, current) {
+			log.Printf("Resume(_, %q): definition of %q changed since the workflow started: %s", wf.ID, wf.Name.String, warning)
+		}
+		var warnings []string
+		taskStates, warnings = workflow.MigrateTaskStates(stored, current, taskStates)
+		for _, warning := range warnings {
+			log.Printf("Resume(_, %q): %s", wf.ID, warning)
+		}
+	}
 	res, err := workflow.Resume(d, state, taskStates)
 	if err != nil {
-		w.l.WorkflowFinished(ctx, wf.ID, nil, err)
+		w.finishWorkflow(ctx, wf.ID, nil, err)
 		return err
 	}
+	w.setExecutor(res, wf.Name.String)
+	if hasDep {
+		return w.runAfter(ctx, res, dep.DependsOnID)
+	}
 	return w.run(res)
 }
 
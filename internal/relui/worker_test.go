@@ -53,6 +53,7 @@ func TestWorkerStartWorkflow(t *testing.T) {
 		ID: wfid,
 		// Params ignored: nondeterministic serialization
 		Name:      nullString(t.Name()),
+		Namespace: DefaultNamespace,
 		Output:    `{"echo": "greetings alice bob"}`,
 		Finished:  true,
 		CreatedAt: time.Now(), // cmpopts.EquateApproxTime
@@ -75,6 +76,9 @@ func TestWorkerStartWorkflow(t *testing.T) {
 			Error:      sql.NullString{},
 			CreatedAt:  time.Now(), // cmpopts.EquateApproxTime
 			UpdatedAt:  time.Now(), // cmpopts.EquateApproxTime
+			StartedAt:  sql.NullTime{Time: time.Now(), Valid: true},
+			FinishedAt: sql.NullTime{Time: time.Now(), Valid: true},
+			Args:       nullString(`["greetings", ["alice", "bob"]]`),
 		},
 	}
 	if diff := cmp.Diff(want, tasks, cmpopts.EquateApproxTime(time.Minute)); diff != "" {
@@ -118,6 +122,9 @@ func TestWorkerResume(t *testing.T) {
 		Error:      sql.NullString{},
 		CreatedAt:  time.Now(), // cmpopts.EquateApproxTime
 		UpdatedAt:  time.Now(), // cmpopts.EquateApproxTime
+		StartedAt:  sql.NullTime{Time: time.Now(), Valid: true},
+		FinishedAt: sql.NullTime{Time: time.Now(), Valid: true},
+		Args:       nullString(`["hello", ["alice", "bob"]]`),
 	}}
 	if diff := cmp.Diff(want, tasks, cmpopts.EquateApproxTime(time.Minute)); diff != "" {
 		t.Errorf("q.TasksForWorkflow(_, %q) mismatch (-want +got):\n%s", wfid, diff)
@@ -179,6 +186,8 @@ func TestWorkflowResumeAll(t *testing.T) {
 			Error:            sql.NullString{},
 			CreatedAt:        time.Now(), // cmpopts.EquateApproxTime
 			UpdatedAt:        time.Now(), // cmpopts.EquateApproxTime
+			StartedAt:        sql.NullTime{Time: time.Now(), Valid: true},
+			FinishedAt:       sql.NullTime{Time: time.Now(), Valid: true},
 			MostRecentUpdate: time.Now(),
 		},
 		{
@@ -190,6 +199,8 @@ func TestWorkflowResumeAll(t *testing.T) {
 			Error:            sql.NullString{},
 			CreatedAt:        time.Now(), // cmpopts.EquateApproxTime
 			UpdatedAt:        time.Now(), // cmpopts.EquateApproxTime
+			StartedAt:        sql.NullTime{Time: time.Now(), Valid: true},
+			FinishedAt:       sql.NullTime{Time: time.Now(), Valid: true},
 			MostRecentUpdate: time.Now(),
 		},
 	}
@@ -271,6 +282,102 @@ func TestWorkflowResumeRetry(t *testing.T) {
 	<-wfDone
 }
 
+func TestWorkerStartWorkflowAfter(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	dbp := testDB(ctx, t)
+	q := db.New(dbp)
+	wg := sync.WaitGroup{}
+	dh := NewDefinitionHolder()
+	w := NewWorker(dh, dbp, &testWorkflowListener{
+		Listener:   &PGListener{DB: dbp},
+		onFinished: wg.Done,
+	})
+
+	gate := make(chan struct{})
+	gated := workflow.New()
+	workflow.Output(gated, "opened", workflow.Task0(gated, "wait", func(ctx context.Context) (bool, error) {
+		select {
+		case <-gate:
+			return true, nil
+		case <-ctx.Done():
+			return false, ctx.Err()
+		}
+	}))
+	dh.RegisterDefinition("gated", gated)
+	dh.RegisterDefinition("echo", newTestEchoWorkflow())
+	params := map[string]interface{}{"greeting": "greetings", "names": []string{"alice", "bob"}}
+
+	go w.Run(ctx)
+	gateID, err := w.StartWorkflow(ctx, "gated", nil, 0)
+	if err != nil {
+		t.Fatalf("w.StartWorkflow(_, %q, nil, 0) = %v, %v, wanted no error", "gated", gateID, err)
+	}
+	if latest, err := w.LatestWorkflow(ctx, "gated"); err != nil || latest != gateID {
+		t.Fatalf("w.LatestWorkflow(_, %q) = %v, %v, wanted %v, nil", "gated", latest, err, gateID)
+	}
+	// Start two chains after the gated workflow: a succeeds, then b.
+	// c is stopped while it waits, which fails d.
+	after := func(dep uuid.UUID) uuid.UUID {
+		t.Helper()
+		id, err := w.StartWorkflowAfter(ctx, "echo", params, dep)
+		if err != nil {
+			t.Fatalf("w.StartWorkflowAfter(_, %q, %v, %v) = %v, %v, wanted no error", "echo", params, dep, id, err)
+		}
+		return id
+	}
+	a := after(gateID)
+	b := after(a)
+	c := after(gateID)
+	d := after(c)
+	for _, id := range []uuid.UUID{a, b, c, d} {
+		if !w.workflowWaiting(id) {
+			t.Errorf("w.workflowWaiting(%v) = false, wanted true", id)
+		}
+	}
+
+	wg.Add(5)
+	if !w.cancelWorkflow(c) {
+		t.Errorf("w.cancelWorkflow(%v) = false, wanted true", c)
+	}
+	close(gate)
+	wg.Wait()
+
+	want := map[uuid.UUID]string{gateID: "", a: "", b: "", c: "context canceled", d: fmt.Sprintf("workflow %v, which this workflow starts after, failed: context canceled", c)}
+	for id, wantErr := range want {
+		wf, err := q.Workflow(ctx, id)
+		if err != nil {
+			t.Fatalf("q.Workflow(_, %v) = %v, %v, wanted no error", id, wf, err)
+		}
+		if !wf.Finished || wf.Error != wantErr {
+			t.Errorf("workflow %v finished: %v, error: %q; wanted finished with error %q", id, wf.Finished, wf.Error, wantErr)
+		}
+	}
+	dependents, err := q.WorkflowDependents(ctx, gateID)
+	if err != nil {
+		t.Fatalf("q.WorkflowDependents(_, %v) = %v, %v, wanted no error", gateID, dependents, err)
+	}
+	var got []uuid.UUID
+	for _, wf := range dependents {
+		got = append(got, wf.ID)
+	}
+	if diff := cmp.Diff([]uuid.UUID{a, c}, got); diff != "" {
+		t.Errorf("q.WorkflowDependents(_, %v) mismatch (-want +got):\n%s", gateID, diff)
+	}
+
+	// Dry runs change nothing a workflow could wait for.
+	cwp := db.CreateWorkflowParams{ID: uuid.New(), Name: nullString("gated"), CreatedAt: time.Now(), UpdatedAt: time.Now(), DryRun: true}
+	if wf, err := q.CreateWorkflow(ctx, cwp); err != nil {
+		t.Fatalf("q.CreateWorkflow(_, %v) = %v, %v, wanted no error", cwp, wf, err)
+	}
+	if latest, err := w.LatestWorkflow(ctx, "gated"); err != nil || latest != gateID {
+		t.Errorf("w.LatestWorkflow(_, %q) = %v, %v, wanted %v, nil", "gated", latest, err, gateID)
+	}
+	if id, err := w.StartWorkflowAfter(ctx, "echo", params, cwp.ID); err == nil {
+		t.Errorf("w.StartWorkflowAfter(_, %q, %v, %v) = %v, nil, wanted an error for a dry run", "echo", params, cwp.ID, id)
+	}
+}
+
 func newTestEchoWorkflow() *workflow.Definition {
 	wd := workflow.New()
 	echo := func(ctx context.Context, greeting string, names []string) (string, error) {
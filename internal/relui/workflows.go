@@ -24,7 +24,6 @@ import (
 	"sync"
 	"time"
 
-	"cloud.google.com/go/storage"
 	"github.com/google/go-cmp/cmp"
 	"golang.org/x/build/buildlet"
 	"golang.org/x/build/dashboard"
@@ -32,24 +31,96 @@ import (
 	"golang.org/x/build/internal/releasetargets"
 	"golang.org/x/build/internal/relui/db"
 	"golang.org/x/build/internal/relui/sign"
+	"golang.org/x/build/internal/sourcecache"
 	"golang.org/x/build/internal/task"
 	"golang.org/x/build/internal/workflow"
 	wf "golang.org/x/build/internal/workflow"
+	"golang.org/x/exp/slices"
 	"golang.org/x/net/context/ctxhttp"
 )
 
-// DefinitionHolder holds workflow definitions.
+// Well-known namespaces of workflow definitions.
+const (
+	// DefaultNamespace holds definitions registered without a namespace.
+	DefaultNamespace = "default"
+	// ReleaseNamespace holds the Go release workflows.
+	ReleaseNamespace = "releases"
+	// XReposNamespace holds the x/ repo tagging workflows.
+	XReposNamespace = "x-repos"
+	// InfraNamespace holds infrastructure maintenance workflows.
+	InfraNamespace = "infra"
+)
+
+// Scarce external resources that tasks declare they need with
+// workflow.NeedsResources. Their limits are configured on the Worker.
+const (
+	// MacOSSignerResource is the macOS signing service.
+	MacOSSignerResource = "macos-signer"
+	// WindowsSignerResource is the Windows signing service.
+	WindowsSignerResource = "windows-signer"
+)
+
+// A Namespace groups the workflow definitions of one team, along
+// with the workflows and schedules created from them, so that they
+// are listed separately from other teams' in the UI and API.
+type Namespace struct {
+	Name  string // Name is stored with workflows and schedules, and used in URLs.
+	Title string // Title is the name shown in the UI. Optional.
+
+	// Members are the email addresses of the users allowed to
+	// act on the namespace's workflows and schedules: create,
+	// stop, approve, and retry workflows, and create and delete
+	// schedules. If Members and Groups are both empty, any user may.
+	Members []string
+
+	// Groups are the email addresses of groups whose members are
+	// allowed to act on the namespace too. Their membership is
+	// kept up to date by a GroupSyncer; until it first syncs, only
+	// Members are allowed.
+	Groups []string
+
+	groupMembers []string // members of Groups as of the last sync
+}
+
+// DisplayName returns the title of the namespace, or its name if it
+// has no title.
+func (ns *Namespace) DisplayName() string {
+	if ns.Title != "" {
+		return ns.Title
+	}
+	return ns.Name
+}
+
+// Allows reports whether the user with the given email address may
+// act on the namespace's workflows and schedules.
+func (ns *Namespace) Allows(email string) bool {
+	if len(ns.Members) == 0 && len(ns.Groups) == 0 {
+		return true
+	}
+	return slices.Contains(ns.Members, email) || slices.Contains(ns.groupMembers, email)
+}
+
+// DefinitionHolder holds workflow definitions, grouped in namespaces.
+//
+// Definition names are unique across namespaces, as workflows and
+// schedules refer to their definition by name.
 type DefinitionHolder struct {
 	mu          sync.Mutex
 	definitions map[string]*wf.Definition
+	namespaceOf map[string]string     // definition name → namespace name
+	namespaces  map[string]*Namespace // by name
 }
 
 // NewDefinitionHolder creates a new DefinitionHolder,
-// initialized with a sample "echo" wf.
+// initialized with a sample "echo" wf in the default namespace.
 func NewDefinitionHolder() *DefinitionHolder {
-	return &DefinitionHolder{definitions: map[string]*wf.Definition{
-		"echo": newEchoWorkflow(),
-	}}
+	h := &DefinitionHolder{
+		definitions: map[string]*wf.Definition{},
+		namespaceOf: map[string]string{},
+		namespaces:  map[string]*Namespace{},
+	}
+	h.RegisterDefinition("echo", newEchoWorkflow())
+	return h
 }
 
 // Definition returns the initialized wf.Definition registered
@@ -60,15 +131,53 @@ func (h *DefinitionHolder) Definition(name string) *wf.Definition {
 	return h.definitions[name]
 }
 
-// RegisterDefinition registers a definition with a name.
+// RegisterDefinition registers a definition with a name in the
+// default namespace.
 // If a definition with the same name already exists, RegisterDefinition panics.
 func (h *DefinitionHolder) RegisterDefinition(name string, d *wf.Definition) {
+	h.RegisterNamespacedDefinition(DefaultNamespace, name, d)
+}
+
+// RegisterNamespacedDefinition registers a definition with a name in
+// the namespace ns. The namespace is created if needed, with no title
+// or members; use RegisterNamespace to configure it.
+// If a definition with the same name already exists in any namespace,
+// RegisterNamespacedDefinition panics.
+func (h *DefinitionHolder) RegisterNamespacedDefinition(ns, name string, d *wf.Definition) {
 	h.mu.Lock()
 	defer h.mu.Unlock()
 	if _, exist := h.definitions[name]; exist {
 		panic("relui: multiple registrations for " + name)
 	}
+	if h.namespaces[ns] == nil {
+		h.namespaces[ns] = &Namespace{Name: ns}
+	}
 	h.definitions[name] = d
+	h.namespaceOf[name] = ns
+}
+
+// RegisterNamespace configures the namespace with ns.Name, replacing
+// any earlier configuration.
+func (h *DefinitionHolder) RegisterNamespace(ns Namespace) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.namespaces[ns.Name] = &ns
+}
+
+// setGroupMembers records the members of the groups of the namespace
+// with the given name, if there is one.
+func (h *DefinitionHolder) setGroupMembers(name string, members []string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	ns := h.namespaces[name]
+	if ns == nil {
+		return
+	}
+	// Namespaces may be in use by callers, so replace rather than
+	// modify this one.
+	updated := *ns
+	updated.groupMembers = members
+	h.namespaces[name] = &updated
 }
 
 // Definitions returns the names of all registered definitions.
@@ -82,6 +191,49 @@ func (h *DefinitionHolder) Definitions() map[string]*wf.Definition {
 	return defs
 }
 
+// NamespaceDefinitions returns the definitions registered in the
+// namespace ns, by name.
+func (h *DefinitionHolder) NamespaceDefinitions(ns string) map[string]*wf.Definition {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	defs := make(map[string]*wf.Definition)
+	for k, v := range h.definitions {
+		if h.namespaceOf[k] == ns {
+			defs[k] = v
+		}
+	}
+	return defs
+}
+
+// DefinitionNamespace returns the name of the namespace of the
+// definition with the given name, or the empty string if there is no
+// such definition.
+func (h *DefinitionHolder) DefinitionNamespace(name string) string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.namespaceOf[name]
+}
+
+// Namespace returns the namespace with the given name, or nil if
+// there is no such namespace.
+func (h *DefinitionHolder) Namespace(name string) *Namespace {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.namespaces[name]
+}
+
+// Namespaces returns all namespaces, sorted by name.
+func (h *DefinitionHolder) Namespaces() []*Namespace {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var nss []*Namespace
+	for _, ns := range h.namespaces {
+		nss = append(nss, ns)
+	}
+	sort.Slice(nss, func(i, j int) bool { return nss[i].Name < nss[j].Name })
+	return nss
+}
+
 // Release parameter definitions.
 var (
 	targetDateParam = wf.ParamDef[task.Date]{
@@ -181,8 +333,8 @@ Their first names will be included at the end of the release announcement, and C
 // development.
 func newEchoWorkflow() *wf.Definition {
 	wd := wf.New()
-	wf.Output(wd, "greeting", wf.Task1(wd, "greeting", echo, wf.Param(wd, wf.ParamDef[string]{Name: "greeting"})))
-	wf.Output(wd, "farewell", wf.Task1(wd, "farewell", echo, wf.Param(wd, wf.ParamDef[string]{Name: "farewell"})))
+	wf.Output(wd, "greeting", wf.Task1(wd, "greeting", echo, wf.Param(wd, wf.ParamDef[string]{Name: "greeting"}), wf.HonorsDryRun()))
+	wf.Output(wd, "farewell", wf.Task1(wd, "farewell", echo, wf.Param(wd, wf.ParamDef[string]{Name: "farewell"}), wf.HonorsDryRun()))
 	return wd
 }
 
@@ -254,16 +406,16 @@ func RegisterReleaseWorkflows(ctx context.Context, h *DefinitionHolder, build *B
 	for _, r := range releases {
 		wd := wf.New()
 
-		versions := wf.Task1(wd, "Get next versions", version.GetNextVersions, wf.Const(r.kinds))
+		versions := wf.Task1(wd, "Get next versions", version.GetNextVersions, wf.Const(r.kinds), wf.HonorsDryRun())
 		targetDate := wf.Param(wd, targetDateParam)
 		securityContent := wf.Param(wd, securityPreAnnParam)
 		cves := wf.Param(wd, securityPreAnnCVEsParam)
 		coordinators := wf.Param(wd, releaseCoordinators)
 
-		sentMail := wf.Task5(wd, "mail-pre-announcement", comm.PreAnnounceRelease, versions, targetDate, securityContent, cves, coordinators)
-		wf.Output(wd, "Pre-announcement URL", wf.Task1(wd, "await-pre-announcement", comm.AwaitAnnounceMail, sentMail))
+		sentMail := wf.Task5(wd, "mail-pre-announcement", comm.PreAnnounceRelease, versions, targetDate, securityContent, cves, coordinators, wf.HonorsDryRun(), wf.IdempotencyKey(task.PreAnnounceReleaseKey))
+		wf.Output(wd, "Pre-announcement URL", wf.Task1(wd, "await-pre-announcement", comm.AwaitAnnounceMail, sentMail, wf.HonorsDryRun()))
 
-		h.RegisterDefinition("pre-announce "+r.name, wd)
+		h.RegisterNamespacedDefinition(ReleaseNamespace, "pre-announce "+r.name, wd)
 	}
 
 	// Register workflows for miscellaneous tasks that happen as part of the Go release cycle.
@@ -281,17 +433,17 @@ func RegisterReleaseWorkflows(ctx context.Context, h *DefinitionHolder, build *B
 				return nil
 			},
 		})
-		devVer := wf.Task0(wd, "Get development version", version.GetDevelVersion)
-		pinged := wf.Task2(wd, "Ping early-in-cycle issues", milestone.PingEarlyIssues, devVer, openTreeURL)
+		devVer := wf.Task0(wd, "Get development version", version.GetDevelVersion, wf.HonorsDryRun())
+		pinged := wf.Task2(wd, "Ping early-in-cycle issues", milestone.PingEarlyIssues, devVer, openTreeURL, wf.HonorsDryRun())
 		wf.Output(wd, "pinged", pinged)
-		h.RegisterDefinition("ping early-in-cycle issues in development milestone", wd)
+		h.RegisterNamespacedDefinition(ReleaseNamespace, "ping early-in-cycle issues in development milestone", wd)
 	}
 	{
 		// Register an "unwait wait-release CLs" workflow.
 		wd := wf.New()
-		unwaited := wf.Task0(wd, "Unwait wait-release CLs", version.UnwaitWaitReleaseCLs)
+		unwaited := wf.Task0(wd, "Unwait wait-release CLs", version.UnwaitWaitReleaseCLs, wf.HonorsDryRun())
 		wf.Output(wd, "unwaited", unwaited)
-		h.RegisterDefinition("unwait wait-release CLs", wd)
+		h.RegisterNamespacedDefinition(ReleaseNamespace, "unwait wait-release CLs", wd)
 	}
 
 	// Register dry-run release workflows.
@@ -335,14 +487,14 @@ func registerProdReleaseWorkflows(ctx context.Context, h *DefinitionHolder, buil
 		}
 		addCommTasks(wd, build, comm, r.kind, wf.Slice(published), securitySummary, securityFixes, coordinators)
 
-		h.RegisterDefinition(fmt.Sprintf("Go 1.%d %s", r.major, r.suffix), wd)
+		h.RegisterNamespacedDefinition(ReleaseNamespace, fmt.Sprintf("Go 1.%d %s", r.major, r.suffix), wd)
 	}
 
 	wd, err := createMinorReleaseWorkflow(build, milestone, version, comm, currentMajor-1, currentMajor)
 	if err != nil {
 		return err
 	}
-	h.RegisterDefinition(fmt.Sprintf("Minor releases for Go 1.%d and 1.%d", currentMajor-1, currentMajor), wd)
+	h.RegisterNamespacedDefinition(ReleaseNamespace, fmt.Sprintf("Minor releases for Go 1.%d and 1.%d", currentMajor-1, currentMajor), wd)
 
 	return nil
 }
@@ -365,7 +517,7 @@ func registerBuildTestSignOnlyWorkflow(h *DefinitionHolder, version *task.Versio
 	wf.Output(wd, "Artifacts", artifacts)
 	wf.Output(wd, "Modules", mods)
 
-	h.RegisterDefinition(fmt.Sprintf("dry-run (build, test, and sign only): Go 1.%d next beta", major), wd)
+	h.RegisterNamespacedDefinition(ReleaseNamespace, fmt.Sprintf("dry-run (build, test, and sign only): Go 1.%d next beta", major), wd)
 }
 
 func createMinorReleaseWorkflow(build *BuildReleaseTasks, milestone *task.MilestoneTasks, version *task.VersionTasks, comm task.CommunicationTasks, prevMajor, currentMajor int) (*wf.Definition, error) {
@@ -389,9 +541,9 @@ func addCommTasks(
 	okayToAnnounceAndTweet := wf.Action0(wd, "Wait to Announce", build.ApproveAction, wf.After(published))
 
 	// Announce that a new Go release has been published.
-	sentMail := wf.Task4(wd, "mail-announcement", comm.AnnounceRelease, wf.Const(kind), published, securityFixes, coordinators, wf.After(okayToAnnounceAndTweet))
-	announcementURL := wf.Task1(wd, "await-announcement", comm.AwaitAnnounceMail, sentMail)
-	tweetURL := wf.Task4(wd, "post-tweet", comm.TweetRelease, wf.Const(kind), published, securitySummary, announcementURL, wf.After(okayToAnnounceAndTweet))
+	sentMail := wf.Task4(wd, "mail-announcement", comm.AnnounceRelease, wf.Const(kind), published, securityFixes, coordinators, wf.After(okayToAnnounceAndTweet), wf.HonorsDryRun(), wf.IdempotencyKey(task.AnnounceReleaseKey))
+	announcementURL := wf.Task1(wd, "await-announcement", comm.AwaitAnnounceMail, sentMail, wf.HonorsDryRun())
+	tweetURL := wf.Task4(wd, "post-tweet", comm.TweetRelease, wf.Const(kind), published, securitySummary, announcementURL, wf.After(okayToAnnounceAndTweet), wf.HonorsDryRun())
 
 	wf.Output(wd, "Announcement URL", announcementURL)
 	wf.Output(wd, "Tweet URL", tweetURL)
@@ -433,7 +585,7 @@ func addSingleReleaseWorkflow(
 	signedAndTestedArtifacts, modules := build.addBuildTasks(wd, major, nextVersion, timestamp, source)
 	okayToTagAndPublish := wf.Action0(wd, "Wait for Release Coordinator Approval", build.ApproveAction, wf.After(signedAndTestedArtifacts))
 
-	dlcl := wf.Task5(wd, "Mail DL CL", version.MailDLCL, wf.Const(major), kindVal, nextVersion, coordinators, wf.Const(false), wf.After(okayToTagAndPublish))
+	dlcl := wf.Task4(wd, "Mail DL CL", version.MailDLCL, wf.Const(major), kindVal, nextVersion, coordinators, wf.After(okayToTagAndPublish), wf.HonorsDryRun(), wf.IdempotencyKey(task.MailDLCLKey))
 	dlclCommit := wf.Task2(wd, "Wait for DL CL submission", version.AwaitCL, dlcl, wf.Const(""))
 	wf.Output(wd, "Download CL submitted", dlclCommit)
 
@@ -449,12 +601,14 @@ func addSingleReleaseWorkflow(
 		versionCL := wf.Task4(wd, "Mail version CL", version.CreateAutoSubmitVersionCL, branchVal, nextVersion, coordinators, versionFile, wf.After(publishingHead))
 		tagCommit = wf.Task2(wd, "Wait for version CL submission", version.AwaitCL, versionCL, publishingHead)
 	}
-	tagged := wf.Action2(wd, "Tag version", version.TagRelease, nextVersion, tagCommit, wf.After(okayToTagAndPublish))
+	tagged := wf.Action2(wd, "Tag version", version.TagRelease, nextVersion, tagCommit, wf.After(okayToTagAndPublish), wf.IdempotencyKey(task.TagReleaseKey))
 	uploaded := wf.Action1(wd, "Upload artifacts to CDN", build.uploadArtifacts, signedAndTestedArtifacts, wf.After(tagged))
 	uploadedMods := wf.Action2(wd, "Upload modules to CDN", build.uploadModules, nextVersion, modules, wf.After(tagged))
 	availableOnProxy := wf.Action2(wd, "Wait for modules on proxy.golang.org", build.awaitProxy, nextVersion, modules, wf.After(uploadedMods))
 	pushed := wf.Action3(wd, "Push issues", milestone.PushIssues, milestones, nextVersion, kindVal, wf.After(tagged))
-	published := wf.Task2(wd, "Publish to website", build.publishArtifacts, nextVersion, signedAndTestedArtifacts, wf.After(uploaded, availableOnProxy, pushed))
+	// Publishing appends to the release log, whose appends are best
+	// kept to one process.
+	published := wf.Task2(wd, "Publish to website", build.publishArtifacts, nextVersion, signedAndTestedArtifacts, wf.After(uploaded, availableOnProxy, pushed), wf.IdempotencyKey(publishArtifactsKey), wf.RunsInProcess())
 	if kind == task.KindMajor {
 		goimportsCL := wf.Task2(wd, fmt.Sprintf("Mail goimports CL for 1.%d", major), version.CreateUpdateStdlibIndexCL, coordinators, nextVersion, wf.After(published))
 		goimportsCommit := wf.Task2(wd, "Wait for goimports CL submission", version.AwaitCL, goimportsCL, wf.Const(""))
@@ -519,18 +673,19 @@ func (tasks *BuildReleaseTasks) addBuildTasks(wd *wf.Definition, major int, vers
 
 		// Create installers and perform platform-specific signing where
 		// applicable. For macOS, produce updated tgz and module zips that
-		// include the signed binaries.
+		// include the signed binaries. Signing tasks talk to the signers
+		// connected to this process, so they must run in it.
 		switch target.GOOS {
 		case "darwin":
 			pkg := wf.Task2(wd, "Build PKG installer", tasks.buildDarwinPKG, version, tar)
-			signedPKG := wf.Task2(wd, "Sign PKG installer", tasks.signArtifact, pkg, wf.Const(sign.BuildMacOS))
+			signedPKG := wf.Task2(wd, "Sign PKG installer", tasks.signArtifact, pkg, wf.Const(sign.BuildMacOS), wf.NeedsResources(MacOSSignerResource), wf.RunsInProcess())
 			signedTGZ := wf.Task1(wd, "Convert PKG to .tgz", tasks.convertPKGToTGZ, signedPKG)
 			mergedTGZ := wf.Task2(wd, "Merge signed files into .tgz", tasks.mergeSignedToTGZ, tar, signedTGZ)
 			mod = wf.Task4(wd, "Merge signed files into module zip", tasks.mergeSignedToModule, version, timestamp, mod, signedTGZ)
 			artifacts = append(artifacts, signedPKG, mergedTGZ)
 		case "windows":
 			msi := wf.Task1(wd, "Build MSI installer", tasks.buildWindowsMSI, tar)
-			signedMSI := wf.Task2(wd, "Sign MSI installer", tasks.signArtifact, msi, wf.Const(sign.BuildWindows))
+			signedMSI := wf.Task2(wd, "Sign MSI installer", tasks.signArtifact, msi, wf.Const(sign.BuildWindows), wf.NeedsResources(WindowsSignerResource), wf.RunsInProcess())
 			artifacts = append(artifacts, signedMSI, zip)
 		default:
 			artifacts = append(artifacts, tar)
@@ -546,7 +701,7 @@ func (tasks *BuildReleaseTasks) addBuildTasks(wd *wf.Definition, major int, vers
 			blockers = append(blockers, long)
 		}
 	}
-	signedArtifacts := wf.Task1(wd, "Compute GPG signature for artifacts", tasks.computeGPG, wf.Slice(artifacts...))
+	signedArtifacts := wf.Task1(wd, "Compute GPG signature for artifacts", tasks.computeGPG, wf.Slice(artifacts...), wf.RunsInProcess())
 
 	// Run advisory trybots.
 	var advisoryResults []wf.Value[tryBotResult]
@@ -593,42 +748,82 @@ func advisoryTryBots(major int) []*dashboard.BuildConfig {
 
 // BuildReleaseTasks serves as an adapter to the various build tasks in the task package.
 type BuildReleaseTasks struct {
-	GerritClient             task.GerritClient
+	// Services are the external services the tasks call. Storage
+	// opens ScratchURL and ServingURL.
+	task.Services
+
 	GerritHTTPClient         *http.Client
 	GerritURL                string
 	PrivateGerritURL         string
-	GCSClient                *storage.Client
-	ScratchURL, ServingURL   string // ScratchURL is a gs:// or file:// URL, no trailing slash. E.g., "gs://golang-release-staging/relui-scratch".
+	SourceCache              *sourcecache.Cache // if non-nil, where public sources are fetched from instead of GerritURL; its stores must be write-only
+	ScratchURL, ServingURL   string             // ScratchURL is a gs:// or file:// URL, no trailing slash. E.g., "gs://golang-release-staging/relui-scratch".
 	DownloadURL              string
 	ProxyPrefix              string // ProxyPrefix is the prefix at which module files are published, e.g. https://proxy.golang.org/golang.org/toolchain/@v
 	PublishFile              func(task.WebsiteFile) error
+	LogFiles                 func(context.Context, []task.WebsiteFile) error // if non-nil, logs the checksums of files to the release log before they're published
 	CreateBuildlet           func(context.Context, string) (buildlet.RemoteClient, error)
-	SignService              sign.Service
+	CheckSigned              func(sign.BuildType, io.Reader) error // if non-nil, checks that the artifacts Sign returns have a signature, like sign.CheckSignedStructure
 	GoogleDockerBuildProject string
 	GoogleDockerBuildTrigger string
-	CloudBuildClient         task.CloudBuildClient
 	ApproveAction            func(*wf.TaskContext) error
 }
 
 func (b *BuildReleaseTasks) buildSource(ctx *wf.TaskContext, distpack bool, revision, securityRevision, versionFile string) (artifact, error) {
-	url := b.GerritURL
-	rev := revision
-	if securityRevision != "" {
-		url = b.PrivateGerritURL
-		rev = securityRevision
-	}
 	if distpack {
 		return b.runBuildStep(ctx, nil, dashboard.Builders["linux-amd64"], artifact{}, "src.tar.gz", func(bs *task.BuildletStep, _ io.Reader, w io.Writer) error {
-			return bs.BuildSourceDistpack(ctx, b.GerritHTTPClient, url, rev, versionFile, w)
+			src, err := b.sourceTarball(ctx, revision, securityRevision)
+			if err != nil {
+				return err
+			}
+			defer src.Close()
+			return bs.BuildSourceDistpack(ctx, src, versionFile, w)
 		})
 	}
 	return b.runBuildStep(ctx, nil, nil, artifact{}, "src.tar.gz", func(_ *task.BuildletStep, _ io.Reader, w io.Writer) error {
-		return task.WriteSourceArchive(ctx, b.GerritHTTPClient, url, rev, versionFile, w)
+		src, err := b.sourceTarball(ctx, revision, securityRevision)
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+		return task.WriteSourceArchive(ctx, src, versionFile, w)
 	})
 }
 
+// sourceTarball returns a gzip-compressed tarball of the go repository
+// at revision, or of the private repository at securityRevision if set.
+// Private sources are never cached, so that they can't leak before
+// the security release is public.
+func (b *BuildReleaseTasks) sourceTarball(ctx *wf.TaskContext, revision, securityRevision string) (io.ReadCloser, error) {
+	url, rev := b.GerritURL, revision
+	if securityRevision != "" {
+		url, rev = b.PrivateGerritURL, securityRevision
+	} else if b.SourceCache != nil {
+		ctx.Printf("Fetching source at %v from the source cache.", rev)
+		src, err := b.SourceCache.GetSourceTgz(ctx, nil, "go", rev)
+		if err != nil {
+			return nil, err
+		}
+		return io.NopCloser(src), nil
+	}
+	tarURL := url + "/+archive/" + rev + ".tar.gz"
+	ctx.Printf("Fetching source from %v.", tarURL)
+	req, err := http.NewRequestWithContext(ctx, "GET", tarURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := b.GerritHTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("failed to fetch %q: %v", tarURL, resp.Status)
+	}
+	return resp.Body, nil
+}
+
 func (b *BuildReleaseTasks) checkSourceMatch(ctx *wf.TaskContext, distpack bool, branch, versionFile string, source artifact) (head string, _ error) {
-	head, err := b.GerritClient.ReadBranchHead(ctx, "go", branch)
+	head, err := b.Gerrit.ReadBranchHead(ctx, "go", branch)
 	if err != nil {
 		return "", err
 	}
@@ -794,7 +989,7 @@ func (b *BuildReleaseTasks) mergeSignedToTGZ(ctx *wf.TaskContext, unsigned, sign
 		signedBinaries, err := loadBinaries(ctx, signed)
 
 		// Copy files from the tgz, overwriting with binaries from the signed tar.
-		scratchFS, err := gcsfs.FromURL(ctx, b.GCSClient, b.ScratchURL)
+		scratchFS, err := b.Storage.FS(ctx, b.ScratchURL)
 		if err != nil {
 			return err
 		}
@@ -852,7 +1047,7 @@ func (b *BuildReleaseTasks) mergeSignedToModule(ctx *wf.TaskContext, version str
 		signedBinaries, err := loadBinaries(ctx, signed)
 
 		// Copy files from the module zip, overwriting with binaries from the signed tar.
-		scratchFS, err := gcsfs.FromURL(ctx, b.GCSClient, b.ScratchURL)
+		scratchFS, err := b.Storage.FS(ctx, b.ScratchURL)
 		if err != nil {
 			return err
 		}
@@ -1021,7 +1216,7 @@ func (b *BuildReleaseTasks) computeGPG(ctx *wf.TaskContext, artifacts []artifact
 	}
 
 	// Set the artifacts' GPGSignature field.
-	scratchFS, err := gcsfs.FromURL(ctx, b.GCSClient, b.ScratchURL)
+	scratchFS, err := b.Storage.FS(ctx, b.ScratchURL)
 	if err != nil {
 		return nil, err
 	}
@@ -1034,6 +1229,9 @@ func (b *BuildReleaseTasks) computeGPG(ctx *wf.TaskContext, artifacts []artifact
 		if !ok {
 			return nil, fmt.Errorf("no GPG signature for %q", path.Base(a.ScratchPath))
 		}
+		if err := b.checkSigned(ctx, scratchFS, sigPath, sign.BuildGPG); err != nil {
+			return nil, err
+		}
 		sig, err := fs.ReadFile(scratchFS, sigPath)
 		if err != nil {
 			return nil, err
@@ -1059,10 +1257,13 @@ func (b *BuildReleaseTasks) signArtifact(ctx *wf.TaskContext, a artifact, bt sig
 	if !ok {
 		return artifact{}, fmt.Errorf("got signed URL %q outside of scratch space %q, which is unsupported", signedURL[0], b.ScratchURL+"/")
 	}
-	scratchFS, err := gcsfs.FromURL(ctx, b.GCSClient, b.ScratchURL)
+	scratchFS, err := b.Storage.FS(ctx, b.ScratchURL)
 	if err != nil {
 		return artifact{}, err
 	}
+	if err := b.checkSigned(ctx, scratchFS, a.ScratchPath, bt); err != nil {
+		return artifact{}, err
+	}
 
 	// Update the Size and SHA256 fields.
 	f, err := scratchFS.Open(a.ScratchPath)
@@ -1088,49 +1289,25 @@ func (b *BuildReleaseTasks) signArtifact(ctx *wf.TaskContext, a artifact, bt sig
 // signArtifacts starts signing on the artifacts provided via the gs:// URL inputs,
 // waits for signing to complete, and returns the gs:// URLs of the signed outputs.
 func (b *BuildReleaseTasks) signArtifacts(ctx *wf.TaskContext, bt sign.BuildType, inURLs []string) (outURLs []string, _ error) {
-	jobID, err := b.SignService.SignArtifact(ctx, bt, inURLs)
+	return task.SignArtifacts(ctx, b.Sign, bt, inURLs)
+}
+
+// checkSigned checks the signed artifact at scratchPath in scratchFS
+// with b.CheckSigned, if set.
+func (b *BuildReleaseTasks) checkSigned(ctx *wf.TaskContext, scratchFS fs.FS, scratchPath string, bt sign.BuildType) error {
+	if b.CheckSigned == nil {
+		return nil
+	}
+	f, err := scratchFS.Open(scratchPath)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	outURLs, jobError := task.AwaitCondition(ctx, time.Minute, func() (out []string, done bool, _ error) {
-		statusContext, cancel := context.WithTimeout(ctx, time.Minute)
-		defer cancel()
-		t := time.Now()
-		status, desc, out, err := b.SignService.ArtifactSigningStatus(statusContext, jobID)
-		if err != nil {
-			ctx.Printf("ArtifactSigningStatus ran into a retryable communication error after %v: %v\n", time.Since(t), err)
-			return nil, false, nil
-		}
-		switch status {
-		case sign.StatusCompleted:
-			return out, true, nil // All done.
-		case sign.StatusFailed:
-			if desc != "" {
-				return nil, true, fmt.Errorf("signing attempt failed: %s", desc)
-			}
-			return nil, true, fmt.Errorf("signing attempt failed")
-		default:
-			if desc != "" {
-				ctx.Printf("still waiting: %s\n", desc)
-			}
-			return nil, false, nil // Still waiting.
-		}
-	})
-	if jobError != nil {
-		// If ctx is canceled, also cancel the signing request.
-		if ctx.Err() != nil {
-			cancelContext, cancel := context.WithTimeout(context.Background(), time.Minute)
-			defer cancel()
-			t := time.Now()
-			err := b.SignService.CancelSigning(cancelContext, jobID)
-			if err != nil {
-				ctx.Printf("CancelSigning error after %v: %v\n", time.Since(t), err)
-			}
-		}
-
-		return nil, jobError
+	defer f.Close()
+	if err := b.CheckSigned(bt, f); err != nil {
+		return fmt.Errorf("signed artifact %s: %v", path.Base(scratchPath), err)
 	}
-	return outURLs, nil
+	ctx.Log(wf.LevelInfo, "signed artifact has a signature", "type", bt, "artifact", path.Base(scratchPath))
+	return nil
 }
 
 func (b *BuildReleaseTasks) runTests(ctx *wf.TaskContext, build *dashboard.BuildConfig, skipTests []string, binary artifact) error {
@@ -1230,7 +1407,7 @@ func (b *BuildReleaseTasks) runBuildStep(
 		ctx.Printf("Buildlet ready.")
 	}
 
-	scratchFS, err := gcsfs.FromURL(ctx, b.GCSClient, b.ScratchURL)
+	scratchFS, err := b.Storage.FS(ctx, b.ScratchURL)
 	if err != nil {
 		return artifact{}, err
 	}
@@ -1318,11 +1495,11 @@ func (w *sizeWriter) Write(p []byte) (n int, err error) {
 }
 
 func (tasks *BuildReleaseTasks) uploadArtifacts(ctx *wf.TaskContext, artifacts []artifact) error {
-	scratchFS, err := gcsfs.FromURL(ctx, tasks.GCSClient, tasks.ScratchURL)
+	scratchFS, err := tasks.Storage.FS(ctx, tasks.ScratchURL)
 	if err != nil {
 		return err
 	}
-	servingFS, err := gcsfs.FromURL(ctx, tasks.GCSClient, tasks.ServingURL)
+	servingFS, err := tasks.Storage.FS(ctx, tasks.ServingURL)
 	if err != nil {
 		return err
 	}
@@ -1351,11 +1528,11 @@ func (tasks *BuildReleaseTasks) uploadArtifacts(ctx *wf.TaskContext, artifacts [
 }
 
 func (tasks *BuildReleaseTasks) uploadModules(ctx *wf.TaskContext, version string, modules []moduleArtifact) error {
-	scratchFS, err := gcsfs.FromURL(ctx, tasks.GCSClient, tasks.ScratchURL)
+	scratchFS, err := tasks.Storage.FS(ctx, tasks.ScratchURL)
 	if err != nil {
 		return err
 	}
-	servingFS, err := gcsfs.FromURL(ctx, tasks.GCSClient, tasks.ServingURL)
+	servingFS, err := tasks.Storage.FS(ctx, tasks.ServingURL)
 	if err != nil {
 		return err
 	}
@@ -1435,6 +1612,11 @@ func uploadFile(scratchFS, servingFS fs.FS, scratch, filename string) error {
 	return nil
 }
 
+// publishArtifactsKey is the idempotency key of publishArtifacts.
+func publishArtifactsKey(version string, artifacts []artifact) string {
+	return "publish " + version
+}
+
 // publishArtifacts publishes artifacts for version (typically so they appear at https://go.dev/dl/).
 // It returns the Go version and files that have been successfully published.
 func (tasks *BuildReleaseTasks) publishArtifacts(ctx *wf.TaskContext, version string, artifacts []artifact) (task.Published, error) {
@@ -1463,13 +1645,23 @@ func (tasks *BuildReleaseTasks) publishArtifacts(ctx *wf.TaskContext, version st
 		case "msi", "pkg":
 			f.Kind = "installer"
 		}
+		files[i] = f
+	}
+
+	// Log their checksums, so that their publication can be verified.
+	if tasks.LogFiles != nil {
+		if err := tasks.LogFiles(ctx, files); err != nil {
+			return task.Published{}, err
+		}
+		ctx.Printf("Logged the checksums of all %d files for %s.", len(files), version)
+	}
 
-		// Publish it.
+	// Publish them.
+	for _, f := range files {
 		if err := tasks.PublishFile(f); err != nil {
 			return task.Published{}, err
 		}
 		ctx.Printf("Published %q.", f.Filename)
-		files[i] = f
 	}
 	ctx.Printf("Published all %d files for %s.", len(files), version)
 	return task.Published{Version: version, Files: files}, nil
@@ -1478,12 +1670,12 @@ func (tasks *BuildReleaseTasks) publishArtifacts(ctx *wf.TaskContext, version st
 func (b *BuildReleaseTasks) runGoogleDockerBuild(ctx context.Context, version string) (string, error) {
 	// Because we want to publish versions without the leading "go", it's easiest to strip it here.
 	v := strings.TrimPrefix(version, "go")
-	return b.CloudBuildClient.RunBuildTrigger(ctx, b.GoogleDockerBuildProject, b.GoogleDockerBuildTrigger, map[string]string{"_GO_VERSION": v})
+	return b.CloudBuild.RunBuildTrigger(ctx, b.GoogleDockerBuildProject, b.GoogleDockerBuildTrigger, map[string]string{"_GO_VERSION": v})
 }
 
 func (b *BuildReleaseTasks) awaitCloudBuild(ctx *wf.TaskContext, id string) (string, error) {
 	detail, err := task.AwaitCondition(ctx, 30*time.Second, func() (string, bool, error) {
-		return b.CloudBuildClient.Completed(ctx, b.GoogleDockerBuildProject, id)
+		return b.CloudBuild.Completed(ctx, b.GoogleDockerBuildProject, id)
 	})
 	return detail, err
 }
@@ -108,6 +108,51 @@ func TestAwaitFunc(t *testing.T) {
 	}
 }
 
+func TestDefinitionHolderNamespaces(t *testing.T) {
+	h := NewDefinitionHolder()
+	h.RegisterNamespacedDefinition(ReleaseNamespace, "release", newEchoWorkflow())
+	h.RegisterNamespace(Namespace{Name: XReposNamespace, Title: "x/ Repos", Members: []string{"gopher@example.com"}})
+	h.RegisterNamespacedDefinition(XReposNamespace, "tag", newEchoWorkflow())
+
+	for name, want := range map[string]string{"echo": DefaultNamespace, "release": ReleaseNamespace, "tag": XReposNamespace, "missing": ""} {
+		if got := h.DefinitionNamespace(name); got != want {
+			t.Errorf("DefinitionNamespace(%q) = %q, wanted %q", name, got, want)
+		}
+	}
+	var got []string
+	for name := range h.NamespaceDefinitions(XReposNamespace) {
+		got = append(got, name)
+	}
+	if diff := cmp.Diff([]string{"tag"}, got); diff != "" {
+		t.Errorf("NamespaceDefinitions(%q) mismatch (-want +got):\n%s", XReposNamespace, diff)
+	}
+	var names []string
+	for _, ns := range h.Namespaces() {
+		names = append(names, ns.Name)
+	}
+	if diff := cmp.Diff([]string{DefaultNamespace, ReleaseNamespace, XReposNamespace}, names); diff != "" {
+		t.Errorf("Namespaces() mismatch (-want +got):\n%s", diff)
+	}
+
+	ns := h.Namespace(XReposNamespace)
+	if ns.DisplayName() != "x/ Repos" || !ns.Allows("gopher@example.com") || ns.Allows("other@example.com") {
+		t.Errorf("Namespace(%q) = %+v, wanted title %q and only member gopher@example.com", XReposNamespace, ns, "x/ Repos")
+	}
+	if ns := h.Namespace(ReleaseNamespace); ns.DisplayName() != ReleaseNamespace || !ns.Allows("other@example.com") {
+		t.Errorf("Namespace(%q) = %+v, wanted no title and no members", ReleaseNamespace, ns)
+	}
+	if ns := h.Namespace("missing"); ns != nil {
+		t.Errorf("Namespace(%q) = %+v, wanted nil", "missing", ns)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("RegisterNamespacedDefinition of a name in another namespace didn't panic")
+		}
+	}()
+	h.RegisterNamespacedDefinition(InfraNamespace, "tag", newEchoWorkflow())
+}
+
 func TestCheckTaskApproved(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -10,6 +10,8 @@ import (
 	"flag"
 	"fmt"
 	"strings"
+	"sync"
+	"time"
 
 	"cloud.google.com/go/compute/metadata"
 	secretmanager "cloud.google.com/go/secretmanager/apiv1"
@@ -47,19 +49,84 @@ func (r *FlagResolver) FlagVar(set *flag.FlagSet, p *string, name, usage string)
 	})
 }
 
-func (r *FlagResolver) resolveSecret(flagValue string) (string, error) {
-	if r.Client == nil || r.Context == nil {
-		return "", fmt.Errorf("secret resolver was not initialized")
+// WatchedFlag defines a string flag on set that will be resolved using r,
+// like Flag. If the flag names a secret, the returned Value can follow
+// its rotations; see Value.Watch.
+func (r *FlagResolver) WatchedFlag(set *flag.FlagSet, name, usage string) *Value {
+	v := new(Value)
+	suffixedUsage := usage + "\n" + secretSuffix
+	set.Func(name, suffixedUsage, func(flagValue string) error {
+		value, err := r.resolveSecret(flagValue)
+		if err != nil {
+			return err
+		}
+		v.mu.Lock()
+		defer v.mu.Unlock()
+		v.value = value
+		v.client, v.name = nil, ""
+		if projectID, secretName, ok := r.secretName(flagValue); ok {
+			v.client = &Client{client: r.Client, projectID: projectID}
+			v.name = secretName
+		}
+		return nil
+	})
+	return v
+}
+
+// A Value is the value of a flag defined with WatchedFlag.
+type Value struct {
+	mu     sync.Mutex
+	value  string
+	client *Client // of the secret's project, if the flag named a secret
+	name   string  // of the secret
+}
+
+// Get returns the current value of the flag.
+func (v *Value) Get() string {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.value
+}
+
+// Watch updates the value of the flag each time the secret it names is
+// rotated, checking for rotations every interval until ctx is done. If
+// the flag doesn't name a secret, Watch does nothing.
+func (v *Value) Watch(ctx context.Context, interval time.Duration) error {
+	v.mu.Lock()
+	client, name := v.client, v.name
+	v.mu.Unlock()
+	if client == nil {
+		return nil
 	}
+	return NewCache(client, interval).Watch(ctx, name, func(value string) {
+		v.mu.Lock()
+		defer v.mu.Unlock()
+		v.value = value
+	})
+}
+
+// secretName returns the project and name of the secret that flagValue
+// refers to, if any.
+func (r *FlagResolver) secretName(flagValue string) (projectID, secretName string, ok bool) {
 	if !strings.HasPrefix(flagValue, "secret:") {
-		return flagValue, nil
+		return "", "", false
 	}
-
-	secretName := strings.TrimPrefix(flagValue, "secret:")
-	projectID := r.DefaultProjectID
+	secretName = strings.TrimPrefix(flagValue, "secret:")
+	projectID = r.DefaultProjectID
 	if parts := strings.SplitN(secretName, "/", 2); len(parts) == 2 {
 		projectID, secretName = parts[0], parts[1]
 	}
+	return projectID, secretName, true
+}
+
+func (r *FlagResolver) resolveSecret(flagValue string) (string, error) {
+	if r.Client == nil || r.Context == nil {
+		return "", fmt.Errorf("secret resolver was not initialized")
+	}
+	projectID, secretName, ok := r.secretName(flagValue)
+	if !ok {
+		return flagValue, nil
+	}
 	if projectID == "" {
 		return "", fmt.Errorf("missing project ID: none specified in %q, and no default set (not on GCP?)", secretName)
 	}
@@ -102,6 +169,12 @@ func FlagVar(p *string, name, usage string) {
 	DefaultResolver.FlagVar(flag.CommandLine, p, name, usage)
 }
 
+// WatchedFlag defines a string flag on flag.CommandLine like Flag, whose
+// value can follow the rotations of the secret it names.
+func WatchedFlag(name, usage string) *Value {
+	return DefaultResolver.WatchedFlag(flag.CommandLine, name, usage)
+}
+
 // JSONVarFlag defines a flag on flag.CommandLine that behaves like Flag
 // and then json.Unmarshals the resulting string into value.
 func JSONVarFlag(value interface{}, name, usage string) {
@@ -23,6 +23,21 @@ const (
 	// NameBuilderMasterKey is the secret name for the builder master key.
 	NameBuilderMasterKey = "builder-master-key"
 
+	// NameBuildletCACert is the secret name for the PEM-encoded root
+	// certificate of the certificate authority of buildlets' TLS
+	// certificates.
+	NameBuildletCACert = "buildlet-ca-cert"
+
+	// NameBuildletCAIntermediateCert is the secret name for the
+	// PEM-encoded intermediate certificate, signed by the root, that
+	// the certificate authority of buildlets' TLS certificates signs
+	// with. The root's private key is kept offline.
+	NameBuildletCAIntermediateCert = "buildlet-ca-intermediate-cert"
+
+	// NameBuildletCAIntermediateKey is the secret name for the
+	// PEM-encoded private key of the intermediate certificate.
+	NameBuildletCAIntermediateKey = "buildlet-ca-intermediate-private-key"
+
 	// NameFarmerRunBench is the secret name for farmer run bench.
 	NameFarmerRunBench = "farmer-run-bench"
 
@@ -50,9 +65,18 @@ const (
 	// NameGomoteSSHPublicKey is the secret name for the gomote SSH public key.
 	NameGomoteSSHPublicKey = "gomote-ssh-public-key"
 
+	// NameGomoteSSHTranscriptKey is the secret name for the base64-encoded
+	// AES-256 key that gomote SSH session transcripts are encrypted with.
+	NameGomoteSSHTranscriptKey = "gomote-ssh-transcript-key"
+
 	// NameMaintnerGitHubToken is the secret name for the Maintner GitHub token.
 	NameMaintnerGitHubToken = "maintner-github-token"
 
+	// NameGitHubChecksAppKey is the secret name for the PEM-encoded
+	// private key of the GitHub App that reports TryBot results as
+	// GitHub check runs.
+	NameGitHubChecksAppKey = "github-checks-app-private-key"
+
 	// NameGitHubWebhookSecret is the secret name for a golang/go GitHub webhook secret.
 	NameGitHubWebhookSecret = "github-webhook-secret"
 
@@ -0,0 +1,167 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package secret
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	secretmanagerpb "google.golang.org/genproto/googleapis/cloud/secretmanager/v1"
+)
+
+// Cache retrieves secrets through a Client and holds on to their
+// values for a while, so that services can look up secrets often, and
+// pick up rotated secrets without restarting, without a Secret Manager
+// request each time.
+type Cache struct {
+	client *Client
+	ttl    time.Duration
+
+	mu          sync.Mutex
+	entries     map[string]*cacheEntry
+	nextWatcher int // ID of the next watcher
+}
+
+// A cacheEntry is the last retrieved version of a secret.
+type cacheEntry struct {
+	known     bool // whether value and version were retrieved
+	value     string
+	version   string    // resource name of the version, if known
+	retrieved time.Time // zero until retrieved
+	err       error     // of the last retrieval, if it failed
+
+	// watchers are called when the secret changes, by ID.
+	watchers map[int]func(value string)
+}
+
+// NewCache returns a Cache of the secrets retrieved through c, which
+// holds their values for ttl, which must be positive.
+func NewCache(c *Client, ttl time.Duration) *Cache {
+	if ttl <= 0 {
+		panic("secret: non-positive cache TTL")
+	}
+	return &Cache{
+		client:  c,
+		ttl:     ttl,
+		entries: make(map[string]*cacheEntry),
+	}
+}
+
+// Retrieve returns the named secret like Client.Retrieve, but only
+// retrieves it from the Secret Management service if it hasn't in the
+// last ttl. If the secret changed since it was last retrieved, the
+// watchers of the secret are called before Retrieve returns.
+func (c *Cache) Retrieve(ctx context.Context, name string) (string, error) {
+	c.mu.Lock()
+	e := c.entries[name]
+	if e == nil {
+		e = new(cacheEntry)
+		c.entries[name] = e
+	}
+	if !e.retrieved.IsZero() && time.Since(e.retrieved) < c.ttl {
+		value, err := e.value, e.err
+		c.mu.Unlock()
+		return value, err
+	}
+	c.mu.Unlock()
+	return c.refresh(ctx, name)
+}
+
+// refresh retrieves the named secret from the Secret Management service
+// and updates its cache entry, calling its watchers if it changed.
+func (c *Cache) refresh(ctx context.Context, name string) (string, error) {
+	r, err := c.client.client.AccessSecretVersion(ctx, &secretmanagerpb.AccessSecretVersionRequest{
+		Name: buildNamePath(c.client.projectID, name, "latest"),
+	})
+
+	c.mu.Lock()
+	e := c.entries[name]
+	e.retrieved = time.Now()
+	e.err = err
+	if err != nil {
+		// Keep the last good value, but report the error until the
+		// next retrieval.
+		c.mu.Unlock()
+		return "", err
+	}
+	value, version := string(r.Payload.GetData()), r.GetName()
+	changed := e.known && (e.version != version || e.value != value)
+	e.known, e.value, e.version = true, value, version
+	var watchers []func(string)
+	if changed {
+		for _, fn := range e.watchers {
+			watchers = append(watchers, fn)
+		}
+	}
+	c.mu.Unlock()
+
+	for _, fn := range watchers {
+		fn(value)
+	}
+	return value, nil
+}
+
+// Watch calls fn with the value of the named secret, and then with its
+// new value each time it changes, until ctx is done. The secret is
+// checked for changes every ttl, and whenever Retrieve retrieves it.
+// Calls of fn for a secret are never concurrent.
+//
+// Watch returns once fn has been called with the current value, or
+// with an error if it couldn't be retrieved. Later errors retrieving
+// the secret are logged, and the secret is checked again after ttl.
+func (c *Cache) Watch(ctx context.Context, name string, fn func(value string)) error {
+	if _, err := c.Retrieve(ctx, name); err != nil {
+		return err
+	}
+
+	// Serialize the calls of fn, which may come from Retrieve as
+	// well as from the polling goroutine. Holding fnMu until fn is
+	// called with the current value keeps changes from being
+	// reported before it.
+	var fnMu sync.Mutex
+	watcher := func(value string) {
+		fnMu.Lock()
+		defer fnMu.Unlock()
+		if ctx.Err() == nil {
+			fn(value)
+		}
+	}
+	fnMu.Lock()
+	c.mu.Lock()
+	e := c.entries[name]
+	if e.watchers == nil {
+		e.watchers = make(map[int]func(string))
+	}
+	id := c.nextWatcher
+	c.nextWatcher++
+	e.watchers[id] = watcher
+	value := e.value
+	c.mu.Unlock()
+	fn(value)
+	fnMu.Unlock()
+
+	go func() {
+		defer func() {
+			c.mu.Lock()
+			delete(e.watchers, id)
+			c.mu.Unlock()
+		}()
+		t := time.NewTicker(c.ttl)
+		defer t.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+			}
+			if _, err := c.Retrieve(ctx, name); err != nil && ctx.Err() == nil {
+				log.Printf("secret: checking secret %q for changes: %v", name, err)
+			}
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,158 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package secret
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	gax "github.com/googleapis/gax-go/v2"
+	secretmanagerpb "google.golang.org/genproto/googleapis/cloud/secretmanager/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// rotatingSecretClient is a secretClient with one secret, which can be
+// rotated to a new version.
+type rotatingSecretClient struct {
+	mu       sync.Mutex
+	versions []string
+	accesses int
+}
+
+func (c *rotatingSecretClient) AccessSecretVersion(ctx context.Context, req *secretmanagerpb.AccessSecretVersionRequest, opts ...gax.CallOption) (*secretmanagerpb.AccessSecretVersionResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.accesses++
+	if req.GetName() != buildNamePath("project", "token", "latest") {
+		return nil, status.Error(codes.NotFound, "secret not found")
+	}
+	return &secretmanagerpb.AccessSecretVersionResponse{
+		Name: buildNamePath("project", "token", fmt.Sprint(len(c.versions))),
+		Payload: &secretmanagerpb.SecretPayload{
+			Data: []byte(c.versions[len(c.versions)-1]),
+		},
+	}, nil
+}
+
+func (c *rotatingSecretClient) Close() error { return nil }
+
+func (c *rotatingSecretClient) rotate(value string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.versions = append(c.versions, value)
+}
+
+func (c *rotatingSecretClient) accessCount() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.accesses
+}
+
+func TestCacheRetrieve(t *testing.T) {
+	fake := &rotatingSecretClient{versions: []string{"v1"}}
+	cache := NewCache(&Client{client: fake, projectID: "project"}, time.Hour)
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		if got, err := cache.Retrieve(ctx, "token"); got != "v1" || err != nil {
+			t.Fatalf("Retrieve(token) = %q, %v; want v1", got, err)
+		}
+	}
+	if n := fake.accessCount(); n != 1 {
+		t.Errorf("secret accessed %d times; want once within the TTL", n)
+	}
+	if _, err := cache.Retrieve(ctx, "other"); status.Code(err) != codes.NotFound {
+		t.Errorf("Retrieve(other) error = %v; want NotFound", err)
+	}
+}
+
+func TestCacheWatch(t *testing.T) {
+	fake := &rotatingSecretClient{versions: []string{"v1"}}
+	cache := NewCache(&Client{client: fake, projectID: "project"}, 10*time.Millisecond)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	values := make(chan string, 10)
+	if err := cache.Watch(ctx, "token", func(v string) { values <- v }); err != nil {
+		t.Fatal(err)
+	}
+	next := func() string {
+		t.Helper()
+		select {
+		case v := <-values:
+			return v
+		case <-time.After(10 * time.Second):
+			t.Fatalf("watcher not called")
+			return ""
+		}
+	}
+	if v := next(); v != "v1" {
+		t.Errorf("first value = %q; want v1", v)
+	}
+	fake.rotate("v2")
+	if v := next(); v != "v2" {
+		t.Errorf("value after rotation = %q; want v2", v)
+	}
+
+	// Unchanged secrets aren't reported again.
+	time.Sleep(50 * time.Millisecond)
+	select {
+	case v := <-values:
+		t.Errorf("watcher called with %q without a change", v)
+	default:
+	}
+
+	// Watchers aren't called once their context is done.
+	cancel()
+	fake.rotate("v3")
+	time.Sleep(50 * time.Millisecond)
+	if got, err := cache.Retrieve(context.Background(), "token"); got != "v3" || err != nil {
+		t.Errorf("Retrieve(token) = %q, %v; want v3", got, err)
+	}
+	select {
+	case v := <-values:
+		t.Errorf("watcher called with %q after its context was done", v)
+	default:
+	}
+
+	if err := cache.Watch(context.Background(), "other", func(string) {}); err == nil {
+		t.Errorf("Watch of a missing secret succeeded; want error")
+	}
+}
+
+func TestWatchedFlag(t *testing.T) {
+	fake := &rotatingSecretClient{versions: []string{"v1"}}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	r := &FlagResolver{Context: ctx, Client: fake, DefaultProjectID: "project"}
+	set := flag.NewFlagSet("test", flag.ContinueOnError)
+	plain := r.WatchedFlag(set, "plain", "")
+	token := r.WatchedFlag(set, "token", "")
+	if err := set.Parse([]string{"-plain=value", "-token=secret:token"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := plain.Watch(ctx, time.Millisecond); err != nil {
+		t.Errorf("Watch of a plain flag: %v", err)
+	}
+	if err := token.Watch(ctx, 10*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if got := token.Get(); got != "v1" {
+		t.Errorf("token = %q; want v1", got)
+	}
+	fake.rotate("v2")
+	for deadline := time.Now().Add(10 * time.Second); token.Get() != "v2"; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("token = %q after rotation; want v2", token.Get())
+		}
+	}
+	if got := plain.Get(); got != "value" {
+		t.Errorf("plain = %q; want value", got)
+	}
+}
@@ -0,0 +1,64 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sourcecache
+
+import (
+	"context"
+	"time"
+
+	"go.opencensus.io/plugin/ochttp"
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+)
+
+// Layers of a Cache, besides its stores and origins, for metrics.
+const (
+	layerMemory = "memory"
+	layerShared = "shared" // joined a concurrent call
+)
+
+var (
+	kRepo         = tag.MustNewKey("go-build/sourcecache/keys/repo")
+	kLayer        = tag.MustNewKey("go-build/sourcecache/keys/layer")
+	mGets         = stats.Int64("go-build/sourcecache/get_count", "number of source tarballs gotten, by the layer that had them", stats.UnitDimensionless)
+	mFetchLatency = stats.Float64("go-build/sourcecache/fetch_latency", "latency of fetching source tarballs from an origin", stats.UnitMilliseconds)
+)
+
+// Views contains the views of the metrics recorded by Caches.
+// Programs that export metrics should register them.
+var Views = []*view.View{
+	{
+		Name:        "go-build/sourcecache/get_count",
+		Description: "Count of source tarballs gotten, by the layer of the cache that had them",
+		Measure:     mGets,
+		TagKeys:     []tag.Key{kRepo, kLayer},
+		Aggregation: view.Count(),
+	},
+	{
+		Name:        "go-build/sourcecache/fetch_latency",
+		Description: "Latency distribution of fetching source tarballs from an origin",
+		Measure:     mFetchLatency,
+		TagKeys:     []tag.Key{kLayer},
+		Aggregation: ochttp.DefaultLatencyDistribution,
+	},
+}
+
+// recordGet records that a tarball of repo was gotten from layer, the
+// name of a store or origin, or layerMemory or layerShared.
+func recordGet(repo, layer string) {
+	stats.RecordWithTags(context.Background(),
+		[]tag.Mutator{tag.Upsert(kRepo, repo), tag.Upsert(kLayer, layer)},
+		mGets.M(1))
+}
+
+// recordFetch records that a tarball of repo was fetched from origin
+// in d.
+func recordFetch(repo, origin string, d time.Duration) {
+	recordGet(repo, origin)
+	stats.RecordWithTags(context.Background(),
+		[]tag.Mutator{tag.Upsert(kLayer, origin)},
+		mFetchLatency.M(float64(d)/float64(time.Millisecond)))
+}
@@ -3,8 +3,13 @@
 // license that can be found in the LICENSE file.
 
 // Package sourcecache provides a cache of code found in Git repositories.
-// It takes directly to the Gerrit instance at go.googlesource.com.
-// If RegisterGitMirrorDial is called, it will first try to get code from gitmirror before falling back on Gerrit.
+//
+// A Cache looks for source tarballs in memory, then in its persistent
+// stores, such as a directory on local disk and a GCS bucket, then
+// fetches them from its origins, such as gitmirror and the Gerrit
+// instance at go.googlesource.com. Concurrent requests for the same
+// tarball share one fetch, so that the components that use a Cache
+// don't each fetch the same revision of a large repository.
 package sourcecache
 
 import (
@@ -13,74 +18,235 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"io/ioutil"
 	"log"
 	"net"
 	"net/http"
+	"regexp"
+	"strings"
 	"time"
 
+	"cloud.google.com/go/storage"
+	"golang.org/x/build/internal/gcsfs"
 	"golang.org/x/build/internal/lru"
 	"golang.org/x/build/internal/singleflight"
 	"golang.org/x/build/internal/spanlog"
 )
 
-var processStartTime = time.Now()
+// A Cache is a cache of source tarballs of Git repositories.
+// It is safe for concurrent use.
+type Cache struct {
+	stores  []Store
+	origins []Origin
+	group   singleflight.Group
+	memory  *lru.Cache // repo-rev -> source
+}
 
-var sourceGroup singleflight.Group
+// Options configure a Cache.
+type Options struct {
+	// MemoryEntries is the number of tarballs kept in memory.
+	// If zero, 40 are kept.
+	MemoryEntries int
+	// Stores are the persistent layers of the cache, fastest first.
+	// Tarballs missing from a store are written to it if it's a
+	// gcsfs.CreateFS.
+	Stores []Store
+	// Origins are where tarballs that aren't cached are fetched from,
+	// in the order they're tried. If empty, they're fetched from the
+	// Gerrit instance at go.googlesource.com.
+	Origins []Origin
+}
+
+// A Store is a persistent layer of a Cache.
+type Store struct {
+	Name string // for logs and metrics, like "disk" or "gcs"
+	FS   fs.FS  // see gcsfs.FromURL
 
-var sourceCache = lru.New(40) // repo-rev -> source
+	// WriteOnly stores are filled with the tarballs the Cache
+	// fetches from its origins, but never read from. Components that
+	// must not trust tarballs that other writers of a store may have
+	// put there, like relui building release sources, use them.
+	WriteOnly bool
+}
+
+// NewStore returns a Store for a file:// URL, naming a directory on
+// local disk, or a gs:// URL, naming a GCS bucket and optional prefix.
+// client is only used for gs:// URLs and can be nil otherwise.
+func NewStore(ctx context.Context, client *storage.Client, url string) (Store, error) {
+	fsys, err := gcsfs.FromURL(ctx, client, url)
+	if err != nil {
+		return Store{}, err
+	}
+	name := "disk"
+	if strings.HasPrefix(url, "gs:") {
+		name = "gcs"
+	}
+	return Store{Name: name, FS: fsys}, nil
+}
 
-// source is the cache entry type for sourceCache.
+// An Origin is where a Cache fetches the tarballs it doesn't have.
+type Origin struct {
+	Name string // for logs and metrics, like "gerrit"
+	// Fetch returns a gzip-compressed tarball of repo at rev.
+	Fetch func(ctx context.Context, repo, rev string) (io.ReadCloser, error)
+}
+
+// New returns a new Cache.
+func New(opts Options) *Cache {
+	if opts.MemoryEntries == 0 {
+		opts.MemoryEntries = 40
+	}
+	if len(opts.Origins) == 0 {
+		opts.Origins = []Origin{GerritOrigin(gerritHTTPClient, "https://go.googlesource.com")}
+	}
+	return &Cache{
+		stores:  opts.Stores,
+		origins: opts.Origins,
+		memory:  lru.New(opts.MemoryEntries),
+	}
+}
+
+// source is the cache entry type for Cache.memory.
 type source struct {
 	Tgz    []byte // Source tarball bytes.
 	TooBig bool
 }
 
+// fetchTimeout bounds how long the fetch shared by concurrent calls to
+// GetSourceTgz may take. It isn't canceled along with any one of them.
+const fetchTimeout = 5 * time.Minute
+
 // GetSourceTgz returns a Reader that provides a tgz of the requested source revision.
 // repo is go.googlesource.com repo ("go", "net", and so on).
-// rev is git revision.
+// rev is git revision. Only revisions that are full commit hashes are
+// cached; others, like branch names, are fetched every time.
+// sl may be nil.
 //
 // An error of type TooBigError is returned if the compressed tarball exceeds a size that
 // on 2021-11-22 was deemed to be enough to meet expected legitimate future needs for a while.
 // See golang.org/issue/46379.
-func GetSourceTgz(sl spanlog.Logger, repo, rev string) (tgz io.Reader, err error) {
+func (c *Cache) GetSourceTgz(ctx context.Context, sl spanlog.Logger, repo, rev string) (tgz io.Reader, err error) {
+	if sl == nil {
+		sl = nopLogger{}
+	}
 	sp := sl.CreateSpan("get_source", repo+"@"+rev)
 	defer func() { sp.Done(err) }()
 
 	key := fmt.Sprintf("%v-%v", repo, rev)
-	v, err, _ := sourceGroup.Do(key, func() (interface{}, error) {
-		if src, ok := sourceCache.Get(key); ok {
-			return src, nil
+	var ran bool // whether this call, rather than a concurrent one, got the tarball
+	var res singleflight.Result
+	select {
+	case res = <-c.group.DoChan(key, func() (interface{}, error) {
+		ran = true
+		ctx, cancel := context.WithTimeout(context.Background(), fetchTimeout)
+		defer cancel()
+		return c.get(ctx, sl, repo, rev)
+	}):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if !ran {
+		recordGet(repo, layerShared)
+	}
+	if res.Err != nil {
+		return nil, res.Err
+	}
+	if res.Val.(source).TooBig {
+		return nil, TooBigError{Repo: repo, Rev: rev, Limit: maxSize(repo)}
+	}
+	return bytes.NewReader(res.Val.(source).Tgz), nil
+}
+
+// commitRx matches full Git commit hashes, the only revisions whose
+// content never changes.
+var commitRx = regexp.MustCompile(`^[0-9a-f]{40}$`)
+
+// get looks for the tarball of repo at rev in each layer of c in turn,
+// and adds it to the layers that didn't have it.
+func (c *Cache) get(ctx context.Context, sl spanlog.Logger, repo, rev string) (source, error) {
+	cacheable := commitRx.MatchString(rev)
+	key := fmt.Sprintf("%v-%v", repo, rev)
+	if cacheable {
+		if src, ok := c.memory.Get(key); ok {
+			recordGet(repo, layerMemory)
+			return src.(source), nil
 		}
+	}
 
-		if gitMirrorClient != nil {
-			sp := sl.CreateSpan("get_source_from_gitmirror")
-			src, err := getSourceTgzFromGitMirror(repo, rev)
-			if err == nil {
-				sourceCache.Add(key, src)
-				sp.Done(nil)
-				return src, nil
+	var missed []Store
+	if cacheable {
+		name := storeName(repo, rev)
+		for _, st := range c.stores {
+			if st.WriteOnly {
+				missed = append(missed, st)
+				continue
+			}
+			sp := sl.CreateSpan("get_source_from_"+st.Name, key)
+			tgz, err := fs.ReadFile(st.FS, name)
+			if err != nil {
+				if !errors.Is(err, fs.ErrNotExist) {
+					log.Printf("Error reading source %s/%s from %s store: %v", repo, rev, st.Name, err)
+				}
+				sp.Done(err)
+				missed = append(missed, st)
+				continue
 			}
-			log.Printf("Error fetching source %s/%s from gitmirror (after %v uptime): %v",
-				repo, rev, time.Since(processStartTime), err)
-			sp.Done(errors.New("timeout"))
+			sp.Done(nil)
+			recordGet(repo, st.Name)
+			src := source{Tgz: tgz}
+			c.memory.Add(key, src)
+			c.fill(missed, name, tgz)
+			return src, nil
 		}
+	}
 
-		sp := sl.CreateSpan("get_source_from_gerrit", fmt.Sprintf("%v from gerrit", key))
-		src, err := getSourceTgzFromGerrit(repo, rev)
+	var err error
+	for _, o := range c.origins {
+		sp := sl.CreateSpan("get_source_from_"+o.Name, fmt.Sprintf("%v from %v", key, o.Name))
+		t0 := time.Now()
+		var src source
+		src, err = fetch(ctx, o, repo, rev)
 		sp.Done(err)
-		if err == nil {
-			sourceCache.Add(key, src)
+		if err != nil {
+			log.Printf("Error fetching source %s/%s from %s (after %v uptime): %v",
+				repo, rev, o.Name, time.Since(processStartTime), err)
+			continue
 		}
-		return src, err
-	})
-	if err != nil {
-		return nil, err
+		recordFetch(repo, o.Name, time.Since(t0))
+		if cacheable {
+			c.memory.Add(key, src)
+			if !src.TooBig {
+				c.fill(missed, storeName(repo, rev), src.Tgz)
+			}
+		}
+		return src, nil
 	}
-	if v.(source).TooBig {
-		return nil, TooBigError{Repo: repo, Rev: rev, Limit: maxSize(repo)}
+	return source{}, err
+}
+
+var processStartTime = time.Now()
+
+// storeName returns the name of the tarball of repo at rev in a Store.
+func storeName(repo, rev string) string {
+	return repo + "/" + rev + ".tar.gz"
+}
+
+// fill writes the tarball tgz to stores, in the background.
+func (c *Cache) fill(stores []Store, name string, tgz []byte) {
+	for _, st := range stores {
+		if _, ok := st.FS.(gcsfs.CreateFS); !ok {
+			continue
+		}
+		go func(st Store) {
+			if _, err := fs.Stat(st.FS, name); st.WriteOnly && err == nil {
+				return
+			}
+			if err := gcsfs.WriteFile(st.FS, name, tgz); err != nil {
+				log.Printf("Error writing source %s to %s store: %v", name, st.Name, err)
+			}
+		}(st)
 	}
-	return bytes.NewReader(v.(source).Tgz), nil
 }
 
 // TooBigError is the error returned when the source revision is considered too big.
@@ -95,12 +261,25 @@ func (e TooBigError) Error() string {
 		e.Repo, e.Rev, e.Limit/1024/1024)
 }
 
-var gitMirrorClient *http.Client
+var gerritHTTPClient = &http.Client{
+	Timeout: 30 * time.Second,
+}
 
-// RegisterGitMirrorDial registers a dial function which will be used to reach gitmirror.
-// If used, this function must be called before GetSourceTgz.
-func RegisterGitMirrorDial(dial func(context.Context) (net.Conn, error)) {
-	gitMirrorClient = &http.Client{
+// GerritOrigin returns an Origin that fetches tarballs from the Gerrit
+// instance at baseURL, like "https://go.googlesource.com", using hc.
+func GerritOrigin(hc *http.Client, baseURL string) Origin {
+	return Origin{
+		Name: "gerrit",
+		Fetch: func(ctx context.Context, repo, rev string) (io.ReadCloser, error) {
+			return getURL(ctx, hc, baseURL+"/"+repo+"/+archive/"+rev+".tar.gz")
+		},
+	}
+}
+
+// GitMirrorOrigin returns an Origin that fetches tarballs from
+// gitmirror, reached with dial.
+func GitMirrorOrigin(dial func(context.Context) (net.Conn, error)) Origin {
+	hc := &http.Client{
 		Timeout: 30 * time.Second,
 		Transport: &http.Transport{
 			IdleConnTimeout: 30 * time.Second,
@@ -109,52 +288,58 @@ func RegisterGitMirrorDial(dial func(context.Context) (net.Conn, error)) {
 			},
 		},
 	}
-}
-
-var gerritHTTPClient = &http.Client{
-	Timeout: 30 * time.Second,
-}
-
-func getSourceTgzFromGerrit(repo, rev string) (source, error) {
-	return getSourceTgzFromURL(gerritHTTPClient, "gerrit", repo, rev, "https://go.googlesource.com/"+repo+"/+archive/"+rev+".tar.gz")
-}
-
-func getSourceTgzFromGitMirror(repo, rev string) (src source, err error) {
-	for i := 0; i < 2; i++ { // two tries; different pods maybe?
-		if i > 0 {
-			time.Sleep(1 * time.Second)
-		}
-		// The "gitmirror" hostname is unused:
-		src, err = getSourceTgzFromURL(gitMirrorClient, "gitmirror", repo, rev, "http://gitmirror/"+repo+".tar.gz?rev="+rev)
-		if err == nil {
-			return src, nil
-		}
-		if tr, ok := http.DefaultTransport.(*http.Transport); ok {
-			tr.CloseIdleConnections()
-		}
+	return Origin{
+		Name: "gitmirror",
+		Fetch: func(ctx context.Context, repo, rev string) (body io.ReadCloser, err error) {
+			for i := 0; i < 2; i++ { // two tries; different pods maybe?
+				if i > 0 {
+					time.Sleep(1 * time.Second)
+				}
+				// The "gitmirror" hostname is unused:
+				body, err = getURL(ctx, hc, "http://gitmirror/"+repo+".tar.gz?rev="+rev)
+				if err == nil {
+					return body, nil
+				}
+				hc.CloseIdleConnections()
+			}
+			return nil, err
+		},
 	}
-	return source{}, err
 }
 
-// getSourceTgzFromURL fetches a source tarball from url.
-// If url serves more than maxSize bytes, it stops short.
-func getSourceTgzFromURL(hc *http.Client, service, repo, rev, url string) (source, error) {
-	res, err := hc.Get(url)
+// getURL returns the body of a successful GET of url.
+func getURL(ctx context.Context, hc *http.Client, url string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := hc.Do(req)
 	if err != nil {
-		return source{}, fmt.Errorf("fetching %s/%s from %s: %v", repo, rev, service, err)
+		return nil, err
 	}
-	defer res.Body.Close()
 	if res.StatusCode/100 != 2 {
 		slurp, _ := ioutil.ReadAll(io.LimitReader(res.Body, 4<<10))
-		return source{}, fmt.Errorf("fetching %s/%s from %s: %v; body: %s", repo, rev, service, res.Status, slurp)
+		res.Body.Close()
+		return nil, fmt.Errorf("%v; body: %s", res.Status, slurp)
+	}
+	return res.Body, nil
+}
+
+// fetch fetches a source tarball from o.
+// If o serves more than maxSize bytes, it stops short.
+func fetch(ctx context.Context, o Origin, repo, rev string) (source, error) {
+	body, err := o.Fetch(ctx, repo, rev)
+	if err != nil {
+		return source{}, fmt.Errorf("fetching %s/%s from %s: %v", repo, rev, o.Name, err)
 	}
+	defer body.Close()
 	// See golang.org/issue/11224 for a discussion on tree filtering.
-	b, err := ioutil.ReadAll(io.LimitReader(res.Body, maxSize(repo)+1))
+	b, err := ioutil.ReadAll(io.LimitReader(body, maxSize(repo)+1))
 	if int64(len(b)) > maxSize(repo) && err == nil {
 		return source{TooBig: true}, nil
 	}
 	if err != nil {
-		return source{}, fmt.Errorf("reading %s/%s from %s: %v", repo, rev, service, err)
+		return source{}, fmt.Errorf("reading %s/%s from %s: %v", repo, rev, o.Name, err)
 	}
 	return source{Tgz: b}, nil
 }
@@ -180,3 +365,11 @@ func maxSize(repo string) int64 {
 		return 200 << 20
 	}
 }
+
+type nopLogger struct{}
+
+func (nopLogger) CreateSpan(event string, optText ...string) spanlog.Span { return nopSpan{} }
+
+type nopSpan struct{}
+
+func (nopSpan) Done(err error) error { return err }
@@ -0,0 +1,172 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sourcecache
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/build/internal/gcsfs"
+)
+
+const (
+	testRev1 = "0123456789abcdef0123456789abcdef01234567"
+	testRev2 = "89abcdef0123456789abcdef0123456789abcdef"
+)
+
+// countingOrigin returns an Origin that serves "repo@rev" as the
+// tarball of each revision and counts its fetches.
+func countingOrigin(name string, fetches *atomic.Int64) Origin {
+	return Origin{
+		Name: name,
+		Fetch: func(ctx context.Context, repo, rev string) (io.ReadCloser, error) {
+			fetches.Add(1)
+			return io.NopCloser(strings.NewReader(repo + "@" + rev)), nil
+		},
+	}
+}
+
+var errOrigin = errors.New("origin is down")
+
+var failingOrigin = Origin{
+	Name: "failing",
+	Fetch: func(ctx context.Context, repo, rev string) (io.ReadCloser, error) {
+		return nil, errOrigin
+	},
+}
+
+func mustGet(t *testing.T, c *Cache, repo, rev string) {
+	t.Helper()
+	r, err := c.GetSourceTgz(context.Background(), nil, repo, rev)
+	if err != nil {
+		t.Fatalf("GetSourceTgz(%q, %q) = %v", repo, rev, err)
+	}
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := repo + "@" + rev; string(got) != want {
+		t.Fatalf("GetSourceTgz(%q, %q) = %q, want %q", repo, rev, got, want)
+	}
+}
+
+// waitForFile waits for the background write of name to fsys.
+func waitForFile(t *testing.T, fsys fs.FS, name string) {
+	t.Helper()
+	for start := time.Now(); time.Since(start) < 10*time.Second; time.Sleep(10 * time.Millisecond) {
+		if _, err := fs.Stat(fsys, name); err == nil {
+			return
+		}
+	}
+	t.Fatalf("%s was never written to the store", name)
+}
+
+func TestCacheLayers(t *testing.T) {
+	store := Store{Name: "disk", FS: gcsfs.DirFS(t.TempDir())}
+	var fetches atomic.Int64
+	c := New(Options{Stores: []Store{store}, Origins: []Origin{countingOrigin("origin", &fetches)}})
+
+	mustGet(t, c, "go", testRev1)
+	mustGet(t, c, "go", testRev1)
+	if n := fetches.Load(); n != 1 {
+		t.Errorf("fetched a cached revision %d times, want 1", n)
+	}
+	waitForFile(t, store.FS, "go/"+testRev1+".tar.gz")
+
+	// A new cache, like that of another process, finds the tarball in
+	// the store without going to its origin.
+	c = New(Options{Stores: []Store{store}, Origins: []Origin{failingOrigin}})
+	mustGet(t, c, "go", testRev1)
+
+	// Revisions that aren't commit hashes may change, so they aren't
+	// cached.
+	c = New(Options{Stores: []Store{store}, Origins: []Origin{countingOrigin("origin", &fetches)}})
+	fetches.Store(0)
+	mustGet(t, c, "go", "master")
+	mustGet(t, c, "go", "master")
+	if n := fetches.Load(); n != 2 {
+		t.Errorf("fetched a branch %d times, want 2", n)
+	}
+	if _, err := fs.Stat(store.FS, "go/master.tar.gz"); err == nil {
+		t.Errorf("branch was written to the store")
+	}
+}
+
+func TestCacheWriteOnlyStore(t *testing.T) {
+	dir := gcsfs.DirFS(t.TempDir())
+	// A tarball that another writer of the store put there isn't
+	// trusted.
+	if err := gcsfs.WriteFile(dir, storeName("go", testRev1), []byte("tampered")); err != nil {
+		t.Fatal(err)
+	}
+	store := Store{Name: "disk", FS: dir, WriteOnly: true}
+	var fetches atomic.Int64
+	c := New(Options{Stores: []Store{store}, Origins: []Origin{countingOrigin("origin", &fetches)}})
+
+	mustGet(t, c, "go", testRev1)
+	mustGet(t, c, "go", testRev2)
+	if n := fetches.Load(); n != 2 {
+		t.Errorf("origin fetched %d times, want 2", n)
+	}
+	// Fetched tarballs are still written to the store, for its
+	// other users.
+	waitForFile(t, dir, storeName("go", testRev2))
+}
+
+func TestCacheOrigins(t *testing.T) {
+	var fetches atomic.Int64
+	c := New(Options{Origins: []Origin{failingOrigin, countingOrigin("fallback", &fetches)}})
+	mustGet(t, c, "net", testRev1)
+	if n := fetches.Load(); n != 1 {
+		t.Errorf("fetched %d times from the fallback origin, want 1", n)
+	}
+
+	c = New(Options{Origins: []Origin{failingOrigin}})
+	if _, err := c.GetSourceTgz(context.Background(), nil, "net", testRev2); err == nil || !strings.Contains(err.Error(), errOrigin.Error()) {
+		t.Errorf("GetSourceTgz with no working origin = %v, want an error mentioning %q", err, errOrigin)
+	}
+}
+
+func TestCacheSharedFetch(t *testing.T) {
+	var fetches atomic.Int64
+	release := make(chan struct{})
+	c := New(Options{Origins: []Origin{{
+		Name: "slow",
+		Fetch: func(ctx context.Context, repo, rev string) (io.ReadCloser, error) {
+			fetches.Add(1)
+			<-release
+			return io.NopCloser(strings.NewReader(repo + "@" + rev)), nil
+		},
+	}}})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := c.GetSourceTgz(context.Background(), nil, "tools", testRev2); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	// Wait for the first fetch to start, then give the others a
+	// chance to join it.
+	for fetches.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if n := fetches.Load(); n != 1 {
+		t.Errorf("concurrent gets fetched %d times, want 1", n)
+	}
+}
@@ -181,7 +181,7 @@ func (t AnnounceMailTasks) AnnounceRelease(ctx *workflow.TaskContext, kind Relea
 	}
 
 	// Send the announcement email to the destination mailing lists.
-	if t.SendMail == nil {
+	if t.SendMail == nil || ctx.DryRun {
 		return SentMail{Subject: "[dry-run] " + m.Subject}, nil
 	}
 	ctx.DisableRetries()
@@ -193,6 +193,15 @@ func (t AnnounceMailTasks) AnnounceRelease(ctx *workflow.TaskContext, kind Relea
 	return SentMail{m.Subject}, nil
 }
 
+// AnnounceReleaseKey is the idempotency key of AnnounceRelease.
+func AnnounceReleaseKey(kind ReleaseKind, published []Published, security []string, users []string) string {
+	var versions []string
+	for _, p := range published {
+		versions = append(versions, p.Version)
+	}
+	return "announce " + strings.Join(versions, " and ")
+}
+
 // PreAnnounceRelease sends an email pre-announcing a Go release
 // containing PRIVATE track security fixes planned for the target date.
 func (t AnnounceMailTasks) PreAnnounceRelease(ctx *workflow.TaskContext, versions []string, target Date, security string, cves []string, users []string) (SentMail, error) {
@@ -249,7 +258,7 @@ func (t AnnounceMailTasks) PreAnnounceRelease(ctx *workflow.TaskContext, version
 	}
 
 	// Send the pre-announcement email to the destination mailing lists.
-	if t.SendMail == nil {
+	if t.SendMail == nil || ctx.DryRun {
 		return SentMail{Subject: "[dry-run] " + m.Subject}, nil
 	}
 	ctx.DisableRetries()
@@ -261,6 +270,11 @@ func (t AnnounceMailTasks) PreAnnounceRelease(ctx *workflow.TaskContext, version
 	return SentMail{m.Subject}, nil
 }
 
+// PreAnnounceReleaseKey is the idempotency key of PreAnnounceRelease.
+func PreAnnounceReleaseKey(versions []string, target Date, security string, cves []string, users []string) string {
+	return fmt.Sprintf("pre-announce %s on %v", strings.Join(versions, " and "), target)
+}
+
 func coordinatorFirstNames(users []string) ([]string, error) {
 	return mapCoordinators(users, func(p *gophers.Person) string {
 		name, _, _ := strings.Cut(p.Name, " ")
@@ -495,6 +509,10 @@ func (c realSendGridMailClient) SendMail(h MailHeader, m MailContent) error {
 // AwaitAnnounceMail waits for an announcement email with the specified subject
 // to show up on Google Groups, and returns its canonical URL.
 func (t AnnounceMailTasks) AwaitAnnounceMail(ctx *workflow.TaskContext, m SentMail) (announcementURL string, _ error) {
+	if ctx.DryRun {
+		// The mail wasn't sent, so there's nothing to wait for.
+		return "(dry-run)", nil
+	}
 	// Find the URL for the announcement while giving the email a chance to be received and moderated.
 	check := func() (string, bool, error) {
 		// See if our email is available by now.
@@ -0,0 +1,382 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package task
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+
+	"golang.org/x/build/buildlet"
+	"golang.org/x/build/internal/gcsfs"
+	wf "golang.org/x/build/internal/workflow"
+	"golang.org/x/net/context/ctxhttp"
+)
+
+// BootstrapTasks builds the trimmed-down Go toolchains that builders
+// use as GOROOT_BOOTSTRAP, and uploads them with their checksums.
+// It replaces running cmd/genbootstrap by hand.
+type BootstrapTasks struct {
+	// Services are the external services the tasks call. Only
+	// Storage, which opens OutputURL, is used.
+	Services
+
+	GerritURL        string // Gitiles base URL, e.g. "https://go.googlesource.com".
+	CreateBuildlet   func(context.Context, string) (buildlet.RemoteClient, error)
+	LatestGoBinaries func(context.Context) (string, error)
+	OutputURL        string // gs:// or file:// URL to write tarballs to, e.g. "gs://go-builder-data".
+	DownloadURL      string // Public URL of OutputURL, e.g. "https://storage.googleapis.com/go-builder-data".
+}
+
+// A BootstrapArtifact is an uploaded bootstrap toolchain tarball.
+type BootstrapArtifact struct {
+	Platform string // GOOS-GOARCH[-suffix]
+	Filename string // For example, "gobootstrap-linux-arm-5-go1.17.13.tar.gz".
+	URL      string
+	SHA256   string
+	Size     int64
+}
+
+var bootstrapPlatformRE = regexp.MustCompile(`^[a-z0-9]+-[a-z0-9]+(-[a-z0-9.]+)?$`)
+
+func (x *BootstrapTasks) NewDefinition() *wf.Definition {
+	wd := wf.New()
+	version := wf.Param(wd, wf.ParamDef[string]{
+		Name:    "Go version",
+		Doc:     `Go version is the tag of the Go release to build the bootstrap toolchains from.`,
+		Example: "go1.17.13",
+		Check: func(v string) error {
+			if !strings.HasPrefix(v, "go1.") {
+				return fmt.Errorf("version %q doesn't look like a Go release tag", v)
+			}
+			return nil
+		},
+	})
+	platforms := wf.Param(wd, wf.ParamDef[[]string]{
+		Name:      "Platforms",
+		ParamType: wf.SliceShort,
+		Doc:       `Platforms are the GOOS-GOARCH pairs to build for, with an optional suffix for the GO$GOARCH setting.`,
+		Example:   "linux-arm-5",
+		Check: func(ps []string) error {
+			if len(ps) == 0 {
+				return fmt.Errorf("no platforms")
+			}
+			for _, p := range ps {
+				if !bootstrapPlatformRE.MatchString(p) {
+					return fmt.Errorf("platform %q isn't of the form GOOS-GOARCH[-suffix]", p)
+				}
+			}
+			return nil
+		},
+	})
+	wf.Expand2(wd, "Plan builds", x.planBuilds, version, platforms)
+	return wd
+}
+
+func (x *BootstrapTasks) planBuilds(wd *wf.Definition, version string, platforms []string) error {
+	var artifacts []wf.Value[BootstrapArtifact]
+	for _, p := range platforms {
+		artifacts = append(artifacts, wf.Task2(wd, "Build "+p, x.BuildBootstrap, wf.Const(version), wf.Const(p)))
+	}
+	summary := wf.Task2(wd, "Write summary", x.WriteSummary, wf.Const(version), wf.Slice(artifacts...))
+	wf.Output(wd, "summary", summary)
+	return nil
+}
+
+// BuildBootstrap builds the bootstrap toolchain for platform at Go
+// version on a linux-amd64 buildlet, trims it, and uploads it.
+func (x *BootstrapTasks) BuildBootstrap(ctx *wf.TaskContext, version, platform string) (BootstrapArtifact, error) {
+	f := strings.Split(platform, "-")
+	goos, goarch, gosuffix := f[0], f[1], ""
+	if len(f) == 3 {
+		gosuffix = f[2]
+	}
+
+	binaries, err := x.LatestGoBinaries(ctx)
+	if err != nil {
+		return BootstrapArtifact{}, err
+	}
+	src, err := x.source(ctx, version)
+	if err != nil {
+		return BootstrapArtifact{}, err
+	}
+	bc, err := x.CreateBuildlet(ctx, "linux-amd64")
+	if err != nil {
+		return BootstrapArtifact{}, err
+	}
+	defer bc.Close()
+	if err := bc.PutTarFromURL(ctx, binaries, ""); err != nil {
+		return BootstrapArtifact{}, err
+	}
+	if err := bc.PutTar(ctx, bytes.NewReader(src), "goroot"); err != nil {
+		return BootstrapArtifact{}, err
+	}
+	workDir, err := bc.WorkDir(ctx)
+	if err != nil {
+		return BootstrapArtifact{}, err
+	}
+
+	env := []string{
+		"GOROOT=" + workDir + "/goroot",
+		"GOROOT_BOOTSTRAP=" + workDir + "/go",
+		"CGO_ENABLED=0",
+		"GOOS=" + goos,
+		"GOARCH=" + goarch,
+	}
+	if gosuffix != "" {
+		env = append(env, "GO"+strings.ToUpper(goarch)+"="+gosuffix)
+	}
+	writer := &LogWriter{Logger: ctx}
+	go writer.Run(ctx)
+	remoteErr, execErr := bc.Exec(ctx, "goroot/src/bootstrap.bash", buildlet.ExecOpts{
+		Dir:      "goroot/src",
+		Output:   writer,
+		ExtraEnv: env,
+	})
+	if execErr != nil {
+		return BootstrapArtifact{}, fmt.Errorf("Exec failed: %v", execErr)
+	}
+	if remoteErr != nil {
+		return BootstrapArtifact{}, fmt.Errorf("bootstrap.bash failed: %v", remoteErr)
+	}
+
+	// bootstrap.bash also makes a bzipped tar file, but it's fat and
+	// full of stuff we don't need, so make our own from its output.
+	tgz, err := bc.GetTar(ctx, "go-"+goos+"-"+goarch+"-bootstrap")
+	if err != nil {
+		return BootstrapArtifact{}, err
+	}
+	defer tgz.Close()
+
+	outFS, err := x.Storage.FS(ctx, x.OutputURL)
+	if err != nil {
+		return BootstrapArtifact{}, err
+	}
+	name := "gobootstrap-" + platform + "-" + version + ".tar.gz"
+	out, err := gcsfs.Create(outFS, name)
+	if err != nil {
+		return BootstrapArtifact{}, err
+	}
+	defer out.Close()
+	hash := sha256.New()
+	size := &sizeWriter{}
+	if err := trimBootstrapTar(tgz, io.MultiWriter(out, hash, size)); err != nil {
+		return BootstrapArtifact{}, err
+	}
+	if err := out.Close(); err != nil {
+		return BootstrapArtifact{}, err
+	}
+	sum := fmt.Sprintf("%x", hash.Sum(nil))
+	if err := gcsfs.WriteFile(outFS, name+".sha256", []byte(sum)); err != nil {
+		return BootstrapArtifact{}, err
+	}
+	ctx.Printf("Uploaded %s (%d bytes, SHA-256 %s)", name, size.size, sum)
+	return BootstrapArtifact{
+		Platform: platform,
+		Filename: name,
+		URL:      x.DownloadURL + "/" + name,
+		SHA256:   sum,
+		Size:     size.size,
+	}, nil
+}
+
+// source returns the source tarball of the go repository at version,
+// patched to build with old Go versions.
+func (x *BootstrapTasks) source(ctx context.Context, version string) ([]byte, error) {
+	resp, err := ctxhttp.Get(ctx, http.DefaultClient, x.GerritURL+"/go/+archive/"+version+".tar.gz")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching %s source: %v", version, resp.Status)
+	}
+	tgz, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	files, err := tgzToMap(bytes.NewReader(tgz))
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := files["src/bootstrap.bash"]; !ok {
+		return nil, fmt.Errorf("%s has no src/bootstrap.bash", version)
+	}
+	// Work around GO_LDSO bug by removing implicit setting from make.bash.
+	// See go.dev/issue/54196 and go.dev/issue/54197.
+	// Even if those are fixed, the old toolchains we are using for bootstrap won't get the fix.
+	makebash := strings.ReplaceAll(files["src/make.bash"], "GO_LDSO", "GO_LDSO_BUG")
+	return replaceTgzFile(tgz, "src/make.bash", makebash)
+}
+
+// replaceTgzFile returns a copy of tgz with the contents of the file
+// name replaced.
+func replaceTgzFile(tgz []byte, name, contents string) ([]byte, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(tgz))
+	if err != nil {
+		return nil, err
+	}
+	tr := tar.NewReader(zr)
+	buf := &bytes.Buffer{}
+	zw := gzip.NewWriter(buf)
+	tw := tar.NewWriter(zw)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		var r io.Reader = tr
+		if h.Name == name {
+			h.Size = int64(len(contents))
+			r = strings.NewReader(contents)
+		}
+		if err := tw.WriteHeader(h); err != nil {
+			return nil, err
+		}
+		if _, err := io.Copy(tw, r); err != nil {
+			return nil, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// trimBootstrapTar copies the gzipped tarball in to out, dropping the
+// files that KeepBootstrapFile rejects.
+func trimBootstrapTar(in io.Reader, out io.Writer) error {
+	zr, err := gzip.NewReader(in)
+	if err != nil {
+		return err
+	}
+	tr := tar.NewReader(zr)
+	zw := gzip.NewWriter(out)
+	tw := tar.NewWriter(zw)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		if !KeepBootstrapFile(strings.TrimSuffix(h.Name, "/"), h.FileInfo().Mode()) {
+			continue
+		}
+		if err := tw.WriteHeader(h); err != nil {
+			return err
+		}
+		if _, err := io.Copy(tw, tr); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// KeepBootstrapFile reports whether the file or directory at rel, a
+// slash-separated path relative to the output of bootstrap.bash,
+// belongs in a bootstrap toolchain. Anything under a directory that
+// doesn't belong is rejected too.
+func KeepBootstrapFile(rel string, mode fs.FileMode) bool {
+	elems := strings.Split(rel, "/")
+	for i := range elems {
+		if !keepBootstrapPath(strings.Join(elems[:i+1], "/")) {
+			return false
+		}
+	}
+	if mode.IsDir() {
+		return true
+	}
+	base := path.Base(rel)
+	if strings.HasPrefix(base, "#") && strings.HasSuffix(base, "#") || strings.HasSuffix(base, "~") {
+		return false // editor junk
+	}
+	return mode.IsRegular() && !strings.HasSuffix(rel, "_test.go")
+}
+
+func keepBootstrapPath(rel string) bool {
+	switch rel {
+	case "api",
+		"bin/gofmt",
+		"doc",
+		"misc/android",
+		"misc/cgo",
+		"misc/chrome",
+		"misc/swig",
+		"test":
+		return false
+	}
+	base := path.Base(rel)
+	if base == "testdata" {
+		return false
+	}
+	if strings.HasPrefix(rel, "pkg/") {
+		// Compiled packages of cmd, in pkg/<goos>_<goarch>/cmd.
+		if _, pkgrel, ok := strings.Cut(strings.TrimPrefix(rel, "pkg/"), "/"); ok && pkgrel == "cmd" {
+			return false
+		}
+	}
+	if strings.HasPrefix(rel, "pkg/tool/") {
+		switch base {
+		case "addr2line", "api", "cgo", "cover",
+			"dist", "doc", "fix", "nm",
+			"objdump", "pack", "pprof",
+			"trace", "vet", "yacc":
+			return false
+		}
+	}
+	return true
+}
+
+// WriteSummary uploads a JSON manifest of the artifacts built for
+// version, and returns a human-readable summary of them.
+func (x *BootstrapTasks) WriteSummary(ctx *wf.TaskContext, version string, artifacts []BootstrapArtifact) (string, error) {
+	manifest, err := json.MarshalIndent(artifacts, "", "\t")
+	if err != nil {
+		return "", err
+	}
+	outFS, err := x.Storage.FS(ctx, x.OutputURL)
+	if err != nil {
+		return "", err
+	}
+	name := "gobootstrap-" + version + ".json"
+	if err := gcsfs.WriteFile(outFS, name, manifest); err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "Bootstrap toolchains for %s (manifest: %s/%s):\n", version, x.DownloadURL, name)
+	for _, a := range artifacts {
+		fmt.Fprintf(&b, "%s %s %d bytes, SHA-256 %s\n", a.Platform, a.URL, a.Size, a.SHA256)
+	}
+	return b.String(), nil
+}
+
+// sizeWriter counts the bytes written to it.
+type sizeWriter struct {
+	size int64
+}
+
+func (w *sizeWriter) Write(p []byte) (int, error) {
+	w.size += int64(len(p))
+	return len(p), nil
+}
@@ -0,0 +1,177 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package task
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/build/internal/workflow"
+)
+
+const fakeBootstrapBash = `#!/bin/bash -eu
+grep -q GO_LDSO_BUG make.bash
+[[ "$GOROOT_BOOTSTRAP" == */go ]]
+out="$GOROOT/../go-$GOOS-$GOARCH-bootstrap"
+mkdir -p "$out/bin" "$out/test" "$out/pkg/tool/${GOOS}_$GOARCH" "$out/pkg/${GOOS}_$GOARCH/cmd" "$out/src/fmt/testdata"
+echo "GOARM=${GOARM:-}" > "$out/bin/go"
+echo gofmt > "$out/bin/gofmt"
+echo compile > "$out/pkg/tool/${GOOS}_$GOARCH/compile"
+echo vet > "$out/pkg/tool/${GOOS}_$GOARCH/vet"
+echo cmd > "$out/pkg/${GOOS}_$GOARCH/cmd/go.a"
+echo fmt > "$out/src/fmt/print.go"
+echo test > "$out/src/fmt/print_test.go"
+echo testdata > "$out/src/fmt/testdata/x"
+echo test > "$out/test/x.go"
+`
+
+func TestBuildBootstrap(t *testing.T) {
+	if runtime.GOOS != "linux" && runtime.GOOS != "darwin" {
+		t.Skip("Requires bash shell scripting support.")
+	}
+
+	goServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ServeTarball("dl/go1.19.linux-amd64.tar.gz", map[string]string{
+			"go/bin/go": "I'm the go command",
+		}, w, r)
+	}))
+	t.Cleanup(goServer.Close)
+
+	goRepo := NewFakeRepo(t, "go")
+	goRepo.Tag("go1.17.13", goRepo.Commit(map[string]string{
+		"src/make.bash":      "export GO_LDSO=/lib/ld.so\n",
+		"src/bootstrap.bash": fakeBootstrapBash,
+	}))
+	fakeGerrit := NewFakeGerrit(t, goRepo)
+	outDir := t.TempDir()
+	var calls CallLog
+	tasks := &BootstrapTasks{
+		Services:       Services{Storage: GCSStorage(nil)}.Record(&calls),
+		GerritURL:      fakeGerrit.GerritURL(),
+		CreateBuildlet: NewFakeBuildlets(t, "", nil).CreateBuildlet,
+		LatestGoBinaries: func(context.Context) (string, error) {
+			return goServer.URL + "/dl/go1.19.linux-amd64.tar.gz", nil
+		},
+		OutputURL:   "file://" + outDir,
+		DownloadURL: "https://example.com/bootstrap",
+	}
+
+	w, err := workflow.Start(tasks.NewDefinition(), map[string]interface{}{
+		"Go version": "go1.17.13",
+		"Platforms":  []string{"linux-arm-5", "linux-amd64"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	outputs, err := w.Run(ctx, &verboseListener{t: t})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	manifest, err := os.ReadFile(filepath.Join(outDir, "gobootstrap-go1.17.13.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var artifacts []BootstrapArtifact
+	if err := json.Unmarshal(manifest, &artifacts); err != nil {
+		t.Fatal(err)
+	}
+	if len(artifacts) != 2 {
+		t.Fatalf("manifest has %d artifacts; want 2", len(artifacts))
+	}
+	for _, a := range artifacts {
+		goos, goarch, _ := strings.Cut(strings.TrimSuffix(a.Platform, "-5"), "-")
+		tgz, err := os.ReadFile(filepath.Join(outDir, a.Filename))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := fmt.Sprintf("%x", sha256.Sum256(tgz)); a.SHA256 != got || a.Size != int64(len(tgz)) {
+			t.Errorf("%s: manifest has SHA-256 %s and size %d; file has %s and %d", a.Platform, a.SHA256, a.Size, got, len(tgz))
+		}
+		if sum, err := os.ReadFile(filepath.Join(outDir, a.Filename+".sha256")); err != nil || string(sum) != a.SHA256 {
+			t.Errorf("%s: checksum file = %q, %v; want %q", a.Platform, sum, err, a.SHA256)
+		}
+		if want := "https://example.com/bootstrap/" + a.Filename; a.URL != want {
+			t.Errorf("%s: URL = %q; want %q", a.Platform, a.URL, want)
+		}
+		files, err := tgzToMap(strings.NewReader(string(tgz)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		goarm := ""
+		if goarch == "arm" {
+			goarm = "5"
+		}
+		want := map[string]string{
+			"bin/go": "GOARM=" + goarm + "\n",
+			"pkg/tool/" + goos + "_" + goarch + "/compile": "compile\n",
+			"src/fmt/print.go": "fmt\n",
+		}
+		if !reflect.DeepEqual(files, want) {
+			t.Errorf("%s: tarball has %v; want %v", a.Platform, files, want)
+		}
+	}
+	if summary := outputs["summary"].(string); !strings.Contains(summary, "gobootstrap-linux-arm-5-go1.17.13.tar.gz") {
+		t.Errorf("summary doesn't mention the linux-arm-5 tarball:\n%s", summary)
+	}
+
+	out := fmt.Sprintf("%q", tasks.OutputURL)
+	for task, want := range map[string][]string{
+		"Build linux-arm-5": {
+			`Storage.Create(` + out + `, "gobootstrap-linux-arm-5-go1.17.13.tar.gz")`,
+			`Storage.Create(` + out + `, "gobootstrap-linux-arm-5-go1.17.13.tar.gz.sha256")`,
+		},
+		"Write summary": {
+			`Storage.Create(` + out + `, "gobootstrap-go1.17.13.json")`,
+		},
+	} {
+		if got := calls.TaskCalls(task); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s made calls:\n%s\nwant:\n%s", task, strings.Join(got, "\n"), strings.Join(want, "\n"))
+		}
+	}
+}
+
+func TestKeepBootstrapFile(t *testing.T) {
+	for _, tt := range []struct {
+		rel  string
+		mode fs.FileMode
+		want bool
+	}{
+		{"bin/go", 0755, true},
+		{"bin/gofmt", 0755, false},
+		{"pkg/tool/linux_amd64/compile", 0755, true},
+		{"pkg/tool/linux_amd64/vet", 0755, false},
+		{"pkg/linux_amd64/cmd", fs.ModeDir, false},
+		{"pkg/linux_amd64/cmd/go.a", 0644, false},
+		{"pkg/linux_amd64/fmt.a", 0644, true},
+		{"src/cmd", fs.ModeDir, true},
+		{"src/fmt/print.go", 0644, true},
+		{"src/fmt/print_test.go", 0644, false},
+		{"src/fmt/testdata/x", 0644, false},
+		{"src/fmt/print.go~", 0644, false},
+		{"test", fs.ModeDir, false},
+		{"test/x.go", 0644, false},
+		{"misc/cgo/x.go", 0644, false},
+		{"src/link", fs.ModeSymlink, false},
+	} {
+		if got := KeepBootstrapFile(tt.rel, tt.mode); got != tt.want {
+			t.Errorf("KeepBootstrapFile(%q, %v) = %v; want %v", tt.rel, tt.mode, got, tt.want)
+		}
+	}
+}
@@ -13,7 +13,6 @@ import (
 	"embed"
 	"fmt"
 	"io"
-	"net/http"
 	"path"
 	"regexp"
 	"strings"
@@ -27,19 +26,11 @@ import (
 	"golang.org/x/build/internal/workflow"
 )
 
-// WriteSourceArchive writes a source archive to out, based on revision with version written in as VERSION.
-func WriteSourceArchive(ctx *workflow.TaskContext, client *http.Client, gerritURL, revision, version string, out io.Writer) error {
+// WriteSourceArchive writes a source archive to out, based on src, a
+// gzip-compressed tarball of the go repository, with version written in as VERSION.
+func WriteSourceArchive(ctx *workflow.TaskContext, src io.Reader, version string, out io.Writer) error {
 	ctx.Printf("Create source archive.")
-	tarURL := gerritURL + "/+archive/" + revision + ".tar.gz"
-	resp, err := client.Get(tarURL)
-	if err != nil {
-		return err
-	}
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("failed to fetch %q: %v", tarURL, resp.Status)
-	}
-	defer resp.Body.Close()
-	gzReader, err := gzip.NewReader(resp.Body)
+	gzReader, err := gzip.NewReader(src)
 	if err != nil {
 		return err
 	}
@@ -222,20 +213,13 @@ type BuildletStep struct {
 	LogWriter   io.Writer
 }
 
-func (b *BuildletStep) BuildSourceDistpack(ctx *workflow.TaskContext, client *http.Client, gerritURL, revision, versionFile string, out io.Writer) error {
+// BuildSourceDistpack builds a source distpack to out from src, a
+// gzip-compressed tarball of the go repository, with versionFile
+// written in as VERSION.
+func (b *BuildletStep) BuildSourceDistpack(ctx *workflow.TaskContext, src io.Reader, versionFile string, out io.Writer) error {
 	ctx.Printf("Create source archive.")
-	tarURL := gerritURL + "/+archive/" + revision + ".tar.gz"
-	resp, err := client.Get(tarURL)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("failed to fetch %q: %v", tarURL, resp.Status)
-	}
-
-	ctx.Printf("Pushing source to buildlet from %v.", tarURL)
-	if err := b.Buildlet.PutTar(ctx, resp.Body, "go"); err != nil {
+	ctx.Printf("Pushing source to buildlet.")
+	if err := b.Buildlet.PutTar(ctx, src, "go"); err != nil {
 		return fmt.Errorf("failed to put source tarball: %v", err)
 	}
 	ctx.Printf("Writing VERSION file.")
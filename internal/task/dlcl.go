@@ -26,7 +26,7 @@ import (
 //   - "go1.21.1" for a minor Go release
 //
 // On success, the ID of the change is returned, like "dl~1234".
-func (t *VersionTasks) MailDLCL(ctx *workflow.TaskContext, major int, kind ReleaseKind, version string, reviewers []string, dryRun bool) (changeID string, _ error) {
+func (t *VersionTasks) MailDLCL(ctx *workflow.TaskContext, major int, kind ReleaseKind, version string, reviewers []string) (changeID string, _ error) {
 	var files = make(map[string]string) // Map key is relative path, and map value is file content.
 
 	// Generate main.go files for versions from the template.
@@ -50,7 +50,7 @@ func (t *VersionTasks) MailDLCL(ctx *workflow.TaskContext, major int, kind Relea
 	ctx.Printf("file %q (command %q):\n%s", path.Join(version, "main.go"), "golang.org/dl/"+version, gofmted)
 
 	// Create a Gerrit CL using the Gerrit API.
-	if dryRun {
+	if ctx.DryRun {
 		return "(dry-run)", nil
 	}
 	changeInput := gerrit.ChangeInput{
@@ -61,6 +61,11 @@ func (t *VersionTasks) MailDLCL(ctx *workflow.TaskContext, major int, kind Relea
 	return t.Gerrit.CreateAutoSubmitChange(ctx, changeInput, reviewers, files)
 }
 
+// MailDLCLKey is the idempotency key of MailDLCL.
+func MailDLCLKey(major int, kind ReleaseKind, version string, reviewers []string) string {
+	return "mail dl CL for " + version
+}
+
 func docLink(major int, kind ReleaseKind, ver string) string {
 	if kind == KindCurrentMinor || kind == KindPrevMinor {
 		return fmt.Sprintf("https://go.dev/doc/devel/release#%v", ver)
@@ -154,9 +154,9 @@ func main() {
 			// Call the mail a dl CL task function in dry-run mode so it
 			// doesn't actually try to mail a dl CL, but capture its log.
 			var buf bytes.Buffer
-			ctx := &workflow.TaskContext{Context: context.Background(), Logger: fmtWriter{&buf}}
+			ctx := &workflow.TaskContext{Context: context.Background(), Logger: fmtWriter{&buf}, DryRun: true}
 			tasks := &VersionTasks{Gerrit: nil}
-			changeID, err := tasks.MailDLCL(ctx, tc.major, tc.kind, tc.version, nil, true)
+			changeID, err := tasks.MailDLCL(ctx, tc.major, tc.kind, tc.version, nil)
 			if err != nil {
 				t.Fatal("got a non-nil error:", err)
 			}
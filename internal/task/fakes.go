@@ -217,7 +217,14 @@ retry:
 		goto retry
 	}
 	if err != nil {
-		return nil, fmt.Errorf("command %v %v failed: %v output: %q", cmd, opts.Args, err, buf.String())
+		_, exited := err.(*exec.ExitError)
+		err = fmt.Errorf("command %v %v failed: %v output: %q", cmd, opts.Args, err, buf.String())
+		// Like a real buildlet, report commands that ran and failed
+		// as remote errors.
+		if exited {
+			return err, nil
+		}
+		return nil, err
 	}
 	return nil, nil
 }
@@ -331,6 +338,7 @@ func (b *fakeBuildlet) WorkDir(ctx context.Context) (string, error) {
 
 func NewFakeGerrit(t *testing.T, repos ...*FakeRepo) *FakeGerrit {
 	result := &FakeGerrit{
+		t:     t,
 		repos: map[string]*FakeRepo{},
 	}
 	server := httptest.NewServer(http.HandlerFunc(result.serveHTTP))
@@ -344,6 +352,7 @@ func NewFakeGerrit(t *testing.T, repos ...*FakeRepo) *FakeGerrit {
 }
 
 type FakeGerrit struct {
+	t         *testing.T
 	repos     map[string]*FakeRepo
 	serverURL string
 }
@@ -430,6 +439,21 @@ func (g *FakeGerrit) ListProjects(ctx context.Context) ([]string, error) {
 	return names, nil
 }
 
+func (g *FakeGerrit) GetProjectInfo(ctx context.Context, project string) (gerrit.ProjectInfo, error) {
+	if _, err := g.repo(project); err != nil {
+		return gerrit.ProjectInfo{}, err
+	}
+	return gerrit.ProjectInfo{ID: project, Name: project, State: "ACTIVE"}, nil
+}
+
+func (g *FakeGerrit) CreateProject(ctx context.Context, project string, input gerrit.ProjectInput) error {
+	if _, ok := g.repos[project]; ok {
+		return fmt.Errorf("project %q already exists", project)
+	}
+	g.repos[project] = NewFakeRepo(g.t, project)
+	return nil
+}
+
 func (g *FakeGerrit) repo(name string) (*FakeRepo, error) {
 	if r, ok := g.repos[name]; ok {
 		return r, nil
@@ -616,6 +640,29 @@ func (s *FakeSignService) CancelSigning(_ context.Context, jobID string) error {
 	return fmt.Errorf("intentional fake error")
 }
 
+// CheckSignedStructure checks that r holds an artifact signed as bt by
+// the fake signing service, like sign.CheckSignedStructure does for
+// real ones.
+func (s *FakeSignService) CheckSignedStructure(bt sign.BuildType, r io.Reader) error {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	switch bt {
+	case sign.BuildMacOS, sign.BuildWindows:
+		if !bytes.Contains(b, []byte(fmt.Sprintf("-signed <%s>", bt))) {
+			return fmt.Errorf("artifact isn't signed for %v", bt)
+		}
+	case sign.BuildGPG:
+		if !bytes.HasPrefix(b, []byte("I'm a GPG signature for ")) {
+			return fmt.Errorf("not a GPG signature")
+		}
+	default:
+		return fmt.Errorf("CheckSignedStructure: not implemented for %v", bt)
+	}
+	return nil
+}
+
 func fakeSignPKG(f, msg string) string {
 	b, err := os.ReadFile(strings.TrimPrefix(f, "file://"))
 	if err != nil {
@@ -37,6 +37,11 @@ type GerritClient interface {
 	ReadBranchHead(ctx context.Context, project, branch string) (string, error)
 	// ListProjects lists all the projects on the server.
 	ListProjects(ctx context.Context) ([]string, error)
+	// GetProjectInfo returns information about project.
+	// If it doesn't exist, it returns an error matching gerrit.ErrResourceNotExist.
+	GetProjectInfo(ctx context.Context, project string) (gerrit.ProjectInfo, error)
+	// CreateProject creates project with the specified options.
+	CreateProject(ctx context.Context, project string, input gerrit.ProjectInput) error
 	// ReadFile reads a file from project at the specified commit.
 	// If the file doesn't exist, it returns an error matching gerrit.ErrResourceNotExist.
 	ReadFile(ctx context.Context, project, commit, file string) ([]byte, error)
@@ -191,6 +196,15 @@ func (c *RealGerritClient) ListProjects(ctx context.Context) ([]string, error) {
 	return names, nil
 }
 
+func (c *RealGerritClient) GetProjectInfo(ctx context.Context, project string) (gerrit.ProjectInfo, error) {
+	return c.Client.GetProjectInfo(ctx, project)
+}
+
+func (c *RealGerritClient) CreateProject(ctx context.Context, project string, input gerrit.ProjectInput) error {
+	_, err := c.Client.CreateProject(ctx, project, input)
+	return err
+}
+
 func (c *RealGerritClient) ReadFile(ctx context.Context, project, commit, file string) ([]byte, error) {
 	body, err := c.Client.GetFileContent(ctx, project, commit, file)
 	if err != nil {
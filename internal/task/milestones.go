@@ -256,8 +256,7 @@ EarlyIssuesLoop:
 		}
 
 		// Post a comment.
-		const dryRun = false
-		if dryRun {
+		if ctx.DryRun {
 			ctx.Printf("[dry run] Would've pinged issue %d (%.32s…).", i.Number, i.Title)
 			continue
 		}
@@ -0,0 +1,356 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package task
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/github"
+	"golang.org/x/build/gerrit"
+	wf "golang.org/x/build/internal/workflow"
+	"golang.org/x/build/maintner/maintnerd/apipb"
+)
+
+// This file contains a workflow definition for onboarding a new
+// golang.org/x repository. Given the name and description of a repo,
+// it creates its Gerrit project, sets up the GitHub repo it's mirrored
+// to, and adds it to x/build's repos package, from which gitmirror,
+// the coordinator, the dashboard and maintner learn about it. Each
+// step checks its result, and is a no-op if it was already done, so
+// that the workflow can be run again for a partially onboarded repo.
+
+// OnboardRepoTasks contains the tasks for onboarding a new
+// golang.org/x repository.
+type OnboardRepoTasks struct {
+	Gerrit GerritClient
+	// GerritParent is the project new Gerrit projects inherit
+	// their permissions from. If empty, it's Gerrit's default,
+	// All-Projects.
+	GerritParent string
+	GitHub       GitHubRepoClient
+	GitHubOrg    string // the GitHub organization of the mirrors, like "golang"
+	// BuildProject is the Gerrit project holding the repos package.
+	BuildProject string
+	DashboardURL string
+	Maintner     apipb.MaintnerServiceClient
+}
+
+// GitHubRepoClient manages the GitHub repositories that Gerrit
+// projects are mirrored to.
+type GitHubRepoClient interface {
+	// GetRepo returns the repository owner/repo, or nil if it doesn't exist.
+	GetRepo(ctx context.Context, owner, repo string) (*github.Repository, error)
+
+	// CreateRepo creates a repository in org.
+	// See github.Client.Repositories.Create.
+	CreateRepo(ctx context.Context, org string, repo *github.Repository) error
+
+	// EditRepo changes the settings of owner/repo.
+	// See github.Client.Repositories.Edit.
+	EditRepo(ctx context.Context, owner, repo string, settings *github.Repository) error
+
+	// ReadBranchHead returns the head of branch in owner/repo,
+	// or "" if the branch doesn't exist.
+	ReadBranchHead(ctx context.Context, owner, repo, branch string) (string, error)
+}
+
+func (c *GitHubClient) GetRepo(ctx context.Context, owner, repo string) (*github.Repository, error) {
+	r, resp, err := c.V3.Repositories.Get(ctx, owner, repo)
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	return r, err
+}
+
+func (c *GitHubClient) CreateRepo(ctx context.Context, org string, repo *github.Repository) error {
+	_, _, err := c.V3.Repositories.Create(ctx, org, repo)
+	return err
+}
+
+func (c *GitHubClient) EditRepo(ctx context.Context, owner, repo string, settings *github.Repository) error {
+	_, _, err := c.V3.Repositories.Edit(ctx, owner, repo, settings)
+	return err
+}
+
+func (c *GitHubClient) ReadBranchHead(ctx context.Context, owner, repo, branch string) (string, error) {
+	b, resp, err := c.V3.Repositories.GetBranch(ctx, owner, repo, branch)
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return b.GetCommit().GetSHA(), nil
+}
+
+func (x *OnboardRepoTasks) NewDefinition() *wf.Definition {
+	wd := wf.New()
+	name := wf.Param(wd, wf.ParamDef[string]{
+		Name:    "Repository name",
+		Doc:     "The name of the new repository, which is served as golang.org/x/<name>.",
+		Example: "newrepo",
+	})
+	desc := wf.Param(wd, wf.ParamDef[string]{
+		Name:    "Description",
+		Doc:     "A short description of the repository, shown on GitHub and on the golang.org/x page.",
+		Example: "additional imaging packages",
+	})
+	reviewers := wf.Param(wd, reviewersParam)
+
+	name = wf.Task1(wd, "Check repository name", x.CheckName, name)
+	head := wf.Task2(wd, "Create Gerrit project", x.CreateGerritProject, name, desc)
+	configured := wf.Task2(wd, "Configure GitHub mirror", x.ConfigureGitHubMirror, name, desc)
+	changeID := wf.Task3(wd, "Mail x/build CL", x.MailReposCL, name, desc, reviewers, wf.After(head))
+	submitted := wf.Task1(wd, "Await x/build CL", x.AwaitCL, changeID)
+	mirrored := wf.Task2(wd, "Await GitHub mirror", x.AwaitGitHubMirror, name, head, wf.After(configured, submitted))
+	dashboard := wf.Task1(wd, "Await dashboard", x.AwaitDashboard, name, wf.After(submitted))
+	maintner := wf.Task1(wd, "Await maintner", x.AwaitMaintner, name, wf.After(submitted))
+
+	wf.Output(wd, "GitHub mirror", mirrored)
+	wf.Output(wd, "Dashboard", dashboard)
+	wf.Output(wd, "Maintner", maintner)
+	return wd
+}
+
+var repoNameRE = regexp.MustCompile(`^[a-z][a-z0-9-]*$`)
+
+// CheckName checks that name is a valid name for a golang.org/x repo.
+func (x *OnboardRepoTasks) CheckName(ctx *wf.TaskContext, name string) (string, error) {
+	if !repoNameRE.MatchString(name) {
+		ctx.DisableRetries()
+		return "", fmt.Errorf("invalid repository name %q: must be lowercase letters, digits and dashes, starting with a letter", name)
+	}
+	return name, nil
+}
+
+// CreateGerritProject creates the Gerrit project name, unless it
+// already exists, and returns the head of its master branch.
+func (x *OnboardRepoTasks) CreateGerritProject(ctx *wf.TaskContext, name, desc string) (string, error) {
+	_, err := x.Gerrit.GetProjectInfo(ctx, name)
+	switch {
+	case errors.Is(err, gerrit.ErrResourceNotExist):
+		err = x.Gerrit.CreateProject(ctx, name, gerrit.ProjectInput{
+			Parent:            x.GerritParent,
+			Description:       desc,
+			CreateEmptyCommit: true,
+		})
+		if err != nil {
+			return "", fmt.Errorf("creating Gerrit project %q: %v", name, err)
+		}
+		ctx.Printf("Created Gerrit project %q.", name)
+	case err != nil:
+		return "", err
+	default:
+		ctx.Printf("Gerrit project %q already exists.", name)
+	}
+
+	// Verify that the project is usable.
+	info, err := x.Gerrit.GetProjectInfo(ctx, name)
+	if err != nil {
+		return "", fmt.Errorf("reading new Gerrit project %q: %v", name, err)
+	}
+	if info.State != "" && info.State != "ACTIVE" {
+		return "", fmt.Errorf("Gerrit project %q is %v, not ACTIVE", name, info.State)
+	}
+	head, err := x.Gerrit.ReadBranchHead(ctx, name, "master")
+	if err != nil {
+		return "", fmt.Errorf("reading master branch of Gerrit project %q: %v", name, err)
+	}
+	return head, nil
+}
+
+// mirrorSettings returns the settings of the GitHub mirror of name.
+// Contributions go through Gerrit, and issues to the main Go repo.
+func mirrorSettings(name, desc string) *github.Repository {
+	if desc == "" {
+		desc = "golang.org/x/" + name
+	}
+	return &github.Repository{
+		Name:        github.String(name),
+		Description: github.String("[mirror] " + desc),
+		Homepage:    github.String("https://pkg.go.dev/golang.org/x/" + name),
+		HasIssues:   github.Bool(false),
+		HasWiki:     github.Bool(false),
+		HasProjects: github.Bool(false),
+	}
+}
+
+// ConfigureGitHubMirror creates the GitHub repo that name is mirrored
+// to, or updates the settings of an existing one, and returns its URL.
+func (x *OnboardRepoTasks) ConfigureGitHubMirror(ctx *wf.TaskContext, name, desc string) (string, error) {
+	want := mirrorSettings(name, desc)
+	r, err := x.GitHub.GetRepo(ctx, x.GitHubOrg, name)
+	if err != nil {
+		return "", err
+	}
+	if r == nil {
+		if err := x.GitHub.CreateRepo(ctx, x.GitHubOrg, want); err != nil {
+			return "", fmt.Errorf("creating GitHub repo %s/%s: %v", x.GitHubOrg, name, err)
+		}
+		ctx.Printf("Created GitHub repo %s/%s.", x.GitHubOrg, name)
+	} else if err := x.GitHub.EditRepo(ctx, x.GitHubOrg, name, want); err != nil {
+		return "", fmt.Errorf("configuring GitHub repo %s/%s: %v", x.GitHubOrg, name, err)
+	}
+
+	// Verify the settings.
+	r, err = x.GitHub.GetRepo(ctx, x.GitHubOrg, name)
+	if err != nil {
+		return "", err
+	}
+	if r == nil {
+		return "", fmt.Errorf("GitHub repo %s/%s doesn't exist after creating it", x.GitHubOrg, name)
+	}
+	if r.GetDescription() != want.GetDescription() || r.GetHomepage() != want.GetHomepage() ||
+		r.GetHasIssues() || r.GetHasWiki() || r.GetHasProjects() {
+		return "", fmt.Errorf("GitHub repo %s/%s has settings %+v; want %+v", x.GitHubOrg, name, r, want)
+	}
+	return fmt.Sprintf("https://github.com/%s/%s", x.GitHubOrg, name), nil
+}
+
+// AwaitGitHubMirror waits for the GitHub mirror of name to have the
+// Gerrit project's master branch at or after head, as pushed by
+// gitmirror, which happens once gitmirror is deployed with the change
+// to the repos package, or sooner if name matches its
+// -auto-add-projects.
+func (x *OnboardRepoTasks) AwaitGitHubMirror(ctx *wf.TaskContext, name, head string) (string, error) {
+	ctx.Printf("Awaiting mirroring of %s to GitHub. Unless %s matches its -auto-add-projects, gitmirror must be redeployed to pick up the change to the repos package.", head, name)
+	return AwaitCondition(ctx, 30*time.Second, func() (string, bool, error) {
+		got, err := x.GitHub.ReadBranchHead(ctx, x.GitHubOrg, name, "master")
+		if err != nil || got == "" {
+			return "", false, err
+		}
+		if got != head {
+			// The branch may have moved on since; accept any
+			// commit that Gerrit has.
+			commits, err := x.Gerrit.GetCommitsInRefs(ctx, name, []string{got}, []string{"refs/heads/master"})
+			if err != nil || len(commits[got]) == 0 {
+				return "", false, nil
+			}
+		}
+		return got, true, nil
+	})
+}
+
+// MailReposCL mails a CL adding name to the repos package, unless it's
+// already there, and returns its change ID.
+func (x *OnboardRepoTasks) MailReposCL(ctx *wf.TaskContext, name, desc string, reviewers []string) (string, error) {
+	const file = "repos/repos.go"
+	head, err := x.Gerrit.ReadBranchHead(ctx, x.BuildProject, "master")
+	if err != nil {
+		return "", err
+	}
+	src, err := x.Gerrit.ReadFile(ctx, x.BuildProject, head, file)
+	if err != nil {
+		return "", err
+	}
+	newSrc, err := addXRepo(string(src), name, desc)
+	if err != nil {
+		ctx.DisableRetries()
+		return "", err
+	}
+	if newSrc == string(src) {
+		ctx.Printf("golang.org/x/%s is already in %s.", name, file)
+		return "", nil
+	}
+	return x.Gerrit.CreateAutoSubmitChange(ctx, gerrit.ChangeInput{
+		Project: x.BuildProject,
+		Branch:  "master",
+		Subject: fmt.Sprintf("repos: add %s\n\nThis is an automated CL which adds golang.org/x/%s, so that\nit's built by the coordinator and shown on the dashboard.", name, name),
+	}, reviewers, map[string]string{file: newSrc})
+}
+
+// addXRepo returns src, the source of the repos package, with an
+// x(name) entry added among the others in sorted order.
+// If there already is one, it returns src unchanged.
+func addXRepo(src, name, desc string) (string, error) {
+	line := fmt.Sprintf("\tx(%q)", name)
+	if desc != "" {
+		line = fmt.Sprintf("\tx(%q, desc(%s))", name, strconv.Quote(desc))
+	}
+	existing := fmt.Sprintf("\tx(%q", name)
+	lines := strings.Split(src, "\n")
+	var xs []int // indexes of the x(...) lines
+	for i, l := range lines {
+		if !strings.HasPrefix(l, "\tx(\"") {
+			continue
+		}
+		if strings.HasPrefix(l, existing+")") || strings.HasPrefix(l, existing+",") {
+			return src, nil
+		}
+		xs = append(xs, i)
+	}
+	if len(xs) == 0 {
+		return "", errors.New("found no x(...) entries in the repos package")
+	}
+	// Insert before the first entry that sorts after line, or
+	// after the last one.
+	j := sort.Search(len(xs), func(j int) bool { return lines[xs[j]] > line })
+	at := xs[len(xs)-1] + 1
+	if j < len(xs) {
+		at = xs[j]
+	}
+	lines = append(lines[:at], append([]string{line}, lines[at:]...)...)
+	return strings.Join(lines, "\n"), nil
+}
+
+// AwaitCL waits for the specified CL to be submitted, and returns the
+// new branch head. If changeID is blank because no CL was needed,
+// it returns immediately.
+func (x *OnboardRepoTasks) AwaitCL(ctx *wf.TaskContext, changeID string) (string, error) {
+	if changeID == "" {
+		ctx.Printf("No CL was necessary")
+		return "", nil
+	}
+	ctx.Printf("Awaiting review/submit of %v", ChangeLink(changeID))
+	return AwaitCondition(ctx, 10*time.Second, func() (string, bool, error) {
+		return x.Gerrit.Submitted(ctx, changeID, "")
+	})
+}
+
+// AwaitDashboard waits for name to show up on the build dashboard,
+// which happens once the coordinator is deployed with the change to the
+// repos package.
+func (x *OnboardRepoTasks) AwaitDashboard(ctx *wf.TaskContext, name string) (string, error) {
+	ctx.Printf("Awaiting %s on the dashboard. The coordinator must be redeployed to pick up the change to the repos package.", name)
+	return AwaitCondition(ctx, 5*time.Minute, func() (string, bool, error) {
+		status, err := getBuildStatus(x.DashboardURL, "")
+		if err != nil {
+			ctx.Printf("Reading dashboard: %v", err)
+			return "", false, nil
+		}
+		for _, rev := range status.Revisions {
+			if rev.Repo == name {
+				return x.DashboardURL + "/?repo=golang.org/x/" + name, true, nil
+			}
+		}
+		return "", false, nil
+	})
+}
+
+// AwaitMaintner waits for maintner to track the Gerrit project name,
+// which happens once maintnerd is deployed with the change to the
+// repos package.
+func (x *OnboardRepoTasks) AwaitMaintner(ctx *wf.TaskContext, name string) (string, error) {
+	ctx.Printf("Awaiting maintner tracking of %s. maintnerd must be redeployed to pick up the change to the repos package.", name)
+	return AwaitCondition(ctx, 5*time.Minute, func() (string, bool, error) {
+		res, err := x.Maintner.GetRef(ctx, &apipb.GetRefRequest{
+			GerritServer:  "go.googlesource.com",
+			GerritProject: name,
+			Ref:           "refs/heads/master",
+		})
+		if err != nil || res.Value == "" {
+			return "", false, nil
+		}
+		return res.Value, true, nil
+	})
+}
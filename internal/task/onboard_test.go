@@ -0,0 +1,197 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package task
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-github/github"
+	"golang.org/x/build/internal/workflow"
+	"golang.org/x/build/maintner/maintnerd/apipb"
+	"golang.org/x/build/types"
+	"google.golang.org/grpc"
+)
+
+const testReposSource = `package repos
+
+func init() {
+	addMirrored("go", coordinatorCanBuild, noDash)
+
+	x("arch")
+	x("build", desc("build.golang.org's implementation"))
+	x("tools", desc("godoc, goimports, gorename, and other tools"))
+
+	add(&Repo{GoGerritProject: "gollvm"})
+}
+`
+
+func TestAddXRepo(t *testing.T) {
+	for _, tt := range []struct {
+		name, desc string
+		want       string // the added line, or "" if src is unchanged
+		before     string // the line after the added line
+	}{
+		{"sync", "additional concurrency primitives", `	x("sync", desc("additional concurrency primitives"))`, `	x("tools", desc("godoc, goimports, gorename, and other tools"))`},
+		{"aaa", "", `	x("aaa")`, `	x("arch")`},
+		{"zzz", `"quoted"`, `	x("zzz", desc("\"quoted\""))`, ``},
+		{"build", "anything", "", ""},
+		{"arch", "", "", ""},
+	} {
+		got, err := addXRepo(testReposSource, tt.name, tt.desc)
+		if err != nil {
+			t.Fatalf("addXRepo(%q) = %v", tt.name, err)
+		}
+		if tt.want == "" {
+			if got != testReposSource {
+				t.Errorf("addXRepo(%q) changed the source of an existing repo:\n%s", tt.name, got)
+			}
+			continue
+		}
+		lines := strings.Split(got, "\n")
+		for i, l := range lines {
+			if l == tt.want {
+				if lines[i+1] != tt.before {
+					t.Errorf("addXRepo(%q) added %q before %q; want before %q", tt.name, l, lines[i+1], tt.before)
+				}
+				break
+			}
+			if i == len(lines)-1 {
+				t.Errorf("addXRepo(%q) didn't add %q:\n%s", tt.name, tt.want, got)
+			}
+		}
+	}
+	if _, err := addXRepo("package repos\n", "new", ""); err == nil {
+		t.Errorf("addXRepo of a source without x entries succeeded; want error")
+	}
+}
+
+// fakeGitHubRepos is a GitHubRepoClient whose repos mirror the
+// projects of a FakeGerrit.
+type fakeGitHubRepos struct {
+	gerrit *FakeGerrit
+	repos  map[string]*github.Repository
+	edits  int
+}
+
+func (g *fakeGitHubRepos) GetRepo(_ context.Context, owner, repo string) (*github.Repository, error) {
+	return g.repos[owner+"/"+repo], nil
+}
+
+func (g *fakeGitHubRepos) CreateRepo(_ context.Context, org string, repo *github.Repository) error {
+	r := *repo
+	g.repos[org+"/"+repo.GetName()] = &r
+	return nil
+}
+
+func (g *fakeGitHubRepos) EditRepo(_ context.Context, owner, repo string, settings *github.Repository) error {
+	g.edits++
+	r := *settings
+	g.repos[owner+"/"+repo] = &r
+	return nil
+}
+
+func (g *fakeGitHubRepos) ReadBranchHead(ctx context.Context, owner, repo, branch string) (string, error) {
+	if g.repos[owner+"/"+repo] == nil {
+		return "", nil
+	}
+	return g.gerrit.ReadBranchHead(ctx, repo, branch)
+}
+
+// fakeMaintner is a maintner that tracks the projects of a FakeGerrit.
+type fakeMaintner struct {
+	apipb.MaintnerServiceClient
+	gerrit *FakeGerrit
+}
+
+func (m *fakeMaintner) GetRef(ctx context.Context, req *apipb.GetRefRequest, _ ...grpc.CallOption) (*apipb.GetRefResponse, error) {
+	head, err := m.gerrit.ReadBranchHead(ctx, req.GerritProject, strings.TrimPrefix(req.Ref, "refs/heads/"))
+	if err != nil {
+		return nil, err
+	}
+	return &apipb.GetRefResponse{Value: head}, nil
+}
+
+func TestOnboardRepo(t *testing.T) {
+	AwaitDivisor = 100
+	t.Cleanup(func() { AwaitDivisor = 1 })
+
+	build := NewFakeRepo(t, "build")
+	build.Commit(map[string]string{"repos/repos.go": testReposSource})
+	fakeGerrit := NewFakeGerrit(t, build)
+	fakeGitHub := &fakeGitHubRepos{gerrit: fakeGerrit, repos: map[string]*github.Repository{}}
+	dash := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(types.BuildStatus{Revisions: []types.BuildRevision{{Repo: "go"}, {Repo: "newrepo"}}})
+	}))
+	t.Cleanup(dash.Close)
+	tasks := &OnboardRepoTasks{
+		Gerrit:       fakeGerrit,
+		GitHub:       fakeGitHub,
+		GitHubOrg:    "golang",
+		BuildProject: "build",
+		DashboardURL: dash.URL,
+		Maintner:     &fakeMaintner{gerrit: fakeGerrit},
+	}
+
+	run := func() map[string]interface{} {
+		t.Helper()
+		w, err := workflow.Start(tasks.NewDefinition(), map[string]interface{}{
+			"Repository name":   "newrepo",
+			"Description":       "a new repository",
+			reviewersParam.Name: []string(nil),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		out, err := w.Run(ctx, &verboseListener{t: t})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return out
+	}
+	out := run()
+
+	head, err := fakeGerrit.ReadBranchHead(context.Background(), "newrepo", "master")
+	if err != nil {
+		t.Fatalf("Gerrit project wasn't created: %v", err)
+	}
+	want := map[string]interface{}{
+		"GitHub mirror": head,
+		"Dashboard":     dash.URL + "/?repo=golang.org/x/newrepo",
+		"Maintner":      head,
+	}
+	if diff := cmp.Diff(want, out); diff != "" {
+		t.Errorf("workflow outputs mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(mirrorSettings("newrepo", "a new repository"), fakeGitHub.repos["golang/newrepo"]); diff != "" {
+		t.Errorf("GitHub repo settings mismatch (-want +got):\n%s", diff)
+	}
+	src, err := fakeGerrit.ReadFile(context.Background(), "build", build.History()[0], "repos/repos.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(src), `x("newrepo", desc("a new repository"))`) {
+		t.Errorf("newrepo wasn't added to the repos package:\n%s", src)
+	}
+
+	// Running the workflow again is a no-op, apart from reapplying
+	// the GitHub settings.
+	buildHead := build.History()[0]
+	run()
+	if got := build.History()[0]; got != buildHead {
+		t.Errorf("second run changed x/build")
+	}
+	if fakeGitHub.edits != 1 {
+		t.Errorf("second run made %d edits to the GitHub repo; want 1", fakeGitHub.edits)
+	}
+}
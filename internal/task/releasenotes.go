@@ -0,0 +1,165 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package task
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+
+	"golang.org/x/build/gerrit"
+	"golang.org/x/build/internal/relnote"
+	wf "golang.org/x/build/internal/workflow"
+)
+
+// ReleaseNotesOutput is the name of the workflow output that holds the
+// ReleaseNotes drafted by ReleaseNotesTasks.
+const ReleaseNotesOutput = "Release notes"
+
+// ReleaseNotes is a draft of the release notes of a major Go release.
+type ReleaseNotes struct {
+	Version  int    // the x in Go 1.x
+	Markdown string // the draft, in Markdown
+}
+
+// ReleaseNotesGerrit is the part of the Gerrit API used to draft
+// release notes. It's implemented by *gerrit.Client.
+type ReleaseNotesGerrit interface {
+	QueryChanges(ctx context.Context, q string, opts ...gerrit.QueryChangesOpt) ([]*gerrit.ChangeInfo, error)
+	ListChangeComments(ctx context.Context, changeID string) (map[string][]gerrit.CommentInfo, error)
+	GetBranch(ctx context.Context, project, branch string) (gerrit.BranchInfo, error)
+	GetFileContent(ctx context.Context, project, commit, path string) (io.ReadCloser, error)
+}
+
+// ReleaseNotesTasks drafts the release notes of the Go release in
+// development from the RELNOTE annotations of the CLs merged during
+// its development cycle and from the api/next files they added.
+type ReleaseNotesTasks struct {
+	Gerrit          ReleaseNotesGerrit
+	GoProject       string
+	GetDevelVersion func(context.Context) (int, error)
+}
+
+func (t *ReleaseNotesTasks) NewDefinition() *wf.Definition {
+	wd := wf.New()
+	version := wf.Task0(wd, "Get development version", t.GetDevelVersion)
+	notes := wf.Task1(wd, "Draft release notes", t.DraftReleaseNotes, version)
+	wf.Output(wd, ReleaseNotesOutput, notes)
+	return wd
+}
+
+// queryPageSize is the number of changes requested from Gerrit at once.
+const queryPageSize = 500
+
+// DraftReleaseNotes drafts the release notes of Go 1.x.
+func (t *ReleaseNotesTasks) DraftReleaseNotes(ctx *wf.TaskContext, x int) (ReleaseNotes, error) {
+	since := relnote.DevCycleStart(x)
+	changes, err := t.mergedChanges(ctx, fmt.Sprintf(
+		`project:%s branch:master status:merged after:%s (message:RELNOTE OR message:RELNOTES OR comment:RELNOTE OR comment:RELNOTES OR file:^api/next/.*)`,
+		t.GoProject, since.Format("2006-01-02")))
+	if err != nil {
+		return ReleaseNotes{}, err
+	}
+	ctx.Printf("Found %d changes merged since %s with release notes or API additions.", len(changes), since.Format("2006-01-02"))
+
+	var notes []relnote.Note
+	apiFiles := make(map[string]bool)
+	for _, ci := range changes {
+		rev, ok := ci.Revisions[ci.CurrentRevision]
+		if !ok || rev.Commit == nil {
+			return ReleaseNotes{}, fmt.Errorf("CL %d: no current revision in query result", ci.ChangeNumber)
+		}
+		for f := range rev.Files {
+			if strings.HasPrefix(f, "api/next/") && path.Ext(f) == ".txt" {
+				apiFiles[f] = true
+			}
+		}
+		note := relnote.ParseRelNote(rev.Commit.Message)
+		if note == "" {
+			// Since July 2020, RELNOTE annotations added in review are
+			// patchset-level inline comments.
+			comments, err := t.Gerrit.ListChangeComments(ctx, ci.ID)
+			if err != nil {
+				return ReleaseNotes{}, err
+			}
+			note = commentRelNote(comments)
+		}
+		if note != "" {
+			notes = append(notes, relnote.CLNote(ci.ChangeNumber, ci.Subject, note))
+		}
+	}
+
+	// Read the API files at master, where they may have been fixed up
+	// since the CLs that added them.
+	head, err := t.Gerrit.GetBranch(ctx, t.GoProject, "master")
+	if err != nil {
+		return ReleaseNotes{}, err
+	}
+	var files []string
+	for f := range apiFiles {
+		files = append(files, f)
+	}
+	sort.Strings(files)
+	for _, f := range files {
+		data, err := readFile(ctx, t.Gerrit, t.GoProject, head.Revision, f)
+		if errors.Is(err, gerrit.ErrResourceNotExist) {
+			continue // Removed, or already merged into api/go1.x.txt.
+		} else if err != nil {
+			return ReleaseNotes{}, err
+		}
+		api, err := relnote.ParseAPI(data)
+		if err != nil {
+			return ReleaseNotes{}, fmt.Errorf("%s: %v", f, err)
+		}
+		notes = append(notes, api...)
+	}
+	ctx.Printf("Drafted %d notes from %d changes and %d API files.", len(notes), len(changes), len(files))
+	return ReleaseNotes{Version: x, Markdown: relnote.Markdown(x, notes)}, nil
+}
+
+// mergedChanges returns all the changes matching query, with their
+// current revisions' commit messages and files.
+func (t *ReleaseNotesTasks) mergedChanges(ctx context.Context, query string) ([]*gerrit.ChangeInfo, error) {
+	var all []*gerrit.ChangeInfo
+	for {
+		changes, err := t.Gerrit.QueryChanges(ctx, query, gerrit.QueryChangesOpt{
+			N:      queryPageSize,
+			Start:  len(all),
+			Fields: []string{"CURRENT_REVISION", "CURRENT_COMMIT", "CURRENT_FILES"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, changes...)
+		if len(changes) == 0 || !changes[len(changes)-1].MoreChanges {
+			return all, nil
+		}
+	}
+}
+
+// commentRelNote returns the RELNOTE annotation in comments, if any.
+func commentRelNote(comments map[string][]gerrit.CommentInfo) string {
+	for _, cs := range comments {
+		for _, c := range cs {
+			if note := relnote.ParseRelNote(c.Message); note != "" {
+				return note
+			}
+		}
+	}
+	return ""
+}
+
+func readFile(ctx context.Context, g ReleaseNotesGerrit, project, commit, file string) ([]byte, error) {
+	body, err := g.GetFileContent(ctx, project, commit, file)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	return io.ReadAll(body)
+}
@@ -0,0 +1,117 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package task
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.org/x/build/gerrit"
+	wf "golang.org/x/build/internal/workflow"
+)
+
+// fakeReleaseNotesGerrit serves changes, their comments, and the files
+// at master.
+type fakeReleaseNotesGerrit struct {
+	changes  []*gerrit.ChangeInfo
+	comments map[string]map[string][]gerrit.CommentInfo // change ID → comments
+	files    map[string]string                          // files at master
+}
+
+func (g *fakeReleaseNotesGerrit) QueryChanges(_ context.Context, q string, opts ...gerrit.QueryChangesOpt) ([]*gerrit.ChangeInfo, error) {
+	// Serve a page at a time, to exercise pagination.
+	start := opts[0].Start
+	if start >= len(g.changes) {
+		return nil, nil
+	}
+	c := *g.changes[start]
+	c.MoreChanges = start+1 < len(g.changes)
+	return []*gerrit.ChangeInfo{&c}, nil
+}
+
+func (g *fakeReleaseNotesGerrit) ListChangeComments(_ context.Context, changeID string) (map[string][]gerrit.CommentInfo, error) {
+	return g.comments[changeID], nil
+}
+
+func (g *fakeReleaseNotesGerrit) GetBranch(_ context.Context, project, branch string) (gerrit.BranchInfo, error) {
+	return gerrit.BranchInfo{Ref: "refs/heads/" + branch, Revision: "abcdef"}, nil
+}
+
+func (g *fakeReleaseNotesGerrit) GetFileContent(_ context.Context, project, commit, path string) (io.ReadCloser, error) {
+	if commit != "abcdef" {
+		return nil, gerrit.ErrResourceNotExist
+	}
+	f, ok := g.files[path]
+	if !ok {
+		return nil, gerrit.ErrResourceNotExist
+	}
+	return io.NopCloser(strings.NewReader(f)), nil
+}
+
+func mergedChange(number int, subject, message string, files ...string) *gerrit.ChangeInfo {
+	rev := gerrit.RevisionInfo{
+		Commit: &gerrit.CommitInfo{Subject: subject, Message: subject + "\n\n" + message},
+		Files:  make(map[string]*gerrit.FileInfo),
+	}
+	for _, f := range files {
+		rev.Files[f] = &gerrit.FileInfo{}
+	}
+	return &gerrit.ChangeInfo{
+		ID:              "go~master~I" + subject,
+		ChangeNumber:    number,
+		Subject:         subject,
+		CurrentRevision: "rev",
+		Revisions:       map[string]gerrit.RevisionInfo{"rev": rev},
+	}
+}
+
+func TestDraftReleaseNotes(t *testing.T) {
+	g := &fakeReleaseNotesGerrit{
+		changes: []*gerrit.ChangeInfo{
+			mergedChange(100, "cmd/go: add a flag", "RELNOTE=yes"),
+			mergedChange(101, "net/http: add PathValue", "For #61410.", "api/next/61410.txt"),
+			mergedChange(102, "runtime: tune the GC", "Noted in review."),
+			mergedChange(103, "os: add API that was later removed", "", "api/next/99999.txt"),
+		},
+		comments: map[string]map[string][]gerrit.CommentInfo{
+			"go~master~Iruntime: tune the GC": {"/PATCHSET_LEVEL": {{Message: "RELNOTE=the GC uses less memory"}}},
+		},
+		files: map[string]string{
+			"api/next/61410.txt": "pkg net/http, method (*Request) PathValue(string) string #61410\npkg net/http, method (*Request) SetPathValue(string, string) #61410\n",
+		},
+	}
+	tasks := &ReleaseNotesTasks{Gerrit: g, GoProject: "go"}
+	ctx := &wf.TaskContext{Context: context.Background(), Logger: &testLogger{t, ""}}
+	got, err := tasks.DraftReleaseNotes(ctx, 22)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := ReleaseNotes{Version: 22, Markdown: `# Go 1.22 release notes (draft)
+
+## Tools
+
+### cmd/go
+
+- TODO: add a flag ([CL 100](https://go.dev/cl/100))
+
+## Standard library
+
+### net/http
+
+- TODO: new API ([#61410](https://go.dev/issue/61410))
+  - ` + "`method (*Request) PathValue(string) string`" + `
+  - ` + "`method (*Request) SetPathValue(string, string)`" + `
+
+### runtime
+
+- TODO: tune the GC; the GC uses less memory ([CL 102](https://go.dev/cl/102))
+`}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("DraftReleaseNotes mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,282 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package task
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"strings"
+	"sync"
+
+	"cloud.google.com/go/storage"
+	"golang.org/x/build/gerrit"
+	"golang.org/x/build/internal/gcsfs"
+	"golang.org/x/build/internal/relui/sign"
+	wf "golang.org/x/build/internal/workflow"
+)
+
+// Services are the external services that workflow definitions call.
+// The tasks of a definition embed them, rather than holding clients of
+// their own, so that tests can swap in fakes for all of them at once,
+// and check the calls the definition makes with Record.
+type Services struct {
+	Gerrit     GerritClient
+	Storage    Storage
+	Sign       sign.Service
+	CloudBuild CloudBuildClient
+}
+
+// Record returns a copy of s whose services log each call made to them
+// in log. Services that are nil in s stay nil.
+func (s Services) Record(log *CallLog) Services {
+	r := Services{}
+	if s.Gerrit != nil {
+		r.Gerrit = &recordedGerrit{s.Gerrit, log}
+	}
+	if s.Storage != nil {
+		r.Storage = &recordedStorage{s.Storage, log}
+	}
+	if s.Sign != nil {
+		r.Sign = &recordedSign{s.Sign, log}
+	}
+	if s.CloudBuild != nil {
+		r.CloudBuild = &recordedCloudBuild{s.CloudBuild, log}
+	}
+	return r
+}
+
+// Storage opens the file systems that workflows read and write files
+// in, such as release artifacts.
+type Storage interface {
+	// FS returns the file system at baseURL, a gs:// or file:// URL.
+	// It uses ctx for all of its operations.
+	FS(ctx context.Context, baseURL string) (fs.FS, error)
+}
+
+// GCSStorage returns a Storage that opens gs:// URLs with client, and
+// file:// URLs in the local file system, like gcsfs.FromURL. client
+// may be nil if only file:// URLs are opened.
+func GCSStorage(client *storage.Client) Storage {
+	return gcsStorage{client}
+}
+
+type gcsStorage struct {
+	client *storage.Client
+}
+
+func (s gcsStorage) FS(ctx context.Context, baseURL string) (fs.FS, error) {
+	return gcsfs.FromURL(ctx, s.client, baseURL)
+}
+
+// A CallLog records calls made to external services, for tests to check.
+type CallLog struct {
+	mu    sync.Mutex
+	calls []Call
+}
+
+// A Call is a call made to an external service.
+type Call struct {
+	// Task is the name of the task that made the call, if it passed
+	// its *workflow.TaskContext to the service.
+	Task    string
+	Service string // "Gerrit", "Storage", "Sign" or "CloudBuild"
+	Method  string
+	// Args are the JSON encodings of the arguments that follow the
+	// context.
+	Args []string
+}
+
+// String returns c as Service.Method(args...), such as
+// Gerrit.Tag("go", "go1.21.0", "abc123").
+func (c Call) String() string {
+	return fmt.Sprintf("%s.%s(%s)", c.Service, c.Method, strings.Join(c.Args, ", "))
+}
+
+// Calls returns the calls logged so far, in the order they were made.
+func (l *CallLog) Calls() []Call {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]Call(nil), l.calls...)
+}
+
+// TaskCalls returns the calls made by the named task, in order, in the
+// format of Call.String. Unlike the order of all calls, which depends
+// on how the workflow's tasks get scheduled, it's deterministic for
+// definitions whose tasks are. Consecutive identical calls are listed
+// once, since how many times a task polls a service, such as with
+// AwaitCondition, depends on timing.
+func (l *CallLog) TaskCalls(task string) []string {
+	var calls []string
+	for _, c := range l.Calls() {
+		if c.Task != task {
+			continue
+		}
+		if s := c.String(); len(calls) == 0 || calls[len(calls)-1] != s {
+			calls = append(calls, s)
+		}
+	}
+	return calls
+}
+
+func (l *CallLog) record(ctx context.Context, service, method string, args ...interface{}) {
+	c := Call{Service: service, Method: method}
+	if tctx, ok := ctx.(*wf.TaskContext); ok && tctx != nil {
+		c.Task = tctx.TaskName
+	}
+	for _, a := range args {
+		b, err := json.Marshal(a)
+		if err != nil {
+			b = []byte(fmt.Sprintf("%#v", a))
+		}
+		c.Args = append(c.Args, string(b))
+	}
+	l.mu.Lock()
+	l.calls = append(l.calls, c)
+	l.mu.Unlock()
+}
+
+type recordedGerrit struct {
+	GerritClient
+	log *CallLog
+}
+
+func (g *recordedGerrit) CreateAutoSubmitChange(ctx *wf.TaskContext, input gerrit.ChangeInput, reviewers []string, contents map[string]string) (string, error) {
+	g.log.record(ctx, "Gerrit", "CreateAutoSubmitChange", input, reviewers, contents)
+	return g.GerritClient.CreateAutoSubmitChange(ctx, input, reviewers, contents)
+}
+
+func (g *recordedGerrit) Submitted(ctx context.Context, changeID, parentCommit string) (string, bool, error) {
+	g.log.record(ctx, "Gerrit", "Submitted", changeID, parentCommit)
+	return g.GerritClient.Submitted(ctx, changeID, parentCommit)
+}
+
+func (g *recordedGerrit) GetTag(ctx context.Context, project, tag string) (gerrit.TagInfo, error) {
+	g.log.record(ctx, "Gerrit", "GetTag", project, tag)
+	return g.GerritClient.GetTag(ctx, project, tag)
+}
+
+func (g *recordedGerrit) Tag(ctx context.Context, project, tag, commit string) error {
+	g.log.record(ctx, "Gerrit", "Tag", project, tag, commit)
+	return g.GerritClient.Tag(ctx, project, tag, commit)
+}
+
+func (g *recordedGerrit) ListTags(ctx context.Context, project string) ([]string, error) {
+	g.log.record(ctx, "Gerrit", "ListTags", project)
+	return g.GerritClient.ListTags(ctx, project)
+}
+
+func (g *recordedGerrit) ReadBranchHead(ctx context.Context, project, branch string) (string, error) {
+	g.log.record(ctx, "Gerrit", "ReadBranchHead", project, branch)
+	return g.GerritClient.ReadBranchHead(ctx, project, branch)
+}
+
+func (g *recordedGerrit) ListProjects(ctx context.Context) ([]string, error) {
+	g.log.record(ctx, "Gerrit", "ListProjects")
+	return g.GerritClient.ListProjects(ctx)
+}
+
+func (g *recordedGerrit) GetProjectInfo(ctx context.Context, project string) (gerrit.ProjectInfo, error) {
+	g.log.record(ctx, "Gerrit", "GetProjectInfo", project)
+	return g.GerritClient.GetProjectInfo(ctx, project)
+}
+
+func (g *recordedGerrit) CreateProject(ctx context.Context, project string, input gerrit.ProjectInput) error {
+	g.log.record(ctx, "Gerrit", "CreateProject", project, input)
+	return g.GerritClient.CreateProject(ctx, project, input)
+}
+
+func (g *recordedGerrit) ReadFile(ctx context.Context, project, commit, file string) ([]byte, error) {
+	g.log.record(ctx, "Gerrit", "ReadFile", project, commit, file)
+	return g.GerritClient.ReadFile(ctx, project, commit, file)
+}
+
+func (g *recordedGerrit) GetCommitsInRefs(ctx context.Context, project string, commits, refs []string) (map[string][]string, error) {
+	g.log.record(ctx, "Gerrit", "GetCommitsInRefs", project, commits, refs)
+	return g.GerritClient.GetCommitsInRefs(ctx, project, commits, refs)
+}
+
+func (g *recordedGerrit) QueryChanges(ctx context.Context, query string) ([]*gerrit.ChangeInfo, error) {
+	g.log.record(ctx, "Gerrit", "QueryChanges", query)
+	return g.GerritClient.QueryChanges(ctx, query)
+}
+
+func (g *recordedGerrit) SetHashtags(ctx context.Context, changeID string, hashtags gerrit.HashtagsInput) error {
+	g.log.record(ctx, "Gerrit", "SetHashtags", changeID, hashtags)
+	return g.GerritClient.SetHashtags(ctx, changeID, hashtags)
+}
+
+type recordedStorage struct {
+	Storage
+	log *CallLog
+}
+
+// FS returns a file system that records the files opened, created and
+// removed in it, by their names relative to baseURL.
+func (s *recordedStorage) FS(ctx context.Context, baseURL string) (fs.FS, error) {
+	fsys, err := s.Storage.FS(ctx, baseURL)
+	if err != nil {
+		return nil, err
+	}
+	return &recordedFS{fsys, ctx, baseURL, s.log}, nil
+}
+
+type recordedFS struct {
+	fsys    fs.FS
+	ctx     context.Context
+	baseURL string
+	log     *CallLog
+}
+
+func (r *recordedFS) Open(name string) (fs.File, error) {
+	r.log.record(r.ctx, "Storage", "Open", r.baseURL, name)
+	return r.fsys.Open(name)
+}
+
+func (r *recordedFS) Create(name string) (gcsfs.WriterFile, error) {
+	r.log.record(r.ctx, "Storage", "Create", r.baseURL, name)
+	return gcsfs.Create(r.fsys, name)
+}
+
+func (r *recordedFS) Remove(name string) error {
+	r.log.record(r.ctx, "Storage", "Remove", r.baseURL, name)
+	return gcsfs.Remove(r.fsys, name)
+}
+
+type recordedSign struct {
+	sign.Service
+	log *CallLog
+}
+
+func (s *recordedSign) SignArtifact(ctx context.Context, bt sign.BuildType, objectURI []string) (string, error) {
+	s.log.record(ctx, "Sign", "SignArtifact", bt.String(), objectURI)
+	return s.Service.SignArtifact(ctx, bt, objectURI)
+}
+
+func (s *recordedSign) ArtifactSigningStatus(ctx context.Context, jobID string) (sign.Status, string, []string, error) {
+	s.log.record(ctx, "Sign", "ArtifactSigningStatus", jobID)
+	return s.Service.ArtifactSigningStatus(ctx, jobID)
+}
+
+func (s *recordedSign) CancelSigning(ctx context.Context, jobID string) error {
+	s.log.record(ctx, "Sign", "CancelSigning", jobID)
+	return s.Service.CancelSigning(ctx, jobID)
+}
+
+type recordedCloudBuild struct {
+	CloudBuildClient
+	log *CallLog
+}
+
+func (c *recordedCloudBuild) RunBuildTrigger(ctx context.Context, project, trigger string, substitutions map[string]string) (string, error) {
+	c.log.record(ctx, "CloudBuild", "RunBuildTrigger", project, trigger, substitutions)
+	return c.CloudBuildClient.RunBuildTrigger(ctx, project, trigger, substitutions)
+}
+
+func (c *recordedCloudBuild) Completed(ctx context.Context, project, buildID string) (string, bool, error) {
+	c.log.record(ctx, "CloudBuild", "Completed", project, buildID)
+	return c.CloudBuildClient.Completed(ctx, project, buildID)
+}
@@ -0,0 +1,61 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package task
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	wf "golang.org/x/build/internal/workflow"
+)
+
+func TestServicesRecord(t *testing.T) {
+	goRepo := NewFakeRepo(t, "go")
+	goRepo.Commit(map[string]string{"README": "hi"})
+	var calls CallLog
+	s := Services{
+		Gerrit:     NewFakeGerrit(t, goRepo),
+		Sign:       NewFakeSignService(t),
+		CloudBuild: &FakeCloudBuild{Project: "p", AllowedBuilds: map[string]map[string]string{"t": {"_V": "1"}}},
+	}.Record(&calls)
+	if s.Storage != nil {
+		t.Errorf("Record made a nil Storage non-nil")
+	}
+
+	ctx := &wf.TaskContext{Context: context.Background(), TaskName: "task"}
+	if _, err := s.Gerrit.ReadBranchHead(ctx, "go", "master"); err != nil {
+		t.Fatal(err)
+	}
+	id, err := s.CloudBuild.RunBuildTrigger(ctx, "p", "t", map[string]string{"_V": "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		s.CloudBuild.Completed(ctx, "p", id)
+	}
+	// Calls that don't carry a TaskContext aren't attributed to a task.
+	s.Gerrit.ListTags(context.Background(), "go")
+	s.Sign.ArtifactSigningStatus(&wf.TaskContext{Context: context.Background(), TaskName: "other"}, "job")
+
+	want := []string{
+		`Gerrit.ReadBranchHead("go", "master")`,
+		`CloudBuild.RunBuildTrigger("p", "t", {"_V":"1"})`,
+		`CloudBuild.Completed("p", "build-12345")`,
+	}
+	if diff := cmp.Diff(want, calls.TaskCalls("task")); diff != "" {
+		t.Errorf("TaskCalls mismatch (-want +got):\n%s", diff)
+	}
+	if got := calls.TaskCalls("other"); len(got) != 1 || got[0] != `Sign.ArtifactSigningStatus("job")` {
+		t.Errorf(`TaskCalls("other") = %q`, got)
+	}
+	all := calls.Calls()
+	if len(all) != 7 {
+		t.Errorf("Calls() returned %d calls; want 7", len(all))
+	}
+	if c := all[5]; c.Task != "" || c.String() != `Gerrit.ListTags("go")` {
+		t.Errorf("Calls()[5] = %+v; want an unattributed ListTags call", c)
+	}
+}
@@ -0,0 +1,73 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package task
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"golang.org/x/build/internal/relui/sign"
+	wf "golang.org/x/build/internal/workflow"
+)
+
+// SignArtifacts submits the artifacts at the gs:// URLs in to signing
+// service s to be signed as bt, waits for the signing job to finish,
+// and returns the gs:// URLs of the signed artifacts.
+//
+// The status of the job is checked with exponential backoff, and its
+// changes are logged with the job, type, status, description, and
+// elapsed time as fields.
+//
+// If ctx is canceled while waiting, the job is canceled too.
+func SignArtifacts(ctx *wf.TaskContext, s sign.Service, bt sign.BuildType, in []string) ([]string, error) {
+	jobID, err := s.SignArtifact(ctx, bt, in)
+	if err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	ctx.Log(wf.LevelInfo, "signing job submitted", "job", jobID, "type", bt, "artifacts", len(in))
+
+	var lastStatus sign.Status
+	var lastDesc string
+	out, err := AwaitConditionBackoff(ctx, 10*time.Second, 2*time.Minute, func() (out []string, done bool, _ error) {
+		statusContext, cancel := context.WithTimeout(ctx, time.Minute)
+		defer cancel()
+		t := time.Now()
+		status, desc, out, err := s.ArtifactSigningStatus(statusContext, jobID)
+		if err != nil {
+			ctx.Log(wf.LevelWarn, "checking signing job status failed; will retry", "job", jobID, "type", bt, "error", err, "elapsed", time.Since(t).Round(time.Millisecond))
+			return nil, false, nil
+		}
+		if status != lastStatus || desc != lastDesc {
+			ctx.Log(wf.LevelInfo, "signing job status", "job", jobID, "type", bt, "status", status, "description", desc, "elapsed", time.Since(start).Round(time.Second))
+			lastStatus, lastDesc = status, desc
+		}
+		switch status {
+		case sign.StatusCompleted:
+			return out, true, nil // All done.
+		case sign.StatusFailed:
+			if desc != "" {
+				return nil, true, fmt.Errorf("signing attempt failed: %s", desc)
+			}
+			return nil, true, fmt.Errorf("signing attempt failed")
+		default:
+			return nil, false, nil // Still waiting.
+		}
+	})
+	if err != nil {
+		// If ctx is canceled, also cancel the signing request.
+		if ctx.Err() != nil {
+			cancelContext, cancel := context.WithTimeout(context.Background(), time.Minute)
+			defer cancel()
+			t := time.Now()
+			if err := s.CancelSigning(cancelContext, jobID); err != nil {
+				ctx.Log(wf.LevelWarn, "canceling signing job failed", "job", jobID, "type", bt, "error", err, "elapsed", time.Since(t).Round(time.Millisecond))
+			}
+		}
+		return nil, err
+	}
+	return out, nil
+}
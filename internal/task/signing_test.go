@@ -0,0 +1,151 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package task
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.org/x/build/internal/relui/sign"
+	"golang.org/x/build/internal/workflow"
+)
+
+// scriptedSignService is a sign.Service whose one job goes through a
+// scripted sequence of statuses and descriptions.
+type scriptedSignService struct {
+	statuses []sign.Status
+	descs    []string
+	polls    int
+	onPoll   func() // if non-nil, called on each poll
+	canceled bool
+}
+
+func (s *scriptedSignService) SignArtifact(_ context.Context, bt sign.BuildType, in []string) (string, error) {
+	return "job1", nil
+}
+
+func (s *scriptedSignService) ArtifactSigningStatus(_ context.Context, jobID string) (sign.Status, string, []string, error) {
+	if s.onPoll != nil {
+		s.onPoll()
+	}
+	// The second poll fails, and the others go through the
+	// statuses in order.
+	i := s.polls
+	s.polls++
+	if i == 1 {
+		return sign.StatusUnknown, "", nil, errors.New("connection reset")
+	}
+	if i > 1 {
+		i--
+	}
+	if i >= len(s.statuses) {
+		i = len(s.statuses) - 1
+	}
+	var out []string
+	if s.statuses[i] == sign.StatusCompleted {
+		out = []string{"gs://scratch/a.signed"}
+	}
+	return s.statuses[i], s.descs[i], out, nil
+}
+
+func (s *scriptedSignService) CancelSigning(_ context.Context, jobID string) error {
+	s.canceled = true
+	return nil
+}
+
+func TestSignArtifacts(t *testing.T) {
+	AwaitDivisor = 1000
+	t.Cleanup(func() { AwaitDivisor = 1 })
+
+	for _, tt := range []struct {
+		name     string
+		statuses []sign.Status
+		descs    []string
+		want     []string
+		wantErr  bool
+		wantLogs []workflow.Record
+	}{
+		{
+			name:     "completed",
+			statuses: []sign.Status{sign.StatusRunning, sign.StatusRunning, sign.StatusRunning, sign.StatusCompleted},
+			descs:    []string{"queued", "notarizing", "notarizing", ""},
+			want:     []string{"gs://scratch/a.signed"},
+			wantLogs: []workflow.Record{
+				{Level: workflow.LevelInfo, Message: "signing job submitted", Fields: map[string]interface{}{"job": "job1", "type": sign.BuildMacOS, "artifacts": 1}, Progress: -1},
+				{Level: workflow.LevelInfo, Message: "signing job status", Fields: map[string]interface{}{"job": "job1", "type": sign.BuildMacOS, "status": sign.StatusRunning, "description": "queued"}, Progress: -1},
+				{Level: workflow.LevelWarn, Message: "checking signing job status failed; will retry", Fields: map[string]interface{}{"job": "job1", "type": sign.BuildMacOS, "error": "connection reset"}, Progress: -1},
+				{Level: workflow.LevelInfo, Message: "signing job status", Fields: map[string]interface{}{"job": "job1", "type": sign.BuildMacOS, "status": sign.StatusRunning, "description": "notarizing"}, Progress: -1},
+				{Level: workflow.LevelInfo, Message: "signing job status", Fields: map[string]interface{}{"job": "job1", "type": sign.BuildMacOS, "status": sign.StatusCompleted, "description": ""}, Progress: -1},
+			},
+		},
+		{
+			name:     "failed",
+			statuses: []sign.Status{sign.StatusRunning, sign.StatusFailed},
+			descs:    []string{"", "bad binary"},
+			wantErr:  true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			logger := &recordingLogger{}
+			ctx := &workflow.TaskContext{Context: context.Background(), Logger: logger}
+			s := &scriptedSignService{statuses: tt.statuses, descs: tt.descs}
+			got, err := SignArtifacts(ctx, s, sign.BuildMacOS, []string{"gs://scratch/a"})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SignArtifacts = %v, %v; want error %v", got, err, tt.wantErr)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("SignArtifacts mismatch (-want +got):\n%s", diff)
+			}
+			if tt.wantLogs == nil {
+				return
+			}
+			// Drop the elapsed times, which vary, and compare
+			// errors by their text.
+			for _, r := range logger.records {
+				delete(r.Fields, "elapsed")
+				if err, ok := r.Fields["error"].(error); ok {
+					r.Fields["error"] = err.Error()
+				}
+			}
+			if diff := cmp.Diff(tt.wantLogs, logger.records); diff != "" {
+				t.Errorf("logs mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+// recordingLogger is a workflow.RecordLogger that keeps its records.
+type recordingLogger struct {
+	records []workflow.Record
+}
+
+func (l *recordingLogger) Printf(format string, v ...interface{}) {
+	l.records = append(l.records, workflow.Record{Message: fmt.Sprintf(format, v...), Progress: -1})
+}
+
+func (l *recordingLogger) Log(r workflow.Record) {
+	l.records = append(l.records, r)
+}
+
+func TestSignArtifactsCanceled(t *testing.T) {
+	AwaitDivisor = 1000
+	t.Cleanup(func() { AwaitDivisor = 1 })
+
+	cctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var buf bytes.Buffer
+	ctx := &workflow.TaskContext{Context: cctx, Logger: fmtWriter{&buf}}
+	s := &scriptedSignService{statuses: []sign.Status{sign.StatusRunning}, descs: []string{""}, onPoll: cancel}
+	if _, err := SignArtifacts(ctx, s, sign.BuildWindows, []string{"gs://scratch/a"}); !errors.Is(err, context.Canceled) {
+		t.Errorf("SignArtifacts after cancellation = %v; want %v", err, context.Canceled)
+	}
+	if !s.canceled {
+		t.Errorf("signing job wasn't canceled")
+	}
+}
@@ -17,6 +17,7 @@ import (
 	"path"
 	"reflect"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -39,6 +40,9 @@ type TagXReposTasks struct {
 	CreateBuildlet   func(context.Context, string) (buildlet.RemoteClient, error)
 	LatestGoBinaries func(context.Context) (string, error)
 	DashboardURL     string
+	// ApproveAction waits for an operator to approve continuing
+	// despite a repository's tests failing.
+	ApproveAction func(*wf.TaskContext) error
 }
 
 func (x *TagXReposTasks) NewDefinition() *wf.Definition {
@@ -237,36 +241,62 @@ func checkCycles1(reposByModule map[string]TagRepo, repo TagRepo, stack []string
 	return cycles
 }
 
-// BuildPlan adds the tasks needed to update repos to wd.
-func (x *TagXReposTasks) BuildPlan(wd *wf.Definition, repos []TagRepo, reviewers []string) error {
-	// repo.ModPath to the wf.Value produced by updating it.
-	updated := map[string]wf.Value[TagRepo]{}
-
-	// Find all repositories whose dependencies are satisfied and update
-	// them, proceeding until all are updated or no progress can be made.
-	for len(updated) != len(repos) {
-		progress := false
+// tagOrder returns repos in an order they can be updated and tagged
+// in: each after the repos it depends on. Repos whose dependencies
+// are satisfied at the same point are ordered by name.
+func tagOrder(repos []TagRepo) ([]TagRepo, error) {
+	ordered := map[string]bool{} // by module path
+	var order []TagRepo
+	// Find all repositories whose dependencies are satisfied, proceeding
+	// until all are ordered or no progress can be made.
+	for len(order) != len(repos) {
+		var ready []TagRepo
 		for _, repo := range repos {
-			if _, ok := updated[repo.ModPath]; ok {
+			if ordered[repo.ModPath] {
 				continue
 			}
-			dep, ok := x.planRepo(wd, repo, updated, reviewers, false)
-			if !ok {
-				continue
+			satisfied := true
+			for _, dep := range repo.Deps {
+				satisfied = satisfied && ordered[dep]
+			}
+			if satisfied {
+				ready = append(ready, repo)
 			}
-			updated[repo.ModPath] = dep
-			progress = true
 		}
-
-		if !progress {
+		if len(ready) == 0 {
 			var missing []string
 			for _, r := range repos {
-				if updated[r.ModPath] == nil {
+				if !ordered[r.ModPath] {
 					missing = append(missing, r.Name)
 				}
 			}
-			return fmt.Errorf("failed to progress the plan: todo: %v", missing)
+			return nil, fmt.Errorf("failed to progress the plan: todo: %v", missing)
 		}
+		sort.Slice(ready, func(i, j int) bool { return ready[i].Name < ready[j].Name })
+		for _, repo := range ready {
+			ordered[repo.ModPath] = true
+		}
+		order = append(order, ready...)
+	}
+	return order, nil
+}
+
+// BuildPlan adds the tasks needed to update repos to wd.
+func (x *TagXReposTasks) BuildPlan(wd *wf.Definition, repos []TagRepo, reviewers []string) error {
+	order, err := tagOrder(repos)
+	if err != nil {
+		return err
+	}
+	// repo.ModPath to the wf.Value produced by updating it.
+	updated := map[string]wf.Value[TagRepo]{}
+	var names []string
+	for _, repo := range order {
+		dep, ok := x.planRepo(wd, repo, updated, reviewers, false)
+		if !ok {
+			return fmt.Errorf("%v's dependencies weren't planned before it", repo.Name)
+		}
+		updated[repo.ModPath] = dep
+		names = append(names, repo.Name)
 	}
 	var allDeps []wf.Dependency
 	for _, dep := range updated {
@@ -274,6 +304,7 @@ func (x *TagXReposTasks) BuildPlan(wd *wf.Definition, repos []TagRepo, reviewers
 	}
 	done := wf.Task0(wd, "done", func(_ context.Context) (string, error) { return "done!", nil }, wf.After(allDeps...))
 	wf.Output(wd, "done", done)
+	wf.Output(wd, "tagging order", wf.Const(names))
 	return nil
 }
 
@@ -325,6 +356,7 @@ func (x *TagXReposTasks) planRepo(wd *wf.Definition, repo TagRepo, updated map[s
 	if !skipPostSubmit {
 		tagCommit = wf.Task2(wd, "wait for green post-submit", x.AwaitGreen, wf.Const(repo), tagCommit)
 	}
+	tagCommit = wf.Task2(wd, "test with latest Go release", x.TestRepo, wf.Const(repo), tagCommit)
 	tagged := wf.Task2(wd, "tag if appropriate", x.MaybeTag, wf.Const(repo), tagCommit)
 	return tagged, true
 }
@@ -422,6 +454,50 @@ func (x *TagXReposTasks) UpdateGoMod(ctx *wf.TaskContext, repo TagRepo, deps []T
 	return tgzToMap(tgz)
 }
 
+// TestRepo runs the tests of repo at commit with the latest Go
+// release. If they fail, it waits for an operator to approve tagging
+// commit anyway. It returns commit.
+func (x *TagXReposTasks) TestRepo(ctx *wf.TaskContext, repo TagRepo, commit string) (string, error) {
+	binaries, err := x.LatestGoBinaries(ctx)
+	if err != nil {
+		return "", err
+	}
+	bc, err := x.CreateBuildlet(ctx, "linux-amd64-longtest") // longtest to allow network access.
+	if err != nil {
+		return "", err
+	}
+	defer bc.Close()
+
+	if err := bc.PutTarFromURL(ctx, binaries, ""); err != nil {
+		return "", err
+	}
+	tarURL := fmt.Sprintf("%s/%s/+archive/%s.tar.gz", x.GerritURL, repo.Name, commit)
+	if err := bc.PutTarFromURL(ctx, tarURL, "repo"); err != nil {
+		return "", err
+	}
+
+	writer := &LogWriter{Logger: ctx}
+	go writer.Run(ctx)
+
+	ctx.Printf("Testing %v at %v with %v", repo.Name, commit, binaries)
+	remoteErr, execErr := bc.Exec(ctx, "go/bin/go", buildlet.ExecOpts{
+		Dir:    "repo",
+		Args:   []string{"test", "./..."},
+		Output: writer,
+	})
+	if execErr != nil {
+		return "", execErr
+	}
+	if remoteErr == nil {
+		return commit, nil
+	}
+	if x.ApproveAction == nil {
+		return "", fmt.Errorf("tests failed: %v", remoteErr)
+	}
+	ctx.Printf("Tests failed: %v. Check the logs, and approve this task to tag %v at %v anyway.", remoteErr, repo.Name, commit)
+	return commit, x.ApproveAction(ctx)
+}
+
 func tgzToMap(r io.Reader) (map[string]string, error) {
 	gzr, err := gzip.NewReader(r)
 	if err != nil {
@@ -639,7 +715,18 @@ func (x *TagXReposTasks) findGreen(ctx *wf.TaskContext, repo TagRepo, commit str
 }
 
 func (x *TagXReposTasks) getBuildStatus(modPath string) (*types.BuildStatus, error) {
-	resp, err := http.Get(x.DashboardURL + "/?mode=json&repo=" + url.QueryEscape(modPath))
+	return getBuildStatus(x.DashboardURL, modPath)
+}
+
+// getBuildStatus returns the status of the builds of modPath on the
+// dashboard at dashboardURL. If modPath is empty, it returns the
+// status shown on the front page.
+func getBuildStatus(dashboardURL, modPath string) (*types.BuildStatus, error) {
+	u := dashboardURL + "/?mode=json"
+	if modPath != "" {
+		u += "&repo=" + url.QueryEscape(modPath)
+	}
+	resp, err := http.Get(u)
 	if err != nil {
 		return nil, err
 	}
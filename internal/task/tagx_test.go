@@ -331,6 +331,13 @@ case "$1" in
   ls go.mod go.sum >/dev/null
   echo "tidied! $*" >> go.mod
   ;;
+"test")
+  if [[ -e FAIL_TESTS ]]; then
+    echo "--- FAIL: TestEverything"
+    exit 1
+  fi
+  echo "ok"
+  ;;
 *)
   echo unexpected command $@
   exit 1
@@ -342,6 +349,7 @@ type tagXTestDeps struct {
 	ctx       context.Context
 	gerrit    *FakeGerrit
 	tagXTasks *TagXReposTasks
+	approvals int // Number of times ApproveAction was called.
 }
 
 func newTagXTestDeps(t *testing.T, dashboardStatus string, repos ...*FakeRepo) *tagXTestDeps {
@@ -416,11 +424,16 @@ func newTagXTestDeps(t *testing.T, dashboardStatus string, repos ...*FakeRepo) *
 		},
 		DashboardURL: dashServer.URL,
 	}
-	return &tagXTestDeps{
+	deps := &tagXTestDeps{
 		ctx:       ctx,
 		gerrit:    fakeGerrit,
 		tagXTasks: tasks,
 	}
+	tasks.ApproveAction = func(*workflow.TaskContext) error {
+		deps.approvals++
+		return nil
+	}
+	return deps
 }
 
 func TestTagXRepos(t *testing.T) {
@@ -503,6 +516,72 @@ func TestTagXRepos(t *testing.T) {
 	}
 }
 
+func TestTagXReposFailingTests(t *testing.T) {
+	mod := NewFakeRepo(t, "mod")
+	mod1 := mod.Commit(map[string]string{
+		"go.mod": "module golang.org/x/mod\n",
+		"go.sum": "\n",
+	})
+	mod.Tag("v1.0.0", mod1)
+	mod2 := mod.Commit(map[string]string{
+		"FAIL_TESTS": "the tests of this commit fail",
+	})
+
+	deps := newTagXTestDeps(t, "ok", mod)
+
+	wd := deps.tagXTasks.NewDefinition()
+	w, err := workflow.Start(wd, map[string]interface{}{
+		reviewersParam.Name: []string(nil),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(deps.ctx, time.Minute)
+	defer cancel()
+	_, err = w.Run(ctx, &verboseListener{t: t})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if deps.approvals != 1 {
+		t.Errorf("failing tests were approved %d times, want 1", deps.approvals)
+	}
+	tag, err := deps.gerrit.GetTag(ctx, "mod", "v1.1.0")
+	if err != nil {
+		t.Fatalf("mod should have been tagged with v1.1.0 once approved: %v", err)
+	}
+	if tag.Revision != mod2 {
+		t.Errorf("mod v1.1.0 = %v, want %v", tag.Revision, mod2)
+	}
+}
+
+func TestTagOrder(t *testing.T) {
+	repos := []TagRepo{
+		{Name: "tools", ModPath: "golang.org/x/tools", Deps: []string{"golang.org/x/mod", "golang.org/x/net", "golang.org/x/sys"}},
+		{Name: "sys", ModPath: "golang.org/x/sys"},
+		{Name: "net", ModPath: "golang.org/x/net", Deps: []string{"golang.org/x/sys", "golang.org/x/text"}},
+		{Name: "text", ModPath: "golang.org/x/text", Deps: []string{"golang.org/x/sys"}},
+		{Name: "mod", ModPath: "golang.org/x/mod"},
+	}
+	order, err := tagOrder(repos)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, r := range order {
+		got = append(got, r.Name)
+	}
+	want := []string{"mod", "sys", "text", "net", "tools"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("tagOrder mismatch (-want +got):\n%s", diff)
+	}
+
+	repos = append(repos, TagRepo{Name: "cyclic", ModPath: "golang.org/x/cyclic", Deps: []string{"golang.org/x/cyclic"}})
+	if _, err := tagOrder(repos); err == nil {
+		t.Errorf("tagOrder with a cycle succeeded, want error")
+	}
+}
+
 func testTagSingleRepo(t *testing.T, dashboardStatus string, skipPostSubmit bool) {
 	mod := NewFakeRepo(t, "mod")
 	mod1 := mod.Commit(map[string]string{
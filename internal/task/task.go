@@ -55,6 +55,31 @@ func AwaitCondition[T any](ctx *wf.TaskContext, period time.Duration, condition
 	}
 }
 
+// AwaitConditionBackoff is like AwaitCondition, but it waits initial
+// after the first call of condition, and twice as long after each
+// following call, up to max.
+func AwaitConditionBackoff[T any](ctx *wf.TaskContext, initial, max time.Duration, condition func() (T, bool, error)) (T, error) {
+	delay := initial
+	for {
+		res, done, err := condition()
+		if done || err != nil {
+			return res, err
+		}
+		t := time.NewTimer(delay / time.Duration(AwaitDivisor))
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			var zero T
+			return zero, ctx.Err()
+		case <-t.C:
+			ctx.ResetWatchdog()
+		}
+		if delay *= 2; delay > max {
+			delay = max
+		}
+	}
+}
+
 // LogWriter is an io.Writer that writes to a workflow task's log, flushing
 // its buffer periodically to avoid too many writes.
 type LogWriter struct {
@@ -125,7 +125,7 @@ func (t TweetTasks) TweetRelease(ctx *workflow.TaskContext, kind ReleaseKind, pu
 	ctx.Printf("tweet image:\n%s\n", imageText)
 
 	// Post a tweet via the Twitter API.
-	if t.TwitterClient == nil {
+	if t.TwitterClient == nil || ctx.DryRun {
 		return "(dry-run)", nil
 	}
 	ctx.DisableRetries()
@@ -221,6 +221,11 @@ func (t *VersionTasks) TagRelease(ctx *workflow.TaskContext, version, commit str
 	return t.Gerrit.Tag(ctx, t.GoProject, version, commit)
 }
 
+// TagReleaseKey is the idempotency key of TagRelease.
+func TagReleaseKey(version, commit string) string {
+	return "tag " + version
+}
+
 func (t *VersionTasks) CreateUpdateStdlibIndexCL(ctx *workflow.TaskContext, reviewers []string, version string) (string, error) {
 	var files = make(map[string]string) // Map key is relative path, and map value is file content.
 
@@ -281,8 +286,7 @@ func (t *VersionTasks) UnwaitWaitReleaseCLs(ctx *workflow.TaskContext) (result s
 	}
 	ctx.Printf("Processing %d open Gerrit CL with wait-release hashtag.", len(waitingCLs))
 	for _, cl := range waitingCLs {
-		const dryRun = false
-		if dryRun {
+		if ctx.DryRun {
 			ctx.Printf("[dry run] Would've unwaited CL %d (%.32s…).", cl.ChangeNumber, cl.Subject)
 			continue
 		}
@@ -0,0 +1,93 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package workflow
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/google/uuid"
+)
+
+// IdempotencyKey declares that the task has an external side effect,
+// like pushing a tag, sending an email, or uploading a file, that must
+// happen at most once. key must be a function that takes the same
+// arguments as the task's function, after its context, and returns a
+// string identifying the side effect, such as "tag go1.21.0".
+//
+// When the workflow runs with an EffectStore, the task's result is
+// recorded under its key once it succeeds. Later runs of a task with
+// the same key, in this workflow or any other, such as a retry or a
+// re-execution after a crash, reuse the recorded result instead of
+// calling the task's function again. A recorded result that doesn't
+// decode as the task's result type fails the task without retries.
+//
+// A side effect that completes just before the process running the
+// workflow dies, before its result is recorded, is repeated.
+func IdempotencyKey(key interface{}) TaskOption {
+	return &idempotencyKey{key}
+}
+
+type idempotencyKey struct {
+	f interface{}
+}
+
+func (*idempotencyKey) taskOption() {}
+
+// An EffectStore records the results of tasks with side effects by
+// their idempotency keys; see IdempotencyKey. It's shared by the
+// workflows that run with it, so it must be safe for concurrent use.
+type EffectStore interface {
+	// Effect returns the JSON-encoded result recorded for key, and
+	// whether there is one. Actions have a nil result.
+	Effect(ctx context.Context, key string) (result json.RawMessage, ok bool, err error)
+	// RecordEffect records result, the JSON-encoded result of the
+	// named task of a workflow, for key. If key already has a result,
+	// it's kept.
+	RecordEffect(ctx context.Context, key string, workflowID uuid.UUID, task string, result json.RawMessage) error
+}
+
+// checkIdempotencyKey panics if key isn't a valid key function for a
+// task whose function is f.
+func checkIdempotencyKey(name string, f, key interface{}) {
+	ft, kt := reflect.TypeOf(f), reflect.TypeOf(key)
+	ok := kt != nil && kt.Kind() == reflect.Func && kt.NumIn() == ft.NumIn()-1 &&
+		kt.NumOut() == 1 && kt.Out(0).Kind() == reflect.String
+	for i := 0; ok && i < kt.NumIn(); i++ {
+		ok = kt.In(i) == ft.In(i+1)
+	}
+	if !ok {
+		panic(fmt.Errorf("task %q: idempotency key must be a func taking the task's arguments and returning a string, not %T", name, key))
+	}
+}
+
+// effectKey returns the idempotency key of the task of def with args,
+// or "" if it has none.
+func effectKey(def *taskDefinition, args []reflect.Value) string {
+	if def.idempotencyKey == nil {
+		return ""
+	}
+	return reflect.ValueOf(def.idempotencyKey).Call(args)[0].String()
+}
+
+// reuseEffect finishes the task of state with result, the result
+// recorded for its side effect by an earlier run.
+func reuseEffect(tctx *TaskContext, state taskState, key string, result json.RawMessage) taskState {
+	tctx.Printf("skipping task: its side effect %q was already done", key)
+	state.finished = true
+	if ft := reflect.TypeOf(state.def.f); ft.NumOut() == 2 {
+		var err error
+		state.result, err = unmarshalNew(ft.Out(0), result)
+		if err != nil {
+			tctx.DisableRetries()
+			state.err = fmt.Errorf("recorded result of side effect %q doesn't match the task: %v", key, err)
+			return state
+		}
+		state.serializedResult = result
+	}
+	return state
+}
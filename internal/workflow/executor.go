@@ -0,0 +1,165 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package workflow
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// An Executor runs tasks on behalf of a Workflow, such as in separate
+// processes, so that a task that panics or leaks memory can't take
+// down the process running the workflow. The other side of an
+// Executor calls ExecuteTask with a Definition built the same way as
+// the workflow's.
+//
+// Tasks added by expansions, tasks with the RunsInProcess option, and
+// tasks whose arguments don't survive a trip through JSON are run in
+// process, unless the Executor is an ExclusiveExecutor.
+type Executor interface {
+	// Execute runs the task described by req, forwarding its logs to
+	// logger, and returns the outcome. An error means that the task
+	// couldn't be run to completion, for example because its process
+	// crashed, and is treated as the task's error.
+	Execute(ctx context.Context, req *TaskRequest, logger Logger) (*TaskResponse, error)
+}
+
+// An ExclusiveExecutor is an Executor that runs all of a workflow's
+// tasks, including those that other Executors leave to run in process,
+// such as the replaying Executor of package workflowtest. Tasks whose
+// arguments don't survive a trip through JSON fail.
+type ExclusiveExecutor interface {
+	Executor
+	// ExecutesAllTasks does nothing; it marks the Executor as
+	// exclusive.
+	ExecutesAllTasks()
+}
+
+// A TaskRequest asks an Executor to run a task.
+type TaskRequest struct {
+	WorkflowID uuid.UUID
+	Task       string
+	DryRun     bool
+	// Args are the JSON encodings of the arguments of the task's
+	// function that follow its context.
+	Args []json.RawMessage
+	// TraceContext carries the trace context of the task's run, as
+	// injected by the global OpenTelemetry propagator, so that the
+	// task's calls join the workflow's trace.
+	TraceContext map[string]string `json:",omitempty"`
+}
+
+// A TaskResponse is the outcome of a task run by an Executor.
+type TaskResponse struct {
+	// Result is the JSON encoding of the task's result. It's only
+	// set for tasks, not actions, that succeeded.
+	Result         json.RawMessage `json:",omitempty"`
+	Error          string          `json:",omitempty"`
+	DisableRetries bool            `json:",omitempty"`
+}
+
+// newTaskRequest returns a request to run the task def with args,
+// or an error if the task can't be run by an Executor. Only arguments
+// that don't survive a trip through JSON stop exclusive Executors.
+func newTaskRequest(workflowID uuid.UUID, dryRun bool, def *taskDefinition, args []reflect.Value, exclusive bool) (*TaskRequest, error) {
+	switch {
+	case exclusive:
+	case def.runsInProcess:
+		return nil, fmt.Errorf("task runs in process")
+	case def.fromExpansion:
+		return nil, fmt.Errorf("task was added by an expansion")
+	}
+	req := &TaskRequest{WorkflowID: workflowID, Task: def.name, DryRun: dryRun}
+	for i, arg := range args {
+		data, err := json.Marshal(arg.Interface())
+		if err != nil {
+			return nil, fmt.Errorf("marshaling argument %d: %v", i+1, err)
+		}
+		// Values like constants with unexported fields don't survive
+		// the trip.
+		if got, err := unmarshalNew(arg.Type(), data); err != nil || !reflect.DeepEqual(got, arg.Interface()) {
+			return nil, fmt.Errorf("argument %d changes when marshaled to JSON", i+1)
+		}
+		req.Args = append(req.Args, data)
+	}
+	return req, nil
+}
+
+// execute runs the task of state with executor.
+func execute(tctx *TaskContext, executor Executor, req *TaskRequest, state taskState) taskState {
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(tctx, carrier)
+	if len(carrier) != 0 {
+		req.TraceContext = carrier
+	}
+	resp, err := executor.Execute(tctx, req, tctx.Logger)
+	switch {
+	case err != nil:
+		state.err = err
+	case resp.Error != "":
+		state.err = errors.New(resp.Error)
+	default:
+		if ft := reflect.TypeOf(state.def.f); ft.NumOut() == 2 {
+			state.serializedResult = resp.Result
+			state.result, state.err = unmarshalNew(ft.Out(0), resp.Result)
+		}
+	}
+	if err == nil && resp.DisableRetries {
+		tctx.DisableRetries()
+	}
+	state.finished = true
+	return state
+}
+
+// ExecuteTask runs the task of d requested by an Executor, logging to
+// logger, and returns its outcome. Like a Workflow, it cancels the task
+// if it doesn't log for WatchdogDelay.
+func ExecuteTask(ctx context.Context, d *Definition, req *TaskRequest, logger Logger) *TaskResponse {
+	def, ok := d.tasks[req.Task]
+	if !ok || def.isExpansion {
+		return &TaskResponse{Error: fmt.Sprintf("unknown task %q", req.Task), DisableRetries: true}
+	}
+	ft := reflect.TypeOf(def.f)
+	if len(req.Args) != ft.NumIn()-1 {
+		return &TaskResponse{Error: fmt.Sprintf("task %q takes %d arguments, got %d", req.Task, ft.NumIn()-1, len(req.Args)), DisableRetries: true}
+	}
+	var args []reflect.Value
+	for i, data := range req.Args {
+		arg := reflect.New(ft.In(i + 1))
+		if err := json.Unmarshal(data, arg.Interface()); err != nil {
+			return &TaskResponse{Error: fmt.Sprintf("unmarshaling argument %d: %v", i+1, err), DisableRetries: true}
+		}
+		args = append(args, arg.Elem())
+	}
+
+	ctx = otel.GetTextMapPropagator().Extract(ctx, propagation.MapCarrier(req.TraceContext))
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	tctx := &TaskContext{
+		Context:       ctx,
+		Logger:        logger,
+		TaskName:      req.Task,
+		WorkflowID:    req.WorkflowID,
+		DryRun:        req.DryRun,
+		watchdogTimer: time.AfterFunc(WatchdogDelay, cancel),
+		watchdogScale: 1,
+	}
+	state := callTask(tctx, taskState{def: def}, args)
+	resp := &TaskResponse{DisableRetries: tctx.disableRetries}
+	if state.err != nil {
+		resp.Error = state.err.Error()
+	} else {
+		resp.Result = state.serializedResult
+	}
+	return resp
+}
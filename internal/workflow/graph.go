@@ -0,0 +1,219 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package workflow
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+
+	"golang.org/x/exp/slices"
+)
+
+// A Graph is a serializable description of the shape of a Definition:
+// its parameters, tasks, and outputs. It does not include the task
+// functions themselves, so it can be stored alongside a workflow run and
+// later compared against the Definition the run is resumed with.
+type Graph struct {
+	Parameters []GraphParameter // Ordered according to registration.
+	Tasks      []GraphTask      // Sorted by name.
+	Outputs    []string         // Sorted by name.
+}
+
+// A GraphParameter describes a workflow parameter.
+type GraphParameter struct {
+	Name string
+	Type string
+}
+
+// A GraphTask describes a task, action, or expansion in a workflow.
+type GraphTask struct {
+	Name         string
+	Expansion    bool     `json:",omitempty"`
+	HonorsDryRun bool     `json:",omitempty"` // See the HonorsDryRun option.
+	Inputs       []string `json:",omitempty"` // Argument types, excluding the context.
+	Output       string   `json:",omitempty"` // Result type; empty for actions and expansions.
+	Deps         []string `json:",omitempty"` // Names of tasks this task depends on, sorted.
+	Resources    []string `json:",omitempty"` // See the NeedsResources option; sorted.
+	Idempotent   bool     `json:",omitempty"` // See the IdempotencyKey option.
+}
+
+// Graph returns a description of the current shape of d.
+// Tasks added at run time by expansions are not included.
+func (d *Definition) Graph() *Graph {
+	g := &Graph{}
+	for _, p := range d.parameters {
+		g.Parameters = append(g.Parameters, GraphParameter{Name: p.Name(), Type: p.Type().String()})
+	}
+	for _, td := range d.tasks {
+		gt := GraphTask{Name: td.name, Expansion: td.isExpansion, HonorsDryRun: td.honorsDryRun, Idempotent: td.idempotencyKey != nil}
+		ft := reflect.TypeOf(td.f)
+		for i := 1; i < ft.NumIn(); i++ {
+			gt.Inputs = append(gt.Inputs, ft.In(i).String())
+		}
+		if ft.NumOut() == 2 {
+			gt.Output = ft.Out(0).String()
+		}
+		seen := map[string]bool{}
+		for _, dep := range td.deps {
+			if !seen[dep.name] {
+				seen[dep.name] = true
+				gt.Deps = append(gt.Deps, dep.name)
+			}
+		}
+		sort.Strings(gt.Deps)
+		for _, r := range td.resources {
+			if !slices.Contains(gt.Resources, r) {
+				gt.Resources = append(gt.Resources, r)
+			}
+		}
+		sort.Strings(gt.Resources)
+		g.Tasks = append(g.Tasks, gt)
+	}
+	sort.Slice(g.Tasks, func(i, j int) bool { return g.Tasks[i].Name < g.Tasks[j].Name })
+	for name := range d.outputs {
+		g.Outputs = append(g.Outputs, name)
+	}
+	sort.Strings(g.Outputs)
+	return g
+}
+
+func (g *Graph) task(name string) (GraphTask, bool) {
+	for _, t := range g.Tasks {
+		if t.Name == name {
+			return t, true
+		}
+	}
+	return GraphTask{}, false
+}
+
+// sameShape reports whether a and b have the same signature, ignoring
+// their names and dependencies.
+func (a GraphTask) sameShape(b GraphTask) bool {
+	return a.Expansion == b.Expansion && a.Output == b.Output && reflect.DeepEqual(a.Inputs, b.Inputs)
+}
+
+// CheckCompatibility compares the graph a workflow run was started with
+// to the graph of the Definition it is about to be resumed with, and
+// returns a human-readable warning for each difference that may affect
+// the run. A nil result means the two are compatible.
+func CheckCompatibility(stored, current *Graph) []string {
+	var warnings []string
+	storedParams := map[string]string{}
+	for _, p := range stored.Parameters {
+		storedParams[p.Name] = p.Type
+	}
+	currentParams := map[string]string{}
+	for _, p := range current.Parameters {
+		currentParams[p.Name] = p.Type
+		typ, ok := storedParams[p.Name]
+		switch {
+		case !ok:
+			warnings = append(warnings, fmt.Sprintf("parameter %q was added", p.Name))
+		case typ != p.Type:
+			warnings = append(warnings, fmt.Sprintf("parameter %q changed type from %v to %v", p.Name, typ, p.Type))
+		}
+	}
+	for _, p := range stored.Parameters {
+		if _, ok := currentParams[p.Name]; !ok {
+			warnings = append(warnings, fmt.Sprintf("parameter %q was removed", p.Name))
+		}
+	}
+	for _, st := range stored.Tasks {
+		ct, ok := current.task(st.Name)
+		switch {
+		case !ok:
+			warnings = append(warnings, fmt.Sprintf("task %q was removed or renamed", st.Name))
+		case !st.sameShape(ct):
+			warnings = append(warnings, fmt.Sprintf("task %q changed signature", st.Name))
+		case !reflect.DeepEqual(st.Deps, ct.Deps):
+			warnings = append(warnings, fmt.Sprintf("task %q changed dependencies from %q to %q", st.Name, st.Deps, ct.Deps))
+		}
+	}
+	for _, ct := range current.Tasks {
+		if _, ok := stored.task(ct.Name); !ok {
+			warnings = append(warnings, fmt.Sprintf("task %q was added", ct.Name))
+		}
+	}
+	if !reflect.DeepEqual(stored.Outputs, current.Outputs) {
+		warnings = append(warnings, fmt.Sprintf("outputs changed from %q to %q", stored.Outputs, current.Outputs))
+	}
+	return warnings
+}
+
+// MigrateTaskStates adapts the task states of a run started with the
+// stored graph so that they can be passed to Resume with a Definition
+// of the current graph.
+//
+// A task that is missing from the current graph is assumed to have been
+// renamed if exactly one new task has the same signature, and its state
+// is carried over under the new name. Every other new task starts with
+// an empty state, so that it runs when the workflow is resumed. States
+// of tasks that were not part of the stored graph, such as those added
+// by expansions, are left untouched. The returned warnings describe
+// each decision that was made.
+func MigrateTaskStates(stored, current *Graph, states map[string]*TaskState) (map[string]*TaskState, []string) {
+	var warnings []string
+	var removed, added []GraphTask
+	for _, st := range stored.Tasks {
+		if _, ok := current.task(st.Name); !ok {
+			removed = append(removed, st)
+		}
+	}
+	for _, ct := range current.Tasks {
+		if _, ok := stored.task(ct.Name); !ok {
+			added = append(added, ct)
+		}
+	}
+
+	migrated := make(map[string]*TaskState, len(states))
+	for name, s := range states {
+		migrated[name] = s
+	}
+	renamed := map[string]bool{}
+	for _, rt := range removed {
+		var candidates []GraphTask
+		for _, at := range added {
+			if rt.sameShape(at) {
+				candidates = append(candidates, at)
+			}
+		}
+		var reverse []GraphTask
+		if len(candidates) == 1 {
+			for _, other := range removed {
+				if other.sameShape(candidates[0]) {
+					reverse = append(reverse, other)
+				}
+			}
+		}
+		switch {
+		case len(candidates) == 0:
+			warnings = append(warnings, fmt.Sprintf("task %q no longer exists; its state is ignored", rt.Name))
+		case len(candidates) > 1 || len(reverse) > 1:
+			warnings = append(warnings, fmt.Sprintf("task %q no longer exists and matches more than one new task; its state is ignored", rt.Name))
+		default:
+			to := candidates[0].Name
+			s := &TaskState{}
+			if old, ok := states[rt.Name]; ok {
+				*s = *old
+			}
+			s.Name = to
+			migrated[to] = s
+			delete(migrated, rt.Name)
+			renamed[to] = true
+			warnings = append(warnings, fmt.Sprintf("task %q appears to have been renamed to %q; carrying over its state", rt.Name, to))
+		}
+	}
+	for _, at := range added {
+		if renamed[at.Name] {
+			continue
+		}
+		if _, ok := migrated[at.Name]; !ok {
+			migrated[at.Name] = &TaskState{Name: at.Name}
+			warnings = append(warnings, fmt.Sprintf("task %q is new; it will run from scratch", at.Name))
+		}
+	}
+	return migrated, warnings
+}
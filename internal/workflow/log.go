@@ -0,0 +1,139 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package workflow
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// A Level is the severity of a task log record.
+type Level int
+
+const (
+	LevelDebug Level = -4
+	LevelInfo  Level = 0
+	LevelWarn  Level = 4
+	LevelError Level = 8
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "DEBUG"
+	case LevelInfo:
+		return "INFO"
+	case LevelWarn:
+		return "WARN"
+	case LevelError:
+		return "ERROR"
+	}
+	return fmt.Sprintf("Level(%d)", int(l))
+}
+
+// ParseLevel parses the name of a level, as returned by Level.String.
+// It is case-insensitive.
+func ParseLevel(s string) (Level, error) {
+	for _, l := range []Level{LevelDebug, LevelInfo, LevelWarn, LevelError} {
+		if strings.EqualFold(s, l.String()) {
+			return l, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown log level %q", s)
+}
+
+// A Record is a structured task log entry.
+type Record struct {
+	Level   Level
+	Message string
+	// Fields holds the key/value pairs attached to the record.
+	Fields map[string]interface{}
+	// Progress is the fraction of the task that is complete, in the
+	// range [0, 1], or a negative number if the record doesn't
+	// report progress.
+	Progress float64
+}
+
+// String formats r as a single line of text, for Loggers that don't
+// support structured records.
+func (r Record) String() string {
+	var b strings.Builder
+	if r.Level != LevelInfo {
+		fmt.Fprintf(&b, "%v: ", r.Level)
+	}
+	b.WriteString(r.Message)
+	keys := make([]string, 0, len(r.Fields))
+	for k := range r.Fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(&b, " %s=%v", k, r.Fields[k])
+	}
+	if r.Progress >= 0 {
+		fmt.Fprintf(&b, " (%.0f%% done)", r.Progress*100)
+	}
+	return b.String()
+}
+
+// A RecordLogger is a Logger that can also store structured records.
+// Loggers returned by a Listener should implement it to preserve
+// levels, fields, and progress; records passed to other Loggers are
+// formatted with Record.String.
+type RecordLogger interface {
+	Logger
+	Log(Record)
+}
+
+// badKey is the key used for a value without a key.
+const badKey = "!BADKEY"
+
+// recordFields converts alternating keys and values into a map.
+func recordFields(keyvals []interface{}) map[string]interface{} {
+	if len(keyvals) == 0 {
+		return nil
+	}
+	fields := make(map[string]interface{}, (len(keyvals)+1)/2)
+	for len(keyvals) > 0 {
+		if len(keyvals) == 1 {
+			fields[badKey] = keyvals[0]
+			break
+		}
+		k, ok := keyvals[0].(string)
+		if !ok {
+			k = fmt.Sprint(keyvals[0])
+		}
+		fields[k] = keyvals[1]
+		keyvals = keyvals[2:]
+	}
+	return fields
+}
+
+// Log logs msg at level, with key/value fields given as alternating
+// keys and values in keyvals.
+func (c *TaskContext) Log(level Level, msg string, keyvals ...interface{}) {
+	c.log(Record{Level: level, Message: msg, Fields: recordFields(keyvals), Progress: -1})
+}
+
+// Progress logs msg, reporting that fraction of the task is complete.
+// fraction is clamped to the range [0, 1].
+func (c *TaskContext) Progress(fraction float64, msg string, keyvals ...interface{}) {
+	if fraction < 0 {
+		fraction = 0
+	} else if fraction > 1 {
+		fraction = 1
+	}
+	c.log(Record{Level: LevelInfo, Message: msg, Fields: recordFields(keyvals), Progress: fraction})
+}
+
+func (c *TaskContext) log(r Record) {
+	c.ResetWatchdog()
+	if rl, ok := c.Logger.(RecordLogger); ok {
+		rl.Log(r)
+		return
+	}
+	c.Logger.Printf("%s", r)
+}
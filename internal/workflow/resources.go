@@ -0,0 +1,218 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package workflow
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// NeedsResources declares that the task uses one unit of each of the
+// named resources while it runs, such as a signing server or a gomote
+// instance. When the workflow runs with Resources that limit any of
+// them, the task waits for a free unit of each before it starts, so
+// that concurrent workflows don't oversubscribe scarce external
+// systems. Resources without a limit are unrestricted.
+func NeedsResources(names ...string) TaskOption {
+	return &needsResources{names}
+}
+
+type needsResources struct {
+	names []string
+}
+
+func (*needsResources) taskOption() {}
+
+// Resources is a set of named resource pools shared by the workflows
+// that run with it. Each pool has a limit on the number of tasks that
+// may use it concurrently; tasks waiting for a pool are served in the
+// order they arrived. Resources is safe for concurrent use.
+type Resources struct {
+	mu    sync.Mutex
+	pools map[string]*resourcePool
+}
+
+type resourcePool struct {
+	limit   int
+	inUse   int
+	waiters []*resourceWaiter
+}
+
+type resourceWaiter struct {
+	ResourceWaiter
+	// ready is closed when the waiter is given a unit of the pool.
+	ready chan struct{}
+}
+
+// NewResources returns a Resources with no limits.
+func NewResources() *Resources {
+	return &Resources{pools: map[string]*resourcePool{}}
+}
+
+// SetLimit sets the maximum number of tasks that may concurrently use
+// the named resource. A limit less than 1 removes it. Tasks already
+// using the resource are unaffected, but waiting tasks are started if
+// the new limit allows it.
+func (r *Resources) SetLimit(name string, limit int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	p, ok := r.pools[name]
+	if !ok {
+		p = &resourcePool{}
+		r.pools[name] = p
+	}
+	p.limit = limit
+	for len(p.waiters) > 0 && (p.limit < 1 || p.inUse < p.limit) {
+		p.grant()
+	}
+	if p.limit < 1 && p.inUse == 0 {
+		delete(r.pools, name)
+	}
+}
+
+// grant gives a unit of p to the first waiter. r.mu must be held.
+func (p *resourcePool) grant() {
+	w := p.waiters[0]
+	p.waiters = p.waiters[1:]
+	p.inUse++
+	close(w.ready)
+}
+
+// A ResourceStatus describes the use of a resource pool.
+type ResourceStatus struct {
+	Name    string
+	Limit   int
+	InUse   int
+	Waiting []ResourceWaiter // In the order they'll be served.
+}
+
+// A ResourceWaiter is a task waiting for a unit of a resource pool.
+type ResourceWaiter struct {
+	WorkflowID uuid.UUID
+	TaskName   string
+	Since      time.Time
+}
+
+// Status returns the status of all limited resources, sorted by name.
+func (r *Resources) Status() []ResourceStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var statuses []ResourceStatus
+	for name, p := range r.pools {
+		if p.limit < 1 {
+			continue
+		}
+		s := ResourceStatus{Name: name, Limit: p.limit, InUse: p.inUse}
+		for _, w := range p.waiters {
+			s.Waiting = append(s.Waiting, w.ResourceWaiter)
+		}
+		statuses = append(statuses, s)
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+	return statuses
+}
+
+// acquire waits for a unit of each of the named resources, logging
+// to ctx while it waits. Resources are acquired in name order so that
+// tasks needing several of them can't deadlock. The returned function
+// releases all of them. If ctx is canceled while waiting, acquire
+// releases any resources it holds and returns ctx's error. A nil
+// Resources limits nothing.
+func (r *Resources) acquire(ctx *TaskContext, names []string) (release func(), err error) {
+	if r == nil {
+		return func() {}, nil
+	}
+	names = append([]string(nil), names...)
+	sort.Strings(names)
+	var held []string
+	release = func() {
+		for _, name := range held {
+			r.release(name)
+		}
+	}
+	for i, name := range names {
+		if i > 0 && name == names[i-1] {
+			continue
+		}
+		if err := r.acquireOne(ctx, name); err != nil {
+			release()
+			return nil, err
+		}
+		held = append(held, name)
+	}
+	return release, nil
+}
+
+func (r *Resources) acquireOne(ctx *TaskContext, name string) error {
+	r.mu.Lock()
+	p, ok := r.pools[name]
+	if !ok || p.limit < 1 {
+		// Track use of unlimited resources so that a limit set
+		// later accounts for them.
+		if !ok {
+			p = &resourcePool{}
+			r.pools[name] = p
+		}
+		p.inUse++
+		r.mu.Unlock()
+		return nil
+	}
+	if p.inUse < p.limit && len(p.waiters) == 0 {
+		p.inUse++
+		r.mu.Unlock()
+		return nil
+	}
+	w := &resourceWaiter{
+		ResourceWaiter: ResourceWaiter{WorkflowID: ctx.WorkflowID, TaskName: ctx.TaskName, Since: time.Now()},
+		ready:          make(chan struct{}),
+	}
+	p.waiters = append(p.waiters, w)
+	inUse, limit, ahead := p.inUse, p.limit, len(p.waiters)-1
+	r.mu.Unlock()
+
+	ctx.Log(LevelInfo, "waiting for resource", "resource", name, "in_use", inUse, "limit", limit, "ahead", ahead)
+	select {
+	case <-w.ready:
+		ctx.Log(LevelInfo, "acquired resource", "resource", name, "waited", time.Since(w.Since).Round(time.Second))
+		return nil
+	case <-ctx.Done():
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	select {
+	case <-w.ready:
+		// Granted concurrently with cancellation; give it back.
+		r.releaseLocked(name)
+	default:
+		for i, pw := range p.waiters {
+			if pw == w {
+				p.waiters = append(p.waiters[:i], p.waiters[i+1:]...)
+				break
+			}
+		}
+	}
+	return ctx.Err()
+}
+
+func (r *Resources) release(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.releaseLocked(name)
+}
+
+func (r *Resources) releaseLocked(name string) {
+	p := r.pools[name]
+	p.inUse--
+	if len(p.waiters) > 0 && (p.limit < 1 || p.inUse < p.limit) {
+		p.grant()
+	}
+	if p.limit < 1 && p.inUse == 0 && len(p.waiters) == 0 {
+		delete(r.pools, name)
+	}
+}
@@ -20,7 +20,8 @@
 // function must take a context.Context or *TaskContext, followed by arguments
 // corresponding to the dynamic type of the Values passed to it. It must return
 // a value of any type and an error. The TaskContext can be used as a normal
-// Context, and also supports workflow features like unstructured logging.
+// Context, and also supports workflow features like leveled, structured
+// logging and progress reporting.
 // A task only runs once all of its inputs are ready. All task outputs must be
 // used either as inputs to another task or as a workflow Output.
 //
@@ -83,6 +84,7 @@ func (d *Definition) name(name string) string {
 
 func (d *Definition) shallowClone() *Definition {
 	clone := New()
+	clone.expansion = true
 	clone.parameters = append([]MetaParameter(nil), d.parameters...)
 	for k, v := range d.tasks {
 		clone.tasks[k] = v
@@ -97,6 +99,7 @@ type definitionState struct {
 	parameters []MetaParameter // Ordered according to registration, unique parameter names.
 	tasks      map[string]*taskDefinition
 	outputs    map[string]metaValue
+	expansion  bool // whether tasks are being added by an expansion
 }
 
 // A TaskOption affects the execution of a task but is not an argument to its function.
@@ -347,6 +350,31 @@ type after struct {
 
 func (a *after) taskOption() {}
 
+// HonorsDryRun declares that the task checks TaskContext.DryRun and
+// makes no externally visible changes, like mailing CLs or
+// publishing artifacts, in dry-run workflows. Tasks without it would
+// run as usual in dry-run workflows, so relui only dry runs
+// definitions whose tasks all have it. Tasks without side effects
+// honor dry runs trivially, and should be given it too.
+func HonorsDryRun() TaskOption {
+	return honorsDryRun{}
+}
+
+type honorsDryRun struct{}
+
+func (honorsDryRun) taskOption() {}
+
+// RunsInProcess declares that the task depends on the state of the
+// process running the workflow, such as connections made to it, so it
+// must not be run by the workflow's Executor.
+func RunsInProcess() TaskOption {
+	return runsInProcess{}
+}
+
+type runsInProcess struct{}
+
+func (runsInProcess) taskOption() {}
+
 // TaskN adds a task to the workflow definition. It takes N inputs, and returns
 // one output. name must uniquely identify the task in the workflow.
 // f must be a function that takes a context.Context or *TaskContext argument,
@@ -380,12 +408,24 @@ func Task5[C context.Context, I1, I2, I3, I4, I5, O1 any](d *Definition, name st
 
 func addFunc(d *Definition, name string, f interface{}, inputs []metaValue, opts []TaskOption) *taskDefinition {
 	name = d.name(name)
-	td := &taskDefinition{name: name, f: f, args: inputs}
+	td := &taskDefinition{name: name, f: f, args: inputs, fromExpansion: d.expansion}
 	for _, input := range inputs {
 		td.deps = append(td.deps, input.dependencies()...)
 	}
 	for _, opt := range opts {
-		td.deps = append(td.deps, opt.(*after).deps...)
+		switch opt := opt.(type) {
+		case *after:
+			td.deps = append(td.deps, opt.deps...)
+		case honorsDryRun:
+			td.honorsDryRun = true
+		case *needsResources:
+			td.resources = append(td.resources, opt.names...)
+		case runsInProcess:
+			td.runsInProcess = true
+		case *idempotencyKey:
+			checkIdempotencyKey(name, f, opt.f)
+			td.idempotencyKey = opt.f
+		}
 	}
 	d.tasks[name] = td
 	return td
@@ -481,6 +521,10 @@ type TaskContext struct {
 	Logger     Logger
 	TaskName   string
 	WorkflowID uuid.UUID
+	// DryRun reports whether the workflow is a dry run, in which
+	// tasks that honor it (see HonorsDryRun) only report what
+	// they would have done.
+	DryRun bool
 
 	watchdogTimer *time.Timer
 	watchdogScale int
@@ -537,6 +581,16 @@ type Listener interface {
 	WorkflowStalled(workflowID uuid.UUID) error
 }
 
+// A TaskContextListener is a Listener that derives the context of each
+// run of a task, for example to add the task's trace span to it.
+type TaskContextListener interface {
+	Listener
+	// TaskContext returns the context of a run of the task, given the
+	// workflow's. It's called after TaskStateChanged reports that the
+	// run started.
+	TaskContext(ctx context.Context, workflowID uuid.UUID, taskID string) context.Context
+}
+
 // TaskState contains the state of a task in a running workflow. Once Finished
 // is true, either Result or Error will be populated.
 type TaskState struct {
@@ -547,12 +601,17 @@ type TaskState struct {
 	SerializedResult []byte
 	Error            string
 	RetryCount       int
+	// SerializedArgs is the JSON array of the arguments of the task's
+	// function that follow its context, once it has started. It's nil
+	// if they can't be marshaled, and for expansions.
+	SerializedArgs []byte
 }
 
 // WorkflowState contains the shallow state of a running workflow.
 type WorkflowState struct {
 	ID     uuid.UUID
 	Params map[string]interface{}
+	DryRun bool
 }
 
 // A Logger is a debug logger passed to a task implementation.
@@ -561,11 +620,20 @@ type Logger interface {
 }
 
 type taskDefinition struct {
-	name        string
-	isExpansion bool
-	args        []metaValue
-	deps        []*taskDefinition
-	f           interface{}
+	name         string
+	isExpansion  bool
+	honorsDryRun bool
+	resources    []string // See the NeedsResources option.
+	// runsInProcess is set by the RunsInProcess option, and
+	// fromExpansion for tasks added by expansions. Such tasks aren't
+	// run by Executors.
+	runsInProcess bool
+	fromExpansion bool
+	args          []metaValue
+	deps          []*taskDefinition
+	f             interface{}
+	// idempotencyKey is set by the IdempotencyKey option.
+	idempotencyKey interface{}
 }
 
 type taskResult[T any] struct {
@@ -589,7 +657,22 @@ func (tr *taskResult[T]) dependencies() []*taskDefinition {
 
 // A Workflow is an instantiated workflow instance, ready to run.
 type Workflow struct {
-	ID            uuid.UUID
+	ID uuid.UUID
+	// DryRun is passed to every task in its TaskContext. It must be
+	// set before Run is called.
+	DryRun bool
+	// Resources limits the concurrency of tasks that need resources,
+	// and may be shared by many workflows. If nil, tasks run without
+	// waiting for resources. It must be set before Run is called.
+	Resources *Resources
+	// Executor, if non-nil, runs the workflow's tasks in its stead.
+	// It must be set before Run is called.
+	Executor Executor
+	// Effects, if non-nil, records the side effects of tasks with an
+	// IdempotencyKey, and may be shared by many workflows. It must be
+	// set before Run is called.
+	Effects EffectStore
+
 	params        map[string]interface{}
 	retryCommands chan retryCommand
 
@@ -615,6 +698,7 @@ type taskState struct {
 	// normal tasks
 	result           interface{}
 	serializedResult []byte
+	serializedArgs   []byte
 	retryCount       int
 
 	// workflow expansion
@@ -627,6 +711,7 @@ func (t *taskState) toExported() *TaskState {
 		Finished:         t.finished,
 		Result:           t.result,
 		SerializedResult: append([]byte(nil), t.serializedResult...),
+		SerializedArgs:   append([]byte(nil), t.serializedArgs...),
 		Started:          t.started,
 		RetryCount:       t.retryCount,
 	}
@@ -702,6 +787,7 @@ func (w *Workflow) validate() error {
 func Resume(def *Definition, state *WorkflowState, taskStates map[string]*TaskState) (*Workflow, error) {
 	w := &Workflow{
 		ID:            state.ID,
+		DryRun:        state.DryRun,
 		params:        state.Params,
 		retryCommands: make(chan retryCommand, len(def.tasks)),
 		def:           def,
@@ -809,6 +895,9 @@ func (w *Workflow) Run(ctx context.Context, listener Listener) (map[string]inter
 					continue
 				}
 				task.started = true
+				if !task.def.isExpansion {
+					task.serializedArgs = marshalArgs(args)
+				}
 				running++
 				listener.TaskStateChanged(w.ID, task.def.name, task.toExported())
 				taskCopy := *task
@@ -816,7 +905,9 @@ func (w *Workflow) Run(ctx context.Context, listener Listener) (map[string]inter
 					defCopy := w.def.shallowClone()
 					go func() { stateChan <- runExpansion(defCopy, taskCopy, args) }()
 				} else {
-					go func() { stateChan <- runTask(ctx, w.ID, listener, taskCopy, args) }()
+					go func() {
+						stateChan <- runTask(ctx, w.ID, w.DryRun, w.Resources, w.Executor, w.Effects, listener, taskCopy, args)
+					}()
 				}
 			}
 		}
@@ -879,12 +970,29 @@ func (w *Workflow) taskArgs(def *taskDefinition) ([]reflect.Value, bool) {
 	return args, true
 }
 
+// marshalArgs returns the JSON array of args, or nil if they can't be
+// marshaled.
+func marshalArgs(args []reflect.Value) []byte {
+	vals := make([]interface{}, len(args))
+	for i, arg := range args {
+		vals[i] = arg.Interface()
+	}
+	data, err := json.Marshal(vals)
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
 // Maximum number of retries. This could be a workflow property.
 var MaxRetries = 3
 
 var WatchdogDelay = 11 * time.Minute // A little over go test -timeout's default value of 10 minutes.
 
-func runTask(ctx context.Context, workflowID uuid.UUID, listener Listener, state taskState, args []reflect.Value) taskState {
+func runTask(ctx context.Context, workflowID uuid.UUID, dryRun bool, resources *Resources, executor Executor, effects EffectStore, listener Listener, state taskState, args []reflect.Value) taskState {
+	if l, ok := listener.(TaskContextListener); ok {
+		ctx = l.TaskContext(ctx, workflowID, state.def.name)
+	}
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
@@ -893,10 +1001,78 @@ func runTask(ctx context.Context, workflowID uuid.UUID, listener Listener, state
 		Logger:        listener.Logger(workflowID, state.def.name),
 		TaskName:      state.def.name,
 		WorkflowID:    workflowID,
-		watchdogTimer: time.AfterFunc(WatchdogDelay, cancel),
+		DryRun:        dryRun,
 		watchdogScale: 1,
 	}
+	// The side effects of dry runs of tasks that honor them aren't real.
+	key := effectKey(state.def, args)
+	if effects == nil || dryRun && state.def.honorsDryRun {
+		key = ""
+	}
+	if key != "" {
+		result, ok, err := effects.Effect(tctx, key)
+		if err != nil {
+			state.err = fmt.Errorf("looking up side effect %q: %v", key, err)
+			state.finished = true
+			return state
+		}
+		if ok {
+			return reuseEffect(tctx, state, key, result)
+		}
+	}
+	// Waiting for resources doesn't count against the watchdog.
+	if len(state.def.resources) != 0 {
+		release, err := resources.acquire(tctx, state.def.resources)
+		if err != nil {
+			state.err = err
+			state.finished = true
+			return state
+		}
+		defer release()
+	}
 
+	var req *TaskRequest
+	if executor != nil {
+		_, exclusive := executor.(ExclusiveExecutor)
+		var err error
+		if req, err = newTaskRequest(workflowID, dryRun, state.def, args, exclusive); err != nil && exclusive {
+			tctx.DisableRetries()
+			state.err = fmt.Errorf("can't run task with exclusive executor: %v", err)
+			state.finished = true
+			return state
+		} else if err != nil {
+			tctx.Log(LevelDebug, "running task in process", "reason", err)
+		}
+	}
+	if req != nil {
+		// The other side of the executor enforces the watchdog.
+		state = execute(tctx, executor, req, state)
+	} else {
+		tctx.watchdogTimer = time.AfterFunc(WatchdogDelay, cancel)
+		state = callTask(tctx, state, args)
+	}
+	if key != "" && state.err == nil {
+		if err := effects.RecordEffect(tctx, key, workflowID, state.def.name, state.serializedResult); err != nil {
+			// The side effect is done, so the task succeeded, but
+			// a re-execution will repeat it.
+			tctx.Printf("recording side effect %q: %v", key, err)
+		}
+	}
+
+	if state.err != nil && !tctx.disableRetries && state.retryCount+1 < MaxRetries {
+		tctx.Printf("task failed, will retry (%v of %v): %v", state.retryCount+1, MaxRetries, state.err)
+		state = taskState{
+			def:        state.def,
+			created:    true,
+			retryCount: state.retryCount + 1,
+		}
+	}
+	return state
+}
+
+// callTask calls the function of the task of state with tctx and args,
+// and records its outcome in state.
+func callTask(tctx *TaskContext, state taskState, args []reflect.Value) taskState {
 	in := append([]reflect.Value{reflect.ValueOf(tctx)}, args...)
 	fv := reflect.ValueOf(state.def.f)
 	out := fv.Call(in)
@@ -916,15 +1092,6 @@ func runTask(ctx context.Context, workflowID uuid.UUID, listener Listener, state
 			state.err = fmt.Errorf("JSON marshaling changed result from %#v to %#v", out[0].Interface(), state.result)
 		}
 	}
-
-	if state.err != nil && !tctx.disableRetries && state.retryCount+1 < MaxRetries {
-		tctx.Printf("task failed, will retry (%v of %v): %v", state.retryCount+1, MaxRetries, state.err)
-		state = taskState{
-			def:        state.def,
-			created:    true,
-			retryCount: state.retryCount + 1,
-		}
-	}
 	return state
 }
 
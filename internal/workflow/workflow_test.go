@@ -6,10 +6,13 @@ package workflow_test
 
 import (
 	"context"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"reflect"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -17,6 +20,9 @@ import (
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
 	"github.com/google/uuid"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 	wf "golang.org/x/build/internal/workflow"
 )
 
@@ -462,6 +468,46 @@ func (l *capturingLogger) Printf(format string, v ...interface{}) {
 	l.lines = append(l.lines, fmt.Sprintf(format, v...))
 }
 
+func TestStructuredLogging(t *testing.T) {
+	log := func(ctx *wf.TaskContext) (string, error) {
+		ctx.Log(wf.LevelWarn, "disk low", "free", 10, "unit")
+		ctx.Progress(1.5, "uploaded", "file", "go.tar.gz")
+		return "", nil
+	}
+
+	wd := wf.New()
+	wf.Output(wd, "out", wf.Task0(wd, "log", log))
+
+	// Loggers that don't support records get formatted text.
+	plain := &capturingLogger{}
+	w := startWorkflow(t, wd, nil)
+	runWorkflow(t, w, &logTestListener{Listener: &verboseListener{t}, logger: plain})
+	wantLines := []string{"WARN: disk low !BADKEY=unit free=10", "uploaded file=go.tar.gz (100% done)"}
+	if !reflect.DeepEqual(plain.lines, wantLines) {
+		t.Errorf("unexpected logging result: got %q, want %q", plain.lines, wantLines)
+	}
+
+	records := &recordingLogger{}
+	w = startWorkflow(t, wd, nil)
+	runWorkflow(t, w, &logTestListener{Listener: &verboseListener{t}, logger: records})
+	wantRecords := []wf.Record{
+		{Level: wf.LevelWarn, Message: "disk low", Fields: map[string]interface{}{"free": 10, "!BADKEY": "unit"}, Progress: -1},
+		{Level: wf.LevelInfo, Message: "uploaded", Fields: map[string]interface{}{"file": "go.tar.gz"}, Progress: 1},
+	}
+	if diff := cmp.Diff(wantRecords, records.records); diff != "" {
+		t.Errorf("unexpected records (-want +got):\n%s", diff)
+	}
+}
+
+type recordingLogger struct {
+	capturingLogger
+	records []wf.Record
+}
+
+func (l *recordingLogger) Log(r wf.Record) {
+	l.records = append(l.records, r)
+}
+
 func TestResume(t *testing.T) {
 	// We expect runOnlyOnce to only run once.
 	var runs int64
@@ -528,6 +574,446 @@ func TestResume(t *testing.T) {
 	})
 }
 
+func TestGraph(t *testing.T) {
+	echo := func(ctx context.Context, arg string) (string, error) { return arg, nil }
+	count := func(ctx context.Context, arg string) (int, error) { return len(arg), nil }
+	act := func(ctx context.Context, _ int) error { return nil }
+
+	wd := wf.New()
+	greeting := wf.Param(wd, wf.ParamDef[string]{Name: "greeting"})
+	e := wf.Task1(wd, "echo", echo, greeting)
+	n := wf.Task1(wd, "count", count, e)
+	a := wf.Action1(wd, "act", act, n)
+	wf.Output(wd, "echoed", wf.Task1(wd, "echo again", echo, e, wf.After(a)))
+
+	want := &wf.Graph{
+		Parameters: []wf.GraphParameter{{Name: "greeting", Type: "string"}},
+		Tasks: []wf.GraphTask{
+			{Name: "act", Inputs: []string{"int"}, Deps: []string{"count"}},
+			{Name: "count", Inputs: []string{"string"}, Output: "int", Deps: []string{"echo"}},
+			{Name: "echo", Inputs: []string{"string"}, Output: "string"},
+			{Name: "echo again", Inputs: []string{"string"}, Output: "string", Deps: []string{"act", "echo"}},
+		},
+		Outputs: []string{"echoed"},
+	}
+	if diff := cmp.Diff(want, wd.Graph()); diff != "" {
+		t.Errorf("Graph() mismatch (-want +got):\n%v", diff)
+	}
+	if w := wf.CheckCompatibility(want, wd.Graph()); w != nil {
+		t.Errorf("CheckCompatibility(g, g) = %q, want no warnings", w)
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	publish := func(ctx *wf.TaskContext, arg string) (string, error) {
+		if ctx.DryRun {
+			return "would publish " + arg, nil
+		}
+		return "published " + arg, nil
+	}
+
+	wd := wf.New()
+	wf.Output(wd, "result", wf.Task1(wd, "publish", publish, wf.Const("go1.21.0"), wf.HonorsDryRun()))
+
+	want := []wf.GraphTask{{Name: "publish", HonorsDryRun: true, Inputs: []string{"string"}, Output: "string"}}
+	if diff := cmp.Diff(want, wd.Graph().Tasks); diff != "" {
+		t.Errorf("Graph().Tasks mismatch (-want +got):\n%v", diff)
+	}
+
+	for _, dryRun := range []bool{false, true} {
+		w := startWorkflow(t, wd, nil)
+		w.DryRun = dryRun
+		outputs := runWorkflow(t, w, nil)
+		want := "published go1.21.0"
+		if dryRun {
+			want = "would publish go1.21.0"
+		}
+		if got := outputs["result"]; got != want {
+			t.Errorf("with DryRun = %v, result = %q, want %q", dryRun, got, want)
+		}
+	}
+}
+
+func TestResources(t *testing.T) {
+	var running, maxRunning int32
+	sign := func(ctx *wf.TaskContext, arg string) (string, error) {
+		n := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			max := atomic.LoadInt32(&maxRunning)
+			if n <= max || atomic.CompareAndSwapInt32(&maxRunning, max, n) {
+				break
+			}
+		}
+		time.Sleep(50 * time.Millisecond)
+		return "signed " + arg, nil
+	}
+
+	wd := wf.New()
+	var signed []wf.Value[string]
+	for _, arg := range []string{"pkg", "msi", "zip"} {
+		signed = append(signed, wf.Task1(wd, "sign "+arg, sign, wf.Const(arg), wf.NeedsResources("signer", "signer")))
+	}
+	wf.Output(wd, "signed", wf.Slice(signed...))
+
+	if got, want := wd.Graph().Tasks[0].Resources, []string{"signer"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Graph().Tasks[0].Resources = %q, want %q", got, want)
+	}
+
+	res := wf.NewResources()
+	res.SetLimit("signer", 1)
+	errc := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		w := startWorkflow(t, wd, nil)
+		w.Resources = res
+		go func() {
+			_, err := w.Run(context.Background(), &verboseListener{t})
+			errc <- err
+		}()
+	}
+	for i := 0; i < 2; i++ {
+		if err := <-errc; err != nil {
+			t.Fatalf("Run() = %v", err)
+		}
+	}
+	if maxRunning != 1 {
+		t.Errorf("at most %v tasks ran concurrently, want 1", maxRunning)
+	}
+	if diff := cmp.Diff([]wf.ResourceStatus{{Name: "signer", Limit: 1}}, res.Status()); diff != "" {
+		t.Errorf("Status() after all workflows finished mismatch (-want +got):\n%v", diff)
+	}
+}
+
+func TestIdempotencyKey(t *testing.T) {
+	var tags []string
+	tag := func(ctx *wf.TaskContext, version, commit string) (string, error) {
+		tags = append(tags, version)
+		return "tagged " + commit + " as " + version, nil
+	}
+	tagKey := func(version, commit string) string { return "tag " + version }
+	definition := func(version string) *wf.Definition {
+		wd := wf.New()
+		wf.Output(wd, "tag", wf.Task2(wd, "tag", tag, wf.Const(version), wf.Const("abc123"), wf.IdempotencyKey(tagKey)))
+		return wd
+	}
+	if !definition("go1.21.0").Graph().Tasks[0].Idempotent {
+		t.Errorf("Graph().Tasks[0].Idempotent = false, want true")
+	}
+
+	effects := &memoryEffects{results: map[string]json.RawMessage{}}
+	for i, version := range []string{"go1.21.0", "go1.21.0", "go1.21.1"} {
+		w := startWorkflow(t, definition(version), nil)
+		w.Effects = effects
+		outputs := runWorkflow(t, w, nil)
+		if got, want := outputs["tag"], "tagged abc123 as "+version; got != want {
+			t.Errorf("run %d: tag = %q, want %q", i, got, want)
+		}
+	}
+	if want := []string{"go1.21.0", "go1.21.1"}; !reflect.DeepEqual(tags, want) {
+		t.Errorf("tagged %q, want %q", tags, want)
+	}
+
+	// A recorded result the task can't have returned isn't reused.
+	effects.results["tag go1.21.2"] = json.RawMessage("42")
+	w := startWorkflow(t, definition("go1.21.2"), nil)
+	w.Effects = effects
+	if got := runToFailure(t, w, nil, "tag"); !strings.Contains(got, "doesn't match the task") {
+		t.Errorf("task error = %q, want one about the recorded result", got)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("IdempotencyKey with a mismatched key function didn't panic")
+		}
+	}()
+	wf.Task2(wf.New(), "tag", tag, wf.Const("go1.21.0"), wf.Const("abc123"), wf.IdempotencyKey(func(version string) string { return version }))
+}
+
+type memoryEffects struct {
+	mu      sync.Mutex
+	results map[string]json.RawMessage
+}
+
+func (e *memoryEffects) Effect(ctx context.Context, key string) (json.RawMessage, bool, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	result, ok := e.results[key]
+	return result, ok, nil
+}
+
+func (e *memoryEffects) RecordEffect(ctx context.Context, key string, workflowID uuid.UUID, task string, result json.RawMessage) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if _, ok := e.results[key]; !ok {
+		e.results[key] = result
+	}
+	return nil
+}
+
+func TestResourcesWaiting(t *testing.T) {
+	started := make(chan bool)
+	block := func(ctx *wf.TaskContext) (string, error) {
+		started <- true
+		<-ctx.Done()
+		return "", ctx.Err()
+	}
+	wd := wf.New()
+	wf.Output(wd, "out", wf.Task0(wd, "block", block, wf.NeedsResources("gomote")))
+
+	res := wf.NewResources()
+	res.SetLimit("gomote", 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	first, second := startWorkflow(t, wd, nil), startWorkflow(t, wd, nil)
+	first.Resources, second.Resources = res, res
+	firstDone := make(chan error)
+	go func() {
+		_, err := first.Run(ctx, &verboseListener{t})
+		firstDone <- err
+	}()
+	defer func() {
+		cancel()
+		<-firstDone
+	}()
+	<-started
+
+	records := &recordingLogger{}
+	secondCtx, cancelSecond := context.WithCancel(ctx)
+	done := make(chan error)
+	go func() {
+		_, err := second.Run(secondCtx, &logTestListener{Listener: &verboseListener{t}, logger: records})
+		done <- err
+	}()
+	var st []wf.ResourceStatus
+	for start := time.Now(); time.Since(start) < 10*time.Second; time.Sleep(10 * time.Millisecond) {
+		if st = res.Status(); len(st[0].Waiting) != 0 {
+			break
+		}
+	}
+	if len(st) != 1 || st[0].InUse != 1 || len(st[0].Waiting) != 1 || st[0].Waiting[0].WorkflowID != second.ID || st[0].Waiting[0].TaskName != "block" {
+		t.Fatalf("Status() = %+v, want one gomote in use and the second workflow's task waiting for it", st)
+	}
+
+	// Canceling a waiting task removes it from the queue without
+	// ever running it.
+	cancelSecond()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("second Run() = %v, want %v", err, context.Canceled)
+	}
+	if st := res.Status(); len(st[0].Waiting) != 0 || st[0].InUse != 1 {
+		t.Errorf("Status() after canceling the waiting task = %+v, want no waiters", st)
+	}
+	if len(records.records) == 0 || records.records[0].Message != "waiting for resource" || records.records[0].Fields["resource"] != "gomote" {
+		t.Errorf("waiting task logged %+v, want a record that it's waiting for the gomote", records.records)
+	}
+}
+
+func TestExecutor(t *testing.T) {
+	type unexported struct{ s string }
+	newDefinition := func() *wf.Definition {
+		wd := wf.New()
+		greeting := wf.Task1(wd, "greet", func(ctx *wf.TaskContext, name string) (string, error) {
+			ctx.Printf("greeting %v", name)
+			return "hello " + name, nil
+		}, wf.Const("gopher"))
+		local := wf.Task1(wd, "local", func(_ context.Context, u unexported) (string, error) {
+			return u.s, nil
+		}, wf.Const(unexported{"unexported"}))
+		pinned := wf.Task1(wd, "pinned", func(_ context.Context, s string) (string, error) {
+			return s + "!", nil
+		}, greeting, wf.RunsInProcess())
+		fail := wf.Action1(wd, "fail", func(ctx *wf.TaskContext, s string) error {
+			if s == "hello gopher!" {
+				return nil
+			}
+			ctx.DisableRetries()
+			return fmt.Errorf("bad greeting %q", s)
+		}, pinned)
+		wf.Output(wd, "pinned", pinned)
+		wf.Output(wd, "local", local)
+		wf.Output(wd, "after", wf.Task0(wd, "after", func(context.Context) (int, error) { return 42, nil }, wf.After(fail)))
+		return wd
+	}
+
+	// The executor runs tasks in a Definition of its own, and
+	// passes everything through JSON, like one in another process
+	// would.
+	exec := &loopbackExecutor{d: newDefinition()}
+	w := startWorkflow(t, newDefinition(), nil)
+	w.Executor = exec
+	logger := &capturingLogger{}
+	outputs := runWorkflow(t, w, &logTestListener{Listener: &verboseListener{t}, logger: logger})
+	want := map[string]interface{}{"pinned": "hello gopher!", "local": "unexported", "after": 42}
+	if diff := cmp.Diff(want, outputs); diff != "" {
+		t.Errorf("outputs mismatch (-want +got):\n%v", diff)
+	}
+	if diff := cmp.Diff([]string{"after", "fail", "greet"}, exec.ran, cmpopts.SortSlices(func(a, b string) bool { return a < b })); diff != "" {
+		t.Errorf("executed tasks mismatch (-want +got):\n%v", diff)
+	}
+	if !strings.Contains(strings.Join(logger.lines, "\n"), "greeting gopher") {
+		t.Errorf("executed task's logs %q don't include its output", logger.lines)
+	}
+
+	// Errors and disabled retries come back from the executor.
+	exec.ran = nil
+	w = startWorkflow(t, newDefinition(), nil)
+	w.Executor = &failingExecutor{exec}
+	if got, want := runToFailure(t, w, nil, "fail"), "bad greeting"; !strings.Contains(got, want) {
+		t.Errorf("got error %q, want %q", got, want)
+	}
+	if n := strings.Count(strings.Join(exec.ran, " "), "fail"); n != 1 {
+		t.Errorf("failing task with retries disabled ran %d times, want 1", n)
+	}
+}
+
+type loopbackExecutor struct {
+	d   *wf.Definition
+	mu  sync.Mutex
+	ran []string
+}
+
+func (e *loopbackExecutor) Execute(ctx context.Context, req *wf.TaskRequest, logger wf.Logger) (*wf.TaskResponse, error) {
+	e.mu.Lock()
+	e.ran = append(e.ran, req.Task)
+	e.mu.Unlock()
+	var remoteReq wf.TaskRequest
+	if err := roundTrip(req, &remoteReq); err != nil {
+		return nil, err
+	}
+	var resp wf.TaskResponse
+	if err := roundTrip(wf.ExecuteTask(ctx, e.d, &remoteReq, logger), &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// failingExecutor changes the greeting on its way to the fail task.
+type failingExecutor struct{ *loopbackExecutor }
+
+func (e *failingExecutor) Execute(ctx context.Context, req *wf.TaskRequest, logger wf.Logger) (*wf.TaskResponse, error) {
+	if req.Task == "fail" {
+		req.Args[0] = json.RawMessage(`"goodbye"`)
+	}
+	return e.loopbackExecutor.Execute(ctx, req, logger)
+}
+
+func TestTaskContextListener(t *testing.T) {
+	defer otel.SetTextMapPropagator(otel.GetTextMapPropagator())
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	traceOf := func(ctx context.Context) (string, error) {
+		return trace.SpanContextFromContext(ctx).TraceID().String(), nil
+	}
+	newDefinition := func() *wf.Definition {
+		wd := wf.New()
+		wf.Output(wd, "local", wf.Task0(wd, "local", traceOf, wf.RunsInProcess()))
+		wf.Output(wd, "executed", wf.Task0(wd, "executed", traceOf))
+		return wd
+	}
+	// Both the tasks run in process and those run by an executor get
+	// the trace context from the listener.
+	w := startWorkflow(t, newDefinition(), nil)
+	w.Executor = &loopbackExecutor{d: newDefinition()}
+	outputs := runWorkflow(t, w, &traceListener{Listener: &verboseListener{t}})
+	traceID := hex.EncodeToString(w.ID[:])
+	want := map[string]interface{}{"local": traceID, "executed": traceID}
+	if diff := cmp.Diff(want, outputs); diff != "" {
+		t.Errorf("outputs mismatch (-want +got):\n%v", diff)
+	}
+}
+
+// traceListener puts a span of the workflow's trace in the context of
+// each task.
+type traceListener struct{ wf.Listener }
+
+func (l *traceListener) TaskContext(ctx context.Context, workflowID uuid.UUID, taskID string) context.Context {
+	return trace.ContextWithSpanContext(ctx, trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID(workflowID),
+		SpanID:     trace.SpanID{1},
+		TraceFlags: trace.FlagsSampled,
+	}))
+}
+
+func roundTrip(in, out interface{}) error {
+	data, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, out)
+}
+
+func TestResumeRenamedTask(t *testing.T) {
+	var runs int64
+	once := func(ctx context.Context) (string, error) {
+		atomic.AddInt64(&runs, 1)
+		return "ran", nil
+	}
+	echo := func(ctx context.Context, arg string) (string, error) { return arg, nil }
+	greet := func(ctx context.Context, arg string) (string, error) { return "hello " + arg, nil }
+
+	oldDef := wf.New()
+	wf.Output(oldDef, "output", wf.Task1(oldDef, "echo", echo, wf.Task0(oldDef, "run once", once)))
+	w := startWorkflow(t, oldDef, nil)
+	storage := &mapListener{Listener: &verboseListener{t}}
+	runWorkflow(t, w, storage)
+
+	newDef := wf.New()
+	v := wf.Task0(newDef, "run only once", once)
+	wf.Output(newDef, "output", wf.Task1(newDef, "greet", greet, wf.Task1(newDef, "echo", echo, v)))
+
+	stored, current := oldDef.Graph(), newDef.Graph()
+	wantWarnings := []string{
+		`task "echo" changed dependencies from ["run once"] to ["run only once"]`,
+		`task "run once" was removed or renamed`,
+		`task "greet" was added`,
+		`task "run only once" was added`,
+	}
+	if diff := cmp.Diff(wantWarnings, wf.CheckCompatibility(stored, current)); diff != "" {
+		t.Errorf("CheckCompatibility mismatch (-want +got):\n%v", diff)
+	}
+
+	taskStates := storage.states[w.ID]
+	if _, err := wf.Resume(newDef, &wf.WorkflowState{ID: w.ID}, taskStates); err == nil {
+		t.Fatalf("Resume with unmigrated task states succeeded, want error")
+	}
+	migrated, warnings := wf.MigrateTaskStates(stored, current, taskStates)
+	wantWarnings = []string{
+		`task "run once" appears to have been renamed to "run only once"; carrying over its state`,
+		`task "greet" is new; it will run from scratch`,
+	}
+	if diff := cmp.Diff(wantWarnings, warnings); diff != "" {
+		t.Errorf("MigrateTaskStates warnings mismatch (-want +got):\n%v", diff)
+	}
+	w2, err := wf.Resume(newDef, &wf.WorkflowState{ID: w.ID}, migrated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := runWorkflow(t, w2, storage)
+	if got, want := out["output"], "hello ran"; got != want {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+	if runs != 1 {
+		t.Errorf("renamed task ran %v times, want 1", runs)
+	}
+}
+
+func TestMigrateTaskStatesAmbiguous(t *testing.T) {
+	stored := &wf.Graph{Tasks: []wf.GraphTask{{Name: "a", Output: "string"}}}
+	current := &wf.Graph{Tasks: []wf.GraphTask{{Name: "b", Output: "string"}, {Name: "c", Output: "string"}}}
+	states := map[string]*wf.TaskState{"a": {Name: "a", Finished: true, SerializedResult: []byte(`"x"`)}}
+	migrated, warnings := wf.MigrateTaskStates(stored, current, states)
+	want := map[string]*wf.TaskState{
+		"a": {Name: "a", Finished: true, SerializedResult: []byte(`"x"`)},
+		"b": {Name: "b"},
+		"c": {Name: "c"},
+	}
+	if diff := cmp.Diff(want, migrated); diff != "" {
+		t.Errorf("MigrateTaskStates mismatch (-want +got):\n%v", diff)
+	}
+	if len(warnings) != 3 || !strings.Contains(warnings[0], "more than one new task") {
+		t.Errorf("MigrateTaskStates warnings = %q, want an ambiguity warning first", warnings)
+	}
+}
+
 type badResult struct {
 	unexported string
 }
@@ -563,7 +1049,7 @@ func (l *mapListener) TaskStateChanged(workflowID uuid.UUID, taskID string, stat
 
 func (l *mapListener) assertState(t *testing.T, w *wf.Workflow, want map[string]*wf.TaskState) {
 	t.Helper()
-	if diff := cmp.Diff(l.states[w.ID], want, cmpopts.IgnoreFields(wf.TaskState{}, "SerializedResult")); diff != "" {
+	if diff := cmp.Diff(l.states[w.ID], want, cmpopts.IgnoreFields(wf.TaskState{}, "SerializedResult", "SerializedArgs")); diff != "" {
 		t.Errorf("task state didn't match expectations: %v", diff)
 	}
 }
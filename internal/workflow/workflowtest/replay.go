@@ -0,0 +1,209 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package workflowtest tests workflow definitions against recordings of
+// real runs of them.
+//
+// A Recording holds the parameters of a run and the inputs and outputs
+// of its tasks, such as those saved by relui. Replay runs a Definition
+// with the recorded parameters, answering each task from the recording
+// instead of calling its function, and reports where the definition
+// invoked tasks differently than the recorded run did. That makes it
+// possible to check changes to complex definitions, like those of
+// releases, without talking to any external service:
+//
+//	var rec workflowtest.Recording
+//	if err := json.Unmarshal(golden, &rec); err != nil {
+//		t.Fatal(err)
+//	}
+//	if _, err := workflowtest.Replay(ctx, def, &rec); err != nil {
+//		t.Error(err)
+//	}
+package workflowtest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+	"golang.org/x/build/internal/workflow"
+)
+
+// A Recording is a record of a run of a workflow. It's meant to be
+// stored as JSON, for example in a golden file.
+type Recording struct {
+	// Params are the JSON encodings of the workflow's parameters, by
+	// name.
+	Params map[string]json.RawMessage
+	DryRun bool `json:",omitempty"`
+	// Tasks are the workflow's tasks, by name.
+	Tasks map[string]*RecordedTask
+}
+
+// A RecordedTask is a record of a task of a workflow.
+type RecordedTask struct {
+	// Args are the JSON encodings of the arguments of the task's
+	// function that follow its context. They're nil if unknown, in
+	// which case replays don't compare them.
+	Args []json.RawMessage `json:",omitempty"`
+	// Result is the JSON encoding of the task's result. It's only set
+	// for tasks, not actions, that succeeded.
+	Result   json.RawMessage `json:",omitempty"`
+	Error    string          `json:",omitempty"`
+	Finished bool            `json:",omitempty"`
+}
+
+// Replay runs def with the parameters of rec, and returns an error
+// describing each difference between the tasks it invokes and the
+// recorded ones:
+//
+//   - a task that isn't in the recording, or didn't finish in it;
+//   - a task invoked with different arguments than the recorded ones;
+//   - a task that finished in the recording but not in the replay.
+//
+// Tasks return the recorded results and errors, and aren't retried.
+// Expansions and the tasks they add are run like any other; the former
+// call their functions, the latter don't. The replay stops when the
+// workflow finishes or stalls, such as after a recorded task error.
+//
+// Replay also returns a recording of the replay, with the arguments of
+// the tasks it invoked, suitable for updating rec.
+func Replay(ctx context.Context, def *workflow.Definition, rec *Recording) (*Recording, error) {
+	params := map[string]interface{}{}
+	for _, p := range def.Parameters() {
+		ptr := reflect.New(p.Type())
+		if err := json.Unmarshal(rec.Params[p.Name()], ptr.Interface()); err != nil {
+			return nil, fmt.Errorf("unmarshaling parameter %q: %v", p.Name(), err)
+		}
+		params[p.Name()] = ptr.Elem().Interface()
+	}
+	w, err := workflow.Start(def, params)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	r := &replayer{
+		rec:    rec,
+		cancel: cancel,
+		replay: &Recording{Params: rec.Params, DryRun: rec.DryRun, Tasks: map[string]*RecordedTask{}},
+	}
+	w.DryRun = rec.DryRun
+	w.Executor = r
+	if _, err := w.Run(ctx, r); err != nil && !r.stalled {
+		return nil, err
+	}
+	return r.replay, r.err()
+}
+
+// A replayer is the Executor and Listener of a replay.
+type replayer struct {
+	rec    *Recording
+	cancel context.CancelFunc
+
+	mu       sync.Mutex
+	replay   *Recording
+	problems []string
+	stalled  bool
+}
+
+var _ workflow.ExclusiveExecutor = (*replayer)(nil)
+
+func (r *replayer) ExecutesAllTasks() {}
+
+func (r *replayer) Execute(ctx context.Context, req *workflow.TaskRequest, logger workflow.Logger) (*workflow.TaskResponse, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	got := &RecordedTask{Args: req.Args}
+	r.replay.Tasks[req.Task] = got
+	want, ok := r.rec.Tasks[req.Task]
+	switch {
+	case !ok:
+		r.problems = append(r.problems, fmt.Sprintf("task %q isn't in the recording", req.Task))
+		return r.fail(got, "task isn't in the recording"), nil
+	case !want.Finished:
+		r.problems = append(r.problems, fmt.Sprintf("task %q didn't finish in the recording", req.Task))
+		return r.fail(got, "task didn't finish in the recording"), nil
+	}
+	if want.Args != nil {
+		if err := compareArgs(want.Args, req.Args); err != nil {
+			r.problems = append(r.problems, fmt.Sprintf("task %q: %v", req.Task, err))
+		}
+	}
+	got.Result, got.Error, got.Finished = want.Result, want.Error, true
+	return &workflow.TaskResponse{Result: want.Result, Error: want.Error, DisableRetries: true}, nil
+}
+
+// fail records that the replayed task got failed with msg, and returns
+// the response that fails it.
+func (r *replayer) fail(got *RecordedTask, msg string) *workflow.TaskResponse {
+	got.Error, got.Finished = msg, true
+	return &workflow.TaskResponse{Error: msg, DisableRetries: true}
+}
+
+func (r *replayer) TaskStateChanged(_ uuid.UUID, name string, state *workflow.TaskState) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	// Expansions don't go through the Executor.
+	if _, ok := r.replay.Tasks[name]; !ok && state.Finished {
+		r.replay.Tasks[name] = &RecordedTask{Error: state.Error, Finished: true}
+	}
+	return nil
+}
+
+func (r *replayer) Logger(uuid.UUID, string) workflow.Logger { return discard{} }
+
+func (r *replayer) WorkflowStalled(uuid.UUID) error {
+	r.mu.Lock()
+	r.stalled = true
+	r.mu.Unlock()
+	r.cancel()
+	return nil
+}
+
+// err returns the differences between the recording and the replay.
+func (r *replayer) err() error {
+	problems := r.problems
+	for name, want := range r.rec.Tasks {
+		if got, ok := r.replay.Tasks[name]; want.Finished && (!ok || !got.Finished) {
+			problems = append(problems, fmt.Sprintf("task %q finished in the recording but wasn't run", name))
+		}
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	sort.Strings(problems)
+	return errors.New("replay differs from recording:\n\t" + strings.Join(problems, "\n\t"))
+}
+
+// compareArgs returns an error if the task arguments got and want don't
+// have the same JSON values.
+func compareArgs(want, got []json.RawMessage) error {
+	if len(got) != len(want) {
+		return fmt.Errorf("invoked with %d arguments, recorded with %d", len(got), len(want))
+	}
+	for i := range got {
+		var g, w interface{}
+		if err := json.Unmarshal(got[i], &g); err != nil {
+			return fmt.Errorf("argument %d: %v", i+1, err)
+		}
+		if err := json.Unmarshal(want[i], &w); err != nil {
+			return fmt.Errorf("recorded argument %d: %v", i+1, err)
+		}
+		if !reflect.DeepEqual(g, w) {
+			return fmt.Errorf("argument %d is %s, recorded as %s", i+1, got[i], want[i])
+		}
+	}
+	return nil
+}
+
+type discard struct{}
+
+func (discard) Printf(string, ...interface{}) {}
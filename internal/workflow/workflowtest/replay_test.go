@@ -0,0 +1,144 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package workflowtest_test
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	wf "golang.org/x/build/internal/workflow"
+	"golang.org/x/build/internal/workflow/workflowtest"
+)
+
+// releaseDefinition returns a definition that tags a version and, for
+// each of its platforms, uploads a build. Its tasks fail the test if
+// called.
+func releaseDefinition(t *testing.T, uploadArg string) *wf.Definition {
+	noCall := func(name string) {
+		t.Errorf("task %q was called during a replay", name)
+	}
+	tag := func(ctx context.Context, version string) (string, error) {
+		noCall("tag")
+		return "", nil
+	}
+	upload := func(ctx context.Context, tag, platform string) (string, error) {
+		noCall("upload " + platform)
+		return "", nil
+	}
+	d := wf.New()
+	version := wf.Param(d, wf.ParamDef[string]{Name: "version"})
+	platforms := wf.Param(d, wf.ParamDef[[]string]{Name: "platforms", ParamType: wf.SliceShort})
+	tagged := wf.Task1(d, "tag", tag, version)
+	wf.Expand2(d, "upload", func(d *wf.Definition, tagged string, platforms []string) error {
+		var uploads []wf.Value[string]
+		for _, p := range platforms {
+			uploads = append(uploads, wf.Task2(d, "upload "+p, upload, wf.Const(uploadArg+tagged), wf.Const(p)))
+		}
+		wf.Output(d, "uploads", wf.Slice(uploads...))
+		return nil
+	}, tagged, platforms)
+	return d
+}
+
+func raw(s string) json.RawMessage { return json.RawMessage(s) }
+
+func recording() *workflowtest.Recording {
+	return &workflowtest.Recording{
+		Params: map[string]json.RawMessage{
+			"version":   raw(`"go1.21.0"`),
+			"platforms": raw(`["linux-amd64", "darwin-arm64"]`),
+		},
+		Tasks: map[string]*workflowtest.RecordedTask{
+			"tag":                 {Args: []json.RawMessage{raw(`"go1.21.0"`)}, Result: raw(`"refs/tags/go1.21.0"`), Finished: true},
+			"upload":              {Finished: true},
+			"upload linux-amd64":  {Args: []json.RawMessage{raw(`"refs/tags/go1.21.0"`), raw(`"linux-amd64"`)}, Result: raw(`"https://go.dev/dl/go1.21.0.linux-amd64.tar.gz"`), Finished: true},
+			"upload darwin-arm64": {Result: raw(`"https://go.dev/dl/go1.21.0.darwin-arm64.tar.gz"`), Finished: true},
+		},
+	}
+}
+
+func TestReplay(t *testing.T) {
+	rec := recording()
+	got, err := workflowtest.Replay(context.Background(), releaseDefinition(t, ""), rec)
+	if err != nil {
+		t.Fatalf("Replay() = %v", err)
+	}
+
+	// The replay fills in unknown arguments.
+	want := recording()
+	want.Tasks["upload darwin-arm64"].Args = []json.RawMessage{raw(`"refs/tags/go1.21.0"`), raw(`"darwin-arm64"`)}
+	normalize := cmp.Transformer("normalize", func(m json.RawMessage) interface{} {
+		var v interface{}
+		json.Unmarshal(m, &v)
+		return v
+	})
+	if diff := cmp.Diff(want, got, normalize); diff != "" {
+		t.Errorf("Replay() recording mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestReplayMismatch(t *testing.T) {
+	tests := []struct {
+		name      string
+		uploadArg string
+		edit      func(*workflowtest.Recording)
+		want      []string
+	}{
+		{
+			name:      "changed argument",
+			uploadArg: "prefix/",
+			want:      []string{`task "upload linux-amd64": argument 1 is "prefix/refs/tags/go1.21.0", recorded as "refs/tags/go1.21.0"`},
+		},
+		{
+			name: "new task",
+			edit: func(r *workflowtest.Recording) { delete(r.Tasks, "upload darwin-arm64") },
+			want: []string{`task "upload darwin-arm64" isn't in the recording`},
+		},
+		{
+			name: "missing task",
+			edit: func(r *workflowtest.Recording) {
+				r.Params["platforms"] = raw(`["linux-amd64"]`)
+			},
+			want: []string{`task "upload darwin-arm64" finished in the recording but wasn't run`},
+		},
+		{
+			name: "recorded failure",
+			edit: func(r *workflowtest.Recording) {
+				r.Tasks["tag"] = &workflowtest.RecordedTask{Error: "permission denied", Finished: true}
+				for name, task := range r.Tasks {
+					if strings.HasPrefix(name, "upload") {
+						task.Result, task.Finished = nil, false
+					}
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := recording()
+			if tt.edit != nil {
+				tt.edit(rec)
+			}
+			_, err := workflowtest.Replay(context.Background(), releaseDefinition(t, tt.uploadArg), rec)
+			if len(tt.want) == 0 {
+				if err != nil {
+					t.Errorf("Replay() = %v, want no error", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("Replay() = nil, want error")
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("Replay() = %v, want error containing %q", err, want)
+				}
+			}
+		})
+	}
+}
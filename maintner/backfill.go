@@ -0,0 +1,410 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package maintner
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/github"
+	"golang.org/x/build/internal/envutil"
+	"golang.org/x/build/maintner/maintpb"
+	"golang.org/x/oauth2"
+)
+
+// A BackfillRequest describes part of the history of a watched GitHub
+// repo or Gerrit project for Corpus.Backfill to re-fetch.
+type BackfillRequest struct {
+	// Repo is the GitHub repo, as "github.com/owner/repo", or the
+	// Gerrit project, as "go.googlesource.com/go", to backfill.
+	Repo string
+
+	// Since and Until bound the modification times of the data to
+	// re-fetch. A zero Until means the present.
+	Since, Until time.Time
+
+	// DryRun, if true, makes Backfill only report the mutations that
+	// would correct the corpus, without applying or logging them.
+	DryRun bool
+
+	// Logf, if non-nil, is called with each progress message and
+	// corrective mutation, which are also written to the process log.
+	Logf func(format string, args ...interface{})
+}
+
+// Backfill re-fetches the part of a watched repo's history described by
+// req, reconciles it against the corpus, and appends mutations to the
+// log for whatever the corpus is missing or has stale, such as data lost
+// to an outage of the sync. It returns those mutations.
+//
+// For GitHub repos, the issues and pull requests updated since
+// req.Since are brought up to date, and their comments and events
+// from the range that the corpus lacks are added. For Gerrit projects,
+// the change refs last updated in the range whose corpus state differs
+// from the server's, or whose history is incomplete, are re-recorded
+// along with their missing commits.
+//
+// Backfill is only valid in leader mode, and the repo must be watched.
+// It may run concurrently with SyncLoop: like the mutations of the
+// sync, its mutations are differences from the corpus, so in the rare
+// case both record the same change, applying it twice is harmless.
+func (c *Corpus) Backfill(ctx context.Context, req BackfillRequest) ([]*maintpb.Mutation, error) {
+	if c.mutationLogger == nil {
+		return nil, errors.New("maintner: can't Backfill in non-leader mode")
+	}
+	if !req.Until.IsZero() && !req.Since.Before(req.Until) {
+		return nil, fmt.Errorf("maintner: empty backfill range %v to %v", req.Since, req.Until)
+	}
+	b := &backfiller{c: c, req: req}
+	b.logf("starting backfill of %v to %v (dry run: %v)", req.Since, req.Until, req.DryRun)
+	err := b.run(ctx)
+	if err != nil {
+		b.logf("backfill failed after %d mutations: %v", len(b.muts), err)
+	} else {
+		b.logf("backfill done: %d mutations", len(b.muts))
+	}
+	return b.muts, err
+}
+
+// A backfiller does the work of a Backfill call.
+type backfiller struct {
+	c    *Corpus
+	req  BackfillRequest
+	muts []*maintpb.Mutation // corrective mutations so far
+}
+
+func (b *backfiller) run(ctx context.Context) error {
+	if id, ok := strings.CutPrefix(b.req.Repo, "github.com/"); ok {
+		for _, w := range b.c.watchedGithubRepos {
+			if strings.EqualFold(w.gr.id.String(), id) {
+				hc := oauth2.NewClient(ctx, oauth2.StaticTokenSource(&oauth2.Token{AccessToken: w.token}))
+				return b.github(ctx, w.gr.newPoller(hc, w.token))
+			}
+		}
+	}
+	for _, w := range b.c.watchedGerritRepos {
+		if w.project.proj == b.req.Repo {
+			return b.gerrit(ctx, w.project)
+		}
+	}
+	return fmt.Errorf("maintner: %s isn't watched by the corpus", b.req.Repo)
+}
+
+func (b *backfiller) logf(format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	log.Printf("backfill %s: %s", b.req.Repo, msg)
+	if b.req.Logf != nil {
+		b.req.Logf("%s", msg)
+	}
+}
+
+// inRange reports whether t is in the range of times to backfill.
+func (b *backfiller) inRange(t time.Time) bool {
+	return !t.Before(b.req.Since) && (b.req.Until.IsZero() || t.Before(b.req.Until))
+}
+
+// add records m, which corrects what, and applies it unless this is a
+// dry run.
+func (b *backfiller) add(m *maintpb.Mutation, what string) {
+	b.muts = append(b.muts, m)
+	b.logf("%s", what)
+	if !b.req.DryRun {
+		b.c.addMutation(m)
+	}
+}
+
+// github backfills the GitHub repo polled by p.
+func (b *backfiller) github(ctx context.Context, p *githubRepoPoller) error {
+	owner, repo := p.Owner(), p.Repo()
+	var nums []int32
+	for page := 1; page != 0; {
+		issues, res, err := p.githubDirect.Issues.ListByRepo(ctx, owner, repo, &github.IssueListByRepoOptions{
+			State:       "all",
+			Sort:        "updated",
+			Direction:   "asc",
+			Since:       b.req.Since,
+			ListOptions: github.ListOptions{Page: page, PerPage: 100},
+		})
+		if err != nil {
+			if canRetry(ctx, err) {
+				continue
+			}
+			return err
+		}
+		for _, is := range issues {
+			if is.Number == nil || !b.req.Until.IsZero() && !is.GetCreatedAt().Before(b.req.Until) {
+				continue
+			}
+			nums = append(nums, int32(is.GetNumber()))
+			p.c.mu.RLock()
+			mp := p.gr.newMutationFromIssue(p.gr.issues[int32(is.GetNumber())], is)
+			p.c.mu.RUnlock()
+			if mp != nil {
+				b.add(mp, fmt.Sprintf("issue %d: updated issue state", is.GetNumber()))
+			}
+		}
+		page = res.NextPage
+	}
+	b.logf("%d issues updated since %v", len(nums), b.req.Since)
+	for _, num := range nums {
+		if err := b.githubIssue(ctx, p, num); err != nil {
+			return fmt.Errorf("issue %d: %v", num, err)
+		}
+	}
+	return nil
+}
+
+// githubIssue backfills the comments and events on an issue.
+func (b *backfiller) githubIssue(ctx context.Context, p *githubRepoPoller, num int32) error {
+	mut := &maintpb.GithubIssueMutation{
+		Owner:  p.Owner(),
+		Repo:   p.Repo(),
+		Number: num,
+	}
+	for page := 1; page != 0; {
+		ics, res, err := p.githubDirect.Issues.ListComments(ctx, p.Owner(), p.Repo(), int(num), &github.IssueListCommentsOptions{
+			Since:       b.req.Since,
+			Direction:   "asc",
+			Sort:        "updated",
+			ListOptions: github.ListOptions{Page: page, PerPage: 100},
+		})
+		if err != nil {
+			if canRetry(ctx, err) {
+				continue
+			}
+			return err
+		}
+		p.c.mu.RLock()
+		for _, ic := range ics {
+			if ic.ID == nil || ic.Body == nil || ic.User == nil || ic.CreatedAt == nil || ic.UpdatedAt == nil {
+				continue
+			}
+			if !b.inRange(*ic.CreatedAt) && !b.inRange(*ic.UpdatedAt) {
+				continue
+			}
+			var cur *GitHubComment
+			if gi := p.gr.issues[num]; gi != nil {
+				cur = gi.comments[int64(*ic.ID)]
+			}
+			cmut, err := newCommentMutation(cur, ic)
+			if err == nil && cmut != nil {
+				mut.Comment = append(mut.Comment, cmut)
+			}
+		}
+		p.c.mu.RUnlock()
+		page = res.NextPage
+	}
+
+	const perPage = 100
+	err := p.foreachItem(ctx, 1,
+		func(ctx context.Context, page int) ([]interface{}, *github.Response, error) {
+			is, res, _, err := p.getEventPage(ctx, num, page, perPage)
+			return is, res, err
+		},
+		func(v interface{}) error {
+			ge := v.(*GitHubIssueEvent)
+			if !b.inRange(ge.Created) {
+				return nil
+			}
+			p.c.mu.RLock()
+			var ok bool
+			if gi := p.gr.issues[num]; gi != nil {
+				_, ok = gi.events[ge.ID]
+			}
+			p.c.mu.RUnlock()
+			if !ok {
+				mut.Event = append(mut.Event, ge.Proto())
+			}
+			return nil
+		})
+	if err != nil {
+		return err
+	}
+
+	if len(mut.Comment) > 0 || len(mut.Event) > 0 {
+		b.add(&maintpb.Mutation{GithubIssue: mut}, fmt.Sprintf("issue %d: %d missing or stale comments, %d missing events", num, len(mut.Comment), len(mut.Event)))
+	}
+	return nil
+}
+
+// gerrit backfills the Gerrit project gp.
+func (b *backfiller) gerrit(ctx context.Context, gp *GerritProject) error {
+	// The sync fetches into the same git directory.
+	gp.gitMu.Lock()
+	out, err := func() ([]byte, error) {
+		if err := gp.init(ctx); err != nil {
+			return nil, err
+		}
+		if err := gp.fetchOrigin(ctx); err != nil {
+			return nil, err
+		}
+		return gp.lsRemote(ctx)
+	}()
+	gp.gitMu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	type staleRef struct {
+		name string
+		hash GitHash
+		why  string
+	}
+	var stale, metas []staleRef
+	c := b.c
+	// The hashes aren't interned with c.gitHashFromHex, so that this
+	// only needs c.mu held for reading. Mutations intern them when
+	// they're applied.
+	c.mu.RLock()
+	for _, line := range bytes.Split(out, []byte("\n")) {
+		// Non-change refs are reconciled on every sync.
+		m := rxRemoteRef.FindSubmatch(line)
+		if m == nil {
+			continue
+		}
+		clNum, err := strconv.ParseInt(string(m[2]), 10, 32)
+		version, ok := gerritVersionNumber(string(m[3]))
+		if err != nil || !ok {
+			continue
+		}
+		hash, err := hex.DecodeString(string(m[1]))
+		if err != nil || len(hash) != 20 {
+			continue
+		}
+		r := staleRef{
+			name: strings.TrimSpace(string(line[bytes.IndexByte(line, '\t')+1:])),
+			hash: GitHash(hash),
+		}
+		if cur := gp.remote[gerritCLVersion{int32(clNum), version}]; cur != r.hash {
+			r.why = fmt.Sprintf("corpus has %v", cur)
+			stale = append(stale, r)
+			continue
+		}
+		// Only the meta refs last updated in the range need
+		// their histories checked.
+		if gc := c.gitCommit[r.hash]; version == 0 && gc != nil && b.inRange(gc.CommitTime) {
+			metas = append(metas, r)
+		}
+	}
+	c.mu.RUnlock()
+	for _, r := range metas {
+		c.mu.RLock()
+		err := gp.foreachCommit(c.gitCommit[r.hash], func(*GitCommit) error { return nil })
+		c.mu.RUnlock()
+		if err != nil {
+			r.why = fmt.Sprintf("incomplete history: %v", err)
+			stale = append(stale, r)
+		}
+	}
+	b.logf("%d change refs differ from the corpus", len(stale))
+
+	const batchSize = 250
+	for i := 0; i < len(stale); i += batchSize {
+		batch := stale[i:]
+		if len(batch) > batchSize {
+			batch = batch[:batchSize]
+		}
+		var hashes []GitHash
+		for _, r := range batch {
+			hashes = append(hashes, r.hash)
+		}
+		gp.gitMu.Lock()
+		err := gp.fetchHashes(ctx, hashes)
+		gp.gitMu.Unlock()
+		if err != nil {
+			return err
+		}
+		for _, r := range batch {
+			t, err := gitCommitTime(gp.gitDir(), r.hash)
+			if err != nil {
+				return err
+			}
+			if !b.inRange(t) {
+				continue
+			}
+			commits, err := b.missingCommits(gp, r.hash)
+			if err != nil {
+				return err
+			}
+			b.add(&maintpb.Mutation{
+				Gerrit: &maintpb.GerritMutation{
+					Project: gp.proj,
+					Commits: commits,
+					Refs:    []*maintpb.GitRef{{Ref: r.name, Sha1: r.hash.String()}},
+				},
+			}, fmt.Sprintf("%s = %v, updated %v (%s): %d missing commits", r.name, r.hash, t.UTC(), r.why, len(commits)))
+		}
+	}
+	return nil
+}
+
+// missingCommits returns the commits reachable from hash that the
+// corpus doesn't have, parents first.
+func (b *backfiller) missingCommits(gp *GerritProject, hash GitHash) ([]*maintpb.GitCommit, error) {
+	var commits []*maintpb.GitCommit
+	seen := map[GitHash]bool{}
+	var visit func(hash GitHash) error
+	visit = func(hash GitHash) error {
+		b.c.mu.RLock()
+		_, have := b.c.gitCommit[hash]
+		b.c.mu.RUnlock()
+		if have || seen[hash] {
+			return nil
+		}
+		seen[hash] = true
+		commit, err := parseCommitFromGit(gp.gitDir(), hash)
+		if err != nil {
+			return err
+		}
+		for _, parent := range commitParents(commit.Raw) {
+			b.c.mu.Lock()
+			ph := b.c.gitHashFromHexStr(parent)
+			b.c.mu.Unlock()
+			if err := visit(ph); err != nil {
+				return err
+			}
+		}
+		commits = append(commits, commit)
+		return nil
+	}
+	return commits, visit(hash)
+}
+
+// commitParents returns the hex hashes of the parents of the commit
+// whose "git cat-file commit" output is raw.
+func commitParents(raw []byte) []string {
+	hdr, _, _ := bytes.Cut(raw, nlnl)
+	var parents []string
+	for _, line := range strings.Split(string(hdr), "\n") {
+		if p, ok := strings.CutPrefix(line, "parent "); ok {
+			parents = append(parents, p)
+		}
+	}
+	return parents
+}
+
+// gitCommitTime returns the commit time of the commit hash in the git
+// repository in dir.
+func gitCommitTime(dir string, hash GitHash) (time.Time, error) {
+	cmd := exec.Command("git", "show", "-s", "--format=%ct", hash.String())
+	envutil.SetDir(cmd, dir)
+	out, err := cmd.Output()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("git show %v: %v", hash, formatExecError(err))
+	}
+	sec, err := strconv.ParseInt(strings.TrimSpace(string(out)), 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("git show %v: bad commit time %q", hash, out)
+	}
+	return time.Unix(sec, 0), nil
+}
@@ -0,0 +1,274 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package maintner
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/github"
+	"golang.org/x/build/maintner/maintpb"
+)
+
+// handlerTransport is a RoundTripper that serves requests, to any host,
+// with a handler.
+type handlerTransport struct{ http.Handler }
+
+func (t handlerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	w := httptest.NewRecorder()
+	t.ServeHTTP(w, req)
+	return w.Result(), nil
+}
+
+func TestBackfillGitHub(t *testing.T) {
+	// The GitHub API serves issue 1, last updated at 12:00 on
+	// 2023-09-02, which the corpus lacks the comment and event of
+	// from 10:00 that day, an out-of-date title, and issue 2, created
+	// after the range to backfill.
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/golang/go/issues", func(w http.ResponseWriter, r *http.Request) {
+		if got := r.FormValue("since"); got != "2023-09-02T00:00:00Z" {
+			t.Errorf("issues listed since %q; want 2023-09-02T00:00:00Z", got)
+		}
+		w.Write([]byte(`[
+			{"id": 1001, "number": 1, "title": "x/build: new title", "user": {"id": 100, "login": "gopher"},
+			 "created_at": "2023-09-01T10:00:00Z", "updated_at": "2023-09-02T12:00:00Z"},
+			{"id": 1002, "number": 2, "title": "later", "user": {"id": 100, "login": "gopher"},
+			 "created_at": "2023-09-04T10:00:00Z", "updated_at": "2023-09-04T10:00:00Z"}
+		]`))
+	})
+	mux.HandleFunc("/repos/golang/go/issues/1/comments", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[
+			{"id": 5001, "body": "seen", "user": {"id": 100, "login": "gopher"},
+			 "created_at": "2023-09-01T11:00:00Z", "updated_at": "2023-09-01T11:00:00Z"},
+			{"id": 5002, "body": "lost", "user": {"id": 101, "login": "gopher2"},
+			 "created_at": "2023-09-02T10:00:00Z", "updated_at": "2023-09-02T10:00:00Z"},
+			{"id": 5003, "body": "after", "user": {"id": 101, "login": "gopher2"},
+			 "created_at": "2023-09-03T10:00:00Z", "updated_at": "2023-09-03T10:00:00Z"}
+		]`))
+	})
+	mux.HandleFunc("/repos/golang/go/issues/1/events", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Date", "Mon, 04 Sep 2023 00:00:00 GMT")
+		w.Write([]byte(`[
+			{"id": 7001, "event": "labeled", "label": {"name": "Builders"}, "created_at": "2023-09-02T10:00:00Z"},
+			{"id": 7002, "event": "closed", "created_at": "2023-09-03T10:00:00Z"}
+		]`))
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected request for %v", r.URL)
+		http.NotFound(w, r)
+	})
+	hc := &http.Client{Transport: handlerTransport{mux}}
+
+	c := new(Corpus)
+	logger := new(dummyMutationLogger)
+	c.EnableLeaderMode(logger, t.TempDir())
+	c.initGithub()
+	gr := c.github.getOrCreateRepo("golang", "go")
+	created := time.Date(2023, 9, 1, 10, 0, 0, 0, time.UTC)
+	updated := time.Date(2023, 9, 1, 11, 0, 0, 0, time.UTC)
+	c.addMutation(gr.newMutationFromIssue(nil, &github.Issue{
+		ID:        github.Int64(1001),
+		Number:    github.Int(1),
+		Title:     github.String("x/build: old title"),
+		User:      &github.User{ID: github.Int64(100), Login: github.String("gopher")},
+		CreatedAt: &created,
+		UpdatedAt: &updated,
+	}))
+	seen := mustProtoFromTime(updated)
+	c.addMutation(&maintpb.Mutation{GithubIssue: &maintpb.GithubIssueMutation{
+		Owner:  "golang",
+		Repo:   "go",
+		Number: 1,
+		Comment: []*maintpb.GithubIssueCommentMutation{{
+			Id:      5001,
+			User:    &maintpb.GithubUser{Id: 100, Login: "gopher"},
+			Body:    "seen",
+			Created: seen,
+			Updated: seen,
+		}},
+	}})
+	logger.Mutations = nil
+
+	backfill := func(dryRun bool) []string {
+		b := &backfiller{c: c, req: BackfillRequest{
+			Repo:   "github.com/golang/go",
+			Since:  time.Date(2023, 9, 2, 0, 0, 0, 0, time.UTC),
+			Until:  time.Date(2023, 9, 3, 0, 0, 0, 0, time.UTC),
+			DryRun: dryRun,
+		}}
+		p := gr.newPoller(hc, "token")
+		p.client = hc
+		if err := b.github(context.Background(), p); err != nil {
+			t.Fatal(err)
+		}
+		var muts []string
+		for _, m := range b.muts {
+			muts = append(muts, m.String())
+		}
+		return muts
+	}
+
+	muts := backfill(true)
+	if len(muts) != 2 || !strings.Contains(muts[0], "new title") || !strings.Contains(muts[1], "5002") || !strings.Contains(muts[1], "7001") ||
+		strings.Contains(muts[1], "5001") || strings.Contains(muts[1], "5003") || strings.Contains(muts[1], "7002") {
+		t.Fatalf("dry run backfill mutations:\n%s\nwant the new title, and comment 5002 and event 7001", strings.Join(muts, "\n"))
+	}
+	if len(logger.Mutations) != 0 {
+		t.Errorf("dry run logged %d mutations; want none", len(logger.Mutations))
+	}
+	if gi := gr.Issue(1); gi.Title != "x/build: old title" || gi.comments[5002] != nil {
+		t.Errorf("dry run changed the corpus")
+	}
+
+	if muts := backfill(false); len(muts) != 2 {
+		t.Fatalf("backfill made %d mutations; want 2", len(muts))
+	}
+	if len(logger.Mutations) != 2 {
+		t.Errorf("backfill logged %d mutations; want 2", len(logger.Mutations))
+	}
+	gi := gr.Issue(1)
+	if gi.Title != "x/build: new title" || gi.comments[5002] == nil || gi.events[7001] == nil || gi.comments[5003] != nil || gi.events[7002] != nil {
+		t.Errorf("backfill didn't correct the corpus: title %q, comments %v, events %v", gi.Title, gi.comments, gi.events)
+	}
+	if gr.Issue(2) != nil {
+		t.Errorf("backfill added issue 2, created after the range")
+	}
+
+	// Once the gap is filled, there's nothing left to backfill.
+	if muts := backfill(false); len(muts) != 0 {
+		t.Errorf("second backfill made mutations:\n%s", strings.Join(muts, "\n"))
+	}
+}
+
+func TestBackfillGerrit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+	git := func(dir, date string, args ...string) string {
+		t.Helper()
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(),
+			"GIT_AUTHOR_NAME=Gopher", "GIT_AUTHOR_EMAIL=gopher@golang.org", "GIT_AUTHOR_DATE="+date,
+			"GIT_COMMITTER_NAME=Gopher", "GIT_COMMITTER_EMAIL=gopher@golang.org", "GIT_COMMITTER_DATE="+date)
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+
+	// The origin has a base commit on master, the first patch set of
+	// CL 1, committed on 2023-09-02, and the first patch set of
+	// CL 2, committed after the range to backfill.
+	origin := t.TempDir()
+	git(origin, "", "init", "--quiet")
+	git(origin, "", "config", "uploadpack.allowAnySHA1InWant", "true")
+	base := git(origin, "2023-09-01T10:00:00Z", "commit-tree", "4b825dc642cb6eb9a060e54bf8d69288fbee4904", "-m", "base")
+	cl1 := git(origin, "2023-09-02T10:00:00Z", "commit-tree", "4b825dc642cb6eb9a060e54bf8d69288fbee4904", "-p", base, "-m", "CL 1")
+	cl2 := git(origin, "2023-09-04T10:00:00Z", "commit-tree", "4b825dc642cb6eb9a060e54bf8d69288fbee4904", "-p", base, "-m", "CL 2")
+	git(origin, "", "update-ref", "refs/heads/master", base)
+	git(origin, "", "update-ref", "refs/changes/01/1/1", cl1)
+	git(origin, "", "update-ref", "refs/changes/02/2/1", cl2)
+
+	const proj = "go.googlesource.com/test"
+	c := new(Corpus)
+	logger := new(dummyMutationLogger)
+	dataDir := t.TempDir()
+	c.EnableLeaderMode(logger, dataDir)
+	c.TrackGerrit(proj)
+	gitDir := filepath.Join(dataDir, url.PathEscape(proj))
+	if err := os.Mkdir(gitDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	git(gitDir, "", "init", "--quiet")
+	git(gitDir, "", "remote", "add", "origin", origin)
+
+	backfill := func(dryRun bool) []*maintpb.Mutation {
+		muts, err := c.Backfill(context.Background(), BackfillRequest{
+			Repo:   proj,
+			Since:  time.Date(2023, 9, 2, 0, 0, 0, 0, time.UTC),
+			Until:  time.Date(2023, 9, 3, 0, 0, 0, 0, time.UTC),
+			DryRun: dryRun,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return muts
+	}
+
+	muts := backfill(true)
+	if len(muts) != 1 {
+		t.Fatalf("dry run backfill made %d mutations; want 1:\n%v", len(muts), muts)
+	}
+	gm := muts[0].Gerrit
+	if len(gm.Refs) != 1 || gm.Refs[0].Ref != "refs/changes/01/1/1" || gm.Refs[0].Sha1 != cl1 {
+		t.Errorf("backfill refs = %v; want refs/changes/01/1/1 = %s", gm.Refs, cl1)
+	}
+	if len(gm.Commits) != 2 || gm.Commits[0].Sha1 != base || gm.Commits[1].Sha1 != cl1 {
+		t.Errorf("backfill commits = %v; want %s and %s, parents first", gm.Commits, base, cl1)
+	}
+	if len(logger.Mutations) != 0 {
+		t.Errorf("dry run logged %d mutations; want none", len(logger.Mutations))
+	}
+
+	if muts := backfill(false); len(muts) != 1 {
+		t.Fatalf("backfill made %d mutations; want 1", len(muts))
+	}
+	if len(logger.Mutations) != 1 {
+		t.Errorf("backfill logged %d mutations; want 1", len(logger.Mutations))
+	}
+	gp := c.Gerrit().Project("go.googlesource.com", "test")
+	if got := gp.remote[gerritCLVersion{1, 1}]; got.String() != cl1 {
+		t.Errorf("corpus has refs/changes/01/1/1 = %v after backfill; want %s", got, cl1)
+	}
+	if c.gitCommit[gp.remote[gerritCLVersion{1, 1}]] == nil {
+		t.Errorf("backfill didn't add commit %s to the corpus", cl1)
+	}
+
+	// Once the gap is filled, there's nothing left to backfill.
+	if muts := backfill(false); len(muts) != 0 {
+		t.Errorf("second backfill made mutations:\n%v", muts)
+	}
+}
+
+func TestBackfillErrors(t *testing.T) {
+	ctx := context.Background()
+	c := new(Corpus)
+	since := time.Date(2023, 9, 2, 0, 0, 0, 0, time.UTC)
+	if _, err := c.Backfill(ctx, BackfillRequest{Repo: "github.com/golang/go", Since: since}); err == nil {
+		t.Errorf("Backfill in non-leader mode succeeded; want error")
+	}
+	c.EnableLeaderMode(new(dummyMutationLogger), t.TempDir())
+	if _, err := c.Backfill(ctx, BackfillRequest{Repo: "github.com/golang/go", Since: since}); err == nil || !strings.Contains(err.Error(), "isn't watched") {
+		t.Errorf("Backfill of an unwatched repo = %v; want not watched error", err)
+	}
+	if _, err := c.Backfill(ctx, BackfillRequest{Repo: "github.com/golang/go", Since: since, Until: since}); err == nil {
+		t.Errorf("Backfill of an empty range succeeded; want error")
+	}
+}
+
+func TestCommitParents(t *testing.T) {
+	raw := []byte("tree 4b825dc642cb6eb9a060e54bf8d69288fbee4904\n" +
+		"parent 1111111111111111111111111111111111111111\n" +
+		"parent 2222222222222222222222222222222222222222\n" +
+		"author Gopher <gopher@golang.org> 1693569600 +0000\n" +
+		"committer Gopher <gopher@golang.org> 1693569600 +0000\n" +
+		"\n" +
+		"parent not a header\n")
+	got := commitParents(raw)
+	if len(got) != 2 || got[0] != strings.Repeat("1", 40) || got[1] != strings.Repeat("2", 40) {
+		t.Errorf("commitParents = %q; want the two parent lines of the header", got)
+	}
+}
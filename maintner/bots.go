@@ -0,0 +1,37 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package maintner
+
+import (
+	"strings"
+
+	"golang.org/x/build/internal/gophers"
+)
+
+// IsBot reports whether u is an automated account, such as gopherbot
+// or dependabot, rather than a human. GitHub Apps have logins ending
+// in "[bot]"; other bots are marked as such in package gophers.
+func (u *GitHubUser) IsBot() bool {
+	if u == nil {
+		return false
+	}
+	if strings.HasSuffix(u.Login, "[bot]") {
+		return true
+	}
+	p := gophers.GetPerson("@" + u.Login)
+	return p != nil && p.Bot
+}
+
+// IsBot reports whether p is an automated identity, such as Gopher
+// Robot or GerritBot, rather than a human, according to package gophers.
+// Gerrit identifies accounts by their ID in the metadata of changes,
+// so both their emails and IDs are known there.
+func (p *GitPerson) IsBot() bool {
+	if p == nil {
+		return false
+	}
+	gp := gophers.GetPerson(p.Email())
+	return gp != nil && gp.Bot
+}
@@ -0,0 +1,44 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package maintner
+
+import "testing"
+
+func TestGitHubUserIsBot(t *testing.T) {
+	for _, tt := range []struct {
+		u    *GitHubUser
+		want bool
+	}{
+		{&GitHubUser{ID: 8566911, Login: "gopherbot"}, true},
+		{&GitHubUser{Login: "GopherBot"}, true},
+		{&GitHubUser{Login: "dependabot[bot]"}, true},
+		{&GitHubUser{Login: "bradfitz"}, false},
+		{&GitHubUser{ID: 2621}, false}, // login not known yet
+		{nil, false},
+	} {
+		if got := tt.u.IsBot(); got != tt.want {
+			t.Errorf("%+v.IsBot() = %v; want %v", tt.u, got, tt.want)
+		}
+	}
+}
+
+func TestGitPersonIsBot(t *testing.T) {
+	for _, tt := range []struct {
+		p    *GitPerson
+		want bool
+	}{
+		{&GitPerson{Str: "Gopher Robot <gobot@golang.org>"}, true},
+		{&GitPerson{Str: "Gerrit User 5976 <5976@62eb7196-b449-3ce5-99f1-c037f21e1705>"}, true},
+		{&GitPerson{Str: "Gerrit User 12446 <12446@62eb7196-b449-3ce5-99f1-c037f21e1705>"}, true},
+		{&GitPerson{Str: "Kokoro <37747@62eb7196-b449-3ce5-99f1-c037f21e1705>"}, true},
+		{&GitPerson{Str: "Gerrit User 5206 <5206@62eb7196-b449-3ce5-99f1-c037f21e1705>"}, false},
+		{&GitPerson{Str: "Foo Bar <foo@bar.com>"}, false},
+		{nil, false},
+	} {
+		if got := tt.p.IsBot(); got != tt.want {
+			t.Errorf("%v.IsBot() = %v; want %v", tt.p, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package maintner
+
+import (
+	"sort"
+)
+
+// An Enricher derives annotations of GitHub issues and Gerrit CLs from
+// their contents, such as the components they affect or the CVEs they
+// refer to. Enrichers are added to a corpus with AddEnricher, and run
+// on the items that change as the corpus processes mutations.
+//
+// Enrichers run with the corpus locked, so they must be quick and must
+// not call methods of the corpus that lock it.
+type Enricher interface {
+	// Namespace is the name under which the annotations of the
+	// enricher are stored, apart from those of other enrichers.
+	Namespace() string
+
+	// EnrichIssue returns the annotations of issue gi of repo r,
+	// replacing any it returned before.
+	EnrichIssue(r *GitHubRepo, gi *GitHubIssue) []Annotation
+
+	// EnrichCL returns the annotations of cl, replacing any it
+	// returned before.
+	EnrichCL(cl *GerritCL) []Annotation
+}
+
+// An Annotation is a key-value pair that an Enricher attaches to an
+// issue or CL. An item may have several annotations with the same
+// key.
+type Annotation struct {
+	Key, Value string
+}
+
+// annotationIndex holds the annotations of the items of a corpus, by
+// namespace.
+//
+// Its zero value is ready to use.
+type annotationIndex struct {
+	byNamespace map[string]map[XRefItem][]Annotation
+
+	// The items that changed since the enrichers last ran.
+	dirtyIssues map[GitHubIssueRef]bool
+	dirtyCLs    map[*GerritCL]bool
+}
+
+// set replaces the annotations of it in namespace ns with as.
+func (x *annotationIndex) set(ns string, it XRefItem, as []Annotation) {
+	if len(as) == 0 {
+		delete(x.byNamespace[ns], it)
+		return
+	}
+	if x.byNamespace == nil {
+		x.byNamespace = make(map[string]map[XRefItem][]Annotation)
+	}
+	if x.byNamespace[ns] == nil {
+		x.byNamespace[ns] = make(map[XRefItem][]Annotation)
+	}
+	x.byNamespace[ns][it] = as
+}
+
+// AddEnricher adds an enricher to the corpus. If the corpus is already
+// initialized, the enricher runs on all of its issues and CLs before
+// AddEnricher returns. Each enricher must have a different namespace.
+func (c *Corpus) AddEnricher(e Enricher) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, old := range c.enrichers {
+		if old.Namespace() == e.Namespace() {
+			panic("maintner: duplicate enricher namespace " + e.Namespace())
+		}
+	}
+	c.enrichers = append(c.enrichers, e)
+	if !c.didInit {
+		return
+	}
+	// Catch the new enricher up. The others see the same items
+	// again, which is harmless.
+	c.GitHub().ForeachRepo(func(r *GitHubRepo) error {
+		return r.ForeachIssue(func(gi *GitHubIssue) error {
+			c.noteEnrichIssue(GitHubIssueRef{r, gi.Number})
+			return nil
+		})
+	})
+	c.Gerrit().ForeachProjectUnsorted(func(gp *GerritProject) error {
+		return gp.ForeachCLUnsorted(func(cl *GerritCL) error {
+			c.noteEnrichCL(cl)
+			return nil
+		})
+	})
+	c.runEnrichers()
+}
+
+// AnnotationNamespaces returns the namespaces of the corpus's
+// enrichers, sorted.
+func (c *Corpus) AnnotationNamespaces() []string {
+	var nss []string
+	for _, e := range c.enrichers {
+		nss = append(nss, e.Namespace())
+	}
+	sort.Strings(nss)
+	return nss
+}
+
+// Annotations returns the annotations of it in namespace ns, as
+// returned by its enricher.
+func (c *Corpus) Annotations(ns string, it XRefItem) []Annotation {
+	return c.annotations.byNamespace[ns][it]
+}
+
+// AnnotatedItems returns the items that have an annotation in namespace
+// ns with the given key and, if value isn't empty, value, sorted by
+// their string form.
+func (c *Corpus) AnnotatedItems(ns, key, value string) []XRefItem {
+	var items []XRefItem
+	for it, as := range c.annotations.byNamespace[ns] {
+		for _, a := range as {
+			if a.Key == key && (value == "" || a.Value == value) {
+				items = append(items, it)
+				break
+			}
+		}
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].String() < items[j].String() })
+	return items
+}
+
+// noteEnrichIssue records that issue ref changed, so that the
+// enrichers run on it when processing finishes.
+//
+// c.mu must be held.
+func (c *Corpus) noteEnrichIssue(ref GitHubIssueRef) {
+	if len(c.enrichers) == 0 {
+		return
+	}
+	if c.annotations.dirtyIssues == nil {
+		c.annotations.dirtyIssues = make(map[GitHubIssueRef]bool)
+	}
+	c.annotations.dirtyIssues[ref] = true
+}
+
+// noteEnrichCL is like noteEnrichIssue, for CLs.
+//
+// c.mu must be held.
+func (c *Corpus) noteEnrichCL(cl *GerritCL) {
+	if len(c.enrichers) == 0 {
+		return
+	}
+	if c.annotations.dirtyCLs == nil {
+		c.annotations.dirtyCLs = make(map[*GerritCL]bool)
+	}
+	c.annotations.dirtyCLs[cl] = true
+}
+
+// runEnrichers runs the enrichers on the items that changed since they
+// last ran. Issues that don't exist, and CLs that are private or have
+// no commit yet, lose their annotations.
+//
+// c.mu must be held.
+func (c *Corpus) runEnrichers() {
+	x := &c.annotations
+	for ref := range x.dirtyIssues {
+		it := XRefItem{Issue: ref}
+		gi := ref.Repo.Issue(ref.Number)
+		for _, e := range c.enrichers {
+			var as []Annotation
+			if gi != nil && !gi.NotExist {
+				as = e.EnrichIssue(ref.Repo, gi)
+			}
+			x.set(e.Namespace(), it, as)
+		}
+	}
+	for cl := range x.dirtyCLs {
+		it := XRefItem{CL: GerritCLRef{Server: cl.Project.Server(), Number: cl.Number}}
+		for _, e := range c.enrichers {
+			var as []Annotation
+			if !cl.Private && cl.Commit != nil {
+				as = e.EnrichCL(cl)
+			}
+			x.set(e.Namespace(), it, as)
+		}
+	}
+	x.dirtyIssues, x.dirtyCLs = nil, nil
+}
@@ -0,0 +1,127 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package enrich provides enrichers that annotate the GitHub issues
+// and Gerrit CLs of a maintner corpus.
+//
+// Each enricher is registered by name, so that maintnerd can run it
+// when asked by its --enrich flag, and its annotations can be queried
+// through maintnerd's GraphQL API. To experiment with a new kind of
+// annotation, add an enricher to the registry.
+package enrich
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"golang.org/x/build/maintner"
+)
+
+// registry holds the constructors of the enrichers, by name. The name
+// of each is also the namespace of its annotations.
+var registry = map[string]func() maintner.Enricher{
+	"component": func() maintner.Enricher { return componentEnricher{} },
+	"cve":       func() maintner.Enricher { return cveEnricher{} },
+}
+
+// Names returns the names of the registered enrichers, sorted.
+func Names() []string {
+	var names []string
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// New returns a new instance of the enricher registered as name.
+func New(name string) (maintner.Enricher, error) {
+	newEnricher, ok := registry[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown enricher %q; valid enrichers are %s", name, strings.Join(Names(), ", "))
+	}
+	return newEnricher(), nil
+}
+
+// componentEnricher annotates issues and CLs with the components they
+// affect, according to the conventional prefix of their titles and
+// subjects, such as "cmd/go, cmd/link: ...". Its annotations have the
+// key "path".
+type componentEnricher struct{}
+
+func (componentEnricher) Namespace() string { return "component" }
+
+func (componentEnricher) EnrichIssue(r *maintner.GitHubRepo, gi *maintner.GitHubIssue) []maintner.Annotation {
+	return componentAnnotations(gi.Title)
+}
+
+func (componentEnricher) EnrichCL(cl *maintner.GerritCL) []maintner.Annotation {
+	return componentAnnotations(cl.Subject())
+}
+
+// rxComponents matches the comma-separated component paths at the start
+// of an issue title or commit subject.
+var rxComponents = regexp.MustCompile(`^((?:[\w.\-]+/)*[\w.\-]+(?:, *(?:[\w.\-]+/)*[\w.\-]+)*): `)
+
+func componentAnnotations(title string) []maintner.Annotation {
+	// Skip the prefixes of cherry-picks to release branches and of
+	// proposals, as in "[release-branch.go1.21] proposal: os: ...".
+	if strings.HasPrefix(title, "[") {
+		if _, rest, ok := strings.Cut(title, "] "); ok {
+			title = rest
+		}
+	}
+	title = strings.TrimPrefix(title, "proposal: ")
+	m := rxComponents.FindStringSubmatch(title)
+	if m == nil {
+		return nil
+	}
+	var as []maintner.Annotation
+	for _, path := range strings.Split(m[1], ",") {
+		as = append(as, maintner.Annotation{Key: "path", Value: strings.TrimSpace(path)})
+	}
+	return as
+}
+
+// cveEnricher annotates issues and CLs with the CVEs that they or,
+// for issues, their comments refer to. Its annotations have the key
+// "id".
+type cveEnricher struct{}
+
+func (cveEnricher) Namespace() string { return "cve" }
+
+func (cveEnricher) EnrichIssue(r *maintner.GitHubRepo, gi *maintner.GitHubIssue) []maintner.Annotation {
+	seen := make(map[string]bool)
+	as := cveAnnotations(seen, nil, gi.Title)
+	as = cveAnnotations(seen, as, gi.Body)
+	gi.ForeachComment(func(c *maintner.GitHubComment) error {
+		as = cveAnnotations(seen, as, c.Body)
+		return nil
+	})
+	return as
+}
+
+func (cveEnricher) EnrichCL(cl *maintner.GerritCL) []maintner.Annotation {
+	return cveAnnotations(make(map[string]bool), nil, cl.Commit.Msg)
+}
+
+var rxCVE = regexp.MustCompile(`(?i)\bCVE-\d{4}-\d{4,}\b`)
+
+// cveAnnotations appends to as the CVEs that text refers to and aren't
+// in seen yet, and adds them to seen.
+func cveAnnotations(seen map[string]bool, as []maintner.Annotation, text string) []maintner.Annotation {
+	if !strings.Contains(strings.ToUpper(text), "CVE-") {
+		return as
+	}
+	for _, id := range rxCVE.FindAllString(text, -1) {
+		id = strings.ToUpper(id)
+		if !seen[id] {
+			seen[id] = true
+			as = append(as, maintner.Annotation{Key: "id", Value: id})
+		}
+	}
+	return as
+}
@@ -0,0 +1,67 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package enrich
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.org/x/build/maintner"
+)
+
+func TestComponentAnnotations(t *testing.T) {
+	for _, tt := range []struct {
+		title string
+		want  []string
+	}{
+		{"cmd/go: crash in go mod tidy", []string{"cmd/go"}},
+		{"cmd/compile, cmd/link: slow builds", []string{"cmd/compile", "cmd/link"}},
+		{"x/tools/gopls: completion is broken", []string{"x/tools/gopls"}},
+		{"proposal: net/http: add Server.Foo", []string{"net/http"}},
+		{"[release-branch.go1.21] runtime: fix deadlock", []string{"runtime"}},
+		{"Crash when building: help", nil},
+		{"no component here", nil},
+	} {
+		var got []string
+		for _, a := range componentAnnotations(tt.title) {
+			if a.Key != "path" {
+				t.Errorf("componentAnnotations(%q) has key %q; want path", tt.title, a.Key)
+			}
+			got = append(got, a.Value)
+		}
+		if diff := cmp.Diff(tt.want, got); diff != "" {
+			t.Errorf("componentAnnotations(%q) mismatch (-want +got):\n%s", tt.title, diff)
+		}
+	}
+}
+
+func TestCVEAnnotations(t *testing.T) {
+	seen := map[string]bool{}
+	as := cveAnnotations(seen, nil, "security: fix CVE-2023-29406 and cve-2023-1234")
+	as = cveAnnotations(seen, as, "This is CVE-2023-29406, not CVE-23-1.")
+	want := []maintner.Annotation{
+		{Key: "id", Value: "CVE-2023-29406"},
+		{Key: "id", Value: "CVE-2023-1234"},
+	}
+	if diff := cmp.Diff(want, as); diff != "" {
+		t.Errorf("cveAnnotations mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestNew(t *testing.T) {
+	for _, name := range Names() {
+		e, err := New(name)
+		if err != nil {
+			t.Errorf("New(%q) = %v", name, err)
+			continue
+		}
+		if e.Namespace() != name {
+			t.Errorf("New(%q).Namespace() = %q; want %q", name, e.Namespace(), name)
+		}
+	}
+	if _, err := New("bogus"); err == nil {
+		t.Errorf("New(bogus) succeeded; want error")
+	}
+}
@@ -0,0 +1,133 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package maintner
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/build/maintner/maintpb"
+)
+
+// wordsEnricher annotates issues and CLs with the words of their titles
+// and subjects, and counts its calls.
+type wordsEnricher struct {
+	ns    string
+	calls *int
+}
+
+func (e wordsEnricher) Namespace() string { return e.ns }
+
+func (e wordsEnricher) EnrichIssue(r *GitHubRepo, gi *GitHubIssue) []Annotation {
+	*e.calls++
+	return wordAnnotations(gi.Title)
+}
+
+func (e wordsEnricher) EnrichCL(cl *GerritCL) []Annotation {
+	*e.calls++
+	return wordAnnotations(cl.Subject())
+}
+
+func wordAnnotations(s string) []Annotation {
+	var as []Annotation
+	for _, w := range strings.Fields(s) {
+		as = append(as, Annotation{Key: "word", Value: w})
+	}
+	return as
+}
+
+func TestEnrichIssues(t *testing.T) {
+	var calls int
+	c := new(Corpus)
+	c.AddEnricher(wordsEnricher{"words", &calls})
+	issueMutation := func(number int32, title string) *maintpb.Mutation {
+		return &maintpb.Mutation{GithubIssue: &maintpb.GithubIssueMutation{
+			Owner:   "golang",
+			Repo:    "go",
+			Number:  number,
+			Created: p3339("2023-04-01T12:00:00Z"),
+			Title:   title,
+		}}
+	}
+	c.processMutationLocked(issueMutation(1, "cmd/go: crash"))
+	c.processMutationLocked(issueMutation(2, "net/http: crash"))
+	c.processMutationLocked(issueMutation(1, "cmd/go: panic"))
+	c.finishProcessing()
+	if calls != 2 {
+		t.Errorf("enricher called %d times; want once per changed issue", calls)
+	}
+
+	repo := c.GitHub().Repo("golang", "go")
+	issue1 := XRefItem{Issue: GitHubIssueRef{repo, 1}}
+	want := []Annotation{{"word", "cmd/go:"}, {"word", "panic"}}
+	if got := c.Annotations("words", issue1); !reflect.DeepEqual(got, want) {
+		t.Errorf("Annotations(words, %v) = %v; want %v", issue1, got, want)
+	}
+	if got := c.Annotations("other", issue1); got != nil {
+		t.Errorf("Annotations(other, %v) = %v; want none", issue1, got)
+	}
+	if got, want := c.AnnotatedItems("words", "word", "crash"), []XRefItem{{Issue: GitHubIssueRef{repo, 2}}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("AnnotatedItems(words, word, crash) = %v; want %v", got, want)
+	}
+	if got := c.AnnotatedItems("words", "word", ""); len(got) != 2 {
+		t.Errorf("AnnotatedItems(words, word, \"\") = %v; want both issues", got)
+	}
+
+	// Issues that turn out not to exist lose their annotations.
+	c.processMutationLocked(&maintpb.Mutation{GithubIssue: &maintpb.GithubIssueMutation{
+		Owner:    "golang",
+		Repo:     "go",
+		Number:   1,
+		NotExist: true,
+	}})
+	c.finishProcessing()
+	if got := c.Annotations("words", issue1); got != nil {
+		t.Errorf("after NotExist, Annotations(words, %v) = %v; want none", issue1, got)
+	}
+
+	// An enricher added to an initialized corpus catches up.
+	c.didInit = true
+	var lateCalls int
+	c.AddEnricher(wordsEnricher{"late", &lateCalls})
+	issue2 := XRefItem{Issue: GitHubIssueRef{repo, 2}}
+	want = []Annotation{{"word", "net/http:"}, {"word", "crash"}}
+	if got := c.Annotations("late", issue2); !reflect.DeepEqual(got, want) {
+		t.Errorf("Annotations(late, %v) = %v; want %v", issue2, got, want)
+	}
+	if got, want := c.AnnotationNamespaces(), []string{"late", "words"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("AnnotationNamespaces() = %q; want %q", got, want)
+	}
+}
+
+func TestEnrichCLs(t *testing.T) {
+	var calls int
+	c := new(Corpus)
+	c.AddEnricher(wordsEnricher{"words", &calls})
+	c.initGerrit()
+	gp := c.gerrit.getOrCreateProject("go.googlesource.com/go")
+	cl := gp.getOrCreateCL(200)
+	c.noteEnrichCL(cl)
+	c.finishProcessing()
+	if calls != 0 {
+		t.Errorf("enricher called %d times for a CL without a commit; want 0", calls)
+	}
+
+	cl.Commit = &GitCommit{Msg: "cmd/go: fix crash\n\nFixes #1\n"}
+	c.noteEnrichCL(cl)
+	c.finishProcessing()
+	it := XRefItem{CL: GerritCLRef{"go.googlesource.com", 200}}
+	want := []Annotation{{"word", "cmd/go:"}, {"word", "fix"}, {"word", "crash"}}
+	if got := c.Annotations("words", it); !reflect.DeepEqual(got, want) {
+		t.Errorf("Annotations(words, %v) = %v; want %v", it, got, want)
+	}
+
+	cl.Private = true
+	c.noteEnrichCL(cl)
+	c.finishProcessing()
+	if got := c.Annotations("words", it); got != nil {
+		t.Errorf("for a private CL, Annotations(words, %v) = %v; want none", it, got)
+	}
+}
@@ -0,0 +1,275 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package maintner
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/build/maintner/internal/robustio"
+	"golang.org/x/build/maintner/maintpb"
+	"golang.org/x/build/maintner/mutenc"
+	"golang.org/x/build/maintner/reclog"
+)
+
+// NewFilteredNetworkMutationSource returns a mutation source from a
+// master server, like NewNetworkMutationSource, that only downloads
+// the mutations that f selects. The server filters the log segments,
+// so that programs that load only part of the corpus (see
+// Corpus.SetLoadFilter) don't download and read the whole log.
+//
+// The filtered segments that the server no longer appends to are cached
+// in cacheDir, if it's not empty. Lazily loaded repos and projects are
+// downloaded from the server when they're looked up.
+func NewFilteredNetworkMutationSource(server, cacheDir string, f LoadFilter) MutationSource {
+	return &filteredMutSource{
+		ns:       NewNetworkMutationSource(server, "").(*netMutSource),
+		filter:   newLoadFilter(f),
+		cacheDir: cacheDir,
+	}
+}
+
+type filteredMutSource struct {
+	ns       *netMutSource // for the logs index
+	filter   *loadFilter
+	cacheDir string
+
+	mu   sync.Mutex
+	last []LogSegmentJSON // the segments whose mutations were sent; guarded by mu
+
+	// Hook for testing. If nil, unused:
+	testHookGetServerSegments func(context.Context, int64) ([]LogSegmentJSON, error)
+}
+
+func (fs *filteredMutSource) GetMutations(ctx context.Context) <-chan MutationStreamEvent {
+	ch := make(chan MutationStreamEvent, 50)
+	go func() {
+		err := fs.fetchAndSendMutations(ctx, ch)
+		final := MutationStreamEvent{Err: err}
+		if err == nil {
+			final.End = true
+		}
+		select {
+		case ch <- final:
+		case <-ctx.Done():
+		}
+	}()
+	return ch
+}
+
+// fetchAndSendMutations waits for the log on the server to change, and
+// sends the new mutations that fs.filter selects to ch.
+func (fs *filteredMutSource) fetchAndSendMutations(ctx context.Context, ch chan<- MutationStreamEvent) error {
+	fs.mu.Lock()
+	last := fs.last
+	fs.mu.Unlock()
+
+	var segs []LogSegmentJSON
+	err := withFetchRetries(ctx, "fetching server segments", 5, func() error {
+		var err error
+		segs, err = fs.getServerSegments(ctx, sumJSONSegSize(last))
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if !extendsSegments(segs, last) {
+		// Our history diverged from the source.
+		return ErrSplit
+	}
+	for i, seg := range segs {
+		var start int64
+		if i < len(last) {
+			start = last[i].Size
+		}
+		if start == seg.Size {
+			continue
+		}
+		err := fs.foreachSegMutation(ctx, fs.filter, seg, start, func(m *maintpb.Mutation) error {
+			select {
+			case ch <- MutationStreamEvent{Mutation: m}:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+		if err != nil {
+			return err
+		}
+	}
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.last = segs
+	return nil
+}
+
+func (fs *filteredMutSource) getServerSegments(ctx context.Context, waitSizeNot int64) ([]LogSegmentJSON, error) {
+	if fn := fs.testHookGetServerSegments; fn != nil {
+		return fn(ctx, waitSizeNot)
+	}
+	return fs.ns.getServerSegments(ctx, waitSizeNot)
+}
+
+// extendsSegments reports whether the log segments segs have the
+// segments last as a prefix: the segments that were complete must be
+// unchanged, and the one that was growing must not have shrunk.
+func extendsSegments(segs, last []LogSegmentJSON) bool {
+	if len(segs) < len(last) {
+		return false
+	}
+	for i, l := range last {
+		s := segs[i]
+		growing := i == len(last)-1
+		if s.Number != l.Number || s.Size < l.Size || (s.Size == l.Size || !growing) && s.SHA224 != l.SHA224 {
+			return false
+		}
+	}
+	return true
+}
+
+// replayMutations calls fn with the mutations sent so far that sel
+// selects, in order, downloading them from the server again.
+func (fs *filteredMutSource) replayMutations(ctx context.Context, sel *loadFilter, fn func(*maintpb.Mutation) error) error {
+	fs.mu.Lock()
+	segs := fs.last
+	fs.mu.Unlock()
+	for _, seg := range segs {
+		if err := fs.foreachSegMutation(ctx, sel, seg, 0, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// foreachSegMutation calls fn with each mutation in log segment seg,
+// starting at offset start, that sel selects.
+func (fs *filteredMutSource) foreachSegMutation(ctx context.Context, sel *loadFilter, seg LogSegmentJSON, start int64, fn func(*maintpb.Mutation) error) error {
+	// Segments on GCS are complete, so their filtered logs can be
+	// cached like NewNetworkMutationSource caches whole segments.
+	var cacheFile string
+	if fs.cacheDir != "" && start == 0 && strings.HasPrefix(seg.URL, "https://storage.googleapis.com/") {
+		cacheFile = filepath.Join(fs.cacheDir, "filtered-"+sel.key(), fmt.Sprintf("%04d.%s.mutlog", seg.Number, seg.SHA224))
+	}
+	var data []byte
+	cached := false
+	if cacheFile != "" {
+		if b, err := robustio.ReadFile(cacheFile); err == nil {
+			data, cached = b, true
+		}
+	}
+	if !cached {
+		err := withFetchRetries(ctx, fmt.Sprintf("fetching filtered segment %d", seg.Number), 10, func() error {
+			var err error
+			data, err = fs.fetchFilteredSeg(ctx, sel, seg, start)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		if cacheFile != "" {
+			if err := writeFileAtomic(cacheFile, data); err != nil {
+				log.Printf("caching filtered segment %d: %v", seg.Number, err)
+			}
+		}
+	}
+	return reclog.ForeachRecord(bytes.NewReader(data), 0, func(off int64, hdr, rec []byte) error {
+		m := new(maintpb.Mutation)
+		if err := mutenc.Unmarshal(rec, m); err != nil {
+			return err
+		}
+		return fn(m)
+	})
+}
+
+// fetchFilteredSeg downloads the records of log segment seg from offset
+// start to its end whose mutations sel selects, from the server's
+// /logs/filtered/<number> handler. See LoadFilter.WriteFilteredLog.
+func (fs *filteredMutSource) fetchFilteredSeg(ctx context.Context, sel *loadFilter, seg LogSegmentJSON, start int64) ([]byte, error) {
+	q := sel.values()
+	q.Set("start", fmt.Sprint(start))
+	q.Set("end", fmt.Sprint(seg.Size))
+	segURL := fs.ns.base.ResolveReference(&url.URL{
+		Path:     fmt.Sprintf("/logs/filtered/%d", seg.Number),
+		RawQuery: q.Encode(),
+	})
+	req, err := http.NewRequestWithContext(ctx, "GET", segURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if !fs.ns.quiet {
+		log.Printf("Downloading %s ...", segURL)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fetchError{Err: err, PossiblyRetryable: true}
+	}
+	defer res.Body.Close()
+	if res.StatusCode/100 == 5 {
+		// Consider a 5xx server response to possibly succeed later.
+		return nil, fetchError{Err: fmt.Errorf("%s: %s", segURL, res.Status), PossiblyRetryable: true}
+	} else if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", segURL, res.Status)
+	}
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, fetchError{Err: err, PossiblyRetryable: true}
+	}
+	return data, nil
+}
+
+// withFetchRetries calls fn until it succeeds, returns an error that
+// isn't a possibly retryable fetchError, or has failed maxTries times.
+func withFetchRetries(ctx context.Context, what string, maxTries int, fn func() error) error {
+	for try := 1; ; try++ {
+		err := fn()
+		if fe := (fetchError{}); !errors.As(err, &fe) || !fe.PossiblyRetryable {
+			return err
+		}
+		if try == maxTries {
+			return fmt.Errorf("after %d attempts, %s still failed: %v", maxTries, what, err)
+		}
+		someDelay := time.Duration(try*try) * time.Second
+		log.Printf("%s did not succeed on attempt %d, will try again in %v: %v", what, try, someDelay, err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(someDelay):
+		}
+	}
+}
+
+// writeFileAtomic writes data to the named file, creating its directory
+// if needed, so that the file is either complete or missing.
+func writeFileAtomic(file string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+		return err
+	}
+	tf, err := ioutil.TempFile(filepath.Dir(file), "tempseg")
+	if err != nil {
+		return err
+	}
+	if _, err := tf.Write(data); err != nil {
+		tf.Close()
+		os.Remove(tf.Name())
+		return err
+	}
+	if err := tf.Close(); err != nil {
+		os.Remove(tf.Name())
+		return err
+	}
+	return robustio.Rename(tf.Name(), file)
+}
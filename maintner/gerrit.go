@@ -13,6 +13,7 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
@@ -24,6 +25,7 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"golang.org/x/build/internal/envutil"
@@ -54,9 +56,17 @@ func normalizeGerritServer(server string) string {
 // Project returns the specified Gerrit project if it's known, otherwise
 // it returns nil. Server is the Gerrit server's hostname, such as
 // "go.googlesource.com".
+//
+// If the corpus loads projects lazily (see LoadFilter), Project loads
+// the project first if it isn't loaded yet.
 func (g *Gerrit) Project(server, project string) *GerritProject {
-	server = normalizeGerritServer(server)
-	return g.projects[server+"/"+project]
+	proj := normalizeGerritServer(server) + "/" + project
+	gp := g.projects[proj]
+	if gp == nil && g.c.lazyLoads() {
+		g.c.lazyLoadGerrit(proj)
+		gp = g.c.Gerrit().projects[proj]
+	}
+	return gp
 }
 
 // c.mu must be held
@@ -106,6 +116,10 @@ type GerritProject struct {
 	// Notably, this excludes the "refs/changes/*" refs matched by
 	// rxChangeRef. Those are in the remote map.
 	ref map[string]GitHash
+
+	// gitMu serializes the git commands that fetch into gitDir, so
+	// that a sync and a Backfill don't race on its ref locks.
+	gitMu sync.Mutex
 }
 
 // Ref returns a non-change ref, such as "HEAD", "refs/heads/master",
@@ -439,6 +453,30 @@ func (cl *GerritCL) WorkInProgress() bool {
 	return wip
 }
 
+// Hashtags returns the current set of hashtags on the CL.
+func (cl *GerritCL) Hashtags() GerritHashtags {
+	return cl.Meta.Hashtags()
+}
+
+// AttentionSet returns the users currently in the CL's attention set,
+// as a map from their Gerrit account identity, as in
+// "5065@62eb7196-b449-3ce5-99f1-c037f21e1705", to the reason they
+// were added.
+func (cl *GerritCL) AttentionSet() map[string]string {
+	return cl.Meta.AttentionSet()
+}
+
+// SubmitRecords returns the submit records Gerrit stored when the CL
+// was last submitted, or nil if it never was.
+func (cl *GerritCL) SubmitRecords() []GerritSubmitRecord {
+	for i := len(cl.Metas) - 1; i >= 0; i-- {
+		if recs := cl.Metas[i].SubmitRecords(); recs != nil {
+			return recs
+		}
+	}
+	return nil
+}
+
 // ChangeID returns the Gerrit "Change-Id: Ixxxx" line's Ixxxx
 // value from the cl.Msg, if any.
 func (cl *GerritCL) ChangeID() string {
@@ -591,13 +629,10 @@ func (c *Corpus) TrackGerrit(gerritProj string) {
 // called with c.mu Locked
 func (c *Corpus) processGerritMutation(gm *maintpb.GerritMutation) {
 	if c.gerrit == nil {
-		// TODO: option to ignore mutation if user isn't interested.
 		c.initGerrit()
 	}
 	gp, ok := c.gerrit.projects[gm.Project]
 	if !ok {
-		// TODO: option to ignore mutation if user isn't interested.
-		// For now, always process the record.
 		gp = c.gerrit.getOrCreateProject(gm.Project)
 	}
 	gp.processMutation(gm)
@@ -817,6 +852,8 @@ func (gp *GerritProject) processMutation(gm *maintpb.GerritMutation) {
 			cl.Commit = gc
 			cl.Version = clv.Version
 			cl.updateGithubIssueRefs()
+			c.updateCLXRefs(cl)
+			c.noteEnrichCL(cl)
 		}
 		if c.didInit {
 			gp.logf("Ref %+v => %v", clv, hash)
@@ -910,6 +947,8 @@ func (gp *GerritProject) finishProcessingCL(cl *GerritCL) {
 	cl.Created = cl.Metas[0].Commit.CommitTime
 
 	cl.updateBranch()
+	c.updateCLXRefs(cl)
+	c.noteEnrichCL(cl)
 }
 
 // clSliceContains reports whether cls contains cl.
@@ -978,7 +1017,10 @@ var rxRemoteRef = regexp.MustCompile(`^([0-9a-f]{40,})\s+refs/changes/[0-9a-f]{2
 var rxChangeRef = regexp.MustCompile(`^refs/changes/[0-9a-f]{2}/([0-9]+)/(meta|(?:\d+))`)
 
 func (gp *GerritProject) sync(ctx context.Context, loop bool) error {
-	if err := gp.init(ctx); err != nil {
+	gp.gitMu.Lock()
+	err := gp.init(ctx)
+	gp.gitMu.Unlock()
+	if err != nil {
 		gp.logf("init: %v", err)
 		return err
 	}
@@ -1036,53 +1078,21 @@ func (gp *GerritProject) syncMissingCommits(ctx context.Context) error {
 }
 
 func (gp *GerritProject) syncOnce(ctx context.Context) error {
+	gp.gitMu.Lock()
+	defer gp.gitMu.Unlock()
+
 	if err := gp.syncMissingCommits(ctx); err != nil {
 		return err
 	}
 
 	c := gp.gerrit.c
-	gitDir := gp.gitDir()
-
-	t0 := time.Now()
-	cmd := exec.CommandContext(ctx, "git", "fetch", "origin")
-	envutil.SetDir(cmd, gitDir)
-	// Enable extra Git tracing in case the fetch hangs.
-	envutil.SetEnv(cmd,
-		"GIT_TRACE2_EVENT=1",
-		"GIT_TRACE_CURL_NO_DATA=1",
-	)
-	cmd.Stdout = new(bytes.Buffer)
-	cmd.Stderr = cmd.Stdout
-
-	// The 'git fetch' needs a timeout in case it hangs, but to avoid spurious
-	// timeouts (and live-lock) the timeout should be (at least) an order of
-	// magnitude longer than we expect the operation to actually take. Moreover,
-	// exec.CommandContext sends SIGKILL, which may terminate the command without
-	// giving it a chance to flush useful trace entries, so we'll terminate it
-	// manually instead (see https://golang.org/issue/22757).
-	if err := cmd.Start(); err != nil {
-		return fmt.Errorf("git fetch origin: %v", err)
-	}
-	timer := time.AfterFunc(10*time.Minute, func() {
-		cmd.Process.Signal(os.Interrupt)
-	})
-	err := cmd.Wait()
-	fetchDuration := time.Since(t0).Round(time.Millisecond)
-	timer.Stop()
-	if err != nil {
-		return fmt.Errorf("git fetch origin: %v after %v, %s", err, fetchDuration, cmd.Stdout)
+	if err := gp.fetchOrigin(ctx); err != nil {
+		return err
 	}
-	gp.logf("ran git fetch origin in %v", fetchDuration)
-
-	t0 = time.Now()
-	cmd = exec.CommandContext(ctx, "git", "ls-remote")
-	envutil.SetDir(cmd, gitDir)
-	out, err := cmd.CombinedOutput()
-	lsRemoteDuration := time.Since(t0).Round(time.Millisecond)
+	out, err := gp.lsRemote(ctx)
 	if err != nil {
-		return fmt.Errorf("git ls-remote in %s: %v after %v, %s", gitDir, err, lsRemoteDuration, out)
+		return err
 	}
-	gp.logf("ran git ls-remote in %v", lsRemoteDuration)
 
 	var changedRefs []*maintpb.GitRef
 	var toFetch []GitHash
@@ -1192,6 +1202,58 @@ func (gp *GerritProject) syncOnce(ctx context.Context) error {
 	return nil
 }
 
+// fetchOrigin fetches all of the project's refs into its git directory.
+func (gp *GerritProject) fetchOrigin(ctx context.Context) error {
+	gitDir := gp.gitDir()
+
+	t0 := time.Now()
+	cmd := exec.CommandContext(ctx, "git", "fetch", "origin")
+	envutil.SetDir(cmd, gitDir)
+	// Enable extra Git tracing in case the fetch hangs.
+	envutil.SetEnv(cmd,
+		"GIT_TRACE2_EVENT=1",
+		"GIT_TRACE_CURL_NO_DATA=1",
+	)
+	cmd.Stdout = new(bytes.Buffer)
+	cmd.Stderr = cmd.Stdout
+
+	// The 'git fetch' needs a timeout in case it hangs, but to avoid spurious
+	// timeouts (and live-lock) the timeout should be (at least) an order of
+	// magnitude longer than we expect the operation to actually take. Moreover,
+	// exec.CommandContext sends SIGKILL, which may terminate the command without
+	// giving it a chance to flush useful trace entries, so we'll terminate it
+	// manually instead (see https://golang.org/issue/22757).
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("git fetch origin: %v", err)
+	}
+	timer := time.AfterFunc(10*time.Minute, func() {
+		cmd.Process.Signal(os.Interrupt)
+	})
+	err := cmd.Wait()
+	fetchDuration := time.Since(t0).Round(time.Millisecond)
+	timer.Stop()
+	if err != nil {
+		return fmt.Errorf("git fetch origin: %v after %v, %s", err, fetchDuration, cmd.Stdout)
+	}
+	gp.logf("ran git fetch origin in %v", fetchDuration)
+	return nil
+}
+
+// lsRemote returns the output of "git ls-remote" for the project.
+func (gp *GerritProject) lsRemote(ctx context.Context) ([]byte, error) {
+	gitDir := gp.gitDir()
+	t0 := time.Now()
+	cmd := exec.CommandContext(ctx, "git", "ls-remote")
+	envutil.SetDir(cmd, gitDir)
+	out, err := cmd.CombinedOutput()
+	lsRemoteDuration := time.Since(t0).Round(time.Millisecond)
+	if err != nil {
+		return nil, fmt.Errorf("git ls-remote in %s: %v after %v, %s", gitDir, err, lsRemoteDuration, out)
+	}
+	gp.logf("ran git ls-remote in %v", lsRemoteDuration)
+	return out, nil
+}
+
 func (gp *GerritProject) syncCommits(ctx context.Context) (n int, err error) {
 	c := gp.gerrit.c
 	lastLog := time.Now()
@@ -1378,6 +1440,10 @@ type gerritMetaFlags uint8
 const (
 	// metaFlagHashtagEdit indicates that the meta commit edits the hashtags on the commit.
 	metaFlagHashtagEdit gerritMetaFlags = 1 << iota
+	// metaFlagAttention indicates that the meta commit may update the attention set.
+	metaFlagAttention
+	// metaFlagSubmitted indicates that the meta commit may record a submission.
+	metaFlagSubmitted
 )
 
 func newGerritMeta(gc *GitCommit, cl *GerritCL) *GerritMeta {
@@ -1386,6 +1452,12 @@ func newGerritMeta(gc *GitCommit, cl *GerritCL) *GerritMeta {
 	if msg := m.Commit.Msg; strings.Contains(msg, "autogenerated:gerrit:setHashtag") && m.ActionTag() == "autogenerated:gerrit:setHashtag" {
 		m.flags |= metaFlagHashtagEdit
 	}
+	if strings.Contains(m.Commit.Msg, "\nAttention: ") {
+		m.flags |= metaFlagAttention
+	}
+	if strings.Contains(m.Commit.Msg, "\nSubmitted-with: ") {
+		m.flags |= metaFlagSubmitted
+	}
 	return m
 }
 
@@ -1480,6 +1552,154 @@ func (m *GerritMeta) HashtagsRemoved() GerritHashtags {
 	return removed
 }
 
+// GerritAttentionUpdate is a change to the attention set of a CL,
+// recorded in an "Attention:" footer of a meta commit.
+type GerritAttentionUpdate struct {
+	// Account is the Gerrit account identity of the user, as in
+	// "5065@62eb7196-b449-3ce5-99f1-c037f21e1705".
+	Account string
+	// Add is whether the user was added to the attention set,
+	// rather than removed from it.
+	Add bool
+	// Reason is why, as in "<GERRIT_ACCOUNT_5065> replied on the change".
+	Reason string
+}
+
+// AttentionUpdates returns the changes to the attention set of m's CL
+// made by this meta commit, if any.
+func (m *GerritMeta) AttentionUpdates() []GerritAttentionUpdate {
+	if m.flags&metaFlagAttention == 0 {
+		return nil
+	}
+	var updates []GerritAttentionUpdate
+	remain := m.Footer()
+	for len(remain) > 0 {
+		var value string
+		value, remain = lineValueRest(remain, "Attention: ")
+		if value == "" {
+			continue
+		}
+		// The value is JSON, as in:
+		//
+		//	{"person_ident":"Gopher \u003c5065@62eb7196-b449-3ce5-99f1-c037f21e1705\u003e","operation":"ADD","reason":"..."}
+		var a struct {
+			PersonIdent string `json:"person_ident"`
+			Operation   string `json:"operation"`
+			Reason      string `json:"reason"`
+		}
+		if err := json.Unmarshal([]byte(value), &a); err != nil {
+			continue
+		}
+		_, _, account := parseGerritLabelValue("Attention " + a.PersonIdent)
+		if account == "" {
+			continue
+		}
+		updates = append(updates, GerritAttentionUpdate{
+			Account: account,
+			Add:     a.Operation == "ADD",
+			Reason:  a.Reason,
+		})
+	}
+	return updates
+}
+
+// AttentionSet returns the users in the attention set of m's CL as of
+// the time of m, as a map from their Gerrit account identity to the
+// reason they were added.
+func (m *GerritMeta) AttentionSet() map[string]string {
+	set := make(map[string]string)
+	for _, mp := range m.history() {
+		for _, u := range mp.AttentionUpdates() {
+			if u.Add {
+				set[u.Account] = u.Reason
+			} else {
+				delete(set, u.Account)
+			}
+		}
+	}
+	return set
+}
+
+// GerritSubmitRecord records how a CL satisfied a submit rule when it
+// was submitted, from the "Submitted-with:" footers of a meta commit.
+type GerritSubmitRecord struct {
+	// Status is the status of the rule: "OK", "FORCED", "CLOSED",
+	// "RULE_ERROR", and so on.
+	Status string
+	// Rule is the name of the rule, as in
+	// "gerrit~DefaultSubmitRule", if it was recorded.
+	Rule string
+	// Labels are the label requirements of the rule.
+	Labels []GerritSubmitLabel
+}
+
+// GerritSubmitLabel is the state of a label requirement of a submit rule
+// when a CL was submitted.
+type GerritSubmitLabel struct {
+	Label string // "Code-Review", "TryBot-Result", ...
+	// Status is "OK", "REJECT", "NEED", "MAY", or "IMPOSSIBLE".
+	Status string
+	// AppliedBy is the Gerrit account identity of the user whose
+	// vote satisfied or rejected the requirement, if any.
+	AppliedBy string
+}
+
+// SubmitRecords returns the submit records stored by m, which Gerrit
+// writes when it submits a CL. It returns nil if m has none.
+//
+// The footers look like:
+//
+//	Submitted-with: OK
+//	Rule-Name: gerrit~DefaultSubmitRule
+//	Submitted-with: OK: Code-Review: Gopher <5065@62eb7196-b449-3ce5-99f1-c037f21e1705>
+//	Submitted-with: MAY: Hold
+func (m *GerritMeta) SubmitRecords() []GerritSubmitRecord {
+	if m.flags&metaFlagSubmitted == 0 {
+		return nil
+	}
+	var recs []GerritSubmitRecord
+	sc := bufio.NewScanner(strings.NewReader(m.Footer()))
+	for sc.Scan() {
+		line := sc.Text()
+		if rule, ok := strings.CutPrefix(line, "Rule-Name: "); ok && len(recs) > 0 {
+			recs[len(recs)-1].Rule = strings.TrimSpace(rule)
+			continue
+		}
+		value, ok := strings.CutPrefix(line, "Submitted-with: ")
+		if !ok {
+			continue
+		}
+		status, label, isLabel := strings.Cut(strings.TrimSpace(value), ": ")
+		if !isLabel {
+			recs = append(recs, GerritSubmitRecord{Status: status})
+			continue
+		}
+		if len(recs) == 0 {
+			// A label requirement with no rule. Gerrit doesn't
+			// write these, but don't lose it.
+			recs = append(recs, GerritSubmitRecord{})
+		}
+		sl := GerritSubmitLabel{Label: label, Status: status}
+		if label, who, ok := strings.Cut(label, ": "); ok {
+			sl.Label = label
+			_, _, sl.AppliedBy = parseGerritLabelValue(label + " " + who)
+		}
+		recs[len(recs)-1].Labels = append(recs[len(recs)-1].Labels, sl)
+	}
+	return recs
+}
+
+// history returns the meta commits of m's CL up to and including m,
+// from the oldest.
+func (m *GerritMeta) history() []*GerritMeta {
+	for i, mc := range m.CL.Metas {
+		if mc == m {
+			return m.CL.Metas[:i+1]
+		}
+	}
+	panic("GerritMeta not in its m.CL.Metas slice")
+}
+
 // LabelVotes returns a map from label name to voter email to their vote.
 //
 // This is relatively expensive to call compared to other methods in maintner.
@@ -6,6 +6,7 @@ package maintner
 
 import (
 	"bytes"
+	"reflect"
 	"testing"
 	"time"
 )
@@ -559,3 +560,60 @@ func TestGerritHashtagsLen(t *testing.T) {
 		}
 	}
 }
+
+func TestGerritAttentionSet(t *testing.T) {
+	cl := &GerritCL{}
+	for _, msg := range []string{
+		"Create change\n\nPatch-set: 1\nAttention: {\"person_ident\":\"Gopher \\u003c1@server\\u003e\",\"operation\":\"ADD\",\"reason\":\"Reviewer was added\"}\nAttention: {\"person_ident\":\"Owner \\u003c2@server\\u003e\",\"operation\":\"ADD\",\"reason\":\"Change was created\"}\n",
+		"Update patch set 1\n\nPatch-set: 1\nLabel: Code-Review=+2\nAttention: {\"person_ident\":\"Gopher \\u003c1@server\\u003e\",\"operation\":\"REMOVE\",\"reason\":\"\\u003cGERRIT_ACCOUNT_1\\u003e replied on the change\"}\n",
+		"Update patch set 1\n\nPatch-set: 1\nHashtags: wait-release\nTag: autogenerated:gerrit:setHashtag\n",
+	} {
+		m := newGerritMeta(&GitCommit{Msg: msg}, cl)
+		cl.Metas = append(cl.Metas, m)
+		cl.Meta = m
+	}
+
+	if got, want := len(cl.Metas[1].AttentionUpdates()), 1; got != want {
+		t.Errorf("second meta has %d attention updates, want %d", got, want)
+	}
+	if got := cl.Metas[2].AttentionUpdates(); got != nil {
+		t.Errorf("hashtag meta has attention updates %v, want none", got)
+	}
+	want := map[string]string{"1@server": "Reviewer was added", "2@server": "Change was created"}
+	if got := cl.Metas[0].AttentionSet(); !reflect.DeepEqual(got, want) {
+		t.Errorf("attention set after first meta = %v; want %v", got, want)
+	}
+	want = map[string]string{"2@server": "Change was created"}
+	if got := cl.AttentionSet(); !reflect.DeepEqual(got, want) {
+		t.Errorf("cl.AttentionSet() = %v; want %v", got, want)
+	}
+	if got := cl.Hashtags(); got != "wait-release" {
+		t.Errorf("cl.Hashtags() = %q, want %q", got, "wait-release")
+	}
+}
+
+func TestGerritSubmitRecords(t *testing.T) {
+	cl := &GerritCL{}
+	for _, msg := range []string{
+		"Update patch set 2\n\nPatch-set: 2\nLabel: Code-Review=+2\n",
+		"Update patch set 2\n\nChange has been successfully merged\n\nPatch-set: 2\nStatus: merged\nSubmission-id: 12345-1\nSubmitted-with: OK\nRule-Name: gerrit~DefaultSubmitRule\nSubmitted-with: OK: Code-Review: Gopher <1@server>\nSubmitted-with: MAY: Hold\nTag: autogenerated:gerrit:merged\n",
+	} {
+		m := newGerritMeta(&GitCommit{Msg: msg}, cl)
+		cl.Metas = append(cl.Metas, m)
+		cl.Meta = m
+	}
+	if got := cl.Metas[0].SubmitRecords(); got != nil {
+		t.Errorf("first meta has submit records %v, want none", got)
+	}
+	want := []GerritSubmitRecord{{
+		Status: "OK",
+		Rule:   "gerrit~DefaultSubmitRule",
+		Labels: []GerritSubmitLabel{
+			{Label: "Code-Review", Status: "OK", AppliedBy: "1@server"},
+			{Label: "Hold", Status: "MAY"},
+		},
+	}}
+	if got := cl.SubmitRecords(); !reflect.DeepEqual(got, want) {
+		t.Errorf("cl.SubmitRecords() = %+v; want %+v", got, want)
+	}
+}
@@ -81,8 +81,17 @@ func (g *GitHub) ForeachRepo(fn func(*GitHubRepo) error) error {
 }
 
 // Repo returns the repo if it's known. Otherwise it returns nil.
+//
+// If the corpus loads repos lazily (see LoadFilter), Repo loads the
+// repo first if it isn't loaded yet.
 func (g *GitHub) Repo(owner, repo string) *GitHubRepo {
-	return g.repos[GitHubRepoID{owner, repo}]
+	id := GitHubRepoID{owner, repo}
+	r := g.repos[id]
+	if r == nil && g.c.lazyLoads() {
+		g.c.lazyLoadGitHub(id)
+		r = g.c.GitHub().repos[id]
+	}
+	return r
 }
 
 func (g *GitHub) getOrCreateRepo(owner, repo string) *GitHubRepo {
@@ -1286,6 +1295,7 @@ func (c *Corpus) processGithubIssueMutation(m *maintpb.GithubIssueMutation) {
 			panic(err)
 		}
 	}
+	c.noteEnrichIssue(GitHubIssueRef{gr, gi.Number})
 	if m.NotExist != gi.NotExist {
 		gi.NotExist = m.NotExist
 	}
@@ -1345,6 +1355,9 @@ func (c *Corpus) processGithubIssueMutation(m *maintpb.GithubIssueMutation) {
 	if m.BodyChange != nil {
 		gi.Body = m.BodyChange.Val
 	}
+	if m.Body != "" || m.BodyChange != nil {
+		c.updateIssueTextXRefs(GitHubIssueRef{gr, gi.Number}, 0, gi.Body)
+	}
 	if m.Title != "" {
 		gi.Title = m.Title
 	}
@@ -1388,6 +1401,7 @@ func (c *Corpus) processGithubIssueMutation(m *maintpb.GithubIssueMutation) {
 		}
 		if cmut.Body != "" {
 			gc.Body = cmut.Body
+			c.updateIssueTextXRefs(GitHubIssueRef{gr, gi.Number}, gc.ID, gc.Body)
 		}
 	}
 	if m.CommentStatus != nil && m.CommentStatus.ServerDate != nil {
@@ -1406,6 +1420,7 @@ func (c *Corpus) processGithubIssueMutation(m *maintpb.GithubIssueMutation) {
 		}
 		gie := gr.newGithubEvent(emut)
 		gi.events[emut.Id] = gie
+		c.updateIssueEventXRefs(GitHubIssueRef{gr, gi.Number}, gie)
 		if gie.Created.After(gi.eventMaxTime) {
 			gi.eventMaxTime = gie.Created
 		}
@@ -1485,24 +1500,7 @@ func (gr *GitHubRepo) sync(ctx context.Context, token string, loop bool) error {
 	if tr, ok := hc.Transport.(*http.Transport); ok {
 		defer tr.CloseIdleConnections()
 	}
-	directTransport := hc.Transport
-	if gr.github.c.githubLimiter != nil {
-		directTransport = limitTransport{gr.github.c.githubLimiter, hc.Transport}
-	}
-	cachingTransport := &httpcache.Transport{
-		Transport:           directTransport,
-		Cache:               &githubCache{Cache: httpcache.NewMemoryCache()},
-		MarkCachedResponses: true, // adds "X-From-Cache: 1" response header.
-	}
-
-	p := &githubRepoPoller{
-		c:             gr.github.c,
-		token:         token,
-		gr:            gr,
-		githubDirect:  github.NewClient(&http.Client{Transport: directTransport}),
-		githubCaching: github.NewClient(&http.Client{Transport: cachingTransport}),
-		client:        http.DefaultClient,
-	}
+	p := gr.newPoller(hc, token)
 	activityCh := gr.github.c.activityChan("github:" + gr.id.String())
 	var expectChanges bool // got webhook update, but haven't seen new data yet
 	var sleepDelay time.Duration
@@ -1549,6 +1547,28 @@ func (gr *GitHubRepo) sync(ctx context.Context, token string, loop bool) error {
 	}
 }
 
+// newPoller returns a poller of gr that makes its GitHub API requests
+// with hc, which authenticates them with token.
+func (gr *GitHubRepo) newPoller(hc *http.Client, token string) *githubRepoPoller {
+	directTransport := hc.Transport
+	if gr.github.c.githubLimiter != nil {
+		directTransport = limitTransport{gr.github.c.githubLimiter, hc.Transport}
+	}
+	cachingTransport := &httpcache.Transport{
+		Transport:           directTransport,
+		Cache:               &githubCache{Cache: httpcache.NewMemoryCache()},
+		MarkCachedResponses: true, // adds "X-From-Cache: 1" response header.
+	}
+	return &githubRepoPoller{
+		c:             gr.github.c,
+		token:         token,
+		gr:            gr,
+		githubDirect:  github.NewClient(&http.Client{Transport: directTransport}),
+		githubCaching: github.NewClient(&http.Client{Transport: cachingTransport}),
+		client:        http.DefaultClient,
+	}
+}
+
 type httpClient interface {
 	Do(req *http.Request) (*http.Response, error)
 }
@@ -1967,43 +1987,11 @@ func (p *githubRepoPoller) syncCommentsOnIssue(ctx context.Context, issueNum int
 				p.logf("bogus comment: %v", ic)
 				continue
 			}
-			created, err := ptypes.TimestampProto(*ic.CreatedAt)
-			if err != nil {
-				continue
-			}
-			updated, err := ptypes.TimestampProto(*ic.UpdatedAt)
+			cmut, err := newCommentMutation(issue.comments[int64(*ic.ID)], ic)
 			if err != nil {
 				continue
 			}
 			since = *ic.UpdatedAt // for next round
-
-			id := int64(*ic.ID)
-			cur := issue.comments[id]
-
-			// TODO: does a reaction update a comment's UpdatedAt time?
-			var cmut *maintpb.GithubIssueCommentMutation
-			if cur == nil {
-				cmut = &maintpb.GithubIssueCommentMutation{
-					Id: id,
-					User: &maintpb.GithubUser{
-						Id:    int64(*ic.User.ID),
-						Login: *ic.User.Login,
-					},
-					Body:    *ic.Body,
-					Created: created,
-					Updated: updated,
-				}
-			} else if !cur.Updated.Equal(*ic.UpdatedAt) || cur.Body != *ic.Body {
-				cmut = &maintpb.GithubIssueCommentMutation{
-					Id: id,
-				}
-				if !cur.Updated.Equal(*ic.UpdatedAt) {
-					cmut.Updated = updated
-				}
-				if cur.Body != *ic.Body {
-					cmut.Body = *ic.Body
-				}
-			}
 			if cmut != nil {
 				mut.GithubIssue.Comment = append(mut.GithubIssue.Comment, cmut)
 			}
@@ -2021,6 +2009,50 @@ func (p *githubRepoPoller) syncCommentsOnIssue(ctx context.Context, issueNum int
 	return nil
 }
 
+// newCommentMutation returns the mutation that brings cur, the corpus's
+// copy of a comment or nil if it has none, up to date with ic, which
+// must have an ID, body, user and times. It returns nil if cur is
+// already up to date.
+//
+// (requires corpus be locked for reads)
+func newCommentMutation(cur *GitHubComment, ic *github.IssueComment) (*maintpb.GithubIssueCommentMutation, error) {
+	created, err := ptypes.TimestampProto(*ic.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	updated, err := ptypes.TimestampProto(*ic.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	// TODO: does a reaction update a comment's UpdatedAt time?
+	if cur == nil {
+		return &maintpb.GithubIssueCommentMutation{
+			Id: int64(*ic.ID),
+			User: &maintpb.GithubUser{
+				Id:    int64(*ic.User.ID),
+				Login: *ic.User.Login,
+			},
+			Body:    *ic.Body,
+			Created: created,
+			Updated: updated,
+		}, nil
+	}
+	if cur.Updated.Equal(*ic.UpdatedAt) && cur.Body == *ic.Body {
+		return nil, nil
+	}
+	cmut := &maintpb.GithubIssueCommentMutation{
+		Id: int64(*ic.ID),
+	}
+	if !cur.Updated.Equal(*ic.UpdatedAt) {
+		cmut.Updated = updated
+	}
+	if cur.Body != *ic.Body {
+		cmut.Body = *ic.Body
+	}
+	return cmut, nil
+}
+
 func (p *githubRepoPoller) issueNumbersWithStaleEventSync() (issueNums []int32) {
 	p.c.mu.RLock()
 	defer p.c.mu.RUnlock()
@@ -2077,44 +2109,13 @@ func (p *githubRepoPoller) syncEventsOnIssue(ctx context.Context, issueNum int32
 	err := p.foreachItem(ctx,
 		1+skipPages,
 		func(ctx context.Context, page int) ([]interface{}, *github.Response, error) {
-			u := fmt.Sprintf("https://api.github.com/repos/%s/%s/issues/%v/events?per_page=%v&page=%v",
-				p.Owner(), p.Repo(), issueNum, perPage, page)
-			req, _ := http.NewRequest("GET", u, nil)
-
-			req.Header.Set("Authorization", "Bearer "+p.token)
-			req.Header.Set("User-Agent", "golang-x-build-maintner/1.0")
-			ctx, cancel := context.WithTimeout(ctx, time.Minute)
-			defer cancel()
-			req = req.WithContext(ctx)
-			res, err := p.client.Do(req)
+			is, ghResp, serverDate, err := p.getEventPage(ctx, issueNum, page, perPage)
 			if err != nil {
-				log.Printf("Fetching %s: %v", u, err)
-				return nil, nil, err
-			}
-			log.Printf("Fetching %s: %v", u, res.Status)
-			ghResp := makeGithubResponse(res)
-			if err := github.CheckResponse(res); err != nil {
-				log.Printf("Fetching %s: %v: %+v", u, res.Status, res.Header)
-				log.Printf("GitHub error %s: %v", u, ghResp)
 				return nil, nil, err
 			}
-
-			evts, err := parseGithubEvents(res.Body)
-			if err != nil {
-				return nil, nil, fmt.Errorf("%s: parse github events: %v", u, err)
-			}
-			is := make([]interface{}, len(evts))
-			for i, v := range evts {
-				is[i] = v
-			}
-			serverDate, err := http.ParseTime(res.Header.Get("Date"))
-			if err != nil {
-				return nil, nil, fmt.Errorf("invalid server Date response: %v", err)
-			}
-			sdp, _ := ptypes.TimestampProto(serverDate.UTC())
+			sdp, _ := ptypes.TimestampProto(serverDate)
 			mut.GithubIssue.EventStatus = &maintpb.GithubIssueSyncStatus{ServerDate: sdp}
-
-			return is, ghResp, err
+			return is, ghResp, nil
 		},
 		func(v interface{}) error {
 			ge := v.(*GitHubIssueEvent)
@@ -2138,6 +2139,46 @@ func (p *githubRepoPoller) syncEventsOnIssue(ctx context.Context, issueNum int32
 	return nil
 }
 
+// getEventPage returns a page of the events of an issue, as
+// *GitHubIssueEvents, and the server's time of the response.
+func (p *githubRepoPoller) getEventPage(ctx context.Context, issueNum int32, page, perPage int) ([]interface{}, *github.Response, time.Time, error) {
+	u := fmt.Sprintf("https://api.github.com/repos/%s/%s/issues/%v/events?per_page=%v&page=%v",
+		p.Owner(), p.Repo(), issueNum, perPage, page)
+	req, _ := http.NewRequest("GET", u, nil)
+
+	req.Header.Set("Authorization", "Bearer "+p.token)
+	req.Header.Set("User-Agent", "golang-x-build-maintner/1.0")
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+	req = req.WithContext(ctx)
+	res, err := p.client.Do(req)
+	if err != nil {
+		log.Printf("Fetching %s: %v", u, err)
+		return nil, nil, time.Time{}, err
+	}
+	log.Printf("Fetching %s: %v", u, res.Status)
+	ghResp := makeGithubResponse(res)
+	if err := github.CheckResponse(res); err != nil {
+		log.Printf("Fetching %s: %v: %+v", u, res.Status, res.Header)
+		log.Printf("GitHub error %s: %v", u, ghResp)
+		return nil, nil, time.Time{}, err
+	}
+
+	evts, err := parseGithubEvents(res.Body)
+	if err != nil {
+		return nil, nil, time.Time{}, fmt.Errorf("%s: parse github events: %v", u, err)
+	}
+	is := make([]interface{}, len(evts))
+	for i, v := range evts {
+		is[i] = v
+	}
+	serverDate, err := http.ParseTime(res.Header.Get("Date"))
+	if err != nil {
+		return nil, nil, time.Time{}, fmt.Errorf("invalid server Date response: %v", err)
+	}
+	return is, ghResp, serverDate.UTC(), nil
+}
+
 // parseGithubEvents parses the JSON array of GitHub issue events in r.
 // It does this the very manual way (using map[string]interface{})
 // instead of using nice types because https://golang.org/issue/15314
@@ -29,3 +29,21 @@ func ExampleGet_numComments() {
 	})
 	fmt.Printf("%d GitHub comments on Go repos.\n", num)
 }
+
+func ExampleGet_partial() {
+	corpus, err := godata.Get(context.Background(), godata.Partial([]string{"golang/go"}, nil))
+	if err != nil {
+		log.Fatal(err)
+	}
+	open := 0
+	corpus.GitHub().Repo("golang", "go").ForeachIssue(func(gi *maintner.GitHubIssue) error {
+		if !gi.Closed && !gi.PullRequest {
+			open++
+		}
+		return nil
+	})
+	fmt.Printf("%d open issues in golang/go.\n", open)
+
+	// Gerrit projects are loaded as they're looked up.
+	fmt.Println(corpus.Gerrit().Project("go.googlesource.com", "build").ServerSlashProject())
+}
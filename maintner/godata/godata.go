@@ -15,6 +15,7 @@ import (
 	"os/user"
 	"path/filepath"
 	"runtime"
+	"strings"
 
 	"golang.org/x/build/maintner"
 )
@@ -43,21 +44,64 @@ const Server = "https://maintner.golang.org/logs"
 // The in-memory representation is about 25% larger than its on-disk
 // size. In April 2022, it's under 4 GB.
 //
+// Programs that only need some GitHub repos or Gerrit projects can
+// save memory and loading time by passing the Partial option.
+//
 // See https://pkg.go.dev/golang.org/x/build/maintner#Corpus for how
 // to walk the data structure.
-func Get(ctx context.Context) (*maintner.Corpus, error) {
+func Get(ctx context.Context, opts ...Option) (*maintner.Corpus, error) {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
 	targetDir := Dir()
 	if err := os.MkdirAll(targetDir, 0700); err != nil {
 		return nil, err
 	}
 	mutSrc := maintner.NewNetworkMutationSource(Server, targetDir)
 	corpus := new(maintner.Corpus)
+	if o.filter != nil {
+		mutSrc = maintner.NewFilteredNetworkMutationSource(Server, targetDir, *o.filter)
+		corpus.SetLoadFilter(*o.filter)
+	}
 	if err := corpus.Initialize(ctx, mutSrc); err != nil {
 		return nil, err
 	}
 	return corpus, nil
 }
 
+// An Option changes how Get loads the corpus.
+type Option func(*options)
+
+type options struct {
+	filter *maintner.LoadFilter
+}
+
+// Partial returns an Option that initially loads only the given GitHub
+// repos, such as "golang/go", and Gerrit projects, such as
+// "go.googlesource.com/go", and loads others as they're first looked
+// up with GitHub.Repo and Gerrit.Project. The commits of the main Go
+// repo that aren't part of Gerrit CLs aren't loaded.
+//
+// The server filters the mutation log, so only the mutations of the
+// selected repos and projects are downloaded and kept in memory.
+// Looking up a GitHub repo or Gerrit project that isn't loaded yet
+// downloads its part of the mutation log. See maintner.LoadFilter and
+// maintner.NewFilteredNetworkMutationSource for details.
+func Partial(gitHubRepos, gerritProjects []string) Option {
+	return func(o *options) {
+		f := &maintner.LoadFilter{
+			GerritProjects: gerritProjects,
+			Lazy:           true,
+		}
+		for _, r := range gitHubRepos {
+			owner, repo, _ := strings.Cut(r, "/")
+			f.GitHubRepos = append(f.GitHubRepos, maintner.GitHubRepoID{Owner: owner, Repo: repo})
+		}
+		o.filter = f
+	}
+}
+
 // Dir returns the directory containing the cached mutation logs.
 func Dir() string {
 	return filepath.Join(XdgCacheDir(), "golang-maintner")
@@ -0,0 +1,275 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package maintner
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"sort"
+	"strings"
+
+	"golang.org/x/build/maintner/maintpb"
+	"golang.org/x/build/maintner/mutenc"
+	"golang.org/x/build/maintner/reclog"
+)
+
+// A LoadFilter selects the parts of a mutation log that a Corpus loads
+// into memory, so that programs that only look at a few GitHub repos or
+// Gerrit projects don't pay for the whole history of the Go project.
+//
+// The mutations that a filter leaves out are discarded instead of
+// processed. To not download them at all, read the mutation log with
+// NewFilteredNetworkMutationSource, which has the server filter it.
+type LoadFilter struct {
+	// GitHubRepos are the GitHub repos whose issues, labels and
+	// milestones are loaded.
+	GitHubRepos []GitHubRepoID
+
+	// GerritProjects are the Gerrit projects whose CLs, refs and
+	// commits are loaded, such as "go.googlesource.com/build".
+	GerritProjects []string
+
+	// Git is whether to load the commits of the Go repo that the
+	// leader tracks with TrackGoGitRepo.
+	Git bool
+
+	// Lazy is whether GitHub.Repo and Gerrit.Project load the repos
+	// and projects that aren't loaded yet when they're looked up.
+	// Doing so replays the mutations that the corpus already read,
+	// so it needs a mutation source that can replay them, such as
+	// those returned by NewNetworkMutationSource and
+	// NewFilteredNetworkMutationSource.
+	//
+	// Lazy loading locks the corpus, so with it the corpus's read
+	// lock must not be held while looking up repos and projects.
+	Lazy bool
+}
+
+// loadFilter is the state of a LoadFilter in a Corpus.
+//
+// A nil *loadFilter loads everything.
+type loadFilter struct {
+	github map[GitHubRepoID]bool
+	gerrit map[string]bool // keyed by "go.googlesource.com/build"
+	git    bool
+	lazy   bool
+}
+
+func (f *loadFilter) wantsGitHub(owner, repo string) bool {
+	return f == nil || f.github[GitHubRepoID{owner, repo}]
+}
+
+func (f *loadFilter) wantsGerrit(proj string) bool {
+	return f == nil || f.gerrit[proj]
+}
+
+func (f *loadFilter) wantsGit() bool {
+	return f == nil || f.git
+}
+
+// wants reports whether f selects any part of mutation m.
+func (f *loadFilter) wants(m *maintpb.Mutation) bool {
+	if im := m.GithubIssue; im != nil && f.wantsGitHub(im.Owner, im.Repo) {
+		return true
+	}
+	if gm := m.Github; gm != nil && f.wantsGitHub(gm.Owner, gm.Repo) {
+		return true
+	}
+	if m.Git != nil && f.wantsGit() {
+		return true
+	}
+	if gm := m.Gerrit; gm != nil && f.wantsGerrit(gm.Project) {
+		return true
+	}
+	return false
+}
+
+// values returns the query parameters that ask a server for the
+// filtered log of f. See ParseLoadFilter.
+func (f *loadFilter) values() url.Values {
+	v := make(url.Values)
+	for id := range f.github {
+		v.Add("github", id.String())
+	}
+	for proj := range f.gerrit {
+		v.Add("gerrit", proj)
+	}
+	sort.Strings(v["github"])
+	sort.Strings(v["gerrit"])
+	if f.git {
+		v.Set("git", "1")
+	}
+	return v
+}
+
+// key returns a short string that identifies what f selects, for the
+// names of caches of filtered logs.
+func (f *loadFilter) key() string {
+	return fmt.Sprintf("%x", sha256.Sum224([]byte(f.values().Encode())))[:16]
+}
+
+// ParseLoadFilter parses the query parameters of a request for a
+// filtered mutation log, as sent by NewFilteredNetworkMutationSource:
+// the "github" parameters are the "owner/repo" names of the GitHub
+// repos, the "gerrit" parameters the Gerrit projects, and the "git"
+// parameter is "1" to select the commits of the Go repo.
+func ParseLoadFilter(v url.Values) (LoadFilter, error) {
+	var f LoadFilter
+	for _, r := range v["github"] {
+		owner, repo, ok := strings.Cut(r, "/")
+		if !ok || owner == "" || repo == "" {
+			return LoadFilter{}, fmt.Errorf("malformed GitHub repo %q", r)
+		}
+		f.GitHubRepos = append(f.GitHubRepos, GitHubRepoID{owner, repo})
+	}
+	f.GerritProjects = v["gerrit"]
+	switch v.Get("git") {
+	case "", "0":
+	case "1":
+		f.Git = true
+	default:
+		return LoadFilter{}, fmt.Errorf("malformed git parameter %q", v.Get("git"))
+	}
+	return f, nil
+}
+
+// WriteFilteredLog copies the records of the mutation log read from r
+// whose mutations f selects to w, renumbering their offsets so that w
+// holds a mutation log of its own. The off argument is the offset in
+// its log segment that r starts at, which must be that of a record.
+func (f LoadFilter) WriteFilteredLog(w io.Writer, r io.Reader, off int64) error {
+	lf := newLoadFilter(f)
+	var wOff int64
+	return reclog.ForeachRecord(r, off, func(off int64, hdr, rec []byte) error {
+		m := new(maintpb.Mutation)
+		if err := mutenc.Unmarshal(rec, m); err != nil {
+			return err
+		}
+		if !lf.wants(m) {
+			return nil
+		}
+		cw := &countingWriter{w: w}
+		err := reclog.WriteRecord(cw, wOff, rec)
+		wOff += cw.n
+		return err
+	})
+}
+
+// countingWriter is an io.Writer that counts the bytes written to w.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+// newLoadFilter returns the state of f in a Corpus.
+func newLoadFilter(f LoadFilter) *loadFilter {
+	lf := &loadFilter{
+		github: make(map[GitHubRepoID]bool),
+		gerrit: make(map[string]bool),
+		git:    f.Git,
+		lazy:   f.Lazy,
+	}
+	for _, id := range f.GitHubRepos {
+		lf.github[id] = true
+	}
+	for _, proj := range f.GerritProjects {
+		lf.gerrit[proj] = true
+	}
+	return lf
+}
+
+// SetLoadFilter restricts the corpus to the parts of its mutation log
+// that f selects. It must be called before Initialize.
+func (c *Corpus) SetLoadFilter(f LoadFilter) {
+	if c.mutationSource != nil {
+		panic("SetLoadFilter called after Initialize")
+	}
+	c.loadFilter = newLoadFilter(f)
+}
+
+// A mutationReplayer is a MutationSource that can send again the
+// mutations it already sent, which lazy loading needs.
+type mutationReplayer interface {
+	// replayMutations calls fn with each mutation that the source
+	// sent so far, in order, stopping if fn returns an error. The
+	// source may leave out the mutations that sel doesn't select.
+	replayMutations(ctx context.Context, sel *loadFilter, fn func(*maintpb.Mutation) error) error
+}
+
+// checkLoadFilter reports whether the load filter of the corpus can be
+// used with mutation source src.
+func (c *Corpus) checkLoadFilter(src MutationSource) error {
+	if c.loadFilter == nil || !c.loadFilter.lazy {
+		return nil
+	}
+	if _, ok := src.(mutationReplayer); !ok {
+		return fmt.Errorf("maintner: lazy loading isn't supported by mutation source %T", src)
+	}
+	return nil
+}
+
+// lazyLoads reports whether the corpus loads repos and projects as
+// they're looked up.
+func (c *Corpus) lazyLoads() bool {
+	return c != nil && c.loadFilter != nil && c.loadFilter.lazy
+}
+
+// lazyLoadGitHub loads GitHub repo id, if it isn't loaded yet.
+func (c *Corpus) lazyLoadGitHub(id GitHubRepoID) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.loadFilter.github[id] {
+		return
+	}
+	c.lazyLoadLocked(id.String(), &loadFilter{github: map[GitHubRepoID]bool{id: true}})
+	c.loadFilter.github[id] = true
+}
+
+// lazyLoadGerrit loads Gerrit project proj, if it isn't loaded yet.
+func (c *Corpus) lazyLoadGerrit(proj string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.loadFilter.gerrit[proj] {
+		return
+	}
+	c.lazyLoadLocked(proj, &loadFilter{gerrit: map[string]bool{proj: true}})
+	c.loadFilter.gerrit[proj] = true
+}
+
+// lazyLoadLocked processes the mutations that the corpus already read
+// and sel selects. It's only marked as loaded by the caller, so that
+// mutations read later are processed. Even if replaying fails partway,
+// it's marked as loaded, since processing the same mutations twice is
+// worse than missing some.
+//
+// c.mu must be held.
+func (c *Corpus) lazyLoadLocked(what string, sel *loadFilter) {
+	if c.mutationSource == nil {
+		// Not initialized yet; it'll be loaded along with the
+		// rest once it is.
+		return
+	}
+	log.Printf("Lazily loading %s ...", what)
+	c.lazySel = sel
+	err := c.mutationSource.(mutationReplayer).replayMutations(context.Background(), sel, func(m *maintpb.Mutation) error {
+		c.processMutationLocked(m)
+		return nil
+	})
+	c.lazySel = nil
+	c.finishProcessing()
+	if err != nil {
+		log.Printf("Lazily loading %s: %v", what, err)
+	}
+}
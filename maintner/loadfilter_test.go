@@ -0,0 +1,194 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package maintner
+
+import (
+	"bytes"
+	"context"
+	"net/url"
+	"os"
+	"testing"
+
+	"golang.org/x/build/maintner/maintpb"
+	"golang.org/x/build/maintner/mutenc"
+	"golang.org/x/build/maintner/reclog"
+)
+
+// newFilterTestLog returns a mutation log on disk with issues in two
+// GitHub repos and two Gerrit projects.
+func newFilterTestLog(t *testing.T) *DiskMutationLogger {
+	logger := NewDiskMutationLogger(t.TempDir())
+	for _, m := range []*maintpb.Mutation{
+		{GithubIssue: &maintpb.GithubIssueMutation{Owner: "golang", Repo: "go", Number: 1, Title: "go issue", Created: p3339("2023-04-01T12:00:00Z")}},
+		{GithubIssue: &maintpb.GithubIssueMutation{Owner: "golang", Repo: "build", Number: 1, Title: "build issue", Created: p3339("2023-04-01T12:00:00Z")}},
+		{Gerrit: &maintpb.GerritMutation{Project: "go.googlesource.com/go"}},
+		{Gerrit: &maintpb.GerritMutation{Project: "go.googlesource.com/build"}},
+		{GithubIssue: &maintpb.GithubIssueMutation{Owner: "golang", Repo: "build", Number: 2, Title: "another build issue", Created: p3339("2023-04-01T12:00:00Z")}},
+	} {
+		if err := logger.Log(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return logger
+}
+
+func TestLoadFilter(t *testing.T) {
+	c := new(Corpus)
+	c.SetLoadFilter(LoadFilter{
+		GitHubRepos:    []GitHubRepoID{{"golang", "go"}},
+		GerritProjects: []string{"go.googlesource.com/go"},
+	})
+	if err := c.Initialize(context.Background(), newFilterTestLog(t)); err != nil {
+		t.Fatal(err)
+	}
+	if r := c.GitHub().Repo("golang", "go"); r == nil || r.Issue(1) == nil {
+		t.Errorf("golang/go issue 1 not loaded")
+	}
+	if r := c.GitHub().Repo("golang", "build"); r != nil {
+		t.Errorf("golang/build loaded; want it left out")
+	}
+	if c.Gerrit().Project("go.googlesource.com", "go") == nil {
+		t.Errorf("Gerrit project go not loaded")
+	}
+	if c.Gerrit().Project("go.googlesource.com", "build") != nil {
+		t.Errorf("Gerrit project build loaded; want it left out")
+	}
+}
+
+func TestLoadFilterLazy(t *testing.T) {
+	c := new(Corpus)
+	c.SetLoadFilter(LoadFilter{
+		GitHubRepos: []GitHubRepoID{{"golang", "go"}},
+		Lazy:        true,
+	})
+	if err := c.Initialize(context.Background(), newFilterTestLog(t)); err != nil {
+		t.Fatal(err)
+	}
+	var repos []string
+	c.GitHub().ForeachRepo(func(r *GitHubRepo) error {
+		repos = append(repos, r.ID().String())
+		return nil
+	})
+	if len(repos) != 1 || repos[0] != "golang/go" {
+		t.Errorf("initially loaded repos %q; want only golang/go", repos)
+	}
+
+	r := c.GitHub().Repo("golang", "build")
+	if r == nil {
+		t.Fatalf("golang/build not lazily loaded")
+	}
+	for _, num := range []int32{1, 2} {
+		if r.Issue(num) == nil {
+			t.Errorf("golang/build issue %d not lazily loaded", num)
+		}
+	}
+	if c.GitHub().Repo("golang", "go").Issue(1).Title != "go issue" {
+		t.Errorf("golang/go changed by lazy loading")
+	}
+	if c.Gerrit().Project("go.googlesource.com", "build") == nil {
+		t.Errorf("Gerrit project build not lazily loaded")
+	}
+	if c.GitHub().Repo("golang", "nope") != nil {
+		t.Errorf("nonexistent repo found")
+	}
+
+	// Later mutations of lazily loaded repos are processed.
+	c.mu.Lock()
+	c.processMutationLocked(&maintpb.Mutation{GithubIssue: &maintpb.GithubIssueMutation{Owner: "golang", Repo: "build", Number: 3, Created: p3339("2023-04-01T12:00:00Z")}})
+	c.processMutationLocked(&maintpb.Mutation{GithubIssue: &maintpb.GithubIssueMutation{Owner: "golang", Repo: "tools", Number: 1, Created: p3339("2023-04-01T12:00:00Z")}})
+	c.finishProcessing()
+	c.mu.Unlock()
+	if r.Issue(3) == nil {
+		t.Errorf("golang/build issue 3 not loaded")
+	}
+	if c.github.repos[GitHubRepoID{"golang", "tools"}] != nil {
+		t.Errorf("golang/tools loaded before it was looked up")
+	}
+}
+
+// noReplaySource is a MutationSource that can't replay mutations.
+type noReplaySource struct{ MutationSource }
+
+func TestLoadFilterLazyNeedsReplay(t *testing.T) {
+	c := new(Corpus)
+	c.SetLoadFilter(LoadFilter{Lazy: true})
+	if err := c.Initialize(context.Background(), noReplaySource{newFilterTestLog(t)}); err == nil {
+		t.Errorf("Initialize succeeded with a source that can't replay mutations; want error")
+	}
+}
+
+func TestWriteFilteredLog(t *testing.T) {
+	f, err := ParseLoadFilter(url.Values{"github": {"golang/build"}, "gerrit": {"go.googlesource.com/go"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var filtered bytes.Buffer
+	err = newFilterTestLog(t).ForeachFile(func(fullPath string, fi os.FileInfo) error {
+		in, err := os.Open(fullPath)
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+		return f.WriteFilteredLog(&filtered, in, 0)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	err = reclog.ForeachRecord(&filtered, 0, func(off int64, hdr, rec []byte) error {
+		m := new(maintpb.Mutation)
+		if err := mutenc.Unmarshal(rec, m); err != nil {
+			return err
+		}
+		if m.GithubIssue != nil {
+			got = append(got, m.GithubIssue.Title)
+		} else {
+			got = append(got, m.Gerrit.Project)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"build issue", "go.googlesource.com/go", "another build issue"}
+	if len(got) != len(want) {
+		t.Fatalf("filtered mutations = %q; want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("filtered mutation %d = %q; want %q", i, got[i], want[i])
+		}
+	}
+
+	for _, v := range []url.Values{
+		{"github": {"golang"}},
+		{"git": {"yes"}},
+	} {
+		if _, err := ParseLoadFilter(v); err == nil {
+			t.Errorf("ParseLoadFilter(%v) succeeded; want error", v)
+		}
+	}
+}
+
+func TestExtendsSegments(t *testing.T) {
+	last := []LogSegmentJSON{{Number: 0, Size: 10, SHA224: "a"}, {Number: 1, Size: 5, SHA224: "b"}}
+	tests := []struct {
+		segs []LogSegmentJSON
+		want bool
+	}{
+		{last, true},
+		{[]LogSegmentJSON{last[0], {Number: 1, Size: 7, SHA224: "c"}}, true},
+		{[]LogSegmentJSON{last[0], {Number: 1, Size: 9, SHA224: "d"}, {Number: 2, Size: 1, SHA224: "e"}}, true},
+		{[]LogSegmentJSON{last[0]}, false},
+		{[]LogSegmentJSON{last[0], {Number: 1, Size: 4, SHA224: "c"}}, false},
+		{[]LogSegmentJSON{last[0], {Number: 1, Size: 5, SHA224: "c"}}, false},
+		{[]LogSegmentJSON{{Number: 0, Size: 12, SHA224: "f"}, last[1]}, false},
+	}
+	for i, tt := range tests {
+		if got := extendsSegments(tt.segs, last); got != tt.want {
+			t.Errorf("%d. extendsSegments = %v; want %v", i, got, tt.want)
+		}
+	}
+}
@@ -13,8 +13,8 @@ import (
 	"sync"
 	"time"
 
-	"github.com/golang/protobuf/proto"
 	"golang.org/x/build/maintner/maintpb"
+	"golang.org/x/build/maintner/mutenc"
 	"golang.org/x/build/maintner/reclog"
 )
 
@@ -23,9 +23,30 @@ type MutationLogger interface {
 	Log(*maintpb.Mutation) error
 }
 
+// MultiMutationLogger returns a MutationLogger that logs each mutation
+// to all the provided loggers, in order. It stops at the first error.
+//
+// It is used to dual-write mutations in two formats while migrating
+// a log from one format to another.
+func MultiMutationLogger(loggers ...MutationLogger) MutationLogger {
+	return multiMutationLogger(loggers)
+}
+
+type multiMutationLogger []MutationLogger
+
+func (ml multiMutationLogger) Log(m *maintpb.Mutation) error {
+	for _, l := range ml {
+		if err := l.Log(m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // DiskMutationLogger logs mutations to disk.
 type DiskMutationLogger struct {
 	directory string
+	format    mutenc.Format
 
 	mu   sync.Mutex
 	done bool // true after first GetMutations
@@ -37,9 +58,15 @@ func NewDiskMutationLogger(directory string) *DiskMutationLogger {
 	if directory == "" {
 		panic("empty directory")
 	}
-	return &DiskMutationLogger{directory: directory}
+	return &DiskMutationLogger{directory: directory, format: mutenc.V1}
 }
 
+// SetFormat sets the format in which d writes new mutations.
+// The default is mutenc.V1. Mutations in either format can be read.
+//
+// It must only be called before d is used.
+func (d *DiskMutationLogger) SetFormat(f mutenc.Format) { d.format = f }
+
 // filename returns the filename to write to. The oldest filename must come
 // first in lexical order.
 func (d *DiskMutationLogger) filename() string {
@@ -50,7 +77,7 @@ func (d *DiskMutationLogger) filename() string {
 // Log will write m to disk. If a mutation file does not exist for the current
 // day, it will be created.
 func (d *DiskMutationLogger) Log(m *maintpb.Mutation) error {
-	data, err := proto.Marshal(m)
+	data, err := mutenc.Marshal(m, d.format)
 	if err != nil {
 		return err
 	}
@@ -100,19 +127,13 @@ func (d *DiskMutationLogger) GetMutations(ctx context.Context) <-chan MutationSt
 	ch := make(chan MutationStreamEvent, 50) // buffered: overlap gunzip/unmarshal with loading
 
 	go func() {
-		err := d.ForeachFile(func(fullPath string, fi os.FileInfo) error {
-			return reclog.ForeachFileRecord(fullPath, func(off int64, hdr, rec []byte) error {
-				m := new(maintpb.Mutation)
-				if err := proto.Unmarshal(rec, m); err != nil {
-					return err
-				}
-				select {
-				case ch <- MutationStreamEvent{Mutation: m}:
-					return nil
-				case <-ctx.Done():
-					return ctx.Err()
-				}
-			})
+		err := d.replayMutations(ctx, nil, func(m *maintpb.Mutation) error {
+			select {
+			case ch <- MutationStreamEvent{Mutation: m}:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
 		})
 		final := MutationStreamEvent{Err: err}
 		if err == nil {
@@ -125,3 +146,17 @@ func (d *DiskMutationLogger) GetMutations(ctx context.Context) <-chan MutationSt
 	}()
 	return ch
 }
+
+// replayMutations calls fn with each mutation on disk, in order.
+// It doesn't filter them by sel.
+func (d *DiskMutationLogger) replayMutations(ctx context.Context, sel *loadFilter, fn func(*maintpb.Mutation) error) error {
+	return d.ForeachFile(func(fullPath string, fi os.FileInfo) error {
+		return reclog.ForeachFileRecord(fullPath, func(off int64, hdr, rec []byte) error {
+			m := new(maintpb.Mutation)
+			if err := mutenc.Unmarshal(rec, m); err != nil {
+				return err
+			}
+			return fn(m)
+		})
+	})
+}
@@ -50,6 +50,11 @@ type Corpus struct {
 	watchedGithubRepos []watchedGithubRepo
 	watchedGerritRepos []watchedGerritRepo
 	githubLimiter      *rate.Limiter
+	xrefs              xrefIndex // cross-references between issues, CLs and commits
+	enrichers          []Enricher
+	annotations        annotationIndex // of enrichers
+	loadFilter         *loadFilter     // nil to load everything
+	lazySel            *loadFilter     // if non-nil, what's being lazily loaded
 
 	// git-specific:
 	lastGitCount  time.Time // last time of log spam about loading status
@@ -99,7 +104,7 @@ func (c *Corpus) GitHub() *GitHub {
 	if c.github != nil {
 		return c.github
 	}
-	return new(GitHub)
+	return &GitHub{c: c}
 }
 
 // Gerrit returns the corpus's Gerrit data.
@@ -107,7 +112,7 @@ func (c *Corpus) Gerrit() *Gerrit {
 	if c.gerrit != nil {
 		return c.gerrit
 	}
-	return new(Gerrit)
+	return &Gerrit{c: c}
 }
 
 // Check verifies the internal structure of the Corpus data structures.
@@ -229,6 +234,9 @@ func (c *Corpus) Initialize(ctx context.Context, src MutationSource) error {
 	if c.mutationSource != nil {
 		panic("duplicate call to Initialize")
 	}
+	if err := c.checkLoadFilter(src); err != nil {
+		return err
+	}
 	c.mutationSource = src
 	log.Printf("Loading data from log %T ...", src)
 	return c.update(ctx, nil)
@@ -344,16 +352,20 @@ func (c *Corpus) addMutation(m *maintpb.Mutation) {
 
 // c.mu must be held.
 func (c *Corpus) processMutationLocked(m *maintpb.Mutation) {
-	if im := m.GithubIssue; im != nil {
+	f := c.loadFilter
+	if c.lazySel != nil {
+		f = c.lazySel
+	}
+	if im := m.GithubIssue; im != nil && f.wantsGitHub(im.Owner, im.Repo) {
 		c.processGithubIssueMutation(im)
 	}
-	if gm := m.Github; gm != nil {
+	if gm := m.Github; gm != nil && f.wantsGitHub(gm.Owner, gm.Repo) {
 		c.processGithubMutation(gm)
 	}
-	if gm := m.Git; gm != nil {
+	if gm := m.Git; gm != nil && f.wantsGit() {
 		c.processGitMutation(gm)
 	}
-	if gm := m.Gerrit; gm != nil {
+	if gm := m.Gerrit; gm != nil && f.wantsGerrit(gm.Project) {
 		c.processGerritMutation(gm)
 	}
 }
@@ -364,6 +376,7 @@ func (c *Corpus) processMutationLocked(m *maintpb.Mutation) {
 // c.mu must be held.
 func (c *Corpus) finishProcessing() {
 	c.gerrit.finishProcessing()
+	c.runEnrichers()
 }
 
 // SyncLoop runs forever (until an error or context expiration) and
@@ -0,0 +1,213 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package backfill lets administrators of maintnerd re-fetch parts of
+// the history of its GitHub repos and Gerrit projects, to repair gaps
+// left in the mutation log by past outages. See maintner.Corpus.Backfill.
+//
+// Backfills are managed over HTTP:
+//
+//	POST /backfills       start a backfill from a JSON Request
+//	GET  /backfills       list backfills, newest first
+//	GET  /backfills/<id>  get a backfill, with its log
+//
+// These requests must carry the server's token as a bearer token.
+// Backfills run one at a time, in the order they're started, and are
+// only kept in memory.
+package backfill
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/build/maintner"
+)
+
+// A Request is a request to backfill part of a repo's history.
+type Request struct {
+	// Repo is the GitHub repo, as "github.com/owner/repo", or the
+	// Gerrit project, as "go.googlesource.com/go", to backfill.
+	Repo string `json:"repo"`
+	// Since and Until bound the times of the history to re-fetch.
+	// Until may be omitted to backfill up to the present.
+	Since time.Time `json:"since"`
+	Until time.Time `json:"until,omitempty"`
+	// DryRun only reports the corrections the backfill would make.
+	DryRun bool `json:"dry_run,omitempty"`
+}
+
+// A Backfill is the state of a backfill.
+type Backfill struct {
+	ID      int       `json:"id"`
+	Request Request   `json:"request"`
+	Status  string    `json:"status"` // "queued", "running", "done" or "failed"
+	Error   string    `json:"error,omitempty"`
+	Created time.Time `json:"created"`
+	// Mutations is how many corrective mutations the backfill has
+	// made, or would make in a dry run.
+	Mutations int `json:"mutations"`
+	// Log is the progress of the backfill and the corrections it
+	// made. It's omitted from lists of backfills.
+	Log []string `json:"log,omitempty"`
+}
+
+// maxLogLines is the most log lines kept for a backfill.
+const maxLogLines = 10000
+
+// A Server runs backfills of a corpus.
+type Server struct {
+	c     *maintner.Corpus
+	token string
+	queue chan *Backfill
+
+	mu        sync.Mutex
+	backfills []*Backfill // by ID-1
+}
+
+// NewServer returns a Server that backfills c, which must be in leader
+// mode, for requests with token. Run must be called to run backfills.
+func NewServer(c *maintner.Corpus, token string) *Server {
+	return &Server{c: c, token: token, queue: make(chan *Backfill, 100)}
+}
+
+// RegisterHandlers registers the handlers that manage backfills on mux.
+func (s *Server) RegisterHandlers(mux *http.ServeMux) {
+	mux.HandleFunc("/backfills", s.serveBackfills)
+	mux.HandleFunc("/backfills/", s.serveBackfill)
+}
+
+// Run runs the backfills that are started until ctx is done.
+func (s *Server) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case b := <-s.queue:
+			s.run(ctx, b)
+		}
+	}
+}
+
+func (s *Server) run(ctx context.Context, b *Backfill) {
+	s.update(b, func() { b.Status = "running" })
+	muts, err := s.c.Backfill(ctx, maintner.BackfillRequest{
+		Repo:   b.Request.Repo,
+		Since:  b.Request.Since,
+		Until:  b.Request.Until,
+		DryRun: b.Request.DryRun,
+		Logf: func(format string, args ...interface{}) {
+			line := time.Now().UTC().Format(time.RFC3339) + " " + fmt.Sprintf(format, args...)
+			s.update(b, func() {
+				if len(b.Log) < maxLogLines {
+					b.Log = append(b.Log, line)
+				}
+			})
+		},
+	})
+	s.update(b, func() {
+		b.Mutations = len(muts)
+		b.Status = "done"
+		if err != nil {
+			b.Status, b.Error = "failed", err.Error()
+		}
+	})
+}
+
+func (s *Server) update(b *Backfill, f func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f()
+}
+
+func (s *Server) authorized(w http.ResponseWriter, r *http.Request) bool {
+	got := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if s.token == "" || subtle.ConstantTimeCompare([]byte(got), []byte(s.token)) != 1 {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+func (s *Server) serveBackfills(w http.ResponseWriter, r *http.Request) {
+	if !s.authorized(w, r) {
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		s.mu.Lock()
+		list := []Backfill{}
+		for i := len(s.backfills) - 1; i >= 0; i-- {
+			b := *s.backfills[i]
+			b.Log = nil
+			list = append(list, b)
+		}
+		s.mu.Unlock()
+		writeJSON(w, http.StatusOK, list)
+	case http.MethodPost:
+		var req Request
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<10)).Decode(&req); err != nil {
+			http.Error(w, "invalid request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if req.Repo == "" || req.Since.IsZero() {
+			http.Error(w, "invalid request: repo and since are required", http.StatusBadRequest)
+			return
+		}
+		if !req.Until.IsZero() && !req.Since.Before(req.Until) {
+			http.Error(w, "invalid request: since must be before until", http.StatusBadRequest)
+			return
+		}
+		s.mu.Lock()
+		b := &Backfill{ID: len(s.backfills) + 1, Request: req, Status: "queued", Created: time.Now().UTC()}
+		select {
+		case s.queue <- b:
+			s.backfills = append(s.backfills, b)
+		default:
+			s.mu.Unlock()
+			http.Error(w, "too many queued backfills", http.StatusServiceUnavailable)
+			return
+		}
+		started := *b
+		s.mu.Unlock()
+		log.Printf("backfill: queued backfill %d of %+v", b.ID, req)
+		writeJSON(w, http.StatusAccepted, started)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) serveBackfill(w http.ResponseWriter, r *http.Request) {
+	if !s.authorized(w, r) {
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	id, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/backfills/"))
+	s.mu.Lock()
+	if err != nil || id < 1 || id > len(s.backfills) {
+		s.mu.Unlock()
+		http.NotFound(w, r)
+		return
+	}
+	b := *s.backfills[id-1]
+	b.Log = append([]string(nil), b.Log...)
+	s.mu.Unlock()
+	writeJSON(w, http.StatusOK, b)
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,84 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package backfill
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"golang.org/x/build/maintner"
+)
+
+func do(t *testing.T, h http.Handler, method, path, token, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w
+}
+
+func TestServer(t *testing.T) {
+	// The corpus isn't in leader mode, so backfills fail, but
+	// they're still run and recorded.
+	s := NewServer(new(maintner.Corpus), "secret")
+	mux := http.NewServeMux()
+	s.RegisterHandlers(mux)
+
+	const valid = `{"repo": "github.com/golang/go", "since": "2023-09-02T00:00:00Z", "until": "2023-09-03T00:00:00Z", "dry_run": true}`
+	for _, tt := range []struct {
+		method, path, token, body string
+		wantCode                  int
+	}{
+		{"GET", "/backfills", "", "", http.StatusUnauthorized},
+		{"POST", "/backfills", "wrong", valid, http.StatusUnauthorized},
+		{"GET", "/backfills/1", "", "", http.StatusUnauthorized},
+		{"POST", "/backfills", "secret", `{"repo": "github.com/golang/go"}`, http.StatusBadRequest},
+		{"POST", "/backfills", "secret", `{"repo": "github.com/golang/go", "since": "2023-09-03T00:00:00Z", "until": "2023-09-02T00:00:00Z"}`, http.StatusBadRequest},
+		{"DELETE", "/backfills", "secret", "", http.StatusMethodNotAllowed},
+		{"GET", "/backfills/1", "secret", "", http.StatusNotFound},
+	} {
+		if w := do(t, mux, tt.method, tt.path, tt.token, tt.body); w.Code != tt.wantCode {
+			t.Errorf("%s %s with token %q = %d %q; want %d", tt.method, tt.path, tt.token, w.Code, w.Body, tt.wantCode)
+		}
+	}
+
+	w := do(t, mux, "POST", "/backfills", "secret", valid)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("POST /backfills = %d %q; want %d", w.Code, w.Body, http.StatusAccepted)
+	}
+	var queued Backfill
+	if err := json.Unmarshal(w.Body.Bytes(), &queued); err != nil {
+		t.Fatal(err)
+	}
+	if queued.ID != 1 || queued.Status != "queued" || !queued.Request.DryRun || queued.Request.Repo != "github.com/golang/go" {
+		t.Errorf("queued backfill = %+v", queued)
+	}
+
+	s.run(context.Background(), <-s.queue)
+	var got Backfill
+	w = do(t, mux, "GET", "/backfills/1", "secret", "")
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != "failed" || !strings.Contains(got.Error, "non-leader mode") {
+		t.Errorf("backfill in a non-leader corpus = %+v; want failed", got)
+	}
+
+	var list []Backfill
+	w = do(t, mux, "GET", "/backfills", "secret", "")
+	if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || list[0].ID != 1 || list[0].Status != "failed" {
+		t.Errorf("GET /backfills = %+v; want the failed backfill", list)
+	}
+}
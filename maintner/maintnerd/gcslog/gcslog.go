@@ -24,9 +24,9 @@ import (
 	"time"
 
 	"cloud.google.com/go/storage"
-	"github.com/golang/protobuf/proto"
 	"golang.org/x/build/maintner"
 	"golang.org/x/build/maintner/maintpb"
+	"golang.org/x/build/maintner/mutenc"
 	"golang.org/x/build/maintner/reclog"
 	"google.golang.org/api/iterator"
 )
@@ -50,6 +50,7 @@ type GCSLog struct {
 	bucket        *storage.BucketHandle
 	segmentPrefix string
 	debug         bool
+	format        mutenc.Format
 
 	mu         sync.Mutex // guards the following
 	cond       *sync.Cond
@@ -79,7 +80,8 @@ func (s gcsLogSegment) String() string {
 // with Google Cloud Storage.
 func newGCSLogBase() *GCSLog {
 	gl := &GCSLog{
-		seg: map[int]gcsLogSegment{},
+		seg:    map[int]gcsLogSegment{},
+		format: mutenc.V1,
 	}
 	gl.cond = sync.NewCond(&gl.mu)
 	return gl
@@ -219,6 +221,80 @@ func (gl *GCSLog) serveLogFile(w http.ResponseWriter, r *http.Request) {
 	http.ServeContent(w, r, "", time.Time{}, strings.NewReader(content))
 }
 
+// serveFilteredLogFile serves the records of a log segment whose
+// mutations are selected by the maintner.LoadFilter in the query
+// parameters, for clients that only load part of the corpus. The path is
+// /logs/filtered/<segment number>, and the start and end parameters are
+// the byte range of the segment to filter, which must be that of whole
+// records. See maintner.NewFilteredNetworkMutationSource.
+func (gl *GCSLog) serveFilteredLogFile(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		http.Error(w, "bad method", http.StatusBadRequest)
+		return
+	}
+
+	num, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/logs/filtered/"))
+	if err != nil {
+		http.Error(w, "bad path", http.StatusBadRequest)
+		return
+	}
+	filter, err := maintner.ParseLoadFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	start, err := strconv.ParseInt(r.FormValue("start"), 10, 64)
+	if err != nil || start < 0 {
+		http.Error(w, "bad start", http.StatusBadRequest)
+		return
+	}
+	end, err := strconv.ParseInt(r.FormValue("end"), 10, 64)
+	if err != nil || end < start {
+		http.Error(w, "bad end", http.StatusBadRequest)
+		return
+	}
+
+	var src io.Reader
+	gl.mu.Lock()
+	if num > gl.curNum || num < 0 {
+		gl.mu.Unlock()
+		http.Error(w, "bad segment number", http.StatusBadRequest)
+		return
+	}
+	if num == gl.curNum {
+		if end > int64(gl.logBuf.Len()) {
+			gl.mu.Unlock()
+			http.Error(w, "bad end", http.StatusBadRequest)
+			return
+		}
+		src = strings.NewReader(gl.logBuf.String()[start:end])
+		gl.mu.Unlock()
+	} else {
+		seg := gl.seg[num]
+		gl.mu.Unlock()
+		if end > seg.size {
+			http.Error(w, "bad end", http.StatusBadRequest)
+			return
+		}
+		rd, err := gl.bucket.Object(gl.objectPath(seg)).NewRangeReader(r.Context(), start, end-start)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer rd.Close()
+		src = rd
+	}
+
+	var buf bytes.Buffer
+	if err := filter.WriteFilteredLog(&buf, src, start); err != nil {
+		log.Printf("gcslog: filtering segment %d: %v", num, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Write(buf.Bytes())
+}
+
 func (gl *GCSLog) serveJSONLogsIndex(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "GET" && r.Method != "HEAD" {
 		http.Error(w, "bad method", http.StatusBadRequest)
@@ -370,9 +446,15 @@ func (w gcsLogWriter) Write(p []byte) (n int, err error) {
 // It must only be called before it's used.
 func (gl *GCSLog) SetDebug(v bool) { gl.debug = v }
 
+// SetFormat sets the format in which new mutations are written.
+// The default is mutenc.V1. Mutations in either format can be read.
+//
+// It must only be called before it's used.
+func (gl *GCSLog) SetFormat(f mutenc.Format) { gl.format = f }
+
 // Log writes m to GCS after the buffer is full or after a periodic flush.
 func (gl *GCSLog) Log(m *maintpb.Mutation) error {
-	data, err := proto.Marshal(m)
+	data, err := mutenc.Marshal(m, gl.format)
 	if err != nil {
 		return err
 	}
@@ -523,7 +605,7 @@ func (gl *GCSLog) GetMutations(ctx context.Context) <-chan maintner.MutationStre
 		err := gl.foreachSegmentReader(ctx, func(r io.Reader) error {
 			return reclog.ForeachRecord(r, 0, func(off int64, hdr, rec []byte) error {
 				m := new(maintpb.Mutation)
-				if err := proto.Unmarshal(rec, m); err != nil {
+				if err := mutenc.Unmarshal(rec, m); err != nil {
 					return err
 				}
 				select {
@@ -586,4 +668,5 @@ func (gl *GCSLog) CopyFrom(src maintner.MutationSource) error {
 func (gl *GCSLog) RegisterHandlers(mux *http.ServeMux) {
 	mux.HandleFunc("/logs", gl.serveJSONLogsIndex)
 	mux.HandleFunc("/logs/", gl.serveLogFile)
+	mux.HandleFunc("/logs/filtered/", gl.serveFilteredLogFile)
 }
@@ -6,9 +6,13 @@ package gcslog
 
 import (
 	"context"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 
+	"github.com/golang/protobuf/ptypes"
+	"golang.org/x/build/maintner"
 	"golang.org/x/build/maintner/maintpb"
 )
 
@@ -42,3 +46,91 @@ func testGCSLogWakeup(t *testing.T, activity bool) {
 		t.Errorf("timeout")
 	}
 }
+
+func TestServeFilteredLogFile(t *testing.T) {
+	gl := newGCSLogBase()
+	t.Cleanup(func() {
+		gl.mu.Lock()
+		defer gl.mu.Unlock()
+		if gl.flushTimer != nil {
+			gl.flushTimer.Stop()
+		}
+	})
+	created, err := ptypes.TimestampProto(time.Date(2023, 4, 1, 12, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	logIssue := func(repo string, num int32) {
+		t.Helper()
+		err := gl.Log(&maintpb.Mutation{GithubIssue: &maintpb.GithubIssueMutation{Owner: "golang", Repo: repo, Number: num, Created: created}})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	logIssue("go", 1)
+	logIssue("build", 1)
+	logIssue("go", 2)
+	if err := gl.Log(&maintpb.Mutation{Gerrit: &maintpb.GerritMutation{Project: "go.googlesource.com/build"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	mux := http.NewServeMux()
+	gl.RegisterHandlers(mux)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	filter := maintner.LoadFilter{
+		GitHubRepos: []maintner.GitHubRepoID{{Owner: "golang", Repo: "go"}},
+		Lazy:        true,
+	}
+	c := new(maintner.Corpus)
+	c.SetLoadFilter(filter)
+	ctx := context.Background()
+	if err := c.Initialize(ctx, maintner.NewFilteredNetworkMutationSource(srv.URL+"/logs", t.TempDir(), filter)); err != nil {
+		t.Fatal(err)
+	}
+	issues := func(repo string) (nums []int32) {
+		c.GitHub().Repo("golang", repo).ForeachIssue(func(i *maintner.GitHubIssue) error {
+			nums = append(nums, i.Number)
+			return nil
+		})
+		return nums
+	}
+	if got := issues("go"); len(got) != 2 {
+		t.Errorf("golang/go issues = %v; want 1 and 2", got)
+	}
+
+	// Later mutations are filtered too.
+	logIssue("go", 3)
+	logIssue("tools", 1)
+	if err := c.Update(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := issues("go"); len(got) != 3 {
+		t.Errorf("golang/go issues after update = %v; want 1 to 3", got)
+	}
+
+	// Lazily loaded repos are downloaded when they're looked up.
+	if got := issues("tools"); len(got) != 1 {
+		t.Errorf("lazily loaded golang/tools issues = %v; want 1", got)
+	}
+	if c.Gerrit().Project("go.googlesource.com", "build") == nil {
+		t.Errorf("Gerrit project build not lazily loaded")
+	}
+
+	for _, path := range []string{
+		"/logs/filtered/0?start=0&end=100000",
+		"/logs/filtered/1?start=0&end=0",
+		"/logs/filtered/0?start=0&end=10&github=golang",
+		"/logs/filtered/x?start=0&end=0",
+	} {
+		res, err := http.Get(srv.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.StatusCode != http.StatusBadRequest {
+			t.Errorf("GET %s: %v; want %v", path, res.Status, http.StatusBadRequest)
+		}
+	}
+}
@@ -0,0 +1,378 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package graphql
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// maxNodes is the maximum number of objects a query may return, to
+// bound the work done for deeply nested connections.
+const maxNodes = 20000
+
+// An object is a value with fields that can be selected.
+type object interface {
+	// typeName returns the name of the object's type in Schema.
+	typeName() string
+	// field returns the value of the named field. It returns
+	// errNoField if there is no such field. The value is nil, a
+	// scalar (bool, int, int32, int64, string, or time.Time), an
+	// object, or a []object or []string.
+	field(e *executor, name string, args *args) (any, error)
+}
+
+var errNoField = errors.New("no such field")
+
+// args holds the arguments of a field, with variables substituted.
+type args struct {
+	vals map[string]any
+	used map[string]bool
+}
+
+// get returns the named argument, or nil if it's missing or null.
+func (a *args) get(name string) any {
+	a.used[name] = true
+	return a.vals[name]
+}
+
+// int returns the named Int argument, or def if it's missing or null.
+func (a *args) int(name string, def int) (int, error) {
+	switch v := a.get(name).(type) {
+	case nil:
+		return def, nil
+	case int64:
+		if v >= math.MinInt32 && v <= math.MaxInt32 {
+			return int(v), nil
+		}
+	case float64: // from JSON variables
+		if v == math.Trunc(v) && v >= math.MinInt32 && v <= math.MaxInt32 {
+			return int(v), nil
+		}
+	}
+	return 0, fmt.Errorf("argument %q must be an Int", name)
+}
+
+// requiredInt returns the named Int argument, which must be present.
+func (a *args) requiredInt(name string) (int, error) {
+	if a.vals[name] == nil {
+		return 0, fmt.Errorf("argument %q is required", name)
+	}
+	return a.int(name, 0)
+}
+
+// string returns the named String or enum argument, or def if it's
+// missing or null.
+func (a *args) string(name, def string) (string, error) {
+	switch v := a.get(name).(type) {
+	case nil:
+		return def, nil
+	case string:
+		return v, nil
+	case enumValue:
+		return string(v), nil
+	}
+	return "", fmt.Errorf("argument %q must be a String", name)
+}
+
+// requiredString returns the named String argument, which must be
+// present.
+func (a *args) requiredString(name string) (string, error) {
+	if a.vals[name] == nil {
+		return "", fmt.Errorf("argument %q is required", name)
+	}
+	return a.string(name, "")
+}
+
+// bool returns the named Boolean argument as a *bool, which is nil if
+// the argument is missing or null.
+func (a *args) bool(name string) (*bool, error) {
+	switch v := a.get(name).(type) {
+	case nil:
+		return nil, nil
+	case bool:
+		return &v, nil
+	}
+	return nil, fmt.Errorf("argument %q must be a Boolean", name)
+}
+
+// An Error is an error reported in a response.
+type Error struct {
+	Message   string     `json:"message"`
+	Locations []position `json:"locations,omitempty"`
+	Path      []any      `json:"path,omitempty"`
+}
+
+// A response is the result of executing a query.
+type response struct {
+	Data   *orderedMap `json:"data,omitempty"`
+	Errors []Error     `json:"errors,omitempty"`
+}
+
+// An orderedMap is a JSON object whose keys are in the order they
+// were selected.
+type orderedMap struct {
+	keys []string
+	vals map[string]any
+}
+
+func (m *orderedMap) set(k string, v any) {
+	if m.vals == nil {
+		m.vals = map[string]any{}
+	}
+	if _, ok := m.vals[k]; !ok {
+		m.keys = append(m.keys, k)
+	}
+	m.vals[k] = v
+}
+
+func (m *orderedMap) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, k := range m.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		kb, err := json.Marshal(k)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(kb)
+		buf.WriteByte(':')
+		vb, err := json.Marshal(m.vals[k])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(vb)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// An executor executes one operation of a document.
+type executor struct {
+	root   object
+	doc    *document
+	vars   map[string]any
+	errors []Error
+	nodes  int // objects completed so far
+
+	// cache holds values computed once per query by resolvers,
+	// such as indexes of the corpus.
+	cache map[string]any
+}
+
+// execute runs the named operation in doc against root. The name may
+// be empty if doc has a single operation.
+func execute(root object, doc *document, opName string, vars map[string]any) *response {
+	var op *operation
+	for _, o := range doc.operations {
+		if o.name == opName || opName == "" && len(doc.operations) == 1 {
+			op = o
+			break
+		}
+	}
+	if op == nil {
+		msg := "operationName is required with multiple operations"
+		if opName != "" {
+			msg = fmt.Sprintf("no operation named %q", opName)
+		}
+		return &response{Errors: []Error{{Message: msg}}}
+	}
+
+	e := &executor{root: root, doc: doc, vars: map[string]any{}, cache: map[string]any{}}
+	for _, v := range op.vars {
+		val, ok := vars[v.name]
+		if !ok {
+			val = v.defValue
+		}
+		if val == nil && v.nonNull {
+			return &response{Errors: []Error{{Message: fmt.Sprintf("variable $%s is required", v.name)}}}
+		}
+		e.vars[v.name] = val
+	}
+	data := e.selectFields(root, op.sel, nil)
+	return &response{Data: data, Errors: e.errors}
+}
+
+// selectFields returns the fields in sel of obj.
+func (e *executor) selectFields(obj object, sel []selection, path []any) *orderedMap {
+	e.nodes++
+	if e.nodes == maxNodes+1 {
+		e.errors = append(e.errors, Error{Message: fmt.Sprintf("query returns more than %d objects", maxNodes), Path: path})
+	}
+	if e.nodes > maxNodes {
+		return nil
+	}
+	m := new(orderedMap)
+	keys, fields := e.collectFields(obj.typeName(), sel, nil, map[string]bool{})
+	for _, k := range keys {
+		fs := fields[k]
+		fpath := append(path[:len(path):len(path)], k)
+		v, err := e.resolve(obj, fs, fpath)
+		if err != nil {
+			var locs []position
+			for _, f := range fs {
+				locs = append(locs, f.pos)
+			}
+			e.errors = append(e.errors, Error{Message: err.Error(), Locations: locs, Path: fpath})
+			v = nil
+		}
+		m.set(k, v)
+	}
+	return m
+}
+
+// collectFields groups the fields selected by sel on an object of the
+// named type by response key, following fragments. It returns the keys
+// in order of first selection.
+func (e *executor) collectFields(typeName string, sel []selection, fields map[string][]*field, visited map[string]bool) ([]string, map[string][]*field) {
+	if fields == nil {
+		fields = map[string][]*field{}
+	}
+	var keys []string
+	add := func(ks []string) {
+		keys = append(keys, ks...)
+	}
+	for _, s := range sel {
+		switch {
+		case s.field != nil:
+			k := s.field.responseKey()
+			if fields[k] == nil {
+				keys = append(keys, k)
+			}
+			fields[k] = append(fields[k], s.field)
+		case s.inline != nil:
+			if s.inline.typeCond == "" || s.inline.typeCond == typeName {
+				ks, _ := e.collectFields(typeName, s.inline.sel, fields, visited)
+				add(ks)
+			}
+		default:
+			frag := e.doc.fragments[s.spread]
+			if frag == nil || visited[s.spread] || frag.typeCond != typeName {
+				continue
+			}
+			visited[s.spread] = true
+			ks, _ := e.collectFields(typeName, frag.sel, fields, visited)
+			add(ks)
+		}
+	}
+	return keys, fields
+}
+
+// resolve returns the value of the fields fs, which all have the same
+// response key, of obj.
+func (e *executor) resolve(obj object, fs []*field, path []any) (any, error) {
+	f := fs[0]
+	for _, g := range fs[1:] {
+		if g.name != f.name || !sameArgs(f.args, g.args) {
+			return nil, fmt.Errorf("fields with response key %q conflict", f.responseKey())
+		}
+	}
+	if f.name == "__typename" {
+		return obj.typeName(), nil
+	}
+	a := &args{vals: map[string]any{}, used: map[string]bool{}}
+	for _, arg := range f.args {
+		v, err := e.substitute(arg.val)
+		if err != nil {
+			return nil, err
+		}
+		a.vals[arg.name] = v
+	}
+	v, err := obj.field(e, f.name, a)
+	if err == errNoField {
+		return nil, fmt.Errorf("no field %q on type %s", f.name, obj.typeName())
+	}
+	if err != nil {
+		return nil, err
+	}
+	for name := range a.vals {
+		if !a.used[name] {
+			return nil, fmt.Errorf("unknown argument %q on field %s.%s", name, obj.typeName(), f.name)
+		}
+	}
+
+	var sel []selection
+	for _, g := range fs {
+		sel = append(sel, g.sel...)
+	}
+	return e.complete(v, f, sel, path)
+}
+
+// complete converts v, the value of field f, to its JSON form.
+func (e *executor) complete(v any, f *field, sel []selection, path []any) (any, error) {
+	switch v := v.(type) {
+	case nil:
+		return nil, nil
+	case object:
+		if sel == nil {
+			return nil, fmt.Errorf("field %q of type %s must have a selection of subfields", f.name, v.typeName())
+		}
+		return e.selectFields(v, sel, path), nil
+	case []object:
+		list := make([]any, len(v))
+		for i, o := range v {
+			if sel == nil {
+				return nil, fmt.Errorf("field %q of type [%s] must have a selection of subfields", f.name, o.typeName())
+			}
+			list[i] = e.selectFields(o, sel, append(path[:len(path):len(path)], i))
+		}
+		return list, nil
+	}
+	if sel != nil {
+		return nil, fmt.Errorf("field %q is a scalar and can't have a selection of subfields", f.name)
+	}
+	switch v := v.(type) {
+	case time.Time:
+		if v.IsZero() {
+			return nil, nil
+		}
+		return v.UTC().Format(time.RFC3339), nil
+	case []string:
+		if v == nil {
+			return []string{}, nil
+		}
+	}
+	return v, nil
+}
+
+// substitute replaces variables in the argument value v.
+func (e *executor) substitute(v any) (any, error) {
+	switch v := v.(type) {
+	case variable:
+		val, ok := e.vars[string(v)]
+		if !ok {
+			return nil, fmt.Errorf("undefined variable $%s", v)
+		}
+		return val, nil
+	case []any:
+		list := make([]any, len(v))
+		for i, x := range v {
+			var err error
+			if list[i], err = e.substitute(x); err != nil {
+				return nil, err
+			}
+		}
+		return list, nil
+	}
+	return v, nil
+}
+
+func sameArgs(a, b []argument) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].name != b[i].name || fmt.Sprint(a[i].val) != fmt.Sprint(b[i].val) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,105 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package graphql serves a read-only GraphQL API for a maintner corpus.
+//
+// The API exposes GitHub issues and their comments, Gerrit CLs and their
+// messages, and the references between them, so that a client can fetch
+// exactly the data it needs in one request. Schema describes the types
+// and fields that can be queried. Lists that can be long are paginated
+// with cursor connections: a field such as issues(first: 10, after: $c)
+// returns a page of up to 10 nodes after the one with cursor $c, along
+// with the pageInfo needed to fetch the next page.
+//
+// Only queries are supported: not mutations, subscriptions, directives,
+// or introspection.
+package graphql
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"golang.org/x/build/maintner"
+)
+
+// maxQueryBytes is the maximum size of a request's body.
+const maxQueryBytes = 1 << 20
+
+// NewHandler returns an HTTP handler that serves GraphQL queries over
+// corpus.
+//
+// Queries may be sent as GET requests with query, variables, and
+// operationName parameters, or as POST requests with a JSON object
+// with the same fields in the body. A GET request without a query
+// returns Schema.
+func NewHandler(corpus *maintner.Corpus) http.Handler {
+	return handler{c: corpus}
+}
+
+type handler struct {
+	c *maintner.Corpus
+}
+
+// A request is a GraphQL request.
+type request struct {
+	Query         string         `json:"query"`
+	Variables     map[string]any `json:"variables"`
+	OperationName string         `json:"operationName"`
+}
+
+func (h handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req request
+	switch r.Method {
+	case "GET":
+		req.Query = r.FormValue("query")
+		req.OperationName = r.FormValue("operationName")
+		if req.Query == "" {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			io.WriteString(w, Schema)
+			return
+		}
+		if v := r.FormValue("variables"); v != "" {
+			if err := json.Unmarshal([]byte(v), &req.Variables); err != nil {
+				writeErrors(w, http.StatusBadRequest, "invalid variables: "+err.Error())
+				return
+			}
+		}
+	case "POST":
+		if err := json.NewDecoder(io.LimitReader(r.Body, maxQueryBytes)).Decode(&req); err != nil {
+			writeErrors(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+			return
+		}
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		writeErrors(w, http.StatusMethodNotAllowed, "GET or POST required")
+		return
+	}
+
+	doc, err := parse(req.Query)
+	if err != nil {
+		writeErrors(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	h.c.RLock()
+	res := execute(query{h.c}, doc, req.OperationName, req.Variables)
+	h.c.RUnlock()
+	writeResponse(w, http.StatusOK, res)
+}
+
+// writeErrors writes a response with no data and an error with msg.
+func writeErrors(w http.ResponseWriter, code int, msg string) {
+	writeResponse(w, code, &response{Errors: []Error{{Message: msg}}})
+}
+
+func writeResponse(w http.ResponseWriter, code int, res *response) {
+	body, err := json.Marshal(res)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(body)
+}
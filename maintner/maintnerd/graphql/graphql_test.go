@@ -0,0 +1,306 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	google_protobuf "github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/google/go-cmp/cmp"
+	"golang.org/x/build/maintner"
+	"golang.org/x/build/maintner/maintpb"
+)
+
+// mutationSource is a maintner.MutationSource of a fixed set of
+// mutations.
+type mutationSource []*maintpb.Mutation
+
+func (s mutationSource) GetMutations(ctx context.Context) <-chan maintner.MutationStreamEvent {
+	ch := make(chan maintner.MutationStreamEvent, len(s)+1)
+	for _, m := range s {
+		ch <- maintner.MutationStreamEvent{Mutation: m}
+	}
+	ch <- maintner.MutationStreamEvent{End: true}
+	return ch
+}
+
+// parityEnricher annotates issues with the parity of their numbers.
+type parityEnricher struct{}
+
+func (parityEnricher) Namespace() string { return "parity" }
+
+func (parityEnricher) EnrichIssue(r *maintner.GitHubRepo, gi *maintner.GitHubIssue) []maintner.Annotation {
+	if gi.Number%2 == 0 {
+		return []maintner.Annotation{{Key: "parity", Value: "even"}}
+	}
+	return []maintner.Annotation{{Key: "parity", Value: "odd"}}
+}
+
+func (parityEnricher) EnrichCL(cl *maintner.GerritCL) []maintner.Annotation { return nil }
+
+// testCorpus returns a corpus with issues 1 through 5 in golang/go.
+// The even-numbered issues are closed, and issue 3 has a label and
+// three comments, the last of which mentions CL 100. The issues are
+// annotated by parityEnricher.
+func testCorpus(t *testing.T) *maintner.Corpus {
+	t.Helper()
+	timestamp := func(day int) *google_protobuf.Timestamp {
+		tp, err := ptypes.TimestampProto(time.Date(2023, 4, day, 12, 0, 0, 0, time.UTC))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tp
+	}
+	gopher := &maintpb.GithubUser{Id: 1, Login: "gopher"}
+	var muts mutationSource
+	for n := int32(1); n <= 5; n++ {
+		m := &maintpb.GithubIssueMutation{
+			Owner:   "golang",
+			Repo:    "go",
+			Number:  n,
+			Id:      int64(1000 + n),
+			User:    gopher,
+			Title:   fmt.Sprintf("issue %d", n),
+			Created: timestamp(int(n)),
+			Updated: timestamp(int(n)),
+		}
+		if n%2 == 0 {
+			m.Closed = &maintpb.BoolChange{Val: true}
+		}
+		if n == 3 {
+			m.AddLabel = []*maintpb.GithubLabel{{Id: 10, Name: "NeedsFix"}}
+			m.Comment = []*maintpb.GithubIssueCommentMutation{
+				{Id: 301, User: gopher, Body: "first", Created: timestamp(10)},
+				{Id: 302, User: &maintpb.GithubUser{Id: 2, Login: "gopher2"}, Body: "second", Created: timestamp(11)},
+				{Id: 303, User: gopher, Body: "third, see go.dev/cl/100", Created: timestamp(12)},
+			}
+		}
+		muts = append(muts, &maintpb.Mutation{GithubIssue: m})
+	}
+	c := new(maintner.Corpus)
+	c.AddEnricher(parityEnricher{})
+	if err := c.Initialize(context.Background(), muts); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// run executes query with the JSON-encoded variables and returns the
+// JSON-decoded response.
+func run(t *testing.T, c *maintner.Corpus, query, variables string) any {
+	t.Helper()
+	body, err := json.Marshal(map[string]any{"query": query, "variables": json.RawMessage(variables)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	NewHandler(c).ServeHTTP(rec, httptest.NewRequest("POST", "/graphql", strings.NewReader(string(body))))
+	var res any
+	if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+		t.Fatalf("decoding response %s: %v", rec.Body, err)
+	}
+	return res
+}
+
+// decode decodes the JSON s.
+func decode(t *testing.T, s string) any {
+	t.Helper()
+	var v any
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		t.Fatalf("decoding %s: %v", s, err)
+	}
+	return v
+}
+
+func TestQuery(t *testing.T) {
+	c := testCorpus(t)
+	for _, tc := range []struct {
+		name, query, variables, want string
+	}{
+		{
+			name: "issue",
+			query: `query($n: Int!) {
+				githubRepo(owner: "golang", name: "go") {
+					issue(number: $n) { __typename number title state url labels { name } author { login } createdAt }
+					missing: issue(number: 100) { number }
+				}
+			}`,
+			variables: `{"n": 3}`,
+			want: `{"data": {"githubRepo": {
+				"issue": {"__typename": "Issue", "number": 3, "title": "issue 3", "state": "OPEN",
+					"url": "https://github.com/golang/go/issues/3", "labels": [{"name": "NeedsFix"}],
+					"author": {"login": "gopher"}, "createdAt": "2023-04-03T12:00:00Z"},
+				"missing": null
+			}}}`,
+		},
+		{
+			name: "fragments",
+			query: `{
+				githubRepo(owner: "golang", name: "go") {
+					open: issues(state: OPEN) { nodes { ...IssueFields } }
+					closed: issues(state: CLOSED) { totalCount nodes { ... on Issue { number } } }
+				}
+			}
+			fragment IssueFields on Issue { number state }`,
+			want: `{"data": {"githubRepo": {
+				"open": {"nodes": [{"number": 5, "state": "OPEN"}, {"number": 3, "state": "OPEN"}, {"number": 1, "state": "OPEN"}]},
+				"closed": {"totalCount": 2, "nodes": [{"number": 4}, {"number": 2}]}
+			}}}`,
+		},
+		{
+			name:  "label filter",
+			query: `{ githubRepo(owner: "golang", name: "go") { issues(label: "NeedsFix") { nodes { number } } } }`,
+			want:  `{"data": {"githubRepo": {"issues": {"nodes": [{"number": 3}]}}}}`,
+		},
+		{
+			name:      "pagination",
+			query:     `query($after: String) { githubRepo(owner: "golang", name: "go") { issues(first: 2, after: $after) { edges { node { number } } pageInfo { hasNextPage endCursor } } } }`,
+			variables: fmt.Sprintf(`{"after": %q}`, encodeCursor(4)),
+			want: fmt.Sprintf(`{"data": {"githubRepo": {"issues": {
+				"edges": [{"node": {"number": 3}}, {"node": {"number": 2}}],
+				"pageInfo": {"hasNextPage": true, "endCursor": %q}
+			}}}}`, encodeCursor(2)),
+		},
+		{
+			name:  "comments",
+			query: `{ githubRepo(owner: "golang", name: "go") { issue(number: 3) { comments(first: 2) { totalCount nodes { body author { login } } pageInfo { hasNextPage } } } } }`,
+			want: `{"data": {"githubRepo": {"issue": {"comments": {
+				"totalCount": 3,
+				"nodes": [{"body": "first", "author": {"login": "gopher"}}, {"body": "second", "author": {"login": "gopher2"}}],
+				"pageInfo": {"hasNextPage": true}
+			}}}}}`,
+		},
+		{
+			name: "xrefs",
+			query: `{ githubRepo(owner: "golang", name: "go") { issue(number: 3) {
+				references { kind from { ref issue { number } } to { ref cl { number } commit } }
+				referencedBy { kind }
+			} } }`,
+			want: `{"data": {"githubRepo": {"issue": {
+				"references": [{"kind": "MENTIONS",
+					"from": {"ref": "golang/go#3", "issue": {"number": 3}},
+					"to": {"ref": "go.googlesource.com/cl/100", "cl": null, "commit": null}}],
+				"referencedBy": []
+			}}}}`,
+		},
+		{
+			name: "annotations",
+			query: `{
+				annotationNamespaces
+				annotated(namespace: "parity", key: "parity", value: "even") { ref issue { number } }
+				githubRepo(owner: "golang", name: "go") {
+					issue(number: 3) {
+						annotations { namespace key value }
+						none: annotations(namespace: "cve") { value }
+					}
+				}
+			}`,
+			want: `{"data": {
+				"annotationNamespaces": ["parity"],
+				"annotated": [{"ref": "golang/go#2", "issue": {"number": 2}}, {"ref": "golang/go#4", "issue": {"number": 4}}],
+				"githubRepo": {"issue": {
+					"annotations": [{"namespace": "parity", "key": "parity", "value": "odd"}],
+					"none": []
+				}}
+			}}`,
+		},
+		{
+			name:  "field errors",
+			query: `{ githubRepos { name bogus issue(number: 1, bogus: 2) { number } } }`,
+			want: `{"data": {"githubRepos": [{"name": "go", "bogus": null, "issue": null}]},
+				"errors": [
+					{"message": "no field \"bogus\" on type GitHubRepo", "locations": [{"line": 1, "column": 22}], "path": ["githubRepos", 0, "bogus"]},
+					{"message": "unknown argument \"bogus\" on field GitHubRepo.issue", "locations": [{"line": 1, "column": 28}], "path": ["githubRepos", 0, "issue"]}
+				]}`,
+		},
+		{
+			name:  "missing selection",
+			query: `{ githubRepo(owner: "golang", name: "go") }`,
+			want: `{"data": {"githubRepo": null},
+				"errors": [{"message": "field \"githubRepo\" of type GitHubRepo must have a selection of subfields", "locations": [{"line": 1, "column": 3}], "path": ["githubRepo"]}]}`,
+		},
+		{
+			name:  "bad cursor",
+			query: `{ githubRepo(owner: "golang", name: "go") { issues(after: "!") { totalCount } } }`,
+			want: `{"data": {"githubRepo": {"issues": null}},
+				"errors": [{"message": "invalid cursor \"!\"", "locations": [{"line": 1, "column": 45}], "path": ["githubRepo", "issues"]}]}`,
+		},
+		{
+			name:  "syntax error",
+			query: `{ githubRepos { name }`,
+			want:  `{"errors": [{"message": "syntax error at 1:23: unexpected end of query"}]}`,
+		},
+		{
+			name:      "missing variable",
+			query:     `query($n: Int!) { githubRepos { issue(number: $n) { number } } }`,
+			variables: `{}`,
+			want:      `{"errors": [{"message": "variable $n is required"}]}`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			variables := tc.variables
+			if variables == "" {
+				variables = "null"
+			}
+			got := run(t, c, tc.query, variables)
+			if diff := cmp.Diff(decode(t, tc.want), got); diff != "" {
+				t.Errorf("response mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, tc := range []struct {
+		query, want string
+	}{
+		{``, "syntax error at 1:1: no operations"},
+		{`mutation { x }`, "syntax error at 1:1: mutations are not supported"},
+		{`{ x @include(if: true) }`, "syntax error at 1:5: directives are not supported"},
+		{`{ x(a: {b: 1}) }`, "syntax error at 1:8: input objects are not supported"},
+		{"{ x(a: \"unterminated) }", "syntax error at 1:8: unterminated string"},
+		{`{ ...F }`, `undefined fragment "F"`},
+		{`{ x }` + "\n" + `fragment F on T { y } fragment F on T { z }`, `syntax error at 2:23: duplicate fragment "F"`},
+		{`{ x { } }`, "syntax error at 1:7: empty selection set"},
+		{`{ x } ?`, `syntax error at 1:7: unexpected character '?'`},
+	} {
+		_, err := parse(tc.query)
+		if err == nil || err.Error() != tc.want {
+			t.Errorf("parse(%q) = %v, want %s", tc.query, err, tc.want)
+		}
+	}
+}
+
+func TestHandler(t *testing.T) {
+	h := NewHandler(testCorpus(t))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/graphql", nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != Schema {
+		t.Errorf("GET without a query: got %d %q, want the schema", rec.Code, rec.Body)
+	}
+
+	q := url.Values{"query": {`query($n: Int) { githubRepo(owner: "golang", name: "go") { issue(number: $n) { title } } }`}, "variables": {`{"n": 2}`}}
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/graphql?"+q.Encode(), nil))
+	if want := `{"data":{"githubRepo":{"issue":{"title":"issue 2"}}}}`; rec.Code != http.StatusOK || rec.Body.String() != want {
+		t.Errorf("GET with a query: got %d %s, want 200 %s", rec.Code, rec.Body, want)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("POST", "/graphql", strings.NewReader("not json")))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("POST with an invalid body: got %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,610 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package graphql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// A document is a parsed GraphQL query document.
+type document struct {
+	operations []*operation
+	fragments  map[string]*fragment
+}
+
+// An operation is a query in a document.
+type operation struct {
+	name string
+	vars []*varDef
+	sel  []selection
+}
+
+// A varDef is a variable definition of an operation. Variable types
+// aren't checked, beyond the arguments' checks of their values.
+type varDef struct {
+	name     string
+	nonNull  bool
+	defValue any // nil if there is no default
+}
+
+// A fragment is a named fragment definition or an inline fragment.
+type fragment struct {
+	name     string // empty for inline fragments
+	typeCond string // empty if the inline fragment has no type condition
+	sel      []selection
+}
+
+// A selection is exactly one of a field, a fragment spread, or an
+// inline fragment.
+type selection struct {
+	field  *field
+	spread string
+	inline *fragment
+}
+
+// A field is a field selection, such as "alias: name(arg: 1) { ... }".
+type field struct {
+	alias, name string
+	args        []argument
+	sel         []selection
+	pos         position
+}
+
+// responseKey returns the key of f in the response.
+func (f *field) responseKey() string {
+	if f.alias != "" {
+		return f.alias
+	}
+	return f.name
+}
+
+type argument struct {
+	name string
+	val  any
+}
+
+// A variable is a reference to a variable as a value.
+type variable string
+
+// An enumValue is an enum value, such as OPEN.
+type enumValue string
+
+// A position is a location in the query, as reported in errors.
+type position struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokPunct
+	tokName
+	tokInt
+	tokFloat
+	tokString
+)
+
+type token struct {
+	kind tokenKind
+	text string // for tokString, the unquoted value
+	pos  position
+}
+
+// A syntaxError is an error in a query document.
+type syntaxError struct {
+	pos position
+	msg string
+}
+
+func (e *syntaxError) Error() string {
+	return fmt.Sprintf("syntax error at %d:%d: %s", e.pos.Line, e.pos.Column, e.msg)
+}
+
+// lex splits src into tokens, dropping whitespace, commas, and
+// comments. The last token is always a tokEOF.
+func lex(src string) ([]token, error) {
+	var toks []token
+	line, lineStart := 1, 0
+	for i := 0; i < len(src); {
+		pos := position{line, i - lineStart + 1}
+		c := src[i]
+		switch {
+		case c == '\n':
+			line, lineStart = line+1, i+1
+			i++
+		case c == ' ' || c == '\t' || c == '\r' || c == ',':
+			i++
+		case strings.HasPrefix(src[i:], "\ufeff"):
+			i += len("\ufeff")
+		case c == '#':
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+		case strings.HasPrefix(src[i:], "..."):
+			toks = append(toks, token{tokPunct, "...", pos})
+			i += 3
+		case strings.IndexByte("!$():=@[]{|}", c) >= 0:
+			toks = append(toks, token{tokPunct, src[i : i+1], pos})
+			i++
+		case c == '_' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z':
+			j := i + 1
+			for j < len(src) && isNameByte(src[j]) {
+				j++
+			}
+			toks = append(toks, token{tokName, src[i:j], pos})
+			i = j
+		case c == '-' || '0' <= c && c <= '9':
+			j := i + 1
+			kind := tokInt
+			for j < len(src) && ('0' <= src[j] && src[j] <= '9' || strings.IndexByte(".eE+-", src[j]) >= 0) {
+				if strings.IndexByte(".eE", src[j]) >= 0 {
+					kind = tokFloat
+				}
+				j++
+			}
+			toks = append(toks, token{kind, src[i:j], pos})
+			i = j
+		case strings.HasPrefix(src[i:], `"""`):
+			return nil, &syntaxError{pos, "block strings are not supported"}
+		case c == '"':
+			s, n, err := unquote(src[i:])
+			if err != nil {
+				return nil, &syntaxError{pos, err.Error()}
+			}
+			toks = append(toks, token{tokString, s, pos})
+			i += n
+		default:
+			r, _ := utf8.DecodeRuneInString(src[i:])
+			return nil, &syntaxError{pos, fmt.Sprintf("unexpected character %q", r)}
+		}
+	}
+	return append(toks, token{tokEOF, "", position{line, len(src) - lineStart + 1}}), nil
+}
+
+func isNameByte(c byte) bool {
+	return c == '_' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9'
+}
+
+// unquote unquotes the string at the beginning of s, which starts with
+// a double quote. It returns the string and the length of its quoted
+// form.
+func unquote(s string) (string, int, error) {
+	var b strings.Builder
+	for i := 1; i < len(s); {
+		switch c := s[i]; c {
+		case '"':
+			return b.String(), i + 1, nil
+		case '\n', '\r':
+			return "", 0, fmt.Errorf("unterminated string")
+		case '\\':
+			if i+1 >= len(s) {
+				return "", 0, fmt.Errorf("unterminated string")
+			}
+			esc := s[i+1]
+			i += 2
+			switch esc {
+			case '"', '\\', '/':
+				b.WriteByte(esc)
+			case 'b':
+				b.WriteByte('\b')
+			case 'f':
+				b.WriteByte('\f')
+			case 'n':
+				b.WriteByte('\n')
+			case 'r':
+				b.WriteByte('\r')
+			case 't':
+				b.WriteByte('\t')
+			case 'u':
+				if i+4 > len(s) {
+					return "", 0, fmt.Errorf("invalid unicode escape")
+				}
+				r, err := strconv.ParseUint(s[i:i+4], 16, 16)
+				if err != nil {
+					return "", 0, fmt.Errorf("invalid unicode escape \\u%s", s[i:i+4])
+				}
+				b.WriteRune(rune(r))
+				i += 4
+			default:
+				return "", 0, fmt.Errorf("invalid escape \\%c", esc)
+			}
+		default:
+			b.WriteByte(c)
+			i++
+		}
+	}
+	return "", 0, fmt.Errorf("unterminated string")
+}
+
+// parse parses a GraphQL query document.
+func parse(src string) (*document, error) {
+	toks, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{toks: toks}
+	doc := &document{fragments: map[string]*fragment{}}
+	for p.peek().kind != tokEOF {
+		switch t := p.peek(); {
+		case t.kind == tokPunct && t.text == "{":
+			sel, err := p.selectionSet()
+			if err != nil {
+				return nil, err
+			}
+			doc.operations = append(doc.operations, &operation{sel: sel})
+		case t.kind == tokName && t.text == "query":
+			op, err := p.operation()
+			if err != nil {
+				return nil, err
+			}
+			doc.operations = append(doc.operations, op)
+		case t.kind == tokName && t.text == "fragment":
+			f, err := p.fragmentDefinition()
+			if err != nil {
+				return nil, err
+			}
+			if doc.fragments[f.name] != nil {
+				return nil, &syntaxError{t.pos, fmt.Sprintf("duplicate fragment %q", f.name)}
+			}
+			doc.fragments[f.name] = f
+		case t.kind == tokName && (t.text == "mutation" || t.text == "subscription"):
+			return nil, &syntaxError{t.pos, t.text + "s are not supported"}
+		default:
+			return nil, p.unexpected()
+		}
+	}
+	if len(doc.operations) == 0 {
+		return nil, &syntaxError{p.peek().pos, "no operations"}
+	}
+	if name := doc.undefinedFragment(); name != "" {
+		return nil, fmt.Errorf("undefined fragment %q", name)
+	}
+	return doc, nil
+}
+
+// undefinedFragment returns the name of a fragment that is spread in
+// doc but not defined, or the empty string if there are none.
+func (doc *document) undefinedFragment() string {
+	var check func([]selection) string
+	check = func(sels []selection) string {
+		for _, s := range sels {
+			var name string
+			switch {
+			case s.field != nil:
+				name = check(s.field.sel)
+			case s.inline != nil:
+				name = check(s.inline.sel)
+			case doc.fragments[s.spread] == nil:
+				name = s.spread
+			}
+			if name != "" {
+				return name
+			}
+		}
+		return ""
+	}
+	for _, op := range doc.operations {
+		if name := check(op.sel); name != "" {
+			return name
+		}
+	}
+	for _, f := range doc.fragments {
+		if name := check(f.sel); name != "" {
+			return name
+		}
+	}
+	return ""
+}
+
+type parser struct {
+	toks []token
+	i    int
+}
+
+func (p *parser) peek() token { return p.toks[p.i] }
+
+func (p *parser) next() token {
+	t := p.toks[p.i]
+	if t.kind != tokEOF {
+		p.i++
+	}
+	return t
+}
+
+// isPunct reports whether the next token is the punctuator s.
+func (p *parser) isPunct(s string) bool {
+	t := p.peek()
+	return t.kind == tokPunct && t.text == s
+}
+
+// punct consumes the punctuator s.
+func (p *parser) punct(s string) error {
+	if !p.isPunct(s) {
+		return p.unexpected()
+	}
+	p.next()
+	return nil
+}
+
+func (p *parser) name() (string, error) {
+	if p.peek().kind != tokName {
+		return "", p.unexpected()
+	}
+	return p.next().text, nil
+}
+
+func (p *parser) unexpected() error {
+	t := p.peek()
+	if t.kind == tokEOF {
+		return &syntaxError{t.pos, "unexpected end of query"}
+	}
+	text := t.text
+	if t.kind == tokString {
+		text = strconv.Quote(text)
+	}
+	return &syntaxError{t.pos, fmt.Sprintf("unexpected %s", text)}
+}
+
+// operation parses "query Name($var: Type = default) { ... }".
+func (p *parser) operation() (*operation, error) {
+	p.next() // "query"
+	op := new(operation)
+	if p.peek().kind == tokName {
+		op.name = p.next().text
+	}
+	if p.isPunct("(") {
+		p.next()
+		for !p.isPunct(")") {
+			v, err := p.varDef()
+			if err != nil {
+				return nil, err
+			}
+			op.vars = append(op.vars, v)
+		}
+		p.next()
+	}
+	if err := p.noDirectives(); err != nil {
+		return nil, err
+	}
+	sel, err := p.selectionSet()
+	if err != nil {
+		return nil, err
+	}
+	op.sel = sel
+	return op, nil
+}
+
+func (p *parser) varDef() (*varDef, error) {
+	if err := p.punct("$"); err != nil {
+		return nil, err
+	}
+	name, err := p.name()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.punct(":"); err != nil {
+		return nil, err
+	}
+	nonNull, err := p.typeRef()
+	if err != nil {
+		return nil, err
+	}
+	v := &varDef{name: name, nonNull: nonNull}
+	if p.isPunct("=") {
+		p.next()
+		if v.defValue, err = p.value(true); err != nil {
+			return nil, err
+		}
+	}
+	return v, nil
+}
+
+// typeRef parses a type such as "[String!]!" and reports whether it's
+// non-null.
+func (p *parser) typeRef() (nonNull bool, err error) {
+	if p.isPunct("[") {
+		p.next()
+		if _, err := p.typeRef(); err != nil {
+			return false, err
+		}
+		if err := p.punct("]"); err != nil {
+			return false, err
+		}
+	} else if _, err := p.name(); err != nil {
+		return false, err
+	}
+	if p.isPunct("!") {
+		p.next()
+		return true, nil
+	}
+	return false, nil
+}
+
+func (p *parser) fragmentDefinition() (*fragment, error) {
+	p.next() // "fragment"
+	name, err := p.name()
+	if err != nil {
+		return nil, err
+	}
+	if name == "on" {
+		return nil, &syntaxError{p.toks[p.i-1].pos, `fragment can't be named "on"`}
+	}
+	if t := p.peek(); t.kind != tokName || t.text != "on" {
+		return nil, p.unexpected()
+	}
+	p.next()
+	typeCond, err := p.name()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.noDirectives(); err != nil {
+		return nil, err
+	}
+	sel, err := p.selectionSet()
+	if err != nil {
+		return nil, err
+	}
+	return &fragment{name: name, typeCond: typeCond, sel: sel}, nil
+}
+
+func (p *parser) selectionSet() ([]selection, error) {
+	if err := p.punct("{"); err != nil {
+		return nil, err
+	}
+	var sels []selection
+	for !p.isPunct("}") {
+		s, err := p.selection()
+		if err != nil {
+			return nil, err
+		}
+		sels = append(sels, s)
+	}
+	p.next()
+	if len(sels) == 0 {
+		return nil, &syntaxError{p.toks[p.i-1].pos, "empty selection set"}
+	}
+	return sels, nil
+}
+
+func (p *parser) selection() (selection, error) {
+	if p.isPunct("...") {
+		p.next()
+		if t := p.peek(); t.kind == tokName && t.text != "on" {
+			p.next()
+			return selection{spread: t.text}, p.noDirectives()
+		}
+		f := new(fragment)
+		if t := p.peek(); t.kind == tokName && t.text == "on" {
+			p.next()
+			var err error
+			if f.typeCond, err = p.name(); err != nil {
+				return selection{}, err
+			}
+		}
+		if err := p.noDirectives(); err != nil {
+			return selection{}, err
+		}
+		var err error
+		if f.sel, err = p.selectionSet(); err != nil {
+			return selection{}, err
+		}
+		return selection{inline: f}, nil
+	}
+
+	f := &field{pos: p.peek().pos}
+	name, err := p.name()
+	if err != nil {
+		return selection{}, err
+	}
+	f.name = name
+	if p.isPunct(":") {
+		p.next()
+		f.alias = name
+		if f.name, err = p.name(); err != nil {
+			return selection{}, err
+		}
+	}
+	if p.isPunct("(") {
+		p.next()
+		for !p.isPunct(")") {
+			name, err := p.name()
+			if err != nil {
+				return selection{}, err
+			}
+			if err := p.punct(":"); err != nil {
+				return selection{}, err
+			}
+			val, err := p.value(false)
+			if err != nil {
+				return selection{}, err
+			}
+			f.args = append(f.args, argument{name, val})
+		}
+		p.next()
+	}
+	if err := p.noDirectives(); err != nil {
+		return selection{}, err
+	}
+	if p.isPunct("{") {
+		if f.sel, err = p.selectionSet(); err != nil {
+			return selection{}, err
+		}
+	}
+	return selection{field: f}, nil
+}
+
+// value parses a value. Values of variable defaults must be constant.
+func (p *parser) value(constant bool) (any, error) {
+	if p.peek().kind == tokEOF {
+		return nil, p.unexpected()
+	}
+	t := p.next()
+	switch t.kind {
+	case tokInt:
+		n, err := strconv.ParseInt(t.text, 10, 64)
+		if err != nil {
+			return nil, &syntaxError{t.pos, fmt.Sprintf("invalid integer %s", t.text)}
+		}
+		return n, nil
+	case tokFloat:
+		f, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, &syntaxError{t.pos, fmt.Sprintf("invalid number %s", t.text)}
+		}
+		return f, nil
+	case tokString:
+		return t.text, nil
+	case tokName:
+		switch t.text {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "null":
+			return nil, nil
+		}
+		return enumValue(t.text), nil
+	case tokPunct:
+		switch t.text {
+		case "$":
+			if constant {
+				break
+			}
+			name, err := p.name()
+			if err != nil {
+				return nil, err
+			}
+			return variable(name), nil
+		case "[":
+			list := []any{}
+			for !p.isPunct("]") {
+				v, err := p.value(constant)
+				if err != nil {
+					return nil, err
+				}
+				list = append(list, v)
+			}
+			p.next()
+			return list, nil
+		case "{":
+			return nil, &syntaxError{t.pos, "input objects are not supported"}
+		}
+	}
+	p.i--
+	return nil, p.unexpected()
+}
+
+// noDirectives returns an error if the next token starts a directive.
+func (p *parser) noDirectives() error {
+	if t := p.peek(); t.kind == tokPunct && t.text == "@" {
+		return &syntaxError{t.pos, "directives are not supported"}
+	}
+	return nil
+}
@@ -0,0 +1,1001 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package graphql
+
+import (
+	"encoding/base64"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/build/maintner"
+)
+
+// Schema is the GraphQL schema served by NewHandler.
+const Schema = `# Times are RFC 3339 strings in UTC.
+scalar Time
+
+type Query {
+  githubRepos: [GitHubRepo!]!
+  githubRepo(owner: String!, name: String!): GitHubRepo
+  gerritProjects: [GerritProject!]!
+  gerritProject(server: String = "go.googlesource.com", project: String!): GerritProject
+  # CommitXRefs returns the cross-references from and to a Git commit,
+  # given its full hash.
+  commitXRefs(hash: String!): [XRef!]!
+  # AnnotationNamespaces are the namespaces of the annotations of
+  # issues and CLs, one per enricher that maintnerd runs.
+  annotationNamespaces: [String!]!
+  # Annotated returns the issues and CLs that have an annotation in
+  # namespace with the given key and, if set, value.
+  annotated(namespace: String!, key: String!, value: String): [XRefItem!]!
+}
+
+type GitHubRepo {
+  owner: String!
+  name: String!
+  issue(number: Int!): Issue
+  # Issues are ordered from the newest to the oldest.
+  issues(first: Int = 25, after: String, state: IssueState = ALL, pullRequest: Boolean, label: String): IssueConnection!
+  labels: [Label!]!
+  milestones: [Milestone!]!
+}
+
+enum IssueState { OPEN CLOSED ALL }
+
+type Issue {
+  id: Int!
+  number: Int!
+  url: String!
+  repo: GitHubRepo!
+  title: String!
+  body: String!
+  state: IssueState!
+  locked: Boolean!
+  pullRequest: Boolean!
+  author: User
+  assignees: [User!]!
+  labels: [Label!]!
+  milestone: Milestone
+  createdAt: Time
+  updatedAt: Time
+  closedAt: Time
+  # Comments are ordered from the oldest to the newest.
+  comments(first: Int = 25, after: String): CommentConnection!
+  # CLs are the Gerrit CLs that refer to the issue.
+  cls: [CL!]!
+  # References are the CLs that the issue and its comments mention.
+  references: [XRef!]!
+  # ReferencedBy are the CLs and commits that refer to the issue.
+  referencedBy: [XRef!]!
+  # Annotations are those of the issue in namespace, or in all
+  # namespaces if it's null.
+  annotations(namespace: String): [Annotation!]!
+}
+
+type Comment {
+  id: Int!
+  author: User
+  body: String!
+  createdAt: Time
+  updatedAt: Time
+}
+
+type User {
+  id: Int!
+  login: String!
+}
+
+type Label {
+  id: Int!
+  name: String!
+}
+
+type Milestone {
+  id: Int!
+  number: Int!
+  title: String!
+  closed: Boolean!
+}
+
+type GerritProject {
+  server: String!
+  project: String!
+  cl(number: Int!): CL
+  # CLs are ordered from the newest to the oldest.
+  cls(first: Int = 25, after: String, status: String): CLConnection!
+}
+
+type CL {
+  number: Int!
+  url: String!
+  project: GerritProject!
+  # Status is "new", "merged", "abandoned", or "draft".
+  status: String!
+  branch: String!
+  subject: String!
+  commitMessage: String!
+  owner: Person
+  version: Int!
+  changeID: String!
+  workInProgress: Boolean!
+  createdAt: Time
+  updatedAt: Time
+  # Messages are ordered from the oldest to the newest.
+  messages(first: Int = 25, after: String): CLMessageConnection!
+  # Issues are the GitHub issues that the CL refers to.
+  issues: [Issue!]!
+  # References are the issues that the CL refers to, and its commit
+  # once it's merged.
+  references: [XRef!]!
+  # ReferencedBy are the issues that mention the CL.
+  referencedBy: [XRef!]!
+  # Annotations are those of the CL in namespace, or in all namespaces
+  # if it's null.
+  annotations(namespace: String): [Annotation!]!
+}
+
+# An XRef is a cross-reference between GitHub issues, Gerrit CLs and
+# Git commits.
+type XRef {
+  kind: XRefKind!
+  from: XRefItem!
+  to: XRefItem!
+}
+
+# FIXES and UPDATES are references to issues from "Fixes #123" and
+# "Updates #123" lines of commit messages, or from commits that closed
+# issues. MERGED is a reference from a CL to its commit.
+enum XRefKind { FIXES UPDATES MENTIONS MERGED }
+
+# An XRefItem is one of an issue, a CL or a commit. Issue and cl are
+# null if the corpus doesn't track the item.
+type XRefItem {
+  # Ref is the item as a string, such as "golang/go#123",
+  # "go.googlesource.com/cl/456", or a commit hash.
+  ref: String!
+  issue: Issue
+  cl: CL
+  commit: String
+}
+
+# An Annotation is a key-value pair that an enricher, whose name is
+# the namespace, attached to an issue or CL.
+type Annotation {
+  namespace: String!
+  key: String!
+  value: String!
+}
+
+type CLMessage {
+  version: Int!
+  author: Person
+  message: String!
+  date: Time
+}
+
+type Person {
+  name: String!
+  email: String!
+}
+
+type IssueConnection {
+  totalCount: Int!
+  nodes: [Issue!]!
+  edges: [IssueEdge!]!
+  pageInfo: PageInfo!
+}
+
+type IssueEdge {
+  cursor: String!
+  node: Issue!
+}
+
+type CommentConnection {
+  totalCount: Int!
+  nodes: [Comment!]!
+  edges: [CommentEdge!]!
+  pageInfo: PageInfo!
+}
+
+type CommentEdge {
+  cursor: String!
+  node: Comment!
+}
+
+type CLConnection {
+  totalCount: Int!
+  nodes: [CL!]!
+  edges: [CLEdge!]!
+  pageInfo: PageInfo!
+}
+
+type CLEdge {
+  cursor: String!
+  node: CL!
+}
+
+type CLMessageConnection {
+  totalCount: Int!
+  nodes: [CLMessage!]!
+  edges: [CLMessageEdge!]!
+  pageInfo: PageInfo!
+}
+
+type CLMessageEdge {
+  cursor: String!
+  node: CLMessage!
+}
+
+type PageInfo {
+  hasNextPage: Boolean!
+  endCursor: String
+}
+`
+
+// maxPageSize is the maximum value of a connection's "first" argument.
+const maxPageSize = 100
+
+// query is the root object.
+type query struct {
+	c *maintner.Corpus
+}
+
+func (query) typeName() string { return "Query" }
+
+func (q query) field(e *executor, name string, a *args) (any, error) {
+	switch name {
+	case "githubRepos":
+		var list []object
+		q.c.GitHub().ForeachRepo(func(r *maintner.GitHubRepo) error {
+			list = append(list, githubRepo{r})
+			return nil
+		})
+		return list, nil
+	case "githubRepo":
+		owner, err := a.requiredString("owner")
+		if err != nil {
+			return nil, err
+		}
+		repo, err := a.requiredString("name")
+		if err != nil {
+			return nil, err
+		}
+		r := q.c.GitHub().Repo(owner, repo)
+		if r == nil {
+			return nil, nil
+		}
+		return githubRepo{r}, nil
+	case "gerritProjects":
+		var list []object
+		q.c.Gerrit().ForeachProjectUnsorted(func(p *maintner.GerritProject) error {
+			list = append(list, gerritProject{p})
+			return nil
+		})
+		sort.Slice(list, func(i, j int) bool {
+			return list[i].(gerritProject).p.ServerSlashProject() < list[j].(gerritProject).p.ServerSlashProject()
+		})
+		return list, nil
+	case "gerritProject":
+		server, err := a.string("server", "go.googlesource.com")
+		if err != nil {
+			return nil, err
+		}
+		proj, err := a.requiredString("project")
+		if err != nil {
+			return nil, err
+		}
+		p := q.c.Gerrit().Project(server, proj)
+		if p == nil {
+			return nil, nil
+		}
+		return gerritProject{p}, nil
+	case "commitXRefs":
+		h, err := a.requiredString("hash")
+		if err != nil {
+			return nil, err
+		}
+		hash, err := maintner.ParseGitHash(h)
+		if err != nil {
+			return nil, err
+		}
+		it := maintner.XRefItem{Commit: hash}
+		return xrefList(append(q.c.XRefsFrom(it), q.c.XRefsTo(it)...)), nil
+	case "annotationNamespaces":
+		return q.c.AnnotationNamespaces(), nil
+	case "annotated":
+		ns, err := a.requiredString("namespace")
+		if err != nil {
+			return nil, err
+		}
+		key, err := a.requiredString("key")
+		if err != nil {
+			return nil, err
+		}
+		value, err := a.string("value", "")
+		if err != nil {
+			return nil, err
+		}
+		list := []object{}
+		for _, it := range q.c.AnnotatedItems(ns, key, value) {
+			list = append(list, xrefItem{it})
+		}
+		return list, nil
+	}
+	return nil, errNoField
+}
+
+type githubRepo struct {
+	r *maintner.GitHubRepo
+}
+
+func (githubRepo) typeName() string { return "GitHubRepo" }
+
+func (r githubRepo) field(e *executor, name string, a *args) (any, error) {
+	switch name {
+	case "owner":
+		return r.r.ID().Owner, nil
+	case "name":
+		return r.r.ID().Repo, nil
+	case "issue":
+		n, err := a.requiredInt("number")
+		if err != nil {
+			return nil, err
+		}
+		gi := r.r.Issue(int32(n))
+		if gi == nil || gi.NotExist {
+			return nil, nil
+		}
+		return issue{r.r, gi}, nil
+	case "issues":
+		state, err := a.string("state", "ALL")
+		if err != nil {
+			return nil, err
+		}
+		if state != "OPEN" && state != "CLOSED" && state != "ALL" {
+			return nil, fmt.Errorf("invalid issue state %q", state)
+		}
+		pr, err := a.bool("pullRequest")
+		if err != nil {
+			return nil, err
+		}
+		label, err := a.string("label", "")
+		if err != nil {
+			return nil, err
+		}
+		var nodes []object
+		var keys []int64
+		r.r.ForeachIssue(func(gi *maintner.GitHubIssue) error {
+			if gi.NotExist ||
+				state == "OPEN" && gi.Closed ||
+				state == "CLOSED" && !gi.Closed ||
+				pr != nil && gi.PullRequest != *pr ||
+				label != "" && !gi.HasLabel(label) {
+				return nil
+			}
+			nodes = append(nodes, issue{r.r, gi})
+			keys = append(keys, int64(gi.Number))
+			return nil
+		})
+		reverse(nodes)
+		reverse(keys)
+		return newConnection("Issue", nodes, keys, true, a)
+	case "labels":
+		var list []object
+		r.r.ForeachLabel(func(l *maintner.GitHubLabel) error {
+			list = append(list, label{l})
+			return nil
+		})
+		return list, nil
+	case "milestones":
+		var list []object
+		r.r.ForeachMilestone(func(m *maintner.GitHubMilestone) error {
+			list = append(list, milestone{m})
+			return nil
+		})
+		return list, nil
+	}
+	return nil, errNoField
+}
+
+type issue struct {
+	r  *maintner.GitHubRepo
+	gi *maintner.GitHubIssue
+}
+
+func (issue) typeName() string { return "Issue" }
+
+func (i issue) field(e *executor, name string, a *args) (any, error) {
+	gi := i.gi
+	switch name {
+	case "id":
+		return gi.ID, nil
+	case "number":
+		return gi.Number, nil
+	case "url":
+		return fmt.Sprintf("https://github.com/%s/issues/%d", i.r.ID(), gi.Number), nil
+	case "repo":
+		return githubRepo{i.r}, nil
+	case "title":
+		return gi.Title, nil
+	case "body":
+		return gi.Body, nil
+	case "state":
+		if gi.Closed {
+			return "CLOSED", nil
+		}
+		return "OPEN", nil
+	case "locked":
+		return gi.Locked, nil
+	case "pullRequest":
+		return gi.PullRequest, nil
+	case "author":
+		return newUser(gi.User), nil
+	case "assignees":
+		list := []object{}
+		for _, u := range gi.Assignees {
+			list = append(list, user{u})
+		}
+		return list, nil
+	case "labels":
+		list := []object{}
+		for _, l := range gi.Labels {
+			list = append(list, label{l})
+		}
+		sort.Slice(list, func(i, j int) bool { return list[i].(label).l.Name < list[j].(label).l.Name })
+		return list, nil
+	case "milestone":
+		if gi.Milestone.IsNone() || gi.Milestone.IsUnknown() {
+			return nil, nil
+		}
+		return milestone{gi.Milestone}, nil
+	case "createdAt":
+		return gi.Created, nil
+	case "updatedAt":
+		return gi.Updated, nil
+	case "closedAt":
+		return gi.ClosedAt, nil
+	case "comments":
+		var nodes []object
+		var keys []int64
+		gi.ForeachComment(func(c *maintner.GitHubComment) error {
+			nodes = append(nodes, comment{c})
+			keys = append(keys, c.ID)
+			return nil
+		})
+		// ForeachComment orders by creation time, but cursors
+		// need an order by key. They're almost always the same.
+		sort.Sort(byKey{nodes, keys})
+		return newConnection("Comment", nodes, keys, false, a)
+	case "cls":
+		list := []object{}
+		for _, cl := range e.clsByIssue()[maintner.GitHubIssueRef{Repo: i.r, Number: gi.Number}] {
+			list = append(list, gerritCL{cl})
+		}
+		return list, nil
+	case "references":
+		return xrefList(e.corpus().XRefsFrom(i.xrefItem())), nil
+	case "referencedBy":
+		return xrefList(e.corpus().XRefsTo(i.xrefItem())), nil
+	case "annotations":
+		return annotationList(e, i.xrefItem(), a)
+	}
+	return nil, errNoField
+}
+
+// corpus returns the corpus being queried.
+func (e *executor) corpus() *maintner.Corpus { return e.root.(query).c }
+
+func (i issue) xrefItem() maintner.XRefItem {
+	return maintner.XRefItem{Issue: maintner.GitHubIssueRef{Repo: i.r, Number: i.gi.Number}}
+}
+
+// clsByIssue returns the CLs that refer to each GitHub issue, newest
+// first. It's computed once per query, as it requires scanning every
+// CL in the corpus.
+func (e *executor) clsByIssue() map[maintner.GitHubIssueRef][]*maintner.GerritCL {
+	if m, ok := e.cache["clsByIssue"].(map[maintner.GitHubIssueRef][]*maintner.GerritCL); ok {
+		return m
+	}
+	m := map[maintner.GitHubIssueRef][]*maintner.GerritCL{}
+	e.corpus().Gerrit().ForeachProjectUnsorted(func(p *maintner.GerritProject) error {
+		return p.ForeachCLUnsorted(func(cl *maintner.GerritCL) error {
+			if cl.Private {
+				return nil
+			}
+			for _, ref := range cl.GitHubIssueRefs {
+				m[ref] = append(m[ref], cl)
+			}
+			return nil
+		})
+	})
+	for _, cls := range m {
+		sort.Slice(cls, func(i, j int) bool { return cls[i].Created.After(cls[j].Created) })
+	}
+	e.cache["clsByIssue"] = m
+	return m
+}
+
+type comment struct {
+	c *maintner.GitHubComment
+}
+
+func (comment) typeName() string { return "Comment" }
+
+func (c comment) field(e *executor, name string, a *args) (any, error) {
+	switch name {
+	case "id":
+		return c.c.ID, nil
+	case "author":
+		return newUser(c.c.User), nil
+	case "body":
+		return c.c.Body, nil
+	case "createdAt":
+		return c.c.Created, nil
+	case "updatedAt":
+		return c.c.Updated, nil
+	}
+	return nil, errNoField
+}
+
+type user struct {
+	u *maintner.GitHubUser
+}
+
+// newUser returns u as a user object, or nil if u is nil.
+func newUser(u *maintner.GitHubUser) object {
+	if u == nil {
+		return nil
+	}
+	return user{u}
+}
+
+func (user) typeName() string { return "User" }
+
+func (u user) field(e *executor, name string, a *args) (any, error) {
+	switch name {
+	case "id":
+		return u.u.ID, nil
+	case "login":
+		return u.u.Login, nil
+	}
+	return nil, errNoField
+}
+
+type label struct {
+	l *maintner.GitHubLabel
+}
+
+func (label) typeName() string { return "Label" }
+
+func (l label) field(e *executor, name string, a *args) (any, error) {
+	switch name {
+	case "id":
+		return l.l.ID, nil
+	case "name":
+		return l.l.Name, nil
+	}
+	return nil, errNoField
+}
+
+type milestone struct {
+	m *maintner.GitHubMilestone
+}
+
+func (milestone) typeName() string { return "Milestone" }
+
+func (m milestone) field(e *executor, name string, a *args) (any, error) {
+	switch name {
+	case "id":
+		return m.m.ID, nil
+	case "number":
+		return m.m.Number, nil
+	case "title":
+		return m.m.Title, nil
+	case "closed":
+		return m.m.Closed, nil
+	}
+	return nil, errNoField
+}
+
+type gerritProject struct {
+	p *maintner.GerritProject
+}
+
+func (gerritProject) typeName() string { return "GerritProject" }
+
+func (p gerritProject) field(e *executor, name string, a *args) (any, error) {
+	switch name {
+	case "server":
+		return p.p.Server(), nil
+	case "project":
+		return p.p.Project(), nil
+	case "cl":
+		n, err := a.requiredInt("number")
+		if err != nil {
+			return nil, err
+		}
+		cl := p.p.CL(int32(n))
+		if cl == nil || cl.Private {
+			return nil, nil
+		}
+		return gerritCL{cl}, nil
+	case "cls":
+		status, err := a.string("status", "")
+		if err != nil {
+			return nil, err
+		}
+		var cls []*maintner.GerritCL
+		p.p.ForeachCLUnsorted(func(cl *maintner.GerritCL) error {
+			if !cl.Private && (status == "" || cl.Status == status) {
+				cls = append(cls, cl)
+			}
+			return nil
+		})
+		sort.Slice(cls, func(i, j int) bool { return cls[i].Number > cls[j].Number })
+		nodes := make([]object, len(cls))
+		keys := make([]int64, len(cls))
+		for i, cl := range cls {
+			nodes[i], keys[i] = gerritCL{cl}, int64(cl.Number)
+		}
+		return newConnection("CL", nodes, keys, true, a)
+	}
+	return nil, errNoField
+}
+
+type gerritCL struct {
+	cl *maintner.GerritCL
+}
+
+func (gerritCL) typeName() string { return "CL" }
+
+func (c gerritCL) field(e *executor, name string, a *args) (any, error) {
+	cl := c.cl
+	switch name {
+	case "number":
+		return cl.Number, nil
+	case "url":
+		review := strings.Replace(cl.Project.Server(), ".googlesource.com", "-review.googlesource.com", 1)
+		return fmt.Sprintf("https://%s/c/%s/+/%d", review, cl.Project.Project(), cl.Number), nil
+	case "project":
+		return gerritProject{cl.Project}, nil
+	case "status":
+		return cl.Status, nil
+	case "branch":
+		return cl.Branch(), nil
+	case "subject":
+		return cl.Subject(), nil
+	case "commitMessage":
+		return cl.Commit.Msg, nil
+	case "owner":
+		return newPerson(cl.Owner()), nil
+	case "version":
+		return cl.Version, nil
+	case "changeID":
+		return cl.ChangeID(), nil
+	case "workInProgress":
+		return cl.WorkInProgress(), nil
+	case "createdAt":
+		return cl.Created, nil
+	case "updatedAt":
+		return cl.Meta.Commit.CommitTime, nil
+	case "messages":
+		nodes := make([]object, len(cl.Messages))
+		keys := make([]int64, len(cl.Messages))
+		for i, m := range cl.Messages {
+			nodes[i], keys[i] = clMessage{m}, int64(i)
+		}
+		return newConnection("CLMessage", nodes, keys, false, a)
+	case "issues":
+		list := []object{}
+		for _, ref := range cl.GitHubIssueRefs {
+			if gi := ref.Repo.Issue(ref.Number); gi != nil && !gi.NotExist {
+				list = append(list, issue{ref.Repo, gi})
+			}
+		}
+		return list, nil
+	case "references":
+		return xrefList(e.corpus().XRefsFrom(c.xrefItem())), nil
+	case "referencedBy":
+		return xrefList(e.corpus().XRefsTo(c.xrefItem())), nil
+	case "annotations":
+		return annotationList(e, c.xrefItem(), a)
+	}
+	return nil, errNoField
+}
+
+func (c gerritCL) xrefItem() maintner.XRefItem {
+	return maintner.XRefItem{CL: maintner.GerritCLRef{Server: c.cl.Project.Server(), Number: c.cl.Number}}
+}
+
+// xrefList returns refs as a list of xref objects.
+func xrefList(refs []maintner.XRef) []object {
+	list := []object{}
+	for _, r := range refs {
+		list = append(list, xref{r})
+	}
+	return list
+}
+
+type xref struct {
+	r maintner.XRef
+}
+
+func (xref) typeName() string { return "XRef" }
+
+func (x xref) field(e *executor, name string, a *args) (any, error) {
+	switch name {
+	case "kind":
+		return strings.ToUpper(string(x.r.Kind)), nil
+	case "from":
+		return xrefItem{x.r.From}, nil
+	case "to":
+		return xrefItem{x.r.To}, nil
+	}
+	return nil, errNoField
+}
+
+type xrefItem struct {
+	it maintner.XRefItem
+}
+
+func (xrefItem) typeName() string { return "XRefItem" }
+
+func (x xrefItem) field(e *executor, name string, a *args) (any, error) {
+	it := x.it
+	switch name {
+	case "ref":
+		return it.String(), nil
+	case "issue":
+		if it.Issue.Repo == nil {
+			return nil, nil
+		}
+		gi := it.Issue.Repo.Issue(it.Issue.Number)
+		if gi == nil || gi.NotExist {
+			return nil, nil
+		}
+		return issue{it.Issue.Repo, gi}, nil
+	case "cl":
+		if it.CL.Server == "" {
+			return nil, nil
+		}
+		cl := e.corpus().CLOfRef(it.CL)
+		if cl == nil || cl.Private {
+			return nil, nil
+		}
+		return gerritCL{cl}, nil
+	case "commit":
+		if it.Commit == "" {
+			return nil, nil
+		}
+		return it.Commit.String(), nil
+	}
+	return nil, errNoField
+}
+
+// annotationList returns the annotations of it in the namespace given
+// by the namespace argument, or in all namespaces, as a list of
+// annotation objects.
+func annotationList(e *executor, it maintner.XRefItem, a *args) (any, error) {
+	ns, err := a.string("namespace", "")
+	if err != nil {
+		return nil, err
+	}
+	nss := []string{ns}
+	if ns == "" {
+		nss = e.corpus().AnnotationNamespaces()
+	}
+	list := []object{}
+	for _, ns := range nss {
+		for _, an := range e.corpus().Annotations(ns, it) {
+			list = append(list, annotation{ns, an})
+		}
+	}
+	return list, nil
+}
+
+type annotation struct {
+	ns string
+	a  maintner.Annotation
+}
+
+func (annotation) typeName() string { return "Annotation" }
+
+func (an annotation) field(e *executor, name string, a *args) (any, error) {
+	switch name {
+	case "namespace":
+		return an.ns, nil
+	case "key":
+		return an.a.Key, nil
+	case "value":
+		return an.a.Value, nil
+	}
+	return nil, errNoField
+}
+
+type clMessage struct {
+	m *maintner.GerritMessage
+}
+
+func (clMessage) typeName() string { return "CLMessage" }
+
+func (m clMessage) field(e *executor, name string, a *args) (any, error) {
+	switch name {
+	case "version":
+		return m.m.Version, nil
+	case "author":
+		return newPerson(m.m.Author), nil
+	case "message":
+		return m.m.Message, nil
+	case "date":
+		return m.m.Date, nil
+	}
+	return nil, errNoField
+}
+
+type person struct {
+	p *maintner.GitPerson
+}
+
+// newPerson returns p as a person object, or nil if p is nil.
+func newPerson(p *maintner.GitPerson) object {
+	if p == nil {
+		return nil
+	}
+	return person{p}
+}
+
+func (person) typeName() string { return "Person" }
+
+func (p person) field(e *executor, name string, a *args) (any, error) {
+	switch name {
+	case "name":
+		return p.p.Name(), nil
+	case "email":
+		return p.p.Email(), nil
+	}
+	return nil, errNoField
+}
+
+// A connection is a page of a list of nodes, following the Relay
+// cursor connections specification. Each node has an int64 key, and
+// the nodes are in increasing order of key, or decreasing order if
+// desc is set. A node's cursor encodes its key, so that pagination
+// continues in the right place even if nodes are added.
+type connection struct {
+	kind  string // the type of the nodes
+	total int
+	nodes []object // the page
+	keys  []int64  // the keys of nodes
+	more  bool     // there are nodes after the page
+}
+
+// newConnection returns the page of nodes selected by the "first" and
+// "after" arguments in a.
+func newConnection(kind string, nodes []object, keys []int64, desc bool, a *args) (*connection, error) {
+	first, err := a.int("first", 25)
+	if err != nil {
+		return nil, err
+	}
+	if first < 0 || first > maxPageSize {
+		return nil, fmt.Errorf("first must be between 0 and %d", maxPageSize)
+	}
+	after, err := a.string("after", "")
+	if err != nil {
+		return nil, err
+	}
+	c := &connection{kind: kind, total: len(nodes)}
+	start := 0
+	if after != "" {
+		k, err := decodeCursor(after)
+		if err != nil {
+			return nil, err
+		}
+		start = sort.Search(len(keys), func(i int) bool {
+			if desc {
+				return keys[i] < k
+			}
+			return keys[i] > k
+		})
+	}
+	end := start + first
+	if end > len(nodes) {
+		end = len(nodes)
+	}
+	c.nodes, c.keys, c.more = nodes[start:end], keys[start:end], end < len(nodes)
+	return c, nil
+}
+
+func (c *connection) typeName() string { return c.kind + "Connection" }
+
+func (c *connection) field(e *executor, name string, a *args) (any, error) {
+	switch name {
+	case "totalCount":
+		return c.total, nil
+	case "nodes":
+		return c.nodes, nil
+	case "edges":
+		list := make([]object, len(c.nodes))
+		for i, n := range c.nodes {
+			list[i] = edge{c.kind, n, c.keys[i]}
+		}
+		return list, nil
+	case "pageInfo":
+		return pageInfo{c}, nil
+	}
+	return nil, errNoField
+}
+
+type edge struct {
+	kind string
+	node object
+	key  int64
+}
+
+func (e edge) typeName() string { return e.kind + "Edge" }
+
+func (ed edge) field(e *executor, name string, a *args) (any, error) {
+	switch name {
+	case "cursor":
+		return encodeCursor(ed.key), nil
+	case "node":
+		return ed.node, nil
+	}
+	return nil, errNoField
+}
+
+type pageInfo struct {
+	c *connection
+}
+
+func (pageInfo) typeName() string { return "PageInfo" }
+
+func (p pageInfo) field(e *executor, name string, a *args) (any, error) {
+	switch name {
+	case "hasNextPage":
+		return p.c.more, nil
+	case "endCursor":
+		if len(p.c.keys) == 0 {
+			return nil, nil
+		}
+		return encodeCursor(p.c.keys[len(p.c.keys)-1]), nil
+	}
+	return nil, errNoField
+}
+
+func encodeCursor(key int64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(key, 10)))
+}
+
+func decodeCursor(s string) (int64, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err == nil {
+		var k int64
+		if k, err = strconv.ParseInt(string(b), 10, 64); err == nil {
+			return k, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid cursor %q", s)
+}
+
+// byKey sorts nodes by their keys.
+type byKey struct {
+	nodes []object
+	keys  []int64
+}
+
+func (s byKey) Len() int           { return len(s.nodes) }
+func (s byKey) Less(i, j int) bool { return s.keys[i] < s.keys[j] }
+func (s byKey) Swap(i, j int) {
+	s.nodes[i], s.nodes[j] = s.nodes[j], s.nodes[i]
+	s.keys[i], s.keys[j] = s.keys[j], s.keys[i]
+}
+
+func reverse[T any](s []T) {
+	for i, j := 0, len(s)-1; i < j; i, j = i+1, j-1 {
+		s[i], s[j] = s[j], s[i]
+	}
+}
@@ -888,6 +888,7 @@ func dashCommit(c *maintner.GitCommit) *apipb.DashCommit {
 		CommitTimeSec: c.CommitTime.Unix(),
 		AuthorName:    c.Author.Name(),
 		AuthorEmail:   c.Author.Email(),
+		AuthorIsBot:   c.Author.IsBot(),
 		Title:         c.Summary(),
 	}
 }
@@ -26,10 +26,15 @@ import (
 	"golang.org/x/build/internal/https"
 	"golang.org/x/build/internal/secret"
 	"golang.org/x/build/maintner"
+	"golang.org/x/build/maintner/enrich"
 	"golang.org/x/build/maintner/godata"
 	"golang.org/x/build/maintner/maintnerd/apipb"
+	"golang.org/x/build/maintner/maintnerd/backfill"
 	"golang.org/x/build/maintner/maintnerd/gcslog"
+	"golang.org/x/build/maintner/maintnerd/graphql"
 	"golang.org/x/build/maintner/maintnerd/maintapi"
+	"golang.org/x/build/maintner/maintnerd/webhook"
+	"golang.org/x/build/maintner/mutenc"
 	"golang.org/x/build/repos"
 	"golang.org/x/crypto/acme/autocert"
 	"golang.org/x/time/rate"
@@ -51,6 +56,15 @@ var (
 
 	bucket         = flag.String("bucket", "", "if non-empty, Google Cloud Storage bucket to use for log storage. If the bucket name contains a \"/\", the part after the slash will be a prefix for the segments.")
 	migrateGCSFlag = flag.Bool("migrate-disk-to-gcs", false, "[dev] If true, migrate from disk-based logs to GCS logs on start-up, then quit.")
+
+	mutFormat = flag.String("mutation-format", "v1", "Format in which new mutations are written to the log: v1 or v2. Mutations in either format are always readable.")
+	dualV2Log = flag.String("dual-write-v2", "", "[migration] If non-empty, also write every new mutation in the v2 format to this log: a Google Cloud Storage bucket (with optional \"/\" prefix) if --bucket is set, otherwise a local directory.")
+	migrateV2 = flag.Bool("migrate-to-v2", false, "[migration] If true, copy the whole log to the --dual-write-v2 log in the v2 format on start-up, then quit.")
+
+	enrichers = flag.String("enrich", "", "Comma-separated list of enrichers that annotate issues and CLs, queryable at /graphql. Valid enrichers: "+strings.Join(enrich.Names(), ", "))
+
+	webhookTokenFile  = flag.String("webhook-token-file", "", "If non-empty, a file containing the token that clients must present to manage webhook subscriptions at /subscriptions. Webhooks are disabled if empty. Requires --generate-mutations.")
+	backfillTokenFile = flag.String("backfill-token-file", "", "If non-empty, a file containing the token that administrators must present to backfill gaps in the history of the watched repos at /backfills. Backfills are disabled if empty. Requires --generate-mutations.")
 )
 
 func init() {
@@ -70,6 +84,45 @@ Maintner is short for "maintainer."
 
 var autocertManager *autocert.Manager
 
+// newV2Logger returns the logger used for --dual-write-v2.
+func newV2Logger(dst string) maintner.MutationLogger {
+	if *bucket != "" {
+		gl, err := gcslog.NewGCSLog(context.Background(), dst)
+		if err != nil {
+			log.Fatalf("newGCSLog: %v", err)
+		}
+		gl.SetDebug(*debug)
+		gl.SetFormat(mutenc.V2)
+		return gl
+	}
+	if err := os.MkdirAll(dst, 0755); err != nil {
+		log.Fatal(err)
+	}
+	dl := maintner.NewDiskMutationLogger(dst)
+	dl.SetFormat(mutenc.V2)
+	return dl
+}
+
+// copyMutations logs all mutations from src to dst.
+func copyMutations(dst maintner.MutationLogger, src maintner.MutationSource) error {
+	if gl, ok := dst.(*gcslog.GCSLog); ok {
+		return gl.CopyFrom(src)
+	}
+	ctx := context.Background()
+	for e := range src.GetMutations(ctx) {
+		if e.Err != nil {
+			return e.Err
+		}
+		if e.End {
+			return nil
+		}
+		if err := dst.Log(e.Mutation); err != nil {
+			return err
+		}
+	}
+	panic("unexpected channel close")
+}
+
 func main() {
 	https.RegisterFlags(flag.CommandLine)
 	flag.Parse()
@@ -87,12 +140,21 @@ func main() {
 	if *migrateGCSFlag && *bucket == "" {
 		log.Fatalf("--bucket flag required with --migrate-disk-to-gcs")
 	}
+	if *migrateV2 && *dualV2Log == "" {
+		log.Fatalf("--dual-write-v2 flag required with --migrate-to-v2")
+	}
+	format, err := mutenc.ParseFormat(*mutFormat)
+	if err != nil {
+		log.Fatalf("--mutation-format: %v", err)
+	}
 
 	type storage interface {
 		maintner.MutationSource
 		maintner.MutationLogger
 	}
 	var logger storage
+	var notifier *webhook.Notifier
+	var backfills *backfill.Server
 
 	corpus := new(maintner.Corpus)
 	switch *config {
@@ -140,6 +202,7 @@ func main() {
 				log.Fatalf("newGCSLog: %v", err)
 			}
 			gl.SetDebug(*debug)
+			gl.SetFormat(format)
 			gl.RegisterHandlers(http.DefaultServeMux)
 			if *migrateGCSFlag {
 				diskLog := maintner.NewDiskMutationLogger(*dataDir)
@@ -151,9 +214,40 @@ func main() {
 			}
 			logger = gl
 		} else {
-			logger = maintner.NewDiskMutationLogger(*dataDir)
+			diskLog := maintner.NewDiskMutationLogger(*dataDir)
+			diskLog.SetFormat(format)
+			logger = diskLog
+		}
+		var mutLogger maintner.MutationLogger = logger
+		if *dualV2Log != "" {
+			v2Log := newV2Logger(*dualV2Log)
+			if *migrateV2 {
+				if err := copyMutations(v2Log, logger); err != nil {
+					log.Fatalf("migrate to v2: %v", err)
+				}
+				log.Printf("Success.")
+				return
+			}
+			mutLogger = maintner.MultiMutationLogger(logger, v2Log)
+		}
+		if *webhookTokenFile != "" {
+			token, err := os.ReadFile(*webhookTokenFile)
+			if err != nil {
+				log.Fatalf("reading webhook token: %v", err)
+			}
+			notifier = webhook.NewNotifier(corpus, strings.TrimSpace(string(token)))
+			notifier.RegisterHandlers(http.DefaultServeMux)
+			mutLogger = maintner.MultiMutationLogger(mutLogger, notifier)
+		}
+		if *backfillTokenFile != "" {
+			token, err := os.ReadFile(*backfillTokenFile)
+			if err != nil {
+				log.Fatalf("reading backfill token: %v", err)
+			}
+			backfills = backfill.NewServer(corpus, strings.TrimSpace(string(token)))
+			backfills.RegisterHandlers(http.DefaultServeMux)
 		}
-		corpus.EnableLeaderMode(logger, *dataDir)
+		corpus.EnableLeaderMode(mutLogger, *dataDir)
 	}
 	if *debug {
 		corpus.SetDebug()
@@ -183,6 +277,15 @@ func main() {
 			corpus.TrackGerrit(project)
 		}
 	}
+	if *enrichers != "" {
+		for _, name := range strings.Split(*enrichers, ",") {
+			e, err := enrich.New(name)
+			if err != nil {
+				log.Fatal(err)
+			}
+			corpus.AddEnricher(e)
+		}
+	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -220,10 +323,17 @@ func main() {
 	if *pubsub != "" {
 		corpus.StartPubSubHelperSubscribe(*pubsub)
 	}
+	if notifier != nil {
+		go notifier.Run(ctx)
+	}
+	if backfills != nil {
+		go backfills.Run(ctx)
+	}
 
 	grpcServer := grpc.NewServer()
 	apipb.RegisterMaintnerServiceServer(grpcServer, maintapi.NewAPIService(corpus))
 	http.Handle("/apipb.MaintnerService/", grpcServer)
+	http.Handle("/graphql", graphql.NewHandler(corpus))
 
 	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		if strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
@@ -244,6 +354,7 @@ func main() {
 </p>
 <ul>
    <li><a href='/logs'>/logs</a>
+   <li><a href='/graphql'>/graphql</a> (GET for the schema, POST to query)
 </ul>
 </body></html>
 `)
@@ -252,7 +363,9 @@ func main() {
 	if *genMut {
 		go func() { log.Fatalf("Corpus.SyncLoop = %v", corpus.SyncLoop(ctx)) }()
 	}
-	log.Fatalln(https.ListenAndServe(ctx, http.DefaultServeMux))
+	if err := https.ListenAndServe(ctx, http.DefaultServeMux); err != nil {
+		log.Fatalln(err)
+	}
 }
 
 func setGoConfig() {
@@ -0,0 +1,499 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package webhook notifies subscribers of changes to a maintner corpus
+// by POSTing compact JSON descriptions of them to webhook URLs.
+//
+// Subscriptions are managed over HTTP:
+//
+//	POST   /subscriptions       create a subscription from a JSON Subscription
+//	GET    /subscriptions       list subscriptions
+//	DELETE /subscriptions/<id>  delete a subscription
+//
+// These requests must carry the server's token as a bearer token.
+// Subscriptions are only kept in memory, so subscribers should
+// re-register when they notice they've stopped receiving events.
+//
+// Each matching change is POSTed to the subscription's URL as a JSON
+// Event. If the subscription has a secret, the X-Maintner-Signature-256
+// header of the request contains "sha256=" followed by the hex-encoded
+// HMAC-SHA256 of the request body keyed by the secret.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/build/maintner"
+	"golang.org/x/build/maintner/maintpb"
+)
+
+// A Filter selects the changes a subscription is notified of.
+// The zero Filter matches all changes.
+type Filter struct {
+	// Repo, if non-empty, is the GitHub repository ("golang/go") or
+	// Gerrit project ("go.googlesource.com/go") that changed.
+	Repo string `json:"repo,omitempty"`
+	// Label, if non-empty, matches GitHub issues and pull requests
+	// that have the label or that had it added or removed by the
+	// change. It is case-insensitive.
+	Label string `json:"label,omitempty"`
+	// CLStatus, if non-empty, matches Gerrit CLs with the status:
+	// "new", "merged" or "abandoned".
+	CLStatus string `json:"cl_status,omitempty"`
+}
+
+func (f *Filter) validate() error {
+	switch f.CLStatus {
+	case "", "new", "merged", "abandoned":
+	default:
+		return fmt.Errorf("invalid CL status %q", f.CLStatus)
+	}
+	if f.Label != "" && f.CLStatus != "" {
+		return errors.New("a filter can't match both a label and a CL status")
+	}
+	return nil
+}
+
+// A Subscription is a request to be notified of changes matching
+// Filter at URL.
+type Subscription struct {
+	ID     string `json:"id"` // assigned by the server
+	URL    string `json:"url"`
+	Filter Filter `json:"filter"`
+	// Secret, if non-empty, is used to sign events sent to URL.
+	// It's never returned by the server.
+	Secret string `json:"secret,omitempty"`
+}
+
+// An Event describes a change to a single issue or CL. Exactly one of
+// Issue and CL is set.
+type Event struct {
+	Subscription string       `json:"subscription"` // ID of the subscription being notified
+	Time         time.Time    `json:"time"`         // when the change was processed
+	Issue        *IssueChange `json:"issue,omitempty"`
+	CL           *CLChange    `json:"cl,omitempty"`
+}
+
+// An IssueChange describes a change to a GitHub issue or pull request.
+// Fields describing what changed are only set if it did.
+type IssueChange struct {
+	Repo        string   `json:"repo"` // "golang/go"
+	Number      int32    `json:"number"`
+	PullRequest bool     `json:"pull_request,omitempty"`
+	Labels      []string `json:"labels"` // current labels, sorted
+
+	Title         string   `json:"title,omitempty"`
+	BodyChanged   bool     `json:"body_changed,omitempty"`
+	State         string   `json:"state,omitempty"` // "open" or "closed"
+	Milestone     string   `json:"milestone,omitempty"`
+	AddedLabels   []string `json:"added_labels,omitempty"`
+	RemovedLabels []string `json:"removed_labels,omitempty"`
+	Comments      []int64  `json:"comments,omitempty"` // IDs of new or edited comments
+	Events        []string `json:"events,omitempty"`   // types of new events, like "assigned"
+	Reviews       []int64  `json:"reviews,omitempty"`  // IDs of new reviews
+}
+
+// A CLChange describes a change to a Gerrit CL.
+type CLChange struct {
+	Project string   `json:"project"` // "go.googlesource.com/go"
+	Number  int32    `json:"number"`
+	Status  string   `json:"status"` // current status: "new", "merged" or "abandoned"
+	Refs    []string `json:"refs"`   // updated refs, like "refs/changes/45/12345/meta"
+}
+
+// queueSize is how many mutations can wait for delivery before new
+// ones are dropped.
+const queueSize = 1000
+
+// A Notifier delivers corpus changes to subscribers. It is a
+// maintner.MutationLogger, so it sees the mutations of a corpus in
+// leader mode when it's added to the corpus's logger with
+// maintner.MultiMutationLogger.
+type Notifier struct {
+	c      *maintner.Corpus
+	token  string
+	client *http.Client
+	queue  chan *maintpb.Mutation
+
+	mu   sync.Mutex
+	subs map[string]*Subscription
+}
+
+// NewNotifier returns a Notifier for changes to c. Managing its
+// subscriptions requires token. Run must be called to deliver
+// events.
+func NewNotifier(c *maintner.Corpus, token string) *Notifier {
+	return &Notifier{
+		c:      c,
+		token:  token,
+		client: &http.Client{Timeout: 10 * time.Second},
+		queue:  make(chan *maintpb.Mutation, queueSize),
+		subs:   make(map[string]*Subscription),
+	}
+}
+
+// Log queues m for delivery to subscribers. It never blocks or fails,
+// so that a slow subscriber can't hold up the corpus; if the queue is
+// full, m is dropped.
+func (n *Notifier) Log(m *maintpb.Mutation) error {
+	select {
+	case n.queue <- m:
+	default:
+		log.Printf("webhook: queue full; dropping mutation")
+	}
+	return nil
+}
+
+// Run delivers queued mutations to subscribers until ctx is done.
+func (n *Notifier) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case m := <-n.queue:
+			n.deliver(ctx, m)
+		}
+	}
+}
+
+func (n *Notifier) deliver(ctx context.Context, m *maintpb.Mutation) {
+	n.mu.Lock()
+	subs := make([]*Subscription, 0, len(n.subs))
+	for _, s := range n.subs {
+		subs = append(subs, s)
+	}
+	n.mu.Unlock()
+	if len(subs) == 0 {
+		return
+	}
+	now := time.Now()
+	for _, ev := range n.events(m) {
+		for _, s := range subs {
+			if !s.Filter.matches(ev) {
+				continue
+			}
+			ev := *ev
+			ev.Subscription, ev.Time = s.ID, now
+			if err := n.post(ctx, s, &ev); err != nil {
+				log.Printf("webhook: delivering to subscription %s: %v", s.ID, err)
+			}
+		}
+	}
+}
+
+// post sends ev to the URL of s, retrying a few times if it fails.
+func (n *Notifier) post(ctx context.Context, s *Subscription, ev *Event) error {
+	body, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	var lastErr error
+	for attempt := 0; attempt < 3; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(time.Duration(attempt) * time.Second):
+			}
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if s.Secret != "" {
+			req.Header.Set("X-Maintner-Signature-256", Signature(s.Secret, body))
+		}
+		res, err := n.client.Do(req)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		res.Body.Close()
+		if res.StatusCode/100 == 2 {
+			return nil
+		}
+		lastErr = fmt.Errorf("POST %s: %s", s.URL, res.Status)
+		if res.StatusCode/100 == 4 {
+			// The subscriber rejected the event; retrying won't help.
+			break
+		}
+	}
+	return lastErr
+}
+
+// Signature returns the value of the X-Maintner-Signature-256 header
+// for an event with the given body sent to a subscription with secret.
+func Signature(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// events returns the events describing m. It looks up the current
+// state of the issues and CLs in m in the corpus.
+func (n *Notifier) events(m *maintpb.Mutation) []*Event {
+	n.c.RLock()
+	defer n.c.RUnlock()
+	var evs []*Event
+	if im := m.GithubIssue; im != nil {
+		if ic := n.issueChange(im); ic != nil {
+			evs = append(evs, &Event{Issue: ic})
+		}
+	}
+	if gm := m.Gerrit; gm != nil {
+		for _, cc := range n.clChanges(gm) {
+			evs = append(evs, &Event{CL: cc})
+		}
+	}
+	return evs
+}
+
+func (n *Notifier) issueChange(im *maintpb.GithubIssueMutation) *IssueChange {
+	repo := n.c.GitHub().Repo(im.Owner, im.Repo)
+	if repo == nil {
+		return nil
+	}
+	gi := repo.Issue(im.Number)
+	if gi == nil || gi.NotExist {
+		return nil
+	}
+	ic := &IssueChange{
+		Repo:        repo.ID().String(),
+		Number:      im.Number,
+		PullRequest: gi.PullRequest,
+		Labels:      []string{},
+		Title:       im.Title,
+		BodyChanged: im.BodyChange != nil || im.Body != "",
+	}
+	for _, l := range gi.Labels {
+		ic.Labels = append(ic.Labels, l.Name)
+	}
+	sort.Strings(ic.Labels)
+	if im.Closed != nil {
+		ic.State = "open"
+		if gi.Closed {
+			ic.State = "closed"
+		}
+	}
+	if im.NoMilestone {
+		ic.Milestone = "none"
+	} else if im.MilestoneTitle != "" {
+		ic.Milestone = im.MilestoneTitle
+	}
+	for _, l := range im.AddLabel {
+		ic.AddedLabels = append(ic.AddedLabels, l.Name)
+	}
+	if len(im.RemoveLabel) > 0 {
+		names := make(map[int64]string)
+		repo.ForeachLabel(func(l *maintner.GitHubLabel) error {
+			names[l.ID] = l.Name
+			return nil
+		})
+		for _, id := range im.RemoveLabel {
+			if name, ok := names[id]; ok {
+				ic.RemovedLabels = append(ic.RemovedLabels, name)
+			}
+		}
+	}
+	for _, c := range im.Comment {
+		ic.Comments = append(ic.Comments, c.Id)
+	}
+	for _, e := range im.Event {
+		ic.Events = append(ic.Events, e.EventType)
+	}
+	for _, r := range im.Review {
+		ic.Reviews = append(ic.Reviews, r.Id)
+	}
+	return ic
+}
+
+func (n *Notifier) clChanges(gm *maintpb.GerritMutation) []*CLChange {
+	server, project, ok := strings.Cut(gm.Project, "/")
+	if !ok {
+		return nil
+	}
+	gp := n.c.Gerrit().Project(server, project)
+	if gp == nil {
+		return nil
+	}
+	byNum := make(map[int32]*CLChange)
+	var ccs []*CLChange
+	for _, ref := range gm.Refs {
+		num, ok := changeNumber(ref.Ref)
+		if !ok {
+			continue
+		}
+		cc := byNum[num]
+		if cc == nil {
+			cl := gp.CL(num)
+			if cl == nil {
+				continue
+			}
+			cc = &CLChange{Project: gm.Project, Number: num, Status: cl.Status}
+			byNum[num] = cc
+			ccs = append(ccs, cc)
+		}
+		cc.Refs = append(cc.Refs, ref.Ref)
+	}
+	return ccs
+}
+
+// changeNumber returns the CL number of a ref like
+// "refs/changes/45/12345/meta" or "refs/changes/45/12345/3".
+func changeNumber(ref string) (int32, bool) {
+	f := strings.Split(ref, "/")
+	if len(f) != 5 || f[0] != "refs" || f[1] != "changes" {
+		return 0, false
+	}
+	num, err := strconv.ParseInt(f[3], 10, 32)
+	if err != nil {
+		return 0, false
+	}
+	return int32(num), true
+}
+
+func (f *Filter) matches(ev *Event) bool {
+	switch {
+	case ev.Issue != nil:
+		ic := ev.Issue
+		if f.Repo != "" && f.Repo != ic.Repo || f.CLStatus != "" {
+			return false
+		}
+		if f.Label != "" && !containsFold(ic.Labels, f.Label) &&
+			!containsFold(ic.AddedLabels, f.Label) && !containsFold(ic.RemovedLabels, f.Label) {
+			return false
+		}
+		return true
+	case ev.CL != nil:
+		cc := ev.CL
+		if f.Repo != "" && f.Repo != cc.Project || f.Label != "" {
+			return false
+		}
+		return f.CLStatus == "" || f.CLStatus == cc.Status
+	}
+	return false
+}
+
+func containsFold(ss []string, s string) bool {
+	for _, v := range ss {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// RegisterHandlers registers the handlers that manage subscriptions
+// on mux.
+func (n *Notifier) RegisterHandlers(mux *http.ServeMux) {
+	mux.HandleFunc("/subscriptions", n.serveSubscriptions)
+	mux.HandleFunc("/subscriptions/", n.serveSubscription)
+}
+
+func (n *Notifier) authorized(w http.ResponseWriter, r *http.Request) bool {
+	got := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if n.token == "" || subtle.ConstantTimeCompare([]byte(got), []byte(n.token)) != 1 {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+func (n *Notifier) serveSubscriptions(w http.ResponseWriter, r *http.Request) {
+	if !n.authorized(w, r) {
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		n.mu.Lock()
+		subs := []Subscription{}
+		for _, s := range n.subs {
+			s := *s
+			s.Secret = ""
+			subs = append(subs, s)
+		}
+		n.mu.Unlock()
+		sort.Slice(subs, func(i, j int) bool { return subs[i].ID < subs[j].ID })
+		writeJSON(w, http.StatusOK, subs)
+	case http.MethodPost:
+		var s Subscription
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<10)).Decode(&s); err != nil {
+			http.Error(w, "invalid subscription: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if u, err := url.Parse(s.URL); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			http.Error(w, "invalid subscription: URL must be an absolute http or https URL", http.StatusBadRequest)
+			return
+		}
+		if err := s.Filter.validate(); err != nil {
+			http.Error(w, "invalid subscription: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.ID = newID()
+		stored := s
+		n.mu.Lock()
+		n.subs[s.ID] = &stored
+		n.mu.Unlock()
+		log.Printf("webhook: added subscription %s for %s with filter %+v", s.ID, s.URL, s.Filter)
+		s.Secret = ""
+		writeJSON(w, http.StatusCreated, s)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (n *Notifier) serveSubscription(w http.ResponseWriter, r *http.Request) {
+	if !n.authorized(w, r) {
+		return
+	}
+	if r.Method != http.MethodDelete {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	id := strings.TrimPrefix(r.URL.Path, "/subscriptions/")
+	n.mu.Lock()
+	_, ok := n.subs[id]
+	delete(n.subs, id)
+	n.mu.Unlock()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	log.Printf("webhook: deleted subscription %s", id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("webhook: writing response: %v", err)
+	}
+}
+
+func newID() string {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b[:])
+}
@@ -0,0 +1,200 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"golang.org/x/build/maintner"
+	"golang.org/x/build/maintner/maintpb"
+)
+
+// mutationSource is a maintner.MutationSource of fixed mutations.
+type mutationSource []*maintpb.Mutation
+
+func (s mutationSource) GetMutations(ctx context.Context) <-chan maintner.MutationStreamEvent {
+	ch := make(chan maintner.MutationStreamEvent, len(s)+1)
+	for _, m := range s {
+		ch <- maintner.MutationStreamEvent{Mutation: m}
+	}
+	ch <- maintner.MutationStreamEvent{End: true}
+	return ch
+}
+
+var labelMutation = &maintpb.Mutation{GithubIssue: &maintpb.GithubIssueMutation{
+	Owner:    "golang",
+	Repo:     "go",
+	Number:   1,
+	AddLabel: []*maintpb.GithubLabel{{Id: 2, Name: "NeedsFix"}},
+	Event:    []*maintpb.GithubIssueEvent{{Id: 10, EventType: "labeled"}},
+}}
+
+func testNotifier(t *testing.T) *Notifier {
+	t.Helper()
+	c := new(maintner.Corpus)
+	err := c.Initialize(context.Background(), mutationSource{
+		{GithubIssue: &maintpb.GithubIssueMutation{
+			Owner:    "golang",
+			Repo:     "go",
+			Number:   1,
+			Id:       1001,
+			Created:  &timestamp.Timestamp{Seconds: 1500000000},
+			Title:    "x/build: something's broken",
+			AddLabel: []*maintpb.GithubLabel{{Id: 1, Name: "Builders"}},
+		}},
+		labelMutation,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewNotifier(c, "secret-token")
+}
+
+func subscribe(t *testing.T, n *Notifier, s Subscription) Subscription {
+	t.Helper()
+	body, _ := json.Marshal(s)
+	req := httptest.NewRequest("POST", "/subscriptions", strings.NewReader(string(body)))
+	req.Header.Set("Authorization", "Bearer secret-token")
+	rec := httptest.NewRecorder()
+	n.serveSubscriptions(rec, req)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("subscribe: got status %d, want %d: %s", rec.Code, http.StatusCreated, rec.Body)
+	}
+	var got Subscription
+	if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if got.ID == "" || got.Secret != "" {
+		t.Errorf("subscribe returned %+v, want an ID and no secret", got)
+	}
+	return got
+}
+
+func TestDeliver(t *testing.T) {
+	n := testNotifier(t)
+
+	var (
+		gotBody []byte
+		gotSig  string
+		calls   int
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		gotBody, _ = io.ReadAll(r.Body)
+		gotSig = r.Header.Get("X-Maintner-Signature-256")
+	}))
+	defer srv.Close()
+
+	sub := subscribe(t, n, Subscription{URL: srv.URL, Filter: Filter{Repo: "golang/go", Label: "needsfix"}, Secret: "s3cret"})
+	subscribe(t, n, Subscription{URL: srv.URL, Filter: Filter{Label: "Documentation"}})
+	subscribe(t, n, Subscription{URL: srv.URL, Filter: Filter{CLStatus: "merged"}})
+
+	n.deliver(context.Background(), labelMutation)
+	if calls != 1 {
+		t.Fatalf("got %d deliveries, want 1", calls)
+	}
+	if want := Signature("s3cret", gotBody); gotSig != want {
+		t.Errorf("signature = %q, want %q", gotSig, want)
+	}
+	var ev Event
+	if err := json.Unmarshal(gotBody, &ev); err != nil {
+		t.Fatal(err)
+	}
+	want := Event{
+		Subscription: sub.ID,
+		Issue: &IssueChange{
+			Repo:        "golang/go",
+			Number:      1,
+			Labels:      []string{"Builders", "NeedsFix"},
+			AddedLabels: []string{"NeedsFix"},
+			Events:      []string{"labeled"},
+		},
+	}
+	if diff := cmp.Diff(want, ev, cmpopts.IgnoreFields(Event{}, "Time")); diff != "" {
+		t.Errorf("event mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestSubscriptionsAPI(t *testing.T) {
+	n := testNotifier(t)
+
+	req := httptest.NewRequest("GET", "/subscriptions", nil)
+	rec := httptest.NewRecorder()
+	n.serveSubscriptions(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("list without token: got status %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+
+	for _, body := range []string{
+		`{"url": "ftp://example.com/hook"}`,
+		`{"url": "https://example.com/hook", "filter": {"cl_status": "open"}}`,
+		`{"url": "https://example.com/hook", "filter": {"label": "NeedsFix", "cl_status": "new"}}`,
+	} {
+		req := httptest.NewRequest("POST", "/subscriptions", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer secret-token")
+		rec := httptest.NewRecorder()
+		n.serveSubscriptions(rec, req)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("subscribe with %s: got status %d, want %d", body, rec.Code, http.StatusBadRequest)
+		}
+	}
+
+	sub := subscribe(t, n, Subscription{URL: "https://example.com/hook", Secret: "s3cret"})
+	req = httptest.NewRequest("GET", "/subscriptions", nil)
+	req.Header.Set("Authorization", "Bearer secret-token")
+	rec = httptest.NewRecorder()
+	n.serveSubscriptions(rec, req)
+	var subs []Subscription
+	if err := json.NewDecoder(rec.Body).Decode(&subs); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]Subscription{sub}, subs); diff != "" {
+		t.Errorf("subscriptions mismatch (-want +got):\n%s", diff)
+	}
+
+	for _, want := range []int{http.StatusNoContent, http.StatusNotFound} {
+		req = httptest.NewRequest("DELETE", "/subscriptions/"+sub.ID, nil)
+		req.Header.Set("Authorization", "Bearer secret-token")
+		rec = httptest.NewRecorder()
+		n.serveSubscription(rec, req)
+		if rec.Code != want {
+			t.Errorf("delete: got status %d, want %d", rec.Code, want)
+		}
+	}
+}
+
+func TestFilterMatchesCL(t *testing.T) {
+	ev := &Event{CL: &CLChange{Project: "go.googlesource.com/build", Number: 123, Status: "merged"}}
+	for _, tc := range []struct {
+		f    Filter
+		want bool
+	}{
+		{Filter{}, true},
+		{Filter{Repo: "go.googlesource.com/build"}, true},
+		{Filter{Repo: "go.googlesource.com/go"}, false},
+		{Filter{CLStatus: "merged"}, true},
+		{Filter{CLStatus: "new"}, false},
+		{Filter{Label: "NeedsFix"}, false},
+	} {
+		if got := tc.f.matches(ev); got != tc.want {
+			t.Errorf("%+v.matches(CL) = %v, want %v", tc.f, got, tc.want)
+		}
+	}
+	if num, ok := changeNumber("refs/changes/23/123/meta"); !ok || num != 123 {
+		t.Errorf("changeNumber(meta ref) = %v, %v, want 123, true", num, ok)
+	}
+	if _, ok := changeNumber("refs/heads/master"); ok {
+		t.Errorf("changeNumber(branch) = _, true, want false")
+	}
+}
@@ -0,0 +1,152 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package mutenc encodes and decodes the maintner mutation records
+// stored in reclog-formatted mutation logs.
+//
+// Two encodings exist. Version 1 records are the plain proto3 binary
+// encoding of a *maintpb.Mutation. Version 2 records start with an
+// explicit schema version, followed by a flags byte and the proto3
+// binary encoding of the mutation, so that readers can tell which
+// schema a record uses without trying to parse it.
+//
+// Records aren't compressed individually: inflating each record would
+// cost more on a full sync than the bytes it saves. Compression, if
+// any, belongs to whole log segments.
+//
+// Readers accept both encodings, even interleaved in the same log, so
+// that logs can be migrated from version 1 to version 2 while both are
+// being written.
+package mutenc
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/build/maintner/maintpb"
+)
+
+// A Format is a mutation record encoding.
+type Format int
+
+const (
+	// V1 is the original encoding: the proto3 binary encoding of a
+	// *maintpb.Mutation, with no header.
+	V1 Format = 1
+	// V2 is the explicitly versioned encoding.
+	V2 Format = 2
+)
+
+func (f Format) String() string {
+	switch f {
+	case V1:
+		return "v1"
+	case V2:
+		return "v2"
+	}
+	return fmt.Sprintf("Format(%d)", int(f))
+}
+
+// ParseFormat parses the name of a format, as returned by Format.String.
+func ParseFormat(s string) (Format, error) {
+	switch s {
+	case "v1":
+		return V1, nil
+	case "v2":
+		return V2, nil
+	}
+	return 0, fmt.Errorf("unknown mutation format %q", s)
+}
+
+// A version 2 record is laid out as:
+//
+//	0x00 <uvarint schema version> <flags byte> <payload>
+//
+// A proto3 encoding never starts with a zero byte, as that would be
+// field number 0, so the leading zero distinguishes version 2 records
+// from version 1 records. The payload is the proto3 binary encoding of
+// the mutation. No flags are defined yet; they're reserved for changes
+// to the payload that older readers must reject.
+const v2Magic = 0x00
+
+var errUnknownFlags = errors.New("mutenc: unknown flags in version 2 record")
+
+// FormatOf reports the format of the encoded record rec.
+// It returns 0 if rec is in an unknown format.
+func FormatOf(rec []byte) Format {
+	if len(rec) == 0 || rec[0] != v2Magic {
+		return V1
+	}
+	v, n := binary.Uvarint(rec[1:])
+	if n <= 0 || v != uint64(V2) {
+		return 0
+	}
+	return V2
+}
+
+// Marshal returns the encoding of m in format f.
+func Marshal(m *maintpb.Mutation, f Format) ([]byte, error) {
+	data, err := proto.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	switch f {
+	case V1:
+		return data, nil
+	case V2:
+		return encodeV2(data)
+	}
+	return nil, fmt.Errorf("mutenc: can't marshal %v", f)
+}
+
+func encodeV2(data []byte) ([]byte, error) {
+	var hdr [1 + binary.MaxVarintLen64 + 1]byte
+	hdr[0] = v2Magic
+	n := 1 + binary.PutUvarint(hdr[1:], uint64(V2))
+	hdr[n] = 0 // flags
+	n++
+	return append(hdr[:n:n], data...), nil
+}
+
+// Unmarshal decodes the record rec, in either format, into m.
+func Unmarshal(rec []byte, m *maintpb.Mutation) error {
+	switch FormatOf(rec) {
+	case V1:
+		return proto.Unmarshal(rec, m)
+	case V2:
+		data, err := decodeV2(rec)
+		if err != nil {
+			return err
+		}
+		return proto.Unmarshal(data, m)
+	}
+	return errors.New("mutenc: record in unknown format")
+}
+
+func decodeV2(rec []byte) ([]byte, error) {
+	_, n := binary.Uvarint(rec[1:])
+	rest := rec[1+n:]
+	if len(rest) == 0 {
+		return nil, errors.New("mutenc: truncated version 2 record")
+	}
+	flags, payload := rest[0], rest[1:]
+	if flags != 0 {
+		return nil, errUnknownFlags
+	}
+	return payload, nil
+}
+
+// Convert re-encodes the record rec, in either format, in format f.
+func Convert(rec []byte, f Format) ([]byte, error) {
+	if FormatOf(rec) == f {
+		return rec, nil
+	}
+	m := new(maintpb.Mutation)
+	if err := Unmarshal(rec, m); err != nil {
+		return nil, err
+	}
+	return Marshal(m, f)
+}
@@ -0,0 +1,118 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mutenc
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/build/maintner/maintpb"
+)
+
+func testMutations() []*maintpb.Mutation {
+	return []*maintpb.Mutation{
+		{},
+		{GithubIssue: &maintpb.GithubIssueMutation{Owner: "golang", Repo: "go", Number: 1}},
+		{GithubIssue: &maintpb.GithubIssueMutation{
+			Owner:      "golang",
+			Repo:       "go",
+			Number:     12345,
+			Title:      "cmd/go: something is broken",
+			BodyChange: &maintpb.StringChange{Val: strings.Repeat("Reviewed-on: https://go-review.googlesource.com/c/go/+/1234\n", 20)},
+		}},
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, f := range []Format{V1, V2} {
+		for _, m := range testMutations() {
+			rec, err := Marshal(m, f)
+			if err != nil {
+				t.Fatalf("Marshal(%v, %v) = %v", m, f, err)
+			}
+			if got := FormatOf(rec); got != f {
+				t.Errorf("FormatOf(Marshal(%v, %v)) = %v", m, f, got)
+			}
+			got := new(maintpb.Mutation)
+			if err := Unmarshal(rec, got); err != nil {
+				t.Fatalf("Unmarshal(Marshal(%v, %v)) = %v", m, f, err)
+			}
+			if !proto.Equal(got, m) {
+				t.Errorf("Unmarshal(Marshal(%v, %v)) = %v", m, f, got)
+			}
+		}
+	}
+}
+
+func TestV2Payload(t *testing.T) {
+	// Version 2 records only add a header to version 1 records, so
+	// they decode as fast.
+	for _, m := range testMutations() {
+		v1, err := Marshal(m, V1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		v2, err := Marshal(m, V2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := append([]byte{v2Magic, byte(V2), 0}, v1...); string(v2) != string(want) {
+			t.Errorf("Marshal(%v, V2) = %x; want %x", m, v2, want)
+		}
+	}
+}
+
+func TestConvert(t *testing.T) {
+	for _, m := range testMutations() {
+		v1, err := Marshal(m, V1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		v2, err := Convert(v1, V2)
+		if err != nil {
+			t.Fatalf("Convert(_, V2) = %v", err)
+		}
+		back, err := Convert(v2, V1)
+		if err != nil {
+			t.Fatalf("Convert(_, V1) = %v", err)
+		}
+		if string(back) != string(v1) {
+			t.Errorf("Convert(Convert(%x, V2), V1) = %x; want original", v1, back)
+		}
+	}
+}
+
+func TestUnknownVersion(t *testing.T) {
+	rec := []byte{v2Magic, 3, 0}
+	if f := FormatOf(rec); f != 0 {
+		t.Errorf("FormatOf(%x) = %v; want 0", rec, f)
+	}
+	if err := Unmarshal(rec, new(maintpb.Mutation)); err == nil {
+		t.Errorf("Unmarshal(%x) succeeded; want error", rec)
+	}
+	rec = []byte{v2Magic, byte(V2), 0x80}
+	if err := Unmarshal(rec, new(maintpb.Mutation)); err != errUnknownFlags {
+		t.Errorf("Unmarshal(%x) = %v; want %v", rec, err, errUnknownFlags)
+	}
+}
+
+func BenchmarkUnmarshal(b *testing.B) {
+	m := testMutations()[2]
+	for _, f := range []Format{V1, V2} {
+		rec, err := Marshal(m, f)
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.Run(f.String(), func(b *testing.B) {
+			b.SetBytes(int64(len(rec)))
+			for i := 0; i < b.N; i++ {
+				if err := Unmarshal(rec, new(maintpb.Mutation)); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -21,11 +21,12 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
-	"github.com/golang/protobuf/proto"
 	"golang.org/x/build/maintner/internal/robustio"
 	"golang.org/x/build/maintner/maintpb"
+	"golang.org/x/build/maintner/mutenc"
 	"golang.org/x/build/maintner/reclog"
 )
 
@@ -119,7 +120,7 @@ func TailNetworkMutationSource(ctx context.Context, server string, fn func(Mutat
 			}
 			if err := reclog.ForeachRecord(bytes.NewReader(newData), off, func(off int64, hdr, rec []byte) error {
 				m := new(maintpb.Mutation)
-				if err := proto.Unmarshal(rec, m); err != nil {
+				if err := mutenc.Unmarshal(rec, m); err != nil {
 					return err
 				}
 				return fn(MutationStreamEvent{Mutation: m})
@@ -141,6 +142,9 @@ type netMutSource struct {
 	last  []fileSeg
 	quiet bool // disable verbose logging
 
+	mu     sync.Mutex
+	loaded []fileSeg // segments whose mutations were sent; guarded by mu
+
 	// Hooks for testing. If nil, unused:
 	testHookGetServerSegments func(context.Context, int64) ([]LogSegmentJSON, error)
 	testHookSyncSeg           func(context.Context, LogSegmentJSON) (fileSeg, []byte, error)
@@ -506,7 +510,45 @@ func (ns *netMutSource) fetchAndSendMutations(ctx context.Context, ch chan<- Mut
 	if err != nil {
 		return err
 	}
-	return foreachFileSeg(newSegs, func(seg fileSeg) error {
+	err = foreachSegMutation(newSegs, func(m *maintpb.Mutation) error {
+		select {
+		case ch <- MutationStreamEvent{Mutation: m}:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+	if err != nil {
+		return err
+	}
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+	if ns.last != nil {
+		ns.loaded = ns.last
+	} else {
+		// Offline, with all the locally cached segments.
+		ns.loaded = newSegs
+	}
+	return nil
+}
+
+// replayMutations calls fn with each mutation sent so far, in order.
+// It doesn't filter them by sel.
+func (ns *netMutSource) replayMutations(ctx context.Context, sel *loadFilter, fn func(*maintpb.Mutation) error) error {
+	ns.mu.Lock()
+	segs := ns.loaded
+	ns.mu.Unlock()
+	return foreachSegMutation(segs, func(m *maintpb.Mutation) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		return fn(m)
+	})
+}
+
+// foreachSegMutation calls fn with each mutation in segs, in order.
+func foreachSegMutation(segs []fileSeg, fn func(*maintpb.Mutation) error) error {
+	return foreachFileSeg(segs, func(seg fileSeg) error {
 		f, err := os.Open(seg.file)
 		if err != nil {
 			return err
@@ -519,15 +561,10 @@ func (ns *netMutSource) fetchAndSendMutations(ctx context.Context, ch chan<- Mut
 		}
 		return reclog.ForeachRecord(io.LimitReader(f, seg.size-seg.skip), seg.skip, func(off int64, hdr, rec []byte) error {
 			m := new(maintpb.Mutation)
-			if err := proto.Unmarshal(rec, m); err != nil {
+			if err := mutenc.Unmarshal(rec, m); err != nil {
 				return err
 			}
-			select {
-			case ch <- MutationStreamEvent{Mutation: m}:
-				return nil
-			case <-ctx.Done():
-				return ctx.Err()
-			}
+			return fn(m)
 		})
 	})
 }
@@ -0,0 +1,300 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package maintner
+
+import (
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// An XRefKind is the kind of a cross-reference.
+type XRefKind string
+
+const (
+	// XRefFixes is a reference to an issue that the source fixes,
+	// as in a "Fixes #123" line of a commit message, or a GitHub
+	// issue closed by a commit.
+	XRefFixes XRefKind = "fixes"
+	// XRefUpdates is a reference to an issue that the source is
+	// related to, as in an "Updates #123" or "For #123" line.
+	XRefUpdates XRefKind = "updates"
+	// XRefMentions is any other reference, such as a CL mentioned
+	// in an issue comment.
+	XRefMentions XRefKind = "mentions"
+	// XRefMerged is a reference from a merged CL to its commit.
+	XRefMerged XRefKind = "merged"
+)
+
+// A GerritCLRef identifies a Gerrit CL. CL numbers are unique per
+// Gerrit server, so references to CLs don't need the project, and
+// may refer to CLs the corpus doesn't track.
+type GerritCLRef struct {
+	Server string // as in GerritProject.Server, such as "go.googlesource.com"
+	Number int32
+}
+
+func (r GerritCLRef) String() string { return fmt.Sprintf("%s/cl/%d", r.Server, r.Number) }
+
+// An XRefItem is an item of the corpus that can refer or be referred
+// to: a GitHub issue, a Gerrit CL, or a Git commit. Exactly one of its
+// fields is set.
+type XRefItem struct {
+	Issue  GitHubIssueRef // Issue.Repo is nil if the item isn't an issue
+	CL     GerritCLRef    // CL.Server is empty if the item isn't a CL
+	Commit GitHash        // empty if the item isn't a commit
+}
+
+func (it XRefItem) String() string {
+	switch {
+	case it.Issue.Repo != nil:
+		return it.Issue.String()
+	case it.CL.Server != "":
+		return it.CL.String()
+	}
+	return it.Commit.String()
+}
+
+// An XRef is a cross-reference from one item of the corpus to another.
+type XRef struct {
+	From, To XRefItem
+	Kind     XRefKind
+}
+
+// xrefStrength ranks the kinds of references, so that of several
+// references between the same items the most specific one is kept.
+var xrefStrength = map[XRefKind]int{
+	XRefMentions: 1,
+	XRefUpdates:  2,
+	XRefFixes:    3,
+	XRefMerged:   4,
+}
+
+// An xrefSource is a piece of text or metadata that references are
+// extracted from: a CL, or the body, a comment, or an event of an
+// issue.
+type xrefSource struct {
+	item    XRefItem
+	comment int64 // GitHub comment ID, or 0
+	event   int64 // GitHub event ID, or 0
+}
+
+// xrefIndex indexes the cross-references of a corpus by their source,
+// so that they can be replaced when the source changes, and by the
+// items they refer from and to.
+//
+// Its zero value is ready to use.
+type xrefIndex struct {
+	bySource map[xrefSource][]XRef
+	from     map[XRefItem]map[xrefSource]bool
+	to       map[XRefItem]map[xrefSource]bool
+}
+
+// set replaces the references extracted from src with refs.
+func (x *xrefIndex) set(src xrefSource, refs []XRef) {
+	if len(refs) == 0 && len(x.bySource[src]) == 0 {
+		return
+	}
+	if x.bySource == nil {
+		x.bySource = make(map[xrefSource][]XRef)
+		x.from = make(map[XRefItem]map[xrefSource]bool)
+		x.to = make(map[XRefItem]map[xrefSource]bool)
+	}
+	for _, r := range x.bySource[src] {
+		unlinkXRefSource(x.from, r.From, src)
+		unlinkXRefSource(x.to, r.To, src)
+	}
+	if len(refs) == 0 {
+		delete(x.bySource, src)
+		return
+	}
+	x.bySource[src] = refs
+	for _, r := range refs {
+		linkXRefSource(x.from, r.From, src)
+		linkXRefSource(x.to, r.To, src)
+	}
+}
+
+func linkXRefSource(m map[XRefItem]map[xrefSource]bool, it XRefItem, src xrefSource) {
+	if m[it] == nil {
+		m[it] = make(map[xrefSource]bool)
+	}
+	m[it][src] = true
+}
+
+func unlinkXRefSource(m map[XRefItem]map[xrefSource]bool, it XRefItem, src xrefSource) {
+	delete(m[it], src)
+	if len(m[it]) == 0 {
+		delete(m, it)
+	}
+}
+
+// lookup returns the references in the sources srcs that match,
+// keeping the most specific one between any two items, sorted by
+// source and then target.
+func (x *xrefIndex) lookup(srcs map[xrefSource]bool, match func(XRef) bool) []XRef {
+	type pair struct{ from, to XRefItem }
+	best := make(map[pair]XRef)
+	for src := range srcs {
+		for _, r := range x.bySource[src] {
+			if !match(r) {
+				continue
+			}
+			p := pair{r.From, r.To}
+			if old, ok := best[p]; !ok || xrefStrength[r.Kind] > xrefStrength[old.Kind] {
+				best[p] = r
+			}
+		}
+	}
+	refs := make([]XRef, 0, len(best))
+	for _, r := range best {
+		refs = append(refs, r)
+	}
+	sort.Slice(refs, func(i, j int) bool {
+		if fi, fj := refs[i].From.String(), refs[j].From.String(); fi != fj {
+			return fi < fj
+		}
+		return refs[i].To.String() < refs[j].To.String()
+	})
+	return refs
+}
+
+// XRefsFrom returns the cross-references from it to other items: the
+// issues that a CL's commit message refers to, the CLs that an issue
+// or its comments mention, and the commit of a merged CL.
+//
+// Of several references between the same two items, only the most
+// specific one is returned. For example, a CL whose commit message
+// says both "Updates #1" and "Fixes #1" fixes issue 1.
+func (c *Corpus) XRefsFrom(it XRefItem) []XRef {
+	return c.xrefs.lookup(c.xrefs.from[it], func(r XRef) bool { return r.From == it })
+}
+
+// XRefsTo returns the cross-references from other items to it. See
+// XRefsFrom.
+func (c *Corpus) XRefsTo(it XRefItem) []XRef {
+	return c.xrefs.lookup(c.xrefs.to[it], func(r XRef) bool { return r.To == it })
+}
+
+// CLOfRef returns the CL that ref identifies, or nil if the corpus
+// doesn't track it.
+func (c *Corpus) CLOfRef(ref GerritCLRef) *GerritCL {
+	for _, gp := range c.Gerrit().projects {
+		if gp.Server() != ref.Server {
+			continue
+		}
+		if cl := gp.CL(ref.Number); cl != nil {
+			return cl
+		}
+	}
+	return nil
+}
+
+// updateCLXRefs updates the cross-references from cl: the GitHub
+// issues its commit message refers to and, once it's merged, its
+// commit.
+//
+// c.mu must be held.
+func (c *Corpus) updateCLXRefs(cl *GerritCL) {
+	if cl.Commit == nil {
+		return
+	}
+	from := XRefItem{CL: GerritCLRef{Server: cl.Project.Server(), Number: cl.Number}}
+	var refs []XRef
+	for _, line := range strings.Split(cl.Commit.Msg, "\n") {
+		if !strings.Contains(line, "#") {
+			continue
+		}
+		kind := xrefKindOfLine(line)
+		for _, ref := range c.parseGithubRefs(cl.Project.ServerSlashProject(), line) {
+			refs = append(refs, XRef{From: from, To: XRefItem{Issue: ref}, Kind: kind})
+		}
+	}
+	if cl.Status == "merged" {
+		refs = append(refs, XRef{From: from, To: XRefItem{Commit: cl.Commit.Hash}, Kind: XRefMerged})
+	}
+	c.xrefs.set(xrefSource{item: from}, refs)
+}
+
+// xrefKindOfLine returns the kind of the references to issues in a
+// line of a commit message, based on its first word.
+func xrefKindOfLine(line string) XRefKind {
+	word, _, _ := strings.Cut(strings.TrimSpace(line), " ")
+	switch strings.ToLower(strings.TrimSuffix(word, ":")) {
+	case "fixes", "fix", "fixed", "closes", "close", "closed", "resolves", "resolve", "resolved":
+		return XRefFixes
+	case "updates", "update", "for", "see":
+		return XRefUpdates
+	}
+	return XRefMentions
+}
+
+// rxCLMentions matches links to CLs and "CL 123" mentions in GitHub
+// issues. The first submatch is the Gerrit host of a review URL, if
+// any, and one of the others is the CL number.
+var rxCLMentions = regexp.MustCompile(`https?://([\w\-]+)-review\.googlesource\.com/(?:c/[\w\-./]+/\+/|#/c/)?(\d+)\b|\b(?:golang\.org|go\.dev)/cl/(\d+)\b|\bCL (\d+)\b`)
+
+// updateIssueTextXRefs updates the cross-references from the body of
+// issue ref, or from its comment commentID if it's not 0, whose text
+// is body.
+//
+// c.mu must be held.
+func (c *Corpus) updateIssueTextXRefs(ref GitHubIssueRef, commentID int64, body string) {
+	from := XRefItem{Issue: ref}
+	var refs []XRef
+	if strings.Contains(body, "CL ") || strings.Contains(body, "/cl/") || strings.Contains(body, "-review.googlesource.com/") {
+		// "CL 123" is only meaningful in the Go project, which
+		// reviews all its repos on go-review.googlesource.com.
+		golang := ref.Repo.ID().Owner == "golang"
+		for _, m := range rxCLMentions.FindAllStringSubmatch(body, -1) {
+			server, num := "go.googlesource.com", m[3]
+			switch {
+			case m[1] != "":
+				server, num = m[1]+".googlesource.com", m[2]
+			case m[4] != "":
+				if !golang {
+					continue
+				}
+				num = m[4]
+			}
+			n, err := strconv.ParseInt(num, 10, 32)
+			if err != nil {
+				continue
+			}
+			refs = append(refs, XRef{From: from, To: XRefItem{CL: GerritCLRef{Server: server, Number: int32(n)}}, Kind: XRefMentions})
+		}
+	}
+	c.xrefs.set(xrefSource{item: from, comment: commentID}, refs)
+}
+
+// updateIssueEventXRefs updates the cross-references from the commit
+// of event e of issue ref, if any, to the issue.
+//
+// c.mu must be held.
+func (c *Corpus) updateIssueEventXRefs(ref GitHubIssueRef, e *GitHubIssueEvent) {
+	to := XRefItem{Issue: ref}
+	var refs []XRef
+	if _, err := ParseGitHash(e.CommitID); err == nil {
+		kind := XRefMentions
+		if e.Type == "closed" {
+			kind = XRefFixes
+		}
+		hash := c.gitHashFromHexStr(e.CommitID)
+		refs = append(refs, XRef{From: XRefItem{Commit: hash}, To: to, Kind: kind})
+	}
+	c.xrefs.set(xrefSource{item: to, event: e.ID}, refs)
+}
+
+// ParseGitHash parses a full hexadecimal Git commit hash.
+func ParseGitHash(s string) (GitHash, error) {
+	b, err := hex.DecodeString(s)
+	if err != nil || len(b) != 20 {
+		return "", fmt.Errorf("invalid git hash %q", s)
+	}
+	return GitHash(b), nil
+}
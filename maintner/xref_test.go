@@ -0,0 +1,143 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package maintner
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/build/maintner/maintpb"
+)
+
+// xrefStrings formats refs for comparison.
+func xrefStrings(refs []XRef) []string {
+	var s []string
+	for _, r := range refs {
+		s = append(s, r.From.String()+" "+string(r.Kind)+" "+r.To.String())
+	}
+	return s
+}
+
+func TestXRefKindOfLine(t *testing.T) {
+	tests := []struct {
+		line string
+		want XRefKind
+	}{
+		{"Fixes #1234", XRefFixes},
+		{"fixes golang/go#1234.", XRefFixes},
+		{"Closes: #1", XRefFixes},
+		{"Updates #1234", XRefUpdates},
+		{"For #1234.", XRefUpdates},
+		{"  See golang/go#1", XRefUpdates},
+		{"This works around #1234.", XRefMentions},
+		{"#1234", XRefMentions},
+	}
+	for _, tt := range tests {
+		if got := xrefKindOfLine(tt.line); got != tt.want {
+			t.Errorf("xrefKindOfLine(%q) = %q; want %q", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestIssueXRefs(t *testing.T) {
+	const commit = "5383ecf5a0824649ffcc0349f00f0317575753d0"
+	c := new(Corpus)
+	c.processMutationLocked(&maintpb.Mutation{GithubIssue: &maintpb.GithubIssueMutation{
+		Owner:   "golang",
+		Repo:    "go",
+		Number:  1,
+		Created: p3339("2023-04-01T12:00:00Z"),
+		Body:    "Regressed in go.dev/cl/100 and https://go-review.googlesource.com/c/go/+/101.",
+		Comment: []*maintpb.GithubIssueCommentMutation{
+			{Id: 10, Body: "Change https://go.dev/cl/102 mentions this issue: `fix it`"},
+			{Id: 11, Body: "CL 102 looks good, and so does CL 103."},
+		},
+		Event: []*maintpb.GithubIssueEvent{
+			{Id: 20, EventType: "closed", Commit: &maintpb.GithubCommit{CommitId: commit}},
+		},
+	}})
+	issue := XRefItem{Issue: GitHubIssueRef{c.GitHub().Repo("golang", "go"), 1}}
+
+	got := xrefStrings(c.XRefsFrom(issue))
+	want := []string{
+		"golang/go#1 mentions go.googlesource.com/cl/100",
+		"golang/go#1 mentions go.googlesource.com/cl/101",
+		"golang/go#1 mentions go.googlesource.com/cl/102",
+		"golang/go#1 mentions go.googlesource.com/cl/103",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("XRefsFrom(%v) = %q; want %q", issue, got, want)
+	}
+
+	got = xrefStrings(c.XRefsTo(issue))
+	want = []string{commit + " fixes golang/go#1"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("XRefsTo(%v) = %q; want %q", issue, got, want)
+	}
+	hash, err := ParseGitHash(strings.ToUpper(commit))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := xrefStrings(c.XRefsFrom(XRefItem{Commit: hash})); !reflect.DeepEqual(got, want) {
+		t.Errorf("XRefsFrom(commit) = %q; want %q", got, want)
+	}
+
+	// Editing a comment replaces its references.
+	c.processMutationLocked(&maintpb.Mutation{GithubIssue: &maintpb.GithubIssueMutation{
+		Owner:   "golang",
+		Repo:    "go",
+		Number:  1,
+		Comment: []*maintpb.GithubIssueCommentMutation{{Id: 11, Body: "Never mind."}},
+	}})
+	cl103 := XRefItem{CL: GerritCLRef{"go.googlesource.com", 103}}
+	if got := c.XRefsTo(cl103); len(got) != 0 {
+		t.Errorf("after edit, XRefsTo(%v) = %q; want none", cl103, xrefStrings(got))
+	}
+	cl102 := XRefItem{CL: GerritCLRef{"go.googlesource.com", 102}}
+	if got := c.XRefsTo(cl102); len(got) != 1 {
+		t.Errorf("after edit, XRefsTo(%v) = %q; want one reference", cl102, xrefStrings(got))
+	}
+}
+
+func TestCLXRefs(t *testing.T) {
+	c := new(Corpus)
+	c.initGerrit()
+	gp := c.gerrit.getOrCreateProject("go.googlesource.com/go")
+	cl := gp.getOrCreateCL(200)
+	cl.Commit = &GitCommit{
+		Hash: GitHash(strings.Repeat("\x01", 20)),
+		Msg:  "cmd/go: fix something\n\nThis is like #1.\n\nUpdates #1\nFixes #2\nFor golang/go#3\n",
+	}
+	c.updateCLXRefs(cl)
+
+	it := XRefItem{CL: GerritCLRef{"go.googlesource.com", 200}}
+	got := xrefStrings(c.XRefsFrom(it))
+	want := []string{
+		"go.googlesource.com/cl/200 updates golang/go#1",
+		"go.googlesource.com/cl/200 fixes golang/go#2",
+		"go.googlesource.com/cl/200 updates golang/go#3",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("XRefsFrom(%v) = %q; want %q", it, got, want)
+	}
+
+	cl.Status = "merged"
+	c.updateCLXRefs(cl)
+	got = xrefStrings(c.XRefsFrom(it))
+	want = append([]string{"go.googlesource.com/cl/200 merged 0101010101010101010101010101010101010101"}, want...)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("after merge, XRefsFrom(%v) = %q; want %q", it, got, want)
+	}
+
+	if got := c.CLOfRef(it.CL); got != nil {
+		t.Errorf("CLOfRef(%v) = %v for an incomplete CL; want nil", it.CL, got)
+	}
+	cl.Meta = &GerritMeta{Commit: cl.Commit}
+	cl.Metas = []*GerritMeta{cl.Meta}
+	if got := c.CLOfRef(it.CL); got != cl {
+		t.Errorf("CLOfRef(%v) = %v; want CL 200", it.CL, got)
+	}
+}
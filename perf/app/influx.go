@@ -392,6 +392,7 @@ comparisonLoop:
 				experimentCommit := cs.HashPairs[series].NumHash   // field
 				repository := residues["repository"]               // tag
 				branch := residues["branch"]                       // tag
+				hardwareID := residues["hardware-id"]              // field
 
 				// cmd/bench didn't set repository prior to
 				// CL 413915. Older runs are all against go.
@@ -412,6 +413,7 @@ comparisonLoop:
 					"benchmarks-commit": benchmarksCommit,
 					"baseline-commit":   baselineCommit,
 					"experiment-commit": experimentCommit,
+					"hardware-id":       hardwareID,
 				}
 				tags := map[string]string{
 					"name":       benchmarkName,
@@ -42,5 +42,7 @@ func main() {
 	log.Printf("Serving...")
 
 	ctx := context.Background()
-	log.Fatal(https.ListenAndServe(ctx, mux))
+	if err := https.ListenAndServe(ctx, mux); err != nil {
+		log.Fatal(err)
+	}
 }
@@ -35,6 +35,11 @@ type App struct {
 	// BaseDir is the directory containing the "template" directory.
 	// If empty, the current directory will be used.
 	BaseDir string
+
+	// Namespaces are the private namespaces, keyed by name. Requests
+	// select a namespace with the "namespace" parameter; without it,
+	// they use the public namespace.
+	Namespaces map[string]*Namespace
 }
 
 // ErrResponseWritten can be returned by App.Auth to abort the normal /upload handling.
@@ -47,6 +52,7 @@ func (a *App) RegisterOnMux(mux *http.ServeMux) {
 	mux.HandleFunc("/upload", a.upload)
 	mux.HandleFunc("/search", a.search)
 	mux.HandleFunc("/uploads", a.uploads)
+	mux.HandleFunc("/hardware", a.hardware)
 }
 
 // index serves the readme on /
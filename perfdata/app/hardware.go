@@ -0,0 +1,68 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"golang.org/x/build/perfdata"
+)
+
+// hardware is the handler for the /hardware endpoint. GET requests
+// list the hardware inventory, optionally restricted to the builder
+// named by the "builder" parameter. POST requests record the
+// hardware a builder is running on; subsequent uploads of results
+// with that "builder" label are labeled with its "hardware-id".
+func (a *App) hardware(w http.ResponseWriter, r *http.Request) {
+	ctx := requestContext(r)
+
+	switch r.Method {
+	case http.MethodGet:
+		hw, err := a.DB.ListHardware(r.FormValue("builder"))
+		if err != nil {
+			errorf(ctx, "%v", err)
+			http.Error(w, err.Error(), 500)
+			return
+		}
+		if hw == nil {
+			hw = []*perfdata.Hardware{}
+		}
+		writeJSON(w, hw)
+	case http.MethodPost:
+		_, err := a.Auth(w, r)
+		switch {
+		case err == ErrResponseWritten:
+			return
+		case err != nil:
+			errorf(ctx, "%v", err)
+			http.Error(w, err.Error(), 500)
+			return
+		}
+		var h perfdata.Hardware
+		if err := json.NewDecoder(r.Body).Decode(&h); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if h.Builder == "" || h.CPU == "" || h.Memory == "" || h.Kernel == "" {
+			http.Error(w, "builder, cpu, memory, and kernel are required", http.StatusBadRequest)
+			return
+		}
+		rec, err := a.DB.RecordHardware(&h)
+		if err != nil {
+			errorf(ctx, "%v", err)
+			http.Error(w, err.Error(), 500)
+			return
+		}
+		writeJSON(w, rec)
+	default:
+		http.Error(w, "/hardware must be called as a GET or POST request", http.StatusMethodNotAllowed)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
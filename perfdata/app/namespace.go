@@ -0,0 +1,76 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// A Namespace is a private namespace of benchmark results, such as
+// pre-publication or security-sensitive ones. Results uploaded to it
+// are only returned by queries of the namespace, which only its
+// readers and writers may make.
+//
+// The entries of Readers and Writers are user names as returned by
+// App.Auth, or domains like "@golang.org" that match all the users
+// whose names end with them.
+type Namespace struct {
+	Readers []string // users that may query the namespace
+	Writers []string // users that may upload to and query the namespace
+}
+
+// allows reports whether user may query the namespace or, if write is
+// true, upload to it.
+func (n *Namespace) allows(user string, write bool) bool {
+	if user == "" {
+		return false
+	}
+	match := func(acl []string) bool {
+		for _, e := range acl {
+			if e == user || strings.HasPrefix(e, "@") && strings.HasSuffix(user, e) {
+				return true
+			}
+		}
+		return false
+	}
+	return match(n.Writers) || !write && match(n.Readers)
+}
+
+// checkNamespace reports whether the request may use the namespace
+// ns, uploading to it if write is true. The public namespace "" may
+// always be queried. If the request may not use ns, checkNamespace
+// writes an error response.
+//
+// user is the result of App.Auth, if it was already called, and
+// otherwise "", in which case checkNamespace calls it if needed.
+func (a *App) checkNamespace(w http.ResponseWriter, r *http.Request, ns, user string, write bool) bool {
+	if ns == "" {
+		return true
+	}
+	n, ok := a.Namespaces[ns]
+	if !ok {
+		http.Error(w, fmt.Sprintf("unknown namespace %q", ns), http.StatusNotFound)
+		return false
+	}
+	if user == "" {
+		var err error
+		user, err = a.Auth(w, r)
+		switch {
+		case err == ErrResponseWritten:
+			return false
+		case err != nil:
+			errorf(requestContext(r), "%v", err)
+			http.Error(w, err.Error(), 500)
+			return false
+		}
+	}
+	if !n.allows(user, write) {
+		http.Error(w, fmt.Sprintf("%s may not access namespace %q", user, ns), http.StatusForbidden)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,135 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build cgo
+// +build cgo
+
+package app
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"golang.org/x/build/perfdata"
+)
+
+func TestNamespaceAllows(t *testing.T) {
+	n := &Namespace{
+		Readers: []string{"reader@example.com", "@golang.org"},
+		Writers: []string{"writer@example.com"},
+	}
+	tests := []struct {
+		user        string
+		read, write bool
+	}{
+		{"reader@example.com", true, false},
+		{"gopher@golang.org", true, false},
+		{"writer@example.com", true, true},
+		{"other@example.com", false, false},
+		{"gopher@notgolang.org", false, false},
+		{"", false, false},
+	}
+	for _, test := range tests {
+		if got := n.allows(test.user, false); got != test.read {
+			t.Errorf("allows(%q, read) = %v, want %v", test.user, got, test.read)
+		}
+		if got := n.allows(test.user, true); got != test.write {
+			t.Errorf("allows(%q, write) = %v, want %v", test.user, got, test.write)
+		}
+	}
+}
+
+func TestNamespaces(t *testing.T) {
+	app := createTestApp(t)
+	defer app.Close()
+	app.app.Namespaces = map[string]*Namespace{
+		"secret":   {Writers: []string{"user"}},
+		"readonly": {Readers: []string{"user"}},
+		"others":   {Writers: []string{"someone-else"}},
+	}
+	ctx := context.Background()
+
+	upload := func(ns, content string) (*perfdata.UploadStatus, error) {
+		c := &perfdata.Client{BaseURL: app.srv.URL, Namespace: ns}
+		u := c.NewUpload(ctx)
+		w, err := u.CreateFile("1.txt")
+		if err != nil {
+			u.Abort()
+			return nil, err
+		}
+		fmt.Fprint(w, content)
+		return u.Commit()
+	}
+	query := func(ns, q string) (string, error) {
+		c := &perfdata.Client{BaseURL: app.srv.URL, Namespace: ns}
+		r, err := c.Query(ctx, q)
+		if err != nil {
+			return "", err
+		}
+		defer r.Close()
+		b, err := io.ReadAll(r)
+		return string(b), err
+	}
+
+	if _, err := upload("", "key: public\nBenchmarkOne 5 ns/op\n"); err != nil {
+		t.Fatalf("public upload: %v", err)
+	}
+	status, err := upload("secret", "key: secret\nBenchmarkTwo 10 ns/op\n")
+	if err != nil {
+		t.Fatalf("upload to secret: %v", err)
+	}
+	if status.ViewURL != "" {
+		t.Errorf("upload to secret has view URL %q, want none", status.ViewURL)
+	}
+	for _, ns := range []string{"readonly", "others", "unknown"} {
+		if _, err := upload(ns, "BenchmarkThree 1 ns/op\n"); err == nil {
+			t.Errorf("upload to %s succeeded, want error", ns)
+		}
+	}
+
+	tests := []struct {
+		ns, q   string
+		want    []string // benchmarks in the results
+		wantErr bool
+	}{
+		{"", "key>", []string{"BenchmarkOne"}, false},
+		{"", "key:secret", nil, false},
+		{"secret", "key>", []string{"BenchmarkTwo"}, false},
+		{"readonly", "key>", nil, false},
+		{"others", "key>", nil, true},
+		{"unknown", "key>", nil, true},
+	}
+	for _, test := range tests {
+		res, err := query(test.ns, test.q)
+		if (err != nil) != test.wantErr {
+			t.Errorf("query %q in namespace %q: err = %v, want error %v", test.q, test.ns, err, test.wantErr)
+			continue
+		}
+		for _, b := range []string{"BenchmarkOne", "BenchmarkTwo", "BenchmarkThree"} {
+			want := false
+			for _, w := range test.want {
+				want = want || w == b
+			}
+			if got := strings.Contains(res, b); got != want {
+				t.Errorf("query %q in namespace %q: has %s = %v, want %v\n%s", test.q, test.ns, b, got, want, res)
+			}
+		}
+	}
+
+	c := &perfdata.Client{BaseURL: app.srv.URL, Namespace: "secret"}
+	ul := c.ListUploads(ctx, "", nil, 0)
+	var ids []string
+	for ul.Next() {
+		ids = append(ids, ul.Info().UploadID)
+	}
+	if err := ul.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 1 || ids[0] != status.UploadID {
+		t.Errorf("uploads in secret = %v, want [%s]", ids, status.UploadID)
+	}
+}
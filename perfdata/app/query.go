@@ -12,6 +12,9 @@ import (
 	"golang.org/x/perf/storage/benchfmt"
 )
 
+// search serves the results matching the query parameter q on /search,
+// in the private namespace given by the query parameter namespace, if
+// any.
 func (a *App) search(w http.ResponseWriter, r *http.Request) {
 	ctx := requestContext(r)
 
@@ -25,8 +28,12 @@ func (a *App) search(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "missing q parameter", 400)
 		return
 	}
+	ns := r.Form.Get("namespace")
+	if !a.checkNamespace(w, r, ns, "", false) {
+		return
+	}
 
-	query := a.DB.Query(q)
+	query := a.DB.QueryNamespace(ns, q)
 	defer query.Close()
 
 	infof(ctx, "query: %s", query.Debug())
@@ -52,6 +59,8 @@ func (a *App) search(w http.ResponseWriter, r *http.Request) {
 // The lines are sorted in order from most to least recent.
 // If the query parameter limit is provided, only the most recent limit upload IDs are returned.
 // If limit is not provided, the most recent 1000 upload IDs are returned.
+// If the query parameter namespace is provided, the uploads of that
+// private namespace are listed instead of the public ones.
 func (a *App) uploads(w http.ResponseWriter, r *http.Request) {
 	ctx := requestContext(r)
 
@@ -61,6 +70,10 @@ func (a *App) uploads(w http.ResponseWriter, r *http.Request) {
 	}
 
 	q := r.Form.Get("q")
+	ns := r.Form.Get("namespace")
+	if !a.checkNamespace(w, r, ns, "", false) {
+		return
+	}
 
 	limit := 1000
 	limitStr := r.Form.Get("limit")
@@ -73,7 +86,7 @@ func (a *App) uploads(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	res := a.DB.ListUploads(q, r.Form["extra_label"], limit)
+	res := a.DB.ListUploadsNamespace(ns, q, r.Form["extra_label"], limit)
 	defer res.Close()
 
 	infof(ctx, "query: %s", res.Debug())
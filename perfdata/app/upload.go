@@ -47,6 +47,13 @@ func (a *App) upload(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// The namespace is in the URL, as parsing the form would read the
+	// uploaded files into memory.
+	ns := r.URL.Query().Get("namespace")
+	if !a.checkNamespace(w, r, ns, user, true) {
+		return
+	}
+
 	// We use r.MultipartReader instead of r.ParseForm to avoid
 	// storing uploaded data in memory.
 	mr, err := r.MultipartReader()
@@ -56,7 +63,7 @@ func (a *App) upload(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	result, err := a.processUpload(ctx, user, mr)
+	result, err := a.processUpload(ctx, user, ns, mr)
 	if err != nil {
 		errorf(ctx, "%v", err)
 		http.Error(w, err.Error(), 500)
@@ -82,8 +89,9 @@ type uploadStatus struct {
 }
 
 // processUpload takes one or more files from a multipart.Reader,
-// writes them to the filesystem, and indexes their content.
-func (a *App) processUpload(ctx context.Context, user string, mr *multipart.Reader) (*uploadStatus, error) {
+// writes them to the filesystem, and indexes their content in the
+// namespace ns.
+func (a *App) processUpload(ctx context.Context, user, ns string, mr *multipart.Reader) (*uploadStatus, error) {
 	var upload *db.Upload
 	var fileids []string
 
@@ -108,7 +116,7 @@ func (a *App) processUpload(ctx context.Context, user string, mr *multipart.Read
 
 		if upload == nil {
 			var err error
-			upload, err = a.DB.NewUpload(ctx)
+			upload, err = a.DB.NewUploadInNamespace(ctx, ns)
 			if err != nil {
 				return nil, err
 			}
@@ -139,6 +147,9 @@ func (a *App) processUpload(ctx context.Context, user string, mr *multipart.Read
 		if user != "" {
 			meta["by"] = user
 		}
+		if ns != "" {
+			meta["namespace"] = ns
+		}
 
 		// We need to do two things with the incoming data:
 		// - Write it to permanent storage via a.FS
@@ -161,7 +172,8 @@ func (a *App) processUpload(ctx context.Context, user string, mr *multipart.Read
 	}
 
 	status := &uploadStatus{UploadID: upload.ID, FileIDs: fileids}
-	if a.ViewURLBase != "" {
+	// The viewer only shows public results.
+	if a.ViewURLBase != "" && ns == "" {
 		status.ViewURL = a.ViewURLBase + url.QueryEscape(upload.ID)
 	}
 
@@ -202,10 +214,15 @@ func (a *App) indexFile(ctx context.Context, upload *db.Upload, p io.Reader, met
 	tr := io.TeeReader(p, fw)
 	br := benchfmt.NewReader(tr)
 	br.AddLabels(meta)
+	hw := make(map[string]string) // builder -> hardware-id
 	i := 0
 	for br.Next() {
 		i++
-		if err := upload.InsertRecord(br.Result()); err != nil {
+		res, err := attachHardware(upload, br.Result(), hw)
+		if err != nil {
+			return err
+		}
+		if err := upload.InsertRecord(res); err != nil {
 			return err
 		}
 	}
@@ -217,3 +234,34 @@ func (a *App) indexFile(ctx context.Context, upload *db.Upload, p io.Reader, met
 	}
 	return nil
 }
+
+// attachHardware returns res with a "hardware-id" label identifying
+// the current hardware of the builder named by its "builder" label.
+// res is returned unchanged if it has no builder, already names its
+// hardware, or the builder has no recorded hardware. hw caches the
+// hardware IDs of builders seen so far.
+func attachHardware(upload *db.Upload, res *benchfmt.Result, hw map[string]string) (*benchfmt.Result, error) {
+	builder := res.Labels["builder"]
+	if builder == "" || res.Labels["hardware-id"] != "" {
+		return res, nil
+	}
+	id, ok := hw[builder]
+	if !ok {
+		h, err := upload.CurrentHardware(builder)
+		if err != nil {
+			return nil, err
+		}
+		if h != nil {
+			id = h.ID
+		}
+		hw[builder] = id
+	}
+	if id == "" {
+		return res, nil
+	}
+	// The reader reuses Labels between results, so don't modify it.
+	res2 := *res
+	res2.Labels = res.Labels.Copy()
+	res2.Labels["hardware-id"] = id
+	return &res2, nil
+}
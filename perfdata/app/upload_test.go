@@ -16,9 +16,11 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
+	"golang.org/x/build/perfdata"
 	"golang.org/x/build/perfdata/db"
 	"golang.org/x/build/perfdata/db/dbtest"
 	_ "golang.org/x/build/perfdata/db/sqlite3"
@@ -124,3 +126,49 @@ func TestUpload(t *testing.T) {
 		t.Errorf("/upload wrote %d files, want 1", len(app.fs.Files()))
 	}
 }
+
+func TestUploadHardware(t *testing.T) {
+	app := createTestApp(t)
+	defer app.Close()
+
+	resp, err := http.Post(app.srv.URL+"/hardware", "application/json", strings.NewReader(`{"builder": "linux-amd64-perf", "cpu": "Intel Xeon", "memory": "16GiB", "kernel": "Linux 6.1.0"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		t.Fatalf("post /hardware: %v", resp.Status)
+	}
+	var hw perfdata.Hardware
+	if err := json.NewDecoder(resp.Body).Decode(&hw); err != nil {
+		t.Fatalf("decoding /hardware response: %v", err)
+	}
+	if hw.ID == "" {
+		t.Fatalf("/hardware response has no ID: %+v", hw)
+	}
+
+	status := app.uploadFiles(t, func(mpw *multipart.Writer) {
+		w, err := mpw.CreateFormFile("file", "1.txt")
+		if err != nil {
+			t.Errorf("CreateFormFile: %v", err)
+		}
+		fmt.Fprintf(w, "builder: linux-amd64-perf\nBenchmarkOne 5 ns/op\nbuilder: windows-amd64-perf\nBenchmarkTwo 10 ns/op\n")
+	})
+
+	q := app.db.Query("upload:" + status.UploadID)
+	defer q.Close()
+	want := map[string]string{"linux-amd64-perf": hw.ID, "windows-amd64-perf": ""}
+	n := 0
+	for ; q.Next(); n++ {
+		r := q.Result()
+		if got, want := r.Labels["hardware-id"], want[r.Labels["builder"]]; got != want {
+			t.Errorf("result for builder %q has hardware-id %q, want %q", r.Labels["builder"], got, want)
+		}
+	}
+	if err := q.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("upload has %d results, want 2", n)
+	}
+}
@@ -7,6 +7,7 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
@@ -110,6 +111,11 @@ func oauthServiceUser(ctx context.Context, r *http.Request) (string, error) {
 	return info.Email, nil
 }
 
+// namespaces are the private namespaces, from the JSON object in the
+// environment variable PERFDATA_NAMESPACES, which maps names to
+// app.Namespace values.
+var namespaces map[string]*app.Namespace
+
 // appHandler is the default handler, registered to serve "/".
 // It creates a new App instance using the appengine Context and then
 // dispatches the request to the App. The environment variable
@@ -145,12 +151,17 @@ func appHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	mux := http.NewServeMux()
-	app := &app.App{DB: db, FS: fs, Auth: auth, ViewURLBase: os.Getenv("PERFDATA_VIEW_URL_BASE")}
+	app := &app.App{DB: db, FS: fs, Auth: auth, ViewURLBase: os.Getenv("PERFDATA_VIEW_URL_BASE"), Namespaces: namespaces}
 	app.RegisterOnMux(mux)
 	mux.ServeHTTP(w, r)
 }
 
 func main() {
+	if v := os.Getenv("PERFDATA_NAMESPACES"); v != "" {
+		if err := json.Unmarshal([]byte(v), &namespaces); err != nil {
+			log.Fatalf("parsing PERFDATA_NAMESPACES: %v", err)
+		}
+	}
 	http.HandleFunc("/", appHandler)
 	appengine.Main()
 }
@@ -6,6 +6,7 @@
 package perfdata
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -26,6 +27,10 @@ type Client struct {
 	BaseURL string
 	// HTTPClient is the HTTP client for sending requests. If nil, http.DefaultClient will be used.
 	HTTPClient *http.Client
+	// Namespace, if non-empty, is the private namespace that uploads
+	// go to and queries search, instead of the public one. The server
+	// must grant the user of HTTPClient access to it.
+	Namespace string
 }
 
 // httpClient returns the http.Client to use for requests.
@@ -48,7 +53,11 @@ func (c *Client) httpClient() *http.Client {
 func (c *Client) Query(ctx context.Context, q string) (io.ReadCloser, error) {
 	hc := c.httpClient()
 
-	resp, err := ctxhttp.Get(ctx, hc, c.BaseURL+"/search?"+url.Values{"q": []string{q}}.Encode())
+	v := url.Values{"q": []string{q}}
+	if c.Namespace != "" {
+		v["namespace"] = []string{c.Namespace}
+	}
+	resp, err := ctxhttp.Get(ctx, hc, c.BaseURL+"/search?"+v.Encode())
 	if err != nil {
 		return nil, err
 	}
@@ -85,6 +94,9 @@ func (c *Client) ListUploads(ctx context.Context, q string, extraLabels []string
 	if limit != 0 {
 		v["limit"] = []string{fmt.Sprintf("%d", limit)}
 	}
+	if c.Namespace != "" {
+		v["namespace"] = []string{c.Namespace}
+	}
 
 	u := c.BaseURL + "/uploads"
 	if len(v) > 0 {
@@ -162,6 +174,83 @@ func (ul *UploadList) Close() error {
 	return ul.Err()
 }
 
+// Hardware describes a machine that runs benchmarks. The storage
+// server keeps an inventory of the hardware of each builder, and
+// labels each result that has a "builder" label with the ID of the
+// builder's current hardware as "hardware-id". Queries can match on
+// the hardware of results with keys like "hardware.cpu", so that
+// hardware changes can be told apart from performance changes.
+type Hardware struct {
+	// ID is the inventory ID assigned by the server. It's the same
+	// for any machines with identical descriptions.
+	ID string `json:"id,omitempty"`
+
+	Builder   string `json:"builder"`             // value of the "builder" label in the machine's results
+	CPU       string `json:"cpu"`                 // like "Intel(R) Xeon(R) CPU @ 2.30GHz"
+	Memory    string `json:"memory"`              // like "64GiB"
+	Kernel    string `json:"kernel"`              // like "Linux 6.1.0-13-cloud-amd64"
+	Microcode string `json:"microcode,omitempty"` // like "0xb000040"
+
+	// FirstSeen and LastSeen are when the server was first and
+	// most recently told that Builder has this hardware, in RFC 3339
+	// format.
+	FirstSeen string `json:"first_seen,omitempty"`
+	LastSeen  string `json:"last_seen,omitempty"`
+}
+
+// RecordHardware tells the storage server that h.Builder currently has
+// the hardware described by h, and returns the server's inventory
+// entry for it. Builders should call it before uploading results and
+// whenever their hardware may have changed.
+func (c *Client) RecordHardware(ctx context.Context, h *Hardware) (*Hardware, error) {
+	body, err := json.Marshal(h)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest("POST", c.BaseURL+"/hardware", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := ctxhttp.Do(ctx, c.httpClient(), req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return nil, fmt.Errorf("recording hardware failed: %v\n%s", resp.Status, body)
+	}
+	got := new(Hardware)
+	if err := json.NewDecoder(resp.Body).Decode(got); err != nil {
+		return nil, err
+	}
+	return got, nil
+}
+
+// ListHardware returns the hardware inventory of builder, or of all
+// builders if builder is empty, most recently seen first.
+func (c *Client) ListHardware(ctx context.Context, builder string) ([]*Hardware, error) {
+	u := c.BaseURL + "/hardware"
+	if builder != "" {
+		u += "?" + url.Values{"builder": []string{builder}}.Encode()
+	}
+	resp, err := ctxhttp.Get(ctx, c.httpClient(), u)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return nil, fmt.Errorf("%s", body)
+	}
+	var hw []*Hardware
+	if err := json.NewDecoder(resp.Body).Decode(&hw); err != nil {
+		return nil, err
+	}
+	return hw, nil
+}
+
 // NewUpload starts a new upload to the storage server.
 // The upload must have Abort or Commit called on it.
 // If the server requires authentication for uploads, c.HTTPClient should be set to the result of oauth2.NewClient.
@@ -171,7 +260,11 @@ func (c *Client) NewUpload(ctx context.Context) *Upload {
 	pr, pw := io.Pipe()
 	mpw := multipart.NewWriter(pw)
 
-	req, err := http.NewRequest("POST", c.BaseURL+"/upload", pr)
+	uploadURL := c.BaseURL + "/upload"
+	if c.Namespace != "" {
+		uploadURL += "?" + url.Values{"namespace": []string{c.Namespace}}.Encode()
+	}
+	req, err := http.NewRequest("POST", uploadURL, pr)
 	if err != nil {
 		return &Upload{err: err}
 	}
@@ -107,6 +107,33 @@ CREATE TABLE IF NOT EXISTS RecordLabels (
 {{if .sqlite3}}
 CREATE INDEX IF NOT EXISTS RecordLabelsNameValue ON RecordLabels(Name, Value);
 {{end}}
+CREATE TABLE IF NOT EXISTS Hardware (
+	InventoryID VARCHAR(20) PRIMARY KEY,
+	Builder VARCHAR(255) NOT NULL,
+	CPU VARCHAR(255) NOT NULL,
+	Memory VARCHAR(64) NOT NULL,
+	Kernel VARCHAR(255) NOT NULL,
+	Microcode VARCHAR(64) NOT NULL,
+	FirstSeen VARCHAR(32) NOT NULL,
+	LastSeen VARCHAR(32) NOT NULL
+{{if not .sqlite3}}
+	, Index (Builder, LastSeen)
+{{end}}
+);
+{{if .sqlite3}}
+CREATE INDEX IF NOT EXISTS HardwareBuilderLastSeen ON Hardware(Builder, LastSeen);
+{{end}}
+CREATE TABLE IF NOT EXISTS UploadNamespaces (
+	UploadID VARCHAR(20) PRIMARY KEY,
+	Namespace VARCHAR(64) NOT NULL,
+	FOREIGN KEY (UploadID) REFERENCES Uploads(UploadID) ON UPDATE CASCADE ON DELETE CASCADE
+{{if not .sqlite3}}
+	, Index (Namespace)
+{{end}}
+);
+{{if .sqlite3}}
+CREATE INDEX IF NOT EXISTS UploadNamespacesNamespace ON UploadNamespaces(Namespace);
+{{end}}
 `))
 
 // createTables creates any missing tables on the connection in
@@ -159,6 +186,9 @@ type Upload struct {
 	// ID is the value of the "upload" key that should be
 	// associated with every record in this upload.
 	ID string
+	// Namespace is the private namespace of the upload, or "" if
+	// it's public.
+	Namespace string
 
 	// recordid is the index of the next record to insert.
 	recordid int64
@@ -215,6 +245,13 @@ func (db *DB) ReplaceUpload(id string) (*Upload, error) {
 // NewUpload returns an upload for storing new files.
 // All records written to the Upload will have the same upload ID.
 func (db *DB) NewUpload(ctx context.Context) (*Upload, error) {
+	return db.NewUploadInNamespace(ctx, "")
+}
+
+// NewUploadInNamespace is like NewUpload, but the records of the
+// upload are in the private namespace ns. They're only returned by
+// queries of that namespace. If ns is "", the upload is public.
+func (db *DB) NewUploadInNamespace(ctx context.Context, ns string) (*Upload, error) {
 	day := now().UTC().Format("20060102")
 
 	num := 0
@@ -260,10 +297,17 @@ func (db *DB) NewUpload(ctx context.Context) (*Upload, error) {
 	if err != nil {
 		return nil, err
 	}
+	if ns != "" {
+		if _, err := utx.Exec("INSERT INTO UploadNamespaces(UploadID, Namespace) VALUES (?, ?)", id, ns); err != nil {
+			utx.Rollback()
+			return nil, err
+		}
+	}
 	u := &Upload{
-		ID: id,
-		db: db,
-		tx: utx,
+		ID:        id,
+		Namespace: ns,
+		db:        db,
+		tx:        utx,
 	}
 	return u, nil
 }
@@ -394,7 +438,17 @@ func parseQuery(q string) (sql []string, args []interface{}, err error) {
 	return
 }
 
-// Query searches for results matching the given query string.
+// namespaceCond returns an SQL condition, and its arguments, that the
+// upload ID in column col is in the namespace ns. Uploads without a
+// namespace are in the public namespace "".
+func namespaceCond(col, ns string) (string, []interface{}) {
+	if ns == "" {
+		return col + " NOT IN (SELECT UploadID FROM UploadNamespaces)", nil
+	}
+	return col + " IN (SELECT UploadID FROM UploadNamespaces WHERE Namespace = ?)", []interface{}{ns}
+}
+
+// Query searches for public results matching the given query string.
 //
 // The query string is first parsed into quoted words (as in the shell)
 // and then each word must be formatted as one of the following:
@@ -402,6 +456,12 @@ func parseQuery(q string) (sql []string, args []interface{}, err error) {
 // key>value - value greater than (useful for dates)
 // key<value - value less than (also useful for dates)
 func (db *DB) Query(q string) *Query {
+	return db.QueryNamespace("", q)
+}
+
+// QueryNamespace is like Query, but searches the results in the
+// namespace ns.
+func (db *DB) QueryNamespace(ns, q string) *Query {
 	ret := &Query{q: q}
 
 	query := "SELECT r.Content FROM "
@@ -428,6 +488,9 @@ func (db *DB) Query(q string) *Query {
 	if len(sql) > 0 {
 		query += " USING (UploadID, RecordID)"
 	}
+	cond, nsArgs := namespaceCond("r.UploadID", ns)
+	query += " WHERE " + cond
+	args = append(args, nsArgs...)
 
 	ret.sqlQuery, ret.sqlArgs = query, args
 	ret.rows, ret.err = db.sql.Query(query, args...)
@@ -578,11 +641,17 @@ func (ul *UploadList) Debug() string {
 	return ret
 }
 
-// ListUploads searches for uploads containing results matching the given query string.
+// ListUploads searches for public uploads containing results matching the given query string.
 // The query may be empty, in which case all uploads will be returned.
 // For each label in extraLabels, one unspecified record's value will be obtained for each upload.
 // If limit is non-zero, only the limit most recent uploads will be returned.
 func (db *DB) ListUploads(q string, extraLabels []string, limit int) *UploadList {
+	return db.ListUploadsNamespace("", q, extraLabels, limit)
+}
+
+// ListUploadsNamespace is like ListUploads, but searches the uploads
+// in the namespace ns.
+func (db *DB) ListUploadsNamespace(ns, q string, extraLabels []string, limit int) *UploadList {
 	ret := &UploadList{q: q, extraLabels: extraLabels}
 
 	var args []interface{}
@@ -598,12 +667,14 @@ func (db *DB) ListUploads(q string, extraLabels []string, limit int) *UploadList
 	}
 	if len(sql) == 0 {
 		// Optimize empty query.
-		query += " FROM (SELECT UploadID, (SELECT COUNT(*) FROM Records r WHERE r.UploadID = u.UploadID) AS rCount FROM Uploads u "
+		cond, nsArgs := namespaceCond("u.UploadID", ns)
+		query += " FROM (SELECT UploadID, (SELECT COUNT(*) FROM Records r WHERE r.UploadID = u.UploadID) AS rCount FROM Uploads u WHERE " + cond
+		args = append(args, nsArgs...)
 		switch db.driverName {
 		case "sqlite3":
-			query += "WHERE"
+			query += " AND"
 		default:
-			query += "HAVING"
+			query += " HAVING"
 		}
 		query += " rCount > 0 ORDER BY u.Day DESC, u.Seq DESC, u.UploadID DESC"
 		if limit != 0 {
@@ -624,8 +695,10 @@ func (db *DB) ListUploads(q string, extraLabels []string, limit int) *UploadList
 			}
 		}
 
+		cond, nsArgs := namespaceCond("j.UploadID", ns)
 		query += " LEFT JOIN Records r USING (UploadID, RecordID)"
-		query += " GROUP BY UploadID) j LEFT JOIN Uploads u USING (UploadID) ORDER BY u.Day DESC, u.Seq DESC, u.UploadID DESC"
+		query += " GROUP BY UploadID) j LEFT JOIN Uploads u USING (UploadID) WHERE " + cond + " ORDER BY u.Day DESC, u.Seq DESC, u.UploadID DESC"
+		args = append(args, nsArgs...)
 		if limit != 0 {
 			query += fmt.Sprintf(" LIMIT %d", limit)
 		}
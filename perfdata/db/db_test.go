@@ -19,6 +19,7 @@ import (
 	"time"
 
 	"golang.org/x/build/internal/diff"
+	"golang.org/x/build/perfdata"
 	. "golang.org/x/build/perfdata/db"
 	"golang.org/x/build/perfdata/db/dbtest"
 	"golang.org/x/perf/storage/benchfmt"
@@ -428,3 +429,172 @@ func TestListUploads(t *testing.T) {
 		})
 	}
 }
+
+// TestHardware verifies that hardware is recorded with stable IDs and
+// can be queried through the "hardware-id" label.
+func TestHardware(t *testing.T) {
+	db, cleanup := dbtest.NewDB(t)
+	defer cleanup()
+
+	defer SetNow(time.Time{})
+
+	record := func(sec int64, h perfdata.Hardware) *perfdata.Hardware {
+		t.Helper()
+		SetNow(time.Unix(sec, 0))
+		rec, err := db.RecordHardware(&h)
+		if err != nil {
+			t.Fatalf("RecordHardware: %v", err)
+		}
+		return rec
+	}
+	h := perfdata.Hardware{Builder: "linux-amd64-perf", CPU: "Intel Xeon @ 2.20GHz", Memory: "16GiB", Kernel: "Linux 6.1.0"}
+	first := record(0, h)
+	again := record(60, h)
+	if first.ID == "" || again.ID != first.ID {
+		t.Errorf("recording the same hardware twice gave IDs %q and %q, want equal and non-empty", first.ID, again.ID)
+	}
+	if again.FirstSeen != first.FirstSeen || again.LastSeen == first.LastSeen {
+		t.Errorf("rerecorded hardware = %+v, want FirstSeen %s and a later LastSeen", again, first.FirstSeen)
+	}
+	h.Kernel = "Linux 6.5.0"
+	upgraded := record(120, h)
+	if upgraded.ID == first.ID {
+		t.Errorf("upgraded kernel kept hardware ID %q", first.ID)
+	}
+
+	cur, err := db.CurrentHardware("linux-amd64-perf")
+	if err != nil || cur == nil || cur.ID != upgraded.ID {
+		t.Errorf("CurrentHardware = %+v, %v, want ID %q", cur, err, upgraded.ID)
+	}
+	if cur, err := db.CurrentHardware("darwin-arm64-perf"); err != nil || cur != nil {
+		t.Errorf("CurrentHardware(unknown builder) = %+v, %v, want nil, nil", cur, err)
+	}
+	list, err := db.ListHardware("")
+	if err != nil {
+		t.Fatalf("ListHardware: %v", err)
+	}
+	if len(list) != 2 || list[0].ID != upgraded.ID || list[1].ID != first.ID {
+		t.Errorf("ListHardware = %v, want IDs %q, %q", list, upgraded.ID, first.ID)
+	}
+
+	u, err := db.NewUpload(context.Background())
+	if err != nil {
+		t.Fatalf("NewUpload: %v", err)
+	}
+	for i, id := range []string{first.ID, upgraded.ID, ""} {
+		r := &benchfmt.Result{Labels: map[string]string{"i": strconv.Itoa(i), "upload": u.ID}, NameLabels: map[string]string{"name": "Name"}, Content: "BenchmarkName 1 ns/op"}
+		if id != "" {
+			r.Labels["hardware-id"] = id
+		}
+		if err := u.InsertRecord(r); err != nil {
+			t.Fatalf("InsertRecord: %v", err)
+		}
+	}
+	if err := u.Commit(); err != nil {
+		t.Fatalf("Commit: %v", err)
+	}
+
+	tests := []struct {
+		q    string
+		want []string // values of the "i" label
+	}{
+		{"hardware.builder:linux-amd64-perf", []string{"0", "1"}},
+		{"hardware.kernel:Linux\\ 6.5.0", []string{"1"}},
+		{"hardware.kernel<Linux\\ 6.5", []string{"0"}},
+		{"hardware.cpu>", []string{"0", "1"}},
+		{"hardware.memory:32GiB", nil},
+		{"hardware.builder:linux-amd64-perf i:0", []string{"0"}},
+	}
+	for _, test := range tests {
+		t.Run("query="+test.q, func(t *testing.T) {
+			q := db.Query(test.q)
+			defer q.Close()
+			var have []string
+			for q.Next() {
+				have = append(have, q.Result().Labels["i"])
+			}
+			if err := q.Err(); err != nil {
+				t.Fatalf("Err() = %v, want nil", err)
+			}
+			sort.Strings(have)
+			if !reflect.DeepEqual(have, test.want) {
+				t.Errorf("i[] = %v, want %v", have, test.want)
+			}
+		})
+	}
+
+	q := db.Query("hardware.bogus:x")
+	if q.Next() || q.Err() == nil {
+		t.Errorf("query with unknown hardware field succeeded")
+	}
+	q.Close()
+}
+
+// TestNamespaces verifies that the records of uploads in a private
+// namespace are only found by queries of that namespace.
+func TestNamespaces(t *testing.T) {
+	SetNow(time.Unix(0, 0))
+	defer SetNow(time.Time{})
+	db, cleanup := dbtest.NewDB(t)
+	defer cleanup()
+
+	for _, ns := range []string{"", "secret", "other", ""} {
+		u, err := db.NewUploadInNamespace(context.Background(), ns)
+		if err != nil {
+			t.Fatalf("NewUploadInNamespace(%q): %v", ns, err)
+		}
+		if err := u.InsertRecord(&benchfmt.Result{
+			Labels:  benchfmt.Labels{"key": "value", "ns": ns, "upload": u.ID},
+			Content: "BenchmarkName 1 ns/op",
+		}); err != nil {
+			t.Fatalf("InsertRecord: %v", err)
+		}
+		if err := u.Commit(); err != nil {
+			t.Fatalf("Commit: %v", err)
+		}
+	}
+
+	tests := []struct {
+		ns, q string
+		want  []string // upload IDs
+	}{
+		{"", "", []string{"19700101.1", "19700101.4"}},
+		{"", "key:value", []string{"19700101.1", "19700101.4"}},
+		{"", "ns:secret", nil},
+		{"secret", "", []string{"19700101.2"}},
+		{"secret", "key:value", []string{"19700101.2"}},
+		{"other", "key:value", []string{"19700101.3"}},
+		{"unknown", "", nil},
+	}
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("ns=%s/query=%s", test.ns, test.q), func(t *testing.T) {
+			q := db.QueryNamespace(test.ns, test.q)
+			var have []string
+			for q.Next() {
+				have = append(have, q.Result().Labels["upload"])
+			}
+			if err := q.Err(); err != nil {
+				t.Fatalf("Query Err() = %v", err)
+			}
+			q.Close()
+			sort.Strings(have)
+			if !reflect.DeepEqual(have, test.want) {
+				t.Errorf("QueryNamespace uploads = %v, want %v", have, test.want)
+			}
+
+			ul := db.ListUploadsNamespace(test.ns, test.q, nil, 0)
+			have = nil
+			for ul.Next() {
+				have = append(have, ul.Info().UploadID)
+			}
+			if err := ul.Err(); err != nil {
+				t.Fatalf("ListUploads Err() = %v", err)
+			}
+			ul.Close()
+			sort.Strings(have)
+			if !reflect.DeepEqual(have, test.want) {
+				t.Errorf("ListUploadsNamespace = %v, want %v", have, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package db
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"golang.org/x/build/perfdata"
+)
+
+// hardwareID returns the inventory ID for h, which is derived from
+// the builder and its hardware description so that recording the
+// same hardware twice yields the same ID.
+func hardwareID(h *perfdata.Hardware) string {
+	sum := sha256.Sum256([]byte(strings.Join([]string{h.Builder, h.CPU, h.Memory, h.Kernel, h.Microcode}, "\x00")))
+	return hex.EncodeToString(sum[:8])
+}
+
+// RecordHardware records that h.Builder is running on the hardware
+// described by h. If the same hardware was recorded before, its
+// LastSeen time is updated; otherwise a new inventory entry is
+// created. The returned Hardware has its ID and times filled in.
+func (db *DB) RecordHardware(h *perfdata.Hardware) (*perfdata.Hardware, error) {
+	rec := *h
+	rec.ID = hardwareID(h)
+	t := now().UTC().Format(time.RFC3339)
+
+	tx, err := db.sql.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	err = tx.QueryRow("SELECT FirstSeen FROM Hardware WHERE InventoryID = ?", rec.ID).Scan(&rec.FirstSeen)
+	switch err {
+	case nil:
+		_, err = tx.Exec("UPDATE Hardware SET LastSeen = ? WHERE InventoryID = ?", t, rec.ID)
+	case sql.ErrNoRows:
+		rec.FirstSeen = t
+		_, err = tx.Exec("INSERT INTO Hardware(InventoryID, Builder, CPU, Memory, Kernel, Microcode, FirstSeen, LastSeen) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+			rec.ID, rec.Builder, rec.CPU, rec.Memory, rec.Kernel, rec.Microcode, t, t)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	rec.LastSeen = t
+	return &rec, nil
+}
+
+// CurrentHardware returns the most recently seen hardware for
+// builder, or nil if none has been recorded.
+func (db *DB) CurrentHardware(builder string) (*perfdata.Hardware, error) {
+	return currentHardware(db.sql, builder)
+}
+
+// CurrentHardware is like DB.CurrentHardware, but runs in u's
+// transaction.
+func (u *Upload) CurrentHardware(builder string) (*perfdata.Hardware, error) {
+	return currentHardware(u.tx, builder)
+}
+
+func currentHardware(q queryer, builder string) (*perfdata.Hardware, error) {
+	hw, err := queryHardware(q, "SELECT InventoryID, Builder, CPU, Memory, Kernel, Microcode, FirstSeen, LastSeen FROM Hardware WHERE Builder = ? ORDER BY LastSeen DESC LIMIT 1", builder)
+	if err != nil || len(hw) == 0 {
+		return nil, err
+	}
+	return hw[0], nil
+}
+
+// ListHardware returns the hardware inventory, most recently seen
+// first. If builder is non-empty, only hardware for that builder is
+// returned.
+func (db *DB) ListHardware(builder string) ([]*perfdata.Hardware, error) {
+	const q = "SELECT InventoryID, Builder, CPU, Memory, Kernel, Microcode, FirstSeen, LastSeen FROM Hardware"
+	if builder == "" {
+		return queryHardware(db.sql, q+" ORDER BY LastSeen DESC, InventoryID")
+	}
+	return queryHardware(db.sql, q+" WHERE Builder = ? ORDER BY LastSeen DESC, InventoryID", builder)
+}
+
+// queryer is implemented by *sql.DB and *sql.Tx.
+type queryer interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+func queryHardware(q queryer, query string, args ...interface{}) ([]*perfdata.Hardware, error) {
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var hw []*perfdata.Hardware
+	for rows.Next() {
+		h := new(perfdata.Hardware)
+		if err := rows.Scan(&h.ID, &h.Builder, &h.CPU, &h.Memory, &h.Kernel, &h.Microcode, &h.FirstSeen, &h.LastSeen); err != nil {
+			return nil, err
+		}
+		hw = append(hw, h)
+	}
+	return hw, rows.Err()
+}
@@ -145,6 +145,9 @@ func (p part) sql() (sql string, args []interface{}, err error) {
 			return "SELECT UploadID, RecordID FROM Records WHERE UploadID < ? AND UploadID > ?", []interface{}{p.value, p.value2}, nil
 		}
 	}
+	if strings.HasPrefix(p.key, "hardware.") {
+		return p.hardwareSQL()
+	}
 	switch p.operator {
 	case equals:
 		if p.value == "" {
@@ -166,3 +169,44 @@ func (p part) sql() (sql string, args []interface{}, err error) {
 		panic("unknown operator " + string(p.operator))
 	}
 }
+
+// hardwareColumns maps the fields that can follow "hardware." in a
+// query key to columns of the Hardware table.
+var hardwareColumns = map[string]string{
+	"builder":    "Builder",
+	"cpu":        "CPU",
+	"memory":     "Memory",
+	"kernel":     "Kernel",
+	"microcode":  "Microcode",
+	"first_seen": "FirstSeen",
+	"last_seen":  "LastSeen",
+}
+
+// hardwareSQL returns a SQL expression and a list of arguments for
+// finding records whose "hardware-id" label names an inventory entry
+// matching p.
+func (p part) hardwareSQL() (sql string, args []interface{}, err error) {
+	col, ok := hardwareColumns[strings.TrimPrefix(p.key, "hardware.")]
+	if !ok {
+		return "", nil, fmt.Errorf("unknown hardware field in key %q", p.key)
+	}
+	const prefix = "SELECT rl.UploadID, rl.RecordID FROM RecordLabels rl INNER JOIN Hardware h ON rl.Value = h.InventoryID WHERE rl.Name = 'hardware-id'"
+	switch p.operator {
+	case equals:
+		if p.value == "" {
+			return "", nil, fmt.Errorf("missing value for key %q", p.key)
+		}
+		return prefix + " AND h." + col + " = ?", []interface{}{p.value}, nil
+	case lt:
+		return prefix + " AND h." + col + " < ?", []interface{}{p.value}, nil
+	case gt:
+		if p.value == "" {
+			return prefix, nil, nil
+		}
+		return prefix + " AND h." + col + " > ?", []interface{}{p.value}, nil
+	case ltgt:
+		return prefix + " AND h." + col + " < ? AND h." + col + " > ?", []interface{}{p.value, p.value2}, nil
+	default:
+		panic("unknown operator " + string(p.operator))
+	}
+}
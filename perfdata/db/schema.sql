@@ -24,3 +24,20 @@ CREATE TABLE RecordLabels (
        INDEX (Name(100), Value(100)),
        FOREIGN KEY (UploadId, RecordId) REFERENCES Records(UploadId, RecordId)
 );
+CREATE TABLE Hardware (
+       InventoryId VARCHAR(20) PRIMARY KEY,
+       Builder VARCHAR(255),
+       CPU VARCHAR(255),
+       Memory VARCHAR(64),
+       Kernel VARCHAR(255),
+       Microcode VARCHAR(64),
+       FirstSeen VARCHAR(32),
+       LastSeen VARCHAR(32),
+       INDEX (Builder, LastSeen)
+);
+CREATE TABLE UploadNamespaces (
+       UploadId VARCHAR(20) PRIMARY KEY,
+       Namespace VARCHAR(64),
+       INDEX (Namespace),
+       FOREIGN KEY (UploadId) REFERENCES Uploads(UploadId)
+);
@@ -119,6 +119,22 @@ func init() {
 	})
 }
 
+// ForNewGerritProject returns the Repo of proj, a Gerrit project that
+// isn't in ByGerritProject, assuming that it's a golang.org/x repo
+// that's mirrored to GitHub, as new projects nearly always are. The
+// coordinator doesn't build it and it isn't shown on the dashboard
+// until it's added to this package.
+//
+// The returned Repo isn't added to ByGerritProject or ByImportPath.
+func ForNewGerritProject(proj string) *Repo {
+	return &Repo{
+		GoGerritProject: proj,
+		MirrorToGitHub:  true,
+		ImportPath:      "golang.org/x/" + proj,
+		GitHubRepo:      "golang/" + proj,
+	}
+}
+
 type modifyRepo func(*Repo)
 
 // noDash is an option to the x func that marks the repo as hidden on
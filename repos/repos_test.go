@@ -10,3 +10,16 @@ func TestInitDoesNotPanic(t *testing.T) {
 	// Verify that repos.go's init funcs don't panic when
 	// validating the repos.
 }
+
+func TestForNewGerritProject(t *testing.T) {
+	r := ForNewGerritProject("newx")
+	if r.ImportPath != "golang.org/x/newx" || r.GitHubRepo != "golang/newx" || !r.MirrorToGitHub {
+		t.Errorf("ForNewGerritProject(%q) = %+v; want a golang.org/x repo mirrored to GitHub", "newx", r)
+	}
+	if r.CoordinatorCanBuild || r.ShowOnDashboard() {
+		t.Errorf("ForNewGerritProject(%q) = %+v; want it not built or on the dashboard", "newx", r)
+	}
+	if _, ok := ByGerritProject["newx"]; ok {
+		t.Errorf("ForNewGerritProject added %q to ByGerritProject", "newx")
+	}
+}
@@ -102,10 +102,69 @@ type BuildRecord struct {
 	FailureURL string `datastore:",noindex"` // deprecated; use LogURL
 	LogURL     string `datastore:",noindex"`
 
+	// ManifestURL is the URL of the JSON manifest of the
+	// environment the build ran in: its builder configuration,
+	// host image, environment variables and bootstrap toolchain.
+	// It's empty if the manifest couldn't be stored.
+	ManifestURL string `datastore:",noindex"`
+
+	// InfraFailure is whether a failed build failed because of the
+	// build infrastructure, such as losing its buildlet, rather
+	// than because the code being built or its tests failed.
+	InfraFailure bool
+
+	// CPUSeconds and PeakMemory are the resources used by the
+	// commands the build ran on its buildlets, as reported by them:
+	// their total user and system CPU time, and the largest peak
+	// resident set size, in bytes, of any of them. They're zero if
+	// the buildlets didn't report them.
+	CPUSeconds float64
+	PeakMemory int64
+
+	// ReadBytes and WriteBytes are the bytes the commands read from
+	// and wrote to storage, and NetBytes those received and sent on
+	// the buildlets' network interfaces while they ran. They're zero
+	// if the buildlets didn't report them.
+	ReadBytes  int64
+	WriteBytes int64
+	NetBytes   int64
+
 	// TODO(bradfitz): log which reverse buildlet we got?
 	// Buildlet string
 }
 
+// TryBotResult is the datastore entity recording the outcome of one
+// build of a TryBot run. Unlike BuildRecord, it identifies the CL and
+// patch set that was tested. The coordinator keeps these indefinitely
+// and serves them at https://farmer.golang.org/try/results.json, for
+// research into flakiness and the effectiveness of TryBots.
+type TryBotResult struct {
+	TryID     string `json:"tryID"`   // "T" + 9 random hex, shared by the builds of a TryBot run
+	Project   string `json:"project"` // "go", "net", etc.
+	Branch    string `json:"branch"`  // "master"
+	ChangeID  string `json:"changeID"`
+	CL        int    `json:"cl"` // Gerrit change number; 0 if it couldn't be looked up
+	Patchset  int    `json:"patchset"`
+	Commit    string `json:"commit"`
+	GoCommit  string `json:"goCommit,omitempty"` // for x/ repos, the Go commit built with
+	GoBranch  string `json:"goBranch,omitempty"` // for x/ repos, the branch of GoCommit
+	SubRepo   string `json:"subRepo,omitempty"`  // for Go CLs, the x/ repo built with the change, if any
+	SubCommit string `json:"subCommit,omitempty"`
+	SubBranch string `json:"subBranch,omitempty"` // the branch of SubCommit
+	Builder   string `json:"builder"`             // "linux-amd64-race"
+	IsSlowBot bool   `json:"isSlowBot"`
+	Result    string `json:"result"` // "ok" or "fail"
+
+	StartTime time.Time `json:"startTime"`
+	EndTime   time.Time `json:"endTime"`
+	Seconds   float64   `json:"seconds"`
+	LogURL    string    `json:"logURL" datastore:",noindex"`
+
+	// ManifestURL is the URL of the build's environment manifest,
+	// as in BuildRecord.
+	ManifestURL string `json:"manifestURL,omitempty" datastore:",noindex"`
+}
+
 type ReverseBuilder struct {
 	Name         string
 	HostType     string
@@ -152,6 +211,68 @@ func (s *ReverseBuilderStatus) Host(hostType string) *ReverseHostStatus {
 	return hs
 }
 
+// WireGuardRegistration is the JSON body a reverse buildlet POSTs to
+// the coordinator's /wireguard/register endpoint to join the
+// coordinator's WireGuard mesh.
+type WireGuardRegistration struct {
+	// PublicKey is the buildlet's base64-encoded WireGuard public key.
+	PublicKey string `json:"publicKey"`
+}
+
+// WireGuardConfig is the coordinator's response to a
+// WireGuardRegistration. It describes how the buildlet should
+// configure its end of the tunnel.
+type WireGuardConfig struct {
+	// Address is the buildlet's address within the mesh.
+	// The coordinator reaches the buildlet's HTTP server on port 80
+	// of this address.
+	Address string `json:"address"`
+	// Network is the mesh network in CIDR notation, such as
+	// "10.200.0.0/16". Traffic to it should be routed to the
+	// coordinator's peer.
+	Network string `json:"network"`
+	// CoordinatorPublicKey is the coordinator's base64-encoded
+	// WireGuard public key.
+	CoordinatorPublicKey string `json:"coordinatorPublicKey"`
+	// Endpoint is the host:port of the coordinator's WireGuard
+	// listener.
+	Endpoint string `json:"endpoint"`
+	// CoordinatorAddress is the coordinator's address within the mesh.
+	CoordinatorAddress string `json:"coordinatorAddress"`
+}
+
+// BuildletSelfTestHeader is the HTTP header in which a reverse
+// buildlet sends its JSON-encoded BuildletSelfTest when it registers
+// with the coordinator.
+const BuildletSelfTestHeader = "X-Go-Builder-Self-Test"
+
+// BuildletSelfTest is the result of the self-test a reverse buildlet
+// runs when it starts, along with a report of its capabilities.
+type BuildletSelfTest struct {
+	// Time is when the buildlet registered, by its own clock.
+	// The coordinator compares it to its clock to detect skew.
+	Time time.Time `json:"time"`
+
+	GOOS   string `json:"goos"`
+	GOARCH string `json:"goarch"`
+	NumCPU int    `json:"numCPU"`
+
+	// CC is the path of the C compiler, if one was found.
+	CC string `json:"cc,omitempty"`
+	// GoBootstrap is the output of "go version" for the toolchain
+	// in $GOROOT_BOOTSTRAP, if that's set.
+	GoBootstrap string `json:"goBootstrap,omitempty"`
+	// DiskMBps is the write throughput of the work directory,
+	// in MB/s, including a sync to disk.
+	DiskMBps float64 `json:"diskMBps"`
+	// CoordinatorRTT is how long it took to dial the coordinator.
+	CoordinatorRTT time.Duration `json:"coordinatorRTT"`
+
+	// Failures describes the checks that failed, if any.
+	// The coordinator doesn't schedule work on such buildlets.
+	Failures []string `json:"failures,omitempty"`
+}
+
 // MajorMinor is a major-minor version pair.
 type MajorMinor struct {
 	Major, Minor int
@@ -194,3 +315,37 @@ type ActivePostSubmitBuild struct {
 	GoCommit  string `json:"goCommit,omitempty"` // hash of Go commit, or empty for the main repo
 	StatusURL string `json:"statusURL"`
 }
+
+// ReleaseStatus is a summary of the release workflows relui is
+// running. relui publishes it as JSON so that the build dashboard and
+// devapp can show release progress to people without relui access.
+type ReleaseStatus struct {
+	Updated   time.Time               `json:"updated"`
+	Workflows []ReleaseWorkflowStatus `json:"workflows"`
+}
+
+// ReleaseWorkflowStatus is the status of a single in-progress relui
+// workflow.
+type ReleaseWorkflowStatus struct {
+	Name      string    `json:"name"`                // "Minor releases for Go 1.21 and 1.20"
+	Namespace string    `json:"namespace,omitempty"` // "releases"; see relui.Namespace
+	URL       string    `json:"url"`                 // relui page for the workflow
+	Started   time.Time `json:"started"`             // when the workflow was created
+
+	// Steps are the names of the tasks currently running or
+	// waiting for approval.
+	Steps []string `json:"steps"`
+	// Waiting is whether any of Steps is waiting for approval.
+	Waiting bool `json:"waiting,omitempty"`
+	// Failed is whether a task has failed and the workflow
+	// needs attention.
+	Failed bool `json:"failed,omitempty"`
+
+	TasksDone  int `json:"tasksDone"`
+	TasksTotal int `json:"tasksTotal"` // tasks created so far; may grow
+
+	// ETA is the estimated completion time, based on earlier runs of
+	// the same workflow. It is absent if there's no basis for an
+	// estimate.
+	ETA *time.Time `json:"eta,omitempty"`
+}
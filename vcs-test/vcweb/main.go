@@ -75,7 +75,9 @@ func main() {
 	http.Handle("/auth/", newAuthHandler(http.Dir(filepath.Join(*dir, "auth"))))
 
 	handler := logger(http.HandlerFunc(loadAndHandle))
-	log.Fatal(https.ListenAndServe(context.Background(), handler))
+	if err := https.ListenAndServe(context.Background(), handler); err != nil {
+		log.Fatal(err)
+	}
 }
 
 var nameRE = regexp.MustCompile(`^[a-zA-Z0-9_\-]+$`)